@@ -0,0 +1,408 @@
+// Package client is a Go client for the wallet server's REST API. It mirrors
+// the operations and schemas in the server's /api/openapi.json, so tools can
+// drive the wallet without depending on its internal packages.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls a wallet server.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+
+	// Session is the login session sent to multi-user servers. Login sets
+	// it; "wallet login" prints one to set here.
+	Session string
+
+	// Token is an API token sent to multi-user servers instead of a
+	// session. An approver token from WithApprover replaces it on the
+	// requests that carry one.
+	Token string
+}
+
+// New returns a client for the server at baseURL, e.g. "http://localhost:4322".
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// APIError is a non-2xx response from the server.
+type APIError struct {
+	StatusCode int
+	Message    string     `json:"error"`
+	Duplicate  *Duplicate `json:"duplicate,omitempty"` // set on 409 from endpoint add/update
+
+	ConfirmRequired bool `json:"confirm_required,omitempty"` // set on 428: resend with WithConfirmation
+
+	Revert *Revert `json:"revert,omitempty"` // set when a simulation, broadcast or RPC call reverted
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("wallet API: HTTP %d", e.StatusCode)
+	}
+	return e.Message
+}
+
+// do sends a JSON request and decodes a JSON response into out (if non-nil).
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	status, data, err := c.send(ctx, method, path, in)
+	if err != nil {
+		return err
+	}
+	if status < 200 || status >= 300 {
+		apiErr := &APIError{StatusCode: status}
+		_ = json.Unmarshal(data, apiErr)
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+type idempotencyKey struct{}
+
+// WithIdempotencyKey returns a context whose requests carry key as their
+// Idempotency-Key header. The server runs a send (Broadcast, ImportTx,
+// SignTx, VaultSend) at most once per key and answers retries with the
+// first result, so reuse the key when retrying after a network failure.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+type approverToken struct{}
+
+// WithApprover returns a context whose requests carry token, from
+// "wallet approvers add", as their bearer credentials. ApproveTx and RejectTx
+// need it for transactions that require two approvers.
+func WithApprover(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, approverToken{}, token)
+}
+
+type confirmation struct{}
+
+// WithConfirmation returns a context whose SignTx and VaultSend calls carry
+// conf, for sends at the server's CONFIRM_THRESHOLD.
+func WithConfirmation(ctx context.Context, conf Confirmation) context.Context {
+	return context.WithValue(ctx, confirmation{}, conf)
+}
+
+type private struct{}
+
+// WithPrivate returns a context whose Broadcast, SignTx, and VaultSend
+// calls send the transaction to a private endpoint of its chain, such as
+// Flashbots Protect, keeping it out of the public mempool. PrivateTx
+// follows it there.
+func WithPrivate(ctx context.Context) context.Context {
+	return context.WithValue(ctx, private{}, true)
+}
+
+// privateFrom reports whether ctx asks for private sends.
+func privateFrom(ctx context.Context) bool {
+	p, _ := ctx.Value(private{}).(bool)
+	return p
+}
+
+// confirmationFrom returns the confirmation carried by ctx, if any.
+func confirmationFrom(ctx context.Context) *Confirmation {
+	if conf, ok := ctx.Value(confirmation{}).(Confirmation); ok {
+		return &conf
+	}
+	return nil
+}
+
+// send sends a JSON request and returns the raw response.
+func (c *Client) send(ctx context.Context, method, path string, in any) (int, []byte, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return 0, nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return 0, nil, err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if key, _ := ctx.Value(idempotencyKey{}).(string); key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	if token, _ := ctx.Value(approverToken{}).(string); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if c.Session != "" {
+		req.AddCookie(&http.Cookie{Name: "wallet_session", Value: c.Session})
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+	return resp.StatusCode, data, nil
+}
+
+func pathEscape(s string) string { return url.PathEscape(s) }
+
+// Health reports the server's status and version.
+func (c *Client) Health(ctx context.Context) (Health, error) {
+	var h Health
+	err := c.do(ctx, http.MethodGet, "/health", nil, &h)
+	return h, err
+}
+
+// Status polls every endpoint.
+func (c *Client) Status(ctx context.Context) (*StatusResponse, error) {
+	var st StatusResponse
+	if err := c.do(ctx, http.MethodGet, "/api/status", nil, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// Assets returns the asset registry.
+func (c *Client) Assets(ctx context.Context) ([]Asset, error) {
+	var out []Asset
+	if err := c.do(ctx, http.MethodGet, "/api/assets", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Compare measures endpoints a and b side by side. Both must serve the same
+// chain.
+func (c *Client) Compare(ctx context.Context, a, b string) ([]Metrics, error) {
+	q := url.Values{"a": {a}, "b": {b}}
+	var out struct {
+		Endpoints []Metrics `json:"endpoints"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/compare?"+q.Encode(), nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Endpoints, nil
+}
+
+// Bench benchmarks the named endpoint, which takes several seconds, and
+// returns the result the server keeps.
+func (c *Client) Bench(ctx context.Context, endpointID string) (*Bench, error) {
+	var out Bench
+	if err := c.do(ctx, http.MethodPost, "/api/endpoints/"+pathEscape(endpointID)+"/bench", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// LastBench returns the named endpoint's last benchmark.
+func (c *Client) LastBench(ctx context.Context, endpointID string) (*Bench, error) {
+	var out Bench
+	if err := c.do(ctx, http.MethodGet, "/api/endpoints/"+pathEscape(endpointID)+"/bench", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// LightClient returns the status of the light client of the endpoint with
+// the given ID.
+func (c *Client) LightClient(ctx context.Context, endpointID string) (*LightClient, error) {
+	var out LightClient
+	if err := c.do(ctx, http.MethodGet, "/api/endpoints/"+pathEscape(endpointID)+"/light-client", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// TxPool returns the size of an endpoint's transaction pool and the
+// transactions in it from the caller's signer accounts and the given
+// addresses.
+func (c *Client) TxPool(ctx context.Context, endpointID string, addresses ...string) (*TxPool, error) {
+	path := "/api/endpoints/" + pathEscape(endpointID) + "/txpool"
+	if len(addresses) > 0 {
+		path += "?address=" + url.QueryEscape(strings.Join(addresses, ","))
+	}
+	var out TxPool
+	if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RPC proxies a JSON-RPC call through the named endpoint.
+func (c *Client) RPC(ctx context.Context, endpointID, method string, params ...any) (json.RawMessage, error) {
+	if params == nil {
+		params = []any{}
+	}
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+	}
+	err := c.do(ctx, http.MethodPost, "/api/rpc/"+pathEscape(endpointID), RPCRequest{Method: method, Params: params}, &resp)
+	return resp.Result, err
+}
+
+// ChainRPC proxies a JSON-RPC call through the server's best endpoint for
+// a chain: online, at the head, and fastest.
+func (c *Client) ChainRPC(ctx context.Context, chainID uint64, method string, params ...any) (json.RawMessage, error) {
+	if params == nil {
+		params = []any{}
+	}
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+	}
+	err := c.do(ctx, http.MethodPost, "/api/rpc/chain/"+strconv.FormatUint(chainID, 10), RPCRequest{Method: method, Params: params}, &resp)
+	return resp.Result, err
+}
+
+// Broadcast sends a signed raw transaction and returns its hash; see
+// WithPrivate to send it privately.
+func (c *Client) Broadcast(ctx context.Context, endpointID, raw string) (string, error) {
+	var resp struct {
+		Hash string `json:"hash"`
+	}
+	err := c.do(ctx, http.MethodPost, "/api/broadcast", BroadcastRequest{Endpoint: endpointID, Raw: raw, Private: privateFrom(ctx)}, &resp)
+	return resp.Hash, err
+}
+
+// PrivateTxs lists the transactions sent to private endpoints, newest
+// first, as last checked.
+func (c *Client) PrivateTxs(ctx context.Context) ([]PrivateTx, error) {
+	var out []PrivateTx
+	if err := c.do(ctx, http.MethodGet, "/api/private", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PrivateTx returns a transaction sent to a private endpoint as last
+// checked or, with endpointID, asks that private endpoint about it now.
+func (c *Client) PrivateTx(ctx context.Context, hash, endpointID string) (*PrivateTx, error) {
+	path := "/api/private/" + pathEscape(hash)
+	if endpointID != "" {
+		path += "?endpoint=" + url.QueryEscape(endpointID)
+	}
+	var out PrivateTx
+	if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GraphQL runs a read-only query against /graphql and decodes its data into
+// out. When the response reports errors they are returned as GraphQLErrors,
+// after any data that did resolve has been decoded.
+func (c *Client) GraphQL(ctx context.Context, query string, variables map[string]any, out any) error {
+	status, data, err := c.send(ctx, http.MethodPost, "/graphql", GraphQLRequest{Query: query, Variables: variables})
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Data   json.RawMessage `json:"data"`
+		Errors GraphQLErrors   `json:"errors"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return &APIError{StatusCode: status}
+	}
+	if len(resp.Data) > 0 && out != nil {
+		if err := json.Unmarshal(resp.Data, out); err != nil {
+			return err
+		}
+	}
+	if len(resp.Errors) > 0 {
+		return resp.Errors
+	}
+	if status < 200 || status >= 300 {
+		return &APIError{StatusCode: status}
+	}
+	return nil
+}
+
+// Logs returns recent server log entries at or above level ("debug",
+// "info", "warn", "error"; empty for info), optionally from one subsystem.
+func (c *Client) Logs(ctx context.Context, level, subsystem string) (*Logs, error) {
+	var out Logs
+	if err := c.do(ctx, http.MethodGet, "/api/logs?"+logQuery(level, subsystem), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// StreamLogs calls fn with recent and then live log entries until ctx is
+// cancelled or the server closes the stream. The client's timeout does not
+// apply to the stream.
+func (c *Client) StreamLogs(ctx context.Context, level, subsystem string, fn func(LogEntry)) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/api/logs/stream?"+logQuery(level, subsystem), nil)
+	if err != nil {
+		return err
+	}
+	hc := *c.HTTPClient
+	hc.Timeout = 0
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		_ = json.NewDecoder(resp.Body).Decode(apiErr)
+		return apiErr
+	}
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		data, ok := strings.CutPrefix(sc.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var e LogEntry
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			return err
+		}
+		fn(e)
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return sc.Err()
+}
+
+func logQuery(level, subsystem string) string {
+	q := url.Values{}
+	if level != "" {
+		q.Set("level", level)
+	}
+	if subsystem != "" {
+		q.Set("subsystem", subsystem)
+	}
+	return q.Encode()
+}
+
+// PanicLock locks every session, the server vault, and in-flight signing.
+func (c *Client) PanicLock(ctx context.Context) (int64, error) {
+	var resp struct {
+		LockEpoch int64 `json:"lock_epoch"`
+	}
+	err := c.do(ctx, http.MethodPost, "/api/lock", nil, &resp)
+	return resp.LockEpoch, err
+}
@@ -0,0 +1,1349 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// These operations are not available from broadcast-only servers.
+
+// AddEndpoint adds an endpoint. Without force, a duplicate of an existing
+// endpoint fails with an *APIError whose Duplicate is set.
+func (c *Client) AddEndpoint(ctx context.Context, ep Endpoint, force bool) (*Endpoint, error) {
+	path := "/api/endpoints"
+	if force {
+		path += "?force=true"
+	}
+	var out Endpoint
+	if err := c.do(ctx, http.MethodPost, path, ep, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateEndpoint replaces an endpoint's name, URL, asset, and JWT secret.
+func (c *Client) UpdateEndpoint(ctx context.Context, id string, ep Endpoint, force bool) (*Endpoint, error) {
+	path := "/api/endpoints/" + pathEscape(id)
+	if force {
+		path += "?force=true"
+	}
+	var out Endpoint
+	if err := c.do(ctx, http.MethodPut, path, ep, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteEndpoint moves an endpoint to the recycle bin.
+func (c *Client) DeleteEndpoint(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/endpoints/"+pathEscape(id), nil, nil)
+}
+
+// RestoreEndpoint brings an endpoint back from the recycle bin.
+func (c *Client) RestoreEndpoint(ctx context.Context, id string) (*Endpoint, error) {
+	var out Endpoint
+	if err := c.do(ctx, http.MethodPost, "/api/endpoints/"+pathEscape(id)+"/restore", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// EndpointJWTSecret returns an endpoint's hex JWT secret, or "" if it has
+// none. Statuses only say whether there is one.
+func (c *Client) EndpointJWTSecret(ctx context.Context, id string) (string, error) {
+	var out struct {
+		JWTSecret string `json:"jwt_secret"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/endpoints/"+pathEscape(id)+"/jwt-secret", nil, &out); err != nil {
+		return "", err
+	}
+	return out.JWTSecret, nil
+}
+
+// AddAsset registers an asset. Its ID is the lowercased symbol.
+func (c *Client) AddAsset(ctx context.Context, a Asset) (*Asset, error) {
+	var out Asset
+	if err := c.do(ctx, http.MethodPost, "/api/assets", a, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateAsset replaces an asset's decimals, CoinGecko ID, and icon.
+func (c *Client) UpdateAsset(ctx context.Context, id string, a Asset) (*Asset, error) {
+	var out Asset
+	if err := c.do(ctx, http.MethodPut, "/api/assets/"+pathEscape(id), a, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteAsset removes an asset that no endpoint uses.
+func (c *Client) DeleteAsset(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/assets/"+pathEscape(id), nil, nil)
+}
+
+// BuildTx builds an unsigned transaction envelope.
+func (c *Client) BuildTx(ctx context.Context, req TxRequest) (*Envelope, error) {
+	var env Envelope
+	if err := c.do(ctx, http.MethodPost, "/api/tx/build", req, &env); err != nil {
+		return nil, err
+	}
+	return &env, nil
+}
+
+// ImportTx verifies a transaction signed elsewhere, broadcasting it if asked.
+func (c *Client) ImportTx(ctx context.Context, req ImportRequest) (*Signed, error) {
+	var raw json.RawMessage
+	if err := c.do(ctx, http.MethodPost, "/api/tx/import", req, &raw); err != nil {
+		return nil, err
+	}
+	return signedOrBroadcast(raw)
+}
+
+// SignRequestUR encodes an envelope as an eth-sign-request for the
+// air-gapped account that holds its sender.
+func (c *Client) SignRequestUR(ctx context.Context, env *Envelope) (*SignRequestUR, error) {
+	in := struct {
+		Envelope *Envelope `json:"envelope"`
+	}{env}
+	var out SignRequestUR
+	if err := c.do(ctx, http.MethodPost, "/api/tx/ur", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SignatureUR decodes the parts of an air-gapped device's eth-signature for
+// an envelope. ImportTx takes the parts directly as well.
+func (c *Client) SignatureUR(ctx context.Context, env *Envelope, parts []string) (*Signature, error) {
+	in := struct {
+		Envelope *Envelope `json:"envelope"`
+		UR       []string  `json:"ur"`
+	}{env, parts}
+	var out Signature
+	if err := c.do(ctx, http.MethodPost, "/api/tx/ur/signature", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SignTx signs an envelope with the server vault key or remote signer that
+// holds its sender, broadcasting it if asked, privately under WithPrivate.
+// It fails with a *QueuedError
+// when the server requires approval, and with a 428 *APIError when a large
+// value needs a confirmation (see WithConfirmation).
+func (c *Client) SignTx(ctx context.Context, env *Envelope, broadcast bool) (*Signed, error) {
+	in := struct {
+		Envelope  *Envelope     `json:"envelope"`
+		Broadcast bool          `json:"broadcast"`
+		Private   bool          `json:"private,omitempty"`
+		Confirm   *Confirmation `json:"confirm,omitempty"`
+	}{env, broadcast, privateFrom(ctx), confirmationFrom(ctx)}
+	var raw json.RawMessage
+	if err := c.do(ctx, http.MethodPost, "/api/tx/sign", in, &raw); err != nil {
+		return nil, err
+	}
+	return signedOrBroadcast(raw)
+}
+
+// Journal lists send intents newest first, with the events of mined ones
+// decoded. Pass stage "signed" for sends whose outcome is still unknown, or
+// "" for all.
+func (c *Client) Journal(ctx context.Context, stage string) ([]JournalEntry, error) {
+	path := "/api/journal"
+	if stage != "" {
+		path += "?stage=" + url.QueryEscape(stage)
+	}
+	var out []JournalEntry
+	err := c.do(ctx, http.MethodGet, path, nil, &out)
+	return out, err
+}
+
+// ContactHistory lists the send intents that sent to counterparty or moved
+// assets to or from it, newest first.
+func (c *Client) ContactHistory(ctx context.Context, counterparty string) ([]JournalEntry, error) {
+	var out []JournalEntry
+	err := c.do(ctx, http.MethodGet, "/api/journal?counterparty="+url.QueryEscape(counterparty), nil, &out)
+	return out, err
+}
+
+// ExportHistory exports the journal's mined sends oldest first, one row per
+// asset moved, as format "csv" or "json" (HistoryRows decodes the latter),
+// or as "koinly" or "cointracker", those tax tools' CSV imports.
+func (c *Client) ExportHistory(ctx context.Context, format string, f HistoryFilter) ([]byte, error) {
+	q := url.Values{"format": {format}}
+	for k, v := range map[string]string{"address": f.Address, "tag": f.Tag, "range": f.Range, "counterparty": f.Counterparty} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	status, data, err := c.send(ctx, http.MethodGet, "/api/history/export?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if status < 200 || status >= 300 {
+		apiErr := &APIError{StatusCode: status}
+		_ = json.Unmarshal(data, apiErr)
+		return nil, apiErr
+	}
+	return data, nil
+}
+
+// HistoryRows is ExportHistory as JSON, decoded.
+func (c *Client) HistoryRows(ctx context.Context, f HistoryFilter) ([]HistoryRow, error) {
+	data, err := c.ExportHistory(ctx, "json", f)
+	if err != nil {
+		return nil, err
+	}
+	var out []HistoryRow
+	return out, json.Unmarshal(data, &out)
+}
+
+// InternalTransfers traces the transaction hash on endpoint for the native
+// currency its internal calls moved.
+func (c *Client) InternalTransfers(ctx context.Context, endpoint, hash string) (*InternalTransfers, error) {
+	var out InternalTransfers
+	path := "/api/tx/" + url.PathEscape(hash) + "/internal?endpoint=" + url.QueryEscape(endpoint)
+	if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeepLink validates a primalwallet: link and returns what it asks for.
+func (c *Client) DeepLink(ctx context.Context, uri string) (*DeepLink, error) {
+	var out DeepLink
+	if err := c.do(ctx, http.MethodGet, "/api/deeplink?uri="+url.QueryEscape(uri), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// NFTs returns the tokens address holds on an endpoint's chain. A long
+// transfer history is indexed over several calls; call again until the
+// inventory is Complete.
+func (c *Client) NFTs(ctx context.Context, address, endpoint string) (*NFTInventory, error) {
+	var out NFTInventory
+	path := "/api/nfts?address=" + url.QueryEscape(address) + "&endpoint=" + url.QueryEscape(endpoint)
+	if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Accounts lists signer accounts, optionally only those of one kind.
+func (c *Client) Accounts(ctx context.Context, kind string) ([]Account, error) {
+	path := "/api/accounts"
+	if kind != "" {
+		path += "?kind=" + url.QueryEscape(kind)
+	}
+	var out []Account
+	err := c.do(ctx, http.MethodGet, path, nil, &out)
+	return out, err
+}
+
+// AddAccount registers a hardware or remote signer account.
+func (c *Client) AddAccount(ctx context.Context, acct Account) (*Account, error) {
+	var out Account
+	if err := c.do(ctx, http.MethodPost, "/api/accounts", acct, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RenameAccount changes a signer account's label.
+func (c *Client) RenameAccount(ctx context.Context, address, label string) (*Account, error) {
+	var out Account
+	in := map[string]string{"label": label}
+	if err := c.do(ctx, http.MethodPut, "/api/accounts/"+pathEscape(address), in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteAccount moves a signer account to the recycle bin.
+func (c *Client) DeleteAccount(ctx context.Context, address string) error {
+	return c.do(ctx, http.MethodDelete, "/api/accounts/"+pathEscape(address), nil, nil)
+}
+
+// RestoreAccount brings a signer account back from the recycle bin.
+func (c *Client) RestoreAccount(ctx context.Context, address string) (*Account, error) {
+	var out Account
+	if err := c.do(ctx, http.MethodPost, "/api/accounts/"+pathEscape(address)+"/restore", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Bookmarks lists chain snapshot bookmarks.
+func (c *Client) Bookmarks(ctx context.Context) ([]Bookmark, error) {
+	var out []Bookmark
+	err := c.do(ctx, http.MethodGet, "/api/bookmarks", nil, &out)
+	return out, err
+}
+
+// AddBookmark bookmarks a block on the chain served by req.Endpoint.
+func (c *Client) AddBookmark(ctx context.Context, req BookmarkRequest) (*Bookmark, error) {
+	var out Bookmark
+	if err := c.do(ctx, http.MethodPost, "/api/bookmarks", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateBookmark changes a bookmark's note.
+func (c *Client) UpdateBookmark(ctx context.Context, id, note string) (*Bookmark, error) {
+	var out Bookmark
+	in := map[string]string{"note": note}
+	if err := c.do(ctx, http.MethodPut, "/api/bookmarks/"+pathEscape(id), in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteBookmark moves a bookmark to the recycle bin.
+func (c *Client) DeleteBookmark(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/bookmarks/"+pathEscape(id), nil, nil)
+}
+
+// RestoreBookmark brings a bookmark back from the recycle bin.
+func (c *Client) RestoreBookmark(ctx context.Context, id string) (*Bookmark, error) {
+	var out Bookmark
+	if err := c.do(ctx, http.MethodPost, "/api/bookmarks/"+pathEscape(id)+"/restore", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Contacts lists the addresses the profile has sent to, most sent to first.
+// Send previews warn about recipients that look like one of them.
+func (c *Client) Contacts(ctx context.Context) ([]Contact, error) {
+	var out []Contact
+	err := c.do(ctx, http.MethodGet, "/api/contacts", nil, &out)
+	return out, err
+}
+
+// DeleteContact forgets an address, e.g. one sent to by mistake.
+func (c *Client) DeleteContact(ctx context.Context, address string) error {
+	return c.do(ctx, http.MethodDelete, "/api/contacts/"+pathEscape(address), nil, nil)
+}
+
+// Labels lists the profile's address labels by address, only those with
+// tag unless it is empty.
+func (c *Client) Labels(ctx context.Context, tag string) ([]Label, error) {
+	path := "/api/labels"
+	if tag != "" {
+		path += "?tag=" + url.QueryEscape(tag)
+	}
+	var out []Label
+	err := c.do(ctx, http.MethodGet, path, nil, &out)
+	return out, err
+}
+
+// SetLabel names and tags l.Address, replacing its label. A label needs a
+// name or a tag.
+func (c *Client) SetLabel(ctx context.Context, l Label) (*Label, error) {
+	var out Label
+	if err := c.do(ctx, http.MethodPut, "/api/labels/"+pathEscape(l.Address), l, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteLabel removes an address's label.
+func (c *Client) DeleteLabel(ctx context.Context, address string) error {
+	return c.do(ctx, http.MethodDelete, "/api/labels/"+pathEscape(address), nil, nil)
+}
+
+// Search finds q among the profile's endpoints, accounts, labels, tags,
+// contacts, and tokens, best matches first, at most limit of them (the
+// server's default if 0). A full transaction hash or address found nowhere
+// locally is looked up on the endpoints.
+func (c *Client) Search(ctx context.Context, q string, limit int) ([]SearchResult, error) {
+	path := "/api/search?q=" + url.QueryEscape(q)
+	if limit > 0 {
+		path += "&limit=" + strconv.Itoa(limit)
+	}
+	var out []SearchResult
+	err := c.do(ctx, http.MethodGet, path, nil, &out)
+	return out, err
+}
+
+// ERC20Tokens lists registered ERC-20 tokens, of one chain if chainID is
+// not 0.
+func (c *Client) ERC20Tokens(ctx context.Context, chainID uint64) ([]ERC20Token, error) {
+	path := "/api/erc20"
+	if chainID != 0 {
+		path += "?chain_id=" + strconv.FormatUint(chainID, 10)
+	}
+	var out []ERC20Token
+	err := c.do(ctx, http.MethodGet, path, nil, &out)
+	return out, err
+}
+
+// AddERC20Token registers a custom token, with the metadata its contract
+// reports. A duplicate of a custom token fails with a 409 *APIError.
+func (c *Client) AddERC20Token(ctx context.Context, req ERC20TokenRequest) (*ERC20Token, error) {
+	var out ERC20Token
+	if err := c.do(ctx, http.MethodPost, "/api/erc20", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteERC20Token removes a custom token.
+func (c *Client) DeleteERC20Token(ctx context.Context, chainID uint64, address string) error {
+	return c.do(ctx, http.MethodDelete, "/api/erc20/"+strconv.FormatUint(chainID, 10)+"/"+pathEscape(address), nil, nil)
+}
+
+// ERC20Balances returns address's nonzero balances of the tokens registered
+// for an endpoint's chain.
+func (c *Client) ERC20Balances(ctx context.Context, address, endpoint string) ([]ERC20Balance, error) {
+	var out []ERC20Balance
+	path := "/api/erc20/balances?address=" + url.QueryEscape(address) + "&endpoint=" + url.QueryEscape(endpoint)
+	err := c.do(ctx, http.MethodGet, path, nil, &out)
+	return out, err
+}
+
+// TokenLists lists imported token lists.
+func (c *Client) TokenLists(ctx context.Context) ([]TokenList, error) {
+	var out []TokenList
+	err := c.do(ctx, http.MethodGet, "/api/erc20/lists", nil, &out)
+	return out, err
+}
+
+// ImportTokenList imports a token list from a URL. The server downloads it
+// again daily.
+func (c *Client) ImportTokenList(ctx context.Context, listURL string) (*TokenList, error) {
+	var out TokenList
+	if err := c.do(ctx, http.MethodPost, "/api/erc20/lists", map[string]string{"url": listURL}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ImportTokenListData imports a token list given as its JSON document.
+func (c *Client) ImportTokenListData(ctx context.Context, list json.RawMessage) (*TokenList, error) {
+	var out TokenList
+	in := map[string]json.RawMessage{"list": list}
+	if err := c.do(ctx, http.MethodPost, "/api/erc20/lists", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RefreshTokenList downloads a token list again now.
+func (c *Client) RefreshTokenList(ctx context.Context, id string) (*TokenList, error) {
+	var out TokenList
+	if err := c.do(ctx, http.MethodPost, "/api/erc20/lists/"+pathEscape(id)+"/refresh", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RemoveTokenList removes a token list and the tokens it registered.
+func (c *Client) RemoveTokenList(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/erc20/lists/"+pathEscape(id), nil, nil)
+}
+
+// BuildPermit returns a permit's typed data to sign elsewhere. With
+// req.Signature set, and the Deadline and Expiration of the permit it
+// signed, the server checks the signature and adds the permit() calldata.
+func (c *Client) BuildPermit(ctx context.Context, req PermitRequest) (*Permit, error) {
+	var out Permit
+	if err := c.do(ctx, http.MethodPost, "/api/permits", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SignPermit builds a permit and signs it with the vault key or remote
+// signer that holds req.Owner.
+func (c *Client) SignPermit(ctx context.Context, req PermitRequest) (*Permit, error) {
+	var out Permit
+	if err := c.do(ctx, http.MethodPost, "/api/permits/sign", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ABIs lists registered contract ABIs.
+func (c *Client) ABIs(ctx context.Context) ([]ABI, error) {
+	var out []ABI
+	err := c.do(ctx, http.MethodGet, "/api/abis", nil, &out)
+	return out, err
+}
+
+// AddABI registers a JSON ABI, or a compiler artifact holding one, under a
+// name.
+func (c *Client) AddABI(ctx context.Context, name string, abi json.RawMessage) (*ABI, error) {
+	var out ABI
+	in := map[string]any{"name": name, "abi": abi}
+	if err := c.do(ctx, http.MethodPost, "/api/abis", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteABI removes an ABI.
+func (c *Client) DeleteABI(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/abis/"+pathEscape(id), nil, nil)
+}
+
+// EncodeCalldata encodes a call to a function of a registered ABI. function
+// is a name, a signature for overloaded names, or a 0x selector.
+func (c *Client) EncodeCalldata(ctx context.Context, abi, function string, args []any) (*Calldata, error) {
+	var out Calldata
+	in := map[string]any{"abi": abi, "function": function, "args": args}
+	if err := c.do(ctx, http.MethodPost, "/api/calldata/encode", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DecodeCalldata decodes calldata with a registered ABI. An empty abi finds
+// the function by its selector among all registered ABIs.
+func (c *Client) DecodeCalldata(ctx context.Context, abi, data string) (*Calldata, error) {
+	var out Calldata
+	in := map[string]string{"abi": abi, "data": data}
+	if err := c.do(ctx, http.MethodPost, "/api/calldata/decode", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Devnets probes the server's devnet URLs for Anvil and Hardhat nodes.
+func (c *Client) Devnets(ctx context.Context) ([]Devnet, error) {
+	var out []Devnet
+	err := c.do(ctx, http.MethodGet, "/api/devnets", nil, &out)
+	return out, err
+}
+
+// AddDevnet adds an endpoint for the devnet at url, unless one has its URL
+// already, named name or after the node when empty. watch also adds the
+// accounts it funds as watch-only accounts.
+func (c *Client) AddDevnet(ctx context.Context, url, name string, watch bool) (*DevnetAdded, error) {
+	var out DevnetAdded
+	in := map[string]any{"url": url, "name": name, "watch": watch}
+	if err := c.do(ctx, http.MethodPost, "/api/devnets", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DevnetStatus returns the head of an Anvil or Hardhat endpoint's chain.
+func (c *Client) DevnetStatus(ctx context.Context, endpoint string) (*DevnetStatus, error) {
+	var out DevnetStatus
+	if err := c.do(ctx, http.MethodGet, "/api/devnet/"+pathEscape(endpoint), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DevnetSnapshot saves the state of an endpoint's test chain under an
+// optional name.
+func (c *Client) DevnetSnapshot(ctx context.Context, endpoint, name string) (*DevnetSnapshot, error) {
+	var out DevnetSnapshot
+	in := map[string]string{"name": name}
+	if err := c.do(ctx, http.MethodPost, "/api/devnet/"+pathEscape(endpoint)+"/snapshots", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DevnetRevert restores a snapshot, which drops it and every later one.
+func (c *Client) DevnetRevert(ctx context.Context, endpoint, snapshot string) (*DevnetStatus, error) {
+	return c.devnetControl(ctx, http.MethodPost, endpoint, "/snapshots/"+pathEscape(snapshot)+"/revert", nil)
+}
+
+// DevnetMine mines blocks blocks, their timestamps interval seconds apart
+// (the node's default when 0).
+func (c *Client) DevnetMine(ctx context.Context, endpoint string, blocks, interval uint64) (*DevnetStatus, error) {
+	in := map[string]uint64{"blocks": blocks, "interval": interval}
+	return c.devnetControl(ctx, http.MethodPost, endpoint, "/mine", in)
+}
+
+// DevnetIncreaseTime moves the chain's clock seconds forward; mine mines a
+// block so the new time shows.
+func (c *Client) DevnetIncreaseTime(ctx context.Context, endpoint string, seconds uint64, mine bool) (*DevnetStatus, error) {
+	in := map[string]any{"seconds": seconds, "mine": mine}
+	return c.devnetControl(ctx, http.MethodPost, endpoint, "/time", in)
+}
+
+// DevnetSetBalance sets an address's balance, in the endpoint's native
+// currency, e.g. "100".
+func (c *Client) DevnetSetBalance(ctx context.Context, endpoint, address, balance string) (*DevnetStatus, error) {
+	in := map[string]string{"balance": balance}
+	return c.devnetControl(ctx, http.MethodPut, endpoint, "/balances/"+pathEscape(address), in)
+}
+
+// DevnetImpersonate starts, or with on false stops, letting the node send
+// transactions from address without its key.
+func (c *Client) DevnetImpersonate(ctx context.Context, endpoint, address string, on bool) (*DevnetStatus, error) {
+	method := http.MethodPost
+	if !on {
+		method = http.MethodDelete
+	}
+	return c.devnetControl(ctx, method, endpoint, "/impersonated/"+pathEscape(address), nil)
+}
+
+func (c *Client) devnetControl(ctx context.Context, method, endpoint, path string, in any) (*DevnetStatus, error) {
+	var out DevnetStatus
+	if err := c.do(ctx, method, "/api/devnet/"+pathEscape(endpoint)+path, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Contract looks up the verified source of the contract at address on an
+// endpoint's chain. sources also returns the source files; refresh asks
+// again instead of using the server's cache.
+func (c *Client) Contract(ctx context.Context, endpoint, address string, sources, refresh bool) (*Contract, error) {
+	q := url.Values{}
+	if sources {
+		q.Set("sources", "true")
+	}
+	if refresh {
+		q.Set("refresh", "true")
+	}
+	path := "/api/endpoints/" + pathEscape(endpoint) + "/contracts/" + pathEscape(address)
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	var out Contract
+	if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Schedules lists recurring transaction schedules.
+func (c *Client) Schedules(ctx context.Context) ([]Schedule, error) {
+	var out []Schedule
+	err := c.do(ctx, http.MethodGet, "/api/schedules", nil, &out)
+	return out, err
+}
+
+// AddSchedule creates a schedule. Its From must be a server vault key or a
+// remote signer account.
+func (c *Client) AddSchedule(ctx context.Context, sc Schedule) (*Schedule, error) {
+	var out Schedule
+	if err := c.do(ctx, http.MethodPost, "/api/schedules", sc, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateSchedule replaces a schedule's settings; set Paused to pause it.
+func (c *Client) UpdateSchedule(ctx context.Context, id string, sc Schedule) (*Schedule, error) {
+	var out Schedule
+	if err := c.do(ctx, http.MethodPut, "/api/schedules/"+pathEscape(id), sc, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteSchedule moves a schedule to the recycle bin.
+func (c *Client) DeleteSchedule(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/schedules/"+pathEscape(id), nil, nil)
+}
+
+// RestoreSchedule brings a schedule back from the recycle bin.
+func (c *Client) RestoreSchedule(ctx context.Context, id string) (*Schedule, error) {
+	var out Schedule
+	if err := c.do(ctx, http.MethodPost, "/api/schedules/"+pathEscape(id)+"/restore", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ScheduleRuns lists schedule runs newest first. Pass status "pending" for
+// the approval queue, or "" for all.
+func (c *Client) ScheduleRuns(ctx context.Context, status string) ([]ScheduleRun, error) {
+	path := "/api/schedules/runs"
+	if status != "" {
+		path += "?status=" + url.QueryEscape(status)
+	}
+	var out []ScheduleRun
+	err := c.do(ctx, http.MethodGet, path, nil, &out)
+	return out, err
+}
+
+// ApproveRun signs and broadcasts a pending run. A failed send returns an
+// *APIError; the run is then marked failed.
+func (c *Client) ApproveRun(ctx context.Context, id string) (*ScheduleRun, error) {
+	var out ScheduleRun
+	if err := c.do(ctx, http.MethodPost, "/api/schedules/runs/"+pathEscape(id)+"/approve", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RejectRun drops a pending run without sending it.
+func (c *Client) RejectRun(ctx context.Context, id string) (*ScheduleRun, error) {
+	var out ScheduleRun
+	if err := c.do(ctx, http.MethodPost, "/api/schedules/runs/"+pathEscape(id)+"/reject", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Bridges lists tracked bridge transfers newest first, optionally only
+// those with status (pending, in_flight, arrived, failed, or stalled).
+func (c *Client) Bridges(ctx context.Context, status string) ([]BridgeTransfer, error) {
+	path := "/api/bridges"
+	if status != "" {
+		path += "?status=" + url.QueryEscape(status)
+	}
+	var out []BridgeTransfer
+	err := c.do(ctx, http.MethodGet, path, nil, &out)
+	return out, err
+}
+
+// Bridge returns one tracked bridge transfer.
+func (c *Client) Bridge(ctx context.Context, id string) (*BridgeTransfer, error) {
+	var out BridgeTransfer
+	if err := c.do(ctx, http.MethodGet, "/api/bridges/"+pathEscape(id), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// TrackBridge registers a bridge transaction sent through one of the
+// server's endpoints, to be followed until it arrives on the destination.
+func (c *Client) TrackBridge(ctx context.Context, req BridgeRequest) (*BridgeTransfer, error) {
+	var out BridgeTransfer
+	if err := c.do(ctx, http.MethodPost, "/api/bridges", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteBridge stops tracking a bridge transfer.
+func (c *Client) DeleteBridge(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/bridges/"+pathEscape(id), nil, nil)
+}
+
+// Batches lists batch sends newest first.
+func (c *Client) Batches(ctx context.Context) ([]Batch, error) {
+	var out []Batch
+	err := c.do(ctx, http.MethodGet, "/api/batches", nil, &out)
+	return out, err
+}
+
+// Batch returns one batch send with each transaction's stage.
+func (c *Client) Batch(ctx context.Context, id string) (*Batch, error) {
+	var out Batch
+	if err := c.do(ctx, http.MethodGet, "/api/batches/"+pathEscape(id), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PreviewBatch checks and builds a batch without keeping it. Recipients
+// that can't be paid come back with an Error.
+func (c *Client) PreviewBatch(ctx context.Context, req BatchRequest) (*Batch, error) {
+	var out Batch
+	if err := c.do(ctx, http.MethodPost, "/api/batches/preview", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AddBatch checks, builds, and keeps a batch. It fails with an *APIError
+// while any recipient is invalid.
+func (c *Client) AddBatch(ctx context.Context, req BatchRequest) (*Batch, error) {
+	var out Batch
+	if err := c.do(ctx, http.MethodPost, "/api/batches", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RebuildBatch builds a batch's unsent transactions again with fresh
+// nonces and fees.
+func (c *Client) RebuildBatch(ctx context.Context, id string) (*Batch, error) {
+	var out Batch
+	if err := c.do(ctx, http.MethodPost, "/api/batches/"+pathEscape(id)+"/build", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SendBatch signs and broadcasts a batch's unsent transactions with the
+// server's key for its sender, in order, stopping at the first that fails.
+// Attach a confirmation with WithConfirmation when the server asks for one.
+func (c *Client) SendBatch(ctx context.Context, id string) (*Batch, error) {
+	in := struct {
+		Confirm *Confirmation `json:"confirm,omitempty"`
+	}{confirmationFrom(ctx)}
+	var out Batch
+	if err := c.do(ctx, http.MethodPost, "/api/batches/"+pathEscape(id)+"/send", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteBatch forgets a batch send. Transactions it sent are unaffected.
+func (c *Client) DeleteBatch(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/batches/"+pathEscape(id), nil, nil)
+}
+
+// Alerts lists the alerts oldest first, optionally only those of kind.
+func (c *Client) Alerts(ctx context.Context, kind string) ([]Alert, error) {
+	path := "/api/alerts"
+	if kind != "" {
+		path += "?kind=" + url.QueryEscape(kind)
+	}
+	var out []Alert
+	err := c.do(ctx, http.MethodGet, path, nil, &out)
+	return out, err
+}
+
+// Alert returns one alert.
+func (c *Client) Alert(ctx context.Context, id string) (*Alert, error) {
+	var out Alert
+	if err := c.do(ctx, http.MethodGet, "/api/alerts/"+pathEscape(id), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AddAlert creates an alert on one of the server's endpoints.
+func (c *Client) AddAlert(ctx context.Context, a Alert) (*Alert, error) {
+	var out Alert
+	if err := c.do(ctx, http.MethodPost, "/api/alerts", a, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateAlert replaces an alert's condition, or mutes or unmutes it.
+func (c *Client) UpdateAlert(ctx context.Context, id string, a Alert) (*Alert, error) {
+	var out Alert
+	if err := c.do(ctx, http.MethodPut, "/api/alerts/"+pathEscape(id), a, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteAlert removes an alert.
+func (c *Client) DeleteAlert(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/alerts/"+pathEscape(id), nil, nil)
+}
+
+// Channels lists the notification channels, without their secrets.
+func (c *Client) Channels(ctx context.Context) ([]Channel, error) {
+	var out []Channel
+	err := c.do(ctx, http.MethodGet, "/api/channels", nil, &out)
+	return out, err
+}
+
+// AddChannel creates a notification channel.
+func (c *Client) AddChannel(ctx context.Context, ch Channel) (*Channel, error) {
+	var out Channel
+	if err := c.do(ctx, http.MethodPost, "/api/channels", ch, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateChannel replaces a notification channel's settings. Secrets left
+// empty are kept.
+func (c *Client) UpdateChannel(ctx context.Context, id string, ch Channel) (*Channel, error) {
+	var out Channel
+	if err := c.do(ctx, http.MethodPut, "/api/channels/"+pathEscape(id), ch, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteChannel removes a notification channel.
+func (c *Client) DeleteChannel(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/channels/"+pathEscape(id), nil, nil)
+}
+
+// TestChannel sends a test notification over a channel.
+func (c *Client) TestChannel(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/api/channels/"+pathEscape(id)+"/test", nil, nil)
+}
+
+// PushSubscriptions lists the browsers subscribed to push notifications.
+// Admin only.
+func (c *Client) PushSubscriptions(ctx context.Context) ([]PushSubscription, error) {
+	var out []PushSubscription
+	err := c.do(ctx, http.MethodGet, "/api/push/subscriptions", nil, &out)
+	return out, err
+}
+
+// DeletePushSubscription stops pushing notifications to a browser.
+func (c *Client) DeletePushSubscription(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/push/subscriptions/"+pathEscape(id), nil, nil)
+}
+
+// TestPushSubscription pushes a test notification to a browser.
+func (c *Client) TestPushSubscription(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/api/push/subscriptions/"+pathEscape(id)+"/test", nil, nil)
+}
+
+// Paymasters lists the configured paymasters. Admin only: their URLs
+// usually carry API keys.
+func (c *Client) Paymasters(ctx context.Context) ([]Paymaster, error) {
+	var out []Paymaster
+	err := c.do(ctx, http.MethodGet, "/api/paymasters", nil, &out)
+	return out, err
+}
+
+// AddPaymaster configures a paymaster service for a chain.
+func (c *Client) AddPaymaster(ctx context.Context, pm Paymaster) (*Paymaster, error) {
+	var out Paymaster
+	if err := c.do(ctx, http.MethodPost, "/api/paymasters", pm, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeletePaymaster removes a paymaster.
+func (c *Client) DeletePaymaster(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/paymasters/"+pathEscape(id), nil, nil)
+}
+
+// Sponsor asks a paymaster to pay for op: the one with paymasterID, or if
+// that is empty the first configured for chainID. Set op's gas limits and
+// fees first; the paymaster signs over them.
+func (c *Client) Sponsor(ctx context.Context, paymasterID string, chainID uint64, op UserOperation) (*Sponsorship, error) {
+	in := map[string]any{"paymaster": paymasterID, "chain_id": chainID, "user_operation": op}
+	var out Sponsorship
+	if err := c.do(ctx, http.MethodPost, "/api/paymasters/sponsor", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Safes finds the Safes on endpoint's chain owned by owners, or by default
+// by the profile's signer accounts and, for the server profile, its vault
+// keys.
+func (c *Client) Safes(ctx context.Context, endpoint string, owners ...string) ([]Safe, error) {
+	q := url.Values{"endpoint": {endpoint}}
+	if len(owners) > 0 {
+		q.Set("owners", strings.Join(owners, ","))
+	}
+	var out []Safe
+	err := c.do(ctx, http.MethodGet, "/api/safes?"+q.Encode(), nil, &out)
+	return out, err
+}
+
+// Safe returns a Safe and its transactions waiting for signatures.
+func (c *Client) Safe(ctx context.Context, endpoint, address string) (*Safe, []SafePending, error) {
+	var out struct {
+		Safe    Safe          `json:"safe"`
+		Pending []SafePending `json:"pending"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/safes/"+pathEscape(address)+"?endpoint="+url.QueryEscape(endpoint), nil, &out); err != nil {
+		return nil, nil, err
+	}
+	return &out.Safe, out.Pending, nil
+}
+
+// BuildSafeTx returns tx for an owner of the Safe to sign.
+func (c *Client) BuildSafeTx(ctx context.Context, endpoint, address string, tx SafeTx) (*SafeSignable, error) {
+	in := map[string]any{"endpoint": endpoint, "tx": tx}
+	var out SafeSignable
+	if err := c.do(ctx, http.MethodPost, "/api/safes/"+pathEscape(address)+"/build", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ProposeSafeTx submits tx to the Transaction Service with an owner's
+// signature over its safeTxHash.
+func (c *Client) ProposeSafeTx(ctx context.Context, endpoint, address string, tx SafeTx, signature string) (*SafeSignature, error) {
+	in := map[string]any{"endpoint": endpoint, "tx": tx, "signature": signature}
+	var out SafeSignature
+	if err := c.do(ctx, http.MethodPost, "/api/safes/"+pathEscape(address)+"/propose", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ConfirmSafeTx adds an owner's signature to a pending Safe transaction.
+func (c *Client) ConfirmSafeTx(ctx context.Context, endpoint, address, safeTxHash, signature string) (*SafeSignature, error) {
+	in := map[string]any{"endpoint": endpoint, "safe_tx_hash": safeTxHash, "signature": signature}
+	var out SafeSignature
+	if err := c.do(ctx, http.MethodPost, "/api/safes/"+pathEscape(address)+"/confirm", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SignSafeTx signs as owner with the vault key or remote signer that holds
+// it: proposing tx, or confirming safeTxHash when that is set.
+func (c *Client) SignSafeTx(ctx context.Context, endpoint, address, owner string, tx SafeTx, safeTxHash string) (*SafeSignature, error) {
+	in := map[string]any{"endpoint": endpoint, "safe": address, "owner": owner}
+	if safeTxHash != "" {
+		in["safe_tx_hash"] = safeTxHash
+	} else {
+		in["tx"] = tx
+	}
+	var out SafeSignature
+	if err := c.do(ctx, http.MethodPost, "/api/safes/sign", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SubmitApproval queues a transaction for review in the dashboard. Nothing
+// is signed until someone approves it.
+func (c *Client) SubmitApproval(ctx context.Context, req ApprovalRequest) (*Approval, error) {
+	var out struct {
+		Approval Approval `json:"approval"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/approvals", req, &out); err != nil {
+		return nil, err
+	}
+	return &out.Approval, nil
+}
+
+// Approvals lists queued transactions newest first. Pass status "pending"
+// for those awaiting review, or "" for all.
+func (c *Client) Approvals(ctx context.Context, status string) ([]Approval, error) {
+	path := "/api/approvals"
+	if status != "" {
+		path += "?status=" + url.QueryEscape(status)
+	}
+	var out []Approval
+	err := c.do(ctx, http.MethodGet, path, nil, &out)
+	return out, err
+}
+
+// Approval returns one queued transaction, e.g. to poll for its outcome.
+func (c *Client) Approval(ctx context.Context, id string) (*Approval, error) {
+	var out Approval
+	if err := c.do(ctx, http.MethodGet, "/api/approvals/"+pathEscape(id), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ApproveTx signs a queued transaction, and broadcasts it if it asked for
+// that. A failed send returns an *APIError; the request is then marked
+// failed. A transaction that needs two approvers takes one sign-off per
+// approver, each with its own WithApprover context; the first returns the
+// request still pending.
+func (c *Client) ApproveTx(ctx context.Context, id string) (*Approval, error) {
+	var out Approval
+	if err := c.do(ctx, http.MethodPost, "/api/approvals/"+pathEscape(id)+"/approve", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RejectTx drops a queued transaction without signing it. One that needs
+// two approvers can be rejected by either, with a WithApprover context.
+func (c *Client) RejectTx(ctx context.Context, id string) (*Approval, error) {
+	var out Approval
+	if err := c.do(ctx, http.MethodPost, "/api/approvals/"+pathEscape(id)+"/reject", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Trash lists the recycle bin.
+func (c *Client) Trash(ctx context.Context) (*Trash, error) {
+	var out Trash
+	if err := c.do(ctx, http.MethodGet, "/api/trash", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PurgeEndpoint permanently deletes an endpoint from the recycle bin.
+func (c *Client) PurgeEndpoint(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/trash/endpoints/"+pathEscape(id), nil, nil)
+}
+
+// PurgeAccount permanently deletes a signer account from the recycle bin.
+func (c *Client) PurgeAccount(ctx context.Context, address string) error {
+	return c.do(ctx, http.MethodDelete, "/api/trash/accounts/"+pathEscape(address), nil, nil)
+}
+
+// PurgeBookmark permanently deletes a bookmark from the recycle bin.
+func (c *Client) PurgeBookmark(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/trash/bookmarks/"+pathEscape(id), nil, nil)
+}
+
+// PurgeSchedule permanently deletes a schedule from the recycle bin.
+func (c *Client) PurgeSchedule(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/trash/schedules/"+pathEscape(id), nil, nil)
+}
+
+// Backup exports the caller's endpoints, signer accounts, bookmarks, and
+// preferences, unencrypted. Seal the result before writing it anywhere.
+func (c *Client) Backup(ctx context.Context) (*Backup, error) {
+	var out Backup
+	if err := c.do(ctx, http.MethodGet, "/api/backup", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Restore restores an opened backup. Records that already exist are kept,
+// or overwritten when replace is set. The server ignores b.Keys.
+func (c *Client) Restore(ctx context.Context, b *Backup, replace bool) (*Restore, error) {
+	path := "/api/restore?conflict=skip"
+	if replace {
+		path = "/api/restore?conflict=replace"
+	}
+	var out Restore
+	if err := c.do(ctx, http.MethodPost, path, b, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// KeySync returns the synced browser vault, including deleted keys. It
+// fails with a 404 APIError while sync is off.
+func (c *Client) KeySync(ctx context.Context) (*SyncedVault, error) {
+	var out SyncedVault
+	if err := c.do(ctx, http.MethodGet, "/api/keysync", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DisableKeySync turns vault sync off and deletes the server's copy. Each
+// browser keeps its own keys.
+func (c *Client) DisableKeySync(ctx context.Context) error {
+	return c.do(ctx, http.MethodDelete, "/api/keysync", nil, nil)
+}
+
+// VaultStatus reports the server vault state.
+func (c *Client) VaultStatus(ctx context.Context) (*VaultStatus, error) {
+	var out VaultStatus
+	if err := c.do(ctx, http.MethodGet, "/api/vault", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// VaultInit creates the server vault.
+func (c *Client) VaultInit(ctx context.Context, passphrase string) (*VaultStatus, error) {
+	var out VaultStatus
+	if err := c.do(ctx, http.MethodPost, "/api/vault/init", map[string]string{"passphrase": passphrase}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// VaultUnlock unlocks the server vault.
+func (c *Client) VaultUnlock(ctx context.Context, passphrase string) (*VaultStatus, error) {
+	var out VaultStatus
+	if err := c.do(ctx, http.MethodPost, "/api/vault/unlock", map[string]string{"passphrase": passphrase}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// VaultLock locks the server vault.
+func (c *Client) VaultLock(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/api/vault/lock", nil, nil)
+}
+
+// VaultAddKey generates a server vault key, or imports privateKey if set.
+func (c *Client) VaultAddKey(ctx context.Context, label, privateKey string) (*VaultKey, error) {
+	in := map[string]string{"label": label, "private_key": privateKey}
+	var out VaultKey
+	if err := c.do(ctx, http.MethodPost, "/api/vault/keys", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// VaultSend builds and signs a transaction from a server vault key, and
+// broadcasts it unless broadcast is false, privately under WithPrivate. It
+// fails with a *QueuedError when
+// the server requires approval, and with a 428 *APIError when a large value
+// needs a confirmation (see WithConfirmation).
+func (c *Client) VaultSend(ctx context.Context, req TxRequest, broadcast bool) (*Signed, error) {
+	in := struct {
+		TxRequest
+		Broadcast bool          `json:"broadcast"`
+		Private   bool          `json:"private,omitempty"`
+		Confirm   *Confirmation `json:"confirm,omitempty"`
+	}{req, broadcast, privateFrom(ctx), confirmationFrom(ctx)}
+	var raw json.RawMessage
+	if err := c.do(ctx, http.MethodPost, "/api/vault/send", in, &raw); err != nil {
+		return nil, err
+	}
+	return signedOrBroadcast(raw)
+}
+
+// Login starts a session on a multi-user server and keeps it in
+// c.Session for later calls.
+func (c *Client) Login(ctx context.Context, name, password string) (*User, error) {
+	var out struct {
+		User    User   `json:"user"`
+		Session string `json:"session"`
+	}
+	in := map[string]string{"name": name, "password": password}
+	if err := c.do(ctx, http.MethodPost, "/api/login", in, &out); err != nil {
+		return nil, err
+	}
+	c.Session = out.Session
+	return &out.User, nil
+}
+
+// Logout ends the client's session.
+func (c *Client) Logout(ctx context.Context) error {
+	if err := c.do(ctx, http.MethodPost, "/api/logout", nil, nil); err != nil {
+		return err
+	}
+	c.Session = ""
+	return nil
+}
+
+// Me reports whether the server is in multi-user mode and who the client is
+// logged in as.
+func (c *Client) Me(ctx context.Context) (*Me, error) {
+	var out Me
+	if err := c.do(ctx, http.MethodGet, "/api/me", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Users lists the users of a multi-user server. Admins only.
+func (c *Client) Users(ctx context.Context) ([]User, error) {
+	var out []User
+	err := c.do(ctx, http.MethodGet, "/api/users", nil, &out)
+	return out, err
+}
+
+// AddUser creates a user with role "admin" or "user". Admins only.
+func (c *Client) AddUser(ctx context.Context, name, password, role string) (*User, error) {
+	in := map[string]string{"name": name, "password": password, "role": role}
+	var out User
+	if err := c.do(ctx, http.MethodPost, "/api/users", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateUser changes a user's role and, if password is set, their password,
+// which ends their sessions. Empty fields are left alone. Admins only.
+func (c *Client) UpdateUser(ctx context.Context, id, role, password string) (*User, error) {
+	in := map[string]string{"role": role, "password": password}
+	var out User
+	if err := c.do(ctx, http.MethodPut, "/api/users/"+pathEscape(id), in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteUser removes a user. Their profile data stays on the server. Admins
+// only.
+func (c *Client) DeleteUser(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/users/"+pathEscape(id), nil, nil)
+}
+
+// Tokens lists the caller's API tokens, or every token for admins.
+func (c *Client) Tokens(ctx context.Context) ([]Token, error) {
+	var out []Token
+	err := c.do(ctx, http.MethodGet, "/api/tokens", nil, &out)
+	return out, err
+}
+
+// CreateToken issues an API token to the caller and returns it with its
+// secret, which can't be retrieved again. A zero ttl never expires.
+func (c *Client) CreateToken(ctx context.Context, name string, scopes []string, ttl time.Duration) (*Token, string, error) {
+	in := map[string]any{"name": name, "scopes": scopes}
+	if ttl > 0 {
+		in["expires_in"] = ttl.String()
+	}
+	var out struct {
+		Token  Token  `json:"token"`
+		Secret string `json:"secret"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/tokens", in, &out); err != nil {
+		return nil, "", err
+	}
+	return &out.Token, out.Secret, nil
+}
+
+// RevokeToken deletes an API token.
+func (c *Client) RevokeToken(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/tokens/"+pathEscape(id), nil, nil)
+}
+
+// Devices lists the caller's paired devices, or every device for admins.
+func (c *Client) Devices(ctx context.Context) ([]Device, error) {
+	var out []Device
+	err := c.do(ctx, http.MethodGet, "/api/devices", nil, &out)
+	return out, err
+}
+
+// StartPairing issues a one-time code that pairs a device to the caller
+// when it opens the returned URL within five minutes.
+func (c *Client) StartPairing(ctx context.Context) (*Pairing, error) {
+	var out Pairing
+	if err := c.do(ctx, http.MethodPost, "/api/devices/pairing", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RevokeDevice unpairs a device.
+func (c *Client) RevokeDevice(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/devices/"+pathEscape(id), nil, nil)
+}
+
+// Preferences returns the caller's dashboard preferences.
+func (c *Client) Preferences(ctx context.Context) (map[string]json.RawMessage, error) {
+	var out map[string]json.RawMessage
+	err := c.do(ctx, http.MethodGet, "/api/preferences", nil, &out)
+	return out, err
+}
+
+// UpdatePreferences merges patch into the caller's preferences; a nil value
+// removes its key. It returns the resulting preferences.
+func (c *Client) UpdatePreferences(ctx context.Context, patch map[string]any) (map[string]json.RawMessage, error) {
+	var out map[string]json.RawMessage
+	err := c.do(ctx, http.MethodPut, "/api/preferences", patch, &out)
+	return out, err
+}
+
+// Verify checks the server's stores for corruption and inconsistencies. With
+// receipts, mined sends are also checked against their receipts.
+func (c *Client) Verify(ctx context.Context, receipts bool) (*VerifyReport, error) {
+	var out VerifyReport
+	if err := c.do(ctx, http.MethodGet, "/api/verify?receipts="+strconv.FormatBool(receipts), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// FaucetStatus reports the faucet balance and recent dispenses. It fails with
+// a 404 *APIError when faucet mode is off.
+func (c *Client) FaucetStatus(ctx context.Context) (*FaucetStatus, error) {
+	var out FaucetStatus
+	if err := c.do(ctx, http.MethodGet, "/api/faucet", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// FaucetDrip requests funds from the public faucet and returns the transaction hash.
+func (c *Client) FaucetDrip(ctx context.Context, address, captcha string) (string, error) {
+	var resp struct {
+		TxHash string `json:"tx_hash"`
+	}
+	in := map[string]string{"address": address, "captcha": captcha}
+	err := c.do(ctx, http.MethodPost, "/faucet/drip", in, &resp)
+	return resp.TxHash, err
+}
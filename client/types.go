@@ -0,0 +1,1382 @@
+package client
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Health is the /health response.
+type Health struct {
+	Status  string `json:"status"`
+	Version string `json:"version"`
+}
+
+// Endpoint is a named EVM RPC endpoint.
+type Endpoint struct {
+	ID            string     `json:"id,omitempty"`
+	Name          string     `json:"name"`
+	URL           string     `json:"url"`
+	Asset         string     `json:"asset"`                   // registry ID (or symbol) of the native currency
+	JWTSecret     string     `json:"jwt_secret,omitempty"`    // hex HS256 secret for authenticated nodes
+	Timeout       string     `json:"timeout,omitempty"`       // request timeout such as "30s"; the server's default when empty
+	Proxy         string     `json:"proxy,omitempty"`         // http(s):// or socks5(h):// proxy URL, "tor", or "direct"; the server's default when empty
+	PollInterval  string     `json:"poll_interval,omitempty"` // how often it is checked, such as "1m"; the server's default when empty
+	Consensus     string     `json:"consensus,omitempty"`     // beacon API URL of a light client verifying its reads
+	Checkpoint    string     `json:"checkpoint,omitempty"`    // block root the light client starts from; the beacon node's finalized block when empty
+	Private       bool       `json:"private,omitempty"`       // a private submission endpoint, such as Flashbots Protect
+	StatusURL     string     `json:"status_url,omitempty"`    // the relay's status API the hash is appended to; Flashbots Protect's for its RPC when empty
+	Confirmations int        `json:"confirmations,omitempty"` // blocks deep a sent transaction must be to count as confirmed; once mined when 0
+	DeletedAt     *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Asset is a registered currency.
+type Asset struct {
+	ID          string `json:"id,omitempty"`
+	Symbol      string `json:"symbol"`
+	Decimals    int    `json:"decimals"`
+	CoingeckoID string `json:"coingecko_id,omitempty"`
+	Icon        string `json:"icon,omitempty"`
+}
+
+// Status is the live health of an endpoint.
+type Status struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	URL           string `json:"url"`
+	Asset         string `json:"asset"`
+	Symbol        string `json:"symbol"`
+	Decimals      int    `json:"decimals"`
+	HasJWT        bool   `json:"has_jwt,omitempty"` // see Client.EndpointJWTSecret for the secret
+	Timeout       string `json:"timeout,omitempty"`
+	Proxy         string `json:"proxy,omitempty"`
+	PollInterval  string `json:"poll_interval,omitempty"`
+	Consensus     string `json:"consensus,omitempty"`
+	Checkpoint    string `json:"checkpoint,omitempty"`
+	Private       bool   `json:"private,omitempty"`
+	StatusURL     string `json:"status_url,omitempty"`
+	Confirmations int    `json:"confirmations,omitempty"`
+	Online        bool   `json:"online"`
+	ChainID       string `json:"chain_id,omitempty"`
+	BlockNumber   string `json:"block_number,omitempty"`
+	Latency       int64  `json:"latency_ms"`
+
+	CheckedAt    time.Time     `json:"checked_at"`             // when the endpoint was last asked
+	Capabilities *Capabilities `json:"capabilities,omitempty"` // probed once online
+
+	Flags     []string `json:"flags,omitempty"`      // "lagging" or "forked", against endpoints of the same chain
+	LagBlocks uint64   `json:"lag_blocks,omitempty"` // blocks behind the highest endpoint of the same chain
+
+	Failures   int `json:"failures,omitempty"`   // failed checks in a row while offline
+	Recovering int `json:"recovering,omitempty"` // successful checks in a row while still shown offline
+}
+
+// Capabilities are the optional methods and transports an endpoint serves.
+type Capabilities struct {
+	Debug      bool      `json:"debug"`       // debug_traceTransaction
+	Trace      bool      `json:"trace"`       // trace_transaction
+	TxPool     bool      `json:"txpool"`      // txpool_status
+	FeeHistory bool      `json:"fee_history"` // eth_feeHistory
+	WebSocket  bool      `json:"websocket"`   // JSON-RPC over ws:// or wss:// at the same address
+	Archive    bool      `json:"archive"`     // serves state back to block 1
+	StateDepth uint64    `json:"state_depth"` // blocks behind the head it serves state for
+	ProbedAt   time.Time `json:"probed_at"`
+}
+
+// Metrics extends Status with gas price and pending pool size. PendingSource
+// is "txpool" when PendingCount covers the whole pool, or "pending_block"
+// when it counts only the node's pending block.
+type Metrics struct {
+	Status
+	GasPrice      string `json:"gas_price,omitempty"`
+	PendingCount  *int64 `json:"pending_count,omitempty"`
+	PendingSource string `json:"pending_source,omitempty"`
+}
+
+// MethodStats is the latency distribution of one method's calls in a
+// benchmark.
+type MethodStats struct {
+	Method  string `json:"method"`
+	Calls   int    `json:"calls"`
+	Errors  int    `json:"errors"`
+	MinMS   int64  `json:"min_ms"`
+	P50MS   int64  `json:"p50_ms"`
+	P90MS   int64  `json:"p90_ms"`
+	MaxMS   int64  `json:"max_ms"`
+	LastErr string `json:"last_error,omitempty"`
+}
+
+// Bench is an endpoint's benchmark. Score is out of 100 and comparable
+// across endpoints.
+type Bench struct {
+	Endpoint     string        `json:"endpoint"`
+	Name         string        `json:"name"`
+	ChainID      string        `json:"chain_id"`
+	RanAt        time.Time     `json:"ran_at"`
+	Methods      []MethodStats `json:"methods"`
+	Batch        bool          `json:"batch"`
+	BatchMS      int64         `json:"batch_ms"`
+	MaxLogsRange uint64        `json:"max_logs_range"` // widest eth_getLogs block range served; 0 if none
+	WebSocket    bool          `json:"websocket"`
+	Score        int           `json:"score"`
+}
+
+// LightClientHead is an execution header a light client's sync committee
+// attested to.
+type LightClientHead struct {
+	Slot        uint64 `json:"slot"`
+	BlockNumber uint64 `json:"block_number"`
+	BlockHash   string `json:"block_hash"`
+	StateRoot   string `json:"state_root"`
+}
+
+// LightClient is how far an endpoint's light client has followed the
+// beacon chain. Period is the sync committee period of Finalized.
+type LightClient struct {
+	Consensus  string           `json:"consensus"`
+	Checkpoint string           `json:"checkpoint,omitempty"`
+	Synced     bool             `json:"synced"`
+	Period     uint64           `json:"period"`
+	Latest     *LightClientHead `json:"latest,omitempty"`
+	Finalized  *LightClientHead `json:"finalized,omitempty"`
+	SyncedAt   time.Time        `json:"synced_at"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// TxPool is the size of an endpoint's transaction pool and the
+// transactions waiting in it from the addresses asked about.
+type TxPool struct {
+	Pending      uint64   `json:"pending"`
+	Queued       uint64   `json:"queued"` // waiting on a lower nonce or a higher balance
+	Addresses    []string `json:"addresses"`
+	Transactions []PoolTx `json:"transactions"`
+}
+
+// PoolTx is a transaction waiting in a node's pool. Quantities are hex.
+type PoolTx struct {
+	Status               string `json:"status"` // pending or queued
+	Hash                 string `json:"hash"`
+	From                 string `json:"from"`
+	To                   string `json:"to,omitempty"`
+	Nonce                string `json:"nonce"`
+	Value                string `json:"value"`
+	Gas                  string `json:"gas"`
+	GasPrice             string `json:"gas_price,omitempty"`
+	MaxFeePerGas         string `json:"max_fee_per_gas,omitempty"`
+	MaxPriorityFeePerGas string `json:"max_priority_fee_per_gas,omitempty"`
+	Type                 string `json:"type,omitempty"`
+}
+
+// StatusResponse is the /api/status response.
+type StatusResponse struct {
+	Version   string   `json:"version"`
+	Endpoints []Status `json:"endpoints"`
+	LockEpoch int64    `json:"lock_epoch"`
+}
+
+// Duplicate describes the existing endpoint a new one would duplicate.
+type Duplicate struct {
+	Existing Endpoint `json:"existing"`
+	Reason   string   `json:"reason"` // "url" or "chain_host"
+}
+
+// Revert is why a call or transaction reverted, decoded from its revert
+// data.
+type Revert struct {
+	Kind   string `json:"kind"` // error, panic, custom, unknown, or empty
+	Reason string `json:"reason"`
+	Error  string `json:"error,omitempty"` // the custom error's signature
+	Args   []any  `json:"args,omitempty"`
+	Data   string `json:"data,omitempty"`
+}
+
+// RPCRequest is a JSON-RPC call to proxy.
+type RPCRequest struct {
+	Method string `json:"method"`
+	Params []any  `json:"params"`
+}
+
+// BroadcastRequest sends a signed raw transaction.
+type BroadcastRequest struct {
+	Endpoint string `json:"endpoint"`
+	Raw      string `json:"raw"`
+	Private  bool   `json:"private,omitempty"` // send to a private endpoint of the chain
+}
+
+// PrivateTx is a transaction sent to a private endpoint and what its relay
+// last said of it. Status is pending, included, failed, cancelled, or
+// unknown; Error says why the last check failed, or why it was given up on.
+type PrivateTx struct {
+	Hash      string     `json:"hash"`
+	Endpoint  string     `json:"endpoint"`
+	Status    string     `json:"status"`
+	Block     string     `json:"block,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	SentAt    time.Time  `json:"sent_at"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+}
+
+// TxRequest describes a transaction to build. Quantities are wei, as decimal
+// or 0x-hex strings; empty nonce, gas, and fee fields are filled by the server.
+type TxRequest struct {
+	Endpoint             string `json:"endpoint"`
+	From                 string `json:"from"`
+	To                   string `json:"to,omitempty"`
+	Value                string `json:"value,omitempty"`
+	Data                 string `json:"data,omitempty"`
+	Nonce                string `json:"nonce,omitempty"`
+	Gas                  string `json:"gas,omitempty"`
+	MaxFeePerGas         string `json:"max_fee_per_gas,omitempty"`
+	MaxPriorityFeePerGas string `json:"max_priority_fee_per_gas,omitempty"`
+}
+
+// Envelope is an unsigned transaction plus what's needed to sign it offline.
+type Envelope struct {
+	Version        int       `json:"version"`
+	Endpoint       string    `json:"endpoint"`
+	ChainID        string    `json:"chain_id"`
+	From           string    `json:"from"`
+	Tx             Fields    `json:"tx"`
+	Summary        Summary   `json:"summary"`
+	SigningPayload string    `json:"signing_payload"`
+	HashToSign     string    `json:"hash_to_sign"`
+	CreatedAt      time.Time `json:"created_at"`
+
+	ConfirmRequired bool `json:"confirm_required,omitempty"` // signing it on the server needs a Confirmation
+
+	L1Fee *L1Fee `json:"l1_fee,omitempty"` // set on rollups
+
+	Warnings []Warning `json:"warnings,omitempty"` // scam and address-poisoning checks on the recipients, and risk scanner findings
+	Blocked  bool      `json:"blocked,omitempty"`  // the server refuses to sign or broadcast it
+
+	Labels []Label `json:"labels,omitempty"` // the profile's labels of the sender, target, and token recipient or spender
+}
+
+// Warning is a reason to look twice at a transaction before signing it.
+type Warning struct {
+	Kind     string `json:"kind"`     // scam_address, address_poisoning, risk_scan_failed, or a risk scanner's own
+	Severity string `json:"severity"` // info, warning or critical
+	Message  string `json:"message"`
+}
+
+// L1Fee is a rollup's fee for posting a transaction's data to L1.
+type L1Fee struct {
+	Rollup   string `json:"rollup"`        // op or arbitrum
+	Fee      string `json:"fee"`           // hex wei, estimated at build time
+	Included bool   `json:"included"`      // already paid for by the transaction's gas (Arbitrum)
+	Gas      string `json:"gas,omitempty"` // hex; the gas that pays for it, on Arbitrum
+}
+
+// Confirmation re-types the end of the recipient address and the amount of
+// a large send. The server only signs values at its CONFIRM_THRESHOLD with
+// one; see WithConfirmation.
+type Confirmation struct {
+	ToSuffix string `json:"to_suffix"` // last 6 characters of the recipient address
+	Value    string `json:"value"`     // whole native units, e.g. "2.5"
+}
+
+// Fields are the transaction fields as hex quantities and data.
+type Fields struct {
+	Type                 string `json:"type"`
+	Nonce                string `json:"nonce"`
+	To                   string `json:"to,omitempty"`
+	Value                string `json:"value"`
+	Gas                  string `json:"gas"`
+	MaxFeePerGas         string `json:"max_fee_per_gas"`
+	MaxPriorityFeePerGas string `json:"max_priority_fee_per_gas"`
+	Data                 string `json:"data"`
+}
+
+// Summary is a human-readable description of a transaction.
+type Summary struct {
+	Action    string `json:"action"`
+	Value     string `json:"value"`
+	MaxFee    string `json:"max_fee"` // includes an L1 fee charged on top of gas
+	L1Fee     string `json:"l1_fee,omitempty"`
+	Method    string `json:"method,omitempty"`
+	Recipient string `json:"recipient,omitempty"`
+	Amount    string `json:"amount,omitempty"`
+}
+
+// Signature is a detached transaction signature.
+type Signature struct {
+	YParity string `json:"y_parity"`
+	R       string `json:"r"`
+	S       string `json:"s"`
+}
+
+// ImportRequest verifies a transaction signed elsewhere. Set Raw, Signature,
+// or UR, the parts of an air-gapped device's ur:eth-signature.
+type ImportRequest struct {
+	Envelope  *Envelope  `json:"envelope"`
+	Raw       string     `json:"raw,omitempty"`
+	Signature *Signature `json:"signature,omitempty"`
+	UR        []string   `json:"ur,omitempty"`
+	Broadcast bool       `json:"broadcast"`
+	Private   bool       `json:"private,omitempty"` // broadcast to a private endpoint of the chain
+}
+
+// SignRequestUR is an envelope encoded for an air-gapped device: the parts
+// of its ur:eth-sign-request, to show in a loop, and an SVG QR code of each.
+type SignRequestUR struct {
+	RequestID string   `json:"request_id"`
+	Parts     []string `json:"parts"`
+	QR        []string `json:"qr"`
+}
+
+// Signed is a signed transaction.
+type Signed struct {
+	Hash string `json:"hash"`
+	Raw  string `json:"raw"`
+	From string `json:"from"`
+}
+
+// DeepLink is a parsed primalwallet: link. Value is in whole native units.
+type DeepLink struct {
+	Action   string `json:"action"` // send or sign
+	Endpoint string `json:"endpoint,omitempty"`
+	ChainID  string `json:"chain_id,omitempty"`
+	From     string `json:"from,omitempty"`
+	To       string `json:"to"`
+	Value    string `json:"value,omitempty"`
+	Data     string `json:"data,omitempty"`
+}
+
+// NFTInventory is the ERC-721 and ERC-1155 tokens an address holds on an
+// endpoint's chain. Until Complete, Tokens is what has been found so far.
+type NFTInventory struct {
+	Endpoint  string `json:"endpoint"`
+	ChainID   uint64 `json:"chain_id"`
+	Address   string `json:"address"`
+	IndexedTo uint64 `json:"indexed_to"` // last block whose logs are indexed
+	Head      uint64 `json:"head"`
+	Complete  bool   `json:"complete"`
+	Tokens    []NFT  `json:"tokens"`
+}
+
+// NFT is one token of an NFTInventory.
+type NFT struct {
+	Contract   string       `json:"contract"`
+	TokenID    string       `json:"token_id"` // decimal
+	Standard   string       `json:"standard"` // erc721 or erc1155
+	Balance    string       `json:"balance"`  // decimal; 1 for ERC-721
+	Collection string       `json:"collection,omitempty"`
+	Metadata   *NFTMetadata `json:"metadata,omitempty"` // nil until fetched
+}
+
+// NFTMetadata is the part of a token's metadata the server keeps. Error
+// says why it couldn't be read.
+type NFTMetadata struct {
+	URI         string    `json:"uri"`
+	Name        string    `json:"name,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Image       string    `json:"image,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+// GraphQLRequest is a /graphql request body.
+type GraphQLRequest struct {
+	Query         string         `json:"query"`
+	Variables     map[string]any `json:"variables,omitempty"`
+	OperationName string         `json:"operationName,omitempty"`
+}
+
+// GraphQLError is one entry of a /graphql response's errors. Path locates
+// the field that failed.
+type GraphQLError struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+// GraphQLErrors is the error returned when a query reports errors.
+type GraphQLErrors []GraphQLError
+
+func (e GraphQLErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// LogEntry is one server log record.
+type LogEntry struct {
+	Time      time.Time         `json:"time"`
+	Level     string            `json:"level"`
+	Subsystem string            `json:"subsystem,omitempty"`
+	Message   string            `json:"msg"`
+	Attrs     map[string]string `json:"attrs,omitempty"`
+}
+
+// Logs is the /api/logs response.
+type Logs struct {
+	Subsystems []string   `json:"subsystems"`
+	Entries    []LogEntry `json:"entries"`
+}
+
+// Account is a hardware or remote signer account.
+type Account struct {
+	Address     string     `json:"address"`
+	Label       string     `json:"label"`
+	Kind        string     `json:"kind"` // ledger, trezor, airgap, aws-kms, gcp-kms, web3signer, watch
+	Path        string     `json:"path,omitempty"`
+	Fingerprint string     `json:"fingerprint,omitempty"` // airgap: master key fingerprint
+	KeyID       string     `json:"key_id,omitempty"`
+	Region      string     `json:"region,omitempty"`
+	URL         string     `json:"url,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Devnet is an Anvil or Hardhat node found on one of the server's devnet
+// URLs. Endpoint is the ID of the endpoint with its URL, if any; Watched
+// are its accounts the profile already has.
+type Devnet struct {
+	URL      string          `json:"url"`
+	Kind     string          `json:"kind"` // anvil or hardhat
+	Client   string          `json:"client"`
+	ChainID  uint64          `json:"chain_id"`
+	Block    uint64          `json:"block"`
+	Time     int64           `json:"timestamp"` // of the block, Unix seconds
+	Accounts []DevnetAccount `json:"accounts"`
+	Endpoint string          `json:"endpoint,omitempty"`
+	Watched  []string        `json:"watched"`
+}
+
+// DevnetAccount is an account a devnet funds. WellKnown ones are derived
+// from the public "test ... junk" mnemonic.
+type DevnetAccount struct {
+	Address   string `json:"address"`
+	Balance   string `json:"balance"` // in ETH
+	WellKnown bool   `json:"well_known,omitempty"`
+}
+
+// DevnetAdded is the outcome of adding a devnet: its endpoint, whether it
+// was created or already there, and the accounts newly watched.
+type DevnetAdded struct {
+	Endpoint Endpoint  `json:"endpoint"`
+	Created  bool      `json:"created"`
+	Watched  []Account `json:"watched"`
+}
+
+// DevnetStatus is the head of an Anvil or Hardhat endpoint's chain, with
+// the snapshots taken and the accounts impersonated through the server
+// since it started.
+type DevnetStatus struct {
+	URL          string           `json:"url"`
+	Kind         string           `json:"kind"` // anvil or hardhat
+	Client       string           `json:"client"`
+	ChainID      uint64           `json:"chain_id"`
+	Block        uint64           `json:"block"`
+	Timestamp    int64            `json:"timestamp"` // of the block, Unix seconds
+	Endpoint     string           `json:"endpoint"`
+	Snapshots    []DevnetSnapshot `json:"snapshots"`
+	Impersonated []string         `json:"impersonated"`
+}
+
+// DevnetSnapshot is a saved state of a devnet's chain. ID is the node's.
+type DevnetSnapshot struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	Block     uint64    `json:"block"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Bookmark is a named point in a chain's history.
+type Bookmark struct {
+	ID          string     `json:"id"`
+	ChainID     string     `json:"chain_id"` // decimal
+	Endpoint    string     `json:"endpoint"`
+	BlockNumber uint64     `json:"block_number"`
+	Timestamp   time.Time  `json:"timestamp"`
+	Note        string     `json:"note"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+}
+
+// BookmarkRequest creates a bookmark. Set exactly one of BlockNumber and
+// Timestamp; a timestamp resolves to the last block at or before it.
+type BookmarkRequest struct {
+	Endpoint    string     `json:"endpoint"`
+	BlockNumber *uint64    `json:"block_number,omitempty"`
+	Timestamp   *time.Time `json:"timestamp,omitempty"`
+	Note        string     `json:"note,omitempty"`
+}
+
+// Contact is an address the wallet has sent to. For the server's profile,
+// whose sends the journal keeps, it has what the journal's mined sends
+// moved to and from the address.
+type Contact struct {
+	Address   string    `json:"address"`
+	Name      string    `json:"name,omitempty"` // its label's name
+	Sends     int       `json:"sends"`
+	FirstSent time.Time `json:"first_sent"`
+	LastSent  time.Time `json:"last_sent"`
+
+	Sent            []AssetTotal `json:"sent,omitempty"`
+	Received        []AssetTotal `json:"received,omitempty"` // only what came back in the wallet's own sends
+	Transactions    int          `json:"transactions,omitempty"`
+	LastInteraction *time.Time   `json:"last_interaction,omitempty"`
+}
+
+// AssetTotal is the total of one asset moved on one chain.
+type AssetTotal struct {
+	ChainID      uint64 `json:"chain_id"`
+	Token        string `json:"token"`                   // symbol; an unregistered token's address
+	TokenAddress string `json:"token_address,omitempty"` // empty for the native currency
+	Amount       string `json:"amount"`                  // in whole units; raw for an unregistered token; the count of ERC-721 tokens
+}
+
+// Label names and tags an address, the profile's own or anyone's.
+type Label struct {
+	Address   string    `json:"address"`
+	Name      string    `json:"name,omitempty"`
+	Tags      []string  `json:"tags,omitempty"` // lowercase letters, digits, and - _ . :
+	Note      string    `json:"note,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SearchResult is one thing a search found. Kind is endpoint, account,
+// label, tag, contact, alert, token, tx, block, or address; the fields that
+// identify it are set.
+type SearchResult struct {
+	Kind     string `json:"kind"`
+	Title    string `json:"title"`
+	Detail   string `json:"detail,omitempty"`
+	Address  string `json:"address,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+	Endpoint string `json:"endpoint,omitempty"`
+	ChainID  uint64 `json:"chain_id,omitempty"`
+	Tag      string `json:"tag,omitempty"`
+}
+
+// ERC20Token is a registered ERC-20 token. List is the ID of the token list
+// it came from; it is empty for custom tokens.
+type ERC20Token struct {
+	ChainID  uint64    `json:"chain_id"`
+	Address  string    `json:"address"`
+	Symbol   string    `json:"symbol"`
+	Name     string    `json:"name,omitempty"`
+	Decimals int       `json:"decimals"`
+	LogoURI  string    `json:"logo_uri,omitempty"`
+	List     string    `json:"list,omitempty"`
+	AddedAt  time.Time `json:"added_at"`
+
+	// Set for custom tokens, which are read from the contract when added.
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
+	FeeBps     int        `json:"fee_bps,omitempty"` // withheld by a transfer, in basis points
+	Warnings   []string   `json:"warnings,omitempty"`
+}
+
+// ERC20TokenRequest registers a custom token. The server reads its chain
+// from Endpoint and its symbol, name, and decimals from the contract.
+type ERC20TokenRequest struct {
+	Endpoint string `json:"endpoint"`
+	Address  string `json:"address"`
+	LogoURI  string `json:"logo_uri,omitempty"`
+}
+
+// ERC20Balance is an address's balance of a registered token.
+type ERC20Balance struct {
+	ERC20Token
+	Balance string `json:"balance"` // smallest unit, decimal
+}
+
+// TokenList is an imported token list. Skipped counts entries for chains
+// without an endpoint, already registered, or invalid. Error says why the
+// last refresh failed.
+type TokenList struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	URL        string    `json:"url,omitempty"` // empty for uploaded lists
+	Tokens     int       `json:"tokens"`
+	Skipped    int       `json:"skipped"`
+	ImportedAt time.Time `json:"imported_at"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// PermitRequest describes an EIP-2612 ("eip2612") or Permit2 ("permit2")
+// permit. Amount is in the token's smallest unit; empty is unlimited. A zero
+// Deadline is an hour from now, and a zero Expiration (Permit2 only) 30
+// days.
+type PermitRequest struct {
+	Endpoint   string `json:"endpoint"`
+	Kind       string `json:"kind"`
+	Owner      string `json:"owner"`
+	Token      string `json:"token"`
+	Spender    string `json:"spender"`
+	Amount     string `json:"amount,omitempty"`
+	Deadline   uint64 `json:"deadline,omitempty"`
+	Expiration uint64 `json:"expiration,omitempty"`
+	Signature  string `json:"signature,omitempty"`
+}
+
+// Permit is a built permit. TypedData is what the owner signs; once signed,
+// Calldata calls permit() on Contract.
+type Permit struct {
+	Kind            string          `json:"kind"`
+	ChainID         uint64          `json:"chain_id"`
+	Contract        string          `json:"contract"`
+	Owner           string          `json:"owner"`
+	Token           string          `json:"token"`
+	Spender         string          `json:"spender"`
+	Amount          string          `json:"amount"`
+	Nonce           string          `json:"nonce"`
+	Deadline        uint64          `json:"deadline"`
+	Expiration      uint64          `json:"expiration,omitempty"`
+	TypedData       json.RawMessage `json:"typed_data"`
+	DomainSeparator string          `json:"domain_separator"`
+	MessageHash     string          `json:"message_hash"`
+	Digest          string          `json:"digest"`
+	Warnings        []string        `json:"warnings,omitempty"`
+	Signature       string          `json:"signature,omitempty"`
+	V               int             `json:"v,omitempty"`
+	R               string          `json:"r,omitempty"`
+	S               string          `json:"s,omitempty"`
+	Calldata        string          `json:"calldata,omitempty"`
+}
+
+// ABI is a registered contract ABI.
+type ABI struct {
+	ID        string        `json:"id"`
+	Name      string        `json:"name"`
+	Functions []ABIFunction `json:"functions"`
+}
+
+// ABIFunction is a function of a registered ABI.
+type ABIFunction struct {
+	Name            string     `json:"name"`
+	Signature       string     `json:"signature"` // e.g. "transfer(address,uint256)"
+	Selector        string     `json:"selector"`
+	Inputs          []ABIParam `json:"inputs"`
+	Outputs         []ABIParam `json:"outputs,omitempty"`
+	StateMutability string     `json:"stateMutability,omitempty"`
+}
+
+// ABIParam is a function input or output. Components are a tuple's fields.
+type ABIParam struct {
+	Name       string     `json:"name"`
+	Type       string     `json:"type"`
+	Components []ABIParam `json:"components,omitempty"`
+}
+
+// Calldata is an encoded or decoded contract call. Args are in the form
+// EncodeCalldata takes: strings for numbers, addresses, and bytes, bools,
+// and slices for arrays and tuples. Verified reports that decoding and
+// encoding the data again gave the same bytes.
+type Calldata struct {
+	ABI      string     `json:"abi"`
+	Function string     `json:"function"`
+	Selector string     `json:"selector"`
+	Data     string     `json:"data"`
+	Args     []any      `json:"args"`
+	Verified bool       `json:"verified"`
+	Inputs   []ABIParam `json:"inputs"`
+}
+
+// Contract is what Sourcify and the block explorers say about the source of
+// a contract. Source is the one that verified it; Match is exact or
+// partial. Sources, path to content, are only filled in on request.
+type Contract struct {
+	ChainID        uint64            `json:"chain_id"`
+	Address        string            `json:"address"`
+	Verified       bool              `json:"verified"`
+	Source         string            `json:"source,omitempty"`
+	Match          string            `json:"match,omitempty"`
+	Name           string            `json:"name,omitempty"`
+	Language       string            `json:"language,omitempty"`
+	Compiler       string            `json:"compiler,omitempty"`
+	License        string            `json:"license,omitempty"`
+	Proxy          bool              `json:"proxy,omitempty"`
+	Implementation string            `json:"implementation,omitempty"`
+	ABI            json.RawMessage   `json:"abi,omitempty"`
+	Files          []string          `json:"files,omitempty"`
+	Sources        map[string]string `json:"sources,omitempty"`
+	CheckedAt      time.Time         `json:"checked_at"`
+}
+
+// ContractSummary is the short form of a verified Contract.
+type ContractSummary struct {
+	Source string `json:"source"`
+	Match  string `json:"match,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+// Schedule is a recurring transaction. Spec is five-field cron in UTC,
+// @hourly/@daily/@weekly/@monthly, or "@every <duration>".
+type Schedule struct {
+	ID        string     `json:"id,omitempty"`
+	Name      string     `json:"name"`
+	Spec      string     `json:"spec"`
+	Mode      string     `json:"mode"` // approve or auto
+	Paused    bool       `json:"paused"`
+	Endpoint  string     `json:"endpoint"`
+	From      string     `json:"from"`
+	To        string     `json:"to"`
+	Value     string     `json:"value"` // wei
+	Data      string     `json:"data,omitempty"`
+	NextRun   *time.Time `json:"next_run,omitempty"`
+	LastRun   *time.Time `json:"last_run,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// ScheduleRun is one firing of a schedule.
+type ScheduleRun struct {
+	ID         string     `json:"id"`
+	ScheduleID string     `json:"schedule_id"`
+	Name       string     `json:"name"`
+	Mode       string     `json:"mode"`
+	DueAt      time.Time  `json:"due_at"`
+	Missed     bool       `json:"missed,omitempty"` // came due while the server was down
+	Status     string     `json:"status"`           // pending, sending, sent, rejected, failed
+	Envelope   *Envelope  `json:"envelope,omitempty"`
+	Hash       string     `json:"hash,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	DecidedAt  *time.Time `json:"decided_at,omitempty"`
+}
+
+// BridgeRequest registers a bridge transfer for tracking.
+type BridgeRequest struct {
+	Name           string `json:"name,omitempty"`
+	SourceEndpoint string `json:"source_endpoint"`
+	SourceHash     string `json:"source_hash"`
+	DestEndpoint   string `json:"dest_endpoint"`
+	Recipient      string `json:"recipient,omitempty"`  // defaults to the source transaction's sender
+	Token          string `json:"token,omitempty"`      // ERC-20 on the destination; empty for the native currency
+	MinAmount      string `json:"min_amount,omitempty"` // smallest unit; empty for any increase
+}
+
+// BridgeTransfer is a tracked bridge transfer and how far it has got.
+type BridgeTransfer struct {
+	ID             string     `json:"id"`
+	Name           string     `json:"name,omitempty"`
+	SourceEndpoint string     `json:"source_endpoint"`
+	SourceChainID  string     `json:"source_chain_id"`
+	SourceHash     string     `json:"source_hash"`
+	SourceBlock    string     `json:"source_block,omitempty"`
+	DestEndpoint   string     `json:"dest_endpoint"`
+	DestChainID    string     `json:"dest_chain_id"`
+	Recipient      string     `json:"recipient"`
+	Token          string     `json:"token,omitempty"`
+	MinAmount      string     `json:"min_amount,omitempty"`
+	Status         string     `json:"status"` // pending, in_flight, arrived, failed, stalled
+	StartBlock     string     `json:"start_block"`
+	StartBalance   string     `json:"start_balance,omitempty"`
+	Scanned        string     `json:"scanned,omitempty"`
+	Received       string     `json:"received,omitempty"`
+	ArrivalHash    string     `json:"arrival_hash,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	ConfirmedAt    *time.Time `json:"confirmed_at,omitempty"`
+	ArrivedAt      *time.Time `json:"arrived_at,omitempty"`
+}
+
+// BatchRequest describes a batch send. List is CSV or JSON text of
+// address and amount pairs, read when Recipients is empty.
+type BatchRequest struct {
+	Name       string           `json:"name,omitempty"`
+	Endpoint   string           `json:"endpoint"`
+	From       string           `json:"from"`
+	Token      string           `json:"token,omitempty"` // ERC-20 address; empty for the native currency
+	Mode       string           `json:"mode,omitempty"`  // transfers (the default) or disperse
+	Recipients []BatchRecipient `json:"recipients,omitempty"`
+	List       string           `json:"list,omitempty"`
+}
+
+// BatchRecipient is one address a batch pays.
+type BatchRecipient struct {
+	Address string `json:"address"`
+	Amount  string `json:"amount"` // whole units, e.g. 1.5
+	Error   string `json:"error,omitempty"`
+	Warning string `json:"warning,omitempty"`
+}
+
+// BatchTx is one transaction of a batch and how far it has got.
+type BatchTx struct {
+	Kind       string    `json:"kind"` // transfer, approve, or disperse
+	Recipients []int     `json:"recipients,omitempty"`
+	Envelope   *Envelope `json:"envelope"`
+	Hash       string    `json:"hash,omitempty"`
+	Stage      string    `json:"stage,omitempty"` // a journal stage or queued; empty until sent
+	Error      string    `json:"error,omitempty"`
+}
+
+// BatchCost is what a batch's unsent transactions take from its sender.
+type BatchCost struct {
+	Symbol       string `json:"symbol"`
+	Total        string `json:"total"`
+	MaxFee       string `json:"max_fee"`
+	Needed       string `json:"needed"`
+	Balance      string `json:"balance"`
+	TokenBalance string `json:"token_balance,omitempty"`
+	Short        bool   `json:"short,omitempty"`
+}
+
+// BatchProgress counts a batch's transactions by how far they have got.
+type BatchProgress struct {
+	Total     int  `json:"total"`
+	Unsent    int  `json:"unsent"`
+	Pending   int  `json:"pending"`
+	Confirmed int  `json:"confirmed"`
+	Reverted  int  `json:"reverted"`
+	Failed    int  `json:"failed"`
+	Done      bool `json:"done"`
+}
+
+// Batch is a batch send: recipients, one sender, and the transactions that
+// pay them.
+type Batch struct {
+	ID         string           `json:"id,omitempty"`
+	Name       string           `json:"name,omitempty"`
+	Endpoint   string           `json:"endpoint"`
+	From       string           `json:"from"`
+	Token      string           `json:"token,omitempty"`
+	Mode       string           `json:"mode"`
+	Recipients []BatchRecipient `json:"recipients"`
+	Txs        []BatchTx        `json:"txs"`
+	Cost       BatchCost        `json:"cost"`
+	Progress   *BatchProgress   `json:"progress,omitempty"`
+	CreatedAt  time.Time        `json:"created_at,omitempty"`
+	UpdatedAt  time.Time        `json:"updated_at,omitempty"`
+}
+
+// Alert is a condition the server checks as it polls its endpoints, and
+// whether it held at the last check.
+type Alert struct {
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Kind     string `json:"kind"` // gas, balance, or offline
+	Endpoint string `json:"endpoint"`
+	Muted    bool   `json:"muted,omitempty"` // checked, but nothing is sent when it fires
+
+	Metric string `json:"metric,omitempty"` // base_fee, gas_price, or priority_fee; base_fee when empty
+	Below  string `json:"below,omitempty"`  // gwei
+	Above  string `json:"above,omitempty"`  // gwei
+
+	Address   string `json:"address,omitempty"`   // the account a balance alert watches
+	Direction string `json:"direction,omitempty"` // any, in, or out; any when empty
+	Min       string `json:"min,omitempty"`       // smallest change to fire for, in whole native units
+
+	After string `json:"after,omitempty"` // how long an offline alert's endpoint must stay offline, e.g. 5m
+
+	Firing    bool       `json:"firing,omitempty"`
+	Value     string     `json:"value,omitempty"`  // at the last check: gwei, the balance in whole native units, or online or offline
+	Change    string     `json:"change,omitempty"` // the balance change last fired for, signed
+	Since     *time.Time `json:"since,omitempty"`  // when an offline alert's endpoint last went offline
+	Error     string     `json:"error,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+	FiredAt   *time.Time `json:"fired_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at,omitempty"`
+}
+
+// Channel is somewhere the server delivers notifications. Secrets come
+// back as ******** when set; sending them empty on update keeps them.
+type Channel struct {
+	ID       string   `json:"id,omitempty"`
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`            // webhook, telegram, email, or ntfy
+	Kinds    []string `json:"kinds,omitempty"` // notification kinds it gets (gas, balance, offline, tx); all when empty
+	Disabled bool     `json:"disabled,omitempty"`
+
+	URL      string   `json:"url,omitempty"` // webhook, ntfy
+	BotToken string   `json:"bot_token,omitempty"`
+	ChatID   string   `json:"chat_id,omitempty"`
+	SMTPHost string   `json:"smtp_host,omitempty"` // email: host:port
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       []string `json:"to,omitempty"`
+	Token    string   `json:"token,omitempty"` // ntfy access token
+
+	LastSentAt *time.Time `json:"last_sent_at,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at,omitempty"`
+}
+
+// PushSubscription is a browser the server pushes notifications to. Its
+// endpoint shows only the push service's origin.
+type PushSubscription struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name,omitempty"`
+	Endpoint string   `json:"endpoint"`
+	Kinds    []string `json:"kinds,omitempty"`
+	By       string   `json:"by,omitempty"`
+
+	LastSentAt *time.Time `json:"last_sent_at,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Paymaster is an ERC-7677 paymaster service for one chain.
+type Paymaster struct {
+	ID         string         `json:"id,omitempty"`
+	Name       string         `json:"name"`
+	ChainID    uint64         `json:"chain_id"`
+	URL        string         `json:"url"`
+	EntryPoint string         `json:"entry_point,omitempty"` // defaults to the v0.7 EntryPoint
+	Context    map[string]any `json:"context,omitempty"`     // e.g. {"token": "0x..."} to pay gas in an ERC-20
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
+// UserOperation is an ERC-4337 v0.7 UserOperation, with hex quantities and
+// data.
+type UserOperation struct {
+	Sender                        string `json:"sender"`
+	Nonce                         string `json:"nonce"`
+	Factory                       string `json:"factory,omitempty"`
+	FactoryData                   string `json:"factoryData,omitempty"`
+	CallData                      string `json:"callData"`
+	CallGasLimit                  string `json:"callGasLimit"`
+	VerificationGasLimit          string `json:"verificationGasLimit"`
+	PreVerificationGas            string `json:"preVerificationGas"`
+	MaxFeePerGas                  string `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas          string `json:"maxPriorityFeePerGas"`
+	Paymaster                     string `json:"paymaster,omitempty"`
+	PaymasterVerificationGasLimit string `json:"paymasterVerificationGasLimit,omitempty"`
+	PaymasterPostOpGasLimit       string `json:"paymasterPostOpGasLimit,omitempty"`
+	PaymasterData                 string `json:"paymasterData,omitempty"`
+	Signature                     string `json:"signature"`
+}
+
+// Sponsorship is a paymaster's offer to pay for a UserOperation, and the
+// operation with its paymaster fields filled in.
+type Sponsorship struct {
+	PaymasterID                   string        `json:"paymaster_id"`
+	Paymaster                     string        `json:"paymaster"`
+	PaymasterData                 string        `json:"paymaster_data"`
+	PaymasterVerificationGasLimit string        `json:"paymaster_verification_gas_limit,omitempty"`
+	PaymasterPostOpGasLimit       string        `json:"paymaster_post_op_gas_limit,omitempty"`
+	Sponsor                       string        `json:"sponsor"`                // who pays
+	Token                         string        `json:"token,omitempty"`        // ERC-20 the sender pays gas in; empty when sponsored
+	TokenSymbol                   string        `json:"token_symbol,omitempty"` // when the token is registered
+	UserOperation                 UserOperation `json:"user_operation"`
+}
+
+// Safe is a Safe multisig as read from the chain. Keys, from Safes, are
+// which of the searched keys own it.
+type Safe struct {
+	Address         string   `json:"address"`
+	ChainID         uint64   `json:"chain_id"`
+	Version         string   `json:"version"`
+	Owners          []string `json:"owners"`
+	Threshold       uint64   `json:"threshold"`
+	Nonce           uint64   `json:"nonce"`
+	DomainSeparator string   `json:"domain_separator"`
+	Keys            []string `json:"keys,omitempty"`
+}
+
+// SafeTx is a Safe transaction. Value and the gas fields are decimal
+// strings; Operation is 0 for a call and 1 for a delegatecall. A zero Nonce
+// takes the next one after the Safe's pending transactions.
+type SafeTx struct {
+	To             string `json:"to"`
+	Value          string `json:"value"`
+	Data           string `json:"data,omitempty"`
+	Operation      int    `json:"operation"`
+	SafeTxGas      string `json:"safe_tx_gas,omitempty"`
+	BaseGas        string `json:"base_gas,omitempty"`
+	GasPrice       string `json:"gas_price,omitempty"`
+	GasToken       string `json:"gas_token,omitempty"`
+	RefundReceiver string `json:"refund_receiver,omitempty"`
+	Nonce          uint64 `json:"nonce,omitempty"`
+}
+
+// SafeSignable is a Safe transaction ready for an owner to sign: TypedData
+// for eth_signTypedData_v4, or Digest (the safeTxHash) directly.
+type SafeSignable struct {
+	Safe            string          `json:"safe"`
+	ChainID         uint64          `json:"chain_id"`
+	Tx              SafeTx          `json:"tx"`
+	TypedData       json.RawMessage `json:"typed_data"`
+	DomainSeparator string          `json:"domain_separator"`
+	MessageHash     string          `json:"message_hash"`
+	Digest          string          `json:"digest"`
+}
+
+// SafeConfirmation is an owner's signature on a pending Safe transaction.
+type SafeConfirmation struct {
+	Owner       string    `json:"owner"`
+	Signature   string    `json:"signature,omitempty"`
+	SubmittedAt time.Time `json:"submitted_at"`
+}
+
+// SafePending is a Safe transaction waiting for signatures. Mismatch means
+// the Transaction Service's hash isn't the transaction's; the server won't
+// sign it.
+type SafePending struct {
+	SafeSignable
+	SafeTxHash            string             `json:"safe_tx_hash"`
+	Proposer              string             `json:"proposer,omitempty"`
+	Origin                string             `json:"origin,omitempty"`
+	SubmittedAt           time.Time          `json:"submitted_at"`
+	ConfirmationsRequired uint64             `json:"confirmations_required"`
+	Confirmations         []SafeConfirmation `json:"confirmations"`
+	Mismatch              bool               `json:"mismatch,omitempty"`
+}
+
+// SafeSignature is a signature the server handed to the Transaction
+// Service. Transaction is set when it proposed a new transaction.
+type SafeSignature struct {
+	SafeTxHash  string        `json:"safe_tx_hash"`
+	Owner       string        `json:"owner"`
+	Signature   string        `json:"signature"`
+	Transaction *SafeSignable `json:"transaction,omitempty"`
+}
+
+// Intent is a send recorded in the journal before it was signed, and its
+// outcome.
+type Intent struct {
+	ID        string     `json:"id"`
+	Origin    string     `json:"origin"` // e.g. "vault_send", "schedule", "faucet", "cli"
+	Endpoint  string     `json:"endpoint"`
+	ChainID   string     `json:"chain_id"`
+	From      string     `json:"from"`
+	To        string     `json:"to,omitempty"`
+	Value     string     `json:"value"` // hex wei
+	Nonce     string     `json:"nonce"` // hex
+	Stage     string     `json:"stage"` // prepared, signed, sent, failed, mined, confirmed, reverted
+	Hash      string     `json:"hash,omitempty"`
+	Raw       string     `json:"raw,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Block     string     `json:"block,omitempty"`      // hex block number once mined
+	BlockHash string     `json:"block_hash,omitempty"` // of Block
+	Reorgs    int        `json:"reorgs,omitempty"`     // how many times a reorg took away the block it was mined in
+	Fee       string     `json:"fee,omitempty"`        // hex wei paid once mined
+	MinedAt   *time.Time `json:"mined_at,omitempty"`   // timestamp of Block
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+
+	Logs     json.RawMessage `json:"logs,omitempty"`     // the receipt's event logs once mined
+	Internal json.RawMessage `json:"internal,omitempty"` // []InternalTransfer, when the endpoint can trace
+}
+
+// JournalEntry is an intent with its receipt's logs decoded.
+type JournalEntry struct {
+	Intent
+	Events  []Event `json:"events,omitempty"`
+	Summary string  `json:"summary,omitempty"` // e.g. "Swap 1.2 WETH → 3200 USDC"
+	Labels  []Label `json:"labels,omitempty"`  // of the addresses it involves
+
+	Contract *ContractSummary `json:"contract,omitempty"` // the target's verified source, if known
+}
+
+// HistoryRow is one asset a mined send moved, as exported. A send that
+// moved nothing, or reverted, is one row with amount 0, so its fee is still
+// accounted for.
+type HistoryRow struct {
+	Time         time.Time `json:"time"`
+	Chain        string    `json:"chain"` // the endpoint's name
+	ChainID      uint64    `json:"chain_id"`
+	Block        uint64    `json:"block"`
+	Hash         string    `json:"hash"`
+	Status       string    `json:"status"`    // confirmed or reverted
+	Direction    string    `json:"direction"` // out, in, or self, for the sending account
+	From         string    `json:"from"`
+	To           string    `json:"to"`
+	FromLabel    string    `json:"from_label,omitempty"` // the name the profile gave from
+	ToLabel      string    `json:"to_label,omitempty"`
+	Token        string    `json:"token"`                   // symbol; an unregistered token's address
+	TokenAddress string    `json:"token_address,omitempty"` // empty for the native currency
+	TokenID      string    `json:"token_id,omitempty"`      // ERC-721
+	Amount       string    `json:"amount"`                  // in whole units; raw for an unregistered token
+	Fee          string    `json:"fee"`                     // on a send's first row only, in the native currency
+	FeeToken     string    `json:"fee_token"`
+	Summary      string    `json:"summary,omitempty"`
+	Tags         []string  `json:"tags,omitempty"` // of from and to
+}
+
+// HistoryFilter narrows a history export. Range is a span back from now
+// ("30d"), a year ("2025"), or dates ("2025-01-01..2025-06-30"); empty
+// fields don't filter.
+type HistoryFilter struct {
+	Address string // only sends from this account
+	Tag     string // only sends involving an address with this label tag
+	Range   string
+
+	Counterparty string // only sends to or moving assets to or from this address
+}
+
+// Event is a decoded event log.
+type Event struct {
+	Address   string     `json:"address"`
+	Name      string     `json:"name"`
+	Signature string     `json:"signature"`
+	Args      []EventArg `json:"args"`
+}
+
+// EventArg is a decoded event parameter. Indexed strings, bytes, arrays, and
+// tuples hold their Keccak-256 hash.
+type EventArg struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Value   any    `json:"value"`
+	Indexed bool   `json:"indexed,omitempty"`
+}
+
+// InternalTransfer is native currency a contract moved during a
+// transaction: a call with value, a contract created with value, or a
+// self-destruct's balance.
+type InternalTransfer struct {
+	Type  string `json:"type"` // call, create, or selfdestruct
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Value string `json:"value"` // hex wei
+}
+
+// InternalTransfers is a traced transaction's internal transfers. Trace is
+// the method the endpoint traced with, empty when it can't trace.
+type InternalTransfers struct {
+	Hash      string             `json:"hash"`
+	Endpoint  string             `json:"endpoint"`
+	Trace     string             `json:"trace"`
+	Transfers []InternalTransfer `json:"transfers"`
+}
+
+// Approval is a transaction waiting for, or decided by, review in the
+// approval queue.
+type Approval struct {
+	ID        string     `json:"id"`
+	Origin    string     `json:"origin"`
+	Note      string     `json:"note,omitempty"`
+	Envelope  *Envelope  `json:"envelope"`
+	Broadcast bool       `json:"broadcast"`
+	Private   bool       `json:"private,omitempty"`
+	Status    string     `json:"status"`           // pending, sending, sent, rejected, expired, failed
+	Needed    int        `json:"approvals_needed"` // 2 under dual control
+	Signoffs  []Signoff  `json:"signoffs,omitempty"`
+	Signed    *Signed    `json:"signed,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	DecidedAt *time.Time `json:"decided_at,omitempty"`
+	DecidedBy string     `json:"decided_by,omitempty"`
+}
+
+// Signoff is one approver's approval of a queued transaction.
+type Signoff struct {
+	Approver string    `json:"approver"`
+	At       time.Time `json:"at"`
+}
+
+// ApprovalRequest queues a transaction for review. Set Envelope to queue one
+// built with BuildTx, or the TxRequest fields to have the server build it.
+// Broadcast defaults to true.
+type ApprovalRequest struct {
+	TxRequest
+	Envelope  *Envelope `json:"envelope,omitempty"`
+	Origin    string    `json:"origin,omitempty"` // shown to the reviewer, e.g. "walletconnect"
+	Note      string    `json:"note,omitempty"`
+	Broadcast *bool     `json:"broadcast,omitempty"`
+	Private   bool      `json:"private,omitempty"` // broadcast to a private endpoint of the chain
+}
+
+// QueuedError is returned by SignTx and VaultSend when the server requires
+// approval: the transaction was queued instead of signed. Poll Approval, or
+// watch the push channel, for the outcome.
+type QueuedError struct {
+	Approval *Approval
+}
+
+func (e *QueuedError) Error() string {
+	return "transaction queued for approval as " + e.Approval.ID
+}
+
+// Trash is the recycle bin.
+type Trash struct {
+	Endpoints []Endpoint `json:"endpoints"`
+	Accounts  []Account  `json:"accounts"`
+	Bookmarks []Bookmark `json:"bookmarks"`
+	Schedules []Schedule `json:"schedules"`
+}
+
+// Backup is what a backup file holds once opened. The server's export has
+// no keys: the dashboard adds its browser keys before sealing the file.
+type Backup struct {
+	Version     int                        `json:"version"`
+	CreatedAt   time.Time                  `json:"created_at"`
+	Keys        []BackupKey                `json:"keys"`
+	Endpoints   []Endpoint                 `json:"endpoints"`
+	Assets      []Asset                    `json:"assets"`
+	Accounts    []Account                  `json:"accounts"`
+	Bookmarks   []Bookmark                 `json:"bookmarks"`
+	Preferences map[string]json.RawMessage `json:"preferences"`
+}
+
+// BackupKey is a browser vault key in a backup.
+type BackupKey struct {
+	Label      string    `json:"label"`
+	Address    string    `json:"address"`
+	PrivateKey string    `json:"private_key"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// RestoreReport counts what a restore did with one kind of record.
+type RestoreReport struct {
+	Added    int      `json:"added"`
+	Replaced int      `json:"replaced"`
+	Skipped  int      `json:"skipped"`
+	Failed   []string `json:"failed,omitempty"`
+}
+
+// Restore is the /api/restore response.
+type Restore struct {
+	Assets      RestoreReport `json:"assets"`
+	Endpoints   RestoreReport `json:"endpoints"`
+	Accounts    RestoreReport `json:"accounts"`
+	Bookmarks   RestoreReport `json:"bookmarks"`
+	Preferences RestoreReport `json:"preferences"`
+}
+
+// SyncedVault is the browser vault synced between a user's browsers. Keys
+// stay encrypted under a key only the browsers can derive.
+type SyncedVault struct {
+	ID                string          `json:"id"`
+	Credential        json.RawMessage `json:"credential"`
+	CredentialVersion int64           `json:"credential_version"`
+	Version           int64           `json:"version"`
+	Keys              []SyncedKey     `json:"keys"`
+}
+
+// SyncedKey is an encrypted key in the synced vault.
+type SyncedKey struct {
+	Address   string     `json:"address"`
+	Label     string     `json:"label"`
+	Encrypted []byte     `json:"encrypted"`
+	IV        []byte     `json:"iv"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	Version   int64      `json:"version"`
+}
+
+// VaultKey is a key in the server vault.
+type VaultKey struct {
+	Address   string    `json:"address"`
+	Label     string    `json:"label"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// VaultStatus is the state of the server vault.
+type VaultStatus struct {
+	Initialized bool       `json:"initialized"`
+	Unlocked    bool       `json:"unlocked"`
+	Keys        []VaultKey `json:"keys"`
+}
+
+// signedOrBroadcast decodes the responses of the signing operations, which
+// return either a Signed, {signed, broadcast}, or {approval} when the server
+// queued the transaction for review.
+func signedOrBroadcast(data json.RawMessage) (*Signed, error) {
+	var wrapped struct {
+		Signed   *Signed   `json:"signed"`
+		Approval *Approval `json:"approval"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err == nil {
+		if wrapped.Signed != nil {
+			return wrapped.Signed, nil
+		}
+		if wrapped.Approval != nil {
+			return nil, &QueuedError{Approval: wrapped.Approval}
+		}
+	}
+	var s Signed
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// User is an account on a multi-user server. Role is "admin", "operator",
+// "viewer", or "user".
+type User struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Me is who the client is logged in as and what their role permits. User
+// is nil in single-user mode and before logging in.
+type Me struct {
+	MultiUser   bool     `json:"multi_user"`
+	User        *User    `json:"user"`
+	Permissions []string `json:"permissions"` // read, operate, manage, admin
+	Token       *Token   `json:"token"`       // set when the client uses an API token
+	Device      *Device  `json:"device"`      // set for requests from a paired device
+}
+
+// Token is an API token on a multi-user server. Scopes are "read-status",
+// "read-balances", "broadcast", and "admin"; a token never does more than
+// its owner's role allows.
+type Token struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	User       string     `json:"user"`
+	Owner      string     `json:"owner"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Device is a browser paired to a user by QR code, such as a phone. Its
+// scopes are at most read-status, read-balances, and broadcast.
+type Device struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	User       string     `json:"user"`
+	Owner      string     `json:"owner"`
+	Scopes     []string   `json:"scopes"`
+	PairedAt   time.Time  `json:"paired_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastIP     string     `json:"last_ip,omitempty"`
+}
+
+// Pairing is a one-time pairing code, as the dashboard URL a device opens
+// to pair. Fingerprint is the SHA-256 fingerprint of the TLS certificate
+// the device should be shown, empty for plain HTTP.
+type Pairing struct {
+	URL         string    `json:"url"`
+	Fingerprint string    `json:"fingerprint"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	SVG         string    `json:"svg"` // QR code of URL
+}
+
+// Dispense is one faucet payout.
+type Dispense struct {
+	Address   string    `json:"address"`
+	IP        string    `json:"ip"`
+	Amount    string    `json:"amount"` // wei
+	TxHash    string    `json:"tx_hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FaucetStatus is the faucet balance, settings, and recent dispenses.
+type FaucetStatus struct {
+	Endpoint   string     `json:"endpoint"`
+	Address    string     `json:"address"`
+	Symbol     string     `json:"symbol"`
+	Amount     string     `json:"amount"`
+	Interval   string     `json:"interval"`
+	Balance    string     `json:"balance,omitempty"`
+	LowBalance bool       `json:"low_balance"`
+	Dispensed  int        `json:"dispensed"`
+	History    []Dispense `json:"history"`
+}
+
+// VerifyProblem is one inconsistency found by Verify.
+type VerifyProblem struct {
+	Store   string `json:"store"`
+	Item    string `json:"item,omitempty"` // record ID, address, or hash
+	Message string `json:"message"`
+}
+
+// VerifyReport is the outcome of Verify.
+type VerifyReport struct {
+	Checked  map[string]int  `json:"checked"` // records checked per store
+	Skipped  []string        `json:"skipped"` // checks that couldn't run, and why
+	Problems []VerifyProblem `json:"problems"`
+}
@@ -0,0 +1,22 @@
+//go:build broadcastonly
+
+package main
+
+import (
+	"log/slog"
+
+	"github.com/primal-host/wallet/internal/bench"
+	"github.com/primal-host/wallet/internal/config"
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/icon"
+	"github.com/primal-host/wallet/internal/idempotency"
+	"github.com/primal-host/wallet/internal/logtail"
+	"github.com/primal-host/wallet/internal/server"
+	"github.com/primal-host/wallet/internal/uptime"
+)
+
+// newServer builds the broadcast-only server: no accounts, no vault.
+func newServer(cfg *config.Config, store *endpoint.Store, idem *idempotency.Store, icons *icon.Cache, history *uptime.Store, benches *bench.Store, limits server.Limits, headers server.Headers, proxy server.Proxy, logs *logtail.Tail) *server.Server {
+	slog.Info("broadcast-only mode: key management disabled")
+	return server.New(store, idem, icons, history, benches, limits, headers, proxy, logs, cfg.ListenAddr)
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/primal-host/wallet/client"
+	"github.com/primal-host/wallet/internal/asset"
+	"github.com/primal-host/wallet/internal/config"
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+	"github.com/primal-host/wallet/internal/txbuild"
+)
+
+// CLI subcommands talk to the running server's API when it answers /health,
+// and otherwise work directly on the local files.
+
+type command struct {
+	usage string
+	run   func(c *cli, args []string) error
+}
+
+var commands = map[string]command{
+	"status":    {"status", cmdStatus},
+	"endpoints": {"endpoints list | endpoints add [-force] [-jwt-secret hex] [-timeout d] [-proxy url] [-poll-interval d] [-consensus url [-checkpoint root]] [-private [-status-url url]] [-confirmations n] <name> <url> <asset>", cmdEndpoints},
+	"assets":    {"assets", cmdAssets},
+	"balance":   {"balance [-endpoint id] <address>", cmdBalance},
+	"broadcast": {"broadcast [-private] [-idempotency-key key] <endpoint> <raw-tx-hex>", cmdBroadcast},
+}
+
+type cli struct {
+	cfg    *config.Config
+	server string         // server URL, running or not
+	api    *client.Client // nil when the server isn't running
+	out    io.Writer
+}
+
+var errUsage = errors.New("usage")
+
+// runCLI runs a subcommand and returns the process exit code.
+func runCLI(args []string) int {
+	cfg := config.Load()
+	fs := flag.NewFlagSet("wallet", flag.ContinueOnError)
+	server := fs.String("server", envOr("WALLET_URL", localURL(cfg.ListenAddr)), "URL of the running wallet server")
+	offline := fs.Bool("offline", false, "work on local files even if the server is running")
+	fs.Usage = func() { usage(fs) }
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		usage(fs)
+		return 2
+	}
+	name := fs.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "wallet: unknown command %q\n", name)
+		usage(fs)
+		return 2
+	}
+
+	c := &cli{cfg: cfg, server: *server, out: os.Stdout}
+	if !*offline {
+		api := client.New(*server)
+		api.Session = os.Getenv("WALLET_SESSION")
+		api.Token = os.Getenv("WALLET_TOKEN")
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		if _, err := api.Health(ctx); err == nil {
+			c.api = api
+		}
+		cancel()
+	}
+	if err := cmd.run(c, fs.Args()[1:]); err != nil {
+		if err == errUsage {
+			fmt.Fprintln(os.Stderr, "usage: wallet "+cmd.usage)
+			return 2
+		}
+		var apiErr *client.APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized && apiErr.Message == "login required" {
+			err = fmt.Errorf("%w (log in with eval \"$(wallet login <name>)\" or set WALLET_TOKEN)", err)
+		}
+		fmt.Fprintln(os.Stderr, "wallet "+name+":", err)
+		return 1
+	}
+	return 0
+}
+
+func usage(fs *flag.FlagSet) {
+	fmt.Fprintln(os.Stderr, "usage: wallet [flags] <command> [args]")
+	fmt.Fprintln(os.Stderr, "       wallet [serve]    run the server")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "  wallet "+commands[name].usage)
+	}
+	fmt.Fprintln(os.Stderr, "\nflags:")
+	fs.PrintDefaults()
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// localURL turns a listen address like ":4322" into a URL for this host.
+func localURL(addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+	return "http://" + addr
+}
+
+// sendContext carries an idempotency key, if given, to the server.
+func (c *cli) sendContext(idemKey string) context.Context {
+	if idemKey == "" {
+		return context.Background()
+	}
+	return client.WithIdempotencyKey(context.Background(), idemKey)
+}
+
+func (c *cli) store() (*endpoint.Store, error) {
+	assets, err := asset.NewRegistry(c.cfg.AssetsFile)
+	if err != nil {
+		return nil, err
+	}
+	return endpoint.NewStore(c.cfg.EndpointsFile, assets)
+}
+
+// statuses returns live endpoint status from the server, or by polling
+// directly when offline.
+func (c *cli) statuses() ([]endpoint.Status, error) {
+	if c.api != nil {
+		resp, err := c.api.Status(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		statuses := make([]endpoint.Status, len(resp.Endpoints))
+		for i, st := range resp.Endpoints {
+			statuses[i] = endpoint.Status{
+				ID: st.ID, Name: st.Name, URL: st.URL, Asset: st.Asset, Symbol: st.Symbol, Decimals: st.Decimals,
+				HasJWT: st.HasJWT, Timeout: st.Timeout, Proxy: st.Proxy, PollInterval: st.PollInterval, Consensus: st.Consensus, Checkpoint: st.Checkpoint, Private: st.Private, StatusURL: st.StatusURL, Confirmations: st.Confirmations, Online: st.Online, ChainID: st.ChainID, BlockNumber: st.BlockNumber, Latency: st.Latency,
+				Flags: st.Flags, LagBlocks: st.LagBlocks, Failures: st.Failures, Recovering: st.Recovering,
+			}
+			if st.Capabilities != nil {
+				caps := endpoint.Capabilities(*st.Capabilities)
+				statuses[i].Capabilities = &caps
+			}
+		}
+		return statuses, nil
+	}
+	store, err := c.store()
+	if err != nil {
+		return nil, err
+	}
+	return store.Poll(context.Background()), nil
+}
+
+func (c *cli) table() *tabwriter.Writer {
+	return tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+}
+
+func cmdStatus(c *cli, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	statuses, err := c.statuses()
+	if err != nil {
+		return err
+	}
+	w := c.table()
+	fmt.Fprintln(w, "ID\tNAME\tSTATUS\tCHAIN\tBLOCK\tLATENCY\tFEATURES")
+	for _, st := range statuses {
+		state, chain, block := "offline", "-", "-"
+		if st.Online {
+			state = "online"
+		} else if st.Recovering > 0 {
+			state = "recovering"
+		}
+		for _, f := range st.Flags {
+			if f == endpoint.FlagLagging {
+				f = fmt.Sprintf("lagging %d blocks", st.LagBlocks)
+			}
+			state += ", " + f
+		}
+		if n, err := evm.ParseQuantity(st.ChainID); err == nil && st.ChainID != "" {
+			chain = n.String()
+		}
+		if n, err := evm.ParseQuantity(st.BlockNumber); err == nil && st.BlockNumber != "" {
+			block = n.String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%dms\t%s\n", st.ID, st.Name, state, chain, block, st.Latency, features(st.Capabilities))
+	}
+	return w.Flush()
+}
+
+// features lists what an endpoint was found to serve beyond the basics, and
+// whether it is an archive or a full node, with how many blocks of state a
+// full node keeps.
+func features(caps *endpoint.Capabilities) string {
+	if caps == nil {
+		return "-"
+	}
+	var out []string
+	for _, f := range []struct {
+		on   bool
+		name string
+	}{
+		{caps.Debug, "debug"},
+		{caps.Trace, "trace"},
+		{caps.TxPool, "txpool"},
+		{caps.FeeHistory, "feehistory"},
+		{caps.WebSocket, "ws"},
+	} {
+		if f.on {
+			out = append(out, f.name)
+		}
+	}
+	switch {
+	case caps.Archive:
+		out = append(out, "archive")
+	case caps.StateDepth > 0:
+		out = append(out, fmt.Sprintf("full:%d", caps.StateDepth))
+	default:
+		out = append(out, "full")
+	}
+	return strings.Join(out, ",")
+}
+
+func cmdEndpoints(c *cli, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch args[0] {
+	case "list":
+		return endpointsList(c)
+	case "add":
+		return endpointsAdd(c, args[1:])
+	}
+	return errUsage
+}
+
+func endpointsList(c *cli) error {
+	var eps []endpoint.Endpoint
+	if c.api != nil {
+		statuses, err := c.statuses()
+		if err != nil {
+			return err
+		}
+		for _, st := range statuses {
+			eps = append(eps, endpoint.Endpoint{ID: st.ID, Name: st.Name, URL: st.URL, Asset: st.Asset, Native: asset.Asset{Symbol: st.Symbol}})
+		}
+	} else {
+		store, err := c.store()
+		if err != nil {
+			return err
+		}
+		eps = store.List()
+	}
+	w := c.table()
+	fmt.Fprintln(w, "ID\tNAME\tSYMBOL\tURL")
+	for _, ep := range eps {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", ep.ID, ep.Name, ep.Native.Symbol, ep.URL)
+	}
+	return w.Flush()
+}
+
+func endpointsAdd(c *cli, args []string) error {
+	fs := flag.NewFlagSet("endpoints add", flag.ContinueOnError)
+	force := fs.Bool("force", false, "add even if it duplicates an existing endpoint")
+	jwtSecret := fs.String("jwt-secret", "", "hex `secret` for nodes that require HS256 JWT auth")
+	timeout := fs.String("timeout", "", "request `timeout` such as 30s, instead of RPC_TIMEOUT")
+	proxy := fs.String("proxy", "", "http(s):// or socks5(h):// `proxy` URL, tor, or direct, instead of RPC_PROXY")
+	pollInterval := fs.String("poll-interval", "", "how often to check the endpoint, such as 1m, instead of POLL_INTERVAL")
+	consensus := fs.String("consensus", "", "beacon API `url` of a light client to verify the endpoint's reads")
+	checkpoint := fs.String("checkpoint", "", "block `root` the light client starts from, instead of the beacon node's finalized block")
+	private := fs.Bool("private", false, "a private submission endpoint, such as Flashbots Protect, for sends kept out of the public mempool")
+	statusURL := fs.String("status-url", "", "the relay's transaction status API `url`, the hash appended; Flashbots Protect's for its RPC when empty")
+	confirmations := fs.Int("confirmations", 0, "blocks deep, its own included, a sent transaction must be to count as `confirmed`; once mined when 0")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() != 3 {
+		return errUsage
+	}
+	req := endpoint.Endpoint{Name: fs.Arg(0), URL: fs.Arg(1), Asset: fs.Arg(2), JWTSecret: *jwtSecret, Timeout: *timeout, Proxy: *proxy, PollInterval: *pollInterval,
+		Consensus: *consensus, Checkpoint: *checkpoint, Private: *private, StatusURL: *statusURL, Confirmations: *confirmations}
+
+	var ep endpoint.Endpoint
+	if c.api != nil {
+		added, err := c.api.AddEndpoint(context.Background(), client.Endpoint{Name: req.Name, URL: req.URL, Asset: req.Asset, JWTSecret: req.JWTSecret, Timeout: req.Timeout, Proxy: req.Proxy, PollInterval: req.PollInterval,
+			Consensus: req.Consensus, Checkpoint: req.Checkpoint, Private: req.Private, StatusURL: req.StatusURL, Confirmations: req.Confirmations}, *force)
+		if err != nil {
+			return err
+		}
+		ep.ID = added.ID
+	} else {
+		store, err := c.store()
+		if err != nil {
+			return err
+		}
+		if !*force {
+			if dup := store.FindDuplicate(context.Background(), req, ""); dup != nil {
+				return fmt.Errorf("duplicates %q (%s); use -force to add anyway", dup.Existing.Name, dup.Reason)
+			}
+		}
+		if ep, err = store.Add(req); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(c.out, "added", ep.ID)
+	return nil
+}
+
+func cmdAssets(c *cli, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	var assets []asset.Asset
+	if c.api != nil {
+		list, err := c.api.Assets(context.Background())
+		if err != nil {
+			return err
+		}
+		for _, a := range list {
+			assets = append(assets, asset.Asset(a))
+		}
+	} else {
+		r, err := asset.NewRegistry(c.cfg.AssetsFile)
+		if err != nil {
+			return err
+		}
+		assets = r.List()
+	}
+	w := c.table()
+	fmt.Fprintln(w, "ID\tSYMBOL\tDECIMALS\tCOINGECKO")
+	for _, a := range assets {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", a.ID, a.Symbol, a.Decimals, a.CoingeckoID)
+	}
+	return w.Flush()
+}
+
+func cmdBalance(c *cli, args []string) error {
+	fs := flag.NewFlagSet("balance", flag.ContinueOnError)
+	only := fs.String("endpoint", "", "query a single endpoint by ID")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+	addr, err := evm.ParseAddress(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	statuses, err := c.statuses()
+	if err != nil {
+		return err
+	}
+	w := c.table()
+	fmt.Fprintln(w, "ENDPOINT\tBALANCE")
+	for _, st := range statuses {
+		if *only != "" && st.ID != *only {
+			continue
+		}
+		if !st.Online {
+			fmt.Fprintf(w, "%s\toffline\n", st.Name)
+			continue
+		}
+		bal, err := c.balance(st, addr)
+		if err != nil {
+			fmt.Fprintf(w, "%s\terror: %v\n", st.Name, err)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s %s\n", st.Name, evm.FormatUnits(bal, st.Decimals), st.Symbol)
+	}
+	return w.Flush()
+}
+
+func (c *cli) balance(st endpoint.Status, addr evm.Address) (*big.Int, error) {
+	params := []any{addr.Hex(), "latest"}
+	var (
+		result json.RawMessage
+		err    error
+	)
+	if c.api != nil {
+		result, err = c.api.RPC(context.Background(), st.ID, "eth_getBalance", params...)
+	} else {
+		store, err := c.store()
+		if err != nil {
+			return nil, err
+		}
+		ep, ok := store.Get(st.ID)
+		if !ok {
+			return nil, fmt.Errorf("endpoint %q not found", st.ID)
+		}
+		result, err = endpoint.RPCCall(context.Background(), ep, "eth_getBalance", params)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var hex string
+	if err := json.Unmarshal(result, &hex); err != nil {
+		return nil, fmt.Errorf("unexpected result %s", result)
+	}
+	return evm.ParseQuantity(hex)
+}
+
+func cmdBroadcast(c *cli, args []string) error {
+	fs := flag.NewFlagSet("broadcast", flag.ContinueOnError)
+	idemKey := fs.String("idempotency-key", "", "send at most once per key; reuse it when retrying (server only)")
+	private := fs.Bool("private", false, "send to a private endpoint of the chain, keeping it out of the public mempool")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 2 {
+		return errUsage
+	}
+	args = fs.Args()
+	var hash string
+	if c.api != nil {
+		ctx := c.sendContext(*idemKey)
+		if *private {
+			ctx = client.WithPrivate(ctx)
+		}
+		var err error
+		if hash, err = c.api.Broadcast(ctx, args[0], args[1]); err != nil {
+			return err
+		}
+	} else {
+		store, err := c.store()
+		if err != nil {
+			return err
+		}
+		ep, ok := store.Get(args[0])
+		if !ok {
+			return fmt.Errorf("endpoint %q not found", args[0])
+		}
+		if *private {
+			if ep, err = privateEndpoint(store, ep); err != nil {
+				return err
+			}
+		}
+		if hash, err = txbuild.Broadcast(context.Background(), ep, args[1]); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(c.out, hash)
+	return nil
+}
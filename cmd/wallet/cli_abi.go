@@ -0,0 +1,219 @@
+//go:build !broadcastonly
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/primal-host/wallet/client"
+	"github.com/primal-host/wallet/internal/abi"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+func init() {
+	commands["abi"] = command{"abi list | abi add <name> <file> | abi remove <name> | abi encode <abi> <function> [args...] | abi decode [-abi name] <data>", cmdABI}
+}
+
+// cmdABI manages registered ABIs and builds calldata from them. Arguments
+// starting with [ or { are JSON arrays or tuples; the rest are strings.
+func cmdABI(c *cli, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	ctx := context.Background()
+	var registry *abi.Registry
+	if c.api == nil {
+		var err error
+		if registry, err = abi.NewRegistry(c.cfg.ABIsFile); err != nil {
+			return err
+		}
+	}
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		var list []client.ABI
+		if c.api != nil {
+			var err error
+			if list, err = c.api.ABIs(ctx); err != nil {
+				return err
+			}
+		} else {
+			for _, contract := range registry.List() {
+				list = append(list, toClientABI(contract.Summary()))
+			}
+		}
+		w := c.table()
+		fmt.Fprintln(w, "ABI\tSELECTOR\tFUNCTION")
+		for _, a := range list {
+			for _, f := range a.Functions {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", a.Name, f.Selector, f.Signature)
+			}
+		}
+		return w.Flush()
+	case args[0] == "add" && len(args) == 3:
+		data, err := os.ReadFile(args[2])
+		if err != nil {
+			return err
+		}
+		var a client.ABI
+		if c.api != nil {
+			out, err := c.api.AddABI(ctx, args[1], data)
+			if err != nil {
+				return err
+			}
+			a = *out
+		} else {
+			contract, err := registry.Add(args[1], data)
+			if err != nil {
+				return err
+			}
+			a = toClientABI(contract.Summary())
+		}
+		fmt.Fprintf(c.out, "added %s with %d functions\n", a.Name, len(a.Functions))
+		return nil
+	case args[0] == "remove" && len(args) == 2:
+		id := strings.ToLower(args[1])
+		if c.api != nil {
+			if err := c.api.DeleteABI(ctx, id); err != nil {
+				return err
+			}
+		} else if err := registry.Delete(id); err != nil {
+			return err
+		}
+		fmt.Fprintln(c.out, "removed", args[1])
+		return nil
+	case args[0] == "encode" && len(args) >= 3:
+		values := make([]any, len(args)-3)
+		for i, arg := range args[3:] {
+			values[i] = arg
+			if strings.HasPrefix(arg, "[") || strings.HasPrefix(arg, "{") {
+				if err := json.Unmarshal([]byte(arg), &values[i]); err != nil {
+					return fmt.Errorf("argument %d: %w", i+1, err)
+				}
+			}
+		}
+		var call *client.Calldata
+		if c.api != nil {
+			var err error
+			if call, err = c.api.EncodeCalldata(ctx, args[1], args[2], values); err != nil {
+				return err
+			}
+		} else {
+			contract, ok := registry.Get(args[1])
+			if !ok {
+				return fmt.Errorf("ABI %s not found", args[1])
+			}
+			f, err := abi.Lookup(contract.Functions(), args[2])
+			if err != nil {
+				return err
+			}
+			data, err := abi.Encode(f, values)
+			if err != nil {
+				return err
+			}
+			if call, err = offlineCall(contract, f, data); err != nil {
+				return err
+			}
+		}
+		return c.printCall(call)
+	case args[0] == "decode":
+		fs := flag.NewFlagSet("abi decode", flag.ContinueOnError)
+		name := fs.String("abi", "", "decode with this ABI instead of searching by selector")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 1 {
+			return errUsage
+		}
+		var call *client.Calldata
+		if c.api != nil {
+			var err error
+			if call, err = c.api.DecodeCalldata(ctx, *name, fs.Arg(0)); err != nil {
+				return err
+			}
+		} else {
+			data, err := evm.DecodeHex(fs.Arg(0))
+			if err != nil || len(data) < 4 {
+				return errors.New("data must be 0x hex calldata with a 4-byte selector")
+			}
+			var (
+				contract abi.Contract
+				f        abi.Function
+				ok       bool
+			)
+			if *name != "" {
+				if contract, ok = registry.Get(*name); !ok {
+					return fmt.Errorf("ABI %s not found", *name)
+				}
+				if f, err = abi.Lookup(contract.Functions(), evm.EncodeHex(data[:4])); err != nil {
+					return fmt.Errorf("no function in %s has selector %s", contract.Name, evm.EncodeHex(data[:4]))
+				}
+			} else if contract, f, ok = registry.FindSelector(data[:4]); !ok {
+				return fmt.Errorf("no registered function has selector %s", evm.EncodeHex(data[:4]))
+			}
+			if call, err = offlineCall(contract, f, data); err != nil {
+				return err
+			}
+		}
+		return c.printCall(call)
+	}
+	return errUsage
+}
+
+// printCall prints the calldata, then each argument as decoded from it.
+func (c *cli) printCall(call *client.Calldata) error {
+	fmt.Fprintln(c.out, call.Data)
+	w := c.table()
+	fmt.Fprintf(w, "%s\t%s (%s)\n", call.Selector, call.Function, call.ABI)
+	for i, in := range call.Inputs {
+		arg, _ := json.Marshal(call.Args[i])
+		fmt.Fprintf(w, "  %s %s\t%s\n", in.Type, in.Name, strings.Trim(string(arg), `"`))
+	}
+	if !call.Verified {
+		fmt.Fprintln(w, "warning\tthe calldata doesn't re-encode to the same bytes")
+	}
+	return w.Flush()
+}
+
+// offlineCall decodes data locally and converts the result to the client's
+// type, so both paths print the same way.
+func offlineCall(contract abi.Contract, f abi.Function, data []byte) (*client.Calldata, error) {
+	call, err := contract.DecodeCall(f, data)
+	if err != nil {
+		return nil, err
+	}
+	return &client.Calldata{
+		ABI:      call.ABI,
+		Function: call.Function,
+		Selector: call.Selector,
+		Data:     call.Data,
+		Args:     call.Args,
+		Verified: call.Verified,
+		Inputs:   toClientParams(call.Inputs),
+	}, nil
+}
+
+func toClientABI(sum abi.Summary) client.ABI {
+	out := client.ABI{ID: sum.ID, Name: sum.Name}
+	for _, m := range sum.Functions {
+		out.Functions = append(out.Functions, client.ABIFunction{
+			Name:            m.Name,
+			Signature:       m.Signature,
+			Selector:        m.Selector,
+			Inputs:          toClientParams(m.Inputs),
+			Outputs:         toClientParams(m.Outputs),
+			StateMutability: m.StateMutability,
+		})
+	}
+	return out
+}
+
+func toClientParams(params []abi.Param) []client.ABIParam {
+	var out []client.ABIParam
+	for _, p := range params {
+		out = append(out, client.ABIParam{Name: p.Name, Type: p.Type, Components: toClientParams(p.Components)})
+	}
+	return out
+}
@@ -0,0 +1,246 @@
+//go:build !broadcastonly
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/primal-host/wallet/client"
+	"github.com/primal-host/wallet/internal/alert"
+)
+
+func init() {
+	commands["alerts"] = command{"alerts list | alerts add gas [-name n] [-metric base_fee|gas_price|priority_fee] [-below gwei] [-above gwei] <endpoint> | alerts add balance [-name n] [-direction any|in|out] [-min amount] <endpoint> <address> | alerts add offline [-name n] [-after duration] <endpoint> | alerts mute <id> | alerts unmute <id> | alerts remove <id>", cmdAlerts}
+}
+
+// cmdAlerts manages the alerts the server checks as it polls, on the server
+// or, offline, in the alerts file; a server started later picks them up.
+func cmdAlerts(c *cli, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			return errUsage
+		}
+		alerts, err := c.alerts()
+		if err != nil {
+			return err
+		}
+		w := c.table()
+		fmt.Fprintln(w, "ID\tKIND\tENDPOINT\tCONDITION\tVALUE\tSTATE\tNAME")
+		for _, a := range alerts {
+			state := "ok"
+			switch {
+			case a.Error != "":
+				state = "error: " + a.Error
+			case a.CheckedAt == nil:
+				state = "unchecked"
+			case a.Firing:
+				state = "firing"
+			}
+			if a.Muted {
+				state += " (muted)"
+			}
+			value := "-"
+			switch {
+			case a.Value == "":
+			case a.Kind == alert.KindGas:
+				value = a.Value + " gwei"
+			case a.Change != "":
+				value = a.Value + " (" + a.Change + ")"
+			case a.Kind == alert.KindOffline && a.Value == alert.ValueOffline && a.Since != nil:
+				value = "offline since " + a.Since.Local().Format("2006-01-02 15:04:05")
+			default:
+				value = a.Value
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", a.ID, a.Kind, a.Endpoint, condition(a), value, state, a.Name)
+		}
+		return w.Flush()
+	case "add":
+		if len(args) < 2 {
+			return errUsage
+		}
+		var a client.Alert
+		switch args[1] {
+		case alert.KindGas:
+			fs := flag.NewFlagSet("alerts add gas", flag.ContinueOnError)
+			name := fs.String("name", "", "alert `name`")
+			metric := fs.String("metric", alert.MetricBaseFee, "fee to watch: base_fee, gas_price, or priority_fee")
+			below := fs.String("below", "", "fire when the fee drops below this many `gwei`")
+			above := fs.String("above", "", "fire when the fee rises above this many `gwei`")
+			if err := fs.Parse(args[2:]); err != nil || fs.NArg() != 1 {
+				return errUsage
+			}
+			a = client.Alert{Name: *name, Kind: alert.KindGas, Endpoint: fs.Arg(0), Metric: *metric, Below: *below, Above: *above}
+		case alert.KindBalance:
+			fs := flag.NewFlagSet("alerts add balance", flag.ContinueOnError)
+			name := fs.String("name", "", "alert `name`")
+			direction := fs.String("direction", alert.DirectionAny, "changes to fire for: any, in (incoming), or out")
+			minChange := fs.String("min", "", "ignore changes smaller than this `amount`, in whole native units")
+			if err := fs.Parse(args[2:]); err != nil || fs.NArg() != 2 {
+				return errUsage
+			}
+			a = client.Alert{Name: *name, Kind: alert.KindBalance, Endpoint: fs.Arg(0), Address: fs.Arg(1), Direction: *direction, Min: *minChange}
+		case alert.KindOffline:
+			fs := flag.NewFlagSet("alerts add offline", flag.ContinueOnError)
+			name := fs.String("name", "", "alert `name`")
+			after := fs.String("after", "", "fire once the endpoint has been offline this long, e.g. 5m; at once when empty")
+			if err := fs.Parse(args[2:]); err != nil || fs.NArg() != 1 {
+				return errUsage
+			}
+			a = client.Alert{Name: *name, Kind: alert.KindOffline, Endpoint: fs.Arg(0), After: *after}
+		default:
+			return errUsage
+		}
+		a, err := c.addAlert(a)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "added alert %s: %s on %s\n", a.ID, condition(a), a.Endpoint)
+		return nil
+	case "mute", "unmute":
+		if len(args) != 2 {
+			return errUsage
+		}
+		if err := c.muteAlert(args[1], args[0] == "mute"); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "%sd alert %s\n", args[0], args[1])
+		return nil
+	case "remove":
+		if len(args) != 2 {
+			return errUsage
+		}
+		var err error
+		if c.api != nil {
+			err = c.api.DeleteAlert(context.Background(), args[1])
+		} else {
+			var alerts *alert.Store
+			if alerts, err = alert.NewStore(c.cfg.AlertsFile); err == nil {
+				err = alerts.Delete(args[1])
+			}
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "removed alert %s\n", args[1])
+		return nil
+	}
+	return errUsage
+}
+
+// condition describes what an alert watches, e.g. "base_fee < 10 gwei",
+// "0xAbC... in >= 0.5", or "offline for 5m".
+func condition(a client.Alert) string {
+	switch a.Kind {
+	case alert.KindBalance:
+		cond := a.Address + " " + a.Direction
+		if a.Min != "" {
+			cond += " >= " + a.Min
+		}
+		return cond
+	case alert.KindOffline:
+		if a.After == "" {
+			return "offline"
+		}
+		return "offline for " + a.After
+	}
+	metric := a.Metric
+	if metric == "" {
+		metric = alert.MetricBaseFee
+	}
+	cond := metric
+	if a.Below != "" {
+		cond += " < " + a.Below + " gwei"
+	}
+	if a.Above != "" {
+		if a.Below != "" {
+			cond += " or"
+		}
+		cond += " > " + a.Above + " gwei"
+	}
+	return cond
+}
+
+// alerts lists the alerts on the server or, offline, in the alerts file.
+func (c *cli) alerts() ([]client.Alert, error) {
+	if c.api != nil {
+		return c.api.Alerts(context.Background(), "")
+	}
+	alerts, err := alert.NewStore(c.cfg.AlertsFile)
+	if err != nil {
+		return nil, err
+	}
+	var out []client.Alert
+	for _, a := range alerts.List("") {
+		out = append(out, clientAlert(a))
+	}
+	return out, nil
+}
+
+// addAlert creates an alert on the server or, offline, in the alerts file.
+func (c *cli) addAlert(a client.Alert) (client.Alert, error) {
+	if c.api != nil {
+		added, err := c.api.AddAlert(context.Background(), a)
+		if err != nil {
+			return client.Alert{}, err
+		}
+		return *added, nil
+	}
+	store, err := c.store()
+	if err != nil {
+		return client.Alert{}, err
+	}
+	if _, ok := store.Get(a.Endpoint); !ok {
+		return client.Alert{}, fmt.Errorf("endpoint %q not found", a.Endpoint)
+	}
+	alerts, err := alert.NewStore(c.cfg.AlertsFile)
+	if err != nil {
+		return client.Alert{}, err
+	}
+	added, err := alerts.Add(alert.Alert{
+		Name: a.Name, Kind: a.Kind, Endpoint: a.Endpoint, Metric: a.Metric, Below: a.Below, Above: a.Above,
+		Address: a.Address, Direction: a.Direction, Min: a.Min, After: a.After,
+	})
+	if err != nil {
+		return client.Alert{}, err
+	}
+	return clientAlert(added), nil
+}
+
+// muteAlert mutes or unmutes an alert on the server or, offline, in the
+// alerts file.
+func (c *cli) muteAlert(id string, muted bool) error {
+	if c.api != nil {
+		a, err := c.api.Alert(context.Background(), id)
+		if err != nil {
+			return err
+		}
+		a.Muted = muted
+		_, err = c.api.UpdateAlert(context.Background(), id, *a)
+		return err
+	}
+	alerts, err := alert.NewStore(c.cfg.AlertsFile)
+	if err != nil {
+		return err
+	}
+	a, ok := alerts.Get(id)
+	if !ok {
+		return fmt.Errorf("alert %q not found", id)
+	}
+	a.Muted = muted
+	_, err = alerts.Update(id, a)
+	return err
+}
+
+func clientAlert(a alert.Alert) client.Alert {
+	return client.Alert{
+		ID: a.ID, Name: a.Name, Kind: a.Kind, Endpoint: a.Endpoint, Muted: a.Muted,
+		Metric: a.Metric, Below: a.Below, Above: a.Above, Address: a.Address, Direction: a.Direction, Min: a.Min,
+		After: a.After, Firing: a.Firing, Value: a.Value, Change: a.Change, Since: a.Since, Error: a.Error, CheckedAt: a.CheckedAt, FiredAt: a.FiredAt, CreatedAt: a.CreatedAt,
+	}
+}
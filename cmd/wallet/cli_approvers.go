@@ -0,0 +1,50 @@
+//go:build !broadcastonly
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/primal-host/wallet/internal/approval"
+)
+
+func init() {
+	commands["approvers"] = command{"approvers list | approvers add <name> | approvers remove <name>", cmdApprovers}
+}
+
+// cmdApprovers manages who can sign off on dual-control requests. It always
+// works on APPROVERS_FILE, even while the server runs, since approvers can't
+// be enrolled through the API.
+func cmdApprovers(c *cli, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		list, err := approval.LoadApprovers(c.cfg.ApproversFile)
+		if err != nil {
+			return err
+		}
+		w := c.table()
+		fmt.Fprintln(w, "NAME\tADDED")
+		for _, a := range list {
+			fmt.Fprintf(w, "%s\t%s\n", a.Name, a.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+		}
+		return w.Flush()
+	case args[0] == "add" && len(args) == 2:
+		token, err := approval.AddApprover(c.cfg.ApproversFile, args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(c.out, "approver token for", args[1]+":", token)
+		fmt.Fprintln(c.out, "it is not shown again; send it as Authorization: Bearer <token> when approving")
+		return nil
+	case args[0] == "remove" && len(args) == 2:
+		if err := approval.RemoveApprover(c.cfg.ApproversFile, args[1]); err != nil {
+			return err
+		}
+		fmt.Fprintln(c.out, "removed", args[1])
+		return nil
+	}
+	return errUsage
+}
@@ -0,0 +1,131 @@
+//go:build !broadcastonly
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/primal-host/wallet/client"
+	"github.com/primal-host/wallet/internal/backup"
+)
+
+func init() {
+	commands["backup"] = command{"backup [-o file]", cmdBackup}
+	commands["restore"] = command{"restore [-replace] <file>", cmdRestore}
+}
+
+// cmdBackup writes the server's endpoints, accounts, bookmarks, and
+// preferences to a passphrase-encrypted file. Browser keys are only in the
+// dashboard's backups.
+func cmdBackup(c *cli, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	out := fs.String("o", "wallet-backup-"+time.Now().Format("2006-01-02")+".json", "file to write")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+	if c.api == nil {
+		return errors.New("the server isn't running")
+	}
+	if _, err := os.Stat(*out); err == nil {
+		return fmt.Errorf("%s already exists", *out)
+	}
+	b, err := c.api.Backup(context.Background())
+	if err != nil {
+		return err
+	}
+	plaintext, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	passphrase, err := readPassword("Backup passphrase")
+	if err != nil {
+		return err
+	}
+	sealed, err := backup.Seal(passphrase, plaintext)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(sealed); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "wrote %s: %d endpoints, %d accounts, %d bookmarks, %d preferences\n",
+		*out, len(b.Endpoints), len(b.Accounts), len(b.Bookmarks), len(b.Preferences))
+	return nil
+}
+
+// cmdRestore restores a backup file into the server. Existing records are
+// kept unless -replace is given.
+func cmdRestore(c *cli, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	replace := fs.Bool("replace", false, "overwrite records that already exist")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+	if c.api == nil {
+		return errors.New("the server isn't running")
+	}
+	contents, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	passphrase, err := readPassword("Backup passphrase")
+	if err != nil {
+		return err
+	}
+	plaintext, err := backup.Open(passphrase, contents)
+	if err != nil {
+		return err
+	}
+	var b client.Backup
+	if err := json.Unmarshal(plaintext, &b); err != nil {
+		return fmt.Errorf("parse backup: %w", err)
+	}
+	keys := len(b.Keys)
+	b.Keys = nil
+	r, err := c.api.Restore(context.Background(), &b, *replace)
+	if err != nil {
+		return err
+	}
+
+	w := c.table()
+	fmt.Fprintln(w, "\tADDED\tREPLACED\tKEPT\tFAILED")
+	var failed []string
+	for _, row := range []struct {
+		name string
+		r    client.RestoreReport
+	}{
+		{"assets", r.Assets},
+		{"endpoints", r.Endpoints},
+		{"accounts", r.Accounts},
+		{"bookmarks", r.Bookmarks},
+		{"preferences", r.Preferences},
+	} {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", row.name, row.r.Added, row.r.Replaced, row.r.Skipped, len(row.r.Failed))
+		failed = append(failed, row.r.Failed...)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if keys > 0 {
+		fmt.Fprintf(c.out, "%d browser keys not restored: restore the file from the dashboard to add them\n", keys)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d records failed:\n  %s", len(failed), strings.Join(failed, "\n  "))
+	}
+	return nil
+}
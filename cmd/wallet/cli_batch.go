@@ -0,0 +1,210 @@
+//go:build !broadcastonly
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/primal-host/wallet/client"
+)
+
+func init() {
+	commands["batch"] = command{"batch list | batch show <id> | batch create -endpoint id -from addr [-token addr] [-mode transfers|disperse] [-name n] [-preview] <file|-> | batch send [-idempotency-key key] [-confirm-to suffix -confirm-value amount] <id> | batch remove <id>", cmdBatch}
+}
+
+// cmdBatch builds and sends batch sends on the server: a list of addresses
+// and amounts, paid by one account.
+func cmdBatch(c *cli, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	if c.api == nil {
+		return errors.New("the server isn't running")
+	}
+	ctx := context.Background()
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			return errUsage
+		}
+		batches, err := c.api.Batches(ctx)
+		if err != nil {
+			return err
+		}
+		w := c.table()
+		fmt.Fprintln(w, "ID\tENDPOINT\tFROM\tMODE\tRECIPIENTS\tTOTAL\tPROGRESS\tNAME")
+		for _, b := range batches {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s %s\t%s\t%s\n", b.ID, b.Endpoint, b.From, b.Mode, len(b.Recipients), b.Cost.Total, b.Cost.Symbol, progress(b.Progress), b.Name)
+		}
+		return w.Flush()
+	case "show":
+		if len(args) != 2 {
+			return errUsage
+		}
+		b, err := c.api.Batch(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		return printBatch(c, b)
+	case "create":
+		fs := flag.NewFlagSet("batch create", flag.ContinueOnError)
+		epID := fs.String("endpoint", "", "endpoint `id` to send through")
+		from := fs.String("from", "", "paying `address`, a server vault key or remote signer, or any account to sign in the dashboard")
+		token := fs.String("token", "", "ERC-20 `address` to pay in; the native currency when empty")
+		mode := fs.String("mode", "transfers", "transfers (one transaction per recipient) or disperse (one Disperse contract call)")
+		name := fs.String("name", "", "batch `name`")
+		preview := fs.Bool("preview", false, "check and price the batch without keeping it")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 1 || *epID == "" || *from == "" {
+			return errUsage
+		}
+		var list []byte
+		var err error
+		if fs.Arg(0) == "-" {
+			list, err = io.ReadAll(os.Stdin)
+		} else {
+			list, err = os.ReadFile(fs.Arg(0))
+		}
+		if err != nil {
+			return err
+		}
+		req := client.BatchRequest{Name: *name, Endpoint: *epID, From: *from, Token: *token, Mode: *mode, List: string(list)}
+		// A preview first shows every invalid recipient, where create
+		// only says how many there are.
+		b, err := c.api.PreviewBatch(ctx, req)
+		if err != nil {
+			return err
+		}
+		invalid := 0
+		for _, r := range b.Recipients {
+			if r.Error != "" {
+				invalid++
+			}
+		}
+		if *preview || invalid > 0 {
+			if err := printBatch(c, b); err != nil {
+				return err
+			}
+			if invalid > 0 {
+				return fmt.Errorf("%d of %d recipients are invalid", invalid, len(b.Recipients))
+			}
+			return nil
+		}
+		if b, err = c.api.AddBatch(ctx, req); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "created batch %s: %s, %s, %s %s plus up to %s in fees\n", b.ID, plural(len(b.Recipients), "recipient"), plural(len(b.Txs), "transaction"), b.Cost.Total, b.Cost.Symbol, b.Cost.MaxFee)
+		if b.Cost.Short {
+			fmt.Fprintln(c.out, "warning: the sender's balance doesn't cover it")
+		}
+		return nil
+	case "send":
+		fs := flag.NewFlagSet("batch send", flag.ContinueOnError)
+		idemKey := fs.String("idempotency-key", "", "send at most once for this `key`")
+		confirmTo := fs.String("confirm-to", "", "last 6 characters of the target, re-typed, for transactions at the server's CONFIRM_THRESHOLD")
+		confirmValue := fs.String("confirm-value", "", "the value re-typed, for transactions at the server's CONFIRM_THRESHOLD")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 1 {
+			return errUsage
+		}
+		ctx := c.sendContext(*idemKey)
+		if *confirmTo != "" || *confirmValue != "" {
+			ctx = client.WithConfirmation(ctx, client.Confirmation{ToSuffix: *confirmTo, Value: *confirmValue})
+		}
+		b, err := c.api.SendBatch(ctx, fs.Arg(0))
+		var apiErr *client.APIError
+		if errors.As(err, &apiErr) && apiErr.ConfirmRequired {
+			return fmt.Errorf("%w (pass -confirm-to and -confirm-value)", err)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "sent batch %s: %s\n", b.ID, progress(b.Progress))
+		return nil
+	case "remove":
+		if len(args) != 2 {
+			return errUsage
+		}
+		if err := c.api.DeleteBatch(ctx, args[1]); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "removed batch %s\n", args[1])
+		return nil
+	}
+	return errUsage
+}
+
+// printBatch shows a batch's cost, recipients, and transactions.
+func printBatch(c *cli, b *client.Batch) error {
+	if len(b.Txs) == 0 {
+		fmt.Fprintf(c.out, "%s from %s on %s (%s), not built\n", plural(len(b.Recipients), "recipient"), b.From, b.Endpoint, b.Mode)
+	} else {
+		fmt.Fprintf(c.out, "%s %s from %s on %s (%s)\n", b.Cost.Total, b.Cost.Symbol, b.From, b.Endpoint, b.Mode)
+		fmt.Fprintf(c.out, "max fees %s; needs %s, has %s", b.Cost.MaxFee, b.Cost.Needed, b.Cost.Balance)
+		if b.Cost.TokenBalance != "" {
+			fmt.Fprintf(c.out, " and %s %s", b.Cost.TokenBalance, b.Cost.Symbol)
+		}
+		if b.Cost.Short {
+			fmt.Fprint(c.out, " (short)")
+		}
+		fmt.Fprintln(c.out)
+	}
+	w := c.table()
+	fmt.Fprintln(w, "#\tADDRESS\tAMOUNT\tSTATUS")
+	for i, r := range b.Recipients {
+		status := "ok"
+		switch {
+		case r.Error != "":
+			status = "error: " + r.Error
+		case r.Warning != "":
+			status = "warning: " + r.Warning
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", i+1, r.Address, r.Amount, status)
+	}
+	if len(b.Txs) > 0 {
+		fmt.Fprintln(w, "\nTX\tKIND\tNONCE\tSTAGE\tHASH")
+		for i, tx := range b.Txs {
+			stage := tx.Stage
+			if stage == "" {
+				stage = "unsent"
+			}
+			if tx.Error != "" {
+				stage += ": " + tx.Error
+			}
+			kind := tx.Kind
+			if tx.Kind != "approve" {
+				kind += " to " + plural(len(tx.Recipients), "recipient")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", i+1, kind, tx.Envelope.Tx.Nonce, stage, tx.Hash)
+		}
+	}
+	return w.Flush()
+}
+
+// progress sums up how far a batch has got, e.g. "3/10 confirmed, 2 pending".
+func progress(p *client.BatchProgress) string {
+	if p == nil {
+		return "-"
+	}
+	parts := []string{fmt.Sprintf("%d/%d confirmed", p.Confirmed, p.Total)}
+	for _, n := range []struct {
+		count int
+		what  string
+	}{{p.Pending, "pending"}, {p.Reverted, "reverted"}, {p.Failed, "failed"}, {p.Unsent, "unsent"}} {
+		if n.count > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n.count, n.what))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func plural(n int, one string) string {
+	if n == 1 {
+		return "1 " + one
+	}
+	return fmt.Sprintf("%d %ss", n, one)
+}
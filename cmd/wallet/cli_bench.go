@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/primal-host/wallet/internal/bench"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+func init() {
+	commands["bench"] = command{"bench [-last] <endpoint>...", cmdBench}
+}
+
+// cmdBench benchmarks endpoints one after another, so they don't slow each
+// other down, and ranks them by score when there are several.
+func cmdBench(c *cli, args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	last := fs.Bool("last", false, "show the last benchmark instead of running one")
+	if err := fs.Parse(args); err != nil || fs.NArg() == 0 {
+		return errUsage
+	}
+	var results []bench.Result
+	for _, id := range fs.Args() {
+		r, err := c.bench(id, *last)
+		if err != nil {
+			return fmt.Errorf("%s: %w", id, err)
+		}
+		if err := c.printBench(r); err != nil {
+			return err
+		}
+		results = append(results, r)
+	}
+	if len(results) < 2 {
+		return nil
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	w := c.table()
+	fmt.Fprintln(w, "RANK\tENDPOINT\tCHAIN\tSCORE")
+	for i, r := range results {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\n", i+1, r.Endpoint, chainName(r.ChainID), r.Score)
+	}
+	return w.Flush()
+}
+
+// bench runs or looks up the benchmark of the endpoint with the given ID,
+// on the server or, offline, directly.
+func (c *cli) bench(id string, last bool) (bench.Result, error) {
+	if c.api != nil {
+		get := c.api.Bench
+		if last {
+			get = c.api.LastBench
+		}
+		b, err := get(context.Background(), id)
+		if err != nil {
+			return bench.Result{}, err
+		}
+		r := bench.Result{
+			Endpoint: b.Endpoint, Name: b.Name, ChainID: b.ChainID, RanAt: b.RanAt,
+			Batch: b.Batch, BatchMS: b.BatchMS, MaxLogsRange: b.MaxLogsRange, WebSocket: b.WebSocket, Score: b.Score,
+		}
+		for _, m := range b.Methods {
+			r.Methods = append(r.Methods, bench.MethodStats(m))
+		}
+		return r, nil
+	}
+	benches, err := bench.NewStore(c.cfg.BenchFile)
+	if err != nil {
+		return bench.Result{}, err
+	}
+	if last {
+		r, ok := benches.Get(id)
+		if !ok {
+			return bench.Result{}, fmt.Errorf("not benchmarked yet")
+		}
+		return r, nil
+	}
+	store, err := c.store()
+	if err != nil {
+		return bench.Result{}, err
+	}
+	ep, ok := store.Get(id)
+	if !ok {
+		return bench.Result{}, fmt.Errorf("endpoint not found")
+	}
+	r, err := bench.Run(context.Background(), ep)
+	if err != nil {
+		return bench.Result{}, err
+	}
+	return r, benches.Put(r)
+}
+
+func (c *cli) printBench(r bench.Result) error {
+	fmt.Fprintf(c.out, "%s (%s), chain %s, %s\n", r.Name, r.Endpoint, chainName(r.ChainID), r.RanAt.Local().Format("2006-01-02 15:04:05"))
+	w := c.table()
+	fmt.Fprintln(w, "METHOD\tCALLS\tERRORS\tMIN\tP50\tP90\tMAX")
+	for _, m := range r.Methods {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%dms\t%dms\t%dms\t%dms\n", m.Method, m.Calls, m.Errors, m.MinMS, m.P50MS, m.P90MS, m.MaxMS)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	batch := "no"
+	if r.Batch {
+		batch = fmt.Sprintf("yes (%dms)", r.BatchMS)
+	}
+	logs := "none"
+	if r.MaxLogsRange > 0 {
+		logs = fmt.Sprintf("%d blocks", r.MaxLogsRange)
+	}
+	ws := "no"
+	if r.WebSocket {
+		ws = "yes"
+	}
+	fmt.Fprintf(c.out, "batch: %s  logs range: %s  websocket: %s\nscore: %d/100\n\n", batch, logs, ws, r.Score)
+	return nil
+}
+
+// chainName shows a hex chain ID in decimal.
+func chainName(id string) string {
+	if n, err := evm.ParseQuantity(id); err == nil && id != "" {
+		return n.String()
+	}
+	return "-"
+}
@@ -0,0 +1,215 @@
+//go:build !broadcastonly
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/primal-host/wallet/client"
+	"github.com/primal-host/wallet/internal/notify"
+)
+
+func init() {
+	commands["channels"] = command{"channels list | channels add <webhook|telegram|email|ntfy> [-name n] [-kinds gas,balance,offline,tx] [-url u] [-bot-token t] [-chat-id id] [-smtp host:port] [-username u] [-password p] [-from addr] [-to addr,...] [-token t] | channels enable <id> | channels disable <id> | channels test <id> | channels remove <id>", cmdChannels}
+}
+
+// cmdChannels manages where the server delivers notifications, on the
+// server or, offline, in the channels file.
+func cmdChannels(c *cli, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			return errUsage
+		}
+		channels, err := c.channels()
+		if err != nil {
+			return err
+		}
+		w := c.table()
+		fmt.Fprintln(w, "ID\tNAME\tTYPE\tKINDS\tTO\tLAST SENT\tERROR")
+		for _, ch := range channels {
+			kinds := "all"
+			if len(ch.Kinds) > 0 {
+				kinds = strings.Join(ch.Kinds, ",")
+			}
+			if ch.Disabled {
+				kinds = "disabled"
+			}
+			sent := "-"
+			if ch.LastSentAt != nil {
+				sent = ch.LastSentAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", ch.ID, ch.Name, ch.Type, kinds, destination(ch), sent, ch.LastError)
+		}
+		return w.Flush()
+	case "add":
+		if len(args) < 2 {
+			return errUsage
+		}
+		fs := flag.NewFlagSet("channels add", flag.ContinueOnError)
+		name := fs.String("name", args[1], "channel `name`")
+		kinds := fs.String("kinds", "", "comma-separated notification `kinds` to deliver; all when empty")
+		target := fs.String("url", "", "webhook URL, or ntfy topic URL such as https://ntfy.sh/my-wallet")
+		botToken := fs.String("bot-token", "", "telegram bot `token`")
+		chatID := fs.String("chat-id", "", "telegram chat `id`")
+		smtpHost := fs.String("smtp", "", "email: SMTP server `host:port`")
+		username := fs.String("username", "", "email: SMTP login")
+		password := fs.String("password", "", "email: SMTP password")
+		from := fs.String("from", "", "email: sender `address`")
+		to := fs.String("to", "", "email: comma-separated recipient `addresses`")
+		token := fs.String("token", "", "ntfy access `token`")
+		if err := fs.Parse(args[2:]); err != nil || fs.NArg() != 0 {
+			return errUsage
+		}
+		ch := client.Channel{
+			Name: *name, Type: args[1], Kinds: splitList(*kinds), URL: *target,
+			BotToken: *botToken, ChatID: *chatID,
+			SMTPHost: *smtpHost, Username: *username, Password: *password, From: *from, To: splitList(*to),
+			Token: *token,
+		}
+		added, err := c.addChannel(ch)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "added channel %s: %s to %s\n", added.ID, added.Type, destination(added))
+		return nil
+	case "enable", "disable":
+		if len(args) != 2 {
+			return errUsage
+		}
+		if err := c.disableChannel(args[1], args[0] == "disable"); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "%sd channel %s\n", args[0], args[1])
+		return nil
+	case "test":
+		if len(args) != 2 {
+			return errUsage
+		}
+		var err error
+		if c.api != nil {
+			err = c.api.TestChannel(context.Background(), args[1])
+		} else {
+			var channels *notify.Store
+			if channels, err = notify.NewStore(c.cfg.ChannelsFile); err == nil {
+				err = channels.Test(args[1])
+			}
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "sent a test notification over %s\n", args[1])
+		return nil
+	case "remove":
+		if len(args) != 2 {
+			return errUsage
+		}
+		var err error
+		if c.api != nil {
+			err = c.api.DeleteChannel(context.Background(), args[1])
+		} else {
+			var channels *notify.Store
+			if channels, err = notify.NewStore(c.cfg.ChannelsFile); err == nil {
+				err = channels.Delete(args[1])
+			}
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "removed channel %s\n", args[1])
+		return nil
+	}
+	return errUsage
+}
+
+// destination describes where a channel delivers.
+func destination(ch client.Channel) string {
+	switch ch.Type {
+	case notify.TypeTelegram:
+		return "chat " + ch.ChatID
+	case notify.TypeEmail:
+		return strings.Join(ch.To, ", ")
+	}
+	return ch.URL
+}
+
+// splitList splits a comma-separated flag, dropping empty entries.
+func splitList(s string) []string {
+	var out []string
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// channels lists the channels on the server or, offline, in the channels
+// file.
+func (c *cli) channels() ([]client.Channel, error) {
+	if c.api != nil {
+		return c.api.Channels(context.Background())
+	}
+	channels, err := notify.NewStore(c.cfg.ChannelsFile)
+	if err != nil {
+		return nil, err
+	}
+	var out []client.Channel
+	for _, ch := range channels.List() {
+		out = append(out, client.Channel(ch))
+	}
+	return out, nil
+}
+
+// addChannel creates a channel on the server or, offline, in the channels
+// file.
+func (c *cli) addChannel(ch client.Channel) (client.Channel, error) {
+	if c.api != nil {
+		added, err := c.api.AddChannel(context.Background(), ch)
+		if err != nil {
+			return client.Channel{}, err
+		}
+		return *added, nil
+	}
+	channels, err := notify.NewStore(c.cfg.ChannelsFile)
+	if err != nil {
+		return client.Channel{}, err
+	}
+	added, err := channels.Add(notify.Channel(ch))
+	if err != nil {
+		return client.Channel{}, err
+	}
+	return client.Channel(added), nil
+}
+
+// disableChannel disables or enables a channel on the server or, offline,
+// in the channels file.
+func (c *cli) disableChannel(id string, disabled bool) error {
+	channels, err := c.channels()
+	if err != nil {
+		return err
+	}
+	for _, ch := range channels {
+		if ch.ID != id {
+			continue
+		}
+		ch.Disabled = disabled
+		if c.api != nil {
+			_, err = c.api.UpdateChannel(context.Background(), id, ch)
+			return err
+		}
+		store, err := notify.NewStore(c.cfg.ChannelsFile)
+		if err != nil {
+			return err
+		}
+		_, err = store.Update(id, notify.Channel(ch))
+		return err
+	}
+	return fmt.Errorf("channel %q not found", id)
+}
@@ -0,0 +1,83 @@
+//go:build !broadcastonly
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+)
+
+func init() {
+	commands["contract"] = command{"contract [-sources] [-refresh] [-add-abi name] <endpoint> <address>", cmdContract}
+}
+
+// cmdContract shows whether a contract's source is verified on Sourcify or
+// a block explorer, and what it was compiled from.
+func cmdContract(c *cli, args []string) error {
+	fs := flag.NewFlagSet("contract", flag.ContinueOnError)
+	sources := fs.Bool("sources", false, "also print the source files")
+	refresh := fs.Bool("refresh", false, "look it up again instead of using the server's cache")
+	addABI := fs.String("add-abi", "", "register the verified ABI under this `name`")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 2 {
+		return errUsage
+	}
+	if c.api == nil {
+		return errors.New("the server isn't running")
+	}
+	ctx := context.Background()
+	ct, err := c.api.Contract(ctx, fs.Arg(0), fs.Arg(1), *sources, *refresh)
+	if err != nil {
+		return err
+	}
+	if !ct.Verified {
+		fmt.Fprintf(c.out, "%s on chain %d is not verified\n", ct.Address, ct.ChainID)
+		if *addABI != "" {
+			return errors.New("no verified ABI to register")
+		}
+		return nil
+	}
+	w := c.table()
+	fmt.Fprintf(w, "address\t%s\n", ct.Address)
+	fmt.Fprintf(w, "name\t%s\n", ct.Name)
+	fmt.Fprintf(w, "verified\t%s (%s match)\n", ct.Source, ct.Match)
+	if ct.Compiler != "" {
+		fmt.Fprintf(w, "compiler\t%s %s\n", ct.Language, ct.Compiler)
+	}
+	if ct.License != "" {
+		fmt.Fprintf(w, "license\t%s\n", ct.License)
+	}
+	switch {
+	case ct.Implementation != "":
+		fmt.Fprintf(w, "proxy\tto %s\n", ct.Implementation)
+	case ct.Proxy:
+		fmt.Fprintln(w, "proxy\tyes")
+	}
+	for i, f := range ct.Files {
+		key := ""
+		if i == 0 {
+			key = "files"
+		}
+		fmt.Fprintf(w, "%s\t%s\n", key, f)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for _, f := range ct.Files {
+		if src, ok := ct.Sources[f]; ok {
+			fmt.Fprintf(c.out, "\n// ==== %s ====\n%s\n", f, src)
+		}
+	}
+	if *addABI != "" {
+		if len(ct.ABI) == 0 {
+			return errors.New("the verified source has no ABI")
+		}
+		a, err := c.api.AddABI(ctx, *addABI, ct.ABI)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "registered ABI %s (%s) with %d functions\n", a.Name, a.ID, len(a.Functions))
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+//go:build !broadcastonly
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/primal-host/wallet/client"
+)
+
+func init() {
+	commands["devnet"] = command{"devnet list | devnet add [-name n] [-watch] <url> | devnet status <endpoint> | devnet snapshot [-name n] <endpoint> | devnet revert <endpoint> <snapshot> | devnet mine [-interval seconds] <endpoint> [blocks] | devnet time [-no-mine] <endpoint> <duration> | devnet balance <endpoint> <address> <amount> | devnet impersonate [-stop] <endpoint> <address>", cmdDevnet}
+}
+
+// cmdDevnet finds Anvil and Hardhat nodes on the server's devnet URLs, adds
+// them as endpoints, and drives their test chains.
+func cmdDevnet(c *cli, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	if c.api == nil {
+		return errors.New("the server isn't running")
+	}
+	ctx := context.Background()
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			return errUsage
+		}
+		nodes, err := c.api.Devnets(ctx)
+		if err != nil {
+			return err
+		}
+		if len(nodes) == 0 {
+			fmt.Fprintln(c.out, "no Anvil or Hardhat node found")
+			return nil
+		}
+		w := c.table()
+		fmt.Fprintln(w, "URL\tCLIENT\tCHAIN\tBLOCK\tACCOUNTS\tENDPOINT")
+		for _, n := range nodes {
+			ep := n.Endpoint
+			if ep == "" {
+				ep = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d (%d watched)\t%s\n", n.URL, n.Client, n.ChainID, n.Block, len(n.Accounts), len(n.Watched), ep)
+		}
+		return w.Flush()
+	case "add":
+		fs := flag.NewFlagSet("devnet add", flag.ContinueOnError)
+		name := fs.String("name", "", "endpoint `name`; after the node when empty")
+		watch := fs.Bool("watch", false, "also add the accounts it funds as watch-only accounts")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 1 {
+			return errUsage
+		}
+		added, err := c.api.AddDevnet(ctx, fs.Arg(0), *name, *watch)
+		if err != nil {
+			return err
+		}
+		if added.Created {
+			fmt.Fprintf(c.out, "added endpoint %s (%s)\n", added.Endpoint.ID, added.Endpoint.Name)
+		} else {
+			fmt.Fprintf(c.out, "endpoint %s (%s) already has this URL\n", added.Endpoint.ID, added.Endpoint.Name)
+		}
+		if *watch {
+			fmt.Fprintf(c.out, "watching %s\n", plural(len(added.Watched), "dev account"))
+		}
+		return nil
+	case "status":
+		if len(args) != 2 {
+			return errUsage
+		}
+		st, err := c.api.DevnetStatus(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		return c.printDevnet(st)
+	case "snapshot":
+		fs := flag.NewFlagSet("devnet snapshot", flag.ContinueOnError)
+		name := fs.String("name", "", "snapshot `name`")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 1 {
+			return errUsage
+		}
+		snap, err := c.api.DevnetSnapshot(ctx, fs.Arg(0), *name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "snapshot %s at block %d\n", snap.ID, snap.Block)
+		return nil
+	case "revert":
+		if len(args) != 3 {
+			return errUsage
+		}
+		st, err := c.api.DevnetRevert(ctx, args[1], args[2])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "reverted to snapshot %s, now at block %d\n", args[2], st.Block)
+		return nil
+	case "mine":
+		fs := flag.NewFlagSet("devnet mine", flag.ContinueOnError)
+		interval := fs.Uint64("interval", 0, "`seconds` between the blocks' timestamps")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() < 1 || fs.NArg() > 2 {
+			return errUsage
+		}
+		blocks := uint64(1)
+		if fs.NArg() == 2 {
+			n, err := strconv.ParseUint(fs.Arg(1), 10, 64)
+			if err != nil || n == 0 {
+				return fmt.Errorf("invalid block count %q", fs.Arg(1))
+			}
+			blocks = n
+		}
+		st, err := c.api.DevnetMine(ctx, fs.Arg(0), blocks, *interval)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "mined %s, now at block %d\n", plural(int(blocks), "block"), st.Block)
+		return nil
+	case "time":
+		fs := flag.NewFlagSet("devnet time", flag.ContinueOnError)
+		noMine := fs.Bool("no-mine", false, "don't mine a block, so the new time shows only in the next one")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 2 {
+			return errUsage
+		}
+		d, err := time.ParseDuration(fs.Arg(1))
+		if err != nil || d < time.Second {
+			return fmt.Errorf("invalid duration %q, e.g. 90s, 24h", fs.Arg(1))
+		}
+		st, err := c.api.DevnetIncreaseTime(ctx, fs.Arg(0), uint64(d/time.Second), !*noMine)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "moved the clock %s forward; block %d is at %s\n", d, st.Block, time.Unix(st.Timestamp, 0).UTC().Format(time.RFC3339))
+		return nil
+	case "balance":
+		if len(args) != 4 {
+			return errUsage
+		}
+		if _, err := c.api.DevnetSetBalance(ctx, args[1], args[2], args[3]); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "set the balance of %s to %s\n", args[2], args[3])
+		return nil
+	case "impersonate":
+		fs := flag.NewFlagSet("devnet impersonate", flag.ContinueOnError)
+		stop := fs.Bool("stop", false, "stop impersonating the address")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 2 {
+			return errUsage
+		}
+		if _, err := c.api.DevnetImpersonate(ctx, fs.Arg(0), fs.Arg(1), !*stop); err != nil {
+			return err
+		}
+		if *stop {
+			fmt.Fprintf(c.out, "stopped impersonating %s\n", fs.Arg(1))
+		} else {
+			fmt.Fprintf(c.out, "impersonating %s; eth_sendTransaction from it needs no key\n", fs.Arg(1))
+		}
+		return nil
+	}
+	return errUsage
+}
+
+// printDevnet prints a devnet's head and the snapshots taken through the
+// server.
+func (c *cli) printDevnet(st *client.DevnetStatus) error {
+	w := c.table()
+	fmt.Fprintf(w, "client\t%s\n", st.Client)
+	fmt.Fprintf(w, "chain\t%d\n", st.ChainID)
+	fmt.Fprintf(w, "block\t%d\n", st.Block)
+	fmt.Fprintf(w, "time\t%s\n", time.Unix(st.Timestamp, 0).UTC().Format(time.RFC3339))
+	for i, a := range st.Impersonated {
+		key := ""
+		if i == 0 {
+			key = "impersonating"
+		}
+		fmt.Fprintf(w, "%s\t%s\n", key, a)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if len(st.Snapshots) == 0 {
+		return nil
+	}
+	fmt.Fprintln(c.out)
+	w = c.table()
+	fmt.Fprintln(w, "SNAPSHOT\tNAME\tBLOCK\tTAKEN")
+	for _, sn := range st.Snapshots {
+		name := sn.Name
+		if name == "" {
+			name = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", sn.ID, name, sn.Block, sn.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+	}
+	return w.Flush()
+}
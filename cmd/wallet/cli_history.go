@@ -0,0 +1,48 @@
+//go:build !broadcastonly
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/primal-host/wallet/client"
+)
+
+func init() {
+	commands["history"] = command{"history [-format csv|json|koinly|cointracker] [-address a] [-tag t] [-counterparty a] [-range r] [-o file]", cmdHistory}
+}
+
+// cmdHistory exports the server's mined sends, one row per asset moved,
+// to a file or standard output.
+func cmdHistory(c *cli, args []string) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	format := fs.String("format", "csv", "csv, json, or a tax tool's CSV import: koinly or cointracker")
+	address := fs.String("address", "", "only sends from this account")
+	tag := fs.String("tag", "", "only sends involving an address with this label tag")
+	counterparty := fs.String("counterparty", "", "only sends to or moving assets to or from this address")
+	rng := fs.String("range", "", "a span back from now (30d), a year (2025), or dates (2025-01-01..2025-06-30)")
+	out := fs.String("o", "", "file to write; standard output when empty")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+	if c.api == nil {
+		return errors.New("the server isn't running")
+	}
+	data, err := c.api.ExportHistory(context.Background(), *format, client.HistoryFilter{Address: *address, Tag: *tag, Range: *rng, Counterparty: *counterparty})
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err := c.out.Write(data)
+		return err
+	}
+	if err := os.WriteFile(*out, data, 0600); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "wrote %s\n", *out)
+	return nil
+}
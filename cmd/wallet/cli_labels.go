@@ -0,0 +1,104 @@
+//go:build !broadcastonly
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/primal-host/wallet/client"
+	"github.com/primal-host/wallet/internal/label"
+)
+
+func init() {
+	commands["labels"] = command{"labels list [-tag t] | labels set [-name n] [-tags a,b] [-note text] <address> | labels remove <address>", cmdLabels}
+}
+
+// cmdLabels manages the names and tags of addresses, on the server or,
+// offline, in the labels file.
+func cmdLabels(c *cli, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch args[0] {
+	case "list":
+		fs := flag.NewFlagSet("labels list", flag.ContinueOnError)
+		tag := fs.String("tag", "", "only labels with this tag")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 0 {
+			return errUsage
+		}
+		var labels []client.Label
+		if c.api != nil {
+			var err error
+			if labels, err = c.api.Labels(context.Background(), *tag); err != nil {
+				return err
+			}
+		} else {
+			store, err := label.NewStore(c.cfg.LabelsFile)
+			if err != nil {
+				return err
+			}
+			for _, l := range store.List(*tag) {
+				labels = append(labels, client.Label(l))
+			}
+		}
+		w := c.table()
+		fmt.Fprintln(w, "ADDRESS\tNAME\tTAGS\tNOTE")
+		for _, l := range labels {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", l.Address, l.Name, strings.Join(l.Tags, ","), l.Note)
+		}
+		return w.Flush()
+	case "set":
+		fs := flag.NewFlagSet("labels set", flag.ContinueOnError)
+		name := fs.String("name", "", "what to call the address")
+		tags := fs.String("tags", "", "comma-separated tags")
+		note := fs.String("note", "", "free-form note")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 1 {
+			return errUsage
+		}
+		l := client.Label{Address: fs.Arg(0), Name: *name, Note: *note}
+		if *tags != "" {
+			l.Tags = strings.Split(*tags, ",")
+		}
+		if c.api != nil {
+			set, err := c.api.SetLabel(context.Background(), l)
+			if err != nil {
+				return err
+			}
+			l = *set
+		} else {
+			store, err := label.NewStore(c.cfg.LabelsFile)
+			if err != nil {
+				return err
+			}
+			set, err := store.Set(label.Label(l))
+			if err != nil {
+				return err
+			}
+			l = client.Label(set)
+		}
+		fmt.Fprintf(c.out, "labeled %s\n", l.Address)
+		return nil
+	case "remove":
+		if len(args) != 2 {
+			return errUsage
+		}
+		var err error
+		if c.api != nil {
+			err = c.api.DeleteLabel(context.Background(), args[1])
+		} else {
+			var store *label.Store
+			if store, err = label.NewStore(c.cfg.LabelsFile); err == nil {
+				err = store.Delete(args[1])
+			}
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "removed the label of %s\n", args[1])
+		return nil
+	}
+	return errUsage
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/lightclient"
+)
+
+func init() {
+	commands["lightclient"] = command{"lightclient <endpoint>", cmdLightClient}
+}
+
+// cmdLightClient shows how far an endpoint's light client has followed the
+// beacon chain. Offline, it syncs one from scratch first, which takes a
+// signature check per sync committee period since the checkpoint.
+func cmdLightClient(c *cli, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	st, err := c.lightClient(args[0])
+	if err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+	w := c.table()
+	fmt.Fprintf(w, "consensus:\t%s\n", st.Consensus)
+	checkpoint := st.Checkpoint
+	if checkpoint == "" {
+		checkpoint = "-"
+	}
+	fmt.Fprintf(w, "checkpoint:\t%s\n", checkpoint)
+	fmt.Fprintf(w, "synced:\t%t\n", st.Synced)
+	if st.Latest != nil {
+		fmt.Fprintf(w, "period:\t%d\n", st.Period)
+		for _, h := range []struct {
+			name string
+			head *lightclient.Head
+		}{{"latest", st.Latest}, {"finalized", st.Finalized}} {
+			fmt.Fprintf(w, "%s:\tblock %d (slot %d) %s\n", h.name, h.head.Number, h.head.Slot, h.head.Hash)
+			fmt.Fprintf(w, "\tstate root %s\n", h.head.StateRoot)
+		}
+	}
+	if !st.SyncedAt.IsZero() {
+		fmt.Fprintf(w, "synced at:\t%s\n", st.SyncedAt.Local().Format("2006-01-02 15:04:05"))
+	}
+	if st.Error != "" {
+		fmt.Fprintf(w, "error:\t%s\n", st.Error)
+	}
+	return w.Flush()
+}
+
+// lightClient returns the status of the light client of the endpoint with
+// the given ID, from the server or, offline, by syncing one.
+func (c *cli) lightClient(id string) (lightclient.Status, error) {
+	if c.api != nil {
+		lc, err := c.api.LightClient(context.Background(), id)
+		if err != nil {
+			return lightclient.Status{}, err
+		}
+		st := lightclient.Status{
+			Consensus: lc.Consensus, Checkpoint: lc.Checkpoint, Synced: lc.Synced, Period: lc.Period, SyncedAt: lc.SyncedAt, Error: lc.Error,
+		}
+		if lc.Latest != nil {
+			st.Latest = &lightclient.Head{Slot: lc.Latest.Slot, Number: lc.Latest.BlockNumber, Hash: lc.Latest.BlockHash, StateRoot: lc.Latest.StateRoot}
+		}
+		if lc.Finalized != nil {
+			st.Finalized = &lightclient.Head{Slot: lc.Finalized.Slot, Number: lc.Finalized.BlockNumber, Hash: lc.Finalized.BlockHash, StateRoot: lc.Finalized.StateRoot}
+		}
+		return st, nil
+	}
+	store, err := c.store()
+	if err != nil {
+		return lightclient.Status{}, err
+	}
+	ep, ok := store.Get(id)
+	if !ok {
+		return lightclient.Status{}, fmt.Errorf("endpoint not found")
+	}
+	if ep.Consensus == "" {
+		return lightclient.Status{}, fmt.Errorf("endpoint has no light client")
+	}
+	lc := lightclient.New(endpoint.Endpoint{ID: ep.ID, URL: ep.Consensus, Proxy: ep.Proxy, Timeout: ep.Timeout}, ep.Checkpoint)
+	lc.Sync(context.Background()) // a failure shows in the status
+	return lc.Status(), nil
+}
@@ -0,0 +1,111 @@
+//go:build !broadcastonly
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+
+	"github.com/primal-host/wallet/internal/deeplink"
+)
+
+func init() {
+	commands["open"] = command{
+		"open <primalwallet:link> | open -register",
+		cmdOpen,
+	}
+}
+
+// cmdOpen opens a primalwallet: link in the dashboard's Send dialog. With
+// -register it makes this binary the operating system's handler for the
+// scheme, so links clicked in other apps arrive here.
+func cmdOpen(c *cli, args []string) error {
+	fs := flag.NewFlagSet("open", flag.ContinueOnError)
+	register := fs.Bool("register", false, "register this binary as the primalwallet: link handler")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if *register {
+		if fs.NArg() != 0 {
+			return errUsage
+		}
+		return registerScheme(c)
+	}
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+	if _, err := deeplink.Parse(fs.Arg(0)); err != nil {
+		return err
+	}
+	if c.api == nil {
+		return fmt.Errorf("no wallet server answering at %s", c.server)
+	}
+
+	target := c.api.BaseURL + "/?uri=" + url.QueryEscape(fs.Arg(0))
+	fmt.Fprintln(c.out, target)
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", target)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", target)
+	default:
+		cmd = exec.Command("xdg-open", target)
+	}
+	return cmd.Start()
+}
+
+// registerScheme points the primalwallet: scheme at "wallet -server URL open
+// <link>". macOS only routes schemes to app bundles, so there the
+// dashboard's browser handler is the way in.
+func registerScheme(c *cli) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	switch runtime.GOOS {
+	case "linux", "freebsd", "openbsd", "netbsd":
+		dir := os.Getenv("XDG_DATA_HOME")
+		if dir == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return err
+			}
+			dir = filepath.Join(home, ".local", "share")
+		}
+		dir = filepath.Join(dir, "applications")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		desktop := fmt.Sprintf("[Desktop Entry]\nType=Application\nName=Wallet\nExec=%q -server %q open %%u\nNoDisplay=true\nMimeType=x-scheme-handler/%s;\n",
+			exe, c.server, deeplink.Scheme)
+		path := filepath.Join(dir, deeplink.Scheme+".desktop")
+		if err := os.WriteFile(path, []byte(desktop), 0644); err != nil {
+			return err
+		}
+		if out, err := exec.Command("xdg-mime", "default", deeplink.Scheme+".desktop", "x-scheme-handler/"+deeplink.Scheme).CombinedOutput(); err != nil {
+			return fmt.Errorf("xdg-mime: %v: %s", err, out)
+		}
+		fmt.Fprintln(c.out, "registered", path)
+	case "windows":
+		key := `HKCU\Software\Classes\` + deeplink.Scheme
+		for _, args := range [][]string{
+			{"add", key, "/ve", "/d", "URL:" + deeplink.Scheme, "/f"},
+			{"add", key, "/v", "URL Protocol", "/d", "", "/f"},
+			{"add", key + `\shell\open\command`, "/ve", "/d", fmt.Sprintf(`"%s" -server "%s" open "%%1"`, exe, c.server), "/f"},
+		} {
+			if out, err := exec.Command("reg", args...).CombinedOutput(); err != nil {
+				return fmt.Errorf("reg: %v: %s", err, out)
+			}
+		}
+		fmt.Fprintln(c.out, "registered", key)
+	default:
+		return fmt.Errorf("can't register %s: links on %s; use the dashboard's Send > Handle Links instead", deeplink.Scheme, runtime.GOOS)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/primal-host/wallet/client"
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+func init() {
+	commands["private"] = command{"private | private [-endpoint id] <tx-hash>", cmdPrivate}
+}
+
+// cmdPrivate lists the transactions sent to private endpoints and what
+// their relays last said of them, or shows one. With -endpoint, that
+// private endpoint is asked about the transaction now, which also works
+// offline.
+func cmdPrivate(c *cli, args []string) error {
+	fs := flag.NewFlagSet("private", flag.ContinueOnError)
+	epID := fs.String("endpoint", "", "private endpoint `id` to ask about the transaction now")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 1 || *epID != "" && fs.NArg() == 0 {
+		return errUsage
+	}
+
+	var txs []client.PrivateTx
+	switch {
+	case fs.NArg() == 0:
+		if c.api == nil {
+			return fmt.Errorf("server not running: name the transaction and its private endpoint with -endpoint")
+		}
+		list, err := c.api.PrivateTxs(context.Background())
+		if err != nil {
+			return err
+		}
+		txs = list
+	case c.api != nil:
+		tx, err := c.api.PrivateTx(context.Background(), fs.Arg(0), *epID)
+		if err != nil {
+			return err
+		}
+		txs = []client.PrivateTx{*tx}
+	default:
+		if *epID == "" {
+			return fmt.Errorf("server not running: name the transaction's private endpoint with -endpoint")
+		}
+		store, err := c.store()
+		if err != nil {
+			return err
+		}
+		ep, ok := store.Get(*epID)
+		if !ok {
+			return fmt.Errorf("endpoint %q not found", *epID)
+		}
+		if !ep.Private {
+			return fmt.Errorf("%s is not a private endpoint", ep.Name)
+		}
+		st, err := endpoint.ReadPrivateStatus(context.Background(), ep, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		txs = []client.PrivateTx{{Hash: fs.Arg(0), Endpoint: ep.ID, Status: st.Status, Block: st.Block, CheckedAt: &now}}
+	}
+
+	w := c.table()
+	fmt.Fprintln(w, "HASH\tENDPOINT\tSTATUS\tBLOCK\tSENT\tCHECKED\tERROR")
+	for _, tx := range txs {
+		sent, checked, block := "-", "-", "-"
+		if !tx.SentAt.IsZero() {
+			sent = tx.SentAt.Local().Format("2006-01-02 15:04:05")
+		}
+		if tx.CheckedAt != nil {
+			checked = tx.CheckedAt.Local().Format("15:04:05")
+		}
+		if tx.Block != "" {
+			block = decimal(tx.Block)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", tx.Hash, tx.Endpoint, tx.Status, block, sent, checked, tx.Error)
+	}
+	return w.Flush()
+}
+
+// privateEndpoint returns the endpoint of store to send privately what
+// would go to ep, for sends made offline: ep itself if it is private,
+// otherwise the first private endpoint that answers with ep's chain ID.
+func privateEndpoint(store *endpoint.Store, ep endpoint.Endpoint) (endpoint.Endpoint, error) {
+	if ep.Private {
+		return ep, nil
+	}
+	chainID, err := chainIDOf(ep)
+	if err != nil {
+		return endpoint.Endpoint{}, fmt.Errorf("%s: %w", ep.Name, err)
+	}
+	for _, alt := range store.List() {
+		if !alt.Private {
+			continue
+		}
+		if id, err := chainIDOf(alt); err == nil && id == chainID {
+			return alt, nil
+		}
+	}
+	return endpoint.Endpoint{}, fmt.Errorf("no private endpoint of chain %s answers", chainID)
+}
+
+// chainIDOf asks ep for its chain ID, in decimal.
+func chainIDOf(ep endpoint.Endpoint) (string, error) {
+	raw, err := endpoint.RPCCall(context.Background(), ep, "eth_chainId", nil)
+	if err != nil {
+		return "", err
+	}
+	var hex string
+	if err := json.Unmarshal(raw, &hex); err != nil {
+		return "", fmt.Errorf("unexpected eth_chainId result %s", raw)
+	}
+	n, err := evm.ParseQuantity(hex)
+	if err != nil {
+		return "", fmt.Errorf("unexpected eth_chainId result %s", raw)
+	}
+	return n.String(), nil
+}
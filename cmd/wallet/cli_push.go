@@ -0,0 +1,105 @@
+//go:build !broadcastonly
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/primal-host/wallet/client"
+	"github.com/primal-host/wallet/internal/webpush"
+)
+
+func init() {
+	commands["push"] = command{"push list | push test <id> | push remove <id>", cmdPush}
+}
+
+// cmdPush manages the browsers subscribed to push notifications, on the
+// server or, offline, in the web push file. Browsers subscribe from the
+// dashboard's Alerts dialog.
+func cmdPush(c *cli, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			return errUsage
+		}
+		var subs []client.PushSubscription
+		if c.api != nil {
+			var err error
+			if subs, err = c.api.PushSubscriptions(context.Background()); err != nil {
+				return err
+			}
+		} else {
+			pushes, err := c.pushes()
+			if err != nil {
+				return err
+			}
+			for _, sub := range pushes.List() {
+				subs = append(subs, client.PushSubscription{
+					ID: sub.ID, Name: sub.Name, Endpoint: sub.Endpoint, Kinds: sub.Kinds, By: sub.By,
+					LastSentAt: sub.LastSentAt, LastError: sub.LastError, CreatedAt: sub.CreatedAt,
+				})
+			}
+		}
+		w := c.table()
+		fmt.Fprintln(w, "ID\tSERVICE\tKINDS\tBY\tLAST SENT\tERROR\tNAME")
+		for _, sub := range subs {
+			kinds := "all"
+			if len(sub.Kinds) > 0 {
+				kinds = strings.Join(sub.Kinds, ",")
+			}
+			sent := "-"
+			if sub.LastSentAt != nil {
+				sent = sub.LastSentAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", sub.ID, sub.Endpoint, kinds, sub.By, sent, sub.LastError, sub.Name)
+		}
+		return w.Flush()
+	case "test":
+		if len(args) != 2 {
+			return errUsage
+		}
+		var err error
+		if c.api != nil {
+			err = c.api.TestPushSubscription(context.Background(), args[1])
+		} else {
+			var pushes *webpush.Store
+			if pushes, err = c.pushes(); err == nil {
+				err = pushes.Test(args[1])
+			}
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "pushed a test notification to %s\n", args[1])
+		return nil
+	case "remove":
+		if len(args) != 2 {
+			return errUsage
+		}
+		var err error
+		if c.api != nil {
+			err = c.api.DeletePushSubscription(context.Background(), args[1])
+		} else {
+			var pushes *webpush.Store
+			if pushes, err = c.pushes(); err == nil {
+				err = pushes.Delete(args[1])
+			}
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "removed push subscription %s\n", args[1])
+		return nil
+	}
+	return errUsage
+}
+
+// pushes opens the web push file.
+func (c *cli) pushes() (*webpush.Store, error) {
+	return webpush.NewStore(c.cfg.WebPushFile, c.cfg.WebPushSubject)
+}
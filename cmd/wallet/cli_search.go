@@ -0,0 +1,38 @@
+//go:build !broadcastonly
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+func init() {
+	commands["search"] = command{"search [-limit n] <query>", cmdSearch}
+}
+
+// cmdSearch finds endpoints, accounts, labels, tags, contacts, tokens, and,
+// by full hash or address, transactions and accounts on the endpoints.
+func cmdSearch(c *cli, args []string) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	limit := fs.Int("limit", 0, "most results to show; the server's default when 0")
+	if err := fs.Parse(args); err != nil || fs.NArg() == 0 {
+		return errUsage
+	}
+	if c.api == nil {
+		return errors.New("the server isn't running")
+	}
+	results, err := c.api.Search(context.Background(), strings.Join(fs.Args(), " "), *limit)
+	if err != nil {
+		return err
+	}
+	w := c.table()
+	fmt.Fprintln(w, "KIND\tTITLE\tDETAIL")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.Kind, r.Title, r.Detail)
+	}
+	return w.Flush()
+}
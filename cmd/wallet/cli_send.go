@@ -0,0 +1,185 @@
+//go:build !broadcastonly
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/primal-host/wallet/client"
+	"github.com/primal-host/wallet/internal/evm"
+	"github.com/primal-host/wallet/internal/journal"
+	"github.com/primal-host/wallet/internal/signer"
+	"github.com/primal-host/wallet/internal/txbuild"
+	"github.com/primal-host/wallet/internal/vault"
+)
+
+func init() {
+	commands["send"] = command{
+		"send -endpoint id -from addr -to addr -value amount [-data hex] [-dry-run] [-private] [-idempotency-key key] [-confirm-to suffix -confirm-value amount]",
+		cmdSend,
+	}
+	commands["journal"] = command{"journal [-stage stage]", cmdJournal}
+}
+
+// cmdSend sends native currency (or calls a contract with -data) from a
+// server vault key. Offline, it unlocks the vault with VAULT_PASSPHRASE_FILE.
+func cmdSend(c *cli, args []string) error {
+	fs := flag.NewFlagSet("send", flag.ContinueOnError)
+	epID := fs.String("endpoint", "", "endpoint ID")
+	from := fs.String("from", "", "vault key address")
+	to := fs.String("to", "", "recipient address")
+	value := fs.String("value", "0", "amount in whole native units (e.g. 0.05)")
+	data := fs.String("data", "", "hex calldata")
+	dryRun := fs.Bool("dry-run", false, "sign but don't broadcast; print the raw transaction")
+	private := fs.Bool("private", false, "send to a private endpoint of the chain, keeping it out of the public mempool")
+	idemKey := fs.String("idempotency-key", "", "send at most once per key; reuse it when retrying (server only)")
+	confirmTo := fs.String("confirm-to", "", "last 6 characters of -to, re-typed, for values at the server's CONFIRM_THRESHOLD")
+	confirmValue := fs.String("confirm-value", "", "-value re-typed, for values at the server's CONFIRM_THRESHOLD")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+	if *epID == "" || *from == "" || *to == "" {
+		return errUsage
+	}
+	wei, err := evm.ParseUnits(*value, 18)
+	if err != nil {
+		return err
+	}
+	req := txbuild.Request{Endpoint: *epID, From: *from, To: *to, Value: wei.String(), Data: *data}
+
+	var signed txbuild.Signed
+	if c.api != nil {
+		ctx := c.sendContext(*idemKey)
+		if *confirmTo != "" || *confirmValue != "" {
+			ctx = client.WithConfirmation(ctx, client.Confirmation{ToSuffix: *confirmTo, Value: *confirmValue})
+		}
+		if *private {
+			ctx = client.WithPrivate(ctx)
+		}
+		s, err := c.api.VaultSend(ctx, client.TxRequest(req), !*dryRun)
+		var apiErr *client.APIError
+		if errors.As(err, &apiErr) && apiErr.ConfirmRequired {
+			return fmt.Errorf("%w (pass -confirm-to and -confirm-value)", err)
+		}
+		if err != nil {
+			return err
+		}
+		signed = txbuild.Signed(*s)
+	} else {
+		s, err := sendOffline(c, req, !*dryRun, *private)
+		if err != nil {
+			return err
+		}
+		signed = *s
+	}
+
+	if *dryRun {
+		fmt.Fprintln(c.out, signed.Raw)
+		return nil
+	}
+	fmt.Fprintln(c.out, signed.Hash)
+	return nil
+}
+
+func sendOffline(c *cli, req txbuild.Request, broadcast, private bool) (*txbuild.Signed, error) {
+	store, err := c.store()
+	if err != nil {
+		return nil, err
+	}
+	ep, ok := store.Get(req.Endpoint)
+	if !ok {
+		return nil, fmt.Errorf("endpoint %q not found", req.Endpoint)
+	}
+	v, err := vault.Open(c.cfg.VaultFile)
+	if err != nil {
+		return nil, err
+	}
+	if c.cfg.VaultPassFile == "" {
+		return nil, fmt.Errorf("server not running: set VAULT_PASSPHRASE_FILE to unlock the vault")
+	}
+	pass, err := os.ReadFile(c.cfg.VaultPassFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.Unlock(strings.TrimRight(string(pass), "\r\n")); err != nil {
+		return nil, err
+	}
+	defer v.Lock()
+
+	env, err := txbuild.Build(context.Background(), ep, req)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := env.Transaction()
+	if err != nil {
+		return nil, err
+	}
+	sign := func() (*txbuild.Signed, error) {
+		sig, err := v.SignTx(context.Background(), signer.Account{Address: env.From}, tx)
+		if err != nil {
+			return nil, err
+		}
+		return txbuild.Import(env, "", &sig)
+	}
+	if !broadcast {
+		return sign()
+	}
+	if private {
+		if ep, err = privateEndpoint(store, ep); err != nil {
+			return nil, err
+		}
+	}
+	j, err := journal.NewStore(c.cfg.JournalFile)
+	if err != nil {
+		return nil, err
+	}
+	signed, err := j.Send(context.Background(), ep, env, "cli", sign)
+	if err != nil {
+		return nil, err
+	}
+	return signed, nil
+}
+
+// cmdJournal lists recent sends and how far each got, so an interrupted send
+// can be checked before it is retried.
+func cmdJournal(c *cli, args []string) error {
+	fs := flag.NewFlagSet("journal", flag.ContinueOnError)
+	stage := fs.String("stage", "", "only intents at this stage (prepared, signed, sent, failed, mined, confirmed, reverted)")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+	var intents []journal.Intent
+	summaries := map[string]string{} // decoded by the server only
+	if c.api != nil {
+		list, err := c.api.Journal(context.Background(), *stage)
+		if err != nil {
+			return err
+		}
+		for _, e := range list {
+			intents = append(intents, journal.Intent(e.Intent))
+			summaries[e.ID] = e.Summary
+		}
+	} else {
+		j, err := journal.NewStore(c.cfg.JournalFile)
+		if err != nil {
+			return err
+		}
+		intents = j.List(*stage)
+	}
+	w := c.table()
+	fmt.Fprintln(w, "ID\tWHEN\tORIGIN\tENDPOINT\tNONCE\tTO\tSTAGE\tHASH\tSUMMARY\tERROR")
+	for _, in := range intents {
+		nonce := in.Nonce
+		if n, err := evm.ParseQuantity(in.Nonce); err == nil {
+			nonce = n.String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", in.ID, in.CreatedAt.Local().Format("2006-01-02 15:04:05"),
+			in.Origin, in.Endpoint, nonce, in.To, in.Stage, in.Hash, summaries[in.ID], in.Error)
+	}
+	return w.Flush()
+}
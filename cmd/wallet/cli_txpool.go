@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+	"github.com/primal-host/wallet/internal/signer"
+)
+
+func init() {
+	commands["txpool"] = command{"txpool [-address addr,...] <endpoint>", cmdTxPool}
+}
+
+// cmdTxPool shows the size of an endpoint's transaction pool and the
+// transactions waiting in it from the signer accounts and the addresses
+// given, for nodes that serve the txpool namespace.
+func cmdTxPool(c *cli, args []string) error {
+	fs := flag.NewFlagSet("txpool", flag.ContinueOnError)
+	addrFlag := fs.String("address", "", "comma-separated `addresses` to list besides the signer accounts")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+	var addresses []string
+	for _, a := range strings.Split(*addrFlag, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			if _, err := evm.ParseAddress(a); err != nil {
+				return err
+			}
+			addresses = append(addresses, a)
+		}
+	}
+
+	pool, decimals, err := c.txPool(fs.Arg(0), addresses)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fs.Arg(0), err)
+	}
+	fmt.Fprintf(c.out, "pending: %d  queued: %d\n", pool.Pending, pool.Queued)
+	if len(pool.Addresses) == 0 {
+		return nil
+	}
+	if len(pool.Transactions) == 0 {
+		fmt.Fprintf(c.out, "no transactions from %d address(es)\n", len(pool.Addresses))
+		return nil
+	}
+	w := c.table()
+	fmt.Fprintln(w, "STATUS\tFROM\tNONCE\tTO\tVALUE\tFEE CAP\tHASH")
+	for _, tx := range pool.Transactions {
+		to := tx.To
+		if to == "" {
+			to = "(create)"
+		}
+		fee := tx.MaxFeePerGas
+		if fee == "" {
+			fee = tx.GasPrice
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", tx.Status, tx.From, decimal(tx.Nonce), to, units(tx.Value, decimals), gweiText(fee), tx.Hash)
+	}
+	return w.Flush()
+}
+
+// txPool reads an endpoint's pool through the server or, offline, directly,
+// listing the transactions of the local signer accounts and addresses. It
+// also returns the decimals of the endpoint's native currency.
+func (c *cli) txPool(id string, addresses []string) (endpoint.TxPool, int, error) {
+	if c.api != nil {
+		p, err := c.api.TxPool(context.Background(), id, addresses...)
+		if err != nil {
+			return endpoint.TxPool{}, 0, err
+		}
+		pool := endpoint.TxPool{Pending: p.Pending, Queued: p.Queued, Addresses: p.Addresses}
+		for _, tx := range p.Transactions {
+			pool.Transactions = append(pool.Transactions, endpoint.PoolTx(tx))
+		}
+		decimals := 18
+		if resp, err := c.api.Status(context.Background()); err == nil {
+			for _, st := range resp.Endpoints {
+				if st.ID == id {
+					decimals = st.Decimals
+				}
+			}
+		}
+		return pool, decimals, nil
+	}
+	store, err := c.store()
+	if err != nil {
+		return endpoint.TxPool{}, 0, err
+	}
+	ep, ok := store.Get(id)
+	if !ok {
+		return endpoint.TxPool{}, 0, fmt.Errorf("endpoint not found")
+	}
+	accounts, err := signer.NewStore(c.cfg.AccountsFile)
+	if err != nil {
+		return endpoint.TxPool{}, 0, err
+	}
+	for _, acct := range accounts.List() {
+		addresses = append(addresses, acct.Address)
+	}
+	pool, err := endpoint.ReadTxPool(context.Background(), ep, addresses)
+	return pool, ep.Native.Decimals, err
+}
+
+// decimal shows a hex quantity in decimal.
+func decimal(hex string) string {
+	if n, err := evm.ParseQuantity(hex); err == nil {
+		return n.String()
+	}
+	return hex
+}
+
+// units shows a hex amount of the smallest unit in whole units.
+func units(hex string, decimals int) string {
+	if n, err := evm.ParseQuantity(hex); err == nil {
+		return evm.FormatUnits(n, decimals)
+	}
+	return hex
+}
+
+// gweiText shows a hex wei fee in gwei.
+func gweiText(hex string) string {
+	if n, err := evm.ParseQuantity(hex); err == nil {
+		return evm.FormatUnits(n, 9) + " gwei"
+	}
+	return "-"
+}
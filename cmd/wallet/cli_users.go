@@ -0,0 +1,266 @@
+//go:build !broadcastonly
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/primal-host/wallet/internal/qr"
+	"github.com/primal-host/wallet/internal/user"
+)
+
+func init() {
+	commands["users"] = command{"users list | users add [-admin] [-role role] <name> | users passwd <name> | users role <name> admin|operator|viewer|user | users remove <name>", cmdUsers}
+	commands["login"] = command{"login <name>", cmdLogin}
+	commands["tokens"] = command{"tokens list | tokens create [-scope read-status,read-balances,broadcast,admin] [-expires 720h] <name> | tokens revoke <id>", cmdTokens}
+	commands["devices"] = command{"devices list | devices pair | devices revoke <id>", cmdDevices}
+}
+
+// cmdUsers manages the accounts of a multi-user server. Like approvers, it
+// always works on USERS_FILE, which the server rereads when it changes, so
+// the first admin can be added before anyone can log in. Passwords are read
+// from standard input.
+func cmdUsers(c *cli, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	users, err := user.NewStore(c.cfg.UsersFile, c.cfg.UsersDir)
+	if err != nil {
+		return err
+	}
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		list, err := users.List()
+		if err != nil {
+			return err
+		}
+		w := c.table()
+		fmt.Fprintln(w, "NAME\tROLE\tID\tADDED")
+		for _, u := range list {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", u.Name, u.Role, u.ID, u.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+		}
+		return w.Flush()
+	case args[0] == "add":
+		fs := flag.NewFlagSet("users add", flag.ContinueOnError)
+		admin := fs.Bool("admin", false, "give the user the admin role")
+		roleName := fs.String("role", string(user.RoleUser), "admin, operator, viewer, or user")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 1 {
+			return errUsage
+		}
+		role := user.Role(*roleName)
+		if *admin {
+			role = user.RoleAdmin
+		}
+		password, err := readPassword("password for " + fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		u, err := users.Add(fs.Arg(0), password, role)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "added %s (%s)\n", u.Name, u.Role)
+		if u.Role.Shared() {
+			fmt.Fprintf(c.out, "%ss work in the server's own endpoints, accounts, and bookmarks\n", u.Role)
+		} else {
+			fmt.Fprintln(c.out, "profile directory:", users.ProfileDir(u.ID))
+		}
+		return nil
+	case args[0] == "passwd" && len(args) == 2:
+		u, err := findUser(users, args[1])
+		if err != nil {
+			return err
+		}
+		password, err := readPassword("new password for " + u.Name)
+		if err != nil {
+			return err
+		}
+		if _, err := users.Update(u.ID, "", password); err != nil {
+			return err
+		}
+		fmt.Fprintln(c.out, "password changed for", u.Name)
+		return nil
+	case args[0] == "role" && len(args) == 3:
+		u, err := findUser(users, args[1])
+		if err != nil {
+			return err
+		}
+		if u, err = users.Update(u.ID, user.Role(args[2]), ""); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "%s is now %s\n", u.Name, u.Role)
+		return nil
+	case args[0] == "remove" && len(args) == 2:
+		u, err := findUser(users, args[1])
+		if err != nil {
+			return err
+		}
+		if err := users.Delete(u.ID); err != nil {
+			return err
+		}
+		fmt.Fprintln(c.out, "removed", u.Name)
+		if !u.Role.Shared() {
+			fmt.Fprintln(c.out, "their data is still in", users.ProfileDir(u.ID))
+		}
+		return nil
+	}
+	return errUsage
+}
+
+// cmdLogin starts a session on the running server and prints it as a shell
+// assignment, so eval "$(wallet login alice)" logs the shell in.
+func cmdLogin(c *cli, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	if c.api == nil {
+		return errors.New("the server isn't running")
+	}
+	password, err := readPassword("password for " + args[0])
+	if err != nil {
+		return err
+	}
+	u, err := c.api.Login(context.Background(), args[0], password)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "logged in as %s (%s)\n", u.Name, u.Role)
+	fmt.Fprintf(c.out, "export WALLET_SESSION=%s\n", c.api.Session)
+	return nil
+}
+
+// cmdTokens manages the logged-in user's API tokens on the running server.
+// A new token's secret is printed once.
+func cmdTokens(c *cli, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	if c.api == nil {
+		return errors.New("the server isn't running")
+	}
+	ctx := context.Background()
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		list, err := c.api.Tokens(ctx)
+		if err != nil {
+			return err
+		}
+		w := c.table()
+		fmt.Fprintln(w, "ID\tNAME\tOWNER\tSCOPES\tEXPIRES\tLAST USED")
+		for _, t := range list {
+			expires, used := "never", "never"
+			if t.ExpiresAt != nil {
+				expires = t.ExpiresAt.Local().Format("2006-01-02 15:04")
+			}
+			if t.LastUsedAt != nil {
+				used = t.LastUsedAt.Local().Format("2006-01-02 15:04")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Name, t.Owner, strings.Join(t.Scopes, ","), expires, used)
+		}
+		return w.Flush()
+	case args[0] == "create":
+		fs := flag.NewFlagSet("tokens create", flag.ContinueOnError)
+		scopes := fs.String("scope", string(user.ScopeReadStatus), "comma-separated scopes")
+		expires := fs.Duration("expires", 0, "lifetime, e.g. 720h; 0 never expires")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 1 {
+			return errUsage
+		}
+		t, secret, err := c.api.CreateToken(ctx, fs.Arg(0), strings.Split(*scopes, ","), *expires)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "created %s (%s) with scopes %s; the token is shown only once\n", t.Name, t.ID, strings.Join(t.Scopes, ","))
+		fmt.Fprintln(c.out, secret)
+		return nil
+	case args[0] == "revoke" && len(args) == 2:
+		if err := c.api.RevokeToken(ctx, args[1]); err != nil {
+			return err
+		}
+		fmt.Fprintln(c.out, "revoked", args[1])
+		return nil
+	}
+	return errUsage
+}
+
+// cmdDevices manages the logged-in user's paired devices on the running
+// server. pair prints a QR code for a phone to scan.
+func cmdDevices(c *cli, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	if c.api == nil {
+		return errors.New("the server isn't running")
+	}
+	ctx := context.Background()
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		list, err := c.api.Devices(ctx)
+		if err != nil {
+			return err
+		}
+		w := c.table()
+		fmt.Fprintln(w, "ID\tNAME\tOWNER\tSCOPES\tPAIRED\tLAST USED")
+		for _, d := range list {
+			used := "never"
+			if d.LastUsedAt != nil {
+				used = d.LastUsedAt.Local().Format("2006-01-02 15:04")
+				if d.LastIP != "" {
+					used += " from " + d.LastIP
+				}
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", d.ID, d.Name, d.Owner, strings.Join(d.Scopes, ","), d.PairedAt.Local().Format("2006-01-02 15:04"), used)
+		}
+		return w.Flush()
+	case args[0] == "pair" && len(args) == 1:
+		p, err := c.api.StartPairing(ctx)
+		if err != nil {
+			return err
+		}
+		code, err := qr.Encode(p.URL)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(c.out, code.Terminal())
+		fmt.Fprintln(c.out, p.URL)
+		if p.Fingerprint != "" {
+			fmt.Fprintln(c.out, "certificate SHA-256:", p.Fingerprint)
+		}
+		fmt.Fprintf(os.Stderr, "scan with the device before %s; the code works once\n", p.ExpiresAt.Local().Format("15:04:05"))
+		return nil
+	case args[0] == "revoke" && len(args) == 2:
+		if err := c.api.RevokeDevice(ctx, args[1]); err != nil {
+			return err
+		}
+		fmt.Fprintln(c.out, "revoked", args[1])
+		return nil
+	}
+	return errUsage
+}
+
+func findUser(users *user.Store, name string) (user.User, error) {
+	u, ok := users.Find(name)
+	if !ok {
+		return user.User{}, fmt.Errorf("user %q not found", name)
+	}
+	return u, nil
+}
+
+// readPassword reads a line from standard input, prompting on standard error
+// when it is a terminal. Typed input is echoed; pipe the password from a
+// file to keep it off the screen.
+func readPassword(prompt string) (string, error) {
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprint(os.Stderr, prompt+": ")
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", errors.New("no password given")
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,148 @@
+//go:build !broadcastonly
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/primal-host/wallet/internal/config"
+	"github.com/primal-host/wallet/internal/journal"
+	"github.com/primal-host/wallet/internal/schedule"
+	"github.com/primal-host/wallet/internal/signer"
+	"github.com/primal-host/wallet/internal/user"
+	"github.com/primal-host/wallet/internal/vault"
+	"github.com/primal-host/wallet/internal/verify"
+)
+
+func init() {
+	commands["verify"] = command{"verify [-receipts]", cmdVerify}
+}
+
+// storeFiles lists the files of the server's stores for verification.
+func storeFiles(cfg *config.Config) []verify.File {
+	return []verify.File{
+		{Name: "endpoints", Path: cfg.EndpointsFile},
+		{Name: "assets", Path: cfg.AssetsFile},
+		{Name: "accounts", Path: cfg.AccountsFile},
+		{Name: "bookmarks", Path: cfg.BookmarksFile},
+		{Name: "contacts", Path: cfg.ContactsFile},
+		{Name: "labels", Path: cfg.LabelsFile},
+		{Name: "erc20", Path: cfg.ERC20File},
+		{Name: "abis", Path: cfg.ABIsFile},
+		{Name: "schedules", Path: cfg.SchedulesFile},
+		{Name: "bridges", Path: cfg.BridgesFile},
+		{Name: "batches", Path: cfg.BatchesFile},
+		{Name: "alerts", Path: cfg.AlertsFile},
+		{Name: "channels", Path: cfg.ChannelsFile, Secret: true},
+		{Name: "webpush", Path: cfg.WebPushFile, Secret: true},
+		{Name: "paymasters", Path: cfg.PaymastersFile},
+		{Name: "approvals", Path: cfg.ApprovalsFile},
+		{Name: "approvers", Path: cfg.ApproversFile, Secret: true},
+		{Name: "idempotency", Path: cfg.IdempotencyFile},
+		{Name: "journal", Path: cfg.JournalFile},
+		{Name: "preferences", Path: cfg.PreferencesFile},
+		{Name: "keysync", Path: cfg.KeySyncFile, Secret: true},
+		{Name: "users", Path: cfg.UsersFile, Secret: true},
+		{Name: "tokens", Path: cfg.TokensFile, Secret: true},
+		{Name: "devices", Path: cfg.DevicesFile, Secret: true},
+		{Name: "vault", Path: cfg.VaultFile, Secret: true},
+		{Name: "faucet", Path: cfg.FaucetHistoryFile},
+		{Name: "uptime", Path: cfg.UptimeFile},
+		{Name: "bench", Path: cfg.BenchFile},
+	}
+}
+
+// cmdVerify checks every store for corruption and inconsistencies and fails
+// if it finds any. Offline, the vault is only decrypted when
+// VAULT_PASSPHRASE_FILE is set.
+func cmdVerify(c *cli, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	receipts := fs.Bool("receipts", false, "also check mined sends against their receipts (an RPC call each)")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+	var r *verify.Report
+	if c.api != nil {
+		resp, err := c.api.Verify(context.Background(), *receipts)
+		if err != nil {
+			return err
+		}
+		r = &verify.Report{Checked: resp.Checked, Skipped: resp.Skipped}
+		for _, p := range resp.Problems {
+			r.Problems = append(r.Problems, verify.Problem(p))
+		}
+	} else {
+		st, problems := c.verifyStores()
+		r = verify.Run(context.Background(), st, *receipts)
+		r.Problems = append(problems, r.Problems...)
+	}
+
+	stores := make([]string, 0, len(r.Checked))
+	for name := range r.Checked {
+		stores = append(stores, name)
+	}
+	sort.Strings(stores)
+	for _, name := range stores {
+		fmt.Fprintf(c.out, "checked %d %s\n", r.Checked[name], name)
+	}
+	for _, s := range r.Skipped {
+		fmt.Fprintln(c.out, "skipped:", s)
+	}
+	if r.OK() {
+		fmt.Fprintln(c.out, "no problems found")
+		return nil
+	}
+	w := c.table()
+	fmt.Fprintln(w, "\nSTORE\tITEM\tPROBLEM")
+	for _, p := range r.Problems {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", p.Store, p.Item, p.Message)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return fmt.Errorf("%d problems found", len(r.Problems))
+}
+
+// verifyStores opens the stores from their files, as the server would. A
+// store that fails to open is left out and reported as a problem.
+func (c *cli) verifyStores() (verify.Stores, []verify.Problem) {
+	st := verify.Stores{Files: storeFiles(c.cfg)}
+	var problems []verify.Problem
+	failed := func(store string, err error) {
+		if err != nil {
+			problems = append(problems, verify.Problem{Store: store, Message: err.Error()})
+		}
+	}
+	var err error
+	st.Endpoints, err = c.store()
+	failed("endpoints", err)
+	st.Accounts, err = signer.NewStore(c.cfg.AccountsFile)
+	failed("accounts", err)
+	st.Vault, err = vault.Open(c.cfg.VaultFile)
+	failed("vault", err)
+	if st.Vault != nil && c.cfg.VaultPassFile != "" && st.Vault.Status().Initialized {
+		pass, err := os.ReadFile(c.cfg.VaultPassFile)
+		if err == nil {
+			err = st.Vault.Unlock(strings.TrimRight(string(pass), "\r\n"))
+		}
+		failed("vault", err)
+	}
+	st.Journal, err = journal.NewStore(c.cfg.JournalFile)
+	failed("journal", err)
+	st.Schedules, err = schedule.NewStore(c.cfg.SchedulesFile)
+	failed("schedules", err)
+	if c.cfg.MultiUser {
+		st.Users, err = user.NewStore(c.cfg.UsersFile, c.cfg.UsersDir)
+		failed("users", err)
+		st.Tokens, err = user.NewTokens(c.cfg.TokensFile)
+		failed("tokens", err)
+		st.Devices, err = user.NewDevices(c.cfg.DevicesFile)
+		failed("devices", err)
+	}
+	return st, problems
+}
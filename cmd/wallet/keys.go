@@ -0,0 +1,346 @@
+//go:build !broadcastonly
+
+package main
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/primal-host/wallet/internal/abi"
+	"github.com/primal-host/wallet/internal/alert"
+	"github.com/primal-host/wallet/internal/approval"
+	"github.com/primal-host/wallet/internal/batch"
+	"github.com/primal-host/wallet/internal/bench"
+	"github.com/primal-host/wallet/internal/bookmark"
+	"github.com/primal-host/wallet/internal/bridge"
+	"github.com/primal-host/wallet/internal/config"
+	"github.com/primal-host/wallet/internal/contact"
+	"github.com/primal-host/wallet/internal/devnet"
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/erc20"
+	"github.com/primal-host/wallet/internal/evm"
+	"github.com/primal-host/wallet/internal/faucet"
+	"github.com/primal-host/wallet/internal/icon"
+	"github.com/primal-host/wallet/internal/idempotency"
+	"github.com/primal-host/wallet/internal/ipfs"
+	"github.com/primal-host/wallet/internal/journal"
+	"github.com/primal-host/wallet/internal/keysync"
+	"github.com/primal-host/wallet/internal/label"
+	"github.com/primal-host/wallet/internal/logtail"
+	"github.com/primal-host/wallet/internal/nft"
+	"github.com/primal-host/wallet/internal/notify"
+	"github.com/primal-host/wallet/internal/paymaster"
+	"github.com/primal-host/wallet/internal/phishing"
+	"github.com/primal-host/wallet/internal/risk"
+	"github.com/primal-host/wallet/internal/safe"
+	"github.com/primal-host/wallet/internal/schedule"
+	"github.com/primal-host/wallet/internal/server"
+	"github.com/primal-host/wallet/internal/signer"
+	"github.com/primal-host/wallet/internal/uptime"
+	"github.com/primal-host/wallet/internal/user"
+	"github.com/primal-host/wallet/internal/vault"
+	"github.com/primal-host/wallet/internal/verified"
+	"github.com/primal-host/wallet/internal/webpush"
+)
+
+// newServer loads the signer accounts, bookmarks, contacts, labels, the scam address
+// list and risk scanner, ABIs, preferences, schedules, tracked bridge transfers, alerts, notification channels, browser push subscriptions, paymasters, Safe Transaction Services, approval
+// queue, send journal, server vault, optional faucet, and users in
+// multi-user mode, and builds the full server.
+func newServer(cfg *config.Config, store *endpoint.Store, idem *idempotency.Store, icons *icon.Cache, history *uptime.Store, benches *bench.Store, limits server.Limits, headers server.Headers, proxy server.Proxy, logs *logtail.Tail) *server.Server {
+	accounts, err := signer.NewStore(cfg.AccountsFile)
+	if err != nil {
+		slog.Error("accounts load failed", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("accounts loaded", "count", len(accounts.List()))
+
+	bookmarks, err := bookmark.NewStore(cfg.BookmarksFile)
+	if err != nil {
+		slog.Error("bookmarks load failed", "error", err)
+		os.Exit(1)
+	}
+
+	contacts, err := contact.NewStore(cfg.ContactsFile)
+	if err != nil {
+		slog.Error("contacts load failed", "error", err)
+		os.Exit(1)
+	}
+
+	labels, err := label.NewStore(cfg.LabelsFile)
+	if err != nil {
+		slog.Error("labels load failed", "error", err)
+		os.Exit(1)
+	}
+
+	var scams *phishing.List
+	if cfg.ScamList != "off" {
+		if scams, err = phishing.Load(cfg.ScamList); err != nil {
+			slog.Error("scam list load failed", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("scam list loaded", "count", scams.Len())
+	}
+
+	var scanner risk.Scanner
+	if cfg.RiskWebhook != "" {
+		wh, err := risk.NewWebhook(cfg.RiskWebhook, cfg.RiskToken)
+		if err != nil {
+			slog.Error("invalid RISK_WEBHOOK", "error", err)
+			os.Exit(1)
+		}
+		scanner = wh
+		slog.Info("risk scanner enabled", "block_critical", cfg.RiskBlockCritical)
+	}
+
+	abis, err := abi.NewRegistry(cfg.ABIsFile)
+	if err != nil {
+		slog.Error("abis load failed", "error", err)
+		os.Exit(1)
+	}
+
+	explorers, err := verified.ParseExplorers(cfg.ExplorerAPIs)
+	if err != nil {
+		slog.Error("invalid EXPLORER_APIS", "error", err)
+		os.Exit(1)
+	}
+	sourcify := cmp.Or(cfg.SourcifyURL, verified.DefaultSourcify)
+	if sourcify == "off" {
+		sourcify = ""
+	}
+	contracts, err := verified.New(cfg.ContractsDir, sourcify, explorers, cfg.EtherscanAPIKey)
+	if err != nil {
+		slog.Error("contract verification setup failed", "error", err)
+		os.Exit(1)
+	}
+
+	tokens20, err := erc20.NewStore(cfg.ERC20File)
+	if err != nil {
+		slog.Error("erc20 tokens load failed", "error", err)
+		os.Exit(1)
+	}
+
+	prefs, err := user.NewPrefs(cfg.PreferencesFile)
+	if err != nil {
+		slog.Error("preferences load failed", "error", err)
+		os.Exit(1)
+	}
+
+	synced, err := keysync.NewStore(cfg.KeySyncFile)
+	if err != nil {
+		slog.Error("synced vault load failed", "error", err)
+		os.Exit(1)
+	}
+
+	gateways, err := ipfs.ParseGateways(cfg.IPFSGateways)
+	if err != nil {
+		slog.Error("invalid IPFS_GATEWAYS", "error", err)
+		os.Exit(1)
+	}
+	ipfsCache, err := ipfs.New(cfg.IPFSDir, gateways)
+	if err != nil {
+		slog.Error("ipfs cache setup failed", "error", err)
+		os.Exit(1)
+	}
+
+	nfts, err := nft.New(cfg.NFTDir, ipfsCache)
+	if err != nil {
+		slog.Error("nft index load failed", "error", err)
+		os.Exit(1)
+	}
+
+	safeServices, err := safe.ParseServices(cfg.SafeTxServices)
+	if err != nil {
+		slog.Error("invalid SAFE_TX_SERVICES", "error", err)
+		os.Exit(1)
+	}
+
+	schedules, err := schedule.NewStore(cfg.SchedulesFile)
+	if err != nil {
+		slog.Error("schedules load failed", "error", err)
+		os.Exit(1)
+	}
+
+	bridges, err := bridge.NewStore(cfg.BridgesFile)
+	if err != nil {
+		slog.Error("bridges load failed", "error", err)
+		os.Exit(1)
+	}
+
+	batches, err := batch.NewStore(cfg.BatchesFile)
+	if err != nil {
+		slog.Error("batches load failed", "error", err)
+		os.Exit(1)
+	}
+	disperse, err := evm.ParseAddress(cmp.Or(cfg.DisperseAddress, batch.DefaultDisperse))
+	if err != nil {
+		slog.Error("invalid DISPERSE_ADDRESS", "error", err)
+		os.Exit(1)
+	}
+
+	alerts, err := alert.NewStore(cfg.AlertsFile)
+	if err != nil {
+		slog.Error("alerts load failed", "error", err)
+		os.Exit(1)
+	}
+
+	channels, err := notify.NewStore(cfg.ChannelsFile)
+	if err != nil {
+		slog.Error("channels load failed", "error", err)
+		os.Exit(1)
+	}
+
+	pushes, err := webpush.NewStore(cfg.WebPushFile, cfg.WebPushSubject)
+	if err != nil {
+		slog.Error("web push load failed", "error", err)
+		os.Exit(1)
+	}
+
+	paymasters, err := paymaster.NewStore(cfg.PaymastersFile)
+	if err != nil {
+		slog.Error("paymasters load failed", "error", err)
+		os.Exit(1)
+	}
+
+	ttl, err := time.ParseDuration(cfg.ApprovalTTL)
+	if err != nil {
+		slog.Error("invalid APPROVAL_TTL", "error", err)
+		os.Exit(1)
+	}
+	approvals, err := approval.NewStore(approval.Config{
+		File:          cfg.ApprovalsFile,
+		TTL:           ttl,
+		Required:      cfg.RequireApproval,
+		ApproversFile: cfg.ApproversFile,
+		DualThreshold: cfg.DualThreshold,
+		Webhook:       cfg.ApprovalWebhook,
+
+		ConfirmThreshold: cfg.ConfirmThreshold,
+	})
+	if err != nil {
+		slog.Error("approvals load failed", "error", err)
+		os.Exit(1)
+	}
+	if cfg.RequireApproval {
+		slog.Info("approval required for server signing", "ttl", ttl)
+	}
+	if cfg.DualThreshold != "" {
+		approvers, err := approval.LoadApprovers(cfg.ApproversFile)
+		if err != nil {
+			slog.Error("approvers load failed", "error", err)
+			os.Exit(1)
+		}
+		if len(approvers) < 2 {
+			slog.Warn("dual control needs two approvers; add them with 'wallet approvers add'", "approvers", len(approvers))
+		}
+		slog.Info("dual control enabled", "threshold", cfg.DualThreshold, "approvers", len(approvers))
+	}
+
+	j, err := journal.NewStore(cfg.JournalFile)
+	if err != nil {
+		slog.Error("journal load failed", "error", err)
+		os.Exit(1)
+	}
+
+	v, err := vault.Open(cfg.VaultFile)
+	if err != nil {
+		slog.Error("vault load failed", "error", err)
+		os.Exit(1)
+	}
+	if cfg.VaultPassFile != "" {
+		pass, err := os.ReadFile(cfg.VaultPassFile)
+		if err != nil {
+			slog.Error("vault passphrase read failed", "error", err)
+			os.Exit(1)
+		}
+		if err := v.Unlock(strings.TrimRight(string(pass), "\r\n")); err != nil {
+			slog.Error("vault unlock failed", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("vault unlocked", "keys", len(v.Status().Keys))
+	}
+
+	var f *faucet.Faucet
+	if cfg.FaucetAddress != "" {
+		interval, err := time.ParseDuration(cfg.FaucetInterval)
+		if err != nil {
+			slog.Error("invalid FAUCET_INTERVAL", "error", err)
+			os.Exit(1)
+		}
+		f, err = faucet.New(faucet.Config{
+			Endpoint:         cfg.FaucetEndpoint,
+			Address:          cfg.FaucetAddress,
+			Amount:           cfg.FaucetAmount,
+			Interval:         interval,
+			LowBalance:       cfg.FaucetLowBalance,
+			TurnstileSiteKey: cfg.FaucetSiteKey,
+			TurnstileSecret:  cfg.FaucetSecret,
+			AlertWebhook:     cfg.FaucetWebhook,
+			HistoryFile:      cfg.FaucetHistoryFile,
+		}, store, v, j)
+		if err != nil {
+			slog.Error("faucet setup failed", "error", err)
+			os.Exit(1)
+		}
+		if !v.Has(cfg.FaucetAddress) {
+			slog.Warn("faucet address is not a server vault key; dispensing will fail", "address", cfg.FaucetAddress)
+		}
+		go f.Watch(context.Background())
+		slog.Info("faucet enabled", "endpoint", cfg.FaucetEndpoint, "address", cfg.FaucetAddress, "amount", cfg.FaucetAmount)
+	}
+
+	devnets, err := devnet.ParseURLs(cfg.DevnetURLs)
+	if err != nil {
+		slog.Error("invalid DEVNET_URLS", "error", err)
+		os.Exit(1)
+	}
+
+	var (
+		users    *user.Store
+		sessions *user.Sessions
+		tokens   *user.Tokens
+		devices  *user.Devices
+	)
+	if cfg.MultiUser {
+		sessionTTL, err := time.ParseDuration(cfg.SessionTTL)
+		if err != nil {
+			slog.Error("invalid SESSION_TTL", "error", err)
+			os.Exit(1)
+		}
+		users, err = user.NewStore(cfg.UsersFile, cfg.UsersDir)
+		if err != nil {
+			slog.Error("users load failed", "error", err)
+			os.Exit(1)
+		}
+		list, err := users.List()
+		if err != nil {
+			slog.Error("users load failed", "error", err)
+			os.Exit(1)
+		}
+		admins := 0
+		for _, u := range list {
+			if u.Admin() {
+				admins++
+			}
+		}
+		if admins == 0 {
+			slog.Warn("multi-user mode has no admin; add one with 'wallet users add -admin <name>'")
+		}
+		sessions = user.NewSessions(sessionTTL)
+		if tokens, err = user.NewTokens(cfg.TokensFile); err != nil {
+			slog.Error("tokens load failed", "error", err)
+			os.Exit(1)
+		}
+		if devices, err = user.NewDevices(cfg.DevicesFile); err != nil {
+			slog.Error("devices load failed", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("multi-user mode enabled", "users", len(list), "admins", admins, "tokens", len(tokens.List("")), "devices", len(devices.List("")))
+	}
+
+	return server.New(store, idem, icons, history, benches, limits, headers, proxy, accounts, bookmarks, contacts, labels, scams, scanner, cfg.RiskBlockCritical, abis, contracts, tokens20, prefs, synced, ipfsCache, nfts, schedules, bridges, batches, disperse.Hex(), alerts, channels, pushes, paymasters, safe.NewService(safeServices, cfg.SafeAPIKey), approvals, j, v, f, devnets, users, sessions, tokens, devices, storeFiles(cfg), logs, cfg.ListenAddr)
+}
@@ -5,27 +5,116 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
+	"github.com/primal-host/wallet/internal/asset"
+	"github.com/primal-host/wallet/internal/bench"
 	"github.com/primal-host/wallet/internal/config"
 	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/icon"
+	"github.com/primal-host/wallet/internal/idempotency"
+	"github.com/primal-host/wallet/internal/logtail"
+	"github.com/primal-host/wallet/internal/ratelimit"
 	"github.com/primal-host/wallet/internal/server"
+	"github.com/primal-host/wallet/internal/uptime"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] != "serve" {
+		os.Exit(runCLI(os.Args[1:]))
+	}
+	serve()
+}
+
+// serve runs the HTTP server until SIGINT or SIGTERM.
+func serve() {
+	// Keep recent log records, including debug ones that stderr omits, for
+	// the dashboard's log view.
+	logs := logtail.New(slog.NewTextHandler(os.Stderr, nil), 1000)
+	slog.SetDefault(slog.New(logs))
+
 	slog.Info("wallet starting", "version", config.Version)
 
 	cfg := config.Load()
 
-	store, err := endpoint.NewStore(cfg.EndpointsFile)
+	assets, err := asset.NewRegistry(cfg.AssetsFile)
+	if err != nil {
+		slog.Error("assets load failed", "error", err)
+		os.Exit(1)
+	}
+
+	timeout, err := time.ParseDuration(cfg.RPCTimeout)
+	if err != nil || timeout <= 0 {
+		slog.Error("invalid RPC_TIMEOUT", "value", cfg.RPCTimeout, "error", err)
+		os.Exit(1)
+	}
+	endpoint.SetTimeout(timeout)
+	endpoint.SetRetry(retryPolicy(cfg))
+	endpoint.SetPolling(polling(cfg))
+	if err := endpoint.SetTransport(transport(cfg)); err != nil {
+		slog.Error("invalid RPC_PROXY", "error", err)
+		os.Exit(1)
+	}
+
+	store, err := endpoint.NewStore(cfg.EndpointsFile, assets)
 	if err != nil {
 		slog.Error("endpoints load failed", "error", err)
 		os.Exit(1)
 	}
 	slog.Info("endpoints loaded", "count", len(store.List()))
 
-	srv := server.New(store, cfg.ListenAddr)
+	idem, err := idempotency.NewStore(cfg.IdempotencyFile)
+	if err != nil {
+		slog.Error("idempotency keys load failed", "error", err)
+		os.Exit(1)
+	}
+
+	icons, err := icon.New(cfg.IconsDir, cfg.TokenListURL)
+	if err != nil {
+		slog.Error("icon cache setup failed", "error", err)
+		os.Exit(1)
+	}
+
+	history, err := uptime.NewStore(cfg.UptimeFile)
+	if err != nil {
+		slog.Error("uptime history load failed", "error", err)
+		os.Exit(1)
+	}
+
+	benches, err := bench.NewStore(cfg.BenchFile)
+	if err != nil {
+		slog.Error("benchmark store load failed", "error", err)
+		os.Exit(1)
+	}
+
+	limits := server.Limits{
+		RPC:   limiter("RATE_LIMIT_RPC", cfg.RateLimitRPC),
+		Write: limiter("RATE_LIMIT_WRITE", cfg.RateLimitWrite),
+	}
+
+	sources, err := server.ParseSources(cfg.CSPSources)
+	if err != nil {
+		slog.Error("invalid CSP_EXTRA_SOURCES", "error", err)
+		os.Exit(1)
+	}
+	trusted, err := server.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		slog.Error("invalid TRUSTED_PROXIES", "error", err)
+		os.Exit(1)
+	}
+	headers := server.Headers{Off: !cfg.SecurityHeaders, Sources: sources, TrustedProxies: trusted}
+	proxy := server.Proxy{CrossCheck: cfg.RPCCrossCheck, VerifyProofs: cfg.RPCVerifyProofs}
+	if cfg.RPCHedgeDelay != "" {
+		proxy.HedgeDelay, err = time.ParseDuration(cfg.RPCHedgeDelay)
+		if err != nil || proxy.HedgeDelay <= 0 {
+			slog.Error("invalid RPC_HEDGE_DELAY", "value", cfg.RPCHedgeDelay, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	srv := newServer(cfg, store, idem, icons, history, benches, limits, headers, proxy, logs)
 
 	go func() {
 		if err := srv.Start(); err != nil {
@@ -46,3 +135,84 @@ func main() {
 	}
 	slog.Info("stopped")
 }
+
+// limiter builds the rate limiter configured by the named variable,
+// exiting if its value is invalid.
+func limiter(name, value string) *ratelimit.Limiter {
+	rate, err := ratelimit.ParseRate(value)
+	if err != nil {
+		slog.Error("invalid "+name, "error", err)
+		os.Exit(1)
+	}
+	return ratelimit.New(rate)
+}
+
+// retryPolicy parses the RPC retry settings, exiting on a bad value.
+func retryPolicy(cfg *config.Config) endpoint.Retry {
+	attempts, err := strconv.Atoi(cfg.RPCRetries)
+	if err != nil || attempts < 0 {
+		slog.Error("invalid RPC_RETRIES", "value", cfg.RPCRetries)
+		os.Exit(1)
+	}
+	backoff, err := time.ParseDuration(cfg.RPCRetryBackoff)
+	if err != nil || backoff <= 0 {
+		slog.Error("invalid RPC_RETRY_BACKOFF", "value", cfg.RPCRetryBackoff, "error", err)
+		os.Exit(1)
+	}
+	maxBackoff, err := time.ParseDuration(cfg.RPCRetryMaxBackoff)
+	if err != nil || maxBackoff < backoff {
+		slog.Error("invalid RPC_RETRY_MAX_BACKOFF", "value", cfg.RPCRetryMaxBackoff, "error", err)
+		os.Exit(1)
+	}
+	return endpoint.Retry{Attempts: attempts, Backoff: backoff, MaxBackoff: maxBackoff}
+}
+
+// polling parses the endpoint polling settings, exiting on a bad value.
+func polling(cfg *config.Config) endpoint.Polling {
+	var (
+		p   endpoint.Polling
+		err error
+	)
+	if p.Workers, err = strconv.Atoi(cfg.PollWorkers); err != nil || p.Workers < 1 {
+		slog.Error("invalid POLL_WORKERS", "value", cfg.PollWorkers)
+		os.Exit(1)
+	}
+	if p.Stagger, err = time.ParseDuration(cfg.PollStagger); err != nil || p.Stagger < 0 {
+		slog.Error("invalid POLL_STAGGER", "value", cfg.PollStagger, "error", err)
+		os.Exit(1)
+	}
+	if p.Interval, err = time.ParseDuration(cfg.PollInterval); err != nil || p.Interval <= 0 {
+		slog.Error("invalid POLL_INTERVAL", "value", cfg.PollInterval, "error", err)
+		os.Exit(1)
+	}
+	if p.MaxBackoff, err = time.ParseDuration(cfg.PollMaxBackoff); err != nil || p.MaxBackoff < p.Interval {
+		slog.Error("invalid POLL_MAX_BACKOFF", "value", cfg.PollMaxBackoff, "error", err)
+		os.Exit(1)
+	}
+	if p.Recover, err = strconv.Atoi(cfg.PollRecover); err != nil || p.Recover < 1 {
+		slog.Error("invalid POLL_RECOVER", "value", cfg.PollRecover)
+		os.Exit(1)
+	}
+	return p
+}
+
+// transport parses the settings of the HTTP transport endpoints share,
+// exiting on a bad value.
+func transport(cfg *config.Config) endpoint.Transport {
+	t := endpoint.DefaultTransport
+	t.HTTP2, t.Proxy = cfg.RPCHTTP2, cfg.RPCProxy
+	var err error
+	if t.MaxConnsPerHost, err = strconv.Atoi(cfg.RPCMaxConnsPerHost); err != nil || t.MaxConnsPerHost < 0 {
+		slog.Error("invalid RPC_MAX_CONNS_PER_HOST", "value", cfg.RPCMaxConnsPerHost)
+		os.Exit(1)
+	}
+	if t.MaxIdleConnsPerHost, err = strconv.Atoi(cfg.RPCIdleConnsPerHost); err != nil || t.MaxIdleConnsPerHost < 0 {
+		slog.Error("invalid RPC_IDLE_CONNS_PER_HOST", "value", cfg.RPCIdleConnsPerHost)
+		os.Exit(1)
+	}
+	if t.IdleConnTimeout, err = time.ParseDuration(cfg.RPCIdleTimeout); err != nil || t.IdleConnTimeout <= 0 {
+		slog.Error("invalid RPC_IDLE_TIMEOUT", "value", cfg.RPCIdleTimeout, "error", err)
+		os.Exit(1)
+	}
+	return t
+}
@@ -0,0 +1,435 @@
+// Package endpointtest runs a fake EVM JSON-RPC node for testing code that
+// talks to endpoints. Like net/http/httptest, it listens on a local port
+// and is stopped with Close. It answers the calls the wallet's poller,
+// health checks, and balance lookups make from canned state that tests
+// set, and can be made slow or failing on demand. It imports nothing from
+// the wallet, so programs outside this module can use it too.
+package endpointtest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Error is a JSON-RPC error. A HandlerFunc or Fail given one answers with
+// it as is; any other error is answered with code -32000 and its message.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// Errors nodes commonly answer with. The wallet retries ErrRateLimited and
+// ErrBusy and treats ErrMethodNotFound as the node not serving the method.
+var (
+	ErrMethodNotFound = &Error{Code: -32601, Message: "the method does not exist/is not available"}
+	ErrInvalidParams  = &Error{Code: -32602, Message: "invalid params"}
+	ErrRateLimited    = &Error{Code: -32005, Message: "rate limit exceeded"}
+	ErrBusy           = &Error{Code: -32000, Message: "server busy, try again later"}
+)
+
+// HandlerFunc answers one call with its result, which is marshaled to JSON,
+// or an error.
+type HandlerFunc func(params []json.RawMessage) (any, error)
+
+// Default state of a new server.
+const (
+	DefaultChainID       = 31337
+	DefaultClientVersion = "endpointtest/v1.0.0"
+	DefaultGasPrice      = 1_000_000_000 // 1 gwei
+	blockTime            = 12            // seconds between block timestamps
+)
+
+// genesis is the timestamp of block 0, so block timestamps are the same
+// from run to run.
+var genesis = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+
+// Server is a fake node. Its setters may be called while requests are in
+// flight.
+type Server struct {
+	// URL is the node's JSON-RPC URL, e.g. http://127.0.0.1:41234.
+	URL string
+
+	srv *httptest.Server
+
+	mu       sync.Mutex
+	chainID  uint64
+	block    uint64
+	client   string
+	gasPrice *big.Int
+	balances map[string]*big.Int    // lowercase address -> wei
+	nonces   map[string]uint64      // lowercase address -> transaction count
+	handlers map[string]HandlerFunc // by method, overriding the built-in ones
+	fails    map[string]error       // by method, "" for every method
+	latency  time.Duration
+	failHTTP []int // statuses the next requests fail with, 0 to drop the connection
+	calls    map[string]int
+}
+
+// NewServer starts a fake node at block 1 of chain DefaultChainID, in which
+// every address has a zero balance.
+func NewServer() *Server {
+	s := &Server{
+		chainID:  DefaultChainID,
+		block:    1,
+		client:   DefaultClientVersion,
+		gasPrice: big.NewInt(DefaultGasPrice),
+		balances: map[string]*big.Int{},
+		nonces:   map[string]uint64{},
+		handlers: map[string]HandlerFunc{},
+		fails:    map[string]error{},
+		calls:    map[string]int{},
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close shuts the node down, waiting for requests in flight.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// SetChainID sets the chain ID eth_chainId and net_version report.
+func (s *Server) SetChainID(id uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chainID = id
+}
+
+// SetBlock sets the head block number.
+func (s *Server) SetBlock(n uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.block = n
+}
+
+// Mine moves the head n blocks forward and returns the new head.
+func (s *Server) Mine(n uint64) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.block += n
+	return s.block
+}
+
+// Block returns the head block number.
+func (s *Server) Block() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.block
+}
+
+// SetClientVersion sets what web3_clientVersion reports, e.g.
+// "anvil/v1.2.3" to pass for Anvil.
+func (s *Server) SetClientVersion(v string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.client = v
+}
+
+// SetGasPrice sets what eth_gasPrice reports, in wei.
+func (s *Server) SetGasPrice(wei *big.Int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gasPrice = new(big.Int).Set(wei)
+}
+
+// SetBalance sets an address's balance in wei, at every block.
+func (s *Server) SetBalance(address string, wei *big.Int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.balances[strings.ToLower(address)] = new(big.Int).Set(wei)
+}
+
+// SetNonce sets an address's transaction count.
+func (s *Server) SetNonce(address string, nonce uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nonces[strings.ToLower(address)] = nonce
+}
+
+// Handle answers method with fn instead of the built-in answer, or the
+// method-not-found error for methods the server doesn't know. A nil fn
+// removes the handler.
+func (s *Server) Handle(method string, fn HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if fn == nil {
+		delete(s.handlers, method)
+		return
+	}
+	s.handlers[method] = fn
+}
+
+// SetLatency delays every response by d, as a slow or distant node would.
+// A client that gives up first gets no response.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// Fail answers every call of method with err, or with a nil err answers
+// normally again. An empty method fails every call; a method's own failure
+// takes precedence.
+func (s *Server) Fail(method string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		delete(s.fails, method)
+		return
+	}
+	s.fails[method] = err
+}
+
+// FailNext fails the next n HTTP requests, whatever they call, with the
+// HTTP status, e.g. 429 or 502, or with status 0 by closing the connection
+// without answering. The failures queue up after any set before.
+func (s *Server) FailNext(n int, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for range n {
+		s.failHTTP = append(s.failHTTP, status)
+	}
+}
+
+// Calls returns how many times method was called, counting each call of a
+// batch and calls failed by Fail, but not requests failed by FailNext,
+// which are never read. An empty method counts every call.
+func (s *Server) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if method == "" {
+		total := 0
+		for _, n := range s.calls {
+			total += n
+		}
+		return total
+	}
+	return s.calls[method]
+}
+
+// request is one JSON-RPC call.
+type request struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// response is the answer to one call.
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	latency := s.latency
+	status := -1
+	if len(s.failHTTP) > 0 {
+		status, s.failHTTP = s.failHTTP[0], s.failHTTP[1:]
+	}
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	switch {
+	case status == 0:
+		if hj, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+		panic(http.ErrAbortHandler)
+	case status > 0:
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "1")
+		}
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "JSON-RPC takes POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		writeJSON(w, response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &Error{Code: -32700, Message: "parse error"}})
+		return
+	}
+	if strings.HasPrefix(strings.TrimSpace(string(raw)), "[") {
+		var batch []request
+		if err := json.Unmarshal(raw, &batch); err != nil || len(batch) == 0 {
+			writeJSON(w, response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &Error{Code: -32600, Message: "invalid request"}})
+			return
+		}
+		out := make([]response, len(batch))
+		for i, req := range batch {
+			out[i] = s.answer(req)
+		}
+		writeJSON(w, out)
+		return
+	}
+	var req request
+	if err := json.Unmarshal(raw, &req); err != nil {
+		writeJSON(w, response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &Error{Code: -32600, Message: "invalid request"}})
+		return
+	}
+	writeJSON(w, s.answer(req))
+}
+
+// answer answers one call: with its failure if one is set, its handler if
+// one is set, and otherwise from the server's state.
+func (s *Server) answer(req request) response {
+	resp := response{JSONRPC: "2.0", ID: req.ID}
+	if resp.ID == nil {
+		resp.ID = json.RawMessage("null")
+	}
+	s.mu.Lock()
+	s.calls[req.Method]++
+	err, failed := s.fails[req.Method]
+	if !failed {
+		err, failed = s.fails[""]
+	}
+	fn := s.handlers[req.Method]
+	s.mu.Unlock()
+
+	var result any
+	switch {
+	case failed:
+	case fn != nil:
+		result, err = fn(req.Params)
+	default:
+		result, err = s.builtin(req.Method, req.Params)
+	}
+	if err != nil {
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &Error{Code: -32000, Message: err.Error()}
+		}
+		resp.Error = rpcErr
+		return resp
+	}
+	if result == nil {
+		result = json.RawMessage("null")
+	}
+	resp.Result = result
+	return resp
+}
+
+// builtin answers the calls endpoints are polled and queried with.
+func (s *Server) builtin(method string, params []json.RawMessage) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch method {
+	case "web3_clientVersion":
+		return s.client, nil
+	case "eth_chainId":
+		return quantity(new(big.Int).SetUint64(s.chainID)), nil
+	case "net_version":
+		return strconv.FormatUint(s.chainID, 10), nil
+	case "eth_blockNumber":
+		return quantity(new(big.Int).SetUint64(s.block)), nil
+	case "eth_syncing":
+		return false, nil
+	case "eth_gasPrice":
+		return quantity(s.gasPrice), nil
+	case "eth_maxPriorityFeePerGas":
+		return quantity(big.NewInt(0)), nil
+	case "eth_getBalance", "eth_getTransactionCount", "eth_getCode":
+		var address string
+		if len(params) == 0 || json.Unmarshal(params[0], &address) != nil {
+			return nil, ErrInvalidParams
+		}
+		address = strings.ToLower(address)
+		switch method {
+		case "eth_getBalance":
+			if wei, ok := s.balances[address]; ok {
+				return quantity(wei), nil
+			}
+			return "0x0", nil
+		case "eth_getTransactionCount":
+			return quantity(new(big.Int).SetUint64(s.nonces[address])), nil
+		}
+		return "0x", nil
+	case "eth_getBlockByNumber":
+		var tag string
+		if len(params) == 0 || json.Unmarshal(params[0], &tag) != nil {
+			return nil, ErrInvalidParams
+		}
+		n, ok := s.blockOf(tag)
+		if !ok {
+			return nil, nil
+		}
+		return s.header(n), nil
+	case "eth_getBlockTransactionCountByNumber":
+		return "0x0", nil
+	}
+	return nil, ErrMethodNotFound
+}
+
+// blockOf resolves a block tag or number. Blocks past the head don't exist.
+func (s *Server) blockOf(tag string) (uint64, bool) {
+	switch tag {
+	case "latest", "pending", "safe", "finalized":
+		return s.block, true
+	case "earliest":
+		return 0, true
+	}
+	n, err := strconv.ParseUint(strings.TrimPrefix(tag, "0x"), 16, 64)
+	if err != nil || !strings.HasPrefix(tag, "0x") || n > s.block {
+		return 0, false
+	}
+	return n, true
+}
+
+// header is block n without transactions. Hashes are made up from the
+// number, so they are stable but not real.
+func (s *Server) header(n uint64) map[string]any {
+	hash := func(n uint64) string { return fmt.Sprintf("0x%064x", n+1) }
+	parent := "0x" + strings.Repeat("0", 64)
+	if n > 0 {
+		parent = hash(n - 1)
+	}
+	return map[string]any{
+		"number":        quantity(new(big.Int).SetUint64(n)),
+		"hash":          hash(n),
+		"parentHash":    parent,
+		"timestamp":     quantity(big.NewInt(genesis + int64(n)*blockTime)),
+		"gasLimit":      "0x1c9c380",
+		"gasUsed":       "0x0",
+		"baseFeePerGas": quantity(s.gasPrice),
+		"miner":         "0x0000000000000000000000000000000000000000",
+		"transactions":  []any{},
+	}
+}
+
+func quantity(n *big.Int) string {
+	return "0x" + n.Text(16)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,304 @@
+package endpointtest_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/primal-host/wallet/endpointtest"
+)
+
+// rpcError is a JSON-RPC error as a client sees it.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string { return e.Message }
+
+// call makes one JSON-RPC call to url and returns its result, or the
+// node's error as an *rpcError.
+func call(t *testing.T, url, method string, params ...any) (json.RawMessage, error) {
+	t.Helper()
+	if params == nil {
+		params = []any{}
+	}
+	body, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+	var out struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("%s: decode response: %v", method, err)
+	}
+	if out.Error != nil {
+		return nil, out.Error
+	}
+	return out.Result, nil
+}
+
+// mustCall is call for calls that must succeed, with the result decoded
+// into a string.
+func mustCall(t *testing.T, url, method string, params ...any) string {
+	t.Helper()
+	raw, err := call(t, url, method, params...)
+	if err != nil {
+		t.Fatalf("%s: %v", method, err)
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		t.Fatalf("%s: result %s is not a string", method, raw)
+	}
+	return s
+}
+
+func TestBuiltins(t *testing.T) {
+	srv := endpointtest.NewServer()
+	defer srv.Close()
+
+	if got := mustCall(t, srv.URL, "eth_chainId"); got != "0x7a69" {
+		t.Errorf("eth_chainId = %s, want 0x7a69", got)
+	}
+	if got := mustCall(t, srv.URL, "net_version"); got != "31337" {
+		t.Errorf("net_version = %s, want 31337", got)
+	}
+	if got := mustCall(t, srv.URL, "web3_clientVersion"); got != endpointtest.DefaultClientVersion {
+		t.Errorf("web3_clientVersion = %s, want %s", got, endpointtest.DefaultClientVersion)
+	}
+	if got := mustCall(t, srv.URL, "eth_gasPrice"); got != "0x3b9aca00" {
+		t.Errorf("eth_gasPrice = %s, want 1 gwei", got)
+	}
+
+	srv.SetChainID(10)
+	if got := mustCall(t, srv.URL, "eth_chainId"); got != "0xa" {
+		t.Errorf("eth_chainId after SetChainID(10) = %s, want 0xa", got)
+	}
+}
+
+func TestBlocks(t *testing.T) {
+	srv := endpointtest.NewServer()
+	defer srv.Close()
+
+	if got := mustCall(t, srv.URL, "eth_blockNumber"); got != "0x1" {
+		t.Errorf("eth_blockNumber of a new server = %s, want 0x1", got)
+	}
+	srv.SetBlock(100)
+	if head := srv.Mine(5); head != 105 || srv.Block() != 105 {
+		t.Errorf("Mine(5) from 100 = %d, Block() = %d, want 105", head, srv.Block())
+	}
+	if got := mustCall(t, srv.URL, "eth_blockNumber"); got != "0x69" {
+		t.Errorf("eth_blockNumber = %s, want 0x69", got)
+	}
+
+	raw, err := call(t, srv.URL, "eth_getBlockByNumber", "latest", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var head struct {
+		Number     string `json:"number"`
+		Hash       string `json:"hash"`
+		ParentHash string `json:"parentHash"`
+	}
+	if err := json.Unmarshal(raw, &head); err != nil {
+		t.Fatal(err)
+	}
+	if head.Number != "0x69" {
+		t.Errorf("latest block number = %s, want 0x69", head.Number)
+	}
+	raw, err = call(t, srv.URL, "eth_getBlockByNumber", "0x68", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parent struct {
+		Hash string `json:"hash"`
+	}
+	if err := json.Unmarshal(raw, &parent); err != nil {
+		t.Fatal(err)
+	}
+	if parent.Hash != head.ParentHash {
+		t.Errorf("block 0x68 hash = %s, want the head's parent %s", parent.Hash, head.ParentHash)
+	}
+
+	raw, err = call(t, srv.URL, "eth_getBlockByNumber", "0x6a", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != "null" {
+		t.Errorf("block past the head = %s, want null", raw)
+	}
+}
+
+func TestAccounts(t *testing.T) {
+	srv := endpointtest.NewServer()
+	defer srv.Close()
+	const addr = "0x00000000000000000000000000000000000000Aa"
+
+	if got := mustCall(t, srv.URL, "eth_getBalance", addr, "latest"); got != "0x0" {
+		t.Errorf("balance of an unknown address = %s, want 0x0", got)
+	}
+	srv.SetBalance(addr, big.NewInt(1e18))
+	srv.SetNonce(addr, 7)
+	if got := mustCall(t, srv.URL, "eth_getBalance", strings.ToLower(addr), "latest"); got != "0xde0b6b3a7640000" {
+		t.Errorf("balance = %s, want 1 ether", got)
+	}
+	if got := mustCall(t, srv.URL, "eth_getTransactionCount", addr, "latest"); got != "0x7" {
+		t.Errorf("nonce = %s, want 0x7", got)
+	}
+
+	_, err := call(t, srv.URL, "eth_getBalance")
+	var rpcErr *rpcError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != endpointtest.ErrInvalidParams.Code {
+		t.Errorf("eth_getBalance without params: err = %v, want invalid params", err)
+	}
+}
+
+func TestHandle(t *testing.T) {
+	srv := endpointtest.NewServer()
+	defer srv.Close()
+
+	_, err := call(t, srv.URL, "eth_call")
+	var rpcErr *rpcError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != endpointtest.ErrMethodNotFound.Code {
+		t.Fatalf("unknown method: err = %v, want method not found", err)
+	}
+
+	srv.Handle("eth_call", func(params []json.RawMessage) (any, error) {
+		return "0x2a", nil
+	})
+	srv.Handle("eth_blockNumber", func([]json.RawMessage) (any, error) {
+		return nil, errors.New("head unavailable")
+	})
+	if got := mustCall(t, srv.URL, "eth_call"); got != "0x2a" {
+		t.Errorf("handled eth_call = %s, want 0x2a", got)
+	}
+	_, err = call(t, srv.URL, "eth_blockNumber")
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -32000 || rpcErr.Message != "head unavailable" {
+		t.Errorf("handler error: err = %v, want -32000 head unavailable", err)
+	}
+
+	srv.Handle("eth_blockNumber", nil)
+	if got := mustCall(t, srv.URL, "eth_blockNumber"); got != "0x1" {
+		t.Errorf("eth_blockNumber after removing its handler = %s, want 0x1", got)
+	}
+}
+
+func TestFail(t *testing.T) {
+	srv := endpointtest.NewServer()
+	defer srv.Close()
+
+	srv.Fail("", endpointtest.ErrBusy)
+	srv.Fail("eth_chainId", endpointtest.ErrRateLimited)
+
+	var rpcErr *rpcError
+	if _, err := call(t, srv.URL, "eth_chainId"); !errors.As(err, &rpcErr) || rpcErr.Code != endpointtest.ErrRateLimited.Code {
+		t.Errorf("eth_chainId: err = %v, want its own failure, rate limited", err)
+	}
+	if _, err := call(t, srv.URL, "eth_blockNumber"); !errors.As(err, &rpcErr) || rpcErr.Message != endpointtest.ErrBusy.Message {
+		t.Errorf("eth_blockNumber: err = %v, want the failure of every method, busy", err)
+	}
+
+	srv.Fail("", nil)
+	srv.Fail("eth_chainId", nil)
+	if got := mustCall(t, srv.URL, "eth_chainId"); got != "0x7a69" {
+		t.Errorf("eth_chainId after clearing failures = %s, want 0x7a69", got)
+	}
+	if n := srv.Calls("eth_chainId"); n != 2 {
+		t.Errorf("Calls(eth_chainId) = %d, want 2 counting the failed one", n)
+	}
+}
+
+func TestFailNext(t *testing.T) {
+	srv := endpointtest.NewServer()
+	defer srv.Close()
+
+	srv.FailNext(1, http.StatusTooManyRequests)
+	srv.FailNext(1, 0)
+
+	body := strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId","params":[]}`)
+	resp, err := http.Post(srv.URL, "application/json", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("first request: %s, Retry-After %q; want 429 with Retry-After", resp.Status, resp.Header.Get("Retry-After"))
+	}
+
+	if _, err := call(t, srv.URL, "eth_chainId"); err == nil {
+		t.Error("second request succeeded; want the connection dropped")
+	}
+	if got := mustCall(t, srv.URL, "eth_chainId"); got != "0x7a69" {
+		t.Errorf("third request = %s, want 0x7a69", got)
+	}
+	if n := srv.Calls(""); n != 1 {
+		t.Errorf("Calls() = %d, want 1: failed requests are never read", n)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	srv := endpointtest.NewServer()
+	defer srv.Close()
+
+	body := `[{"jsonrpc":"2.0","id":0,"method":"eth_chainId","params":[]},` +
+		`{"jsonrpc":"2.0","id":1,"method":"eth_nope","params":[]},` +
+		`{"jsonrpc":"2.0","id":2,"method":"eth_blockNumber","params":[]}]`
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out []struct {
+		ID     int       `json:"id"`
+		Result string    `json:"result"`
+		Error  *rpcError `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 3 {
+		t.Fatalf("got %d replies, want 3", len(out))
+	}
+	if out[0].ID != 0 || out[0].Result != "0x7a69" {
+		t.Errorf("reply 0 = %+v, want eth_chainId's", out[0])
+	}
+	if out[1].ID != 1 || out[1].Error == nil || out[1].Error.Code != endpointtest.ErrMethodNotFound.Code {
+		t.Errorf("reply 1 = %+v, want method not found", out[1])
+	}
+	if out[2].ID != 2 || out[2].Result != "0x1" {
+		t.Errorf("reply 2 = %+v, want eth_blockNumber's", out[2])
+	}
+	if n := srv.Calls(""); n != 3 {
+		t.Errorf("Calls() = %d, want each call of the batch counted", n)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	srv := endpointtest.NewServer()
+	defer srv.Close()
+	srv.SetLatency(200 * time.Millisecond)
+
+	client := &http.Client{Timeout: 20 * time.Millisecond}
+	body := strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId","params":[]}`)
+	if resp, err := client.Post(srv.URL, "application/json", body); err == nil {
+		resp.Body.Close()
+		t.Error("a client that gave up first got a response")
+	}
+
+	srv.SetLatency(0)
+	if got := mustCall(t, srv.URL, "eth_chainId"); got != "0x7a69" {
+		t.Errorf("eth_chainId without latency = %s, want 0x7a69", got)
+	}
+}
@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/primal-host/wallet/internal/endpoint"
+)
+
+// RPCError is a JSON-RPC error an endpoint answered with.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// headSlack is how many blocks behind the highest head an endpoint may be
+// and still be picked for its latency.
+const headSlack = 1
+
+// ErrNoEndpoint is returned by CallChain when no online endpoint serves
+// the chain.
+var ErrNoEndpoint = errors.New("no online endpoint for the chain")
+
+// Call makes a JSON-RPC call to the endpoint with the given ID and returns
+// the raw result. Transient failures are retried as Config says, except
+// for calls that send transactions, which could be sent twice.
+func (e *Engine) Call(ctx context.Context, id, method string, params ...any) (json.RawMessage, error) {
+	ep, ok := e.store.Get(id)
+	if !ok {
+		return nil, fmt.Errorf("endpoint %q not found", id)
+	}
+	return call(ctx, ep, method, params)
+}
+
+// CallChain makes a JSON-RPC call to the chain with the given ID, much as
+// the server's chain route does: of the online endpoints of the last poll,
+// those at most a block behind the highest head are tried fastest first,
+// then the rest highest head first, until one answers. An RPC error is an
+// answer, so it is returned rather than tried elsewhere. Unlike the route,
+// calls don't stick to one endpoint. Poll or Run must have run first.
+func (e *Engine) CallChain(ctx context.Context, chainID uint64, method string, params ...any) (json.RawMessage, error) {
+	var candidates []Status
+	var top uint64
+	for _, st := range e.Statuses() {
+		if st.Online && st.ChainID == chainID {
+			candidates = append(candidates, st)
+			top = max(top, st.Block)
+		}
+	}
+	behind := func(st Status) bool { return st.Block+headSlack < top }
+	slices.SortStableFunc(candidates, func(a, b Status) int {
+		if behind(a) != behind(b) {
+			if behind(a) {
+				return 1
+			}
+			return -1
+		}
+		if behind(a) {
+			return cmp.Compare(b.Block, a.Block)
+		}
+		return cmp.Compare(a.Latency, b.Latency)
+	})
+	err := ErrNoEndpoint
+	for _, st := range candidates {
+		ep, ok := e.store.Get(st.ID)
+		if !ok {
+			continue
+		}
+		var result json.RawMessage
+		result, err = call(ctx, ep, method, params)
+		var rpcErr *RPCError
+		if err == nil || errors.As(err, &rpcErr) || ctx.Err() != nil {
+			return result, err
+		}
+	}
+	return nil, err
+}
+
+func call(ctx context.Context, ep endpoint.Endpoint, method string, params []any) (json.RawMessage, error) {
+	if params == nil {
+		params = []any{}
+	}
+	result, err := endpoint.RPCCall(ctx, ep, method, params)
+	var rpcErr *endpoint.RPCError
+	if errors.As(err, &rpcErr) {
+		return nil, &RPCError{Code: rpcErr.Code, Message: rpcErr.Message, Data: rpcErr.Data}
+	}
+	return result, err
+}
@@ -0,0 +1,307 @@
+// Package engine embeds the wallet's endpoint engine in other Go programs,
+// without the HTTP server: the endpoint store kept in endpoints.json, the
+// background poller that follows each endpoint's health and head, and the
+// RPC proxy's calls with retries and failover between the endpoints of a
+// chain.
+//
+// Its types are its own, as the client package's are, so the internal
+// packages behind them can change without breaking programs that use it.
+// The signer and vault stay internal for now; sign elsewhere and send the
+// raw transaction with Call or CallChain.
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/primal-host/wallet/internal/asset"
+	"github.com/primal-host/wallet/internal/endpoint"
+)
+
+// Config sets up an Engine. The timeout, retry, and polling settings are
+// the Engine's own, so engines opened with different ones don't affect
+// each other. Zero values keep the server's defaults.
+type Config struct {
+	// EndpointsFile is the endpoint list, in the server's endpoints.json
+	// format. It is created on the first change if it doesn't exist.
+	EndpointsFile string
+
+	// AssetsFile is the registry of native currencies; empty uses the
+	// built-in assets.
+	AssetsFile string
+
+	// Timeout bounds each request to an endpoint without a timeout of its
+	// own. The default is 10 seconds.
+	Timeout time.Duration
+
+	// RetryAttempts is how many times a call that failed transiently is
+	// retried, with a backoff starting at RetryBackoff; a negative value
+	// turns retrying off.
+	RetryAttempts int
+	RetryBackoff  time.Duration
+
+	// PollInterval is how long an endpoint's status stays fresh, for
+	// endpoints without a poll interval of their own.
+	PollInterval time.Duration
+}
+
+// defaultTimeout and defaultRetry are the server's defaults, which an
+// Engine starts from whatever the program set process-wide.
+const defaultTimeout = 10 * time.Second
+
+var defaultRetry = endpoint.Retry{Attempts: 2, Backoff: 250 * time.Millisecond, MaxBackoff: 5 * time.Second}
+
+// Engine follows a set of endpoints. Its methods may be called
+// concurrently.
+type Engine struct {
+	store *endpoint.Store
+
+	mu       sync.Mutex
+	statuses []endpoint.Status // the last poll's
+}
+
+// Open loads the endpoints and applies cfg's settings. Nothing is polled
+// until Poll or Run is called.
+func Open(cfg Config) (*Engine, error) {
+	if cfg.EndpointsFile == "" {
+		return nil, errors.New("no endpoints file")
+	}
+	assets, err := asset.NewRegistry(cfg.AssetsFile)
+	if err != nil {
+		return nil, err
+	}
+	store, err := endpoint.NewStore(cfg.EndpointsFile, assets)
+	if err != nil {
+		return nil, err
+	}
+	set := endpoint.Settings{Timeout: defaultTimeout}
+	if cfg.Timeout > 0 {
+		set.Timeout = cfg.Timeout
+	}
+	r := defaultRetry
+	if cfg.RetryAttempts != 0 {
+		r.Attempts = max(cfg.RetryAttempts, 0)
+	}
+	if cfg.RetryBackoff > 0 {
+		r.Backoff = cfg.RetryBackoff
+		r.MaxBackoff = max(r.MaxBackoff, cfg.RetryBackoff)
+	}
+	set.Retry = &r
+	p := endpoint.DefaultPolling
+	if cfg.PollInterval > 0 {
+		p.Interval = cfg.PollInterval
+	}
+	set.Polling = &p
+	store.SetSettings(set)
+	return &Engine{store: store}, nil
+}
+
+// Endpoint is an EVM JSON-RPC endpoint. Fields of the server's endpoints
+// that aren't here, such as light client and private relay settings, are
+// kept as they are by UpdateEndpoint.
+type Endpoint struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	URL   string `json:"url"`
+	Asset string `json:"asset"` // native currency's registry ID, e.g. "eth"
+
+	JWTSecret     string `json:"jwt_secret,omitempty"`    // hex; signs each request with a short-lived token
+	Timeout       string `json:"timeout,omitempty"`       // e.g. "30s"; empty uses Config.Timeout
+	Proxy         string `json:"proxy,omitempty"`         // HTTP, SOCKS5, or Tor proxy URL, or "direct"
+	PollInterval  string `json:"poll_interval,omitempty"` // e.g. "1m"; empty uses Config.PollInterval
+	Confirmations int    `json:"confirmations,omitempty"` // blocks deep a sent transaction must be
+}
+
+// Status is an endpoint's health as of its last check.
+type Status struct {
+	ID        string        `json:"id"`
+	Name      string        `json:"name"`
+	Online    bool          `json:"online"`
+	ChainID   uint64        `json:"chain_id,omitempty"`
+	Block     uint64        `json:"block,omitempty"`
+	Latency   time.Duration `json:"latency"`
+	CheckedAt time.Time     `json:"checked_at"`
+
+	// LagBlocks is how far behind the highest endpoint of its chain it is;
+	// Lagging says that is too far, and Forked that it has another block
+	// than most of them at their common height.
+	LagBlocks uint64 `json:"lag_blocks,omitempty"`
+	Lagging   bool   `json:"lagging,omitempty"`
+	Forked    bool   `json:"forked,omitempty"`
+}
+
+// Endpoints returns the endpoints, in the file's order.
+func (e *Engine) Endpoints() []Endpoint {
+	eps := e.store.List()
+	out := make([]Endpoint, len(eps))
+	for i, ep := range eps {
+		out[i] = fromInternal(ep)
+	}
+	return out
+}
+
+// Endpoint returns the endpoint with the given ID.
+func (e *Engine) Endpoint(id string) (Endpoint, bool) {
+	ep, ok := e.store.Get(id)
+	if !ok {
+		return Endpoint{}, false
+	}
+	return fromInternal(ep), true
+}
+
+// AddEndpoint adds an endpoint and saves the file. Its ID is always made
+// up from the name, as the server's are, so ep.ID is ignored; the returned
+// endpoint has the ID it got.
+func (e *Engine) AddEndpoint(ep Endpoint) (Endpoint, error) {
+	added, err := e.store.Add(toInternal(endpoint.Endpoint{}, ep))
+	if err != nil {
+		return Endpoint{}, err
+	}
+	return fromInternal(added), nil
+}
+
+// UpdateEndpoint replaces the endpoint with the given ID and saves the
+// file.
+func (e *Engine) UpdateEndpoint(id string, ep Endpoint) (Endpoint, error) {
+	old, ok := e.store.Get(id)
+	if !ok {
+		return Endpoint{}, fmt.Errorf("endpoint %q not found", id)
+	}
+	updated, err := e.store.Update(id, toInternal(old, ep))
+	if err != nil {
+		return Endpoint{}, err
+	}
+	return fromInternal(updated), nil
+}
+
+// RemoveEndpoint moves the endpoint with the given ID to the recycle bin,
+// as the server does, and saves the file.
+func (e *Engine) RemoveEndpoint(id string) error {
+	return e.store.Delete(id)
+}
+
+// toInternal sets ep's fields on base, keeping the ones Endpoint lacks.
+func toInternal(base endpoint.Endpoint, ep Endpoint) endpoint.Endpoint {
+	base.ID = ep.ID
+	base.Name = ep.Name
+	base.URL = ep.URL
+	base.Asset = ep.Asset
+	base.JWTSecret = ep.JWTSecret
+	base.Timeout = ep.Timeout
+	base.Proxy = ep.Proxy
+	base.PollInterval = ep.PollInterval
+	base.Confirmations = ep.Confirmations
+	return base
+}
+
+func fromInternal(ep endpoint.Endpoint) Endpoint {
+	return Endpoint{
+		ID:            ep.ID,
+		Name:          ep.Name,
+		URL:           ep.URL,
+		Asset:         ep.Asset,
+		JWTSecret:     ep.JWTSecret,
+		Timeout:       ep.Timeout,
+		Proxy:         ep.Proxy,
+		PollInterval:  ep.PollInterval,
+		Confirmations: ep.Confirmations,
+	}
+}
+
+func statusOf(st endpoint.Status) Status {
+	out := Status{
+		ID:        st.ID,
+		Name:      st.Name,
+		Online:    st.Online,
+		ChainID:   hexUint(st.ChainID),
+		Block:     hexUint(st.BlockNumber),
+		Latency:   time.Duration(st.Latency) * time.Millisecond,
+		CheckedAt: st.CheckedAt,
+		LagBlocks: st.LagBlocks,
+	}
+	for _, f := range st.Flags {
+		switch f {
+		case endpoint.FlagLagging:
+			out.Lagging = true
+		case endpoint.FlagForked:
+			out.Forked = true
+		}
+	}
+	return out
+}
+
+// hexUint parses a 0x quantity, or returns 0.
+func hexUint(s string) uint64 {
+	n, _ := strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 64)
+	return n
+}
+
+// pollerTick is how often Run looks for endpoints due a check, as the
+// server's poller does.
+const pollerTick = time.Second
+
+// Poll checks the endpoints due a check and returns every endpoint's
+// status. Each endpoint keeps its own schedule, so calling it more often
+// than the poll interval only asks the endpoints that are due; one that is
+// down is asked less often the longer it stays down.
+func (e *Engine) Poll(ctx context.Context) []Status {
+	sts := e.store.Poll(ctx)
+	e.mu.Lock()
+	e.statuses = sts
+	e.mu.Unlock()
+	return convert(sts)
+}
+
+// Run polls until ctx ends, calling onChange, if not nil, with every
+// status whose health changed since the last poll: whether it is online,
+// its chain, head, lag, or flags. A new latency or check time alone isn't
+// a change.
+func (e *Engine) Run(ctx context.Context, onChange func(Status)) error {
+	t := time.NewTicker(pollerTick)
+	defer t.Stop()
+	last := map[string]Status{}
+	for {
+		for _, st := range e.Poll(ctx) {
+			if prev, ok := last[st.ID]; onChange != nil && (!ok || !prev.sameHealth(st)) {
+				onChange(st)
+			}
+			last[st.ID] = st
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// sameHealth reports whether st and o tell the same about an endpoint's
+// health, whatever their latency and check time.
+func (st Status) sameHealth(o Status) bool {
+	return st.Online == o.Online && st.ChainID == o.ChainID && st.Block == o.Block &&
+		st.LagBlocks == o.LagBlocks && st.Lagging == o.Lagging && st.Forked == o.Forked
+}
+
+// Statuses returns the statuses of the last poll, without asking any
+// endpoint; nil before the first.
+func (e *Engine) Statuses() []Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.statuses == nil {
+		return nil
+	}
+	return convert(e.statuses)
+}
+
+func convert(sts []endpoint.Status) []Status {
+	out := make([]Status, len(sts))
+	for i, st := range sts {
+		out[i] = statusOf(st)
+	}
+	return out
+}
@@ -0,0 +1,170 @@
+package engine_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/primal-host/wallet/endpointtest"
+	"github.com/primal-host/wallet/engine"
+)
+
+// open opens an engine on a new endpoints file in a temporary directory.
+func open(t *testing.T, cfg engine.Config) *engine.Engine {
+	t.Helper()
+	if cfg.EndpointsFile == "" {
+		cfg.EndpointsFile = filepath.Join(t.TempDir(), "endpoints.json")
+	}
+	e, err := engine.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestOpen(t *testing.T) {
+	if _, err := engine.Open(engine.Config{}); err == nil {
+		t.Error("Open without an endpoints file succeeded")
+	}
+
+	srv := endpointtest.NewServer()
+	defer srv.Close()
+
+	// The settings are each engine's own: one that doesn't retry and one
+	// that does, opened in that order, each keep theirs.
+	noRetry := open(t, engine.Config{RetryAttempts: -1})
+	retry := open(t, engine.Config{RetryAttempts: 2, RetryBackoff: time.Millisecond})
+	for _, e := range []*engine.Engine{noRetry, retry} {
+		if len(e.Endpoints()) != 0 {
+			t.Fatalf("a new file has endpoints: %+v", e.Endpoints())
+		}
+		if _, err := e.AddEndpoint(engine.Endpoint{Name: "Node", URL: srv.URL, Asset: "eth"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv.FailNext(1, http.StatusServiceUnavailable)
+	if _, err := noRetry.Call(context.Background(), "node", "eth_chainId"); err == nil {
+		t.Error("engine without retries: call through a 503 succeeded")
+	}
+	srv.FailNext(1, http.StatusServiceUnavailable)
+	result, err := retry.Call(context.Background(), "node", "eth_chainId")
+	if err != nil || string(result) != `"0x7a69"` {
+		t.Errorf("engine with retries: result %s, err %v; want 0x7a69 after a retry", result, err)
+	}
+}
+
+func TestEndpointRoundTrip(t *testing.T) {
+	srv := endpointtest.NewServer()
+	defer srv.Close()
+
+	// The relay has fields only the server knows, which the engine must
+	// keep when it saves the file.
+	path := filepath.Join(t.TempDir(), "endpoints.json")
+	stored := []map[string]any{{
+		"id": "relay", "name": "Relay", "url": srv.URL, "asset": "eth",
+		"private": true, "status_url": "https://relay.example/tx/",
+	}}
+	data, _ := json.Marshal(stored)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := open(t, engine.Config{EndpointsFile: path})
+
+	added, err := e.AddEndpoint(engine.Endpoint{ID: "ignored", Name: "Node A", URL: srv.URL, Asset: "eth"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added.ID != "node-a" {
+		t.Errorf("added endpoint ID = %q, want node-a from its name", added.ID)
+	}
+
+	relay, ok := e.Endpoint("relay")
+	if !ok {
+		t.Fatal("relay not found")
+	}
+	relay.Name = "Relay 2"
+	relay.Confirmations = 3
+	updated, err := e.UpdateEndpoint("relay", relay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Name != "Relay 2" || updated.Confirmations != 3 {
+		t.Errorf("updated endpoint = %+v, want the new name and confirmations", updated)
+	}
+
+	if err := e.RemoveEndpoint(added.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := e.Endpoint(added.ID); ok {
+		t.Error("removed endpoint is still listed")
+	}
+	if n := len(e.Endpoints()); n != 1 {
+		t.Errorf("%d endpoints after removing one of two, want 1", n)
+	}
+
+	data, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved []map[string]any
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	for _, ep := range saved {
+		if ep["id"] != "relay" {
+			continue
+		}
+		if ep["name"] != "Relay 2" || ep["private"] != true || ep["status_url"] != "https://relay.example/tx/" {
+			t.Errorf("saved relay = %v, want the new name with private and status_url kept", ep)
+		}
+		return
+	}
+	t.Errorf("relay missing from the saved file: %s", data)
+}
+
+func TestRunOnChange(t *testing.T) {
+	srv := endpointtest.NewServer()
+	defer srv.Close()
+	srv.SetBlock(100)
+
+	e := open(t, engine.Config{PollInterval: 10 * time.Millisecond})
+	if _, err := e.AddEndpoint(engine.Endpoint{Name: "Node", URL: srv.URL, Asset: "eth"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan engine.Status, 16)
+	done := make(chan error, 1)
+	go func() { done <- e.Run(ctx, func(st engine.Status) { changes <- st }) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != context.Canceled {
+			t.Errorf("Run returned %v, want context.Canceled", err)
+		}
+	}()
+
+	next := func(within time.Duration) (engine.Status, bool) {
+		select {
+		case st := <-changes:
+			return st, true
+		case <-time.After(within):
+			return engine.Status{}, false
+		}
+	}
+	if st, ok := next(3 * time.Second); !ok || !st.Online || st.Block != 100 {
+		t.Fatalf("first change = %+v (%v), want online at block 100", st, ok)
+	}
+	// Later polls see the same health, only a new latency and check time.
+	if st, ok := next(1500 * time.Millisecond); ok {
+		t.Errorf("change %+v without a new head", st)
+	}
+	srv.SetBlock(101)
+	if st, ok := next(3 * time.Second); !ok || st.Block != 101 {
+		t.Errorf("change after a new block = %+v (%v), want block 101", st, ok)
+	}
+}
@@ -2,7 +2,12 @@ module github.com/primal-host/wallet
 
 go 1.25.7
 
-require github.com/labstack/echo/v4 v4.15.0
+require (
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.4.1
+	github.com/labstack/echo/v4 v4.15.0
+	golang.org/x/crypto v0.46.0
+	golang.org/x/net v0.48.0
+)
 
 require (
 	github.com/labstack/gommon v0.4.2 // indirect
@@ -10,8 +15,6 @@ require (
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
 	github.com/valyala/fasttemplate v1.2.2 // indirect
-	golang.org/x/crypto v0.46.0 // indirect
-	golang.org/x/net v0.48.0 // indirect
 	golang.org/x/sys v0.39.0 // indirect
 	golang.org/x/text v0.32.0 // indirect
 	golang.org/x/time v0.14.0 // indirect
@@ -0,0 +1,632 @@
+// Package abi encodes and decodes contract calldata from Solidity JSON ABIs,
+// and keeps the registry of ABIs the wallet knows about.
+package abi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// Param is a function input or output.
+type Param struct {
+	Name       string  `json:"name"`
+	Type       string  `json:"type"`
+	Components []Param `json:"components,omitempty"` // fields of a tuple
+	Indexed    bool    `json:"indexed,omitempty"`    // event parameters only
+}
+
+// Function is a contract function from a JSON ABI. Custom errors and events
+// have the same shape.
+type Function struct {
+	Name            string  `json:"name"`
+	Inputs          []Param `json:"inputs"`
+	Outputs         []Param `json:"outputs,omitempty"`
+	StateMutability string  `json:"stateMutability,omitempty"`
+}
+
+// Parse returns the functions of a JSON ABI. It accepts the ABI array itself
+// or a compiler artifact with an "abi" field, as Hardhat and Foundry write.
+func Parse(data []byte) ([]Function, error) {
+	return parse(data, "function")
+}
+
+// ParseErrors returns the custom errors of a JSON ABI, which revert data
+// is decoded against.
+func ParseErrors(data []byte) ([]Function, error) {
+	return parse(data, "error")
+}
+
+// ParseEvents returns the events of a JSON ABI, which logs are decoded
+// against.
+func ParseEvents(data []byte) ([]Function, error) {
+	return parse(data, "event")
+}
+
+// parse returns the entries of kind in a JSON ABI. An entry without a type
+// is a function.
+func parse(data []byte, kind string) ([]Function, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		var artifact struct {
+			ABI json.RawMessage `json:"abi"`
+		}
+		if err := json.Unmarshal(data, &artifact); err != nil || artifact.ABI == nil {
+			return nil, fmt.Errorf("ABI must be a JSON array or an artifact with an \"abi\" field")
+		}
+		data = artifact.ABI
+	}
+	var entries []struct {
+		Type string `json:"type"`
+		Function
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parse ABI: %w", err)
+	}
+	var out []Function
+	for _, e := range entries {
+		if e.Type == "" {
+			e.Type = "function"
+		}
+		if e.Type != kind {
+			continue
+		}
+		if e.Name == "" {
+			return nil, fmt.Errorf("%s without a name", kind)
+		}
+		if _, err := paramTypes(e.Inputs); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", kind, e.Name, err)
+		}
+		out = append(out, e.Function)
+	}
+	return out, nil
+}
+
+// Signature is the canonical signature the selector is hashed from, e.g.
+// "transfer(address,uint256)".
+func (f Function) Signature() string {
+	types, err := paramTypes(f.Inputs)
+	if err != nil {
+		return f.Name + "(?)"
+	}
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = t.String()
+	}
+	return f.Name + "(" + strings.Join(names, ",") + ")"
+}
+
+// Selector is the first four bytes of the Keccak-256 of the signature.
+func (f Function) Selector() []byte {
+	return evm.Keccak256([]byte(f.Signature()))[:4]
+}
+
+// Lookup finds a function by name, signature, or 0x selector. A name shared
+// by overloads is ambiguous, so the signature is needed then.
+func Lookup(funcs []Function, ref string) (Function, error) {
+	ref = strings.ReplaceAll(strings.TrimSpace(ref), " ", "")
+	var byName []Function
+	for _, f := range funcs {
+		if f.Signature() == ref || evm.EncodeHex(f.Selector()) == strings.ToLower(ref) {
+			return f, nil
+		}
+		if f.Name == ref {
+			byName = append(byName, f)
+		}
+	}
+	switch len(byName) {
+	case 0:
+		return Function{}, fmt.Errorf("function %q not found", ref)
+	case 1:
+		return byName[0], nil
+	}
+	return Function{}, fmt.Errorf("%s is overloaded; give its signature, e.g. %s", ref, byName[0].Signature())
+}
+
+// Encode returns the calldata for a call to f: the selector, then the
+// arguments. Scalars are strings (numbers in decimal or 0x hex, addresses,
+// 0x hex bytes), booleans, or JSON numbers; arrays and tuples are slices.
+func Encode(f Function, args []any) ([]byte, error) {
+	types, err := paramTypes(f.Inputs)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != len(types) {
+		return nil, fmt.Errorf("%s takes %d arguments, got %d", f.Signature(), len(types), len(args))
+	}
+	for i, t := range types {
+		if _, err := t.encode(args[i]); err != nil {
+			return nil, fmt.Errorf("%s: %w", argName(f.Inputs, i), err)
+		}
+	}
+	body, err := encodeSeq(types, args)
+	if err != nil {
+		return nil, err
+	}
+	return append(f.Selector(), body...), nil
+}
+
+// Decode returns the arguments of calldata for f, in the form Encode takes,
+// so they can be encoded again.
+func Decode(f Function, data []byte) ([]any, error) {
+	if len(data) < 4 || !bytes.Equal(data[:4], f.Selector()) {
+		return nil, fmt.Errorf("calldata is not a call to %s", f.Signature())
+	}
+	types, err := paramTypes(f.Inputs)
+	if err != nil {
+		return nil, err
+	}
+	return decodeSeq(types, data[4:])
+}
+
+func argName(params []Param, i int) string {
+	if params[i].Name != "" {
+		return params[i].Name
+	}
+	return fmt.Sprintf("argument %d", i+1)
+}
+
+type kind int
+
+const (
+	kindUint kind = iota
+	kindInt
+	kindAddress
+	kindBool
+	kindFixedBytes
+	kindBytes
+	kindString
+	kindSlice // T[]
+	kindArray // T[k]
+	kindTuple
+)
+
+// typ is a parsed ABI type.
+type typ struct {
+	kind   kind
+	size   int    // bits for ints, bytes for bytesN, length for T[k]
+	elem   *typ   // element of a slice or array
+	fields []*typ // fields of a tuple
+	names  []string
+}
+
+func paramTypes(params []Param) ([]*typ, error) {
+	out := make([]*typ, len(params))
+	for i, p := range params {
+		t, err := newType(p.Type, p.Components)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = t
+	}
+	return out, nil
+}
+
+func newType(s string, components []Param) (*typ, error) {
+	if strings.HasSuffix(s, "]") {
+		open := strings.LastIndex(s, "[")
+		if open < 0 {
+			return nil, fmt.Errorf("invalid type %q", s)
+		}
+		elem, err := newType(s[:open], components)
+		if err != nil {
+			return nil, err
+		}
+		n := s[open+1 : len(s)-1]
+		if n == "" {
+			return &typ{kind: kindSlice, elem: elem}, nil
+		}
+		k, err := strconv.Atoi(n)
+		if err != nil || k <= 0 {
+			return nil, fmt.Errorf("invalid array length in %q", s)
+		}
+		return &typ{kind: kindArray, size: k, elem: elem}, nil
+	}
+	switch s {
+	case "address":
+		return &typ{kind: kindAddress}, nil
+	case "bool":
+		return &typ{kind: kindBool}, nil
+	case "bytes":
+		return &typ{kind: kindBytes}, nil
+	case "string":
+		return &typ{kind: kindString}, nil
+	case "uint", "int":
+		s += "256"
+	case "tuple":
+		t := &typ{kind: kindTuple}
+		for _, c := range components {
+			f, err := newType(c.Type, c.Components)
+			if err != nil {
+				return nil, err
+			}
+			t.fields = append(t.fields, f)
+			t.names = append(t.names, c.Name)
+		}
+		return t, nil
+	}
+	for _, p := range []struct {
+		prefix   string
+		kind     kind
+		min, max int
+		step     int
+	}{
+		{"uint", kindUint, 8, 256, 8},
+		{"int", kindInt, 8, 256, 8},
+		{"bytes", kindFixedBytes, 1, 32, 1},
+	} {
+		if !strings.HasPrefix(s, p.prefix) {
+			continue
+		}
+		n, err := strconv.Atoi(s[len(p.prefix):])
+		if err != nil || n < p.min || n > p.max || n%p.step != 0 {
+			break
+		}
+		return &typ{kind: p.kind, size: n}, nil
+	}
+	return nil, fmt.Errorf("unsupported type %q", s)
+}
+
+func (t *typ) String() string {
+	switch t.kind {
+	case kindUint:
+		return "uint" + strconv.Itoa(t.size)
+	case kindInt:
+		return "int" + strconv.Itoa(t.size)
+	case kindAddress:
+		return "address"
+	case kindBool:
+		return "bool"
+	case kindFixedBytes:
+		return "bytes" + strconv.Itoa(t.size)
+	case kindBytes:
+		return "bytes"
+	case kindString:
+		return "string"
+	case kindSlice:
+		return t.elem.String() + "[]"
+	case kindArray:
+		return t.elem.String() + "[" + strconv.Itoa(t.size) + "]"
+	}
+	names := make([]string, len(t.fields))
+	for i, f := range t.fields {
+		names[i] = f.String()
+	}
+	return "(" + strings.Join(names, ",") + ")"
+}
+
+// dynamic reports whether values of t are encoded in the tail, behind an
+// offset.
+func (t *typ) dynamic() bool {
+	switch t.kind {
+	case kindBytes, kindString, kindSlice:
+		return true
+	case kindArray:
+		return t.elem.dynamic()
+	case kindTuple:
+		for _, f := range t.fields {
+			if f.dynamic() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// headSize is how many bytes t takes in the head of a sequence.
+func (t *typ) headSize() int {
+	if t.dynamic() {
+		return 32
+	}
+	switch t.kind {
+	case kindArray:
+		return t.size * t.elem.headSize()
+	case kindTuple:
+		n := 0
+		for _, f := range t.fields {
+			n += f.headSize()
+		}
+		return n
+	}
+	return 32
+}
+
+func (t *typ) encode(v any) ([]byte, error) {
+	switch t.kind {
+	case kindUint, kindInt:
+		n, err := toInt(v)
+		if err != nil {
+			return nil, err
+		}
+		bits := uint(t.size)
+		if t.kind == kindUint {
+			if n.Sign() < 0 || n.BitLen() > int(bits) {
+				return nil, fmt.Errorf("%s is out of range for %s", n, t)
+			}
+			return word(n), nil
+		}
+		limit := new(big.Int).Lsh(big.NewInt(1), bits-1)
+		if n.Cmp(limit) >= 0 || n.Cmp(new(big.Int).Neg(limit)) < 0 {
+			return nil, fmt.Errorf("%s is out of range for %s", n, t)
+		}
+		if n.Sign() < 0 {
+			n = new(big.Int).Add(n, new(big.Int).Lsh(big.NewInt(1), 256))
+		}
+		return word(n), nil
+	case kindAddress:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("address must be a string")
+		}
+		a, err := evm.ParseAddress(strings.TrimSpace(s))
+		if err != nil {
+			return nil, err
+		}
+		return append(make([]byte, 12), a[:]...), nil
+	case kindBool:
+		b, ok := v.(bool)
+		if s, isStr := v.(string); isStr {
+			b, ok = s == "true", s == "true" || s == "false"
+		}
+		if !ok {
+			return nil, fmt.Errorf("bool must be true or false")
+		}
+		out := make([]byte, 32)
+		if b {
+			out[31] = 1
+		}
+		return out, nil
+	case kindFixedBytes:
+		b, err := toBytes(v)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) != t.size {
+			return nil, fmt.Errorf("%s needs %d bytes, got %d", t, t.size, len(b))
+		}
+		return padRight(b), nil
+	case kindBytes, kindString:
+		var b []byte
+		if t.kind == kindString {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("string must be a string")
+			}
+			b = []byte(s)
+		} else {
+			var err error
+			if b, err = toBytes(v); err != nil {
+				return nil, err
+			}
+		}
+		return append(word(big.NewInt(int64(len(b)))), padRight(b)...), nil
+	case kindSlice, kindArray:
+		items, ok := v.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%s must be an array", t)
+		}
+		if t.kind == kindArray && len(items) != t.size {
+			return nil, fmt.Errorf("%s needs %d items, got %d", t, t.size, len(items))
+		}
+		types := make([]*typ, len(items))
+		for i := range items {
+			types[i] = t.elem
+		}
+		body, err := encodeSeq(types, items)
+		if err != nil {
+			return nil, err
+		}
+		if t.kind == kindSlice {
+			body = append(word(big.NewInt(int64(len(items)))), body...)
+		}
+		return body, nil
+	}
+	items, ok := v.([]any)
+	if m, isMap := v.(map[string]any); isMap {
+		items, ok = make([]any, len(t.fields)), true
+		for i, name := range t.names {
+			field, present := m[name]
+			if !present {
+				return nil, fmt.Errorf("tuple is missing field %q", name)
+			}
+			items[i] = field
+		}
+	}
+	if !ok || len(items) != len(t.fields) {
+		return nil, fmt.Errorf("%s needs %d fields", t, len(t.fields))
+	}
+	return encodeSeq(t.fields, items)
+}
+
+// encodeSeq encodes values as a sequence: static values inline in the head,
+// dynamic ones in the tail behind an offset.
+func encodeSeq(types []*typ, vals []any) ([]byte, error) {
+	headLen := 0
+	for _, t := range types {
+		headLen += t.headSize()
+	}
+	var head, tail []byte
+	for i, t := range types {
+		enc, err := t.encode(vals[i])
+		if err != nil {
+			return nil, err
+		}
+		if t.dynamic() {
+			head = append(head, word(big.NewInt(int64(headLen+len(tail))))...)
+			tail = append(tail, enc...)
+		} else {
+			head = append(head, enc...)
+		}
+	}
+	return append(head, tail...), nil
+}
+
+func decodeSeq(types []*typ, data []byte) ([]any, error) {
+	out := make([]any, len(types))
+	pos := 0
+	for i, t := range types {
+		if pos+t.headSize() > len(data) {
+			return nil, fmt.Errorf("calldata too short")
+		}
+		at := data[pos:]
+		if t.dynamic() {
+			off, err := readLength(data[pos:], len(data))
+			if err != nil {
+				return nil, err
+			}
+			at = data[off:]
+		}
+		v, err := t.decode(at)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+		pos += t.headSize()
+	}
+	return out, nil
+}
+
+func (t *typ) decode(data []byte) (any, error) {
+	if len(data) < 32 && t.kind != kindArray && t.kind != kindTuple {
+		return nil, fmt.Errorf("calldata too short")
+	}
+	switch t.kind {
+	case kindUint:
+		n := new(big.Int).SetBytes(data[:32])
+		if n.BitLen() > t.size {
+			return nil, fmt.Errorf("%s value out of range", t)
+		}
+		return n.String(), nil
+	case kindInt:
+		n := new(big.Int).SetBytes(data[:32])
+		if data[0]&0x80 != 0 {
+			n.Sub(n, new(big.Int).Lsh(big.NewInt(1), 256))
+		}
+		limit := new(big.Int).Lsh(big.NewInt(1), uint(t.size-1))
+		if n.Cmp(limit) >= 0 || n.Cmp(new(big.Int).Neg(limit)) < 0 {
+			return nil, fmt.Errorf("%s value out of range", t)
+		}
+		return n.String(), nil
+	case kindAddress:
+		if !allZero(data[:12]) {
+			return nil, fmt.Errorf("address has dirty high bytes")
+		}
+		var a evm.Address
+		copy(a[:], data[12:32])
+		return a.Hex(), nil
+	case kindBool:
+		if !allZero(data[:31]) || data[31] > 1 {
+			return nil, fmt.Errorf("bool is neither 0 nor 1")
+		}
+		return data[31] == 1, nil
+	case kindFixedBytes:
+		if !allZero(data[t.size:32]) {
+			return nil, fmt.Errorf("%s has dirty padding", t)
+		}
+		return evm.EncodeHex(data[:t.size]), nil
+	case kindBytes, kindString:
+		n, err := readLength(data, len(data)-32)
+		if err != nil {
+			return nil, err
+		}
+		b := data[32 : 32+n]
+		if t.kind == kindBytes {
+			return evm.EncodeHex(b), nil
+		}
+		if !utf8.Valid(b) {
+			return nil, fmt.Errorf("string is not valid UTF-8")
+		}
+		return string(b), nil
+	case kindSlice, kindArray:
+		n := t.size
+		if t.kind == kindSlice {
+			var err error
+			// Each item takes at least a word, which bounds n before allocating.
+			if n, err = readLength(data, (len(data)-32)/32); err != nil {
+				return nil, err
+			}
+			data = data[32:]
+		}
+		types := make([]*typ, n)
+		for i := range types {
+			types[i] = t.elem
+		}
+		return decodeSeq(types, data)
+	}
+	return decodeSeq(t.fields, data)
+}
+
+// readLength reads an offset or length word and checks it against max.
+func readLength(data []byte, max int) (int, error) {
+	n := new(big.Int).SetBytes(data[:32])
+	if !n.IsInt64() || n.Int64() > int64(max) {
+		return 0, fmt.Errorf("offset or length out of range")
+	}
+	return int(n.Int64()), nil
+}
+
+func toInt(v any) (*big.Int, error) {
+	switch v := v.(type) {
+	case string:
+		s := strings.TrimSpace(v)
+		neg := strings.HasPrefix(s, "-")
+		s = strings.TrimPrefix(s, "-")
+		n, ok := new(big.Int), false
+		if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+			n, ok = n.SetString(s[2:], 16)
+		} else {
+			n, ok = n.SetString(s, 10)
+		}
+		if !ok || s == "" {
+			return nil, fmt.Errorf("invalid integer %q", v)
+		}
+		if neg {
+			n.Neg(n)
+		}
+		return n, nil
+	case json.Number:
+		return toInt(v.String())
+	case float64:
+		if v != math.Trunc(v) || math.Abs(v) > 1<<53 {
+			return nil, fmt.Errorf("pass %v as a string to keep its precision", v)
+		}
+		return big.NewInt(int64(v)), nil
+	}
+	return nil, fmt.Errorf("integer must be a string or number")
+}
+
+func toBytes(v any) ([]byte, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("bytes must be a 0x hex string")
+	}
+	return evm.DecodeHex(strings.TrimSpace(s))
+}
+
+// word left-pads a non-negative integer to 32 bytes.
+func word(n *big.Int) []byte {
+	return n.FillBytes(make([]byte, 32))
+}
+
+// padRight pads b with zeros to a multiple of 32 bytes.
+func padRight(b []byte) []byte {
+	out := make([]byte, (len(b)+31)/32*32)
+	copy(out, b)
+	return out
+}
+
+func allZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,142 @@
+package abi
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// common are the events decoded without a registered ABI: token transfers
+// and approvals, WETH wrapping, Uniswap V2 and V3 swaps, and ownership
+// changes. ERC-20 and ERC-721 Transfer and Approval share a topic and are
+// told apart by how many parameters are indexed.
+const common = `[
+  {"type":"event","name":"Transfer","inputs":[{"name":"from","type":"address","indexed":true},{"name":"to","type":"address","indexed":true},{"name":"value","type":"uint256"}]},
+  {"type":"event","name":"Transfer","inputs":[{"name":"from","type":"address","indexed":true},{"name":"to","type":"address","indexed":true},{"name":"tokenId","type":"uint256","indexed":true}]},
+  {"type":"event","name":"Approval","inputs":[{"name":"owner","type":"address","indexed":true},{"name":"spender","type":"address","indexed":true},{"name":"value","type":"uint256"}]},
+  {"type":"event","name":"Approval","inputs":[{"name":"owner","type":"address","indexed":true},{"name":"approved","type":"address","indexed":true},{"name":"tokenId","type":"uint256","indexed":true}]},
+  {"type":"event","name":"ApprovalForAll","inputs":[{"name":"owner","type":"address","indexed":true},{"name":"operator","type":"address","indexed":true},{"name":"approved","type":"bool"}]},
+  {"type":"event","name":"TransferSingle","inputs":[{"name":"operator","type":"address","indexed":true},{"name":"from","type":"address","indexed":true},{"name":"to","type":"address","indexed":true},{"name":"id","type":"uint256"},{"name":"value","type":"uint256"}]},
+  {"type":"event","name":"TransferBatch","inputs":[{"name":"operator","type":"address","indexed":true},{"name":"from","type":"address","indexed":true},{"name":"to","type":"address","indexed":true},{"name":"ids","type":"uint256[]"},{"name":"values","type":"uint256[]"}]},
+  {"type":"event","name":"Deposit","inputs":[{"name":"dst","type":"address","indexed":true},{"name":"wad","type":"uint256"}]},
+  {"type":"event","name":"Withdrawal","inputs":[{"name":"src","type":"address","indexed":true},{"name":"wad","type":"uint256"}]},
+  {"type":"event","name":"Swap","inputs":[{"name":"sender","type":"address","indexed":true},{"name":"amount0In","type":"uint256"},{"name":"amount1In","type":"uint256"},{"name":"amount0Out","type":"uint256"},{"name":"amount1Out","type":"uint256"},{"name":"to","type":"address","indexed":true}]},
+  {"type":"event","name":"Swap","inputs":[{"name":"sender","type":"address","indexed":true},{"name":"recipient","type":"address","indexed":true},{"name":"amount0","type":"int256"},{"name":"amount1","type":"int256"},{"name":"sqrtPriceX96","type":"uint160"},{"name":"liquidity","type":"uint128"},{"name":"tick","type":"int24"}]},
+  {"type":"event","name":"OwnershipTransferred","inputs":[{"name":"previousOwner","type":"address","indexed":true},{"name":"newOwner","type":"address","indexed":true}]}
+]`
+
+// CommonEvents returns the events decoded without a registered ABI.
+func CommonEvents() []Function {
+	events, err := ParseEvents([]byte(common))
+	if err != nil {
+		panic(err)
+	}
+	return events
+}
+
+// Log is an event log from a transaction receipt, as JSON-RPC returns it.
+type Log struct {
+	Address string   `json:"address"`
+	Topics  []string `json:"topics"`
+	Data    string   `json:"data"`
+}
+
+// Event is a decoded event log.
+type Event struct {
+	Address   string `json:"address"` // the contract that emitted it
+	Name      string `json:"name"`
+	Signature string `json:"signature"`
+	Args      []Arg  `json:"args"`
+}
+
+// Arg is a decoded event parameter. Indexed strings, bytes, arrays, and
+// tuples are logged only as their Keccak-256 hash, which Value holds then.
+type Arg struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Value   any    `json:"value"`
+	Indexed bool   `json:"indexed,omitempty"`
+}
+
+// Topic is the first topic of an event's logs: the Keccak-256 of its
+// signature.
+func Topic(event Function) string {
+	return evm.EncodeHex(evm.Keccak256([]byte(event.Signature())))
+}
+
+// DecodeLog decodes l against the first of events whose topic and indexed
+// parameters match it.
+func DecodeLog(l Log, events []Function) (Event, bool) {
+	if len(l.Topics) == 0 {
+		return Event{}, false
+	}
+	for _, ev := range events {
+		if !strings.EqualFold(Topic(ev), l.Topics[0]) {
+			continue
+		}
+		if e, err := decodeLog(l, ev); err == nil {
+			return e, true
+		}
+	}
+	return Event{}, false
+}
+
+func decodeLog(l Log, ev Function) (Event, error) {
+	types, err := paramTypes(ev.Inputs)
+	if err != nil {
+		return Event{}, err
+	}
+	var dataTypes []*typ
+	indexed := 0
+	for i, p := range ev.Inputs {
+		if p.Indexed {
+			indexed++
+		} else {
+			dataTypes = append(dataTypes, types[i])
+		}
+	}
+	if indexed != len(l.Topics)-1 {
+		return Event{}, fmt.Errorf("%s has %d indexed parameters, the log %d", ev.Signature(), indexed, len(l.Topics)-1)
+	}
+	data, err := evm.DecodeHex(l.Data)
+	if err != nil {
+		return Event{}, err
+	}
+	values, err := decodeSeq(dataTypes, data)
+	if err != nil {
+		return Event{}, err
+	}
+	e := Event{Address: l.Address, Name: ev.Name, Signature: ev.Signature(), Args: make([]Arg, len(ev.Inputs))}
+	topic := 1
+	for i, p := range ev.Inputs {
+		e.Args[i] = Arg{Name: argName(ev.Inputs, i), Type: types[i].String(), Indexed: p.Indexed}
+		if !p.Indexed {
+			e.Args[i].Value, values = values[0], values[1:]
+			continue
+		}
+		word, err := evm.DecodeHex(l.Topics[topic])
+		topic++
+		if err != nil || len(word) != 32 {
+			return Event{}, fmt.Errorf("malformed topic")
+		}
+		if hashed(types[i]) {
+			e.Args[i].Value = evm.EncodeHex(word)
+			continue
+		}
+		if e.Args[i].Value, err = types[i].decode(word); err != nil {
+			return Event{}, err
+		}
+	}
+	return e, nil
+}
+
+// hashed reports whether an indexed parameter of type t is logged as its
+// hash rather than its value.
+func hashed(t *typ) bool {
+	switch t.kind {
+	case kindBytes, kindString, kindSlice, kindArray, kindTuple:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,283 @@
+package abi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// Contract is a registered ABI.
+type Contract struct {
+	ID   string          `json:"id"`   // lowercased name, e.g. "erc20"
+	Name string          `json:"name"` // e.g. "ERC20"
+	ABI  json.RawMessage `json:"abi"`  // the JSON ABI array
+}
+
+// Functions returns the contract's functions.
+func (c Contract) Functions() []Function {
+	funcs, _ := Parse(c.ABI) // validated when registered
+	return funcs
+}
+
+// Errors returns the contract's custom errors.
+func (c Contract) Errors() []Function {
+	errs, _ := ParseErrors(c.ABI) // validated when registered
+	return errs
+}
+
+// Events returns the contract's events.
+func (c Contract) Events() []Function {
+	events, _ := ParseEvents(c.ABI) // validated when registered
+	return events
+}
+
+// Method is a function as the API lists it, with its signature and selector.
+type Method struct {
+	Function
+	Signature string `json:"signature"`
+	Selector  string `json:"selector"`
+}
+
+// Summary is a registered ABI as the API lists it.
+type Summary struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Functions []Method `json:"functions"`
+}
+
+// Summary lists the contract's functions with their signatures and
+// selectors.
+func (c Contract) Summary() Summary {
+	sum := Summary{ID: c.ID, Name: c.Name, Functions: []Method{}}
+	for _, f := range c.Functions() {
+		sum.Functions = append(sum.Functions, Method{Function: f, Signature: f.Signature(), Selector: evm.EncodeHex(f.Selector())})
+	}
+	return sum
+}
+
+// Call is a decoded contract call.
+type Call struct {
+	ABI      string  `json:"abi"`
+	Function string  `json:"function"` // canonical signature
+	Selector string  `json:"selector"`
+	Data     string  `json:"data"`
+	Args     []any   `json:"args"`
+	Verified bool    `json:"verified"` // decoding and re-encoding gave the same bytes
+	Inputs   []Param `json:"inputs"`
+}
+
+// DecodeCall decodes data as a call to f and encodes the arguments again.
+// Calldata that doesn't survive the round trip, e.g. with dirty padding or
+// trailing bytes, isn't marked verified.
+func (c Contract) DecodeCall(f Function, data []byte) (Call, error) {
+	args, err := Decode(f, data)
+	if err != nil {
+		return Call{}, err
+	}
+	again, err := Encode(f, args)
+	if err != nil {
+		return Call{}, err
+	}
+	return Call{
+		ABI:      c.Name,
+		Function: f.Signature(),
+		Selector: evm.EncodeHex(f.Selector()),
+		Data:     evm.EncodeHex(data),
+		Args:     args,
+		Verified: bytes.Equal(again, data),
+		Inputs:   f.Inputs,
+	}, nil
+}
+
+// erc20 is the ABI a new registry starts with.
+const erc20 = `[
+  {"type":"function","name":"name","inputs":[],"outputs":[{"name":"","type":"string"}],"stateMutability":"view"},
+  {"type":"function","name":"symbol","inputs":[],"outputs":[{"name":"","type":"string"}],"stateMutability":"view"},
+  {"type":"function","name":"decimals","inputs":[],"outputs":[{"name":"","type":"uint8"}],"stateMutability":"view"},
+  {"type":"function","name":"totalSupply","inputs":[],"outputs":[{"name":"","type":"uint256"}],"stateMutability":"view"},
+  {"type":"function","name":"balanceOf","inputs":[{"name":"account","type":"address"}],"outputs":[{"name":"","type":"uint256"}],"stateMutability":"view"},
+  {"type":"function","name":"allowance","inputs":[{"name":"owner","type":"address"},{"name":"spender","type":"address"}],"outputs":[{"name":"","type":"uint256"}],"stateMutability":"view"},
+  {"type":"function","name":"transfer","inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"}],"outputs":[{"name":"","type":"bool"}],"stateMutability":"nonpayable"},
+  {"type":"function","name":"approve","inputs":[{"name":"spender","type":"address"},{"name":"value","type":"uint256"}],"outputs":[{"name":"","type":"bool"}],"stateMutability":"nonpayable"},
+  {"type":"function","name":"transferFrom","inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"value","type":"uint256"}],"outputs":[{"name":"","type":"bool"}],"stateMutability":"nonpayable"}
+]`
+
+// Registry manages ABIs persisted to a JSON file.
+type Registry struct {
+	mu        sync.RWMutex
+	contracts []Contract
+	path      string
+}
+
+// NewRegistry loads ABIs from a JSON file. If the file doesn't exist, starts
+// with the ERC-20 ABI.
+func NewRegistry(path string) (*Registry, error) {
+	r := &Registry{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			r.contracts = []Contract{{ID: "erc20", Name: "ERC20", ABI: json.RawMessage(erc20)}}
+			return r, nil
+		}
+		return nil, fmt.Errorf("read abis: %w", err)
+	}
+	if err := json.Unmarshal(data, &r.contracts); err != nil {
+		return nil, fmt.Errorf("parse abis: %w", err)
+	}
+	return r, nil
+}
+
+// List returns all registered ABIs.
+func (r *Registry) List() []Contract {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]Contract{}, r.contracts...)
+}
+
+// Get returns the ABI with the given ID or name, ignoring case.
+func (r *Registry) Get(ref string) (Contract, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if c := r.findLocked(idFor(ref)); c != nil {
+		return *c, true
+	}
+	return Contract{}, false
+}
+
+// FindSelector returns the first registered function whose selector is sel,
+// and the ABI it belongs to.
+func (r *Registry) FindSelector(sel []byte) (Contract, Function, bool) {
+	for _, c := range r.List() {
+		for _, f := range c.Functions() {
+			if string(f.Selector()) == string(sel) {
+				return c, f, true
+			}
+		}
+	}
+	return Contract{}, Function{}, false
+}
+
+// Errors returns the custom errors of every registered ABI.
+func (r *Registry) Errors() []Function {
+	var errs []Function
+	for _, c := range r.List() {
+		errs = append(errs, c.Errors()...)
+	}
+	return errs
+}
+
+// Events returns the events of every registered ABI.
+func (r *Registry) Events() []Function {
+	var events []Function
+	for _, c := range r.List() {
+		events = append(events, c.Events()...)
+	}
+	return events
+}
+
+var nameRe = regexp.MustCompile(`^[A-Za-z0-9._-]{1,40}$`)
+
+func idFor(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// Add registers an ABI under a name. Names are unique, ignoring case. The
+// ABI may be a compiler artifact; only its "abi" field is kept.
+func (r *Registry) Add(name string, abi json.RawMessage) (Contract, error) {
+	name = strings.TrimSpace(name)
+	if !nameRe.MatchString(name) {
+		return Contract{}, fmt.Errorf("name %q must be 1-40 letters, digits, or ._-", name)
+	}
+	funcs, err := Parse(abi)
+	if err != nil {
+		return Contract{}, err
+	}
+	if len(funcs) == 0 {
+		return Contract{}, fmt.Errorf("ABI has no functions")
+	}
+	if _, err := ParseErrors(abi); err != nil {
+		return Contract{}, err
+	}
+	if _, err := ParseEvents(abi); err != nil {
+		return Contract{}, err
+	}
+	entries, err := normalize(abi)
+	if err != nil {
+		return Contract{}, err
+	}
+	c := Contract{ID: idFor(name), Name: name, ABI: entries}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing := r.findLocked(c.ID); existing != nil {
+		return Contract{}, fmt.Errorf("ABI %s already exists", existing.Name)
+	}
+	r.contracts = append(r.contracts, c)
+	if err := r.save(); err != nil {
+		r.contracts = r.contracts[:len(r.contracts)-1]
+		return Contract{}, err
+	}
+	return c, nil
+}
+
+// Delete removes an ABI.
+func (r *Registry) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, c := range r.contracts {
+		if c.ID == id {
+			old := r.contracts
+			r.contracts = append(r.contracts[:i:i], r.contracts[i+1:]...)
+			if err := r.save(); err != nil {
+				r.contracts = old
+				return err
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("ABI %q not found", id)
+}
+
+// normalize unwraps a compiler artifact to its ABI array and compacts it.
+func normalize(abi json.RawMessage) (json.RawMessage, error) {
+	var artifact struct {
+		ABI json.RawMessage `json:"abi"`
+	}
+	if json.Unmarshal(abi, &artifact) == nil && artifact.ABI != nil {
+		abi = artifact.ABI
+	}
+	var entries []any
+	if err := json.Unmarshal(abi, &entries); err != nil {
+		return nil, fmt.Errorf("parse ABI: %w", err)
+	}
+	return json.Marshal(entries)
+}
+
+// findLocked finds an ABI by ID. Must be called with mu held.
+func (r *Registry) findLocked(id string) *Contract {
+	for i := range r.contracts {
+		if r.contracts[i].ID == id {
+			return &r.contracts[i]
+		}
+	}
+	return nil
+}
+
+// save writes the current ABIs to disk. Must be called with mu held.
+func (r *Registry) save() error {
+	data, err := json.MarshalIndent(r.contracts, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal abis: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(r.path, data, 0644); err != nil {
+		return fmt.Errorf("write abis: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package abi
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// The built-in revert errors Solidity emits for require/revert with a
+// message and for failed checks.
+var (
+	errorString = Function{Name: "Error", Inputs: []Param{{Name: "message", Type: "string"}}}
+	panicCode   = Function{Name: "Panic", Inputs: []Param{{Name: "code", Type: "uint256"}}}
+)
+
+// panicReasons explains Solidity's panic codes.
+var panicReasons = map[uint64]string{
+	0x00: "generic compiler panic",
+	0x01: "assertion failed",
+	0x11: "arithmetic overflow or underflow",
+	0x12: "division or modulo by zero",
+	0x21: "invalid enum value",
+	0x22: "corrupt storage byte array",
+	0x31: "pop from an empty array",
+	0x32: "array index out of bounds",
+	0x41: "out of memory",
+	0x51: "call to an uninitialized function",
+}
+
+// Revert is why a call or transaction reverted, decoded from its revert
+// data.
+type Revert struct {
+	Kind   string `json:"kind"`            // error, panic, custom, unknown, or empty
+	Reason string `json:"reason"`          // readable, e.g. "arithmetic overflow or underflow (panic 0x11)"
+	Error  string `json:"error,omitempty"` // the custom error's signature
+	Args   []any  `json:"args,omitempty"`  // the custom error's arguments
+	Data   string `json:"data,omitempty"`  // the raw revert data
+}
+
+// DecodeRevert decodes revert data: Error(string) from require and revert,
+// Panic(uint256) from failed checks, and custom errors found in errs.
+// message is the node's error message, the only reason a node that returns
+// no data gives.
+func DecodeRevert(data []byte, message string, errs []Function) Revert {
+	if len(data) == 0 {
+		reason := strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(message, "execution reverted"), ":"))
+		if reason == "" {
+			reason = "no reason given"
+		}
+		return Revert{Kind: "empty", Reason: reason}
+	}
+	r := Revert{Kind: "unknown", Data: evm.EncodeHex(data)}
+	if len(data) < 4 {
+		r.Reason = "malformed revert data " + r.Data
+		return r
+	}
+	switch sel := data[:4]; {
+	case bytes.Equal(sel, errorString.Selector()):
+		if args, err := Decode(errorString, data); err == nil {
+			r.Kind, r.Reason = "error", args[0].(string)
+			return r
+		}
+	case bytes.Equal(sel, panicCode.Selector()):
+		if args, err := Decode(panicCode, data); err == nil {
+			code, _ := new(big.Int).SetString(args[0].(string), 10)
+			reason, ok := panicReasons[code.Uint64()]
+			if !ok || !code.IsUint64() {
+				reason = "panic"
+			}
+			r.Kind, r.Reason = "panic", fmt.Sprintf("%s (panic 0x%x)", reason, code)
+			return r
+		}
+	default:
+		for _, f := range errs {
+			if !bytes.Equal(sel, f.Selector()) {
+				continue
+			}
+			args, err := Decode(f, data)
+			if err != nil {
+				continue
+			}
+			r.Kind, r.Error, r.Args = "custom", f.Signature(), args
+			r.Reason = f.Name + "(" + formatArgs(args) + ")"
+			return r
+		}
+	}
+	r.Reason = "unknown error " + evm.EncodeHex(data[:4])
+	return r
+}
+
+// formatArgs lists decoded arguments for a reason.
+func formatArgs(args []any) string {
+	out := make([]string, len(args))
+	for i, a := range args {
+		switch v := a.(type) {
+		case string:
+			out[i] = v
+		case []any:
+			out[i] = "[" + formatArgs(v) + "]"
+		default:
+			out[i] = fmt.Sprint(v)
+		}
+	}
+	return strings.Join(out, ", ")
+}
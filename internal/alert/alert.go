@@ -0,0 +1,537 @@
+// Package alert stores conditions to be told about — a chain's gas price
+// crossing a threshold, an address's balance changing, an endpoint going
+// offline — and whether each one holds. The server checks
+// them as its endpoints are polled and notifies when one starts to hold.
+package alert
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// Alert kinds.
+const (
+	KindGas     = "gas"     // a fee on an endpoint's chain is below or above a threshold
+	KindBalance = "balance" // an address's native balance on an endpoint changed
+	KindOffline = "offline" // an endpoint is offline, or has been for a while
+)
+
+// Kinds are the alert kinds, for notification channels to pick from.
+var Kinds = []string{KindGas, KindBalance, KindOffline}
+
+// Offline alert values: what the poller last found.
+const (
+	ValueOnline  = "online"
+	ValueOffline = "offline"
+)
+
+// Balance directions.
+const (
+	DirectionAny = "any" // any change
+	DirectionIn  = "in"  // increases: incoming transfers
+	DirectionOut = "out" // decreases: outgoing transfers and fees
+)
+
+// Gas metrics.
+const (
+	MetricBaseFee     = "base_fee"     // the latest block's base fee
+	MetricGasPrice    = "gas_price"    // eth_gasPrice
+	MetricPriorityFee = "priority_fee" // eth_maxPriorityFeePerGas
+)
+
+// Alert is a condition and whether it held when last checked.
+type Alert struct {
+	ID       string `json:"id"`
+	Name     string `json:"name,omitempty"`
+	Kind     string `json:"kind"`
+	Endpoint string `json:"endpoint"`
+	Muted    bool   `json:"muted,omitempty"` // checked, but nothing is sent when it fires
+
+	// Metric is the fee a gas alert watches. It fires when the fee drops
+	// below Below or rises above Above, in gwei; at least one is set.
+	Metric string `json:"metric,omitempty"`
+	Below  string `json:"below,omitempty"`
+	Above  string `json:"above,omitempty"`
+
+	// Address is the account a balance alert watches. It fires on every
+	// change in Direction of at least Min, in whole native units; smaller
+	// changes are ignored.
+	Address   string `json:"address,omitempty"`
+	Direction string `json:"direction,omitempty"`
+	Min       string `json:"min,omitempty"`
+
+	// After is how long an offline alert's endpoint must stay offline
+	// before it fires, as a Go duration such as 5m; at once when empty.
+	After string `json:"after,omitempty"`
+
+	// Firing is whether a gas or offline alert's condition held at the last
+	// check. It fires when the condition starts to hold, and again only
+	// after it stopped. A balance alert fires on each change and never
+	// stays firing.
+	Firing    bool       `json:"firing"`
+	Value     string     `json:"value,omitempty"`  // at the last check: gwei, the balance in whole native units, or online or offline
+	Change    string     `json:"change,omitempty"` // the balance change last fired for, signed, in whole native units
+	Since     *time.Time `json:"since,omitempty"`  // when an offline alert's endpoint last went offline
+	Error     string     `json:"error,omitempty"`  // why the last check failed
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+	FiredAt   *time.Time `json:"fired_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Store keeps alerts in a JSON file.
+type Store struct {
+	mu     sync.Mutex
+	alerts []Alert // oldest first
+	path   string
+}
+
+// NewStore loads alerts from a JSON file. If the file doesn't exist, starts
+// empty.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path, alerts: []Alert{}}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("read alerts: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.alerts); err != nil {
+		return nil, fmt.Errorf("parse alerts: %w", err)
+	}
+	return s, nil
+}
+
+// List returns alerts oldest first, optionally only those of kind.
+func (s *Store) List(kind string) []Alert {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []Alert{}
+	for _, a := range s.alerts {
+		if kind == "" || a.Kind == kind {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// Get returns an alert by ID.
+func (s *Store) Get(id string) (Alert, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a := s.findLocked(id); a != nil {
+		return *a, true
+	}
+	return Alert{}, false
+}
+
+// Add validates a and stores it, not firing.
+func (s *Store) Add(a Alert) (Alert, error) {
+	if err := Validate(&a); err != nil {
+		return Alert{}, err
+	}
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return Alert{}, err
+	}
+	a.ID = hex.EncodeToString(b)
+	a.CreatedAt = time.Now().UTC()
+	reset(&a)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.alerts
+	s.alerts = append(s.alerts[:len(old):len(old)], a)
+	if err := s.save(); err != nil {
+		s.alerts = old
+		return Alert{}, err
+	}
+	return a, nil
+}
+
+// Update replaces an alert's condition. Muting or unmuting alone keeps its
+// state; any other change checks it afresh.
+func (s *Store) Update(id string, a Alert) (Alert, error) {
+	if err := Validate(&a); err != nil {
+		return Alert{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur := s.findLocked(id)
+	if cur == nil {
+		return Alert{}, fmt.Errorf("alert %q not found", id)
+	}
+	old := *cur
+	a.ID, a.CreatedAt = old.ID, old.CreatedAt
+	a.Firing, a.Value, a.Change, a.Error = old.Firing, old.Value, old.Change, old.Error
+	a.Since, a.CheckedAt, a.FiredAt = old.Since, old.CheckedAt, old.FiredAt
+	if !sameCondition(old, a) {
+		reset(&a)
+	}
+	*cur = a
+	if err := s.save(); err != nil {
+		*cur = old
+		return Alert{}, err
+	}
+	return a, nil
+}
+
+// Delete removes an alert.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.alerts {
+		if s.alerts[i].ID == id {
+			old := s.alerts
+			s.alerts = append(s.alerts[:i:i], s.alerts[i+1:]...)
+			if err := s.save(); err != nil {
+				s.alerts = old
+				return err
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("alert %q not found", id)
+}
+
+// Validate normalizes a's condition and checks it. The endpoint's existence
+// is left to the caller.
+func Validate(a *Alert) error {
+	a.Name = strings.TrimSpace(a.Name)
+	a.Endpoint = strings.TrimSpace(a.Endpoint)
+	if a.Endpoint == "" {
+		return fmt.Errorf("endpoint is required")
+	}
+	switch a.Kind {
+	case KindGas:
+		switch a.Metric {
+		case "":
+			a.Metric = MetricBaseFee
+		case MetricBaseFee, MetricGasPrice, MetricPriorityFee:
+		default:
+			return fmt.Errorf("unknown metric %q: use base_fee, gas_price, or priority_fee", a.Metric)
+		}
+		if a.Below == "" && a.Above == "" {
+			return fmt.Errorf("a gas alert needs below or above")
+		}
+		for _, f := range []*string{&a.Below, &a.Above} {
+			if *f == "" {
+				continue
+			}
+			n, err := evm.ParseUnits(strings.TrimSpace(*f), 9)
+			if err != nil || n.Sign() < 0 {
+				return fmt.Errorf("invalid threshold %q: use gwei, such as 10 or 0.5", *f)
+			}
+			*f = evm.FormatUnits(n, 9)
+		}
+	case KindBalance:
+		addr, err := evm.ParseAddress(strings.TrimSpace(a.Address))
+		if err != nil {
+			return fmt.Errorf("invalid address %q", a.Address)
+		}
+		a.Address = addr.Hex()
+		switch a.Direction {
+		case "":
+			a.Direction = DirectionAny
+		case DirectionAny, DirectionIn, DirectionOut:
+		default:
+			return fmt.Errorf("unknown direction %q: use any, in, or out", a.Direction)
+		}
+		if a.Min != "" {
+			n, err := evm.ParseUnits(strings.TrimSpace(a.Min), 18)
+			if err != nil || n.Sign() < 0 {
+				return fmt.Errorf("invalid min %q: use whole native units, such as 0.5", a.Min)
+			}
+			a.Min = evm.FormatUnits(n, 18)
+		}
+	case KindOffline:
+		a.After = strings.TrimSpace(a.After)
+		if a.After != "" {
+			if d, err := time.ParseDuration(a.After); err != nil || d < 0 {
+				return fmt.Errorf("invalid after %q: use a duration such as 5m", a.After)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown kind %q: use gas, balance, or offline", a.Kind)
+	}
+	return nil
+}
+
+// Observe records a check of the gas alert id that read value, in wei, or
+// failed with checkErr. It returns the alert and whether it started firing.
+// The file is written only when the alert starts or stops firing.
+func (s *Store) Observe(id string, value *big.Int, checkErr error) (Alert, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.findLocked(id)
+	if a == nil {
+		return Alert{}, false, fmt.Errorf("alert %q not found", id)
+	}
+	now := time.Now().UTC()
+	a.CheckedAt = &now
+	if checkErr != nil {
+		a.Error = checkErr.Error()
+		return *a, false, nil
+	}
+	a.Error = ""
+	a.Value = evm.FormatUnits(value, 9)
+	holds := crosses(value, a.Below, a.Above)
+	if holds == a.Firing {
+		return *a, false, nil
+	}
+	old := *a
+	a.Firing = holds
+	if holds {
+		a.FiredAt = &now
+	}
+	if err := s.save(); err != nil {
+		*a = old
+		return old, false, err
+	}
+	return *a, holds, nil
+}
+
+// ObserveBalance records a check of the balance alert id that read
+// balance, in the smallest unit of a currency with decimals, or failed with
+// checkErr. It returns the alert and whether the change since the last
+// check fires it. The first check only records the balance. The file is
+// written whenever the balance changes.
+func (s *Store) ObserveBalance(id string, balance *big.Int, decimals int, checkErr error) (Alert, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.findLocked(id)
+	if a == nil {
+		return Alert{}, false, fmt.Errorf("alert %q not found", id)
+	}
+	now := time.Now().UTC()
+	a.CheckedAt = &now
+	if checkErr != nil {
+		a.Error = checkErr.Error()
+		return *a, false, nil
+	}
+	a.Error = ""
+	value := evm.FormatUnits(balance, decimals)
+	if value == a.Value {
+		return *a, false, nil
+	}
+	old := *a
+	a.Value = value
+	fired := false
+	if prev, err := evm.ParseUnits(old.Value, decimals); err == nil && old.Value != "" {
+		change := new(big.Int).Sub(balance, prev)
+		if moves(change, a.Direction, a.Min, decimals) {
+			fired = true
+			a.Change = evm.FormatUnits(new(big.Int).Abs(change), decimals)
+			if change.Sign() < 0 {
+				a.Change = "-" + a.Change
+			}
+			a.FiredAt = &now
+		}
+	}
+	if err := s.save(); err != nil {
+		*a = old
+		return old, false, err
+	}
+	return *a, fired, nil
+}
+
+// ObserveOnline records a poll at at that found the offline alert id's
+// endpoint online or not. It returns the alert and whether it started or
+// stopped firing: it fires once the endpoint has been offline for After,
+// and stops when the endpoint is back. The file is written whenever the
+// endpoint goes offline or comes back, and when the alert starts or stops
+// firing.
+func (s *Store) ObserveOnline(id string, online bool, at time.Time) (Alert, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.findLocked(id)
+	if a == nil {
+		return Alert{}, false, fmt.Errorf("alert %q not found", id)
+	}
+	at = at.UTC()
+	old := *a
+	a.CheckedAt, a.Error = &at, ""
+	value := ValueOnline
+	if !online {
+		value = ValueOffline
+		if a.Value != ValueOffline || a.Since == nil {
+			a.Since = &at
+		}
+	}
+	a.Value = value
+	after, _ := time.ParseDuration(a.After)
+	holds := !online && at.Sub(*a.Since) >= after
+	if holds && !a.Firing {
+		a.FiredAt = &at
+	}
+	a.Firing = holds
+	if a.Value == old.Value && a.Firing == old.Firing {
+		return *a, false, nil
+	}
+	if err := s.save(); err != nil {
+		*a = old
+		return old, false, err
+	}
+	return *a, a.Firing != old.Firing, nil
+}
+
+// moves reports whether a balance change, in the smallest unit of a
+// currency with decimals, is in direction and at least least whole units.
+func moves(change *big.Int, direction, least string, decimals int) bool {
+	switch {
+	case change.Sign() == 0,
+		direction == DirectionIn && change.Sign() < 0,
+		direction == DirectionOut && change.Sign() > 0:
+		return false
+	}
+	if least == "" {
+		return true
+	}
+	n, err := evm.ParseUnits(least, decimals)
+	if err != nil {
+		return true // finer than the currency: any change is at least least
+	}
+	return new(big.Int).Abs(change).Cmp(n) >= 0
+}
+
+// crosses reports whether value, in wei, is below below or above above, in
+// gwei; empty thresholds are ignored.
+func crosses(value *big.Int, below, above string) bool {
+	if below != "" {
+		if n, err := evm.ParseUnits(below, 9); err == nil && value.Cmp(n) < 0 {
+			return true
+		}
+	}
+	if above != "" {
+		if n, err := evm.ParseUnits(above, 9); err == nil && value.Cmp(n) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Message describes an alert on ep that fired for a notification, e.g.
+// "Mainnet base fee is 8.2 gwei, below 10 gwei", "0xAbC… on Mainnet
+// received 1.5 ETH, balance now 3.2 ETH", or "Mainnet has been offline for
+// 5m0s"; for an offline alert that stopped firing, "Mainnet is back online
+// after 7m12s".
+func Message(a Alert, ep endpoint.Endpoint) string {
+	name := ep.Name
+	if name == "" {
+		name = a.Endpoint
+	}
+	var msg string
+	switch a.Kind {
+	case KindBalance:
+		verb, change := "received", a.Change
+		if strings.HasPrefix(change, "-") {
+			verb, change = "sent", change[1:]
+		}
+		msg = fmt.Sprintf("%s on %s %s %s %s, balance now %s %s", a.Address, name, verb, change, ep.Native.Symbol, a.Value, ep.Native.Symbol)
+	case KindOffline:
+		var down time.Duration
+		if a.Since != nil && a.CheckedAt != nil {
+			down = a.CheckedAt.Sub(*a.Since).Round(time.Second)
+		}
+		switch {
+		case !a.Firing:
+			msg = fmt.Sprintf("%s is back online after %s", name, down)
+		case down > 0:
+			msg = fmt.Sprintf("%s has been offline for %s", name, down)
+		default:
+			msg = fmt.Sprintf("%s is offline", name)
+		}
+	default:
+		cond := "above " + a.Above
+		if value, err := evm.ParseUnits(a.Value, 9); err == nil && crosses(value, a.Below, "") {
+			cond = "below " + a.Below
+		}
+		msg = fmt.Sprintf("%s %s is %s gwei, %s gwei", name, strings.ReplaceAll(a.Metric, "_", " "), a.Value, cond)
+	}
+	if a.Name != "" {
+		msg = a.Name + ": " + msg
+	}
+	return msg
+}
+
+// ReadGas reads metric from ep, in wei.
+func ReadGas(ctx context.Context, ep endpoint.Endpoint, metric string) (*big.Int, error) {
+	method := map[string]string{MetricGasPrice: "eth_gasPrice", MetricPriorityFee: "eth_maxPriorityFeePerGas"}[metric]
+	if metric == MetricBaseFee {
+		raw, err := endpoint.RPCCall(ctx, ep, "eth_getBlockByNumber", []any{"latest", false})
+		if err != nil {
+			return nil, fmt.Errorf("eth_getBlockByNumber: %w", err)
+		}
+		var block *struct {
+			BaseFeePerGas string `json:"baseFeePerGas"`
+		}
+		if err := json.Unmarshal(raw, &block); err != nil || block == nil {
+			return nil, fmt.Errorf("eth_getBlockByNumber: unexpected result %s", raw)
+		}
+		if block.BaseFeePerGas == "" {
+			return nil, fmt.Errorf("the chain has no base fee (EIP-1559)")
+		}
+		return evm.ParseQuantity(block.BaseFeePerGas)
+	}
+	raw, err := endpoint.RPCCall(ctx, ep, method, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", method, err)
+	}
+	var hexFee string
+	if err := json.Unmarshal(raw, &hexFee); err != nil {
+		return nil, fmt.Errorf("%s: unexpected result %s", method, raw)
+	}
+	n, err := evm.ParseQuantity(hexFee)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unexpected result %s", method, raw)
+	}
+	return n, nil
+}
+
+// sameCondition reports whether a and b watch the same thing the same way.
+func sameCondition(a, b Alert) bool {
+	return a.Kind == b.Kind && a.Endpoint == b.Endpoint &&
+		a.Metric == b.Metric && a.Below == b.Below && a.Above == b.Above &&
+		a.Address == b.Address && a.Direction == b.Direction && a.Min == b.Min &&
+		a.After == b.After
+}
+
+// reset clears what the last check found.
+func reset(a *Alert) {
+	a.Firing, a.Value, a.Change, a.Error = false, "", "", ""
+	a.Since, a.CheckedAt, a.FiredAt = nil, nil, nil
+}
+
+// findLocked finds an alert by ID. Must be called with mu held.
+func (s *Store) findLocked(id string) *Alert {
+	for i := range s.alerts {
+		if s.alerts[i].ID == id {
+			return &s.alerts[i]
+		}
+	}
+	return nil
+}
+
+// save writes alerts to disk. Must be called with mu held.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.alerts, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal alerts: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("write alerts: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,471 @@
+// Package approval queues transactions that arrive programmatically — from
+// API clients, scripts, or wallet connectors — until someone reviews them in
+// the dashboard. Nothing in the queue is signed until it is approved, and
+// requests that wait too long expire. Under dual control, high-value requests
+// need sign-offs from two different approvers.
+package approval
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/primal-host/wallet/internal/evm"
+	"github.com/primal-host/wallet/internal/txbuild"
+)
+
+// finishedLimit is how many decided requests are kept. Pending ones are
+// always kept.
+const finishedLimit = 200
+
+// Request statuses.
+const (
+	StatusPending  = "pending"  // waiting for review
+	StatusSending  = "sending"  // approved, being signed and broadcast
+	StatusSent     = "sent"     // signed, and broadcast if asked; Signed is set
+	StatusRejected = "rejected" // rejected in review
+	StatusExpired  = "expired"  // not reviewed before ExpiresAt
+	StatusFailed   = "failed"   // signing or broadcasting failed; Error says why
+)
+
+// Interrupted is the error of a request that was sending when the server
+// stopped. The send journal can tell whether it went out.
+const Interrupted = "interrupted while sending; check the chain before sending again"
+
+// ErrNoApprover is returned when a request that needs two approvers is
+// decided without approver credentials.
+var ErrNoApprover = errors.New("this request needs two approvers; send an approver token")
+
+// Config configures the queue.
+type Config struct {
+	File     string
+	TTL      time.Duration // how long a request waits for review
+	Required bool          // server signing routes queue instead of signing
+
+	ApproversFile string // see AddApprover
+	DualThreshold string // whole native units; values at or above it need two approvers
+	Webhook       string // optional URL that receives queue events as JSON
+
+	// ConfirmThreshold is in whole native units. Server signing of values
+	// at or above it takes a txbuild.Confirmation.
+	ConfirmThreshold string
+}
+
+// Request is a transaction waiting for, or decided by, review.
+type Request struct {
+	ID        string            `json:"id"`
+	Origin    string            `json:"origin"` // who asked, e.g. "vault_send" or a client's own label
+	Note      string            `json:"note,omitempty"`
+	Envelope  *txbuild.Envelope `json:"envelope"` // exactly what is signed on approval
+	Broadcast bool              `json:"broadcast"`
+	Private   bool              `json:"private,omitempty"` // broadcast to a private endpoint of the envelope's chain
+	Status    string            `json:"status"`
+	Needed    int               `json:"approvals_needed"` // sign-offs before it is sent: 1, or 2 under dual control
+	Signoffs  []Signoff         `json:"signoffs,omitempty"`
+	Signed    *txbuild.Signed   `json:"signed,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	DecidedAt *time.Time        `json:"decided_at,omitempty"` // approved, rejected, or expired
+	DecidedBy string            `json:"decided_by,omitempty"` // approver who rejected it or gave the last sign-off
+}
+
+// Signoff is one approver's approval of a request.
+type Signoff struct {
+	Approver string    `json:"approver"`
+	At       time.Time `json:"at"`
+}
+
+// Open reports whether r can still be approved or rejected at now.
+func (r Request) Open(now time.Time) bool {
+	return r.Status == StatusPending && now.Before(r.ExpiresAt)
+}
+
+// Awaiting is how many more sign-offs r needs before it is sent.
+func (r Request) Awaiting() int {
+	needed := r.Needed
+	if needed < 1 {
+		needed = 1 // queued before dual control
+	}
+	return max(needed-len(r.Signoffs), 0)
+}
+
+// Store manages queued requests persisted to a JSON file.
+type Store struct {
+	mu       sync.RWMutex
+	requests []Request // oldest first
+	cfg      Config
+}
+
+// NewStore loads the queue from cfg.File. If the file doesn't exist, starts
+// empty. Requests left sending by a crash are marked failed, since the
+// transaction may or may not have gone out.
+func NewStore(cfg Config) (*Store, error) {
+	if cfg.TTL <= 0 {
+		cfg.TTL = time.Hour
+	}
+	if cfg.DualThreshold != "" {
+		if _, err := evm.ParseUnits(cfg.DualThreshold, 18); err != nil {
+			return nil, fmt.Errorf("invalid dual-control threshold: %w", err)
+		}
+	}
+	if cfg.ConfirmThreshold != "" {
+		if _, err := evm.ParseUnits(cfg.ConfirmThreshold, 18); err != nil {
+			return nil, fmt.Errorf("invalid confirmation threshold: %w", err)
+		}
+	}
+	s := &Store{cfg: cfg, requests: []Request{}}
+	data, err := os.ReadFile(cfg.File)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("read approvals: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.requests); err != nil {
+		return nil, fmt.Errorf("parse approvals: %w", err)
+	}
+	for i := range s.requests {
+		if s.requests[i].Status == StatusSending {
+			s.requests[i].Status = StatusFailed
+			s.requests[i].Error = Interrupted
+		}
+	}
+	return s, nil
+}
+
+// Required reports whether server signing routes must queue for approval.
+func (s *Store) Required() bool {
+	return s.cfg.Required
+}
+
+// TTL is how long a request waits for review before it expires.
+func (s *Store) TTL() time.Duration {
+	return s.cfg.TTL
+}
+
+// Needed is how many approvers must sign off on env: two when its value
+// reaches the dual-control threshold or it hands over tokens while there is
+// one, otherwise one. decimals are those of the endpoint's native currency.
+func (s *Store) Needed(env *txbuild.Envelope, decimals int) int {
+	if reaches(env, s.cfg.DualThreshold, decimals) || (s.cfg.DualThreshold != "" && movesTokens(env)) {
+		return 2
+	}
+	return 1
+}
+
+// ConfirmRequired reports whether env's value is large enough, or it hands
+// over tokens while there is a threshold, that the server only signs it
+// with a txbuild.Confirmation.
+func (s *Store) ConfirmRequired(env *txbuild.Envelope, decimals int) bool {
+	return reaches(env, s.cfg.ConfirmThreshold, decimals) || (s.cfg.ConfirmThreshold != "" && movesTokens(env))
+}
+
+// reaches reports whether env's value is at or above threshold, in whole
+// native units. An empty threshold is never reached, and a value that can't
+// be read always reaches it.
+func reaches(env *txbuild.Envelope, threshold string, decimals int) bool {
+	if threshold == "" {
+		return false
+	}
+	limit, err := evm.ParseUnits(threshold, decimals)
+	if err != nil {
+		return true
+	}
+	if env.Tx.Value == "" {
+		return false
+	}
+	value, err := evm.ParseQuantity(env.Tx.Value)
+	return err != nil || value.Cmp(limit) >= 0
+}
+
+// movesTokens reports whether env's calldata hands over tokens, as
+// txbuild.DecodeTokenMove reads it. Token amounts can't be weighed against
+// a threshold in native units, so such calls count as reaching it, and so
+// does calldata that can't be read.
+func movesTokens(env *txbuild.Envelope) bool {
+	data, err := evm.DecodeHex(env.Tx.Data)
+	if err != nil {
+		return true
+	}
+	_, ok := txbuild.DecodeTokenMove(data)
+	return ok
+}
+
+// Authenticate returns the approver whose token this is.
+func (s *Store) Authenticate(token string) (string, error) {
+	return Authenticate(s.cfg.ApproversFile, token)
+}
+
+// List returns requests newest first, optionally only those with status.
+func (s *Store) List(status string) []Request {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []Request{}
+	for i := len(s.requests) - 1; i >= 0; i-- {
+		if status == "" || s.requests[i].Status == status {
+			out = append(out, s.requests[i])
+		}
+	}
+	return out
+}
+
+// Get returns the request with the given ID.
+func (s *Store) Get(id string) (Request, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if r := s.findLocked(id); r != nil {
+		return *r, true
+	}
+	return Request{}, false
+}
+
+// Add queues env for review until needed approvers sign off, dropping the
+// oldest decided requests beyond finishedLimit.
+func (s *Store) Add(env *txbuild.Envelope, origin, note string, broadcast, private bool, needed int) (Request, error) {
+	if env == nil {
+		return Request{}, fmt.Errorf("envelope is required")
+	}
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return Request{}, err
+	}
+	now := time.Now().UTC()
+	r := Request{
+		ID:        hex.EncodeToString(id),
+		Origin:    strings.TrimSpace(origin),
+		Note:      strings.TrimSpace(note),
+		Envelope:  env,
+		Broadcast: broadcast,
+		Private:   private,
+		Status:    StatusPending,
+		Needed:    max(needed, 1),
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.cfg.TTL),
+	}
+	if r.Origin == "" {
+		r.Origin = "api"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.requests
+	all := append(s.requests[:len(old):len(old)], r)
+	finished := 0
+	for _, q := range all {
+		if q.Status != StatusPending && q.Status != StatusSending {
+			finished++
+		}
+	}
+	kept := make([]Request, 0, len(all))
+	for _, q := range all {
+		if finished > finishedLimit && q.Status != StatusPending && q.Status != StatusSending {
+			finished--
+			continue
+		}
+		kept = append(kept, q)
+	}
+	s.requests = kept
+	if err := s.save(); err != nil {
+		s.requests = old
+		return Request{}, err
+	}
+	return r, nil
+}
+
+// Approve records approver's sign-off on a pending request. Once it has all
+// it needs, the request moves to sending, so it can only be sent once. A
+// request that needs two sign-offs takes them from two different named
+// approvers; others may be approved anonymously. A request past its expiry
+// can't be approved.
+func (s *Store) Approve(id, approver string) (Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	r, err := s.pendingLocked(id, now)
+	if err != nil {
+		return Request{}, err
+	}
+	if r.Awaiting() > 1 || len(r.Signoffs) > 0 {
+		if approver == "" {
+			return Request{}, ErrNoApprover
+		}
+		for _, so := range r.Signoffs {
+			if strings.EqualFold(so.Approver, approver) {
+				return Request{}, fmt.Errorf("approval %q already has %s's sign-off; it needs another approver", id, so.Approver)
+			}
+		}
+	}
+	old := *r
+	r.Signoffs = append(r.Signoffs[:len(r.Signoffs):len(r.Signoffs)], Signoff{Approver: approver, At: now})
+	if r.Awaiting() == 0 {
+		r.Status = StatusSending
+		r.DecidedAt = &now
+		r.DecidedBy = approver
+	}
+	if err := s.save(); err != nil {
+		*r = old
+		return Request{}, err
+	}
+	return *r, nil
+}
+
+// Reject marks a pending request rejected. Any one approver can reject a
+// request that needs two.
+func (s *Store) Reject(id, approver string) (Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	r, err := s.pendingLocked(id, now)
+	if err != nil {
+		return Request{}, err
+	}
+	if r.Needed > 1 && approver == "" {
+		return Request{}, ErrNoApprover
+	}
+	old := *r
+	r.Status = StatusRejected
+	r.DecidedAt = &now
+	r.DecidedBy = approver
+	if err := s.save(); err != nil {
+		*r = old
+		return Request{}, err
+	}
+	return *r, nil
+}
+
+// pendingLocked finds a request that can still be decided. Must be called
+// with mu held.
+func (s *Store) pendingLocked(id string, now time.Time) (*Request, error) {
+	r := s.findLocked(id)
+	if r == nil {
+		return nil, fmt.Errorf("approval %q not found", id)
+	}
+	if r.Status == StatusPending && !r.Open(now) {
+		return nil, fmt.Errorf("approval %q expired at %s", id, r.ExpiresAt.Format(time.RFC3339))
+	}
+	if r.Status != StatusPending {
+		return nil, fmt.Errorf("approval %q is %s, not pending", id, r.Status)
+	}
+	return r, nil
+}
+
+// Finish records the outcome of a claimed request: the signed transaction,
+// or the error that stopped it.
+func (s *Store) Finish(id string, signed *txbuild.Signed, sendErr error) (Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.findLocked(id)
+	if r == nil {
+		return Request{}, fmt.Errorf("approval %q not found", id)
+	}
+	old := *r
+	r.Signed = signed
+	if sendErr != nil {
+		r.Status = StatusFailed
+		r.Error = sendErr.Error()
+	} else {
+		r.Status = StatusSent
+		r.Error = ""
+	}
+	if err := s.save(); err != nil {
+		*r = old
+		return Request{}, err
+	}
+	return *r, nil
+}
+
+// Expire marks pending requests past their expiry as expired and returns
+// them.
+func (s *Store) Expire(now time.Time) ([]Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := append([]Request{}, s.requests...)
+	var expired []Request
+	for i := range s.requests {
+		r := &s.requests[i]
+		if r.Status == StatusPending && !r.Open(now) {
+			at := now.UTC()
+			r.Status = StatusExpired
+			r.DecidedAt = &at
+			expired = append(expired, *r)
+		}
+	}
+	if len(expired) == 0 {
+		return nil, nil
+	}
+	if err := s.save(); err != nil {
+		s.requests = old
+		return nil, err
+	}
+	return expired, nil
+}
+
+// Notify posts event and r to the webhook, if one is configured, without
+// waiting for it. event is "queued", "signed_off", or the status r reached.
+func (s *Store) Notify(event string, r Request) {
+	if s.cfg.Webhook == "" {
+		return
+	}
+	text := fmt.Sprintf("Approval %s from %s %s", r.ID, r.Origin, strings.ReplaceAll(event, "_", " "))
+	if r.Envelope != nil {
+		text += ": " + r.Envelope.Summary.Value + " to " + r.Envelope.Tx.To
+	}
+	if a := r.Awaiting(); r.Status == StatusPending && a > 0 {
+		text += fmt.Sprintf(" (sign-offs still needed: %d)", a)
+	}
+	body, _ := json.Marshal(map[string]any{"text": text, "event": event, "approval": r})
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.Webhook, bytes.NewReader(body))
+		if err != nil {
+			slog.Error("approval webhook failed", "subsystem", "approval", "approval", r.ID, "error", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			slog.Error("approval webhook failed", "subsystem", "approval", "approval", r.ID, "error", err)
+			return
+		}
+		resp.Body.Close()
+	}()
+}
+
+// findLocked finds a request by ID. Must be called with mu held.
+func (s *Store) findLocked(id string) *Request {
+	for i := range s.requests {
+		if s.requests[i].ID == id {
+			return &s.requests[i]
+		}
+	}
+	return nil
+}
+
+// save writes the queue to disk. Must be called with mu held.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.requests, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal approvals: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(s.cfg.File, data, 0644); err != nil {
+		return fmt.Errorf("write approvals: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package approval
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Approver is a person who can sign off on requests that need two
+// approvers. Only a hash of their token is stored.
+type Approver struct {
+	Name      string    `json:"name"`
+	TokenHash string    `json:"token_hash"` // hex SHA-256 of the bearer token
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// The approvers file is only written by the CLI, never through the API, so
+// nobody who can reach the server can enrol themselves. It is read on every
+// sign-off, so changes apply without a restart.
+
+// LoadApprovers reads the approvers file. A missing file means no approvers.
+func LoadApprovers(path string) ([]Approver, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Approver{}, nil
+		}
+		return nil, fmt.Errorf("read approvers: %w", err)
+	}
+	var list []Approver
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parse approvers: %w", err)
+	}
+	return list, nil
+}
+
+// AddApprover enrols name and returns their new token, which is shown once.
+func AddApprover(path, name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("approver name is required")
+	}
+	list, err := LoadApprovers(path)
+	if err != nil {
+		return "", err
+	}
+	for _, a := range list {
+		if strings.EqualFold(a.Name, name) {
+			return "", fmt.Errorf("approver %q already exists", a.Name)
+		}
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	list = append(list, Approver{Name: name, TokenHash: hashToken(token), CreatedAt: time.Now().UTC()})
+	if err := saveApprovers(path, list); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RemoveApprover revokes name's token.
+func RemoveApprover(path, name string) error {
+	list, err := LoadApprovers(path)
+	if err != nil {
+		return err
+	}
+	for i, a := range list {
+		if strings.EqualFold(a.Name, name) {
+			return saveApprovers(path, append(list[:i], list[i+1:]...))
+		}
+	}
+	return fmt.Errorf("approver %q not found", name)
+}
+
+// Authenticate returns the name of the approver whose token this is.
+func Authenticate(path, token string) (string, error) {
+	list, err := LoadApprovers(path)
+	if err != nil {
+		return "", err
+	}
+	sum := hashToken(token)
+	for _, a := range list {
+		if subtle.ConstantTimeCompare([]byte(a.TokenHash), []byte(sum)) == 1 {
+			return a.Name, nil
+		}
+	}
+	return "", fmt.Errorf("unknown approver token")
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func saveApprovers(path string, list []Approver) error {
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal approvers: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("write approvers: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+// Package asset is the registry of currencies the wallet knows about. Each
+// asset carries its display symbol, decimals, and the metadata needed to
+// price and show it, so endpoints (and anything else holding a balance)
+// reference an asset by ID instead of repeating a free-text symbol.
+package asset
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// Asset is a registered currency.
+type Asset struct {
+	ID          string `json:"id"`                     // lowercased symbol, e.g. "avax"
+	Symbol      string `json:"symbol"`                 // display symbol, e.g. "AVAX"
+	Decimals    int    `json:"decimals"`               // 18 for EVM native currencies
+	CoingeckoID string `json:"coingecko_id,omitempty"` // e.g. "avalanche-2"
+	Icon        string `json:"icon,omitempty"`         // image URL
+}
+
+// Format renders an amount in the asset's smallest unit as whole units with
+// the symbol, e.g. "1.5 AVAX".
+func (a Asset) Format(n *big.Int) string {
+	return evm.FormatUnits(n, a.Decimals) + " " + a.Symbol
+}
+
+// known are the assets a new registry starts with, and the metadata used
+// when an unregistered symbol is migrated in.
+var known = []Asset{
+	{ID: "eth", Symbol: "ETH", Decimals: 18, CoingeckoID: "ethereum"},
+	{ID: "avax", Symbol: "AVAX", Decimals: 18, CoingeckoID: "avalanche-2"},
+	{ID: "bnb", Symbol: "BNB", Decimals: 18, CoingeckoID: "binancecoin"},
+	{ID: "pol", Symbol: "POL", Decimals: 18, CoingeckoID: "polygon-ecosystem-token"},
+}
+
+// Registry manages assets persisted to a JSON file.
+type Registry struct {
+	mu     sync.RWMutex
+	assets []Asset
+	path   string
+}
+
+// NewRegistry loads assets from a JSON file. If the file doesn't exist, starts
+// with the common native currencies.
+func NewRegistry(path string) (*Registry, error) {
+	r := &Registry{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			r.assets = append([]Asset{}, known...)
+			return r, nil
+		}
+		return nil, fmt.Errorf("read assets: %w", err)
+	}
+	if err := json.Unmarshal(data, &r.assets); err != nil {
+		return nil, fmt.Errorf("parse assets: %w", err)
+	}
+	return r, nil
+}
+
+// List returns all registered assets.
+func (r *Registry) List() []Asset {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]Asset{}, r.assets...)
+}
+
+// Get returns the asset with the given ID.
+func (r *Registry) Get(id string) (Asset, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if a := r.findLocked(id); a != nil {
+		return *a, true
+	}
+	return Asset{}, false
+}
+
+// Lookup finds an asset by ID or symbol, ignoring case, so "AVAX", "avax",
+// and "Avax" are the same asset.
+func (r *Registry) Lookup(ref string) (Asset, bool) {
+	return r.Get(idFor(ref))
+}
+
+// Ensure returns the asset for symbol, registering it with 18 decimals if it
+// is new. It migrates endpoints that predate the registry.
+func (r *Registry) Ensure(symbol string) (Asset, error) {
+	if a, ok := r.Lookup(symbol); ok {
+		return a, nil
+	}
+	a := Asset{Symbol: strings.TrimSpace(symbol), Decimals: 18}
+	for _, k := range known {
+		if k.ID == idFor(symbol) {
+			a = k
+		}
+	}
+	return r.Add(a)
+}
+
+var (
+	symbolRe    = regexp.MustCompile(`^[A-Za-z0-9.$_-]{1,16}$`)
+	coingeckoRe = regexp.MustCompile(`^[a-z0-9-]+$`)
+)
+
+// idFor derives an asset ID from a symbol.
+func idFor(symbol string) string {
+	return strings.ToLower(strings.TrimSpace(symbol))
+}
+
+func validate(a *Asset) error {
+	a.Symbol = strings.TrimSpace(a.Symbol)
+	a.CoingeckoID = strings.TrimSpace(a.CoingeckoID)
+	a.Icon = strings.TrimSpace(a.Icon)
+	if a.Symbol == "" {
+		return fmt.Errorf("symbol is required")
+	}
+	if !symbolRe.MatchString(a.Symbol) {
+		return fmt.Errorf("symbol %q must be 1-16 letters, digits, or .$_-", a.Symbol)
+	}
+	if a.Decimals < 0 || a.Decimals > 36 {
+		return fmt.Errorf("decimals must be between 0 and 36")
+	}
+	if a.CoingeckoID != "" && !coingeckoRe.MatchString(a.CoingeckoID) {
+		return fmt.Errorf("invalid coingecko id %q", a.CoingeckoID)
+	}
+	if a.Icon != "" {
+		u, err := url.ParseRequestURI(a.Icon)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+			return fmt.Errorf("icon must be an http(s) URL")
+		}
+	}
+	return nil
+}
+
+// Add registers a new asset. Its ID is the lowercased symbol, so a symbol
+// that differs from an existing one only in case is rejected.
+func (r *Registry) Add(a Asset) (Asset, error) {
+	if err := validate(&a); err != nil {
+		return Asset{}, err
+	}
+	a.ID = idFor(a.Symbol)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing := r.findLocked(a.ID); existing != nil {
+		return Asset{}, fmt.Errorf("asset %s already exists", existing.Symbol)
+	}
+	r.assets = append(r.assets, a)
+	if err := r.save(); err != nil {
+		r.assets = r.assets[:len(r.assets)-1]
+		return Asset{}, err
+	}
+	return a, nil
+}
+
+// Update replaces an asset's metadata. The symbol may change only in case,
+// since endpoints refer to the asset by ID.
+func (r *Registry) Update(id string, a Asset) (Asset, error) {
+	if err := validate(&a); err != nil {
+		return Asset{}, err
+	}
+	if idFor(a.Symbol) != id {
+		return Asset{}, fmt.Errorf("symbol %q does not match asset %q; add a new asset instead", a.Symbol, id)
+	}
+	a.ID = id
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing := r.findLocked(id)
+	if existing == nil {
+		return Asset{}, fmt.Errorf("asset %q not found", id)
+	}
+	old := *existing
+	*existing = a
+	if err := r.save(); err != nil {
+		*existing = old
+		return Asset{}, err
+	}
+	return a, nil
+}
+
+// Delete removes an asset. Callers check that nothing still refers to it.
+func (r *Registry) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, a := range r.assets {
+		if a.ID == id {
+			old := r.assets
+			r.assets = append(r.assets[:i:i], r.assets[i+1:]...)
+			if err := r.save(); err != nil {
+				r.assets = old
+				return err
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("asset %q not found", id)
+}
+
+// findLocked finds an asset by ID. Must be called with mu held.
+func (r *Registry) findLocked(id string) *Asset {
+	for i := range r.assets {
+		if r.assets[i].ID == id {
+			return &r.assets[i]
+		}
+	}
+	return nil
+}
+
+// save writes the current assets to disk. Must be called with mu held.
+func (r *Registry) save() error {
+	data, err := json.MarshalIndent(r.assets, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal assets: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(r.path, data, 0644); err != nil {
+		return fmt.Errorf("write assets: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+// Package backup seals a wallet's data into a single passphrase-encrypted
+// file and opens it again. The dashboard reads and writes the same format
+// with WebCrypto, so the key derivation is PBKDF2 rather than the scrypt the
+// server-side stores use.
+package backup
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/primal-host/wallet/internal/asset"
+	"github.com/primal-host/wallet/internal/bookmark"
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/signer"
+)
+
+const (
+	// Format identifies a backup file.
+	Format  = "primal-wallet-backup"
+	version = 1
+	kdfName = "PBKDF2-SHA256"
+
+	// Iterations is the PBKDF2 work factor new backups are sealed with.
+	Iterations = 600000
+	// maxIterations bounds what a file may ask for, so a crafted backup
+	// can't make opening it take hours.
+	maxIterations = 10000000
+)
+
+// MinPassphrase is the shortest passphrase Seal accepts.
+const MinPassphrase = 8
+
+// ErrPassphrase means the passphrase is wrong or the file was modified.
+var ErrPassphrase = errors.New("wrong passphrase or corrupted backup")
+
+// KDF records how a file's key was derived from the passphrase.
+type KDF struct {
+	Name       string `json:"name"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+}
+
+// File is a sealed backup as written to disk.
+type File struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	CreatedAt  time.Time `json:"created_at"`
+	KDF        KDF       `json:"kdf"`
+	IV         []byte    `json:"iv"`
+	Ciphertext []byte    `json:"ciphertext"`
+}
+
+// Key is a browser vault key. The dashboard decrypts its keys to export them,
+// so a backup made from the CLI or API carries none.
+type Key struct {
+	Label      string    `json:"label"`
+	Address    string    `json:"address"`
+	PrivateKey string    `json:"private_key"` // hex
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Data is what a backup holds once opened.
+type Data struct {
+	Version     int                        `json:"version"`
+	CreatedAt   time.Time                  `json:"created_at"`
+	Keys        []Key                      `json:"keys"`
+	Endpoints   []endpoint.Endpoint        `json:"endpoints"`
+	Assets      []asset.Asset              `json:"assets"` // the endpoints' native currencies
+	Accounts    []signer.Account           `json:"accounts"`
+	Bookmarks   []bookmark.Bookmark        `json:"bookmarks"`
+	Preferences map[string]json.RawMessage `json:"preferences"`
+}
+
+// Seal encrypts plaintext, a Data in JSON, with passphrase and returns the
+// backup file's contents.
+func Seal(passphrase string, plaintext []byte) ([]byte, error) {
+	if len(passphrase) < MinPassphrase {
+		return nil, fmt.Errorf("passphrase must be at least %d characters", MinPassphrase)
+	}
+	f := File{Format: Format, Version: version, CreatedAt: time.Now().UTC(), KDF: KDF{Name: kdfName, Iterations: Iterations, Salt: make([]byte, 16)}}
+	if _, err := rand.Read(f.KDF.Salt); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(passphrase, f.KDF)
+	if err != nil {
+		return nil, err
+	}
+	f.IV = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(f.IV); err != nil {
+		return nil, err
+	}
+	f.Ciphertext = aead.Seal(nil, f.IV, plaintext, nil)
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal backup: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// Open decrypts a backup file's contents with passphrase and returns the
+// Data in JSON.
+func Open(passphrase string, contents []byte) ([]byte, error) {
+	var f File
+	if err := json.Unmarshal(contents, &f); err != nil || f.Format != Format {
+		return nil, fmt.Errorf("not a wallet backup")
+	}
+	if f.Version != version {
+		return nil, fmt.Errorf("unsupported backup version %d", f.Version)
+	}
+	if f.KDF.Name != kdfName || f.KDF.Iterations < 1 || f.KDF.Iterations > maxIterations || len(f.KDF.Salt) == 0 {
+		return nil, fmt.Errorf("unsupported backup key derivation")
+	}
+	aead, err := newAEAD(passphrase, f.KDF)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.IV) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid backup iv")
+	}
+	plaintext, err := aead.Open(nil, f.IV, f.Ciphertext, nil)
+	if err != nil {
+		return nil, ErrPassphrase
+	}
+	return plaintext, nil
+}
+
+// newAEAD derives the AES-256-GCM key for a file.
+func newAEAD(passphrase string, kdf KDF) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, kdf.Salt, kdf.Iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,530 @@
+// Package batch keeps batch sends: one account paying a list of recipients
+// the native currency or an ERC-20 token, either as a transfer to each or
+// as a single call to a Disperse contract. Recipients are read from CSV or
+// JSON and checked one by one before anything is built.
+package batch
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/primal-host/wallet/internal/abi"
+	"github.com/primal-host/wallet/internal/evm"
+	"github.com/primal-host/wallet/internal/journal"
+	"github.com/primal-host/wallet/internal/txbuild"
+)
+
+// MaxRecipients is the most recipients one batch pays.
+const MaxRecipients = 500
+
+// keepLimit is how many batches are kept; the oldest go first.
+const keepLimit = 200
+
+// DefaultDisperse is the Disperse contract of disperse.app, deployed at the
+// same address on Ethereum and most EVM chains.
+const DefaultDisperse = "0xD152f549545093347A162Dce210e7293f1452150"
+
+// Modes.
+const (
+	ModeTransfers = "transfers" // one transaction per recipient
+	ModeDisperse  = "disperse"  // one call to the Disperse contract, after an approval for a token
+)
+
+// StageQueued is the stage of a transaction waiting in the approval queue,
+// which the journal doesn't have yet.
+const StageQueued = "queued"
+
+// Transaction kinds.
+const (
+	KindTransfer = "transfer"
+	KindApprove  = "approve"
+	KindDisperse = "disperse"
+)
+
+var disperseABI = mustParse(`[
+  {"type":"function","name":"disperseEther","stateMutability":"payable","inputs":[{"name":"recipients","type":"address[]"},{"name":"values","type":"uint256[]"}]},
+  {"type":"function","name":"disperseToken","inputs":[{"name":"token","type":"address"},{"name":"recipients","type":"address[]"},{"name":"values","type":"uint256[]"}]},
+  {"type":"function","name":"transfer","inputs":[{"name":"to","type":"address"},{"name":"amount","type":"uint256"}]},
+  {"type":"function","name":"approve","inputs":[{"name":"spender","type":"address"},{"name":"amount","type":"uint256"}]}
+]`)
+
+// Recipient is one address a batch pays.
+type Recipient struct {
+	Address string `json:"address"`
+	Amount  string `json:"amount"`            // whole units, e.g. 1.5
+	Error   string `json:"error,omitempty"`   // why it can't be paid; the batch isn't built while any has one
+	Warning string `json:"warning,omitempty"` // worth a second look, e.g. a lookalike address
+}
+
+// Tx is one transaction of a batch.
+type Tx struct {
+	Kind       string            `json:"kind"`
+	Recipients []int             `json:"recipients,omitempty"` // indexes of the recipients it pays
+	Envelope   *txbuild.Envelope `json:"envelope"`
+
+	// Hash, Stage, and Error are read from the journal, which records the
+	// transaction once it is signed by any route, and the approval queue
+	// when the batch is returned. They aren't stored.
+	Hash  string `json:"hash,omitempty"`
+	Stage string `json:"stage,omitempty"` // a journal stage or StageQueued; empty until then
+	Error string `json:"error,omitempty"`
+}
+
+// Sent reports whether the transaction is queued, on its way, or mined, so
+// it isn't built or sent again.
+func (t Tx) Sent() bool {
+	return t.Stage != "" && t.Stage != journal.StageFailed
+}
+
+// Cost is what a batch's unsent transactions take from its sender, as last
+// built.
+type Cost struct {
+	Symbol       string `json:"symbol"`  // of what the recipients get
+	Total        string `json:"total"`   // the amounts together
+	MaxFee       string `json:"max_fee"` // the transactions' max fees together, in the native currency
+	Needed       string `json:"needed"`  // native currency the sender needs: the max fees, plus the total when it is native
+	Balance      string `json:"balance"` // the sender's native balance
+	TokenBalance string `json:"token_balance,omitempty"`
+	Short        bool   `json:"short,omitempty"` // a balance doesn't cover what's needed
+}
+
+// Progress counts a batch's transactions by how far they have got.
+type Progress struct {
+	Total     int  `json:"total"`
+	Unsent    int  `json:"unsent"`
+	Pending   int  `json:"pending"` // queued for approval, signed, or sent, not yet confirmed
+	Confirmed int  `json:"confirmed"`
+	Reverted  int  `json:"reverted"`
+	Failed    int  `json:"failed"` // did not go out; sending again rebuilds them
+	Done      bool `json:"done"`   // every transaction is confirmed or reverted
+}
+
+// Batch is a list of recipients, one sender, and the transactions that pay
+// them.
+type Batch struct {
+	ID         string      `json:"id"`
+	Name       string      `json:"name,omitempty"`
+	Endpoint   string      `json:"endpoint"`
+	From       string      `json:"from"`
+	Token      string      `json:"token,omitempty"` // ERC-20 address; empty for the native currency
+	Mode       string      `json:"mode"`
+	Recipients []Recipient `json:"recipients"`
+	Txs        []Tx        `json:"txs"`
+	Cost       Cost        `json:"cost"`
+	Progress   *Progress   `json:"progress,omitempty"` // set when returned
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// Count counts b's transactions by journal stage.
+func (b Batch) Count() Progress {
+	p := Progress{Total: len(b.Txs)}
+	for _, t := range b.Txs {
+		switch t.Stage {
+		case "":
+			p.Unsent++
+		case journal.StageConfirmed:
+			p.Confirmed++
+		case journal.StageReverted:
+			p.Reverted++
+		case journal.StageFailed:
+			p.Failed++
+		default:
+			p.Pending++
+		}
+	}
+	p.Done = p.Total > 0 && p.Confirmed+p.Reverted == p.Total
+	return p
+}
+
+// Parse reads recipients from CSV, one address and amount per line with an
+// optional header, separated by commas, semicolons, or tabs, or from JSON,
+// an array of {address, amount} objects or [address, amount] pairs.
+// Amounts are whole units. Lines starting with # are skipped.
+func Parse(data []byte) ([]Recipient, error) {
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	if len(data) == 0 {
+		return nil, errors.New("the list is empty")
+	}
+	var out []Recipient
+	var err error
+	if data[0] == '[' {
+		out, err = parseJSON(data)
+	} else {
+		out, err = parseCSV(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, errors.New("the list is empty")
+	}
+	if len(out) > MaxRecipients {
+		return nil, fmt.Errorf("%d recipients; a batch pays at most %d", len(out), MaxRecipients)
+	}
+	return out, nil
+}
+
+func parseCSV(data []byte) ([]Recipient, error) {
+	first, _, _ := bytes.Cut(data, []byte("\n"))
+	r := csv.NewReader(bytes.NewReader(data))
+	switch {
+	case bytes.ContainsRune(first, '\t'):
+		r.Comma = '\t'
+	case bytes.ContainsRune(first, ';'):
+		r.Comma = ';'
+	}
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	var out []Recipient
+	for n := 0; ; n++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse csv: %w", err)
+		}
+		if len(rec) == 1 && strings.TrimSpace(rec[0]) == "" {
+			continue
+		}
+		if len(rec) < 2 {
+			line, _ := r.FieldPos(0)
+			return nil, fmt.Errorf("line %d: want an address and an amount", line)
+		}
+		address, amount := strings.TrimSpace(rec[0]), strings.TrimSpace(rec[1])
+		// A first line without an address is a header.
+		if n == 0 && !strings.HasPrefix(strings.ToLower(address), "0x") {
+			continue
+		}
+		out = append(out, Recipient{Address: address, Amount: amount})
+	}
+}
+
+func parseJSON(data []byte) ([]Recipient, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var items []any
+	if err := dec.Decode(&items); err != nil {
+		return nil, fmt.Errorf("parse json: %w", err)
+	}
+	out := make([]Recipient, 0, len(items))
+	for i, item := range items {
+		var address, amount any
+		switch v := item.(type) {
+		case map[string]any:
+			address, amount = v["address"], v["amount"]
+		case []any:
+			if len(v) == 2 {
+				address, amount = v[0], v[1]
+			}
+		}
+		a, ok1 := address.(string)
+		n, ok2 := text(amount)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("item %d: want {\"address\", \"amount\"} or [address, amount]", i+1)
+		}
+		out = append(out, Recipient{Address: strings.TrimSpace(a), Amount: n})
+	}
+	return out, nil
+}
+
+// text is a JSON string or number as a string.
+func text(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return strings.TrimSpace(v), true
+	case json.Number:
+		return v.String(), true
+	}
+	return "", false
+}
+
+// Validate checks each recipient: a valid address other than the zero
+// address, listed once, and an amount above zero with at most decimals
+// places. Addresses are checksummed in place and problems are put in the
+// recipients' Error. It returns the amounts in the smallest unit, nil for
+// invalid recipients, and how many are invalid.
+func Validate(recipients []Recipient, decimals int) ([]*big.Int, int) {
+	amounts := make([]*big.Int, len(recipients))
+	seen := map[evm.Address]int{}
+	invalid := 0
+	for i := range recipients {
+		r := &recipients[i]
+		r.Error, r.Warning = "", ""
+		a, err := evm.ParseAddress(r.Address)
+		switch {
+		case err != nil:
+			r.Error = "invalid address: " + err.Error()
+		case a == evm.Address{}:
+			r.Error = "the zero address burns what it is sent"
+		default:
+			r.Address = a.Hex()
+			if j, ok := seen[a]; ok {
+				r.Error = fmt.Sprintf("listed already as recipient %d", j+1)
+			} else {
+				seen[a] = i
+			}
+		}
+		if r.Error == "" {
+			n, err := evm.ParseUnits(r.Amount, decimals)
+			switch {
+			case err != nil:
+				r.Error = "invalid amount: " + err.Error()
+			case n.Sign() == 0:
+				r.Error = "the amount is zero"
+			default:
+				amounts[i] = n
+			}
+		}
+		if r.Error != "" {
+			amounts[i] = nil
+			invalid++
+		}
+	}
+	return amounts, invalid
+}
+
+// Call is a transaction of a batch before it is built.
+type Call struct {
+	Kind       string
+	Recipients []int
+	To         string
+	Value      *big.Int
+	Data       []byte
+}
+
+// Plan returns the calls that pay amounts, all valid, from b's sender. In
+// disperse mode a token needs the Disperse contract at disperse allowed to
+// take the total first; allowance is what it may take now.
+func Plan(b Batch, amounts []*big.Int, disperse string, allowance *big.Int) ([]Call, error) {
+	total := Total(amounts)
+	var calls []Call
+	if b.Mode == ModeTransfers {
+		for i, r := range b.Recipients {
+			c := Call{Kind: KindTransfer, Recipients: []int{i}, To: r.Address, Value: amounts[i]}
+			if b.Token != "" {
+				data, err := encode("transfer", r.Address, amounts[i].String())
+				if err != nil {
+					return nil, err
+				}
+				c.To, c.Value, c.Data = b.Token, new(big.Int), data
+			}
+			calls = append(calls, c)
+		}
+		return calls, nil
+	}
+
+	addresses := make([]any, len(b.Recipients))
+	values := make([]any, len(b.Recipients))
+	all := make([]int, len(b.Recipients))
+	for i, r := range b.Recipients {
+		addresses[i], values[i], all[i] = r.Address, amounts[i].String(), i
+	}
+	if b.Token == "" {
+		data, err := encode("disperseEther", addresses, values)
+		if err != nil {
+			return nil, err
+		}
+		return []Call{{Kind: KindDisperse, Recipients: all, To: disperse, Value: total, Data: data}}, nil
+	}
+	if allowance == nil || allowance.Cmp(total) < 0 {
+		data, err := encode("approve", disperse, total.String())
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls, Call{Kind: KindApprove, To: b.Token, Value: new(big.Int), Data: data})
+	}
+	data, err := encode("disperseToken", b.Token, addresses, values)
+	if err != nil {
+		return nil, err
+	}
+	return append(calls, Call{Kind: KindDisperse, Recipients: all, To: disperse, Value: new(big.Int), Data: data}), nil
+}
+
+// DisperseGas is a generous gas limit for a Disperse token call to n
+// recipients, for when it can't be estimated because the approval it
+// depends on isn't mined yet. Unused gas isn't charged.
+func DisperseGas(n int) uint64 {
+	return 80_000 + 50_000*uint64(n)
+}
+
+// Total adds up amounts, skipping nils.
+func Total(amounts []*big.Int) *big.Int {
+	total := new(big.Int)
+	for _, n := range amounts {
+		if n != nil {
+			total.Add(total, n)
+		}
+	}
+	return total
+}
+
+func encode(name string, args ...any) ([]byte, error) {
+	f, err := abi.Lookup(disperseABI, name)
+	if err != nil {
+		return nil, err
+	}
+	return abi.Encode(f, args)
+}
+
+func mustParse(s string) []abi.Function {
+	funcs, err := abi.Parse([]byte(s))
+	if err != nil {
+		panic(err)
+	}
+	return funcs
+}
+
+// Store keeps batches in a JSON file.
+type Store struct {
+	mu      sync.Mutex
+	batches []Batch // oldest first
+	path    string
+}
+
+// NewStore loads batches from a JSON file. If the file doesn't exist,
+// starts empty.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path, batches: []Batch{}}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("read batches: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.batches); err != nil {
+		return nil, fmt.Errorf("parse batches: %w", err)
+	}
+	return s, nil
+}
+
+// List returns batches newest first.
+func (s *Store) List() []Batch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Batch, 0, len(s.batches))
+	for i := len(s.batches) - 1; i >= 0; i-- {
+		out = append(out, s.batches[i])
+	}
+	return out
+}
+
+// Get returns a batch by ID.
+func (s *Store) Get(id string) (Batch, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := s.index(id); i >= 0 {
+		return s.batches[i], true
+	}
+	return Batch{}, false
+}
+
+// Add stores a built batch under a new ID. The oldest batches beyond
+// keepLimit are dropped.
+func (s *Store) Add(b Batch) (Batch, error) {
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return Batch{}, err
+	}
+	now := time.Now().UTC()
+	b.ID = hex.EncodeToString(id)
+	b.CreatedAt, b.UpdatedAt = now, now
+	b.Progress = nil
+	b.Txs = stored(b.Txs)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.batches
+	s.batches = append(s.batches[:len(old):len(old)], b)
+	if len(s.batches) > keepLimit {
+		s.batches = s.batches[len(s.batches)-keepLimit:]
+	}
+	if err := s.save(); err != nil {
+		s.batches = old
+		return Batch{}, err
+	}
+	return b, nil
+}
+
+// SetTxs replaces a batch's transactions and cost, as rebuilt.
+func (s *Store) SetTxs(id string, txs []Tx, cost Cost) (Batch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i < 0 {
+		return Batch{}, fmt.Errorf("batch %q not found", id)
+	}
+	old := s.batches[i]
+	s.batches[i].Txs = stored(txs)
+	s.batches[i].Cost = cost
+	s.batches[i].UpdatedAt = time.Now().UTC()
+	if err := s.save(); err != nil {
+		s.batches[i] = old
+		return Batch{}, err
+	}
+	return s.batches[i], nil
+}
+
+// Delete forgets a batch. Transactions already sent are unaffected.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i < 0 {
+		return fmt.Errorf("batch %q not found", id)
+	}
+	old := s.batches
+	s.batches = append(s.batches[:i:i], s.batches[i+1:]...)
+	if err := s.save(); err != nil {
+		s.batches = old
+		return err
+	}
+	return nil
+}
+
+// stored is txs without what is read from the journal.
+func stored(txs []Tx) []Tx {
+	out := make([]Tx, len(txs))
+	for i, t := range txs {
+		t.Hash, t.Stage, t.Error = "", "", ""
+		out[i] = t
+	}
+	return out
+}
+
+// index returns the position of id, or -1. Must be called with mu held.
+func (s *Store) index(id string) int {
+	for i := range s.batches {
+		if s.batches[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// save writes batches to disk. Must be called with mu held.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.batches, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal batches: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("write batches: %w", err)
+	}
+	return nil
+}
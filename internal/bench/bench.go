@@ -0,0 +1,259 @@
+// Package bench runs a standard battery of requests against an endpoint
+// and scores it, so providers can be compared on the same terms. The last
+// result for each endpoint is kept in a JSON file.
+package bench
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// samples is how many times each method is called.
+const samples = 5
+
+// batchSize is how many calls the batch test sends at once.
+const batchSize = 10
+
+// logRanges are the block ranges eth_getLogs is tried over, widest first.
+// Providers cap the range a single query may span.
+var logRanges = []uint64{100_000, 10_000, 5_000, 2_000, 1_000, 100, 10}
+
+// zeroTopic is the topic logs are filtered on, which no event has, so the
+// range limit is tested without fetching logs.
+const zeroTopic = "0x0000000000000000000000000000000000000000000000000000000000000000"
+
+// MethodStats is the latency distribution of one method's calls.
+type MethodStats struct {
+	Method  string `json:"method"`
+	Calls   int    `json:"calls"`
+	Errors  int    `json:"errors"`
+	MinMS   int64  `json:"min_ms"`
+	P50MS   int64  `json:"p50_ms"`
+	P90MS   int64  `json:"p90_ms"`
+	MaxMS   int64  `json:"max_ms"`
+	LastErr string `json:"last_error,omitempty"`
+}
+
+// Result is an endpoint's benchmark.
+type Result struct {
+	Endpoint string        `json:"endpoint"` // endpoint ID
+	Name     string        `json:"name"`
+	ChainID  string        `json:"chain_id"`
+	RanAt    time.Time     `json:"ran_at"`
+	Methods  []MethodStats `json:"methods"`
+
+	Batch        bool   `json:"batch"`          // answered a batch of batchSize calls in full
+	BatchMS      int64  `json:"batch_ms"`       // how long the batch took
+	MaxLogsRange uint64 `json:"max_logs_range"` // widest eth_getLogs block range served, of logRanges; 0 if none
+	WebSocket    bool   `json:"websocket"`
+
+	// Score is out of 100: up to 50 for the median latency of all calls
+	// (50·100/(100+ms)), 20 for the share answered, 10 for batches, 15
+	// for the logs range (3 per power of ten up to 100000), and 5 for
+	// WebSockets.
+	Score int `json:"score"`
+}
+
+// Run benchmarks ep: each common method is called a few times in a row,
+// then a batch is sent, eth_getLogs is tried over ever narrower ranges, and
+// the WebSocket transport is probed. It fails if the endpoint doesn't
+// answer eth_chainId.
+func Run(ctx context.Context, ep endpoint.Endpoint) (Result, error) {
+	r := Result{Endpoint: ep.ID, Name: ep.Name, RanAt: time.Now().UTC()}
+	raw, err := endpoint.RPCCall(ctx, ep, "eth_chainId", nil)
+	if err != nil {
+		return Result{}, fmt.Errorf("endpoint is offline: %w", err)
+	}
+	if err := json.Unmarshal(raw, &r.ChainID); err != nil {
+		return Result{}, fmt.Errorf("unexpected eth_chainId result %s", raw)
+	}
+
+	var all []int64
+	answered, total := 0, 0
+	for _, c := range []endpoint.Call{
+		{Method: "eth_blockNumber"},
+		{Method: "eth_chainId"},
+		{Method: "eth_gasPrice"},
+		{Method: "eth_getBalance", Params: []any{evm.Address{}.Hex(), "latest"}},
+		{Method: "eth_getBlockByNumber", Params: []any{"latest", false}},
+		{Method: "eth_getLogs", Params: []any{map[string]any{"fromBlock": "latest", "toBlock": "latest"}}},
+	} {
+		st := MethodStats{Method: c.Method}
+		var ms []int64
+		for range samples {
+			if ctx.Err() != nil {
+				return Result{}, ctx.Err()
+			}
+			start := time.Now()
+			_, err := endpoint.RPCCall(ctx, ep, c.Method, c.Params)
+			st.Calls++
+			if err != nil {
+				st.Errors++
+				st.LastErr = err.Error()
+				continue
+			}
+			ms = append(ms, time.Since(start).Milliseconds())
+		}
+		if len(ms) > 0 {
+			slices.Sort(ms)
+			st.MinMS, st.P50MS, st.P90MS, st.MaxMS = ms[0], percentile(ms, 0.5), percentile(ms, 0.9), ms[len(ms)-1]
+		}
+		all = append(all, ms...)
+		answered += len(ms)
+		total += st.Calls
+		r.Methods = append(r.Methods, st)
+	}
+
+	calls := make([]endpoint.Call, batchSize)
+	for i := range calls {
+		calls[i] = endpoint.Call{Method: "eth_blockNumber"}
+	}
+	start := time.Now()
+	if replies, err := endpoint.RPCBatch(ctx, ep, calls); err == nil {
+		r.BatchMS = time.Since(start).Milliseconds()
+		r.Batch = !slices.ContainsFunc(replies, func(rep endpoint.Reply) bool { return rep.Err != nil })
+	}
+
+	r.MaxLogsRange = maxLogsRange(ctx, ep)
+	r.WebSocket = endpoint.Probe(ctx, ep).WebSocket
+	if ctx.Err() != nil {
+		return Result{}, ctx.Err()
+	}
+
+	slices.Sort(all)
+	r.Score = score(r, all, answered, total)
+	return r, nil
+}
+
+// maxLogsRange returns the widest of logRanges ep answers eth_getLogs over,
+// ending at its head.
+func maxLogsRange(ctx context.Context, ep endpoint.Endpoint) uint64 {
+	raw, err := endpoint.RPCCall(ctx, ep, "eth_blockNumber", nil)
+	if err != nil {
+		return 0
+	}
+	var hex string
+	if json.Unmarshal(raw, &hex) != nil {
+		return 0
+	}
+	n, err := evm.ParseQuantity(hex)
+	if err != nil || !n.IsUint64() {
+		return 0
+	}
+	head := n.Uint64()
+	for _, span := range logRanges {
+		if span > head {
+			continue
+		}
+		filter := map[string]any{
+			"fromBlock": fmt.Sprintf("0x%x", head-span+1),
+			"toBlock":   fmt.Sprintf("0x%x", head),
+			"topics":    []any{zeroTopic},
+		}
+		if _, err := endpoint.RPCCall(ctx, ep, "eth_getLogs", []any{filter}); err == nil {
+			return span
+		}
+		if ctx.Err() != nil {
+			return 0
+		}
+	}
+	return 0
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted ms.
+func percentile(ms []int64, p float64) int64 {
+	i := int(math.Ceil(p*float64(len(ms)))) - 1
+	return ms[max(i, 0)]
+}
+
+// score rates r out of 100 given the sorted latencies of all answered
+// calls, as Result.Score describes.
+func score(r Result, ms []int64, answered, total int) int {
+	var s float64
+	if len(ms) > 0 {
+		s += 50 * 100 / (100 + float64(percentile(ms, 0.5)))
+	}
+	if total > 0 {
+		s += 20 * float64(answered) / float64(total)
+	}
+	if r.Batch {
+		s += 10
+	}
+	if r.MaxLogsRange > 0 {
+		s += 3 * min(math.Log10(float64(r.MaxLogsRange)), 5)
+	}
+	if r.WebSocket {
+		s += 5
+	}
+	return int(math.Round(s))
+}
+
+// Store keeps the last benchmark of each endpoint in a JSON file.
+type Store struct {
+	mu      sync.RWMutex
+	results map[string]Result // by endpoint ID
+	path    string
+}
+
+// NewStore loads benchmarks from a JSON file. If the file doesn't exist,
+// starts empty.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path, results: map[string]Result{}}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("read benchmarks: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.results); err != nil {
+		return nil, fmt.Errorf("parse benchmarks: %w", err)
+	}
+	return s, nil
+}
+
+// Get returns the last benchmark of the endpoint with the given ID.
+func (s *Store) Get(id string) (Result, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.results[id]
+	return r, ok
+}
+
+// Put keeps r as its endpoint's last benchmark.
+func (s *Store) Put(r Result) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, had := s.results[r.Endpoint]
+	s.results[r.Endpoint] = r
+	if err := s.save(); err != nil {
+		if had {
+			s.results[r.Endpoint] = prev
+		} else {
+			delete(s.results, r.Endpoint)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.results, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal benchmarks: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("write benchmarks: %w", err)
+	}
+	return nil
+}
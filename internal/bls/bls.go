@@ -0,0 +1,112 @@
+package bls
+
+import (
+	"errors"
+	"math/big"
+)
+
+// ateLoop is |x|, the absolute value of the BLS parameter x =
+// -0xd201000000010000, over which the Miller loop runs.
+var ateLoop = hexInt("d201000000010000")
+
+// finalExp is (p¹² - 1)/r.
+var finalExp = func() *big.Int {
+	e := new(big.Int).Exp(p, big.NewInt(12), nil)
+	e.Sub(e, big.NewInt(1))
+	return e.Div(e, r)
+}()
+
+// PublicKey is a public key, a point of G1.
+type PublicKey struct{ p g1 }
+
+// Signature is a signature, a point of G2.
+type Signature struct{ p g2 }
+
+// PublicKeyFromBytes decompresses a 48-byte public key. It isn't checked
+// to be in G1, so keys must come from a source that did, such as the
+// beacon chain's state.
+func PublicKeyFromBytes(b []byte) (*PublicKey, error) {
+	pt, err := decodeG1(b)
+	if err != nil {
+		return nil, err
+	}
+	if pt.inf {
+		return nil, errors.New("public key is the identity")
+	}
+	return &PublicKey{pt}, nil
+}
+
+// SignatureFromBytes decompresses a 96-byte signature and checks that it
+// is in G2.
+func SignatureFromBytes(b []byte) (*Signature, error) {
+	pt, err := decodeG2(b)
+	if err != nil {
+		return nil, err
+	}
+	if !pt.inSubgroup() {
+		return nil, errors.New("signature isn't in G2")
+	}
+	return &Signature{pt}, nil
+}
+
+// AggregatePublicKeys adds keys into the key their signers' aggregate
+// signature verifies under.
+func AggregatePublicKeys(keys []*PublicKey) *PublicKey {
+	sum := g1{inf: true}
+	for _, k := range keys {
+		sum = sum.add(k.p)
+	}
+	return &PublicKey{sum}
+}
+
+// Verify reports whether sig is pk's signature of msg.
+func Verify(pk *PublicKey, msg []byte, sig *Signature) bool {
+	if pk.p.inf || sig.p.inf {
+		return false
+	}
+	// e(pk, H(msg)) = e(g, sig), checked as e(pk, H(msg))·e(-g, sig) = 1.
+	f := miller(pk.p, hashToG2(msg, dst)).mul(miller(g1Gen.neg(), sig.p))
+	return f.exp(finalExp).isOne()
+}
+
+// FastAggregateVerify reports whether sig is the aggregate signature of
+// msg by every one of keys.
+func FastAggregateVerify(keys []*PublicKey, msg []byte, sig *Signature) bool {
+	if len(keys) == 0 {
+		return false
+	}
+	return Verify(AggregatePublicKeys(keys), msg, sig)
+}
+
+// miller is the Miller loop of the optimal ate pairing over |x|, whose
+// result after the final exponentiation is a pairing of a and b. Points
+// of E' are mapped to E(Fp12) by (x, y) ↦ (x/w², y/w³), and each line is
+// scaled by w³, which the final exponentiation removes.
+func miller(a g1, b g2) fp12 {
+	f := fp12One()
+	t := b
+	for i := ateLoop.BitLen() - 2; i >= 0; i-- {
+		l, _ := t.slope(t)
+		f = f.mul(f).mul(line(t, l, a))
+		t = t.addWithSlope(t, l)
+		if ateLoop.Bit(i) == 1 {
+			l, _ = t.slope(b)
+			f = f.mul(line(t, l, a))
+			t = t.addWithSlope(b, l)
+		}
+	}
+	return f
+}
+
+// line evaluates at a the line of slope l through t, times w³:
+// (l·xₜ - yₜ) - l·xₐ·w² + yₐ·w³.
+func line(t g2, l fp2, a g1) fp12 {
+	var z fp12
+	for k := range 6 {
+		z[k] = fp2Zero()
+	}
+	z[0] = l.mul(t.x).sub(t.y)
+	z[2] = l.mulFp(a.x).neg()
+	z[3] = fp2{new(big.Int).Set(a.y), new(big.Int)}
+	return z
+}
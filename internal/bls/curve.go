@@ -0,0 +1,224 @@
+package bls
+
+import (
+	"errors"
+	"math/big"
+)
+
+// g1 is an affine point of E(Fp): y² = x³ + 4.
+type g1 struct {
+	x, y *big.Int
+	inf  bool
+}
+
+// g2 is an affine point of the twist E'(Fp2): y² = x³ + 4(1 + i).
+type g2 struct {
+	x, y fp2
+	inf  bool
+}
+
+var (
+	b1 = big.NewInt(4)
+	b2 = fp2FromInts(4, 4)
+
+	g1Gen = g1{
+		x: hexInt("17f1d3a73197d7942695638c4fa9ac0fc3688c4f9774b905a14e3a3f171bac586c55e83ff97a1aeffb3af00adb22c6bb"),
+		y: hexInt("08b3f481e3aaa0f1a09e30ed741d8ae4fcf5e095d5d00af600db18cb2c04b3edd03cc744a2888ae40caa232946c5e7e1"),
+	}
+)
+
+func (a g1) onCurve() bool {
+	if a.inf {
+		return true
+	}
+	return fpMul(a.y, a.y).Cmp(fpAdd(fpMul(fpMul(a.x, a.x), a.x), b1)) == 0
+}
+
+func (a g1) neg() g1 {
+	if a.inf {
+		return a
+	}
+	return g1{x: a.x, y: fpNeg(a.y)}
+}
+
+func (a g1) add(b g1) g1 {
+	switch {
+	case a.inf:
+		return b
+	case b.inf:
+		return a
+	}
+	var l *big.Int
+	if a.x.Cmp(b.x) == 0 {
+		if a.y.Cmp(b.y) != 0 || a.y.Sign() == 0 {
+			return g1{inf: true}
+		}
+		// λ = 3x²/2y
+		l = fpMul(fpMul(big.NewInt(3), fpMul(a.x, a.x)), fpInv(fpAdd(a.y, a.y)))
+	} else {
+		l = fpMul(fpSub(b.y, a.y), fpInv(fpSub(b.x, a.x)))
+	}
+	x := fpSub(fpSub(fpMul(l, l), a.x), b.x)
+	return g1{x: x, y: fpSub(fpMul(l, fpSub(a.x, x)), a.y)}
+}
+
+func (a g1) scale(k *big.Int) g1 {
+	z := g1{inf: true}
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		z = z.add(z)
+		if k.Bit(i) == 1 {
+			z = z.add(a)
+		}
+	}
+	return z
+}
+
+func (a g2) onCurve() bool {
+	if a.inf {
+		return true
+	}
+	return a.y.square().equal(a.x.square().mul(a.x).add(b2))
+}
+
+func (a g2) neg() g2 {
+	if a.inf {
+		return a
+	}
+	return g2{x: a.x, y: a.y.neg()}
+}
+
+// slope returns the slope of the line through a and b, the tangent when
+// they are equal, or false when it is vertical.
+func (a g2) slope(b g2) (fp2, bool) {
+	if a.x.equal(b.x) {
+		if !a.y.equal(b.y) || a.y.isZero() {
+			return fp2{}, false
+		}
+		return a.x.square().mulFp(big.NewInt(3)).mul(a.y.add(a.y).inv()), true
+	}
+	return b.y.sub(a.y).mul(b.x.sub(a.x).inv()), true
+}
+
+func (a g2) add(b g2) g2 {
+	switch {
+	case a.inf:
+		return b
+	case b.inf:
+		return a
+	}
+	l, ok := a.slope(b)
+	if !ok {
+		return g2{inf: true}
+	}
+	return a.addWithSlope(b, l)
+}
+
+func (a g2) addWithSlope(b g2, l fp2) g2 {
+	x := l.square().sub(a.x).sub(b.x)
+	return g2{x: x, y: l.mul(a.x.sub(x)).sub(a.y)}
+}
+
+func (a g2) scale(k *big.Int) g2 {
+	z := g2{inf: true}
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		z = z.add(z)
+		if k.Bit(i) == 1 {
+			z = z.add(a)
+		}
+	}
+	return z
+}
+
+// inSubgroup reports whether a is in the order-r subgroup, G2.
+func (a g2) inSubgroup() bool { return a.scale(r).inf }
+
+// Compressed points carry three flags in their first byte: compressed,
+// infinity, and whether y is the larger of ±y.
+const (
+	flagCompressed = 0x80
+	flagInfinity   = 0x40
+	flagSign       = 0x20
+)
+
+// decodeFp reads a big-endian field element, rejecting values ≥ p.
+func decodeFp(b []byte) (*big.Int, error) {
+	n := new(big.Int).SetBytes(b)
+	if n.Cmp(p) >= 0 {
+		return nil, errors.New("coordinate out of range")
+	}
+	return n, nil
+}
+
+// decodeG1 decompresses a 48-byte G1 point.
+func decodeG1(b []byte) (g1, error) {
+	if len(b) != 48 {
+		return g1{}, errors.New("public key must be 48 bytes")
+	}
+	flags := b[0] & 0xe0
+	if flags&flagCompressed == 0 {
+		return g1{}, errors.New("public key isn't compressed")
+	}
+	buf := append([]byte{b[0] &^ 0xe0}, b[1:]...)
+	if flags&flagInfinity != 0 {
+		if flags&flagSign != 0 || new(big.Int).SetBytes(buf).Sign() != 0 {
+			return g1{}, errors.New("invalid point at infinity")
+		}
+		return g1{inf: true}, nil
+	}
+	x, err := decodeFp(buf)
+	if err != nil {
+		return g1{}, err
+	}
+	y, ok := fpSqrt(fpAdd(fpMul(fpMul(x, x), x), b1))
+	if !ok {
+		return g1{}, errors.New("point isn't on the curve")
+	}
+	if (y.Cmp(pMinus1Half) > 0) != (flags&flagSign != 0) {
+		y = fpNeg(y)
+	}
+	return g1{x: x, y: y}, nil
+}
+
+// decodeG2 decompresses a 96-byte G2 point, x's imaginary part first.
+func decodeG2(b []byte) (g2, error) {
+	if len(b) != 96 {
+		return g2{}, errors.New("signature must be 96 bytes")
+	}
+	flags := b[0] & 0xe0
+	if flags&flagCompressed == 0 {
+		return g2{}, errors.New("signature isn't compressed")
+	}
+	buf := append([]byte{b[0] &^ 0xe0}, b[1:]...)
+	if flags&flagInfinity != 0 {
+		if flags&flagSign != 0 || new(big.Int).SetBytes(buf).Sign() != 0 {
+			return g2{}, errors.New("invalid point at infinity")
+		}
+		return g2{inf: true}, nil
+	}
+	c1, err := decodeFp(buf[:48])
+	if err != nil {
+		return g2{}, err
+	}
+	c0, err := decodeFp(buf[48:])
+	if err != nil {
+		return g2{}, err
+	}
+	x := fp2{c0, c1}
+	y, ok := x.square().mul(x).add(b2).sqrt()
+	if !ok {
+		return g2{}, errors.New("point isn't on the curve")
+	}
+	if larger(y) != (flags&flagSign != 0) {
+		y = y.neg()
+	}
+	return g2{x: x, y: y}, nil
+}
+
+// larger reports whether y is the lexicographically larger of ±y,
+// comparing the imaginary parts first.
+func larger(y fp2) bool {
+	if y.c1.Sign() != 0 {
+		return y.c1.Cmp(pMinus1Half) > 0
+	}
+	return y.c0.Cmp(pMinus1Half) > 0
+}
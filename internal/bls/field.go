@@ -0,0 +1,227 @@
+// Package bls verifies BLS signatures over the BLS12-381 curve as the
+// beacon chain makes them: public keys in G1, signatures in G2, and
+// messages hashed to G2 with the proof-of-possession ciphersuite. It only
+// verifies; there is no signing. Field arithmetic uses math/big, which is
+// slow but ample for checking a sync committee's signature each slot.
+package bls
+
+import "math/big"
+
+// p is the base field modulus.
+var p = hexInt("1a0111ea397fe69a4b1ba7b6434bacd764774b84f38512bf6730d2a0f6b0f6241eabfffeb153ffffb9feffffffffaaab")
+
+// r is the order of G1 and G2.
+var r = hexInt("73eda753299d7d483339d80809a1d80553bda402fffe5bfeffffffff00000001")
+
+var (
+	pMinus1Half = new(big.Int).Rsh(new(big.Int).Sub(p, big.NewInt(1)), 1) // (p-1)/2
+	pPlus1Quart = new(big.Int).Rsh(new(big.Int).Add(p, big.NewInt(1)), 2) // (p+1)/4
+)
+
+func hexInt(s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("bls: bad constant " + s)
+	}
+	return n
+}
+
+// Elements of Fp are *big.Int in [0, p). The helpers return new values and
+// never modify their arguments.
+
+func fpAdd(a, b *big.Int) *big.Int {
+	z := new(big.Int).Add(a, b)
+	if z.Cmp(p) >= 0 {
+		z.Sub(z, p)
+	}
+	return z
+}
+
+func fpSub(a, b *big.Int) *big.Int {
+	z := new(big.Int).Sub(a, b)
+	if z.Sign() < 0 {
+		z.Add(z, p)
+	}
+	return z
+}
+
+func fpNeg(a *big.Int) *big.Int {
+	if a.Sign() == 0 {
+		return new(big.Int)
+	}
+	return new(big.Int).Sub(p, a)
+}
+
+func fpMul(a, b *big.Int) *big.Int {
+	z := new(big.Int).Mul(a, b)
+	return z.Mod(z, p)
+}
+
+func fpInv(a *big.Int) *big.Int {
+	if a.Sign() == 0 {
+		return new(big.Int)
+	}
+	return new(big.Int).ModInverse(a, p)
+}
+
+// fpSqrt returns a square root of a, if it has one. p ≡ 3 (mod 4), so it
+// is a^((p+1)/4).
+func fpSqrt(a *big.Int) (*big.Int, bool) {
+	z := new(big.Int).Exp(a, pPlus1Quart, p)
+	return z, fpMul(z, z).Cmp(a) == 0
+}
+
+// fp2 is an element c0 + c1·i of Fp2 = Fp[i]/(i² + 1).
+type fp2 struct{ c0, c1 *big.Int }
+
+func fp2Zero() fp2 { return fp2{new(big.Int), new(big.Int)} }
+func fp2One() fp2  { return fp2{big.NewInt(1), new(big.Int)} }
+
+func fp2FromInts(c0, c1 int64) fp2 {
+	return fp2{new(big.Int).Mod(big.NewInt(c0), p), new(big.Int).Mod(big.NewInt(c1), p)}
+}
+
+func (a fp2) isZero() bool     { return a.c0.Sign() == 0 && a.c1.Sign() == 0 }
+func (a fp2) equal(b fp2) bool { return a.c0.Cmp(b.c0) == 0 && a.c1.Cmp(b.c1) == 0 }
+
+func (a fp2) add(b fp2) fp2 { return fp2{fpAdd(a.c0, b.c0), fpAdd(a.c1, b.c1)} }
+func (a fp2) sub(b fp2) fp2 { return fp2{fpSub(a.c0, b.c0), fpSub(a.c1, b.c1)} }
+func (a fp2) neg() fp2      { return fp2{fpNeg(a.c0), fpNeg(a.c1)} }
+func (a fp2) conj() fp2     { return fp2{new(big.Int).Set(a.c0), fpNeg(a.c1)} }
+
+func (a fp2) mul(b fp2) fp2 {
+	return fp2{
+		fpSub(fpMul(a.c0, b.c0), fpMul(a.c1, b.c1)),
+		fpAdd(fpMul(a.c0, b.c1), fpMul(a.c1, b.c0)),
+	}
+}
+
+func (a fp2) square() fp2 { return a.mul(a) }
+
+func (a fp2) mulFp(b *big.Int) fp2 { return fp2{fpMul(a.c0, b), fpMul(a.c1, b)} }
+
+// mulXi multiplies by ξ = 1 + i, the non-residue Fp12 is built on.
+func (a fp2) mulXi() fp2 { return fp2{fpSub(a.c0, a.c1), fpAdd(a.c0, a.c1)} }
+
+func (a fp2) inv() fp2 {
+	norm := fpInv(fpAdd(fpMul(a.c0, a.c0), fpMul(a.c1, a.c1)))
+	return fp2{fpMul(a.c0, norm), fpNeg(fpMul(a.c1, norm))}
+}
+
+func (a fp2) exp(e *big.Int) fp2 {
+	z := fp2One()
+	for i := e.BitLen() - 1; i >= 0; i-- {
+		z = z.square()
+		if e.Bit(i) == 1 {
+			z = z.mul(a)
+		}
+	}
+	return z
+}
+
+// isSquare reports whether a is a square, which it is when its norm is a
+// square in Fp.
+func (a fp2) isSquare() bool {
+	norm := fpAdd(fpMul(a.c0, a.c0), fpMul(a.c1, a.c1))
+	return new(big.Int).Exp(norm, pMinus1Half, p).Cmp(big.NewInt(1)) <= 0
+}
+
+// sqrt returns a square root of a, if it has one: with n = √(c0² + c1²),
+// x0 = √((c0 ± n)/2) and x1 = c1/(2·x0).
+func (a fp2) sqrt() (fp2, bool) {
+	if a.c1.Sign() == 0 {
+		if s, ok := fpSqrt(a.c0); ok {
+			return fp2{s, new(big.Int)}, true
+		}
+		// c0 is a non-residue, so -c0 is a residue and √c0 = √(-c0)·i.
+		s, _ := fpSqrt(fpNeg(a.c0))
+		return fp2{new(big.Int), s}, true
+	}
+	n, ok := fpSqrt(fpAdd(fpMul(a.c0, a.c0), fpMul(a.c1, a.c1)))
+	if !ok {
+		return fp2{}, false
+	}
+	half := fpInv(big.NewInt(2))
+	x0, ok := fpSqrt(fpMul(fpAdd(a.c0, n), half))
+	if !ok {
+		if x0, ok = fpSqrt(fpMul(fpSub(a.c0, n), half)); !ok {
+			return fp2{}, false
+		}
+	}
+	z := fp2{x0, fpMul(a.c1, fpInv(fpAdd(x0, x0)))}
+	return z, z.square().equal(a)
+}
+
+// sgn0 is the sign of a as RFC 9380 defines it.
+func (a fp2) sgn0() uint {
+	sign0 := a.c0.Bit(0)
+	sign1 := a.c1.Bit(0)
+	if sign0 == 1 || a.c0.Sign() == 0 && sign1 == 1 {
+		return 1
+	}
+	return 0
+}
+
+// fp12 is an element of Fp12 = Fp2[w]/(w⁶ - ξ), the coefficient of wᵏ at
+// index k.
+type fp12 [6]fp2
+
+func fp12One() fp12 {
+	var z fp12
+	z[0] = fp2One()
+	for k := 1; k < 6; k++ {
+		z[k] = fp2Zero()
+	}
+	return z
+}
+
+func (a fp12) isOne() bool {
+	if !a[0].equal(fp2One()) {
+		return false
+	}
+	for k := 1; k < 6; k++ {
+		if !a[k].isZero() {
+			return false
+		}
+	}
+	return true
+}
+
+func (a fp12) mul(b fp12) fp12 {
+	var lo, hi [6]fp2
+	for k := range 6 {
+		lo[k], hi[k] = fp2Zero(), fp2Zero()
+	}
+	for i := range 6 {
+		if a[i].isZero() {
+			continue
+		}
+		for j := range 6 {
+			if b[j].isZero() {
+				continue
+			}
+			t := a[i].mul(b[j])
+			if i+j < 6 {
+				lo[i+j] = lo[i+j].add(t)
+			} else {
+				hi[i+j-6] = hi[i+j-6].add(t)
+			}
+		}
+	}
+	var z fp12
+	for k := range 6 {
+		z[k] = lo[k].add(hi[k].mulXi())
+	}
+	return z
+}
+
+func (a fp12) exp(e *big.Int) fp12 {
+	z := fp12One()
+	for i := e.BitLen() - 1; i >= 0; i-- {
+		z = z.mul(z)
+		if e.Bit(i) == 1 {
+			z = z.mul(a)
+		}
+	}
+	return z
+}
@@ -0,0 +1,146 @@
+package bls
+
+import (
+	"crypto/sha256"
+	"math/big"
+)
+
+// dst is the domain separation tag of Ethereum's ciphersuite,
+// BLS_SIG_BLS12381G2_XMD:SHA-256_SSWU_RO_POP_.
+const dst = "BLS_SIG_BLS12381G2_XMD:SHA-256_SSWU_RO_POP_"
+
+// The simplified SWU map targets E2': y² = x³ + A'x + B', 3-isogenous to
+// E', with Z = -(2 + i).
+var (
+	sswuA = fp2FromInts(0, 240)
+	sswuB = fp2FromInts(1012, 1012)
+	sswuZ = fp2FromInts(-2, -1)
+)
+
+// isoK are the coefficients of the 3-isogeny from E2' to E', lowest degree
+// first: x numerator, x denominator, y numerator, y denominator (RFC 9380,
+// appendix E.3). The denominators are monic; their leading 1 is implied.
+var isoK = [4][]fp2{
+	{
+		{hexInt("05c759507e8e333ebb5b7a9a47d7ed8532c52d39fd3a042a88b58423c50ae15d5c2638e343d9c71c6238aaaaaaaa97d6"), hexInt("05c759507e8e333ebb5b7a9a47d7ed8532c52d39fd3a042a88b58423c50ae15d5c2638e343d9c71c6238aaaaaaaa97d6")},
+		{new(big.Int), hexInt("11560bf17baa99bc32126fced787c88f984f87adf7ae0c7f9a208c6b4f20a4181472aaa9cb8d555526a9ffffffffc71a")},
+		{hexInt("11560bf17baa99bc32126fced787c88f984f87adf7ae0c7f9a208c6b4f20a4181472aaa9cb8d555526a9ffffffffc71e"), hexInt("08ab05f8bdd54cde190937e76bc3e447cc27c3d6fbd7063fcd104635a790520c0a395554e5c6aaaa9354ffffffffe38d")},
+		{hexInt("171d6541fa38ccfaed6dea691f5fb614cb14b4e7f4e810aa22d6108f142b85757098e38d0f671c7188e2aaaaaaaa5ed1"), new(big.Int)},
+	},
+	{
+		{new(big.Int), hexInt("1a0111ea397fe69a4b1ba7b6434bacd764774b84f38512bf6730d2a0f6b0f6241eabfffeb153ffffb9feffffffffaa63")},
+		{big.NewInt(0xc), hexInt("1a0111ea397fe69a4b1ba7b6434bacd764774b84f38512bf6730d2a0f6b0f6241eabfffeb153ffffb9feffffffffaa9f")},
+	},
+	{
+		{hexInt("1530477c7ab4113b59a4c18b076d11930f7da5d4a07f649bf54439d87d27e500fc8c25ebf8c92f6812cfc71c71c6d706"), hexInt("1530477c7ab4113b59a4c18b076d11930f7da5d4a07f649bf54439d87d27e500fc8c25ebf8c92f6812cfc71c71c6d706")},
+		{new(big.Int), hexInt("05c759507e8e333ebb5b7a9a47d7ed8532c52d39fd3a042a88b58423c50ae15d5c2638e343d9c71c6238aaaaaaaa97be")},
+		{hexInt("11560bf17baa99bc32126fced787c88f984f87adf7ae0c7f9a208c6b4f20a4181472aaa9cb8d555526a9ffffffffc71c"), hexInt("08ab05f8bdd54cde190937e76bc3e447cc27c3d6fbd7063fcd104635a790520c0a395554e5c6aaaa9354ffffffffe38f")},
+		{hexInt("124c9ad43b6cf79bfbf7043de3811ad0761b0f37a1e26286b0e977c69aa274524e79097a56dc4bd9e1b371c71c718b10"), new(big.Int)},
+	},
+	{
+		{hexInt("1a0111ea397fe69a4b1ba7b6434bacd764774b84f38512bf6730d2a0f6b0f6241eabfffeb153ffffb9feffffffffa8fb"), hexInt("1a0111ea397fe69a4b1ba7b6434bacd764774b84f38512bf6730d2a0f6b0f6241eabfffeb153ffffb9feffffffffa8fb")},
+		{new(big.Int), hexInt("1a0111ea397fe69a4b1ba7b6434bacd764774b84f38512bf6730d2a0f6b0f6241eabfffeb153ffffb9feffffffffa9d3")},
+		{big.NewInt(0x12), hexInt("1a0111ea397fe69a4b1ba7b6434bacd764774b84f38512bf6730d2a0f6b0f6241eabfffeb153ffffb9feffffffffaa99")},
+	},
+}
+
+// hEff clears the cofactor of a point of E' (RFC 9380, section 8.8.2).
+var hEff = hexInt("0bc69f08f2ee75b3584c6a0ea91b352888e2a8e9145ad7689986ff031508ffe1329c2f178731db956d82bf015d1212b02ec0ec69d7477c1ae954cbc06689f6a359894c0adebbf6b4e8020005aaa95551")
+
+// hashToG2 hashes msg to a point of G2 (hash_to_curve with
+// BLS12381G2_XMD:SHA-256_SSWU_RO_ and the given tag).
+func hashToG2(msg []byte, tag string) g2 {
+	u := hashToField(msg, tag)
+	q := mapToCurve(u[0]).add(mapToCurve(u[1]))
+	return q.scale(hEff)
+}
+
+// hashToField derives two elements of Fp2 from msg.
+func hashToField(msg []byte, tag string) [2]fp2 {
+	const l = 64 // bytes per Fp element: ⌈(381 + 128)/8⌉
+	uniform := expandMessageXMD(msg, tag, 4*l)
+	var u [2]fp2
+	for i := range 2 {
+		var e [2]*big.Int
+		for j := range 2 {
+			off := l * (j + 2*i)
+			e[j] = new(big.Int).SetBytes(uniform[off : off+l])
+			e[j].Mod(e[j], p)
+		}
+		u[i] = fp2{e[0], e[1]}
+	}
+	return u
+}
+
+// expandMessageXMD is expand_message_xmd with SHA-256 (RFC 9380, section
+// 5.3.1). n must be at most 255·32.
+func expandMessageXMD(msg []byte, tag string, n int) []byte {
+	dstPrime := append([]byte(tag), byte(len(tag)))
+	h := sha256.New()
+	h.Write(make([]byte, sha256.BlockSize))
+	h.Write(msg)
+	h.Write([]byte{byte(n >> 8), byte(n), 0})
+	h.Write(dstPrime)
+	b0 := h.Sum(nil)
+
+	out := make([]byte, 0, n)
+	prev := make([]byte, sha256.Size)
+	for i := 1; len(out) < n; i++ {
+		x := make([]byte, sha256.Size)
+		for k := range x {
+			x[k] = b0[k] ^ prev[k]
+		}
+		h.Reset()
+		h.Write(x)
+		h.Write([]byte{byte(i)})
+		h.Write(dstPrime)
+		prev = h.Sum(nil)
+		out = append(out, prev...)
+	}
+	return out[:n]
+}
+
+// mapToCurve maps u to E' with the simplified SWU map to E2' followed by
+// the isogeny.
+func mapToCurve(u fp2) g2 {
+	zu2 := sswuZ.mul(u.square())
+	tv := zu2.square().add(zu2)
+	var x1 fp2
+	if tv.isZero() {
+		x1 = sswuB.mul(sswuZ.mul(sswuA).inv())
+	} else {
+		x1 = sswuB.neg().mul(sswuA.inv()).mul(fp2One().add(tv.inv()))
+	}
+	g := func(x fp2) fp2 { return x.square().mul(x).add(sswuA.mul(x)).add(sswuB) }
+	x, y := x1, fp2{}
+	if gx1 := g(x1); gx1.isSquare() {
+		y, _ = gx1.sqrt()
+	} else {
+		x = zu2.mul(x1)
+		y, _ = g(x).sqrt()
+	}
+	if u.sgn0() != y.sgn0() {
+		y = y.neg()
+	}
+	return isoMap(x, y)
+}
+
+// isoMap maps a point of E2' to E'.
+func isoMap(x, y fp2) g2 {
+	eval := func(k []fp2, monic bool) fp2 {
+		z := fp2Zero()
+		if monic {
+			z = fp2One()
+		}
+		for i := len(k) - 1; i >= 0; i-- {
+			z = z.mul(x).add(k[i])
+		}
+		return z
+	}
+	xNum, xDen := eval(isoK[0], false), eval(isoK[1], true)
+	yNum, yDen := eval(isoK[2], false), eval(isoK[3], true)
+	if xDen.isZero() || yDen.isZero() {
+		return g2{inf: true}
+	}
+	return g2{x: xNum.mul(xDen.inv()), y: y.mul(yNum).mul(yDen.inv())}
+}
@@ -0,0 +1,269 @@
+// Package bookmark stores chain snapshots — a (chain, block, timestamp)
+// triple with a note — so balances can be shown "as of" that point via
+// archive queries.
+package bookmark
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/primal-host/wallet/internal/endpoint"
+)
+
+// Bookmark is a named point in a chain's history.
+type Bookmark struct {
+	ID          string    `json:"id"`
+	ChainID     string    `json:"chain_id"` // decimal
+	Endpoint    string    `json:"endpoint"` // endpoint used to resolve the block
+	BlockNumber uint64    `json:"block_number"`
+	Timestamp   time.Time `json:"timestamp"` // block timestamp
+	Note        string    `json:"note"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // set while in the recycle bin
+}
+
+// Store manages bookmarks persisted to a JSON file.
+type Store struct {
+	mu        sync.RWMutex
+	bookmarks []Bookmark
+	path      string
+}
+
+// NewStore loads bookmarks from a JSON file. If the file doesn't exist, starts empty.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.bookmarks = []Bookmark{}
+			return s, nil
+		}
+		return nil, fmt.Errorf("read bookmarks: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.bookmarks); err != nil {
+		return nil, fmt.Errorf("parse bookmarks: %w", err)
+	}
+	return s, nil
+}
+
+// List returns all bookmarks, excluding deleted ones.
+func (s *Store) List() []Bookmark {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Bookmark, 0, len(s.bookmarks))
+	for _, b := range s.bookmarks {
+		if b.DeletedAt == nil {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// Trash returns deleted bookmarks that can still be restored.
+func (s *Store) Trash() []Bookmark {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []Bookmark{}
+	for _, b := range s.bookmarks {
+		if b.DeletedAt != nil {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// Get returns the bookmark with the given ID.
+func (s *Store) Get(id string) (Bookmark, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if b := s.findLocked(id); b != nil && b.DeletedAt == nil {
+		return *b, true
+	}
+	return Bookmark{}, false
+}
+
+// Add resolves the snapshot against ep and stores it. Exactly one of block
+// or at selects the point: a block number, or the last block at or before a
+// time (e.g. "as of Dec 31").
+func (s *Store) Add(ctx context.Context, ep endpoint.Endpoint, block *uint64, at *time.Time, note string) (Bookmark, error) {
+	if (block == nil) == (at == nil) {
+		return Bookmark{}, fmt.Errorf("give either a block number or a timestamp")
+	}
+	chainID, err := quantity(ctx, ep, "eth_chainId")
+	if err != nil {
+		return Bookmark{}, err
+	}
+	var (
+		num uint64
+		ts  time.Time
+	)
+	if block != nil {
+		num = *block
+		if ts, err = blockTime(ctx, ep, num); err != nil {
+			return Bookmark{}, err
+		}
+	} else if num, ts, err = blockAt(ctx, ep, *at); err != nil {
+		return Bookmark{}, err
+	}
+
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return Bookmark{}, err
+	}
+	b := Bookmark{
+		ID:          hex.EncodeToString(id),
+		ChainID:     chainID.String(),
+		Endpoint:    ep.ID,
+		BlockNumber: num,
+		Timestamp:   ts,
+		Note:        strings.TrimSpace(note),
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.bookmarks
+	s.bookmarks = append(s.bookmarks[:len(old):len(old)], b)
+	if err := s.save(); err != nil {
+		s.bookmarks = old
+		return Bookmark{}, err
+	}
+	return b, nil
+}
+
+// Put stores b under its own ID, replacing any bookmark with that ID,
+// including one in the recycle bin. It restores bookmarks from a backup,
+// which already resolved the block.
+func (s *Store) Put(b Bookmark) (Bookmark, error) {
+	if strings.TrimSpace(b.ID) == "" {
+		return Bookmark{}, fmt.Errorf("id is required")
+	}
+	if b.ChainID == "" {
+		return Bookmark{}, fmt.Errorf("chain_id is required")
+	}
+	b.Note = strings.TrimSpace(b.Note)
+	if b.CreatedAt.IsZero() {
+		b.CreatedAt = time.Now().UTC()
+	}
+	b.DeletedAt = nil
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.bookmarks
+	next := make([]Bookmark, 0, len(old)+1)
+	for _, existing := range old {
+		if existing.ID != b.ID {
+			next = append(next, existing)
+		}
+	}
+	s.bookmarks = append(next, b)
+	if err := s.save(); err != nil {
+		s.bookmarks = old
+		return Bookmark{}, err
+	}
+	return b, nil
+}
+
+// SetNote changes a bookmark's note.
+func (s *Store) SetNote(id, note string) (Bookmark, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.findLocked(id)
+	if b == nil || b.DeletedAt != nil {
+		return Bookmark{}, fmt.Errorf("bookmark %q not found", id)
+	}
+	old := b.Note
+	b.Note = strings.TrimSpace(note)
+	if err := s.save(); err != nil {
+		b.Note = old
+		return Bookmark{}, err
+	}
+	return *b, nil
+}
+
+// Delete moves a bookmark to the recycle bin.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.findLocked(id)
+	if b == nil || b.DeletedAt != nil {
+		return fmt.Errorf("bookmark %q not found", id)
+	}
+	now := time.Now().UTC()
+	b.DeletedAt = &now
+	if err := s.save(); err != nil {
+		b.DeletedAt = nil
+		return err
+	}
+	return nil
+}
+
+// Restore brings a deleted bookmark back from the recycle bin.
+func (s *Store) Restore(id string) (Bookmark, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.findLocked(id)
+	if b == nil || b.DeletedAt == nil {
+		return Bookmark{}, fmt.Errorf("deleted bookmark %q not found", id)
+	}
+	deletedAt := b.DeletedAt
+	b.DeletedAt = nil
+	if err := s.save(); err != nil {
+		b.DeletedAt = deletedAt
+		return Bookmark{}, err
+	}
+	return *b, nil
+}
+
+// Purge permanently removes a deleted bookmark.
+func (s *Store) Purge(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, b := range s.bookmarks {
+		if b.ID == id && b.DeletedAt != nil {
+			old := s.bookmarks
+			s.bookmarks = append(s.bookmarks[:i:i], s.bookmarks[i+1:]...)
+			if err := s.save(); err != nil {
+				s.bookmarks = old
+				return err
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("deleted bookmark %q not found", id)
+}
+
+// findLocked finds a bookmark by ID, including deleted ones. Must be called with mu held.
+func (s *Store) findLocked(id string) *Bookmark {
+	for i := range s.bookmarks {
+		if s.bookmarks[i].ID == id {
+			return &s.bookmarks[i]
+		}
+	}
+	return nil
+}
+
+// save writes the current bookmarks to disk. Must be called with mu held.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.bookmarks, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal bookmarks: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("write bookmarks: %w", err)
+	}
+	return nil
+}
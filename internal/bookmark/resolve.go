@@ -0,0 +1,90 @@
+package bookmark
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+func quantity(ctx context.Context, ep endpoint.Endpoint, method string) (*big.Int, error) {
+	result, err := endpoint.RPCCall(ctx, ep, method, []any{})
+	if err != nil {
+		return nil, err
+	}
+	var s string
+	if err := json.Unmarshal(result, &s); err != nil {
+		return nil, fmt.Errorf("%s: unexpected result %s", method, result)
+	}
+	return evm.ParseQuantity(s)
+}
+
+// blockTime returns the timestamp of block num.
+func blockTime(ctx context.Context, ep endpoint.Endpoint, num uint64) (time.Time, error) {
+	result, err := endpoint.RPCCall(ctx, ep, "eth_getBlockByNumber", []any{evm.EncodeQuantity(new(big.Int).SetUint64(num)), false})
+	if err != nil {
+		return time.Time{}, err
+	}
+	var block *struct {
+		Timestamp string `json:"timestamp"`
+	}
+	if err := json.Unmarshal(result, &block); err != nil {
+		return time.Time{}, fmt.Errorf("eth_getBlockByNumber: %w", err)
+	}
+	if block == nil {
+		return time.Time{}, fmt.Errorf("block %d not found", num)
+	}
+	ts, err := evm.ParseQuantity(block.Timestamp)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(ts.Int64(), 0).UTC(), nil
+}
+
+// blockAt finds the last block whose timestamp is at or before t by binary
+// search over block numbers.
+func blockAt(ctx context.Context, ep endpoint.Endpoint, t time.Time) (uint64, time.Time, error) {
+	head, err := quantity(ctx, ep, "eth_blockNumber")
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	latest := head.Uint64()
+	headTime, err := blockTime(ctx, ep, latest)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if !t.Before(headTime) {
+		return 0, time.Time{}, fmt.Errorf("%s is after the latest block", t.Format(time.RFC3339))
+	}
+
+	var searchErr error
+	// First block strictly after t; the answer is the one before it.
+	after := sort.Search(int(latest)+1, func(i int) bool {
+		if searchErr != nil {
+			return true
+		}
+		ts, err := blockTime(ctx, ep, uint64(i))
+		if err != nil {
+			searchErr = err
+			return true
+		}
+		return ts.After(t)
+	})
+	if searchErr != nil {
+		return 0, time.Time{}, searchErr
+	}
+	if after == 0 {
+		return 0, time.Time{}, fmt.Errorf("%s is before the genesis block", t.Format(time.RFC3339))
+	}
+	num := uint64(after - 1)
+	ts, err := blockTime(ctx, ep, num)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return num, ts, nil
+}
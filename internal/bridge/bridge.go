@@ -0,0 +1,484 @@
+// Package bridge tracks transfers between two configured chains: the
+// deposit transaction on the source chain, and the funds it should deliver
+// to a recipient on the destination. Arrival is seen in the recipient's
+// native balance, or in the token's Transfer logs for an ERC-20.
+package bridge
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// finishedLimit is how many finished transfers are kept. Tracked ones are
+// always kept.
+const finishedLimit = 200
+
+// Window is how long a transfer is tracked before it is marked stalled. It
+// covers the week an optimistic rollup withdrawal waits to be proven.
+const Window = 8 * 24 * time.Hour
+
+// logRange is the most destination blocks searched for token logs in one
+// check, so a transfer registered long ago catches up over several checks
+// instead of one request the endpoint refuses.
+const logRange = 2000
+
+// Transfer statuses.
+const (
+	StatusPending  = "pending"   // the source transaction isn't mined yet
+	StatusInFlight = "in_flight" // the source transaction succeeded; waiting on the destination
+	StatusArrived  = "arrived"   // the funds reached the recipient
+	StatusFailed   = "failed"    // the source transaction reverted
+	StatusStalled  = "stalled"   // nothing arrived within Window
+)
+
+var transferTopic = evm.EncodeHex(evm.Keccak256([]byte("Transfer(address,address,uint256)")))
+
+// Transfer is one bridge transfer and how far it has got.
+type Transfer struct {
+	ID             string `json:"id"`
+	Name           string `json:"name,omitempty"`
+	SourceEndpoint string `json:"source_endpoint"`
+	SourceChainID  string `json:"source_chain_id"` // hex
+	SourceHash     string `json:"source_hash"`
+	SourceBlock    string `json:"source_block,omitempty"` // hex, once mined
+	DestEndpoint   string `json:"dest_endpoint"`
+	DestChainID    string `json:"dest_chain_id"` // hex
+	Recipient      string `json:"recipient"`     // defaults to the source transaction's sender
+	Token          string `json:"token,omitempty"`
+	// MinAmount is how much must reach the recipient, in the smallest unit,
+	// decimal. Bridges take fees, so it is usually below what was sent.
+	// Empty means any increase.
+	MinAmount string `json:"min_amount,omitempty"`
+
+	Status string `json:"status"`
+	// StartBlock and StartBalance are the destination head and the
+	// recipient's native balance when the transfer was registered; arrival
+	// is measured from them.
+	StartBlock   string `json:"start_block"` // hex
+	StartBalance string `json:"start_balance,omitempty"`
+	Scanned      string `json:"scanned,omitempty"`      // hex; last destination block searched for token logs
+	Received     string `json:"received,omitempty"`     // smallest unit, decimal
+	ArrivalHash  string `json:"arrival_hash,omitempty"` // destination transaction that delivered a token
+	Error        string `json:"error,omitempty"`
+
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	ConfirmedAt *time.Time `json:"confirmed_at,omitempty"`
+	ArrivedAt   *time.Time `json:"arrived_at,omitempty"`
+}
+
+// Tracked reports whether t is still being checked.
+func (t Transfer) Tracked() bool {
+	return t.Status == StatusPending || t.Status == StatusInFlight
+}
+
+// Store keeps transfers in a JSON file.
+type Store struct {
+	mu        sync.Mutex
+	transfers []Transfer // oldest first
+	path      string
+}
+
+// NewStore loads transfers from a JSON file. If the file doesn't exist,
+// starts empty.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path, transfers: []Transfer{}}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("read bridges: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.transfers); err != nil {
+		return nil, fmt.Errorf("parse bridges: %w", err)
+	}
+	return s, nil
+}
+
+// List returns transfers newest first, optionally only those with status.
+func (s *Store) List(status string) []Transfer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []Transfer{}
+	for i := len(s.transfers) - 1; i >= 0; i-- {
+		if status == "" || s.transfers[i].Status == status {
+			out = append(out, s.transfers[i])
+		}
+	}
+	return out
+}
+
+// Get returns a transfer by ID.
+func (s *Store) Get(id string) (Transfer, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t := s.findLocked(id); t != nil {
+		return *t, true
+	}
+	return Transfer{}, false
+}
+
+// Add checks t against its two endpoints and starts tracking it. The source
+// transaction must be known to src, and the chains must differ. The
+// destination head and the recipient's balance there are read now, so
+// register a transfer as soon as it is sent: native funds that arrive
+// before then aren't seen.
+func (s *Store) Add(ctx context.Context, src, dst endpoint.Endpoint, t Transfer) (Transfer, error) {
+	t.Name = strings.TrimSpace(t.Name)
+	t.SourceHash = strings.ToLower(strings.TrimSpace(t.SourceHash))
+	if b, err := evm.DecodeHex(t.SourceHash); err != nil || len(b) != 32 {
+		return Transfer{}, fmt.Errorf("source_hash must be a 32-byte transaction hash")
+	}
+	if t.Token != "" {
+		token, err := evm.ParseAddress(t.Token)
+		if err != nil {
+			return Transfer{}, fmt.Errorf("token: %w", err)
+		}
+		t.Token = token.Hex()
+	}
+	if t.MinAmount != "" {
+		n, err := evm.ParseQuantity(t.MinAmount)
+		if err != nil || n.Sign() < 0 {
+			return Transfer{}, fmt.Errorf("min_amount must be a decimal or 0x hex integer")
+		}
+		t.MinAmount = n.String()
+	}
+
+	srcChain, err := quantity(ctx, src, "eth_chainId")
+	if err != nil {
+		return Transfer{}, fmt.Errorf("source: %w", err)
+	}
+	dstChain, err := quantity(ctx, dst, "eth_chainId")
+	if err != nil {
+		return Transfer{}, fmt.Errorf("destination: %w", err)
+	}
+	if srcChain.Cmp(dstChain) == 0 {
+		return Transfer{}, fmt.Errorf("source and destination are both chain %s", srcChain)
+	}
+	result, err := endpoint.RPCCall(ctx, src, "eth_getTransactionByHash", []any{t.SourceHash})
+	if err != nil {
+		return Transfer{}, fmt.Errorf("source: %w", err)
+	}
+	var tx *struct {
+		From string `json:"from"`
+	}
+	if err := json.Unmarshal(result, &tx); err != nil {
+		return Transfer{}, fmt.Errorf("unexpected eth_getTransactionByHash result: %s", result)
+	}
+	if tx == nil {
+		return Transfer{}, fmt.Errorf("transaction %s isn't known to %s", t.SourceHash, src.Name)
+	}
+	if t.Recipient == "" {
+		t.Recipient = tx.From
+	}
+	recipient, err := evm.ParseAddress(t.Recipient)
+	if err != nil {
+		return Transfer{}, fmt.Errorf("recipient: %w", err)
+	}
+	t.Recipient = recipient.Hex()
+
+	head, err := quantity(ctx, dst, "eth_blockNumber")
+	if err != nil {
+		return Transfer{}, fmt.Errorf("destination: %w", err)
+	}
+	if t.Token == "" {
+		balance, err := nativeBalance(ctx, dst, recipient, evm.EncodeQuantity(head))
+		if err != nil {
+			return Transfer{}, fmt.Errorf("destination: %w", err)
+		}
+		t.StartBalance = balance.String()
+	}
+
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return Transfer{}, err
+	}
+	now := time.Now().UTC()
+	t.ID = hex.EncodeToString(b)
+	t.SourceEndpoint, t.DestEndpoint = src.ID, dst.ID
+	t.SourceChainID, t.DestChainID = evm.EncodeQuantity(srcChain), evm.EncodeQuantity(dstChain)
+	t.Status = StatusPending
+	t.StartBlock = evm.EncodeQuantity(head)
+	t.SourceBlock, t.Scanned, t.Received, t.ArrivalHash, t.Error = "", "", "", "", ""
+	t.CreatedAt, t.UpdatedAt = now, now
+	t.ConfirmedAt, t.ArrivedAt = nil, nil
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.transfers
+	s.transfers = prune(append(s.transfers[:len(old):len(old)], t))
+	if err := s.save(); err != nil {
+		s.transfers = old
+		return Transfer{}, err
+	}
+	return t, nil
+}
+
+// Delete stops tracking a transfer and forgets it.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.transfers {
+		if s.transfers[i].ID == id {
+			old := s.transfers
+			s.transfers = append(s.transfers[:i:i], s.transfers[i+1:]...)
+			if err := s.save(); err != nil {
+				s.transfers = old
+				return err
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("bridge transfer %q not found", id)
+}
+
+// Check moves each tracked transfer along: a pending one to in flight or
+// failed once its source receipt is in, and an in-flight one to arrived
+// once enough has reached the recipient. Transfers tracked longer than
+// Window are marked stalled. It returns the transfers whose status changed.
+// Endpoints that are gone or unreachable are skipped until the next check.
+func (s *Store) Check(ctx context.Context, lookup func(id string) (endpoint.Endpoint, bool)) ([]Transfer, error) {
+	now := time.Now().UTC()
+	var changed []Transfer
+	var saveErr error
+	for _, t := range s.List("") {
+		if !t.Tracked() {
+			continue
+		}
+		next := t
+		switch {
+		case now.Sub(t.CreatedAt) > Window:
+			next.Status = StatusStalled
+			next.Error = fmt.Sprintf("nothing arrived within %s", Window)
+		case t.Status == StatusPending:
+			ep, ok := lookup(t.SourceEndpoint)
+			if !ok || !confirm(ctx, ep, &next, now) {
+				continue
+			}
+		default:
+			ep, ok := lookup(t.DestEndpoint)
+			if !ok || !arrive(ctx, ep, &next, now) {
+				continue
+			}
+		}
+		next.UpdatedAt = now
+		if err := s.replace(next); err != nil {
+			saveErr = err
+			continue
+		}
+		if next.Status != t.Status {
+			changed = append(changed, next)
+		}
+	}
+	return changed, saveErr
+}
+
+// confirm looks for t's source receipt and reports whether it found one.
+func confirm(ctx context.Context, ep endpoint.Endpoint, t *Transfer, now time.Time) bool {
+	result, err := endpoint.RPCCall(ctx, ep, "eth_getTransactionReceipt", []any{t.SourceHash})
+	if err != nil {
+		return false
+	}
+	var receipt *struct {
+		Status      string `json:"status"`
+		BlockNumber string `json:"blockNumber"`
+	}
+	if err := json.Unmarshal(result, &receipt); err != nil || receipt == nil {
+		return false
+	}
+	t.SourceBlock = receipt.BlockNumber
+	t.ConfirmedAt = &now
+	if receipt.Status == "0x0" {
+		t.Status = StatusFailed
+		t.Error = "the source transaction reverted"
+	} else {
+		t.Status = StatusInFlight
+	}
+	return true
+}
+
+// arrive measures what has reached t's recipient on ep and reports whether
+// t changed.
+func arrive(ctx context.Context, ep endpoint.Endpoint, t *Transfer, now time.Time) bool {
+	prev := *t
+	need := big.NewInt(1)
+	if t.MinAmount != "" {
+		need, _ = new(big.Int).SetString(t.MinAmount, 10)
+	}
+	recipient, err := evm.ParseAddress(t.Recipient)
+	if err != nil {
+		return false
+	}
+
+	received := new(big.Int)
+	if t.Token == "" {
+		balance, err := nativeBalance(ctx, ep, recipient, "latest")
+		if err != nil {
+			return false
+		}
+		start, _ := new(big.Int).SetString(t.StartBalance, 10)
+		received.Sub(balance, start)
+		if received.Sign() < 0 {
+			received.SetInt64(0)
+		}
+		t.Received = received.String()
+	} else {
+		if !scanLogs(ctx, ep, t, recipient) {
+			return false
+		}
+		received.SetString(t.Received, 10)
+	}
+	if received.Cmp(need) >= 0 {
+		t.Status = StatusArrived
+		t.ArrivedAt = &now
+	}
+	return t.Status != prev.Status || t.Received != prev.Received || t.Scanned != prev.Scanned
+}
+
+// scanLogs searches up to logRange destination blocks past t.Scanned for
+// the token's Transfers to recipient, adding them to t.Received. It reports
+// whether it searched anything.
+func scanLogs(ctx context.Context, ep endpoint.Endpoint, t *Transfer, recipient evm.Address) bool {
+	head, err := quantity(ctx, ep, "eth_blockNumber")
+	if err != nil {
+		return false
+	}
+	from, _ := evm.ParseQuantity(t.StartBlock)
+	if t.Scanned != "" {
+		scanned, _ := evm.ParseQuantity(t.Scanned)
+		from = scanned.Add(scanned, big.NewInt(1))
+	}
+	if from.Cmp(head) > 0 {
+		return false
+	}
+	to := new(big.Int).Add(from, big.NewInt(logRange-1))
+	if to.Cmp(head) > 0 {
+		to = head
+	}
+	result, err := endpoint.RPCCall(ctx, ep, "eth_getLogs", []any{map[string]any{
+		"fromBlock": evm.EncodeQuantity(from),
+		"toBlock":   evm.EncodeQuantity(to),
+		"address":   t.Token,
+		"topics":    []any{transferTopic, nil, evm.EncodeHex(append(make([]byte, 12), recipient[:]...))},
+	}})
+	if err != nil {
+		return false
+	}
+	var logs []struct {
+		Data            string `json:"data"`
+		TransactionHash string `json:"transactionHash"`
+	}
+	if err := json.Unmarshal(result, &logs); err != nil {
+		return false
+	}
+	received := new(big.Int)
+	if t.Received != "" {
+		received.SetString(t.Received, 10)
+	}
+	for _, l := range logs {
+		data, err := evm.DecodeHex(l.Data)
+		if err != nil || len(data) < 32 {
+			continue
+		}
+		received.Add(received, new(big.Int).SetBytes(data[:32]))
+		t.ArrivalHash = l.TransactionHash
+	}
+	t.Received = received.String()
+	t.Scanned = evm.EncodeQuantity(to)
+	return true
+}
+
+// replace saves t over the stored transfer with its ID.
+func (s *Store) replace(t Transfer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur := s.findLocked(t.ID)
+	if cur == nil {
+		return nil // deleted meanwhile
+	}
+	old := *cur
+	*cur = t
+	if err := s.save(); err != nil {
+		*cur = old
+		return err
+	}
+	return nil
+}
+
+// prune drops the oldest finished transfers beyond finishedLimit.
+func prune(transfers []Transfer) []Transfer {
+	finished := 0
+	for _, t := range transfers {
+		if !t.Tracked() {
+			finished++
+		}
+	}
+	kept := make([]Transfer, 0, len(transfers))
+	for _, t := range transfers {
+		if finished > finishedLimit && !t.Tracked() {
+			finished--
+			continue
+		}
+		kept = append(kept, t)
+	}
+	return kept
+}
+
+func nativeBalance(ctx context.Context, ep endpoint.Endpoint, addr evm.Address, block string) (*big.Int, error) {
+	return quantity(ctx, ep, "eth_getBalance", addr.Hex(), block)
+}
+
+// quantity makes a call whose result is a hex quantity.
+func quantity(ctx context.Context, ep endpoint.Endpoint, method string, params ...any) (*big.Int, error) {
+	if params == nil {
+		params = []any{}
+	}
+	result, err := endpoint.RPCCall(ctx, ep, method, params)
+	if err != nil {
+		return nil, err
+	}
+	var s string
+	if err := json.Unmarshal(result, &s); err != nil {
+		return nil, fmt.Errorf("unexpected %s result: %s", method, result)
+	}
+	n, err := evm.ParseQuantity(s)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected %s result: %s", method, result)
+	}
+	return n, nil
+}
+
+// findLocked finds a transfer by ID. Must be called with mu held.
+func (s *Store) findLocked(id string) *Transfer {
+	for i := range s.transfers {
+		if s.transfers[i].ID == id {
+			return &s.transfers[i]
+		}
+	}
+	return nil
+}
+
+// save writes transfers to disk. Must be called with mu held.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.transfers, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal bridges: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("write bridges: %w", err)
+	}
+	return nil
+}
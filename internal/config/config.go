@@ -5,14 +5,270 @@ import "os"
 const Version = "0.1.0"
 
 type Config struct {
-	ListenAddr    string
-	EndpointsFile string
+	ListenAddr     string
+	EndpointsFile  string
+	AssetsFile     string
+	AccountsFile   string
+	BookmarksFile  string
+	ContactsFile   string // addresses sent to, for address-poisoning checks
+	LabelsFile     string // names and tags for addresses
+	ERC20File      string // ERC-20 token registry and imported token lists
+	ABIsFile       string
+	SchedulesFile  string
+	BridgesFile    string // tracked bridge transfers
+	BatchesFile    string // batch sends
+	AlertsFile     string // gas, balance, and endpoint downtime alerts
+	ChannelsFile   string // where notifications are delivered
+	WebPushFile    string // VAPID key and browser push subscriptions
+	WebPushSubject string // contact for push services, a mailto: or https: URL
+	PaymastersFile string // ERC-4337 paymaster services per chain
+	VaultFile      string
+	VaultPassFile  string // optional; unlocks the vault at startup
+
+	IdempotencyFile string
+	JournalFile     string
+	PreferencesFile string
+	KeySyncFile     string // browser vault synced between the user's browsers
+	UptimeFile      string // endpoint check history for uptime reports
+	BenchFile       string // last benchmark of each endpoint
+
+	// Chain, asset, and token icons are fetched once and cached here.
+	IconsDir     string
+	TokenListURL string // optional token list for token logos
+
+	// NFT holdings, metadata, and images are indexed and cached here.
+	NFTDir string
+
+	// IPFS content is fetched through the first gateway that answers and
+	// cached here.
+	IPFSDir      string
+	IPFSGateways string
+
+	// Contract verification is looked up on Sourcify (off skips it) and on
+	// block explorer APIs, as chainID=URL, with EtherscanAPIKey for
+	// Etherscan's own API; answers are cached here.
+	ContractsDir    string
+	SourcifyURL     string
+	ExplorerAPIs    string
+	EtherscanAPIKey string
+
+	// Anvil and Hardhat nodes are looked for at these URLs, or none when
+	// off; empty probes ports 8545-8549 on this machine.
+	DevnetURLs string
+
+	// Safe Transaction Services, as chainID=URL, added to Safe's hosted
+	// ones; SafeAPIKey is sent to them as a bearer token.
+	SafeTxServices string
+	SafeAPIKey     string
+
+	// Extra scam addresses to check recipients against besides the bundled
+	// list, or off to skip the check.
+	ScamList string
+
+	// A risk scanner webhook asked about each transaction before signing;
+	// RiskToken is sent to it as a bearer token. With RiskBlockCritical, the
+	// server refuses to sign or broadcast a transaction with a critical
+	// warning.
+	RiskWebhook       string
+	RiskToken         string
+	RiskBlockCritical bool
+
+	// Token-bucket limits per client IP or API token, as <count>/<duration>
+	// or off.
+	RateLimitRPC   string // RPC proxy, GraphQL, and comparisons
+	RateLimitWrite string // other state-changing requests
+
+	// CSP and framing headers; off when a reverse proxy sets its own.
+	// CSPSources are extra origins the dashboard may load scripts from.
+	SecurityHeaders bool
+	CSPSources      string
+
+	// TrustedProxies are the IPs and CIDR ranges of reverse proxies whose
+	// X-Forwarded-For names the client; empty trusts none.
+	TrustedProxies string
+
+	// The RPC proxy asks a second endpoint of the same chain every state
+	// read and flags answers that differ. RPCHedgeDelay, a duration, sends
+	// reads that wait longer than it to a second endpoint as well.
+	// RPCVerifyProofs checks balances with eth_getProof against a second
+	// endpoint's state root.
+	RPCCrossCheck   bool
+	RPCHedgeDelay   string
+	RPCVerifyProofs bool
+
+	// How long a request to an endpoint without a timeout of its own may
+	// take.
+	RPCTimeout string
+
+	// Retries of transient RPC failures, with jittered exponential backoff
+	// from RPCRetryBackoff up to RPCRetryMaxBackoff.
+	RPCRetries         string
+	RPCRetryBackoff    string
+	RPCRetryMaxBackoff string
+
+	// The HTTP transport shared by every endpoint: connection limits per
+	// host, how long idle connections are kept, HTTP/2, and a proxy.
+	RPCMaxConnsPerHost  string
+	RPCIdleConnsPerHost string
+	RPCIdleTimeout      string
+	RPCHTTP2            bool
+	RPCProxy            string
+
+	// Endpoint polling: checks run at once, the delay between workers'
+	// first checks, and how often an endpoint without an interval of its
+	// own is checked. Offline endpoints back off up to PollMaxBackoff and
+	// need PollRecover successful checks in a row to show online again.
+	PollWorkers    string
+	PollStagger    string
+	PollInterval   string
+	PollMaxBackoff string
+	PollRecover    string
+
+	// Multi-user mode: logins, an admin role, and a profile per user.
+	MultiUser   bool
+	UsersFile   string
+	UsersDir    string // USERS_DIR/<user ID> holds each user's profile
+	SessionTTL  string
+	TokensFile  string
+	DevicesFile string // devices paired by QR code
+
+	// Programmatic transactions wait for review in the approval queue.
+	ApprovalsFile   string
+	ApprovalTTL     string
+	RequireApproval bool // server signing routes queue instead of signing
+	ApproversFile   string
+	DualThreshold   string // values at or above it need two approvers
+	ApprovalWebhook string
+
+	// Server signing of values at or above it needs the recipient and
+	// amount re-typed.
+	ConfirmThreshold string
+
+	// Disperse contract batch sends call; the canonical deployment when
+	// empty.
+	DisperseAddress string
+
+	// Faucet mode is enabled when FaucetAddress is set.
+	FaucetEndpoint    string
+	FaucetAddress     string
+	FaucetAmount      string
+	FaucetInterval    string
+	FaucetLowBalance  string
+	FaucetSiteKey     string
+	FaucetSecret      string
+	FaucetWebhook     string
+	FaucetHistoryFile string
 }
 
 func Load() *Config {
 	return &Config{
-		ListenAddr:    envOrDefault("LISTEN_ADDR", ":4322"),
-		EndpointsFile: envOrDefault("ENDPOINTS_FILE", "endpoints.json"),
+		ListenAddr:     envOrDefault("LISTEN_ADDR", ":4322"),
+		EndpointsFile:  envOrDefault("ENDPOINTS_FILE", "endpoints.json"),
+		AssetsFile:     envOrDefault("ASSETS_FILE", "assets.json"),
+		AccountsFile:   envOrDefault("ACCOUNTS_FILE", "accounts.json"),
+		BookmarksFile:  envOrDefault("BOOKMARKS_FILE", "bookmarks.json"),
+		ContactsFile:   envOrDefault("CONTACTS_FILE", "contacts.json"),
+		LabelsFile:     envOrDefault("LABELS_FILE", "labels.json"),
+		ERC20File:      envOrDefault("ERC20_FILE", "erc20.json"),
+		ABIsFile:       envOrDefault("ABIS_FILE", "abis.json"),
+		SchedulesFile:  envOrDefault("SCHEDULES_FILE", "schedules.json"),
+		BridgesFile:    envOrDefault("BRIDGES_FILE", "bridges.json"),
+		BatchesFile:    envOrDefault("BATCHES_FILE", "batches.json"),
+		AlertsFile:     envOrDefault("ALERTS_FILE", "alerts.json"),
+		ChannelsFile:   envOrDefault("CHANNELS_FILE", "channels.json"),
+		WebPushFile:    envOrDefault("WEBPUSH_FILE", "webpush.json"),
+		WebPushSubject: os.Getenv("WEBPUSH_SUBJECT"),
+		PaymastersFile: envOrDefault("PAYMASTERS_FILE", "paymasters.json"),
+		VaultFile:      envOrDefault("VAULT_FILE", "vault.json"),
+		VaultPassFile:  os.Getenv("VAULT_PASSPHRASE_FILE"),
+
+		IdempotencyFile: envOrDefault("IDEMPOTENCY_FILE", "idempotency.json"),
+		JournalFile:     envOrDefault("JOURNAL_FILE", "journal.json"),
+		PreferencesFile: envOrDefault("PREFERENCES_FILE", "preferences.json"),
+		KeySyncFile:     envOrDefault("KEYSYNC_FILE", "keysync.json"),
+		UptimeFile:      envOrDefault("UPTIME_FILE", "uptime.json"),
+		BenchFile:       envOrDefault("BENCH_FILE", "bench.json"),
+
+		IconsDir:     envOrDefault("ICONS_DIR", "icons"),
+		TokenListURL: os.Getenv("TOKEN_LIST_URL"),
+
+		NFTDir: envOrDefault("NFT_DIR", "nfts"),
+
+		IPFSDir:      envOrDefault("IPFS_DIR", "ipfs"),
+		IPFSGateways: envOrDefault("IPFS_GATEWAYS", "https://ipfs.io,https://dweb.link"),
+
+		ContractsDir:    envOrDefault("CONTRACTS_DIR", "contracts"),
+		SourcifyURL:     os.Getenv("SOURCIFY_URL"),
+		ExplorerAPIs:    os.Getenv("EXPLORER_APIS"),
+		EtherscanAPIKey: os.Getenv("ETHERSCAN_API_KEY"),
+
+		DevnetURLs: os.Getenv("DEVNET_URLS"),
+
+		SafeTxServices: os.Getenv("SAFE_TX_SERVICES"),
+		SafeAPIKey:     os.Getenv("SAFE_API_KEY"),
+
+		ScamList: os.Getenv("SCAM_LIST"),
+
+		RiskWebhook:       os.Getenv("RISK_WEBHOOK"),
+		RiskToken:         os.Getenv("RISK_TOKEN"),
+		RiskBlockCritical: os.Getenv("RISK_BLOCK_CRITICAL") == "true",
+
+		RateLimitRPC:   envOrDefault("RATE_LIMIT_RPC", "600/1m"),
+		RateLimitWrite: envOrDefault("RATE_LIMIT_WRITE", "120/1m"),
+
+		SecurityHeaders: os.Getenv("SECURITY_HEADERS") != "off",
+		CSPSources:      os.Getenv("CSP_EXTRA_SOURCES"),
+		TrustedProxies:  os.Getenv("TRUSTED_PROXIES"),
+
+		RPCCrossCheck:   os.Getenv("RPC_CROSS_CHECK") == "true",
+		RPCHedgeDelay:   os.Getenv("RPC_HEDGE_DELAY"),
+		RPCVerifyProofs: os.Getenv("RPC_VERIFY_PROOFS") == "true",
+
+		RPCTimeout: envOrDefault("RPC_TIMEOUT", "10s"),
+
+		RPCRetries:         envOrDefault("RPC_RETRIES", "2"),
+		RPCRetryBackoff:    envOrDefault("RPC_RETRY_BACKOFF", "250ms"),
+		RPCRetryMaxBackoff: envOrDefault("RPC_RETRY_MAX_BACKOFF", "5s"),
+
+		RPCMaxConnsPerHost:  envOrDefault("RPC_MAX_CONNS_PER_HOST", "0"),
+		RPCIdleConnsPerHost: envOrDefault("RPC_IDLE_CONNS_PER_HOST", "8"),
+		RPCIdleTimeout:      envOrDefault("RPC_IDLE_TIMEOUT", "90s"),
+		RPCHTTP2:            os.Getenv("RPC_HTTP2") != "off",
+		RPCProxy:            os.Getenv("RPC_PROXY"),
+
+		PollWorkers:    envOrDefault("POLL_WORKERS", "8"),
+		PollStagger:    envOrDefault("POLL_STAGGER", "50ms"),
+		PollInterval:   envOrDefault("POLL_INTERVAL", "5s"),
+		PollMaxBackoff: envOrDefault("POLL_MAX_BACKOFF", "5m"),
+		PollRecover:    envOrDefault("POLL_RECOVER", "2"),
+
+		MultiUser:   os.Getenv("MULTI_USER") == "true",
+		UsersFile:   envOrDefault("USERS_FILE", "users.json"),
+		UsersDir:    envOrDefault("USERS_DIR", "users"),
+		SessionTTL:  envOrDefault("SESSION_TTL", "12h"),
+		TokensFile:  envOrDefault("TOKENS_FILE", "tokens.json"),
+		DevicesFile: envOrDefault("DEVICES_FILE", "devices.json"),
+
+		ApprovalsFile:   envOrDefault("APPROVALS_FILE", "approvals.json"),
+		ApprovalTTL:     envOrDefault("APPROVAL_TTL", "1h"),
+		RequireApproval: os.Getenv("REQUIRE_APPROVAL") == "true",
+		ApproversFile:   envOrDefault("APPROVERS_FILE", "approvers.json"),
+		DualThreshold:   os.Getenv("DUAL_CONTROL_THRESHOLD"),
+		ApprovalWebhook: os.Getenv("APPROVAL_WEBHOOK"),
+
+		ConfirmThreshold: os.Getenv("CONFIRM_THRESHOLD"),
+
+		DisperseAddress: os.Getenv("DISPERSE_ADDRESS"),
+
+		FaucetEndpoint:    os.Getenv("FAUCET_ENDPOINT"),
+		FaucetAddress:     os.Getenv("FAUCET_ADDRESS"),
+		FaucetAmount:      envOrDefault("FAUCET_AMOUNT", "0.1"),
+		FaucetInterval:    envOrDefault("FAUCET_INTERVAL", "24h"),
+		FaucetLowBalance:  os.Getenv("FAUCET_LOW_BALANCE"),
+		FaucetSiteKey:     os.Getenv("FAUCET_TURNSTILE_SITEKEY"),
+		FaucetSecret:      os.Getenv("FAUCET_TURNSTILE_SECRET"),
+		FaucetWebhook:     os.Getenv("FAUCET_ALERT_WEBHOOK"),
+		FaucetHistoryFile: envOrDefault("FAUCET_HISTORY_FILE", "faucet.json"),
 	}
 }
 
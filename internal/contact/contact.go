@@ -0,0 +1,199 @@
+// Package contact keeps the addresses a profile has actually sent to, so a
+// send preview can tell a familiar recipient from one that only looks like
+// it.
+package contact
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// maxContacts bounds the history; the least recently used go first.
+const maxContacts = 5000
+
+// Contact is an address sent to from this wallet.
+type Contact struct {
+	Address   string    `json:"address"`
+	Sends     int       `json:"sends"`
+	FirstSent time.Time `json:"first_sent"`
+	LastSent  time.Time `json:"last_sent"`
+
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // set while in the recycle bin
+}
+
+// Store manages contacts persisted to a JSON file.
+type Store struct {
+	mu       sync.RWMutex
+	contacts []Contact
+	path     string
+}
+
+// NewStore loads contacts from a JSON file. If the file doesn't exist,
+// starts empty.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path, contacts: []Contact{}}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("read contacts: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.contacts); err != nil {
+		return nil, fmt.Errorf("parse contacts: %w", err)
+	}
+	return s, nil
+}
+
+// List returns contacts, most sent to first, excluding deleted ones.
+func (s *Store) List() []Contact {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Contact, 0, len(s.contacts))
+	for _, c := range s.contacts {
+		if c.DeletedAt == nil {
+			out = append(out, c)
+		}
+	}
+	slices.SortStableFunc(out, func(a, b Contact) int {
+		if a.Sends != b.Sends {
+			return b.Sends - a.Sends
+		}
+		return b.LastSent.Compare(a.LastSent)
+	})
+	return out
+}
+
+// Trash returns deleted contacts that can still be restored.
+func (s *Store) Trash() []Contact {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []Contact{}
+	for _, c := range s.contacts {
+		if c.DeletedAt != nil {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Get returns the contact for an address.
+func (s *Store) Get(address string) (Contact, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i := s.index(address)
+	if i < 0 || s.contacts[i].DeletedAt != nil {
+		return Contact{}, false
+	}
+	return s.contacts[i], true
+}
+
+// Record counts a send to each address. Sending to a deleted contact
+// again brings it back from the recycle bin.
+func (s *Store) Record(addresses ...string) error {
+	now := time.Now().UTC()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.contacts
+	s.contacts = slices.Clone(old)
+	for _, address := range addresses {
+		a, err := evm.ParseAddress(address)
+		if err != nil {
+			continue
+		}
+		if i := s.index(a.Hex()); i >= 0 {
+			s.contacts[i].Sends++
+			s.contacts[i].LastSent = now
+			s.contacts[i].DeletedAt = nil
+			continue
+		}
+		s.contacts = append(s.contacts, Contact{Address: a.Hex(), Sends: 1, FirstSent: now, LastSent: now})
+	}
+	if len(s.contacts) > maxContacts {
+		slices.SortStableFunc(s.contacts, func(a, b Contact) int { return b.LastSent.Compare(a.LastSent) })
+		s.contacts = s.contacts[:maxContacts]
+	}
+	if err := s.save(); err != nil {
+		s.contacts = old
+		return err
+	}
+	return nil
+}
+
+// Delete moves a contact to the recycle bin, e.g. one sent to by mistake.
+// Until it is restored it is no longer familiar.
+func (s *Store) Delete(address string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(address)
+	if i < 0 || s.contacts[i].DeletedAt != nil {
+		return fmt.Errorf("contact %q not found", address)
+	}
+	now := time.Now().UTC()
+	s.contacts[i].DeletedAt = &now
+	if err := s.save(); err != nil {
+		s.contacts[i].DeletedAt = nil
+		return err
+	}
+	return nil
+}
+
+// Restore brings a deleted contact back from the recycle bin.
+func (s *Store) Restore(address string) (Contact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(address)
+	if i < 0 || s.contacts[i].DeletedAt == nil {
+		return Contact{}, fmt.Errorf("deleted contact %q not found", address)
+	}
+	deletedAt := s.contacts[i].DeletedAt
+	s.contacts[i].DeletedAt = nil
+	if err := s.save(); err != nil {
+		s.contacts[i].DeletedAt = deletedAt
+		return Contact{}, err
+	}
+	return s.contacts[i], nil
+}
+
+// Purge permanently removes a deleted contact.
+func (s *Store) Purge(address string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(address)
+	if i < 0 || s.contacts[i].DeletedAt == nil {
+		return fmt.Errorf("deleted contact %q not found", address)
+	}
+	old := s.contacts
+	s.contacts = slices.Delete(slices.Clone(old), i, i+1)
+	if err := s.save(); err != nil {
+		s.contacts = old
+		return err
+	}
+	return nil
+}
+
+// index returns the position of address, including a deleted contact's,
+// or -1. Must be called with mu held.
+func (s *Store) index(address string) int {
+	return slices.IndexFunc(s.contacts, func(c Contact) bool { return strings.EqualFold(c.Address, address) })
+}
+
+// save writes contacts to disk. Must be called with mu held.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.contacts, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal contacts: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("write contacts: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// Package deeplink parses primalwallet: links, which let other local apps and
+// web pages open the dashboard pre-filled to a send or sign flow:
+//
+//	primalwallet://send?to=0x...&value=0.05&endpoint=avax
+//
+// A link only fills in the form. The user still reviews the built
+// transaction and confirms before anything is signed.
+package deeplink
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// Scheme is the scheme registered with the operating system. Browsers only
+// let pages register web+ schemes, so WebScheme is accepted as well.
+const (
+	Scheme    = "primalwallet"
+	WebScheme = "web+primalwallet"
+)
+
+// Link is a parsed deep link.
+type Link struct {
+	Action   string `json:"action"` // send (sign and broadcast) or sign (sign only)
+	Endpoint string `json:"endpoint,omitempty"`
+	ChainID  string `json:"chain_id,omitempty"` // decimal; picks an endpoint when none is named
+	From     string `json:"from,omitempty"`
+	To       string `json:"to"`
+	Value    string `json:"value,omitempty"` // whole native units, like the CLI's -value
+	Data     string `json:"data,omitempty"`
+}
+
+// Parse validates a deep link. Unknown parameters are rejected rather than
+// ignored, so a misspelt amount can't silently become a zero-value send.
+func Parse(raw string) (*Link, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid link: %w", err)
+	}
+	if !strings.EqualFold(u.Scheme, Scheme) && !strings.EqualFold(u.Scheme, WebScheme) {
+		return nil, fmt.Errorf("link scheme must be %s: or %s:", Scheme, WebScheme)
+	}
+	// primalwallet://send?..., primalwallet:send?..., and primalwallet:///send?...
+	// all name the action.
+	l := &Link{Action: strings.Trim(u.Host+u.Opaque+u.Path, "/")}
+	if l.Action != "send" && l.Action != "sign" {
+		return nil, fmt.Errorf("unknown link action %q", l.Action)
+	}
+
+	q, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("invalid link query: %w", err)
+	}
+	for key, vals := range q {
+		if len(vals) != 1 {
+			return nil, fmt.Errorf("link parameter %s given more than once", key)
+		}
+		v := strings.TrimSpace(vals[0])
+		switch key {
+		case "endpoint":
+			l.Endpoint = v
+		case "chain_id":
+			n, err := evm.ParseQuantity(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid chain_id %q", v)
+			}
+			l.ChainID = n.String()
+		case "from":
+			a, err := evm.ParseAddress(v)
+			if err != nil {
+				return nil, err
+			}
+			l.From = a.Hex()
+		case "to":
+			a, err := evm.ParseAddress(v)
+			if err != nil {
+				return nil, err
+			}
+			l.To = a.Hex()
+		case "value":
+			if _, err := evm.ParseUnits(v, 18); err != nil {
+				return nil, err
+			}
+			l.Value = v
+		case "data":
+			if _, err := evm.DecodeHex(v); err != nil {
+				return nil, fmt.Errorf("invalid data: %w", err)
+			}
+			l.Data = v
+		default:
+			return nil, fmt.Errorf("unknown link parameter %q", key)
+		}
+	}
+	if l.To == "" {
+		return nil, fmt.Errorf("link is missing to")
+	}
+	return l, nil
+}
@@ -0,0 +1,82 @@
+package devnet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// The test-chain controls Anvil and Hardhat share. Both take evm_* calls;
+// the rest are named anvil_* or hardhat_* after the node (Anvil also
+// answers to hardhat_*, but not the other way round).
+
+// Snapshot saves the chain's state and returns the ID to revert to.
+func Snapshot(ctx context.Context, ep endpoint.Endpoint) (string, error) {
+	raw, err := endpoint.RPCCall(ctx, ep, "evm_snapshot", nil)
+	if err != nil {
+		return "", err
+	}
+	var id string
+	if err := json.Unmarshal(raw, &id); err != nil {
+		return "", fmt.Errorf("evm_snapshot: %w", err)
+	}
+	return id, nil
+}
+
+// Revert restores the state saved as snapshot id. The node forgets that
+// snapshot and every later one; it reports false if it had no such
+// snapshot.
+func Revert(ctx context.Context, ep endpoint.Endpoint, id string) (bool, error) {
+	raw, err := endpoint.RPCCall(ctx, ep, "evm_revert", []any{id})
+	if err != nil {
+		return false, err
+	}
+	var ok bool
+	if err := json.Unmarshal(raw, &ok); err != nil {
+		return false, fmt.Errorf("evm_revert: %w", err)
+	}
+	return ok, nil
+}
+
+// Mine mines blocks blocks, their timestamps interval seconds apart (the
+// node's default spacing when 0).
+func Mine(ctx context.Context, ep endpoint.Endpoint, kind string, blocks, interval uint64) error {
+	params := []any{hexUint(blocks)}
+	if interval > 0 {
+		params = append(params, hexUint(interval))
+	}
+	_, err := endpoint.RPCCall(ctx, ep, kind+"_mine", params)
+	return err
+}
+
+// SetBalance sets address's balance to wei.
+func SetBalance(ctx context.Context, ep endpoint.Endpoint, kind string, address evm.Address, wei *big.Int) error {
+	_, err := endpoint.RPCCall(ctx, ep, kind+"_setBalance", []any{address.Hex(), evm.EncodeQuantity(wei)})
+	return err
+}
+
+// Impersonate lets the node send transactions from address without its
+// key (eth_sendTransaction), or with on false stops it.
+func Impersonate(ctx context.Context, ep endpoint.Endpoint, kind string, address evm.Address, on bool) error {
+	method := kind + "_impersonateAccount"
+	if !on {
+		method = kind + "_stopImpersonatingAccount"
+	}
+	_, err := endpoint.RPCCall(ctx, ep, method, []any{address.Hex()})
+	return err
+}
+
+// IncreaseTime moves the chain's clock seconds forward, which shows in the
+// next block mined.
+func IncreaseTime(ctx context.Context, ep endpoint.Endpoint, seconds uint64) error {
+	_, err := endpoint.RPCCall(ctx, ep, "evm_increaseTime", []any{seconds})
+	return err
+}
+
+func hexUint(n uint64) string {
+	return fmt.Sprintf("0x%x", n)
+}
@@ -0,0 +1,278 @@
+// Package devnet finds local development nodes, Anvil (Foundry) and
+// Hardhat Network, on the ports they usually listen on, and reports their
+// chain and the accounts they fund.
+package devnet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// Node kinds.
+const (
+	KindAnvil   = "anvil"
+	KindHardhat = "hardhat"
+)
+
+// ErrNotDevnet is returned for a node that answers but isn't Anvil or
+// Hardhat.
+var ErrNotDevnet = errors.New("not Anvil or Hardhat")
+
+// probeTimeout bounds probing one URL, so a port nothing answers on doesn't
+// hold up the rest.
+const probeTimeout = 2 * time.Second
+
+// DefaultURLs are probed when no list is configured: 8545, where Anvil and
+// Hardhat both listen by default, and the next few ports, where a second
+// node or a fork usually goes.
+var DefaultURLs = []string{
+	"http://127.0.0.1:8545",
+	"http://127.0.0.1:8546",
+	"http://127.0.0.1:8547",
+	"http://127.0.0.1:8548",
+	"http://127.0.0.1:8549",
+}
+
+// DevAccounts are the first ten accounts of the "test test test test test
+// test test test test test test junk" mnemonic, which Anvil and Hardhat
+// fund with 10,000 ETH each unless told otherwise. Their private keys are
+// public, so nothing of value should ever be sent to them on a real chain.
+var DevAccounts = []string{
+	"0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266",
+	"0x70997970C51812dc3A010C7d01b50e0d17dc79C8",
+	"0x3C44CdDdB6a900fa2b585dd299e03d12FA4293BC",
+	"0x90F79bf6EB2c4f870365E785982E1f101E93b906",
+	"0x15d34AAf54267DB7D7c367839AAf71A00a2C6A65",
+	"0x9965507D1a55bcC2695C58ba16FB37d819B0A4dc",
+	"0x976EA74026E726554dB657fA54763abd0C3a0aa9",
+	"0x14dC79964da2C08b23698B3D3cc7Ca32193d9955",
+	"0x23618e81E3f5cdF7f54C3d65f7FBc0aBf5B21E8f",
+	"0xa0Ee7A142d267C1f36714E4a8F75612F20a79720",
+}
+
+// Account is an account a node funds.
+type Account struct {
+	Address string `json:"address"`
+	Balance string `json:"balance"`              // in ETH
+	Known   bool   `json:"well_known,omitempty"` // one of DevAccounts, whose key is public
+}
+
+// Node is a development node that answered a probe.
+type Node struct {
+	URL      string    `json:"url"`
+	Kind     string    `json:"kind"`   // anvil or hardhat
+	Client   string    `json:"client"` // web3_clientVersion, e.g. "anvil/v1.2.3"
+	ChainID  uint64    `json:"chain_id"`
+	Block    uint64    `json:"block"`
+	Time     int64     `json:"timestamp"` // of the block, Unix seconds
+	Accounts []Account `json:"accounts,omitempty"`
+}
+
+// Product is the node software's name, Anvil or Hardhat.
+func (n Node) Product() string {
+	if n.Kind == KindHardhat {
+		return "Hardhat"
+	}
+	return "Anvil"
+}
+
+// Name is what an endpoint for n is called by default, e.g.
+// "Anvil (127.0.0.1:8545)".
+func (n Node) Name() string {
+	if u, err := url.Parse(n.URL); err == nil && u.Host != "" {
+		return n.Product() + " (" + u.Host + ")"
+	}
+	return n.Product()
+}
+
+// ParseURLs parses a space- or comma-separated list of node URLs to probe.
+// Empty means DefaultURLs and "off" none.
+func ParseURLs(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	switch s {
+	case "":
+		return DefaultURLs, nil
+	case "off":
+		return nil, nil
+	}
+	var urls []string
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' }) {
+		u, err := url.Parse(f)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%q must be an http:// or https:// URL", f)
+		}
+		urls = append(urls, u.String())
+	}
+	return urls, nil
+}
+
+// Detect probes urls at once and returns the Anvil and Hardhat nodes among
+// them, in the order given. URLs that don't answer, or answer as some
+// other client, are left out.
+func Detect(ctx context.Context, urls []string) []Node {
+	found := make([]*Node, len(urls))
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if n, err := Probe(ctx, u); err == nil {
+				found[i] = &n
+			}
+		}()
+	}
+	wg.Wait()
+	nodes := []Node{}
+	for _, n := range found {
+		if n != nil {
+			nodes = append(nodes, *n)
+		}
+	}
+	return nodes
+}
+
+// Probe asks the node at rawURL what it is. It fails unless the node is
+// Anvil or Hardhat. The accounts are the node's own (eth_accounts), or
+// DevAccounts when it lists none.
+func Probe(ctx context.Context, rawURL string) (Node, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	ep := Endpoint(rawURL)
+	n, err := Status(ctx, ep)
+	if err != nil {
+		return Node{}, err
+	}
+	n.URL = rawURL
+
+	accounts, err := endpoint.RPCCall(ctx, ep, "eth_accounts", nil)
+	if err != nil && ctx.Err() != nil {
+		return Node{}, err
+	}
+	var listed []string
+	if err == nil {
+		json.Unmarshal(accounts, &listed)
+	}
+	if len(listed) == 0 {
+		listed = DevAccounts
+	}
+	calls := make([]endpoint.Call, 0, len(listed))
+	for _, a := range listed {
+		addr, err := evm.ParseAddress(a)
+		if err != nil {
+			continue
+		}
+		n.Accounts = append(n.Accounts, Account{Address: addr.Hex(), Known: isDevAccount(addr)})
+		calls = append(calls, endpoint.Call{Method: "eth_getBalance", Params: []any{addr.Hex(), "latest"}})
+	}
+	balances, err := endpoint.RPCBatch(ctx, ep, calls)
+	if err != nil {
+		return Node{}, err
+	}
+	for i, r := range balances {
+		var s string
+		if r.Err != nil || json.Unmarshal(r.Result, &s) != nil {
+			continue
+		}
+		if wei, err := evm.ParseQuantity(s); err == nil {
+			n.Accounts[i].Balance = evm.FormatUnits(wei, 18)
+		}
+	}
+	return n, nil
+}
+
+// Status asks ep's node what it is and where its chain is. It fails unless
+// the node is Anvil or Hardhat; URL and Accounts are left empty.
+func Status(ctx context.Context, ep endpoint.Endpoint) (Node, error) {
+	replies, err := endpoint.RPCBatch(ctx, ep, []endpoint.Call{
+		{Method: "web3_clientVersion"},
+		{Method: "eth_chainId"},
+		{Method: "eth_getBlockByNumber", Params: []any{"latest", false}},
+	})
+	if err != nil {
+		return Node{}, err
+	}
+	for _, r := range replies {
+		if r.Err != nil {
+			return Node{}, r.Err
+		}
+	}
+	var n Node
+	if err := json.Unmarshal(replies[0].Result, &n.Client); err != nil {
+		return Node{}, fmt.Errorf("web3_clientVersion: %w", err)
+	}
+	n.Kind = kindOf(n.Client)
+	if n.Kind == "" {
+		return Node{}, fmt.Errorf("%s is %q, %w", ep.URL, n.Client, ErrNotDevnet)
+	}
+	if n.ChainID, err = quantity(replies[1].Result); err != nil {
+		return Node{}, fmt.Errorf("eth_chainId: %w", err)
+	}
+	var head struct {
+		Number    json.RawMessage `json:"number"`
+		Timestamp json.RawMessage `json:"timestamp"`
+	}
+	if err := json.Unmarshal(replies[2].Result, &head); err != nil {
+		return Node{}, fmt.Errorf("latest block: %w", err)
+	}
+	if n.Block, err = quantity(head.Number); err != nil {
+		return Node{}, fmt.Errorf("latest block number: %w", err)
+	}
+	t, err := quantity(head.Timestamp)
+	if err != nil {
+		return Node{}, fmt.Errorf("latest block timestamp: %w", err)
+	}
+	n.Time = int64(t)
+	return n, nil
+}
+
+// Endpoint is an ad hoc endpoint for calling the node at rawURL directly,
+// never through a configured proxy, which couldn't reach a local port.
+func Endpoint(rawURL string) endpoint.Endpoint {
+	return endpoint.Endpoint{ID: "devnet", Name: rawURL, URL: rawURL, Proxy: endpoint.ProxyDirect}
+}
+
+// kindOf tells Anvil and Hardhat apart by their client version, e.g.
+// "anvil/v1.2.3" or "HardhatNetwork/2.22.0/@ethereumjs/vm/...".
+func kindOf(client string) string {
+	c := strings.ToLower(client)
+	switch {
+	case strings.HasPrefix(c, "anvil"):
+		return KindAnvil
+	case strings.HasPrefix(c, "hardhatnetwork"):
+		return KindHardhat
+	}
+	return ""
+}
+
+func quantity(raw json.RawMessage) (uint64, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return 0, err
+	}
+	n, err := evm.ParseQuantity(s)
+	if err != nil {
+		return 0, err
+	}
+	if !n.IsUint64() {
+		return 0, errors.New("out of range")
+	}
+	return n.Uint64(), nil
+}
+
+func isDevAccount(addr evm.Address) bool {
+	for _, a := range DevAccounts {
+		if strings.EqualFold(a, addr.Hex()) {
+			return true
+		}
+	}
+	return false
+}
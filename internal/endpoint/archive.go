@@ -0,0 +1,173 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// stateMethods are the methods that read account state, with the index of
+// their block parameter.
+var stateMethods = map[string]int{
+	"eth_getBalance":          1,
+	"eth_getCode":             1,
+	"eth_getTransactionCount": 1,
+	"eth_getStorageAt":        2,
+	"eth_call":                1,
+	"eth_getProof":            2,
+}
+
+// stateBlock returns the block a state query asks for and whether it asks
+// for a past one at all. The number is nil when the block is named by hash
+// (EIP-1898), so its height isn't known.
+func stateBlock(method string, params []any) (block *uint64, historical bool) {
+	i, ok := stateMethods[method]
+	if !ok || i >= len(params) {
+		return nil, false
+	}
+	tag := params[i]
+	if obj, ok := tag.(map[string]any); ok {
+		if _, ok := obj["blockHash"]; ok {
+			return nil, true
+		}
+		tag = obj["blockNumber"]
+	}
+	s, ok := tag.(string)
+	if !ok {
+		return nil, false
+	}
+	switch s {
+	case "latest", "pending", "safe", "finalized":
+		return nil, false
+	case "earliest":
+		n := uint64(0)
+		return &n, true
+	}
+	n, err := evm.ParseQuantity(s)
+	if err != nil || !n.IsUint64() {
+		return nil, false
+	}
+	u := n.Uint64()
+	return &u, true
+}
+
+// blockMethods are the other methods that take a block tag, with the index
+// of their block parameter.
+var blockMethods = map[string]int{
+	"eth_estimateGas":                         1,
+	"eth_createAccessList":                    1,
+	"eth_feeHistory":                          1,
+	"eth_getBlockByNumber":                    0,
+	"eth_getBlockTransactionCountByNumber":    0,
+	"eth_getBlockReceipts":                    0,
+	"eth_getTransactionByBlockNumberAndIndex": 0,
+	"eth_getUncleCountByBlockNumber":          0,
+}
+
+// AtHead reports whether a call reads the chain at its head: it takes a
+// block tag, and the tag is "latest" or "pending", or left out, which
+// nodes take as "latest".
+func AtHead(method string, params []any) bool {
+	i, ok := stateMethods[method]
+	if !ok {
+		i, ok = blockMethods[method]
+	}
+	if !ok {
+		return false
+	}
+	if i >= len(params) || params[i] == nil {
+		return true
+	}
+	tag := params[i]
+	if obj, ok := tag.(map[string]any); ok {
+		tag = obj["blockNumber"]
+	}
+	s, _ := tag.(string)
+	return s == "latest" || s == "pending"
+}
+
+// StateUnavailable reports whether err is a node saying it no longer keeps
+// the state a query asked for, as pruned full nodes do.
+func StateUnavailable(err error) bool {
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	msg := strings.ToLower(rpcErr.Message)
+	for _, s := range []string{"missing trie node", "state not available", "state is not available", "historical state", "state histories", "pruned", "old data not available", "not an archive"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// tooOld reports whether ep is known not to keep block's state: it was
+// probed without archive state, and block was already beyond its depth when
+// it was probed.
+func tooOld(ep Endpoint, block *uint64) bool {
+	p, ok := cachedProbe(ep)
+	if !ok || p.caps.Archive || block == nil {
+		return false
+	}
+	return *block+p.caps.StateDepth < p.head
+}
+
+// archives returns the store's other endpoints probed as archive nodes of
+// ep's chain, leaving out private endpoints, which are for sends.
+func (s *Store) archives(ep Endpoint) []Endpoint {
+	p, ok := cachedProbe(ep)
+	if !ok || p.chainID == "" {
+		return nil
+	}
+	var out []Endpoint
+	for _, alt := range s.List() {
+		if alt.ID == ep.ID || alt.Private {
+			continue
+		}
+		if q, ok := cachedProbe(alt); ok && q.caps.Archive && q.chainID == p.chainID {
+			out = append(out, alt)
+		}
+	}
+	return out
+}
+
+// Historical makes a JSON-RPC call to ep, sending a state query for a block
+// whose state ep no longer keeps to an archive endpoint serving the same
+// chain instead. A query is rerouted when probing showed ep is too shallow
+// for the block, or when ep answers that the state is gone. It returns the
+// endpoint that answered with the result.
+func (s *Store) Historical(ctx context.Context, ep Endpoint, method string, params []any) (json.RawMessage, Endpoint, error) {
+	block, historical := stateBlock(method, params)
+	if !historical {
+		result, err := RPCCall(ctx, ep, method, params)
+		return result, ep, err
+	}
+	var firstErr error
+	if !tooOld(ep, block) {
+		result, err := RPCCall(ctx, ep, method, params)
+		if err == nil || !StateUnavailable(err) {
+			return result, ep, err
+		}
+		firstErr = err
+	}
+	for _, alt := range s.archives(ep) {
+		result, err := RPCCall(ctx, alt, method, params)
+		if err == nil || !StateUnavailable(err) && !transportError(err) {
+			// A revert from an archive node is the query's real answer.
+			slog.Debug("historical query routed", "subsystem", "endpoint", "endpoint", ep.ID, "archive", alt.ID, "method", method)
+			return result, alt, err
+		}
+		slog.Debug("archive query failed", "subsystem", "endpoint", "archive", alt.ID, "method", method, "error", err)
+	}
+	if firstErr != nil {
+		return nil, ep, firstErr
+	}
+	// Probing may be out of date; ep gets the last word.
+	result, err := RPCCall(ctx, ep, method, params)
+	return result, ep, err
+}
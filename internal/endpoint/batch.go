@@ -0,0 +1,141 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// maxBatch is the most calls sent in one HTTP request. Providers cap batch
+// sizes, commonly at 100 or more, so longer batches go out in parts.
+const maxBatch = 100
+
+// Call is one JSON-RPC call of a batch.
+type Call struct {
+	Method string `json:"method"`
+	Params []any  `json:"params"`
+}
+
+// Reply is the outcome of one call of a batch: its raw result, or the
+// error the node answered it with.
+type Reply struct {
+	Result json.RawMessage
+	Err    error
+}
+
+// RPCBatch sends calls to ep as JSON-RPC batches, in as few HTTP requests
+// as the batch size limit allows, and returns their replies in the same
+// order. A call the node fails has its error in its Reply; the error
+// returned is for a batch that failed as a whole, which is retried as
+// RPCCall retries a single call when every call in it may be.
+func RPCBatch(ctx context.Context, ep Endpoint, calls []Call) ([]Reply, error) {
+	replies := make([]Reply, 0, len(calls))
+	for start := 0; start < len(calls); start += maxBatch {
+		part, err := batchWithRetry(ctx, ep, calls[start:min(start+maxBatch, len(calls))])
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, part...)
+	}
+	return replies, nil
+}
+
+// batchWithRetry sends one batch, retrying it per the Retry policy.
+func batchWithRetry(ctx context.Context, ep Endpoint, calls []Call) ([]Reply, error) {
+	r := ep.retry()
+	replies, err := batchAttempt(ctx, ep, calls)
+	n := 0
+	for ; err != nil && ctx.Err() == nil && n < r.Attempts && batchRetryable(calls, err); n++ {
+		wait := r.backoff(n+1, err)
+		slog.Debug("rpc batch retried", "subsystem", "endpoint", "endpoint", ep.ID, "calls", len(calls), "attempt", n+2, "wait", wait, "error", err)
+		countRetry(ep.ID, func(st *RetryStats) { st.Retries++ })
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		replies, err = batchAttempt(ctx, ep, calls)
+	}
+	if n > 0 {
+		countRetry(ep.ID, func(st *RetryStats) {
+			if err == nil {
+				st.Recovered++
+			} else {
+				st.GaveUp++
+			}
+		})
+	}
+	return replies, err
+}
+
+// batchRetryable reports whether a batch of calls that failed with err is
+// worth sending again.
+func batchRetryable(calls []Call, err error) bool {
+	for _, c := range calls {
+		if !retryable(c.Method, err) {
+			return false
+		}
+	}
+	return true
+}
+
+// batchAttempt sends calls to ep as one JSON-RPC batch, once. Each call's
+// id is its index, since nodes may answer a batch in any order.
+func batchAttempt(ctx context.Context, ep Endpoint, calls []Call) ([]Reply, error) {
+	body := make([]map[string]any, len(calls))
+	for i, c := range calls {
+		params := c.Params
+		if params == nil {
+			params = []any{}
+		}
+		body[i] = map[string]any{
+			"jsonrpc": "2.0",
+			"id":      i,
+			"method":  c.Method,
+			"params":  params,
+		}
+	}
+	var raw json.RawMessage
+	if err := post(ctx, ep, body, &raw); err != nil {
+		return nil, err
+	}
+
+	var results []struct {
+		ID     *int            `json:"id"`
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &results); err != nil {
+		// Nodes that refuse batches answer with a single error object.
+		var single struct {
+			Error *RPCError `json:"error"`
+		}
+		if json.Unmarshal(raw, &single) == nil && single.Error != nil {
+			return nil, single.Error
+		}
+		return nil, fmt.Errorf("unexpected batch response: %w", err)
+	}
+
+	replies := make([]Reply, len(calls))
+	answered := make([]bool, len(calls))
+	for _, res := range results {
+		if res.ID == nil || *res.ID < 0 || *res.ID >= len(calls) {
+			continue
+		}
+		if res.Error != nil {
+			replies[*res.ID] = Reply{Err: res.Error}
+		} else {
+			replies[*res.ID] = Reply{Result: res.Result}
+		}
+		answered[*res.ID] = true
+	}
+	for i, ok := range answered {
+		if !ok {
+			replies[i].Err = errors.New("rpc: no reply to " + calls[i].Method + " in batch")
+		}
+	}
+	return replies, nil
+}
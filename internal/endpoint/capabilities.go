@@ -0,0 +1,328 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// capabilityTTL is how long a probe's result is trusted. Providers turn
+// namespaces on and off rarely, and probing on every poll would double its
+// cost.
+const capabilityTTL = 30 * time.Minute
+
+// wsTimeout bounds the WebSocket probe's dial and first answer.
+const wsTimeout = 5 * time.Second
+
+// zeroHash is looked up by probes: a node that serves a method answers it
+// with null or "not found", one that doesn't with a method error.
+const zeroHash = "0x0000000000000000000000000000000000000000000000000000000000000000"
+
+// stateDepths are how many blocks behind the head state is probed for when
+// block 1's isn't served, deepest first. 128 is what Geth keeps by default.
+var stateDepths = []uint64{100_000, 10_000, 1_000, 128}
+
+// Capabilities are the optional methods and transports an endpoint was
+// found to serve.
+type Capabilities struct {
+	Debug      bool      `json:"debug"`       // debug_traceTransaction
+	Trace      bool      `json:"trace"`       // trace_transaction
+	TxPool     bool      `json:"txpool"`      // txpool_status
+	FeeHistory bool      `json:"fee_history"` // eth_feeHistory
+	WebSocket  bool      `json:"websocket"`   // JSON-RPC over ws:// or wss:// at the same address
+	Archive    bool      `json:"archive"`     // serves state back to block 1
+	StateDepth uint64    `json:"state_depth"` // blocks behind the head it serves state for; the head itself when archive
+	ProbedAt   time.Time `json:"probed_at"`
+}
+
+// TraceMethod is the trace method InternalTransfers uses: TraceParity,
+// TraceDebug, or empty when ep serves neither.
+func (c Capabilities) TraceMethod() string {
+	switch {
+	case c.Trace:
+		return TraceParity
+	case c.Debug:
+		return TraceDebug
+	}
+	return ""
+}
+
+// Unserved reports whether method is one the probes found the endpoint
+// doesn't serve. Methods outside the probed namespaces are never unserved.
+func (c Capabilities) Unserved(method string) bool {
+	switch {
+	case strings.HasPrefix(method, "debug_trace"):
+		return !c.Debug
+	case strings.HasPrefix(method, "trace_"):
+		return !c.Trace
+	case strings.HasPrefix(method, "txpool_"):
+		return !c.TxPool
+	case method == "eth_feeHistory":
+		return !c.FeeHistory
+	}
+	return false
+}
+
+var probeCache = struct {
+	sync.Mutex
+	probes map[string]probed // by ID and URL, so an edited endpoint is probed again
+}{probes: map[string]probed{}}
+
+// probed is a cached probe, with the chain and head it saw, which routing
+// historical queries needs.
+type probed struct {
+	caps    Capabilities
+	chainID string
+	head    uint64
+}
+
+func probeKey(ep Endpoint) string {
+	return ep.ID + " " + ep.URL
+}
+
+// Cached returns ep's last probed capabilities without probing, and whether
+// there were any still fresh. Request paths use it so a cold cache never
+// slows them down; polling fills it.
+func Cached(ep Endpoint) (Capabilities, bool) {
+	p, ok := cachedProbe(ep)
+	return p.caps, ok
+}
+
+func cachedProbe(ep Endpoint) (probed, bool) {
+	probeCache.Lock()
+	defer probeCache.Unlock()
+	p, ok := probeCache.probes[probeKey(ep)]
+	if !ok || time.Since(p.caps.ProbedAt) >= capabilityTTL {
+		return probed{}, false
+	}
+	return p, true
+}
+
+// Probe returns ep's capabilities, probing it when the last result is older
+// than capabilityTTL. The probes run in parallel. A result that a probe
+// couldn't settle, because the endpoint didn't answer, is not cached.
+func Probe(ctx context.Context, ep Endpoint) Capabilities {
+	if caps, ok := Cached(ep); ok {
+		return caps
+	}
+	caps := Capabilities{ProbedAt: time.Now().UTC()}
+	var chainID string
+	var head uint64
+	var mu sync.Mutex
+	settled := true
+	probe := func(served *bool, check func() (bool, error)) func() {
+		return func() {
+			ok, err := check()
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				settled = false
+				return
+			}
+			*served = ok
+		}
+	}
+	probes := []func(){
+		probe(&caps.Debug, func() (bool, error) { return serves(ctx, ep, "debug_traceTransaction", zeroHash) }),
+		probe(&caps.Trace, func() (bool, error) { return serves(ctx, ep, "trace_transaction", zeroHash) }),
+		probe(&caps.TxPool, func() (bool, error) { return serves(ctx, ep, "txpool_status") }),
+		probe(&caps.FeeHistory, func() (bool, error) { return serves(ctx, ep, "eth_feeHistory", "0x1", "latest", []any{}) }),
+		probe(&caps.WebSocket, func() (bool, error) { return probeWebSocket(ctx, ep), nil }),
+		func() {
+			id, err := rpcCall(ctx, ep, "eth_chainId", nil)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				settled = false
+				return
+			}
+			chainID = id
+		},
+		func() {
+			h, archive, depth, err := probeState(ctx, ep)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				settled = false
+				return
+			}
+			head, caps.Archive, caps.StateDepth = h, archive, depth
+		},
+	}
+	var wg sync.WaitGroup
+	for _, p := range probes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p()
+		}()
+	}
+	wg.Wait()
+	if settled {
+		probeCache.Lock()
+		probeCache.probes[probeKey(ep)] = probed{caps: caps, chainID: chainID, head: head}
+		probeCache.Unlock()
+	}
+	return caps
+}
+
+// serves calls method and reports whether ep serves it. A JSON-RPC error
+// that isn't about the method, such as "not found" for the zero hash, means
+// it does; an HTTP error or a body that isn't JSON-RPC means a gateway
+// turned it away. Only a transport error leaves it unsettled.
+func serves(ctx context.Context, ep Endpoint, method string, params ...any) (bool, error) {
+	_, err := RPCCall(ctx, ep, method, params)
+	if err == nil {
+		return true, nil
+	}
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		return !methodMissing(rpcErr), nil
+	}
+	if transportError(err) {
+		return false, err
+	}
+	return false, nil
+}
+
+// transportError reports whether err is a failure to reach the endpoint
+// rather than an answer from it.
+func transportError(err error) bool {
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// methodMissing reports whether e says the method isn't served, which
+// nodes and providers put in different words.
+func methodMissing(e *RPCError) bool {
+	if e.Code == -32601 {
+		return true
+	}
+	msg := strings.ToLower(e.Message)
+	if !strings.Contains(msg, "method") && !strings.Contains(msg, "namespace") {
+		return false
+	}
+	for _, s := range []string{"not found", "does not exist", "not available", "not supported", "unsupported", "not allowed", "not enabled", "disabled"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// probeState finds ep's head and how far back it serves state by asking for the zero
+// address's balance at block 1, then at each of stateDepths behind the
+// head. A node without the state answers with an error such as "missing
+// trie node".
+func probeState(ctx context.Context, ep Endpoint) (head uint64, archive bool, depth uint64, err error) {
+	hexHead, err := rpcCall(ctx, ep, "eth_blockNumber", nil)
+	if err != nil {
+		return 0, false, 0, err
+	}
+	n, err := evm.ParseQuantity(hexHead)
+	if err != nil || !n.IsUint64() {
+		return 0, false, 0, errors.New("invalid block number " + hexHead)
+	}
+	head = n.Uint64()
+	balanceAt := func(block uint64) (bool, error) {
+		_, err := RPCCall(ctx, ep, "eth_getBalance", []any{evm.Address{}.Hex(), evm.EncodeQuantity(new(big.Int).SetUint64(block))})
+		if err == nil {
+			return true, nil
+		}
+		if transportError(err) {
+			return false, err
+		}
+		return false, nil
+	}
+	if head > 1 {
+		ok, err := balanceAt(1)
+		if err != nil {
+			return 0, false, 0, err
+		}
+		if ok {
+			return head, true, head, nil
+		}
+	}
+	for _, d := range stateDepths {
+		if d >= head {
+			continue
+		}
+		ok, err := balanceAt(head - d)
+		if err != nil {
+			return 0, false, 0, err
+		}
+		if ok {
+			return head, false, d, nil
+		}
+	}
+	return head, false, 0, nil
+}
+
+// probeWebSocket reports whether ep's address, with ws:// or wss:// for
+// http:// or https://, answers eth_chainId over a WebSocket. Providers that
+// serve WebSockets on another path aren't found. The WebSocket is dialed
+// directly, so endpoints reached through a proxy aren't probed.
+func probeWebSocket(ctx context.Context, ep Endpoint) bool {
+	if proxied(ep) {
+		return false
+	}
+	u, err := url.Parse(ep.URL)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	default:
+		return false
+	}
+	var auth string
+	switch {
+	case ep.JWTSecret != "":
+		token, err := jwtToken(ep.JWTSecret)
+		if err != nil {
+			return false
+		}
+		auth = "Bearer " + token
+	case u.User != nil:
+		pass, _ := u.User.Password()
+		auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(u.User.Username()+":"+pass))
+		u.User = nil
+	}
+	origin := *u
+	origin.Scheme, origin.Path, origin.RawQuery = "http", "/", ""
+	cfg, err := websocket.NewConfig(u.String(), origin.String())
+	if err != nil {
+		return false
+	}
+	if auth != "" {
+		cfg.Header.Set("Authorization", auth)
+	}
+	ctx, cancel := context.WithTimeout(ctx, wsTimeout)
+	defer cancel()
+	conn, err := cfg.DialContext(ctx)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(wsTimeout))
+	if err := websocket.JSON.Send(conn, map[string]any{"jsonrpc": "2.0", "id": 1, "method": "eth_chainId", "params": []any{}}); err != nil {
+		return false
+	}
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+	}
+	return websocket.JSON.Receive(conn, &reply) == nil && len(reply.Result) > 0
+}
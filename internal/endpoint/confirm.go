@@ -0,0 +1,104 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// maxConfirmations bounds an endpoint's Confirmations; beyond a few
+// thousand blocks every chain is final.
+const maxConfirmations = 10000
+
+// ConfirmDepth returns how many blocks deep a transaction sent through ep
+// must be to count as confirmed: its Confirmations, and at least 1.
+func (ep Endpoint) ConfirmDepth() uint64 {
+	return uint64(max(ep.Confirmations, 1))
+}
+
+// Receipt is the part of a transaction receipt that tells where and how it
+// was mined, and what it cost.
+type Receipt struct {
+	Status            string `json:"status"` // 0x1 succeeded, 0x0 reverted
+	BlockNumber       string `json:"blockNumber"`
+	BlockHash         string `json:"blockHash"`
+	GasUsed           string `json:"gasUsed"`
+	EffectiveGasPrice string `json:"effectiveGasPrice"`
+	L1Fee             string `json:"l1Fee,omitempty"` // OP Stack rollups: the L1 data fee, charged on top
+	Logs              []struct {
+		Address string   `json:"address"`
+		Topics  []string `json:"topics"`
+		Data    string   `json:"data"`
+	} `json:"logs"`
+}
+
+// ReadReceipt returns the receipt of hash on ep, or nil while it isn't
+// mined.
+func ReadReceipt(ctx context.Context, ep Endpoint, hash string) (*Receipt, error) {
+	raw, err := RPCCall(ctx, ep, "eth_getTransactionReceipt", []any{hash})
+	if err != nil {
+		return nil, err
+	}
+	var receipt *Receipt
+	if err := json.Unmarshal(raw, &receipt); err != nil {
+		return nil, fmt.Errorf("eth_getTransactionReceipt: unexpected result %s", raw)
+	}
+	return receipt, nil
+}
+
+// Fee returns what the transaction cost its sender in wei: the gas it used
+// at its effective price, plus a rollup's L1 data fee. It is nil if the
+// receipt doesn't say.
+func (r Receipt) Fee() *big.Int {
+	used, err := evm.ParseQuantity(r.GasUsed)
+	if err != nil {
+		return nil
+	}
+	price, err := evm.ParseQuantity(r.EffectiveGasPrice)
+	if err != nil {
+		return nil
+	}
+	fee := new(big.Int).Mul(used, price)
+	if l1, err := evm.ParseQuantity(r.L1Fee); err == nil {
+		fee.Add(fee, l1)
+	}
+	return fee
+}
+
+// ReadBlockTime returns the timestamp of block, a hex number, on ep.
+func ReadBlockTime(ctx context.Context, ep Endpoint, block string) (time.Time, error) {
+	raw, err := RPCCall(ctx, ep, "eth_getBlockByNumber", []any{block, false})
+	if err != nil {
+		return time.Time{}, err
+	}
+	var b *struct {
+		Timestamp string `json:"timestamp"`
+	}
+	if err := json.Unmarshal(raw, &b); err != nil || b == nil {
+		return time.Time{}, fmt.Errorf("eth_getBlockByNumber: unexpected result %s", raw)
+	}
+	ts, err := evm.ParseQuantity(b.Timestamp)
+	if err != nil || !ts.IsInt64() {
+		return time.Time{}, fmt.Errorf("eth_getBlockByNumber: invalid timestamp %q", b.Timestamp)
+	}
+	return time.Unix(ts.Int64(), 0).UTC(), nil
+}
+
+// ReadHead returns ep's latest block number, in hex.
+func ReadHead(ctx context.Context, ep Endpoint) (string, error) {
+	return rpcCall(ctx, ep, "eth_blockNumber", nil)
+}
+
+// Depth returns how many blocks deep block is under head, both hex: 1 when
+// it is the head, and 0 when it is ahead of it or either doesn't parse.
+func Depth(block, head string) uint64 {
+	b, h := quantity(block), quantity(head)
+	if block == "" || head == "" || h < b {
+		return 0
+	}
+	return h - b + 1
+}
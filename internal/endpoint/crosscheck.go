@@ -0,0 +1,212 @@
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math/big"
+	"sync"
+
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// Outcomes of a cross-check.
+const (
+	CheckMatch       = "match"
+	CheckMismatch    = "mismatch"
+	CheckUnavailable = "unavailable" // no other endpoint of the chain, or it didn't answer
+)
+
+// checkedMethods are the state reads CrossChecked verifies. eth_getProof is
+// left out: its answer is large, and a proof checks itself against a state
+// root anyway.
+var checkedMethods = map[string]bool{
+	"eth_getBalance":          true,
+	"eth_getCode":             true,
+	"eth_getTransactionCount": true,
+	"eth_getStorageAt":        true,
+	"eth_call":                true,
+}
+
+// CrossCheckable reports whether CrossChecked verifies method.
+func CrossCheckable(method string) bool {
+	return checkedMethods[method]
+}
+
+// CrossCheck is the answer a second endpoint gave to the same state read.
+type CrossCheck struct {
+	Endpoint string          `json:"endpoint,omitempty"`
+	Block    string          `json:"block,omitempty"` // the block both were asked about
+	Status   string          `json:"status"`          // match, mismatch, or unavailable
+	Result   json.RawMessage `json:"result,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// peer returns another endpoint probed on ep's chain, preferring one that
+// keeps block's state. Private endpoints, which are for sends, aren't
+// peers.
+func (s *Store) peer(ep Endpoint, block *uint64) (Endpoint, bool) {
+	p, ok := cachedProbe(ep)
+	if !ok || p.chainID == "" {
+		return Endpoint{}, false
+	}
+	var found Endpoint
+	ok = false
+	for _, alt := range s.List() {
+		if alt.ID == ep.ID || alt.Private {
+			continue
+		}
+		q, probed := cachedProbe(alt)
+		if !probed || q.chainID != p.chainID {
+			continue
+		}
+		if !tooOld(alt, block) {
+			return alt, true
+		}
+		if !ok {
+			found, ok = alt, true
+		}
+	}
+	return found, ok
+}
+
+// CrossChecked makes a JSON-RPC call to ep like Historical and, for a state
+// read, asks another endpoint of the same chain too. Reads of the latest
+// state are pinned to the lower of the two heads, so a block arriving in
+// between isn't taken for a discrepancy; reads of pending state aren't
+// checked. The check is nil when the call isn't one that is checked.
+func (s *Store) CrossChecked(ctx context.Context, ep Endpoint, method string, params []any) (json.RawMessage, Endpoint, *CrossCheck, error) {
+	i := stateMethods[method]
+	if !checkedMethods[method] || i < len(params) && params[i] == "pending" {
+		result, servedBy, err := s.Historical(ctx, ep, method, params)
+		return result, servedBy, nil, err
+	}
+	block, _ := stateBlock(method, params)
+	alt, ok := s.peer(ep, block)
+	if !ok {
+		result, servedBy, err := s.Historical(ctx, ep, method, params)
+		return result, servedBy, &CrossCheck{Status: CheckUnavailable, Error: "no other endpoint serves the chain"}, err
+	}
+
+	check := &CrossCheck{Endpoint: alt.ID}
+	if i >= len(params) || params[i] == nil || params[i] == "latest" {
+		tag, err := commonHead(ctx, ep, alt)
+		if err != nil {
+			result, servedBy, err := s.Historical(ctx, ep, method, params)
+			check.Status, check.Error = CheckUnavailable, "head: "+err.Error()
+			return result, servedBy, check, err
+		}
+		pinned := make([]any, i+1)
+		copy(pinned, params)
+		pinned[i] = tag
+		params = pinned
+	}
+	if tag, ok := params[i].(string); ok {
+		check.Block = tag
+	}
+
+	var (
+		result, altResult json.RawMessage
+		servedBy          Endpoint
+		err, altErr       error
+		wg                sync.WaitGroup
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		result, servedBy, err = s.Historical(ctx, ep, method, params)
+	}()
+	go func() {
+		defer wg.Done()
+		altResult, altErr = RPCCall(ctx, alt, method, params)
+	}()
+	wg.Wait()
+
+	switch {
+	case altErr != nil && (transportError(altErr) || StateUnavailable(altErr)):
+		check.Status, check.Error = CheckUnavailable, altErr.Error()
+	case err != nil && (transportError(err) || StateUnavailable(err)):
+		// ep's own failure is reported to the caller; there is nothing to
+		// compare.
+		check.Status = CheckUnavailable
+	case sameAnswer(result, err, altResult, altErr):
+		check.Status = CheckMatch
+	default:
+		check.Status = CheckMismatch
+		check.Result = altResult
+		if altErr != nil {
+			check.Error = altErr.Error()
+		}
+		slog.Warn("rpc results differ", "subsystem", "rpc", "method", method, "block", check.Block,
+			"endpoint", servedBy.ID, "result", answer(result, err),
+			"peer", alt.ID, "peer_result", answer(altResult, altErr))
+	}
+	if check.Status == CheckUnavailable {
+		slog.Debug("cross-check unavailable", "subsystem", "rpc", "method", method, "endpoint", ep.ID, "peer", alt.ID, "error", check.Error)
+	}
+	return result, servedBy, check, err
+}
+
+// commonHead returns the lower of a's and b's latest block numbers as a
+// quantity.
+func commonHead(ctx context.Context, a, b Endpoint) (string, error) {
+	var heads [2]uint64
+	var errs [2]error
+	var wg sync.WaitGroup
+	for i, ep := range []Endpoint{a, b} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hex, err := rpcCall(ctx, ep, "eth_blockNumber", nil)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			n, err := evm.ParseQuantity(hex)
+			if err != nil || !n.IsUint64() {
+				errs[i] = errors.New("invalid block number " + hex)
+				return
+			}
+			heads[i] = n.Uint64()
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs[:]...); err != nil {
+		return "", err
+	}
+	return evm.EncodeQuantity(new(big.Int).SetUint64(min(heads[0], heads[1]))), nil
+}
+
+// sameAnswer reports whether two endpoints answered alike: equal results,
+// ignoring the case of hex digits, reverts with the same data, or both
+// refusing the request, which nodes word differently.
+func sameAnswer(a json.RawMessage, aErr error, b json.RawMessage, bErr error) bool {
+	if aErr == nil && bErr == nil {
+		return bytes.EqualFold(bytes.TrimSpace(a), bytes.TrimSpace(b))
+	}
+	var ae, be *RPCError
+	if !errors.As(aErr, &ae) || !errors.As(bErr, &be) {
+		return false
+	}
+	ad, aRevert := ae.RevertData()
+	bd, bRevert := be.RevertData()
+	if aRevert != bRevert {
+		return false
+	}
+	return !aRevert || bytes.Equal(ad, bd)
+}
+
+// answer is a result or error for the log, cut short so a large call
+// output doesn't flood it.
+func answer(result json.RawMessage, err error) string {
+	s := string(result)
+	if err != nil {
+		s = err.Error()
+	}
+	if len(s) > 200 {
+		s = s[:200] + "…"
+	}
+	return s
+}
@@ -0,0 +1,136 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// Flags Poll sets on a Status.
+const (
+	FlagLagging = "lagging" // more than lagThreshold blocks behind the highest endpoint of its chain
+	FlagForked  = "forked"  // has another block than most endpoints of its chain at their common height
+)
+
+// lagThreshold is how many blocks an endpoint may trail the highest one of
+// its chain before it is flagged. A block or two is just a poll that caught
+// a new block propagating.
+const lagThreshold = 3
+
+// forkDepth is how far below the common height blocks are compared, so a
+// reorg at the tip that one endpoint hasn't caught up with yet isn't taken
+// for a fork.
+const forkDepth = 2
+
+// compare flags lagging and forked endpoints among statuses that are online
+// and share a chain ID. eps and statuses are in the same order.
+func compare(ctx context.Context, eps []Endpoint, statuses []Status) {
+	groups := map[string][]int{}
+	for i, st := range statuses {
+		if st.Online && st.ChainID != "" && st.BlockNumber != "" {
+			id := strings.ToLower(st.ChainID)
+			groups[id] = append(groups[id], i)
+		}
+	}
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		heights := map[int]uint64{}
+		var highest, lowest uint64
+		for _, i := range group {
+			n, err := evm.ParseQuantity(statuses[i].BlockNumber)
+			if err != nil || !n.IsUint64() {
+				continue
+			}
+			h := n.Uint64()
+			if len(heights) == 0 || h > highest {
+				highest = h
+			}
+			if len(heights) == 0 || h < lowest {
+				lowest = h
+			}
+			heights[i] = h
+		}
+		for i, h := range heights {
+			statuses[i].LagBlocks = highest - h
+			if highest-h > lagThreshold {
+				statuses[i].Flags = append(statuses[i].Flags, FlagLagging)
+			}
+		}
+		if len(heights) < 2 || lowest <= forkDepth {
+			continue
+		}
+		compareHashes(ctx, eps, statuses, heights, lowest-forkDepth)
+	}
+}
+
+// compareHashes fetches each endpoint's block at height and flags those
+// whose hash isn't the one most of them have. With no majority, as with two
+// endpoints that disagree, all of them are flagged.
+func compareHashes(ctx context.Context, eps []Endpoint, statuses []Status, heights map[int]uint64, height uint64) {
+	hashes := map[int]string{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	tag := evm.EncodeQuantity(new(big.Int).SetUint64(height))
+	for i := range heights {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			hash, err := blockHash(ctx, eps[i], tag)
+			if err != nil || hash == "" {
+				slog.Debug("block hash unavailable", "subsystem", "endpoint", "endpoint", eps[i].ID, "block", tag, "error", err)
+				return
+			}
+			mu.Lock()
+			hashes[i] = strings.ToLower(hash)
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	if len(hashes) < 2 {
+		return
+	}
+	votes := map[string]int{}
+	for _, h := range hashes {
+		votes[h]++
+	}
+	if len(votes) == 1 {
+		return
+	}
+	majority, best, tied := "", 0, false
+	for h, n := range votes {
+		switch {
+		case n > best:
+			majority, best, tied = h, n, false
+		case n == best:
+			tied = true
+		}
+	}
+	for i, h := range hashes {
+		if tied || h != majority {
+			statuses[i].Flags = append(statuses[i].Flags, FlagForked)
+			slog.Debug("endpoint diverged", "subsystem", "endpoint", "endpoint", eps[i].ID, "block", tag, "hash", h)
+		}
+	}
+}
+
+// blockHash returns the hash of ep's block at tag.
+func blockHash(ctx context.Context, ep Endpoint, tag string) (string, error) {
+	raw, err := RPCCall(ctx, ep, "eth_getBlockByNumber", []any{tag, false})
+	if err != nil {
+		return "", err
+	}
+	var block *struct {
+		Hash string `json:"hash"`
+	}
+	if err := json.Unmarshal(raw, &block); err != nil || block == nil {
+		return "", err
+	}
+	return block.Hash, nil
+}
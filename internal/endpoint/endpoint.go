@@ -2,47 +2,157 @@ package endpoint
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/primal-host/wallet/internal/asset"
+	"github.com/primal-host/wallet/internal/evm"
 )
 
 // Endpoint represents a named EVM RPC endpoint.
 type Endpoint struct {
-	ID     string `json:"id"`
-	Name   string `json:"name"`
-	URL    string `json:"url"`
-	Symbol string `json:"symbol"` // native token symbol (e.g. "AVAX", "ETH")
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	URL   string `json:"url"`
+	Asset string `json:"asset"` // registry ID of the native currency (e.g. "avax")
+
+	// Native is the resolved Asset, filled in by the Store on every read.
+	Native asset.Asset `json:"-"`
+
+	// settings are the Store's own timeout and retry policy, filled in
+	// with Native; nil uses the process-wide ones.
+	settings *Settings
+
+	// JWTSecret, when set, signs every request with a short-lived HS256
+	// bearer token, as Engine API ports and JWT-protected proxies require.
+	JWTSecret string `json:"jwt_secret,omitempty"` // hex
+
+	// Timeout bounds each request to the endpoint, as a duration such as
+	// "30s"; empty uses the Store's Settings or the default set with
+	// SetTimeout.
+	Timeout string `json:"timeout,omitempty"`
+
+	// Proxy routes requests to the endpoint through an HTTP or SOCKS5
+	// proxy, or Tor, in place of the default set with SetTransport;
+	// ProxyDirect bypasses any proxy.
+	Proxy string `json:"proxy,omitempty"`
+
+	// PollInterval is how often the endpoint is checked, as a duration
+	// such as "1m"; empty uses the Store's Settings or the default set
+	// with SetPolling.
+	PollInterval string `json:"poll_interval,omitempty"`
+
+	// Consensus, the URL of a beacon node's REST API, makes the endpoint a
+	// light client: the beacon chain is followed from Checkpoint, a
+	// trusted block root, by checking sync committee signatures, and state
+	// reads are verified against the execution headers it attests to.
+	// Without a checkpoint the beacon node's finalized block is trusted
+	// on first use.
+	Consensus  string `json:"consensus,omitempty"`
+	Checkpoint string `json:"checkpoint,omitempty"`
+
+	// Private marks a private submission endpoint, such as Flashbots
+	// Protect or a compatible relay, which keeps the transactions sent to
+	// it out of the public mempool until they are mined. StatusURL is the
+	// relay's transaction status API, the hash appended; Flashbots
+	// Protect's is used for its own RPC when empty, and other relays'
+	// transactions are followed by their receipts.
+	Private   bool   `json:"private,omitempty"`
+	StatusURL string `json:"status_url,omitempty"`
+
+	// Confirmations is how many blocks deep, its own included, a
+	// transaction sent through the endpoint must be before it counts as
+	// confirmed; until then it is only mined, and goes back to waiting if
+	// a reorg takes its block away. 0 counts it confirmed once mined.
+	Confirmations int `json:"confirmations,omitempty"`
+
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // set while in the recycle bin
 }
 
 // Status is the live health info for an endpoint.
 type Status struct {
-	ID          string `json:"id"`
-	Name        string `json:"name"`
-	URL         string `json:"url"`
-	Symbol      string `json:"symbol"`
-	Online      bool   `json:"online"`
-	ChainID     string `json:"chain_id,omitempty"`
-	BlockNumber string `json:"block_number,omitempty"`
-	Latency     int64  `json:"latency_ms"`
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	URL           string `json:"url"`
+	Asset         string `json:"asset"`
+	Symbol        string `json:"symbol"`
+	Decimals      int    `json:"decimals"`
+	HasJWT        bool   `json:"has_jwt,omitempty"` // the secret itself is only served to managers
+	Timeout       string `json:"timeout,omitempty"`
+	Proxy         string `json:"proxy,omitempty"`
+	PollInterval  string `json:"poll_interval,omitempty"`
+	Consensus     string `json:"consensus,omitempty"`
+	Checkpoint    string `json:"checkpoint,omitempty"`
+	Private       bool   `json:"private,omitempty"`
+	StatusURL     string `json:"status_url,omitempty"`
+	Confirmations int    `json:"confirmations,omitempty"`
+	Online        bool   `json:"online"`
+	ChainID       string `json:"chain_id,omitempty"`
+	BlockNumber   string `json:"block_number,omitempty"`
+	Latency       int64  `json:"latency_ms"`
+
+	// CheckedAt is when the endpoint was last asked; Poll reports a
+	// check again until the endpoint is due another.
+	CheckedAt time.Time `json:"checked_at"`
+
+	// Capabilities are the optional methods and transports the endpoint
+	// serves, probed once it is online and cached for capabilityTTL.
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+
+	// Poll compares endpoints serving the same chain. LagBlocks is how far
+	// behind the highest of them this one is; Flags holds FlagLagging when
+	// that is too far, and FlagForked when its block at their common height
+	// isn't the one most of them have.
+	Flags     []string `json:"flags,omitempty"`
+	LagBlocks uint64   `json:"lag_blocks,omitempty"`
+
+	// Failures counts the failed checks in a row of an offline endpoint;
+	// Recovering, the successful ones of an endpoint still shown offline
+	// until enough have passed.
+	Failures   int `json:"failures,omitempty"`
+	Recovering int `json:"recovering,omitempty"`
+
+	jwtSecret string // checked with; statuses are public, secrets aren't
+}
+
+// CheckedWithJWT reports whether the status was checked with the given JWT
+// secret, so a status can be told stale after the secret changes.
+func (st Status) CheckedWithJWT(secret string) bool {
+	return st.jwtSecret == secret
 }
 
 // Store manages endpoints loaded from a JSON file.
 type Store struct {
 	mu        sync.RWMutex
 	endpoints []Endpoint
+	assets    *asset.Registry
 	path      string
+
+	pollMu sync.Mutex
+	polled map[string]polled // last check by endpoint ID
+	round  []Status          // the last poll's statuses, compared
+
+	settings *Settings // nil uses the process-wide settings
 }
 
-// NewStore loads endpoints from a JSON file. If the file doesn't exist, starts empty.
-func NewStore(path string) (*Store, error) {
-	s := &Store{path: path}
+// NewStore loads endpoints from a JSON file. If the file doesn't exist, starts
+// empty. Endpoints saved before the asset registry existed carry a free-text
+// symbol; those symbols are registered in assets and the file is rewritten
+// with asset IDs.
+func NewStore(path string, assets *asset.Registry) (*Store, error) {
+	s := &Store{path: path, assets: assets}
 	data, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -51,21 +161,102 @@ func NewStore(path string) (*Store, error) {
 		}
 		return nil, fmt.Errorf("read endpoints: %w", err)
 	}
-	if err := json.Unmarshal(data, &s.endpoints); err != nil {
+	var stored []struct {
+		Endpoint
+		Symbol string `json:"symbol"`
+	}
+	if err := json.Unmarshal(data, &stored); err != nil {
 		return nil, fmt.Errorf("parse endpoints: %w", err)
 	}
+	migrated := 0
+	s.endpoints = make([]Endpoint, len(stored))
+	for i, st := range stored {
+		s.endpoints[i] = st.Endpoint
+		if st.Asset == "" && strings.TrimSpace(st.Symbol) != "" {
+			a, err := assets.Ensure(st.Symbol)
+			if err != nil {
+				return nil, fmt.Errorf("migrate endpoint %q symbol: %w", st.ID, err)
+			}
+			s.endpoints[i].Asset = a.ID
+			migrated++
+		}
+	}
+	if migrated > 0 {
+		if err := s.save(); err != nil {
+			return nil, err
+		}
+		slog.Info("endpoint symbols moved to asset registry", "subsystem", "endpoint", "count", migrated)
+	}
 	return s, nil
 }
 
-// List returns all configured endpoints.
+// Assets returns the registry that endpoints' native currencies refer to.
+func (s *Store) Assets() *asset.Registry {
+	return s.assets
+}
+
+// resolve fills in ep.Native. An asset missing from the registry (removed by
+// hand from its file) is shown by its ID with 18 decimals.
+func (s *Store) resolve(ep Endpoint) Endpoint {
+	a, ok := s.assets.Get(ep.Asset)
+	if !ok {
+		a = asset.Asset{ID: ep.Asset, Symbol: strings.ToUpper(ep.Asset), Decimals: 18}
+	}
+	ep.Native = a
+	ep.settings = s.settings
+	return ep
+}
+
+// UsesAsset returns the names of endpoints, including deleted ones, whose
+// native currency is the asset id.
+func (s *Store) UsesAsset(id string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var names []string
+	for _, ep := range s.endpoints {
+		if ep.Asset == id {
+			names = append(names, ep.Name)
+		}
+	}
+	return names
+}
+
+// List returns all configured endpoints, excluding deleted ones.
 func (s *Store) List() []Endpoint {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	out := make([]Endpoint, len(s.endpoints))
-	copy(out, s.endpoints)
+	out := make([]Endpoint, 0, len(s.endpoints))
+	for _, ep := range s.endpoints {
+		if ep.DeletedAt == nil {
+			out = append(out, s.resolve(ep))
+		}
+	}
+	return out
+}
+
+// Trash returns deleted endpoints that can still be restored.
+func (s *Store) Trash() []Endpoint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []Endpoint{}
+	for _, ep := range s.endpoints {
+		if ep.DeletedAt != nil {
+			out = append(out, s.resolve(ep))
+		}
+	}
 	return out
 }
 
+// Get returns the endpoint with the given ID.
+func (s *Store) Get(id string) (Endpoint, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if ep := s.findLocked(id); ep != nil && ep.DeletedAt == nil {
+		return s.resolve(*ep), true
+	}
+	return Endpoint{}, false
+}
+
 var slugRe = regexp.MustCompile(`[^a-z0-9-]+`)
 
 // slugify converts a name to a URL-safe ID.
@@ -80,6 +271,20 @@ func slugify(name string) string {
 	return s
 }
 
+// checkAsset normalizes ep.Asset, which may name the asset by ID or symbol in
+// any case, to a registered asset ID.
+func (s *Store) checkAsset(ep *Endpoint) error {
+	if strings.TrimSpace(ep.Asset) == "" {
+		return fmt.Errorf("asset is required")
+	}
+	a, ok := s.assets.Lookup(ep.Asset)
+	if !ok {
+		return fmt.Errorf("asset %q is not registered", ep.Asset)
+	}
+	ep.Asset, ep.Native = a.ID, a
+	return nil
+}
+
 // Add creates a new endpoint, generating an ID from the name.
 func (s *Store) Add(ep Endpoint) (Endpoint, error) {
 	if strings.TrimSpace(ep.Name) == "" {
@@ -91,8 +296,16 @@ func (s *Store) Add(ep Endpoint) (Endpoint, error) {
 	if _, err := url.ParseRequestURI(ep.URL); err != nil {
 		return Endpoint{}, fmt.Errorf("invalid url: %w", err)
 	}
-	if strings.TrimSpace(ep.Symbol) == "" {
-		return Endpoint{}, fmt.Errorf("symbol is required")
+	if err := s.checkAsset(&ep); err != nil {
+		return Endpoint{}, err
+	}
+	if ep.JWTSecret != "" {
+		if _, err := parseJWTSecret(ep.JWTSecret); err != nil {
+			return Endpoint{}, err
+		}
+	}
+	if err := checkConnection(ep); err != nil {
+		return Endpoint{}, err
 	}
 
 	s.mu.Lock()
@@ -112,7 +325,7 @@ func (s *Store) Add(ep Endpoint) (Endpoint, error) {
 		s.endpoints = s.endpoints[:len(s.endpoints)-1]
 		return Endpoint{}, err
 	}
-	return ep, nil
+	return s.resolve(ep), nil
 }
 
 // Update replaces an existing endpoint's fields by ID.
@@ -126,15 +339,23 @@ func (s *Store) Update(id string, ep Endpoint) (Endpoint, error) {
 	if _, err := url.ParseRequestURI(ep.URL); err != nil {
 		return Endpoint{}, fmt.Errorf("invalid url: %w", err)
 	}
-	if strings.TrimSpace(ep.Symbol) == "" {
-		return Endpoint{}, fmt.Errorf("symbol is required")
+	if err := s.checkAsset(&ep); err != nil {
+		return Endpoint{}, err
+	}
+	if ep.JWTSecret != "" {
+		if _, err := parseJWTSecret(ep.JWTSecret); err != nil {
+			return Endpoint{}, err
+		}
+	}
+	if err := checkConnection(ep); err != nil {
+		return Endpoint{}, err
 	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	for i, existing := range s.endpoints {
-		if existing.ID == id {
+		if existing.ID == id && existing.DeletedAt == nil {
 			ep.ID = id
 			old := s.endpoints[i]
 			s.endpoints[i] = ep
@@ -142,21 +363,106 @@ func (s *Store) Update(id string, ep Endpoint) (Endpoint, error) {
 				s.endpoints[i] = old
 				return Endpoint{}, err
 			}
-			return ep, nil
+			s.forget(id)
+			return s.resolve(ep), nil
 		}
 	}
 	return Endpoint{}, fmt.Errorf("endpoint %q not found", id)
 }
 
-// Delete removes an endpoint by ID.
+// Put stores ep under its own ID, replacing any endpoint with that ID,
+// including one in the recycle bin. It restores endpoints from a backup.
+func (s *Store) Put(ep Endpoint) (Endpoint, error) {
+	if strings.TrimSpace(ep.ID) == "" {
+		return Endpoint{}, fmt.Errorf("id is required")
+	}
+	if strings.TrimSpace(ep.Name) == "" {
+		return Endpoint{}, fmt.Errorf("name is required")
+	}
+	if strings.TrimSpace(ep.URL) == "" {
+		return Endpoint{}, fmt.Errorf("url is required")
+	}
+	if _, err := url.ParseRequestURI(ep.URL); err != nil {
+		return Endpoint{}, fmt.Errorf("invalid url: %w", err)
+	}
+	if err := s.checkAsset(&ep); err != nil {
+		return Endpoint{}, err
+	}
+	if ep.JWTSecret != "" {
+		if _, err := parseJWTSecret(ep.JWTSecret); err != nil {
+			return Endpoint{}, err
+		}
+	}
+	if err := checkConnection(ep); err != nil {
+		return Endpoint{}, err
+	}
+	ep.DeletedAt = nil
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := s.endpoints
+	next := make([]Endpoint, 0, len(old)+1)
+	for _, existing := range old {
+		if existing.ID != ep.ID {
+			next = append(next, existing)
+		}
+	}
+	s.endpoints = append(next, ep)
+	if err := s.save(); err != nil {
+		s.endpoints = old
+		return Endpoint{}, err
+	}
+	s.forget(ep.ID)
+	return s.resolve(ep), nil
+}
+
+// Delete moves an endpoint to the recycle bin. It stops being listed and
+// polled but keeps its ID until restored or purged.
 func (s *Store) Delete(id string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	ep := s.findLocked(id)
+	if ep == nil || ep.DeletedAt != nil {
+		return fmt.Errorf("endpoint %q not found", id)
+	}
+	now := time.Now().UTC()
+	ep.DeletedAt = &now
+	if err := s.save(); err != nil {
+		ep.DeletedAt = nil
+		return err
+	}
+	return nil
+}
+
+// Restore brings a deleted endpoint back from the recycle bin.
+func (s *Store) Restore(id string) (Endpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ep := s.findLocked(id)
+	if ep == nil || ep.DeletedAt == nil {
+		return Endpoint{}, fmt.Errorf("deleted endpoint %q not found", id)
+	}
+	deletedAt := ep.DeletedAt
+	ep.DeletedAt = nil
+	if err := s.save(); err != nil {
+		ep.DeletedAt = deletedAt
+		return Endpoint{}, err
+	}
+	return s.resolve(*ep), nil
+}
+
+// Purge permanently removes a deleted endpoint.
+func (s *Store) Purge(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	for i, ep := range s.endpoints {
-		if ep.ID == id {
+		if ep.ID == id && ep.DeletedAt != nil {
 			old := s.endpoints
-			s.endpoints = append(s.endpoints[:i], s.endpoints[i+1:]...)
+			s.endpoints = append(s.endpoints[:i:i], s.endpoints[i+1:]...)
 			if err := s.save(); err != nil {
 				s.endpoints = old
 				return err
@@ -164,10 +470,80 @@ func (s *Store) Delete(id string) error {
 			return nil
 		}
 	}
-	return fmt.Errorf("endpoint %q not found", id)
+	return fmt.Errorf("deleted endpoint %q not found", id)
+}
+
+// Duplicate describes an existing endpoint that a new or edited endpoint would duplicate.
+type Duplicate struct {
+	Existing Endpoint `json:"existing"`
+	Reason   string   `json:"reason"` // "url" or "chain_host"
 }
 
-// findLocked finds an endpoint by ID. Must be called with mu held.
+// FindDuplicate reports whether ep duplicates an existing endpoint (other than
+// excludeID): either the same URL after normalization, or the same provider
+// host serving the same chain ID. The chain check probes eth_chainId, but only
+// against endpoints on the same host. Returns nil if there is no duplicate.
+func (s *Store) FindDuplicate(ctx context.Context, ep Endpoint, excludeID string) *Duplicate {
+	norm := normalizeURL(ep.URL)
+	host := urlHost(ep.URL)
+
+	var sameHost []Endpoint
+	for _, existing := range s.List() {
+		if existing.ID == excludeID {
+			continue
+		}
+		if normalizeURL(existing.URL) == norm {
+			return &Duplicate{Existing: existing, Reason: "url"}
+		}
+		if host != "" && urlHost(existing.URL) == host {
+			sameHost = append(sameHost, existing)
+		}
+	}
+	if len(sameHost) == 0 {
+		return nil
+	}
+
+	chainID, err := rpcCall(ctx, ep, "eth_chainId", nil)
+	if err != nil {
+		return nil
+	}
+	for _, existing := range sameHost {
+		if id, err := rpcCall(ctx, existing, "eth_chainId", nil); err == nil && strings.EqualFold(id, chainID) {
+			return &Duplicate{Existing: existing, Reason: "chain_host"}
+		}
+	}
+	return nil
+}
+
+// normalizeURL reduces an RPC URL to a comparable form: lowercased scheme and
+// host, default ports and credentials dropped, trailing slash trimmed.
+func normalizeURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return raw
+	}
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && !(scheme == "http" && port == "80") && !(scheme == "https" && port == "443") {
+		host += ":" + port
+	}
+	out := scheme + "://" + host + strings.TrimRight(u.Path, "/")
+	if u.RawQuery != "" {
+		out += "?" + u.RawQuery
+	}
+	return out
+}
+
+// urlHost returns the lowercased hostname of an RPC URL.
+func urlHost(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// findLocked finds an endpoint by ID, including deleted ones. Must be called with mu held.
 func (s *Store) findLocked(id string) *Endpoint {
 	for i := range s.endpoints {
 		if s.endpoints[i].ID == id {
@@ -190,93 +566,367 @@ func (s *Store) save() error {
 	return nil
 }
 
-// Poll checks each endpoint with eth_chainId and eth_blockNumber, returning live status.
-func (s *Store) Poll() []Status {
-	eps := s.List()
-	results := make([]Status, len(eps))
-	var wg sync.WaitGroup
-	for i, ep := range eps {
-		wg.Add(1)
-		go func(i int, ep Endpoint) {
-			defer wg.Done()
-			results[i] = poll(ep)
-		}(i, ep)
-	}
-	wg.Wait()
-	return results
-}
-
-func poll(ep Endpoint) Status {
+// Check polls a single endpoint.
+func Check(ctx context.Context, ep Endpoint) Status {
 	st := Status{
-		ID:     ep.ID,
-		Name:   ep.Name,
-		URL:    ep.URL,
-		Symbol: ep.Symbol,
+		ID:            ep.ID,
+		Name:          ep.Name,
+		URL:           ep.URL,
+		Asset:         ep.Asset,
+		Symbol:        ep.Native.Symbol,
+		Decimals:      ep.Native.Decimals,
+		HasJWT:        ep.JWTSecret != "",
+		jwtSecret:     ep.JWTSecret,
+		Timeout:       ep.Timeout,
+		Proxy:         ep.Proxy,
+		PollInterval:  ep.PollInterval,
+		Consensus:     ep.Consensus,
+		Checkpoint:    ep.Checkpoint,
+		Private:       ep.Private,
+		StatusURL:     ep.StatusURL,
+		Confirmations: ep.Confirmations,
 	}
 
 	start := time.Now()
+	st.CheckedAt = start.UTC()
 
-	// Get chain ID.
-	chainID, err := rpcCall(ep.URL, "eth_chainId", nil)
+	// Get chain ID. Polls make single attempts, so latency is one round
+	// trip and a dead endpoint doesn't hold the poll through retries.
+	chainID, err := stringResult(rpcAttempt(ctx, ep, "eth_chainId", nil))
 	if err != nil {
 		st.Latency = time.Since(start).Milliseconds()
+		slog.Debug("endpoint offline", "subsystem", "endpoint", "endpoint", ep.ID, "method", "eth_chainId", "error", err)
 		return st
 	}
 	st.ChainID = chainID
 
 	// Get block number.
-	blockNum, err := rpcCall(ep.URL, "eth_blockNumber", nil)
+	blockNum, err := stringResult(rpcAttempt(ctx, ep, "eth_blockNumber", nil))
 	if err != nil {
 		st.Latency = time.Since(start).Milliseconds()
 		st.Online = true // chain ID worked, so it's partially online
+		slog.Debug("endpoint poll failed", "subsystem", "endpoint", "endpoint", ep.ID, "method", "eth_blockNumber", "error", err)
 		return st
 	}
 	st.BlockNumber = blockNum
 
 	st.Latency = time.Since(start).Milliseconds()
 	st.Online = true
+	caps := Probe(ctx, ep)
+	st.Capabilities = &caps
 	return st
 }
 
-// RPCCall makes a JSON-RPC call and returns the result string.
-func RPCCall(url, method string, params []any) (json.RawMessage, error) {
+// Metrics is a fuller look at an endpoint than Status, for comparing
+// providers serving the same chain.
+type Metrics struct {
+	Status
+	GasPrice      string `json:"gas_price,omitempty"`      // hex wei
+	PendingCount  *int64 `json:"pending_count,omitempty"`  // unset when the node won't say
+	PendingSource string `json:"pending_source,omitempty"` // txpool (whole pool) or pending_block
+}
+
+// Measure checks ep and adds its gas price and pending pool size. The pool
+// size comes from txpool_status where the node was found to serve it;
+// otherwise it is the number of transactions in the node's pending block, a
+// lower bound.
+func Measure(ctx context.Context, ep Endpoint) Metrics {
+	m := Metrics{Status: Check(ctx, ep)}
+	if !m.Online {
+		return m
+	}
+	if gas, err := rpcCall(ctx, ep, "eth_gasPrice", nil); err == nil {
+		m.GasPrice = gas
+	}
+
+	if m.Capabilities != nil && m.Capabilities.TxPool {
+		if raw, err := RPCCall(ctx, ep, "txpool_status", nil); err == nil {
+			var pool struct {
+				Pending string `json:"pending"`
+			}
+			if json.Unmarshal(raw, &pool) == nil {
+				if n, err := strconv.ParseInt(strings.TrimPrefix(pool.Pending, "0x"), 16, 64); err == nil {
+					m.PendingCount, m.PendingSource = &n, "txpool"
+					return m
+				}
+			}
+		}
+	}
+	if count, err := rpcCall(ctx, ep, "eth_getBlockTransactionCountByNumber", []any{"pending"}); err == nil {
+		if n, err := strconv.ParseInt(strings.TrimPrefix(count, "0x"), 16, 64); err == nil {
+			m.PendingCount, m.PendingSource = &n, "pending_block"
+		}
+	}
+	return m
+}
+
+var defaultTimeout = struct {
+	sync.Mutex
+	d time.Duration
+}{d: 10 * time.Second}
+
+// SetTimeout sets how long a request to an endpoint without a Timeout of
+// its own may take.
+func SetTimeout(d time.Duration) {
+	defaultTimeout.Lock()
+	defer defaultTimeout.Unlock()
+	defaultTimeout.d = d
+}
+
+// Settings are a Store's own timeout, retry policy, and polling, for
+// programs that keep several stores and want them set apart. Zero fields
+// use the process-wide settings of SetTimeout, SetRetry, and SetPolling.
+type Settings struct {
+	Timeout time.Duration
+	Retry   *Retry
+	Polling *Polling
+}
+
+// SetSettings gives s settings of its own. Endpoints read from s carry
+// them, so RPCCall and RPCBatch use them as well as Poll. Call it before
+// the store is used.
+func (s *Store) SetSettings(set Settings) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings = &set
+}
+
+// timeout returns how long a request to ep may take.
+func (ep Endpoint) timeout() time.Duration {
+	if d, err := time.ParseDuration(ep.Timeout); err == nil && d > 0 {
+		return d
+	}
+	if ep.settings != nil && ep.settings.Timeout > 0 {
+		return ep.settings.Timeout
+	}
+	defaultTimeout.Lock()
+	defer defaultTimeout.Unlock()
+	return defaultTimeout.d
+}
+
+// checkConnection validates an endpoint's timeout, proxy, poll interval,
+// light client, private submission, and confirmation settings, which may be
+// empty.
+func checkConnection(ep Endpoint) error {
+	if ep.Timeout != "" {
+		if d, err := time.ParseDuration(ep.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid timeout %q: use a duration such as 30s", ep.Timeout)
+		}
+	}
+	if _, err := ParseProxy(ep.Proxy); err != nil {
+		return err
+	}
+	if ep.Consensus != "" {
+		if u, err := url.ParseRequestURI(ep.Consensus); err != nil || u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("invalid consensus url %q: use the http:// or https:// URL of a beacon node", ep.Consensus)
+		}
+	}
+	if ep.Checkpoint != "" {
+		if ep.Consensus == "" {
+			return fmt.Errorf("a checkpoint needs a consensus url")
+		}
+		if b, err := evm.DecodeHex(ep.Checkpoint); err != nil || len(b) != 32 || !strings.HasPrefix(ep.Checkpoint, "0x") {
+			return fmt.Errorf("invalid checkpoint %q: use a 0x-prefixed beacon block root", ep.Checkpoint)
+		}
+	}
+	if ep.StatusURL != "" {
+		if !ep.Private {
+			return fmt.Errorf("a status url needs a private endpoint")
+		}
+		if u, err := url.ParseRequestURI(ep.StatusURL); err != nil || u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("invalid status url %q: use the http:// or https:// URL the relay appends a transaction hash to", ep.StatusURL)
+		}
+	}
+	if ep.Private && ep.Consensus != "" {
+		return fmt.Errorf("a private endpoint can't be a light client")
+	}
+	if ep.Confirmations < 0 || ep.Confirmations > maxConfirmations {
+		return fmt.Errorf("invalid confirmations %d: use 0 to %d blocks", ep.Confirmations, maxConfirmations)
+	}
+	return checkPollInterval(ep)
+}
+
+// RPCCall makes a JSON-RPC call to ep and returns the raw result,
+// retrying transient failures as the Retry policy set with SetRetry says.
+// Each attempt is bounded by ep's timeout, and canceling ctx ends the call
+// and its retries.
+func RPCCall(ctx context.Context, ep Endpoint, method string, params []any) (json.RawMessage, error) {
+	r := ep.retry()
+	result, err := rpcAttempt(ctx, ep, method, params)
+	n := 0
+	for ; err != nil && ctx.Err() == nil && n < r.Attempts && retryable(method, err); n++ {
+		wait := r.backoff(n+1, err)
+		slog.Debug("rpc call retried", "subsystem", "endpoint", "endpoint", ep.ID, "method", method, "attempt", n+2, "wait", wait, "error", err)
+		countRetry(ep.ID, func(st *RetryStats) { st.Retries++ })
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		result, err = rpcAttempt(ctx, ep, method, params)
+	}
+	if n > 0 {
+		countRetry(ep.ID, func(st *RetryStats) {
+			if err == nil {
+				st.Recovered++
+			} else {
+				st.GaveUp++
+			}
+		})
+	}
+	return result, err
+}
+
+// EthCall makes an eth_call to to at the latest block and returns its
+// output. The calldata is data's parts joined, e.g. a selector and its
+// argument words.
+func EthCall(ctx context.Context, ep Endpoint, to string, data ...[]byte) ([]byte, error) {
+	result, err := RPCCall(ctx, ep, "eth_call", []any{map[string]string{"to": to, "data": evm.EncodeHex(slices.Concat(data...))}, "latest"})
+	if err != nil {
+		return nil, err
+	}
+	var s string
+	if err := json.Unmarshal(result, &s); err != nil {
+		return nil, fmt.Errorf("unexpected eth_call result: %s", result)
+	}
+	return evm.DecodeHex(s)
+}
+
+// rpcAttempt makes a JSON-RPC call to ep once.
+func rpcAttempt(ctx context.Context, ep Endpoint, method string, params []any) (json.RawMessage, error) {
 	body := map[string]any{
 		"jsonrpc": "2.0",
 		"id":      1,
 		"method":  method,
 		"params":  params,
 	}
+	var result struct {
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
+	}
+	if err := post(ctx, ep, body, &result); err != nil {
+		return nil, err
+	}
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return result.Result, nil
+}
+
+// post sends body to ep as JSON and decodes the response into out, within
+// ep's timeout.
+func post(ctx context.Context, ep Endpoint, body, out any) error {
 	data, err := json.Marshal(body)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	ctx, cancel := context.WithTimeout(ctx, ep.timeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.URL, bytes.NewReader(data))
 	if err != nil {
-		return nil, err
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if ep.JWTSecret != "" {
+		token, err := jwtToken(ep.JWTSecret)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
 	}
-	defer resp.Body.Close()
 
-	var result struct {
-		Result json.RawMessage `json:"result"`
-		Error  *struct {
-			Code    int    `json:"code"`
-			Message string `json:"message"`
-		} `json:"error"`
+	resp, err := httpClient(ep).Do(req)
+	if err != nil {
+		return err
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
+	defer func() {
+		// Reading to the end lets the connection be reused.
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+	}()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			// Auth proxies and gateways answer with non-JSON-RPC bodies.
+			return httpError(resp)
+		}
+		return err
 	}
-	if result.Error != nil {
-		return nil, fmt.Errorf("rpc error %d: %s", result.Error.Code, result.Error.Message)
+	return nil
+}
+
+// GetJSON fetches ep.URL and decodes its JSON response into out, within
+// ep's timeout and through its proxy. It reads REST APIs, such as a beacon
+// node's, rather than JSON-RPC.
+func GetJSON(ctx context.Context, ep Endpoint, out any) error {
+	ctx, cancel := context.WithTimeout(ctx, ep.timeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ep.URL, nil)
+	if err != nil {
+		return err
 	}
-	return result.Result, nil
+	req.Header.Set("Accept", "application/json")
+	resp, err := httpClient(ep).Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return httpError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// RPCError is a JSON-RPC error response.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// RevertData returns the revert data of a failed eth_call, eth_estimateGas
+// or eth_sendRawTransaction, and whether the error is a revert at all.
+// Nodes put the data in the error's data field, as a hex string or nested
+// in an object; a revert without data has none.
+func (e *RPCError) RevertData() ([]byte, bool) {
+	if e.Code != 3 && !strings.Contains(strings.ToLower(e.Message), "revert") {
+		return nil, false
+	}
+	var hex string
+	if json.Unmarshal(e.Data, &hex) != nil {
+		var nested struct {
+			Data string `json:"data"`
+		}
+		if json.Unmarshal(e.Data, &nested) == nil {
+			hex = nested.Data
+		}
+	}
+	if !strings.HasPrefix(hex, "0x") {
+		return nil, true
+	}
+	data, err := evm.DecodeHex(hex)
+	if err != nil {
+		return nil, true
+	}
+	return data, true
 }
 
 // rpcCall is the internal helper returning a string result.
-func rpcCall(url, method string, params []any) (string, error) {
-	raw, err := RPCCall(url, method, params)
+func rpcCall(ctx context.Context, ep Endpoint, method string, params []any) (string, error) {
+	return stringResult(RPCCall(ctx, ep, method, params))
+}
+
+// stringResult returns a call's result as a string, or the raw JSON when
+// it isn't one.
+func stringResult(raw json.RawMessage, err error) (string, error) {
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,307 @@
+package endpoint_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/primal-host/wallet/endpointtest"
+	"github.com/primal-host/wallet/internal/asset"
+	"github.com/primal-host/wallet/internal/endpoint"
+)
+
+// newStore returns a store in a temporary directory with an endpoint for
+// each server, named name-0, name-1, and so on.
+func newStore(t *testing.T, name string, servers ...*endpointtest.Server) (*endpoint.Store, []endpoint.Endpoint) {
+	t.Helper()
+	assets, err := asset.NewRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := endpoint.NewStore(filepath.Join(t.TempDir(), "endpoints.json"), assets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eps := make([]endpoint.Endpoint, len(servers))
+	for i, srv := range servers {
+		eps[i], err = store.Add(endpoint.Endpoint{Name: fmt.Sprintf("%s-%d", name, i), URL: srv.URL, Asset: "eth"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store, eps
+}
+
+// fastRetry retries n times without waiting long, until the test ends.
+func fastRetry(t *testing.T, n int) {
+	endpoint.SetRetry(endpoint.Retry{Attempts: n, Backoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond})
+	t.Cleanup(func() {
+		endpoint.SetRetry(endpoint.Retry{Attempts: 2, Backoff: 250 * time.Millisecond, MaxBackoff: 5 * time.Second})
+	})
+}
+
+func TestRPCCall(t *testing.T) {
+	srv := endpointtest.NewServer()
+	defer srv.Close()
+	srv.SetBlock(0x1234)
+	_, eps := newStore(t, "call", srv)
+
+	result, err := endpoint.RPCCall(context.Background(), eps[0], "eth_blockNumber", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result) != `"0x1234"` {
+		t.Errorf("eth_blockNumber = %s, want \"0x1234\"", result)
+	}
+
+	_, err = endpoint.RPCCall(context.Background(), eps[0], "eth_nope", nil)
+	var rpcErr *endpoint.RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != endpointtest.ErrMethodNotFound.Code {
+		t.Errorf("unknown method: err = %v, want method not found", err)
+	}
+	if n := srv.Calls("eth_nope"); n != 1 {
+		t.Errorf("unknown method asked %d times, want once: the answer won't change", n)
+	}
+}
+
+func TestRPCCallRetry(t *testing.T) {
+	fastRetry(t, 2)
+	srv := endpointtest.NewServer()
+	defer srv.Close()
+	_, eps := newStore(t, "retry", srv)
+	id := eps[0].ID
+	before := endpoint.Retries()[id]
+
+	srv.FailNext(2, http.StatusBadGateway)
+	if _, err := endpoint.RPCCall(context.Background(), eps[0], "eth_chainId", nil); err != nil {
+		t.Fatalf("two 502s with two retries: %v", err)
+	}
+	if st := endpoint.Retries()[id]; st.Retries-before.Retries != 2 || st.Recovered-before.Recovered != 1 || st.GaveUp != before.GaveUp {
+		t.Errorf("stats after recovering = %+v, want 2 more retries, 1 more recovered than %+v", st, before)
+	}
+
+	srv.FailNext(3, http.StatusServiceUnavailable)
+	_, err := endpoint.RPCCall(context.Background(), eps[0], "eth_chainId", nil)
+	var httpErr *endpoint.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("three 503s with two retries: err = %v, want HTTP 503", err)
+	}
+	if st := endpoint.Retries()[id]; st.Retries-before.Retries != 4 || st.GaveUp-before.GaveUp != 1 {
+		t.Errorf("stats after giving up = %+v, want 4 more retries, 1 more gave up than %+v", st, before)
+	}
+
+	srv.FailNext(1, http.StatusTooManyRequests)
+	start := time.Now()
+	if _, err := endpoint.RPCCall(context.Background(), eps[0], "eth_chainId", nil); err != nil {
+		t.Fatalf("429: %v", err)
+	}
+	if d := time.Since(start); d >= time.Second {
+		t.Errorf("429's Retry-After was waited out for %v, past MaxBackoff", d)
+	}
+}
+
+func TestRPCCallRetryRPCErrors(t *testing.T) {
+	fastRetry(t, 2)
+	srv := endpointtest.NewServer()
+	defer srv.Close()
+	_, eps := newStore(t, "rpcerr", srv)
+
+	for _, fail := range []*endpointtest.Error{endpointtest.ErrBusy, endpointtest.ErrRateLimited} {
+		srv.Fail("eth_gasPrice", fail)
+		before := srv.Calls("eth_gasPrice")
+		if _, err := endpoint.RPCCall(context.Background(), eps[0], "eth_gasPrice", nil); err == nil {
+			t.Errorf("%s: call succeeded against a failing node", fail.Message)
+		}
+		if n := srv.Calls("eth_gasPrice") - before; n != 3 {
+			t.Errorf("%s: asked %d times, want 3", fail.Message, n)
+		}
+	}
+
+	srv.Fail("eth_gasPrice", &endpointtest.Error{Code: -32000, Message: "execution reverted"})
+	before := srv.Calls("eth_gasPrice")
+	if _, err := endpoint.RPCCall(context.Background(), eps[0], "eth_gasPrice", nil); err == nil {
+		t.Error("revert: call succeeded against a failing node")
+	}
+	if n := srv.Calls("eth_gasPrice") - before; n != 1 {
+		t.Errorf("revert: asked %d times, want once", n)
+	}
+}
+
+func TestRPCCallSendNotRetried(t *testing.T) {
+	fastRetry(t, 2)
+	srv := endpointtest.NewServer()
+	defer srv.Close()
+	_, eps := newStore(t, "send", srv)
+	srv.Handle("eth_sendRawTransaction", func([]json.RawMessage) (any, error) {
+		return fmt.Sprintf("0x%064x", 1), nil
+	})
+
+	srv.FailNext(1, http.StatusBadGateway)
+	_, err := endpoint.RPCCall(context.Background(), eps[0], "eth_sendRawTransaction", []any{"0x02"})
+	var httpErr *endpoint.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadGateway {
+		t.Errorf("send after a 502: err = %v, want the 502, not a retry", err)
+	}
+	if n := srv.Calls("eth_sendRawTransaction"); n != 0 {
+		t.Errorf("sent %d times, want none", n)
+	}
+
+	srv.FailNext(1, http.StatusTooManyRequests)
+	if _, err := endpoint.RPCCall(context.Background(), eps[0], "eth_sendRawTransaction", []any{"0x02"}); err != nil {
+		t.Errorf("send after a 429: %v, want it retried, as the node took nothing", err)
+	}
+	if n := srv.Calls("eth_sendRawTransaction"); n != 1 {
+		t.Errorf("sent %d times, want once", n)
+	}
+}
+
+func TestRPCBatch(t *testing.T) {
+	srv := endpointtest.NewServer()
+	defer srv.Close()
+	srv.SetBlock(7)
+	_, eps := newStore(t, "batch", srv)
+
+	replies, err := endpoint.RPCBatch(context.Background(), eps[0], []endpoint.Call{
+		{Method: "eth_chainId"},
+		{Method: "eth_nope"},
+		{Method: "eth_blockNumber"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 3 {
+		t.Fatalf("got %d replies, want 3", len(replies))
+	}
+	if string(replies[0].Result) != `"0x7a69"` || replies[0].Err != nil {
+		t.Errorf("reply 0 = %s, %v; want \"0x7a69\"", replies[0].Result, replies[0].Err)
+	}
+	var rpcErr *endpoint.RPCError
+	if !errors.As(replies[1].Err, &rpcErr) || rpcErr.Code != endpointtest.ErrMethodNotFound.Code {
+		t.Errorf("reply 1 err = %v, want method not found", replies[1].Err)
+	}
+	if string(replies[2].Result) != `"0x7"` || replies[2].Err != nil {
+		t.Errorf("reply 2 = %s, %v; want \"0x7\"", replies[2].Result, replies[2].Err)
+	}
+}
+
+func TestRPCBatchSplit(t *testing.T) {
+	srv := endpointtest.NewServer()
+	defer srv.Close()
+	_, eps := newStore(t, "split", srv)
+
+	calls := make([]endpoint.Call, 250)
+	for i := range calls {
+		calls[i] = endpoint.Call{Method: "eth_getBlockTransactionCountByNumber", Params: []any{fmt.Sprintf("0x%x", i)}}
+	}
+	srv.SetBlock(300)
+	replies, err := endpoint.RPCBatch(context.Background(), eps[0], calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != len(calls) {
+		t.Fatalf("got %d replies, want %d", len(replies), len(calls))
+	}
+	for i, r := range replies {
+		if r.Err != nil {
+			t.Fatalf("reply %d: %v", i, r.Err)
+		}
+	}
+	if n := srv.Calls("eth_getBlockTransactionCountByNumber"); n != len(calls) {
+		t.Errorf("node answered %d calls, want %d", n, len(calls))
+	}
+}
+
+func TestRPCBatchRetry(t *testing.T) {
+	fastRetry(t, 1)
+	srv := endpointtest.NewServer()
+	defer srv.Close()
+	_, eps := newStore(t, "batchretry", srv)
+
+	srv.FailNext(1, http.StatusBadGateway)
+	replies, err := endpoint.RPCBatch(context.Background(), eps[0], []endpoint.Call{{Method: "eth_chainId"}, {Method: "eth_blockNumber"}})
+	if err != nil || len(replies) != 2 {
+		t.Fatalf("batch after a 502: %d replies, %v; want it retried", len(replies), err)
+	}
+
+	srv.FailNext(1, http.StatusBadGateway)
+	_, err = endpoint.RPCBatch(context.Background(), eps[0], []endpoint.Call{{Method: "eth_chainId"}, {Method: "eth_sendRawTransaction", Params: []any{"0x02"}}})
+	var httpErr *endpoint.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadGateway {
+		t.Errorf("batch with a send after a 502: err = %v, want the 502, not a retry", err)
+	}
+}
+
+func TestPoll(t *testing.T) {
+	high := endpointtest.NewServer()
+	defer high.Close()
+	low := endpointtest.NewServer()
+	defer low.Close()
+	down := endpointtest.NewServer()
+	down.Close()
+	high.SetBlock(100)
+	low.SetBlock(90)
+	store, eps := newStore(t, "poll", high, low, down)
+
+	sts := store.Poll(context.Background())
+	if len(sts) != 3 {
+		t.Fatalf("got %d statuses, want 3", len(sts))
+	}
+	byID := map[string]endpoint.Status{}
+	for _, st := range sts {
+		byID[st.ID] = st
+	}
+	if st := byID[eps[0].ID]; !st.Online || st.ChainID != "0x7a69" || st.BlockNumber != "0x64" || st.LagBlocks != 0 || len(st.Flags) != 0 {
+		t.Errorf("highest endpoint = %+v, want online at 0x64 without flags", st)
+	}
+	if st := byID[eps[1].ID]; !st.Online || st.LagBlocks != 10 || !hasFlag(st, endpoint.FlagLagging) {
+		t.Errorf("lower endpoint = %+v, want 10 blocks behind and lagging", st)
+	}
+	if st := byID[eps[2].ID]; st.Online {
+		t.Errorf("closed endpoint = %+v, want offline", st)
+	}
+
+	asked := high.Calls("")
+	store.Poll(context.Background())
+	if n := high.Calls(""); n != asked {
+		t.Errorf("an immediate second poll asked the endpoint %d more times, want none", n-asked)
+	}
+}
+
+func TestPollForked(t *testing.T) {
+	a, b, c := endpointtest.NewServer(), endpointtest.NewServer(), endpointtest.NewServer()
+	for _, srv := range []*endpointtest.Server{a, b, c} {
+		defer srv.Close()
+		srv.SetBlock(50)
+	}
+	// c has its own block at every height, as a node on a fork would.
+	c.Handle("eth_getBlockByNumber", func(params []json.RawMessage) (any, error) {
+		return map[string]any{
+			"number":     "0x32",
+			"hash":       fmt.Sprintf("0x%064x", 0xf0000+50),
+			"parentHash": fmt.Sprintf("0x%064x", 0xf0000+49),
+			"timestamp":  "0x0",
+		}, nil
+	})
+	store, eps := newStore(t, "fork", a, b, c)
+
+	for _, st := range store.Poll(context.Background()) {
+		want := st.ID == eps[2].ID
+		if hasFlag(st, endpoint.FlagForked) != want {
+			t.Errorf("%s: flags %v, want forked %v", st.ID, st.Flags, want)
+		}
+	}
+}
+
+func hasFlag(st endpoint.Status, flag string) bool {
+	for _, f := range st.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
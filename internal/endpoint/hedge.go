@@ -0,0 +1,172 @@
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// hedgedMethods are the reads Hedged may send to a second endpoint: they
+// have no side effects and any node of the chain answers them alike.
+// Filters and subscriptions live on one node, and traces are too costly to
+// ask for twice.
+var hedgedMethods = map[string]bool{
+	"eth_chainId":                          true,
+	"eth_blockNumber":                      true,
+	"eth_gasPrice":                         true,
+	"eth_maxPriorityFeePerGas":             true,
+	"eth_feeHistory":                       true,
+	"eth_getBalance":                       true,
+	"eth_getCode":                          true,
+	"eth_getTransactionCount":              true,
+	"eth_getStorageAt":                     true,
+	"eth_call":                             true,
+	"eth_estimateGas":                      true,
+	"eth_getProof":                         true,
+	"eth_getBlockByNumber":                 true,
+	"eth_getBlockByHash":                   true,
+	"eth_getBlockReceipts":                 true,
+	"eth_getTransactionByHash":             true,
+	"eth_getTransactionReceipt":            true,
+	"eth_getLogs":                          true,
+	"eth_getBlockTransactionCountByNumber": true,
+}
+
+// HedgeStats counts the hedged calls made to one endpoint.
+type HedgeStats struct {
+	Calls     uint64 `json:"calls"`      // hedgeable calls
+	Hedged    uint64 `json:"hedged"`     // calls that also went to a backup
+	BackupWon uint64 `json:"backup_won"` // calls the backup answered first
+}
+
+var hedgeStats = struct {
+	sync.Mutex
+	m map[string]*HedgeStats // by primary endpoint ID
+}{m: map[string]*HedgeStats{}}
+
+// Hedges returns the hedging counters since startup by endpoint ID.
+func Hedges() map[string]HedgeStats {
+	hedgeStats.Lock()
+	defer hedgeStats.Unlock()
+	out := make(map[string]HedgeStats, len(hedgeStats.m))
+	for id, st := range hedgeStats.m {
+		out[id] = *st
+	}
+	return out
+}
+
+func countHedge(id string, count func(*HedgeStats)) {
+	hedgeStats.Lock()
+	defer hedgeStats.Unlock()
+	st, ok := hedgeStats.m[id]
+	if !ok {
+		st = &HedgeStats{}
+		hedgeStats.m[id] = st
+	}
+	count(st)
+}
+
+// answered reports whether a call's outcome settles it: a result, or a
+// revert, which every node gives alike. A null result, such as a receipt a
+// lagging node hasn't seen yet, only settles it when nothing better comes.
+func answered(result json.RawMessage, err error) (settled, null bool) {
+	if err != nil {
+		var rpcErr *RPCError
+		if errors.As(err, &rpcErr) {
+			_, revert := rpcErr.RevertData()
+			return revert, false
+		}
+		return false, false
+	}
+	if bytes.Equal(bytes.TrimSpace(result), []byte("null")) {
+		return false, true
+	}
+	return true, false
+}
+
+// Hedged makes a JSON-RPC call to ep like Historical and, when ep hasn't
+// answered within delay, sends it to another endpoint of the same chain as
+// well, returning whichever answers first and canceling the other. A call
+// ep fails fast goes to the backup at once. Only reads in hedgedMethods are
+// hedged. It returns the endpoint that answered with the result; ep's error
+// is returned when both fail.
+func (s *Store) Hedged(ctx context.Context, ep Endpoint, method string, params []any, delay time.Duration) (json.RawMessage, Endpoint, error) {
+	if !hedgedMethods[method] {
+		return s.Historical(ctx, ep, method, params)
+	}
+	countHedge(ep.ID, func(st *HedgeStats) { st.Calls++ })
+	block, _ := stateBlock(method, params)
+	backup, ok := s.peer(ep, block)
+	if !ok {
+		return s.Historical(ctx, ep, method, params)
+	}
+
+	type outcome struct {
+		result json.RawMessage
+		from   Endpoint
+		err    error
+		backup bool
+	}
+	// The slower call is canceled once the faster settles it, and the
+	// channel is buffered so it can finish without anyone waiting for it.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan outcome, 2)
+	go func() {
+		result, from, err := s.Historical(ctx, ep, method, params)
+		done <- outcome{result, from, err, false}
+	}()
+	hedge := func() {
+		countHedge(ep.ID, func(st *HedgeStats) { st.Hedged++ })
+		go func() {
+			result, from, err := s.Historical(ctx, backup, method, params)
+			done <- outcome{result, from, err, true}
+		}()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	var primary, fallback *outcome
+	pending, hedged := 1, false
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if !hedged {
+				hedged = true
+				pending++
+				hedge()
+			}
+		case o := <-done:
+			pending--
+			settled, null := answered(o.result, o.err)
+			if settled {
+				if o.backup {
+					countHedge(ep.ID, func(st *HedgeStats) { st.BackupWon++ })
+					slog.Debug("hedged call won by backup", "subsystem", "rpc", "method", method, "endpoint", ep.ID, "backup", o.from.ID)
+				}
+				return o.result, o.from, o.err
+			}
+			if !o.backup {
+				primary = &o
+			}
+			if null || fallback == nil {
+				fallback = &o
+			}
+			if !hedged {
+				hedged = true
+				pending++
+				hedge()
+			}
+		}
+	}
+	// Neither settled it: a null answer beats an error, and ep's error is
+	// the one reported.
+	if _, null := answered(fallback.result, fallback.err); !null && primary != nil {
+		fallback = primary
+	}
+	return fallback.result, fallback.from, fallback.err
+}
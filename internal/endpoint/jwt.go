@@ -0,0 +1,61 @@
+package endpoint
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jwtLifetime is how long a minted token is reused. Engine API nodes reject
+// tokens whose iat is more than 60 seconds from their clock, so tokens are
+// refreshed well inside that window.
+const jwtLifetime = 30 * time.Second
+
+var jwtCache = struct {
+	sync.Mutex
+	tokens map[string]cachedToken // by secret
+}{tokens: map[string]cachedToken{}}
+
+type cachedToken struct {
+	token  string
+	minted time.Time
+}
+
+// parseJWTSecret decodes a hex secret, as found in a geth or reth jwt.hex
+// file. The 0x prefix and surrounding whitespace are optional.
+func parseJWTSecret(s string) ([]byte, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "0x")
+	key, err := hex.DecodeString(s)
+	if err != nil || len(key) == 0 {
+		return nil, fmt.Errorf("jwt_secret must be hex-encoded")
+	}
+	return key, nil
+}
+
+// jwtToken returns an HS256 bearer token for secret, minting a new one when
+// the cached token is older than jwtLifetime.
+func jwtToken(secret string) (string, error) {
+	jwtCache.Lock()
+	defer jwtCache.Unlock()
+	now := time.Now()
+	if t, ok := jwtCache.tokens[secret]; ok && now.Sub(t.minted) < jwtLifetime {
+		return t.token, nil
+	}
+	key, err := parseJWTSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." +
+		enc.EncodeToString(fmt.Appendf(nil, `{"iat":%d}`, now.Unix()))
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(unsigned))
+	token := unsigned + "." + enc.EncodeToString(mac.Sum(nil))
+	jwtCache.tokens[secret] = cachedToken{token: token, minted: now}
+	return token, nil
+}
@@ -0,0 +1,228 @@
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Polling is how Poll spreads its checks, so dozens of endpoints don't all
+// get asked at once every round.
+type Polling struct {
+	Workers  int           // checks run at once
+	Stagger  time.Duration // between one worker's first check and the next's
+	Interval time.Duration // how long a status stays fresh, for endpoints without a PollInterval
+
+	// An offline endpoint's interval doubles with each failed check, up
+	// to MaxBackoff, and it is reported online again only after Recover
+	// checks in a row succeed.
+	MaxBackoff time.Duration
+	Recover    int
+}
+
+// DefaultPolling is the polling used until SetPolling is called.
+var DefaultPolling = Polling{
+	Workers:  8,
+	Stagger:  50 * time.Millisecond,
+	Interval: 5 * time.Second,
+
+	MaxBackoff: 5 * time.Minute,
+	Recover:    2,
+}
+
+var pollPolicy = struct {
+	sync.Mutex
+	Polling
+}{Polling: DefaultPolling}
+
+// SetPolling replaces the polling Poll uses.
+func SetPolling(p Polling) {
+	pollPolicy.Lock()
+	defer pollPolicy.Unlock()
+	pollPolicy.Polling = p
+}
+
+func currentPolling() Polling {
+	pollPolicy.Lock()
+	defer pollPolicy.Unlock()
+	return pollPolicy.Polling
+}
+
+// polling returns the polling s uses.
+func (s *Store) polling() Polling {
+	s.mu.RLock()
+	set := s.settings
+	s.mu.RUnlock()
+	if set != nil && set.Polling != nil {
+		return *set.Polling
+	}
+	return currentPolling()
+}
+
+// pollInterval returns how long ep's status stays fresh.
+func (ep Endpoint) pollInterval(p Polling) time.Duration {
+	if d, err := time.ParseDuration(ep.PollInterval); err == nil && d > 0 {
+		return d
+	}
+	return p.Interval
+}
+
+// checkPollInterval validates an endpoint's poll interval, which may be
+// empty.
+func checkPollInterval(ep Endpoint) error {
+	if ep.PollInterval == "" {
+		return nil
+	}
+	if d, err := time.ParseDuration(ep.PollInterval); err != nil || d <= 0 {
+		return fmt.Errorf("invalid poll interval %q: use a duration such as 30s", ep.PollInterval)
+	}
+	return nil
+}
+
+// polled is an endpoint's last check.
+type polled struct {
+	st       Status    // as reported, which may lag the check while recovering
+	at       time.Time // when the poll that checked it began
+	failures int       // failed checks in a row
+	passes   int       // successful checks in a row since it went offline
+}
+
+// wait returns how long after last the endpoint is checked again.
+func (last polled) wait(interval time.Duration, p Polling) time.Duration {
+	if last.failures <= 1 {
+		return interval
+	}
+	ceiling := max(p.MaxBackoff, interval)
+	wait := interval << min(last.failures-1, 30)
+	if wait <= 0 || wait > ceiling {
+		return ceiling
+	}
+	return wait
+}
+
+// settle turns a fresh check of an endpoint into the status to report,
+// given its last check. Going offline shows at once; coming back only
+// after p.Recover checks in a row succeed, so a flaky node doesn't flap.
+func settle(st Status, last polled, seen bool, p Polling) polled {
+	next := polled{st: st}
+	switch {
+	case !st.Online:
+		next.failures = last.failures + 1
+		next.st.Failures = next.failures
+	case !seen || last.st.Online:
+		// Online then and now, or checked for the first time.
+	default:
+		next.passes = last.passes + 1
+		if next.passes < p.Recover {
+			next.st.Online, next.st.ChainID, next.st.BlockNumber, next.st.Capabilities = false, "", "", nil
+			next.st.Recovering = next.passes
+		}
+	}
+	return next
+}
+
+// Poll checks each endpoint with eth_chainId and eth_blockNumber, and probes the
+// optional methods of those online, returning live status. Endpoints that
+// serve the same chain are compared for lag and forks.
+//
+// Each endpoint keeps a schedule of its own: one checked less than its poll
+// interval ago, give or take a tenth for timers that fire a little early,
+// reports that check again. An offline endpoint is checked less often the
+// longer it stays down, and shows online again only once it has answered
+// a few checks in a row. The checks that are due run on a bounded pool
+// of workers whose starts are staggered. When none is due, the last poll's
+// statuses are returned without asking any endpoint.
+func (s *Store) Poll(ctx context.Context) []Status {
+	eps := s.List()
+	p := s.polling()
+	results := make([]Status, len(eps))
+	start := time.Now()
+
+	var due []int
+	s.pollMu.Lock()
+	for i, ep := range eps {
+		last, ok := s.polled[ep.ID]
+		if ok && start.Sub(last.at) < last.wait(ep.pollInterval(p), p)*9/10 {
+			results[i] = last.st
+			continue
+		}
+		due = append(due, i)
+	}
+	if len(due) == 0 && sameEndpoints(s.round, eps) {
+		results = slices.Clone(s.round)
+		s.pollMu.Unlock()
+		return results
+	}
+	s.pollMu.Unlock()
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := range min(max(p.Workers, 1), len(due)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if w > 0 && p.Stagger > 0 {
+				select {
+				case <-time.After(time.Duration(w) * p.Stagger):
+				case <-ctx.Done():
+				}
+			}
+			for i := range jobs {
+				results[i] = Check(ctx, eps[i])
+			}
+		}()
+	}
+	for _, i := range due {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		compare(ctx, eps, results)
+		return results
+	}
+	s.pollMu.Lock()
+	if s.polled == nil {
+		s.polled = map[string]polled{}
+	}
+	for _, i := range due {
+		last, seen := s.polled[eps[i].ID]
+		next := settle(results[i], last, seen, p)
+		next.at = start
+		s.polled[eps[i].ID] = next
+		results[i] = next.st
+		if seen && last.st.Online != next.st.Online {
+			slog.Info("endpoint status changed", "subsystem", "endpoint", "endpoint", eps[i].ID, "online", next.st.Online)
+		}
+	}
+	s.pollMu.Unlock()
+	compare(ctx, eps, results)
+	s.pollMu.Lock()
+	s.round = slices.Clone(results)
+	s.pollMu.Unlock()
+	return results
+}
+
+// sameEndpoints reports whether statuses are of eps, in order.
+func sameEndpoints(statuses []Status, eps []Endpoint) bool {
+	if statuses == nil || len(statuses) != len(eps) {
+		return false
+	}
+	for i, st := range statuses {
+		if st.ID != eps[i].ID {
+			return false
+		}
+	}
+	return true
+}
+
+// forget drops id's last check, so the next poll checks it again.
+func (s *Store) forget(id string) {
+	s.pollMu.Lock()
+	defer s.pollMu.Unlock()
+	delete(s.polled, id)
+}
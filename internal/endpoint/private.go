@@ -0,0 +1,96 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// flashbotsStatus is the transaction status API of Flashbots Protect, used
+// for endpoints on its RPC that don't name one.
+const flashbotsStatus = "https://protect.flashbots.net/tx/"
+
+// Outcomes of a private submission.
+const (
+	PrivatePending   = "pending"   // the relay holds it; not mined yet
+	PrivateIncluded  = "included"  // mined
+	PrivateFailed    = "failed"    // the relay gave up on it without it being mined
+	PrivateCancelled = "cancelled" // withdrawn with a cancellation sent to the relay
+	PrivateUnknown   = "unknown"   // the relay hasn't seen it
+)
+
+// PrivateDone reports whether a private submission's status is final.
+func PrivateDone(status string) bool {
+	return status == PrivateIncluded || status == PrivateFailed || status == PrivateCancelled
+}
+
+// PrivateStatus is how far a transaction sent to a private endpoint has
+// got.
+type PrivateStatus struct {
+	Status string `json:"status"`
+	Block  string `json:"block,omitempty"` // hex, once included
+}
+
+// statusURL returns ep's transaction status API, if it has one.
+func (ep Endpoint) statusURL() string {
+	if ep.StatusURL != "" {
+		return ep.StatusURL
+	}
+	if u, err := url.Parse(ep.URL); err == nil && (u.Hostname() == "rpc.flashbots.net" || strings.HasSuffix(u.Hostname(), ".rpc.flashbots.net")) {
+		return flashbotsStatus
+	}
+	return ""
+}
+
+// ReadPrivateStatus asks ep, a private endpoint, about a transaction sent
+// to it: from its relay's status API where it has one, otherwise from ep's
+// receipt and pending transaction lookups. The block of an included
+// transaction comes from its receipt.
+func ReadPrivateStatus(ctx context.Context, ep Endpoint, hash string) (PrivateStatus, error) {
+	var st PrivateStatus
+	if api := ep.statusURL(); api != "" {
+		var resp struct {
+			Status string `json:"status"`
+		}
+		relay := Endpoint{ID: ep.ID, URL: api + hash, Proxy: ep.Proxy, Timeout: ep.Timeout}
+		if err := GetJSON(ctx, relay, &resp); err != nil {
+			return PrivateStatus{}, fmt.Errorf("status api: %w", err)
+		}
+		switch st.Status = strings.ToLower(resp.Status); st.Status {
+		case PrivatePending, PrivateIncluded, PrivateFailed, PrivateCancelled, PrivateUnknown:
+		default:
+			return PrivateStatus{}, fmt.Errorf("status api: unexpected status %q", resp.Status)
+		}
+		if st.Status != PrivateIncluded {
+			return st, nil
+		}
+	}
+
+	raw, err := RPCCall(ctx, ep, "eth_getTransactionReceipt", []any{hash})
+	if err != nil {
+		return PrivateStatus{}, fmt.Errorf("eth_getTransactionReceipt: %w", err)
+	}
+	var receipt *struct {
+		BlockNumber string `json:"blockNumber"`
+	}
+	if err := json.Unmarshal(raw, &receipt); err != nil {
+		return PrivateStatus{}, fmt.Errorf("eth_getTransactionReceipt: unexpected result %s", raw)
+	}
+	if receipt != nil {
+		return PrivateStatus{Status: PrivateIncluded, Block: receipt.BlockNumber}, nil
+	}
+	if st.Status == PrivateIncluded {
+		return st, nil // the relay knew before ep did
+	}
+
+	raw, err = RPCCall(ctx, ep, "eth_getTransactionByHash", []any{hash})
+	if err != nil {
+		return PrivateStatus{}, fmt.Errorf("eth_getTransactionByHash: %w", err)
+	}
+	if string(raw) == "null" {
+		return PrivateStatus{Status: PrivateUnknown}, nil
+	}
+	return PrivateStatus{Status: PrivatePending}, nil
+}
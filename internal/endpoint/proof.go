@@ -0,0 +1,398 @@
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// ProofVerified is the outcome of a proof check whose account proof led
+// from another endpoint's state root to the value returned.
+const ProofVerified = "verified"
+
+// provedMethods are the reads Proven checks, and the field of the account
+// each returns.
+var provedMethods = map[string]string{
+	"eth_getBalance":          "balance",
+	"eth_getTransactionCount": "nonce",
+}
+
+// Provable reports whether Proven checks method.
+func Provable(method string) bool {
+	_, ok := provedMethods[method]
+	return ok
+}
+
+// ProofCheck is how a read was checked against a state root: the endpoint
+// that gave the root, the block, and the outcome, which is verified,
+// mismatch, or unavailable (no other endpoint of the chain, or the proof
+// or block couldn't be fetched).
+type ProofCheck struct {
+	Endpoint  string `json:"endpoint,omitempty"`
+	Block     string `json:"block,omitempty"`
+	StateRoot string `json:"state_root,omitempty"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+// emptyTrieRoot is the root of an empty trie, the storage root of an
+// account without storage.
+var emptyTrieRoot = evm.Keccak256([]byte{0x80})
+
+// Account is an account's state as its proof's leaf holds it.
+type Account struct {
+	Nonce       *big.Int
+	Balance     *big.Int
+	StorageRoot []byte
+	CodeHash    []byte
+}
+
+// Proven makes a JSON-RPC call to ep like Historical and, for a balance or
+// nonce read, checks the answer with eth_getProof: ep's proof of the
+// account must lead from the state root another endpoint of the chain has
+// for the block to the value returned. Reads of the latest state are
+// pinned to the lower of the two heads; reads of other tags aren't
+// checked. The check is nil when the call isn't one that is checked.
+func (s *Store) Proven(ctx context.Context, ep Endpoint, method string, params []any) (json.RawMessage, Endpoint, *ProofCheck, error) {
+	i := stateMethods[method]
+	var tag any
+	if i < len(params) {
+		tag = params[i]
+	}
+	field, ok := provedMethods[method]
+	latest := tag == nil || tag == "latest"
+	numbered := false
+	if t, isString := tag.(string); isString {
+		numbered = strings.HasPrefix(t, "0x")
+	}
+	if !ok || len(params) == 0 || !latest && !numbered {
+		result, servedBy, err := s.Historical(ctx, ep, method, params)
+		return result, servedBy, nil, err
+	}
+	address, _ := params[0].(string)
+	block, _ := stateBlock(method, params)
+	alt, ok := s.peer(ep, block)
+	if !ok {
+		result, servedBy, err := s.Historical(ctx, ep, method, params)
+		return result, servedBy, &ProofCheck{Status: CheckUnavailable, Error: "no other endpoint serves the chain"}, err
+	}
+
+	check := &ProofCheck{Endpoint: alt.ID}
+	if latest {
+		head, err := commonHead(ctx, ep, alt)
+		if err != nil {
+			result, servedBy, err := s.Historical(ctx, ep, method, params)
+			check.Status, check.Error = CheckUnavailable, "head: "+err.Error()
+			return result, servedBy, check, err
+		}
+		pinned := make([]any, i+1)
+		copy(pinned, params)
+		pinned[i] = head
+		params = pinned
+		tag = head
+	}
+	check.Block = tag.(string)
+
+	var (
+		result, proof json.RawMessage
+		servedBy      Endpoint
+		root          string
+		err           error
+		proofErr      error
+		rootErr       error
+		wg            sync.WaitGroup
+	)
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		result, servedBy, err = s.Historical(ctx, ep, method, params)
+	}()
+	go func() {
+		defer wg.Done()
+		proof, proofErr = RPCCall(ctx, ep, "eth_getProof", []any{address, []any{}, check.Block})
+	}()
+	go func() {
+		defer wg.Done()
+		root, rootErr = stateRoot(ctx, alt, check.Block)
+	}()
+	wg.Wait()
+	if err != nil {
+		return result, servedBy, nil, err
+	}
+
+	switch {
+	case proofErr != nil:
+		check.Status, check.Error = CheckUnavailable, "eth_getProof: "+proofErr.Error()
+	case rootErr != nil:
+		check.Status, check.Error = CheckUnavailable, "state root: "+rootErr.Error()
+	default:
+		check.StateRoot = root
+		if err := checkAccountProof(root, address, proof, field, result); err != nil {
+			check.Status, check.Error = CheckMismatch, err.Error()
+		} else {
+			check.Status = ProofVerified
+		}
+	}
+	switch check.Status {
+	case CheckMismatch:
+		slog.Warn("rpc result fails its proof", "subsystem", "rpc", "method", method, "block", check.Block,
+			"endpoint", servedBy.ID, "result", string(result), "peer", alt.ID, "state_root", root, "error", check.Error)
+	case CheckUnavailable:
+		slog.Debug("proof check unavailable", "subsystem", "rpc", "method", method, "endpoint", ep.ID, "peer", alt.ID, "error", check.Error)
+	}
+	return result, servedBy, check, nil
+}
+
+// stateRoot returns the state root of block, a quantity, as ep has it.
+func stateRoot(ctx context.Context, ep Endpoint, block string) (string, error) {
+	raw, err := RPCCall(ctx, ep, "eth_getBlockByNumber", []any{block, false})
+	if err != nil {
+		return "", err
+	}
+	var header *struct {
+		StateRoot string `json:"stateRoot"`
+	}
+	if err := json.Unmarshal(raw, &header); err != nil || header == nil || header.StateRoot == "" {
+		return "", fmt.Errorf("block %s not found", block)
+	}
+	return header.StateRoot, nil
+}
+
+// checkAccountProof verifies an eth_getProof answer for address against
+// root and that the account's field is the quantity result holds.
+func checkAccountProof(root, address string, raw json.RawMessage, field string, result json.RawMessage) error {
+	rootHash, err := evm.DecodeHex(root)
+	if err != nil || len(rootHash) != 32 {
+		return fmt.Errorf("invalid state root %s", root)
+	}
+	acct, err := ProveAccount(rootHash, address, raw)
+	if err != nil {
+		return err
+	}
+
+	var hex string
+	if err := json.Unmarshal(result, &hex); err != nil {
+		return fmt.Errorf("unexpected result %s", result)
+	}
+	got, err := evm.ParseQuantity(hex)
+	if err != nil {
+		return err
+	}
+	want := acct.Balance
+	if field == "nonce" {
+		want = acct.Nonce
+	}
+	if got.Cmp(want) != 0 {
+		return fmt.Errorf("%s %s isn't the %s the proof shows (%s)", field, got, field, want)
+	}
+	return nil
+}
+
+// ProveAccount verifies an eth_getProof answer for address against the
+// state root and returns the account it proves. An account the proof
+// shows absent is empty: no nonce, balance, storage, or code.
+func ProveAccount(root []byte, address string, raw json.RawMessage) (Account, error) {
+	var proof struct {
+		AccountProof []string `json:"accountProof"`
+	}
+	if err := json.Unmarshal(raw, &proof); err != nil {
+		return Account{}, fmt.Errorf("invalid proof: %w", err)
+	}
+	addr, err := evm.ParseAddress(address)
+	if err != nil {
+		return Account{}, err
+	}
+	nodes, err := decodeNodes(proof.AccountProof)
+	if err != nil {
+		return Account{}, err
+	}
+	leaf, err := verifyProof(root, evm.Keccak256(addr[:]), nodes)
+	if err != nil {
+		return Account{}, err
+	}
+	if leaf == nil {
+		return Account{Nonce: new(big.Int), Balance: new(big.Int), StorageRoot: emptyTrieRoot, CodeHash: evm.Keccak256()}, nil
+	}
+	return decodeAccount(leaf)
+}
+
+// ProveStorage verifies the proof of storage slot key in an eth_getProof
+// answer against acct's storage root and returns the slot's value.
+func ProveStorage(acct Account, key string, raw json.RawMessage) (*big.Int, error) {
+	var proof struct {
+		StorageProof []struct {
+			Key   string   `json:"key"`
+			Proof []string `json:"proof"`
+		} `json:"storageProof"`
+	}
+	if err := json.Unmarshal(raw, &proof); err != nil {
+		return nil, fmt.Errorf("invalid proof: %w", err)
+	}
+	slot, err := evm.ParseQuantity(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage key %s", key)
+	}
+	for _, sp := range proof.StorageProof {
+		if n, err := evm.ParseQuantity(sp.Key); err != nil || n.Cmp(slot) != 0 {
+			continue
+		}
+		nodes, err := decodeNodes(sp.Proof)
+		if err != nil {
+			return nil, err
+		}
+		leaf, err := verifyProof(acct.StorageRoot, evm.Keccak256(slot.FillBytes(make([]byte, 32))), nodes)
+		if err != nil {
+			return nil, err
+		}
+		if leaf == nil {
+			return new(big.Int), nil
+		}
+		v, err := evm.RLPDecode(leaf)
+		b, ok := v.([]byte)
+		if err != nil || !ok {
+			return nil, errors.New("invalid storage value")
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	return nil, fmt.Errorf("no proof of storage key %s", key)
+}
+
+// decodeNodes decodes a proof's hex-encoded trie nodes.
+func decodeNodes(hex []string) ([][]byte, error) {
+	nodes := make([][]byte, len(hex))
+	for i, n := range hex {
+		var err error
+		if nodes[i], err = evm.DecodeHex(n); err != nil {
+			return nil, fmt.Errorf("invalid proof node %d", i)
+		}
+	}
+	return nodes, nil
+}
+
+// decodeAccount decodes an account leaf: [nonce, balance, storageRoot,
+// codeHash].
+func decodeAccount(leaf []byte) (Account, error) {
+	v, err := evm.RLPDecode(leaf)
+	if err != nil {
+		return Account{}, fmt.Errorf("invalid account: %w", err)
+	}
+	fields, ok := v.([]any)
+	if !ok || len(fields) != 4 {
+		return Account{}, errors.New("invalid account")
+	}
+	var b [4][]byte
+	for i, f := range fields {
+		if b[i], ok = f.([]byte); !ok {
+			return Account{}, errors.New("invalid account")
+		}
+	}
+	if len(b[2]) != 32 || len(b[3]) != 32 {
+		return Account{}, errors.New("invalid account")
+	}
+	return Account{Nonce: new(big.Int).SetBytes(b[0]), Balance: new(big.Int).SetBytes(b[1]), StorageRoot: b[2], CodeHash: b[3]}, nil
+}
+
+// verifyProof walks a Merkle Patricia trie proof from root along key's
+// nibbles and returns the value stored at key, or nil when the proof
+// shows there is none. Every node referenced by hash must be the next one
+// of proof and hash to it; nodes shorter than a hash are inlined in their
+// parent.
+func verifyProof(root, key []byte, proof [][]byte) ([]byte, error) {
+	if bytes.Equal(root, emptyTrieRoot) {
+		return nil, nil
+	}
+	path := make([]byte, 0, 2*len(key))
+	for _, b := range key {
+		path = append(path, b>>4, b&0x0f)
+	}
+	next := 0
+	resolve := func(ref any) (any, error) {
+		switch ref := ref.(type) {
+		case []any:
+			return ref, nil
+		case []byte:
+			if len(ref) != 32 {
+				return nil, errors.New("invalid proof: bad node reference")
+			}
+			if next >= len(proof) {
+				return nil, errors.New("invalid proof: ends early")
+			}
+			enc := proof[next]
+			next++
+			if !bytes.Equal(evm.Keccak256(enc), ref) {
+				return nil, fmt.Errorf("invalid proof: node %d doesn't match its hash", next-1)
+			}
+			return evm.RLPDecode(enc)
+		}
+		return nil, errors.New("invalid proof: bad node reference")
+	}
+
+	node, err := resolve(root)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		list, ok := node.([]any)
+		if !ok {
+			return nil, errors.New("invalid proof: node isn't a list")
+		}
+		switch len(list) {
+		case 17: // branch
+			if len(path) == 0 {
+				v, _ := list[16].([]byte)
+				if len(v) == 0 {
+					return nil, nil
+				}
+				return v, nil
+			}
+			child := list[path[0]]
+			path = path[1:]
+			if b, ok := child.([]byte); ok && len(b) == 0 {
+				return nil, nil
+			}
+			if node, err = resolve(child); err != nil {
+				return nil, err
+			}
+		case 2: // leaf or extension
+			enc, ok := list[0].([]byte)
+			if !ok || len(enc) == 0 {
+				return nil, errors.New("invalid proof: bad node path")
+			}
+			flag := enc[0] >> 4
+			var nibbles []byte
+			if flag&1 == 1 {
+				nibbles = append(nibbles, enc[0]&0x0f)
+			}
+			for _, b := range enc[1:] {
+				nibbles = append(nibbles, b>>4, b&0x0f)
+			}
+			if flag >= 2 { // leaf
+				if !bytes.Equal(nibbles, path) {
+					return nil, nil
+				}
+				v, ok := list[1].([]byte)
+				if !ok {
+					return nil, errors.New("invalid proof: bad leaf")
+				}
+				return v, nil
+			}
+			if !bytes.HasPrefix(path, nibbles) {
+				return nil, nil
+			}
+			path = path[len(nibbles):]
+			if node, err = resolve(list[1]); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, errors.New("invalid proof: bad node")
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Retry is how RPCCall retries transient failures: timeouts, connection
+// errors, HTTP 429 and 5xx, and JSON-RPC errors that say the node is rate
+// limiting or busy. The n-th retry waits a random time up to Backoff·2ⁿ⁻¹,
+// capped at MaxBackoff, or as long as a 429's Retry-After asks within
+// that cap.
+type Retry struct {
+	Attempts   int // retries after the first attempt; zero turns retrying off
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+var retryPolicy = struct {
+	sync.Mutex
+	Retry
+}{Retry: Retry{Attempts: 2, Backoff: 250 * time.Millisecond, MaxBackoff: 5 * time.Second}}
+
+// SetRetry replaces the retry policy RPCCall uses.
+func SetRetry(r Retry) {
+	retryPolicy.Lock()
+	defer retryPolicy.Unlock()
+	retryPolicy.Retry = r
+}
+
+func currentRetry() Retry {
+	retryPolicy.Lock()
+	defer retryPolicy.Unlock()
+	return retryPolicy.Retry
+}
+
+// retry returns the retry policy for calls to ep.
+func (ep Endpoint) retry() Retry {
+	if ep.settings != nil && ep.settings.Retry != nil {
+		return *ep.settings.Retry
+	}
+	return currentRetry()
+}
+
+// RetryStats counts RPCCall's retries for one endpoint.
+type RetryStats struct {
+	Retries   uint64 `json:"retries"`   // attempts after the first
+	Recovered uint64 `json:"recovered"` // calls that succeeded after retrying
+	GaveUp    uint64 `json:"gave_up"`   // calls that failed after retrying
+}
+
+var retryStats = struct {
+	sync.Mutex
+	m map[string]*RetryStats // by endpoint ID
+}{m: map[string]*RetryStats{}}
+
+// Retries returns the retry counters since startup by endpoint ID.
+func Retries() map[string]RetryStats {
+	retryStats.Lock()
+	defer retryStats.Unlock()
+	out := make(map[string]RetryStats, len(retryStats.m))
+	for id, st := range retryStats.m {
+		out[id] = *st
+	}
+	return out
+}
+
+func countRetry(id string, count func(*RetryStats)) {
+	retryStats.Lock()
+	defer retryStats.Unlock()
+	st, ok := retryStats.m[id]
+	if !ok {
+		st = &RetryStats{}
+		retryStats.m[id] = st
+	}
+	count(st)
+}
+
+// HTTPError is an HTTP error status from an endpoint whose body isn't a
+// JSON-RPC response, as auth proxies and gateways send.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	RetryAfter time.Duration // from a Retry-After header in seconds
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("rpc: HTTP %s", e.Status)
+}
+
+// httpError builds an HTTPError from resp.
+func httpError(resp *http.Response) *HTTPError {
+	e := &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		e.RetryAfter = time.Duration(secs) * time.Second
+	}
+	return e
+}
+
+// sendMethods submit transactions or, on Anvil and Hardhat, move the test
+// chain along. A retry could do it twice, and a sent transaction would be
+// refused with an error that hides the first attempt's success, so they
+// are only retried when the node can't have taken them.
+var sendMethods = map[string]bool{
+	"eth_sendRawTransaction": true,
+	"eth_sendTransaction":    true,
+	"evm_mine":               true,
+	"anvil_mine":             true,
+	"hardhat_mine":           true,
+	"evm_snapshot":           true,
+	"evm_revert":             true,
+	"evm_increaseTime":       true,
+}
+
+// retryable reports whether a call of method that failed with err is worth
+// trying again.
+func retryable(method string, err error) bool {
+	if rateLimited(err) {
+		return true
+	}
+	if sendMethods[method] {
+		// Refused connections never reached the node.
+		var opErr *net.OpError
+		return errors.As(err, &opErr) && opErr.Op == "dial"
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode >= 500
+	}
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		msg := strings.ToLower(rpcErr.Message)
+		for _, s := range []string{"timeout", "timed out", "try again", "temporarily", "busy", "overloaded", "unavailable"} {
+			if strings.Contains(msg, s) && !StateUnavailable(err) {
+				return true
+			}
+		}
+		return false
+	}
+	// A URL that doesn't parse fails the same way every time.
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && urlErr.Op != "parse"
+}
+
+// rateLimited reports whether err says the endpoint turned the call away
+// for rate, which leaves nothing done on the node.
+func rateLimited(err error) bool {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests
+	}
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		if rpcErr.Code == -32005 || rpcErr.Code == http.StatusTooManyRequests {
+			return true
+		}
+		msg := strings.ToLower(rpcErr.Message)
+		return strings.Contains(msg, "rate limit") || strings.Contains(msg, "too many requests") || strings.Contains(msg, "exceeds the limit") || strings.Contains(msg, "limit exceeded")
+	}
+	return false
+}
+
+// backoff returns how long to wait before retry n, counting from 1.
+func (r Retry) backoff(n int, err error) time.Duration {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.RetryAfter > 0 {
+		return min(httpErr.RetryAfter, r.MaxBackoff)
+	}
+	ceiling := r.Backoff << (n - 1)
+	if ceiling <= 0 || ceiling > r.MaxBackoff {
+		ceiling = r.MaxBackoff
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling) + 1
+}
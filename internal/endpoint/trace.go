@@ -0,0 +1,173 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// Trace methods an endpoint may serve.
+const (
+	TraceParity = "trace" // trace_transaction: Erigon, Nethermind, Reth
+	TraceDebug  = "debug" // debug_traceTransaction with callTracer: Geth and most clients
+)
+
+// ErrNoTrace is returned for an endpoint that serves neither trace method.
+var ErrNoTrace = errors.New("endpoint does not serve trace_transaction or debug_traceTransaction")
+
+// Transfer is a movement of the native currency by a contract during a
+// transaction: a call with value, a contract created with value, or a
+// self-destruct's balance.
+type Transfer struct {
+	Type  string `json:"type"` // call, create, or selfdestruct
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Value string `json:"value"` // hex wei
+}
+
+// InternalTransfers traces the transaction hash on ep and returns the value
+// its internal calls moved, leaving out the transaction's own value and
+// calls that reverted. It returns ErrNoTrace when ep can't trace.
+func InternalTransfers(ctx context.Context, ep Endpoint, hash string) ([]Transfer, error) {
+	switch Probe(ctx, ep).TraceMethod() {
+	case TraceParity:
+		return parityTransfers(ctx, ep, hash)
+	case TraceDebug:
+		return debugTransfers(ctx, ep, hash)
+	}
+	return nil, ErrNoTrace
+}
+
+// parityTransfers reads trace_transaction's flat list, where a trace's
+// traceAddress is its path from the top-level call.
+func parityTransfers(ctx context.Context, ep Endpoint, hash string) ([]Transfer, error) {
+	raw, err := RPCCall(ctx, ep, "trace_transaction", []any{hash})
+	if err != nil {
+		return nil, err
+	}
+	var traces []struct {
+		Type   string `json:"type"`
+		Action struct {
+			CallType      string `json:"callType"`
+			From          string `json:"from"`
+			To            string `json:"to"`
+			Value         string `json:"value"`
+			Address       string `json:"address"`       // selfdestruct
+			RefundAddress string `json:"refundAddress"` // selfdestruct
+			Balance       string `json:"balance"`       // selfdestruct
+		} `json:"action"`
+		Result *struct {
+			Address string `json:"address"` // create
+		} `json:"result"`
+		TraceAddress []int  `json:"traceAddress"`
+		Error        string `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &traces); err != nil {
+		return nil, err
+	}
+	var reverted [][]int
+	var out []Transfer
+	for _, t := range traces {
+		if t.Error != "" {
+			reverted = append(reverted, t.TraceAddress)
+			continue
+		}
+		if len(t.TraceAddress) == 0 || within(t.TraceAddress, reverted) {
+			continue
+		}
+		a := t.Action
+		var tr Transfer
+		switch {
+		case t.Type == "call" && a.CallType == "call":
+			tr = Transfer{Type: "call", From: a.From, To: a.To, Value: a.Value}
+		case t.Type == "create" && t.Result != nil:
+			tr = Transfer{Type: "create", From: a.From, To: t.Result.Address, Value: a.Value}
+		case t.Type == "suicide" || t.Type == "selfdestruct":
+			tr = Transfer{Type: "selfdestruct", From: a.Address, To: a.RefundAddress, Value: a.Balance}
+		default:
+			continue
+		}
+		if positive(tr.Value) {
+			out = append(out, tr)
+		}
+	}
+	return out, nil
+}
+
+// within reports whether path is under any of prefixes.
+func within(path []int, prefixes [][]int) bool {
+	for _, p := range prefixes {
+		if len(p) > len(path) {
+			continue
+		}
+		match := true
+		for i := range p {
+			if p[i] != path[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// callFrame is a call in callTracer's tree.
+type callFrame struct {
+	Type  string      `json:"type"`
+	From  string      `json:"from"`
+	To    string      `json:"to"`
+	Value string      `json:"value"`
+	Error string      `json:"error"`
+	Calls []callFrame `json:"calls"`
+}
+
+// debugTransfers walks callTracer's tree below the top-level call.
+func debugTransfers(ctx context.Context, ep Endpoint, hash string) ([]Transfer, error) {
+	raw, err := RPCCall(ctx, ep, "debug_traceTransaction", []any{hash, map[string]any{"tracer": "callTracer"}})
+	if err != nil {
+		return nil, err
+	}
+	var top callFrame
+	if err := json.Unmarshal(raw, &top); err != nil {
+		return nil, err
+	}
+	if top.Error != "" {
+		return nil, nil
+	}
+	var out []Transfer
+	var walk func(calls []callFrame)
+	walk = func(calls []callFrame) {
+		for _, c := range calls {
+			if c.Error != "" {
+				continue
+			}
+			var typ string
+			switch strings.ToUpper(c.Type) {
+			case "CALL":
+				typ = "call"
+			case "CREATE", "CREATE2":
+				typ = "create"
+			case "SELFDESTRUCT":
+				typ = "selfdestruct"
+			}
+			if typ != "" && positive(c.Value) {
+				out = append(out, Transfer{Type: typ, From: c.From, To: c.To, Value: c.Value})
+			}
+			walk(c.Calls)
+		}
+	}
+	walk(top.Calls)
+	return out, nil
+}
+
+// positive reports whether a hex quantity is above zero.
+func positive(hex string) bool {
+	n, err := evm.ParseQuantity(hex)
+	return err == nil && n.Sign() > 0
+}
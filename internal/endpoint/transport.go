@@ -0,0 +1,148 @@
+package endpoint
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Transport tunes the HTTP connections RPCCall makes. Endpoints share one
+// client per proxy, so polls and proxied calls reuse connections instead of
+// opening one per call.
+type Transport struct {
+	MaxConnsPerHost     int           // connections to one host at once; zero is unlimited
+	MaxIdleConnsPerHost int           // idle connections kept open per host
+	IdleConnTimeout     time.Duration // how long an idle connection is kept
+	HTTP2               bool          // negotiate HTTP/2 with https:// endpoints
+	Proxy               string        // proxy for endpoints without their own; see ParseProxy
+}
+
+// DefaultTransport is the transport used until SetTransport is called.
+var DefaultTransport = Transport{
+	MaxConnsPerHost:     0,
+	MaxIdleConnsPerHost: 8,
+	IdleConnTimeout:     90 * time.Second,
+	HTTP2:               true,
+}
+
+// Proxy values with a meaning of their own.
+const (
+	ProxyDirect = "direct" // no proxy, not even one from the environment
+	ProxyTor    = "tor"    // Tor's SOCKS port on this host
+)
+
+// torProxy is where a local Tor daemon listens. socks5h has Tor resolve
+// host names, so DNS lookups don't leave this host either.
+const torProxy = "socks5h://127.0.0.1:9050"
+
+var sharedClients = struct {
+	sync.Mutex
+	t       Transport
+	clients map[string]*http.Client // by endpoint proxy, "" for the default
+}{t: DefaultTransport, clients: map[string]*http.Client{}}
+
+// SetTransport replaces the transport settings RPCCall uses. Connections
+// made with the old ones are closed once idle.
+func SetTransport(t Transport) error {
+	if _, err := ParseProxy(t.Proxy); err != nil {
+		return err
+	}
+	sharedClients.Lock()
+	old := sharedClients.clients
+	sharedClients.t, sharedClients.clients = t, map[string]*http.Client{}
+	sharedClients.Unlock()
+	for _, c := range old {
+		c.CloseIdleConnections()
+	}
+	return nil
+}
+
+// ParseProxy parses a proxy setting: an http://, https://, socks5://, or
+// socks5h:// URL, ProxyTor, or ProxyDirect. It returns nil for ProxyDirect,
+// and for an empty setting, which leaves the choice to HTTPS_PROXY,
+// HTTP_PROXY, and NO_PROXY.
+func ParseProxy(proxy string) (*url.URL, error) {
+	switch proxy {
+	case "", ProxyDirect:
+		return nil, nil
+	case ProxyTor:
+		proxy = torProxy
+	}
+	u, err := url.Parse(proxy)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q: use an http://, https://, socks5://, or socks5h:// URL, tor, or direct", proxy)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return u, nil
+	}
+	return nil, fmt.Errorf("invalid proxy %q: use an http://, https://, socks5://, or socks5h:// URL, tor, or direct", proxy)
+}
+
+// httpClient returns the client for calls to ep, made on first use. It has
+// no timeout of its own; each call's context carries ep's.
+func httpClient(ep Endpoint) *http.Client {
+	sharedClients.Lock()
+	defer sharedClients.Unlock()
+	if c, ok := sharedClients.clients[ep.Proxy]; ok {
+		return c
+	}
+	c := &http.Client{Transport: newTransport(sharedClients.t, ep.Proxy)}
+	sharedClients.clients[ep.Proxy] = c
+	return c
+}
+
+// proxied reports whether calls to ep go through a proxy, whether its own,
+// the default, or one from the environment.
+func proxied(ep Endpoint) bool {
+	rt, ok := httpClient(ep).Transport.(*http.Transport)
+	if !ok || rt.Proxy == nil {
+		return false
+	}
+	req, err := http.NewRequest(http.MethodPost, ep.URL, nil)
+	if err != nil {
+		return false
+	}
+	u, err := rt.Proxy(req)
+	return err != nil || u != nil
+}
+
+// newTransport builds a transport with t's settings, proxying through
+// proxy, or t.Proxy when that is empty. A proxy that doesn't parse, as
+// from a hand-edited endpoints file, fails every call rather than letting
+// them go out directly.
+func newTransport(t Transport, proxy string) *http.Transport {
+	if proxy == "" {
+		proxy = t.Proxy
+	}
+	var proxyFunc func(*http.Request) (*url.URL, error)
+	switch u, err := ParseProxy(proxy); {
+	case err != nil:
+		proxyFunc = func(*http.Request) (*url.URL, error) { return nil, err }
+	case u != nil:
+		proxyFunc = http.ProxyURL(u)
+	case proxy == "":
+		proxyFunc = http.ProxyFromEnvironment
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	rt := &http.Transport{
+		Proxy:                 proxyFunc,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          100,
+		MaxConnsPerHost:       t.MaxConnsPerHost,
+		MaxIdleConnsPerHost:   t.MaxIdleConnsPerHost,
+		IdleConnTimeout:       t.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     t.HTTP2,
+	}
+	if !t.HTTP2 {
+		// A non-nil empty map is how net/http is told not to upgrade.
+		rt.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return rt
+}
@@ -0,0 +1,160 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// TxPool is a look into a node's transaction pool: how many transactions
+// it holds, and those of the addresses asked about. Pending transactions
+// can be mined next; queued ones wait on a lower nonce or a higher balance.
+type TxPool struct {
+	Pending      uint64   `json:"pending"`
+	Queued       uint64   `json:"queued"`
+	Addresses    []string `json:"addresses"`    // the addresses whose transactions are listed
+	Transactions []PoolTx `json:"transactions"` // by sender, then nonce
+}
+
+// PoolTx is a transaction waiting in a node's pool. Quantities are hex, as
+// the node gives them.
+type PoolTx struct {
+	Status               string `json:"status"` // pending or queued
+	Hash                 string `json:"hash"`
+	From                 string `json:"from"`
+	To                   string `json:"to,omitempty"` // empty for a contract creation
+	Nonce                string `json:"nonce"`
+	Value                string `json:"value"`
+	Gas                  string `json:"gas"`
+	GasPrice             string `json:"gas_price,omitempty"`
+	MaxFeePerGas         string `json:"max_fee_per_gas,omitempty"`
+	MaxPriorityFeePerGas string `json:"max_priority_fee_per_gas,omitempty"`
+	Type                 string `json:"type,omitempty"`
+}
+
+// poolTx is a transaction as txpool_content gives it.
+type poolTx struct {
+	Hash                 string `json:"hash"`
+	From                 string `json:"from"`
+	To                   string `json:"to"`
+	Nonce                string `json:"nonce"`
+	Value                string `json:"value"`
+	Gas                  string `json:"gas"`
+	GasPrice             string `json:"gasPrice"`
+	MaxFeePerGas         string `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas string `json:"maxPriorityFeePerGas"`
+	Type                 string `json:"type"`
+}
+
+// ReadTxPool reads ep's pool size with txpool_status and the transactions
+// the given addresses have in it with txpool_contentFrom, or, from nodes
+// without it, txpool_content, which lists the whole pool.
+func ReadTxPool(ctx context.Context, ep Endpoint, addresses []string) (TxPool, error) {
+	raw, err := RPCCall(ctx, ep, "txpool_status", nil)
+	if err != nil {
+		return TxPool{}, fmt.Errorf("txpool_status: %w", err)
+	}
+	var status struct {
+		Pending string `json:"pending"`
+		Queued  string `json:"queued"`
+	}
+	if err := json.Unmarshal(raw, &status); err != nil {
+		return TxPool{}, fmt.Errorf("txpool_status: unexpected result %s", raw)
+	}
+	pool := TxPool{Addresses: []string{}, Transactions: []PoolTx{}}
+	for _, f := range []struct {
+		hex string
+		dst *uint64
+	}{{status.Pending, &pool.Pending}, {status.Queued, &pool.Queued}} {
+		n, err := strconv.ParseUint(strings.TrimPrefix(f.hex, "0x"), 16, 64)
+		if err != nil {
+			return TxPool{}, fmt.Errorf("txpool_status: unexpected result %s", raw)
+		}
+		*f.dst = n
+	}
+
+	seen := map[evm.Address]bool{}
+	for _, a := range addresses {
+		addr, err := evm.ParseAddress(a)
+		if err != nil {
+			return TxPool{}, err
+		}
+		if !seen[addr] {
+			seen[addr] = true
+			pool.Addresses = append(pool.Addresses, addr.Hex())
+		}
+	}
+	if len(pool.Addresses) == 0 {
+		return pool, nil
+	}
+
+	whole := false
+	for _, addr := range pool.Addresses {
+		raw, err := RPCCall(ctx, ep, "txpool_contentFrom", []any{addr})
+		var rpcErr *RPCError
+		if errors.As(err, &rpcErr) && methodMissing(rpcErr) {
+			whole = true
+			break
+		}
+		if err != nil {
+			return TxPool{}, fmt.Errorf("txpool_contentFrom: %w", err)
+		}
+		var content map[string]map[string]poolTx
+		if err := json.Unmarshal(raw, &content); err != nil {
+			return TxPool{}, fmt.Errorf("txpool_contentFrom: unexpected result")
+		}
+		pool.add(content)
+	}
+	if whole {
+		pool.Transactions = []PoolTx{}
+		raw, err := RPCCall(ctx, ep, "txpool_content", nil)
+		if err != nil {
+			return TxPool{}, fmt.Errorf("txpool_content: %w", err)
+		}
+		var content map[string]map[string]map[string]poolTx
+		if err := json.Unmarshal(raw, &content); err != nil {
+			return TxPool{}, fmt.Errorf("txpool_content: unexpected result")
+		}
+		for status, bySender := range content {
+			for sender, byNonce := range bySender {
+				if addr, err := evm.ParseAddress(sender); err == nil && seen[addr] {
+					pool.add(map[string]map[string]poolTx{status: byNonce})
+				}
+			}
+		}
+	}
+
+	sort.Slice(pool.Transactions, func(i, j int) bool {
+		a, b := pool.Transactions[i], pool.Transactions[j]
+		if !strings.EqualFold(a.From, b.From) {
+			return strings.ToLower(a.From) < strings.ToLower(b.From)
+		}
+		return quantity(a.Nonce) < quantity(b.Nonce)
+	})
+	return pool, nil
+}
+
+// add lists the pending and queued transactions of content, which maps
+// each status to transactions by nonce.
+func (p *TxPool) add(content map[string]map[string]poolTx) {
+	for _, status := range []string{"pending", "queued"} {
+		for _, tx := range content[status] {
+			p.Transactions = append(p.Transactions, PoolTx{
+				Status: status, Hash: tx.Hash, From: tx.From, To: tx.To, Nonce: tx.Nonce, Value: tx.Value, Gas: tx.Gas,
+				GasPrice: tx.GasPrice, MaxFeePerGas: tx.MaxFeePerGas, MaxPriorityFeePerGas: tx.MaxPriorityFeePerGas, Type: tx.Type,
+			})
+		}
+	}
+}
+
+// quantity parses a hex quantity, as zero if it isn't one.
+func quantity(hex string) uint64 {
+	n, _ := strconv.ParseUint(strings.TrimPrefix(hex, "0x"), 16, 64)
+	return n
+}
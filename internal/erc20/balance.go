@@ -0,0 +1,94 @@
+package erc20
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"slices"
+	"sync"
+
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// balanceWorkers bounds the concurrent balanceOf calls to one endpoint.
+const balanceWorkers = 8
+
+// Balance is an owner's balance of a registered token.
+type Balance struct {
+	Token
+	Balance string `json:"balance"` // smallest unit, decimal
+}
+
+// Balances reads owner's balance of each token through ep and returns the
+// nonzero ones, in the order given. Tokens whose balanceOf fails are left
+// out, so one broken contract doesn't hide the rest. The calls go out as
+// one JSON-RPC batch, or one by one where ep refuses batches.
+func Balances(ctx context.Context, ep endpoint.Endpoint, owner evm.Address, tokens []Token) []Balance {
+	amounts, err := batchBalances(ctx, ep, owner, tokens)
+	if err != nil {
+		amounts = eachBalance(ctx, ep, owner, tokens)
+	}
+
+	out := []Balance{}
+	for i, t := range tokens {
+		if amounts[i] != nil && amounts[i].Sign() > 0 {
+			out = append(out, Balance{Token: t, Balance: amounts[i].String()})
+		}
+	}
+	return out
+}
+
+// batchBalances reads owner's balance of each token in one batch.
+func batchBalances(ctx context.Context, ep endpoint.Endpoint, owner evm.Address, tokens []Token) ([]*big.Int, error) {
+	data := evm.EncodeHex(slices.Concat(selBalanceOf, addressWord(owner)))
+	calls := make([]endpoint.Call, len(tokens))
+	for i, t := range tokens {
+		calls[i] = endpoint.Call{Method: "eth_call", Params: []any{map[string]string{"to": t.Address, "data": data}, "latest"}}
+	}
+	replies, err := endpoint.RPCBatch(ctx, ep, calls)
+	if err != nil {
+		return nil, err
+	}
+	amounts := make([]*big.Int, len(tokens))
+	for i, r := range replies {
+		var s string
+		if r.Err != nil || json.Unmarshal(r.Result, &s) != nil {
+			continue
+		}
+		if out, err := evm.DecodeHex(s); err == nil && len(out) >= 32 {
+			amounts[i] = new(big.Int).SetBytes(out[:32])
+		}
+	}
+	return amounts, nil
+}
+
+// eachBalance reads owner's balance of each token with separate calls.
+func eachBalance(ctx context.Context, ep endpoint.Endpoint, owner evm.Address, tokens []Token) []*big.Int {
+	amounts := make([]*big.Int, len(tokens))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(balanceWorkers, len(tokens)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				amounts[i] = balanceOf(ctx, ep, tokens[i].Address, owner)
+			}
+		}()
+	}
+	for i := range tokens {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return amounts
+}
+
+func balanceOf(ctx context.Context, ep endpoint.Endpoint, contract string, owner evm.Address) *big.Int {
+	out, err := endpoint.EthCall(ctx, ep, contract, selBalanceOf, addressWord(owner))
+	if err != nil || len(out) < 32 {
+		return nil
+	}
+	return new(big.Int).SetBytes(out[:32])
+}
@@ -0,0 +1,342 @@
+// Package erc20 is the registry of ERC-20 tokens the wallet shows balances
+// of: custom tokens added one at a time, and tokens imported from token
+// lists in the Uniswap tokenlists format. A token is identified by its
+// chain ID and contract address, so the same list serves every endpoint of
+// a chain.
+package erc20
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// ErrDuplicate is returned when a custom token is already registered.
+var ErrDuplicate = errors.New("token already registered")
+
+// Token is a registered ERC-20 token.
+type Token struct {
+	ChainID  uint64    `json:"chain_id"`
+	Address  string    `json:"address"` // EIP-55 checksummed
+	Symbol   string    `json:"symbol"`
+	Name     string    `json:"name,omitempty"`
+	Decimals int       `json:"decimals"`
+	LogoURI  string    `json:"logo_uri,omitempty"`
+	List     string    `json:"list,omitempty"` // ID of the token list it came from; empty for custom tokens
+	AddedAt  time.Time `json:"added_at"`
+
+	// Custom tokens are read from the contract when added; see Inspect.
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
+	FeeBps     int        `json:"fee_bps,omitempty"`
+	Warnings   []string   `json:"warnings,omitempty"`
+}
+
+// List is an imported token list.
+type List struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	URL        string    `json:"url,omitempty"` // empty for uploaded lists, which aren't refreshed
+	Tokens     int       `json:"tokens"`        // entries registered
+	Skipped    int       `json:"skipped"`       // entries for other chains, already registered, or invalid
+	ImportedAt time.Time `json:"imported_at"`   // last successful import or refresh
+	Error      string    `json:"error,omitempty"`
+}
+
+// registry is the store's file.
+type registry struct {
+	Tokens []Token `json:"tokens"`
+	Lists  []List  `json:"lists"`
+}
+
+// Store manages the registry persisted to a JSON file.
+type Store struct {
+	mu   sync.RWMutex
+	data registry
+	path string
+}
+
+// NewStore loads the registry from a JSON file. If the file doesn't exist,
+// starts empty.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path, data: registry{Tokens: []Token{}, Lists: []List{}}}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("read erc20 tokens: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.data); err != nil {
+		return nil, fmt.Errorf("parse erc20 tokens: %w", err)
+	}
+	return s, nil
+}
+
+// Tokens returns the tokens of a chain, or of every chain for 0, by chain
+// and symbol.
+func (s *Store) Tokens(chainID uint64) []Token {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []Token{}
+	for _, t := range s.data.Tokens {
+		if chainID == 0 || t.ChainID == chainID {
+			out = append(out, t)
+		}
+	}
+	slices.SortFunc(out, func(a, b Token) int {
+		if a.ChainID != b.ChainID {
+			return cmp.Compare(a.ChainID, b.ChainID)
+		}
+		return strings.Compare(strings.ToLower(a.Symbol), strings.ToLower(b.Symbol))
+	})
+	return out
+}
+
+// Get returns the token at address on a chain.
+func (s *Store) Get(chainID uint64, address string) (Token, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if i := s.indexLocked(chainID, address); i >= 0 {
+		return s.data.Tokens[i], true
+	}
+	return Token{}, false
+}
+
+// Lists returns the imported token lists.
+func (s *Store) Lists() []List {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]List{}, s.data.Lists...)
+}
+
+// Add registers a custom token, whose metadata the caller has read from the
+// contract with Inspect. One imported from a list becomes custom, so
+// refreshing the list no longer touches it.
+func (s *Store) Add(t Token) (Token, error) {
+	if err := validate(&t); err != nil {
+		return Token{}, err
+	}
+	t.List = ""
+	t.AddedAt = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.data.Tokens
+	i := s.indexLocked(t.ChainID, t.Address)
+	if i >= 0 && old[i].List == "" {
+		return Token{}, fmt.Errorf("%w: %s on chain %d", ErrDuplicate, old[i].Symbol, t.ChainID)
+	}
+	next := slices.Clone(old)
+	if i >= 0 {
+		next[i] = t
+	} else {
+		next = append(next, t)
+	}
+	s.data.Tokens = next
+	if err := s.save(); err != nil {
+		s.data.Tokens = old
+		return Token{}, err
+	}
+	return t, nil
+}
+
+// Delete removes a custom token. Imported tokens go with their list.
+func (s *Store) Delete(chainID uint64, address string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.indexLocked(chainID, address)
+	if i < 0 {
+		return fmt.Errorf("token %s not found on chain %d", address, chainID)
+	}
+	if s.data.Tokens[i].List != "" {
+		return fmt.Errorf("%s was imported from a token list; remove the list instead", s.data.Tokens[i].Symbol)
+	}
+	old := s.data.Tokens
+	s.data.Tokens = slices.Delete(slices.Clone(old), i, i+1)
+	if err := s.save(); err != nil {
+		s.data.Tokens = old
+		return err
+	}
+	return nil
+}
+
+// Import registers a token list's entries for the given chains, replacing
+// what an earlier import of the same list (by URL, or by name for uploaded
+// lists) registered. Entries already registered, as custom tokens or by
+// another list, are skipped.
+func (s *Store) Import(doc Doc, url string, chains map[uint64]bool) (List, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l := List{Name: doc.Name, URL: url}
+	li := slices.IndexFunc(s.data.Lists, func(x List) bool {
+		if url != "" {
+			return x.URL == url
+		}
+		return x.URL == "" && x.Name == doc.Name
+	})
+	if li >= 0 {
+		l.ID = s.data.Lists[li].ID
+	} else {
+		id := make([]byte, 6)
+		if _, err := rand.Read(id); err != nil {
+			return List{}, err
+		}
+		l.ID = hex.EncodeToString(id)
+	}
+
+	tokens := slices.DeleteFunc(slices.Clone(s.data.Tokens), func(t Token) bool { return t.List == l.ID })
+	seen := map[string]bool{}
+	for _, t := range tokens {
+		seen[key(t.ChainID, t.Address)] = true
+	}
+	now := time.Now().UTC()
+	for _, e := range doc.Tokens {
+		t := Token{ChainID: e.ChainID, Address: e.Address, Symbol: e.Symbol, Name: e.Name, Decimals: e.Decimals, LogoURI: e.LogoURI, List: l.ID, AddedAt: now}
+		if !chains[t.ChainID] || validate(&t) != nil || seen[key(t.ChainID, t.Address)] {
+			l.Skipped++
+			continue
+		}
+		seen[key(t.ChainID, t.Address)] = true
+		tokens = append(tokens, t)
+		l.Tokens++
+	}
+	l.ImportedAt = now
+
+	lists := slices.Clone(s.data.Lists)
+	if li >= 0 {
+		lists[li] = l
+	} else {
+		lists = append(lists, l)
+	}
+	old := s.data
+	s.data = registry{Tokens: tokens, Lists: lists}
+	if err := s.save(); err != nil {
+		s.data = old
+		return List{}, err
+	}
+	return l, nil
+}
+
+// SetListError records why refreshing a list failed. Its tokens stay as
+// the last successful import left them.
+func (s *Store) SetListError(id string, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.data.Lists, func(l List) bool { return l.ID == id })
+	if i < 0 {
+		return fmt.Errorf("token list %q not found", id)
+	}
+	old := s.data.Lists
+	s.data.Lists = slices.Clone(old)
+	s.data.Lists[i].Error = err.Error()
+	if err := s.save(); err != nil {
+		s.data.Lists = old
+		return err
+	}
+	return nil
+}
+
+// GetList returns the list with the given ID.
+func (s *Store) GetList(id string) (List, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, l := range s.data.Lists {
+		if l.ID == id {
+			return l, true
+		}
+	}
+	return List{}, false
+}
+
+// RemoveList removes a token list and the tokens it registered.
+func (s *Store) RemoveList(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.data.Lists, func(l List) bool { return l.ID == id })
+	if i < 0 {
+		return fmt.Errorf("token list %q not found", id)
+	}
+	old := s.data
+	s.data = registry{
+		Tokens: slices.DeleteFunc(slices.Clone(old.Tokens), func(t Token) bool { return t.List == id }),
+		Lists:  slices.Delete(slices.Clone(old.Lists), i, i+1),
+	}
+	if err := s.save(); err != nil {
+		s.data = old
+		return err
+	}
+	return nil
+}
+
+// Due returns the lists fetched from a URL whose last import is older than
+// every.
+func (s *Store) Due(now time.Time, every time.Duration) []List {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []List
+	for _, l := range s.data.Lists {
+		if l.URL != "" && now.Sub(l.ImportedAt) >= every {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+func (s *Store) indexLocked(chainID uint64, address string) int {
+	return slices.IndexFunc(s.data.Tokens, func(t Token) bool {
+		return t.ChainID == chainID && strings.EqualFold(t.Address, address)
+	})
+}
+
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal erc20 tokens: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("write erc20 tokens: %w", err)
+	}
+	return nil
+}
+
+func key(chainID uint64, address string) string {
+	return fmt.Sprintf("%d:%s", chainID, strings.ToLower(address))
+}
+
+// validate checks a token and normalizes its fields.
+func validate(t *Token) error {
+	if t.ChainID == 0 {
+		return errors.New("chain_id is required")
+	}
+	addr, err := evm.ParseAddress(strings.TrimSpace(t.Address))
+	if err != nil {
+		return err
+	}
+	t.Address = addr.Hex()
+	t.Symbol = strings.TrimSpace(t.Symbol)
+	t.Name = strings.TrimSpace(t.Name)
+	t.LogoURI = strings.TrimSpace(t.LogoURI)
+	if t.Symbol == "" || len(t.Symbol) > 32 || strings.IndexFunc(t.Symbol, unicode.IsControl) >= 0 {
+		return fmt.Errorf("symbol %q must be 1 to 32 printable characters", t.Symbol)
+	}
+	if len(t.Name) > 64 || strings.IndexFunc(t.Name, unicode.IsControl) >= 0 {
+		return fmt.Errorf("name %q must be at most 64 printable characters", t.Name)
+	}
+	if t.Decimals < 0 || t.Decimals > 255 {
+		return fmt.Errorf("decimals %d must be between 0 and 255", t.Decimals)
+	}
+	return nil
+}
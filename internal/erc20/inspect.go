@@ -0,0 +1,324 @@
+package erc20
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+const (
+	// holderBlocks is how far back Inspect looks for a Transfer to find an
+	// address holding the token, for the fee-on-transfer check.
+	holderBlocks = 2000
+
+	// holderTries bounds the recent recipients whose balance is read.
+	holderTries = 5
+)
+
+var (
+	selTotalSupply = selector("totalSupply()")
+	selDecimals    = selector("decimals()")
+	selSymbol      = selector("symbol()")
+	selName        = selector("name()")
+	selBalanceOf   = selector("balanceOf(address)")
+	selTransfer    = selector("transfer(address,uint256)")
+
+	transferTopic = evm.EncodeHex(evm.Keccak256([]byte("Transfer(address,address,uint256)")))
+
+	// probeRecipient receives the fee-on-transfer check's simulated
+	// transfer. Nobody holds its key.
+	probeRecipient = evm.Address(evm.Keccak256([]byte("wallet erc20 transfer probe"))[12:])
+)
+
+// Metadata is what Inspect reads from a token contract.
+type Metadata struct {
+	Symbol   string
+	Name     string
+	Decimals int
+	// FeeBps is the share of a simulated transfer the recipient didn't
+	// receive, in basis points; nonzero for fee-on-transfer tokens.
+	FeeBps int
+	// Warnings describe non-standard behavior, and checks that couldn't be
+	// made.
+	Warnings []string
+}
+
+// Inspect reads a token's symbol, name, and decimals through ep, so a
+// custom token is registered with what the contract says rather than what
+// was typed. It fails if address has no code or doesn't answer
+// totalSupply(), decimals(), and symbol(). Symbols and names returned as
+// bytes32, as by early tokens such as MKR, are accepted with a warning.
+//
+// Inspect also simulates a transfer from a recent recipient of the token,
+// with an eth_call state override, to see whether the token withholds a
+// fee. Endpoints without state overrides, and tokens without recent
+// transfers, skip the check with a warning.
+func Inspect(ctx context.Context, ep endpoint.Endpoint, address evm.Address) (Metadata, error) {
+	contract := address.Hex()
+	if err := hasCode(ctx, ep, address); err != nil {
+		return Metadata{}, err
+	}
+	if out, err := endpoint.EthCall(ctx, ep, contract, selTotalSupply); err != nil || len(out) < 32 {
+		return Metadata{}, fmt.Errorf("%s is not an ERC-20 token: totalSupply() failed", contract)
+	}
+
+	var m Metadata
+	out, err := endpoint.EthCall(ctx, ep, contract, selDecimals)
+	if err != nil || len(out) < 32 {
+		return Metadata{}, fmt.Errorf("%s doesn't implement decimals()", contract)
+	}
+	d := new(big.Int).SetBytes(out[:32])
+	if d.Cmp(big.NewInt(255)) > 0 {
+		return Metadata{}, fmt.Errorf("%s reports %s decimals", contract, d)
+	}
+	m.Decimals = int(d.Int64())
+
+	out, err = endpoint.EthCall(ctx, ep, contract, selSymbol)
+	if err != nil {
+		return Metadata{}, fmt.Errorf("%s doesn't implement symbol()", contract)
+	}
+	symbol, fixed, err := decodeText(out)
+	if err != nil || symbol == "" {
+		return Metadata{}, fmt.Errorf("%s returns an unreadable symbol", contract)
+	}
+	m.Symbol = symbol
+	if fixed {
+		m.Warnings = append(m.Warnings, "symbol() returns bytes32 rather than a string")
+	}
+	if out, err := endpoint.EthCall(ctx, ep, contract, selName); err == nil {
+		if name, fixed, err := decodeText(out); err == nil {
+			m.Name = name
+			if fixed {
+				m.Warnings = append(m.Warnings, "name() returns bytes32 rather than a string")
+			}
+		}
+	}
+
+	fee, err := transferFee(ctx, ep, address)
+	switch {
+	case err != nil:
+		m.Warnings = append(m.Warnings, "fee-on-transfer check skipped: "+err.Error())
+	case fee > 0:
+		m.FeeBps = fee
+		m.Warnings = append(m.Warnings, fmt.Sprintf("fee-on-transfer: a transfer delivers %s%% less than sent", formatBps(fee)))
+	case fee < 0:
+		m.Warnings = append(m.Warnings, fmt.Sprintf("a transfer delivers %s%% more than sent; the token may rebase", formatBps(-fee)))
+	}
+	return m, nil
+}
+
+// transferFee simulates a transfer of a recent recipient's whole balance to
+// probeRecipient and returns the share that didn't arrive, in basis
+// points. The recipient's code is overridden with a probe that makes the
+// transfer and returns probeRecipient's balance afterwards, so the token
+// sees the holder as the sender.
+func transferFee(ctx context.Context, ep endpoint.Endpoint, token evm.Address) (int, error) {
+	holder, amount, err := findHolder(ctx, ep, token)
+	if err != nil {
+		return 0, err
+	}
+	out, err := endpoint.EthCall(ctx, ep, token.Hex(), selBalanceOf, addressWord(probeRecipient))
+	if err != nil || len(out) < 32 {
+		return 0, errors.New("balanceOf() failed")
+	}
+	before := new(big.Int).SetBytes(out[:32])
+
+	override := map[string]any{holder.Hex(): map[string]string{"code": evm.EncodeHex(probeCode(token, amount))}}
+	result, err := endpoint.RPCCall(ctx, ep, "eth_call", []any{map[string]string{"to": holder.Hex()}, "latest", override})
+	if err != nil {
+		return 0, fmt.Errorf("the endpoint can't simulate the transfer: %w", err)
+	}
+	var hex string
+	if err := json.Unmarshal(result, &hex); err != nil {
+		return 0, fmt.Errorf("unexpected eth_call result: %s", result)
+	}
+	out, err = evm.DecodeHex(hex)
+	if err != nil || len(out) < 32 {
+		return 0, errors.New("the endpoint ignored the state override")
+	}
+	received := new(big.Int).Sub(new(big.Int).SetBytes(out[:32]), before)
+	if received.Sign() == 0 {
+		return 0, errors.New("the simulated transfer moved nothing")
+	}
+	// (amount - received) * 10000 / amount
+	lost := new(big.Int).Sub(amount, received)
+	bps := lost.Mul(lost, big.NewInt(10000))
+	bps.Quo(bps, amount)
+	if !bps.IsInt64() || bps.Int64() > 10000 || bps.Int64() < -10000 {
+		return 0, errors.New("the simulated transfer's result is implausible")
+	}
+	return int(bps.Int64()), nil
+}
+
+// findHolder returns a recent recipient of the token with a nonzero
+// balance, and that balance.
+func findHolder(ctx context.Context, ep endpoint.Endpoint, token evm.Address) (evm.Address, *big.Int, error) {
+	head, err := rpcString(ctx, ep, "eth_blockNumber")
+	if err != nil {
+		return evm.Address{}, nil, err
+	}
+	n, err := evm.ParseQuantity(head)
+	if err != nil || !n.IsUint64() {
+		return evm.Address{}, nil, fmt.Errorf("unexpected eth_blockNumber result: %s", head)
+	}
+	from := n.Uint64() - min(n.Uint64(), holderBlocks)
+	filter := map[string]any{
+		"address":   token.Hex(),
+		"fromBlock": fmt.Sprintf("0x%x", from),
+		"toBlock":   "latest",
+		"topics":    []any{transferTopic},
+	}
+	result, err := endpoint.RPCCall(ctx, ep, "eth_getLogs", []any{filter})
+	if err != nil {
+		return evm.Address{}, nil, err
+	}
+	var logs []struct {
+		Topics []string `json:"topics"`
+	}
+	if err := json.Unmarshal(result, &logs); err != nil {
+		return evm.Address{}, nil, fmt.Errorf("unexpected eth_getLogs result: %s", result)
+	}
+	var tried []evm.Address
+	for i := len(logs) - 1; i >= 0 && len(tried) < holderTries; i-- {
+		if len(logs[i].Topics) != 3 {
+			continue // ERC-721 transfers index the token ID too
+		}
+		b, err := evm.DecodeHex(logs[i].Topics[2])
+		if err != nil || len(b) != 32 {
+			continue
+		}
+		to := evm.Address(b[12:])
+		if to == (evm.Address{}) || to == token || to == probeRecipient || slices.Contains(tried, to) {
+			continue
+		}
+		tried = append(tried, to)
+		out, err := endpoint.EthCall(ctx, ep, token.Hex(), selBalanceOf, addressWord(to))
+		if err != nil || len(out) < 32 {
+			continue
+		}
+		if bal := new(big.Int).SetBytes(out[:32]); bal.Sign() > 0 {
+			return to, bal, nil
+		}
+	}
+	return evm.Address{}, nil, fmt.Errorf("no holder found in the last %d blocks", holderBlocks)
+}
+
+// probeCode assembles the contract transferFee runs at the holder's
+// address: transfer(probeRecipient, amount) on the token, then return
+// probeRecipient's balance. It reverts if either call fails.
+func probeCode(token evm.Address, amount *big.Int) []byte {
+	const (
+		opGas        = 0x5a
+		opCall       = 0xf1
+		opStaticcall = 0xfa
+		opMstore     = 0x52
+		opIszero     = 0x15
+		opJumpi      = 0x57
+		opJumpdest   = 0x5b
+		opReturn     = 0xf3
+		opRevert     = 0xfd
+		opPush1      = 0x60
+		opPush20     = 0x73
+		opPush32     = 0x7f
+	)
+	push1 := func(b byte) []byte { return []byte{opPush1, b} }
+	push20 := func(a evm.Address) []byte { return append([]byte{opPush20}, a[:]...) }
+	push32 := func(w []byte) []byte { return append([]byte{opPush32}, w...) }
+	selWord := func(sel []byte) []byte { return append(slices.Clone(sel), make([]byte, 28)...) }
+
+	var code []byte
+	emit := func(parts ...[]byte) {
+		for _, p := range parts {
+			code = append(code, p...)
+		}
+	}
+	// transfer(probeRecipient, amount): selector at 0, arguments at 4 and 36.
+	emit(push32(selWord(selTransfer)), push1(0), []byte{opMstore})
+	emit(push20(probeRecipient), push1(4), []byte{opMstore})
+	emit(push32(amount.FillBytes(make([]byte, 32))), push1(36), []byte{opMstore})
+	emit(push1(0), push1(0), push1(68), push1(0), push1(0), push20(token), []byte{opGas, opCall, opIszero})
+	revertAt := len(code) // patched below
+	emit(push1(0), []byte{opJumpi})
+	// balanceOf(probeRecipient), returned from memory 0.
+	emit(push32(selWord(selBalanceOf)), push1(0), []byte{opMstore})
+	emit(push20(probeRecipient), push1(4), []byte{opMstore})
+	emit(push1(32), push1(0), push1(36), push1(0), push20(token), []byte{opGas, opStaticcall, opIszero})
+	revertAt2 := len(code)
+	emit(push1(0), []byte{opJumpi})
+	emit(push1(32), push1(0), []byte{opReturn})
+	dest := len(code)
+	emit([]byte{opJumpdest}, push1(0), push1(0), []byte{opRevert})
+	code[revertAt+1] = byte(dest)
+	code[revertAt2+1] = byte(dest)
+	return code
+}
+
+// decodeText decodes a string returned by a call, or a bytes32 for tokens
+// that predate the standard, reporting which it was.
+func decodeText(out []byte) (string, bool, error) {
+	if len(out) >= 64 {
+		if s, err := decodeString(out); err == nil && utf8.ValidString(s) {
+			return strings.TrimSpace(s), false, nil
+		}
+	}
+	if len(out) == 32 {
+		b := bytes.TrimRight(out, "\x00")
+		if utf8.Valid(b) {
+			return strings.TrimSpace(string(b)), true, nil
+		}
+	}
+	return "", false, errors.New("malformed string")
+}
+
+// decodeString decodes an ABI-encoded string.
+func decodeString(out []byte) (string, error) {
+	off := new(big.Int).SetBytes(out[:32])
+	if !off.IsInt64() || off.Int64() > int64(len(out)-32) {
+		return "", errors.New("malformed string")
+	}
+	start := int(off.Int64()) + 32
+	n := new(big.Int).SetBytes(out[start-32 : start])
+	if !n.IsInt64() || n.Int64() > int64(len(out)-start) {
+		return "", errors.New("malformed string")
+	}
+	return string(out[start : start+int(n.Int64())]), nil
+}
+
+// formatBps formats basis points as a percentage, e.g. 250 as "2.5".
+func formatBps(bps int) string {
+	s := fmt.Sprintf("%d.%02d", bps/100, bps%100)
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
+
+// rpcString makes a call whose result is a string.
+func rpcString(ctx context.Context, ep endpoint.Endpoint, method string, params ...any) (string, error) {
+	if params == nil {
+		params = []any{}
+	}
+	result, err := endpoint.RPCCall(ctx, ep, method, params)
+	if err != nil {
+		return "", err
+	}
+	var s string
+	if err := json.Unmarshal(result, &s); err != nil {
+		return "", fmt.Errorf("unexpected %s result: %s", method, result)
+	}
+	return s, nil
+}
+
+func selector(sig string) []byte {
+	return evm.Keccak256([]byte(sig))[:4]
+}
+
+func addressWord(a evm.Address) []byte {
+	return append(make([]byte, 12), a[:]...)
+}
@@ -0,0 +1,360 @@
+package erc20
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// Permit2Address is Uniswap's Permit2 contract, deployed at the same address
+// on every chain that has it.
+const Permit2Address = "0x000000000022D473030F116dDEE9F6B43aC78BA3"
+
+// PermitKind is the standard a permit follows.
+type PermitKind string
+
+const (
+	// PermitEIP2612 is the token's own permit(), for tokens that implement
+	// EIP-2612.
+	PermitEIP2612 PermitKind = "eip2612"
+	// PermitPermit2 is an allowance through Permit2 (PermitSingle), for any
+	// token the owner has approved Permit2 to spend.
+	PermitPermit2 PermitKind = "permit2"
+)
+
+const (
+	domainType  = "EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)"
+	permit2Type = "EIP712Domain(string name,uint256 chainId,address verifyingContract)"
+	permitType  = "Permit(address owner,address spender,uint256 value,uint256 nonce,uint256 deadline)"
+	detailsType = "PermitDetails(address token,uint160 amount,uint48 expiration,uint48 nonce)"
+	singleType  = "PermitSingle(PermitDetails details,address spender,uint256 sigDeadline)" + detailsType
+	maxUint48   = 1<<48 - 1
+	permitCall  = "permit(address,address,uint256,uint256,uint8,bytes32,bytes32)"
+	permit2Call = "permit(address,((address,uint160,uint48,uint48),address,uint256),bytes)"
+)
+
+var (
+	maxUint160 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 160), big.NewInt(1))
+	maxUint256 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+)
+
+// PermitRequest describes an approval to sign.
+type PermitRequest struct {
+	Kind     PermitKind
+	Owner    evm.Address
+	Token    evm.Address
+	Spender  evm.Address
+	Amount   *big.Int // nil for the largest the permit allows
+	Deadline uint64   // Unix time after which the signature is rejected
+	// Expiration is when a Permit2 allowance lapses, in Unix time.
+	Expiration uint64
+}
+
+// TypedField is a field of an EIP-712 struct type.
+type TypedField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// TypedData is an EIP-712 payload in the form eth_signTypedData_v4 takes.
+type TypedData struct {
+	Types       map[string][]TypedField `json:"types"`
+	PrimaryType string                  `json:"primaryType"`
+	Domain      map[string]any          `json:"domain"`
+	Message     map[string]any          `json:"message"`
+}
+
+// Permit is a permit built from a PermitRequest, ready to sign. Contract is
+// where permit() is called with Calldata once the permit is signed: the
+// token for EIP-2612, Permit2 otherwise.
+type Permit struct {
+	Kind            PermitKind `json:"kind"`
+	ChainID         uint64     `json:"chain_id"`
+	Contract        string     `json:"contract"`
+	Owner           string     `json:"owner"`
+	Token           string     `json:"token"`
+	Spender         string     `json:"spender"`
+	Amount          string     `json:"amount"`
+	Nonce           string     `json:"nonce"`
+	Deadline        uint64     `json:"deadline"`
+	Expiration      uint64     `json:"expiration,omitempty"`
+	TypedData       TypedData  `json:"typed_data"`
+	DomainSeparator string     `json:"domain_separator"`
+	MessageHash     string     `json:"message_hash"`
+	Digest          string     `json:"digest"` // the hash that is signed
+	Warnings        []string   `json:"warnings,omitempty"`
+
+	Signature string `json:"signature,omitempty"` // r || s || v, v as 27/28
+	V         int    `json:"v,omitempty"`
+	R         string `json:"r,omitempty"`
+	S         string `json:"s,omitempty"`
+	Calldata  string `json:"calldata,omitempty"`
+
+	domain, message []byte
+	amount, nonce   *big.Int
+}
+
+// BuildPermit reads what a permit needs through ep, the nonce and the
+// contract's domain, and returns it ready to sign. For EIP-2612 the domain
+// is rebuilt from the token's name() and version() and must match its
+// DOMAIN_SEPARATOR(), so a signature is never made over a domain the token
+// would reject.
+func BuildPermit(ctx context.Context, ep endpoint.Endpoint, req PermitRequest) (*Permit, error) {
+	now := uint64(time.Now().Unix())
+	if req.Deadline <= now {
+		return nil, errors.New("deadline must be in the future")
+	}
+	if req.Spender == (evm.Address{}) {
+		return nil, errors.New("spender is required")
+	}
+	if req.Amount != nil && (req.Amount.Sign() < 0 || req.Amount.BitLen() > 256) {
+		return nil, errors.New("amount must be a uint256")
+	}
+	head, err := rpcString(ctx, ep, "eth_chainId")
+	if err != nil {
+		return nil, err
+	}
+	id, err := evm.ParseQuantity(head)
+	if err != nil || !id.IsUint64() {
+		return nil, fmt.Errorf("unexpected eth_chainId result: %s", head)
+	}
+	if err := hasCode(ctx, ep, req.Token); err != nil {
+		return nil, err
+	}
+	p := &Permit{
+		Kind:     req.Kind,
+		ChainID:  id.Uint64(),
+		Owner:    req.Owner.Hex(),
+		Token:    req.Token.Hex(),
+		Spender:  req.Spender.Hex(),
+		Deadline: req.Deadline,
+	}
+	switch req.Kind {
+	case PermitEIP2612:
+		err = p.buildEIP2612(ctx, ep, req)
+	case PermitPermit2:
+		err = p.buildPermit2(ctx, ep, req, now)
+	default:
+		return nil, fmt.Errorf("unknown permit kind %q", req.Kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.DomainSeparator = evm.EncodeHex(p.domain)
+	p.MessageHash = evm.EncodeHex(p.message)
+	p.Digest = evm.EncodeHex(evm.Keccak256(p.Payload()))
+	return p, nil
+}
+
+func (p *Permit) buildEIP2612(ctx context.Context, ep endpoint.Endpoint, req PermitRequest) error {
+	token := req.Token.Hex()
+	out, err := endpoint.EthCall(ctx, ep, token, selector("DOMAIN_SEPARATOR()"))
+	if err != nil || len(out) != 32 {
+		return fmt.Errorf("%s doesn't support EIP-2612 permits: it has no DOMAIN_SEPARATOR()", token)
+	}
+	onChain := out
+	out, err = endpoint.EthCall(ctx, ep, token, selector("nonces(address)"), addressWord(req.Owner))
+	if err != nil || len(out) < 32 {
+		return fmt.Errorf("%s doesn't support EIP-2612 permits: it has no nonces()", token)
+	}
+	p.nonce = new(big.Int).SetBytes(out[:32])
+
+	out, err = endpoint.EthCall(ctx, ep, token, selName)
+	if err != nil {
+		return fmt.Errorf("%s has no name(), which its permit domain needs", token)
+	}
+	name, _, err := decodeText(out)
+	if err != nil {
+		return fmt.Errorf("%s returns an unreadable name", token)
+	}
+	// Most tokens use version "1"; some, such as USDC, say otherwise in
+	// version().
+	versions := []string{"1", "2"}
+	if out, err := endpoint.EthCall(ctx, ep, token, selector("version()")); err == nil {
+		if v, _, err := decodeText(out); err == nil && v != "" {
+			versions = slices.Insert(slices.DeleteFunc(versions, func(x string) bool { return x == v }), 0, v)
+		}
+	}
+	version := ""
+	for _, v := range versions {
+		d := hashStruct(domainType, keccakText(name), keccakText(v), uintWord(new(big.Int).SetUint64(p.ChainID)), addressWord(req.Token))
+		if slices.Equal(d, onChain) {
+			version, p.domain = v, d
+			break
+		}
+	}
+	if p.domain == nil {
+		return fmt.Errorf("%s's DOMAIN_SEPARATOR() doesn't match an EIP-712 domain for name %q; it may use a non-standard permit", token, name)
+	}
+
+	p.amount = req.Amount
+	if p.amount == nil {
+		p.amount = maxUint256
+	}
+	p.Contract = token
+	p.Amount = p.amount.String()
+	p.Nonce = p.nonce.String()
+	p.message = hashStruct(permitType, addressWord(req.Owner), addressWord(req.Spender), uintWord(p.amount), uintWord(p.nonce), uintWord(new(big.Int).SetUint64(p.Deadline)))
+	p.TypedData = TypedData{
+		Types: map[string][]TypedField{
+			"EIP712Domain": fields("name string", "version string", "chainId uint256", "verifyingContract address"),
+			"Permit":       fields("owner address", "spender address", "value uint256", "nonce uint256", "deadline uint256"),
+		},
+		PrimaryType: "Permit",
+		Domain:      map[string]any{"name": name, "version": version, "chainId": p.ChainID, "verifyingContract": token},
+		Message: map[string]any{
+			"owner":    p.Owner,
+			"spender":  p.Spender,
+			"value":    p.Amount,
+			"nonce":    p.Nonce,
+			"deadline": fmt.Sprint(p.Deadline),
+		},
+	}
+	return nil
+}
+
+func (p *Permit) buildPermit2(ctx context.Context, ep endpoint.Endpoint, req PermitRequest, now uint64) error {
+	permit2, _ := evm.ParseAddress(Permit2Address)
+	if err := hasCode(ctx, ep, permit2); err != nil {
+		return fmt.Errorf("Permit2 isn't deployed on chain %d", p.ChainID)
+	}
+	p.domain = hashStruct(permit2Type, keccakText("Permit2"), uintWord(new(big.Int).SetUint64(p.ChainID)), addressWord(permit2))
+	if out, err := endpoint.EthCall(ctx, ep, Permit2Address, selector("DOMAIN_SEPARATOR()")); err != nil || !slices.Equal(out, p.domain) {
+		return fmt.Errorf("the contract at %s isn't Permit2", Permit2Address)
+	}
+	// allowance(owner, token, spender) returns (amount, expiration, nonce).
+	out, err := endpoint.EthCall(ctx, ep, Permit2Address, selector("allowance(address,address,address)"), addressWord(req.Owner), addressWord(req.Token), addressWord(req.Spender))
+	if err != nil || len(out) < 96 {
+		return errors.New("reading the Permit2 nonce failed")
+	}
+	p.nonce = new(big.Int).SetBytes(out[64:96])
+
+	p.amount = req.Amount
+	if p.amount == nil {
+		p.amount = maxUint160
+	}
+	if p.amount.Cmp(maxUint160) > 0 {
+		return errors.New("a Permit2 amount must fit in 160 bits")
+	}
+	p.Expiration = req.Expiration
+	if p.Expiration <= now || p.Expiration > maxUint48 || p.Deadline > maxUint48 {
+		return errors.New("expiration must be in the future, and it and the deadline must fit in 48 bits")
+	}
+	if out, err := endpoint.EthCall(ctx, ep, p.Token, selector("allowance(address,address)"), addressWord(req.Owner), addressWord(permit2)); err == nil && len(out) >= 32 {
+		if new(big.Int).SetBytes(out[:32]).Cmp(p.amount) < 0 {
+			p.Warnings = append(p.Warnings, "the owner hasn't approved Permit2 to spend this much of the token, so the spender can't use the allowance until it does")
+		}
+	}
+
+	p.Contract = permit2.Hex()
+	p.Amount = p.amount.String()
+	p.Nonce = p.nonce.String()
+	details := hashStruct(detailsType, addressWord(req.Token), uintWord(p.amount), uintWord(new(big.Int).SetUint64(p.Expiration)), uintWord(p.nonce))
+	p.message = hashStruct(singleType, details, addressWord(req.Spender), uintWord(new(big.Int).SetUint64(p.Deadline)))
+	p.TypedData = TypedData{
+		Types: map[string][]TypedField{
+			"EIP712Domain":  fields("name string", "chainId uint256", "verifyingContract address"),
+			"PermitSingle":  fields("details PermitDetails", "spender address", "sigDeadline uint256"),
+			"PermitDetails": fields("token address", "amount uint160", "expiration uint48", "nonce uint48"),
+		},
+		PrimaryType: "PermitSingle",
+		Domain:      map[string]any{"name": "Permit2", "chainId": p.ChainID, "verifyingContract": p.Contract},
+		Message: map[string]any{
+			"details": map[string]any{
+				"token":      p.Token,
+				"amount":     p.Amount,
+				"expiration": fmt.Sprint(p.Expiration),
+				"nonce":      p.Nonce,
+			},
+			"spender":     p.Spender,
+			"sigDeadline": fmt.Sprint(p.Deadline),
+		},
+	}
+	return nil
+}
+
+// Payload returns what a signer hashes and signs: 0x1901, the domain
+// separator, and the message's struct hash.
+func (p *Permit) Payload() []byte {
+	return slices.Concat([]byte{0x19, 0x01}, p.domain, p.message)
+}
+
+// SetSignature checks that sig is the owner's signature of the permit and
+// fills in the signature fields and the permit() calldata.
+func (p *Permit) SetSignature(sig evm.Signature) error {
+	signer, err := evm.RecoverAddress(evm.Keccak256(p.Payload()), sig)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(signer.Hex(), p.Owner) {
+		return fmt.Errorf("the signature is by %s, not the owner %s", signer.Hex(), p.Owner)
+	}
+	r, s := uintWord(sig.R), uintWord(sig.S)
+	v := int(sig.YParity) + 27
+	raw := slices.Concat(r, s, []byte{byte(v)})
+	p.Signature = evm.EncodeHex(raw)
+	p.V, p.R, p.S = v, evm.EncodeHex(r), evm.EncodeHex(s)
+
+	owner, _ := evm.ParseAddress(p.Owner)
+	spender, _ := evm.ParseAddress(p.Spender)
+	deadline := uintWord(new(big.Int).SetUint64(p.Deadline))
+	var data []byte
+	switch p.Kind {
+	case PermitEIP2612:
+		data = slices.Concat(selector(permitCall), addressWord(owner), addressWord(spender), uintWord(p.amount), deadline,
+			uintWord(big.NewInt(int64(v))), r, s)
+	case PermitPermit2:
+		token, _ := evm.ParseAddress(p.Token)
+		// The PermitSingle tuple is static, so it sits in the head; the
+		// signature follows as dynamic bytes, padded to a whole word.
+		data = slices.Concat(selector(permit2Call), addressWord(owner),
+			addressWord(token), uintWord(p.amount), uintWord(new(big.Int).SetUint64(p.Expiration)), uintWord(p.nonce),
+			addressWord(spender), deadline,
+			uintWord(big.NewInt(8*32)), uintWord(big.NewInt(65)), raw, make([]byte, 31))
+	}
+	p.Calldata = evm.EncodeHex(data)
+	return nil
+}
+
+// hashStruct returns the EIP-712 hash of a struct given its type and its
+// fields' encoded words.
+func hashStruct(typ string, words ...[]byte) []byte {
+	return evm.Keccak256(slices.Concat(append([][]byte{evm.Keccak256([]byte(typ))}, words...)...))
+}
+
+func keccakText(s string) []byte {
+	return evm.Keccak256([]byte(s))
+}
+
+func uintWord(n *big.Int) []byte {
+	return n.FillBytes(make([]byte, 32))
+}
+
+// fields builds a type's field list from "name type" pairs.
+func fields(defs ...string) []TypedField {
+	out := make([]TypedField, len(defs))
+	for i, d := range defs {
+		name, typ, _ := strings.Cut(d, " ")
+		out[i] = TypedField{Name: name, Type: typ}
+	}
+	return out
+}
+
+// hasCode checks that address is a contract.
+func hasCode(ctx context.Context, ep endpoint.Endpoint, address evm.Address) error {
+	code, err := rpcString(ctx, ep, "eth_getCode", address.Hex(), "latest")
+	if err != nil {
+		return err
+	}
+	if b, err := evm.DecodeHex(code); err != nil || len(b) == 0 {
+		return fmt.Errorf("no contract at %s", address.Hex())
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package erc20
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxListSize bounds a downloaded token list; the largest public ones are a
+// few MiB.
+const maxListSize = 16 << 20
+
+// Doc is a token list in the Uniswap tokenlists format. Fields the
+// registry doesn't use, such as version and tags, are ignored.
+type Doc struct {
+	Name   string  `json:"name"`
+	Tokens []Entry `json:"tokens"`
+}
+
+// Entry is one token of a Doc.
+type Entry struct {
+	ChainID  uint64 `json:"chainId"`
+	Address  string `json:"address"`
+	Symbol   string `json:"symbol"`
+	Name     string `json:"name"`
+	Decimals int    `json:"decimals"`
+	LogoURI  string `json:"logoURI"`
+}
+
+// ParseList parses a token list.
+func ParseList(data []byte) (Doc, error) {
+	var doc Doc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return Doc{}, fmt.Errorf("parse token list: %w", err)
+	}
+	doc.Name = strings.TrimSpace(doc.Name)
+	if doc.Name == "" {
+		return Doc{}, errors.New("token list has no name")
+	}
+	if len(doc.Tokens) == 0 {
+		return Doc{}, errors.New("token list has no tokens")
+	}
+	return doc, nil
+}
+
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// FetchList downloads and parses a token list.
+func FetchList(ctx context.Context, url string) (Doc, error) {
+	if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+		return Doc{}, fmt.Errorf("token list URL %q must be http(s)", url)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return Doc{}, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Doc{}, fmt.Errorf("fetch token list: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Doc{}, fmt.Errorf("fetch token list: HTTP %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxListSize+1))
+	if err != nil {
+		return Doc{}, fmt.Errorf("fetch token list: %w", err)
+	}
+	if len(data) > maxListSize {
+		return Doc{}, fmt.Errorf("token list is larger than %d bytes", maxListSize)
+	}
+	return ParseList(data)
+}
@@ -0,0 +1,154 @@
+// Package evm holds the Ethereum primitives the wallet needs on the server:
+// Keccak hashing, EIP-55 addresses, RLP, and EIP-1559 transactions.
+package evm
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Keccak256 returns the legacy Keccak-256 hash of the concatenated inputs.
+func Keccak256(data ...[]byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// Address is a 20-byte account address.
+type Address [20]byte
+
+// ParseAddress parses a 0x-prefixed hex address. Mixed-case input must carry a
+// valid EIP-55 checksum.
+func ParseAddress(s string) (Address, error) {
+	var a Address
+	if !strings.HasPrefix(s, "0x") && !strings.HasPrefix(s, "0X") {
+		return a, fmt.Errorf("address %q missing 0x prefix", s)
+	}
+	b, err := hex.DecodeString(s[2:])
+	if err != nil || len(b) != 20 {
+		return a, fmt.Errorf("invalid address %q", s)
+	}
+	copy(a[:], b)
+	body := s[2:]
+	if body != strings.ToLower(body) && body != strings.ToUpper(body) && a.Hex() != "0x"+body {
+		return a, fmt.Errorf("address %q has an invalid checksum", s)
+	}
+	return a, nil
+}
+
+// Hex returns the EIP-55 checksummed form of the address.
+func (a Address) Hex() string {
+	lower := hex.EncodeToString(a[:])
+	hash := Keccak256([]byte(lower))
+	out := []byte(lower)
+	for i, c := range out {
+		if c >= 'a' && c <= 'f' && hash[i/2]>>(4*(1-uint(i%2)))&0xf >= 8 {
+			out[i] = c - 32
+		}
+	}
+	return "0x" + string(out)
+}
+
+func (a Address) String() string { return a.Hex() }
+
+// MarshalText encodes the address in checksummed hex.
+func (a Address) MarshalText() ([]byte, error) { return []byte(a.Hex()), nil }
+
+// UnmarshalText parses a hex address.
+func (a *Address) UnmarshalText(b []byte) error {
+	parsed, err := ParseAddress(string(b))
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// EncodeHex returns b as a 0x-prefixed hex string.
+func EncodeHex(b []byte) string {
+	return "0x" + hex.EncodeToString(b)
+}
+
+// DecodeHex parses 0x-prefixed (or bare) hex data. An empty string or "0x" is empty data.
+func DecodeHex(s string) ([]byte, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if len(s)%2 == 1 {
+		s = "0" + s
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex: %w", err)
+	}
+	return b, nil
+}
+
+// EncodeQuantity returns n as a JSON-RPC hex quantity ("0x0", "0x1a").
+func EncodeQuantity(n *big.Int) string {
+	if n == nil {
+		return "0x0"
+	}
+	return "0x" + n.Text(16)
+}
+
+// ParseQuantity parses a hex quantity ("0x1a") or a decimal string ("26").
+func ParseQuantity(s string) (*big.Int, error) {
+	s = strings.TrimSpace(s)
+	n := new(big.Int)
+	var ok bool
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		if len(s) == 2 {
+			return n, nil
+		}
+		_, ok = n.SetString(s[2:], 16)
+	} else {
+		_, ok = n.SetString(s, 10)
+	}
+	if !ok || n.Sign() < 0 {
+		return nil, fmt.Errorf("invalid quantity %q", s)
+	}
+	return n, nil
+}
+
+// FormatUnits renders an integer amount with the given number of decimals,
+// trimming trailing zeros ("1500000000000000000", 18 -> "1.5").
+func FormatUnits(n *big.Int, decimals int) string {
+	if n == nil {
+		return "0"
+	}
+	s := n.String()
+	if decimals == 0 {
+		return s
+	}
+	if len(s) <= decimals {
+		s = strings.Repeat("0", decimals-len(s)+1) + s
+	}
+	whole, frac := s[:len(s)-decimals], strings.TrimRight(s[len(s)-decimals:], "0")
+	if frac == "" {
+		return whole
+	}
+	return whole + "." + frac
+}
+
+// ParseUnits is the inverse of FormatUnits: it parses a decimal amount such
+// as "1.5" into an integer with the given number of decimals.
+func ParseUnits(s string, decimals int) (*big.Int, error) {
+	s = strings.TrimSpace(s)
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" {
+		whole = "0"
+	}
+	if len(frac) > decimals {
+		return nil, fmt.Errorf("%q has more than %d decimals", s, decimals)
+	}
+	n, ok := new(big.Int).SetString(whole+frac+strings.Repeat("0", decimals-len(frac)), 10)
+	if !ok || n.Sign() < 0 {
+		return nil, fmt.Errorf("invalid amount %q", s)
+	}
+	return n, nil
+}
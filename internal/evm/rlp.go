@@ -0,0 +1,122 @@
+package evm
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// RLPEncode encodes v, which must be a []byte, string, uint64, *big.Int, or
+// []any of those (nested lists allowed).
+func RLPEncode(v any) []byte {
+	switch v := v.(type) {
+	case []byte:
+		return rlpBytes(v)
+	case string:
+		return rlpBytes([]byte(v))
+	case uint64:
+		return rlpBytes(new(big.Int).SetUint64(v).Bytes())
+	case *big.Int:
+		if v == nil {
+			return rlpBytes(nil)
+		}
+		return rlpBytes(v.Bytes())
+	case []any:
+		var payload []byte
+		for _, item := range v {
+			payload = append(payload, RLPEncode(item)...)
+		}
+		return append(rlpLength(len(payload), 0xc0), payload...)
+	default:
+		panic(fmt.Sprintf("rlp: unsupported type %T", v))
+	}
+}
+
+func rlpBytes(b []byte) []byte {
+	if len(b) == 1 && b[0] < 0x80 {
+		return []byte{b[0]}
+	}
+	return append(rlpLength(len(b), 0x80), b...)
+}
+
+func rlpLength(n int, offset byte) []byte {
+	if n < 56 {
+		return []byte{offset + byte(n)}
+	}
+	lb := new(big.Int).SetInt64(int64(n)).Bytes()
+	return append([]byte{offset + 55 + byte(len(lb))}, lb...)
+}
+
+// RLPDecode decodes a single RLP item, returning []byte for strings and []any
+// for lists. Trailing data after the item is an error.
+func RLPDecode(b []byte) (any, error) {
+	v, rest, err := rlpDecodeItem(b)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("rlp: %d trailing bytes", len(rest))
+	}
+	return v, nil
+}
+
+func rlpDecodeItem(b []byte) (any, []byte, error) {
+	if len(b) == 0 {
+		return nil, nil, fmt.Errorf("rlp: unexpected end of input")
+	}
+	prefix := b[0]
+	switch {
+	case prefix < 0x80:
+		return b[:1], b[1:], nil
+	case prefix < 0xb8:
+		n := int(prefix - 0x80)
+		if len(b) < 1+n {
+			return nil, nil, fmt.Errorf("rlp: string overflows input")
+		}
+		return b[1 : 1+n], b[1+n:], nil
+	case prefix < 0xc0:
+		n, body, err := rlpLongLength(b, prefix-0xb7)
+		if err != nil {
+			return nil, nil, err
+		}
+		return body[:n], body[n:], nil
+	case prefix < 0xf8:
+		n := int(prefix - 0xc0)
+		if len(b) < 1+n {
+			return nil, nil, fmt.Errorf("rlp: list overflows input")
+		}
+		list, err := rlpDecodeList(b[1 : 1+n])
+		return list, b[1+n:], err
+	default:
+		n, body, err := rlpLongLength(b, prefix-0xf7)
+		if err != nil {
+			return nil, nil, err
+		}
+		list, err := rlpDecodeList(body[:n])
+		return list, body[n:], err
+	}
+}
+
+func rlpLongLength(b []byte, lenOfLen byte) (int, []byte, error) {
+	if len(b) < 1+int(lenOfLen) {
+		return 0, nil, fmt.Errorf("rlp: length overflows input")
+	}
+	n := new(big.Int).SetBytes(b[1 : 1+lenOfLen])
+	body := b[1+lenOfLen:]
+	if !n.IsInt64() || n.Int64() > int64(len(body)) {
+		return 0, nil, fmt.Errorf("rlp: item overflows input")
+	}
+	return int(n.Int64()), body, nil
+}
+
+func rlpDecodeList(b []byte) ([]any, error) {
+	list := []any{}
+	for len(b) > 0 {
+		item, rest, err := rlpDecodeItem(b)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+		b = rest
+	}
+	return list, nil
+}
@@ -0,0 +1,170 @@
+package evm
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// DynamicFeeTxType is the EIP-2718 type byte of EIP-1559 transactions.
+const DynamicFeeTxType = 0x02
+
+// Tx is an EIP-1559 (type 2) transaction with an empty access list.
+type Tx struct {
+	ChainID              *big.Int
+	Nonce                uint64
+	MaxPriorityFeePerGas *big.Int
+	MaxFeePerGas         *big.Int
+	Gas                  uint64
+	To                   *Address // nil for contract creation
+	Value                *big.Int
+	Data                 []byte
+}
+
+// Signature is a secp256k1 signature with its recovery parity.
+type Signature struct {
+	YParity byte
+	R, S    *big.Int
+}
+
+func (tx *Tx) fields() []any {
+	var to []byte
+	if tx.To != nil {
+		to = tx.To[:]
+	}
+	return []any{
+		tx.ChainID,
+		tx.Nonce,
+		tx.MaxPriorityFeePerGas,
+		tx.MaxFeePerGas,
+		uint64(tx.Gas),
+		to,
+		tx.Value,
+		tx.Data,
+		[]any{}, // access list
+	}
+}
+
+// SigningPayload returns the unsigned serialized transaction: the type byte
+// followed by the RLP of its fields. Hardware wallets sign this directly.
+func (tx *Tx) SigningPayload() []byte {
+	return append([]byte{DynamicFeeTxType}, RLPEncode(tx.fields())...)
+}
+
+// SigningHash returns the Keccak-256 hash of the signing payload.
+func (tx *Tx) SigningHash() []byte {
+	return Keccak256(tx.SigningPayload())
+}
+
+// EncodeSigned returns the raw signed transaction for eth_sendRawTransaction.
+func (tx *Tx) EncodeSigned(sig Signature) []byte {
+	fields := append(tx.fields(), uint64(sig.YParity), sig.R, sig.S)
+	return append([]byte{DynamicFeeTxType}, RLPEncode(fields)...)
+}
+
+// Hash returns the transaction hash of the signed transaction.
+func (tx *Tx) Hash(sig Signature) []byte {
+	return Keccak256(tx.EncodeSigned(sig))
+}
+
+// DecodeSignedTx parses a raw signed EIP-1559 transaction.
+func DecodeSignedTx(raw []byte) (*Tx, Signature, error) {
+	var sig Signature
+	if len(raw) == 0 || raw[0] != DynamicFeeTxType {
+		return nil, sig, fmt.Errorf("not an EIP-1559 transaction")
+	}
+	v, err := RLPDecode(raw[1:])
+	if err != nil {
+		return nil, sig, err
+	}
+	f, ok := v.([]any)
+	if !ok || len(f) != 12 {
+		return nil, sig, fmt.Errorf("signed transaction must have 12 fields")
+	}
+	b := make([][]byte, len(f))
+	for i, item := range f {
+		if i == 8 {
+			continue // access list
+		}
+		if b[i], ok = item.([]byte); !ok {
+			return nil, sig, fmt.Errorf("field %d is not a byte string", i)
+		}
+	}
+	if al, ok := f[8].([]any); !ok || len(al) != 0 {
+		return nil, sig, fmt.Errorf("access lists are not supported")
+	}
+
+	tx := &Tx{
+		ChainID:              new(big.Int).SetBytes(b[0]),
+		Nonce:                new(big.Int).SetBytes(b[1]).Uint64(),
+		MaxPriorityFeePerGas: new(big.Int).SetBytes(b[2]),
+		MaxFeePerGas:         new(big.Int).SetBytes(b[3]),
+		Gas:                  new(big.Int).SetBytes(b[4]).Uint64(),
+		Value:                new(big.Int).SetBytes(b[6]),
+		Data:                 b[7],
+	}
+	switch len(b[5]) {
+	case 0:
+	case 20:
+		var to Address
+		copy(to[:], b[5])
+		tx.To = &to
+	default:
+		return nil, sig, fmt.Errorf("invalid recipient length %d", len(b[5]))
+	}
+	parity := new(big.Int).SetBytes(b[9])
+	if parity.Cmp(big.NewInt(1)) > 0 {
+		return nil, sig, fmt.Errorf("invalid y parity %s", parity)
+	}
+	sig = Signature{YParity: byte(parity.Uint64()), R: new(big.Int).SetBytes(b[10]), S: new(big.Int).SetBytes(b[11])}
+	return tx, sig, nil
+}
+
+// ParseSignature parses a 65-byte r||s||v signature in hex, with v as 0/1
+// or 27/28.
+func ParseSignature(hexSig string) (Signature, error) {
+	b, err := DecodeHex(strings.TrimSpace(hexSig))
+	if err != nil || len(b) != 65 {
+		return Signature{}, fmt.Errorf("invalid signature %q", hexSig)
+	}
+	v := b[64]
+	if v >= 27 {
+		v -= 27
+	}
+	if v > 1 {
+		return Signature{}, fmt.Errorf("invalid signature parity %d", b[64])
+	}
+	return Signature{YParity: v, R: new(big.Int).SetBytes(b[:32]), S: new(big.Int).SetBytes(b[32:64])}, nil
+}
+
+// RecoverAddress returns the address that produced sig over hash.
+func RecoverAddress(hash []byte, sig Signature) (Address, error) {
+	var addr Address
+	if sig.R == nil || sig.S == nil || sig.R.BitLen() > 256 || sig.S.BitLen() > 256 {
+		return addr, fmt.Errorf("invalid signature")
+	}
+	compact := make([]byte, 65)
+	compact[0] = 27 + sig.YParity
+	sig.R.FillBytes(compact[1:33])
+	sig.S.FillBytes(compact[33:65])
+	pub, _, err := ecdsa.RecoverCompact(compact, hash)
+	if err != nil {
+		return addr, fmt.Errorf("recover signer: %w", err)
+	}
+	return PubkeyToAddress(pub), nil
+}
+
+// PubkeyToAddress derives the account address of a secp256k1 public key.
+func PubkeyToAddress(pub *secp256k1.PublicKey) Address {
+	var addr Address
+	copy(addr[:], Keccak256(pub.SerializeUncompressed()[1:])[12:])
+	return addr
+}
+
+// Sender recovers the address that signed the transaction.
+func (tx *Tx) Sender(sig Signature) (Address, error) {
+	return RecoverAddress(tx.SigningHash(), sig)
+}
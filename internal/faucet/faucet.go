@@ -0,0 +1,385 @@
+// Package faucet dispenses small amounts of a chain's native currency from a
+// server vault key, with per-address and per-IP rate limits, an optional
+// captcha, a persisted dispense history, and low-balance alerts.
+package faucet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/primal-host/wallet/internal/asset"
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+	"github.com/primal-host/wallet/internal/journal"
+	"github.com/primal-host/wallet/internal/signer"
+	"github.com/primal-host/wallet/internal/txbuild"
+	"github.com/primal-host/wallet/internal/vault"
+)
+
+const (
+	historyLimit  = 50 // dispenses returned by Status
+	watchInterval = time.Minute
+	turnstileURL  = "https://challenges.cloudflare.com/turnstile/v0/siteverify"
+)
+
+// Config configures the faucet. Amounts are in whole native units ("0.1").
+type Config struct {
+	Endpoint         string        // endpoint ID to send through
+	Address          string        // server vault key that funds the faucet
+	Amount           string        // per dispense
+	Interval         time.Duration // minimum time between dispenses per address and per IP
+	LowBalance       string        // alert when the faucet balance drops below this
+	TurnstileSiteKey string        // optional Cloudflare Turnstile captcha
+	TurnstileSecret  string
+	AlertWebhook     string // optional URL that receives low-balance alerts as JSON
+	HistoryFile      string
+}
+
+// Dispense is one completed faucet payout.
+type Dispense struct {
+	Address   string    `json:"address"`
+	IP        string    `json:"ip,omitempty"`
+	Amount    string    `json:"amount"` // wei
+	TxHash    string    `json:"tx_hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Status is the faucet state shown to operators.
+type Status struct {
+	Endpoint   string     `json:"endpoint"`
+	Address    string     `json:"address"`
+	Symbol     string     `json:"symbol"`
+	Amount     string     `json:"amount"`
+	Interval   string     `json:"interval"`
+	Balance    string     `json:"balance,omitempty"`
+	LowBalance bool       `json:"low_balance"`
+	Dispensed  int        `json:"dispensed"`
+	History    []Dispense `json:"history"`
+}
+
+// RateLimitError is returned when a requester must wait before the next dispense.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limited: try again in %s", e.RetryAfter.Round(time.Minute))
+}
+
+// Faucet dispenses funds and records each payout.
+type Faucet struct {
+	cfg       Config
+	amount    *big.Int
+	threshold *big.Int
+	endpoints *endpoint.Store
+	vault     *vault.Vault
+	journal   *journal.Store // records each payout as a send intent
+
+	mu      sync.Mutex // serializes dispenses so nonces don't collide
+	history []Dispense
+	balance *big.Int
+	low     bool
+}
+
+// New validates cfg and loads the dispense history. Payouts are sent
+// through j.
+func New(cfg Config, endpoints *endpoint.Store, v *vault.Vault, j *journal.Store) (*Faucet, error) {
+	if _, err := evm.ParseAddress(cfg.Address); err != nil {
+		return nil, fmt.Errorf("faucet address: %w", err)
+	}
+	ep, ok := endpoints.Get(cfg.Endpoint)
+	if !ok {
+		return nil, fmt.Errorf("faucet endpoint %q not found", cfg.Endpoint)
+	}
+	amount, err := evm.ParseUnits(cfg.Amount, ep.Native.Decimals)
+	if err != nil || amount.Sign() == 0 {
+		return nil, fmt.Errorf("faucet amount %q is invalid", cfg.Amount)
+	}
+	threshold := new(big.Int)
+	if cfg.LowBalance != "" {
+		if threshold, err = evm.ParseUnits(cfg.LowBalance, ep.Native.Decimals); err != nil {
+			return nil, fmt.Errorf("faucet low balance: %w", err)
+		}
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 24 * time.Hour
+	}
+
+	f := &Faucet{cfg: cfg, amount: amount, threshold: threshold, endpoints: endpoints, vault: v, journal: j}
+	data, err := os.ReadFile(cfg.HistoryFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read faucet history: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &f.history); err != nil {
+			return nil, fmt.Errorf("parse faucet history: %w", err)
+		}
+	}
+	return f, nil
+}
+
+// SiteKey is the public captcha site key, or "" when no captcha is configured.
+func (f *Faucet) SiteKey() string {
+	return f.cfg.TurnstileSiteKey
+}
+
+// native is the faucet endpoint's native currency.
+func (f *Faucet) native() asset.Asset {
+	ep, _ := f.endpoints.Get(f.cfg.Endpoint)
+	return ep.Native
+}
+
+// Symbol is the native currency symbol of the faucet endpoint.
+func (f *Faucet) Symbol() string {
+	return f.native().Symbol
+}
+
+// AmountDisplay is the per-dispense amount in whole units.
+func (f *Faucet) AmountDisplay() string {
+	return evm.FormatUnits(f.amount, f.native().Decimals)
+}
+
+// Drip verifies the captcha token, enforces rate limits, and sends the
+// configured amount to address.
+func (f *Faucet) Drip(ctx context.Context, address, ip, captchaToken string) (Dispense, error) {
+	to, err := evm.ParseAddress(strings.TrimSpace(address))
+	if err != nil {
+		return Dispense{}, err
+	}
+	if strings.EqualFold(to.Hex(), f.cfg.Address) {
+		return Dispense{}, fmt.Errorf("cannot send to the faucet itself")
+	}
+	if f.cfg.TurnstileSecret != "" {
+		if err := verifyTurnstile(ctx, f.cfg.TurnstileSecret, captchaToken, ip); err != nil {
+			return Dispense{}, err
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if wait := f.waitLocked(to.Hex(), ip); wait > 0 {
+		return Dispense{}, &RateLimitError{RetryAfter: wait}
+	}
+
+	ep, ok := f.endpoints.Get(f.cfg.Endpoint)
+	if !ok {
+		return Dispense{}, fmt.Errorf("faucet endpoint %q not found", f.cfg.Endpoint)
+	}
+	env, err := txbuild.Build(ctx, ep, txbuild.Request{
+		Endpoint: ep.ID,
+		From:     f.cfg.Address,
+		To:       to.Hex(),
+		Value:    f.amount.String(),
+	})
+	if err != nil {
+		return Dispense{}, err
+	}
+	tx, err := env.Transaction()
+	if err != nil {
+		return Dispense{}, err
+	}
+	signed, err := f.journal.Send(ctx, ep, env, "faucet", func() (*txbuild.Signed, error) {
+		sig, err := f.vault.SignTx(ctx, signer.Account{Address: f.cfg.Address}, tx)
+		if err != nil {
+			return nil, err
+		}
+		return txbuild.Import(env, "", &sig)
+	})
+	if err != nil {
+		return Dispense{}, err
+	}
+
+	d := Dispense{Address: to.Hex(), IP: ip, Amount: f.amount.String(), TxHash: signed.Hash, CreatedAt: time.Now().UTC()}
+	f.history = append(f.history, d)
+	if err := f.saveLocked(); err != nil {
+		// The funds are already sent; keep the in-memory record for rate limiting.
+		slog.Error("faucet history save failed", "subsystem", "faucet", "error", err)
+	}
+	slog.Info("faucet dispensed", "subsystem", "faucet", "to", d.Address, "ip", ip, "tx", d.TxHash)
+	return d, nil
+}
+
+// waitLocked returns how long address or ip must still wait. Must be called with mu held.
+func (f *Faucet) waitLocked(address, ip string) time.Duration {
+	cutoff := time.Now().Add(-f.cfg.Interval)
+	var wait time.Duration
+	for i := len(f.history) - 1; i >= 0; i-- {
+		d := f.history[i]
+		if d.CreatedAt.Before(cutoff) {
+			break
+		}
+		if d.Address == address || (ip != "" && sameClient(d.IP, ip)) {
+			if w := d.CreatedAt.Sub(cutoff); w > wait {
+				wait = w
+			}
+		}
+	}
+	return wait
+}
+
+// sameClient reports whether two IPs count as one client for the per-IP
+// limit. IPv6 clients are handed a whole /64, so every address in it
+// counts as the same client.
+func sameClient(a, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		return a == b
+	}
+	if ipA.To4() != nil || ipB.To4() != nil {
+		return ipA.Equal(ipB)
+	}
+	mask := net.CIDRMask(64, 128)
+	return ipA.Mask(mask).Equal(ipB.Mask(mask))
+}
+
+// Status returns the faucet configuration, last known balance, and recent dispenses.
+func (f *Faucet) Status() Status {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	native := f.native()
+	st := Status{
+		Endpoint:   f.cfg.Endpoint,
+		Address:    f.cfg.Address,
+		Symbol:     native.Symbol,
+		Amount:     evm.FormatUnits(f.amount, native.Decimals),
+		Interval:   f.cfg.Interval.String(),
+		LowBalance: f.low,
+		Dispensed:  len(f.history),
+		History:    []Dispense{},
+	}
+	if f.balance != nil {
+		st.Balance = evm.FormatUnits(f.balance, native.Decimals)
+	}
+	for i := len(f.history) - 1; i >= 0 && len(st.History) < historyLimit; i-- {
+		st.History = append(st.History, f.history[i])
+	}
+	return st
+}
+
+// Watch checks the faucet balance every minute until ctx is done, alerting
+// once each time it drops below the low-balance threshold.
+func (f *Faucet) Watch(ctx context.Context) {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		f.checkBalance(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (f *Faucet) checkBalance(ctx context.Context) {
+	ep, ok := f.endpoints.Get(f.cfg.Endpoint)
+	if !ok {
+		return
+	}
+	result, err := endpoint.RPCCall(ctx, ep, "eth_getBalance", []any{f.cfg.Address, "latest"})
+	if err != nil {
+		slog.Warn("faucet balance check failed", "subsystem", "faucet", "error", err)
+		return
+	}
+	var hex string
+	if err := json.Unmarshal(result, &hex); err != nil {
+		return
+	}
+	bal, err := evm.ParseQuantity(hex)
+	if err != nil {
+		return
+	}
+
+	f.mu.Lock()
+	f.balance = bal
+	wasLow := f.low
+	f.low = bal.Cmp(f.threshold) < 0 || bal.Cmp(f.amount) < 0
+	nowLow := f.low
+	f.mu.Unlock()
+
+	if nowLow && !wasLow {
+		f.alert(ctx, bal)
+	}
+}
+
+func (f *Faucet) alert(ctx context.Context, bal *big.Int) {
+	balance := f.native().Format(bal)
+	slog.Warn("faucet balance low", "subsystem", "faucet", "address", f.cfg.Address, "balance", balance)
+	if f.cfg.AlertWebhook == "" {
+		return
+	}
+	body, _ := json.Marshal(map[string]string{
+		"text":    fmt.Sprintf("Faucet %s balance is low: %s", f.cfg.Address, balance),
+		"address": f.cfg.Address,
+		"balance": balance,
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.cfg.AlertWebhook, bytes.NewReader(body))
+	if err != nil {
+		slog.Error("faucet alert failed", "subsystem", "faucet", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		slog.Error("faucet alert failed", "subsystem", "faucet", "error", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// saveLocked writes the history file. Must be called with mu held.
+func (f *Faucet) saveLocked() error {
+	data, err := json.MarshalIndent(f.history, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal faucet history: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(f.cfg.HistoryFile, data, 0644); err != nil {
+		return fmt.Errorf("write faucet history: %w", err)
+	}
+	return nil
+}
+
+// verifyTurnstile checks a Cloudflare Turnstile token.
+func verifyTurnstile(ctx context.Context, secret, token, ip string) error {
+	if token == "" {
+		return fmt.Errorf("captcha required")
+	}
+	form := url.Values{"secret": {secret}, "response": {token}}
+	if ip != "" {
+		form.Set("remoteip", ip)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, turnstileURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("captcha verification failed: %w", err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("captcha verification failed: %w", err)
+	}
+	if !result.Success {
+		return fmt.Errorf("captcha failed")
+	}
+	return nil
+}
@@ -0,0 +1,373 @@
+// Package graphql is a small, dependency-free GraphQL executor for read-only
+// APIs. It parses query documents (aliases, arguments, variables, and named
+// and inline fragments) and resolves them against a schema of Go resolver
+// functions. Mutations, subscriptions, directives, and introspection are not
+// supported.
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Schema maps type names to objects. Query names the root type. Any type
+// name that isn't an object is a scalar and is passed through to JSON as is.
+type Schema struct {
+	Query string
+	Types map[string]Object
+}
+
+// Object is a GraphQL object type: its fields by name.
+type Object map[string]Field
+
+// Field describes one field of an object.
+type Field struct {
+	// Type is the GraphQL type, e.g. "String", "[Endpoint]", or "ID!".
+	Type string
+	// Args maps argument names to types. A trailing "!" makes it required.
+	Args map[string]string
+	// Resolve computes the value. When nil, the value is read from the
+	// parent: the map key or the struct field whose json tag matches the
+	// field name. A list element that is an error becomes null and is
+	// reported at its own path.
+	Resolve func(ctx context.Context, p Params) (any, error)
+}
+
+// Params is what a resolver receives.
+type Params struct {
+	Source any            // parent value
+	Args   map[string]any // argument values with variables substituted
+}
+
+// String returns a string argument, or "" when absent.
+func (p Params) String(name string) string {
+	s, _ := p.Args[name].(string)
+	return s
+}
+
+// Strings returns a list-of-strings argument.
+func (p Params) Strings(name string) []string {
+	list, _ := p.Args[name].([]any)
+	out := make([]string, 0, len(list))
+	for _, v := range list {
+		if s, ok := v.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Request is a GraphQL-over-HTTP request body.
+type Request struct {
+	Query         string         `json:"query"`
+	Variables     map[string]any `json:"variables,omitempty"`
+	OperationName string         `json:"operationName,omitempty"`
+}
+
+// Response is a GraphQL result. Data is absent when the request itself was
+// invalid and null fields carry an entry in Errors.
+type Response struct {
+	Data   any     `json:"data,omitempty"`
+	Errors []Error `json:"errors,omitempty"`
+}
+
+// Error is a GraphQL error, with the response path for field errors.
+type Error struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+// Execute parses, validates, and runs req against the schema. Sibling
+// elements of a list are resolved concurrently, so per-item lookups such as
+// balances fan out instead of running one after another.
+func (s *Schema) Execute(ctx context.Context, req Request) Response {
+	doc, err := parse(req.Query)
+	if err != nil {
+		return Response{Errors: []Error{{Message: err.Error()}}}
+	}
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		return Response{Errors: []Error{{Message: err.Error()}}}
+	}
+	vars, err := op.variables(req.Variables)
+	if err != nil {
+		return Response{Errors: []Error{{Message: err.Error()}}}
+	}
+	if err := s.validate(s.Query, op.fields); err != nil {
+		return Response{Errors: []Error{{Message: err.Error()}}}
+	}
+
+	ex := &executor{schema: s, vars: vars}
+	data := ex.object(ctx, s.Query, nil, op.fields, nil)
+	return Response{Data: data, Errors: ex.errors}
+}
+
+func (d *document) operation(name string) (*operation, error) {
+	if name == "" {
+		if len(d.ops) > 1 {
+			return nil, fmt.Errorf("operationName is required when the document has several operations")
+		}
+		return d.ops[0], nil
+	}
+	for _, op := range d.ops {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %q", name)
+}
+
+// variables applies defaults and checks required variables are provided.
+func (op *operation) variables(in map[string]any) (map[string]any, error) {
+	out := map[string]any{}
+	for _, def := range op.vars {
+		v, ok := in[def.name]
+		switch {
+		case ok:
+			out[def.name] = v
+		case def.hasValue:
+			out[def.name] = def.def
+		case strings.HasSuffix(def.typ, "!"):
+			return nil, fmt.Errorf("variable $%s of type %s is required", def.name, def.typ)
+		}
+	}
+	return out, nil
+}
+
+// validate checks every selected field exists, that objects have a
+// selection and scalars don't, and that arguments are known and required
+// ones present.
+func (s *Schema) validate(typ string, fields []*field) error {
+	obj := s.Types[typ]
+	for _, f := range fields {
+		if f.name == "__typename" {
+			if len(f.fields) > 0 {
+				return fmt.Errorf("field __typename must not have a selection")
+			}
+			continue
+		}
+		def, ok := obj[f.name]
+		if !ok {
+			return fmt.Errorf("cannot query field %q on type %s", f.name, typ)
+		}
+		for arg := range f.args {
+			if _, ok := def.Args[arg]; !ok {
+				return fmt.Errorf("unknown argument %q on field %s.%s", arg, typ, f.name)
+			}
+		}
+		for arg, argType := range def.Args {
+			if _, ok := f.args[arg]; !ok && strings.HasSuffix(argType, "!") {
+				return fmt.Errorf("field %s.%s requires argument %q", typ, f.name, arg)
+			}
+		}
+		named := namedType(def.Type)
+		if _, isObject := s.Types[named]; isObject {
+			if len(f.fields) == 0 {
+				return fmt.Errorf("field %s.%s of type %s must have a selection", typ, f.name, def.Type)
+			}
+			if err := s.validate(named, f.fields); err != nil {
+				return err
+			}
+		} else if len(f.fields) > 0 {
+			return fmt.Errorf("field %s.%s of scalar type %s must not have a selection", typ, f.name, def.Type)
+		}
+	}
+	return nil
+}
+
+// namedType strips list and non-null wrappers: "[Endpoint!]!" -> "Endpoint".
+func namedType(t string) string {
+	return strings.Trim(t, "[]!")
+}
+
+type executor struct {
+	schema *Schema
+	vars   map[string]any
+
+	mu     sync.Mutex
+	errors []Error
+}
+
+func (ex *executor) fail(path []any, err error) {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	ex.errors = append(ex.errors, Error{Message: err.Error(), Path: append([]any(nil), path...)})
+}
+
+// object resolves fields against src as an instance of typ.
+func (ex *executor) object(ctx context.Context, typ string, src any, fields []*field, path []any) *orderedMap {
+	out := &orderedMap{}
+	obj := ex.schema.Types[typ]
+	for _, f := range fields {
+		fieldPath := append(path[:len(path):len(path)], f.alias)
+		if f.name == "__typename" {
+			out.set(f.alias, typ)
+			continue
+		}
+		def := obj[f.name]
+		p := Params{Source: src, Args: ex.args(f.args)}
+		var v any
+		var err error
+		if def.Resolve != nil {
+			v, err = def.Resolve(ctx, p)
+		} else {
+			v = defaultResolve(src, f.name)
+		}
+		if err != nil {
+			ex.fail(fieldPath, err)
+			out.set(f.alias, nil)
+			continue
+		}
+		out.set(f.alias, ex.value(ctx, def.Type, v, f.fields, fieldPath))
+	}
+	return out
+}
+
+// value completes a resolved value according to its declared type.
+func (ex *executor) value(ctx context.Context, typ string, v any, fields []*field, path []any) any {
+	typ = strings.TrimSuffix(typ, "!")
+	if isNil(v) {
+		return nil
+	}
+	if err, ok := v.(error); ok {
+		ex.fail(path, err)
+		return nil
+	}
+	if strings.HasPrefix(typ, "[") {
+		elem := typ[1 : len(typ)-1]
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			ex.fail(path, fmt.Errorf("expected a list, got %T", v))
+			return nil
+		}
+		out := make([]any, rv.Len())
+		var wg sync.WaitGroup
+		for i := range out {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				out[i] = ex.value(ctx, elem, rv.Index(i).Interface(), fields, append(path[:len(path):len(path)], i))
+			}(i)
+		}
+		wg.Wait()
+		return out
+	}
+	if _, isObject := ex.schema.Types[typ]; isObject {
+		return ex.object(ctx, typ, v, fields, path)
+	}
+	return v
+}
+
+// args substitutes variables into argument values.
+func (ex *executor) args(in map[string]any) map[string]any {
+	out := make(map[string]any, len(in))
+	for k, v := range in {
+		out[k] = ex.substitute(v)
+	}
+	return out
+}
+
+func (ex *executor) substitute(v any) any {
+	switch v := v.(type) {
+	case variable:
+		return ex.vars[string(v)]
+	case enumValue:
+		return string(v)
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = ex.substitute(e)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, e := range v {
+			out[k] = ex.substitute(e)
+		}
+		return out
+	}
+	return v
+}
+
+// defaultResolve reads name from a map or from the struct field tagged
+// `json:"name"`.
+func defaultResolve(src any, name string) any {
+	rv := reflect.ValueOf(src)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		if e := rv.MapIndex(reflect.ValueOf(name)); e.IsValid() {
+			return e.Interface()
+		}
+	case reflect.Struct:
+		t := rv.Type()
+		for i := 0; i < t.NumField(); i++ {
+			tag, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+			if tag == name && t.Field(i).IsExported() {
+				return rv.Field(i).Interface()
+			}
+		}
+	}
+	return nil
+}
+
+func isNil(v any) bool {
+	if v == nil {
+		return true
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// orderedMap is a JSON object that keeps fields in query order, as GraphQL
+// requires.
+type orderedMap struct {
+	keys []string
+	vals map[string]any
+}
+
+func (m *orderedMap) set(k string, v any) {
+	if m.vals == nil {
+		m.vals = map[string]any{}
+	}
+	if _, ok := m.vals[k]; !ok {
+		m.keys = append(m.keys, k)
+	}
+	m.vals[k] = v
+}
+
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(k)
+		buf.Write(key)
+		buf.WriteByte(':')
+		val, err := json.Marshal(m.vals[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
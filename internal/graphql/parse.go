@@ -0,0 +1,558 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// field is one selected field after fragments have been inlined.
+type field struct {
+	alias  string // response key; equals name when not aliased
+	name   string
+	args   map[string]any // literal values, lists, objects, or variable refs
+	fields []*field
+}
+
+// variable is a $name reference inside an argument value.
+type variable string
+
+// enumValue is a bare name used as a value.
+type enumValue string
+
+type varDef struct {
+	name     string
+	typ      string
+	def      any
+	hasValue bool
+}
+
+type operation struct {
+	name   string
+	vars   []varDef
+	fields []*field
+}
+
+// document is a parsed query document.
+type document struct {
+	ops       []*operation
+	fragments map[string][]selection
+}
+
+// selection is either a *field or a fragment: a named spread or an inline
+// fragment. Fragments are inlined once the whole document is parsed.
+type selection struct {
+	field    *field
+	spread   string
+	inline   []selection
+	children []selection // field sub-selections before inlining
+}
+
+// ── Lexer ─────────────────────────────────────────────
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokPunct
+	tokName
+	tokInt
+	tokFloat
+	tokString
+)
+
+type token struct {
+	kind tokenKind
+	val  string
+	pos  int
+}
+
+func lex(src string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "..."):
+			toks = append(toks, token{tokPunct, "...", i})
+			i += 3
+		case strings.ContainsRune("!$():=@[]{}|", rune(c)):
+			toks = append(toks, token{tokPunct, string(c), i})
+			i++
+		case c == '_' || isLetter(c):
+			start := i
+			for i < len(src) && (src[i] == '_' || isLetter(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			toks = append(toks, token{tokName, src[start:i], start})
+		case c == '-' || isDigit(c):
+			start := i
+			kind := tokInt
+			i++
+			for i < len(src) && isDigit(src[i]) {
+				i++
+			}
+			if i < len(src) && src[i] == '.' {
+				kind = tokFloat
+				i++
+				for i < len(src) && isDigit(src[i]) {
+					i++
+				}
+			}
+			if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+				kind = tokFloat
+				i++
+				if i < len(src) && (src[i] == '+' || src[i] == '-') {
+					i++
+				}
+				for i < len(src) && isDigit(src[i]) {
+					i++
+				}
+			}
+			toks = append(toks, token{kind, src[start:i], start})
+		case c == '"':
+			s, n, err := lexString(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("syntax error at %d: %w", i, err)
+			}
+			toks = append(toks, token{tokString, s, i})
+			i += n
+		default:
+			return nil, fmt.Errorf("syntax error at %d: unexpected character %q", i, c)
+		}
+	}
+	return append(toks, token{tokEOF, "", len(src)}), nil
+}
+
+// lexString reads a quoted string (or a """block string""") at the start of
+// s, returning its value and the number of bytes consumed.
+func lexString(s string) (string, int, error) {
+	if strings.HasPrefix(s, `"""`) {
+		end := strings.Index(s[3:], `"""`)
+		if end < 0 {
+			return "", 0, fmt.Errorf("unterminated block string")
+		}
+		return strings.TrimSpace(s[3 : 3+end]), end + 6, nil
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '\n':
+			return "", 0, fmt.Errorf("unterminated string")
+		case '"':
+			v, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid string %s", s[:i+1])
+			}
+			return v, i + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+func isLetter(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+func isDigit(c byte) bool  { return c >= '0' && c <= '9' }
+
+// ── Parser ────────────────────────────────────────────
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func parse(src string) (*document, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	doc := &document{fragments: map[string][]selection{}}
+	raw := map[*operation][]selection{}
+
+	for p.peek().kind != tokEOF {
+		switch t := p.peek(); {
+		case t.kind == tokPunct && t.val == "{":
+			sels, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			op := &operation{}
+			doc.ops = append(doc.ops, op)
+			raw[op] = sels
+		case t.kind == tokName && t.val == "query":
+			p.next()
+			op := &operation{}
+			if p.peek().kind == tokName {
+				op.name = p.next().val
+			}
+			if p.is("(") {
+				if op.vars, err = p.varDefs(); err != nil {
+					return nil, err
+				}
+			}
+			sels, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.ops = append(doc.ops, op)
+			raw[op] = sels
+		case t.kind == tokName && (t.val == "mutation" || t.val == "subscription"):
+			return nil, fmt.Errorf("%s operations are not supported", t.val)
+		case t.kind == tokName && t.val == "fragment":
+			p.next()
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.keyword("on"); err != nil {
+				return nil, err
+			}
+			if _, err := p.name(); err != nil {
+				return nil, err
+			}
+			sels, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			if _, dup := doc.fragments[name]; dup {
+				return nil, fmt.Errorf("fragment %q defined twice", name)
+			}
+			doc.fragments[name] = sels
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.ops) == 0 {
+		return nil, fmt.Errorf("document has no operations")
+	}
+	for op, sels := range raw {
+		if op.fields, err = doc.inline(sels, nil); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// inline flattens fragments into fields, merging fields that share a
+// response key. seen guards against fragment cycles.
+func (d *document) inline(sels []selection, seen []string) ([]*field, error) {
+	var out []*field
+	byKey := map[string]*field{}
+	add := func(f *field) {
+		if prev, ok := byKey[f.alias]; ok {
+			prev.fields = append(prev.fields, f.fields...)
+			return
+		}
+		byKey[f.alias] = f
+		out = append(out, f)
+	}
+	for _, sel := range sels {
+		switch {
+		case sel.field != nil:
+			f := *sel.field
+			children, err := d.inline(sel.children, seen)
+			if err != nil {
+				return nil, err
+			}
+			f.fields = children
+			add(&f)
+		case sel.spread != "":
+			for _, s := range seen {
+				if s == sel.spread {
+					return nil, fmt.Errorf("fragment %q spreads itself", s)
+				}
+			}
+			frag, ok := d.fragments[sel.spread]
+			if !ok {
+				return nil, fmt.Errorf("unknown fragment %q", sel.spread)
+			}
+			fields, err := d.inline(frag, append(seen, sel.spread))
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range fields {
+				add(f)
+			}
+		default:
+			fields, err := d.inline(sel.inline, seen)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range fields {
+				add(f)
+			}
+		}
+	}
+	return out, nil
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) is(punct string) bool {
+	t := p.peek()
+	return t.kind == tokPunct && t.val == punct
+}
+
+func (p *parser) expect(punct string) error {
+	if !p.is(punct) {
+		return p.unexpected()
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) keyword(kw string) error {
+	if t := p.peek(); t.kind != tokName || t.val != kw {
+		return p.unexpected()
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) name() (string, error) {
+	if p.peek().kind != tokName {
+		return "", p.unexpected()
+	}
+	return p.next().val, nil
+}
+
+func (p *parser) unexpected() error {
+	t := p.peek()
+	if t.kind == tokEOF {
+		return fmt.Errorf("syntax error: unexpected end of document")
+	}
+	return fmt.Errorf("syntax error at %d: unexpected %q", t.pos, t.val)
+}
+
+func (p *parser) varDefs() ([]varDef, error) {
+	p.next() // (
+	var defs []varDef
+	for !p.is(")") {
+		if err := p.expect("$"); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		typ, err := p.typeRef()
+		if err != nil {
+			return nil, err
+		}
+		def := varDef{name: name, typ: typ}
+		if p.is("=") {
+			p.next()
+			if def.def, err = p.value(true); err != nil {
+				return nil, err
+			}
+			def.hasValue = true
+		}
+		defs = append(defs, def)
+	}
+	p.next() // )
+	return defs, nil
+}
+
+func (p *parser) typeRef() (string, error) {
+	var typ string
+	if p.is("[") {
+		p.next()
+		inner, err := p.typeRef()
+		if err != nil {
+			return "", err
+		}
+		if err := p.expect("]"); err != nil {
+			return "", err
+		}
+		typ = "[" + inner + "]"
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		typ = name
+	}
+	if p.is("!") {
+		p.next()
+		typ += "!"
+	}
+	return typ, nil
+}
+
+func (p *parser) selectionSet() ([]selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var sels []selection
+	for !p.is("}") {
+		if p.peek().kind == tokEOF {
+			return nil, p.unexpected()
+		}
+		if p.is("@") {
+			return nil, fmt.Errorf("directives are not supported")
+		}
+		if p.is("...") {
+			p.next()
+			if t := p.peek(); t.kind == tokName && t.val != "on" {
+				sels = append(sels, selection{spread: p.next().val})
+				continue
+			}
+			if t := p.peek(); t.kind == tokName && t.val == "on" {
+				p.next()
+				if _, err := p.name(); err != nil {
+					return nil, err
+				}
+			}
+			inner, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			sels = append(sels, selection{inline: inner})
+			continue
+		}
+		sel, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, sel)
+	}
+	p.next() // }
+	if len(sels) == 0 {
+		return nil, fmt.Errorf("syntax error: empty selection set")
+	}
+	return sels, nil
+}
+
+func (p *parser) field() (selection, error) {
+	name, err := p.name()
+	if err != nil {
+		return selection{}, err
+	}
+	f := &field{alias: name, name: name}
+	if p.is(":") {
+		p.next()
+		if f.name, err = p.name(); err != nil {
+			return selection{}, err
+		}
+	}
+	if p.is("(") {
+		p.next()
+		f.args = map[string]any{}
+		for !p.is(")") {
+			arg, err := p.name()
+			if err != nil {
+				return selection{}, err
+			}
+			if err := p.expect(":"); err != nil {
+				return selection{}, err
+			}
+			if f.args[arg], err = p.value(false); err != nil {
+				return selection{}, err
+			}
+		}
+		p.next() // )
+	}
+	if p.is("@") {
+		return selection{}, fmt.Errorf("directives are not supported")
+	}
+	sel := selection{field: f}
+	if p.is("{") {
+		if sel.children, err = p.selectionSet(); err != nil {
+			return selection{}, err
+		}
+	}
+	return sel, nil
+}
+
+// value parses an argument or default value. Defaults must be constant.
+func (p *parser) value(constant bool) (any, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokPunct && t.val == "$" && !constant:
+		p.next()
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		return variable(name), nil
+	case t.kind == tokPunct && t.val == "[":
+		p.next()
+		list := []any{}
+		for !p.is("]") {
+			if p.peek().kind == tokEOF {
+				return nil, p.unexpected()
+			}
+			v, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		p.next()
+		return list, nil
+	case t.kind == tokPunct && t.val == "{":
+		p.next()
+		obj := map[string]any{}
+		for !p.is("}") {
+			key, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if obj[key], err = p.value(constant); err != nil {
+				return nil, err
+			}
+		}
+		p.next()
+		return obj, nil
+	case t.kind == tokInt:
+		p.next()
+		n, err := strconv.ParseInt(t.val, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid int %s", t.val)
+		}
+		return n, nil
+	case t.kind == tokFloat:
+		p.next()
+		f, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float %s", t.val)
+		}
+		return f, nil
+	case t.kind == tokString:
+		p.next()
+		return t.val, nil
+	case t.kind == tokName:
+		p.next()
+		switch t.val {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return enumValue(t.val), nil
+	}
+	return nil, p.unexpected()
+}
@@ -0,0 +1,243 @@
+// Package icon fetches chain, asset, and token icons once and serves them
+// from a local cache, so browsers never ask a third-party CDN for them and
+// don't reveal which tokens their user holds.
+package icon
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/primal-host/wallet/internal/asset"
+	"github.com/primal-host/wallet/internal/atomicfile"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// ErrNotFound is returned when no source has an icon.
+var ErrNotFound = errors.New("icon not found")
+
+const (
+	// trustWallet serves logos from the Trust Wallet assets repository.
+	trustWallet = "https://raw.githubusercontent.com/trustwallet/assets/master/blockchains/"
+
+	maxIconSize      = 512 << 10
+	maxTokenListSize = 16 << 20
+
+	// missTTL is how long a failed lookup is remembered before the
+	// sources are asked again.
+	missTTL = 24 * time.Hour
+)
+
+// chains maps chain IDs to their directory in the Trust Wallet repository.
+var chains = map[uint64]string{
+	1:      "ethereum",
+	10:     "optimism",
+	56:     "smartchain",
+	100:    "xdai",
+	137:    "polygon",
+	250:    "fantom",
+	324:    "zksync",
+	8453:   "base",
+	42161:  "arbitrum",
+	42220:  "celo",
+	43114:  "avalanchec",
+	59144:  "linea",
+	534352: "scroll",
+}
+
+// nativeChains maps the built-in assets to the chain whose logo they use.
+var nativeChains = map[string]uint64{
+	"eth":  1,
+	"avax": 43114,
+	"bnb":  56,
+	"pol":  137,
+}
+
+// Icon is a cached image.
+type Icon struct {
+	Data        []byte
+	ContentType string
+}
+
+// Cache keeps icons in a directory. Misses are cached too, for a day.
+type Cache struct {
+	dir          string
+	tokenListURL string // optional Uniswap-style token list
+	client       *http.Client
+
+	mu     sync.Mutex
+	logos  map[string]string // "chainID:lowercase address" -> logoURI
+	listed bool              // the token list has been loaded
+}
+
+// New returns a cache in dir, creating it. tokenListURL, if set, is a token
+// list consulted for token logos before the Trust Wallet repository. It is
+// fetched once and kept in dir; delete tokenlist.json to fetch it again.
+func New(dir, tokenListURL string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create icons dir: %w", err)
+	}
+	return &Cache{dir: dir, tokenListURL: tokenListURL, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+// Chain returns the logo of a chain.
+func (c *Cache) Chain(ctx context.Context, chainID uint64) (Icon, error) {
+	dir, ok := chains[chainID]
+	if !ok {
+		return Icon{}, ErrNotFound
+	}
+	return c.fetch(ctx, fmt.Sprintf("chain:%d", chainID), trustWallet+dir+"/info/logo.png")
+}
+
+// Asset returns an asset's icon: its icon URL if it has one, or else the
+// logo of the chain it is native to.
+func (c *Cache) Asset(ctx context.Context, a asset.Asset) (Icon, error) {
+	if a.Icon != "" {
+		return c.fetch(ctx, "url:"+a.Icon, a.Icon)
+	}
+	if chainID, ok := nativeChains[a.ID]; ok {
+		return c.Chain(ctx, chainID)
+	}
+	return Icon{}, ErrNotFound
+}
+
+// Token returns the logo of the token contract at address on a chain, from
+// the token list if one is configured, or else the Trust Wallet repository.
+func (c *Cache) Token(ctx context.Context, chainID uint64, address evm.Address) (Icon, error) {
+	if logo := c.listLogo(ctx, chainID, address); logo != "" {
+		if icon, err := c.fetch(ctx, "url:"+logo, logo); err == nil {
+			return icon, nil
+		}
+	}
+	dir, ok := chains[chainID]
+	if !ok {
+		return Icon{}, ErrNotFound
+	}
+	return c.fetch(ctx, fmt.Sprintf("token:%d:%s", chainID, address.Hex()), trustWallet+dir+"/assets/"+address.Hex()+"/logo.png")
+}
+
+// fetch returns the icon cached under key, downloading it from url on a
+// miss.
+func (c *Cache) fetch(ctx context.Context, key, url string) (Icon, error) {
+	sum := sha256.Sum256([]byte(key))
+	path := filepath.Join(c.dir, hex.EncodeToString(sum[:16]))
+	if data, err := os.ReadFile(path); err == nil {
+		return Icon{Data: data, ContentType: http.DetectContentType(data)}, nil
+	}
+	if info, err := os.Stat(path + ".miss"); err == nil && time.Since(info.ModTime()) < missTTL {
+		return Icon{}, ErrNotFound
+	}
+	data, err := c.get(ctx, url, maxIconSize)
+	if err == nil && !isImage(http.DetectContentType(data)) {
+		err = fmt.Errorf("%s isn't a PNG, JPEG, GIF, or WebP image", url)
+	}
+	if err != nil {
+		// Remember the miss so every page load doesn't ask again, unless
+		// the browser just went away.
+		if ctx.Err() == nil {
+			_ = os.WriteFile(path+".miss", []byte(err.Error()+"\n"), 0644)
+		}
+		return Icon{}, ErrNotFound
+	}
+	if err := atomicfile.Write(path, data); err != nil {
+		return Icon{}, fmt.Errorf("write icon: %w", err)
+	}
+	return Icon{Data: data, ContentType: http.DetectContentType(data)}, nil
+}
+
+// isImage reports whether contentType is a raster format. SVG is refused:
+// served from the wallet's origin, its scripts would run there.
+func isImage(contentType string) bool {
+	switch contentType {
+	case "image/png", "image/jpeg", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+// listLogo looks a token up in the token list, loading the list first if
+// needed.
+func (c *Cache) listLogo(ctx context.Context, chainID uint64, address evm.Address) string {
+	if c.tokenListURL == "" {
+		return ""
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.listed {
+		// A list that can't be loaded isn't tried again until restart;
+		// the Trust Wallet repository still answers.
+		logos, err := c.loadTokenList(context.WithoutCancel(ctx))
+		if err != nil {
+			slog.Warn("token list unavailable", "subsystem", "icons", "url", c.tokenListURL, "error", err)
+		}
+		c.logos, c.listed = logos, true
+	}
+	return c.logos[fmt.Sprintf("%d:%s", chainID, strings.ToLower(address.Hex()))]
+}
+
+// loadTokenList reads the token list from dir, downloading it the first
+// time. Must be called with mu held.
+func (c *Cache) loadTokenList(ctx context.Context) (map[string]string, error) {
+	path := filepath.Join(c.dir, "tokenlist.json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if data, err = c.get(ctx, c.tokenListURL, maxTokenListSize); err != nil {
+			return nil, err
+		}
+		if err := atomicfile.Write(path, data); err != nil {
+			return nil, fmt.Errorf("write token list: %w", err)
+		}
+	}
+	var list struct {
+		Tokens []struct {
+			ChainID uint64 `json:"chainId"`
+			Address string `json:"address"`
+			LogoURI string `json:"logoURI"`
+		} `json:"tokens"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parse token list: %w", err)
+	}
+	logos := map[string]string{}
+	for _, t := range list.Tokens {
+		if strings.HasPrefix(t.LogoURI, "https://") {
+			logos[fmt.Sprintf("%d:%s", t.ChainID, strings.ToLower(t.Address))] = t.LogoURI
+		}
+	}
+	return logos, nil
+}
+
+// get downloads url, failing if the body is larger than limit.
+func (c *Cache) get(ctx context.Context, url string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: HTTP %d", url, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s is larger than %d bytes", url, limit)
+	}
+	return data, nil
+}
@@ -0,0 +1,140 @@
+// Package idempotency remembers the responses to requests that carried an
+// Idempotency-Key header, so an automation client retrying after a network
+// failure gets the original result instead of sending a second transaction.
+package idempotency
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Retention is how long a key and its result are kept.
+const Retention = 24 * time.Hour
+
+var (
+	// ErrInProgress means a request with the key is still running.
+	ErrInProgress = errors.New("a request with this Idempotency-Key is still in progress")
+	// ErrMismatch means the key was first used for a different request.
+	ErrMismatch = errors.New("Idempotency-Key was already used for a different request")
+)
+
+// Record is a finished request and the response it got.
+type Record struct {
+	Key         string          `json:"key"`
+	Principal   string          `json:"principal,omitempty"` // the user or API token that sent it; empty in single-user mode
+	Route       string          `json:"route"`               // "POST /api/broadcast"
+	RequestHash string          `json:"request_hash"`        // sha256 of the body, hex
+	Status      int             `json:"status"`
+	Body        json.RawMessage `json:"body"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// Store keeps records in a JSON file, dropping them after Retention.
+type Store struct {
+	mu       sync.Mutex
+	records  []Record
+	inflight map[slot]string // slot -> request hash
+	path     string
+}
+
+// slot is a key as one principal used it. Keys are chosen by clients, so
+// two users may pick the same one without sharing results.
+type slot struct{ principal, key string }
+
+// NewStore loads records from a JSON file. If the file doesn't exist, starts empty.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path, inflight: map[slot]string{}}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.records = []Record{}
+			return s, nil
+		}
+		return nil, fmt.Errorf("read idempotency keys: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.records); err != nil {
+		return nil, fmt.Errorf("parse idempotency keys: %w", err)
+	}
+	return s, nil
+}
+
+// Begin claims principal's key for a request. It returns the stored record
+// when the request already finished, ErrInProgress while it is running, and
+// ErrMismatch when the key belongs to a different route or body. A nil
+// record and error means the caller should run the request and then call
+// Finish or Release.
+func (s *Store) Begin(principal, key, route, requestHash string) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r := s.findLocked(principal, key); r != nil {
+		if r.Route != route || r.RequestHash != requestHash {
+			return nil, ErrMismatch
+		}
+		rec := *r
+		return &rec, nil
+	}
+	if h, ok := s.inflight[slot{principal, key}]; ok {
+		if h != requestHash {
+			return nil, ErrMismatch
+		}
+		return nil, ErrInProgress
+	}
+	s.inflight[slot{principal, key}] = requestHash
+	return nil, nil
+}
+
+// Finish stores the response for a key claimed with Begin. The record is
+// kept even when writing the file fails, so retries in this process still
+// get the stored response instead of running the request again; the error
+// only means the record won't survive a restart until a later write
+// succeeds.
+func (s *Store) Finish(rec Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.inflight, slot{rec.Principal, rec.Key})
+	rec.CreatedAt = time.Now().UTC()
+
+	cutoff := rec.CreatedAt.Add(-Retention)
+	kept := make([]Record, 0, len(s.records)+1)
+	for _, r := range s.records {
+		if r.CreatedAt.After(cutoff) {
+			kept = append(kept, r)
+		}
+	}
+	s.records = append(kept, rec)
+	return s.save()
+}
+
+// Release gives up a key claimed with Begin without storing a result, so
+// the request can be retried with the same key.
+func (s *Store) Release(principal, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.inflight, slot{principal, key})
+}
+
+func (s *Store) findLocked(principal, key string) *Record {
+	cutoff := time.Now().Add(-Retention)
+	for i := range s.records {
+		if s.records[i].Key == key && s.records[i].Principal == principal && s.records[i].CreatedAt.After(cutoff) {
+			return &s.records[i]
+		}
+	}
+	return nil
+}
+
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal idempotency keys: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("write idempotency keys: %w", err)
+	}
+	return nil
+}
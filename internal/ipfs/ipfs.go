@@ -0,0 +1,197 @@
+// Package ipfs fetches IPFS content through HTTP gateways and caches it on
+// disk. Content is addressed by its hash, so a cached copy never goes stale
+// and any gateway is as good as another for a given path.
+package ipfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/primal-host/wallet/internal/atomicfile"
+)
+
+// ErrNotFound is returned when no gateway has the content.
+var ErrNotFound = errors.New("ipfs content not found")
+
+const (
+	// fetchTimeout bounds one gateway's answer; a slow gateway is skipped
+	// for the next.
+	fetchTimeout = 20 * time.Second
+
+	// MaxSize is the largest object the cache keeps.
+	MaxSize = 10 << 20
+)
+
+// Content is a cached IPFS object.
+type Content struct {
+	Data        []byte
+	ContentType string
+}
+
+// Cache fetches IPFS paths through its gateways, in order, and keeps what
+// they return in a directory.
+type Cache struct {
+	dir      string
+	gateways []string // origins, e.g. https://ipfs.io
+	client   *http.Client
+
+	mu        sync.Mutex
+	preferred int // the gateway that answered last is tried first
+}
+
+// New returns a cache in dir, creating it.
+func New(dir string, gateways []string) (*Cache, error) {
+	if len(gateways) == 0 {
+		return nil, errors.New("no IPFS gateways")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create ipfs dir: %w", err)
+	}
+	return &Cache{dir: dir, gateways: gateways, client: &http.Client{Timeout: fetchTimeout}}, nil
+}
+
+// ParseGateways parses a space- or comma-separated list of gateway origins.
+func ParseGateways(s string) ([]string, error) {
+	var gateways []string
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' }) {
+		u, err := url.Parse(f)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || strings.Trim(u.Path, "/") != "" || u.RawQuery != "" || u.Fragment != "" {
+			return nil, fmt.Errorf("%q must be an http:// or https:// origin", f)
+		}
+		gateways = append(gateways, u.Scheme+"://"+u.Host)
+	}
+	return gateways, nil
+}
+
+// ParsePath checks an IPFS path, a CID optionally followed by a path within
+// it, and returns it cleaned.
+func ParsePath(p string) (string, error) {
+	segs := strings.Split(strings.Trim(p, "/"), "/")
+	cid := segs[0]
+	if len(cid) < 32 || len(cid) > 128 || strings.IndexFunc(cid, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9')
+	}) >= 0 {
+		return "", fmt.Errorf("%q is not a CID", cid)
+	}
+	for _, s := range segs[1:] {
+		if s == "" || s == "." || s == ".." {
+			return "", fmt.Errorf("invalid IPFS path %q", p)
+		}
+	}
+	return strings.Join(segs, "/"), nil
+}
+
+// PathOf returns the IPFS path a URI refers to: an ipfs:// URI, or a
+// gateway URL of the form https://<any host>/ipfs/<path>.
+func PathOf(uri string) (string, bool) {
+	var p string
+	if rest, ok := strings.CutPrefix(uri, "ipfs://"); ok {
+		p = strings.TrimPrefix(rest, "ipfs/")
+	} else if u, err := url.Parse(uri); err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.RawQuery == "" {
+		rest, ok := strings.CutPrefix(u.Path, "/ipfs/")
+		if !ok {
+			return "", false
+		}
+		p = rest
+	} else {
+		return "", false
+	}
+	p, err := ParsePath(p)
+	return p, err == nil
+}
+
+// Get returns the content at an IPFS path, from the cache or the first
+// gateway that has it.
+func (c *Cache) Get(ctx context.Context, p string) (Content, error) {
+	p, err := ParsePath(p)
+	if err != nil {
+		return Content{}, err
+	}
+	sum := sha256.Sum256([]byte(p))
+	path := filepath.Join(c.dir, hex.EncodeToString(sum[:16]))
+	if data, err := os.ReadFile(path); err == nil {
+		return Content{Data: data, ContentType: contentType(data)}, nil
+	}
+
+	c.mu.Lock()
+	first := c.preferred
+	c.mu.Unlock()
+	var lastErr error
+	failed := false // a gateway failed other than with a 404
+	for i := range c.gateways {
+		n := (first + i) % len(c.gateways)
+		data, err := c.fetch(ctx, c.gateways[n], p)
+		if err != nil {
+			if ctx.Err() != nil {
+				return Content{}, ctx.Err()
+			}
+			failed = failed || !errors.Is(err, ErrNotFound)
+			lastErr = err
+			continue
+		}
+		c.mu.Lock()
+		c.preferred = n
+		c.mu.Unlock()
+		if err := atomicfile.Write(path, data); err != nil {
+			return Content{}, fmt.Errorf("write ipfs cache: %w", err)
+		}
+		return Content{Data: data, ContentType: contentType(data)}, nil
+	}
+	if !failed {
+		return Content{}, ErrNotFound
+	}
+	return Content{}, lastErr
+}
+
+// fetch reads an IPFS path from one gateway.
+func (c *Cache) fetch(ctx context.Context, gateway, p string) ([]byte, error) {
+	segs := strings.Split(p, "/")
+	for i, s := range segs {
+		segs[i] = url.PathEscape(s)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gateway+"/ipfs/"+strings.Join(segs, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%s: HTTP %d", gateway, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", gateway, err)
+	}
+	if len(data) > MaxSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", p, MaxSize)
+	}
+	return data, nil
+}
+
+// contentType sniffs content, telling JSON, which token metadata is, from
+// other text. Gateways' own Content-Type headers are not kept.
+func contentType(data []byte) string {
+	ct := http.DetectContentType(data)
+	if strings.HasPrefix(ct, "text/plain") && json.Valid(data) {
+		return "application/json"
+	}
+	return ct
+}
@@ -0,0 +1,458 @@
+// Package journal is a write-ahead record of outgoing transactions. An intent
+// (endpoint, from, to, value, nonce) is written before a transaction is
+// signed and updated as it is signed and broadcast, so after a crash the
+// wallet can tell whether a send went out instead of leaving it to guesswork.
+package journal
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+	"github.com/primal-host/wallet/internal/txbuild"
+)
+
+// finishedLimit is how many resolved intents are kept. Unresolved
+// ones are always kept.
+const finishedLimit = 500
+
+// maxLogs bounds the receipt logs, and the internal transfers, kept with an
+// intent.
+const maxLogs = 100
+
+// ReceiptWindow is how long a sent intent is polled for its receipt. One
+// still unmined after that stays sent. Mined intents are polled until they
+// are confirmed.
+const ReceiptWindow = 24 * time.Hour
+
+// Intent stages.
+const (
+	StagePrepared = "prepared" // recorded, not signed yet
+	StageSigned   = "signed"   // signed; not known to be on the node yet
+	StageSent     = "sent"     // the node accepted it, or it was found on chain
+	StageFailed   = "failed"   // it did not go out; Error says why
+
+	StageMined     = "mined"     // mined, but not yet as deep as its endpoint's Confirmations
+	StageConfirmed = "confirmed" // mined deep enough and succeeded
+	StageReverted  = "reverted"  // mined deep enough and reverted
+)
+
+// Intent is one send, from before signing to its outcome.
+type Intent struct {
+	ID        string     `json:"id"`
+	Origin    string     `json:"origin"` // which path sent it, e.g. "vault_send", "schedule", "faucet"
+	Endpoint  string     `json:"endpoint"`
+	ChainID   string     `json:"chain_id"`
+	From      string     `json:"from"`
+	To        string     `json:"to,omitempty"` // empty for contract creation
+	Value     string     `json:"value"`        // hex wei
+	Nonce     string     `json:"nonce"`        // hex
+	Stage     string     `json:"stage"`
+	Hash      string     `json:"hash,omitempty"`
+	Raw       string     `json:"raw,omitempty"` // signed transaction, kept so a failed send can be rebroadcast
+	Error     string     `json:"error,omitempty"`
+	Block     string     `json:"block,omitempty"`      // hex block number once mined
+	BlockHash string     `json:"block_hash,omitempty"` // of Block, to tell when a reorg takes it away
+	Reorgs    int        `json:"reorgs,omitempty"`     // how many times a reorg took away the block it was mined in
+	Fee       string     `json:"fee,omitempty"`        // hex wei the sender paid once mined: gas used at its effective price, plus any L1 data fee
+	MinedAt   *time.Time `json:"mined_at,omitempty"`   // timestamp of Block
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+
+	// Logs are the event logs of the receipt once mined, up to maxLogs,
+	// each {address, topics, data}.
+	Logs json.RawMessage `json:"logs,omitempty"`
+	// Internal are the native currency transfers the transaction's internal
+	// calls made, each {type, from, to, value}, when its endpoint can trace.
+	Internal json.RawMessage `json:"internal,omitempty"`
+}
+
+// Store keeps intents in a JSON file.
+type Store struct {
+	mu      sync.Mutex
+	intents []Intent // oldest first
+	path    string
+	opened  time.Time // intents unresolved before this were interrupted
+}
+
+// NewStore loads intents from a JSON file. If the file doesn't exist, starts
+// empty.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path, intents: []Intent{}, opened: time.Now().UTC()}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("read journal: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.intents); err != nil {
+		return nil, fmt.Errorf("parse journal: %w", err)
+	}
+	return s, nil
+}
+
+// List returns intents newest first, optionally only those at stage.
+func (s *Store) List(stage string) []Intent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []Intent{}
+	for i := len(s.intents) - 1; i >= 0; i-- {
+		if stage == "" || s.intents[i].Stage == stage {
+			out = append(out, s.intents[i])
+		}
+	}
+	return out
+}
+
+// Send records env as an intent, then signs it with sign and broadcasts it
+// to ep, recording each stage before moving on. Nothing is signed if the
+// intent can't be written, and nothing is broadcast if the signed
+// transaction can't be. When only the broadcast fails, the signed
+// transaction is returned with the error.
+func (s *Store) Send(ctx context.Context, ep endpoint.Endpoint, env *txbuild.Envelope, origin string, sign func() (*txbuild.Signed, error)) (*txbuild.Signed, error) {
+	id, err := s.begin(env, origin)
+	if err != nil {
+		return nil, err
+	}
+	signed, err := sign()
+	if err != nil {
+		s.finish(id, StageFailed, err.Error())
+		return nil, err
+	}
+	if err := s.update(id, func(in *Intent) {
+		in.Stage = StageSigned
+		in.Hash = signed.Hash
+		in.Raw = signed.Raw
+	}); err != nil {
+		return nil, fmt.Errorf("not broadcast: %w", err)
+	}
+	if _, err := txbuild.Broadcast(ctx, ep, signed.Raw); err != nil {
+		// A transport error can hide a broadcast that reached the node.
+		switch stage, _, cerr := check(ctx, ep, s.get(id)); {
+		case cerr != nil:
+			s.finish(id, StageSigned, err.Error()) // left for Reconcile
+		case stage == StageSent:
+			s.finish(id, StageSent, "")
+			return signed, nil
+		default:
+			s.finish(id, StageFailed, err.Error())
+		}
+		return signed, err
+	}
+	s.finish(id, StageSent, "")
+	return signed, nil
+}
+
+// Reconcile resolves intents a crash left unresolved: those prepared but
+// never signed did not go out, and signed ones are looked up on their
+// endpoint. Intents whose endpoint is gone or unreachable stay signed for
+// the next run. It returns the intents it resolved.
+func (s *Store) Reconcile(ctx context.Context, lookup func(id string) (endpoint.Endpoint, bool)) ([]Intent, error) {
+	s.mu.Lock()
+	var stale []Intent
+	for _, in := range s.intents {
+		if (in.Stage == StagePrepared || in.Stage == StageSigned) && in.UpdatedAt.Before(s.opened) {
+			stale = append(stale, in)
+		}
+	}
+	s.mu.Unlock()
+
+	var resolved []Intent
+	var saveErr error
+	for _, in := range stale {
+		stage, reason := StageFailed, "interrupted before signing; nothing was sent"
+		if in.Stage == StageSigned {
+			ep, ok := lookup(in.Endpoint)
+			if !ok {
+				slog.Warn("journal intent unresolved", "subsystem", "journal", "intent", in.ID, "error", "endpoint not found")
+				continue
+			}
+			var err error
+			if stage, reason, err = check(ctx, ep, in); err != nil {
+				slog.Warn("journal intent unresolved", "subsystem", "journal", "intent", in.ID, "error", err)
+				continue
+			}
+		}
+		if err := s.finish(in.ID, stage, reason); err != nil {
+			saveErr = err
+			continue
+		}
+		resolved = append(resolved, s.get(in.ID))
+	}
+	return resolved, saveErr
+}
+
+// CheckReceipts polls the receipts of sent intents from the last
+// ReceiptWindow, including those sent before a restart, and of mined ones
+// until they are as deep as their endpoint's Confirmations, at which they
+// are confirmed or reverted. A mined intent whose receipt moves to another
+// block was reorged and is recorded in its new one; one whose receipt
+// disappears goes back to sent, with Error saying why. It returns the
+// intents whose stage or block changed.
+func (s *Store) CheckReceipts(lookup func(id string) (endpoint.Endpoint, bool)) ([]Intent, error) {
+	cutoff := time.Now().Add(-ReceiptWindow)
+	heads := map[string]string{} // endpoint ID -> head, read once per check
+	var changed []Intent
+	var saveErr error
+	for _, in := range s.List("") {
+		if in.Stage != StageMined && (in.Stage != StageSent || in.UpdatedAt.Before(cutoff)) {
+			continue
+		}
+		ep, ok := lookup(in.Endpoint)
+		if !ok {
+			continue
+		}
+		receipt, err := endpoint.ReadReceipt(context.Background(), ep, in.Hash)
+		if err != nil {
+			continue
+		}
+		reorged := in.Stage == StageMined && (receipt == nil || !strings.EqualFold(receipt.BlockHash, in.BlockHash))
+		if receipt == nil {
+			if reorged {
+				if err := s.update(in.ID, func(in *Intent) {
+					in.Error = fmt.Sprintf("block %s was reorged away; waiting to be mined again", in.Block)
+					in.Stage, in.Block, in.BlockHash, in.Logs, in.Internal = StageSent, "", "", nil, nil
+					in.Fee, in.MinedAt = "", nil
+					in.Reorgs++
+				}); err != nil {
+					saveErr = err
+					continue
+				}
+				changed = append(changed, s.get(in.ID))
+			}
+			continue
+		}
+
+		stage := StageConfirmed
+		if receipt.Status == "0x0" {
+			stage = StageReverted
+		}
+		if need := ep.ConfirmDepth(); need > 1 {
+			head, ok := heads[ep.ID]
+			if !ok {
+				head, _ = endpoint.ReadHead(context.Background(), ep)
+				heads[ep.ID] = head
+			}
+			if endpoint.Depth(receipt.BlockNumber, head) < need {
+				stage = StageMined
+			}
+		}
+		if stage == in.Stage && !reorged {
+			continue
+		}
+
+		logs, internal, fee, minedAt := in.Logs, in.Internal, in.Fee, in.MinedAt
+		if in.Stage != StageMined || reorged {
+			logs = nil
+			if len(receipt.Logs) > 0 {
+				logs, _ = json.Marshal(receipt.Logs[:min(len(receipt.Logs), maxLogs)])
+			}
+			internal = nil
+			if receipt.Status != "0x0" {
+				internal = internalTransfers(ep, in.Hash)
+			}
+			fee = ""
+			if f := receipt.Fee(); f != nil {
+				fee = evm.EncodeQuantity(f)
+			}
+			minedAt = nil
+			if t, err := endpoint.ReadBlockTime(context.Background(), ep, receipt.BlockNumber); err == nil {
+				minedAt = &t
+			}
+		}
+		if err := s.update(in.ID, func(in *Intent) {
+			if reorged {
+				in.Reorgs++
+			}
+			in.Stage = stage
+			in.Error = ""
+			in.Block = receipt.BlockNumber
+			in.BlockHash = receipt.BlockHash
+			in.Logs = logs
+			in.Internal = internal
+			in.Fee = fee
+			in.MinedAt = minedAt
+		}); err != nil {
+			saveErr = err
+			continue
+		}
+		changed = append(changed, s.get(in.ID))
+	}
+	return changed, saveErr
+}
+
+// internalTransfers traces hash on ep for the value its internal calls
+// moved, up to maxLogs transfers. It returns nil when there were none or
+// ep can't trace, so the intent is recorded either way.
+func internalTransfers(ep endpoint.Endpoint, hash string) json.RawMessage {
+	transfers, err := endpoint.InternalTransfers(context.Background(), ep, hash)
+	if err != nil {
+		if !errors.Is(err, endpoint.ErrNoTrace) {
+			slog.Debug("trace failed", "subsystem", "journal", "hash", hash, "error", err)
+		}
+		return nil
+	}
+	if len(transfers) == 0 {
+		return nil
+	}
+	data, _ := json.Marshal(transfers[:min(len(transfers), maxLogs)])
+	return data
+}
+
+// check looks a signed intent up on ep: on the node means sent, and a nonce
+// the account has already used means another transaction took its place.
+func check(ctx context.Context, ep endpoint.Endpoint, in Intent) (stage, reason string, err error) {
+	result, err := endpoint.RPCCall(ctx, ep, "eth_getTransactionByHash", []any{in.Hash})
+	if err != nil {
+		return "", "", err
+	}
+	if string(result) != "null" && len(result) > 0 {
+		return StageSent, "", nil
+	}
+	result, err = endpoint.RPCCall(ctx, ep, "eth_getTransactionCount", []any{in.From, "latest"})
+	if err != nil {
+		return "", "", err
+	}
+	var hexCount string
+	if err := json.Unmarshal(result, &hexCount); err != nil {
+		return "", "", fmt.Errorf("parse nonce: %w", err)
+	}
+	count, err := evm.ParseQuantity(hexCount)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := evm.ParseQuantity(in.Nonce)
+	if err != nil {
+		return "", "", err
+	}
+	if count.Cmp(nonce) > 0 {
+		return StageFailed, fmt.Sprintf("not on the node; nonce %s was used by another transaction", nonce), nil
+	}
+	return StageFailed, "not on the node; safe to send again (raw is kept for rebroadcast)", nil
+}
+
+// begin writes a prepared intent for env.
+func (s *Store) begin(env *txbuild.Envelope, origin string) (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	in := Intent{
+		ID:        hex.EncodeToString(b),
+		Origin:    origin,
+		Endpoint:  env.Endpoint,
+		ChainID:   env.ChainID,
+		From:      env.From,
+		To:        env.Tx.To,
+		Value:     env.Tx.Value,
+		Nonce:     env.Tx.Nonce,
+		Stage:     StagePrepared,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.intents
+	s.intents = trim(append(s.intents[:len(old):len(old)], in))
+	if err := s.save(); err != nil {
+		s.intents = old
+		return "", err
+	}
+	return in.ID, nil
+}
+
+// finish records an outcome. A failed save is logged, since the send itself
+// has already happened (or not) by then.
+func (s *Store) finish(id, stage, reason string) error {
+	err := s.update(id, func(in *Intent) {
+		in.Stage = stage
+		in.Error = reason
+	})
+	if err != nil {
+		slog.Error("journal save failed", "subsystem", "journal", "intent", id, "error", err)
+	}
+	return err
+}
+
+func (s *Store) update(id string, fn func(*Intent)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.intents {
+		if s.intents[i].ID == id {
+			old := s.intents[i]
+			fn(&s.intents[i])
+			s.intents[i].UpdatedAt = time.Now().UTC()
+			if err := s.save(); err != nil {
+				s.intents[i] = old
+				return err
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("intent %q not found", id)
+}
+
+func (s *Store) get(id string) Intent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, in := range s.intents {
+		if in.ID == id {
+			return in
+		}
+	}
+	return Intent{}
+}
+
+// trim drops the oldest finished intents beyond finishedLimit.
+func trim(intents []Intent) []Intent {
+	finished := 0
+	for _, in := range intents {
+		if finishedStage(in.Stage) {
+			finished++
+		}
+	}
+	if finished <= finishedLimit {
+		return intents
+	}
+	kept := make([]Intent, 0, len(intents))
+	for _, in := range intents {
+		if finished > finishedLimit && finishedStage(in.Stage) {
+			finished--
+			continue
+		}
+		kept = append(kept, in)
+	}
+	return kept
+}
+
+// finishedStage reports whether an intent at stage is past the point where
+// a crash could leave it unresolved.
+func finishedStage(stage string) bool {
+	return stage != StagePrepared && stage != StageSigned
+}
+
+// save writes the journal to disk. Must be called with mu held.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.intents, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal journal: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("write journal: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+// Package keysync keeps a copy of the dashboard's browser vault on the
+// server, so a second browser unlocks the same keys without importing them.
+// Keys arrive encrypted under a key the browser derives from a password or
+// passkey; the server versions them but can never decrypt them.
+package keysync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrConflict means a write was based on an outdated version: another
+// browser changed the key, or the vault, first.
+var ErrConflict = errors.New("changed by another browser; sync again")
+
+// ErrOff means sync hasn't been turned on.
+var ErrOff = errors.New("vault sync is off")
+
+// Key is an encrypted browser vault key, identified by its address.
+type Key struct {
+	Address   string     `json:"address"`
+	Label     string     `json:"label"`
+	Encrypted []byte     `json:"encrypted"` // AES-GCM ciphertext of the private key
+	IV        []byte     `json:"iv"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // in the recycle bin
+	Version   int64      `json:"version"`
+}
+
+// Vault is a synced browser vault.
+type Vault struct {
+	// ID is chosen by the browser that turned sync on. Browsers compare it
+	// with their own to tell whether they hold the same vault.
+	ID string `json:"id"`
+	// Credential tells browsers how to derive the vault key: the salts and
+	// credential IDs of its passwords and passkeys, each with its own
+	// wrapped copy of the key. The server doesn't read it.
+	Credential json.RawMessage `json:"credential"`
+	// CredentialVersion is the version of the latest change to Credential.
+	CredentialVersion int64 `json:"credential_version"`
+	// Version is the version of the latest change to any key.
+	Version int64 `json:"version"`
+	Keys    []Key `json:"keys"`
+}
+
+var (
+	addressRe = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+	idRe      = regexp.MustCompile(`^[0-9a-f]{16,64}$`)
+)
+
+// Store holds one profile's synced vault in a JSON file.
+type Store struct {
+	mu    sync.RWMutex
+	vault *Vault // nil while sync is off
+	path  string
+}
+
+// NewStore loads the synced vault from a JSON file. If the file doesn't
+// exist, sync is off.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("read synced vault: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.vault); err != nil {
+		return nil, fmt.Errorf("parse synced vault: %w", err)
+	}
+	return s, nil
+}
+
+// Get returns the synced vault, including deleted keys.
+func (s *Store) Get() (Vault, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.vault == nil {
+		return Vault{}, ErrOff
+	}
+	v := *s.vault
+	v.Keys = append([]Key{}, s.vault.Keys...)
+	return v, nil
+}
+
+// Enable turns sync on with a browser's vault. If another vault is synced,
+// it fails with ErrConflict unless replace is set.
+func (s *Store) Enable(v Vault, replace bool) (Vault, error) {
+	if !idRe.MatchString(v.ID) {
+		return Vault{}, fmt.Errorf("id must be 16-64 lowercase hex digits")
+	}
+	if err := checkCredential(v.Credential); err != nil {
+		return Vault{}, err
+	}
+	seen := map[string]bool{}
+	for _, k := range v.Keys {
+		if err := check(k); err != nil {
+			return Vault{}, err
+		}
+		if seen[strings.ToLower(k.Address)] {
+			return Vault{}, fmt.Errorf("key %s appears twice", k.Address)
+		}
+		seen[strings.ToLower(k.Address)] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.vault != nil && s.vault.ID != v.ID && !replace {
+		return Vault{}, ErrConflict
+	}
+	// Versions keep counting up across replacements, so a browser can't
+	// mistake a new key for one it has seen.
+	var version int64 = 1
+	if s.vault != nil {
+		version = s.vault.Version + 1
+	}
+	now := time.Now().UTC()
+	next := &Vault{ID: v.ID, Credential: v.Credential, CredentialVersion: version, Version: version, Keys: make([]Key, len(v.Keys))}
+	for i, k := range v.Keys {
+		k.Version, k.UpdatedAt = version, now
+		if k.CreatedAt.IsZero() {
+			k.CreatedAt = now
+		}
+		next.Keys[i] = k
+	}
+	old := s.vault
+	s.vault = next
+	if err := s.save(); err != nil {
+		s.vault = old
+		return Vault{}, err
+	}
+	return *next, nil
+}
+
+// Disable turns sync off and deletes the server's copy.
+func (s *Store) Disable() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.vault == nil {
+		return ErrOff
+	}
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove synced vault: %w", err)
+	}
+	s.vault = nil
+	return nil
+}
+
+// SetCredential replaces the credential of the vault with the given ID,
+// after a browser adds or removes a password or passkey. base is the
+// credential version the browser last saw; if it has changed since,
+// SetCredential fails with ErrConflict.
+func (s *Store) SetCredential(vaultID string, base int64, cred json.RawMessage) (Vault, error) {
+	if err := checkCredential(cred); err != nil {
+		return Vault{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.vault == nil {
+		return Vault{}, ErrOff
+	}
+	if s.vault.ID != vaultID || s.vault.CredentialVersion != base {
+		return Vault{}, ErrConflict
+	}
+	old := *s.vault
+	s.vault.Version++
+	s.vault.Credential, s.vault.CredentialVersion = cred, s.vault.Version
+	if err := s.save(); err != nil {
+		*s.vault = old
+		return Vault{}, err
+	}
+	v := *s.vault
+	v.Keys = append([]Key{}, s.vault.Keys...)
+	return v, nil
+}
+
+// Put adds or updates a key of the vault with the given ID. base is the
+// version of the key the browser last saw, or 0 for a key it believes is
+// new. If the key has changed since, Put fails with ErrConflict and returns
+// the server's copy, if it still has one.
+func (s *Store) Put(vaultID string, base int64, k Key) (Key, error) {
+	if err := check(k); err != nil {
+		return Key{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.vault == nil {
+		return Key{}, ErrOff
+	}
+	if s.vault.ID != vaultID {
+		return Key{}, ErrConflict
+	}
+	i := s.findLocked(k.Address)
+	switch {
+	case i >= 0 && s.vault.Keys[i].Version != base:
+		return s.vault.Keys[i], ErrConflict
+	case i < 0 && base != 0:
+		// Purged by another browser.
+		return Key{}, ErrConflict
+	}
+
+	old := s.vault.Keys
+	version := s.vault.Version + 1
+	now := time.Now().UTC()
+	k.Version, k.UpdatedAt = version, now
+	if i >= 0 {
+		k.CreatedAt = old[i].CreatedAt
+	} else if k.CreatedAt.IsZero() {
+		k.CreatedAt = now
+	}
+	keys := make([]Key, 0, len(old)+1)
+	for _, existing := range old {
+		if !strings.EqualFold(existing.Address, k.Address) {
+			keys = append(keys, existing)
+		}
+	}
+	s.vault.Keys = append(keys, k)
+	s.vault.Version = version
+	if err := s.save(); err != nil {
+		s.vault.Keys, s.vault.Version = old, version-1
+		return Key{}, err
+	}
+	return k, nil
+}
+
+// Purge permanently removes a key, with base as in Put.
+func (s *Store) Purge(vaultID string, base int64, address string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.vault == nil {
+		return ErrOff
+	}
+	if s.vault.ID != vaultID {
+		return ErrConflict
+	}
+	i := s.findLocked(address)
+	if i < 0 {
+		return fmt.Errorf("key %s not found", address)
+	}
+	if s.vault.Keys[i].Version != base {
+		return ErrConflict
+	}
+	old := s.vault.Keys
+	s.vault.Keys = append(old[:i:i], old[i+1:]...)
+	s.vault.Version++
+	if err := s.save(); err != nil {
+		s.vault.Keys = old
+		s.vault.Version--
+		return err
+	}
+	return nil
+}
+
+// checkCredential validates a credential from a browser.
+func checkCredential(cred json.RawMessage) error {
+	var fields map[string]any
+	if err := json.Unmarshal(cred, &fields); err != nil || len(fields) == 0 {
+		return fmt.Errorf("credential must be a JSON object")
+	}
+	return nil
+}
+
+// check validates a key from a browser.
+func check(k Key) error {
+	if !addressRe.MatchString(k.Address) {
+		return fmt.Errorf("invalid address %q", k.Address)
+	}
+	if len(k.Encrypted) == 0 || len(k.IV) != 12 {
+		return fmt.Errorf("key %s must have its ciphertext and a 12-byte iv", k.Address)
+	}
+	return nil
+}
+
+// findLocked returns the index of the key with the address, or -1. Must be
+// called with mu held and sync on.
+func (s *Store) findLocked(address string) int {
+	for i, k := range s.vault.Keys {
+		if strings.EqualFold(k.Address, address) {
+			return i
+		}
+	}
+	return -1
+}
+
+// save writes the vault to disk. Must be called with mu held.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.vault, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal synced vault: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		return fmt.Errorf("write synced vault: %w", err)
+	}
+	return nil
+}
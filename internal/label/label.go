@@ -0,0 +1,204 @@
+// Package label keeps a profile's names and tags for addresses, its own
+// or anyone's, so history and transaction previews can say who an address
+// is and history can be filtered by tag.
+package label
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// Limits on one label.
+const (
+	maxName = 64
+	maxNote = 500
+	maxTags = 16
+	maxTag  = 32
+)
+
+// Label names and tags an address.
+type Label struct {
+	Address   string    `json:"address"`
+	Name      string    `json:"name,omitempty"`
+	Tags      []string  `json:"tags,omitempty"` // lowercase, sorted
+	Note      string    `json:"note,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Has reports whether l carries tag.
+func (l Label) Has(tag string) bool {
+	return slices.Contains(l.Tags, strings.ToLower(tag))
+}
+
+// Store manages labels persisted to a JSON file.
+type Store struct {
+	mu     sync.RWMutex
+	labels []Label
+	path   string
+}
+
+// NewStore loads labels from a JSON file. If the file doesn't exist, starts
+// empty.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path, labels: []Label{}}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("read labels: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.labels); err != nil {
+		return nil, fmt.Errorf("parse labels: %w", err)
+	}
+	return s, nil
+}
+
+// List returns labels by address, only those carrying tag unless it is
+// empty.
+func (s *Store) List(tag string) []Label {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []Label{}
+	for _, l := range s.labels {
+		if tag == "" || l.Has(tag) {
+			out = append(out, l)
+		}
+	}
+	slices.SortFunc(out, func(a, b Label) int { return strings.Compare(strings.ToLower(a.Address), strings.ToLower(b.Address)) })
+	return out
+}
+
+// Get returns the label of an address.
+func (s *Store) Get(address string) (Label, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i := s.index(address)
+	if i < 0 {
+		return Label{}, false
+	}
+	return s.labels[i], true
+}
+
+// Lookup returns the labels of those of addresses that have one, once each,
+// in the order given.
+func (s *Store) Lookup(addresses ...string) []Label {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []Label
+	for _, a := range addresses {
+		if i := s.index(a); i >= 0 && !slices.ContainsFunc(out, func(l Label) bool { return l.Address == s.labels[i].Address }) {
+			out = append(out, s.labels[i])
+		}
+	}
+	return out
+}
+
+// Set validates l and stores it, replacing the address's label if it has
+// one. Tags are trimmed, lowercased, and deduplicated.
+func (s *Store) Set(l Label) (Label, error) {
+	a, err := evm.ParseAddress(l.Address)
+	if err != nil {
+		return Label{}, fmt.Errorf("invalid address: %w", err)
+	}
+	l.Address = a.Hex()
+	l.Name = strings.TrimSpace(l.Name)
+	l.Note = strings.TrimSpace(l.Note)
+	if len(l.Name) > maxName {
+		return Label{}, fmt.Errorf("name is longer than %d bytes", maxName)
+	}
+	if len(l.Note) > maxNote {
+		return Label{}, fmt.Errorf("note is longer than %d bytes", maxNote)
+	}
+	var tags []string
+	for _, t := range l.Tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || slices.Contains(tags, t) {
+			continue
+		}
+		if err := checkTag(t); err != nil {
+			return Label{}, err
+		}
+		tags = append(tags, t)
+	}
+	if len(tags) > maxTags {
+		return Label{}, fmt.Errorf("at most %d tags", maxTags)
+	}
+	slices.Sort(tags)
+	l.Tags = tags
+	if l.Name == "" && len(l.Tags) == 0 {
+		return Label{}, fmt.Errorf("a label needs a name or a tag")
+	}
+	l.UpdatedAt = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.labels
+	s.labels = slices.Clone(old)
+	if i := s.index(l.Address); i >= 0 {
+		s.labels[i] = l
+	} else {
+		s.labels = append(s.labels, l)
+	}
+	if err := s.save(); err != nil {
+		s.labels = old
+		return Label{}, err
+	}
+	return l, nil
+}
+
+// Delete removes an address's label.
+func (s *Store) Delete(address string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(address)
+	if i < 0 {
+		return fmt.Errorf("label %q not found", address)
+	}
+	old := s.labels
+	s.labels = slices.Delete(slices.Clone(old), i, i+1)
+	if err := s.save(); err != nil {
+		s.labels = old
+		return err
+	}
+	return nil
+}
+
+// checkTag accepts lowercase letters, digits, and - _ . : up to maxTag
+// bytes, so tags work unquoted in a query string or on the command line.
+func checkTag(t string) error {
+	if len(t) > maxTag {
+		return fmt.Errorf("tag %q is longer than %d bytes", t, maxTag)
+	}
+	for _, r := range t {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && !strings.ContainsRune("-_.:", r) {
+			return fmt.Errorf("invalid tag %q: use letters, digits, and - _ . :", t)
+		}
+	}
+	return nil
+}
+
+// index returns the position of address, or -1. Must be called with mu held.
+func (s *Store) index(address string) int {
+	return slices.IndexFunc(s.labels, func(l Label) bool { return strings.EqualFold(l.Address, address) })
+}
+
+// save writes labels to disk. Must be called with mu held.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.labels, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal labels: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("write labels: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,680 @@
+// Package lightclient follows the beacon chain the way Helios does: from a
+// trusted checkpoint, every header is taken only with a valid signature of
+// the sync committee the chain so far proves, so the execution headers it
+// attests to, and the state roots in them, needn't be taken on trust from
+// an RPC provider. State reads are then checked against those roots with
+// eth_getProof.
+package lightclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/primal-host/wallet/internal/bls"
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// syncInterval is how often Sync asks for new headers: a slot.
+const syncInterval = 12 * time.Second
+
+// staleSlots is how far behind the wall clock the latest header may be
+// before the client no longer counts as synced.
+const staleSlots = 32
+
+// maxUpdates is how many sync committee periods' updates are asked for at
+// once, the most beacon nodes serve.
+const maxUpdates = 128
+
+// domainSyncCommittee is the signature domain type of sync committees.
+var domainSyncCommittee = []byte{7, 0, 0, 0}
+
+// executionGindex is where a beacon block body holds the execution
+// payload header.
+const executionGindex = 25
+
+// layout is where a fork's beacon state holds the roots a light client
+// checks, as generalized indices.
+type layout struct {
+	finalized, current, next uint64
+	blob                     bool // the execution header has Deneb's blob gas fields
+}
+
+// layouts are the forks the client understands, by the name the beacon API
+// gives. Light client data before Capella has no execution header.
+var layouts = map[string]layout{
+	"capella": {finalized: 105, current: 54, next: 55},
+	"deneb":   {finalized: 105, current: 54, next: 55, blob: true},
+	"electra": {finalized: 169, current: 86, next: 87, blob: true},
+	"fulu":    {finalized: 169, current: 86, next: 87, blob: true},
+}
+
+// ErrNotSynced is returned for reads that need a verified header while the
+// client has none recent enough.
+var ErrNotSynced = errors.New("light client isn't synced")
+
+// Head is an execution header the sync committee attested to.
+type Head struct {
+	Slot      uint64 `json:"slot"` // of the beacon block holding it
+	Number    uint64 `json:"block_number"`
+	Hash      string `json:"block_hash"`
+	StateRoot string `json:"state_root"`
+}
+
+// Status is how far a client has followed the beacon chain.
+type Status struct {
+	Consensus  string    `json:"consensus"`
+	Checkpoint string    `json:"checkpoint,omitempty"` // block root it starts or started from
+	Synced     bool      `json:"synced"`
+	Period     uint64    `json:"period"` // sync committee period of the finalized header
+	Latest     *Head     `json:"latest,omitempty"`
+	Finalized  *Head     `json:"finalized,omitempty"`
+	SyncedAt   time.Time `json:"synced_at,omitzero"` // last successful sync
+	Error      string    `json:"error,omitempty"`
+}
+
+// chain is what the client needs to know of the beacon chain besides its
+// headers: where slots fall in time and which fork signs them.
+type chain struct {
+	genesisTime     uint64
+	validatorsRoot  []byte
+	secondsPerSlot  uint64
+	slotsPerEpoch   uint64
+	epochsPerPeriod uint64
+	forks           []fork // by epoch, ascending
+}
+
+type fork struct {
+	epoch   uint64
+	version []byte
+}
+
+// header is a beacon header with the execution header it holds.
+type header struct {
+	Beacon          BeaconHeader     `json:"beacon"`
+	Execution       *ExecutionHeader `json:"execution"`
+	ExecutionBranch []string         `json:"execution_branch"`
+}
+
+// committee is a sync committee's public keys.
+type committee []*bls.PublicKey
+
+// update is a light client update: a header attested to by the sync
+// committee, and, when known, the finalized header and the next
+// committee it proves. Finality and optimistic updates leave parts out.
+type update struct {
+	AttestedHeader          header         `json:"attested_header"`
+	NextSyncCommittee       *SyncCommittee `json:"next_sync_committee"`
+	NextSyncCommitteeBranch []string       `json:"next_sync_committee_branch"`
+	FinalizedHeader         *header        `json:"finalized_header"`
+	FinalityBranch          []string       `json:"finality_branch"`
+	SyncAggregate           struct {
+		Bits      string `json:"sync_committee_bits"`
+		Signature string `json:"sync_committee_signature"`
+	} `json:"sync_aggregate"`
+	SignatureSlot string `json:"signature_slot"`
+}
+
+// versioned is the beacon API's envelope for light client data.
+type versioned[T any] struct {
+	Version string `json:"version"`
+	Data    T      `json:"data"`
+}
+
+// Client follows one beacon node's chain.
+type Client struct {
+	beacon     endpoint.Endpoint // URL is the beacon API's base
+	checkpoint string
+
+	syncing sync.Mutex // held by Sync
+
+	mu         sync.Mutex
+	chain      *chain
+	trusted    string // the checkpoint started from
+	finalized  header
+	latest     header
+	period     uint64
+	current    committee
+	next       committee
+	syncedAt   time.Time
+	err        error
+	lastFailed bool
+}
+
+// New returns a client following the beacon node at beacon.URL from the
+// given checkpoint, a block root, or from the node's finalized block when
+// it is empty. Requests use beacon's proxy and timeout. Nothing is fetched
+// until Sync.
+func New(beacon endpoint.Endpoint, checkpoint string) *Client {
+	return &Client{beacon: beacon, checkpoint: checkpoint}
+}
+
+// Sync brings the client up to the beacon chain's latest signed header,
+// starting from the checkpoint on first use. It does nothing when a sync
+// is already running or the last one succeeded within a slot.
+func (c *Client) Sync(ctx context.Context) error {
+	if !c.syncing.TryLock() {
+		return nil
+	}
+	defer c.syncing.Unlock()
+	c.mu.Lock()
+	recent := c.err == nil && time.Since(c.syncedAt) < syncInterval
+	c.mu.Unlock()
+	if recent {
+		return nil
+	}
+
+	err := c.sync(ctx)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+	if err == nil {
+		c.syncedAt = time.Now()
+		if c.lastFailed {
+			slog.Info("light client synced again", "subsystem", "lightclient", "consensus", redact(c.beacon.URL), "slot", c.latest.Beacon.Slot)
+		}
+	} else if !c.lastFailed {
+		slog.Warn("light client sync failed", "subsystem", "lightclient", "consensus", redact(c.beacon.URL), "error", err)
+	} else {
+		slog.Debug("light client sync failed", "subsystem", "lightclient", "consensus", redact(c.beacon.URL), "error", err)
+	}
+	c.lastFailed = err != nil
+	return err
+}
+
+func (c *Client) sync(ctx context.Context) error {
+	c.mu.Lock()
+	started := c.chain != nil
+	c.mu.Unlock()
+	if !started {
+		if err := c.bootstrap(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Catch up a sync committee period at a time until the next committee
+	// of the current period is known.
+	for {
+		c.mu.Lock()
+		period, haveNext := c.period, c.next != nil
+		now := c.chain.period(c.chain.currentSlot())
+		c.mu.Unlock()
+		if period >= now && haveNext {
+			break
+		}
+		count := uint64(1)
+		if now > period {
+			count = min(now-period+1, maxUpdates)
+		}
+		var updates []versioned[update]
+		if err := c.get(ctx, fmt.Sprintf("/eth/v1/beacon/light_client/updates?start_period=%d&count=%d", period, count), &updates); err != nil {
+			return fmt.Errorf("updates: %w", err)
+		}
+		for _, u := range updates {
+			if err := c.apply(u.Version, u.Data); err != nil {
+				return fmt.Errorf("update: %w", err)
+			}
+		}
+		c.mu.Lock()
+		progress := c.period > period || c.next != nil && !haveNext
+		c.mu.Unlock()
+		if !progress {
+			if period >= now {
+				break // the next committee isn't signed for yet
+			}
+			return fmt.Errorf("no update moves past sync committee period %d", period)
+		}
+	}
+
+	var fin versioned[update]
+	if err := c.get(ctx, "/eth/v1/beacon/light_client/finality_update", &fin); err != nil {
+		return fmt.Errorf("finality update: %w", err)
+	}
+	if err := c.apply(fin.Version, fin.Data); err != nil {
+		return fmt.Errorf("finality update: %w", err)
+	}
+	var opt versioned[update]
+	if err := c.get(ctx, "/eth/v1/beacon/light_client/optimistic_update", &opt); err != nil {
+		return fmt.Errorf("optimistic update: %w", err)
+	}
+	if err := c.apply(opt.Version, opt.Data); err != nil {
+		return fmt.Errorf("optimistic update: %w", err)
+	}
+	return nil
+}
+
+// bootstrap learns the chain's parameters and takes the checkpoint's
+// header and sync committee, checked against the checkpoint root.
+func (c *Client) bootstrap(ctx context.Context) error {
+	ch, err := c.loadChain(ctx)
+	if err != nil {
+		return err
+	}
+	checkpoint := c.checkpoint
+	if checkpoint == "" {
+		var finalized struct {
+			Data struct {
+				Root string `json:"root"`
+			} `json:"data"`
+		}
+		if err := c.get(ctx, "/eth/v1/beacon/headers/finalized", &finalized); err != nil {
+			return fmt.Errorf("finalized header: %w", err)
+		}
+		checkpoint = finalized.Data.Root
+		slog.Warn("light client trusts the beacon node's finalized block; set a checkpoint to avoid this", "subsystem", "lightclient",
+			"consensus", redact(c.beacon.URL), "checkpoint", checkpoint)
+	}
+	root, err := decodeRoot(checkpoint)
+	if err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+
+	var boot versioned[struct {
+		Header                     header        `json:"header"`
+		CurrentSyncCommittee       SyncCommittee `json:"current_sync_committee"`
+		CurrentSyncCommitteeBranch []string      `json:"current_sync_committee_branch"`
+	}]
+	if err := c.get(ctx, "/eth/v1/beacon/light_client/bootstrap/"+checkpoint, &boot); err != nil {
+		return fmt.Errorf("bootstrap: %w", err)
+	}
+	l, ok := layouts[boot.Version]
+	if !ok {
+		return fmt.Errorf("bootstrap: unsupported fork %q", boot.Version)
+	}
+	h := boot.Data.Header
+	if got, err := h.Beacon.root(); err != nil || string(got) != string(root) {
+		return fmt.Errorf("bootstrap header isn't the checkpoint %s", checkpoint)
+	}
+	if err := h.verifyExecution(l); err != nil {
+		return fmt.Errorf("bootstrap: %w", err)
+	}
+	sc := boot.Data.CurrentSyncCommittee
+	scRoot, err := sc.root()
+	if err != nil {
+		return fmt.Errorf("bootstrap: %w", err)
+	}
+	stateRoot, _ := decodeRoot(h.Beacon.StateRoot)
+	if !validBranch(scRoot, boot.Data.CurrentSyncCommitteeBranch, l.current, stateRoot) {
+		return errors.New("bootstrap: sync committee isn't in the checkpoint's state")
+	}
+	keys, err := sc.keys()
+	if err != nil {
+		return fmt.Errorf("bootstrap: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.chain, c.trusted = ch, checkpoint
+	c.finalized, c.latest = h, h
+	c.period = ch.period(h.Beacon.slot())
+	c.current, c.next = keys, nil
+	return nil
+}
+
+// loadChain reads the chain's genesis, fork schedule, and timing.
+func (c *Client) loadChain(ctx context.Context) (*chain, error) {
+	var genesis struct {
+		Data struct {
+			GenesisTime           string `json:"genesis_time"`
+			GenesisValidatorsRoot string `json:"genesis_validators_root"`
+		} `json:"data"`
+	}
+	if err := c.get(ctx, "/eth/v1/beacon/genesis", &genesis); err != nil {
+		return nil, fmt.Errorf("genesis: %w", err)
+	}
+	var schedule struct {
+		Data []struct {
+			CurrentVersion string `json:"current_version"`
+			Epoch          string `json:"epoch"`
+		} `json:"data"`
+	}
+	if err := c.get(ctx, "/eth/v1/config/fork_schedule", &schedule); err != nil {
+		return nil, fmt.Errorf("fork schedule: %w", err)
+	}
+	var spec struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := c.get(ctx, "/eth/v1/config/spec", &spec); err != nil {
+		return nil, fmt.Errorf("spec: %w", err)
+	}
+
+	ch := &chain{secondsPerSlot: 12, slotsPerEpoch: 32, epochsPerPeriod: 256}
+	var err error
+	if ch.genesisTime, err = strconv.ParseUint(genesis.Data.GenesisTime, 10, 64); err != nil {
+		return nil, fmt.Errorf("genesis: invalid time %q", genesis.Data.GenesisTime)
+	}
+	if ch.validatorsRoot, err = decodeRoot(genesis.Data.GenesisValidatorsRoot); err != nil {
+		return nil, fmt.Errorf("genesis: %w", err)
+	}
+	for name, dst := range map[string]*uint64{
+		"SECONDS_PER_SLOT":                 &ch.secondsPerSlot,
+		"SLOTS_PER_EPOCH":                  &ch.slotsPerEpoch,
+		"EPOCHS_PER_SYNC_COMMITTEE_PERIOD": &ch.epochsPerPeriod,
+	} {
+		if s, ok := spec.Data[name].(string); ok {
+			if n, err := strconv.ParseUint(s, 10, 64); err == nil && n > 0 {
+				*dst = n
+			}
+		}
+	}
+	for _, f := range schedule.Data {
+		epoch, err := strconv.ParseUint(f.Epoch, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("fork schedule: invalid epoch %q", f.Epoch)
+		}
+		version, err := decodeFixed(f.CurrentVersion, 4)
+		if err != nil {
+			return nil, fmt.Errorf("fork schedule: %w", err)
+		}
+		ch.forks = append(ch.forks, fork{epoch: epoch, version: version})
+	}
+	if len(ch.forks) == 0 {
+		return nil, errors.New("fork schedule is empty")
+	}
+	return ch, nil
+}
+
+// apply checks an update and takes what it proves: a newer latest or
+// finalized header, and the next sync committee.
+func (c *Client) apply(version string, u update) error {
+	l, ok := layouts[version]
+	if !ok {
+		return fmt.Errorf("unsupported fork %q", version)
+	}
+	sigSlot, err := strconv.ParseUint(u.SignatureSlot, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid signature slot %q", u.SignatureSlot)
+	}
+	attested := u.AttestedHeader
+	attSlot := attested.Beacon.slot()
+	if sigSlot <= attSlot {
+		return errors.New("signed before the header it attests to")
+	}
+	hasFinality := u.FinalizedHeader != nil && !zeroBranch(u.FinalityBranch)
+	hasNext := u.NextSyncCommittee != nil && !zeroBranch(u.NextSyncCommitteeBranch)
+	if hasFinality && u.FinalizedHeader.Beacon.slot() > attSlot {
+		return errors.New("finalized header is newer than the attested one")
+	}
+
+	c.mu.Lock()
+	ch, period := c.chain, c.period
+	signers := c.current
+	switch sigPeriod := ch.period(sigSlot); {
+	case sigPeriod == period:
+	case sigPeriod == period+1 && c.next != nil:
+		signers = c.next
+	default:
+		c.mu.Unlock()
+		return fmt.Errorf("signed by the committee of period %d; the client is at %d", sigPeriod, period)
+	}
+	newer := attSlot > c.latest.Beacon.slot() ||
+		hasFinality && u.FinalizedHeader.Beacon.slot() > c.finalized.Beacon.slot() ||
+		hasNext && c.next == nil && ch.period(attSlot) == period
+	c.mu.Unlock()
+	if !newer {
+		return nil
+	}
+
+	if err := attested.verifyExecution(l); err != nil {
+		return err
+	}
+	attestedState, err := decodeRoot(attested.Beacon.StateRoot)
+	if err != nil {
+		return err
+	}
+	if hasFinality {
+		fin := u.FinalizedHeader
+		if err := fin.verifyExecution(l); err != nil {
+			return err
+		}
+		root, err := fin.Beacon.root()
+		if err != nil {
+			return err
+		}
+		if !validBranch(root, u.FinalityBranch, l.finalized, attestedState) {
+			return errors.New("finalized header isn't in the attested state")
+		}
+	}
+	var next committee
+	if hasNext {
+		root, err := u.NextSyncCommittee.root()
+		if err != nil {
+			return err
+		}
+		if !validBranch(root, u.NextSyncCommitteeBranch, l.next, attestedState) {
+			return errors.New("next sync committee isn't in the attested state")
+		}
+	}
+	if err := ch.verifySignature(signers, attested.Beacon, sigSlot, u.SyncAggregate.Bits, u.SyncAggregate.Signature); err != nil {
+		return err
+	}
+	if hasNext {
+		if next, err = u.NextSyncCommittee.keys(); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if hasNext && c.next == nil && ch.period(attSlot) == c.period {
+		c.next = next
+	}
+	if hasFinality && u.FinalizedHeader.Beacon.slot() > c.finalized.Beacon.slot() {
+		fin := *u.FinalizedHeader
+		if finPeriod := ch.period(fin.Beacon.slot()); finPeriod > c.period {
+			if finPeriod != c.period+1 || c.next == nil {
+				return fmt.Errorf("finalized header of period %d skips the committee of period %d", finPeriod, c.period+1)
+			}
+			c.current, c.next, c.period = c.next, nil, finPeriod
+			if hasNext && ch.period(attSlot) == c.period {
+				c.next = next
+			}
+		}
+		c.finalized = fin
+		if fin.Beacon.slot() > c.latest.Beacon.slot() {
+			c.latest = fin
+		}
+	}
+	if attSlot > c.latest.Beacon.slot() {
+		c.latest = attested
+	}
+	return nil
+}
+
+// verifySignature checks that at least two thirds of signers signed
+// header at sigSlot.
+func (ch *chain) verifySignature(signers committee, h BeaconHeader, sigSlot uint64, bitsHex, sigHex string) error {
+	mask, err := evm.DecodeHex(bitsHex)
+	if err != nil || len(mask)*8 != len(signers) {
+		return errors.New("invalid sync committee bits")
+	}
+	var keys []*bls.PublicKey
+	for i, k := range signers {
+		if mask[i/8]>>(i%8)&1 == 1 {
+			keys = append(keys, k)
+		}
+	}
+	if 3*len(keys) < 2*len(signers) {
+		return fmt.Errorf("only %d of %d sync committee members signed", len(keys), len(signers))
+	}
+	sigBytes, err := decodeFixed(sigHex, 96)
+	if err != nil {
+		return err
+	}
+	sig, err := bls.SignatureFromBytes(sigBytes)
+	if err != nil {
+		return err
+	}
+	root, err := h.root()
+	if err != nil {
+		return err
+	}
+	epoch := max(sigSlot, 1) - 1
+	epoch /= ch.slotsPerEpoch
+	version := ch.forks[0].version
+	for _, f := range ch.forks {
+		if f.epoch <= epoch {
+			version = f.version
+		}
+	}
+	forkDataRoot := hash(chunk(version), ch.validatorsRoot)
+	domain := append(append([]byte{}, domainSyncCommittee...), forkDataRoot[:28]...)
+	if !bls.FastAggregateVerify(keys, hash(root, domain), sig) {
+		return errors.New("sync committee signature is invalid")
+	}
+	return nil
+}
+
+// verifyExecution checks that h's execution header is the one its beacon
+// block holds.
+func (h header) verifyExecution(l layout) error {
+	if h.Execution == nil {
+		return errors.New("header has no execution header")
+	}
+	root, err := h.Execution.root(l.blob)
+	if err != nil {
+		return err
+	}
+	body, err := decodeRoot(h.Beacon.BodyRoot)
+	if err != nil {
+		return err
+	}
+	if !validBranch(root, h.ExecutionBranch, executionGindex, body) {
+		return errors.New("execution header isn't in its beacon block")
+	}
+	return nil
+}
+
+func (h header) head() *Head {
+	return &Head{Slot: h.Beacon.slot(), Number: h.Execution.number(), Hash: h.Execution.BlockHash, StateRoot: h.Execution.StateRoot}
+}
+
+// keys parses the committee's public keys.
+func (sc SyncCommittee) keys() (committee, error) {
+	keys := make(committee, len(sc.Pubkeys))
+	for i, k := range sc.Pubkeys {
+		b, err := decodeFixed(k, 48)
+		if err != nil {
+			return nil, err
+		}
+		if keys[i], err = bls.PublicKeyFromBytes(b); err != nil {
+			return nil, fmt.Errorf("sync committee key %d: %w", i, err)
+		}
+	}
+	return keys, nil
+}
+
+// zeroBranch reports whether branch is absent or all zero, as the beacon
+// API fills in parts an update doesn't have.
+func zeroBranch(branch []string) bool {
+	for _, h := range branch {
+		if b, err := evm.DecodeHex(h); err != nil || strings.Trim(string(b), "\x00") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (ch *chain) period(slot uint64) uint64 {
+	return slot / ch.slotsPerEpoch / ch.epochsPerPeriod
+}
+
+func (ch *chain) currentSlot() uint64 {
+	now := uint64(time.Now().Unix())
+	if now < ch.genesisTime {
+		return 0
+	}
+	return (now - ch.genesisTime) / ch.secondsPerSlot
+}
+
+// get fetches a path of the beacon API, keeping any query the beacon URL
+// has, as providers' API keys, out of errors.
+func (c *Client) get(ctx context.Context, path string, out any) error {
+	u, err := url.Parse(c.beacon.URL)
+	if err != nil {
+		return err
+	}
+	rel, err := url.Parse(path)
+	if err != nil {
+		return err
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + rel.Path
+	q := u.Query()
+	for k, v := range rel.Query() {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	ep := c.beacon
+	ep.URL = u.String()
+	err = endpoint.GetJSON(ctx, ep, out)
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		ue.URL = redact(ue.URL)
+	}
+	return err
+}
+
+// Status reports how far the client has followed the chain.
+func (c *Client) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := Status{Consensus: redact(c.beacon.URL), Checkpoint: c.trusted, SyncedAt: c.syncedAt, Synced: c.syncedLocked()}
+	if st.Checkpoint == "" {
+		st.Checkpoint = c.checkpoint
+	}
+	if c.err != nil {
+		st.Error = c.err.Error()
+	}
+	if c.chain != nil {
+		st.Period = c.period
+		st.Latest, st.Finalized = c.latest.head(), c.finalized.head()
+	}
+	return st
+}
+
+// Latest returns the newest execution header the sync committee signed.
+func (c *Client) Latest() (Head, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.syncedLocked() {
+		return Head{}, ErrNotSynced
+	}
+	return *c.latest.head(), nil
+}
+
+// Finalized returns the newest finalized execution header.
+func (c *Client) Finalized() (Head, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.syncedLocked() {
+		return Head{}, ErrNotSynced
+	}
+	return *c.finalized.head(), nil
+}
+
+// syncedLocked reports whether the latest header is recent. Must be
+// called with mu held.
+func (c *Client) syncedLocked() bool {
+	if c.chain == nil {
+		return false
+	}
+	return c.latest.Beacon.slot()+staleSlots >= c.chain.currentSlot()
+}
+
+// redact drops credentials and the query from a URL, which providers put
+// API keys in.
+func redact(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	u.User, u.RawQuery = nil, ""
+	return u.String()
+}
@@ -0,0 +1,172 @@
+package lightclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// Outcomes of Call.
+const (
+	Verified   = "verified"   // answered from a signed header or its proven state
+	Unverified = "unverified" // forwarded as the endpoint answered it
+)
+
+// stateReads are the state reads Call proves, with the position of their
+// block parameter.
+var stateReads = map[string]int{
+	"eth_getBalance":          1,
+	"eth_getTransactionCount": 1,
+	"eth_getCode":             1,
+	"eth_getStorageAt":        2,
+}
+
+// Check is how a call through a light client was answered: verified
+// against the header of the given slot and block, or unverified.
+type Check struct {
+	Status    string `json:"status"`
+	Slot      uint64 `json:"slot,omitempty"`
+	Block     string `json:"block,omitempty"`
+	StateRoot string `json:"state_root,omitempty"`
+}
+
+// Call makes a JSON-RPC call to ep, an execution endpoint of the chain c
+// follows, and verifies the answer where it can. eth_blockNumber is the
+// latest signed header's block. Balance, nonce, code, and storage reads of
+// latest, safe, finalized, or a signed header's block number are answered
+// from ep's eth_getProof of the account at that block, checked against the
+// header's state root; a proof that doesn't check out fails the call.
+// Other calls are forwarded unverified.
+func (c *Client) Call(ctx context.Context, ep endpoint.Endpoint, method string, params []any) (json.RawMessage, Check, error) {
+	if method == "eth_blockNumber" {
+		head, err := c.Latest()
+		if err != nil {
+			return nil, Check{}, err
+		}
+		result, _ := json.Marshal(evm.EncodeQuantity(new(big.Int).SetUint64(head.Number)))
+		return result, head.check(), nil
+	}
+
+	i, ok := stateReads[method]
+	var (
+		head  Head
+		found bool
+		err   error
+	)
+	if ok && len(params) >= i {
+		var tag any
+		if i < len(params) {
+			tag = params[i]
+		}
+		head, found, err = c.headAt(tag)
+	}
+	if !found {
+		result, err := endpoint.RPCCall(ctx, ep, method, params)
+		return result, Check{Status: Unverified}, err
+	}
+	if err != nil {
+		return nil, Check{}, err
+	}
+
+	address, _ := params[0].(string)
+	block := evm.EncodeQuantity(new(big.Int).SetUint64(head.Number))
+	keys := []any{}
+	if method == "eth_getStorageAt" {
+		keys = []any{params[1]}
+	}
+	proof, err := endpoint.RPCCall(ctx, ep, "eth_getProof", []any{address, keys, block})
+	if err != nil {
+		return nil, Check{}, fmt.Errorf("eth_getProof: %w", err)
+	}
+	result, err := answer(ctx, ep, method, params, head, block, proof)
+	if err != nil {
+		slog.Warn("rpc result fails light client verification", "subsystem", "lightclient", "endpoint", ep.ID, "method", method,
+			"block", block, "state_root", head.StateRoot, "error", err)
+		return nil, Check{}, fmt.Errorf("%s fails light client verification at block %s: %w", method, block, err)
+	}
+	return result, head.check(), nil
+}
+
+// headAt returns the signed header a block parameter names, and whether it
+// names one: latest (or none), safe, finalized, or the number of the
+// latest or finalized header.
+func (c *Client) headAt(tag any) (Head, bool, error) {
+	switch tag {
+	case nil, "latest":
+		head, err := c.Latest()
+		return head, true, err
+	case "safe", "finalized":
+		head, err := c.Finalized()
+		return head, true, err
+	}
+	s, ok := tag.(string)
+	if !ok {
+		return Head{}, false, nil
+	}
+	n, err := evm.ParseQuantity(s)
+	if err != nil || !n.IsUint64() {
+		return Head{}, false, nil
+	}
+	for _, get := range []func() (Head, error){c.Latest, c.Finalized} {
+		if head, err := get(); err == nil && head.Number == n.Uint64() {
+			return head, true, nil
+		}
+	}
+	return Head{}, false, nil
+}
+
+// answer proves the account in proof against head's state root and
+// returns what method asks of it.
+func answer(ctx context.Context, ep endpoint.Endpoint, method string, params []any, head Head, block string, proof json.RawMessage) (json.RawMessage, error) {
+	root, err := decodeRoot(head.StateRoot)
+	if err != nil {
+		return nil, err
+	}
+	address, _ := params[0].(string)
+	acct, err := endpoint.ProveAccount(root, address, proof)
+	if err != nil {
+		return nil, err
+	}
+	var out string
+	switch method {
+	case "eth_getBalance":
+		out = evm.EncodeQuantity(acct.Balance)
+	case "eth_getTransactionCount":
+		out = evm.EncodeQuantity(acct.Nonce)
+	case "eth_getStorageAt":
+		key, _ := params[1].(string)
+		v, err := endpoint.ProveStorage(acct, key, proof)
+		if err != nil {
+			return nil, err
+		}
+		out = evm.EncodeHex(v.FillBytes(make([]byte, 32)))
+	case "eth_getCode":
+		raw, err := endpoint.RPCCall(ctx, ep, "eth_getCode", []any{address, block})
+		if err != nil {
+			return nil, err
+		}
+		var hex string
+		if err := json.Unmarshal(raw, &hex); err != nil {
+			return nil, fmt.Errorf("unexpected eth_getCode result %s", raw)
+		}
+		code, err := evm.DecodeHex(hex)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(evm.Keccak256(code), acct.CodeHash) {
+			return nil, fmt.Errorf("code doesn't match the account's code hash")
+		}
+		out = evm.EncodeHex(code)
+	}
+	return json.Marshal(out)
+}
+
+func (h Head) check() Check {
+	return Check{Status: Verified, Slot: h.Slot, Block: evm.EncodeQuantity(new(big.Int).SetUint64(h.Number)), StateRoot: h.StateRoot}
+}
@@ -0,0 +1,259 @@
+package lightclient
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"math/bits"
+	"strconv"
+
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// SSZ hash_tree_root of the few containers the light client checks. Roots
+// are 32-byte chunks; containers are Merkle trees of their fields' roots.
+
+func hash(a, b []byte) []byte {
+	h := sha256.New()
+	h.Write(a)
+	h.Write(b)
+	return h.Sum(nil)
+}
+
+// merkleize returns the root of chunks padded with zero chunks to the next
+// power of two.
+func merkleize(chunks [][]byte) []byte {
+	n := 1
+	for n < len(chunks) {
+		n *= 2
+	}
+	layer := make([][]byte, n)
+	for i := range layer {
+		if i < len(chunks) {
+			layer[i] = chunks[i]
+		} else {
+			layer[i] = make([]byte, 32)
+		}
+	}
+	for len(layer) > 1 {
+		next := make([][]byte, len(layer)/2)
+		for i := range next {
+			next[i] = hash(layer[2*i], layer[2*i+1])
+		}
+		layer = next
+	}
+	return layer[0]
+}
+
+// chunk pads b, at most 32 bytes, to a chunk.
+func chunk(b []byte) []byte {
+	c := make([]byte, 32)
+	copy(c, b)
+	return c
+}
+
+// packBytes splits b into chunks, the last padded.
+func packBytes(b []byte) [][]byte {
+	var chunks [][]byte
+	for i := 0; i < len(b); i += 32 {
+		chunks = append(chunks, chunk(b[i:min(i+32, len(b))]))
+	}
+	return chunks
+}
+
+func uint64Root(n uint64) []byte {
+	c := make([]byte, 32)
+	binary.LittleEndian.PutUint64(c, n)
+	return c
+}
+
+// validBranch reports whether branch proves leaf at generalized index
+// gindex of the tree with the given root.
+func validBranch(leaf []byte, branch []string, gindex uint64, root []byte) bool {
+	depth := bits.Len64(gindex) - 1
+	if len(branch) != depth {
+		return false
+	}
+	v := leaf
+	for i, h := range branch {
+		sibling, err := decodeRoot(h)
+		if err != nil {
+			return false
+		}
+		if gindex>>i&1 == 1 {
+			v = hash(sibling, v)
+		} else {
+			v = hash(v, sibling)
+		}
+	}
+	return string(v) == string(root)
+}
+
+// decodeRoot decodes a 32-byte hex root.
+func decodeRoot(s string) ([]byte, error) {
+	b, err := evm.DecodeHex(s)
+	if err != nil || len(b) != 32 {
+		return nil, fmt.Errorf("invalid root %q", s)
+	}
+	return b, nil
+}
+
+// decodeFixed decodes hex data of exactly n bytes.
+func decodeFixed(s string, n int) ([]byte, error) {
+	b, err := evm.DecodeHex(s)
+	if err != nil || len(b) != n {
+		return nil, fmt.Errorf("invalid %d-byte value %q", n, s)
+	}
+	return b, nil
+}
+
+// BeaconHeader is a beacon block header as the beacon API serves it.
+type BeaconHeader struct {
+	Slot          string `json:"slot"`
+	ProposerIndex string `json:"proposer_index"`
+	ParentRoot    string `json:"parent_root"`
+	StateRoot     string `json:"state_root"`
+	BodyRoot      string `json:"body_root"`
+}
+
+func (h BeaconHeader) slot() uint64 {
+	n, _ := strconv.ParseUint(h.Slot, 10, 64)
+	return n
+}
+
+func (h BeaconHeader) root() ([]byte, error) {
+	slot, err1 := strconv.ParseUint(h.Slot, 10, 64)
+	proposer, err2 := strconv.ParseUint(h.ProposerIndex, 10, 64)
+	parent, err3 := decodeRoot(h.ParentRoot)
+	state, err4 := decodeRoot(h.StateRoot)
+	body, err5 := decodeRoot(h.BodyRoot)
+	for _, err := range []error{err1, err2, err3, err4, err5} {
+		if err != nil {
+			return nil, fmt.Errorf("invalid beacon header: %w", err)
+		}
+	}
+	return merkleize([][]byte{uint64Root(slot), uint64Root(proposer), parent, state, body}), nil
+}
+
+// ExecutionHeader is an execution payload header as the beacon API serves
+// it, from Capella on. Deneb added the blob gas fields.
+type ExecutionHeader struct {
+	ParentHash       string `json:"parent_hash"`
+	FeeRecipient     string `json:"fee_recipient"`
+	StateRoot        string `json:"state_root"`
+	ReceiptsRoot     string `json:"receipts_root"`
+	LogsBloom        string `json:"logs_bloom"`
+	PrevRandao       string `json:"prev_randao"`
+	BlockNumber      string `json:"block_number"`
+	GasLimit         string `json:"gas_limit"`
+	GasUsed          string `json:"gas_used"`
+	Timestamp        string `json:"timestamp"`
+	ExtraData        string `json:"extra_data"`
+	BaseFeePerGas    string `json:"base_fee_per_gas"`
+	BlockHash        string `json:"block_hash"`
+	TransactionsRoot string `json:"transactions_root"`
+	WithdrawalsRoot  string `json:"withdrawals_root"`
+	BlobGasUsed      string `json:"blob_gas_used,omitempty"`
+	ExcessBlobGas    string `json:"excess_blob_gas,omitempty"`
+}
+
+func (h ExecutionHeader) number() uint64 {
+	n, _ := strconv.ParseUint(h.BlockNumber, 10, 64)
+	return n
+}
+
+// root returns the header's hash tree root; blob says whether it has the
+// blob gas fields.
+func (h ExecutionHeader) root(blob bool) ([]byte, error) {
+	var (
+		fields [][]byte
+		bad    error
+	)
+	root32 := func(s string) {
+		b, err := decodeRoot(s)
+		if err != nil && bad == nil {
+			bad = err
+		}
+		fields = append(fields, b)
+	}
+	uint64Field := func(s string) {
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil && bad == nil {
+			bad = fmt.Errorf("invalid number %q", s)
+		}
+		fields = append(fields, uint64Root(n))
+	}
+
+	root32(h.ParentHash)
+	recipient, err := decodeFixed(h.FeeRecipient, 20)
+	if err != nil {
+		return nil, err
+	}
+	fields = append(fields, chunk(recipient))
+	root32(h.StateRoot)
+	root32(h.ReceiptsRoot)
+	bloom, err := decodeFixed(h.LogsBloom, 256)
+	if err != nil {
+		return nil, err
+	}
+	fields = append(fields, merkleize(packBytes(bloom)))
+	root32(h.PrevRandao)
+	uint64Field(h.BlockNumber)
+	uint64Field(h.GasLimit)
+	uint64Field(h.GasUsed)
+	uint64Field(h.Timestamp)
+	extra, err := evm.DecodeHex(h.ExtraData)
+	if err != nil || len(extra) > 32 {
+		return nil, fmt.Errorf("invalid extra data %q", h.ExtraData)
+	}
+	fields = append(fields, hash(chunk(extra), uint64Root(uint64(len(extra)))))
+	baseFee, ok := new(big.Int).SetString(h.BaseFeePerGas, 10)
+	if !ok || baseFee.Sign() < 0 || baseFee.BitLen() > 256 {
+		return nil, fmt.Errorf("invalid base fee %q", h.BaseFeePerGas)
+	}
+	fee := baseFee.FillBytes(make([]byte, 32))
+	for i, j := 0, 31; i < j; i, j = i+1, j-1 {
+		fee[i], fee[j] = fee[j], fee[i]
+	}
+	fields = append(fields, fee)
+	root32(h.BlockHash)
+	root32(h.TransactionsRoot)
+	root32(h.WithdrawalsRoot)
+	if blob {
+		uint64Field(h.BlobGasUsed)
+		uint64Field(h.ExcessBlobGas)
+	}
+	if bad != nil {
+		return nil, fmt.Errorf("invalid execution header: %w", bad)
+	}
+	return merkleize(fields), nil
+}
+
+// SyncCommittee is a sync committee as the beacon API serves it.
+type SyncCommittee struct {
+	Pubkeys         []string `json:"pubkeys"`
+	AggregatePubkey string   `json:"aggregate_pubkey"`
+}
+
+func (c SyncCommittee) root() ([]byte, error) {
+	keyRoot := func(s string) ([]byte, error) {
+		b, err := decodeFixed(s, 48)
+		if err != nil {
+			return nil, err
+		}
+		return hash(b[:32], chunk(b[32:])), nil
+	}
+	leaves := make([][]byte, len(c.Pubkeys))
+	for i, k := range c.Pubkeys {
+		var err error
+		if leaves[i], err = keyRoot(k); err != nil {
+			return nil, fmt.Errorf("invalid sync committee: %w", err)
+		}
+	}
+	agg, err := keyRoot(c.AggregatePubkey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sync committee: %w", err)
+	}
+	return hash(merkleize(leaves), agg), nil
+}
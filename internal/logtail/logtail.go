@@ -0,0 +1,189 @@
+// Package logtail keeps the server's recent structured log records in memory
+// and streams new ones to subscribers, so the dashboard can show live logs
+// without shell access to the host.
+package logtail
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is one log record.
+type Entry struct {
+	Time      time.Time         `json:"time"`
+	Level     string            `json:"level"`               // DEBUG, INFO, WARN, ERROR
+	Subsystem string            `json:"subsystem,omitempty"` // from the "subsystem" attribute
+	Message   string            `json:"msg"`
+	Attrs     map[string]string `json:"attrs,omitempty"`
+}
+
+// Filter selects entries by minimum level and subsystem.
+type Filter struct {
+	Level     slog.Level
+	Subsystem string // empty matches every subsystem
+}
+
+// Match reports whether e passes the filter.
+func (f Filter) Match(e Entry) bool {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(e.Level)); err != nil {
+		return false
+	}
+	return lvl >= f.Level && (f.Subsystem == "" || e.Subsystem == f.Subsystem)
+}
+
+// Tail is a slog.Handler that records every entry, down to debug level, and
+// passes those the next handler accepts on to it.
+type Tail struct {
+	next   slog.Handler
+	buf    *buffer
+	attrs  []slog.Attr // from Logger.With, keys already group-prefixed
+	prefix string      // open groups, "a.b."
+}
+
+type buffer struct {
+	mu      sync.Mutex
+	entries []Entry // ring, oldest at start
+	size    int
+	subs    map[chan Entry]struct{}
+}
+
+// New wraps next, keeping the last size entries.
+func New(next slog.Handler, size int) *Tail {
+	return &Tail{next: next, buf: &buffer{size: size, subs: map[chan Entry]struct{}{}}}
+}
+
+// Recent returns buffered entries matching f, oldest first.
+func (t *Tail) Recent(f Filter) []Entry {
+	t.buf.mu.Lock()
+	defer t.buf.mu.Unlock()
+	out := []Entry{}
+	for _, e := range t.buf.entries {
+		if f.Match(e) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Subsystems lists the subsystems seen in the buffer.
+func (t *Tail) Subsystems() []string {
+	t.buf.mu.Lock()
+	defer t.buf.mu.Unlock()
+	seen := map[string]bool{}
+	out := []string{}
+	for _, e := range t.buf.entries {
+		if e.Subsystem != "" && !seen[e.Subsystem] {
+			seen[e.Subsystem] = true
+			out = append(out, e.Subsystem)
+		}
+	}
+	return out
+}
+
+// Subscribe returns a channel receiving new entries until cancel is called.
+// Entries are dropped rather than blocking logging when the subscriber
+// falls behind.
+func (t *Tail) Subscribe() (<-chan Entry, func()) {
+	ch := make(chan Entry, 64)
+	t.buf.mu.Lock()
+	t.buf.subs[ch] = struct{}{}
+	t.buf.mu.Unlock()
+	return ch, func() {
+		t.buf.mu.Lock()
+		defer t.buf.mu.Unlock()
+		if _, ok := t.buf.subs[ch]; ok {
+			delete(t.buf.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (t *Tail) Enabled(context.Context, slog.Level) bool { return true }
+
+func (t *Tail) Handle(ctx context.Context, r slog.Record) error {
+	e := Entry{
+		Time:    r.Time,
+		Level:   r.Level.String(),
+		Message: r.Message,
+	}
+	for _, a := range t.attrs {
+		e.add("", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		e.add(t.prefix, a)
+		return true
+	})
+	t.buf.add(e)
+
+	if t.next.Enabled(ctx, r.Level) {
+		return t.next.Handle(ctx, r)
+	}
+	return nil
+}
+
+func (t *Tail) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := *t
+	out.next = t.next.WithAttrs(attrs)
+	out.attrs = append([]slog.Attr(nil), t.attrs...)
+	for _, a := range attrs {
+		a.Key = t.prefix + a.Key
+		out.attrs = append(out.attrs, a)
+	}
+	return &out
+}
+
+func (t *Tail) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return t
+	}
+	out := *t
+	out.next = t.next.WithGroup(name)
+	out.prefix = t.prefix + name + "."
+	return &out
+}
+
+// add flattens a into the entry, lifting "subsystem" out of the attributes.
+func (e *Entry) add(prefix string, a slog.Attr) {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, g := range v.Group() {
+			e.add(prefix, g)
+		}
+		return
+	}
+	if a.Key == "" {
+		return
+	}
+	key := prefix + a.Key
+	if key == "subsystem" {
+		e.Subsystem = v.String()
+		return
+	}
+	if e.Attrs == nil {
+		e.Attrs = map[string]string{}
+	}
+	e.Attrs[key] = strings.TrimSpace(v.String())
+}
+
+func (b *buffer) add(e Entry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.entries) == b.size {
+		copy(b.entries, b.entries[1:])
+		b.entries = b.entries[:len(b.entries)-1]
+	}
+	b.entries = append(b.entries, e)
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
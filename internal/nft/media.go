@@ -0,0 +1,272 @@
+package nft
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/primal-host/wallet/internal/atomicfile"
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/ipfs"
+)
+
+// ErrNotFound is returned when a token has no image, or it can't be had.
+var ErrNotFound = errors.New("image not found")
+
+const (
+	fetchTimeout    = 15 * time.Second
+	maxMetadataSize = 256 << 10
+	maxImageSize    = 5 << 20
+
+	// missTTL is how long failed metadata and image downloads are
+	// remembered before they are tried again.
+	missTTL = 24 * time.Hour
+)
+
+// Metadata is the part of a token's metadata the gallery shows.
+type Metadata struct {
+	URI         string    `json:"uri"` // tokenURI or uri, as the contract returns it
+	Name        string    `json:"name,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Image       string    `json:"image,omitempty"` // as the metadata gives it; Image serves it
+	Error       string    `json:"error,omitempty"` // why the metadata couldn't be read
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+// Image is a cached token image.
+type Image struct {
+	Data        []byte
+	ContentType string
+}
+
+// cachedMetadata returns a token's metadata from the cache. A failure is
+// kept for missTTL, after which the token counts as not cached.
+func (x *Index) cachedMetadata(chainID uint64, s seen) (*Metadata, bool) {
+	data, err := os.ReadFile(x.metadataPath(chainID, s.Contract, s.TokenID))
+	if err != nil {
+		return nil, false
+	}
+	var m Metadata
+	if json.Unmarshal(data, &m) != nil || (m.Error != "" && time.Since(m.FetchedAt) > missTTL) {
+		return nil, false
+	}
+	return &m, true
+}
+
+// fetchMetadata reads a token's metadata URI from its contract, downloads
+// the metadata, and caches it, or the reason it failed.
+func (x *Index) fetchMetadata(ctx context.Context, ep endpoint.Endpoint, chainID uint64, s seen) *Metadata {
+	m := &Metadata{FetchedAt: time.Now().UTC()}
+	err := func() error {
+		id, _ := new(big.Int).SetString(s.TokenID, 10)
+		sel := selTokenURI
+		if s.Standard == ERC1155 {
+			sel = selURI
+		}
+		out, err := endpoint.EthCall(ctx, ep, s.Contract, sel, uintWord(id))
+		if err != nil {
+			return fmt.Errorf("read metadata URI: %w", err)
+		}
+		if m.URI, err = decodeString(out); err != nil {
+			return fmt.Errorf("read metadata URI: %w", err)
+		}
+		uri := m.URI
+		if s.Standard == ERC1155 {
+			// ERC-1155 clients substitute the ID as 64 lowercase hex digits.
+			uri = strings.ReplaceAll(uri, "{id}", fmt.Sprintf("%064x", id))
+		}
+		data, err := x.get(ctx, uri, maxMetadataSize)
+		if err != nil {
+			return err
+		}
+		var doc struct {
+			Name        string `json:"name"`
+			Description string `json:"description"`
+			Image       string `json:"image"`
+			ImageURL    string `json:"image_url"`
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("parse metadata: %w", err)
+		}
+		m.Name, m.Description, m.Image = doc.Name, doc.Description, doc.Image
+		if m.Image == "" {
+			m.Image = doc.ImageURL
+		}
+		return nil
+	}()
+	if err != nil {
+		if ctx.Err() != nil {
+			// The browser went away; try again next time.
+			return nil
+		}
+		m.Error = err.Error()
+	}
+	if data, err := json.Marshal(m); err == nil {
+		_ = atomicfile.Write(x.metadataPath(chainID, s.Contract, s.TokenID), data)
+	}
+	return m
+}
+
+// Image returns a token's image, downloading it on the first request. Its
+// metadata must have been fetched by Inventory.
+func (x *Index) Image(ctx context.Context, chainID uint64, contract, tokenID string) (Image, error) {
+	m, ok := x.cachedMetadata(chainID, seen{Contract: strings.ToLower(contract), TokenID: tokenID})
+	if !ok || m.Image == "" {
+		return Image{}, ErrNotFound
+	}
+	sum := sha256.Sum256([]byte(m.Image))
+	path := filepath.Join(x.dir, "images", hex.EncodeToString(sum[:16]))
+	if data, err := os.ReadFile(path); err == nil {
+		return Image{Data: data, ContentType: http.DetectContentType(data)}, nil
+	}
+	if info, err := os.Stat(path + ".miss"); err == nil && time.Since(info.ModTime()) < missTTL {
+		return Image{}, ErrNotFound
+	}
+	data, err := x.get(ctx, m.Image, maxImageSize)
+	if err == nil && !isImage(http.DetectContentType(data)) {
+		err = errors.New("not a PNG, JPEG, GIF, or WebP image")
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			_ = os.WriteFile(path+".miss", []byte(err.Error()+"\n"), 0644)
+		}
+		return Image{}, ErrNotFound
+	}
+	if err := atomicfile.Write(path, data); err != nil {
+		return Image{}, fmt.Errorf("write nft cache: %w", err)
+	}
+	return Image{Data: data, ContentType: http.DetectContentType(data)}, nil
+}
+
+// isImage reports whether contentType is a raster format. SVG is refused:
+// served from the wallet's origin, its scripts would run there, and token
+// contracts choose what it holds.
+func isImage(contentType string) bool {
+	switch contentType {
+	case "image/png", "image/jpeg", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+// get returns the contents of a metadata or image URI: data: URIs inline,
+// ipfs:// and gateway URLs through the IPFS cache, ar:// through
+// arweave.net, and other http(s) URLs as they are.
+func (x *Index) get(ctx context.Context, uri string, limit int64) ([]byte, error) {
+	if rest, ok := strings.CutPrefix(uri, "data:"); ok {
+		return decodeDataURI(rest, limit)
+	}
+	if path, ok := ipfs.PathOf(uri); ok {
+		content, err := x.ipfs.Get(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(content.Data)) > limit {
+			return nil, fmt.Errorf("%s is larger than %d bytes", truncate(uri), limit)
+		}
+		return content.Data, nil
+	}
+	switch {
+	case strings.HasPrefix(uri, "ar://"):
+		uri = "https://arweave.net/" + strings.TrimPrefix(uri, "ar://")
+	case strings.HasPrefix(uri, "https://"), strings.HasPrefix(uri, "http://"):
+	default:
+		return nil, fmt.Errorf("unsupported URI %q", truncate(uri))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := x.public.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: HTTP %d", truncate(uri), resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s is larger than %d bytes", truncate(uri), limit)
+	}
+	return data, nil
+}
+
+// decodeDataURI decodes what follows "data:" in a data: URI.
+func decodeDataURI(rest string, limit int64) ([]byte, error) {
+	meta, payload, ok := strings.Cut(rest, ",")
+	if !ok {
+		return nil, errors.New("malformed data: URI")
+	}
+	var data []byte
+	if strings.HasSuffix(meta, ";base64") {
+		var err error
+		if data, err = base64.StdEncoding.DecodeString(payload); err != nil {
+			return nil, fmt.Errorf("malformed data: URI: %w", err)
+		}
+	} else {
+		s, err := url.PathUnescape(payload)
+		if err != nil {
+			return nil, fmt.Errorf("malformed data: URI: %w", err)
+		}
+		data = []byte(s)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("data: URI is larger than %d bytes", limit)
+	}
+	return data, nil
+}
+
+// publicClient returns a client that only connects to public addresses.
+// Token contracts choose the URLs it fetches, so without this one could
+// point the server at itself or its network.
+func publicClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: fetchTimeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+				return fmt.Errorf("%s is not a public address", host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout:   fetchTimeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: fetchTimeout},
+	}
+}
+
+func (x *Index) metadataPath(chainID uint64, contract, tokenID string) string {
+	sum := sha256.Sum256(fmt.Appendf(nil, "%d:%s:%s", chainID, contract, tokenID))
+	return filepath.Join(x.dir, "metadata", hex.EncodeToString(sum[:16])+".json")
+}
+
+// truncate shortens a URI for an error message; data: URIs can be long.
+func truncate(uri string) string {
+	if len(uri) > 80 {
+		return uri[:80] + "..."
+	}
+	return uri
+}
@@ -0,0 +1,492 @@
+// Package nft finds the ERC-721 and ERC-1155 tokens an address holds and
+// caches their metadata and images. Holdings come from Transfer logs,
+// indexed a range of blocks at a time and resumed on the next request, and
+// from tokenOfOwnerByIndex on ERC-721 contracts that are enumerable, which
+// also finds tokens received before the indexed range. Every token found is
+// checked against ownerOf or balanceOf before it is listed.
+package nft
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+	"github.com/primal-host/wallet/internal/ipfs"
+)
+
+// Standard is a token standard.
+type Standard string
+
+const (
+	ERC721  Standard = "erc721"
+	ERC1155 Standard = "erc1155"
+)
+
+const (
+	// logRange is the block range of one eth_getLogs request to start
+	// with. It is halved for a holder whenever an endpoint refuses a range.
+	logRange = 10000
+
+	// budget bounds how long one request spends indexing logs and fetching
+	// metadata before it returns what it has.
+	budget = 10 * time.Second
+
+	// maxEnumerated bounds the tokens read from one enumerable contract.
+	maxEnumerated = 200
+
+	// interfaceEnumerable is the ERC-165 ID of ERC721Enumerable.
+	interfaceEnumerable = "780e9d63"
+)
+
+var (
+	topicTransfer       = evm.EncodeHex(evm.Keccak256([]byte("Transfer(address,address,uint256)")))
+	topicTransferSingle = evm.EncodeHex(evm.Keccak256([]byte("TransferSingle(address,address,address,uint256,uint256)")))
+	topicTransferBatch  = evm.EncodeHex(evm.Keccak256([]byte("TransferBatch(address,address,address,uint256[],uint256[])")))
+
+	selOwnerOf             = selector("ownerOf(uint256)")
+	selBalanceOf           = selector("balanceOf(address)")
+	selBalanceOfID         = selector("balanceOf(address,uint256)")
+	selTokenOfOwnerByIndex = selector("tokenOfOwnerByIndex(address,uint256)")
+	selSupportsInterface   = selector("supportsInterface(bytes4)")
+	selTokenURI            = selector("tokenURI(uint256)")
+	selURI                 = selector("uri(uint256)")
+	selName                = selector("name()")
+)
+
+// Token is an NFT an address holds.
+type Token struct {
+	Contract   string    `json:"contract"`
+	TokenID    string    `json:"token_id"` // decimal
+	Standard   Standard  `json:"standard"`
+	Balance    string    `json:"balance"`              // decimal; 1 for ERC-721
+	Collection string    `json:"collection,omitempty"` // the contract's name()
+	Metadata   *Metadata `json:"metadata,omitempty"`   // nil until fetched
+}
+
+// Inventory is what is known of an address's NFTs on one endpoint's chain.
+type Inventory struct {
+	Endpoint  string  `json:"endpoint"`
+	ChainID   uint64  `json:"chain_id"`
+	Address   string  `json:"address"`
+	IndexedTo uint64  `json:"indexed_to"` // last block whose logs are indexed
+	Head      uint64  `json:"head"`
+	Complete  bool    `json:"complete"` // indexed to head, and every token's metadata fetched or tried
+	Tokens    []Token `json:"tokens"`
+}
+
+// seen is a token an address has received, whether or not it still holds
+// it.
+type seen struct {
+	Contract string   `json:"contract"`
+	TokenID  string   `json:"token_id"`
+	Standard Standard `json:"standard"`
+}
+
+// holder is the indexing state of one address on one chain.
+type holder struct {
+	Next       uint64          `json:"next"`  // first block not yet indexed
+	Range      uint64          `json:"range"` // blocks per eth_getLogs request
+	Seen       []seen          `json:"seen"`
+	Enumerable map[string]bool `json:"enumerable"` // ERC-721 contracts, by lowercase address
+}
+
+// Index keeps the indexing state of every address asked about in a
+// directory, with the metadata and image caches.
+type Index struct {
+	dir    string
+	ipfs   *ipfs.Cache
+	public *http.Client // for URLs from token contracts; refuses private addresses
+
+	mu      sync.Mutex
+	holders map[string]*holder // "chainID:lowercase address"
+	names   map[string]string  // "chainID:lowercase contract" -> name()
+}
+
+// New returns an index in dir, creating it. IPFS metadata and images are
+// fetched through cache.
+func New(dir string, cache *ipfs.Cache) (*Index, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "metadata"), 0755); err != nil {
+		return nil, fmt.Errorf("create nft dir: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "images"), 0755); err != nil {
+		return nil, fmt.Errorf("create nft dir: %w", err)
+	}
+	x := &Index{
+		dir:     dir,
+		ipfs:    cache,
+		public:  publicClient(),
+		holders: map[string]*holder{},
+		names:   map[string]string{},
+	}
+	data, err := os.ReadFile(x.indexPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return x, nil
+		}
+		return nil, fmt.Errorf("read nft index: %w", err)
+	}
+	if err := json.Unmarshal(data, &x.holders); err != nil {
+		return nil, fmt.Errorf("parse nft index: %w", err)
+	}
+	return x, nil
+}
+
+// Inventory indexes owner's Transfer logs on ep's chain for up to the
+// request budget, then returns the tokens owner holds now. fromBlock is
+// where indexing starts the first time an address is asked about; later
+// requests resume where the last one stopped. Call again until Complete.
+func (x *Index) Inventory(ctx context.Context, ep endpoint.Endpoint, owner evm.Address, fromBlock uint64) (Inventory, error) {
+	deadline := time.Now().Add(budget)
+	chainID, err := quantity(ctx, ep, "eth_chainId")
+	if err != nil {
+		return Inventory{}, err
+	}
+	head, err := quantity(ctx, ep, "eth_blockNumber")
+	if err != nil {
+		return Inventory{}, err
+	}
+	key := fmt.Sprintf("%d:%s", chainID, strings.ToLower(owner.Hex()))
+	h := x.holder(key, fromBlock)
+
+	for h.Next <= head && time.Now().Before(deadline) && ctx.Err() == nil {
+		to := min(h.Next+h.Range-1, head)
+		found, err := transfers(ctx, ep, owner, h.Next, to)
+		if err != nil {
+			// Endpoints cap the range, or the results, of one request.
+			if h.Range > 1 {
+				h.Range /= 2
+				continue
+			}
+			return Inventory{}, fmt.Errorf("read logs: %w", err)
+		}
+		h.add(found...)
+		h.Next = to + 1
+	}
+
+	for _, c := range h.contracts(ERC721) {
+		enumerable, known := h.Enumerable[c]
+		if !known {
+			enumerable = supports(ctx, ep, c, interfaceEnumerable)
+			h.Enumerable[c] = enumerable
+		}
+		if enumerable {
+			h.add(enumerate(ctx, ep, c, owner)...)
+		}
+	}
+	if err := x.save(key, h); err != nil {
+		return Inventory{}, err
+	}
+
+	inv := Inventory{
+		Endpoint: ep.ID,
+		ChainID:  chainID,
+		Address:  owner.Hex(),
+		Head:     head,
+		Complete: h.Next > head,
+		Tokens:   []Token{},
+	}
+	if h.Next > 0 {
+		inv.IndexedTo = h.Next - 1
+	}
+	for _, s := range h.Seen {
+		balance := held(ctx, ep, s, owner)
+		if balance.Sign() == 0 {
+			continue
+		}
+		t := Token{Contract: s.Contract, TokenID: s.TokenID, Standard: s.Standard, Balance: balance.String(), Collection: x.name(ctx, ep, chainID, s.Contract)}
+		m, cached := x.cachedMetadata(chainID, s)
+		if !cached && time.Now().Before(deadline) && ctx.Err() == nil {
+			if m = x.fetchMetadata(ctx, ep, chainID, s); m != nil {
+				cached = true
+			}
+		}
+		if !cached {
+			inv.Complete = false
+		}
+		t.Metadata = m
+		inv.Tokens = append(inv.Tokens, t)
+	}
+	return inv, nil
+}
+
+// holder returns a copy of the state of key, or a new one starting at
+// fromBlock.
+func (x *Index) holder(key string, fromBlock uint64) *holder {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	h, ok := x.holders[key]
+	if !ok {
+		return &holder{Next: fromBlock, Range: logRange, Seen: []seen{}, Enumerable: map[string]bool{}}
+	}
+	c := *h
+	c.Seen = slices.Clone(h.Seen)
+	c.Enumerable = make(map[string]bool, len(h.Enumerable))
+	for k, v := range h.Enumerable {
+		c.Enumerable[k] = v
+	}
+	return &c
+}
+
+// save stores h as the state of key, merged with any progress another
+// request made meanwhile, and writes the index.
+func (x *Index) save(key string, h *holder) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if old, ok := x.holders[key]; ok {
+		h.Next = max(h.Next, old.Next)
+		h.add(old.Seen...)
+		for k, v := range old.Enumerable {
+			if _, ok := h.Enumerable[k]; !ok {
+				h.Enumerable[k] = v
+			}
+		}
+	}
+	x.holders[key] = h
+	data, err := json.MarshalIndent(x.holders, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal nft index: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(x.indexPath(), data, 0644); err != nil {
+		return fmt.Errorf("write nft index: %w", err)
+	}
+	return nil
+}
+
+func (x *Index) indexPath() string {
+	return filepath.Join(x.dir, "index.json")
+}
+
+// name returns a contract's name(), remembered until restart.
+func (x *Index) name(ctx context.Context, ep endpoint.Endpoint, chainID uint64, contract string) string {
+	key := fmt.Sprintf("%d:%s", chainID, contract)
+	x.mu.Lock()
+	name, ok := x.names[key]
+	x.mu.Unlock()
+	if ok {
+		return name
+	}
+	if out, err := endpoint.EthCall(ctx, ep, contract, selName); err == nil {
+		name, _ = decodeString(out)
+	}
+	x.mu.Lock()
+	x.names[key] = name
+	x.mu.Unlock()
+	return name
+}
+
+// add records tokens not seen before.
+func (h *holder) add(tokens ...seen) {
+	for _, t := range tokens {
+		if !slices.Contains(h.Seen, t) {
+			h.Seen = append(h.Seen, t)
+		}
+	}
+}
+
+// contracts lists the contracts of one standard the holder has received
+// tokens from.
+func (h *holder) contracts(std Standard) []string {
+	var out []string
+	for _, s := range h.Seen {
+		if s.Standard == std && !slices.Contains(out, s.Contract) {
+			out = append(out, s.Contract)
+		}
+	}
+	return out
+}
+
+// rpcLog is an eth_getLogs result entry.
+type rpcLog struct {
+	Address string   `json:"address"`
+	Topics  []string `json:"topics"`
+	Data    string   `json:"data"`
+}
+
+// transfers returns the tokens sent to owner between two blocks.
+func transfers(ctx context.Context, ep endpoint.Endpoint, owner evm.Address, from, to uint64) ([]seen, error) {
+	ownerTopic := evm.EncodeHex(append(make([]byte, 12), owner[:]...))
+	var out []seen
+	for _, filter := range []struct {
+		topics []any
+	}{
+		// ERC-20 Transfer has the same signature with the amount in data,
+		// so only logs with the token ID as a fourth topic are ERC-721.
+		{[]any{topicTransfer, nil, ownerTopic}},
+		{[]any{[]string{topicTransferSingle, topicTransferBatch}, nil, nil, ownerTopic}},
+	} {
+		result, err := endpoint.RPCCall(ctx, ep, "eth_getLogs", []any{map[string]any{
+			"fromBlock": evm.EncodeQuantity(new(big.Int).SetUint64(from)),
+			"toBlock":   evm.EncodeQuantity(new(big.Int).SetUint64(to)),
+			"topics":    filter.topics,
+		}})
+		if err != nil {
+			return nil, err
+		}
+		var logs []rpcLog
+		if err := json.Unmarshal(result, &logs); err != nil {
+			return nil, fmt.Errorf("unexpected eth_getLogs result: %w", err)
+		}
+		for _, l := range logs {
+			if len(l.Topics) == 0 {
+				continue
+			}
+			contract := strings.ToLower(l.Address)
+			data, err := evm.DecodeHex(l.Data)
+			if err != nil {
+				continue
+			}
+			switch {
+			case l.Topics[0] == topicTransfer && len(l.Topics) == 4:
+				if id, err := evm.ParseQuantity(l.Topics[3]); err == nil {
+					out = append(out, seen{contract, id.String(), ERC721})
+				}
+			case l.Topics[0] == topicTransferSingle && len(data) >= 64:
+				out = append(out, seen{contract, new(big.Int).SetBytes(data[:32]).String(), ERC1155})
+			case l.Topics[0] == topicTransferBatch:
+				ids, err := decodeUints(data, 0)
+				if err != nil {
+					continue
+				}
+				for _, id := range ids {
+					out = append(out, seen{contract, id.String(), ERC1155})
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// enumerate lists owner's tokens in an ERC721Enumerable contract.
+func enumerate(ctx context.Context, ep endpoint.Endpoint, contract string, owner evm.Address) []seen {
+	out, err := endpoint.EthCall(ctx, ep, contract, selBalanceOf, addressWord(owner))
+	if err != nil || len(out) < 32 {
+		return nil
+	}
+	n := new(big.Int).SetBytes(out[:32])
+	if !n.IsInt64() || n.Int64() > maxEnumerated {
+		n = big.NewInt(maxEnumerated)
+	}
+	var tokens []seen
+	for i := range n.Int64() {
+		out, err := endpoint.EthCall(ctx, ep, contract, selTokenOfOwnerByIndex, addressWord(owner), uintWord(big.NewInt(i)))
+		if err != nil || len(out) < 32 {
+			break
+		}
+		tokens = append(tokens, seen{contract, new(big.Int).SetBytes(out[:32]).String(), ERC721})
+	}
+	return tokens
+}
+
+// supports reports whether a contract implements an ERC-165 interface.
+func supports(ctx context.Context, ep endpoint.Endpoint, contract, interfaceID string) bool {
+	id, _ := evm.DecodeHex(interfaceID)
+	out, err := endpoint.EthCall(ctx, ep, contract, selSupportsInterface, append(id, make([]byte, 28)...))
+	return err == nil && len(out) >= 32 && out[31] == 1
+}
+
+// held returns how many of a token owner holds now: 0 or 1 for ERC-721.
+func held(ctx context.Context, ep endpoint.Endpoint, s seen, owner evm.Address) *big.Int {
+	id, _ := new(big.Int).SetString(s.TokenID, 10)
+	if s.Standard == ERC721 {
+		out, err := endpoint.EthCall(ctx, ep, s.Contract, selOwnerOf, uintWord(id))
+		if err != nil || len(out) < 32 || [20]byte(out[12:32]) != owner {
+			return new(big.Int)
+		}
+		return big.NewInt(1)
+	}
+	out, err := endpoint.EthCall(ctx, ep, s.Contract, selBalanceOfID, addressWord(owner), uintWord(id))
+	if err != nil || len(out) < 32 {
+		return new(big.Int)
+	}
+	return new(big.Int).SetBytes(out[:32])
+}
+
+// quantity makes a call without parameters that returns a hex quantity.
+func quantity(ctx context.Context, ep endpoint.Endpoint, method string) (uint64, error) {
+	result, err := endpoint.RPCCall(ctx, ep, method, []any{})
+	if err != nil {
+		return 0, err
+	}
+	var s string
+	if err := json.Unmarshal(result, &s); err != nil {
+		return 0, fmt.Errorf("unexpected %s result: %s", method, result)
+	}
+	n, err := evm.ParseQuantity(s)
+	if err != nil || !n.IsUint64() {
+		return 0, fmt.Errorf("unexpected %s result: %s", method, result)
+	}
+	return n.Uint64(), nil
+}
+
+func selector(sig string) []byte {
+	return evm.Keccak256([]byte(sig))[:4]
+}
+
+func uintWord(n *big.Int) []byte {
+	return n.FillBytes(make([]byte, 32))
+}
+
+func addressWord(a evm.Address) []byte {
+	return append(make([]byte, 12), a[:]...)
+}
+
+var errABI = errors.New("malformed ABI data")
+
+// decodeString decodes a string returned by a call.
+func decodeString(out []byte) (string, error) {
+	start, n, err := dynamicAt(out, 0)
+	if err != nil {
+		return "", err
+	}
+	if n > len(out)-start {
+		return "", errABI
+	}
+	return string(out[start : start+n]), nil
+}
+
+// decodeUints decodes the uint256[] whose offset is in the word at head.
+func decodeUints(data []byte, head int) ([]*big.Int, error) {
+	start, n, err := dynamicAt(data, head)
+	if err != nil {
+		return nil, err
+	}
+	if n > (len(data)-start)/32 {
+		return nil, errABI
+	}
+	out := make([]*big.Int, n)
+	for i := range out {
+		out[i] = new(big.Int).SetBytes(data[start+i*32 : start+i*32+32])
+	}
+	return out, nil
+}
+
+// dynamicAt follows the offset in the word at head to a dynamic value and
+// returns where its contents start and its length: bytes for a string,
+// elements for an array.
+func dynamicAt(data []byte, head int) (start, n int, err error) {
+	if len(data) < head+32 {
+		return 0, 0, errABI
+	}
+	off := new(big.Int).SetBytes(data[head : head+32])
+	if !off.IsInt64() || off.Int64() > int64(len(data)-32) {
+		return 0, 0, errABI
+	}
+	start = int(off.Int64()) + 32
+	length := new(big.Int).SetBytes(data[start-32 : start])
+	if !length.IsInt64() || length.Int64() > int64(len(data)) {
+		return 0, 0, errABI
+	}
+	return start, int(length.Int64()), nil
+}
@@ -0,0 +1,363 @@
+// Package notify delivers notifications — an alert firing, an endpoint
+// coming back — over channels kept in a JSON file: a generic webhook, a
+// Telegram bot, SMTP email, or an ntfy topic. Each type of channel is a
+// Sender registered under its name, so new ones plug in beside them.
+// Channels hold bot tokens and passwords, so the file is kept private and
+// List leaves them out.
+package notify
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sendTimeout bounds one delivery.
+const sendTimeout = 15 * time.Second
+
+// Notification kinds besides the alert kinds.
+const (
+	KindTest = "test" // the notification Test sends
+	KindTx   = "tx"   // a journaled send confirmed, failed, or was reorged out
+)
+
+// Notification is something to tell the server's users about as it
+// happens.
+type Notification struct {
+	Kind    string    `json:"kind"` // what it is about, e.g. gas
+	Message string    `json:"message"`
+	Alert   any       `json:"alert,omitempty"` // the alert that fired
+	At      time.Time `json:"at"`
+}
+
+// Title is a short heading for n, for channels that have one.
+func (n Notification) Title() string {
+	if n.Kind == KindTx {
+		return "Wallet transaction"
+	}
+	return "Wallet " + n.Kind + " alert"
+}
+
+// Channel is somewhere notifications are delivered. Which fields it uses
+// depends on its type.
+type Channel struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Kinds    []string `json:"kinds,omitempty"` // the notification kinds it gets; all when empty
+	Disabled bool     `json:"disabled,omitempty"`
+
+	URL string `json:"url,omitempty"` // webhook: where to POST; ntfy: the topic, e.g. https://ntfy.sh/my-wallet
+
+	BotToken string `json:"bot_token,omitempty"` // telegram
+	ChatID   string `json:"chat_id,omitempty"`   // telegram
+
+	SMTPHost string   `json:"smtp_host,omitempty"` // email: host:port; port 465 is TLS from the start, others use STARTTLS when offered
+	Username string   `json:"username,omitempty"`  // email: SMTP login, if the server needs one
+	Password string   `json:"password,omitempty"`  // email
+	From     string   `json:"from,omitempty"`      // email
+	To       []string `json:"to,omitempty"`        // email
+
+	Token string `json:"token,omitempty"` // ntfy: access token for a protected topic
+
+	LastSentAt *time.Time `json:"last_sent_at,omitempty"`
+	LastError  string     `json:"last_error,omitempty"` // why the last delivery failed
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Wants reports whether c gets notifications of kind.
+func (c Channel) Wants(kind string) bool {
+	return !c.Disabled && (len(c.Kinds) == 0 || slices.Contains(c.Kinds, kind))
+}
+
+// Redacted returns c without its secrets, for showing.
+func (c Channel) Redacted() Channel {
+	c.BotToken, c.Password, c.Token = redact(c.BotToken), redact(c.Password), redact(c.Token)
+	c.Kinds = slices.Clone(c.Kinds)
+	c.To = slices.Clone(c.To)
+	return c
+}
+
+// redacted stands in for a secret that is set.
+const redacted = "********"
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redacted
+}
+
+// Sender delivers notifications over one type of channel.
+type Sender interface {
+	// Validate normalizes the fields c's type uses and checks them.
+	Validate(c *Channel) error
+	// Send delivers n over c.
+	Send(ctx context.Context, c Channel, n Notification) error
+}
+
+var (
+	sendersMu sync.RWMutex
+	senders   = map[string]Sender{}
+)
+
+// Register makes a type of channel available under name.
+func Register(name string, s Sender) {
+	sendersMu.Lock()
+	defer sendersMu.Unlock()
+	senders[name] = s
+}
+
+// Types returns the names of the registered types of channel, sorted.
+func Types() []string {
+	sendersMu.RLock()
+	defer sendersMu.RUnlock()
+	return typesLocked()
+}
+
+func senderFor(typ string) (Sender, error) {
+	sendersMu.RLock()
+	defer sendersMu.RUnlock()
+	s, ok := senders[typ]
+	if !ok {
+		return nil, fmt.Errorf("unknown type %q: use %s", typ, strings.Join(typesLocked(), ", "))
+	}
+	return s, nil
+}
+
+// typesLocked returns the registered types, sorted. Must be called with
+// sendersMu held.
+func typesLocked() []string {
+	out := make([]string, 0, len(senders))
+	for name := range senders {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Store keeps channels in a JSON file.
+type Store struct {
+	mu       sync.Mutex
+	channels []Channel // oldest first
+	path     string
+}
+
+// NewStore loads channels from a JSON file. If the file doesn't exist,
+// starts empty.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path, channels: []Channel{}}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("read channels: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.channels); err != nil {
+		return nil, fmt.Errorf("parse channels: %w", err)
+	}
+	return s, nil
+}
+
+// List returns the channels oldest first, without their secrets.
+func (s *Store) List() []Channel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Channel, len(s.channels))
+	for i, c := range s.channels {
+		out[i] = c.Redacted()
+	}
+	return out
+}
+
+// Get returns a channel by ID, without its secrets.
+func (s *Store) Get(id string) (Channel, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c := s.findLocked(id); c != nil {
+		return c.Redacted(), true
+	}
+	return Channel{}, false
+}
+
+// Add validates c and stores it.
+func (s *Store) Add(c Channel) (Channel, error) {
+	if err := validate(&c); err != nil {
+		return Channel{}, err
+	}
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return Channel{}, err
+	}
+	c.ID = hex.EncodeToString(b)
+	c.CreatedAt = time.Now().UTC()
+	c.LastSentAt, c.LastError = nil, ""
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.channels
+	s.channels = append(s.channels[:len(old):len(old)], c)
+	if err := s.save(); err != nil {
+		s.channels = old
+		return Channel{}, err
+	}
+	return c.Redacted(), nil
+}
+
+// Update replaces a channel's settings. A secret left empty or redacted
+// keeps the one stored.
+func (s *Store) Update(id string, c Channel) (Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur := s.findLocked(id)
+	if cur == nil {
+		return Channel{}, fmt.Errorf("channel %q not found", id)
+	}
+	old := *cur
+	for _, f := range []struct{ next, prev *string }{{&c.BotToken, &old.BotToken}, {&c.Password, &old.Password}, {&c.Token, &old.Token}} {
+		if *f.next == "" || *f.next == redacted {
+			*f.next = *f.prev
+		}
+	}
+	if err := validate(&c); err != nil {
+		return Channel{}, err
+	}
+	c.ID, c.CreatedAt, c.LastSentAt, c.LastError = old.ID, old.CreatedAt, old.LastSentAt, old.LastError
+	*cur = c
+	if err := s.save(); err != nil {
+		*cur = old
+		return Channel{}, err
+	}
+	return c.Redacted(), nil
+}
+
+// Delete removes a channel.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.channels {
+		if s.channels[i].ID == id {
+			old := s.channels
+			s.channels = append(s.channels[:i:i], s.channels[i+1:]...)
+			if err := s.save(); err != nil {
+				s.channels = old
+				return err
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("channel %q not found", id)
+}
+
+// Deliver sends n over every enabled channel that wants its kind, in the
+// background. Failures are logged and recorded on the channel.
+func (s *Store) Deliver(n Notification) {
+	s.mu.Lock()
+	var to []Channel
+	for _, c := range s.channels {
+		if c.Wants(n.Kind) {
+			to = append(to, c)
+		}
+	}
+	s.mu.Unlock()
+	for _, c := range to {
+		go func(c Channel) {
+			if err := s.send(c, n); err != nil {
+				slog.Error("notification failed", "subsystem", "notify", "channel", c.ID, "type", c.Type, "error", err)
+			}
+		}(c)
+	}
+}
+
+// Test sends a test notification over the channel id now, even if it is
+// disabled or doesn't want test notifications.
+func (s *Store) Test(id string) error {
+	s.mu.Lock()
+	c := s.findLocked(id)
+	if c == nil {
+		s.mu.Unlock()
+		return fmt.Errorf("channel %q not found", id)
+	}
+	ch := *c
+	s.mu.Unlock()
+	return s.send(ch, Notification{Kind: KindTest, Message: "Test notification to " + ch.Name, At: time.Now().UTC()})
+}
+
+// send delivers n over c and records the outcome.
+func (s *Store) send(c Channel, n Notification) error {
+	sender, err := senderFor(c.Type)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		err = sender.Send(ctx, c, n)
+		cancel()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cur := s.findLocked(c.ID); cur != nil {
+		if err != nil {
+			cur.LastError = err.Error()
+		} else {
+			now := time.Now().UTC()
+			cur.LastSentAt, cur.LastError = &now, ""
+		}
+		if serr := s.save(); serr != nil {
+			slog.Error("channel save failed", "subsystem", "notify", "channel", c.ID, "error", serr)
+		}
+	}
+	return err
+}
+
+// validate normalizes c and checks it with its type's Sender.
+func validate(c *Channel) error {
+	c.Name = strings.TrimSpace(c.Name)
+	c.Type = strings.TrimSpace(c.Type)
+	if c.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	sender, err := senderFor(c.Type)
+	if err != nil {
+		return err
+	}
+	var kinds []string
+	for _, k := range c.Kinds {
+		if k = strings.TrimSpace(k); k != "" && !slices.Contains(kinds, k) {
+			kinds = append(kinds, k)
+		}
+	}
+	c.Kinds = kinds
+	return sender.Validate(c)
+}
+
+// findLocked finds a channel by ID. Must be called with mu held.
+func (s *Store) findLocked(id string) *Channel {
+	for i := range s.channels {
+		if s.channels[i].ID == id {
+			return &s.channels[i]
+		}
+	}
+	return nil
+}
+
+// save writes channels to disk, readable only by the owner. Must be called
+// with mu held.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.channels, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal channels: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		return fmt.Errorf("write channels: %w", err)
+	}
+	return nil
+}
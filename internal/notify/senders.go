@@ -0,0 +1,214 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Channel types.
+const (
+	TypeWebhook  = "webhook"
+	TypeTelegram = "telegram"
+	TypeEmail    = "email"
+	TypeNtfy     = "ntfy"
+)
+
+// telegramAPI is the Bot API's base URL.
+const telegramAPI = "https://api.telegram.org"
+
+func init() {
+	Register(TypeWebhook, webhook{})
+	Register(TypeTelegram, telegram{})
+	Register(TypeEmail, email{})
+	Register(TypeNtfy, ntfy{})
+}
+
+// webhook POSTs the notification as JSON, with the message in text as
+// Slack and Mattermost incoming webhooks expect.
+type webhook struct{}
+
+func (webhook) Validate(c *Channel) error {
+	return checkURL(&c.URL, "webhook url")
+}
+
+func (webhook) Send(ctx context.Context, c Channel, n Notification) error {
+	body, _ := json.Marshal(map[string]any{"text": n.Message, "kind": n.Kind, "at": n.At, "alert": n.Alert})
+	return post(ctx, c.URL, "application/json", body, nil)
+}
+
+// telegram sends the message to a chat through a bot.
+type telegram struct{}
+
+func (telegram) Validate(c *Channel) error {
+	c.BotToken, c.ChatID = strings.TrimSpace(c.BotToken), strings.TrimSpace(c.ChatID)
+	if c.BotToken == "" || c.ChatID == "" {
+		return fmt.Errorf("a telegram channel needs bot_token and chat_id")
+	}
+	return nil
+}
+
+func (telegram) Send(ctx context.Context, c Channel, n Notification) error {
+	body, _ := json.Marshal(map[string]any{"chat_id": c.ChatID, "text": n.Message, "disable_web_page_preview": true})
+	err := post(ctx, telegramAPI+"/bot"+c.BotToken+"/sendMessage", "application/json", body, nil)
+	if err != nil {
+		// The URL carries the bot token; keep it out of errors and logs.
+		err = fmt.Errorf("%s", strings.ReplaceAll(err.Error(), c.BotToken, redacted))
+	}
+	return err
+}
+
+// ntfy publishes the message to a topic on ntfy.sh or a self-hosted
+// server.
+type ntfy struct{}
+
+func (ntfy) Validate(c *Channel) error {
+	c.Token = strings.TrimSpace(c.Token)
+	if err := checkURL(&c.URL, "ntfy url"); err != nil {
+		return err
+	}
+	if u, _ := url.Parse(c.URL); strings.Trim(u.Path, "/") == "" {
+		return fmt.Errorf("the ntfy url needs a topic, e.g. https://ntfy.sh/my-wallet")
+	}
+	return nil
+}
+
+func (ntfy) Send(ctx context.Context, c Channel, n Notification) error {
+	header := http.Header{"Title": {n.Title()}, "Tags": {n.Kind}}
+	if c.Token != "" {
+		header.Set("Authorization", "Bearer "+c.Token)
+	}
+	return post(ctx, c.URL, "text/plain; charset=utf-8", []byte(n.Message), header)
+}
+
+// email sends a plain-text message through an SMTP server.
+type email struct{}
+
+func (email) Validate(c *Channel) error {
+	c.SMTPHost, c.Username = strings.TrimSpace(c.SMTPHost), strings.TrimSpace(c.Username)
+	if _, _, err := net.SplitHostPort(c.SMTPHost); err != nil {
+		return fmt.Errorf("invalid smtp_host %q: use host:port, such as smtp.example.com:587", c.SMTPHost)
+	}
+	from, err := mail.ParseAddress(c.From)
+	if err != nil {
+		return fmt.Errorf("invalid from %q", c.From)
+	}
+	c.From = from.String()
+	var to []string
+	for _, addr := range c.To {
+		if addr = strings.TrimSpace(addr); addr == "" {
+			continue
+		}
+		a, err := mail.ParseAddress(addr)
+		if err != nil {
+			return fmt.Errorf("invalid to %q", addr)
+		}
+		to = append(to, a.String())
+	}
+	if len(to) == 0 {
+		return fmt.Errorf("an email channel needs at least one to address")
+	}
+	c.To = to
+	return nil
+}
+
+func (email) Send(ctx context.Context, c Channel, n Notification) error {
+	host, port, _ := net.SplitHostPort(c.SMTPHost)
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", c.SMTPHost)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if port == "465" {
+		conn = tls.Client(conn, &tls.Config{ServerName: host})
+	}
+	cl, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer cl.Close()
+	if ok, _ := cl.Extension("STARTTLS"); ok && port != "465" {
+		if err := cl.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if c.Username != "" {
+		if err := cl.Auth(smtp.PlainAuth("", c.Username, c.Password, host)); err != nil {
+			return err
+		}
+	}
+	from, _ := mail.ParseAddress(c.From)
+	if err := cl.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, addr := range c.To {
+		to, _ := mail.ParseAddress(addr)
+		if err := cl.Rcpt(to.Address); err != nil {
+			return err
+		}
+	}
+	w, err := cl.Data()
+	if err != nil {
+		return err
+	}
+	msg := "From: " + c.From + "\r\n" +
+		"To: " + strings.Join(c.To, ", ") + "\r\n" +
+		"Subject: " + n.Title() + "\r\n" +
+		"Date: " + n.At.Format(time.RFC1123Z) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n\r\n" +
+		strings.ReplaceAll(n.Message, "\n", "\r\n") + "\r\n"
+	if _, err := io.WriteString(w, msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return cl.Quit()
+}
+
+// post sends body to target and fails on any status but 2xx.
+func post(ctx context.Context, target, contentType string, body []byte, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// checkURL trims *u and checks that it is an http or https URL.
+func checkURL(u *string, field string) error {
+	*u = strings.TrimSpace(*u)
+	parsed, err := url.Parse(*u)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid %s %q: use an http or https URL", field, *u)
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+// Package paymaster keeps ERC-4337 paymaster services per chain and asks
+// them to sponsor UserOperations through the ERC-7677 paymaster web service
+// API. Paymaster URLs usually carry an API key, so they stay on the server.
+package paymaster
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// EntryPointV07 is the ERC-4337 v0.7 EntryPoint, the default.
+const EntryPointV07 = "0x0000000071727De22E5E9d8BAf0edAc6f37da032"
+
+// Paymaster is a paymaster service for one chain.
+type Paymaster struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	ChainID    uint64 `json:"chain_id"`
+	URL        string `json:"url"`
+	EntryPoint string `json:"entry_point"`
+	// Context is passed to the service with every request, e.g. a
+	// sponsorship policy ID. A "token" entry asks an ERC-20 paymaster to
+	// charge the sender in that token instead of sponsoring outright.
+	Context   map[string]any `json:"context,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// Token is the ERC-20 the sender pays gas in, or "" when the paymaster
+// sponsors it.
+func (pm Paymaster) Token() string {
+	t, _ := pm.Context["token"].(string)
+	return t
+}
+
+// UserOperation is an ERC-4337 v0.7 UserOperation as JSON-RPC sends it,
+// with hex quantities and data.
+type UserOperation struct {
+	Sender                        string `json:"sender"`
+	Nonce                         string `json:"nonce"`
+	Factory                       string `json:"factory,omitempty"`
+	FactoryData                   string `json:"factoryData,omitempty"`
+	CallData                      string `json:"callData"`
+	CallGasLimit                  string `json:"callGasLimit"`
+	VerificationGasLimit          string `json:"verificationGasLimit"`
+	PreVerificationGas            string `json:"preVerificationGas"`
+	MaxFeePerGas                  string `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas          string `json:"maxPriorityFeePerGas"`
+	Paymaster                     string `json:"paymaster,omitempty"`
+	PaymasterVerificationGasLimit string `json:"paymasterVerificationGasLimit,omitempty"`
+	PaymasterPostOpGasLimit       string `json:"paymasterPostOpGasLimit,omitempty"`
+	PaymasterData                 string `json:"paymasterData,omitempty"`
+	Signature                     string `json:"signature"`
+}
+
+// Sponsorship is a paymaster's answer for a UserOperation: the paymaster
+// fields to put in it, and who pays for its gas.
+type Sponsorship struct {
+	Paymaster                     string `json:"paymaster"`
+	PaymasterData                 string `json:"paymaster_data"`
+	PaymasterVerificationGasLimit string `json:"paymaster_verification_gas_limit,omitempty"`
+	PaymasterPostOpGasLimit       string `json:"paymaster_post_op_gas_limit,omitempty"`
+	// Sponsor is who pays: the name the service gives, or else the
+	// paymaster's name here.
+	Sponsor string `json:"sponsor"`
+	// Token is the ERC-20 the sender pays gas in; empty when the gas is
+	// sponsored. TokenSymbol is its symbol when the token is registered.
+	Token       string `json:"token,omitempty"`
+	TokenSymbol string `json:"token_symbol,omitempty"`
+}
+
+// Store manages paymasters persisted to a JSON file.
+type Store struct {
+	mu         sync.RWMutex
+	paymasters []Paymaster
+	path       string
+}
+
+// NewStore loads paymasters from a JSON file. If the file doesn't exist,
+// starts empty.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path, paymasters: []Paymaster{}}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("read paymasters: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.paymasters); err != nil {
+		return nil, fmt.Errorf("parse paymasters: %w", err)
+	}
+	return s, nil
+}
+
+// List returns all paymasters.
+func (s *Store) List() []Paymaster {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.paymasters)
+}
+
+// Get returns a paymaster by ID.
+func (s *Store) Get(id string) (Paymaster, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, pm := range s.paymasters {
+		if pm.ID == id {
+			return pm, true
+		}
+	}
+	return Paymaster{}, false
+}
+
+// ForChain returns the first paymaster configured for a chain.
+func (s *Store) ForChain(chainID uint64) (Paymaster, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, pm := range s.paymasters {
+		if pm.ChainID == chainID {
+			return pm, true
+		}
+	}
+	return Paymaster{}, false
+}
+
+// Add validates and saves a paymaster.
+func (s *Store) Add(pm Paymaster) (Paymaster, error) {
+	pm.Name = strings.TrimSpace(pm.Name)
+	if pm.Name == "" {
+		return Paymaster{}, fmt.Errorf("name is required")
+	}
+	if pm.ChainID == 0 {
+		return Paymaster{}, fmt.Errorf("chain_id is required")
+	}
+	u, err := url.Parse(strings.TrimSpace(pm.URL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Paymaster{}, fmt.Errorf("url must be an http or https URL")
+	}
+	pm.URL = u.String()
+	if pm.EntryPoint == "" {
+		pm.EntryPoint = EntryPointV07
+	}
+	entryPoint, err := evm.ParseAddress(pm.EntryPoint)
+	if err != nil {
+		return Paymaster{}, fmt.Errorf("entry_point: %w", err)
+	}
+	pm.EntryPoint = entryPoint.Hex()
+	if t, ok := pm.Context["token"]; ok {
+		str, _ := t.(string)
+		token, err := evm.ParseAddress(str)
+		if err != nil {
+			return Paymaster{}, fmt.Errorf("context token: %w", err)
+		}
+		pm.Context["token"] = token.Hex()
+	}
+
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return Paymaster{}, err
+	}
+	pm.ID = hex.EncodeToString(id)
+	pm.CreatedAt = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.paymasters
+	s.paymasters = append(s.paymasters[:len(old):len(old)], pm)
+	if err := s.save(); err != nil {
+		s.paymasters = old
+		return Paymaster{}, err
+	}
+	return pm, nil
+}
+
+// Delete removes a paymaster.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.paymasters, func(pm Paymaster) bool { return pm.ID == id })
+	if i < 0 {
+		return fmt.Errorf("paymaster %q not found", id)
+	}
+	old := s.paymasters
+	s.paymasters = slices.Delete(slices.Clone(old), i, i+1)
+	if err := s.save(); err != nil {
+		s.paymasters = old
+		return err
+	}
+	return nil
+}
+
+// Sponsor asks pm to pay for op. It first asks for stub data
+// (pm_getPaymasterStubData), which names the sponsor and gives the
+// paymaster's gas limits, fills those in, and then asks for the final data
+// (pm_getPaymasterData) unless the stub says it is already final. op's gas
+// limits and fees should be set: the paymaster signs over them.
+func Sponsor(ctx context.Context, pm Paymaster, op UserOperation) (*Sponsorship, error) {
+	svc := endpoint.Endpoint{ID: pm.ID, Name: pm.Name, URL: pm.URL}
+	chainID := fmt.Sprintf("0x%x", pm.ChainID)
+	pmContext := pm.Context
+	if pmContext == nil {
+		pmContext = map[string]any{}
+	}
+
+	var stub struct {
+		Sponsor *struct {
+			Name string `json:"name"`
+		} `json:"sponsor"`
+		Paymaster                     string `json:"paymaster"`
+		PaymasterData                 string `json:"paymasterData"`
+		PaymasterVerificationGasLimit string `json:"paymasterVerificationGasLimit"`
+		PaymasterPostOpGasLimit       string `json:"paymasterPostOpGasLimit"`
+		IsFinal                       bool   `json:"isFinal"`
+	}
+	if err := call(ctx, svc, "pm_getPaymasterStubData", []any{op, pm.EntryPoint, chainID, pmContext}, &stub); err != nil {
+		return nil, err
+	}
+	if stub.Paymaster == "" {
+		return nil, fmt.Errorf("%s returned no paymaster; it won't sponsor this operation", pm.Name)
+	}
+	sp := &Sponsorship{
+		Paymaster:                     stub.Paymaster,
+		PaymasterData:                 stub.PaymasterData,
+		PaymasterVerificationGasLimit: stub.PaymasterVerificationGasLimit,
+		PaymasterPostOpGasLimit:       stub.PaymasterPostOpGasLimit,
+		Sponsor:                       pm.Name,
+		Token:                         pm.Token(),
+	}
+	if stub.Sponsor != nil && stub.Sponsor.Name != "" {
+		sp.Sponsor = stub.Sponsor.Name
+	}
+	if stub.IsFinal {
+		return sp, nil
+	}
+
+	op = sp.Apply(op)
+	var final struct {
+		Paymaster     string `json:"paymaster"`
+		PaymasterData string `json:"paymasterData"`
+	}
+	if err := call(ctx, svc, "pm_getPaymasterData", []any{op, pm.EntryPoint, chainID, pmContext}, &final); err != nil {
+		return nil, err
+	}
+	if final.Paymaster == "" {
+		return nil, fmt.Errorf("%s returned no paymaster data", pm.Name)
+	}
+	sp.Paymaster, sp.PaymasterData = final.Paymaster, final.PaymasterData
+	return sp, nil
+}
+
+// Apply returns op with the sponsorship's paymaster fields filled in.
+func (sp *Sponsorship) Apply(op UserOperation) UserOperation {
+	op.Paymaster = sp.Paymaster
+	op.PaymasterData = sp.PaymasterData
+	op.PaymasterVerificationGasLimit = sp.PaymasterVerificationGasLimit
+	op.PaymasterPostOpGasLimit = sp.PaymasterPostOpGasLimit
+	return op
+}
+
+func call(ctx context.Context, svc endpoint.Endpoint, method string, params []any, out any) error {
+	result, err := endpoint.RPCCall(ctx, svc, method, params)
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	if err := json.Unmarshal(result, out); err != nil {
+		return fmt.Errorf("unexpected %s result: %s", method, result)
+	}
+	return nil
+}
+
+// save writes paymasters to disk. Must be called with mu held.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.paymasters, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal paymasters: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("write paymasters: %w", err)
+	}
+	return nil
+}
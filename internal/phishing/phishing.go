@@ -0,0 +1,108 @@
+// Package phishing flags recipients that are known scam addresses, or that
+// look like an address the wallet knows without being it — what address
+// poisoning plants in a transaction history for the victim to copy.
+package phishing
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// lookalikeChars is how many hex characters at each end of an address a
+// lookalike shares with the real one. Wallets show addresses shortened to a
+// few characters at each end, and poisoning generates addresses to match
+// them; a random address matches a given one this way once in 16 million.
+const lookalikeChars = 3
+
+//go:embed scam_addresses.txt
+var bundled string
+
+// List is a set of scam addresses with their labels. A nil List is empty.
+type List struct {
+	labels map[string]string // lowercased address -> label
+}
+
+// Load returns the bundled scam list, plus the addresses in the file at
+// path when it is set. The file has one address per line with an optional
+// label after it and # comments, or is a JSON array of addresses.
+func Load(path string) (*List, error) {
+	l := &List{labels: map[string]string{}}
+	if err := l.parse(bundled); err != nil {
+		return nil, fmt.Errorf("bundled scam list: %w", err)
+	}
+	if path == "" {
+		return l, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read scam list: %w", err)
+	}
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		var addresses []string
+		if err := json.Unmarshal(data, &addresses); err != nil {
+			return nil, fmt.Errorf("parse scam list: %w", err)
+		}
+		data = []byte(strings.Join(addresses, "\n"))
+	}
+	if err := l.parse(string(data)); err != nil {
+		return nil, fmt.Errorf("parse scam list: %w", err)
+	}
+	return l, nil
+}
+
+func (l *List) parse(text string) error {
+	for n, line := range strings.Split(text, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		address, label, _ := strings.Cut(strings.TrimSpace(line), " ")
+		if address == "" {
+			continue
+		}
+		a, err := evm.ParseAddress(address)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n+1, err)
+		}
+		l.labels[strings.ToLower(a.Hex())] = strings.TrimSpace(label)
+	}
+	return nil
+}
+
+// Len returns how many addresses are listed.
+func (l *List) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.labels)
+}
+
+// Lookup reports whether address is listed, and its label.
+func (l *List) Lookup(address string) (string, bool) {
+	if l == nil {
+		return "", false
+	}
+	label, ok := l.labels[strings.ToLower(address)]
+	return label, ok
+}
+
+// Lookalike returns the first of known that shares address's first and
+// last characters but is a different address.
+func Lookalike(address string, known []string) (string, bool) {
+	a := strings.ToLower(strings.TrimPrefix(address, "0x"))
+	if len(a) != 40 {
+		return "", false
+	}
+	for _, k := range known {
+		b := strings.ToLower(strings.TrimPrefix(k, "0x"))
+		if len(b) != 40 || a == b {
+			continue
+		}
+		if a[:lookalikeChars] == b[:lookalikeChars] && a[40-lookalikeChars:] == b[40-lookalikeChars:] {
+			return k, true
+		}
+	}
+	return "", false
+}
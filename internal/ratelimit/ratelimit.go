@@ -0,0 +1,145 @@
+// Package ratelimit implements token-bucket rate limits keyed by client.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate is a number of requests allowed per period. Bursts of up to Count
+// requests are allowed; after that requests are let through as the bucket
+// refills.
+type Rate struct {
+	Count int
+	Per   time.Duration
+}
+
+// ParseRate parses a rate written as "<count>/<duration>", e.g. "600/1m".
+// An empty string or "off" means no limit and returns the zero Rate.
+func ParseRate(s string) (Rate, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "off" {
+		return Rate{}, nil
+	}
+	count, per, ok := strings.Cut(s, "/")
+	n, err := strconv.Atoi(count)
+	if !ok || err != nil || n <= 0 {
+		return Rate{}, fmt.Errorf("rate %q must be <count>/<duration>, e.g. 600/1m, or off", s)
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		return Rate{}, fmt.Errorf("rate %q must be <count>/<duration>, e.g. 600/1m, or off", s)
+	}
+	return Rate{Count: n, Per: d}, nil
+}
+
+// String formats the rate the way ParseRate reads it.
+func (r Rate) String() string {
+	if r.Count == 0 {
+		return "off"
+	}
+	return strconv.Itoa(r.Count) + "/" + r.Per.String()
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limited bool // the last request was refused
+}
+
+// Limiter keeps a token bucket per key. A nil Limiter allows everything.
+type Limiter struct {
+	rate      Rate
+	perSecond float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	allowed   uint64
+	refused   uint64
+}
+
+// New returns a limiter for rate, or nil if rate is the zero Rate.
+func New(rate Rate) *Limiter {
+	if rate.Count == 0 {
+		return nil
+	}
+	return &Limiter{
+		rate:      rate,
+		perSecond: float64(rate.Count) / rate.Per.Seconds(),
+		buckets:   map[string]*bucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow takes a token from key's bucket. If the bucket is empty it returns
+// false and how long until a token is available. first is true when key
+// has just started being refused, so callers can log once per burst.
+func (l *Limiter) Allow(key string) (ok bool, retryAfter time.Duration, first bool) {
+	if l == nil {
+		return true, 0, false
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	b, found := l.buckets[key]
+	if !found {
+		b = &bucket{tokens: float64(l.rate.Count), updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.updated = now
+	if b.tokens >= 1 {
+		b.tokens--
+		b.limited = false
+		l.allowed++
+		return true, 0, false
+	}
+	first = !b.limited
+	b.limited = true
+	l.refused++
+	wait := time.Duration(math.Ceil((1 - b.tokens) / l.perSecond * float64(time.Second)))
+	return false, wait, first
+}
+
+// refill returns b's tokens at now. Must be called with mu held.
+func (l *Limiter) refill(b *bucket, now time.Time) float64 {
+	return math.Min(float64(l.rate.Count), b.tokens+now.Sub(b.updated).Seconds()*l.perSecond)
+}
+
+// sweep forgets buckets that have refilled, since a new bucket starts full
+// anyway. It runs at most once per period. Must be called with mu held.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.rate.Per {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= float64(l.rate.Count) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Stats are a limiter's counters since startup.
+type Stats struct {
+	Limit   string `json:"limit"`
+	Allowed uint64 `json:"allowed"`
+	Limited uint64 `json:"limited"`
+	Clients int    `json:"clients"` // keys currently tracked
+}
+
+// Stats returns the limiter's counters.
+func (l *Limiter) Stats() Stats {
+	if l == nil {
+		return Stats{Limit: "off"}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Stats{Limit: l.rate.String(), Allowed: l.allowed, Limited: l.refused, Clients: len(l.buckets)}
+}
@@ -0,0 +1,121 @@
+// Package risk asks a transaction risk scanner about an unsigned
+// transaction before it is signed. Scanners are self-hosted services or
+// commercial ones behind a small adapter, reached over a webhook.
+package risk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/primal-host/wallet/internal/txbuild"
+)
+
+const (
+	// scanTimeout bounds a scan; it runs while the user waits on a preview.
+	scanTimeout = 8 * time.Second
+	// maxResponse bounds what is read from the scanner.
+	maxResponse = 1 << 20
+	// maxWarnings and maxMessage bound what a scanner can put in front of
+	// the user.
+	maxWarnings = 20
+	maxMessage  = 500
+)
+
+// Scanner analyses an unsigned transaction and returns what it finds.
+type Scanner interface {
+	Scan(ctx context.Context, env *txbuild.Envelope) ([]txbuild.Warning, error)
+}
+
+// Webhook is a Scanner that posts the envelope to a URL. The request body
+// is {"chain_id", "from", "to", "value", "data", "envelope"}; the reply is
+// {"warnings": [{"kind", "severity", "message"}]}, with severity info,
+// warning or critical.
+type Webhook struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewWebhook returns a Scanner for the webhook at rawURL. token, if set, is
+// sent as a bearer token.
+func NewWebhook(rawURL, token string) (*Webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("risk webhook %q must be an http:// or https:// URL", rawURL)
+	}
+	return &Webhook{url: rawURL, token: token, client: &http.Client{Timeout: scanTimeout}}, nil
+}
+
+// Scan posts env to the webhook and returns its warnings. Kinds are the
+// scanner's own, such as malicious_contract or drainer_signature; an
+// unknown severity is read as warning.
+func (w *Webhook) Scan(ctx context.Context, env *txbuild.Envelope) ([]txbuild.Warning, error) {
+	body, err := json.Marshal(map[string]any{
+		"chain_id": env.ChainID,
+		"from":     env.From,
+		"to":       env.Tx.To,
+		"value":    env.Tx.Value,
+		"data":     env.Tx.Data,
+		"envelope": env,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if w.token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.token)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("risk scanner: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return nil, fmt.Errorf("risk scanner: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("risk scanner: HTTP %d", resp.StatusCode)
+	}
+	var out struct {
+		Warnings []txbuild.Warning `json:"warnings"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("risk scanner: unexpected response: %w", err)
+	}
+	warnings := make([]txbuild.Warning, 0, min(len(out.Warnings), maxWarnings))
+	for _, wn := range out.Warnings {
+		if len(warnings) == maxWarnings {
+			break
+		}
+		wn.Message = strings.TrimSpace(wn.Message)
+		if wn.Message == "" {
+			continue
+		}
+		if len(wn.Message) > maxMessage {
+			wn.Message = wn.Message[:maxMessage]
+		}
+		if wn.Kind == "" {
+			wn.Kind = "risk"
+		}
+		switch wn.Severity {
+		case txbuild.SeverityInfo, txbuild.SeverityWarning, txbuild.SeverityCritical:
+		default:
+			wn.Severity = txbuild.SeverityWarning
+		}
+		warnings = append(warnings, wn)
+	}
+	return warnings, nil
+}
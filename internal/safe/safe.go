@@ -0,0 +1,315 @@
+// Package safe works with Safe (formerly Gnosis Safe) multisig accounts:
+// it reads a Safe's owners, threshold, and nonce from the chain, builds and
+// hashes Safe transactions, and talks to the Safe Transaction Service that
+// collects owners' signatures off-chain.
+package safe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/erc20"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// Operations a Safe transaction can perform.
+const (
+	OpCall         = 0
+	OpDelegateCall = 1
+)
+
+const (
+	// safeTxType is the EIP-712 type of a Safe transaction since v1.0.0.
+	safeTxType = "SafeTx(address to,uint256 value,bytes data,uint8 operation,uint256 safeTxGas,uint256 baseGas,uint256 gasPrice,address gasToken,address refundReceiver,uint256 nonce)"
+	// legacyDomainType is the EIP-712 domain of Safes before v1.3.0.
+	legacyDomainType = "EIP712Domain(address verifyingContract)"
+	// maxOwners bounds getOwners() so a hostile contract can't make the
+	// decoder allocate without limit.
+	maxOwners = 256
+)
+
+// Info is a Safe as the chain sees it.
+type Info struct {
+	Address         string   `json:"address"`
+	ChainID         uint64   `json:"chain_id"`
+	Version         string   `json:"version"`
+	Owners          []string `json:"owners"`
+	Threshold       uint64   `json:"threshold"`
+	Nonce           uint64   `json:"nonce"`
+	DomainSeparator string   `json:"domain_separator"`
+
+	domain []byte
+}
+
+// IsOwner reports whether address is one of the Safe's owners.
+func (i *Info) IsOwner(address string) bool {
+	return slices.ContainsFunc(i.Owners, func(o string) bool { return strings.EqualFold(o, address) })
+}
+
+// Inspect reads a Safe's version, owners, threshold, nonce, and EIP-712
+// domain separator through ep. Contracts that don't answer all of them
+// aren't Safes, or are older than v1.0.0.
+func Inspect(ctx context.Context, ep endpoint.Endpoint, address evm.Address) (*Info, error) {
+	chainID, err := chainID(ctx, ep)
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{Address: address.Hex(), ChainID: chainID}
+	notSafe := fmt.Errorf("%s is not a Safe (v1.0.0 or later) on chain %d", address.Hex(), chainID)
+
+	out, err := endpoint.EthCall(ctx, ep, address.Hex(), selector("getThreshold()"))
+	if err != nil || len(out) < 32 {
+		return nil, notSafe
+	}
+	info.Threshold = new(big.Int).SetBytes(out[:32]).Uint64()
+	out, err = endpoint.EthCall(ctx, ep, address.Hex(), selector("nonce()"))
+	if err != nil || len(out) < 32 {
+		return nil, notSafe
+	}
+	info.Nonce = new(big.Int).SetBytes(out[:32]).Uint64()
+	out, err = endpoint.EthCall(ctx, ep, address.Hex(), selector("domainSeparator()"))
+	if err != nil || len(out) != 32 {
+		return nil, notSafe
+	}
+	info.domain = out
+	info.DomainSeparator = evm.EncodeHex(out)
+	out, err = endpoint.EthCall(ctx, ep, address.Hex(), selector("getOwners()"))
+	if err != nil {
+		return nil, notSafe
+	}
+	owners, err := decodeAddresses(out)
+	if err != nil || len(owners) == 0 {
+		return nil, notSafe
+	}
+	info.Owners = owners
+	if out, err := endpoint.EthCall(ctx, ep, address.Hex(), selector("VERSION()")); err == nil {
+		info.Version, _ = decodeString(out)
+	}
+	return info, nil
+}
+
+// Tx is a Safe transaction: what the Safe will do once enough owners have
+// signed it. Value and the gas fields are decimal strings, as the
+// Transaction Service writes them.
+type Tx struct {
+	To             string `json:"to"`
+	Value          string `json:"value"`
+	Data           string `json:"data,omitempty"`
+	Operation      int    `json:"operation"`
+	SafeTxGas      string `json:"safe_tx_gas"`
+	BaseGas        string `json:"base_gas"`
+	GasPrice       string `json:"gas_price"`
+	GasToken       string `json:"gas_token"`
+	RefundReceiver string `json:"refund_receiver"`
+	Nonce          uint64 `json:"nonce"`
+}
+
+// Signable is a Safe transaction hashed against its Safe's domain, ready for
+// an owner to sign. Digest is the safeTxHash.
+type Signable struct {
+	Safe      string          `json:"safe"`
+	ChainID   uint64          `json:"chain_id"`
+	Tx        Tx              `json:"tx"`
+	TypedData erc20.TypedData `json:"typed_data"`
+	// DomainSeparator and MessageHash are what hardware wallets that sign
+	// EIP-712 hashes need.
+	DomainSeparator string `json:"domain_separator"`
+	MessageHash     string `json:"message_hash"`
+	Digest          string `json:"digest"`
+
+	payload []byte
+}
+
+// Build normalizes tx and hashes it for the Safe in info. Empty gas fields
+// default to zero, and an empty gas token and refund receiver to the zero
+// address, which is how wallets propose transactions the executor pays
+// gas for.
+func Build(info *Info, tx Tx) (*Signable, error) {
+	to, err := evm.ParseAddress(tx.To)
+	if err != nil {
+		return nil, fmt.Errorf("to: %w", err)
+	}
+	tx.To = to.Hex()
+	if tx.Operation != OpCall && tx.Operation != OpDelegateCall {
+		return nil, errors.New("operation must be 0 (call) or 1 (delegatecall)")
+	}
+	data, err := evm.DecodeHex(tx.Data)
+	if err != nil {
+		return nil, fmt.Errorf("data: %w", err)
+	}
+	tx.Data = evm.EncodeHex(data)
+	words := make(map[string][]byte)
+	for _, f := range []struct {
+		name string
+		v    *string
+	}{{"value", &tx.Value}, {"safe_tx_gas", &tx.SafeTxGas}, {"base_gas", &tx.BaseGas}, {"gas_price", &tx.GasPrice}} {
+		n := big.NewInt(0)
+		if *f.v != "" {
+			if n, err = evm.ParseQuantity(*f.v); err != nil || n.Sign() < 0 || n.BitLen() > 256 {
+				return nil, fmt.Errorf("%s must be a uint256", f.name)
+			}
+		}
+		*f.v = n.String()
+		words[f.name] = uintWord(n)
+	}
+	for _, f := range []struct {
+		name string
+		v    *string
+	}{{"gas_token", &tx.GasToken}, {"refund_receiver", &tx.RefundReceiver}} {
+		var a evm.Address
+		if *f.v != "" {
+			if a, err = evm.ParseAddress(*f.v); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.name, err)
+			}
+		}
+		*f.v = a.Hex()
+		words[f.name] = addressWord(a)
+	}
+	message := evm.Keccak256(slices.Concat(
+		evm.Keccak256([]byte(safeTxType)),
+		addressWord(to),
+		words["value"],
+		evm.Keccak256(data),
+		uintWord(big.NewInt(int64(tx.Operation))),
+		words["safe_tx_gas"],
+		words["base_gas"],
+		words["gas_price"],
+		words["gas_token"],
+		words["refund_receiver"],
+		uintWord(new(big.Int).SetUint64(tx.Nonce)),
+	))
+	sg := &Signable{
+		Safe:            info.Address,
+		ChainID:         info.ChainID,
+		Tx:              tx,
+		DomainSeparator: info.DomainSeparator,
+		MessageHash:     evm.EncodeHex(message),
+		payload:         slices.Concat([]byte{0x19, 0x01}, info.domain, message),
+	}
+	sg.Digest = evm.EncodeHex(evm.Keccak256(sg.payload))
+	// Safes before v1.3.0 left the chain ID out of their domain.
+	domainFields := []erc20.TypedField{{Name: "chainId", Type: "uint256"}, {Name: "verifyingContract", Type: "address"}}
+	domain := map[string]any{"chainId": info.ChainID, "verifyingContract": info.Address}
+	safeAddr, _ := evm.ParseAddress(info.Address)
+	if slices.Equal(info.domain, evm.Keccak256(evm.Keccak256([]byte(legacyDomainType)), addressWord(safeAddr))) {
+		domainFields = domainFields[1:]
+		delete(domain, "chainId")
+	}
+	sg.TypedData = erc20.TypedData{
+		Types: map[string][]erc20.TypedField{
+			"EIP712Domain": domainFields,
+			"SafeTx": {
+				{Name: "to", Type: "address"}, {Name: "value", Type: "uint256"}, {Name: "data", Type: "bytes"},
+				{Name: "operation", Type: "uint8"}, {Name: "safeTxGas", Type: "uint256"}, {Name: "baseGas", Type: "uint256"},
+				{Name: "gasPrice", Type: "uint256"}, {Name: "gasToken", Type: "address"}, {Name: "refundReceiver", Type: "address"},
+				{Name: "nonce", Type: "uint256"},
+			},
+		},
+		PrimaryType: "SafeTx",
+		Domain:      domain,
+		Message: map[string]any{
+			"to":             tx.To,
+			"value":          tx.Value,
+			"data":           tx.Data,
+			"operation":      tx.Operation,
+			"safeTxGas":      tx.SafeTxGas,
+			"baseGas":        tx.BaseGas,
+			"gasPrice":       tx.GasPrice,
+			"gasToken":       tx.GasToken,
+			"refundReceiver": tx.RefundReceiver,
+			"nonce":          fmt.Sprint(tx.Nonce),
+		},
+	}
+	return sg, nil
+}
+
+// Payload returns what a signer hashes and signs: 0x1901, the Safe's
+// domain separator, and the transaction's struct hash.
+func (sg *Signable) Payload() []byte {
+	return sg.payload
+}
+
+// Signature checks that sig is by one of the Safe's owners and returns the
+// signer and the signature as r || s || v with v as 27/28, the form the
+// Safe and the Transaction Service take for EOA owners.
+func (sg *Signable) Signature(info *Info, sig evm.Signature) (string, string, error) {
+	signer, err := evm.RecoverAddress(evm.Keccak256(sg.payload), sig)
+	if err != nil {
+		return "", "", err
+	}
+	if !info.IsOwner(signer.Hex()) {
+		return "", "", fmt.Errorf("the signature is by %s, which is not an owner of the Safe", signer.Hex())
+	}
+	raw := slices.Concat(uintWord(sig.R), uintWord(sig.S), []byte{sig.YParity + 27})
+	return signer.Hex(), evm.EncodeHex(raw), nil
+}
+
+func chainID(ctx context.Context, ep endpoint.Endpoint) (uint64, error) {
+	result, err := endpoint.RPCCall(ctx, ep, "eth_chainId", []any{})
+	if err != nil {
+		return 0, err
+	}
+	var s string
+	if err := json.Unmarshal(result, &s); err != nil {
+		return 0, fmt.Errorf("unexpected eth_chainId result: %s", result)
+	}
+	id, err := evm.ParseQuantity(s)
+	if err != nil || !id.IsUint64() {
+		return 0, fmt.Errorf("unexpected eth_chainId result: %s", result)
+	}
+	return id.Uint64(), nil
+}
+
+// decodeAddresses decodes an ABI-encoded address[] return value.
+func decodeAddresses(out []byte) ([]string, error) {
+	if len(out) < 64 {
+		return nil, errors.New("short result")
+	}
+	offset := new(big.Int).SetBytes(out[:32])
+	if !offset.IsInt64() || offset.Int64() > int64(len(out))-32 {
+		return nil, errors.New("malformed address[]")
+	}
+	start := int(offset.Int64())
+	n := new(big.Int).SetBytes(out[start : start+32])
+	if !n.IsInt64() || n.Int64() > maxOwners || int64(len(out)-start-32) < n.Int64()*32 {
+		return nil, errors.New("malformed address[]")
+	}
+	addrs := make([]string, n.Int64())
+	for i := range addrs {
+		word := out[start+32+32*i : start+64+32*i]
+		var a evm.Address
+		copy(a[:], word[12:])
+		addrs[i] = a.Hex()
+	}
+	return addrs, nil
+}
+
+// decodeString decodes an ABI-encoded string return value.
+func decodeString(out []byte) (string, error) {
+	if len(out) < 64 {
+		return "", errors.New("short result")
+	}
+	n := new(big.Int).SetBytes(out[32:64])
+	if !n.IsInt64() || n.Int64() > int64(len(out)-64) {
+		return "", errors.New("malformed string")
+	}
+	return string(out[64 : 64+n.Int64()]), nil
+}
+
+func selector(sig string) []byte {
+	return evm.Keccak256([]byte(sig))[:4]
+}
+
+func addressWord(a evm.Address) []byte {
+	return append(make([]byte, 12), a[:]...)
+}
+
+func uintWord(n *big.Int) []byte {
+	return n.FillBytes(make([]byte, 32))
+}
@@ -0,0 +1,297 @@
+package safe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxResponse bounds what is read from the Transaction Service.
+const maxResponse = 4 << 20
+
+// DefaultServices are Safe's hosted Transaction Services by chain ID.
+var DefaultServices = map[uint64]string{
+	1:        "https://safe-transaction-mainnet.safe.global",
+	10:       "https://safe-transaction-optimism.safe.global",
+	56:       "https://safe-transaction-bsc.safe.global",
+	100:      "https://safe-transaction-gnosis-chain.safe.global",
+	137:      "https://safe-transaction-polygon.safe.global",
+	324:      "https://safe-transaction-zksync.safe.global",
+	8453:     "https://safe-transaction-base.safe.global",
+	42161:    "https://safe-transaction-arbitrum.safe.global",
+	42220:    "https://safe-transaction-celo.safe.global",
+	43114:    "https://safe-transaction-avalanche.safe.global",
+	59144:    "https://safe-transaction-linea.safe.global",
+	534352:   "https://safe-transaction-scroll.safe.global",
+	11155111: "https://safe-transaction-sepolia.safe.global",
+}
+
+// ParseServices parses a space- or comma-separated list of chainID=URL
+// Transaction Services, which add to or replace the defaults.
+func ParseServices(s string) (map[uint64]string, error) {
+	services := make(map[uint64]string, len(DefaultServices))
+	for id, u := range DefaultServices {
+		services[id] = u
+	}
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' }) {
+		id, raw, ok := strings.Cut(f, "=")
+		chainID, err := strconv.ParseUint(id, 10, 64)
+		if !ok || err != nil || chainID == 0 {
+			return nil, fmt.Errorf("%q must be chainID=URL", f)
+		}
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+			return nil, fmt.Errorf("%q must be an http:// or https:// URL", raw)
+		}
+		services[chainID] = strings.TrimRight(u.String(), "/")
+	}
+	return services, nil
+}
+
+// Service is a Safe Transaction Service client.
+type Service struct {
+	services map[uint64]string
+	apiKey   string
+	client   *http.Client
+}
+
+// NewService returns a client for the Transaction Services by chain ID.
+// apiKey, if set, is sent as a bearer token, as Safe's API gateway wants.
+func NewService(services map[uint64]string, apiKey string) *Service {
+	return &Service{services: services, apiKey: apiKey, client: &http.Client{Timeout: 15 * time.Second}}
+}
+
+// Supports reports whether a Transaction Service is known for the chain.
+func (s *Service) Supports(chainID uint64) bool {
+	_, ok := s.services[chainID]
+	return ok
+}
+
+// Confirmation is an owner's signature collected by the service.
+type Confirmation struct {
+	Owner       string    `json:"owner"`
+	Signature   string    `json:"signature,omitempty"`
+	SubmittedAt time.Time `json:"submitted_at"`
+}
+
+// Pending is a Safe transaction the service holds that hasn't executed.
+type Pending struct {
+	*Signable
+	SafeTxHash            string         `json:"safe_tx_hash"`
+	Proposer              string         `json:"proposer,omitempty"`
+	Origin                string         `json:"origin,omitempty"`
+	SubmittedAt           time.Time      `json:"submitted_at"`
+	ConfirmationsRequired uint64         `json:"confirmations_required"`
+	Confirmations         []Confirmation `json:"confirmations"`
+	// Mismatch is set when the service's safeTxHash isn't the hash of the
+	// transaction it describes; such a transaction must not be signed.
+	Mismatch bool `json:"mismatch,omitempty"`
+}
+
+// serviceTx is a multisig transaction as the service writes it.
+type serviceTx struct {
+	Safe                  string      `json:"safe"`
+	To                    string      `json:"to"`
+	Value                 string      `json:"value"`
+	Data                  *string     `json:"data"`
+	Operation             int         `json:"operation"`
+	SafeTxGas             json.Number `json:"safeTxGas"`
+	BaseGas               json.Number `json:"baseGas"`
+	GasPrice              string      `json:"gasPrice"`
+	GasToken              *string     `json:"gasToken"`
+	RefundReceiver        *string     `json:"refundReceiver"`
+	Nonce                 json.Number `json:"nonce"`
+	SafeTxHash            string      `json:"safeTxHash"`
+	Proposer              string      `json:"proposer"`
+	Origin                string      `json:"origin"`
+	SubmissionDate        time.Time   `json:"submissionDate"`
+	IsExecuted            bool        `json:"isExecuted"`
+	ConfirmationsRequired uint64      `json:"confirmationsRequired"`
+	Confirmations         []struct {
+		Owner          string    `json:"owner"`
+		Signature      string    `json:"signature"`
+		SubmissionDate time.Time `json:"submissionDate"`
+	} `json:"confirmations"`
+}
+
+// pending rebuilds st for the Safe in info and checks its hash.
+func (st serviceTx) pending(info *Info) (*Pending, error) {
+	nonce, err := strconv.ParseUint(st.Nonce.String(), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("transaction %s has an unreadable nonce", st.SafeTxHash)
+	}
+	tx := Tx{To: st.To, Value: st.Value, Operation: st.Operation, SafeTxGas: st.SafeTxGas.String(), BaseGas: st.BaseGas.String(), GasPrice: st.GasPrice, Nonce: nonce}
+	for _, f := range []struct{ in, out *string }{{st.Data, &tx.Data}, {st.GasToken, &tx.GasToken}, {st.RefundReceiver, &tx.RefundReceiver}} {
+		if f.in != nil {
+			*f.out = *f.in
+		}
+	}
+	sg, err := Build(info, tx)
+	if err != nil {
+		return nil, fmt.Errorf("transaction %s: %w", st.SafeTxHash, err)
+	}
+	p := &Pending{
+		Signable:              sg,
+		SafeTxHash:            st.SafeTxHash,
+		Proposer:              st.Proposer,
+		Origin:                st.Origin,
+		SubmittedAt:           st.SubmissionDate,
+		ConfirmationsRequired: st.ConfirmationsRequired,
+		Confirmations:         []Confirmation{},
+		Mismatch:              !strings.EqualFold(sg.Digest, st.SafeTxHash),
+	}
+	for _, c := range st.Confirmations {
+		p.Confirmations = append(p.Confirmations, Confirmation{Owner: c.Owner, Signature: c.Signature, SubmittedAt: c.SubmissionDate})
+	}
+	return p, nil
+}
+
+// Confirmed reports whether owner has already signed.
+func (p *Pending) Confirmed(owner string) bool {
+	for _, c := range p.Confirmations {
+		if strings.EqualFold(c.Owner, owner) {
+			return true
+		}
+	}
+	return false
+}
+
+// OwnerSafes returns the Safes on the chain that owner is an owner of.
+func (s *Service) OwnerSafes(ctx context.Context, chainID uint64, owner string) ([]string, error) {
+	var out struct {
+		Safes []string `json:"safes"`
+	}
+	if err := s.do(ctx, chainID, http.MethodGet, "/api/v1/owners/"+owner+"/safes/", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Safes, nil
+}
+
+// Pending returns the Safe's unexecuted transactions from its current
+// nonce on, lowest nonce first, each rebuilt and hashed here.
+func (s *Service) Pending(ctx context.Context, info *Info) ([]*Pending, error) {
+	q := url.Values{"executed": {"false"}, "nonce__gte": {strconv.FormatUint(info.Nonce, 10)}, "ordering": {"nonce"}, "limit": {"100"}}
+	var out struct {
+		Results []serviceTx `json:"results"`
+	}
+	if err := s.do(ctx, info.ChainID, http.MethodGet, "/api/v1/safes/"+info.Address+"/multisig-transactions/?"+q.Encode(), nil, &out); err != nil {
+		return nil, err
+	}
+	list := make([]*Pending, 0, len(out.Results))
+	for _, st := range out.Results {
+		if st.IsExecuted {
+			continue
+		}
+		p, err := st.pending(info)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+	return list, nil
+}
+
+// Transaction returns one transaction of the Safe in info by safeTxHash.
+func (s *Service) Transaction(ctx context.Context, info *Info, safeTxHash string) (*Pending, error) {
+	var st serviceTx
+	if err := s.do(ctx, info.ChainID, http.MethodGet, "/api/v1/multisig-transactions/"+safeTxHash+"/", nil, &st); err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(st.Safe, info.Address) {
+		return nil, fmt.Errorf("transaction %s belongs to another Safe", safeTxHash)
+	}
+	if st.IsExecuted {
+		return nil, fmt.Errorf("transaction %s has already executed", safeTxHash)
+	}
+	return st.pending(info)
+}
+
+// Propose submits a new transaction with its proposer's signature.
+func (s *Service) Propose(ctx context.Context, sg *Signable, sender, signature, origin string) error {
+	body := map[string]any{
+		"safe":                    sg.Safe,
+		"to":                      sg.Tx.To,
+		"value":                   sg.Tx.Value,
+		"data":                    nullIfEmpty(sg.Tx.Data),
+		"operation":               sg.Tx.Operation,
+		"safeTxGas":               sg.Tx.SafeTxGas,
+		"baseGas":                 sg.Tx.BaseGas,
+		"gasPrice":                sg.Tx.GasPrice,
+		"gasToken":                sg.Tx.GasToken,
+		"refundReceiver":          sg.Tx.RefundReceiver,
+		"nonce":                   sg.Tx.Nonce,
+		"contractTransactionHash": sg.Digest,
+		"sender":                  sender,
+		"signature":               signature,
+		"origin":                  origin,
+	}
+	return s.do(ctx, sg.ChainID, http.MethodPost, "/api/v1/safes/"+sg.Safe+"/multisig-transactions/", body, nil)
+}
+
+// Confirm adds an owner's signature to a transaction the service holds.
+func (s *Service) Confirm(ctx context.Context, chainID uint64, safeTxHash, signature string) error {
+	return s.do(ctx, chainID, http.MethodPost, "/api/v1/multisig-transactions/"+safeTxHash+"/confirmations/", map[string]string{"signature": signature}, nil)
+}
+
+func (s *Service) do(ctx context.Context, chainID uint64, method, path string, in, out any) error {
+	base, ok := s.services[chainID]
+	if !ok {
+		return fmt.Errorf("no Safe Transaction Service for chain %d; add one with SAFE_TX_SERVICES", chainID)
+	}
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, base+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("safe transaction service: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return fmt.Errorf("safe transaction service: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		msg := strings.TrimSpace(string(data))
+		if len(msg) > 300 {
+			msg = msg[:300]
+		}
+		return fmt.Errorf("safe transaction service: HTTP %d: %s", resp.StatusCode, msg)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("safe transaction service: unexpected response: %w", err)
+	}
+	return nil
+}
+
+func nullIfEmpty(data string) any {
+	if data == "" || data == "0x" {
+		return nil
+	}
+	return data
+}
@@ -0,0 +1,512 @@
+// Package schedule stores recurring transaction templates — a payment or a
+// DCA buy on a cron-like schedule — and the runs they produce. Each run is
+// either queued for approval in the dashboard or, in auto mode, signed
+// straight away by a server-side key.
+package schedule
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/primal-host/wallet/internal/evm"
+	"github.com/primal-host/wallet/internal/txbuild"
+)
+
+// runLimit is how many finished runs are kept. Pending runs are always kept.
+const runLimit = 200
+
+// Modes say what happens when a schedule comes due.
+const (
+	ModeApprove = "approve" // queue the built transaction for approval
+	ModeAuto    = "auto"    // sign and broadcast it with the server vault or a remote signer
+)
+
+// Run statuses.
+const (
+	StatusPending  = "pending"  // waiting for approval
+	StatusSending  = "sending"  // approved, being signed and broadcast
+	StatusSent     = "sent"     // broadcast; Hash is set
+	StatusRejected = "rejected" // rejected in the approval queue
+	StatusFailed   = "failed"   // building, signing, or broadcasting failed; Error says why
+)
+
+// Schedule is a transaction template and when to send it.
+type Schedule struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Spec     string `json:"spec"` // cron expression, see ParseSpec
+	Mode     string `json:"mode"` // approve or auto
+	Paused   bool   `json:"paused"`
+	Endpoint string `json:"endpoint"`
+	From     string `json:"from"` // server vault key or remote signer account
+	To       string `json:"to"`
+	Value    string `json:"value"` // wei, decimal or 0x hex
+	Data     string `json:"data"`
+
+	NextRun   *time.Time `json:"next_run,omitempty"` // unset while paused, or if the spec never fires
+	LastRun   *time.Time `json:"last_run,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // set while in the recycle bin
+}
+
+// Request is the transaction the schedule builds. Nonce and fees are filled
+// in from the endpoint each time.
+func (sc Schedule) Request() txbuild.Request {
+	return txbuild.Request{Endpoint: sc.Endpoint, From: sc.From, To: sc.To, Value: sc.Value, Data: sc.Data}
+}
+
+// Run is one firing of a schedule.
+type Run struct {
+	ID         string            `json:"id"`
+	ScheduleID string            `json:"schedule_id"`
+	Name       string            `json:"name"` // schedule name at the time
+	Mode       string            `json:"mode"`
+	DueAt      time.Time         `json:"due_at"`
+	Missed     bool              `json:"missed,omitempty"` // came due while the server was down; queued for approval
+	Status     string            `json:"status"`
+	Envelope   *txbuild.Envelope `json:"envelope,omitempty"` // what is (or was) signed
+	Hash       string            `json:"hash,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	DecidedAt  *time.Time        `json:"decided_at,omitempty"` // approved, rejected, or sent
+}
+
+// Store manages schedules and runs persisted to a JSON file.
+type Store struct {
+	mu        sync.RWMutex
+	schedules []Schedule
+	runs      []Run // oldest first
+	path      string
+}
+
+type file struct {
+	Schedules []Schedule `json:"schedules"`
+	Runs      []Run      `json:"runs"`
+}
+
+// NewStore loads schedules from a JSON file. If the file doesn't exist,
+// starts empty. Runs left sending by a crash are marked failed, since the
+// transaction may or may not have gone out.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path, schedules: []Schedule{}, runs: []Run{}}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("read schedules: %w", err)
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse schedules: %w", err)
+	}
+	if f.Schedules != nil {
+		s.schedules = f.Schedules
+	}
+	if f.Runs != nil {
+		s.runs = f.Runs
+	}
+	for i := range s.runs {
+		if s.runs[i].Status == StatusSending {
+			s.runs[i].Status = StatusFailed
+			s.runs[i].Error = "interrupted while sending; check the chain before sending again"
+		}
+	}
+	return s, nil
+}
+
+// List returns all schedules, excluding deleted ones.
+func (s *Store) List() []Schedule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Schedule, 0, len(s.schedules))
+	for _, sc := range s.schedules {
+		if sc.DeletedAt == nil {
+			out = append(out, sc)
+		}
+	}
+	return out
+}
+
+// Trash returns deleted schedules that can still be restored.
+func (s *Store) Trash() []Schedule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []Schedule{}
+	for _, sc := range s.schedules {
+		if sc.DeletedAt != nil {
+			out = append(out, sc)
+		}
+	}
+	return out
+}
+
+// Get returns the schedule with the given ID.
+func (s *Store) Get(id string) (Schedule, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if sc := s.findLocked(id); sc != nil && sc.DeletedAt == nil {
+		return *sc, true
+	}
+	return Schedule{}, false
+}
+
+// Add validates and stores a new schedule.
+func (s *Store) Add(sc Schedule) (Schedule, error) {
+	spec, err := validate(&sc)
+	if err != nil {
+		return Schedule{}, err
+	}
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return Schedule{}, err
+	}
+	now := time.Now().UTC()
+	sc.ID = hex.EncodeToString(id)
+	sc.CreatedAt = now
+	sc.LastRun = nil
+	sc.DeletedAt = nil
+	sc.NextRun = nextRun(sc, spec, now)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.schedules
+	s.schedules = append(s.schedules[:len(old):len(old)], sc)
+	if err := s.save(); err != nil {
+		s.schedules = old
+		return Schedule{}, err
+	}
+	return sc, nil
+}
+
+// Update replaces a schedule's settings. The next run is worked out again
+// from now, so resuming a paused schedule doesn't fire the runs it missed.
+func (s *Store) Update(id string, sc Schedule) (Schedule, error) {
+	spec, err := validate(&sc)
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing := s.findLocked(id)
+	if existing == nil || existing.DeletedAt != nil {
+		return Schedule{}, fmt.Errorf("schedule %q not found", id)
+	}
+	old := *existing
+	sc.ID = old.ID
+	sc.CreatedAt = old.CreatedAt
+	sc.LastRun = old.LastRun
+	sc.DeletedAt = nil
+	sc.NextRun = nextRun(sc, spec, time.Now().UTC())
+	*existing = sc
+	if err := s.save(); err != nil {
+		*existing = old
+		return Schedule{}, err
+	}
+	return sc, nil
+}
+
+// Delete moves a schedule to the recycle bin. Its pending runs stay in the
+// approval queue.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sc := s.findLocked(id)
+	if sc == nil || sc.DeletedAt != nil {
+		return fmt.Errorf("schedule %q not found", id)
+	}
+	now := time.Now().UTC()
+	sc.DeletedAt = &now
+	if err := s.save(); err != nil {
+		sc.DeletedAt = nil
+		return err
+	}
+	return nil
+}
+
+// Restore brings a deleted schedule back from the recycle bin. Runs it
+// missed while deleted are skipped.
+func (s *Store) Restore(id string) (Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sc := s.findLocked(id)
+	if sc == nil || sc.DeletedAt == nil {
+		return Schedule{}, fmt.Errorf("deleted schedule %q not found", id)
+	}
+	old := *sc
+	sc.DeletedAt = nil
+	if spec, err := ParseSpec(sc.Spec); err == nil {
+		sc.NextRun = nextRun(*sc, spec, time.Now().UTC())
+	}
+	if err := s.save(); err != nil {
+		*sc = old
+		return Schedule{}, err
+	}
+	return *sc, nil
+}
+
+// Purge permanently removes a deleted schedule.
+func (s *Store) Purge(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, sc := range s.schedules {
+		if sc.ID == id && sc.DeletedAt != nil {
+			old := s.schedules
+			s.schedules = append(s.schedules[:i:i], s.schedules[i+1:]...)
+			if err := s.save(); err != nil {
+				s.schedules = old
+				return err
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("deleted schedule %q not found", id)
+}
+
+// Due returns the schedules whose next run is at or before now and moves
+// each one on to its following run. A schedule that missed several runs
+// (the server was down) comes due once, not once per missed run.
+func (s *Store) Due(now time.Time) ([]Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now = now.UTC()
+	old := append([]Schedule(nil), s.schedules...)
+	var due []Schedule
+	for i := range s.schedules {
+		sc := &s.schedules[i]
+		if sc.DeletedAt != nil || sc.Paused || sc.NextRun == nil || sc.NextRun.After(now) {
+			continue
+		}
+		due = append(due, *sc)
+		last := now
+		sc.LastRun = &last
+		if spec, err := ParseSpec(sc.Spec); err == nil {
+			sc.NextRun = nextRun(*sc, spec, now)
+		} else {
+			sc.NextRun = nil
+		}
+	}
+	if len(due) == 0 {
+		return nil, nil
+	}
+	if err := s.save(); err != nil {
+		s.schedules = old
+		return nil, err
+	}
+	return due, nil
+}
+
+// Runs returns runs newest first, optionally only those with status.
+func (s *Store) Runs(status string) []Run {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []Run{}
+	for i := len(s.runs) - 1; i >= 0; i-- {
+		if status == "" || s.runs[i].Status == status {
+			out = append(out, s.runs[i])
+		}
+	}
+	return out
+}
+
+// AddRun records a run, dropping the oldest finished runs beyond runLimit.
+func (s *Store) AddRun(r Run) (Run, error) {
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return Run{}, err
+	}
+	r.ID = hex.EncodeToString(id)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.runs
+	runs := append(s.runs[:len(old):len(old)], r)
+	finished := 0
+	for _, run := range runs {
+		if run.Status != StatusPending && run.Status != StatusSending {
+			finished++
+		}
+	}
+	kept := make([]Run, 0, len(runs))
+	for _, run := range runs {
+		if finished > runLimit && run.Status != StatusPending && run.Status != StatusSending {
+			finished--
+			continue
+		}
+		kept = append(kept, run)
+	}
+	s.runs = kept
+	if err := s.save(); err != nil {
+		s.runs = old
+		return Run{}, err
+	}
+	return r, nil
+}
+
+// Claim moves a pending run to sending, so it can only be approved once.
+func (s *Store) Claim(id string) (Run, error) {
+	return s.decide(id, StatusSending)
+}
+
+// Reject marks a pending run rejected.
+func (s *Store) Reject(id string) (Run, error) {
+	return s.decide(id, StatusRejected)
+}
+
+func (s *Store) decide(id, status string) (Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.findRunLocked(id)
+	if r == nil {
+		return Run{}, fmt.Errorf("run %q not found", id)
+	}
+	if r.Status != StatusPending {
+		return Run{}, fmt.Errorf("run %q is %s, not pending", id, r.Status)
+	}
+	old := *r
+	now := time.Now().UTC()
+	r.Status = status
+	r.DecidedAt = &now
+	if err := s.save(); err != nil {
+		*r = old
+		return Run{}, err
+	}
+	return *r, nil
+}
+
+// FinishRun records the outcome of a claimed run: its signed envelope and
+// hash, or the error that stopped it.
+func (s *Store) FinishRun(id string, env *txbuild.Envelope, hash string, sendErr error) (Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.findRunLocked(id)
+	if r == nil {
+		return Run{}, fmt.Errorf("run %q not found", id)
+	}
+	old := *r
+	if env != nil {
+		r.Envelope = env
+	}
+	if sendErr != nil {
+		r.Status = StatusFailed
+		r.Error = sendErr.Error()
+	} else {
+		r.Status = StatusSent
+		r.Hash = hash
+	}
+	if err := s.save(); err != nil {
+		*r = old
+		return Run{}, err
+	}
+	return *r, nil
+}
+
+// Validate checks a schedule's fields and normalizes them in place, the same
+// way Add and Update do.
+func Validate(sc *Schedule) error {
+	_, err := validate(sc)
+	return err
+}
+
+func validate(sc *Schedule) (*Spec, error) {
+	sc.Name = strings.TrimSpace(sc.Name)
+	if sc.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	sc.Spec = strings.TrimSpace(sc.Spec)
+	spec, err := ParseSpec(sc.Spec)
+	if err != nil {
+		return nil, err
+	}
+	if spec.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("schedule %q never fires", sc.Spec)
+	}
+	if sc.Mode == "" {
+		sc.Mode = ModeApprove
+	}
+	if sc.Mode != ModeApprove && sc.Mode != ModeAuto {
+		return nil, fmt.Errorf("mode must be %s or %s", ModeApprove, ModeAuto)
+	}
+	if sc.Endpoint == "" {
+		return nil, fmt.Errorf("endpoint is required")
+	}
+	from, err := evm.ParseAddress(sc.From)
+	if err != nil {
+		return nil, fmt.Errorf("from: %w", err)
+	}
+	sc.From = from.Hex()
+	to, err := evm.ParseAddress(sc.To)
+	if err != nil {
+		return nil, fmt.Errorf("to: %w", err)
+	}
+	sc.To = to.Hex()
+	if sc.Value == "" {
+		sc.Value = "0"
+	}
+	value, err := evm.ParseQuantity(sc.Value)
+	if err != nil {
+		return nil, fmt.Errorf("value: %w", err)
+	}
+	sc.Value = value.String()
+	if _, err := evm.DecodeHex(sc.Data); err != nil {
+		return nil, fmt.Errorf("data: %w", err)
+	}
+	return spec, nil
+}
+
+func nextRun(sc Schedule, spec *Spec, now time.Time) *time.Time {
+	if sc.Paused {
+		return nil
+	}
+	next := spec.Next(now)
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
+
+// findLocked finds a schedule by ID, including deleted ones. Must be called with mu held.
+func (s *Store) findLocked(id string) *Schedule {
+	for i := range s.schedules {
+		if s.schedules[i].ID == id {
+			return &s.schedules[i]
+		}
+	}
+	return nil
+}
+
+// findRunLocked finds a run by ID. Must be called with mu held.
+func (s *Store) findRunLocked(id string) *Run {
+	for i := range s.runs {
+		if s.runs[i].ID == id {
+			return &s.runs[i]
+		}
+	}
+	return nil
+}
+
+// save writes the current schedules and runs to disk. Must be called with mu held.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(file{Schedules: s.schedules, Runs: s.runs}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal schedules: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("write schedules: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/evm"
+	"github.com/primal-host/wallet/internal/qr"
+	"github.com/primal-host/wallet/internal/signer"
+	"github.com/primal-host/wallet/internal/txbuild"
+	"github.com/primal-host/wallet/internal/ur"
+)
+
+// handleTxUR encodes an envelope as an eth-sign-request for the air-gapped
+// device that holds its from account: the UR parts, and a QR code of each
+// to show in a loop.
+func (s *Server) handleTxUR(c echo.Context) error {
+	var req struct {
+		Envelope txbuild.Envelope `json:"envelope"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	acct, ok := s.profileFor(c.Request().Context()).accounts.Get(req.Envelope.From)
+	if !ok || acct.Kind != signer.KindAirGap {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "from is not an air-gapped account"})
+	}
+	tx, err := req.Envelope.Transaction()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	fingerprint, _ := strconv.ParseUint(acct.Fingerprint, 16, 32)
+	from, _ := evm.ParseAddress(acct.Address)
+	signReq := ur.SignRequest{
+		ID:          ur.RequestID(tx.SigningHash()),
+		Data:        tx.SigningPayload(),
+		DataType:    ur.DataTypedTx,
+		ChainID:     tx.ChainID.Uint64(),
+		Path:        acct.Path,
+		Fingerprint: uint32(fingerprint),
+		Address:     from[:],
+	}
+	msg, err := signReq.Marshal()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	parts := ur.Encode(ur.TypeSignRequest, msg, ur.MaxFragment)
+	codes := make([]string, len(parts))
+	for i, part := range parts {
+		code, err := qr.Encode(part)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		codes[i] = code.SVG(4)
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"request_id": formatUUID(signReq.ID),
+		"parts":      parts,
+		"qr":         codes,
+	})
+}
+
+// handleTxURSignature decodes the eth-signature an air-gapped device shows
+// for an envelope into the signature /api/tx/import takes.
+func (s *Server) handleTxURSignature(c echo.Context) error {
+	var req struct {
+		Envelope txbuild.Envelope `json:"envelope"`
+		UR       []string         `json:"ur"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	sig, err := urSignature(&req.Envelope, req.UR)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{
+		"y_parity": evm.EncodeQuantity(big.NewInt(int64(sig.YParity))),
+		"r":        evm.EncodeQuantity(sig.R),
+		"s":        evm.EncodeQuantity(sig.S),
+	})
+}
+
+// urSignature decodes the parts of an eth-signature UR and checks that it
+// answers the sign request for env. Import checks that it recovers to the
+// from address.
+func urSignature(env *txbuild.Envelope, parts []string) (*evm.Signature, error) {
+	tx, err := env.Transaction()
+	if err != nil {
+		return nil, err
+	}
+	typ, msg, err := ur.Decode(parts)
+	if err != nil {
+		return nil, err
+	}
+	if typ != ur.TypeSignature {
+		return nil, fmt.Errorf("scanned a %s, not an %s", typ, ur.TypeSignature)
+	}
+	sig, err := ur.ParseSignature(msg)
+	if err != nil {
+		return nil, err
+	}
+	if sig.RequestID != ur.RequestID(tx.SigningHash()) {
+		return nil, fmt.Errorf("the signature is for a different transaction")
+	}
+	return &evm.Signature{
+		YParity: sig.YParity,
+		R:       new(big.Int).SetBytes(sig.R),
+		S:       new(big.Int).SetBytes(sig.S),
+	}, nil
+}
+
+// formatUUID formats a UUID in its usual 8-4-4-4-12 form.
+func formatUUID(id [16]byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[:4], id[4:6], id[6:8], id[8:10], id[10:])
+}
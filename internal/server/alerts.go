@@ -0,0 +1,258 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/alert"
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/notify"
+)
+
+// alertRoutes registers alert management.
+func (s *Server) alertRoutes() {
+	s.echo.GET("/api/alerts", s.handleListAlerts)
+	s.echo.POST("/api/alerts", s.handleAddAlert)
+	s.echo.GET("/api/alerts/:id", s.handleGetAlert)
+	s.echo.PUT("/api/alerts/:id", s.handleUpdateAlert)
+	s.echo.DELETE("/api/alerts/:id", s.handleDeleteAlert)
+}
+
+// notify logs n, pushes it to the server profile's dashboards as a
+// notification message, and delivers it off the server.
+func (s *Server) notify(n notify.Notification) {
+	n.At = time.Now().UTC()
+	slog.Info("notification", "subsystem", "alert", "kind", n.Kind, "message", n.Message)
+	s.hub.broadcastShared(map[string]any{"type": "notification", "notification": n})
+	s.deliver(n)
+}
+
+// deliver sends n over the notification channels and to the subscribed
+// browsers that want its kind.
+func (s *Server) deliver(n notify.Notification) {
+	if n.At.IsZero() {
+		n.At = time.Now().UTC()
+	}
+	s.channels.Deliver(n)
+	s.pushes.Deliver(n)
+}
+
+// checkAlerts checks the alerts on the server's endpoints against their
+// latest poll, in the background; the poller calls it after every round. A
+// check still running from an earlier round is left to finish instead.
+func (s *Server) checkAlerts(statuses []endpoint.Status) {
+	if !s.alertMu.TryLock() {
+		return
+	}
+	go func() {
+		defer s.alertMu.Unlock()
+		due := s.dueAlerts(statuses)
+		s.checkGasAlerts(due)
+		s.checkBalanceAlerts(due)
+		s.checkOfflineAlerts(statuses)
+	}()
+}
+
+// dueAlert is an alert to check and its endpoint.
+type dueAlert struct {
+	alert.Alert
+	ep endpoint.Endpoint
+}
+
+// dueAlerts returns the alerts on online endpoints that have a block the
+// alert wasn't checked at, and records that block for each. Must be called
+// with alertMu held.
+func (s *Server) dueAlerts(statuses []endpoint.Status) []dueAlert {
+	byID := map[string]endpoint.Status{}
+	for _, st := range statuses {
+		byID[st.ID] = st
+	}
+	alerts := s.alerts.List("")
+	live := map[string]bool{}
+	for _, a := range alerts {
+		live[a.ID] = true
+	}
+	for id := range s.alertBlocks {
+		if !live[id] {
+			delete(s.alertBlocks, id)
+		}
+	}
+	var due []dueAlert
+	for _, a := range alerts {
+		st, ok := byID[a.Endpoint]
+		if !ok || !st.Online || st.BlockNumber == "" || s.alertBlocks[a.ID] == st.BlockNumber {
+			continue
+		}
+		ep, ok := s.store.Get(a.Endpoint)
+		if !ok {
+			continue
+		}
+		s.alertBlocks[a.ID] = st.BlockNumber
+		due = append(due, dueAlert{a, ep})
+	}
+	return due
+}
+
+// checkGasAlerts reads each fee the due gas alerts watch once, and notifies
+// for the unmuted alerts that start firing.
+func (s *Server) checkGasAlerts(due []dueAlert) {
+	type reading struct {
+		value *big.Int
+		err   error
+	}
+	read := map[string]reading{} // endpoint ID and metric -> fee, once per check
+	for _, d := range due {
+		if d.Kind != alert.KindGas {
+			continue
+		}
+		key := d.Endpoint + " " + d.Metric
+		r, ok := read[key]
+		if !ok {
+			r.value, r.err = alert.ReadGas(s.ctx, d.ep, d.Metric)
+			read[key] = r
+		}
+		checked, fired, err := s.alerts.Observe(d.ID, r.value, r.err)
+		s.alertChecked(checked, d.ep, fired, err)
+	}
+}
+
+// checkBalanceAlerts reads each balance the due balance alerts watch once,
+// verified as the proxy would, and notifies for the unmuted alerts whose
+// balance changed enough.
+func (s *Server) checkBalanceAlerts(due []dueAlert) {
+	type reading struct {
+		wei *big.Int
+		err error
+	}
+	read := map[string]reading{} // endpoint ID and address -> balance, once per check
+	for _, d := range due {
+		if d.Kind != alert.KindBalance {
+			continue
+		}
+		key := d.Endpoint + " " + d.Address
+		r, ok := read[key]
+		if !ok {
+			r.wei, r.err = s.alertBalance(d.ep, d.Address)
+			read[key] = r
+		}
+		checked, fired, err := s.alerts.ObserveBalance(d.ID, r.wei, d.ep.Native.Decimals, r.err)
+		s.alertChecked(checked, d.ep, fired, err)
+	}
+}
+
+// checkOfflineAlerts records whether each offline alert's endpoint is
+// online after every poll round, and notifies for the unmuted alerts that
+// start firing, and again when their endpoint is back.
+func (s *Server) checkOfflineAlerts(statuses []endpoint.Status) {
+	byID := map[string]endpoint.Status{}
+	for _, st := range statuses {
+		byID[st.ID] = st
+	}
+	for _, a := range s.alerts.List(alert.KindOffline) {
+		st, ok := byID[a.Endpoint]
+		if !ok {
+			continue
+		}
+		ep, ok := s.store.Get(a.Endpoint)
+		if !ok {
+			continue
+		}
+		at := st.CheckedAt
+		if at.IsZero() {
+			at = time.Now()
+		}
+		checked, changed, err := s.alerts.ObserveOnline(a.ID, st.Online, at)
+		s.alertChecked(checked, ep, changed, err)
+	}
+}
+
+// alertBalance reads address's native balance on ep. A balance that fails
+// its proof is an error, so it can't fire an alert.
+func (s *Server) alertBalance(ep endpoint.Endpoint, address string) (*big.Int, error) {
+	b, err := s.balanceAt(s.ctx, s.store, ep, address, "")
+	if err != nil {
+		return nil, err
+	}
+	if b.Proof != nil && b.Proof.Status == endpoint.CheckMismatch {
+		return nil, fmt.Errorf("balance fails its proof: %s", b.Proof.Error)
+	}
+	wei, _ := new(big.Int).SetString(b.Wei, 10)
+	return wei, nil
+}
+
+// alertChecked logs a failure to save a check of a, or notifies if the
+// check fired it, or stopped an offline alert firing, and it isn't muted.
+func (s *Server) alertChecked(a alert.Alert, ep endpoint.Endpoint, fired bool, err error) {
+	if err != nil {
+		slog.Error("alert save failed", "subsystem", "alert", "alert", a.ID, "error", err)
+		return
+	}
+	if fired && !a.Muted {
+		s.notify(notify.Notification{Kind: a.Kind, Message: alert.Message(a, ep), Alert: &a})
+	}
+}
+
+// handleListAlerts returns the alerts, optionally only those of ?kind=.
+func (s *Server) handleListAlerts(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.alerts.List(c.QueryParam("kind")))
+}
+
+// handleGetAlert returns one alert.
+func (s *Server) handleGetAlert(c echo.Context) error {
+	a, ok := s.alerts.Get(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "alert not found"})
+	}
+	return c.JSON(http.StatusOK, a)
+}
+
+// handleAddAlert creates an alert on one of the server's endpoints.
+func (s *Server) handleAddAlert(c echo.Context) error {
+	var req alert.Alert
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if _, ok := s.store.Get(req.Endpoint); !ok && req.Endpoint != "" {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "endpoint not found"})
+	}
+	a, err := s.alerts.Add(req)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	slog.Info("alert added", "subsystem", "alert", "alert", a.ID, "kind", a.Kind, "endpoint", a.Endpoint, "by", s.profileFor(c.Request().Context()).name())
+	return c.JSON(http.StatusCreated, a)
+}
+
+// handleUpdateAlert replaces an alert's condition, or mutes or unmutes it.
+func (s *Server) handleUpdateAlert(c echo.Context) error {
+	var req alert.Alert
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if _, ok := s.store.Get(req.Endpoint); !ok && req.Endpoint != "" {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "endpoint not found"})
+	}
+	a, err := s.alerts.Update(c.Param("id"), req)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, a)
+}
+
+// handleDeleteAlert removes an alert.
+func (s *Server) handleDeleteAlert(c echo.Context) error {
+	if err := s.alerts.Delete(c.Param("id")); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "deleted"})
+}
@@ -0,0 +1,255 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/approval"
+	"github.com/primal-host/wallet/internal/txbuild"
+)
+
+// approvalTick is how often pending requests are checked for expiry.
+const approvalTick = 30 * time.Second
+
+// approvalRoutes registers the transaction approval queue.
+func (s *Server) approvalRoutes() {
+	s.echo.GET("/api/approvals", s.handleListApprovals)
+	s.echo.POST("/api/approvals", s.idempotent(s.handleSubmitApproval))
+	s.echo.GET("/api/approvals/:id", s.handleGetApproval)
+	s.echo.POST("/api/approvals/:id/approve", s.idempotent(s.handleApprove))
+	s.echo.POST("/api/approvals/:id/reject", s.handleReject)
+}
+
+// runApprovals expires requests nobody reviewed in time, until the server
+// shuts down.
+func (s *Server) runApprovals() {
+	t := time.NewTicker(approvalTick)
+	defer t.Stop()
+	for {
+		expired, err := s.approvals.Expire(time.Now())
+		if err != nil {
+			slog.Error("approval save failed", "subsystem", "approval", "error", err)
+		}
+		for _, r := range expired {
+			slog.Info("approval expired", "subsystem", "approval", "approval", r.ID, "origin", r.Origin)
+			s.approvalChanged(r.Status, r)
+		}
+		select {
+		case <-s.closing:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// approvalChanged pushes r to the server profile's dashboards and posts
+// event to the approval webhook.
+func (s *Server) approvalChanged(event string, r approval.Request) {
+	s.hub.broadcastShared(map[string]any{"type": "approval", "approval": r})
+	s.approvals.Notify(event, r)
+}
+
+// approvalsNeeded is how many approvers must sign off on env before the
+// server signs it.
+func (s *Server) approvalsNeeded(env *txbuild.Envelope) int {
+	return s.approvals.Needed(env, s.nativeDecimals(env.Endpoint))
+}
+
+// checkConfirmation checks that a sender re-typed the recipient and amount
+// of env if its value reaches CONFIRM_THRESHOLD or it hands over tokens.
+func (s *Server) checkConfirmation(ctx context.Context, env *txbuild.Envelope, conf *txbuild.Confirmation) error {
+	if !s.approvals.ConfirmRequired(env, s.nativeDecimals(env.Endpoint)) {
+		return nil
+	}
+	return conf.Check(s.confirmTarget(ctx, env))
+}
+
+// confirmTarget is what a confirmation of env repeats. Token amounts are
+// typed in the token's decimals when the caller's token registry has it,
+// and in base units otherwise.
+func (s *Server) confirmTarget(ctx context.Context, env *txbuild.Envelope) txbuild.ConfirmTarget {
+	tokenDecimals := 0
+	if chainID, err := parseChainID(env.ChainID); err == nil {
+		if t, ok := s.profileFor(ctx).erc20.Get(chainID, env.Tx.To); ok {
+			tokenDecimals = t.Decimals
+		}
+	}
+	return txbuild.Target(env, s.nativeDecimals(env.Endpoint), tokenDecimals)
+}
+
+// confirmError answers 428 for a missing or mismatched confirmation.
+func confirmError(c echo.Context, err error) error {
+	return c.JSON(http.StatusPreconditionRequired, map[string]any{"error": err.Error(), "confirm_required": true})
+}
+
+// nativeDecimals is the decimals of an endpoint's native currency, or 18 if
+// the endpoint is gone.
+func (s *Server) nativeDecimals(id string) int {
+	if ep, ok := s.store.Get(id); ok {
+		return ep.Native.Decimals
+	}
+	return 18
+}
+
+// mustQueue reports whether the server signing routes have to queue env
+// instead of signing it: always with REQUIRE_APPROVAL, and under dual
+// control when its value needs two approvers.
+func (s *Server) mustQueue(env *txbuild.Envelope) bool {
+	return s.approvals.Required() || s.approvalsNeeded(env) > 1
+}
+
+// approver returns the approver named by the request's bearer token, or ""
+// if it has none.
+func (s *Server) approver(c echo.Context) (string, error) {
+	auth := c.Request().Header.Get("Authorization")
+	if auth == "" {
+		return "", nil
+	}
+	token, ok := strings.CutPrefix(auth, "Bearer ")
+	if !ok {
+		return "", errors.New("expected Authorization: Bearer <approver token>")
+	}
+	return s.approvals.Authenticate(strings.TrimSpace(token))
+}
+
+// queueApproval queues env for review and answers 202 with the request.
+// Clients poll GET /api/approvals/:id, or watch the push channel, for the
+// outcome.
+func (s *Server) queueApproval(c echo.Context, env *txbuild.Envelope, origin, note string, broadcast, private bool) error {
+	if _, _, err := s.txSigner(env.From); err != nil {
+		return scheduleError(c, err)
+	}
+	if _, err := env.Transaction(); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	// The reviewer sees the server's checks, not any the submitter sent.
+	s.checkWarnings(c.Request().Context(), env)
+	if env.Blocked {
+		err := fmt.Errorf("%w: %s", errRiskBlocked, critical(env.Warnings).Message)
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
+	r, err := s.approvals.Add(env, origin, note, broadcast, private, s.approvalsNeeded(env))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	slog.Info("approval queued", "subsystem", "approval", "approval", r.ID, "origin", r.Origin, "from", env.From, "needed", r.Needed)
+	s.approvalChanged("queued", r)
+	c.Response().Header().Set("Location", "/api/approvals/"+r.ID)
+	return c.JSON(http.StatusAccepted, map[string]any{"status": "pending_approval", "approval": r})
+}
+
+// handleListApprovals returns queued requests newest first, optionally
+// filtered by ?status=.
+func (s *Server) handleListApprovals(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.approvals.List(c.QueryParam("status")))
+}
+
+// handleSubmitApproval queues a transaction for review. It takes either an
+// envelope from /api/tx/build or the fields to build one, plus an origin
+// label and a note to show the reviewer.
+func (s *Server) handleSubmitApproval(c echo.Context) error {
+	var req struct {
+		txbuild.Request
+		Envelope  *txbuild.Envelope `json:"envelope"`
+		Origin    string            `json:"origin"`
+		Note      string            `json:"note"`
+		Broadcast *bool             `json:"broadcast"`
+		Private   bool              `json:"private"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	env := req.Envelope
+	if env == nil {
+		var err error
+		if env, err = s.buildTx(c.Request().Context(), req.Request); err != nil {
+			return scheduleError(c, err)
+		}
+	}
+	return s.queueApproval(c, env, req.Origin, req.Note, req.Broadcast == nil || *req.Broadcast, req.Private)
+}
+
+// handleGetApproval returns one request, so a client that queued it can poll
+// for the outcome.
+func (s *Server) handleGetApproval(c echo.Context) error {
+	r, ok := s.approvals.Get(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "approval " + c.Param("id") + " not found"})
+	}
+	return c.JSON(http.StatusOK, r)
+}
+
+// handleApprove signs off on a queued request. With its last sign-off, the
+// envelope is signed exactly as it was reviewed and broadcast if the request
+// asked for that; earlier sign-offs answer 202 with the request still
+// pending. A nonce that went stale in the queue fails at broadcast.
+func (s *Server) handleApprove(c echo.Context) error {
+	id := c.Param("id")
+	pending, ok := s.approvals.Get(id)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "approval " + id + " not found"})
+	}
+	who, err := s.approver(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+	}
+	// Leave the request pending if it can't be signed right now. Approve
+	// reports requests that are already decided or expired.
+	if pending.Open(time.Now()) && pending.Awaiting() == 1 && s.vault.Has(pending.Envelope.From) && !s.vault.Status().Unlocked {
+		return c.JSON(http.StatusLocked, map[string]string{"error": "vault is locked"})
+	}
+	claimed, err := s.approvals.Approve(id, who)
+	if err != nil {
+		if errors.Is(err, approval.ErrNoApprover) {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	if claimed.Status == approval.StatusPending {
+		slog.Info("approval signed off", "subsystem", "approval", "approval", id, "approver", who, "awaiting", claimed.Awaiting())
+		s.approvalChanged("signed_off", claimed)
+		return c.JSON(http.StatusAccepted, claimed)
+	}
+
+	signed, sendErr := s.signTx(c.Request().Context(), pending.Envelope, pending.Broadcast, pending.Private, "approval")
+	r, err := s.approvals.Finish(id, signed, sendErr)
+	if err != nil {
+		slog.Error("approval save failed", "subsystem", "approval", "approval", id, "error", err)
+	}
+	s.approvalChanged(r.Status, r)
+	if sendErr != nil {
+		slog.Warn("approved transaction failed", "subsystem", "approval", "approval", id, "error", sendErr)
+		return c.JSON(http.StatusBadGateway, map[string]any{"error": sendErr.Error(), "approval": r})
+	}
+	slog.Info("approval approved", "subsystem", "approval", "approval", id, "approver", who, "tx", signed.Hash)
+	return c.JSON(http.StatusOK, r)
+}
+
+// handleReject drops a pending request without signing it.
+func (s *Server) handleReject(c echo.Context) error {
+	who, err := s.approver(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+	}
+	r, err := s.approvals.Reject(c.Param("id"), who)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		case errors.Is(err, approval.ErrNoApprover):
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	slog.Info("approval rejected", "subsystem", "approval", "approval", r.ID, "approver", who)
+	s.approvalChanged(r.Status, r)
+	return c.JSON(http.StatusOK, r)
+}
@@ -0,0 +1,186 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/asset"
+	"github.com/primal-host/wallet/internal/backup"
+	"github.com/primal-host/wallet/internal/user"
+)
+
+// restoreReport counts what a restore did with one kind of record.
+type restoreReport struct {
+	Added    int      `json:"added"`
+	Replaced int      `json:"replaced"`
+	Skipped  int      `json:"skipped"`
+	Failed   []string `json:"failed,omitempty"`
+}
+
+func (r *restoreReport) fail(name string, err error) {
+	r.Failed = append(r.Failed, name+": "+err.Error())
+}
+
+// handleBackup returns the caller's endpoints, signer accounts, bookmarks,
+// and preferences, plus the assets the endpoints use. The result is not
+// encrypted: the dashboard adds its browser keys and seals the file itself,
+// so the passphrase never reaches the server.
+func (s *Server) handleBackup(c echo.Context) error {
+	p := s.profileFor(c.Request().Context())
+	d := backup.Data{
+		Version:     1,
+		CreatedAt:   time.Now().UTC(),
+		Keys:        []backup.Key{},
+		Endpoints:   p.store.List(),
+		Assets:      []asset.Asset{},
+		Accounts:    p.accounts.List(),
+		Bookmarks:   p.bookmarks.List(),
+		Preferences: p.prefs.Get(),
+	}
+	seen := map[string]bool{}
+	for _, ep := range d.Endpoints {
+		if !seen[ep.Asset] {
+			seen[ep.Asset] = true
+			d.Assets = append(d.Assets, ep.Native)
+		}
+	}
+	slog.Info("backup exported", "subsystem", "backup", "endpoints", len(d.Endpoints), "accounts", len(d.Accounts), "bookmarks", len(d.Bookmarks))
+	return c.JSON(http.StatusOK, d)
+}
+
+// handleRestore restores an opened backup into the caller's profile. Records
+// that already exist, matched by ID or address, are kept with
+// ?conflict=skip (the default) or overwritten with ?conflict=replace; either
+// way deleted records in the recycle bin are replaced. Keys are ignored:
+// they belong in the browser vault.
+func (s *Server) handleRestore(c echo.Context) error {
+	mode := c.QueryParam("conflict")
+	switch mode {
+	case "":
+		mode = "skip"
+	case "skip", "replace":
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "conflict must be skip or replace"})
+	}
+	var d backup.Data
+	if err := c.Bind(&d); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid backup"})
+	}
+	p := s.profileFor(c.Request().Context())
+	replace := mode == "replace"
+
+	// Endpoints refer to their native currency by ID, so missing assets are
+	// registered first. The registry is shared, which takes admin.
+	assets := restoreReport{}
+	if p.can(user.PermAdmin) {
+		for _, a := range d.Assets {
+			if _, ok := p.store.Assets().Get(a.ID); ok {
+				assets.Skipped++
+				continue
+			}
+			if _, err := p.store.Assets().Add(a); err != nil {
+				assets.fail(a.Symbol, err)
+				continue
+			}
+			assets.Added++
+		}
+	}
+
+	endpoints := restoreReport{}
+	for _, ep := range d.Endpoints {
+		_, exists := p.store.Get(ep.ID)
+		if exists && !replace {
+			endpoints.Skipped++
+			continue
+		}
+		if _, err := p.store.Put(ep); err != nil {
+			endpoints.fail(ep.Name, err)
+			continue
+		}
+		if exists {
+			endpoints.Replaced++
+		} else {
+			endpoints.Added++
+		}
+	}
+
+	accounts := restoreReport{}
+	for _, acct := range d.Accounts {
+		_, exists := p.accounts.Get(acct.Address)
+		if exists && !replace {
+			accounts.Skipped++
+			continue
+		}
+		if _, err := p.accounts.Put(acct); err != nil {
+			accounts.fail(acct.Address, err)
+			continue
+		}
+		if exists {
+			accounts.Replaced++
+		} else {
+			accounts.Added++
+		}
+	}
+
+	bookmarks := restoreReport{}
+	for _, b := range d.Bookmarks {
+		_, exists := p.bookmarks.Get(b.ID)
+		if exists && !replace {
+			bookmarks.Skipped++
+			continue
+		}
+		if _, err := p.bookmarks.Put(b); err != nil {
+			bookmarks.fail(b.ID, err)
+			continue
+		}
+		if exists {
+			bookmarks.Replaced++
+		} else {
+			bookmarks.Added++
+		}
+	}
+
+	prefs := restoreReport{}
+	current := p.prefs.Get()
+	patch := map[string]json.RawMessage{}
+	for k, v := range d.Preferences {
+		if string(v) == "null" {
+			continue
+		}
+		_, exists := current[k]
+		switch {
+		case exists && !replace:
+			prefs.Skipped++
+			continue
+		case exists:
+			prefs.Replaced++
+		default:
+			prefs.Added++
+		}
+		patch[k] = v
+	}
+	if len(patch) > 0 {
+		if _, err := p.prefs.Update(patch); err != nil {
+			prefs = restoreReport{}
+			prefs.fail("preferences", err)
+		}
+	}
+
+	failed := 0
+	for _, r := range []restoreReport{assets, endpoints, accounts, bookmarks, prefs} {
+		failed += len(r.Failed)
+	}
+	slog.Info("backup restored", "subsystem", "backup", "conflict", mode, "failed", failed, "by", p.name())
+	return c.JSON(http.StatusOK, map[string]restoreReport{
+		"assets":      assets,
+		"endpoints":   endpoints,
+		"accounts":    accounts,
+		"bookmarks":   bookmarks,
+		"preferences": prefs,
+	})
+}
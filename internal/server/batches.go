@@ -0,0 +1,560 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/primal-host/wallet/internal/approval"
+	"github.com/primal-host/wallet/internal/batch"
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+	"github.com/primal-host/wallet/internal/journal"
+	"github.com/primal-host/wallet/internal/txbuild"
+)
+
+// batchRoutes registers batch sends.
+func (s *Server) batchRoutes() {
+	s.echo.GET("/api/batches", s.handleListBatches)
+	s.echo.POST("/api/batches", s.handleAddBatch)
+	s.echo.POST("/api/batches/preview", s.handlePreviewBatch)
+	s.echo.GET("/api/batches/:id", s.handleGetBatch)
+	s.echo.POST("/api/batches/:id/build", s.handleRebuildBatch)
+	s.echo.POST("/api/batches/:id/send", s.idempotent(s.handleSendBatch))
+	s.echo.DELETE("/api/batches/:id", s.handleDeleteBatch)
+}
+
+// batchRequest is a batch to build. List is CSV or JSON text for
+// batch.Parse, read when Recipients is empty.
+type batchRequest struct {
+	Name       string            `json:"name"`
+	Endpoint   string            `json:"endpoint"`
+	From       string            `json:"from"`
+	Token      string            `json:"token"` // ERC-20 address; empty for the native currency
+	Mode       string            `json:"mode"`  // transfers (the default) or disperse
+	Recipients []batch.Recipient `json:"recipients"`
+	List       string            `json:"list"`
+}
+
+// errBatchInput marks batch errors that are the request's fault.
+var errBatchInput = errors.New("invalid batch")
+
+// handleListBatches returns batches newest first, with their progress.
+func (s *Server) handleListBatches(c echo.Context) error {
+	list := s.batches.List()
+	for i := range list {
+		s.batchProgress(&list[i])
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// handleGetBatch returns a batch with each transaction's journal stage.
+func (s *Server) handleGetBatch(c echo.Context) error {
+	b, ok := s.batches.Get(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "batch " + c.Param("id") + " not found"})
+	}
+	s.batchProgress(&b)
+	return c.JSON(http.StatusOK, b)
+}
+
+// handlePreviewBatch checks and builds a batch without keeping it, so its
+// recipients' problems and its cost can be looked at first.
+func (s *Server) handlePreviewBatch(c echo.Context) error {
+	b, _, err := s.newBatch(c)
+	if err != nil {
+		return batchError(c, err)
+	}
+	p := b.Count()
+	b.Progress = &p
+	return c.JSON(http.StatusOK, b)
+}
+
+// handleAddBatch checks, builds, and keeps a batch. Nothing is kept while
+// a recipient is invalid; the batch comes back with each one's error.
+func (s *Server) handleAddBatch(c echo.Context) error {
+	b, invalid, err := s.newBatch(c)
+	if err != nil {
+		return batchError(c, err)
+	}
+	if invalid > 0 {
+		return c.JSON(http.StatusBadRequest, map[string]any{"error": plural(invalid, "recipient is", "recipients are") + " invalid", "batch": b})
+	}
+	b, err = s.batches.Add(b)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	slog.Info("batch created", "subsystem", "batch", "batch", b.ID, "from", b.From, "recipients", len(b.Recipients), "txs", len(b.Txs), "mode", b.Mode)
+	s.batchProgress(&b)
+	return c.JSON(http.StatusCreated, b)
+}
+
+// handleRebuildBatch builds a batch's unsent transactions again with fresh
+// nonces and fees, as wallets signing them one by one should do first.
+func (s *Server) handleRebuildBatch(c echo.Context) error {
+	b, ok := s.batches.Get(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "batch " + c.Param("id") + " not found"})
+	}
+	b, err := s.rebuildBatch(c.Request().Context(), b)
+	if err != nil {
+		return batchError(c, err)
+	}
+	return c.JSON(http.StatusOK, b)
+}
+
+// handleSendBatch signs and broadcasts a batch's unsent transactions in
+// order with the vault key or remote signer that holds its sender,
+// rebuilding them first. It stops at the first that fails. With
+// REQUIRE_APPROVAL, or under dual control, they are queued for approval
+// instead. A transaction at CONFIRM_THRESHOLD needs the confirmation
+// ("confirm") of its own target and value.
+func (s *Server) handleSendBatch(c echo.Context) error {
+	var req struct {
+		Confirm *txbuild.Confirmation `json:"confirm"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	b, ok := s.batches.Get(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "batch " + c.Param("id") + " not found"})
+	}
+	if s.vault.Has(b.From) && !s.vault.Status().Unlocked {
+		return c.JSON(http.StatusLocked, map[string]string{"error": "vault is locked"})
+	}
+	if _, _, err := s.txSigner(b.From); err != nil {
+		return scheduleError(c, err)
+	}
+	if !s.batchMu.TryLock() {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "a batch is being sent"})
+	}
+	defer s.batchMu.Unlock()
+
+	ctx := c.Request().Context()
+	b, err := s.rebuildBatch(ctx, b)
+	if err != nil {
+		return batchError(c, err)
+	}
+	sent, queued := 0, 0
+	for i, tx := range b.Txs {
+		if tx.Sent() {
+			continue
+		}
+		env := tx.Envelope
+		if s.mustQueue(env) {
+			s.checkWarnings(ctx, env)
+			note := fmt.Sprintf("batch %s, transaction %d of %d", cmp.Or(b.Name, b.ID), i+1, len(b.Txs))
+			r, err := s.approvals.Add(env, "batch", note, true, false, s.approvalsNeeded(env))
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			}
+			s.approvalChanged("queued", r)
+			queued++
+			continue
+		}
+		if err := s.checkConfirmation(ctx, env, req.Confirm); err != nil {
+			s.batchProgress(&b)
+			return c.JSON(http.StatusPreconditionRequired, map[string]any{"error": fmt.Sprintf("transaction %d: %s", i+1, err), "confirm_required": true, "batch": b})
+		}
+		if _, err := s.signTx(ctx, env, true, false, "batch"); err != nil {
+			slog.Warn("batch send failed", "subsystem", "batch", "batch", b.ID, "tx", i+1, "error", err)
+			s.batchProgress(&b)
+			status := http.StatusBadGateway
+			switch {
+			case strings.Contains(err.Error(), "locked"):
+				status = http.StatusLocked
+			case errors.Is(err, errRiskBlocked):
+				status = http.StatusForbidden
+			}
+			return c.JSON(status, map[string]any{"error": fmt.Sprintf("transaction %d: %s", i+1, err), "batch": b})
+		}
+		sent++
+	}
+	slog.Info("batch sent", "subsystem", "batch", "batch", b.ID, "sent", sent, "queued", queued)
+	s.batchProgress(&b)
+	return c.JSON(http.StatusOK, b)
+}
+
+// handleDeleteBatch forgets a batch. What it already sent is unaffected.
+func (s *Server) handleDeleteBatch(c echo.Context) error {
+	if err := s.batches.Delete(c.Param("id")); err != nil {
+		return batchError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// newBatch reads a batch request and builds it, returning how many of its
+// recipients are invalid.
+func (s *Server) newBatch(c echo.Context) (batch.Batch, int, error) {
+	var req batchRequest
+	if err := c.Bind(&req); err != nil {
+		return batch.Batch{}, 0, fmt.Errorf("%w: invalid request", errBatchInput)
+	}
+	recipients := req.Recipients
+	if len(recipients) == 0 {
+		var err error
+		if recipients, err = batch.Parse([]byte(req.List)); err != nil {
+			return batch.Batch{}, 0, fmt.Errorf("%w: %w", errBatchInput, err)
+		}
+	}
+	if len(recipients) > batch.MaxRecipients {
+		return batch.Batch{}, 0, fmt.Errorf("%w: %d recipients; a batch pays at most %d", errBatchInput, len(recipients), batch.MaxRecipients)
+	}
+	b := batch.Batch{Name: strings.TrimSpace(req.Name), Endpoint: req.Endpoint, Mode: cmp.Or(req.Mode, batch.ModeTransfers), Recipients: recipients}
+	if b.Mode != batch.ModeTransfers && b.Mode != batch.ModeDisperse {
+		return batch.Batch{}, 0, fmt.Errorf("%w: mode must be transfers or disperse", errBatchInput)
+	}
+	from, err := evm.ParseAddress(req.From)
+	if err != nil {
+		return batch.Batch{}, 0, fmt.Errorf("%w: from: %w", errBatchInput, err)
+	}
+	b.From = from.Hex()
+	if req.Token != "" {
+		token, err := evm.ParseAddress(req.Token)
+		if err != nil {
+			return batch.Batch{}, 0, fmt.Errorf("%w: token: %w", errBatchInput, err)
+		}
+		b.Token = token.Hex()
+	}
+	invalid, err := s.buildBatch(c.Request().Context(), &b)
+	return b, invalid, err
+}
+
+// buildBatch checks b's recipients and builds its transactions and cost. A
+// recipient is invalid if batch.Validate says so, if it is on the scam
+// list, or if a transfer to it fails to estimate; lookalikes of known
+// addresses are only warned about. While any is invalid nothing is built,
+// and the count is returned.
+func (s *Server) buildBatch(ctx context.Context, b *batch.Batch) (int, error) {
+	ep, ok := s.store.Get(b.Endpoint)
+	if !ok {
+		return 0, fmt.Errorf("endpoint %q not found", b.Endpoint)
+	}
+	decimals, err := s.batchDecimals(ctx, ep, b)
+	if err != nil {
+		return 0, err
+	}
+	amounts, invalid := batch.Validate(b.Recipients, decimals)
+	for i := range b.Recipients {
+		r := &b.Recipients[i]
+		if r.Error != "" {
+			continue
+		}
+		for _, w := range s.checkAddresses(ctx, r.Address) {
+			if w.Severity == txbuild.SeverityCritical {
+				r.Error, amounts[i] = w.Message, nil
+				invalid++
+				break
+			}
+			r.Warning = w.Message
+		}
+	}
+	b.Txs = nil
+	if invalid > 0 {
+		return invalid, nil
+	}
+
+	var allowance *big.Int
+	if b.Mode == batch.ModeDisperse {
+		if code, err := rpcString(ctx, ep, "eth_getCode", s.disperse, "latest"); err != nil {
+			return 0, err
+		} else if code == "" || code == "0x" {
+			return 0, fmt.Errorf("%w: no Disperse contract at %s on %s; use transfers mode", errBatchInput, s.disperse, ep.Name)
+		}
+		if b.Token != "" {
+			if allowance, err = tokenQuantity(ctx, ep, b.Token, "allowance(address,address)", b.From, s.disperse); err != nil {
+				return 0, fmt.Errorf("allowance: %w", err)
+			}
+		}
+	}
+	calls, err := batch.Plan(*b, amounts, s.disperse, allowance)
+	if err != nil {
+		return 0, err
+	}
+	txs, invalid, err := s.buildBatchCalls(ctx, ep, b, calls, false)
+	if err != nil || invalid > 0 {
+		return invalid, err
+	}
+	b.Txs = txs
+	b.Cost, err = s.batchCost(ctx, ep, *b, decimals)
+	return 0, err
+}
+
+// rebuildBatch builds b's unsent transactions again with fresh nonces and
+// fees, in order after those already sent, and saves them. A transfer that
+// no longer estimates fails the rebuild.
+func (s *Server) rebuildBatch(ctx context.Context, b batch.Batch) (batch.Batch, error) {
+	ep, ok := s.store.Get(b.Endpoint)
+	if !ok {
+		return b, fmt.Errorf("endpoint %q not found", b.Endpoint)
+	}
+	decimals, err := s.batchDecimals(ctx, ep, &b)
+	if err != nil {
+		return b, err
+	}
+	s.batchProgress(&b)
+	var calls []batch.Call
+	var unsent []int
+	approving := false // an approval the Disperse call depends on may not be mined yet
+	for i, tx := range b.Txs {
+		if tx.Kind == batch.KindApprove && tx.Stage != journal.StageConfirmed {
+			approving = true
+		}
+		if tx.Sent() {
+			continue
+		}
+		value, _ := evm.ParseQuantity(tx.Envelope.Tx.Value)
+		data, _ := evm.DecodeHex(tx.Envelope.Tx.Data)
+		calls = append(calls, batch.Call{Kind: tx.Kind, Recipients: tx.Recipients, To: tx.Envelope.Tx.To, Value: value, Data: data})
+		unsent = append(unsent, i)
+	}
+	if len(calls) == 0 {
+		return b, nil
+	}
+	built, invalid, err := s.buildBatchCalls(ctx, ep, &b, calls, approving)
+	if err != nil {
+		return b, err
+	}
+	if invalid > 0 {
+		return b, fmt.Errorf("%w: %s no longer estimate; see the recipients' errors", errBatchInput, plural(invalid, "transfer does", "transfers do"))
+	}
+	txs := slices.Clone(b.Txs)
+	for j, i := range unsent {
+		txs[i] = built[j]
+	}
+	b.Txs = txs
+	cost, err := s.batchCost(ctx, ep, b, decimals)
+	if err != nil {
+		return b, err
+	}
+	saved, err := s.batches.SetTxs(b.ID, txs, cost)
+	if err != nil {
+		return b, err
+	}
+	s.batchProgress(&saved)
+	return saved, nil
+}
+
+// buildBatchCalls builds calls from b's sender with consecutive nonces from
+// its pending one and the fees of the first. A transfer that fails to
+// estimate marks its recipient invalid, and the count is returned. A
+// Disperse call after an approval in the same calls, or with approving set,
+// can't be estimated until the approval is mined, and gets
+// batch.DisperseGas.
+func (s *Server) buildBatchCalls(ctx context.Context, ep endpoint.Endpoint, b *batch.Batch, calls []batch.Call, approving bool) ([]batch.Tx, int, error) {
+	nonce, err := rpcQuantity(ctx, ep, "eth_getTransactionCount", b.From, "pending")
+	if err != nil {
+		return nil, 0, fmt.Errorf("nonce: %w", err)
+	}
+	var txs []batch.Tx
+	var first *txbuild.Envelope
+	invalid := 0
+	for _, call := range calls {
+		req := txbuild.Request{
+			Endpoint: ep.ID,
+			From:     b.From,
+			To:       call.To,
+			Value:    call.Value.String(),
+			Data:     evm.EncodeHex(call.Data),
+			Nonce:    new(big.Int).Add(nonce, big.NewInt(int64(len(txs)))).String(),
+		}
+		if first != nil {
+			req.MaxFeePerGas, req.MaxPriorityFeePerGas = first.Tx.MaxFeePerGas, first.Tx.MaxPriorityFeePerGas
+		}
+		env, err := txbuild.Build(ctx, ep, req)
+		if err != nil && call.Kind == batch.KindDisperse && approving {
+			req.Gas = strconv.FormatUint(batch.DisperseGas(len(call.Recipients)), 10)
+			env, err = txbuild.Build(ctx, ep, req)
+		}
+		if err != nil {
+			if call.Kind != batch.KindTransfer {
+				return nil, 0, fmt.Errorf("%s: %w", call.Kind, err)
+			}
+			b.Recipients[call.Recipients[0]].Error = "the transfer would fail: " + err.Error()
+			invalid++
+			continue
+		}
+		if call.Kind == batch.KindApprove {
+			approving = true
+		}
+		if first == nil {
+			first = env
+		}
+		txs = append(txs, batch.Tx{Kind: call.Kind, Recipients: call.Recipients, Envelope: env})
+	}
+	if invalid > 0 {
+		return nil, invalid, nil
+	}
+	return txs, 0, nil
+}
+
+// batchDecimals returns the decimals of what b sends. A token must be
+// registered on the endpoint's chain.
+func (s *Server) batchDecimals(ctx context.Context, ep endpoint.Endpoint, b *batch.Batch) (int, error) {
+	if b.Token == "" {
+		return ep.Native.Decimals, nil
+	}
+	chainID, err := endpointChainID(ctx, ep)
+	if err != nil {
+		return 0, fmt.Errorf("chain id: %w", err)
+	}
+	t, ok := s.erc20.Get(chainID, b.Token)
+	if !ok {
+		return 0, fmt.Errorf("%w: token %s isn't registered on chain %d; add it under ERC-20 first", errBatchInput, b.Token, chainID)
+	}
+	return t.Decimals, nil
+}
+
+// batchCost adds up what b's unsent transactions take and reads the
+// sender's balances to compare.
+func (s *Server) batchCost(ctx context.Context, ep endpoint.Endpoint, b batch.Batch, decimals int) (batch.Cost, error) {
+	total, fees := new(big.Int), new(big.Int)
+	for _, tx := range b.Txs {
+		if tx.Sent() {
+			continue
+		}
+		for _, i := range tx.Recipients {
+			if n, err := evm.ParseUnits(b.Recipients[i].Amount, decimals); err == nil {
+				total.Add(total, n)
+			}
+		}
+		gas, _ := evm.ParseQuantity(tx.Envelope.Tx.Gas)
+		price, _ := evm.ParseQuantity(tx.Envelope.Tx.MaxFeePerGas)
+		if gas != nil && price != nil {
+			fees.Add(fees, new(big.Int).Mul(gas, price))
+		}
+		if l1 := tx.Envelope.L1Fee; l1 != nil && !l1.Included {
+			if n, err := evm.ParseQuantity(l1.Fee); err == nil {
+				fees.Add(fees, n)
+			}
+		}
+	}
+	needed := new(big.Int).Set(fees)
+	if b.Token == "" {
+		needed.Add(needed, total)
+	}
+	balance, err := rpcQuantity(ctx, ep, "eth_getBalance", b.From, "latest")
+	if err != nil {
+		return batch.Cost{}, fmt.Errorf("balance: %w", err)
+	}
+	cost := batch.Cost{
+		Symbol:  ep.Native.Symbol,
+		Total:   evm.FormatUnits(total, decimals),
+		MaxFee:  ep.Native.Format(fees),
+		Needed:  ep.Native.Format(needed),
+		Balance: ep.Native.Format(balance),
+		Short:   balance.Cmp(needed) < 0,
+	}
+	if b.Token != "" {
+		tokens, err := tokenQuantity(ctx, ep, b.Token, "balanceOf(address)", b.From)
+		if err != nil {
+			return batch.Cost{}, fmt.Errorf("token balance: %w", err)
+		}
+		chainID, _ := endpointChainID(ctx, ep)
+		cost.Symbol = s.tokenName(chainID, b.Token)
+		cost.TokenBalance = evm.FormatUnits(tokens, decimals)
+		cost.Short = cost.Short || tokens.Cmp(total) < 0
+	}
+	return cost, nil
+}
+
+// batchProgress sets each of b's transactions' hash and stage from the
+// journal, or queued while one waits for approval, and counts them.
+func (s *Server) batchProgress(b *batch.Batch) {
+	intents := s.journal.List("")
+	pending := s.approvals.List(approval.StatusPending)
+	for i := range b.Txs {
+		tx := &b.Txs[i]
+		tx.Hash, tx.Stage, tx.Error = "", "", ""
+		env := tx.Envelope
+		if env == nil {
+			continue
+		}
+		// The journal keeps a send's fields, not its calldata; the
+		// newest send matching them is this transaction's.
+		j := slices.IndexFunc(intents, func(in journal.Intent) bool {
+			return in.ChainID == env.ChainID && in.Nonce == env.Tx.Nonce && in.Value == env.Tx.Value &&
+				strings.EqualFold(in.From, env.From) && strings.EqualFold(in.To, env.Tx.To)
+		})
+		if j >= 0 {
+			tx.Hash, tx.Stage, tx.Error = intents[j].Hash, intents[j].Stage, intents[j].Error
+		} else if slices.ContainsFunc(pending, func(r approval.Request) bool { return r.Envelope != nil && r.Envelope.HashToSign == env.HashToSign }) {
+			tx.Stage = batch.StageQueued
+		}
+	}
+	p := b.Count()
+	b.Progress = &p
+}
+
+// rpcQuantity makes a call on ep whose result is a hex quantity.
+func rpcQuantity(ctx context.Context, ep endpoint.Endpoint, method string, params ...any) (*big.Int, error) {
+	s, err := rpcString(ctx, ep, method, params...)
+	if err != nil {
+		return nil, err
+	}
+	return evm.ParseQuantity(s)
+}
+
+// rpcString makes a call on ep whose result is a string.
+func rpcString(ctx context.Context, ep endpoint.Endpoint, method string, params ...any) (string, error) {
+	raw, err := endpoint.RPCCall(ctx, ep, method, params)
+	if err != nil {
+		return "", err
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", fmt.Errorf("unexpected %s result: %s", method, raw)
+	}
+	return s, nil
+}
+
+// tokenQuantity calls a view function of token that takes addresses and
+// returns a uint256.
+func tokenQuantity(ctx context.Context, ep endpoint.Endpoint, token, signature string, addresses ...string) (*big.Int, error) {
+	data := evm.Keccak256([]byte(signature))[:4]
+	for _, a := range addresses {
+		addr, err := evm.ParseAddress(a)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, make([]byte, 12)...)
+		data = append(data, addr[:]...)
+	}
+	out, err := rpcString(ctx, ep, "eth_call", map[string]string{"to": token, "data": evm.EncodeHex(data)}, "latest")
+	if err != nil {
+		return nil, err
+	}
+	b, err := evm.DecodeHex(out)
+	if err != nil || len(b) < 32 {
+		return nil, fmt.Errorf("unexpected eth_call result: %s", out)
+	}
+	return new(big.Int).SetBytes(b[:32]), nil
+}
+
+// batchError writes a batch failure: 400 for the request's own problems,
+// 404 for what doesn't exist, and 502 for the endpoint's.
+func batchError(c echo.Context, err error) error {
+	msg := strings.TrimPrefix(err.Error(), errBatchInput.Error()+": ")
+	switch {
+	case errors.Is(err, errBatchInput):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	case strings.Contains(msg, "not found"):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": msg})
+	case strings.Contains(msg, "marshal"), strings.Contains(msg, "write"):
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": msg})
+	}
+	return c.JSON(http.StatusBadGateway, map[string]string{"error": msg})
+}
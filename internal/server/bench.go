@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/primal-host/wallet/internal/bench"
+)
+
+// handleBench returns an endpoint's last benchmark.
+func (s *Server) handleBench(c echo.Context) error {
+	id := c.Param("id")
+	if _, ok := s.store.Get(id); !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "endpoint not found"})
+	}
+	r, ok := s.benches.Get(id)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "endpoint not benchmarked yet"})
+	}
+	return c.JSON(http.StatusOK, r)
+}
+
+// handleRunBench benchmarks an endpoint, keeps the result, and returns it.
+// It makes a few dozen calls and can take as many seconds.
+func (s *Server) handleRunBench(c echo.Context) error {
+	ep, ok := s.store.Get(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "endpoint not found"})
+	}
+	ctx, cancel := s.pollContext(c.Request().Context())
+	defer cancel()
+	r, err := bench.Run(ctx, ep)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	if err := s.benches.Put(r); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, r)
+}
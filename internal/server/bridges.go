@@ -0,0 +1,104 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/bridge"
+)
+
+// bridgeTick is how often tracked bridge transfers are checked.
+const bridgeTick = 15 * time.Second
+
+// bridgeRoutes registers bridge transfer tracking.
+func (s *Server) bridgeRoutes() {
+	s.echo.GET("/api/bridges", s.handleListBridges)
+	s.echo.POST("/api/bridges", s.handleAddBridge)
+	s.echo.GET("/api/bridges/:id", s.handleGetBridge)
+	s.echo.DELETE("/api/bridges/:id", s.handleDeleteBridge)
+}
+
+// runBridges checks tracked bridge transfers until the server shuts down,
+// and pushes each status change to the server profile's dashboards as a
+// bridge message.
+func (s *Server) runBridges() {
+	t := time.NewTicker(bridgeTick)
+	defer t.Stop()
+	for {
+		changed, err := s.bridges.Check(s.ctx, s.store.Get)
+		if err != nil {
+			slog.Error("bridge save failed", "subsystem", "bridge", "error", err)
+		}
+		for _, tr := range changed {
+			s.bridgeChanged(tr)
+		}
+		select {
+		case <-s.closing:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// bridgeChanged logs a transfer's new status and pushes it to the server
+// profile's dashboards.
+func (s *Server) bridgeChanged(tr bridge.Transfer) {
+	if tr.Status == bridge.StatusFailed || tr.Status == bridge.StatusStalled {
+		slog.Warn("bridge transfer "+tr.Status, "subsystem", "bridge", "bridge", tr.ID, "source_tx", tr.SourceHash, "error", tr.Error)
+	} else {
+		slog.Info("bridge transfer "+strings.ReplaceAll(tr.Status, "_", " "), "subsystem", "bridge", "bridge", tr.ID, "source_tx", tr.SourceHash, "received", tr.Received, "arrival_tx", tr.ArrivalHash)
+	}
+	s.hub.broadcastShared(map[string]any{"type": "bridge", "bridge": tr})
+}
+
+// handleListBridges returns bridge transfers newest first, optionally
+// filtered by ?status=.
+func (s *Server) handleListBridges(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.bridges.List(c.QueryParam("status")))
+}
+
+// handleGetBridge returns one bridge transfer.
+func (s *Server) handleGetBridge(c echo.Context) error {
+	tr, ok := s.bridges.Get(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "bridge transfer not found"})
+	}
+	return c.JSON(http.StatusOK, tr)
+}
+
+// handleAddBridge starts tracking a bridge transfer sent from one of the
+// server's endpoints to another.
+func (s *Server) handleAddBridge(c echo.Context) error {
+	var req bridge.Transfer
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	src, ok := s.store.Get(req.SourceEndpoint)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "source endpoint not found"})
+	}
+	dst, ok := s.store.Get(req.DestEndpoint)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "destination endpoint not found"})
+	}
+	tr, err := s.bridges.Add(c.Request().Context(), src, dst, req)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	slog.Info("bridge transfer registered", "subsystem", "bridge", "bridge", tr.ID, "source", tr.SourceEndpoint, "dest", tr.DestEndpoint, "source_tx", tr.SourceHash, "by", s.profileFor(c.Request().Context()).name())
+	s.hub.broadcastShared(map[string]any{"type": "bridge", "bridge": tr})
+	return c.JSON(http.StatusCreated, tr)
+}
+
+// handleDeleteBridge stops tracking a bridge transfer.
+func (s *Server) handleDeleteBridge(c echo.Context) error {
+	if err := s.bridges.Delete(c.Param("id")); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "deleted"})
+}
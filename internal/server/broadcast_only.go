@@ -0,0 +1,57 @@
+//go:build broadcastonly
+
+package server
+
+import (
+	"context"
+
+	"github.com/primal-host/wallet/internal/abi"
+	"github.com/primal-host/wallet/internal/bench"
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/graphql"
+	"github.com/primal-host/wallet/internal/icon"
+	"github.com/primal-host/wallet/internal/idempotency"
+	"github.com/primal-host/wallet/internal/logtail"
+	"github.com/primal-host/wallet/internal/uptime"
+)
+
+// Broadcast-only builds compile out every key, signer, and management route,
+// leaving endpoint monitoring, the RPC proxy, and /api/broadcast.
+const broadcastOnly = true
+
+type manageState struct{}
+
+func New(store *endpoint.Store, idem *idempotency.Store, icons *icon.Cache, history *uptime.Store, benches *bench.Store, limits Limits, headers Headers, proxy Proxy, logs *logtail.Tail, addr string) *Server {
+	return newServer(store, idem, icons, history, benches, limits, headers, proxy, logs, addr)
+}
+
+// storeFor is always the one endpoint store: there are no user profiles.
+func (s *Server) storeFor(context.Context) *endpoint.Store { return s.store }
+
+// sharedFor is always true: broadcast-only builds have no users.
+func (s *Server) sharedFor(context.Context) bool { return true }
+
+// ownAddresses is always empty: there are no signer accounts.
+func (s *Server) ownAddresses(context.Context) []string { return nil }
+
+// rpcAllowed allows every method: there are no roles.
+func (s *Server) rpcAllowed(context.Context, string) error { return nil }
+
+// customErrors is empty: the ABI registry is compiled out.
+func (s *Server) customErrors() []abi.Function { return nil }
+
+// currentLockEpoch is always zero: there is nothing to lock.
+func (s *Server) currentLockEpoch() int64 { return 0 }
+
+// checkAlerts does nothing: alerts are compiled out.
+func (s *Server) checkAlerts([]endpoint.Status) {}
+
+// principal is always empty: every request is the server's.
+func (s *Server) principal(context.Context) string { return "" }
+
+// validToken is always false: there are no API tokens.
+func (s *Server) validToken(string) bool { return false }
+
+// manageGraphQL adds nothing: accounts, the vault, bookmarks, and the faucet
+// are compiled out.
+func (s *Server) manageGraphQL(*graphql.Schema) {}
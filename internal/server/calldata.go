@@ -0,0 +1,136 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/abi"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// calldataRoutes registers the ABI registry and the calldata builder.
+func (s *Server) calldataRoutes() {
+	s.echo.GET("/api/abis", s.handleListABIs)
+	s.echo.POST("/api/abis", s.handleAddABI)
+	s.echo.DELETE("/api/abis/:id", s.handleDeleteABI)
+	s.echo.POST("/api/calldata/encode", s.handleEncodeCalldata)
+	s.echo.POST("/api/calldata/decode", s.handleDecodeCalldata)
+}
+
+// handleListABIs lists registered ABIs with their functions' signatures and
+// selectors.
+func (s *Server) handleListABIs(c echo.Context) error {
+	out := []abi.Summary{}
+	for _, contract := range s.abis.List() {
+		out = append(out, contract.Summary())
+	}
+	return c.JSON(http.StatusOK, out)
+}
+
+// handleAddABI registers a JSON ABI, or a compiler artifact holding one,
+// under a name.
+func (s *Server) handleAddABI(c echo.Context) error {
+	var req struct {
+		Name string          `json:"name"`
+		ABI  json.RawMessage `json:"abi"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	contract, err := s.abis.Add(req.Name, req.ABI)
+	if err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, contract.Summary())
+}
+
+// handleDeleteABI removes an ABI.
+func (s *Server) handleDeleteABI(c echo.Context) error {
+	if err := s.abis.Delete(c.Param("id")); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// handleEncodeCalldata encodes a call to a registered function. The result
+// is decoded and encoded again, and the arguments returned are the decoded
+// ones, so what is shown is what the calldata says.
+func (s *Server) handleEncodeCalldata(c echo.Context) error {
+	var req struct {
+		ABI      string `json:"abi"`
+		Function string `json:"function"` // name, signature, or selector
+		Args     []any  `json:"args"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	contract, ok := s.abis.Get(req.ABI)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "ABI " + req.ABI + " not found"})
+	}
+	f, err := abi.Lookup(contract.Functions(), req.Function)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if req.Args == nil {
+		req.Args = []any{}
+	}
+	data, err := abi.Encode(f, req.Args)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	call, err := contract.DecodeCall(f, data)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, call)
+}
+
+// handleDecodeCalldata decodes calldata with the named ABI, or with the
+// first registered function whose selector matches.
+func (s *Server) handleDecodeCalldata(c echo.Context) error {
+	var req struct {
+		ABI  string `json:"abi"`
+		Data string `json:"data"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	data, err := evm.DecodeHex(strings.TrimSpace(req.Data))
+	if err != nil || len(data) < 4 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "data must be 0x hex calldata with a 4-byte selector"})
+	}
+	var (
+		contract abi.Contract
+		f        abi.Function
+	)
+	if req.ABI != "" {
+		var ok bool
+		if contract, ok = s.abis.Get(req.ABI); !ok {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "ABI " + req.ABI + " not found"})
+		}
+		if f, err = abi.Lookup(contract.Functions(), evm.EncodeHex(data[:4])); err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "no function in " + contract.Name + " has selector " + evm.EncodeHex(data[:4])})
+		}
+	} else {
+		var ok bool
+		if contract, f, ok = s.abis.FindSelector(data[:4]); !ok {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "no registered function has selector " + evm.EncodeHex(data[:4])})
+		}
+	}
+	call, err := contract.DecodeCall(f, data)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, call)
+}
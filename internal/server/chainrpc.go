@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// chainStickiness is how long calls for a chain keep going to the endpoint
+// picked for it, so a client reading block by block doesn't see the head
+// jump back and forth between endpoints a block apart.
+const chainStickiness = 30 * time.Second
+
+// headSlack is how many blocks behind the highest head an endpoint may be
+// and still be picked for its latency. Endpoints hear of a new block a
+// moment apart.
+const headSlack = 1
+
+// chainPick is the endpoint picked for a chain, and when.
+type chainPick struct {
+	id string
+	at time.Time
+}
+
+// handleChainRPC proxies a JSON-RPC request, or a batch of them, to the
+// best endpoint of a chain, named by decimal or 0x hex chain ID. The
+// endpoint picked is named in the X-Served-By header.
+func (s *Server) handleChainRPC(c echo.Context) error {
+	chainID, err := parseChainID(c.Param("chain"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	ctx, cancel := s.pollContext(c.Request().Context())
+	defer cancel()
+	target, status, err := s.poller.best(ctx, s.storeFor(c.Request().Context()), chainID)
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+	c.Response().Header().Set("X-Served-By", target.ID)
+	return s.proxyRPC(c, target)
+}
+
+// best returns the endpoint of store to send calls for chainID to. The one
+// picked last is kept for chainStickiness while it stays eligible; after
+// that the eligible endpoint at the highest head, give or take headSlack,
+// with the lowest latency is picked. On failure it also returns the HTTP
+// status to answer with.
+func (p *poller) best(ctx context.Context, store *endpoint.Store, chainID uint64) (endpoint.Endpoint, int, error) {
+	statuses := p.statuses(ctx, store)
+	if statuses == nil {
+		return endpoint.Endpoint{}, http.StatusServiceUnavailable, fmt.Errorf("status not polled yet")
+	}
+	eligible, served := eligibleForChain(statuses, chainID)
+	if len(eligible) == 0 {
+		if !served {
+			return endpoint.Endpoint{}, http.StatusNotFound, fmt.Errorf("no endpoint serves chain %d", chainID)
+		}
+		return endpoint.Endpoint{}, http.StatusServiceUnavailable, fmt.Errorf("no endpoint of chain %d is online", chainID)
+	}
+
+	now := time.Now()
+	p.mu.Lock()
+	ss := p.seen[store]
+	var id string
+	if ss != nil {
+		if pick, ok := ss.picks[chainID]; ok && now.Sub(pick.at) < chainStickiness &&
+			slices.ContainsFunc(eligible, func(st endpoint.Status) bool { return st.ID == pick.id }) {
+			id = pick.id
+		}
+	}
+	if id == "" {
+		id = fastestAtHead(eligible).ID
+		if ss != nil {
+			if ss.picks == nil {
+				ss.picks = map[uint64]chainPick{}
+			}
+			ss.picks[chainID] = chainPick{id: id, at: now}
+		}
+	}
+	p.mu.Unlock()
+
+	ep, ok := store.Get(id)
+	if !ok {
+		return endpoint.Endpoint{}, http.StatusServiceUnavailable, fmt.Errorf("no endpoint of chain %d is online", chainID)
+	}
+	return ep, 0, nil
+}
+
+// eligibleForChain returns the statuses of endpoints online on chainID
+// that aren't forked, leaving out lagging ones unless every one lags, and
+// whether any endpoint was seen on the chain at all. Private endpoints,
+// which are for sends, are left out.
+func eligibleForChain(statuses []endpoint.Status, chainID uint64) (eligible []endpoint.Status, served bool) {
+	var lagging []endpoint.Status
+	for _, st := range statuses {
+		if st.ChainID == "" || st.Private {
+			continue
+		}
+		if n, err := evm.ParseQuantity(st.ChainID); err != nil || !n.IsUint64() || n.Uint64() != chainID {
+			continue
+		}
+		served = true
+		switch {
+		case !st.Online || slices.Contains(st.Flags, endpoint.FlagForked):
+		case slices.Contains(st.Flags, endpoint.FlagLagging):
+			lagging = append(lagging, st)
+		default:
+			eligible = append(eligible, st)
+		}
+	}
+	if len(eligible) == 0 {
+		eligible = lagging
+	}
+	return eligible, served
+}
+
+// fastestAtHead returns the status with the lowest latency among those at
+// most headSlack blocks behind the highest. statuses isn't empty.
+func fastestAtHead(statuses []endpoint.Status) endpoint.Status {
+	blocks := make([]uint64, len(statuses))
+	var top uint64
+	for i, st := range statuses {
+		blocks[i] = polledHead(st)
+		top = max(top, blocks[i])
+	}
+	best := -1
+	for i, st := range statuses {
+		if blocks[i]+headSlack < top {
+			continue
+		}
+		if best < 0 || st.Latency < statuses[best].Latency {
+			best = i
+		}
+	}
+	return statuses[best]
+}
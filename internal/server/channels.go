@@ -0,0 +1,112 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/alert"
+	"github.com/primal-host/wallet/internal/notify"
+)
+
+// channelRoutes registers notification channel management.
+func (s *Server) channelRoutes() {
+	s.echo.GET("/api/channels", s.handleListChannels)
+	s.echo.POST("/api/channels", s.handleAddChannel)
+	s.echo.GET("/api/channels/:id", s.handleGetChannel)
+	s.echo.PUT("/api/channels/:id", s.handleUpdateChannel)
+	s.echo.DELETE("/api/channels/:id", s.handleDeleteChannel)
+	s.echo.POST("/api/channels/:id/test", s.handleTestChannel)
+}
+
+// notifyKinds are the kinds of notification the server sends: the alert
+// kinds and journaled send outcomes.
+var notifyKinds = append(slices.Clone(alert.Kinds), notify.KindTx)
+
+// checkKinds checks that a channel or push subscription only picks kinds
+// of notification the server sends.
+func checkKinds(kinds []string) error {
+	for _, k := range kinds {
+		if !slices.Contains(notifyKinds, strings.TrimSpace(k)) {
+			return fmt.Errorf("unknown kind %q: use %s", k, strings.Join(notifyKinds, ", "))
+		}
+	}
+	return nil
+}
+
+// handleListChannels returns the notification channels, without secrets.
+func (s *Server) handleListChannels(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.channels.List())
+}
+
+// handleGetChannel returns one notification channel, without secrets.
+func (s *Server) handleGetChannel(c echo.Context) error {
+	ch, ok := s.channels.Get(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "channel not found"})
+	}
+	return c.JSON(http.StatusOK, ch)
+}
+
+// handleAddChannel creates a notification channel.
+func (s *Server) handleAddChannel(c echo.Context) error {
+	var req notify.Channel
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if err := checkKinds(req.Kinds); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	ch, err := s.channels.Add(req)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	slog.Info("channel added", "subsystem", "notify", "channel", ch.ID, "type", ch.Type, "by", s.profileFor(c.Request().Context()).name())
+	return c.JSON(http.StatusCreated, ch)
+}
+
+// handleUpdateChannel replaces a notification channel's settings; secrets
+// left empty are kept.
+func (s *Server) handleUpdateChannel(c echo.Context) error {
+	var req notify.Channel
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if err := checkKinds(req.Kinds); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	ch, err := s.channels.Update(c.Param("id"), req)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, ch)
+}
+
+// handleDeleteChannel removes a notification channel.
+func (s *Server) handleDeleteChannel(c echo.Context) error {
+	if err := s.channels.Delete(c.Param("id")); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// handleTestChannel sends a test notification over a channel and reports
+// how it went.
+func (s *Server) handleTestChannel(c echo.Context) error {
+	id := c.Param("id")
+	if _, ok := s.channels.Get(id); !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "channel not found"})
+	}
+	if err := s.channels.Test(id); err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "sent"})
+}
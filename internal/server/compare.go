@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/endpoint"
+)
+
+// handleCompare measures two endpoints side by side (?a=&b=): block height,
+// latency, gas price, and pending pool size.
+func (s *Server) handleCompare(c echo.Context) error {
+	ctx, cancel := s.pollContext(c.Request().Context())
+	defer cancel()
+	metrics, err := compareEndpoints(ctx, s.storeFor(ctx), c.QueryParam("a"), c.QueryParam("b"))
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]any{"endpoints": metrics})
+}
+
+// compareEndpoints measures a and b from store concurrently. Comparing
+// providers only makes sense on one chain, so it fails when both answer with
+// different chain IDs.
+func compareEndpoints(ctx context.Context, store *endpoint.Store, a, b string) ([]endpoint.Metrics, error) {
+	if a == "" || b == "" {
+		return nil, fmt.Errorf("give two endpoints to compare")
+	}
+	if a == b {
+		return nil, fmt.Errorf("pick two different endpoints")
+	}
+	eps := make([]endpoint.Endpoint, 2)
+	for i, id := range []string{a, b} {
+		ep, ok := store.Get(id)
+		if !ok {
+			return nil, fmt.Errorf("endpoint %q not found", id)
+		}
+		eps[i] = ep
+	}
+
+	metrics := make([]endpoint.Metrics, 2)
+	var wg sync.WaitGroup
+	for i, ep := range eps {
+		wg.Add(1)
+		go func(i int, ep endpoint.Endpoint) {
+			defer wg.Done()
+			metrics[i] = endpoint.Measure(ctx, ep)
+		}(i, ep)
+	}
+	wg.Wait()
+	if x, y := metrics[0].ChainID, metrics[1].ChainID; x != "" && y != "" && x != y {
+		return nil, fmt.Errorf("%s and %s serve different chains", eps[0].Name, eps[1].Name)
+	}
+	return metrics, nil
+}
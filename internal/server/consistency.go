@@ -0,0 +1,215 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// headMarkTTL is how long a chain's high-water mark holds after it was
+// last raised. A devnet restarted from block 0 is served again once it
+// passes.
+const headMarkTTL = time.Minute
+
+// headMark is the highest head of a chain the proxy has reported.
+type headMark struct {
+	block uint64
+	at    time.Time
+}
+
+// headGuard keeps the proxy from reporting a chain's head going backwards
+// when its calls move between endpoints: through the chain route, hedging,
+// or archive routing. It knows the head from results that report it, and
+// holds reads of the latest state to an endpoint known to have that head.
+type headGuard struct {
+	p       *poller
+	store   *endpoint.Store
+	chainID uint64
+}
+
+// guard returns the head guard for target's chain, or nil while target's
+// chain isn't known from a poll.
+func (p *poller) guard(store *endpoint.Store, target endpoint.Endpoint) *headGuard {
+	st, ok := p.status(store, target.ID)
+	if !ok || st.ChainID == "" {
+		return nil
+	}
+	n, err := evm.ParseQuantity(st.ChainID)
+	if err != nil || !n.IsUint64() {
+		return nil
+	}
+	return &headGuard{p: p, store: store, chainID: n.Uint64()}
+}
+
+// mark returns the chain's high-water mark, or 0 if none holds.
+func (g *headGuard) mark() uint64 {
+	g.p.mu.Lock()
+	defer g.p.mu.Unlock()
+	ss, ok := g.p.seen[g.store]
+	if !ok {
+		return 0
+	}
+	m, ok := ss.marks[g.chainID]
+	if !ok || time.Since(m.at) >= headMarkTTL {
+		return 0
+	}
+	return m.block
+}
+
+// markLead is how far past the chain's highest polled head a result may
+// raise the mark. An endpoint that reports a head far beyond what polling
+// saw would otherwise hold every other endpoint's reads back until
+// headMarkTTL.
+const markLead = 128
+
+// raise records head as reported by the endpoint with the given ID, and
+// raises the chain's mark to it if it is the highest yet. An endpoint the
+// last poll flagged as forked or lagging doesn't move the mark, and no
+// endpoint moves it more than markLead blocks past the highest polled head.
+func (g *headGuard) raise(id string, head uint64) {
+	g.p.mu.Lock()
+	defer g.p.mu.Unlock()
+	ss, ok := g.p.seen[g.store]
+	if !ok {
+		return
+	}
+	if ss.marks == nil {
+		ss.marks = map[uint64]headMark{}
+	}
+	if ss.heads == nil {
+		ss.heads = map[string]headMark{}
+	}
+	now := time.Now()
+	if m := ss.heads[id]; head >= m.block || now.Sub(m.at) >= headMarkTTL {
+		ss.heads[id] = headMark{block: head, at: now}
+	}
+	var top uint64
+	for _, st := range ss.statuses {
+		if st.ID == id && (slices.Contains(st.Flags, endpoint.FlagForked) || slices.Contains(st.Flags, endpoint.FlagLagging)) {
+			return
+		}
+		if n, err := evm.ParseQuantity(st.ChainID); err == nil && n.IsUint64() && n.Uint64() == g.chainID {
+			top = max(top, polledHead(st))
+		}
+	}
+	if top > 0 {
+		head = min(head, top+markLead)
+	}
+	if m := ss.marks[g.chainID]; head >= m.block || now.Sub(m.at) >= headMarkTTL {
+		ss.marks[g.chainID] = headMark{block: head, at: now}
+	}
+}
+
+// behind reports whether the endpoint with the given ID is known to be
+// behind the mark: the higher of its polled head and the heads its results
+// reported is below it.
+func (g *headGuard) behind(id string) bool {
+	mark := g.mark()
+	g.p.mu.Lock()
+	defer g.p.mu.Unlock()
+	ss, ok := g.p.seen[g.store]
+	if !ok {
+		return false
+	}
+	var head uint64
+	if i := slices.IndexFunc(ss.statuses, func(st endpoint.Status) bool { return st.ID == id }); i >= 0 {
+		head = polledHead(ss.statuses[i])
+	}
+	if m, ok := ss.heads[id]; ok && time.Since(m.at) < headMarkTTL {
+		head = max(head, m.block)
+	}
+	return head > 0 && head < mark
+}
+
+// check reports whether result, of method called with params on the
+// endpoint with ID servedBy, may be returned. A result that reports a head
+// may if the head isn't below the mark, which it then raises. A read of
+// the latest or pending state reports none, so it may unless its endpoint
+// is known to be behind the mark.
+func (g *headGuard) check(servedBy, method string, params []any, result json.RawMessage) bool {
+	if head, ok := reportedHead(method, params, result); ok {
+		if head < g.mark() {
+			return false
+		}
+		g.raise(servedBy, head)
+		return true
+	}
+	return !endpoint.AtHead(method, params) || !g.behind(servedBy)
+}
+
+// retry calls method on the chain's other online endpoints, highest polled
+// head first, until one answers with a head not below the mark. It skips
+// the endpoints in tried and, for reads of the latest state, those known
+// to be behind the mark.
+func (g *headGuard) retry(ctx context.Context, method string, params []any, tried ...string) (json.RawMessage, endpoint.Endpoint, error) {
+	g.p.mu.Lock()
+	var statuses []endpoint.Status
+	if ss, ok := g.p.seen[g.store]; ok {
+		statuses = slices.Clone(ss.statuses)
+	}
+	g.p.mu.Unlock()
+
+	candidates, _ := eligibleForChain(statuses, g.chainID)
+	slices.SortStableFunc(candidates, func(a, b endpoint.Status) int {
+		return cmp.Compare(polledHead(b), polledHead(a))
+	})
+	for _, st := range candidates {
+		if slices.Contains(tried, st.ID) || endpoint.AtHead(method, params) && g.behind(st.ID) {
+			continue
+		}
+		ep, ok := g.store.Get(st.ID)
+		if !ok {
+			continue
+		}
+		result, err := endpoint.RPCCall(ctx, ep, method, params)
+		if err != nil || !g.check(ep.ID, method, params, result) {
+			continue
+		}
+		return result, ep, nil
+	}
+	return nil, endpoint.Endpoint{}, fmt.Errorf("every endpoint of chain %d is behind block %d, already reported", g.chainID, g.mark())
+}
+
+// reportedHead returns the head a result reports: eth_blockNumber's, or
+// the number of the block eth_getBlockByNumber returns for "latest".
+func reportedHead(method string, params []any, result json.RawMessage) (uint64, bool) {
+	var hex string
+	switch method {
+	case "eth_blockNumber":
+		if json.Unmarshal(result, &hex) != nil {
+			return 0, false
+		}
+	case "eth_getBlockByNumber":
+		if len(params) == 0 || params[0] != "latest" {
+			return 0, false
+		}
+		var block struct {
+			Number string `json:"number"`
+		}
+		if json.Unmarshal(result, &block) != nil {
+			return 0, false
+		}
+		hex = block.Number
+	default:
+		return 0, false
+	}
+	n, err := evm.ParseQuantity(hex)
+	if err != nil || !n.IsUint64() {
+		return 0, false
+	}
+	return n.Uint64(), true
+}
+
+// polledHead returns the head st was polled at, or 0 if unknown.
+func polledHead(st endpoint.Status) uint64 {
+	if n, err := evm.ParseQuantity(st.BlockNumber); err == nil && n.IsUint64() {
+		return n.Uint64()
+	}
+	return 0
+}
@@ -0,0 +1,166 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/contact"
+	"github.com/primal-host/wallet/internal/evm"
+	"github.com/primal-host/wallet/internal/label"
+	"github.com/primal-host/wallet/internal/phishing"
+	"github.com/primal-host/wallet/internal/txbuild"
+)
+
+// contactRoutes registers the history of addresses sent to.
+func (s *Server) contactRoutes() {
+	s.echo.GET("/api/contacts", s.handleListContacts)
+	s.echo.DELETE("/api/contacts/:address", s.handleDeleteContact)
+	s.echo.POST("/api/contacts/:address/restore", s.handleRestoreContact)
+	s.echo.DELETE("/api/trash/contacts/:address", s.handlePurgeContact)
+}
+
+// contactEntry is a contact with the name the profile gave it and, for
+// the server's profile, whose sends the journal keeps, what was sent to
+// and received from it.
+type contactEntry struct {
+	contact.Contact
+	Name string `json:"name,omitempty"`
+	*contactActivity
+}
+
+// handleListContacts returns the addresses the profile has sent to, most
+// sent to first, with their totals from the journal's index of sends by
+// counterparty.
+func (s *Server) handleListContacts(c echo.Context) error {
+	p := s.profileFor(c.Request().Context())
+	var activity map[string]*contactActivity
+	if p.shared() {
+		activity = s.counterpartyActivity()
+	}
+	list := p.contacts.List()
+	addresses := make([]string, len(list))
+	for i, ct := range list {
+		addresses[i] = ct.Address
+	}
+	labels := p.labels.Lookup(addresses...)
+	out := make([]contactEntry, len(list))
+	for i, ct := range list {
+		out[i] = contactEntry{Contact: ct}
+		if j := slices.IndexFunc(labels, func(l label.Label) bool { return strings.EqualFold(l.Address, ct.Address) }); j >= 0 {
+			out[i].Name = labels[j].Name
+		}
+		if p.shared() {
+			act, ok := activity[strings.ToLower(ct.Address)]
+			if !ok {
+				act = &contactActivity{Sent: []assetTotal{}, Received: []assetTotal{}}
+			}
+			if act.LastInteraction == nil || ct.LastSent.After(*act.LastInteraction) {
+				t := ct.LastSent
+				act.LastInteraction = &t
+			}
+			out[i].contactActivity = act
+		}
+	}
+	return c.JSON(http.StatusOK, out)
+}
+
+// handleDeleteContact moves an address to the recycle bin, so a send to
+// it by mistake doesn't make it familiar.
+func (s *Server) handleDeleteContact(c echo.Context) error {
+	p := s.profileFor(c.Request().Context())
+	if err := p.contacts.Delete(c.Param("address")); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	slog.Info("contact deleted", "subsystem", "contacts", "address", c.Param("address"), "by", p.name())
+	return c.JSON(http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// handleRestoreContact brings a contact back from the recycle bin.
+func (s *Server) handleRestoreContact(c echo.Context) error {
+	ct, err := s.profileFor(c.Request().Context()).contacts.Restore(c.Param("address"))
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, ct)
+}
+
+// handlePurgeContact permanently removes a deleted contact.
+func (s *Server) handlePurgeContact(c echo.Context) error {
+	if err := s.profileFor(c.Request().Context()).contacts.Purge(c.Param("address")); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "purged"})
+}
+
+// recipients returns who env sends to: the transaction's target and, for
+// token transfers and approvals, the token recipient or spender.
+func recipients(env *txbuild.Envelope) []string {
+	var out []string
+	for _, a := range []string{env.Tx.To, env.Summary.Recipient} {
+		if a != "" && !slices.ContainsFunc(out, func(o string) bool { return strings.EqualFold(o, a) }) {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// addressWarnings checks env's recipients with checkAddresses.
+func (s *Server) addressWarnings(ctx context.Context, env *txbuild.Envelope) []txbuild.Warning {
+	return s.checkAddresses(ctx, recipients(env)...)
+}
+
+// checkAddresses checks addresses against the scam list and, when the
+// profile hasn't sent to them before, against its contacts and keys for a
+// lookalike.
+func (s *Server) checkAddresses(ctx context.Context, addresses ...string) []txbuild.Warning {
+	p := s.profileFor(ctx)
+	own := s.ownKeys(ctx)
+	var known []string
+	for _, c := range p.contacts.List() {
+		known = append(known, c.Address)
+	}
+	var warnings []txbuild.Warning
+	for _, r := range addresses {
+		a, err := evm.ParseAddress(r)
+		if err != nil {
+			continue
+		}
+		if label, ok := s.scams.Lookup(a.Hex()); ok {
+			msg := a.Hex() + " is on the scam address list"
+			if label != "" {
+				msg += " (" + label + ")"
+			}
+			warnings = append(warnings, txbuild.Warning{Kind: "scam_address", Severity: txbuild.SeverityCritical, Message: msg + "."})
+			continue
+		}
+		if _, ok := p.contacts.Get(a.Hex()); ok || slices.ContainsFunc(own, func(o string) bool { return strings.EqualFold(o, a.Hex()) }) {
+			continue
+		}
+		if k, ok := phishing.Lookalike(a.Hex(), own); ok {
+			warnings = append(warnings, txbuild.Warning{Kind: "address_poisoning", Severity: txbuild.SeverityWarning, Message: a.Hex() + " looks like your account " + k + " but is a different address. Check every character."})
+		} else if k, ok := phishing.Lookalike(a.Hex(), known); ok {
+			warnings = append(warnings, txbuild.Warning{Kind: "address_poisoning", Severity: txbuild.SeverityWarning, Message: a.Hex() + " looks like " + k + ", which you have sent to before, but is a different address you have never sent to. Check every character."})
+		}
+	}
+	return warnings
+}
+
+// recordContacts adds env's recipients to the profile's contacts after a
+// send. A failure is only logged; the transaction has gone out.
+func (s *Server) recordContacts(ctx context.Context, env *txbuild.Envelope) {
+	if err := s.profileFor(ctx).contacts.Record(recipients(env)...); err != nil {
+		slog.Warn("contact record failed", "subsystem", "contacts", "error", err)
+	}
+}
@@ -0,0 +1,55 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// contractRoutes registers the contract verification lookup.
+func (s *Server) contractRoutes() {
+	s.echo.GET("/api/endpoints/:id/contracts/:address", s.handleContract)
+}
+
+// handleContract reports whether the source of the contract at :address on
+// the endpoint's chain is verified, with its ABI and compiler metadata, from
+// the cache or Sourcify and the chain's explorer. ?sources=true adds the
+// source files; ?refresh=true asks the sources again.
+func (s *Server) handleContract(c echo.Context) error {
+	ctx := c.Request().Context()
+	ep, ok := s.storeFor(ctx).Get(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "endpoint not found"})
+	}
+	addr, err := evm.ParseAddress(c.Param("address"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	chainID, err := endpointChainID(c.Request().Context(), ep)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": "chain id: " + err.Error()})
+	}
+	code, err := rpcString(ctx, ep, "eth_getCode", addr.Hex(), "latest")
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	if code == "" || code == "0x" {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "no contract at " + addr.Hex() + " on " + ep.Name})
+	}
+	ct, err := s.contracts.Get(ctx, chainID, addr.Hex(), c.QueryParam("refresh") == "true")
+	if err != nil {
+		if errors.Is(err, ctx.Err()) {
+			return err
+		}
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	if c.QueryParam("sources") != "true" {
+		ct.Sources = nil
+	}
+	return c.JSON(http.StatusOK, ct)
+}
@@ -124,7 +124,8 @@ const dashboardHTML = `<!DOCTYPE html>
     align-items: center;
     justify-content: space-between;
   }
-  .ep-card-header h3 { font-size: 1rem; font-weight: 600; }
+  .ep-card-header h3 { font-size: 1rem; font-weight: 600; display: flex; align-items: center; gap: 0.4rem; }
+  .chain-icon { width: 1rem; height: 1rem; border-radius: 50%; }
   .ep-card-body {
     padding: 1rem 1.25rem;
     display: flex;
@@ -153,12 +154,14 @@ const dashboardHTML = `<!DOCTYPE html>
   .status-online .status-dot { background: #4ade80; }
   .status-offline .status-dot { background: #f87171; }
   .status-checking .status-dot { background: #facc15; animation: pulse 1.5s infinite; }
+  .status-warn .status-dot { background: #fb923c; }
   @keyframes pulse { 0%, 100% { opacity: 1; } 50% { opacity: 0.4; } }
 
   .status-text { font-size: 0.75rem; }
   .status-online .status-text { color: #4ade80; }
   .status-offline .status-text { color: #f87171; }
   .status-checking .status-text { color: #facc15; }
+  .status-warn .status-text { color: #fb923c; }
 
   /* URL display */
   .url-display {
@@ -258,7 +261,7 @@ const dashboardHTML = `<!DOCTYPE html>
     margin-top: 0.75rem;
   }
   .modal label:first-of-type { margin-top: 0; }
-  .modal input, .modal select {
+  .modal input, .modal select, .modal textarea {
     width: 100%;
     padding: 0.5rem 0.75rem;
     background: #0f1117;
@@ -268,7 +271,13 @@ const dashboardHTML = `<!DOCTYPE html>
     font-size: 0.875rem;
     font-family: inherit;
   }
-  .modal input:focus, .modal select:focus {
+  .modal textarea {
+    resize: vertical;
+    font-family: "SF Mono", "Fira Code", monospace;
+    font-size: 0.75rem;
+    word-break: break-all;
+  }
+  .modal input:focus, .modal select:focus, .modal textarea:focus {
     outline: none;
     border-color: #1d4ed8;
   }
@@ -285,8 +294,246 @@ const dashboardHTML = `<!DOCTYPE html>
     display: none;
   }
 
+  .modal-success {
+    color: #4ade80;
+    font-size: 0.8125rem;
+    margin-top: 0.5rem;
+    word-break: break-all;
+    display: none;
+  }
+
+  /* Broadcast-only builds have no key or endpoint management. */
+  .broadcast-only .manage-only { display: none !important; }
+
+  /* In multi-user mode, controls the user's role doesn't permit are hidden. */
+  .no-admin .admin-only,
+  .no-manage .needs-manage,
+  .no-operate .needs-operate,
+  .own-profile .server-only { display: none !important; }
+  .token-scopes, .channel-kinds { display: flex; flex-wrap: wrap; gap: 0.75rem; font-size: 0.8125rem; }
+  .token-scopes label, .channel-kinds label { display: flex; align-items: center; gap: 0.25rem; margin: 0; }
+  .header-right .user-badge { color: #a1a1aa; font-size: 0.8125rem; }
+
+  .modal-warning {
+    color: #facc15;
+    font-size: 0.8125rem;
+    margin-top: 0.75rem;
+    padding: 0.625rem 0.75rem;
+    background: #1f1c0d;
+    border: 1px solid #3f3a17;
+    border-radius: 0.25rem;
+    display: none;
+  }
+  .modal-warning .modal-footer { margin-top: 0.625rem; }
+
+  /* Undo toast */
+  .toast {
+    position: fixed;
+    bottom: 1.5rem;
+    left: 50%;
+    transform: translateX(-50%);
+    display: none;
+    align-items: center;
+    gap: 1rem;
+    padding: 0.75rem 1rem;
+    background: #27272a;
+    border: 1px solid #3f3f46;
+    border-radius: 0.5rem;
+    font-size: 0.8125rem;
+    z-index: 200;
+  }
+  .toast.active { display: flex; }
+
+  /* Recycle bin */
+  .trash-row {
+    display: flex;
+    align-items: center;
+    gap: 0.5rem;
+    padding: 0.5rem 0;
+    border-bottom: 1px solid #1e1e22;
+    font-size: 0.8125rem;
+  }
+  .trash-row .trash-name { flex: 1; min-width: 0; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+  .trash-row .trash-kind { color: #71717a; font-size: 0.6875rem; }
+  .trash-empty { color: #71717a; font-size: 0.8125rem; font-style: italic; }
+
+  /* NFTs */
+  .nft-grid {
+    display: grid;
+    grid-template-columns: repeat(auto-fill, minmax(10rem, 1fr));
+    gap: 0.75rem;
+    max-height: 28rem;
+    overflow-y: auto;
+  }
+  .nft-card { border: 1px solid #27272a; border-radius: 0.5rem; overflow: hidden; background: #18181b; }
+  .nft-card .nft-image {
+    aspect-ratio: 1;
+    display: flex;
+    align-items: center;
+    justify-content: center;
+    background: #0f0f11;
+    color: #52525b;
+    font-size: 0.75rem;
+  }
+  .nft-card .nft-image img { width: 100%; height: 100%; object-fit: contain; }
+  .nft-card .nft-info { padding: 0.5rem 0.625rem; font-size: 0.75rem; }
+  .nft-card .nft-name { font-weight: 600; color: #e4e4e7; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+  .nft-card .nft-collection { color: #71717a; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+  .nft-card .nft-error { color: #a1a1aa; font-style: italic; }
+
+  /* Logs */
+  .modal.modal-wide { width: 56rem; }
+  .logs-controls { display: flex; gap: 0.5rem; align-items: center; margin-bottom: 0.75rem; }
+  .modal .logs-controls select { width: auto; }
+  .logs-controls .logs-state { margin-left: auto; font-size: 0.75rem; color: #71717a; }
+  .logs-list {
+    height: 24rem;
+    overflow-y: auto;
+    background: #0f1014;
+    border: 1px solid #27272a;
+    border-radius: 0.375rem;
+    padding: 0.5rem;
+    font-family: ui-monospace, SFMono-Regular, Menlo, monospace;
+    font-size: 0.75rem;
+    line-height: 1.5;
+  }
+  .log-line { white-space: pre-wrap; word-break: break-all; color: #d4d4d8; }
+  .log-line .log-time { color: #52525b; }
+  .log-line .log-level { display: inline-block; width: 3.25rem; font-weight: 600; }
+  .log-line .log-sub { color: #818cf8; }
+  .log-line .log-attrs { color: #71717a; }
+  .log-debug .log-level { color: #71717a; }
+  .log-info .log-level { color: #4ade80; }
+  .log-warn .log-level { color: #facc15; }
+  .log-error .log-level { color: #f87171; }
+
+  /* Send */
+  .send-review {
+    margin-top: 0.75rem;
+    padding: 0.5rem 0.75rem;
+    background: #0f1014;
+    border: 1px solid #27272a;
+    border-radius: 0.375rem;
+    font-size: 0.8125rem;
+    display: none;
+  }
+  .send-review .review-row { display: flex; justify-content: space-between; gap: 1rem; padding: 0.25rem 0; }
+  .send-review .review-row .label { color: #71717a; }
+  .send-review .review-row .value { font-family: ui-monospace, SFMono-Regular, Menlo, monospace; word-break: break-all; text-align: right; }
+  .send-confirm { display: none; }
+  .send-confirm .modal-warning { display: block; }
+
+  /* Bookmarks */
+  .asof { display: flex; align-items: center; gap: 0.5rem; font-size: 0.8125rem; color: #71717a; }
+  .asof .key-selector { max-width: 14rem; font-family: inherit; }
+  .bm-row {
+    display: flex;
+    align-items: center;
+    gap: 0.5rem;
+    padding: 0.5rem 0;
+    border-bottom: 1px solid #1e1e22;
+    font-size: 0.8125rem;
+  }
+  .bm-row .bm-note { flex: 1; min-width: 0; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+  .bm-row .bm-meta { color: #71717a; font-size: 0.6875rem; white-space: nowrap; }
+
+  /* ERC-20 tokens */
+  .erc20-section { margin-top: 1rem; font-size: 0.8125rem; font-weight: 600; color: #a1a1aa; }
+  .erc20-list { max-height: 16rem; overflow-y: auto; }
+  .erc20-row-inputs { display: flex; gap: 0.5rem; }
+  .erc20-row-inputs input, .erc20-row-inputs select { flex: 1; min-width: 0; }
+  .erc20-warning { color: #facc15; cursor: help; }
+  .acct-key-tokens { font-family: monospace; font-size: 0.8125rem; color: #a1a1aa; }
+
+  /* Assets */
+  .asset-picker { display: flex; gap: 0.5rem; align-items: center; }
+  .asset-picker select, .asset-picker input { flex: 1; }
+  .asset-row {
+    display: flex;
+    align-items: center;
+    gap: 0.5rem;
+    padding: 0.5rem 0;
+    border-bottom: 1px solid #1e1e22;
+    font-size: 0.8125rem;
+  }
+  .asset-row .asset-icon { width: 1rem; height: 1rem; border-radius: 50%; }
+  .asset-row .asset-symbol { flex: 1; font-weight: 600; }
+  .asset-row .asset-meta { color: #71717a; font-size: 0.6875rem; white-space: nowrap; }
+
+  /* Schedules */
+  .count-badge {
+    font-size: 0.6875rem;
+    color: #18181b;
+    background: #facc15;
+    padding: 0 0.4rem;
+    border-radius: 0.75rem;
+    margin-left: 0.375rem;
+  }
+  .count-badge:empty { display: none; }
+  .sched-heading { font-size: 0.8125rem; font-weight: 600; color: #a1a1aa; margin: 1rem 0 0.25rem; }
+  .sched-row {
+    display: flex;
+    align-items: center;
+    gap: 0.5rem;
+    padding: 0.5rem 0;
+    border-bottom: 1px solid #1e1e22;
+    font-size: 0.8125rem;
+  }
+  .sched-row .sched-name { flex: 1; min-width: 0; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+  .sched-row .sched-meta { color: #71717a; font-size: 0.6875rem; white-space: nowrap; }
+  .sched-row .sched-status.sent,
+  .sched-row .sched-status.arrived { color: #4ade80; }
+  .sched-row .sched-status.failed,
+  .sched-row .sched-status.stalled,
+  .sched-row .sched-status.firing { color: #f87171; }
+  .sched-row .sched-status.rejected,
+  .sched-row .sched-status.expired,
+  .sched-row .sched-status.muted { color: #71717a; }
+  .sched-form { display: grid; grid-template-columns: 1fr 1fr; gap: 0 1rem; }
+
+  /* Batch sends */
+  .batch-table { max-height: 16rem; overflow-y: auto; margin-top: 0.5rem; }
+  .batch-table table { width: 100%; border-collapse: collapse; font-size: 0.75rem; }
+  .batch-table th { text-align: left; color: #71717a; font-weight: 500; padding: 0.25rem 0.375rem; }
+  .batch-table td { padding: 0.25rem 0.375rem; border-top: 1px solid #1e1e22; font-family: monospace; word-break: break-all; }
+  .batch-table td.error { color: #f87171; font-family: inherit; }
+  .batch-table td.warning { color: #fbbf24; font-family: inherit; }
+  .batch-cost.short .value { color: #f87171; }
+
+  /* Approvals */
+  .approval-card {
+    border: 1px solid #27272a;
+    border-radius: 0.5rem;
+    padding: 0.75rem;
+    margin: 0.5rem 0;
+  }
+  .approval-card .approval-head { display: flex; align-items: center; gap: 0.5rem; margin-bottom: 0.5rem; font-size: 0.8125rem; }
+  .approval-card .approval-origin { flex: 1; font-weight: 600; }
+  .approval-card .approval-note { color: #a1a1aa; font-size: 0.8125rem; margin-bottom: 0.5rem; }
+  .approval-card .approval-actions { display: flex; justify-content: flex-end; gap: 0.5rem; margin-top: 0.5rem; }
+  .approval-card .send-review { display: block; margin-top: 0; }
+  .approval-card .modal-warning { display: block; margin: 0 0 0.5rem; }
+
+  /* Compare */
+  .compare-pick { display: grid; grid-template-columns: 1fr 1fr; gap: 1rem; margin-bottom: 0.75rem; }
+  .compare-table { width: 100%; border-collapse: collapse; font-size: 0.8125rem; }
+  .compare-table th, .compare-table td { padding: 0.5rem; border-bottom: 1px solid #1e1e22; text-align: left; }
+  .compare-table th { color: #71717a; font-weight: 500; width: 25%; }
+  .compare-table td { font-family: ui-monospace, SFMono-Regular, Menlo, monospace; }
+  .compare-table td.best { color: #4ade80; }
+  .compare-table .compare-note { color: #52525b; font-size: 0.6875rem; font-family: inherit; }
+
   /* Hex block number formatting */
   .mono { font-family: monospace; font-size: 0.8rem; }
+  .share-card { border: 1px solid #27272a; border-radius: 6px; padding: 0.5rem 0.75rem; margin-top: 0.5rem; }
+  .share-card .mono { word-spacing: 0.3rem; line-height: 1.5; }
+  .pair-qr { display: none; text-align: center; margin: 1rem 0; }
+  .pair-qr svg { width: 240px; height: 240px; }
+  .pair-qr p { word-break: break-all; margin: 0.5rem 0 0; }
+  .airgap-qr { text-align: center; margin: 1rem 0 0.25rem; }
+  .airgap-qr svg { width: 280px; height: 280px; }
+  .airgap-part { text-align: center; font-size: 0.75rem; color: #71717a; min-height: 1rem; }
+  .airgap-video { display: none; width: 100%; max-height: 16rem; margin-top: 0.75rem; border-radius: 0.25rem; background: #000; }
 
   /* Latency */
   .latency { font-size: 0.75rem; color: #52525b; }
@@ -323,6 +570,7 @@ const dashboardHTML = `<!DOCTYPE html>
   }
   .btn-icon:hover { color: #e4e4e7; background: #27272a; }
   .btn-icon.danger:hover { color: #f87171; background: #2a1515; }
+  a.btn-icon { text-decoration: none; }
 
   /* Delete confirm */
   .btn-danger {
@@ -390,6 +638,11 @@ const dashboardHTML = `<!DOCTYPE html>
     margin-top: 0.25rem;
   }
   .acct-detail-row .detail-stats span { color: #a1a1aa; }
+  .faucet-low { color: #facc15; }
+  .devnet-actions { display: flex; align-items: center; gap: 1rem; margin-top: 0.5rem; }
+  .devnet-actions label { display: flex; align-items: center; gap: 0.375rem; margin: 0; }
+  .devnet-control { display: flex; gap: 0.5rem; align-items: flex-end; }
+  .devnet-control > div { flex: 1; min-width: 0; }
   .acct-key-section {
     padding: 0.75rem 1.25rem;
     border-bottom: 1px solid #1e1e22;
@@ -426,11 +679,62 @@ const dashboardHTML = `<!DOCTYPE html>
     color: #e4e4e7;
   }
   .acct-key-balance.loading { color: #52525b; }
+  .acct-key-header .hw-badge {
+    font-size: 0.6875rem;
+    color: #a1a1aa;
+    background: #27272a;
+    padding: 0.0625rem 0.4375rem;
+    border-radius: 0.75rem;
+    margin-left: 0.375rem;
+    font-weight: 400;
+  }
+  .acct-key-path { font-family: monospace; font-size: 0.6875rem; color: #52525b; }
+
+  /* Hardware address picker */
+  .hw-address-list {
+    max-height: 14rem;
+    overflow-y: auto;
+    margin-top: 0.75rem;
+    border: 1px solid #27272a;
+    border-radius: 0.25rem;
+  }
+  .hw-address-list:empty { display: none; }
+  .hw-address-row {
+    display: flex;
+    align-items: center;
+    gap: 0.5rem;
+    padding: 0.375rem 0.625rem;
+    font-size: 0.75rem;
+    border-bottom: 1px solid #1e1e22;
+  }
+  .hw-address-row:last-child { border-bottom: none; }
+  .hw-address-row input { width: auto; }
+  .hw-address-row .mono { color: #a1a1aa; }
+  .hw-address-row .acct-key-path { margin-left: auto; }
+
   .acct-add-key {
     padding: 0.625rem 1.25rem;
     text-align: right;
     border-top: 1px solid #1e1e22;
   }
+
+  /* Search */
+  .search-results { list-style: none; max-height: 22rem; overflow-y: auto; margin-top: 0.5rem; }
+  .search-results:empty { display: none; }
+  .search-results li {
+    display: flex;
+    align-items: baseline;
+    gap: 0.5rem;
+    padding: 0.375rem 0.5rem;
+    border-radius: 0.25rem;
+    font-size: 0.8125rem;
+    cursor: pointer;
+  }
+  .search-results li.selected { background: #1e1e22; }
+  .search-results .search-kind { flex: none; width: 4.5rem; font-size: 0.6875rem; color: #71717a; text-transform: uppercase; }
+  .search-results .search-title { color: #e4e4e7; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+  .search-results .search-detail { margin-left: auto; color: #71717a; font-size: 0.75rem; white-space: nowrap; overflow: hidden; text-overflow: ellipsis; }
+  .ep-card.found { border-color: #1d4ed8; }
 </style>
 </head>
 <body>
@@ -438,12 +742,38 @@ const dashboardHTML = `<!DOCTYPE html>
 <header>
   <h1>Wallet</h1>
   <div class="header-right">
+    <button class="btn manage-only" onclick="showSearchModal()" title="Search (Ctrl+K)">Search</button>
+    <button class="btn manage-only needs-operate" onclick="showSendModal()">Send</button>
+    <button class="btn manage-only server-only" onclick="showApprovalsModal()">Approvals<span class="count-badge" id="approvals-badge" title="Transactions awaiting approval"></span></button>
+    <button class="btn manage-only server-only" onclick="showSchedulesModal()">Schedules<span class="count-badge" id="schedules-badge" title="Runs awaiting approval"></span></button>
+    <button class="btn manage-only server-only" onclick="showBridgesModal()">Bridges<span class="count-badge" id="bridges-badge" title="Transfers in flight"></span></button>
+    <button class="btn manage-only server-only" onclick="showBatchesModal()">Batches<span class="count-badge" id="batches-badge" title="Batches still confirming"></span></button>
+    <button class="btn manage-only server-only" onclick="showAlertsModal()">Alerts<span class="count-badge" id="alerts-badge" title="Alerts firing"></span></button>
+    <button class="btn manage-only" onclick="showSafesModal()">Safes</button>
+    <button class="btn manage-only" onclick="showContactsModal()">Contacts</button>
+    <button class="btn" onclick="showCompareModal()">Compare</button>
+    <button class="btn manage-only" onclick="showERC20Modal()">ERC-20</button>
+    <button class="btn needs-operate" onclick="showBroadcastModal()">Broadcast</button>
+    <button class="btn admin-only" onclick="showLogsModal()">Logs</button>
+    <button class="btn manage-only admin-only" onclick="panicLock(true)" title="Lock every session now (Ctrl+Shift+L)">Lock All</button>
+    <button class="btn manage-only needs-manage" onclick="showTrashModal()">Recycle Bin</button>
+    <button class="btn manage-only needs-manage" onclick="showBackupModal()">Backup</button>
+    <button class="btn admin-only" id="btn-users" style="display:none" onclick="showUsersModal()">Users</button>
+    <button class="btn" id="btn-tokens" style="display:none" onclick="showTokensModal()">Tokens</button>
+    <button class="btn" id="btn-devices" style="display:none" onclick="showDevicesModal()">Devices</button>
+    <span class="user-badge" id="user-badge"></span>
+    <button class="btn" id="btn-logout" style="display:none" onclick="logout()">Log Out</button>
     <span class="version">v{{VERSION}}</span>
   </div>
 </header>
 
+<div class="toast" id="toast">
+  <span id="toast-text"></span>
+  <button class="btn" id="toast-undo" onclick="undoToast()">Undo</button>
+</div>
+
 <main>
-  <div class="wallet-bar" id="wallet-bar">
+  <div class="wallet-bar manage-only needs-operate" id="wallet-bar">
     <div class="bar-left">
       <span id="wallet-status" class="no-wallet">Checking wallet...</span>
     </div>
@@ -452,8 +782,9 @@ const dashboardHTML = `<!DOCTYPE html>
 
   <div class="section-header">
     <h2>Endpoints</h2>
-    <button class="btn btn-primary" onclick="showEndpointModal()">+ Add Endpoint</button>
+    <button class="btn btn-primary manage-only needs-manage" onclick="showEndpointModal()">+ Add Endpoint</button>
   </div>
+  <div id="devnets-container" class="manage-only needs-manage"></div>
   <div id="endpoints-container">
     <div class="empty-state status-checking">
       <span class="status-dot"></span>
@@ -461,7 +792,8 @@ const dashboardHTML = `<!DOCTYPE html>
     </div>
   </div>
 
-  <div id="accounts-container"></div>
+  <div id="accounts-container" class="manage-only"></div>
+  <div id="faucet-container" class="manage-only"></div>
 </main>
 
 <!-- Setup Wallet Modal -->
@@ -484,6 +816,13 @@ const dashboardHTML = `<!DOCTYPE html>
           <p>Enter a password to encrypt your keys</p>
         </div>
       </div>
+      <div class="setup-choice" id="setup-synced" style="display:none" onclick="adoptSyncedVault()">
+        <span class="choice-icon">&#128260;</span>
+        <div class="choice-text">
+          <h4>Synced Wallet</h4>
+          <p>Unlock the keys another browser synced to the server</p>
+        </div>
+      </div>
     </div>
     <div class="modal-error" id="setup-error"></div>
     <div class="modal-footer">
@@ -532,9 +871,36 @@ const dashboardHTML = `<!DOCTYPE html>
     <input type="text" id="endpoint-name" placeholder="e.g. My Local Node" autocomplete="off" spellcheck="false">
     <label for="endpoint-url">RPC URL</label>
     <input type="text" id="endpoint-url" placeholder="e.g. http://192.168.1.100:9650/ext/bc/C/rpc" autocomplete="off" spellcheck="false">
-    <label for="endpoint-symbol">Symbol</label>
-    <input type="text" id="endpoint-symbol" placeholder="e.g. AVAX, ETH" autocomplete="off" spellcheck="false">
+    <label for="endpoint-asset">Native currency</label>
+    <div class="asset-picker">
+      <select id="endpoint-asset"></select>
+      <button class="btn" type="button" onclick="showAssetsModal()">Assets</button>
+    </div>
+    <label for="endpoint-jwt">JWT secret (optional)</label>
+    <input type="password" id="endpoint-jwt" placeholder="hex, e.g. contents of jwt.hex" autocomplete="off" spellcheck="false">
+    <label for="endpoint-timeout">Request timeout (optional)</label>
+    <input type="text" id="endpoint-timeout" placeholder="e.g. 30s; the server default when empty" autocomplete="off" spellcheck="false">
+    <label for="endpoint-proxy">Proxy (optional)</label>
+    <input type="text" id="endpoint-proxy" placeholder="socks5h://host:port, tor, or direct; the server default when empty" autocomplete="off" spellcheck="false">
+    <label for="endpoint-poll-interval">Poll interval (optional)</label>
+    <input type="text" id="endpoint-poll-interval" placeholder="e.g. 1m; the server default when empty" autocomplete="off" spellcheck="false">
+    <label for="endpoint-consensus">Light client beacon API (optional)</label>
+    <input type="text" id="endpoint-consensus" placeholder="e.g. https://beacon.example; verifies reads against sync committee headers" autocomplete="off" spellcheck="false">
+    <label for="endpoint-checkpoint">Light client checkpoint (optional)</label>
+    <input type="text" id="endpoint-checkpoint" placeholder="0x block root; the beacon node's finalized block when empty" autocomplete="off" spellcheck="false">
+    <label><input type="checkbox" id="endpoint-private"> Private submission endpoint, such as Flashbots Protect, for sends kept out of the public mempool</label>
+    <label for="endpoint-status-url">Private transaction status API (optional)</label>
+    <input type="text" id="endpoint-status-url" placeholder="e.g. https://relay.example/tx/; Flashbots Protect's for its RPC when empty" autocomplete="off" spellcheck="false">
+    <label for="endpoint-confirmations">Confirmations (optional)</label>
+    <input type="number" id="endpoint-confirmations" min="0" step="1" placeholder="blocks deep a sent transaction must be to count as confirmed; once mined when empty">
     <div class="modal-error" id="endpoint-error"></div>
+    <div class="modal-warning" id="endpoint-duplicate">
+      <span id="endpoint-duplicate-text"></span>
+      <div class="modal-footer">
+        <button class="btn" onclick="mergeIntoDuplicate()">Update Existing</button>
+        <button class="btn btn-danger" onclick="saveEndpoint(true)">Save Anyway</button>
+      </div>
+    </div>
     <div class="modal-footer">
       <button class="btn" onclick="hideModal('endpoint-modal')">Cancel</button>
       <button class="btn btn-primary" id="btn-endpoint-save" onclick="saveEndpoint()">Add</button>
@@ -542,16 +908,116 @@ const dashboardHTML = `<!DOCTYPE html>
   </div>
 </div>
 
-<!-- Delete Endpoint Confirm Modal -->
-<div class="modal-overlay" id="delete-endpoint-modal">
+<!-- Assets Modal -->
+<div class="modal-overlay" id="assets-modal">
+  <div class="modal">
+    <h3>Assets</h3>
+    <p>Endpoints name their native currency from this list. Symbols that differ only in case are the same asset.</p>
+    <div id="assets-list"></div>
+    <input type="hidden" id="asset-edit-id" value="">
+    <label for="asset-symbol">Symbol</label>
+    <input type="text" id="asset-symbol" placeholder="e.g. AVAX" autocomplete="off" spellcheck="false">
+    <label for="asset-decimals">Decimals</label>
+    <input type="number" id="asset-decimals" min="0" max="36" value="18">
+    <label for="asset-coingecko">CoinGecko ID (optional)</label>
+    <input type="text" id="asset-coingecko" placeholder="e.g. avalanche-2" autocomplete="off" spellcheck="false">
+    <label for="asset-icon">Icon URL (optional)</label>
+    <input type="text" id="asset-icon" placeholder="https://..." autocomplete="off" spellcheck="false">
+    <div class="modal-error" id="assets-error"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('assets-modal')">Close</button>
+      <button class="btn btn-primary" id="btn-asset-save" onclick="saveAsset()">Add Asset</button>
+    </div>
+  </div>
+</div>
+
+<!-- Recycle Bin Modal -->
+<div class="modal-overlay" id="trash-modal">
+  <div class="modal">
+    <h3>Recycle Bin</h3>
+    <div id="trash-list"></div>
+    <div class="modal-error" id="trash-error"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('trash-modal')">Close</button>
+    </div>
+  </div>
+</div>
+
+<!-- Logs Modal -->
+<div class="modal-overlay" id="logs-modal">
+  <div class="modal modal-wide">
+    <h3>Server Logs</h3>
+    <div class="logs-controls">
+      <select id="logs-level" onchange="openLogStream()">
+        <option value="debug">Debug</option>
+        <option value="info" selected>Info</option>
+        <option value="warn">Warn</option>
+        <option value="error">Error</option>
+      </select>
+      <select id="logs-subsystem" onchange="openLogStream()">
+        <option value="">All subsystems</option>
+      </select>
+      <button class="btn" id="btn-logs-pause" onclick="toggleLogsPaused()">Pause</button>
+      <button class="btn" onclick="document.getElementById('logs-list').innerHTML = ''">Clear</button>
+      <span class="logs-state" id="logs-state"></span>
+    </div>
+    <div class="logs-list" id="logs-list"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('logs-modal')">Close</button>
+    </div>
+  </div>
+</div>
+
+<!-- Bookmarks Modal -->
+<div class="modal-overlay" id="bookmarks-modal">
   <div class="modal">
-    <h3>Delete Endpoint</h3>
-    <input type="hidden" id="delete-endpoint-id" value="">
-    <p>Are you sure you want to delete <strong id="delete-endpoint-name"></strong>? This cannot be undone.</p>
-    <div class="modal-error" id="delete-endpoint-error"></div>
+    <h3>Chain Bookmarks</h3>
+    <p>Bookmark a block to view balances as of that point. Past balances need an archive node.</p>
+    <div id="bookmarks-list"></div>
+    <label for="bm-endpoint">Endpoint</label>
+    <select id="bm-endpoint"></select>
+    <label for="bm-mode">Point in time</label>
+    <select id="bm-mode" onchange="bookmarkModeChanged()">
+      <option value="time">Date and time (last block at or before)</option>
+      <option value="block">Block number</option>
+    </select>
+    <input type="datetime-local" id="bm-time" step="1">
+    <input type="number" id="bm-block" min="0" placeholder="e.g. 19000000" style="display:none">
+    <label for="bm-note">Note</label>
+    <input type="text" id="bm-note" placeholder="e.g. FY2025 year end" autocomplete="off">
+    <div class="modal-error" id="bookmarks-error"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('bookmarks-modal')">Close</button>
+      <button class="btn btn-primary needs-manage" id="btn-bm-add" onclick="addBookmark()">Add Bookmark</button>
+    </div>
+  </div>
+</div>
+
+<div class="modal-overlay" id="erc20-modal">
+  <div class="modal modal-wide">
+    <h3>ERC-20 Tokens</h3>
+    <p>Balances of these tokens show under each account. Token lists in the Uniswap tokenlists format add the tokens of every chain you have an endpoint for; lists from a URL are refreshed daily. Tokens you add by hand are never replaced by a list.</p>
+    <div class="erc20-section">Token Lists</div>
+    <div id="erc20-lists"></div>
+    <div class="erc20-row-inputs needs-manage">
+      <input type="text" id="erc20-list-url" placeholder="https://tokens.uniswap.org" autocomplete="off" spellcheck="false">
+      <button class="btn" id="btn-erc20-import" onclick="importTokenList()">Import URL</button>
+    </div>
+    <div class="erc20-row-inputs needs-manage">
+      <input type="file" id="erc20-list-file" accept=".json,application/json">
+      <button class="btn" id="btn-erc20-upload" onclick="uploadTokenList()">Import File</button>
+    </div>
+    <div class="erc20-section">Tokens</div>
+    <select id="erc20-chain" onchange="renderERC20Tokens()"></select>
+    <div class="erc20-list" id="erc20-tokens"></div>
+    <div class="erc20-section needs-manage">Add a Token</div>
+    <div class="erc20-row-inputs needs-manage">
+      <input type="text" id="erc20-address" placeholder="Contract address on the chain above" autocomplete="off" spellcheck="false">
+      <button class="btn" id="btn-erc20-add" onclick="addERC20Token()">Add</button>
+    </div>
+    <div class="modal-error" id="erc20-error"></div>
     <div class="modal-footer">
-      <button class="btn" onclick="hideModal('delete-endpoint-modal')">Cancel</button>
-      <button class="btn btn-danger" id="btn-endpoint-delete" onclick="confirmDeleteEndpoint()">Delete</button>
+      <button class="btn" onclick="hideModal('erc20-modal')">Close</button>
     </div>
   </div>
 </div>
@@ -576,6 +1042,20 @@ const dashboardHTML = `<!DOCTYPE html>
           <p>Paste a private key you already have</p>
         </div>
       </div>
+      <div class="setup-choice" onclick="hideModal('addkey-modal'); showVanityModal()">
+        <span class="choice-icon">&#127919;</span>
+        <div class="choice-text">
+          <h4>Vanity Address</h4>
+          <p>Search for a key whose address starts or ends as you choose</p>
+        </div>
+      </div>
+      <div class="setup-choice" onclick="showRecoverModal()">
+        <span class="choice-icon">&#129513;</span>
+        <div class="choice-text">
+          <h4>Recover from Shares</h4>
+          <p>Rebuild a key from its recovery shares</p>
+        </div>
+      </div>
     </div>
     <div class="modal-error" id="addkey-error"></div>
     <div class="modal-footer">
@@ -584,6 +1064,107 @@ const dashboardHTML = `<!DOCTYPE html>
   </div>
 </div>
 
+<!-- Hardware Wallet Modal -->
+<div class="modal-overlay" id="hw-modal">
+  <div class="modal">
+    <h3>Hardware Wallet</h3>
+    <p>Keys stay on the device. Addresses are added as accounts and transactions are confirmed on the device.</p>
+    <div class="setup-choices">
+      <div class="setup-choice" onclick="hideModal('hw-modal'); showHardwareAccountsModal('ledger')">
+        <span class="choice-icon">&#128272;</span>
+        <div class="choice-text">
+          <h4>Ledger</h4>
+          <p>Connect over USB (WebHID) with the Ethereum app open</p>
+        </div>
+      </div>
+      <div class="setup-choice" onclick="hideModal('hw-modal'); showHardwareAccountsModal('trezor')">
+        <span class="choice-icon">&#128737;</span>
+        <div class="choice-text">
+          <h4>Trezor</h4>
+          <p>Connect through Trezor Connect (opens a Trezor popup)</p>
+        </div>
+      </div>
+      <div class="setup-choice" onclick="hideModal('hw-modal'); showAirgapAccountModal()">
+        <span class="choice-icon">&#128247;</span>
+        <div class="choice-text">
+          <h4>Air-Gapped (Keystone)</h4>
+          <p>Never connects: transactions and signatures go across as QR codes</p>
+        </div>
+      </div>
+    </div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('hw-modal')">Cancel</button>
+    </div>
+  </div>
+</div>
+
+<!-- Hardware Accounts Modal -->
+<div class="modal-overlay" id="hwacct-modal">
+  <div class="modal">
+    <h3 id="hwacct-title">Hardware Accounts</h3>
+    <input type="hidden" id="hwacct-kind" value="">
+    <label for="hwacct-path">Derivation path</label>
+    <select id="hwacct-path">
+      <option value="m/44'/60'/{index}'/0/0">Ledger Live — m/44'/60'/x'/0/0</option>
+      <option value="m/44'/60'/0'/0/{index}">BIP-44 — m/44'/60'/0'/0/x</option>
+      <option value="m/44'/60'/0'/{index}">Legacy (MEW) — m/44'/60'/0'/x</option>
+    </select>
+    <label for="hwacct-start">First index</label>
+    <input type="number" id="hwacct-start" min="0" value="0">
+    <label for="hwacct-count">Number of accounts</label>
+    <input type="number" id="hwacct-count" min="1" max="50" value="5">
+    <label for="hwacct-label">Label template</label>
+    <input type="text" id="hwacct-label" value="" autocomplete="off" spellcheck="false">
+    <div class="hw-address-list" id="hwacct-addresses"></div>
+    <div class="modal-error" id="hwacct-error"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('hwacct-modal')">Cancel</button>
+      <button class="btn" id="btn-hwacct-load" onclick="loadHardwareAddresses()">Load Addresses</button>
+      <button class="btn btn-primary needs-manage" id="btn-hwacct-add" onclick="addHardwareAccounts()" disabled>Add Selected</button>
+    </div>
+  </div>
+</div>
+
+<!-- Air-Gapped Account Modal -->
+<div class="modal-overlay" id="airgap-acct-modal">
+  <div class="modal">
+    <h3>Air-Gapped Account</h3>
+    <p>Copy the address, derivation path, and master key fingerprint from the device. It signs only requests that carry its fingerprint.</p>
+    <label for="airgap-acct-label">Label</label>
+    <input type="text" id="airgap-acct-label" value="Keystone" autocomplete="off" spellcheck="false">
+    <label for="airgap-acct-address">Address</label>
+    <input type="text" id="airgap-acct-address" placeholder="0x..." autocomplete="off" spellcheck="false">
+    <label for="airgap-acct-path">Derivation path</label>
+    <input type="text" id="airgap-acct-path" value="m/44'/60'/0'/0/0" autocomplete="off" spellcheck="false">
+    <label for="airgap-acct-fingerprint">Master key fingerprint</label>
+    <input type="text" id="airgap-acct-fingerprint" placeholder="e.g. 1a2b3c4d" maxlength="8" autocomplete="off" spellcheck="false">
+    <div class="modal-error" id="airgap-acct-error"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('airgap-acct-modal')">Cancel</button>
+      <button class="btn btn-primary needs-manage" id="btn-airgap-acct-add" onclick="addAirgapAccount()">Add</button>
+    </div>
+  </div>
+</div>
+
+<!-- Air-Gapped Signing Modal -->
+<div class="modal-overlay" id="airgap-modal" data-persistent="true">
+  <div class="modal">
+    <h3>Sign on the Device</h3>
+    <p>Scan this code with the air-gapped wallet, check the transaction on its screen, and sign. Then scan the signature code it shows, or paste its <span class="mono">ur:eth-signature/</span> text.</p>
+    <div class="airgap-qr" id="airgap-qr"></div>
+    <div class="airgap-part" id="airgap-part"></div>
+    <video class="airgap-video" id="airgap-video" playsinline muted></video>
+    <label for="airgap-response">Signature</label>
+    <textarea id="airgap-response" rows="3" spellcheck="false" autocomplete="off" placeholder="ur:eth-signature/..."></textarea>
+    <div class="modal-error" id="airgap-error"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="cancelAirgap()">Cancel</button>
+      <button class="btn" id="btn-airgap-scan" onclick="scanAirgap()">Scan with Camera</button>
+      <button class="btn btn-primary" id="btn-airgap-use" onclick="useAirgapSignature(document.getElementById('airgap-response').value.split(/\s+/).filter(Boolean))">Use Signature</button>
+    </div>
+  </div>
+</div>
+
 <!-- Rename Key Modal -->
 <div class="modal-overlay" id="rename-key-modal">
   <div class="modal">
@@ -599,1019 +1180,8363 @@ const dashboardHTML = `<!DOCTYPE html>
   </div>
 </div>
 
-<!-- Import Key Modal -->
-<div class="modal-overlay" id="import-modal">
+<!-- Search Modal -->
+<div class="modal-overlay" id="search-modal">
   <div class="modal">
-    <h3>Import Private Key</h3>
-    <label for="import-label">Label</label>
-    <input type="text" id="import-label" placeholder="e.g. Main, Test, Hot" autocomplete="off" spellcheck="false">
-    <label for="import-key">Private Key (hex)</label>
-    <input type="password" id="import-key" placeholder="0x..." autocomplete="off" spellcheck="false">
-    <div class="modal-error" id="import-error"></div>
+    <h3>Search</h3>
+    <input type="text" id="search-input" placeholder="Endpoint, account, label, #tag, token, address, or tx hash" autocomplete="off" spellcheck="false" oninput="searchSoon()" onkeydown="searchKey(event)">
+    <ul class="search-results" id="search-results"></ul>
+    <div class="modal-error" id="search-error"></div>
+  </div>
+</div>
+
+<!-- Key Labels Modal -->
+<div class="modal-overlay" id="labels-modal">
+  <div class="modal">
+    <h3>Key Labels</h3>
+    <p>New keys are named from this template. <code>{index}</code> is replaced with the key's number.</p>
+    <label for="labels-template">Template</label>
+    <input type="text" id="labels-template" placeholder="e.g. Key {index}, Payroll {index}" autocomplete="off" spellcheck="false">
+    <label for="labels-start">Start numbering at</label>
+    <input type="number" id="labels-start" min="0" value="1">
+    <div class="modal-error" id="labels-error"></div>
     <div class="modal-footer">
-      <button class="btn" onclick="hideModal('import-modal')">Cancel</button>
-      <button class="btn btn-primary" id="btn-import-confirm" onclick="doImportKey()">Import</button>
+      <button class="btn" onclick="hideModal('labels-modal')">Cancel</button>
+      <button class="btn" id="btn-labels-save" onclick="saveLabelTemplate()">Save Template</button>
+      <button class="btn btn-primary" id="btn-labels-apply" onclick="renameAllKeys()">Rename All</button>
     </div>
   </div>
 </div>
 
-<script>
-// ── State ──────────────────────────────────────────────
-let endpoints = [];
-let walletState = 'none';       // 'none' | 'locked' | 'unlocked'
-let decryptedKeys = [];          // [{id, label, address, key}] — in-memory only
-let activeKeyIndex = 0;
-let aesKey = null;               // CryptoKey, held while unlocked
-let storedKeyCount = 0;
-let credMethod = '';             // 'prf' | 'password'
-let expandedAccounts = new Set();   // endpoint IDs currently expanded
-let accountBalances = {};           // { [epId]: { [address]: "1.2345 AVAX" } }
-
-// ── Constants ──────────────────────────────────────────
-const PRF_SALT = new TextEncoder().encode('wallet-encryption-v1');
-const HKDF_INFO = new TextEncoder().encode('AES-GCM Wallet Encryption Key V1');
-const PBKDF2_ITERATIONS = 600000;
-const DB_NAME = 'wallet-vault';
-const DB_VERSION = 1;
+<!-- Login Modal -->
+<div class="modal-overlay" id="login-modal" data-persistent="true">
+  <div class="modal">
+    <h3>Log In</h3>
+    <p>This wallet server has several users. Log in to see your endpoints and accounts.</p>
+    <label for="login-name">Name</label>
+    <input type="text" id="login-name" autocomplete="username" spellcheck="false">
+    <label for="login-password">Password</label>
+    <input type="password" id="login-password" autocomplete="current-password">
+    <div class="modal-error" id="login-error"></div>
+    <div class="modal-footer">
+      <button class="btn btn-primary" id="btn-login" onclick="login()">Log In</button>
+    </div>
+  </div>
+</div>
 
-// ── Init ───────────────────────────────────────────────
-(async function init() {
-  try {
-    const cred = await getCredential();
-    if (cred) {
-      const keys = await getEncryptedKeys();
-      storedKeyCount = keys.length;
-      credMethod = cred.method || 'prf';
-      walletState = 'locked';
-    }
-  } catch (e) {
-    console.error('init check failed:', e);
-  }
-  renderWalletBar();
-  refresh();
-  setInterval(refresh, 10000);
-})();
+<!-- Users Modal -->
+<div class="modal-overlay" id="users-modal">
+  <div class="modal">
+    <h3>Users</h3>
+    <p>Admins, operators, and viewers share the server's endpoints, accounts, and keys: viewers can only look, operators can also send, and admins can change anything. Users each get endpoints, accounts, bookmarks, and preferences of their own.</p>
+    <div id="users-list"></div>
+    <div class="sched-heading">New user</div>
+    <label for="user-name">Name</label>
+    <input type="text" id="user-name" autocomplete="off" spellcheck="false">
+    <label for="user-password">Password</label>
+    <input type="password" id="user-password" autocomplete="new-password" placeholder="At least 8 characters">
+    <label for="user-role">Role</label>
+    <select id="user-role">
+      <option value="user">User</option>
+      <option value="viewer">Viewer</option>
+      <option value="operator">Operator</option>
+      <option value="admin">Admin</option>
+    </select>
+    <div class="modal-error" id="users-error"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('users-modal')">Close</button>
+      <button class="btn btn-primary" onclick="addUser()">Add User</button>
+    </div>
+  </div>
+</div>
 
-// ── IndexedDB Helpers ──────────────────────────────────
-function openVaultDB() {
-  return new Promise((resolve, reject) => {
-    const req = indexedDB.open(DB_NAME, DB_VERSION);
-    req.onupgradeneeded = (e) => {
-      const db = e.target.result;
-      if (!db.objectStoreNames.contains('credentials')) {
-        db.createObjectStore('credentials', { keyPath: 'id' });
-      }
-      if (!db.objectStoreNames.contains('keys')) {
-        db.createObjectStore('keys', { keyPath: 'id', autoIncrement: true });
-      }
-    };
-    req.onsuccess = () => resolve(req.result);
-    req.onerror = () => reject(req.error);
-  });
-}
+<div class="modal-overlay" id="devices-modal">
+  <div class="modal">
+    <h3>Paired Devices</h3>
+    <p>Pair a phone by scanning a one-time QR code with its camera. A paired browser stays logged in as you, but can only check statuses and balances and broadcast transactions it signs itself; it can't unlock the server vault, sign server-side, or change settings.</p>
+    <div id="devices-list"></div>
+    <div class="pair-qr" id="pair-qr">
+      <div id="pair-qr-image"></div>
+      <p class="mono" id="pair-qr-fingerprint"></p>
+      <p id="pair-qr-expires"></p>
+    </div>
+    <div class="modal-error" id="devices-error"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('devices-modal')">Close</button>
+      <button class="btn btn-primary" onclick="startPairing()">Pair a Device</button>
+    </div>
+  </div>
+</div>
+
+<div class="modal-overlay" id="auth-modal">
+  <div class="modal">
+    <h3>Authenticators</h3>
+    <p>Each passkey or password here unlocks this wallet on its own. Add a second one, such as a security key, so losing one doesn't lock you out of your keys.</p>
+    <div id="auth-list"></div>
+    <label for="auth-name">Name of the new one</label>
+    <input type="text" id="auth-name" placeholder="e.g. YubiKey" autocomplete="off">
+    <div id="auth-new-password" style="display:none">
+      <label for="auth-password">New password</label>
+      <input type="password" id="auth-password" autocomplete="new-password" placeholder="At least 8 characters">
+      <label for="auth-password-confirm">Confirm new password</label>
+      <input type="password" id="auth-password-confirm" autocomplete="new-password">
+    </div>
+    <div id="auth-current-field">
+      <label for="auth-current">Current password</label>
+      <input type="password" id="auth-current" autocomplete="current-password" placeholder="Or leave empty to confirm with a passkey">
+    </div>
+    <div class="modal-error" id="auth-error"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('auth-modal')">Close</button>
+      <button class="btn" onclick="showRekeyModal()">Change</button>
+      <button class="btn" onclick="addPasswordAuthenticator()">Add Password</button>
+      <button class="btn btn-primary" onclick="addPasskeyAuthenticator()">Add Passkey</button>
+    </div>
+  </div>
+</div>
+
+<div class="modal-overlay" id="rekey-modal">
+  <div class="modal">
+    <h3>Change Password or Passkey</h3>
+    <p>Every key is re-encrypted under a new vault key that only the new password or passkey unlocks. The other authenticators are removed: add them again afterwards. A synced wallet is uploaded anew, and your other browsers join it with the new password or passkey.</p>
+    <label for="rekey-method">Unlock with</label>
+    <select id="rekey-method" onchange="rekeyMethodChanged()">
+      <option value="password">A new password</option>
+      <option value="prf">A new passkey</option>
+    </select>
+    <div id="rekey-password-fields">
+      <label for="rekey-password">New password</label>
+      <input type="password" id="rekey-password" autocomplete="new-password" placeholder="At least 8 characters">
+      <label for="rekey-password-confirm">Confirm new password</label>
+      <input type="password" id="rekey-password-confirm" autocomplete="new-password">
+    </div>
+    <div id="rekey-current-field">
+      <label for="rekey-current">Current password</label>
+      <input type="password" id="rekey-current" autocomplete="current-password" placeholder="Or leave empty to confirm with a passkey">
+    </div>
+    <div class="modal-error" id="rekey-error"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('rekey-modal')">Cancel</button>
+      <button class="btn btn-primary" id="btn-rekey" onclick="changeUnlockMethod()">Change</button>
+    </div>
+  </div>
+</div>
+
+<div class="modal-overlay" id="shares-modal">
+  <div class="modal">
+    <h3>Recovery Shares</h3>
+    <p>Split a key into shares so that any few of them rebuild it, while fewer reveal nothing. Keep the shares apart, with different people or in different places. The vault key unlocks every key in this wallet, here or synced, so its shares can replace a lost passkey or password.</p>
+    <label for="shares-secret">Split</label>
+    <select id="shares-secret" onchange="sharesSecretChanged()"></select>
+    <label for="shares-count">Shares</label>
+    <input type="number" id="shares-count" min="2" max="16" value="5">
+    <label for="shares-threshold">Needed to recover</label>
+    <input type="number" id="shares-threshold" min="2" max="16" value="3">
+    <div id="shares-current-field" style="display:none">
+      <label for="shares-current">Current password</label>
+      <input type="password" id="shares-current" autocomplete="current-password" placeholder="Or leave empty to confirm with a passkey">
+    </div>
+    <div class="modal-error" id="shares-error"></div>
+    <div id="shares-list"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="closeSharesModal()">Close</button>
+      <button class="btn btn-primary" onclick="splitIntoShares()">Split</button>
+    </div>
+  </div>
+</div>
+
+<div class="modal-overlay" id="recover-modal">
+  <div class="modal">
+    <h3>Recover from Shares</h3>
+    <p>Enter the words of each share on its own line. Shares of a private key add the key to this wallet; shares of the vault key unlock it.</p>
+    <textarea id="recover-shares" rows="6" spellcheck="false" autocomplete="off"></textarea>
+    <div class="modal-error" id="recover-error"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('recover-modal')">Cancel</button>
+      <button class="btn btn-primary" onclick="recoverFromShares()">Recover</button>
+    </div>
+  </div>
+</div>
+
+<div class="modal-overlay" id="rotate-modal">
+  <div class="modal">
+    <h3>Rotate Key</h3>
+    <p>Move everything <span id="rotate-from"></span> holds to a new key on every endpoint, then keep the old address as watch-only. The new key is saved before anything moves. Tokens are swept first and the native currency last, since it pays their gas.</p>
+    <p id="rotate-to" class="mono"></p>
+    <label for="rotate-tokens">Other ERC-20 contracts to sweep, one per line. Registered tokens are always swept.</label>
+    <textarea id="rotate-tokens" rows="3" spellcheck="false" autocomplete="off" placeholder="0x..."></textarea>
+    <div class="modal-error" id="rotate-error"></div>
+    <div id="rotate-rows"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('rotate-modal')">Close</button>
+      <button class="btn" onclick="archiveRotatedKey()">Archive Old Key</button>
+      <button class="btn" id="btn-rotate-scan" onclick="scanRotation()">Scan</button>
+      <button class="btn btn-primary" id="btn-rotate-sweep" onclick="sweepRotation()">Sweep</button>
+    </div>
+  </div>
+</div>
+
+<div class="modal-overlay" id="nft-modal">
+  <div class="modal modal-wide">
+    <h3>NFTs</h3>
+    <p>ERC-721 and ERC-1155 tokens <span id="nft-owner" class="mono"></span> holds on <span id="nft-endpoint"></span>, found from its transfer history. The first look at an address reads the whole chain, which can take a while on a long one.</p>
+    <p id="nft-state"></p>
+    <div class="modal-error" id="nft-error"></div>
+    <div class="nft-grid" id="nft-grid"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('nft-modal')">Close</button>
+    </div>
+  </div>
+</div>
+
+<div class="modal-overlay" id="permit-modal">
+  <div class="modal">
+    <h3>Sign a Permit</h3>
+    <p>Approve a spender for <span id="permit-owner" class="mono"></span> on <span id="permit-endpoint"></span> with a signature instead of a transaction. The spender submits the permit and pays its gas. EIP-2612 needs a token that supports it; Permit2 works for any token the owner has approved Permit2 for.</p>
+    <label for="permit-kind">Standard</label>
+    <select id="permit-kind">
+      <option value="eip2612">EIP-2612 (token permit)</option>
+      <option value="permit2">Permit2</option>
+    </select>
+    <label for="permit-token">Token contract</label>
+    <input type="text" id="permit-token" list="permit-tokens" placeholder="0x..." autocomplete="off" spellcheck="false">
+    <datalist id="permit-tokens"></datalist>
+    <label for="permit-spender">Spender</label>
+    <input type="text" id="permit-spender" placeholder="0x..." autocomplete="off" spellcheck="false">
+    <label for="permit-amount">Amount, in whole tokens of a registered token; empty for unlimited</label>
+    <input type="text" id="permit-amount" autocomplete="off" spellcheck="false">
+    <div class="modal-warning" id="permit-warnings"></div>
+    <div class="modal-error" id="permit-error"></div>
+    <textarea id="permit-result" rows="8" readonly spellcheck="false" style="display:none"></textarea>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('permit-modal')">Close</button>
+      <button class="btn btn-primary" id="btn-permit-sign" onclick="signPermit()">Sign</button>
+    </div>
+  </div>
+</div>
+
+<div class="modal-overlay" id="keysync-modal">
+  <div class="modal">
+    <h3>Sync Keys</h3>
+    <p>Keep this wallet's encrypted keys on the server, so your other browsers and paired phones unlock the same keys with the same password or passkey. The server can't decrypt them.</p>
+    <p id="keysync-status"></p>
+    <div id="keysync-join" style="display:none">
+      <label for="keysync-password">Password of the synced wallet</label>
+      <input type="password" id="keysync-password" autocomplete="off" placeholder="Or leave empty to use a passkey">
+    </div>
+    <div class="modal-error" id="keysync-error"></div>
+    <div class="modal-footer" id="keysync-actions"></div>
+  </div>
+</div>
+
+<div class="modal-overlay" id="backup-modal">
+  <div class="modal">
+    <h3>Backup &amp; Restore</h3>
+    <p>A backup is one file holding this browser's keys, your endpoints, signer accounts, bookmarks, and preferences, encrypted with a passphrase of its own. Keep it somewhere other than this browser: clearing its site data deletes the keys stored here.</p>
+    <div class="sched-heading">Export</div>
+    <p id="backup-keys-note"></p>
+    <label for="backup-passphrase">Passphrase</label>
+    <input type="password" id="backup-passphrase" autocomplete="new-password" placeholder="At least 8 characters">
+    <label for="backup-passphrase-confirm">Confirm passphrase</label>
+    <input type="password" id="backup-passphrase-confirm" autocomplete="new-password">
+    <div class="sched-heading">Restore</div>
+    <label for="restore-file">Backup file</label>
+    <input type="file" id="restore-file" accept=".json,application/json">
+    <label for="restore-passphrase">Passphrase</label>
+    <input type="password" id="restore-passphrase" autocomplete="off">
+    <label for="restore-conflict">When something already exists</label>
+    <select id="restore-conflict">
+      <option value="skip">Keep what is here</option>
+      <option value="replace">Replace it with the backup's</option>
+    </select>
+    <div class="modal-error" id="backup-error"></div>
+    <div class="modal-success" id="backup-result"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('backup-modal')">Close</button>
+      <button class="btn" id="btn-restore" onclick="restoreBackup()">Restore</button>
+      <button class="btn btn-primary" id="btn-backup" onclick="exportBackup()">Export</button>
+    </div>
+  </div>
+</div>
+
+<div class="modal-overlay" id="tokens-modal">
+  <div class="modal">
+    <h3>API Tokens</h3>
+    <p>Tokens let scripts call the API with an Authorization: Bearer header instead of a login. A token can do only what its scopes and your role allow.</p>
+    <div id="tokens-list"></div>
+    <div class="sched-heading">New token</div>
+    <label for="token-name">Name</label>
+    <input type="text" id="token-name" autocomplete="off" spellcheck="false" placeholder="e.g. uptime monitor">
+    <label>Scopes</label>
+    <div class="token-scopes">
+      <label><input type="checkbox" value="read-status" checked> read-status</label>
+      <label><input type="checkbox" value="read-balances"> read-balances</label>
+      <label class="needs-operate"><input type="checkbox" value="broadcast"> broadcast</label>
+      <label class="admin-only"><input type="checkbox" value="admin"> admin</label>
+    </div>
+    <label for="token-expires">Expires</label>
+    <select id="token-expires">
+      <option value="168h">In 7 days</option>
+      <option value="720h" selected>In 30 days</option>
+      <option value="2160h">In 90 days</option>
+      <option value="8760h">In a year</option>
+      <option value="">Never</option>
+    </select>
+    <div class="modal-error" id="tokens-error"></div>
+    <div class="modal-success mono" id="tokens-secret"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('tokens-modal')">Close</button>
+      <button class="btn btn-primary" onclick="createToken()">Create Token</button>
+    </div>
+  </div>
+</div>
+
+<!-- Send Modal -->
+<div class="modal-overlay" id="send-modal">
+  <div class="modal">
+    <h3 id="send-title">Send</h3>
+    <div class="modal-warning" id="send-link-warning">Opened from a link. Check the recipient, amount, and data before confirming.</div>
+    <label for="send-from">From</label>
+    <select id="send-from" onchange="resetSendReview()"></select>
+    <label for="send-endpoint">Endpoint</label>
+    <select id="send-endpoint" onchange="resetSendReview()"></select>
+    <label for="send-to">To</label>
+    <input type="text" id="send-to" placeholder="0x..." autocomplete="off" spellcheck="false" oninput="resetSendReview()">
+    <label for="send-value">Amount</label>
+    <input type="text" id="send-value" placeholder="0.0" autocomplete="off" spellcheck="false" oninput="resetSendReview()">
+    <label for="send-data">Data (optional)</label>
+    <div class="asset-picker">
+      <input type="text" id="send-data" placeholder="0x" autocomplete="off" spellcheck="false" oninput="resetSendReview()">
+      <button class="btn" type="button" onclick="showCalldataModal()" title="Encode a contract call from a registered ABI">Build</button>
+    </div>
+    <label for="send-safe">Via Safe (optional)</label>
+    <input type="text" id="send-safe" placeholder="Propose from a Safe that From owns" autocomplete="off" spellcheck="false" oninput="resetSendReview()">
+    <label><input type="checkbox" id="send-private"> Send privately through a private endpoint of the chain, out of the public mempool</label>
+    <div class="modal-warning" id="send-warnings"></div>
+    <div class="send-review" id="send-review"></div>
+    <div class="send-confirm" id="send-confirm">
+      <div class="modal-warning">This is a large send or a token transfer. Re-type the last 6 characters of the recipient address and the amount to confirm it.</div>
+      <label for="send-confirm-to">Recipient address ends in</label>
+      <input type="text" id="send-confirm-to" maxlength="6" autocomplete="off" spellcheck="false">
+      <label for="send-confirm-value">Amount</label>
+      <input type="text" id="send-confirm-value" placeholder="0.0" autocomplete="off" spellcheck="false">
+    </div>
+    <div class="modal-error" id="send-error"></div>
+    <div class="modal-success" id="send-result"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="registerLinkHandler()" title="Open primalwallet: links from web pages in this dashboard">Handle Links</button>
+      <button class="btn" onclick="hideModal('send-modal')">Close</button>
+      <button class="btn btn-primary" id="btn-send" onclick="sendStep()">Review</button>
+    </div>
+  </div>
+</div>
+
+<!-- Calldata Modal -->
+<div class="modal-overlay" id="calldata-modal">
+  <div class="modal">
+    <h3>Build Calldata</h3>
+    <p>Pick a function from a registered ABI and fill in its arguments. Arrays and tuples take JSON, e.g. ["0xabc...", "5"]. Amounts are in the token's smallest unit.</p>
+    <label for="calldata-abi">ABI</label>
+    <select id="calldata-abi" onchange="renderCalldataFunctions()"></select>
+    <label for="calldata-function">Function</label>
+    <select id="calldata-function" onchange="renderCalldataInputs()"></select>
+    <div id="calldata-inputs"></div>
+    <div class="send-review" id="calldata-review"></div>
+    <div class="modal-error" id="calldata-error"></div>
+    <div class="admin-only">
+      <div class="sched-heading">Register an ABI</div>
+      <label for="abi-name">Name</label>
+      <input type="text" id="abi-name" placeholder="e.g. UniswapV2Router" autocomplete="off" spellcheck="false">
+      <label for="abi-json">JSON ABI or compiler artifact</label>
+      <textarea id="abi-json" rows="4" placeholder='[{"type":"function","name":"transfer",...}]' spellcheck="false"></textarea>
+      <button class="btn" type="button" onclick="fillVerifiedABI()" title="Fill in the ABI verified for the send's recipient on Sourcify or a block explorer">From verified source</button>
+      <button class="btn" type="button" onclick="addABI()">Register</button>
+    </div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('calldata-modal')">Close</button>
+      <button class="btn" onclick="encodeCalldata()">Encode</button>
+      <button class="btn btn-primary" id="btn-calldata-use" onclick="useCalldata()" disabled>Use</button>
+    </div>
+  </div>
+</div>
+
+<!-- Approvals Modal -->
+<div class="modal-overlay" id="approvals-modal">
+  <div class="modal modal-wide">
+    <h3>Approvals</h3>
+    <p>Transactions submitted through the API or a wallet connector wait here until you approve or reject them. Nothing is signed before you approve; unreviewed requests expire.</p>
+    <div class="sched-heading">Awaiting approval</div>
+    <div id="approvals-pending"></div>
+    <div class="sched-heading">Recent decisions</div>
+    <div id="approvals-done"></div>
+    <label for="approver-token">Approver token</label>
+    <input type="password" id="approver-token" placeholder="Needed for transactions that require two approvers" autocomplete="off" spellcheck="false">
+    <div class="modal-error" id="approvals-error"></div>
+    <div class="modal-success" id="approvals-result"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('approvals-modal')">Close</button>
+    </div>
+  </div>
+</div>
+
+<!-- Schedules Modal -->
+<div class="modal-overlay" id="schedules-modal">
+  <div class="modal modal-wide">
+    <h3>Scheduled Transactions</h3>
+    <p>Recurring sends from a server vault key or remote signer. Approve-mode schedules wait here for you; auto-mode schedules sign and broadcast on their own. Times are UTC.</p>
+    <div class="sched-heading">Awaiting approval</div>
+    <div id="sched-pending"></div>
+    <div class="sched-heading">Schedules</div>
+    <div id="sched-list"></div>
+    <div class="sched-heading">Recent runs</div>
+    <div id="sched-runs"></div>
+    <div class="sched-heading">New schedule</div>
+    <div class="sched-form">
+      <div>
+        <label for="sched-name">Name</label>
+        <input type="text" id="sched-name" placeholder="e.g. Weekly DCA" autocomplete="off">
+      </div>
+      <div>
+        <label for="sched-spec">Schedule</label>
+        <input type="text" id="sched-spec" placeholder="0 9 * * 1  or  @daily  or  @every 6h" autocomplete="off" spellcheck="false">
+      </div>
+      <div>
+        <label for="sched-from">From</label>
+        <select id="sched-from"></select>
+      </div>
+      <div>
+        <label for="sched-endpoint">Endpoint</label>
+        <select id="sched-endpoint"></select>
+      </div>
+      <div>
+        <label for="sched-to">To</label>
+        <input type="text" id="sched-to" placeholder="0x..." autocomplete="off" spellcheck="false">
+      </div>
+      <div>
+        <label for="sched-value">Amount</label>
+        <input type="text" id="sched-value" placeholder="0.0" autocomplete="off" spellcheck="false">
+      </div>
+      <div>
+        <label for="sched-data">Data (optional)</label>
+        <input type="text" id="sched-data" placeholder="0x" autocomplete="off" spellcheck="false">
+      </div>
+      <div>
+        <label for="sched-mode">When due</label>
+        <select id="sched-mode">
+          <option value="approve">Queue for approval</option>
+          <option value="auto">Sign and send automatically</option>
+        </select>
+      </div>
+    </div>
+    <div class="modal-error" id="schedules-error"></div>
+    <div class="modal-success" id="schedules-result"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('schedules-modal')">Close</button>
+      <button class="btn btn-primary admin-only" id="btn-sched-add" onclick="addSchedule()">Add Schedule</button>
+    </div>
+  </div>
+</div>
+
+<!-- Bridges Modal -->
+<div class="modal-overlay" id="bridges-modal">
+  <div class="modal modal-wide">
+    <h3>Bridge Transfers</h3>
+    <p>Register a bridge transaction right after sending it. The server waits for it to be mined on the source chain, then for the funds to reach the recipient on the destination chain.</p>
+    <div id="bridge-list"></div>
+    <div class="sched-heading needs-operate">Track a transfer</div>
+    <div class="sched-form needs-operate">
+      <div>
+        <label for="bridge-source">From endpoint</label>
+        <select id="bridge-source"></select>
+      </div>
+      <div>
+        <label for="bridge-dest">To endpoint</label>
+        <select id="bridge-dest"></select>
+      </div>
+      <div>
+        <label for="bridge-hash">Source transaction hash</label>
+        <input type="text" id="bridge-hash" placeholder="0x..." autocomplete="off" spellcheck="false">
+      </div>
+      <div>
+        <label for="bridge-name">Name (optional)</label>
+        <input type="text" id="bridge-name" placeholder="e.g. USDC to Base" autocomplete="off">
+      </div>
+      <div>
+        <label for="bridge-recipient">Recipient (optional)</label>
+        <input type="text" id="bridge-recipient" placeholder="Defaults to the sender" autocomplete="off" spellcheck="false">
+      </div>
+      <div>
+        <label for="bridge-token">Token on destination (optional)</label>
+        <input type="text" id="bridge-token" placeholder="Empty for the native currency" autocomplete="off" spellcheck="false">
+      </div>
+      <div>
+        <label for="bridge-min">Minimum to arrive (optional)</label>
+        <input type="text" id="bridge-min" placeholder="Smallest unit; empty for any amount" autocomplete="off" spellcheck="false">
+      </div>
+    </div>
+    <div class="modal-error" id="bridges-error"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('bridges-modal')">Close</button>
+      <button class="btn btn-primary needs-operate" id="btn-bridge-add" onclick="addBridge()">Track</button>
+    </div>
+  </div>
+</div>
+
+<!-- Batches Modal -->
+<div class="modal-overlay" id="contacts-modal">
+  <div class="modal modal-wide">
+    <h3>Contacts</h3>
+    <p>The addresses this wallet has sent to, with what its sends moved to and from each. Received amounts only cover what came back within those sends, such as a swap's output.</p>
+    <div id="contact-list"></div>
+    <div id="contact-detail" style="display:none">
+      <div class="sched-heading" id="contact-detail-title"></div>
+      <div class="batch-table" id="contact-history"></div>
+    </div>
+    <div class="modal-error" id="contacts-error"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('contacts-modal')">Close</button>
+    </div>
+  </div>
+</div>
+
+<div class="modal-overlay" id="batches-modal">
+  <div class="modal modal-wide">
+    <h3>Batch Sends</h3>
+    <p>Pay a list of addresses from one account, as a transfer to each or as one call to the Disperse contract. Every recipient is checked before anything is built, and the batch's transactions are followed as they confirm.</p>
+    <div id="batch-list"></div>
+    <div id="batch-detail" style="display:none">
+      <div class="sched-heading" id="batch-detail-title"></div>
+      <div id="batch-cost"></div>
+      <div class="batch-table" id="batch-recipients"></div>
+      <div class="batch-table" id="batch-txs"></div>
+      <div class="sched-form" id="batch-confirm" style="display:none">
+        <div>
+          <label for="batch-confirm-to">Last 6 characters of the target</label>
+          <input type="text" id="batch-confirm-to" autocomplete="off" spellcheck="false">
+        </div>
+        <div>
+          <label for="batch-confirm-value">Value, re-typed</label>
+          <input type="text" id="batch-confirm-value" autocomplete="off" spellcheck="false">
+        </div>
+      </div>
+    </div>
+    <div class="sched-heading needs-operate">New batch</div>
+    <div class="sched-form needs-operate">
+      <div>
+        <label for="batch-endpoint">Endpoint</label>
+        <select id="batch-endpoint"></select>
+      </div>
+      <div>
+        <label for="batch-from">From</label>
+        <select id="batch-from"></select>
+      </div>
+      <div>
+        <label for="batch-mode">Send as</label>
+        <select id="batch-mode">
+          <option value="transfers">A transfer to each recipient</option>
+          <option value="disperse">One Disperse contract call</option>
+        </select>
+      </div>
+      <div>
+        <label for="batch-token">Token (optional)</label>
+        <input type="text" id="batch-token" placeholder="ERC-20 address; empty for the native currency" autocomplete="off" spellcheck="false">
+      </div>
+      <div>
+        <label for="batch-name">Name (optional)</label>
+        <input type="text" id="batch-name" placeholder="e.g. March airdrop" autocomplete="off">
+      </div>
+      <div>
+        <label for="batch-file">List file (optional)</label>
+        <input type="file" id="batch-file" accept=".csv,.txt,.json,text/csv,application/json" onchange="loadBatchFile()">
+      </div>
+    </div>
+    <div class="needs-operate">
+      <label for="batch-list-text">Recipients</label>
+      <textarea id="batch-list-text" rows="5" placeholder="address,amount&#10;0x...,1.5" spellcheck="false"></textarea>
+    </div>
+    <div class="modal-error" id="batches-error"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('batches-modal')">Close</button>
+      <button class="btn needs-operate" id="btn-batch-preview" onclick="addBatch(true)">Preview</button>
+      <button class="btn btn-primary needs-operate" id="btn-batch-add" onclick="addBatch(false)">Create</button>
+      <button class="btn btn-primary needs-operate" id="btn-batch-send" onclick="sendBatch()" style="display:none">Send</button>
+    </div>
+  </div>
+</div>
+
+<!-- Devnet Modal -->
+<div class="modal-overlay" id="devnet-modal">
+  <div class="modal modal-wide">
+    <h3 id="devnet-title">Test Chain</h3>
+    <p>Drive an Anvil or Hardhat node's chain: save and restore its state, mine blocks, move its clock, set balances, and send from any address without its key. The snapshots and impersonations listed are the ones made here since the server started.</p>
+    <div id="devnet-status"></div>
+    <div class="sched-heading">Snapshots</div>
+    <div id="devnet-snapshots"></div>
+    <div class="devnet-control admin-only">
+      <div>
+        <label for="devnet-snapshot-name">Name (optional)</label>
+        <input type="text" id="devnet-snapshot-name" placeholder="e.g. before deploy" autocomplete="off">
+      </div>
+      <button class="btn" onclick="devnetSnapshot()">Take Snapshot</button>
+    </div>
+    <div class="sched-heading admin-only">Blocks and time</div>
+    <div class="devnet-control admin-only">
+      <div>
+        <label for="devnet-mine-blocks">Blocks</label>
+        <input type="number" id="devnet-mine-blocks" min="1" value="1">
+      </div>
+      <div>
+        <label for="devnet-mine-interval">Seconds apart (optional)</label>
+        <input type="number" id="devnet-mine-interval" min="0" placeholder="node default">
+      </div>
+      <button class="btn" onclick="devnetMine()">Mine</button>
+    </div>
+    <div class="devnet-control admin-only">
+      <div>
+        <label for="devnet-time-hours">Move the clock forward, hours</label>
+        <input type="number" id="devnet-time-hours" min="0" step="any" placeholder="e.g. 24">
+      </div>
+      <button class="btn" onclick="devnetTime()">Advance and Mine</button>
+    </div>
+    <div class="sched-heading admin-only">Accounts</div>
+    <div class="devnet-control admin-only">
+      <div>
+        <label for="devnet-balance-address">Address</label>
+        <input type="text" id="devnet-balance-address" placeholder="0x..." autocomplete="off" spellcheck="false">
+      </div>
+      <div>
+        <label for="devnet-balance-amount" id="devnet-balance-label">Balance</label>
+        <input type="text" id="devnet-balance-amount" placeholder="e.g. 100" autocomplete="off">
+      </div>
+      <button class="btn" onclick="devnetSetBalance()">Set Balance</button>
+    </div>
+    <div id="devnet-impersonated"></div>
+    <div class="devnet-control admin-only">
+      <div>
+        <label for="devnet-impersonate-address">Impersonate</label>
+        <input type="text" id="devnet-impersonate-address" placeholder="0x..." autocomplete="off" spellcheck="false">
+      </div>
+      <button class="btn" onclick="devnetImpersonate(document.getElementById('devnet-impersonate-address').value.trim(), true)">Impersonate</button>
+    </div>
+    <div class="modal-error" id="devnet-error"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('devnet-modal')">Close</button>
+    </div>
+  </div>
+</div>
+
+<!-- Alerts Modal -->
+<div class="modal-overlay" id="alerts-modal">
+  <div class="modal modal-wide">
+    <h3>Alerts</h3>
+    <p>The server checks each alert at every new block on its endpoint and notifies open dashboards when a gas alert's condition starts to hold, a watched balance changes, or an endpoint goes offline and comes back. A muted alert is still checked, but sends nothing.</p>
+    <div id="alert-list"></div>
+    <div class="sched-heading needs-operate">New alert</div>
+    <div class="sched-form needs-operate">
+      <div>
+        <label for="alert-kind">Kind</label>
+        <select id="alert-kind" onchange="showAlertFields()">
+          <option value="gas">Gas price</option>
+          <option value="balance">Balance change</option>
+          <option value="offline">Endpoint offline</option>
+        </select>
+      </div>
+      <div>
+        <label for="alert-endpoint">Endpoint</label>
+        <select id="alert-endpoint"></select>
+      </div>
+      <div class="alert-gas">
+        <label for="alert-metric">Fee</label>
+        <select id="alert-metric">
+          <option value="base_fee">Base fee</option>
+          <option value="gas_price">Gas price</option>
+          <option value="priority_fee">Priority fee</option>
+        </select>
+      </div>
+      <div class="alert-gas">
+        <label for="alert-below">Below (gwei)</label>
+        <input type="text" id="alert-below" placeholder="e.g. 10" autocomplete="off" spellcheck="false">
+      </div>
+      <div class="alert-gas">
+        <label for="alert-above">Above (gwei)</label>
+        <input type="text" id="alert-above" placeholder="e.g. 100" autocomplete="off" spellcheck="false">
+      </div>
+      <div class="alert-balance">
+        <label for="alert-address">Address</label>
+        <input type="text" id="alert-address" list="alert-addresses" placeholder="0x..." autocomplete="off" spellcheck="false">
+        <datalist id="alert-addresses"></datalist>
+      </div>
+      <div class="alert-balance">
+        <label for="alert-direction">Changes</label>
+        <select id="alert-direction">
+          <option value="any">Any</option>
+          <option value="in">Incoming</option>
+          <option value="out">Outgoing</option>
+        </select>
+      </div>
+      <div class="alert-balance">
+        <label for="alert-min">At least (optional)</label>
+        <input type="text" id="alert-min" placeholder="Whole native units, e.g. 0.1" autocomplete="off" spellcheck="false">
+      </div>
+      <div class="alert-offline">
+        <label for="alert-after">Offline for (optional)</label>
+        <input type="text" id="alert-after" placeholder="e.g. 5m; empty for at once" autocomplete="off" spellcheck="false">
+      </div>
+      <div>
+        <label for="alert-name">Name (optional)</label>
+        <input type="text" id="alert-name" placeholder="e.g. Cheap gas" autocomplete="off">
+      </div>
+    </div>
+    <div class="modal-error" id="alerts-error"></div>
+    <div class="sched-heading">Browser notifications</div>
+    <p id="push-status"></p>
+    <div class="modal-error" id="push-error"></div>
+    <button class="btn" id="btn-push" onclick="togglePush()">Notify this browser</button>
+    <button class="btn" id="btn-push-test" onclick="testPush()">Send Test</button>
+    <div class="admin-only">
+      <div class="sched-heading">Notification channels</div>
+      <p>Besides this dashboard, notifications go to every enabled channel that takes their kind.</p>
+      <div id="channel-list"></div>
+      <div class="sched-form">
+        <div>
+          <label for="channel-type">Type</label>
+          <select id="channel-type" onchange="showChannelFields()">
+            <option value="webhook">Webhook</option>
+            <option value="telegram">Telegram</option>
+            <option value="email">Email</option>
+            <option value="ntfy">ntfy</option>
+          </select>
+        </div>
+        <div>
+          <label for="channel-name">Name</label>
+          <input type="text" id="channel-name" placeholder="e.g. Ops chat" autocomplete="off">
+        </div>
+        <div class="channel-webhook channel-ntfy">
+          <label for="channel-url">URL</label>
+          <input type="text" id="channel-url" placeholder="https://..." autocomplete="off" spellcheck="false">
+        </div>
+        <div class="channel-ntfy">
+          <label for="channel-token">Access token (optional)</label>
+          <input type="password" id="channel-token" autocomplete="off">
+        </div>
+        <div class="channel-telegram">
+          <label for="channel-bot-token">Bot token</label>
+          <input type="password" id="channel-bot-token" autocomplete="off">
+        </div>
+        <div class="channel-telegram">
+          <label for="channel-chat-id">Chat ID</label>
+          <input type="text" id="channel-chat-id" autocomplete="off" spellcheck="false">
+        </div>
+        <div class="channel-email">
+          <label for="channel-smtp">SMTP server</label>
+          <input type="text" id="channel-smtp" placeholder="smtp.example.com:587" autocomplete="off" spellcheck="false">
+        </div>
+        <div class="channel-email">
+          <label for="channel-username">SMTP login (optional)</label>
+          <input type="text" id="channel-username" autocomplete="off" spellcheck="false">
+        </div>
+        <div class="channel-email">
+          <label for="channel-password">SMTP password</label>
+          <input type="password" id="channel-password" autocomplete="off">
+        </div>
+        <div class="channel-email">
+          <label for="channel-from">From</label>
+          <input type="text" id="channel-from" placeholder="wallet@example.com" autocomplete="off" spellcheck="false">
+        </div>
+        <div class="channel-email">
+          <label for="channel-to">To</label>
+          <input type="text" id="channel-to" placeholder="Comma-separated addresses" autocomplete="off" spellcheck="false">
+        </div>
+      </div>
+      <label>Alert kinds</label>
+      <div class="channel-kinds">
+        <label><input type="checkbox" value="gas" checked> gas</label>
+        <label><input type="checkbox" value="balance" checked> balance</label>
+        <label><input type="checkbox" value="offline" checked> offline</label>
+        <label><input type="checkbox" value="tx" checked> tx</label>
+      </div>
+      <div class="modal-error" id="channels-error"></div>
+      <button class="btn" id="btn-channel-add" onclick="addChannel()">Add Channel</button>
+    </div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('alerts-modal')">Close</button>
+      <button class="btn btn-primary needs-operate" id="btn-alert-add" onclick="addAlert()">Add</button>
+    </div>
+  </div>
+</div>
+
+<!-- Safes Modal -->
+<div class="modal-overlay" id="safes-modal">
+  <div class="modal modal-wide">
+    <h3>Safe Multisig</h3>
+    <p>Safes your keys own on the endpoint's chain, found through the Safe Transaction Service and read from the chain. Each pending transaction is rebuilt and hashed here before anyone signs it. To propose a new one, send with "Via Safe" filled in.</p>
+    <label for="safes-endpoint">Endpoint</label>
+    <div class="asset-picker">
+      <select id="safes-endpoint"></select>
+      <button class="btn" type="button" onclick="detectSafes()">Detect</button>
+    </div>
+    <div id="safe-list"></div>
+    <div id="safe-detail"></div>
+    <div class="modal-error" id="safes-error"></div>
+    <div class="modal-success" id="safes-result"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('safes-modal')">Close</button>
+    </div>
+  </div>
+</div>
+
+<!-- Compare Modal -->
+<div class="modal-overlay" id="compare-modal">
+  <div class="modal modal-wide">
+    <h3>Compare Endpoints</h3>
+    <p>Two endpoints on the same chain side by side, updated live. Better values are highlighted.</p>
+    <div class="compare-pick">
+      <select id="compare-a" onchange="compareChanged(true)"></select>
+      <select id="compare-b" onchange="compareChanged(false)"></select>
+    </div>
+    <table class="compare-table" id="compare-table"></table>
+    <div class="modal-error" id="compare-error"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('compare-modal')">Close</button>
+    </div>
+  </div>
+</div>
+
+<!-- Broadcast Modal -->
+<div class="modal-overlay" id="broadcast-modal">
+  <div class="modal">
+    <h3>Broadcast Transaction</h3>
+    <p>Send an already-signed raw transaction through one of the endpoints.</p>
+    <label for="broadcast-endpoint">Endpoint</label>
+    <select id="broadcast-endpoint"></select>
+    <label for="broadcast-raw">Signed transaction (hex)</label>
+    <textarea id="broadcast-raw" rows="5" placeholder="0x02f8..." spellcheck="false"></textarea>
+    <label><input type="checkbox" id="broadcast-private"> Send privately through a private endpoint of the chain, out of the public mempool</label>
+    <div class="modal-error" id="broadcast-error"></div>
+    <div class="modal-success" id="broadcast-result"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('broadcast-modal')">Close</button>
+      <button class="btn btn-primary" id="btn-broadcast" onclick="broadcastRaw()">Broadcast</button>
+    </div>
+  </div>
+</div>
+
+<div class="modal-overlay" id="vanity-modal">
+  <div class="modal">
+    <h3>Vanity Address</h3>
+    <p>Generate random keys on this device until one's address starts or ends with the hex digits you choose. Each digit makes it 16 times slower, so keep it to a few.</p>
+    <label for="vanity-prefix">Starts with</label>
+    <input type="text" id="vanity-prefix" placeholder="e.g. cafe" autocomplete="off" spellcheck="false" oninput="vanityChanged()">
+    <label for="vanity-suffix">Ends with</label>
+    <input type="text" id="vanity-suffix" autocomplete="off" spellcheck="false" oninput="vanityChanged()">
+    <label><input type="checkbox" id="vanity-checksum" onchange="vanityChanged()"> Match upper and lower case of the checksummed address</label>
+    <p id="vanity-progress"></p>
+    <div class="modal-error" id="vanity-error"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="stopVanity(); hideModal('vanity-modal')">Close</button>
+      <button class="btn btn-primary" id="btn-vanity" onclick="toggleVanity()">Start</button>
+    </div>
+  </div>
+</div>
+
+<!-- Import Key Modal -->
+<div class="modal-overlay" id="import-modal">
+  <div class="modal">
+    <h3>Import Private Key</h3>
+    <label for="import-label">Label</label>
+    <input type="text" id="import-label" placeholder="e.g. Main, Test, Hot" autocomplete="off" spellcheck="false">
+    <label for="import-key">Private Key (hex)</label>
+    <input type="password" id="import-key" placeholder="0x..." autocomplete="off" spellcheck="false">
+    <div class="modal-error" id="import-error"></div>
+    <div class="modal-footer">
+      <button class="btn" onclick="hideModal('import-modal')">Cancel</button>
+      <button class="btn btn-primary" id="btn-import-confirm" onclick="doImportKey()">Import</button>
+    </div>
+  </div>
+</div>
+
+<script>
+// ── State ──────────────────────────────────────────────
+let endpoints = [];
+let walletState = 'none';       // 'none' | 'locked' | 'unlocked'
+let decryptedKeys = [];          // [{id, label, address, key}] — in-memory only
+let activeKeyIndex = 0;
+let aesKey = null;               // CryptoKey, held while unlocked
+let recoveredVaultKey = null;    // raw vault key while unlocked with recovery shares
+let storedKeyCount = 0;
+let credMethod = '';             // 'prf' | 'password' | 'both'
+let keySyncId = '';              // ID of the synced vault this browser holds, or ''
+let keySyncAvailable = false;    // a synced vault exists this browser could adopt or join
+let expandedAccounts = new Set();   // endpoint IDs currently expanded
+let accountBalances = {};           // { [epId]: { [address]: "1.2345 AVAX" } }
+let tokenBalances = {};             // { [epId]: { [address]: "12.5 USDC, 0.1 WETH" } }
+let hwAccounts = [];                // [{address, label, kind, path}] — hardware signer accounts
+let hwCandidates = [];              // [{address, path, index}] — loaded but not yet added
+let bookmarks = [];                 // [{id, chain_id, block_number, timestamp, note}]
+let asOfBookmark = '';              // bookmark ID balances are shown as of; '' for latest
+let faucetStatus = null;            // /api/faucet when faucet mode is on
+let lockEpoch = null;               // server lock epoch; a change means a panic lock elsewhere
+let pushSocket = null;              // open /api/ws connection, or null while polling
+let pushSubscription = '';          // last subscribe command sent, as JSON
+let pollTimer = null;               // fallback status polling while the socket is down
+let latestBalances = {};            // { [epId]: { [address lowercased]: "1.2345 AVAX" } } from pushes
+let watchedTxs = {};                // { [hash]: { endpoint, el } } broadcasts awaiting a receipt
+let sendAccounts = [];              // From choices: wallet accounts plus server vault keys
+let sendMode = 'send';              // 'send' broadcasts; 'sign' only signs (from a sign link)
+let sendEnvelope = null;            // built transaction awaiting confirmation
+let schedules = [];                 // /api/schedules
+let scheduleRuns = [];              // /api/schedules/runs, newest first
+let bridges = [];                   // /api/bridges, newest first
+let batches = [];                   // /api/batches, newest first
+let batchShown = null;              // the batch in the Batches dialog's detail, kept or previewed
+let batchAccounts = [];             // signingAccounts() when the Batches dialog opened
+let alerts = [];                    // /api/alerts, oldest first
+let channels = [];                  // /api/channels, without secrets
+let safes = [];                     // /api/safes for the Safes dialog's endpoint
+let safeOpen = null;                // { endpoint, safe, pending } of the Safe under review
+let safeSigners = [];               // signingAccounts() when Safes were last detected
+let approvals = [];                 // /api/approvals, newest first
+let assets = [];                    // /api/assets
+let comparePair = [];               // [a, b] endpoint IDs while the compare view is open
+let compareTimer = null;            // fallback compare polling while the socket is down
+
+// ── Constants ──────────────────────────────────────────
+const PRF_SALT = new TextEncoder().encode('wallet-encryption-v1');
+const HKDF_INFO = new TextEncoder().encode('AES-GCM Wallet Encryption Key V1');
+const VAULT_CHECK = 'wallet-vault-check';
+const PBKDF2_ITERATIONS = 600000;
+const DB_NAME = 'wallet-vault';
+const DB_VERSION = 1;
+const LABEL_TEMPLATE_KEY = 'wallet-label-template';
+const PUSH_SUBSCRIPTION_KEY = 'wallet-push-subscription';   // this browser's push subscription ID
+const DEFAULT_LABEL_TEMPLATE = 'Key {index}';
+const BROADCAST_ONLY = {{BROADCAST_ONLY}};
+const CSRF_TOKEN = '{{CSRF_TOKEN}}';
+const ETHERS_SRI = '{{ETHERS_SRI}}';
+
+// Requests that change state send the CSRF token, which the server checks
+// against its cookie. Only this server gets it.
+const nativeFetch = window.fetch.bind(window);
+window.fetch = function(input, init) {
+  init = init || {};
+  const method = (init.method || (input instanceof Request ? input.method : 'GET')).toUpperCase();
+  const url = new URL(input instanceof Request ? input.url : input, location.href);
+  if (method !== 'GET' && method !== 'HEAD' && url.origin === location.origin) {
+    const headers = new Headers(init.headers || (input instanceof Request ? input.headers : undefined));
+    headers.set('X-CSRF-Token', CSRF_TOKEN);
+    init = Object.assign({}, init, { headers: headers });
+  }
+  return nativeFetch(input, init);
+};
+
+let me = { multi_user: false, user: null, permissions: [] }; // from /api/me
+let prefs = {};                             // the user's server-side preferences
+
+// ── Init ───────────────────────────────────────────────
+(async function init() {
+  if (BROADCAST_ONLY) {
+    document.body.classList.add('broadcast-only');
+    refresh();
+    connectPush();
+    return;
+  }
+  await redeemPairing();
+  if (!(await loadMe())) return;
+  await loadPreferences();
+  try {
+    const cred = await getCredential();
+    if (cred) {
+      const keys = await getEncryptedKeys();
+      storedKeyCount = keys.filter(k => !k.deletedAt).length;
+      credMethod = vaultMethod(cred);
+      walletState = 'locked';
+      keySyncId = cred.syncId || '';
+    }
+    await probeKeySync();
+    scheduleKeySync();
+  } catch (e) {
+    console.error('init check failed:', e);
+  }
+  renderWalletBar();
+  refresh().then(openDeepLink);
+  connectPush();
+  if (can('manage')) loadDevnets();
+})();
+
+// ── Users ──────────────────────────────────────────────
+// In multi-user mode the dashboard needs a login first. Controls the role
+// doesn't permit are hidden, and users with a profile of their own don't
+// see the server's queues.
+async function loadMe() {
+  try {
+    const resp = await fetch('/api/me');
+    if (resp.ok) me = await resp.json();
+  } catch (err) {
+    console.error('user check failed:', err);
+  }
+  if (me.multi_user && !me.user) {
+    showModal('login-modal');
+    document.getElementById('login-name').focus();
+    return false;
+  }
+  if (me.user) {
+    document.getElementById('user-badge').textContent = me.user.name + (me.user.role !== 'user' ? ' \u00b7 ' + me.user.role : '');
+    if (can('admin')) document.getElementById('btn-users').style.display = '';
+    if (me.device) {
+      // A paired device stays logged in until it is revoked from another
+      // session, so it has no Log Out.
+      document.getElementById('user-badge').textContent += ' \u00b7 ' + me.device.name;
+    } else {
+      document.getElementById('btn-logout').style.display = '';
+      document.getElementById('btn-tokens').style.display = '';
+      document.getElementById('btn-devices').style.display = '';
+    }
+    for (const perm of ['admin', 'manage', 'operate']) {
+      if (!can(perm)) document.body.classList.add('no-' + perm);
+    }
+    if (!sharedProfile()) document.body.classList.add('own-profile');
+  }
+  return true;
+}
+
+// can reports whether the logged-in user's role grants perm. Paired devices
+// never manage or administer, whatever the role.
+function can(perm) {
+  if (me.device && (perm === 'manage' || perm === 'admin')) return false;
+  return !me.user || (me.permissions || []).includes(perm);
+}
+
+function sharedProfile() {
+  return !me.user || me.user.role !== 'user';
+}
+
+async function login() {
+  const errEl = document.getElementById('login-error');
+  const btn = document.getElementById('btn-login');
+  errEl.style.display = 'none';
+  btn.disabled = true;
+  try {
+    const resp = await fetch('/api/login', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({
+        name: document.getElementById('login-name').value.trim(),
+        password: document.getElementById('login-password').value
+      })
+    });
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'HTTP ' + resp.status);
+    location.reload();
+  } catch (err) {
+    errEl.textContent = err.message;
+    errEl.style.display = 'block';
+    btn.disabled = false;
+  }
+}
+
+async function logout() {
+  try {
+    await fetch('/api/logout', { method: 'POST' });
+  } finally {
+    location.reload();
+  }
+}
+
+async function showUsersModal() {
+  document.getElementById('users-error').style.display = 'none';
+  document.getElementById('user-name').value = '';
+  document.getElementById('user-password').value = '';
+  document.getElementById('user-role').value = 'user';
+  await renderUsers();
+  showModal('users-modal');
+}
+
+async function renderUsers() {
+  const listEl = document.getElementById('users-list');
+  try {
+    const resp = await fetch('/api/users');
+    const users = await resp.json();
+    if (!resp.ok) throw new Error(users.error || 'HTTP ' + resp.status);
+    listEl.innerHTML = users.map(u => {
+      const self = me.user && u.id === me.user.id;
+      return '<div class="trash-row">' +
+        '<span class="trash-name">' + esc(u.name) + (self ? ' <span class="trash-kind">you</span>' : '') + '</span>' +
+        '<select class="key-selector" onchange="setUserRole(\'' + esc(u.id) + '\', this.value)">' +
+          ['user', 'viewer', 'operator', 'admin'].map(r => '<option value="' + r + '"' + (r === u.role ? ' selected' : '') + '>' + r + '</option>').join('') +
+        '</select>' +
+        (self ? '' : '<button class="btn btn-danger" onclick="deleteUser(\'' + esc(u.id) + '\', \'' + esc(u.name) + '\')">Remove</button>') +
+      '</div>';
+    }).join('');
+  } catch (err) {
+    const errEl = document.getElementById('users-error');
+    errEl.textContent = 'Failed to load users: ' + err.message;
+    errEl.style.display = 'block';
+  }
+}
+
+async function usersAction(method, path, body) {
+  const errEl = document.getElementById('users-error');
+  errEl.style.display = 'none';
+  try {
+    const resp = await fetch(path, {
+      method: method,
+      headers: body ? { 'Content-Type': 'application/json' } : {},
+      body: body ? JSON.stringify(body) : undefined
+    });
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'HTTP ' + resp.status);
+    await renderUsers();
+    return true;
+  } catch (err) {
+    errEl.textContent = 'Failed: ' + err.message;
+    errEl.style.display = 'block';
+    return false;
+  }
+}
+
+async function addUser() {
+  const ok = await usersAction('POST', '/api/users', {
+    name: document.getElementById('user-name').value.trim(),
+    password: document.getElementById('user-password').value,
+    role: document.getElementById('user-role').value
+  });
+  if (ok) {
+    document.getElementById('user-name').value = '';
+    document.getElementById('user-password').value = '';
+  }
+}
+
+function setUserRole(id, role) {
+  usersAction('PUT', '/api/users/' + encodeURIComponent(id), { role: role });
+}
+
+async function showTokensModal() {
+  document.getElementById('tokens-error').style.display = 'none';
+  document.getElementById('tokens-secret').style.display = 'none';
+  document.getElementById('token-name').value = '';
+  await renderTokens();
+  showModal('tokens-modal');
+}
+
+async function renderTokens() {
+  const listEl = document.getElementById('tokens-list');
+  try {
+    const resp = await fetch('/api/tokens');
+    const tokens = await resp.json();
+    if (!resp.ok) throw new Error(tokens.error || 'HTTP ' + resp.status);
+    listEl.innerHTML = tokens.length ? tokens.map(t => {
+      const meta = [t.scopes.join(', ')];
+      if (t.owner !== me.user.name) meta.push(t.owner);
+      meta.push(t.expires_at ? 'expires ' + new Date(t.expires_at).toLocaleDateString() : 'never expires');
+      meta.push(t.last_used_at ? 'used ' + new Date(t.last_used_at).toLocaleString() : 'never used');
+      return '<div class="trash-row">' +
+        '<span class="trash-name">' + esc(t.name) + ' <span class="trash-kind">' + esc(meta.join(' \u00b7 ')) + '</span></span>' +
+        '<button class="btn btn-danger token-revoke" data-id="' + esc(t.id) + '" data-name="' + esc(t.name) + '">Revoke</button>' +
+      '</div>';
+    }).join('') : '<p class="trash-empty">No tokens yet.</p>';
+    listEl.querySelectorAll('.token-revoke').forEach(btn => {
+      btn.addEventListener('click', () => revokeToken(btn.dataset.id, btn.dataset.name));
+    });
+  } catch (err) {
+    const errEl = document.getElementById('tokens-error');
+    errEl.textContent = 'Failed to load tokens: ' + err.message;
+    errEl.style.display = 'block';
+  }
+}
+
+async function createToken() {
+  const errEl = document.getElementById('tokens-error');
+  const secretEl = document.getElementById('tokens-secret');
+  errEl.style.display = 'none';
+  secretEl.style.display = 'none';
+  const body = {
+    name: document.getElementById('token-name').value.trim(),
+    scopes: Array.from(document.querySelectorAll('.token-scopes input:checked')).map(el => el.value),
+    expires_in: document.getElementById('token-expires').value
+  };
+  try {
+    const resp = await fetch('/api/tokens', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify(body)
+    });
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'HTTP ' + resp.status);
+    secretEl.textContent = 'Copy this token now; it won\'t be shown again: ' + data.secret;
+    secretEl.style.display = 'block';
+    document.getElementById('token-name').value = '';
+    await renderTokens();
+  } catch (err) {
+    errEl.textContent = 'Failed: ' + err.message;
+    errEl.style.display = 'block';
+  }
+}
+
+async function revokeToken(id, name) {
+  if (!confirm('Revoke ' + name + '? Scripts using it will stop working.')) return;
+  const errEl = document.getElementById('tokens-error');
+  errEl.style.display = 'none';
+  try {
+    const resp = await fetch('/api/tokens/' + encodeURIComponent(id), { method: 'DELETE' });
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'HTTP ' + resp.status);
+    await renderTokens();
+  } catch (err) {
+    errEl.textContent = 'Failed: ' + err.message;
+    errEl.style.display = 'block';
+  }
+}
+
+async function showDevicesModal() {
+  document.getElementById('devices-error').style.display = 'none';
+  document.getElementById('pair-qr').style.display = 'none';
+  await renderDevices();
+  showModal('devices-modal');
+}
+
+async function renderDevices() {
+  const listEl = document.getElementById('devices-list');
+  try {
+    const resp = await fetch('/api/devices');
+    const devices = await resp.json();
+    if (!resp.ok) throw new Error(devices.error || 'HTTP ' + resp.status);
+    listEl.innerHTML = devices.length ? devices.map(d => {
+      const meta = [d.scopes.join(', ')];
+      if (d.owner !== me.user.name) meta.push(d.owner);
+      meta.push('paired ' + new Date(d.paired_at).toLocaleDateString());
+      meta.push(d.last_used_at ? 'used ' + new Date(d.last_used_at).toLocaleString() + (d.last_ip ? ' from ' + d.last_ip : '') : 'never used');
+      return '<div class="trash-row">' +
+        '<span class="trash-name">' + esc(d.name) + ' <span class="trash-kind">' + esc(meta.join(' \u00b7 ')) + '</span></span>' +
+        '<button class="btn btn-danger device-revoke" data-id="' + esc(d.id) + '" data-name="' + esc(d.name) + '">Revoke</button>' +
+      '</div>';
+    }).join('') : '<p class="trash-empty">No paired devices.</p>';
+    listEl.querySelectorAll('.device-revoke').forEach(btn => {
+      btn.addEventListener('click', () => revokeDevice(btn.dataset.id, btn.dataset.name));
+    });
+  } catch (err) {
+    const errEl = document.getElementById('devices-error');
+    errEl.textContent = 'Failed to load devices: ' + err.message;
+    errEl.style.display = 'block';
+  }
+}
+
+// startPairing shows a one-time QR code. The SVG comes from the server's
+// own encoder, so it is inserted as markup.
+async function startPairing() {
+  const errEl = document.getElementById('devices-error');
+  errEl.style.display = 'none';
+  try {
+    const resp = await fetch('/api/devices/pairing', { method: 'POST' });
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'HTTP ' + resp.status);
+    document.getElementById('pair-qr-image').innerHTML = data.svg;
+    document.getElementById('pair-qr-fingerprint').textContent = data.fingerprint
+      ? 'Certificate SHA-256: ' + data.fingerprint
+      : 'Served over plain HTTP: the pairing code can be read by anyone on the network.';
+    document.getElementById('pair-qr-expires').textContent = 'Scan before ' + new Date(data.expires_at).toLocaleTimeString() + '. The code works once.';
+    document.getElementById('pair-qr').style.display = 'block';
+  } catch (err) {
+    errEl.textContent = 'Failed: ' + err.message;
+    errEl.style.display = 'block';
+  }
+}
+
+async function revokeDevice(id, name) {
+  if (!confirm('Revoke ' + name + '? It will need to be paired again.')) return;
+  const errEl = document.getElementById('devices-error');
+  errEl.style.display = 'none';
+  try {
+    const resp = await fetch('/api/devices/' + encodeURIComponent(id), { method: 'DELETE' });
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'HTTP ' + resp.status);
+    await renderDevices();
+  } catch (err) {
+    errEl.textContent = 'Failed: ' + err.message;
+    errEl.style.display = 'block';
+  }
+}
+
+// redeemPairing pairs this browser when it was opened from a pairing QR
+// code (/#pair=<code>&fp=<fingerprint>). The code is in the fragment so it
+// never reaches proxy logs.
+async function redeemPairing() {
+  const params = new URLSearchParams(location.hash.slice(1));
+  const code = params.get('pair');
+  if (!code) return;
+  history.replaceState(null, '', location.pathname + location.search);
+  try {
+    const resp = await fetch('/api/devices/pair', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ code: code })
+    });
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'HTTP ' + resp.status);
+  } catch (err) {
+    alert('Pairing failed: ' + err.message);
+  }
+}
+
+function deleteUser(id, name) {
+  if (!confirm('Remove ' + name + '? Their data stays on the server.')) return;
+  usersAction('DELETE', '/api/users/' + encodeURIComponent(id));
+}
+
+// ── Key Sync ───────────────────────────────────────────
+// With sync on, the server keeps a copy of the encrypted key records and the
+// credential they are encrypted under, so another browser (or a paired
+// phone) unlocks the same keys. Records changed here are marked dirty and
+// pushed with the version last seen; when another browser changed the key
+// first, the newer change wins, and a key purged elsewhere but edited here
+// is kept rather than lost.
+let keySyncChain = Promise.resolve();
+
+// scheduleKeySync queues a sync behind any that is running.
+function scheduleKeySync() {
+  if (BROADCAST_ONLY || !can('operate')) return keySyncChain;
+  keySyncChain = keySyncChain.then(syncKeys).catch(err => console.error('key sync failed:', err));
+  return keySyncChain;
+}
+
+document.addEventListener('visibilitychange', () => {
+  if (document.visibilityState === 'visible' && keySyncId) scheduleKeySync();
+});
+
+// probeKeySync notes whether a synced vault exists, which a browser without
+// a wallet can adopt from the setup dialog.
+async function probeKeySync() {
+  keySyncAvailable = false;
+  if (!can('operate')) return;
+  try {
+    const resp = await fetch('/api/keysync');
+    keySyncAvailable = resp.ok;
+  } catch (e) {
+    // Sync stays unavailable.
+  }
+  document.getElementById('setup-synced').style.display = keySyncAvailable ? '' : 'none';
+}
+
+// syncedToRecord converts a synced key to an IndexedDB record, keeping id
+// when it replaces an existing one.
+function syncedToRecord(k, id) {
+  const rec = {
+    label: k.label,
+    address: k.address,
+    encrypted: Array.from(base64ToBytes(k.encrypted)),
+    iv: Array.from(base64ToBytes(k.iv)),
+    createdAt: Date.parse(k.created_at) || Date.now(),
+    updatedAt: Date.parse(k.updated_at) || Date.now(),
+    syncVersion: k.version
+  };
+  if (k.deleted_at) rec.deletedAt = Date.parse(k.deleted_at);
+  if (id !== undefined) rec.id = id;
+  return rec;
+}
+
+function recordToSynced(rec) {
+  return {
+    address: rec.address,
+    label: rec.label,
+    encrypted: bytesToBase64(new Uint8Array(rec.encrypted)),
+    iv: bytesToBase64(new Uint8Array(rec.iv)),
+    created_at: new Date(rec.createdAt || Date.now()).toISOString(),
+    deleted_at: rec.deletedAt ? new Date(rec.deletedAt).toISOString() : null
+  };
+}
+
+async function syncKeys() {
+  const cred = await getCredential();
+  if (!cred || !cred.syncId) return;
+  const resp = await fetch('/api/keysync');
+  if (resp.status === 404 || resp.status === 403) {
+    // Turned off from another browser; this one keeps its keys.
+    delete cred.syncId;
+    await saveCredential(cred);
+    keySyncId = '';
+    return;
+  }
+  const vault = await resp.json();
+  if (!resp.ok) throw new Error(vault.error || 'HTTP ' + resp.status);
+  if (vault.id !== cred.syncId) {
+    // Another browser replaced the synced vault; this one can join it.
+    delete cred.syncId;
+    await saveCredential(cred);
+    keySyncId = '';
+    keySyncAvailable = true;
+    return;
+  }
+  if (vault.credential_version !== (cred.syncCredentialVersion || 0)) {
+    // Another browser added or removed a password or passkey.
+    const next = localCredential(vault, cred.createdAt);
+    await saveCredential(next);
+    credMethod = vaultMethod(next);
+    renderWalletBar();
+  }
+
+  const local = await getEncryptedKeys();
+  const byAddress = {};
+  for (const rec of local) byAddress[rec.address.toLowerCase()] = rec;
+  const remote = {};
+  let changed = false;
+  for (const k of vault.keys) {
+    const addr = k.address.toLowerCase();
+    remote[addr] = k;
+    const rec = byAddress[addr];
+    if (rec && (rec.dirty || rec.syncVersion === k.version)) continue;
+    await saveEncryptedKey(syncedToRecord(k, rec && rec.id), true);
+    changed = true;
+  }
+  for (const rec of local) {
+    const k = remote[rec.address.toLowerCase()];
+    if (!k && rec.syncVersion && !rec.dirty) {
+      // Purged in another browser.
+      await deleteEncryptedKey(rec.id);
+      changed = true;
+    } else if (rec.dirty || (!k && !rec.syncVersion)) {
+      if (await pushKey(rec, cred.syncId, k)) changed = true;
+    }
+  }
+  if (changed) await reloadKeys();
+}
+
+// pushKey sends a record changed here. It returns true when the server's
+// copy was newer and replaced the record instead.
+async function pushKey(rec, vaultId, server) {
+  let base = rec.syncVersion || (server ? server.version : 0);
+  for (let attempt = 0; attempt < 3; attempt++) {
+    const resp = await fetch('/api/keysync/keys/' + encodeURIComponent(rec.address), {
+      method: 'PUT',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify(Object.assign(recordToSynced(rec), { vault: vaultId, base_version: base }))
+    });
+    const data = await resp.json();
+    if (resp.ok) {
+      rec.syncVersion = data.version;
+      delete rec.dirty;
+      await saveEncryptedKey(rec, true);
+      return false;
+    }
+    if (resp.status !== 409) throw new Error(data.error || 'HTTP ' + resp.status);
+    if (!data.key) {
+      if (base === 0) throw new Error(data.error);
+      base = 0; // purged elsewhere: add it back
+      continue;
+    }
+    if ((rec.updatedAt || 0) >= Date.parse(data.key.updated_at)) {
+      base = data.key.version;
+      continue;
+    }
+    await saveEncryptedKey(syncedToRecord(data.key, rec.id), true);
+    return true;
+  }
+  throw new Error('key ' + rec.address + ' keeps changing; sync again later');
+}
+
+// reloadKeys shows keys a sync added, changed, or removed.
+async function reloadKeys() {
+  const keys = await getEncryptedKeys();
+  storedKeyCount = keys.filter(k => !k.deletedAt).length;
+  if (walletState === 'unlocked' && aesKey) {
+    const active = decryptedKeys[activeKeyIndex] && decryptedKeys[activeKeyIndex].address;
+    await decryptAllKeys();
+    const i = decryptedKeys.findIndex(k => k.address === active);
+    if (i >= 0) activeKeyIndex = i;
+  }
+  renderWalletBar();
+  refresh();
+}
+
+// purgeKey deletes a key for good, here and, when it is synced, on the
+// server, so other browsers drop it too.
+async function purgeKey(id) {
+  const rec = (await getEncryptedKeys()).find(k => k.id === id);
+  const cred = await getCredential();
+  if (rec && rec.syncVersion && cred && cred.syncId) {
+    const resp = await fetch('/api/keysync/keys/' + encodeURIComponent(rec.address) +
+      '?vault=' + cred.syncId + '&base_version=' + rec.syncVersion, { method: 'DELETE' });
+    if (!resp.ok && resp.status !== 404) {
+      const data = await resp.json();
+      scheduleKeySync();
+      throw new Error(data.error || 'HTTP ' + resp.status);
+    }
+  }
+  await deleteEncryptedKey(id);
+}
+
+// syncedCredential is the part of the credential record other browsers
+// need to derive the vault key.
+function syncedCredential(cred) {
+  const credential = {};
+  for (const f of ['authenticators', 'method', 'pbkdf2Salt', 'credentialId', 'rpId', 'transports', 'check']) {
+    if (cred[f] !== undefined) credential[f] = cred[f];
+  }
+  return credential;
+}
+
+// localCredential is the credential record for the synced vault.
+function localCredential(vault, createdAt) {
+  return Object.assign({}, vault.credential, {
+    id: 'primary',
+    syncId: vault.id,
+    syncCredentialVersion: vault.credential_version,
+    createdAt: createdAt || Date.now()
+  });
+}
+
+// replaceVault swaps the credential and every key record in one
+// transaction, so a failure can't leave keys encrypted under two keys.
+async function replaceVault(cred, records) {
+  const db = await openVaultDB();
+  return new Promise((resolve, reject) => {
+    const tx = db.transaction(['credentials', 'keys'], 'readwrite');
+    tx.objectStore('credentials').put(cred);
+    const keys = tx.objectStore('keys');
+    keys.clear();
+    for (const rec of records) keys.put(rec);
+    tx.oncomplete = () => resolve();
+    tx.onerror = () => reject(tx.error);
+  });
+}
+
+async function showKeySyncModal() {
+  document.getElementById('keysync-error').style.display = 'none';
+  document.getElementById('keysync-password').value = '';
+  await renderKeySync();
+  showModal('keysync-modal');
+}
+
+async function renderKeySync() {
+  const statusEl = document.getElementById('keysync-status');
+  const actionsEl = document.getElementById('keysync-actions');
+  const joinEl = document.getElementById('keysync-join');
+  let vault = null;
+  try {
+    const resp = await fetch('/api/keysync');
+    if (resp.ok) vault = await resp.json();
+  } catch (e) {
+    // Shown as off.
+  }
+  joinEl.style.display = 'none';
+  let actions = '<button class="btn" onclick="hideModal(\'keysync-modal\')">Close</button>';
+  if (vault && vault.id === keySyncId) {
+    const n = vault.keys.filter(k => !k.deleted_at).length;
+    statusEl.textContent = 'Sync is on: ' + n + ' key' + (n === 1 ? ' is' : 's are') + ' synced. Turning it off deletes the server’s copy; every browser keeps its own.';
+    actions += '<button class="btn" onclick="scheduleKeySync().then(renderKeySync)">Sync Now</button>' +
+      '<button class="btn btn-danger" onclick="disableKeySync()">Turn Off</button>';
+  } else if (vault) {
+    statusEl.textContent = 'Another browser’s wallet is synced. Join it to add this browser’s keys to it and unlock with its passwords and passkeys from now on, or replace it with this browser’s wallet.';
+    if (vaultAuthenticators(vault.credential).some(a => a.method === 'password')) joinEl.style.display = 'block';
+    actions += '<button class="btn btn-danger" onclick="enableKeySync(true)">Replace</button>' +
+      '<button class="btn btn-primary" onclick="joinSyncedVault()">Join</button>';
+  } else {
+    statusEl.textContent = 'Sync is off: this browser’s keys are only stored here.';
+    actions += '<button class="btn btn-primary" onclick="enableKeySync(false)">Turn On</button>';
+  }
+  actionsEl.innerHTML = actions;
+}
+
+function keySyncFailed(err) {
+  const errEl = document.getElementById('keysync-error');
+  errEl.textContent = 'Failed: ' + err.message;
+  errEl.style.display = 'block';
+}
+
+// enableKeySync uploads this browser's vault. The credential gains a check
+// value so browsers that join can tell a wrong password.
+async function enableKeySync(replace) {
+  document.getElementById('keysync-error').style.display = 'none';
+  if (replace && !confirm('Replace the synced wallet with this browser’s? Browsers using it keep their keys but stop syncing until they join again.')) return;
+  try {
+    if (!aesKey) throw new Error('Unlock the wallet first.');
+    const cred = await getCredential();
+    if (!cred.check) cred.check = await vaultCheck(aesKey);
+    const records = await getEncryptedKeys();
+    await uploadVault(cred, records, replace);
+    await replaceVault(cred, records);
+    keySyncId = cred.syncId;
+    await renderKeySync();
+  } catch (err) {
+    keySyncFailed(err);
+  }
+}
+
+// uploadVault makes cred and records the synced vault, under a new ID, and
+// marks them synced. The caller saves them.
+async function uploadVault(cred, records, replace) {
+  const id = bytesToHex(crypto.getRandomValues(new Uint8Array(16)));
+  const resp = await fetch('/api/keysync' + (replace ? '?replace=true' : ''), {
+    method: 'PUT',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ id: id, credential: syncedCredential(cred), keys: records.map(recordToSynced) })
+  });
+  const vault = await resp.json();
+  if (!resp.ok) throw new Error(vault.error || 'HTTP ' + resp.status);
+  cred.syncId = id;
+  cred.syncCredentialVersion = vault.credential_version;
+  for (const rec of records) {
+    rec.syncVersion = vault.version;
+    delete rec.dirty;
+  }
+}
+
+async function disableKeySync() {
+  if (!confirm('Turn sync off and delete the server’s copy of the keys?')) return;
+  try {
+    const resp = await fetch('/api/keysync', { method: 'DELETE' });
+    const data = await resp.json();
+    if (!resp.ok && resp.status !== 404) throw new Error(data.error || 'HTTP ' + resp.status);
+    const cred = await getCredential();
+    delete cred.syncId;
+    await saveCredential(cred);
+    keySyncId = '';
+    await renderKeySync();
+  } catch (err) {
+    keySyncFailed(err);
+  }
+}
+
+// syncedVaultKey opens the synced vault's key with one of its passwords,
+// or one of its passkeys when no password was entered.
+async function syncedVaultKey(credential, password) {
+  const { key, raw } = await openVault(credential, password || undefined);
+  raw.fill(0);
+  return key;
+}
+
+// joinSyncedVault moves this browser onto the synced vault: its keys are
+// re-encrypted under the synced vault's key and pushed, and it unlocks with
+// the synced password or passkey from then on.
+async function joinSyncedVault() {
+  document.getElementById('keysync-error').style.display = 'none';
+  try {
+    if (!aesKey) throw new Error('Unlock the wallet first.');
+    const resp = await fetch('/api/keysync');
+    const vault = await resp.json();
+    if (!resp.ok) throw new Error(vault.error || 'HTTP ' + resp.status);
+    const key = await syncedVaultKey(vault.credential, document.getElementById('keysync-password').value);
+    const records = [];
+    for (const rec of await getEncryptedKeys()) {
+      const plaintext = await decryptPrivateKey(new Uint8Array(rec.encrypted), new Uint8Array(rec.iv), aesKey);
+      const { encrypted, iv } = await encryptPrivateKey(plaintext, key);
+      rec.encrypted = Array.from(encrypted);
+      rec.iv = Array.from(iv);
+      rec.dirty = true;
+      rec.updatedAt = Date.now();
+      delete rec.syncVersion;
+      records.push(rec);
+    }
+    const cred = localCredential(vault);
+    await replaceVault(cred, records);
+    aesKey = key;
+    credMethod = vaultMethod(cred);
+    keySyncId = vault.id;
+    await scheduleKeySync();
+    await reloadKeys();
+    await renderKeySync();
+  } catch (err) {
+    keySyncFailed(err);
+  }
+}
+
+// adoptSyncedVault sets this browser up with the synced vault, for a
+// browser that has no wallet yet, and unlocks it.
+async function adoptSyncedVault() {
+  const errEl = document.getElementById('setup-error');
+  errEl.style.display = 'none';
+  try {
+    const resp = await fetch('/api/keysync');
+    const vault = await resp.json();
+    if (!resp.ok) throw new Error(vault.error || 'HTTP ' + resp.status);
+    const cred = localCredential(vault);
+    await replaceVault(cred, vault.keys.map(k => syncedToRecord(k)));
+    credMethod = vaultMethod(cred);
+    keySyncId = vault.id;
+    walletState = 'locked';
+    storedKeyCount = vault.keys.filter(k => !k.deleted_at).length;
+    hideModal('setup-modal');
+    renderWalletBar();
+    unlockWallet();
+  } catch (err) {
+    errEl.textContent = 'Failed: ' + err.message;
+    errEl.style.display = 'block';
+  }
+}
+
+// ── Backups ────────────────────────────────────────────
+// A backup file is sealed in the browser, in the format internal/backup
+// reads: the server only ever sees its endpoints, accounts, bookmarks, and
+// preferences, never the passphrase or the keys.
+const BACKUP_FORMAT = 'primal-wallet-backup';
+const BACKUP_KDF = 'PBKDF2-SHA256';
+const BACKUP_MAX_ITERATIONS = 10000000;
+
+function bytesToBase64(bytes) {
+  let s = '';
+  for (const b of bytes) s += String.fromCharCode(b);
+  return btoa(s);
+}
+
+function base64ToBytes(b64) {
+  return Uint8Array.from(atob(b64), c => c.charCodeAt(0));
+}
+
+function showBackupModal() {
+  document.getElementById('backup-error').style.display = 'none';
+  document.getElementById('backup-result').style.display = 'none';
+  for (const id of ['backup-passphrase', 'backup-passphrase-confirm', 'restore-passphrase', 'restore-file']) {
+    document.getElementById(id).value = '';
+  }
+  const note = document.getElementById('backup-keys-note');
+  if (aesKey) {
+    note.textContent = 'The backup will include ' + decryptedKeys.length + ' browser key' + (decryptedKeys.length === 1 ? '' : 's') + '.';
+  } else if (storedKeyCount > 0) {
+    note.textContent = 'The wallet is locked: unlock it to include its ' + storedKeyCount + ' browser key' + (storedKeyCount === 1 ? '' : 's') + '.';
+  } else {
+    note.textContent = 'This browser has no keys to include.';
+  }
+  showModal('backup-modal');
+}
+
+async function exportBackup() {
+  const errEl = document.getElementById('backup-error');
+  const resultEl = document.getElementById('backup-result');
+  const btn = document.getElementById('btn-backup');
+  errEl.style.display = 'none';
+  resultEl.style.display = 'none';
+  const passphrase = document.getElementById('backup-passphrase').value;
+  if (passphrase.length < 8) {
+    errEl.textContent = 'The passphrase must be at least 8 characters.';
+    errEl.style.display = 'block';
+    return;
+  }
+  if (passphrase !== document.getElementById('backup-passphrase-confirm').value) {
+    errEl.textContent = 'The passphrases do not match.';
+    errEl.style.display = 'block';
+    return;
+  }
+  if (!aesKey && storedKeyCount > 0 && !confirm('The wallet is locked, so the backup will not include its browser keys. Export anyway?')) return;
+
+  btn.disabled = true;
+  btn.textContent = 'Encrypting...';
+  try {
+    const resp = await fetch('/api/backup');
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'HTTP ' + resp.status);
+    data.keys = [];
+    if (aesKey) {
+      const created = {};
+      for (const rec of await getEncryptedKeys()) created[rec.id] = rec.createdAt;
+      data.keys = decryptedKeys.map(k => ({
+        label: k.label,
+        address: k.address,
+        private_key: k.key,
+        created_at: new Date(created[k.id] || Date.now()).toISOString()
+      }));
+    }
+
+    const salt = crypto.getRandomValues(new Uint8Array(16));
+    const iv = crypto.getRandomValues(new Uint8Array(12));
+    const key = await deriveAESKeyFromPassword(passphrase, salt, PBKDF2_ITERATIONS);
+    const ciphertext = await crypto.subtle.encrypt(
+      { name: 'AES-GCM', iv }, key, new TextEncoder().encode(JSON.stringify(data))
+    );
+    const file = {
+      format: BACKUP_FORMAT,
+      version: 1,
+      created_at: data.created_at,
+      kdf: { name: BACKUP_KDF, iterations: PBKDF2_ITERATIONS, salt: bytesToBase64(salt) },
+      iv: bytesToBase64(iv),
+      ciphertext: bytesToBase64(new Uint8Array(ciphertext))
+    };
+    const url = URL.createObjectURL(new Blob([JSON.stringify(file, null, 2) + '\n'], { type: 'application/json' }));
+    const a = document.createElement('a');
+    a.href = url;
+    a.download = 'wallet-backup-' + data.created_at.slice(0, 10) + '.json';
+    a.click();
+    URL.revokeObjectURL(url);
+
+    document.getElementById('backup-passphrase').value = '';
+    document.getElementById('backup-passphrase-confirm').value = '';
+    resultEl.textContent = 'Exported ' + [
+      data.keys.length + ' keys',
+      data.endpoints.length + ' endpoints',
+      data.accounts.length + ' accounts',
+      data.bookmarks.length + ' bookmarks'
+    ].join(', ') + '. Without the passphrase the file cannot be restored.';
+    resultEl.style.display = 'block';
+  } catch (err) {
+    errEl.textContent = 'Failed: ' + err.message;
+    errEl.style.display = 'block';
+  } finally {
+    btn.disabled = false;
+    btn.textContent = 'Export';
+  }
+}
+
+// openBackup decrypts a backup file's contents.
+async function openBackup(text, passphrase) {
+  let file;
+  try {
+    file = JSON.parse(text);
+  } catch (e) {
+    file = null;
+  }
+  if (!file || file.format !== BACKUP_FORMAT) throw new Error('Not a wallet backup.');
+  if (file.version !== 1) throw new Error('Unsupported backup version ' + file.version + '.');
+  const kdf = file.kdf || {};
+  if (kdf.name !== BACKUP_KDF || !(kdf.iterations >= 1 && kdf.iterations <= BACKUP_MAX_ITERATIONS)) {
+    throw new Error('Unsupported backup key derivation.');
+  }
+  const key = await deriveAESKeyFromPassword(passphrase, base64ToBytes(kdf.salt), kdf.iterations);
+  try {
+    const plaintext = await crypto.subtle.decrypt(
+      { name: 'AES-GCM', iv: base64ToBytes(file.iv) }, key, base64ToBytes(file.ciphertext)
+    );
+    return JSON.parse(new TextDecoder().decode(plaintext));
+  } catch (e) {
+    throw new Error('Wrong passphrase or corrupted backup.');
+  }
+}
+
+// restoreBackupKeys re-encrypts a backup's keys under this browser's vault
+// key. Keys are matched by address; one in the recycle bin is replaced.
+async function restoreBackupKeys(keys, replace) {
+  const report = { added: 0, replaced: 0, skipped: 0, failed: [] };
+  if (!keys.length) return report;
+  if (!aesKey) throw new Error('The backup has browser keys: set up or unlock the wallet first.');
+  await ensureEthers();
+  const trashed = (await getEncryptedKeys()).filter(k => k.deletedAt);
+  for (const k of keys) {
+    try {
+      let key = String(k.private_key || '');
+      if (!key.startsWith('0x')) key = '0x' + key;
+      if (!/^0x[0-9a-fA-F]{64}$/.test(key)) throw new Error('invalid private key');
+      const address = new ethers.Wallet(key).address;
+      if (k.address && k.address.toLowerCase() !== address.toLowerCase()) throw new Error('key does not match its address');
+      const label = (k.label || '').trim() || nextKeyLabel();
+      const existing = decryptedKeys.find(d => d.address.toLowerCase() === address.toLowerCase());
+      if (existing && !replace) {
+        report.skipped++;
+        continue;
+      }
+      const { encrypted, iv } = await encryptPrivateKey(key, aesKey);
+      const record = {
+        label: label,
+        address: address,
+        encrypted: Array.from(encrypted),
+        iv: Array.from(iv),
+        createdAt: Date.parse(k.created_at) || Date.now()
+      };
+      const previous = existing || trashed.find(t => t.address.toLowerCase() === address.toLowerCase());
+      if (previous) record.id = previous.id;
+      await saveEncryptedKey(record);
+      if (existing) {
+        existing.label = label;
+        existing.key = key;
+        report.replaced++;
+        continue;
+      }
+      let id = record.id;
+      if (id === undefined) {
+        const allKeys = await getEncryptedKeys();
+        id = allKeys[allKeys.length - 1].id;
+      }
+      decryptedKeys.push({ id: id, label: label, address: address, key: key });
+      report.added++;
+    } catch (err) {
+      report.failed.push((k.address || k.label || 'key') + ': ' + err.message);
+    }
+  }
+  storedKeyCount = decryptedKeys.length;
+  return report;
+}
+
+async function restoreBackup() {
+  const errEl = document.getElementById('backup-error');
+  const resultEl = document.getElementById('backup-result');
+  const btn = document.getElementById('btn-restore');
+  errEl.style.display = 'none';
+  resultEl.style.display = 'none';
+  const input = document.getElementById('restore-file');
+  if (!input.files.length) {
+    errEl.textContent = 'Choose a backup file.';
+    errEl.style.display = 'block';
+    return;
+  }
+  const conflict = document.getElementById('restore-conflict').value;
+
+  btn.disabled = true;
+  btn.textContent = 'Restoring...';
+  try {
+    const data = await openBackup(await input.files[0].text(), document.getElementById('restore-passphrase').value);
+    const reports = { keys: await restoreBackupKeys(data.keys || [], conflict === 'replace') };
+    data.keys = [];
+    const resp = await fetch('/api/restore?conflict=' + conflict, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify(data)
+    });
+    const result = await resp.json();
+    if (!resp.ok) throw new Error(result.error || 'HTTP ' + resp.status);
+    Object.assign(reports, result);
+
+    const lines = [];
+    const failures = [];
+    for (const [name, r] of Object.entries(reports)) {
+      const parts = [];
+      if (r.added) parts.push(r.added + ' added');
+      if (r.replaced) parts.push(r.replaced + ' replaced');
+      if (r.skipped) parts.push(r.skipped + ' kept');
+      if (r.failed && r.failed.length) {
+        parts.push(r.failed.length + ' failed');
+        failures.push(...r.failed);
+      }
+      if (parts.length) lines.push(name.charAt(0).toUpperCase() + name.slice(1) + ': ' + parts.join(', '));
+    }
+    resultEl.textContent = lines.length ? lines.join('. ') + '.' : 'The backup was empty.';
+    resultEl.style.display = 'block';
+    if (failures.length) {
+      errEl.textContent = failures.join('; ');
+      errEl.style.display = 'block';
+    }
+    document.getElementById('restore-passphrase').value = '';
+    await loadPreferences();
+    renderWalletBar();
+    refresh();
+  } catch (err) {
+    errEl.textContent = 'Failed: ' + err.message;
+    errEl.style.display = 'block';
+  } finally {
+    btn.disabled = false;
+    btn.textContent = 'Restore';
+  }
+}
+
+// ── Preferences ────────────────────────────────────────
+// Preferences live on the server so they follow the user between browsers.
+// A label template left in localStorage by older versions moves there once.
+async function loadPreferences() {
+  try {
+    const resp = await fetch('/api/preferences');
+    if (resp.ok) prefs = await resp.json();
+  } catch (err) {
+    console.error('preferences load failed:', err);
+  }
+  const legacy = localStorage.getItem(LABEL_TEMPLATE_KEY);
+  if (legacy !== null) {
+    if (!prefs.label_template) await savePreference('label_template', legacy);
+    localStorage.removeItem(LABEL_TEMPLATE_KEY);
+  }
+}
+
+async function savePreference(key, value) {
+  prefs[key] = value;
+  try {
+    const resp = await fetch('/api/preferences', {
+      method: 'PUT',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ [key]: value })
+    });
+    if (resp.ok) prefs = await resp.json();
+  } catch (err) {
+    console.error('preferences save failed:', err);
+  }
+}
+
+// ── IndexedDB Helpers ──────────────────────────────────
+function openVaultDB() {
+  return new Promise((resolve, reject) => {
+    const req = indexedDB.open(DB_NAME, DB_VERSION);
+    req.onupgradeneeded = (e) => {
+      const db = e.target.result;
+      if (!db.objectStoreNames.contains('credentials')) {
+        db.createObjectStore('credentials', { keyPath: 'id' });
+      }
+      if (!db.objectStoreNames.contains('keys')) {
+        db.createObjectStore('keys', { keyPath: 'id', autoIncrement: true });
+      }
+    };
+    req.onsuccess = () => resolve(req.result);
+    req.onerror = () => reject(req.error);
+  });
+}
 
 async function saveCredential(cred) {
   const db = await openVaultDB();
   return new Promise((resolve, reject) => {
-    const tx = db.transaction('credentials', 'readwrite');
-    tx.objectStore('credentials').put(cred);
-    tx.oncomplete = () => resolve();
+    const tx = db.transaction('credentials', 'readwrite');
+    tx.objectStore('credentials').put(cred);
+    tx.oncomplete = () => resolve();
+    tx.onerror = () => reject(tx.error);
+  });
+}
+
+async function getCredential() {
+  const db = await openVaultDB();
+  return new Promise((resolve, reject) => {
+    const tx = db.transaction('credentials', 'readonly');
+    const req = tx.objectStore('credentials').getAll();
+    req.onsuccess = () => resolve(req.result.length > 0 ? req.result[0] : null);
+    req.onerror = () => reject(req.error);
+  });
+}
+
+// saveEncryptedKey stores a key record. Changes made in this browser are
+// marked dirty for syncKeys to push; synced records come from the server.
+async function saveEncryptedKey(record, synced) {
+  if (!synced) {
+    record.dirty = true;
+    record.updatedAt = Date.now();
+  }
+  const db = await openVaultDB();
+  return new Promise((resolve, reject) => {
+    const tx = db.transaction('keys', 'readwrite');
+    tx.objectStore('keys').put(record);
+    tx.oncomplete = () => {
+      if (!synced) scheduleKeySync();
+      resolve();
+    };
+    tx.onerror = () => reject(tx.error);
+  });
+}
+
+async function getEncryptedKeys() {
+  const db = await openVaultDB();
+  return new Promise((resolve, reject) => {
+    const tx = db.transaction('keys', 'readonly');
+    const req = tx.objectStore('keys').getAll();
+    req.onsuccess = () => resolve(req.result);
+    req.onerror = () => reject(req.error);
+  });
+}
+
+async function deleteEncryptedKey(id) {
+  const db = await openVaultDB();
+  return new Promise((resolve, reject) => {
+    const tx = db.transaction('keys', 'readwrite');
+    tx.objectStore('keys').delete(id);
+    tx.oncomplete = () => resolve();
+    tx.onerror = () => reject(tx.error);
+  });
+}
+
+// ── Crypto Helpers ─────────────────────────────────────
+async function deriveAESKeyFromPRF(prfOutput, extractable = false) {
+  const keyMaterial = await crypto.subtle.importKey(
+    'raw', prfOutput, 'HKDF', false, ['deriveKey']
+  );
+  return crypto.subtle.deriveKey(
+    { name: 'HKDF', salt: PRF_SALT, info: HKDF_INFO, hash: 'SHA-256' },
+    keyMaterial,
+    { name: 'AES-GCM', length: 256 },
+    extractable,
+    ['encrypt', 'decrypt']
+  );
+}
+
+async function deriveAESKeyFromPassword(password, salt, iterations = PBKDF2_ITERATIONS, extractable = false) {
+  const enc = new TextEncoder();
+  const keyMaterial = await crypto.subtle.importKey(
+    'raw', enc.encode(password), 'PBKDF2', false, ['deriveKey']
+  );
+  return crypto.subtle.deriveKey(
+    { name: 'PBKDF2', salt: salt, iterations: iterations, hash: 'SHA-256' },
+    keyMaterial,
+    { name: 'AES-GCM', length: 256 },
+    extractable,
+    ['encrypt', 'decrypt']
+  );
+}
+
+async function encryptPrivateKey(plaintext, key) {
+  const iv = crypto.getRandomValues(new Uint8Array(12));
+  const encoded = new TextEncoder().encode(plaintext);
+  const encrypted = await crypto.subtle.encrypt(
+    { name: 'AES-GCM', iv }, key, encoded
+  );
+  return { encrypted: new Uint8Array(encrypted), iv };
+}
+
+async function decryptPrivateKey(encrypted, iv, key) {
+  const decrypted = await crypto.subtle.decrypt(
+    { name: 'AES-GCM', iv }, key, encrypted
+  );
+  return new TextDecoder().decode(decrypted);
+}
+
+// ── Biometric Setup ────────────────────────────────────
+async function setupBiometric() {
+  const errEl = document.getElementById('setup-error');
+  errEl.style.display = 'none';
+
+  try {
+    const passkey = await createPasskey([]);
+
+    // PRF works — wrap a new vault key for the passkey and store it.
+    const raw = crypto.getRandomValues(new Uint8Array(32));
+    const auth = await passkeyAuthenticator(passkeyName(passkey.transports), passkey, raw);
+    aesKey = await importVaultKey(raw);
+    raw.fill(0);
+
+    await saveCredential({
+      id: 'primary',
+      authenticators: [auth],
+      check: await vaultCheck(aesKey),
+      createdAt: Date.now()
+    });
+
+    credMethod = 'prf';
+    walletState = 'unlocked';
+    decryptedKeys = [];
+    storedKeyCount = 0;
+    renderWalletBar();
+    hideModal('setup-modal');
+    showModal('addkey-modal');
+
+  } catch (err) {
+    if (err.name === 'NotAllowedError') {
+      errEl.textContent = 'Biometric prompt was cancelled or timed out.';
+    } else {
+      errEl.textContent = err.message;
+    }
+    errEl.style.display = 'block';
+  }
+}
+
+// createPasskey registers a passkey with the PRF extension and returns its
+// credential ID, transports, and PRF output. exclude lists the wallet's
+// passkeys, which the authenticator must not register again.
+async function createPasskey(exclude) {
+  if (!window.PublicKeyCredential) {
+    throw new Error('WebAuthn is not available in this browser. Use a password instead.');
+  }
+
+  // 1. Create credential with PRF extension.
+  const userId = crypto.getRandomValues(new Uint8Array(32));
+  const credential = await navigator.credentials.create({
+    publicKey: {
+      rp: { name: 'Wallet', id: location.hostname },
+      user: {
+        id: userId,
+        name: 'wallet-user',
+        displayName: 'Wallet User'
+      },
+      challenge: crypto.getRandomValues(new Uint8Array(32)),
+      pubKeyCredParams: [
+        { type: 'public-key', alg: -7 },
+        { type: 'public-key', alg: -257 }
+      ],
+      authenticatorSelection: {
+        residentKey: 'preferred',
+        userVerification: 'required'
+      },
+      excludeCredentials: exclude.map(a => ({
+        type: 'public-key',
+        id: new Uint8Array(a.credentialId).buffer,
+        transports: a.transports || []
+      })),
+      extensions: { prf: {} }
+    }
+  });
+
+  // 2. Try PRF eval regardless of prf.enabled — some browsers
+  //    (Safari) report enabled:false but support PRF at assertion time.
+  const transports = credential.response.getTransports ? credential.response.getTransports() : [];
+
+  const assertion = await navigator.credentials.get({
+    publicKey: {
+      challenge: crypto.getRandomValues(new Uint8Array(32)),
+      rpId: location.hostname,
+      allowCredentials: [{
+        type: 'public-key',
+        id: credential.rawId,
+        transports: transports
+      }],
+      userVerification: 'required',
+      extensions: {
+        prf: { eval: { first: PRF_SALT } }
+      }
+    }
+  });
+
+  const exts = assertion.getClientExtensionResults();
+  if (!exts.prf || !exts.prf.results || !exts.prf.results.first) {
+    throw new Error('Your authenticator does not support PRF encryption. Use a password instead.');
+  }
+  return {
+    credentialId: Array.from(new Uint8Array(credential.rawId)),
+    transports: transports,
+    prf: exts.prf.results.first
+  };
+}
+
+// ── Password Setup ─────────────────────────────────────
+function showPasswordSetup() {
+  hideModal('setup-modal');
+  document.getElementById('setup-password').value = '';
+  document.getElementById('setup-password-confirm').value = '';
+  document.getElementById('password-setup-error').style.display = 'none';
+  showModal('password-setup-modal');
+}
+
+async function setupWithPassword() {
+  const pw = document.getElementById('setup-password').value;
+  const confirm = document.getElementById('setup-password-confirm').value;
+  const errEl = document.getElementById('password-setup-error');
+  const btn = document.getElementById('btn-password-setup');
+  errEl.style.display = 'none';
+
+  const problem = passwordProblem(pw, confirm);
+  if (problem) {
+    errEl.textContent = problem;
+    errEl.style.display = 'block';
+    return;
+  }
+
+  btn.disabled = true;
+  btn.textContent = 'Deriving key...';
+
+  try {
+    const raw = crypto.getRandomValues(new Uint8Array(32));
+    const auth = await passwordAuthenticator('Password', pw, raw);
+    aesKey = await importVaultKey(raw);
+    raw.fill(0);
+
+    await saveCredential({
+      id: 'primary',
+      authenticators: [auth],
+      check: await vaultCheck(aesKey),
+      createdAt: Date.now()
+    });
+
+    credMethod = 'password';
+    walletState = 'unlocked';
+    decryptedKeys = [];
+    storedKeyCount = 0;
+    renderWalletBar();
+    hideModal('password-setup-modal');
+    showModal('addkey-modal');
+
+  } catch (err) {
+    errEl.textContent = 'Setup failed: ' + err.message;
+    errEl.style.display = 'block';
+  } finally {
+    btn.disabled = false;
+    btn.textContent = 'Set Password';
+  }
+}
+
+// passwordProblem explains what is wrong with a new password, or returns ''.
+function passwordProblem(pw, confirm) {
+  if (!pw) return 'Please enter a password.';
+  if (pw.length < 8) return 'Password must be at least 8 characters.';
+  if (pw !== confirm) return 'Passwords do not match.';
+  return '';
+}
+
+// ── Unlock ─────────────────────────────────────────────
+async function unlockWallet() {
+  if (credMethod === 'password') {
+    showPasswordUnlock();
+    return;
+  }
+  // PRF unlock.
+  const btn = document.querySelector('#wallet-actions .btn-primary');
+  if (btn) { btn.disabled = true; btn.textContent = 'Unlocking...'; }
+
+  try {
+    const stored = await getCredential();
+    if (!stored) throw new Error('No credential found.');
+
+    const { key, raw } = await openVault(stored);
+    raw.fill(0);
+    aesKey = key;
+    await decryptAllKeys();
+    walletState = 'unlocked';
+    renderWalletBar();
+    refresh();
+
+  } catch (err) {
+    if (err.name !== 'NotAllowedError') {
+      console.error('Unlock failed:', err);
+    }
+    renderWalletBar();
+    // A wallet with a password too falls back to it.
+    if (credMethod === 'both') showPasswordUnlock();
+  }
+}
+
+function showPasswordUnlock() {
+  document.getElementById('unlock-password').value = '';
+  document.getElementById('password-unlock-error').style.display = 'none';
+  showModal('password-unlock-modal');
+}
+
+async function unlockWithPassword() {
+  const pw = document.getElementById('unlock-password').value;
+  const errEl = document.getElementById('password-unlock-error');
+  const btn = document.getElementById('btn-password-unlock');
+  errEl.style.display = 'none';
+
+  if (!pw) {
+    errEl.textContent = 'Please enter your password.';
+    errEl.style.display = 'block';
+    return;
+  }
+
+  btn.disabled = true;
+  btn.textContent = 'Unlocking...';
+
+  try {
+    const stored = await getCredential();
+    if (!stored) throw new Error('No credential found.');
+
+    const { key, raw } = await openVault(stored, pw);
+    raw.fill(0);
+    aesKey = key;
+    // A wallet set up without a check value only finds out here.
+    await decryptAllKeys();
+    walletState = 'unlocked';
+    renderWalletBar();
+    hideModal('password-unlock-modal');
+    refresh();
+
+  } catch (err) {
+    errEl.textContent = 'Wrong password or decryption failed.';
+    errEl.style.display = 'block';
+    aesKey = null;
+  } finally {
+    btn.disabled = false;
+    btn.textContent = 'Unlock';
+  }
+}
+
+async function decryptAllKeys() {
+  const encryptedKeys = await getEncryptedKeys();
+  decryptedKeys = [];
+  for (const rec of encryptedKeys) {
+    if (rec.deletedAt) continue;
+    const plaintext = await decryptPrivateKey(
+      new Uint8Array(rec.encrypted),
+      new Uint8Array(rec.iv),
+      aesKey
+    );
+    decryptedKeys.push({ id: rec.id, label: rec.label, address: rec.address, key: plaintext });
+  }
+  activeKeyIndex = 0;
+  storedKeyCount = decryptedKeys.length;
+}
+
+// ── Authenticators ─────────────────────────────────────
+// Keys are encrypted under a random vault key. Each authenticator, a passkey
+// or a password, keeps its own copy of the vault key wrapped under the key
+// it derives, so any one of them unlocks the wallet and losing one loses
+// nothing. A wallet set up before there could be several has no list: its
+// passkey or password derives the vault key itself, and keeps doing so as
+// the first entry of the list once another is added.
+
+// vaultAuthenticators returns the credential's passkeys and passwords.
+function vaultAuthenticators(cred) {
+  if (cred.authenticators) return cred.authenticators;
+  const only = {
+    id: 'primary',
+    name: cred.method === 'password' ? 'Password' : 'Passkey',
+    method: cred.method || 'prf',
+    createdAt: cred.createdAt
+  };
+  for (const f of ['credentialId', 'rpId', 'transports', 'pbkdf2Salt']) {
+    if (cred[f] !== undefined) only[f] = cred[f];
+  }
+  return [only];
+}
+
+// vaultMethod reports how the wallet unlocks: 'prf', 'password', or 'both'.
+function vaultMethod(cred) {
+  const methods = new Set(vaultAuthenticators(cred).map(a => a.method));
+  if (methods.size > 1) return 'both';
+  return methods.has('password') ? 'password' : 'prf';
+}
+
+// openVault unlocks the vault with a password, or asks for a passkey when
+// password is undefined, and returns the vault key and its raw bytes. The
+// caller zeroes raw once done with it.
+async function openVault(cred, password) {
+  const auths = vaultAuthenticators(cred);
+  if (password !== undefined) {
+    for (const auth of auths.filter(a => a.method === 'password')) {
+      const kek = await deriveAESKeyFromPassword(password, new Uint8Array(auth.pbkdf2Salt), PBKDF2_ITERATIONS, !auth.wrapped);
+      const opened = await unwrapVaultKey(cred, auth, kek);
+      if (opened) return opened;
+    }
+    throw new Error('Wrong password.');
+  }
+  const { auth, prf } = await assertPasskey(auths.filter(a => a.method === 'prf'));
+  const opened = await unwrapVaultKey(cred, auth, await deriveAESKeyFromPRF(prf, !auth.wrapped));
+  if (!opened) throw new Error('That passkey does not unlock this wallet.');
+  return opened;
+}
+
+// assertPasskey asks for any of the passkeys and returns the one used, with
+// its PRF output.
+async function assertPasskey(passkeys) {
+  if (passkeys.length === 0) throw new Error('This wallet has no passkey.');
+  const assertion = await navigator.credentials.get({
+    publicKey: {
+      challenge: crypto.getRandomValues(new Uint8Array(32)),
+      rpId: passkeys[0].rpId,
+      allowCredentials: passkeys.map(a => ({
+        type: 'public-key',
+        id: new Uint8Array(a.credentialId).buffer,
+        transports: a.transports || []
+      })),
+      userVerification: 'required',
+      extensions: {
+        prf: { eval: { first: PRF_SALT } }
+      }
+    }
+  });
+
+  const exts = assertion.getClientExtensionResults();
+  if (!exts.prf || !exts.prf.results || !exts.prf.results.first) {
+    throw new Error('PRF evaluation failed.');
+  }
+  const used = bytesToHex(new Uint8Array(assertion.rawId));
+  const auth = passkeys.find(a => bytesToHex(a.credentialId) === used);
+  if (!auth) throw new Error('That passkey does not unlock this wallet.');
+  return { auth, prf: exts.prf.results.first };
+}
+
+// unwrapVaultKey opens an authenticator's copy of the vault key with the
+// key the authenticator derived, or returns null if that key is wrong.
+async function unwrapVaultKey(cred, auth, kek) {
+  let raw;
+  try {
+    raw = auth.wrapped
+      ? new Uint8Array(await crypto.subtle.decrypt({ name: 'AES-GCM', iv: new Uint8Array(auth.wrapped.iv) }, kek, new Uint8Array(auth.wrapped.encrypted)))
+      : new Uint8Array(await crypto.subtle.exportKey('raw', kek));
+  } catch (e) {
+    return null;
+  }
+  const key = await importVaultKey(raw);
+  if (!(await checkVaultKey(cred, key))) {
+    raw.fill(0);
+    return null;
+  }
+  return { key, raw };
+}
+
+async function wrapVaultKey(raw, kek) {
+  const iv = crypto.getRandomValues(new Uint8Array(12));
+  const encrypted = await crypto.subtle.encrypt({ name: 'AES-GCM', iv }, kek, raw);
+  return { encrypted: Array.from(new Uint8Array(encrypted)), iv: Array.from(iv) };
+}
+
+function importVaultKey(raw) {
+  return crypto.subtle.importKey('raw', raw, { name: 'AES-GCM' }, false, ['encrypt', 'decrypt']);
+}
+
+async function passkeyAuthenticator(name, passkey, raw) {
+  return {
+    id: bytesToHex(crypto.getRandomValues(new Uint8Array(8))),
+    name: name,
+    method: 'prf',
+    credentialId: passkey.credentialId,
+    rpId: location.hostname,
+    transports: passkey.transports,
+    wrapped: await wrapVaultKey(raw, await deriveAESKeyFromPRF(passkey.prf)),
+    createdAt: Date.now()
+  };
+}
+
+async function passwordAuthenticator(name, password, raw) {
+  const salt = crypto.getRandomValues(new Uint8Array(32));
+  return {
+    id: bytesToHex(crypto.getRandomValues(new Uint8Array(8))),
+    name: name,
+    method: 'password',
+    pbkdf2Salt: Array.from(salt),
+    wrapped: await wrapVaultKey(raw, await deriveAESKeyFromPassword(password, salt)),
+    createdAt: Date.now()
+  };
+}
+
+// passkeyName names a new passkey after where it lives.
+function passkeyName(transports) {
+  if (transports.includes('internal')) return 'This device';
+  if (transports.includes('hybrid')) return 'Phone';
+  return 'Security key';
+}
+
+// checkVaultKey reports whether key opens the credential's check value, so
+// a wallet without keys can still tell a wrong password. Wallets set up
+// before check values get one when synced or given a second authenticator.
+async function checkVaultKey(stored, key) {
+  if (!stored.check) return true;
+  try {
+    return await decryptPrivateKey(new Uint8Array(stored.check.encrypted), new Uint8Array(stored.check.iv), key) === VAULT_CHECK;
+  } catch (e) {
+    return false;
+  }
+}
+
+async function vaultCheck(key) {
+  const { encrypted, iv } = await encryptPrivateKey(VAULT_CHECK, key);
+  return { encrypted: Array.from(encrypted), iv: Array.from(iv) };
+}
+
+async function showAuthModal() {
+  for (const id of ['auth-name', 'auth-current', 'auth-password', 'auth-password-confirm']) {
+    document.getElementById(id).value = '';
+  }
+  document.getElementById('auth-new-password').style.display = 'none';
+  document.getElementById('auth-error').style.display = 'none';
+  await renderAuthenticators();
+  showModal('auth-modal');
+}
+
+async function renderAuthenticators() {
+  const cred = await getCredential();
+  const auths = vaultAuthenticators(cred);
+  document.getElementById('auth-list').innerHTML = auths.map(a => {
+    const meta = [a.method === 'prf' ? 'passkey' : 'password'];
+    if (a.createdAt) meta.push('added ' + new Date(a.createdAt).toLocaleDateString());
+    return '<div class="trash-row">' +
+      '<span class="trash-name">' + esc(a.name) + ' <span class="trash-kind">' + esc(meta.join(' · ')) + '</span></span>' +
+      (auths.length > 1 ? '<button class="btn btn-danger" onclick="removeAuthenticator(\'' + esc(a.id) + '\')">Remove</button>' : '') +
+    '</div>';
+  }).join('');
+  document.getElementById('auth-current-field').style.display = auths.some(a => a.method === 'password') && !recoveredVaultKey ? 'block' : 'none';
+}
+
+function authFailed(err) {
+  const errEl = document.getElementById('auth-error');
+  errEl.textContent = err.name === 'NotAllowedError' ? 'The passkey prompt was cancelled or timed out.' : 'Failed: ' + err.message;
+  errEl.style.display = 'block';
+}
+
+// confirmVault opens the vault again before an authenticator is added, with
+// the current password if one was entered or else a current passkey, so an
+// unattended unlocked browser can't be given a new way in. A wallet
+// unlocked with recovery shares has proved enough.
+async function confirmVault(cred, password) {
+  if (!cred.check) cred.check = await vaultCheck(aesKey);
+  if (recoveredVaultKey) return { key: aesKey, raw: recoveredVaultKey.slice() };
+  return openVault(cred, password || undefined);
+}
+
+// saveAuthenticators stores a changed list of authenticators. A synced
+// wallet's list is saved on the server first, so other browsers pick it up.
+async function saveAuthenticators(cred, auths) {
+  const next = Object.assign({}, cred, { authenticators: auths });
+  for (const f of ['method', 'credentialId', 'rpId', 'transports', 'pbkdf2Salt']) delete next[f];
+  if (next.syncId) {
+    const resp = await fetch('/api/keysync/credential', {
+      method: 'PUT',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ vault: next.syncId, base_version: next.syncCredentialVersion || 0, credential: syncedCredential(next) })
+    });
+    const data = await resp.json();
+    if (!resp.ok) {
+      if (resp.status === 409) scheduleKeySync();
+      throw new Error(data.error || 'HTTP ' + resp.status);
+    }
+    next.syncCredentialVersion = data.credential_version;
+  }
+  await saveCredential(next);
+  credMethod = vaultMethod(next);
+}
+
+async function addPasskeyAuthenticator() {
+  document.getElementById('auth-error').style.display = 'none';
+  try {
+    const cred = await getCredential();
+    const auths = vaultAuthenticators(cred);
+    const { raw } = await confirmVault(cred, document.getElementById('auth-current').value);
+    try {
+      const passkey = await createPasskey(auths.filter(a => a.method === 'prf'));
+      const name = document.getElementById('auth-name').value.trim() || passkeyName(passkey.transports);
+      await saveAuthenticators(cred, auths.concat(await passkeyAuthenticator(name, passkey, raw)));
+    } finally {
+      raw.fill(0);
+    }
+    await showAuthModal();
+  } catch (err) {
+    authFailed(err);
+  }
+}
+
+async function addPasswordAuthenticator() {
+  document.getElementById('auth-error').style.display = 'none';
+  const fields = document.getElementById('auth-new-password');
+  if (fields.style.display === 'none') {
+    fields.style.display = 'block';
+    document.getElementById('auth-password').focus();
+    return;
+  }
+  try {
+    const pw = document.getElementById('auth-password').value;
+    const problem = passwordProblem(pw, document.getElementById('auth-password-confirm').value);
+    if (problem) throw new Error(problem);
+    const cred = await getCredential();
+    const auths = vaultAuthenticators(cred);
+    const { raw } = await confirmVault(cred, document.getElementById('auth-current').value);
+    try {
+      const name = document.getElementById('auth-name').value.trim() || 'Password';
+      await saveAuthenticators(cred, auths.concat(await passwordAuthenticator(name, pw, raw)));
+    } finally {
+      raw.fill(0);
+    }
+    await showAuthModal();
+  } catch (err) {
+    authFailed(err);
+  }
+}
+
+// removeAuthenticator deletes an authenticator's copy of the vault key. The
+// vault key itself stays the same, so a copy of the wallet's storage taken
+// earlier still opens with it.
+async function removeAuthenticator(id) {
+  document.getElementById('auth-error').style.display = 'none';
+  try {
+    const cred = await getCredential();
+    const auths = vaultAuthenticators(cred);
+    const auth = auths.find(a => a.id === id);
+    if (!auth || auths.length < 2) return;
+    if (!confirm('Remove ' + auth.name + '? It will no longer unlock this wallet.')) return;
+    await saveAuthenticators(cred, auths.filter(a => a.id !== id));
+    await renderAuthenticators();
+  } catch (err) {
+    authFailed(err);
+  }
+}
+
+function showRekeyModal() {
+  for (const id of ['rekey-password', 'rekey-password-confirm', 'rekey-current']) {
+    document.getElementById(id).value = '';
+  }
+  document.getElementById('rekey-method').value = credMethod === 'password' ? 'prf' : 'password';
+  document.getElementById('rekey-current-field').style.display = document.getElementById('auth-current-field').style.display;
+  document.getElementById('rekey-error').style.display = 'none';
+  rekeyMethodChanged();
+  hideModal('auth-modal');
+  showModal('rekey-modal');
+}
+
+function rekeyMethodChanged() {
+  const password = document.getElementById('rekey-method').value === 'password';
+  document.getElementById('rekey-password-fields').style.display = password ? 'block' : 'none';
+}
+
+// changeUnlockMethod re-keys the vault: every key record is re-encrypted
+// under a new vault key that only the new password or passkey unlocks, and
+// the other authenticators are dropped, so neither the old password nor an
+// old copy of this browser's storage opens the keys. The records are
+// rewritten with the credential in one IndexedDB transaction: if anything
+// fails before it commits, the wallet is left as it was.
+async function changeUnlockMethod() {
+  const errEl = document.getElementById('rekey-error');
+  const btn = document.getElementById('btn-rekey');
+  errEl.style.display = 'none';
+  const method = document.getElementById('rekey-method').value;
+  const pw = document.getElementById('rekey-password').value;
+  if (method === 'password') {
+    const problem = passwordProblem(pw, document.getElementById('rekey-password-confirm').value);
+    if (problem) {
+      errEl.textContent = problem;
+      errEl.style.display = 'block';
+      return;
+    }
+  }
+
+  btn.disabled = true;
+  btn.textContent = 'Re-encrypting...';
+  const raw = crypto.getRandomValues(new Uint8Array(32));
+  try {
+    const cred = await getCredential();
+    if (!cred.check) cred.check = await vaultCheck(aesKey);
+    const current = await confirmVault(cred, document.getElementById('rekey-current').value);
+    current.raw.fill(0);
+
+    let auth;
+    if (method === 'password') {
+      auth = await passwordAuthenticator('Password', pw, raw);
+    } else {
+      const passkey = await createPasskey([]);
+      auth = await passkeyAuthenticator(passkeyName(passkey.transports), passkey, raw);
+    }
+    const key = await importVaultKey(raw);
+
+    const records = [];
+    for (const rec of await getEncryptedKeys()) {
+      const plaintext = await decryptPrivateKey(new Uint8Array(rec.encrypted), new Uint8Array(rec.iv), current.key);
+      const { encrypted, iv } = await encryptPrivateKey(plaintext, key);
+      if (await decryptPrivateKey(encrypted, iv, key) !== plaintext) {
+        throw new Error('re-encrypting ' + rec.address + ' failed');
+      }
+      records.push(Object.assign({}, rec, { encrypted: Array.from(encrypted), iv: Array.from(iv) }));
+    }
+    const next = { id: 'primary', authenticators: [auth], check: await vaultCheck(key), createdAt: cred.createdAt };
+
+    // A synced wallet is uploaded as a new synced vault, which other
+    // browsers join with the new password or passkey. If saving here then
+    // fails, this browser can join it the same way.
+    if (cred.syncId) await uploadVault(next, records, true);
+    await replaceVault(next, records);
+
+    aesKey = key;
+    credMethod = vaultMethod(next);
+    keySyncId = next.syncId || '';
+    hideModal('rekey-modal');
+    await reloadKeys();
+  } catch (err) {
+    errEl.textContent = err.name === 'NotAllowedError' ? 'The passkey prompt was cancelled or timed out.' : 'Failed: ' + err.message;
+    errEl.style.display = 'block';
+  } finally {
+    raw.fill(0);
+    btn.disabled = false;
+    btn.textContent = 'Change';
+  }
+}
+
+// ── Recovery Shares ────────────────────────────────────
+// Shamir's secret sharing over GF(256), as in SLIP-39: a key, or the vault
+// key, is split byte by byte into up to 16 shares, any threshold of which
+// rebuild it, while fewer reveal nothing about it. A share is written as 27
+// words from the BIP-39 English list: a 15-bit set ID and what the secret
+// is, the threshold and the share's index, the share's 32 bytes, and a
+// 17-bit SHA-256 checksum.
+const SHARE_WORDS = 27;
+const GF_EXP = new Uint8Array(510);
+const GF_LOG = new Uint8Array(256);
+(function() {
+  let x = 1;
+  for (let i = 0; i < 255; i++) {
+    GF_EXP[i] = GF_EXP[i + 255] = x;
+    GF_LOG[x] = i;
+    x ^= ((x << 1) ^ (x & 0x80 ? 0x1b : 0)) & 0xff; // multiply by the generator 3
+  }
+})();
+
+function gfMul(a, b) {
+  return a && b ? GF_EXP[GF_LOG[a] + GF_LOG[b]] : 0;
+}
+
+function gfDiv(a, b) {
+  return a ? GF_EXP[GF_LOG[a] + 255 - GF_LOG[b]] : 0;
+}
+
+// splitSecret returns n shares of secret, as [{x, y}], any threshold of
+// which rebuild it.
+function splitSecret(secret, threshold, n) {
+  const coeffs = crypto.getRandomValues(new Uint8Array(secret.length * (threshold - 1)));
+  const shares = [];
+  for (let x = 1; x <= n; x++) {
+    const y = new Uint8Array(secret.length);
+    for (let j = 0; j < secret.length; j++) {
+      let v = 0;
+      for (let k = threshold - 2; k >= 0; k--) v = gfMul(v, x) ^ coeffs[j * (threshold - 1) + k];
+      y[j] = gfMul(v, x) ^ secret[j];
+    }
+    shares.push({ x, y });
+  }
+  coeffs.fill(0);
+  return shares;
+}
+
+// combineShares rebuilds a secret from shares by Lagrange interpolation at 0.
+function combineShares(shares) {
+  const secret = new Uint8Array(shares[0].y.length);
+  for (const a of shares) {
+    let basis = 1;
+    for (const b of shares) {
+      if (b !== a) basis = gfMul(basis, gfDiv(b.x, b.x ^ a.x));
+    }
+    for (let j = 0; j < secret.length; j++) secret[j] ^= gfMul(a.y[j], basis);
+  }
+  return secret;
+}
+
+async function shareChecksum(payload) {
+  const digest = new Uint8Array(await crypto.subtle.digest('SHA-256', payload));
+  return ((digest[0] << 9) | (digest[1] << 1) | (digest[2] >> 7)) >>> 0;
+}
+
+// encodeShare writes a share of a set as words. vault is true for the
+// vault key, false for a private key.
+async function encodeShare(set, vault, threshold, share) {
+  const payload = new Uint8Array(35);
+  payload[0] = set >> 7;
+  payload[1] = ((set << 1) & 0xff) | (vault ? 1 : 0);
+  payload[2] = ((threshold - 1) << 4) | (share.x - 1);
+  payload.set(share.y, 3);
+  let bits = '';
+  for (const b of payload) bits += b.toString(2).padStart(8, '0');
+  bits += (await shareChecksum(payload)).toString(2).padStart(17, '0');
+  const words = [];
+  for (let i = 0; i < SHARE_WORDS; i++) {
+    words.push(ethers.wordlists.en.getWord(parseInt(bits.slice(i * 11, i * 11 + 11), 2)));
+  }
+  return words.join(' ');
+}
+
+// decodeShare reads a share written by encodeShare.
+async function decodeShare(text) {
+  const words = text.trim().toLowerCase().split(/\s+/);
+  if (words.length !== SHARE_WORDS) throw new Error('a share has ' + SHARE_WORDS + ' words, not ' + words.length);
+  let bits = '';
+  for (const w of words) {
+    const i = ethers.wordlists.en.getWordIndex(w);
+    if (i < 0) throw new Error('"' + w + '" is not a share word');
+    bits += i.toString(2).padStart(11, '0');
+  }
+  const payload = new Uint8Array(35);
+  for (let i = 0; i < payload.length; i++) payload[i] = parseInt(bits.slice(i * 8, i * 8 + 8), 2);
+  if (parseInt(bits.slice(280), 2) !== await shareChecksum(payload)) {
+    throw new Error('checksum mismatch: check the words');
+  }
+  return {
+    set: (payload[0] << 7) | (payload[1] >> 1),
+    vault: (payload[1] & 1) === 1,
+    threshold: (payload[2] >> 4) + 1,
+    x: (payload[2] & 0x0f) + 1,
+    y: payload.slice(3)
+  };
+}
+
+let shareCards = []; // [{title, words}] from the last split, until the dialog closes
+
+function showSharesModal() {
+  const select = document.getElementById('shares-secret');
+  select.innerHTML = decryptedKeys.map((k, i) =>
+    '<option value="' + i + '">' + esc(k.label) + ' (' + k.address.slice(0, 6) + '...' + k.address.slice(-4) + ')</option>'
+  ).join('') + '<option value="vault">The vault key (unlocks every key in this wallet)</option>';
+  select.value = decryptedKeys.length > 0 ? String(activeKeyIndex) : 'vault';
+  document.getElementById('shares-current').value = '';
+  document.getElementById('shares-error').style.display = 'none';
+  sharesSecretChanged();
+  shareCards = [];
+  renderShareCards();
+  showModal('shares-modal');
+}
+
+// sharesSecretChanged asks for the current password when splitting the
+// vault key, which takes unlocking it again.
+async function sharesSecretChanged() {
+  const cred = await getCredential();
+  const password = vaultAuthenticators(cred).some(a => a.method === 'password');
+  document.getElementById('shares-current-field').style.display =
+    document.getElementById('shares-secret').value === 'vault' && password && !recoveredVaultKey ? 'block' : 'none';
+}
+
+async function splitIntoShares() {
+  const errEl = document.getElementById('shares-error');
+  errEl.style.display = 'none';
+  const n = parseInt(document.getElementById('shares-count').value, 10);
+  const threshold = parseInt(document.getElementById('shares-threshold').value, 10);
+  const which = document.getElementById('shares-secret').value;
+  let secret = null;
+  try {
+    if (!(n >= 2 && n <= 16)) throw new Error('Make 2 to 16 shares.');
+    if (!(threshold >= 2 && threshold <= n)) throw new Error('Recovery must need at least 2 shares, and no more than there are.');
+    await ensureEthers();
+    let about;
+    if (which === 'vault') {
+      const cred = await getCredential();
+      const hadCheck = !!cred.check;
+      secret = (await confirmVault(cred, document.getElementById('shares-current').value)).raw;
+      // Recovery checks the rebuilt key against the check value.
+      if (!hadCheck) await saveCredential(cred);
+      about = 'the vault key of this wallet';
+    } else {
+      const k = decryptedKeys[parseInt(which, 10)];
+      secret = hexToBytes(k.key);
+      about = k.label + ' (' + k.address + ')';
+    }
+    const set = crypto.getRandomValues(new Uint16Array(1))[0] & 0x7fff;
+    const cards = [];
+    for (const share of splitSecret(secret, threshold, n)) {
+      cards.push({
+        title: 'Recovery share ' + share.x + ' of ' + n + ' for ' + about + '. Any ' + threshold + ' of the ' + n + ' shares rebuild it.',
+        words: await encodeShare(set, which === 'vault', threshold, share)
+      });
+      share.y.fill(0);
+    }
+    shareCards = cards;
+    renderShareCards();
+  } catch (err) {
+    errEl.textContent = err.name === 'NotAllowedError' ? 'The passkey prompt was cancelled or timed out.' : 'Failed: ' + err.message;
+    errEl.style.display = 'block';
+  } finally {
+    if (secret) secret.fill(0);
+  }
+}
+
+function renderShareCards() {
+  document.getElementById('shares-list').innerHTML = shareCards.map((c, i) =>
+    '<div class="share-card">' +
+      '<p>' + esc(c.title) + '</p>' +
+      '<p class="mono">' + esc(c.words) + '</p>' +
+      '<button class="btn" onclick="printShare(' + i + ')">Print</button>' +
+      '<button class="btn" onclick="downloadShare(' + i + ')">Download</button>' +
+    '</div>'
+  ).join('');
+}
+
+function closeSharesModal() {
+  shareCards = [];
+  renderShareCards();
+  hideModal('shares-modal');
+}
+
+function shareText(c) {
+  return c.title + '\n\n' + c.words.split(' ').map((w, i) => String(i + 1).padStart(2, ' ') + '. ' + w).join('\n') + '\n';
+}
+
+// printShare prints one share on its own, so each can go to a different
+// place.
+function printShare(i) {
+  const w = window.open('', '_blank');
+  if (!w) return;
+  w.document.write('<!DOCTYPE html><title>Recovery share</title><pre style="font-size:14pt">' + esc(shareText(shareCards[i])) + '</pre>');
+  w.document.close();
+  w.focus();
+  w.print();
+}
+
+function downloadShare(i) {
+  const url = URL.createObjectURL(new Blob([shareText(shareCards[i])], { type: 'text/plain' }));
+  const a = document.createElement('a');
+  a.href = url;
+  a.download = 'wallet-share-' + (i + 1) + '-of-' + shareCards.length + '.txt';
+  a.click();
+  URL.revokeObjectURL(url);
+}
+
+function showRecoverModal() {
+  document.getElementById('recover-shares').value = '';
+  document.getElementById('recover-error').style.display = 'none';
+  hideModal('addkey-modal');
+  showModal('recover-modal');
+}
+
+// recoverFromShares rebuilds a secret from shares, one per line. A private
+// key goes to the import dialog; the vault key unlocks the wallet, after
+// which a new passkey or password can be added in place of lost ones.
+async function recoverFromShares() {
+  const errEl = document.getElementById('recover-error');
+  errEl.style.display = 'none';
+  let secret = null;
+  try {
+    await ensureEthers();
+    const lines = document.getElementById('recover-shares').value.split('\n').filter(l => l.trim());
+    const shares = [];
+    for (let i = 0; i < lines.length; i++) {
+      try {
+        shares.push(await decodeShare(lines[i]));
+      } catch (e) {
+        throw new Error('share on line ' + (i + 1) + ': ' + e.message);
+      }
+    }
+    if (shares.length === 0) throw new Error('Enter the shares, one per line.');
+    const first = shares[0];
+    if (shares.some(s => s.set !== first.set || s.vault !== first.vault || s.threshold !== first.threshold)) {
+      throw new Error('These shares come from different splits.');
+    }
+    const used = shares.filter((s, i) => shares.findIndex(o => o.x === s.x) === i);
+    if (used.length < first.threshold) {
+      throw new Error(first.threshold + ' different shares are needed, and there ' + (used.length === 1 ? 'is 1' : 'are ' + used.length) + '.');
+    }
+    secret = combineShares(used.slice(0, first.threshold));
+
+    if (!first.vault) {
+      if (walletState !== 'unlocked') throw new Error('This share set holds a private key: unlock or set up the wallet first, then recover it from Add Key.');
+      hideModal('recover-modal');
+      showImportModal();
+      document.getElementById('import-key').value = '0x' + bytesToHex(secret);
+      return;
+    }
+
+    const cred = await getCredential();
+    if (!cred) throw new Error('This browser has no wallet for this vault key. Set it up from the synced wallet first.');
+    const key = await importVaultKey(secret);
+    if (!cred.check || !(await checkVaultKey(cred, key))) throw new Error('These shares are for a different wallet.');
+    aesKey = key;
+    recoveredVaultKey = secret;
+    secret = null;
+    await decryptAllKeys();
+    walletState = 'unlocked';
+    renderWalletBar();
+    refresh();
+    hideModal('recover-modal');
+    hideModal('password-unlock-modal');
+    await showAuthModal();
+  } catch (err) {
+    errEl.textContent = 'Failed: ' + err.message;
+    errEl.style.display = 'block';
+  } finally {
+    if (secret) secret.fill(0);
+  }
+}
+
+// ── Key Rotation ───────────────────────────────────────
+// Rotating moves a key's balances to a freshly generated key and retires it.
+// The rotations preference maps each old address to its new key, the token
+// contracts being swept, and the hash of every sweep sent, so a reload or
+// another browser picks up where it stopped. A recorded sweep only holds a
+// row back while it is pending: once mined, whatever is left is swept again.
+const ERC20_ABI = [
+  'function balanceOf(address) view returns (uint256)',
+  'function transfer(address, uint256) returns (bool)',
+  'function decimals() view returns (uint8)',
+  'function symbol() view returns (string)'
+];
+const SWEEP_RECEIPT_TIMEOUT_MS = 180000;
+
+let rotateKeyId = null;
+let rotateRows = []; // [{endpoint, token, symbol, decimals, amount, status, hash, error}]
+let rotateBusy = false;
+
+function rotationFor(address) {
+  return (prefs.rotations || {})[address.toLowerCase()];
+}
+
+async function saveRotation(address, r) {
+  const all = Object.assign({}, prefs.rotations);
+  if (r) all[address.toLowerCase()] = r; else delete all[address.toLowerCase()];
+  await savePreference('rotations', all);
+}
+
+function showRotateModal(id) {
+  const k = decryptedKeys.find(x => x.id === id);
+  if (!k) return;
+  const r = rotationFor(k.address);
+  rotateKeyId = id;
+  rotateRows = [];
+  document.getElementById('rotate-from').textContent = k.label + ' (' + k.address + ')';
+  document.getElementById('rotate-tokens').value = r ? r.tokens.join('\n') : '';
+  document.getElementById('rotate-error').style.display = 'none';
+  renderRotation();
+  showModal('rotate-modal');
+}
+
+function renderRotation() {
+  const old = decryptedKeys.find(x => x.id === rotateKeyId);
+  const r = old && rotationFor(old.address);
+  const next = r && decryptedKeys.find(x => x.address.toLowerCase() === r.to.toLowerCase());
+  document.getElementById('rotate-to').textContent = next ? 'New key: ' + next.label + ' (' + next.address + ')' : '';
+  const statusText = {
+    ready: 'to sweep',
+    dust: 'too small to pay gas',
+    sending: 'sending…',
+    pending: 'pending',
+    confirmed: 'swept',
+    reverted: 'reverted',
+    failed: 'failed'
+  };
+  document.getElementById('rotate-rows').innerHTML = rotateRows.map(row => {
+    const ep = endpoints.find(e => e.id === row.endpoint);
+    let kind = statusText[row.status];
+    if (row.hash) kind += ' · ' + row.hash.slice(0, 10) + '…';
+    if (row.error) kind += ' · ' + row.error;
+    return '<div class="trash-row">' +
+      '<span class="trash-name">' + esc(ep ? ep.name : row.endpoint) + ' · ' + formatBalance(row.amount, row.decimals) + ' ' + esc(row.symbol) + '</span>' +
+      '<span class="trash-kind">' + esc(kind) + '</span>' +
+    '</div>';
+  }).join('');
+  document.getElementById('btn-rotate-scan').disabled = rotateBusy;
+  document.getElementById('btn-rotate-sweep').disabled = rotateBusy ||
+    !rotateRows.some(row => row.status === 'ready' || row.status === 'failed' || row.status === 'reverted');
+}
+
+// proxyCall makes one JSON-RPC call through the server's proxy.
+async function proxyCall(epId, method, params) {
+  const resp = await fetch('/api/rpc/' + epId, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ method: method, params: params })
+  });
+  const data = await resp.json();
+  if (data.error) throw new Error(data.error.message || data.error);
+  if (data.cross_check && data.cross_check.status === 'mismatch') {
+    console.warn(method + ' on ' + epId + ' disagrees with ' + data.cross_check.endpoint + ' at block ' + data.cross_check.block, data.result, data.cross_check.result || data.cross_check.error);
+  }
+  if (data.proof && data.proof.status === 'mismatch') {
+    console.warn(method + ' on ' + epId + ' fails its proof against ' + data.proof.endpoint + "'s state root at block " + data.proof.block, data.result, data.proof.error);
+  }
+  return data.result;
+}
+
+// provenText flags a balance whose eth_getProof check failed.
+function provenText(text, proof) {
+  return proof && proof.status === 'mismatch' ? text + ' \u26a0 unproven' : text;
+}
+
+// markProof explains a failed eth_getProof check on a balance's element.
+function markProof(el, proof) {
+  el.title = proof && proof.status === 'mismatch'
+    ? 'Fails its proof against the state root of ' + proof.endpoint + ' at block ' + proof.block + ': ' + proof.error
+    : '';
+}
+
+// proxyBatch makes several JSON-RPC calls through the server's proxy in
+// one request. Each entry of the result is { result } or { error }.
+async function proxyBatch(epId, calls) {
+  const resp = await fetch('/api/rpc/' + epId, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify(calls.map(c => ({ method: c[0], params: c[1] })))
+  });
+  const data = await resp.json();
+  if (!Array.isArray(data)) throw new Error(data.error || 'batch failed');
+  return data;
+}
+
+// scanRotation generates the new key on the first scan, then lists every
+// balance the old key holds on the online endpoints.
+async function scanRotation() {
+  const errEl = document.getElementById('rotate-error');
+  errEl.style.display = 'none';
+  const old = decryptedKeys.find(x => x.id === rotateKeyId);
+  const tokens = document.getElementById('rotate-tokens').value.split('\n').map(s => s.trim()).filter(Boolean);
+  const bad = tokens.find(t => !/^0x[0-9a-fA-F]{40}$/.test(t));
+  if (bad) {
+    errEl.textContent = 'Not a contract address: ' + bad;
+    errEl.style.display = 'block';
+    return;
+  }
+  rotateBusy = true;
+  renderRotation();
+  try {
+    await ensureEthers();
+    let r = rotationFor(old.address);
+    if (!r || !decryptedKeys.some(x => x.address.toLowerCase() === r.to.toLowerCase())) {
+      const next = await addGeneratedKey();
+      renderWalletBar();
+      r = { to: next.address, sweeps: {} };
+    }
+    r.tokens = tokens;
+    await saveRotation(old.address, r);
+
+    const erc20 = new ethers.Interface(ERC20_ABI);
+    const rows = [];
+    for (const ep of endpoints.filter(e => e.online)) {
+      const calldata = erc20.encodeFunctionData('balanceOf', [old.address]);
+      const outs = tokens.length ? await proxyBatch(ep.id, tokens.map(token => ['eth_call', [{ to: token, data: calldata }, 'latest']])) : [];
+      for (const [i, token] of tokens.entries()) {
+        let amount;
+        try {
+          amount = erc20.decodeFunctionResult('balanceOf', outs[i].result)[0];
+        } catch {
+          continue; // not a token on this chain
+        }
+        if (amount === 0n) continue;
+        rows.push(Object.assign({ endpoint: ep.id, token: token, amount: amount }, await tokenInfo(erc20, ep.id, token)));
+      }
+      // Tokens in the registry are swept too, unless listed above.
+      const listed = new Set(tokens.map(t => t.toLowerCase()));
+      const resp = await fetch('/api/erc20/balances?endpoint=' + encodeURIComponent(ep.id) + '&address=' + encodeURIComponent(old.address));
+      for (const b of resp.ok ? await resp.json() : []) {
+        if (listed.has(b.address.toLowerCase())) continue;
+        rows.push({ endpoint: ep.id, token: b.address, symbol: b.symbol, decimals: b.decimals, amount: BigInt(b.balance) });
+      }
+      const wei = BigInt(await proxyCall(ep.id, 'eth_getBalance', [old.address, 'latest']));
+      if (wei === 0n) continue;
+      // The build doubles the base fee, so anything under twice the current
+      // price of a transfer can't pay for its own sweep.
+      const price = BigInt(await proxyCall(ep.id, 'eth_gasPrice', []));
+      rows.push({ endpoint: ep.id, token: '', symbol: ep.symbol || 'ETH', decimals: ep.decimals ?? 18, amount: wei, dust: wei <= 21000n * price * 2n });
+    }
+    for (const row of rows) {
+      row.hash = r.sweeps[sweepKey(row)];
+      row.status = row.dust ? 'dust' : 'ready';
+      if (!row.hash) continue;
+      const receipt = await proxyCall(row.endpoint, 'eth_getTransactionReceipt', [row.hash]);
+      if (!receipt) row.status = 'pending';
+    }
+    rotateRows = rows;
+    if (!rows.length) {
+      errEl.textContent = 'Nothing left to sweep.';
+      errEl.style.display = 'block';
+    }
+  } catch (err) {
+    errEl.textContent = 'Scan failed: ' + err.message;
+    errEl.style.display = 'block';
+  } finally {
+    rotateBusy = false;
+    renderRotation();
+  }
+}
+
+// tokenInfo reads a token's symbol and decimals, falling back to its
+// address and raw units for contracts that lack them.
+async function tokenInfo(erc20, epId, token) {
+  const info = { symbol: token.slice(0, 8) + '…', decimals: 0 };
+  try {
+    info.decimals = Number(erc20.decodeFunctionResult('decimals', await proxyCall(epId, 'eth_call', [{ to: token, data: erc20.encodeFunctionData('decimals') }, 'latest']))[0]);
+    info.symbol = erc20.decodeFunctionResult('symbol', await proxyCall(epId, 'eth_call', [{ to: token, data: erc20.encodeFunctionData('symbol') }, 'latest']))[0];
+  } catch {
+    // keep the fallback
+  }
+  return info;
+}
+
+function sweepKey(row) {
+  return row.endpoint + ':' + (row.token ? row.token.toLowerCase() : 'native');
+}
+
+// sweepRotation sends the listed sweeps one at a time, waiting for each to
+// be mined so the native sweep sees what the token sweeps paid in gas. A
+// sweep still pending at the timeout stops the rest on its endpoint.
+async function sweepRotation() {
+  const errEl = document.getElementById('rotate-error');
+  errEl.style.display = 'none';
+  const old = decryptedKeys.find(x => x.id === rotateKeyId);
+  const r = rotationFor(old.address);
+  rotateBusy = true;
+  const stalled = new Set();
+  try {
+    for (const row of rotateRows) {
+      if (!['ready', 'failed', 'reverted'].includes(row.status) || stalled.has(row.endpoint)) continue;
+      row.status = 'sending';
+      row.error = '';
+      renderRotation();
+      try {
+        row.hash = await sendSweep(old, r.to, row);
+        r.sweeps[sweepKey(row)] = row.hash;
+        await saveRotation(old.address, r);
+        row.status = 'pending';
+        renderRotation();
+        const receipt = await waitForReceipt(row.endpoint, row.hash);
+        if (receipt) {
+          row.status = receipt.status === '0x1' ? 'confirmed' : 'reverted';
+        } else {
+          stalled.add(row.endpoint);
+        }
+      } catch (err) {
+        row.status = 'failed';
+        row.error = err.message;
+      }
+      renderRotation();
+    }
+  } finally {
+    rotateBusy = false;
+    renderRotation();
+  }
+}
+
+// sendSweep builds, signs, and broadcasts one sweep and returns its hash.
+// The native sweep pays its own fee, so it is priced with a zero-value
+// transfer first and sends the balance less the most that fee can be. An
+// L1 data fee charged on top of gas moves with the L1 base fee, so room is
+// left for it to double.
+async function sendSweep(old, to, row) {
+  let req = { endpoint: row.endpoint, from: old.address };
+  if (row.token) {
+    const erc20 = new ethers.Interface(ERC20_ABI);
+    Object.assign(req, { to: row.token, value: '0', data: erc20.encodeFunctionData('transfer', [to, row.amount]) });
+  } else {
+    const probe = await buildTx(Object.assign({ to: to, value: '0' }, req));
+    let fee = BigInt(probe.tx.gas) * BigInt(probe.tx.max_fee_per_gas);
+    if (probe.l1_fee && !probe.l1_fee.included) fee += 2n * BigInt(probe.l1_fee.fee);
+    const balance = BigInt(await proxyCall(row.endpoint, 'eth_getBalance', [old.address, 'latest']));
+    if (balance <= fee) throw new Error('the balance no longer covers the fee');
+    row.amount = balance - fee;
+    Object.assign(req, {
+      to: to,
+      value: row.amount.toString(),
+      gas: probe.tx.gas,
+      max_fee_per_gas: probe.tx.max_fee_per_gas,
+      max_priority_fee_per_gas: probe.tx.max_priority_fee_per_gas
+    });
+  }
+  const env = await buildTx(req);
+  const signature = await signInBrowser({ kind: 'local' }, env);
+  const resp = await fetch('/api/tx/import', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ envelope: env, signature: signature, broadcast: true })
+  });
+  const data = await resp.json();
+  if (!resp.ok) throw new Error(data.error || 'broadcast failed');
+  return (data.signed || data).hash;
+}
+
+async function buildTx(req) {
+  const resp = await fetch('/api/tx/build', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify(req)
+  });
+  const env = await resp.json();
+  if (!resp.ok) throw new Error(env.error || 'build failed');
+  return env;
+}
+
+// waitForReceipt polls for a transaction's receipt, or returns null once
+// SWEEP_RECEIPT_TIMEOUT_MS passes.
+async function waitForReceipt(epId, hash) {
+  const deadline = Date.now() + SWEEP_RECEIPT_TIMEOUT_MS;
+  while (Date.now() < deadline) {
+    const receipt = await proxyCall(epId, 'eth_getTransactionReceipt', [hash]);
+    if (receipt) return receipt;
+    await new Promise(resolve => setTimeout(resolve, 3000));
+  }
+  return null;
+}
+
+// archiveRotatedKey keeps the old address as a watch-only account and moves
+// its key to the recycle bin, where it can still be restored.
+async function archiveRotatedKey() {
+  const errEl = document.getElementById('rotate-error');
+  errEl.style.display = 'none';
+  const old = decryptedKeys.find(x => x.id === rotateKeyId);
+  const unswept = rotateRows.some(row => row.status !== 'confirmed' && row.status !== 'dust');
+  if (rotateBusy) return;
+  if (!rotationFor(old.address) && !confirm('Nothing has been swept from ' + old.label + '. Archive it anyway?')) return;
+  if (unswept && !confirm('Some balances of ' + old.label + ' have not been swept. Archive it anyway?')) return;
+  try {
+    const resp = await fetch('/api/accounts', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ address: old.address, label: old.label, kind: 'watch' })
+    });
+    const data = await resp.json();
+    if (!resp.ok && resp.status !== 409) throw new Error(data.error || 'HTTP ' + resp.status);
+    if (resp.ok) hwAccounts.push(data);
+    await setKeyDeleted(old.id, true);
+  } catch (err) {
+    errEl.textContent = 'Archive failed: ' + err.message;
+    errEl.style.display = 'block';
+    return;
+  }
+  await saveRotation(old.address, null);
+  const idx = decryptedKeys.indexOf(old);
+  old.key = '';
+  decryptedKeys.splice(idx, 1);
+  if (activeKeyIndex >= decryptedKeys.length) activeKeyIndex = Math.max(0, decryptedKeys.length - 1);
+  storedKeyCount = decryptedKeys.length;
+  rotateKeyId = null;
+  hideModal('rotate-modal');
+  renderWalletBar();
+  refresh();
+}
+
+// ── Lock ───────────────────────────────────────────────
+function lockWallet() {
+  for (let i = 0; i < decryptedKeys.length; i++) {
+    decryptedKeys[i].key = '';
+  }
+  decryptedKeys = [];
+  aesKey = null;
+  if (recoveredVaultKey) recoveredVaultKey.fill(0);
+  recoveredVaultKey = null;
+  stopVanity();
+  activeKeyIndex = 0;
+  walletState = 'locked';
+  expandedAccounts.clear();
+  accountBalances = {};
+  renderWalletBar();
+  renderEndpoints();
+  renderAccounts();
+}
+
+// ── Panic Lock ─────────────────────────────────────────
+// Ctrl/Cmd+Shift+L (or POST /api/lock from anywhere) locks every session:
+// other tabs hear it over a BroadcastChannel, other browsers on their next
+// status poll when the server's lock epoch changes.
+const lockChannel = ('BroadcastChannel' in window) ? new BroadcastChannel('wallet-lock') : null;
+if (lockChannel) lockChannel.onmessage = () => panicLock(false);
+
+function panicLock(propagate) {
+  lockWallet();
+  cancelPendingPrompts();
+  if (!propagate) return;
+  if (lockChannel) lockChannel.postMessage('lock');
+  fetch('/api/lock', { method: 'POST' })
+    .then(resp => resp.json())
+    .then(data => { lockEpoch = data.lock_epoch; })
+    .catch(err => console.error('server lock failed:', err));
+}
+
+// cancelPendingPrompts closes every open dialog and aborts hardware wallet
+// requests that are waiting on the device.
+function cancelPendingPrompts() {
+  document.querySelectorAll('.modal-overlay.active').forEach(m => m.classList.remove('active'));
+  hwCandidates = [];
+  ledgerPending.forEach(cancel => cancel());
+  ledgerPending.clear();
+  if (ledgerDevice && ledgerDevice.opened) ledgerDevice.close().catch(() => {});
+  ledgerDevice = null;
+  if (window.TrezorConnect) TrezorConnect.cancel('Wallet locked');
+  if (airgapPending) cancelAirgap();
+}
+
+// ── Import Key ─────────────────────────────────────────
+async function doImportKey() {
+  const labelInput = document.getElementById('import-label');
+  const keyInput = document.getElementById('import-key');
+  const errEl = document.getElementById('import-error');
+  const btn = document.getElementById('btn-import-confirm');
+  errEl.style.display = 'none';
+
+  const label = labelInput.value.trim() || nextKeyLabel();
+  let key = keyInput.value.trim();
+
+  if (!key) {
+    errEl.textContent = 'Please enter a private key.';
+    errEl.style.display = 'block';
+    return;
+  }
+
+  if (!key.startsWith('0x')) key = '0x' + key;
+
+  if (!/^0x[0-9a-fA-F]{64}$/.test(key)) {
+    errEl.textContent = 'Invalid key format. Expected 64 hex characters.';
+    errEl.style.display = 'block';
+    return;
+  }
+
+  if (!aesKey) {
+    errEl.textContent = 'Wallet is not unlocked. Please unlock first.';
+    errEl.style.display = 'block';
+    return;
+  }
+
+  btn.disabled = true;
+  btn.textContent = 'Encrypting...';
+
+  try {
+    await ensureEthers();
+    const wallet = new ethers.Wallet(key);
+    const address = wallet.address;
+
+    const { encrypted, iv } = await encryptPrivateKey(key, aesKey);
+
+    await saveEncryptedKey({
+      label: label,
+      address: address,
+      encrypted: Array.from(encrypted),
+      iv: Array.from(iv),
+      createdAt: Date.now()
+    });
+
+    const allKeys = await getEncryptedKeys();
+    const newest = allKeys[allKeys.length - 1];
+    decryptedKeys.push({ id: newest.id, label: label, address: address, key: key });
+    activeKeyIndex = decryptedKeys.length - 1;
+    storedKeyCount = decryptedKeys.length;
+
+    labelInput.value = '';
+    keyInput.value = '';
+    errEl.style.display = 'none';
+    hideModal('import-modal');
+    renderWalletBar();
+    refresh();
+
+  } catch (err) {
+    errEl.textContent = 'Failed: ' + err.message;
+    errEl.style.display = 'block';
+  } finally {
+    btn.disabled = false;
+    btn.textContent = 'Import';
+  }
+}
+
+// ── Generate Key ───────────────────────────────────────
+async function generateKey() {
+  const errEl = document.getElementById('addkey-error');
+  errEl.style.display = 'none';
+
+  if (!aesKey) {
+    errEl.textContent = 'Wallet is not unlocked.';
+    errEl.style.display = 'block';
+    return;
+  }
+
+  try {
+    await addGeneratedKey();
+    activeKeyIndex = decryptedKeys.length - 1;
+
+    hideModal('addkey-modal');
+    renderWalletBar();
+    refresh();
+
+  } catch (err) {
+    errEl.textContent = 'Failed: ' + err.message;
+    errEl.style.display = 'block';
+  }
+}
+
+// addGeneratedKey creates a random key, saves it to the vault, and returns
+// its decrypted entry. The wallet must be unlocked.
+async function addGeneratedKey() {
+  await ensureEthers();
+  const wallet = ethers.Wallet.createRandom();
+  const label = nextKeyLabel();
+  const { encrypted, iv } = await encryptPrivateKey(wallet.privateKey, aesKey);
+
+  await saveEncryptedKey({
+    label: label,
+    address: wallet.address,
+    encrypted: Array.from(encrypted),
+    iv: Array.from(iv),
+    createdAt: Date.now()
+  });
+
+  const allKeys = await getEncryptedKeys();
+  const newest = allKeys[allKeys.length - 1];
+  const entry = { id: newest.id, label: label, address: wallet.address, key: wallet.privateKey };
+  decryptedKeys.push(entry);
+  storedKeyCount = decryptedKeys.length;
+  return entry;
+}
+
+// ── ERC-20 Tokens ──────────────────────────────────────
+let erc20Tokens = [];
+let erc20Lists = [];
+
+async function showERC20Modal() {
+  const chains = [...new Set(endpoints.filter(ep => ep.chain_id).map(ep => hexToDecimal(ep.chain_id)))];
+  const names = id => endpoints.filter(ep => ep.chain_id && hexToDecimal(ep.chain_id) === id).map(ep => ep.name).join(', ');
+  document.getElementById('erc20-chain').innerHTML = chains
+    .map(id => '<option value="' + esc(id) + '">Chain ' + esc(id) + ' (' + esc(names(id)) + ')</option>')
+    .join('');
+  document.getElementById('erc20-error').style.display = 'none';
+  showModal('erc20-modal');
+  await loadERC20();
+}
+
+async function loadERC20() {
+  try {
+    const [tokens, lists] = await Promise.all([fetch('/api/erc20'), fetch('/api/erc20/lists')]);
+    if (!tokens.ok || !lists.ok) throw new Error('Failed to load tokens.');
+    erc20Tokens = await tokens.json();
+    erc20Lists = await lists.json();
+  } catch (err) {
+    showERC20Error(err.message);
+  }
+  renderTokenLists();
+  renderERC20Tokens();
+}
+
+function showERC20Error(message) {
+  const errEl = document.getElementById('erc20-error');
+  errEl.textContent = message;
+  errEl.style.display = 'block';
+}
+
+function renderTokenLists() {
+  const el = document.getElementById('erc20-lists');
+  if (erc20Lists.length === 0) {
+    el.innerHTML = '<p class="trash-empty">No token lists.</p>';
+    return;
+  }
+  el.innerHTML = erc20Lists.map(l =>
+    '<div class="bm-row">' +
+      '<span class="bm-note" title="' + esc(l.url || 'Uploaded file') + '">' + esc(l.name) + '</span>' +
+      '<span class="bm-meta">' + (l.error ? 'refresh failed: ' + esc(l.error) + ' \u00b7 ' : '') +
+        formatNumber(l.tokens) + ' tokens, ' + formatNumber(l.skipped) + ' skipped \u00b7 ' + esc(new Date(l.imported_at).toLocaleString()) + '</span>' +
+      (l.url ? '<button class="btn-icon needs-manage" onclick="refreshTokenList(\'' + esc(l.id) + '\')" title="Refresh">&#8635;</button>' : '') +
+      '<button class="btn-icon danger needs-manage" onclick="removeTokenList(\'' + esc(l.id) + '\')" title="Remove">&#10005;</button>' +
+    '</div>'
+  ).join('');
+}
+
+function renderERC20Tokens() {
+  const chain = Number(document.getElementById('erc20-chain').value);
+  const el = document.getElementById('erc20-tokens');
+  const tokens = erc20Tokens.filter(t => t.chain_id === chain);
+  if (tokens.length === 0) {
+    el.innerHTML = '<p class="trash-empty">No tokens on this chain.</p>';
+    return;
+  }
+  const listName = id => (erc20Lists.find(l => l.id === id) || { name: 'a removed list' }).name;
+  el.innerHTML = tokens.map(t =>
+    '<div class="bm-row">' +
+      '<span class="bm-note">' + esc(t.symbol) + (t.name ? ' \u00b7 ' + esc(t.name) : '') + '</span>' +
+      '<span class="bm-meta mono">' + esc(t.address) + '</span>' +
+      '<span class="bm-meta">' + (t.list ? esc(listName(t.list)) : 'custom') + '</span>' +
+      (t.warnings ? '<span class="bm-meta erc20-warning" title="' + esc(t.warnings.join('\n')) + '">&#9888; ' + esc(t.fee_bps ? 'fee ' + t.fee_bps / 100 + '%' : 'notes') + '</span>' : '') +
+      (t.list ? '' : '<button class="btn-icon danger needs-manage" onclick="deleteERC20Token(' + t.chain_id + ', \'' + esc(t.address) + '\')" title="Remove">&#10005;</button>') +
+    '</div>'
+  ).join('');
+}
+
+async function erc20Request(btn, method, url, body) {
+  document.getElementById('erc20-error').style.display = 'none';
+  if (btn) btn.disabled = true;
+  try {
+    const opts = { method: method };
+    if (body) {
+      opts.headers = { 'Content-Type': 'application/json' };
+      opts.body = JSON.stringify(body);
+    }
+    const resp = await fetch(url, opts);
+    if (!resp.ok) throw new Error((await resp.json()).error || 'HTTP ' + resp.status);
+    tokenBalances = {};
+    await loadERC20();
+    renderAccounts();
+    return true;
+  } catch (err) {
+    showERC20Error(err.message);
+    return false;
+  } finally {
+    if (btn) btn.disabled = false;
+  }
+}
+
+async function importTokenList() {
+  const input = document.getElementById('erc20-list-url');
+  const url = input.value.trim();
+  if (!url) return showERC20Error('Enter the URL of a token list.');
+  if (await erc20Request(document.getElementById('btn-erc20-import'), 'POST', '/api/erc20/lists', { url: url })) input.value = '';
+}
+
+async function uploadTokenList() {
+  const input = document.getElementById('erc20-list-file');
+  if (!input.files.length) return showERC20Error('Choose a token list file.');
+  let list;
+  try {
+    list = JSON.parse(await input.files[0].text());
+  } catch {
+    return showERC20Error('The file is not JSON.');
+  }
+  if (await erc20Request(document.getElementById('btn-erc20-upload'), 'POST', '/api/erc20/lists', { list: list })) input.value = '';
+}
+
+function refreshTokenList(id) {
+  return erc20Request(null, 'POST', '/api/erc20/lists/' + encodeURIComponent(id) + '/refresh');
+}
+
+function removeTokenList(id) {
+  const l = erc20Lists.find(x => x.id === id);
+  if (!l || !confirm('Remove ' + l.name + ' and its ' + l.tokens + ' tokens?')) return;
+  return erc20Request(null, 'DELETE', '/api/erc20/lists/' + encodeURIComponent(id));
+}
+
+async function addERC20Token() {
+  const chain = document.getElementById('erc20-chain').value;
+  const ep = endpoints.find(e => e.online && e.chain_id && hexToDecimal(e.chain_id) === chain);
+  if (!ep) return showERC20Error('Add an endpoint for the token\'s chain first.');
+  const input = document.getElementById('erc20-address');
+  const body = { endpoint: ep.id, address: input.value.trim() };
+  if (await erc20Request(document.getElementById('btn-erc20-add'), 'POST', '/api/erc20', body)) input.value = '';
+}
+
+function deleteERC20Token(chainId, address) {
+  return erc20Request(null, 'DELETE', '/api/erc20/' + chainId + '/' + encodeURIComponent(address));
+}
+
+// ── Permits ────────────────────────────────────────────
+// The server builds a permit's typed data, reading the nonce and domain on
+// chain. Local and hardware keys sign it here and hand the signature back
+// for checking and calldata; vault keys and remote signers sign on the
+// server.
+let permitTarget = null;
+
+async function showPermitModal(epId, address) {
+  const ep = endpoints.find(e => e.id === epId);
+  permitTarget = { endpoint: epId, owner: address };
+  document.getElementById('permit-owner').textContent = address;
+  document.getElementById('permit-endpoint').textContent = ep ? ep.name : epId;
+  document.getElementById('permit-error').style.display = 'none';
+  document.getElementById('permit-warnings').style.display = 'none';
+  document.getElementById('permit-result').style.display = 'none';
+  document.getElementById('permit-tokens').innerHTML = '';
+  showModal('permit-modal');
+  if (ep && ep.chain_id) {
+    try {
+      const resp = await fetch('/api/erc20?chain_id=' + hexToDecimal(ep.chain_id));
+      if (resp.ok) erc20Tokens = await resp.json();
+    } catch (err) {
+      console.error('tokens fetch failed:', err);
+    }
+    document.getElementById('permit-tokens').innerHTML = erc20Tokens
+      .filter(t => t.chain_id === Number(hexToDecimal(ep.chain_id)))
+      .map(t => '<option value="' + esc(t.address) + '">' + esc(t.symbol) + '</option>')
+      .join('');
+  }
+}
+
+async function permitRequest(url, body) {
+  const resp = await fetch(url, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify(body)
+  });
+  const data = await resp.json();
+  if (!resp.ok) throw new Error(data.error || 'HTTP ' + resp.status);
+  return data;
+}
+
+// signPermitInBrowser signs a permit's digest with a local key or its typed
+// data on a hardware wallet, and returns the 65-byte signature.
+async function signPermitInBrowser(acct, permit) {
+  if (acct.kind === 'ledger') {
+    const sig = await ledgerSignTypedData(acct.path, hexToBytes(permit.domain_separator), hexToBytes(permit.message_hash));
+    return sig.r + sig.s.slice(2) + sig.v.toString(16).padStart(2, '0');
+  }
+  if (acct.kind === 'trezor') {
+    const res = await trezorSignTypedData(acct.path, permit.typed_data, permit.domain_separator, permit.message_hash);
+    return res.signature.startsWith('0x') ? res.signature : '0x' + res.signature;
+  }
+  const k = decryptedKeys.find(x => x.address.toLowerCase() === acct.address.toLowerCase());
+  if (!k || !k.key) throw new Error('Unlock the wallet to sign with this key.');
+  await ensureEthers();
+  return new ethers.SigningKey(k.key.startsWith('0x') ? k.key : '0x' + k.key).sign(permit.digest).serialized;
+}
+
+async function signPermit() {
+  const errEl = document.getElementById('permit-error');
+  const warnEl = document.getElementById('permit-warnings');
+  const resultEl = document.getElementById('permit-result');
+  errEl.style.display = 'none';
+  warnEl.style.display = 'none';
+  resultEl.style.display = 'none';
+  const btn = document.getElementById('btn-permit-sign');
+  btn.disabled = true;
+  try {
+    const body = Object.assign({}, permitTarget, {
+      kind: document.getElementById('permit-kind').value,
+      token: document.getElementById('permit-token').value.trim(),
+      spender: document.getElementById('permit-spender').value.trim()
+    });
+    const amount = document.getElementById('permit-amount').value.trim();
+    if (amount) {
+      const t = erc20Tokens.find(x => x.address.toLowerCase() === body.token.toLowerCase());
+      if (!t) throw new Error('Register the token in the ERC-20 dialog to give an amount, or leave it empty for unlimited.');
+      body.amount = parseUnits(amount, { decimals: t.decimals });
+    }
+    const acct = walletAccounts().find(a => a.address.toLowerCase() === permitTarget.owner.toLowerCase());
+    let permit;
+    if (acct && (acct.kind === 'local' || acct.kind === 'ledger' || acct.kind === 'trezor')) {
+      permit = await permitRequest('/api/permits', body);
+      if (permit.warnings && !confirm(permit.warnings.join('\n') + '\n\nSign anyway?')) return;
+      // Sign with the deadline the server picked, so the rebuilt permit is the same.
+      const signature = await signPermitInBrowser(acct, permit);
+      permit = await permitRequest('/api/permits', Object.assign(body, { deadline: permit.deadline, expiration: permit.expiration, signature: signature }));
+    } else {
+      permit = await permitRequest('/api/permits/sign', body);
+    }
+    if (permit.warnings) {
+      warnEl.textContent = permit.warnings.join(' ');
+      warnEl.style.display = 'block';
+    }
+    resultEl.value = JSON.stringify({
+      contract: permit.contract,
+      deadline: permit.deadline,
+      signature: permit.signature,
+      v: permit.v,
+      r: permit.r,
+      s: permit.s,
+      calldata: permit.calldata
+    }, null, 2);
+    resultEl.style.display = 'block';
+  } catch (err) {
+    errEl.textContent = err.message;
+    errEl.style.display = 'block';
+  } finally {
+    btn.disabled = false;
+  }
+}
+
+// ── NFTs ───────────────────────────────────────────────
+// /api/nfts indexes an address's transfer history a slice at a time, so the
+// gallery asks again until the inventory is complete, showing what it has
+// so far. Images come from the server's cache, never the token's own URLs.
+let nftQuery = 0;
+
+function showNFTs(epId, address) {
+  const ep = endpoints.find(e => e.id === epId);
+  document.getElementById('nft-owner').textContent = address;
+  document.getElementById('nft-endpoint').textContent = ep ? ep.name : epId;
+  document.getElementById('nft-state').textContent = 'Reading transfer history...';
+  document.getElementById('nft-error').textContent = '';
+  document.getElementById('nft-grid').innerHTML = '';
+  showModal('nft-modal');
+  loadNFTs(epId, address, ++nftQuery);
+}
+
+async function loadNFTs(epId, address, query) {
+  const url = '/api/nfts?endpoint=' + encodeURIComponent(epId) + '&address=' + encodeURIComponent(address);
+  // Stop once the dialog is closed or shows another address.
+  while (query === nftQuery && document.getElementById('nft-modal').classList.contains('active')) {
+    let inv;
+    try {
+      const resp = await fetch(url);
+      inv = await resp.json();
+      if (!resp.ok) throw new Error(inv.error || 'HTTP ' + resp.status);
+    } catch (e) {
+      if (query !== nftQuery) return;
+      document.getElementById('nft-state').textContent = '';
+      document.getElementById('nft-error').textContent = 'Failed to read NFTs: ' + e.message;
+      return;
+    }
+    if (query !== nftQuery) return;
+    renderNFTs(inv);
+    if (inv.complete) return;
+  }
+}
+
+function renderNFTs(inv) {
+  let state;
+  if (inv.indexed_to < inv.head) {
+    state = 'Indexed to block ' + formatNumber(inv.indexed_to) + ' of ' + formatNumber(inv.head) + '...';
+  } else if (!inv.complete) {
+    state = 'Reading metadata...';
+  } else {
+    state = inv.tokens.length === 0 ? 'No NFTs.' : inv.tokens.length + (inv.tokens.length === 1 ? ' token.' : ' tokens.');
+  }
+  document.getElementById('nft-state').textContent = state;
+
+  let html = '';
+  for (const t of inv.tokens) {
+    const m = t.metadata || {};
+    const name = m.name || '#' + (t.token_id.length > 12 ? t.token_id.slice(0, 10) + '\u2026' : t.token_id);
+    const image = '/api/nfts/image/' + inv.chain_id + '/' + t.contract + '/' + t.token_id;
+    html += '<div class="nft-card" title="' + esc(m.description || '') + '">';
+    html +=   '<div class="nft-image">';
+    if (m.image) {
+      html +=   '<img src="' + image + '" alt="" loading="lazy" onerror="this.replaceWith(\'No image\')">';
+    } else {
+      html +=   t.metadata ? 'No image' : '...';
+    }
+    html +=   '</div>';
+    html +=   '<div class="nft-info">';
+    html +=     '<div class="nft-name">' + esc(name) + (t.balance !== '1' ? ' \u00d7' + esc(t.balance) : '') + '</div>';
+    html +=     '<div class="nft-collection mono">' + esc(t.collection || t.contract) + '</div>';
+    if (m.error) html += '<div class="nft-error">' + esc(m.error) + '</div>';
+    html +=   '</div>';
+    html += '</div>';
+  }
+  document.getElementById('nft-grid').innerHTML = html;
+}
+
+// ── Vanity Address ─────────────────────────────────────
+// Web Workers from /static/vanity-worker.js, one per core, grind random keys
+// until an address matches. The match goes to the import dialog, which
+// encrypts it like any other key.
+const VANITY_MAX_DIGITS = 10;
+
+let vanityWorkers = [];
+let vanityTimer = null;
+let vanityTries = 0;
+let vanityStarted = 0;
+
+function showVanityModal() {
+  stopVanity();
+  document.getElementById('vanity-prefix').value = '';
+  document.getElementById('vanity-suffix').value = '';
+  document.getElementById('vanity-checksum').checked = false;
+  document.getElementById('vanity-error').style.display = 'none';
+  vanityChanged();
+  showModal('vanity-modal');
+}
+
+// vanityPattern reads the dialog's pattern and the number of tries a match
+// takes on average.
+function vanityPattern() {
+  const checksum = document.getElementById('vanity-checksum').checked;
+  let prefix = document.getElementById('vanity-prefix').value.trim().replace(/^0x/i, '');
+  let suffix = document.getElementById('vanity-suffix').value.trim();
+  const digits = prefix + suffix;
+  if (!digits) throw new Error('Enter the digits the address should start or end with.');
+  if (!/^[0-9a-fA-F]*$/.test(digits)) throw new Error('Use hex digits only: 0-9 and a-f.');
+  if (digits.length > VANITY_MAX_DIGITS) throw new Error('Use at most ' + VANITY_MAX_DIGITS + ' digits.');
+  if (!checksum) {
+    prefix = prefix.toLowerCase();
+    suffix = suffix.toLowerCase();
+  }
+  // A letter in a checksummed address is upper case half the time.
+  const letters = checksum ? (digits.match(/[a-f]/gi) || []).length : 0;
+  return { prefix: prefix, suffix: suffix, checksum: checksum, expected: 16 ** digits.length * 2 ** letters };
+}
+
+function vanityChanged() {
+  if (vanityWorkers.length) return;
+  const el = document.getElementById('vanity-progress');
+  try {
+    el.textContent = 'About ' + formatNumber(vanityPattern().expected) + ' tries on average.';
+  } catch (err) {
+    el.textContent = '';
+  }
+}
+
+function toggleVanity() {
+  if (vanityWorkers.length) {
+    stopVanity();
+    vanityChanged();
+  } else {
+    startVanity();
+  }
+}
+
+function startVanity() {
+  const errEl = document.getElementById('vanity-error');
+  errEl.style.display = 'none';
+  let p;
+  try {
+    if (!ETHERS_SRI) throw new Error('ethers.js is not bundled in this server build, so keys cannot be generated here');
+    p = vanityPattern();
+  } catch (err) {
+    errEl.textContent = err.message;
+    errEl.style.display = 'block';
+    return;
+  }
+  vanityTries = 0;
+  vanityStarted = Date.now();
+  for (let i = 0; i < (navigator.hardwareConcurrency || 4); i++) {
+    const w = new Worker('/static/vanity-worker.js');
+    w.onmessage = e => {
+      vanityTries += e.data.tries;
+      if (e.data.key) foundVanity(e.data.key);
+    };
+    w.onerror = e => {
+      e.preventDefault();
+      stopVanity();
+      errEl.textContent = 'The generator stopped: ' + (e.message || 'ethers.js could not be loaded');
+      errEl.style.display = 'block';
+    };
+    w.postMessage({ prefix: p.prefix, suffix: p.suffix, checksum: p.checksum });
+    vanityWorkers.push(w);
+  }
+  vanityTimer = setInterval(() => showVanityProgress(p.expected), 500);
+  document.getElementById('btn-vanity').textContent = 'Stop';
+}
+
+function showVanityProgress(expected) {
+  // Escape closes dialogs without asking, so stop once this one is gone.
+  if (!document.getElementById('vanity-modal').classList.contains('active')) {
+    stopVanity();
+    return;
+  }
+  const rate = vanityTries / Math.max((Date.now() - vanityStarted) / 1000, 0.001);
+  let text = formatNumber(vanityTries) + ' tries, ' + formatNumber(Math.round(rate)) + ' per second';
+  // Every try is a fresh chance, so the expected wait never shrinks.
+  if (rate > 0) text += '. A match takes ' + formatDuration(expected / rate) + ' on average.';
+  document.getElementById('vanity-progress').textContent = text;
+}
+
+function stopVanity() {
+  for (const w of vanityWorkers) w.terminate();
+  vanityWorkers = [];
+  clearInterval(vanityTimer);
+  vanityTimer = null;
+  document.getElementById('btn-vanity').textContent = 'Start';
+}
+
+function foundVanity(key) {
+  if (!vanityWorkers.length) return; // another worker found one first
+  stopVanity();
+  hideModal('vanity-modal');
+  showImportModal();
+  document.getElementById('import-key').value = key;
+}
+
+// ── Key Labels ─────────────────────────────────────────
+function getLabelTemplate() {
+  return prefs.label_template || DEFAULT_LABEL_TEMPLATE;
+}
+
+function applyLabelTemplate(template, index) {
+  if (!template.includes('{index}')) template += ' {index}';
+  return template.replace(/\{index\}/g, String(index)).trim();
+}
+
+// nextKeyLabel names the next key, skipping numbers already taken by
+// existing labels so a deleted key doesn't cause duplicates.
+function nextKeyLabel() {
+  const template = getLabelTemplate();
+  const taken = new Set(decryptedKeys.map(k => k.label));
+  let n = storedKeyCount + 1;
+  while (taken.has(applyLabelTemplate(template, n))) n++;
+  return applyLabelTemplate(template, n);
+}
+
+function showLabelsModal() {
+  document.getElementById('labels-template').value = getLabelTemplate();
+  document.getElementById('labels-start').value = '1';
+  document.getElementById('labels-error').style.display = 'none';
+  showModal('labels-modal');
+}
+
+function readLabelTemplate() {
+  const errEl = document.getElementById('labels-error');
+  const template = document.getElementById('labels-template').value.trim();
+  errEl.style.display = 'none';
+  if (!template) {
+    errEl.textContent = 'Template cannot be empty.';
+    errEl.style.display = 'block';
+    return '';
+  }
+  return template;
+}
+
+function saveLabelTemplate() {
+  const template = readLabelTemplate();
+  if (!template) return;
+  savePreference('label_template', template);
+  hideModal('labels-modal');
+}
+
+// renameAllKeys relabels every key from the template in their stored
+// order, numbering from the chosen start index.
+async function renameAllKeys() {
+  const template = readLabelTemplate();
+  if (!template) return;
+  const errEl = document.getElementById('labels-error');
+  const btn = document.getElementById('btn-labels-apply');
+  const start = parseInt(document.getElementById('labels-start').value, 10);
+  if (isNaN(start) || start < 0) {
+    errEl.textContent = 'Start must be a non-negative number.';
+    errEl.style.display = 'block';
+    return;
+  }
+
+  btn.disabled = true;
+  try {
+    await savePreference('label_template', template);
+    const ordered = decryptedKeys.slice().sort((a, b) => a.id - b.id);
+    for (let i = 0; i < ordered.length; i++) {
+      const label = applyLabelTemplate(template, start + i);
+      await updateKeyLabel(ordered[i].id, label);
+      ordered[i].label = label;
+    }
+    hideModal('labels-modal');
+    renderWalletBar();
+    renderAccounts();
+  } catch (err) {
+    errEl.textContent = 'Failed: ' + err.message;
+    errEl.style.display = 'block';
+  } finally {
+    btn.disabled = false;
+  }
+}
+
+function showAddKeyModal() {
+  document.getElementById('addkey-error').style.display = 'none';
+  showModal('addkey-modal');
+}
+
+// ── Wallet Bar Rendering ───────────────────────────────
+function renderWalletBar() {
+  const statusEl = document.getElementById('wallet-status');
+  const actionsEl = document.getElementById('wallet-actions');
+
+  if (walletState === 'none') {
+    statusEl.className = 'no-wallet';
+    statusEl.textContent = 'No wallet configured';
+    actionsEl.innerHTML = '<button class="btn btn-primary" onclick="showModal(\'setup-modal\')">Setup Wallet</button>' +
+      '<button class="btn" onclick="showModal(\'hw-modal\')">Hardware</button>';
+  } else if (walletState === 'locked') {
+    const methodLabel = { prf: 'biometric', password: 'password', both: 'biometric or password' }[credMethod];
+    statusEl.className = 'label';
+    statusEl.innerHTML = '<span class="lock-icon">&#128274;</span> Wallet locked' +
+      (storedKeyCount > 0 ? ' <span class="key-badge">' + storedKeyCount + ' key' + (storedKeyCount !== 1 ? 's' : '') + '</span>' : '') +
+      ' <span class="method-badge">' + methodLabel + '</span>';
+    actionsEl.innerHTML = '<button class="btn btn-primary" onclick="unlockWallet()">Unlock</button>' +
+      '<button class="btn" onclick="showRecoverModal()">Recover</button>' +
+      '<button class="btn" onclick="showModal(\'hw-modal\')">Hardware</button>';
+  } else if (walletState === 'unlocked') {
+    let html = '';
+    if (decryptedKeys.length > 0) {
+      const active = decryptedKeys[activeKeyIndex];
+      if (decryptedKeys.length > 1) {
+        html += '<select class="key-selector" onchange="switchKey(this.value)">';
+        for (let i = 0; i < decryptedKeys.length; i++) {
+          const k = decryptedKeys[i];
+          const sel = i === activeKeyIndex ? ' selected' : '';
+          html += '<option value="' + i + '"' + sel + '>' + esc(k.label) + ' (' + k.address.slice(0, 6) + '...' + k.address.slice(-4) + ')</option>';
+        }
+        html += '</select>';
+      }
+      statusEl.className = 'address';
+      statusEl.textContent = active.address;
+    } else {
+      statusEl.className = 'no-wallet';
+      statusEl.textContent = 'No keys imported';
+    }
+
+    actionsEl.innerHTML = html +
+      '<button class="btn btn-primary" onclick="showAddKeyModal()">Add Key</button>' +
+      '<button class="btn" onclick="showModal(\'hw-modal\')">Hardware</button>' +
+      (decryptedKeys.length > 0 ? '<button class="btn" onclick="showLabelsModal()">Labels</button>' : '') +
+      '<button class="btn" onclick="showAuthModal()">Authenticators</button>' +
+      '<button class="btn" onclick="showSharesModal()">Shares</button>' +
+      '<button class="btn" onclick="showKeySyncModal()">' + (keySyncId ? 'Synced' : 'Sync') + '</button>' +
+      '<button class="btn" onclick="lockWallet()">Lock</button>';
+  }
+}
+
+function switchKey(index) {
+  activeKeyIndex = parseInt(index, 10);
+  renderWalletBar();
+  refresh();
+}
+
+function showImportModal() {
+  document.getElementById('import-label').value = '';
+  document.getElementById('import-key').value = '';
+  document.getElementById('import-error').style.display = 'none';
+  showModal('import-modal');
+}
+
+// ── Refresh ────────────────────────────────────────────
+async function refresh() {
+  try {
+    const resp = await fetch('/api/status');
+    if (resp.status === 401) {
+      // The session expired or the server restarted.
+      showModal('login-modal');
+      return;
+    }
+    const data = await resp.json();
+    if (!BROADCAST_ONLY) {
+      await loadHardwareAccounts();
+      await loadBookmarks();
+      await loadFaucet();
+      if (sharedProfile()) {
+        await loadSchedules();
+        await loadApprovals();
+        await loadBridges();
+        await loadBatches();
+        await loadAlerts();
+      }
+    }
+    applyStatus(data);
+  } catch (err) {
+    console.error('status poll failed:', err);
+  }
+}
+
+// applyStatus renders an /api/status response or a pushed status message.
+function applyStatus(data) {
+  endpoints = data.endpoints || [];
+  if (lockEpoch !== null && data.lock_epoch !== lockEpoch) panicLock(false);
+  lockEpoch = data.lock_epoch;
+  renderEndpoints();
+  if (!BROADCAST_ONLY) {
+    renderAccounts();
+    renderFaucet();
+  }
+}
+
+// applyStatusUpdate merges a pushed status_update, which carries only the
+// endpoints whose status changed and the IDs of those removed.
+function applyStatusUpdate(msg) {
+  const removed = new Set(msg.removed || []);
+  const next = endpoints.filter(ep => !removed.has(ep.id));
+  for (const st of msg.endpoints || []) {
+    const i = next.findIndex(ep => ep.id === st.id);
+    if (i >= 0) next[i] = st;
+    else next.push(st);
+  }
+  applyStatus({ endpoints: next, lock_epoch: msg.lock_epoch });
+}
+
+// ── Push Channel ───────────────────────────────────────
+// The server pushes status, new blocks, subscribed balances, and watched
+// transactions over /api/ws. While the socket is down the dashboard polls
+// /api/status instead and keeps trying to reconnect.
+function connectPush() {
+  const ws = new WebSocket((location.protocol === 'https:' ? 'wss://' : 'ws://') + location.host + '/api/ws');
+  ws.onopen = () => {
+    pushSocket = ws;
+    pushSubscription = '';
+    if (pollTimer) {
+      clearInterval(pollTimer);
+      pollTimer = null;
+    }
+    subscribePush();
+    for (const hash in watchedTxs) {
+      ws.send(JSON.stringify({ type: 'watch_tx', endpoint: watchedTxs[hash].endpoint, hash: hash }));
+    }
+    if (comparePair.length) startCompare();
+  };
+  ws.onmessage = (ev) => handlePush(JSON.parse(ev.data));
+  ws.onclose = () => {
+    if (pushSocket === ws) pushSocket = null;
+    if (!pollTimer) pollTimer = setInterval(refresh, 10000);
+    if (comparePair.length) startCompare();
+    setTimeout(connectPush, 5000);
+  };
+}
+
+function handlePush(msg) {
+  switch (msg.type) {
+    case 'status':
+      applyStatus(msg);
+      break;
+    case 'status_update':
+      applyStatusUpdate(msg);
+      break;
+    case 'lock':
+      if (lockEpoch !== null && msg.lock_epoch !== lockEpoch) panicLock(false);
+      lockEpoch = msg.lock_epoch;
+      break;
+    case 'block':
+      if (faucetStatus && faucetStatus.endpoint === msg.endpoint) loadFaucet().then(renderFaucet);
+      break;
+    case 'balances':
+      applyPushedBalances(msg);
+      break;
+    case 'tx':
+      applyTxStatus(msg);
+      break;
+    case 'schedule_run':
+      loadSchedules();
+      break;
+    case 'approval':
+      loadApprovals();
+      break;
+    case 'bridge':
+      loadBridges();
+      break;
+    case 'notification':
+      showNotice(msg.notification.message);
+      loadAlerts();
+      break;
+    case 'private_tx':
+      applyPrivateStatus(msg.tx);
+      break;
+    case 'compare':
+      if (comparePair.length) renderCompare(msg);
+      break;
+    case 'error':
+      console.error('push:', msg.message);
+      break;
+  }
+}
+
+// subscribePush asks for balance pushes covering what is on screen: every
+// endpoint card when a key is active, plus expanded account cards. It only
+// sends when the subscription changes.
+function subscribePush() {
+  if (!pushSocket) return;
+  const ids = new Set(expandedAccounts);
+  if (getActiveAddress()) {
+    for (const ep of endpoints) ids.add(ep.id);
+  }
+  const cmd = JSON.stringify({
+    type: 'subscribe',
+    endpoints: [...ids],
+    addresses: walletAccounts().map(k => k.address)
+  });
+  if (cmd === pushSubscription) return;
+  pushSubscription = cmd;
+  pushSocket.send(cmd);
+}
+
+function applyPushedBalances(msg) {
+  const ep = endpoints.find(e => e.id === msg.endpoint);
+  if (!ep) return;
+  // Balances as of a bookmark don't change with new blocks.
+  const showLatest = balanceBlockTag(ep) === 'latest';
+  if (!latestBalances[ep.id]) latestBalances[ep.id] = {};
+  if (showLatest && !accountBalances[ep.id]) accountBalances[ep.id] = {};
+  const active = getActiveAddress().toLowerCase();
+  for (const b of msg.balances) {
+    const addr = b.address.toLowerCase();
+    const text = provenText(formatAmount(b.wei, ep), b.proof);
+    latestBalances[ep.id][addr] = text;
+    if (addr === active) {
+      const el = document.querySelector('[data-ep="' + ep.id + '"]');
+      if (el) {
+        el.textContent = text;
+        markProof(el, b.proof);
+      }
+    }
+    const k = showLatest && walletAccounts().find(a => a.address.toLowerCase() === addr);
+    if (k) {
+      accountBalances[ep.id][k.address] = text;
+      const el = document.querySelector('[data-acct-bal="' + ep.id + '-' + k.address + '"]');
+      if (el) {
+        el.textContent = text;
+        el.classList.remove('loading');
+        markProof(el, b.proof);
+      }
+    }
+  }
+}
+
+// watchTx shows a broadcast transaction's progress in el until it is mined.
+function watchTx(epId, hash, el) {
+  watchedTxs[hash] = { endpoint: epId, el: el };
+  if (pushSocket) pushSocket.send(JSON.stringify({ type: 'watch_tx', endpoint: epId, hash: hash }));
+}
+
+// applyPrivateStatus shows what the relay says of a transaction sent
+// privately, until its receipt comes in.
+function applyPrivateStatus(tx) {
+  const w = watchedTxs[tx.hash];
+  if (!w) return;
+  w.el.textContent = 'Sent privately: ' + tx.hash + ' \u2014 relay: ' + tx.status + (tx.error ? ' (' + tx.error + ')' : '');
+}
+
+// applyTxStatus shows a watched transaction's progress: pending, mined
+// until it is as deep as its endpoint's confirmations, then confirmed or
+// failed. A reorg puts it back to pending.
+function applyTxStatus(msg) {
+  const w = watchedTxs[msg.hash];
+  if (!w) return;
+  let text = 'Sent: ' + msg.hash + ' \u2014 ' + msg.status;
+  if (msg.status === 'mined') {
+    text += ' in block ' + formatNumber(hexToDecimal(msg.block_number));
+    if (msg.confirmations_required) {
+      text += ', ' + (msg.confirmations !== undefined ? msg.confirmations + ' of ' : '') + msg.confirmations_required + ' confirmations';
+    }
+  } else if (msg.status === 'reorged') {
+    text += '; its block was taken away, waiting to be mined again';
+  } else if (msg.status !== 'pending') {
+    text += ' in block ' + formatNumber(hexToDecimal(msg.block_number));
+    delete watchedTxs[msg.hash];
+  }
+  w.el.textContent = text;
+}
+
+// ── Render ─────────────────────────────────────────────
+function renderEndpoints() {
+  const container = document.getElementById('endpoints-container');
+  const walletAddress = getActiveAddress();
+
+  if (endpoints.length === 0) {
+    container.innerHTML =
+      '<div class="empty-state">' +
+        '<h2>No Endpoints Configured</h2>' +
+        (BROADCAST_ONLY
+          ? '<p>Add endpoints to the endpoints file and restart.</p>'
+          : '<p>Click "+ Add Endpoint" above to get started.</p>') +
+      '</div>';
+    return;
+  }
+
+  let html = '<div class="endpoints">';
+  for (const ep of endpoints) {
+    const [statusClass, statusLabel, statusTitle] = endpointState(ep);
+    const chainId = ep.chain_id ? hexToDecimal(ep.chain_id) : '\u2014';
+    const blockNum = ep.block_number ? hexToDecimal(ep.block_number) : '\u2014';
+    const latencyClass = ep.latency_ms < 200 ? 'fast' : ep.latency_ms < 1000 ? 'medium' : 'slow';
+    const urlAbbrev = abbreviateURL(ep.url);
+
+    html += '<div class="ep-card" data-id="' + esc(ep.id) + '">';
+    html +=   '<div class="ep-card-header">';
+    html +=     '<h3>' + (ep.chain_id ? '<img class="chain-icon" src="/api/icons/chain/' + chainId + '" alt="" onerror="this.remove()">' : '') + esc(ep.name) + '</h3>';
+    html +=     '<div style="display:flex;align-items:center;gap:0.25rem">';
+    html +=       '<span class="' + statusClass + '" title="' + esc(statusTitle) + '">';
+    html +=         '<span class="status-dot"></span>';
+    html +=         '<span class="status-text">' + statusLabel + '</span>';
+    html +=       '</span>';
+    html +=       '<div class="ep-card-actions manage-only needs-manage">';
+    html +=         '<button class="btn-icon" onclick="editEndpoint(\'' + esc(ep.id) + '\')" title="Edit">&#9998;</button>';
+    html +=         '<button class="btn-icon danger" onclick="deleteEndpoint(\'' + esc(ep.id) + '\', \'' + esc(ep.name) + '\')" title="Delete">&#10005;</button>';
+    html +=       '</div>';
+    html +=     '</div>';
+    html +=   '</div>';
+    html +=   '<div class="ep-card-body">';
+    html +=     '<div class="ep-row">';
+    html +=       '<span class="label">RPC</span>';
+    html +=       '<span class="url-display" title="' + esc(ep.url) + '">' + esc(urlAbbrev) + (ep.has_jwt ? ' \u00b7 JWT' : '') + (ep.proxy && ep.proxy !== 'direct' ? ' \u00b7 ' + (ep.proxy === 'tor' ? 'Tor' : 'proxy') : '') + (ep.consensus ? ' \u00b7 light client' : '') + (ep.private ? ' \u00b7 private' : '') + '</span>';
+    html +=     '</div>';
+    html +=     '<div class="ep-row">';
+    html +=       '<span class="label">Chain ID</span>';
+    html +=       '<span class="value">' + chainId + '</span>';
+    html +=     '</div>';
+    html +=     '<div class="ep-row">';
+    html +=       '<span class="label">Block</span>';
+    html +=       '<span class="value">' + formatNumber(blockNum) + '</span>';
+    html +=     '</div>';
+    html +=     '<div class="ep-row">';
+    html +=       '<span class="label">Latency</span>';
+    html +=       '<span class="latency ' + latencyClass + '">' + ep.latency_ms + ' ms</span>';
+    html +=     '</div>';
+    if (ep.capabilities) {
+      html +=   '<div class="ep-row">';
+      html +=     '<span class="label">Features</span>';
+      html +=     '<span class="value">' + esc(capabilityText(ep.capabilities)) + '</span>';
+      html +=   '</div>';
+    }
+
+    if (walletAddress && ep.online) {
+      html +=   '<div class="ep-row" id="balance-' + esc(ep.id) + '">';
+      html +=     '<span class="label">Balance</span>';
+      html +=     '<span class="value balance" data-ep="' + esc(ep.id) + '">...</span>';
+      html +=   '</div>';
+    }
+
+    html +=   '</div>';
+    html += '</div>';
+  }
+  html += '</div>';
+  container.innerHTML = html;
+
+  if (!walletAddress) return;
+  if (!pushSocket) {
+    fetchBalances(walletAddress);
+    return;
+  }
+  for (const ep of endpoints) {
+    const text = latestBalances[ep.id] && latestBalances[ep.id][walletAddress.toLowerCase()];
+    const el = document.querySelector('[data-ep="' + ep.id + '"]');
+    if (text && el) el.textContent = text;
+  }
+}
+
+// ── Balances ───────────────────────────────────────────
+async function fetchBalances(address) {
+  for (const ep of endpoints) {
+    if (!ep.online) continue;
+    try {
+      const resp = await fetch('/api/rpc/' + ep.id, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ method: 'eth_getBalance', params: [address, 'latest'] })
+      });
+      const data = await resp.json();
+      if (data.result) {
+        const el = document.querySelector('[data-ep="' + ep.id + '"]');
+        if (el) {
+          el.textContent = provenText(formatAmount(data.result, ep), data.proof);
+          markProof(el, data.proof);
+        }
+      }
+    } catch (err) {
+      console.error('balance fetch failed for ' + ep.name + ':', err);
+    }
+  }
+}
+
+// ── Active Address Helper ──────────────────────────────
+function getActiveAddress() {
+  if (walletState !== 'unlocked' || decryptedKeys.length === 0) return '';
+  return decryptedKeys[activeKeyIndex].address;
+}
+
+// ── Ethers.js Lazy Load ────────────────────────────────
+// The bundle is embedded in the server; the integrity hash catches a copy
+// altered on the way. A build without it has no hash and can't sign here.
+let ethersLoaded = false;
+function ensureEthers() {
+  if (ethersLoaded) return Promise.resolve();
+  if (!ETHERS_SRI) return Promise.reject(new Error('ethers.js is not bundled in this server build, so the browser cannot sign'));
+  return new Promise((resolve, reject) => {
+    const script = document.createElement('script');
+    script.src = '/static/ethers.umd.min.js';
+    script.integrity = ETHERS_SRI;
+    script.onload = () => { ethersLoaded = true; resolve(); };
+    script.onerror = () => reject(new Error('Failed to load ethers.js'));
+    document.head.appendChild(script);
+  });
+}
+
+// ── Hardware Accounts ──────────────────────────────────
+async function loadHardwareAccounts() {
+  try {
+    const resp = await fetch('/api/accounts');
+    if (resp.ok) hwAccounts = await resp.json();
+  } catch (err) {
+    console.error('accounts fetch failed:', err);
+  }
+}
+
+// walletAccounts lists every account the dashboard can show: unlocked vault
+// keys first, then hardware accounts, which need no unlock to display.
+function walletAccounts() {
+  const out = [];
+  const seen = new Set();
+  if (walletState === 'unlocked') {
+    for (const k of decryptedKeys) {
+      out.push({ id: k.id, label: k.label, address: k.address, kind: 'local' });
+      seen.add(k.address.toLowerCase());
+    }
+  }
+  for (const a of hwAccounts) {
+    if (seen.has(a.address.toLowerCase())) continue;
+    out.push({ label: a.label, address: a.address, kind: a.kind, path: a.path });
+  }
+  return out;
+}
+
+async function renameHardwareAccount(address, label) {
+  const resp = await fetch('/api/accounts/' + address, {
+    method: 'PUT',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ label })
+  });
+  const data = await resp.json();
+  if (!resp.ok) throw new Error(data.error || 'rename failed');
+  const a = hwAccounts.find(x => x.address === address);
+  if (a) a.label = data.label;
+}
+
+async function removeHardwareAccount(address) {
+  const acct = hwAccounts.find(a => a.address === address);
+  const resp = await fetch('/api/accounts/' + address, { method: 'DELETE' });
+  if (!resp.ok) {
+    const data = await resp.json();
+    alert(data.error || 'Failed to remove account.');
+    return;
+  }
+  hwAccounts = hwAccounts.filter(a => a.address !== address);
+  renderAccounts();
+  showUndoToast('Removed ' + (acct ? acct.label : address), async () => {
+    await fetch('/api/accounts/' + address + '/restore', { method: 'POST' });
+    await loadHardwareAccounts();
+    renderAccounts();
+  });
+}
+
+// ── Ledger (WebHID) ────────────────────────────────────
+const LEDGER_VENDOR_ID = 0x2c97;
+const LEDGER_CHANNEL = 0x0101;
+const LEDGER_TAG_APDU = 0x05;
+const LEDGER_PACKET_SIZE = 64;
+const LEDGER_CLA = 0xe0;
+const LEDGER_INS_GET_ADDRESS = 0x02;
+const LEDGER_INS_SIGN_TX = 0x04;
+const LEDGER_INS_SIGN_MESSAGE = 0x08;
+const LEDGER_INS_SIGN_EIP712 = 0x0c;
+let ledgerDevice = null;
+let ledgerPending = new Set();      // cancel functions for in-flight APDU exchanges
+
+async function ledgerConnect() {
+  if (!navigator.hid) throw new Error('WebHID is not available in this browser. Use Chrome or Edge.');
+  if (ledgerDevice && ledgerDevice.opened) return ledgerDevice;
+  let device = (await navigator.hid.getDevices()).find(d => d.vendorId === LEDGER_VENDOR_ID);
+  if (!device) {
+    const picked = await navigator.hid.requestDevice({ filters: [{ vendorId: LEDGER_VENDOR_ID }] });
+    device = picked[0];
+  }
+  if (!device) throw new Error('No Ledger selected.');
+  if (!device.opened) await device.open();
+  ledgerDevice = device;
+  return device;
+}
+
+// ledgerFrame splits an APDU into 64-byte HID packets: channel, tag,
+// sequence index, and (first packet only) the total APDU length.
+function ledgerFrame(apdu) {
+  const data = new Uint8Array(2 + apdu.length);
+  data[0] = apdu.length >> 8;
+  data[1] = apdu.length & 0xff;
+  data.set(apdu, 2);
+
+  const packets = [];
+  for (let offset = 0, seq = 0; offset < data.length; seq++) {
+    const pkt = new Uint8Array(LEDGER_PACKET_SIZE);
+    pkt[0] = LEDGER_CHANNEL >> 8;
+    pkt[1] = LEDGER_CHANNEL & 0xff;
+    pkt[2] = LEDGER_TAG_APDU;
+    pkt[3] = seq >> 8;
+    pkt[4] = seq & 0xff;
+    const chunk = data.slice(offset, offset + LEDGER_PACKET_SIZE - 5);
+    pkt.set(chunk, 5);
+    packets.push(pkt);
+    offset += chunk.length;
+  }
+  return packets;
+}
+
+function ledgerExchange(device, apdu) {
+  let cancel;
+  const exchange = new Promise((resolve, reject) => {
+    let expected = -1;
+    let buf = new Uint8Array(0);
+    const onReport = (e) => {
+      const pkt = new Uint8Array(e.data.buffer, e.data.byteOffset, e.data.byteLength);
+      let payload;
+      if (expected < 0) {
+        expected = (pkt[5] << 8) | pkt[6];
+        payload = pkt.slice(7);
+      } else {
+        payload = pkt.slice(5);
+      }
+      buf = concatBytes(buf, payload);
+      if (buf.length < expected) return;
+
+      device.removeEventListener('inputreport', onReport);
+      const resp = buf.slice(0, expected);
+      const sw = (resp[resp.length - 2] << 8) | resp[resp.length - 1];
+      if (sw !== 0x9000) {
+        reject(ledgerError(sw));
+      } else {
+        resolve(resp.slice(0, resp.length - 2));
+      }
+    };
+    device.addEventListener('inputreport', onReport);
+    cancel = () => {
+      device.removeEventListener('inputreport', onReport);
+      reject(new Error('Ledger request cancelled: wallet locked'));
+    };
+
+    (async () => {
+      for (const pkt of ledgerFrame(apdu)) {
+        await device.sendReport(0, pkt);
+      }
+    })().catch(err => {
+      device.removeEventListener('inputreport', onReport);
+      reject(err);
+    });
+  });
+  ledgerPending.add(cancel);
+  return exchange.finally(() => ledgerPending.delete(cancel));
+}
+
+function ledgerAPDU(ins, p1, p2, data) {
+  const apdu = new Uint8Array(5 + data.length);
+  apdu.set([LEDGER_CLA, ins, p1, p2, data.length]);
+  apdu.set(data, 5);
+  return apdu;
+}
+
+function ledgerError(sw) {
+  switch (sw) {
+    case 0x6985: return new Error('Rejected on the Ledger.');
+    case 0x5515: return new Error('Ledger is locked. Unlock it and try again.');
+    case 0x6d00:
+    case 0x6e00:
+    case 0x6e01: return new Error('Open the Ethereum app on the Ledger.');
+    case 0x6a80: return new Error('Ledger rejected the data (enable blind signing for contract data).');
+    default: return new Error('Ledger error 0x' + sw.toString(16));
+  }
+}
+
+function encodeDerivationPath(path) {
+  const parts = path.replace(/^m\//, '').split('/');
+  const out = new Uint8Array(1 + parts.length * 4);
+  const view = new DataView(out.buffer);
+  out[0] = parts.length;
+  parts.forEach((p, i) => {
+    let n = parseInt(p, 10);
+    if (p.endsWith("'")) n += 0x80000000;
+    view.setUint32(1 + i * 4, n >>> 0);
+  });
+  return out;
+}
+
+// ledgerSendChunked sends a payload larger than one APDU as a first chunk
+// (P1=0x00) followed by continuation chunks (P1=0x80), returning the final response.
+async function ledgerSendChunked(ins, payload) {
+  const device = await ledgerConnect();
+  let resp;
+  for (let off = 0; off < payload.length; off += 255) {
+    resp = await ledgerExchange(device, ledgerAPDU(ins, off === 0 ? 0x00 : 0x80, 0x00, payload.slice(off, off + 255)));
+  }
+  return resp;
+}
+
+function ledgerSignature(resp) {
+  return { v: resp[0], r: '0x' + bytesToHex(resp.slice(1, 33)), s: '0x' + bytesToHex(resp.slice(33, 65)) };
+}
+
+async function ledgerGetAddress(path, display) {
+  const device = await ledgerConnect();
+  const resp = await ledgerExchange(device, ledgerAPDU(LEDGER_INS_GET_ADDRESS, display ? 0x01 : 0x00, 0x00, encodeDerivationPath(path)));
+  const pkLen = resp[0];
+  const addrLen = resp[1 + pkLen];
+  const addr = new TextDecoder().decode(resp.slice(2 + pkLen, 2 + pkLen + addrLen));
+  await ensureEthers();
+  return ethers.getAddress('0x' + addr.toLowerCase());
+}
+
+// ledgerSignTransaction signs a serialized unsigned transaction (the RLP
+// payload, prefixed with the type byte for typed transactions).
+async function ledgerSignTransaction(path, unsignedTx) {
+  const payload = concatBytes(encodeDerivationPath(path), unsignedTx);
+  return ledgerSignature(await ledgerSendChunked(LEDGER_INS_SIGN_TX, payload));
+}
+
+// ledgerSignMessage signs an EIP-191 personal message.
+async function ledgerSignMessage(path, message) {
+  const len = new Uint8Array(4);
+  new DataView(len.buffer).setUint32(0, message.length);
+  const payload = concatBytes(encodeDerivationPath(path), len, message);
+  return ledgerSignature(await ledgerSendChunked(LEDGER_INS_SIGN_MESSAGE, payload));
+}
+
+// ledgerSignTypedData signs EIP-712 data from its domain separator and
+// message struct hash (32 bytes each).
+async function ledgerSignTypedData(path, domainSeparator, messageHash) {
+  const device = await ledgerConnect();
+  const payload = concatBytes(encodeDerivationPath(path), domainSeparator, messageHash);
+  return ledgerSignature(await ledgerExchange(device, ledgerAPDU(LEDGER_INS_SIGN_EIP712, 0x00, 0x00, payload)));
+}
+
+// ── Trezor (Trezor Connect) ────────────────────────────
+const TREZOR_CONNECT_URL = 'https://connect.trezor.io/9/trezor-connect.js';
+let trezorReady = null;
+
+function ensureTrezor() {
+  if (trezorReady) return trezorReady;
+  trezorReady = new Promise((resolve, reject) => {
+    const script = document.createElement('script');
+    script.src = TREZOR_CONNECT_URL;
+    script.onload = () => {
+      TrezorConnect.init({
+        lazyLoad: true,
+        manifest: { email: 'wallet@' + location.hostname, appUrl: location.origin }
+      }).then(resolve, reject);
+    };
+    script.onerror = () => reject(new Error('Failed to load Trezor Connect; the server must allow it with CSP_EXTRA_SOURCES=https://connect.trezor.io'));
+    document.head.appendChild(script);
+  });
+  trezorReady.catch(() => { trezorReady = null; });
+  return trezorReady;
+}
+
+// trezorCall unwraps Trezor Connect's {success, payload} responses.
+async function trezorCall(method, params) {
+  await ensureTrezor();
+  const res = await TrezorConnect[method](params);
+  if (!res.success) throw new Error('Trezor: ' + (res.payload && res.payload.error || 'request failed'));
+  return res.payload;
+}
+
+async function trezorGetAddresses(paths, display) {
+  const payload = await trezorCall('ethereumGetAddress', {
+    bundle: paths.map(path => ({ path, showOnTrezor: !!display }))
+  });
+  await ensureEthers();
+  return payload.map(p => ethers.getAddress(p.address));
+}
+
+// trezorSignTransaction signs a transaction given as hex-string fields
+// (to, value, gasLimit, nonce, data, chainId and either gasPrice or
+// maxFeePerGas/maxPriorityFeePerGas). Trezor serializes it on the device.
+async function trezorSignTransaction(path, transaction) {
+  return trezorCall('ethereumSignTransaction', { path, transaction });
+}
+
+// trezorSignMessage signs an EIP-191 personal message given as hex.
+async function trezorSignMessage(path, messageHex) {
+  return trezorCall('ethereumSignMessage', { path, message: messageHex.replace(/^0x/, ''), hex: true });
+}
+
+// trezorSignTypedData signs full EIP-712 data; the precomputed hashes let
+// models without on-device EIP-712 parsing sign the digest instead.
+async function trezorSignTypedData(path, data, domainSeparatorHash, messageHash) {
+  return trezorCall('ethereumSignTypedData', {
+    path,
+    data,
+    metamask_v4_compat: true,
+    domain_separator_hash: domainSeparatorHash,
+    message_hash: messageHash
+  });
+}
+
+// ── Hardware Account Picker ────────────────────────────
+const HW_NAMES = { ledger: 'Ledger', trezor: 'Trezor' };
+
+// hwGetAddresses reads the addresses at the given paths from a device.
+async function hwGetAddresses(kind, paths) {
+  if (kind === 'trezor') return trezorGetAddresses(paths, false);
+  const out = [];
+  for (const path of paths) out.push(await ledgerGetAddress(path, false));
+  return out;
+}
+
+async function verifyHardwareAddress(address) {
+  const acct = hwAccounts.find(a => a.address === address);
+  if (!acct) return;
+  try {
+    const shown = acct.kind === 'trezor'
+      ? (await trezorGetAddresses([acct.path], true))[0]
+      : await ledgerGetAddress(acct.path, true);
+    if (shown !== acct.address) alert('Address mismatch: device reports ' + shown);
+  } catch (err) {
+    alert(err.message);
+  }
+}
+
+function showHardwareAccountsModal(kind) {
+  hwCandidates = [];
+  document.getElementById('hwacct-kind').value = kind;
+  document.getElementById('hwacct-title').textContent = HW_NAMES[kind] + ' Accounts';
+  document.getElementById('hwacct-label').value = HW_NAMES[kind] + ' {index}';
+  document.getElementById('hwacct-addresses').innerHTML = '';
+  document.getElementById('hwacct-error').style.display = 'none';
+  document.getElementById('btn-hwacct-add').disabled = true;
+  showModal('hwacct-modal');
+}
+
+async function loadHardwareAddresses() {
+  const errEl = document.getElementById('hwacct-error');
+  const btn = document.getElementById('btn-hwacct-load');
+  const listEl = document.getElementById('hwacct-addresses');
+  const kind = document.getElementById('hwacct-kind').value;
+  const template = document.getElementById('hwacct-path').value;
+  const start = parseInt(document.getElementById('hwacct-start').value, 10);
+  const count = parseInt(document.getElementById('hwacct-count').value, 10);
+  errEl.style.display = 'none';
+
+  if (isNaN(start) || start < 0 || isNaN(count) || count < 1 || count > 50) {
+    errEl.textContent = 'Choose a start index of 0 or more and between 1 and 50 accounts.';
+    errEl.style.display = 'block';
+    return;
+  }
+
+  btn.disabled = true;
+  btn.textContent = 'Reading device...';
+  hwCandidates = [];
+  listEl.innerHTML = '';
+  try {
+    const paths = [];
+    for (let i = start; i < start + count; i++) paths.push(template.replace('{index}', String(i)));
+    const addresses = await hwGetAddresses(kind, paths);
+
+    const known = new Set(hwAccounts.map(a => a.address));
+    let html = '';
+    addresses.forEach((address, i) => {
+      hwCandidates.push({ address, path: paths[i], index: start + i });
+      const checked = known.has(address) ? ' disabled' : ' checked';
+      html +=
+        '<label class="hw-address-row">' +
+          '<input type="checkbox" data-hw-idx="' + i + '"' + checked + '>' +
+          '<span class="mono">' + address.slice(0, 10) + '...' + address.slice(-8) + '</span>' +
+          '<span class="acct-key-path">' + esc(paths[i]) + '</span>' +
+        '</label>';
+    });
+    listEl.innerHTML = html;
+    document.getElementById('btn-hwacct-add').disabled = false;
+  } catch (err) {
+    errEl.textContent = err.message;
+    errEl.style.display = 'block';
+  } finally {
+    btn.disabled = false;
+    btn.textContent = 'Load Addresses';
+  }
+}
+
+async function addHardwareAccounts() {
+  const errEl = document.getElementById('hwacct-error');
+  const btn = document.getElementById('btn-hwacct-add');
+  const kind = document.getElementById('hwacct-kind').value;
+  const labelTemplate = document.getElementById('hwacct-label').value.trim() || HW_NAMES[kind] + ' {index}';
+  errEl.style.display = 'none';
+
+  const selected = [];
+  document.querySelectorAll('#hwacct-addresses input[data-hw-idx]').forEach(cb => {
+    if (cb.checked && !cb.disabled) selected.push(hwCandidates[parseInt(cb.dataset.hwIdx, 10)]);
+  });
+  if (selected.length === 0) {
+    errEl.textContent = 'Select at least one address.';
+    errEl.style.display = 'block';
+    return;
+  }
+
+  btn.disabled = true;
+  try {
+    for (const c of selected) {
+      const resp = await fetch('/api/accounts', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({
+          address: c.address,
+          label: applyLabelTemplate(labelTemplate, c.index),
+          kind: kind,
+          path: c.path
+        })
+      });
+      const data = await resp.json();
+      if (!resp.ok) throw new Error(data.error || 'Failed to add ' + c.address);
+      hwAccounts.push(data);
+    }
+    hideModal('hwacct-modal');
+    renderAccounts();
+  } catch (err) {
+    errEl.textContent = err.message;
+    errEl.style.display = 'block';
+  } finally {
+    btn.disabled = false;
+  }
+}
+
+// ── Air-Gapped Accounts ────────────────────────────────
+// An air-gapped wallet never connects: the server encodes each transaction
+// as an eth-sign-request UR, shown here as an animated QR code, and the
+// device's eth-signature comes back through the camera or pasted text.
+let airgapPending = null; // {env, resolve, reject, timer, stream, parts}
+
+function showAirgapAccountModal() {
+  document.getElementById('airgap-acct-address').value = '';
+  document.getElementById('airgap-acct-fingerprint').value = '';
+  document.getElementById('airgap-acct-error').style.display = 'none';
+  showModal('airgap-acct-modal');
+}
+
+async function addAirgapAccount() {
+  const errEl = document.getElementById('airgap-acct-error');
+  const btn = document.getElementById('btn-airgap-acct-add');
+  errEl.style.display = 'none';
+  btn.disabled = true;
+  try {
+    const resp = await fetch('/api/accounts', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({
+        address: document.getElementById('airgap-acct-address').value.trim(),
+        label: document.getElementById('airgap-acct-label').value.trim() || 'Keystone',
+        kind: 'airgap',
+        path: document.getElementById('airgap-acct-path').value.trim(),
+        fingerprint: document.getElementById('airgap-acct-fingerprint').value.trim()
+      })
+    });
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'Failed to add the account');
+    hwAccounts.push(data);
+    hideModal('airgap-acct-modal');
+    renderAccounts();
+  } catch (err) {
+    errEl.textContent = err.message;
+    errEl.style.display = 'block';
+  } finally {
+    btn.disabled = false;
+  }
+}
+
+// airgapSign shows env's sign request and resolves with the signature once
+// the device's answer is scanned or pasted, or rejects on Cancel.
+async function airgapSign(env) {
+  const resp = await fetch('/api/tx/ur', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ envelope: env })
+  });
+  const data = await resp.json();
+  if (!resp.ok) throw new Error(data.error || 'HTTP ' + resp.status);
+  if (airgapPending) cancelAirgap();
+
+  document.getElementById('airgap-response').value = '';
+  document.getElementById('airgap-error').style.display = 'none';
+  const qrEl = document.getElementById('airgap-qr');
+  const partEl = document.getElementById('airgap-part');
+  let frame = 0;
+  const show = () => {
+    // The server's QR encoder returns SVG markup.
+    qrEl.innerHTML = data.qr[frame];
+    partEl.textContent = data.qr.length > 1 ? 'Part ' + (frame + 1) + ' of ' + data.qr.length : '';
+    frame = (frame + 1) % data.qr.length;
+  };
+  show();
+  return new Promise((resolve, reject) => {
+    airgapPending = { env, resolve, reject, timer: data.qr.length > 1 ? setInterval(show, 300) : null, stream: null, parts: new Map() };
+    showModal('airgap-modal');
+  });
+}
+
+// endAirgap stops the animation and the camera and closes the dialog.
+function endAirgap() {
+  const p = airgapPending;
+  airgapPending = null;
+  if (p.timer) clearInterval(p.timer);
+  stopAirgapCamera(p);
+  hideModal('airgap-modal');
+  return p;
+}
+
+function stopAirgapCamera(p) {
+  if (!p.stream) return;
+  p.stream.getTracks().forEach(t => t.stop());
+  p.stream = null;
+  p.parts.clear();
+  const video = document.getElementById('airgap-video');
+  video.srcObject = null;
+  video.style.display = 'none';
+}
+
+function cancelAirgap() {
+  if (airgapPending) endAirgap().reject(new Error('Signing cancelled.'));
+}
+
+// useAirgapSignature has the server decode the device's UR parts and check
+// that they answer this request.
+async function useAirgapSignature(parts) {
+  const p = airgapPending;
+  const errEl = document.getElementById('airgap-error');
+  errEl.style.display = 'none';
+  if (!p) return;
+  if (parts.length === 0) {
+    errEl.textContent = 'Scan or paste the signature the device shows.';
+    errEl.style.display = 'block';
+    return;
+  }
+  try {
+    const resp = await fetch('/api/tx/ur/signature', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ envelope: p.env, ur: parts })
+    });
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'HTTP ' + resp.status);
+    if (airgapPending === p) endAirgap().resolve(data);
+  } catch (err) {
+    errEl.textContent = err.message;
+    errEl.style.display = 'block';
+  }
+}
+
+// scanAirgap reads the device's signature code with the camera. Browsers
+// without BarcodeDetector can still paste the UR text.
+async function scanAirgap() {
+  const p = airgapPending;
+  const errEl = document.getElementById('airgap-error');
+  errEl.style.display = 'none';
+  if (!p || p.stream) return;
+  if (!('BarcodeDetector' in window) || !navigator.mediaDevices) {
+    errEl.textContent = 'This browser can\'t scan QR codes. Paste the signature text instead.';
+    errEl.style.display = 'block';
+    return;
+  }
+  try {
+    p.stream = await navigator.mediaDevices.getUserMedia({ video: { facingMode: 'environment' } });
+  } catch (err) {
+    errEl.textContent = 'Camera unavailable: ' + err.message;
+    errEl.style.display = 'block';
+    return;
+  }
+  if (airgapPending !== p) {
+    p.stream.getTracks().forEach(t => t.stop());
+    return;
+  }
+  // The device has scanned the request by now, and the part counter
+  // shows scanning progress instead.
+  if (p.timer) {
+    clearInterval(p.timer);
+    p.timer = null;
+  }
+  const stream = p.stream;
+  const video = document.getElementById('airgap-video');
+  video.srcObject = stream;
+  video.style.display = 'block';
+  await video.play();
+  const detector = new BarcodeDetector({ formats: ['qr_code'] });
+  while (airgapPending === p && p.stream === stream) {
+    let codes = [];
+    try {
+      codes = await detector.detect(video);
+    } catch (err) {
+      // Frames before the video starts can't be read.
+    }
+    for (const code of codes) {
+      const text = code.rawValue.trim().toLowerCase();
+      if (!text.startsWith('ur:')) continue;
+      // A single part is the whole signature; a multipart one is done when
+      // every part of its sequence has been seen. A signature the server
+      // refuses stops the camera rather than being sent again and again.
+      const seq = text.match(/^ur:[a-z0-9-]+\/(\d+)-(\d+)\//);
+      let parts = null;
+      if (!seq) {
+        parts = [text];
+      } else {
+        p.parts.set(text, Number(seq[1]));
+        const want = Number(seq[2]);
+        const have = new Set([...p.parts.values()].filter(n => n <= want));
+        document.getElementById('airgap-part').textContent = 'Scanned ' + have.size + ' of ' + want + ' parts';
+        if (have.size === want) parts = [...p.parts.keys()];
+      }
+      if (parts) {
+        await useAirgapSignature(parts);
+        stopAirgapCamera(p);
+        return;
+      }
+    }
+    await new Promise(r => setTimeout(r, 200));
+  }
+}
+
+// ── Endpoint Management ─────────────────────────────────
+async function showEndpointModal(editId) {
+  await loadAssets();
+  renderAssetOptions('');
+  document.getElementById('endpoint-edit-id').value = editId || '';
+  document.getElementById('endpoint-name').value = '';
+  document.getElementById('endpoint-url').value = '';
+  document.getElementById('endpoint-jwt').value = '';
+  document.getElementById('endpoint-timeout').value = '';
+  document.getElementById('endpoint-proxy').value = '';
+  document.getElementById('endpoint-poll-interval').value = '';
+  document.getElementById('endpoint-consensus').value = '';
+  document.getElementById('endpoint-checkpoint').value = '';
+  document.getElementById('endpoint-private').checked = false;
+  document.getElementById('endpoint-status-url').value = '';
+  document.getElementById('endpoint-confirmations').value = '';
+  document.getElementById('endpoint-error').style.display = 'none';
+  document.getElementById('endpoint-duplicate').style.display = 'none';
+  endpointDuplicate = null;
+
+  if (editId) {
+    const ep = endpoints.find(e => e.id === editId);
+    if (ep) {
+      document.getElementById('endpoint-name').value = ep.name;
+      document.getElementById('endpoint-url').value = ep.url;
+      renderAssetOptions(ep.asset);
+      if (ep.has_jwt) {
+        // Statuses only say there is a secret; managers fetch it to edit.
+        try {
+          const resp = await fetch('/api/endpoints/' + encodeURIComponent(ep.id) + '/jwt-secret');
+          if (resp.ok) document.getElementById('endpoint-jwt').value = (await resp.json()).jwt_secret || '';
+        } catch (e) {}
+      }
+      document.getElementById('endpoint-timeout').value = ep.timeout || '';
+      document.getElementById('endpoint-proxy').value = ep.proxy || '';
+      document.getElementById('endpoint-poll-interval').value = ep.poll_interval || '';
+      document.getElementById('endpoint-consensus').value = ep.consensus || '';
+      document.getElementById('endpoint-checkpoint').value = ep.checkpoint || '';
+      document.getElementById('endpoint-private').checked = !!ep.private;
+      document.getElementById('endpoint-status-url').value = ep.status_url || '';
+      document.getElementById('endpoint-confirmations').value = ep.confirmations || '';
+    }
+    document.getElementById('endpoint-modal-title').textContent = 'Edit Endpoint';
+    document.getElementById('btn-endpoint-save').textContent = 'Save';
+  } else {
+    document.getElementById('endpoint-modal-title').textContent = 'Add Endpoint';
+    document.getElementById('btn-endpoint-save').textContent = 'Add';
+  }
+  showModal('endpoint-modal');
+}
+
+function editEndpoint(id) {
+  showEndpointModal(id);
+}
+
+// endpointDuplicate holds the existing endpoint from a 409 response while the
+// user decides whether to merge into it or save anyway.
+let endpointDuplicate = null;
+
+async function saveEndpoint(force) {
+  const editId = document.getElementById('endpoint-edit-id').value;
+  const name = document.getElementById('endpoint-name').value.trim();
+  const url = document.getElementById('endpoint-url').value.trim();
+  const asset = document.getElementById('endpoint-asset').value;
+  const jwt_secret = document.getElementById('endpoint-jwt').value.trim();
+  const timeout = document.getElementById('endpoint-timeout').value.trim();
+  const proxy = document.getElementById('endpoint-proxy').value.trim();
+  const poll_interval = document.getElementById('endpoint-poll-interval').value.trim();
+  const consensus = document.getElementById('endpoint-consensus').value.trim();
+  const checkpoint = document.getElementById('endpoint-checkpoint').value.trim();
+  const isPrivate = document.getElementById('endpoint-private').checked;
+  const status_url = document.getElementById('endpoint-status-url').value.trim();
+  const confirmations = parseInt(document.getElementById('endpoint-confirmations').value, 10) || 0;
+  const errEl = document.getElementById('endpoint-error');
+  const dupEl = document.getElementById('endpoint-duplicate');
+  const btn = document.getElementById('btn-endpoint-save');
+  errEl.style.display = 'none';
+  dupEl.style.display = 'none';
+
+  if (!name || !url || !asset) {
+    errEl.textContent = 'Name, URL, and native currency are required.';
+    errEl.style.display = 'block';
+    return;
+  }
+
+  btn.disabled = true;
+  try {
+    const isEdit = !!editId;
+    const path = isEdit ? '/api/endpoints/' + editId : '/api/endpoints';
+    const resp = await fetch(path + (force === true ? '?force=true' : ''), {
+      method: isEdit ? 'PUT' : 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ name, url, asset, jwt_secret, timeout, proxy, poll_interval, consensus, checkpoint, private: isPrivate, status_url, confirmations })
+    });
+    const data = await resp.json();
+    if (resp.status === 409 && data.duplicate) {
+      endpointDuplicate = data.duplicate.existing;
+      document.getElementById('endpoint-duplicate-text').textContent =
+        'This ' + data.error + '. Polling both doubles the load on that node.';
+      dupEl.style.display = 'block';
+      return;
+    }
+    if (!resp.ok) {
+      errEl.textContent = data.error || 'Failed to save endpoint.';
+      errEl.style.display = 'block';
+      return;
+    }
+    hideModal('endpoint-modal');
+    refresh();
+  } catch (err) {
+    errEl.textContent = 'Request failed: ' + err.message;
+    errEl.style.display = 'block';
+  } finally {
+    btn.disabled = false;
+  }
+}
+
+// mergeIntoDuplicate applies the form's name and asset to the existing
+// endpoint instead of creating a second one.
+async function mergeIntoDuplicate() {
+  if (!endpointDuplicate) return;
+  const editId = document.getElementById('endpoint-edit-id').value;
+  const errEl = document.getElementById('endpoint-error');
+  const existing = endpointDuplicate;
+  const name = document.getElementById('endpoint-name').value.trim();
+  const asset = document.getElementById('endpoint-asset').value;
+  try {
+    const resp = await fetch('/api/endpoints/' + existing.id + '?force=true', {
+      method: 'PUT',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ name, url: existing.url, asset, jwt_secret: existing.jwt_secret, timeout: existing.timeout, proxy: existing.proxy, poll_interval: existing.poll_interval,
+        consensus: existing.consensus, checkpoint: existing.checkpoint, private: existing.private, status_url: existing.status_url,
+        confirmations: existing.confirmations })
+    });
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'Failed to update endpoint.');
+    if (editId && editId !== existing.id) {
+      await fetch('/api/endpoints/' + editId, { method: 'DELETE' });
+    }
+    hideModal('endpoint-modal');
+    refresh();
+  } catch (err) {
+    errEl.textContent = err.message;
+    errEl.style.display = 'block';
+  }
+}
+
+async function deleteEndpoint(id, name) {
+  try {
+    const resp = await fetch('/api/endpoints/' + id, { method: 'DELETE' });
+    const data = await resp.json();
+    if (!resp.ok) {
+      alert(data.error || 'Failed to delete endpoint.');
+      return;
+    }
+    refresh();
+    showUndoToast('Deleted ' + name, async () => {
+      await fetch('/api/endpoints/' + id + '/restore', { method: 'POST' });
+      refresh();
+    });
+  } catch (err) {
+    alert('Request failed: ' + err.message);
+  }
+}
+
+// ── Assets ─────────────────────────────────────────────
+async function loadAssets() {
+  try {
+    const resp = await fetch('/api/assets');
+    assets = resp.ok ? await resp.json() : [];
+  } catch (err) {
+    assets = [];
+  }
+}
+
+// renderAssetOptions fills the endpoint form's currency picker, keeping the
+// current choice unless selected names another.
+function renderAssetOptions(selected) {
+  const sel = document.getElementById('endpoint-asset');
+  selected = selected || sel.value;
+  sel.innerHTML = assets
+    .map(a => '<option value="' + esc(a.id) + '"' + (a.id === selected ? ' selected' : '') + '>' + esc(a.symbol) + '</option>')
+    .join('');
+}
+
+async function showAssetsModal() {
+  resetAssetForm();
+  document.getElementById('assets-error').style.display = 'none';
+  await loadAssets();
+  renderAssetList();
+  showModal('assets-modal');
+}
+
+function resetAssetForm() {
+  document.getElementById('asset-edit-id').value = '';
+  document.getElementById('asset-symbol').value = '';
+  document.getElementById('asset-symbol').disabled = false;
+  document.getElementById('asset-decimals').value = '18';
+  document.getElementById('asset-coingecko').value = '';
+  document.getElementById('asset-icon').value = '';
+  document.getElementById('btn-asset-save').textContent = 'Add Asset';
+}
+
+function renderAssetList() {
+  const listEl = document.getElementById('assets-list');
+  if (assets.length === 0) {
+    listEl.innerHTML = '<p class="trash-empty">No assets yet.</p>';
+    return;
+  }
+  listEl.innerHTML = assets.map(a =>
+    '<div class="asset-row">' +
+      '<img class="asset-icon" src="/api/icons/asset/' + encodeURIComponent(a.id) + '" alt="" onerror="this.remove()">' +
+      '<span class="asset-symbol">' + esc(a.symbol) + '</span>' +
+      '<span class="asset-meta">' + a.decimals + ' decimals' + (a.coingecko_id ? ' \u00b7 ' + esc(a.coingecko_id) : '') + '</span>' +
+      '<button class="btn-icon" onclick="editAsset(\'' + esc(a.id) + '\')" title="Edit">&#9998;</button>' +
+      '<button class="btn-icon danger" onclick="deleteAsset(\'' + esc(a.id) + '\')" title="Delete">&#10005;</button>' +
+    '</div>'
+  ).join('');
+}
+
+function editAsset(id) {
+  const a = assets.find(x => x.id === id);
+  if (!a) return;
+  document.getElementById('asset-edit-id').value = a.id;
+  document.getElementById('asset-symbol').value = a.symbol;
+  document.getElementById('asset-symbol').disabled = true;
+  document.getElementById('asset-decimals').value = a.decimals;
+  document.getElementById('asset-coingecko').value = a.coingecko_id || '';
+  document.getElementById('asset-icon').value = a.icon || '';
+  document.getElementById('btn-asset-save').textContent = 'Save';
+}
+
+async function saveAsset() {
+  const editId = document.getElementById('asset-edit-id').value;
+  const errEl = document.getElementById('assets-error');
+  const btn = document.getElementById('btn-asset-save');
+  errEl.style.display = 'none';
+  const body = {
+    symbol: document.getElementById('asset-symbol').value.trim(),
+    decimals: Number(document.getElementById('asset-decimals').value),
+    coingecko_id: document.getElementById('asset-coingecko').value.trim(),
+    icon: document.getElementById('asset-icon').value.trim()
+  };
+  btn.disabled = true;
+  try {
+    const resp = await fetch(editId ? '/api/assets/' + editId : '/api/assets', {
+      method: editId ? 'PUT' : 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify(body)
+    });
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'Failed to save asset.');
+    await loadAssets();
+    renderAssetList();
+    renderAssetOptions(editId ? '' : data.id);
+    resetAssetForm();
+    if (editId) refresh();
+  } catch (err) {
+    errEl.textContent = err.message;
+    errEl.style.display = 'block';
+  } finally {
+    btn.disabled = false;
+  }
+}
+
+async function deleteAsset(id) {
+  const errEl = document.getElementById('assets-error');
+  errEl.style.display = 'none';
+  try {
+    const resp = await fetch('/api/assets/' + id, { method: 'DELETE' });
+    if (!resp.ok) throw new Error((await resp.json()).error || 'Delete failed.');
+  } catch (err) {
+    errEl.textContent = err.message;
+    errEl.style.display = 'block';
+    return;
+  }
+  await loadAssets();
+  renderAssetList();
+  renderAssetOptions('');
+}
+
+// ── Accounts Section ────────────────────────────────────
+function renderAccounts() {
+  const container = document.getElementById('accounts-container');
+  const accounts = walletAccounts();
+  subscribePush();
+  if (accounts.length === 0 || endpoints.length === 0) {
+    container.innerHTML = '';
+    return;
+  }
+
+  let html = '<div class="acct-section-header"><h2>Accounts</h2>' + asOfControls() + '</div>';
+
+  for (const ep of endpoints) {
+    const isOpen = expandedAccounts.has(ep.id);
+    const [statusClass, statusLabel, statusTitle] = endpointState(ep);
+
+    html += '<div class="acct-card">';
+    html +=   '<div class="acct-card-header" onclick="toggleAccount(\'' + esc(ep.id) + '\')">';
+    html +=     '<span class="acct-name">';
+    html +=       '<span class="chevron' + (isOpen ? ' open' : '') + '">&#9654;</span> ';
+    html +=       esc(ep.name);
+    html +=     '</span>';
+    html +=     '<span class="' + statusClass + '" title="' + esc(statusTitle) + '">';
+    html +=       '<span class="status-dot"></span>';
+    html +=       '<span class="status-text">' + statusLabel + '</span>';
+    html +=     '</span>';
+    html +=   '</div>';
+
+    html +=   '<div class="acct-card-body' + (isOpen ? ' open' : '') + '">';
+
+    // Connection details
+    const chainId = ep.chain_id ? hexToDecimal(ep.chain_id) : '\u2014';
+    const blockNum = ep.block_number ? hexToDecimal(ep.block_number) : '\u2014';
+    const latencyClass = ep.latency_ms < 200 ? 'fast' : ep.latency_ms < 1000 ? 'medium' : 'slow';
+    html +=     '<div class="acct-detail-row">';
+    html +=       'RPC: <span class="mono">' + esc(abbreviateURL(ep.url)) + '</span>';
+    html +=       '<div class="detail-stats">';
+    html +=         '<span>Chain ID: ' + chainId + '</span>';
+    html +=         '<span>Block: ' + formatNumber(blockNum) + '</span>';
+    html +=         '<span class="latency ' + latencyClass + '">' + ep.latency_ms + ' ms</span>';
+    html +=       '</div>';
+    html +=     '</div>';
+
+    // Key sections
+    for (const k of accounts) {
+      const balKey = accountBalances[ep.id] && accountBalances[ep.id][k.address];
+      const balText = balKey || '...';
+      const balClass = balKey ? '' : ' loading';
+      const renameId = k.kind === 'local' ? k.id : k.address;
+
+      html +=   '<div class="acct-key-section">';
+      html +=     '<div class="acct-key-header">';
+      html +=       '<span class="key-label">' + esc(k.label) + (k.kind !== 'local' ? '<span class="hw-badge">' + esc(k.kind) + '</span>' : '') + '</span>';
+      html +=       '<span>';
+      html +=       '<button class="btn-rename" onclick="event.stopPropagation(); showNFTs(\'' + esc(ep.id) + '\', \'' + k.address + '\')">nfts</button>';
+      if (k.kind !== 'watch' && k.kind !== 'airgap') {
+        html +=     '<button class="btn-rename needs-operate" onclick="event.stopPropagation(); showPermitModal(\'' + esc(ep.id) + '\', \'' + k.address + '\')">permit</button>';
+      }
+      html +=       '<span class="needs-manage">';
+      if (k.kind === 'ledger' || k.kind === 'trezor') {
+        html +=       '<button class="btn-rename" onclick="event.stopPropagation(); verifyHardwareAddress(\'' + k.address + '\')">verify</button>';
+      }
+      html +=         '<button class="btn-rename acct-rename" data-id="' + esc(String(renameId)) + '" data-label="' + esc(k.label) + '">rename</button>';
+      if (k.kind === 'local') {
+        html +=       '<button class="btn-rename needs-operate" onclick="event.stopPropagation(); showRotateModal(' + k.id + ')">rotate</button>';
+        html +=       '<button class="btn-rename" onclick="event.stopPropagation(); removeKey(' + k.id + ')">remove</button>';
+      } else {
+        html +=       '<button class="btn-rename" onclick="event.stopPropagation(); removeHardwareAccount(\'' + k.address + '\')">remove</button>';
+      }
+      html +=       '</span></span>';
+      html +=     '</div>';
+      html +=     '<div class="acct-key-address">' + k.address + '</div>';
+      if (k.path) {
+        html +=   '<div class="acct-key-path">' + esc(k.path) + '</div>';
+      }
+      html +=     '<div class="acct-key-balance' + balClass + '" data-acct-bal="' + esc(ep.id) + '-' + esc(k.address) + '">' + balText + '</div>';
+      html +=     '<div class="acct-key-tokens" data-acct-tokens="' + esc(ep.id) + '-' + esc(k.address) + '">' + esc((tokenBalances[ep.id] && tokenBalances[ep.id][k.address]) || '') + '</div>';
+      html +=   '</div>';
+    }
+
+    // Add key button
+    html +=     '<div class="acct-add-key needs-operate">';
+    html +=       '<button class="btn" onclick="event.stopPropagation(); showAddKeyModal()">+ Add Key</button>';
+    html +=     '</div>';
+
+    html +=   '</div>'; // acct-card-body
+    html += '</div>';   // acct-card
+  }
+
+  container.innerHTML = html;
+  container.querySelectorAll('.acct-rename').forEach(btn => btn.addEventListener('click', e => {
+    e.stopPropagation();
+    showRenameModal(btn.dataset.id, btn.dataset.label);
+  }));
+
+  // Fetch balances for expanded cards. Over the push channel, latest
+  // balances arrive with each new block, so only missing ones are fetched.
+  for (const epId of expandedAccounts) {
+    const ep = endpoints.find(e => e.id === epId);
+    if (ep && ep.online && (!pushSocket || !accountBalances[epId])) fetchAccountBalances(epId);
+  }
+}
+
+function toggleAccount(epId) {
+  if (expandedAccounts.has(epId)) {
+    expandedAccounts.delete(epId);
+  } else {
+    expandedAccounts.add(epId);
+  }
+  renderAccounts();
+}
+
+// fetchAccountBalances reads every wallet account's balance on one endpoint
+// with a single GraphQL request.
+async function fetchAccountBalances(epId) {
+  const ep = endpoints.find(e => e.id === epId);
+  if (!ep || !ep.online) return;
+
+  if (!accountBalances[epId]) accountBalances[epId] = {};
+  const blockTag = balanceBlockTag(ep);
+  const accounts = walletAccounts();
+  if (accounts.length === 0) return;
+
+  const setText = (address, text, proof) => {
+    accountBalances[epId][address] = text;
+    const el = document.querySelector('[data-acct-bal="' + ep.id + '-' + address + '"]');
+    if (el) {
+      el.textContent = text;
+      el.classList.remove('loading');
+      markProof(el, proof);
+    }
+  };
+  if (blockTag === null) {
+    for (const k of accounts) setText(k.address, '\u2014 (bookmark is on another chain)');
+    return;
+  }
+
+  try {
+    const resp = await fetch('/graphql', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({
+        query: 'query($id: ID!, $addresses: [String!]!, $block: String) {' +
+          ' endpoint(id: $id) { balances(addresses: $addresses, block: $block) { wei proof { endpoint block status error } } } }',
+        variables: { id: epId, addresses: accounts.map(k => k.address), block: blockTag }
+      })
+    });
+    const data = await resp.json();
+    const balances = (data.data && data.data.endpoint && data.data.endpoint.balances) || [];
+    accounts.forEach((k, i) => {
+      const b = balances[i];
+      if (b) {
+        setText(k.address, provenText(formatAmount(b.wei, ep), b.proof), b.proof);
+      } else if (blockTag !== 'latest') {
+        setText(k.address, 'unavailable (archive node required?)');
+      }
+    });
+  } catch (err) {
+    console.error('account balance fetch failed:', err);
+  }
+  // Token balances are only read at the latest block.
+  if (blockTag === 'latest') fetchTokenBalances(epId, accounts);
+}
+
+// fetchTokenBalances shows each account's nonzero balances of the tokens
+// registered for the endpoint's chain.
+async function fetchTokenBalances(epId, accounts) {
+  if (!tokenBalances[epId]) tokenBalances[epId] = {};
+  await Promise.all(accounts.map(async k => {
+    try {
+      const resp = await fetch('/api/erc20/balances?endpoint=' + encodeURIComponent(epId) + '&address=' + encodeURIComponent(k.address));
+      if (!resp.ok) return;
+      const text = (await resp.json()).map(b => formatBalance(b.balance, b.decimals) + ' ' + b.symbol).join(', ');
+      tokenBalances[epId][k.address] = text;
+      const el = document.querySelector('[data-acct-tokens="' + epId + '-' + k.address + '"]');
+      if (el) el.textContent = text;
+    } catch (err) {
+      console.error('token balance fetch failed:', err);
+    }
+  }));
+}
+
+function showRenameModal(keyId, currentLabel) {
+  document.getElementById('rename-key-id').value = keyId;
+  document.getElementById('rename-key-label').value = currentLabel;
+  document.getElementById('rename-key-error').style.display = 'none';
+  showModal('rename-key-modal');
+  document.getElementById('rename-key-label').focus();
+}
+
+async function doRenameKey() {
+  const rawId = document.getElementById('rename-key-id').value;
+  const newLabel = document.getElementById('rename-key-label').value.trim();
+  const errEl = document.getElementById('rename-key-error');
+  const btn = document.getElementById('btn-rename-save');
+  errEl.style.display = 'none';
+
+  if (!newLabel) {
+    errEl.textContent = 'Label cannot be empty.';
+    errEl.style.display = 'block';
+    return;
+  }
+
+  btn.disabled = true;
+  try {
+    if (rawId.startsWith('0x')) {
+      await renameHardwareAccount(rawId, newLabel);
+    } else {
+      const keyId = parseInt(rawId, 10);
+      await updateKeyLabel(keyId, newLabel);
+      // Update in-memory
+      const dk = decryptedKeys.find(k => k.id === keyId);
+      if (dk) dk.label = newLabel;
+    }
+    hideModal('rename-key-modal');
+    renderWalletBar();
+    renderAccounts();
+  } catch (err) {
+    errEl.textContent = 'Failed: ' + err.message;
+    errEl.style.display = 'block';
+  } finally {
+    btn.disabled = false;
+  }
+}
+
+async function updateKeyLabel(id, newLabel) {
+  const db = await openVaultDB();
+  return new Promise((resolve, reject) => {
+    const tx = db.transaction('keys', 'readwrite');
+    const store = tx.objectStore('keys');
+    const req = store.get(id);
+    req.onsuccess = () => {
+      const rec = req.result;
+      if (!rec) { reject(new Error('Key not found')); return; }
+      rec.label = newLabel;
+      rec.dirty = true;
+      rec.updatedAt = Date.now();
+      store.put(rec);
+    };
+    tx.oncomplete = () => {
+      scheduleKeySync();
+      resolve();
+    };
     tx.onerror = () => reject(tx.error);
   });
 }
 
-async function getCredential() {
-  const db = await openVaultDB();
-  return new Promise((resolve, reject) => {
-    const tx = db.transaction('credentials', 'readonly');
-    const req = tx.objectStore('credentials').getAll();
-    req.onsuccess = () => resolve(req.result.length > 0 ? req.result[0] : null);
-    req.onerror = () => reject(req.error);
-  });
+// ── Logs ───────────────────────────────────────────────
+let logSource = null;   // EventSource while the logs modal is open
+let logsPaused = false;
+let logsHeld = [];      // entries received while paused
+
+async function showLogsModal() {
+  try {
+    const resp = await fetch('/api/logs?level=debug');
+    const data = await resp.json();
+    for (const sub of data.subsystems || []) addLogSubsystem(sub);
+  } catch (err) {
+    console.error('log subsystems fetch failed:', err);
+  }
+  showModal('logs-modal');
+  openLogStream();
+}
+
+function addLogSubsystem(sub) {
+  const sel = document.getElementById('logs-subsystem');
+  if (!sub || Array.from(sel.options).some(o => o.value === sub)) return;
+  const opt = document.createElement('option');
+  opt.value = sub;
+  opt.textContent = sub;
+  sel.appendChild(opt);
+}
+
+// openLogStream (re)connects with the current filters. The server replays
+// recent entries first, so the list is cleared on every (re)connect.
+function openLogStream() {
+  closeLogStream();
+  const params = new URLSearchParams({
+    level: document.getElementById('logs-level').value,
+    subsystem: document.getElementById('logs-subsystem').value
+  });
+  const stateEl = document.getElementById('logs-state');
+  logSource = new EventSource('/api/logs/stream?' + params);
+  logSource.onopen = () => {
+    document.getElementById('logs-list').innerHTML = '';
+    logsHeld = [];
+    stateEl.textContent = 'Live';
+  };
+  logSource.onerror = () => { stateEl.textContent = 'Reconnecting\u2026'; };
+  logSource.onmessage = (ev) => {
+    const entry = JSON.parse(ev.data);
+    addLogSubsystem(entry.subsystem);
+    if (logsPaused) {
+      logsHeld.push(entry);
+    } else {
+      appendLogEntries([entry]);
+    }
+  };
+}
+
+function closeLogStream() {
+  if (logSource) {
+    logSource.close();
+    logSource = null;
+  }
+}
+
+function toggleLogsPaused() {
+  logsPaused = !logsPaused;
+  document.getElementById('btn-logs-pause').textContent = logsPaused ? 'Resume' : 'Pause';
+  if (!logsPaused) {
+    appendLogEntries(logsHeld);
+    logsHeld = [];
+  }
+}
+
+function appendLogEntries(entries) {
+  const list = document.getElementById('logs-list');
+  const atBottom = list.scrollTop + list.clientHeight >= list.scrollHeight - 8;
+  for (const e of entries) {
+    const level = (e.level || '').toLowerCase();
+    const attrs = Object.entries(e.attrs || {}).map(([k, v]) => k + '=' + v).join(' ');
+    const line = document.createElement('div');
+    line.className = 'log-line log-' + level;
+    line.innerHTML =
+      '<span class="log-time">' + esc(new Date(e.time).toLocaleTimeString()) + '</span> ' +
+      '<span class="log-level">' + esc(e.level) + '</span>' +
+      (e.subsystem ? '<span class="log-sub">[' + esc(e.subsystem) + ']</span> ' : '') +
+      esc(e.msg) +
+      (attrs ? ' <span class="log-attrs">' + esc(attrs) + '</span>' : '');
+    list.appendChild(line);
+  }
+  while (list.childElementCount > 1000) list.firstElementChild.remove();
+  if (atBottom) list.scrollTop = list.scrollHeight;
+}
+
+// Stop streaming however the modal gets closed (button, overlay, Escape).
+new MutationObserver(() => {
+  if (!document.getElementById('logs-modal').classList.contains('active')) closeLogStream();
+}).observe(document.getElementById('logs-modal'), { attributes: true, attributeFilter: ['class'] });
+
+// ── Bookmarks ──────────────────────────────────────────
+async function loadBookmarks() {
+  try {
+    const resp = await fetch('/api/bookmarks');
+    bookmarks = resp.ok ? await resp.json() : [];
+  } catch (err) {
+    bookmarks = [];
+  }
+  if (asOfBookmark && !bookmarks.some(b => b.id === asOfBookmark)) asOfBookmark = '';
+}
+
+function bookmarkLabel(b) {
+  const date = new Date(b.timestamp).toLocaleDateString();
+  return (b.note || 'Block ' + b.block_number) + ' \u2014 ' + date;
+}
+
+function asOfControls() {
+  let html = '<div class="asof">As of ';
+  html += '<select class="key-selector" onchange="setAsOf(this.value)">';
+  html += '<option value="">Latest</option>';
+  for (const b of bookmarks) {
+    html += '<option value="' + esc(b.id) + '"' + (b.id === asOfBookmark ? ' selected' : '') + '>' + esc(bookmarkLabel(b)) + '</option>';
+  }
+  html += '</select>';
+  html += '<button class="btn" onclick="showBookmarksModal()">Bookmarks</button>';
+  html += '</div>';
+  return html;
+}
+
+function setAsOf(id) {
+  asOfBookmark = id;
+  accountBalances = {};
+  tokenBalances = {};
+  renderAccounts();
+}
+
+// balanceBlockTag returns the block to read balances at on ep: 'latest',
+// the bookmarked block, or null when the bookmark is for another chain.
+function balanceBlockTag(ep) {
+  const b = bookmarks.find(x => x.id === asOfBookmark);
+  if (!b) return 'latest';
+  if (!ep.chain_id || hexToDecimal(ep.chain_id) !== b.chain_id) return null;
+  return '0x' + b.block_number.toString(16);
+}
+
+function showBookmarksModal() {
+  document.getElementById('bm-endpoint').innerHTML = endpoints
+    .filter(ep => ep.online)
+    .map(ep => '<option value="' + esc(ep.id) + '">' + esc(ep.name) + '</option>')
+    .join('');
+  document.getElementById('bm-time').value = '';
+  document.getElementById('bm-block').value = '';
+  document.getElementById('bm-note').value = '';
+  document.getElementById('bookmarks-error').style.display = 'none';
+  renderBookmarkList();
+  showModal('bookmarks-modal');
+}
+
+function bookmarkModeChanged() {
+  const byBlock = document.getElementById('bm-mode').value === 'block';
+  document.getElementById('bm-block').style.display = byBlock ? '' : 'none';
+  document.getElementById('bm-time').style.display = byBlock ? 'none' : '';
+}
+
+function renderBookmarkList() {
+  const listEl = document.getElementById('bookmarks-list');
+  if (bookmarks.length === 0) {
+    listEl.innerHTML = '<p class="trash-empty">No bookmarks yet.</p>';
+    return;
+  }
+  listEl.innerHTML = bookmarks.map(b =>
+    '<div class="bm-row">' +
+      '<span class="bm-note">' + esc(b.note || 'Block ' + b.block_number) + '</span>' +
+      '<span class="bm-meta">chain ' + esc(b.chain_id) + ' \u00b7 block ' + formatNumber(b.block_number) +
+        ' \u00b7 ' + esc(new Date(b.timestamp).toLocaleString()) + '</span>' +
+      '<button class="btn-icon danger needs-manage" onclick="deleteBookmark(\'' + esc(b.id) + '\')" title="Delete">&#10005;</button>' +
+    '</div>'
+  ).join('');
+}
+
+async function addBookmark() {
+  const errEl = document.getElementById('bookmarks-error');
+  const btn = document.getElementById('btn-bm-add');
+  errEl.style.display = 'none';
+  const body = {
+    endpoint: document.getElementById('bm-endpoint').value,
+    note: document.getElementById('bm-note').value.trim()
+  };
+  if (document.getElementById('bm-mode').value === 'block') {
+    const n = document.getElementById('bm-block').value;
+    if (n === '') {
+      errEl.textContent = 'Enter a block number.';
+      errEl.style.display = 'block';
+      return;
+    }
+    body.block_number = Number(n);
+  } else {
+    const t = document.getElementById('bm-time').value;
+    if (!t) {
+      errEl.textContent = 'Choose a date and time.';
+      errEl.style.display = 'block';
+      return;
+    }
+    body.timestamp = new Date(t).toISOString();
+  }
+
+  btn.disabled = true;
+  try {
+    const resp = await fetch('/api/bookmarks', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify(body)
+    });
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'Failed to add bookmark.');
+    await loadBookmarks();
+    renderBookmarkList();
+    renderAccounts();
+    document.getElementById('bm-note').value = '';
+  } catch (err) {
+    errEl.textContent = err.message;
+    errEl.style.display = 'block';
+  } finally {
+    btn.disabled = false;
+  }
+}
+
+async function deleteBookmark(id) {
+  const b = bookmarks.find(x => x.id === id);
+  try {
+    const resp = await fetch('/api/bookmarks/' + id, { method: 'DELETE' });
+    if (!resp.ok) throw new Error((await resp.json()).error || 'Delete failed.');
+  } catch (err) {
+    alert('Request failed: ' + err.message);
+    return;
+  }
+  await loadBookmarks();
+  renderBookmarkList();
+  renderAccounts();
+  showUndoToast('Deleted bookmark ' + (b && b.note || ''), async () => {
+    await fetch('/api/bookmarks/' + id + '/restore', { method: 'POST' });
+    await loadBookmarks();
+    renderBookmarkList();
+    renderAccounts();
+  });
+}
+
+// ── Devnets ────────────────────────────────────────────
+let devnets = [];
+
+// loadDevnets looks for Anvil and Hardhat nodes on the server's devnet
+// URLs, once on load and after one is added.
+async function loadDevnets() {
+  try {
+    const resp = await fetch('/api/devnets');
+    devnets = resp.ok ? await resp.json() : [];
+  } catch (err) {
+    devnets = [];
+  }
+  renderDevnets();
+}
+
+// renderDevnets offers each node that isn't set up yet, no endpoint or dev
+// accounts not watched, and the test-chain controls of those with an
+// endpoint.
+function renderDevnets() {
+  const container = document.getElementById('devnets-container');
+  const pending = devnets.filter(n => !n.endpoint || n.watched.length < n.accounts.length);
+  container.innerHTML = devnets.map((n, i) => {
+    const product = n.kind === 'hardhat' ? 'Hardhat' : 'Anvil';
+    const funded = n.accounts.filter(a => a.balance && a.balance !== '0').length;
+    return '<div class="acct-card"><div class="acct-detail-row">' +
+      product + ' found at <span class="mono">' + esc(n.url) + '</span>' +
+      (n.endpoint ? ', endpoint ' + esc(n.endpoint) : '') +
+      '<div class="detail-stats">' +
+        '<span>chain ' + n.chain_id + '</span>' +
+        '<span>block ' + formatNumber(n.block) + '</span>' +
+        '<span>' + funded + ' funded dev accounts</span>' +
+        '<span>' + esc(n.client) + '</span>' +
+      '</div>' +
+      '<div class="devnet-actions">' +
+        (pending.includes(n) ?
+          '<label><input type="checkbox" id="devnet-watch-' + i + '"' + (n.endpoint ? ' checked disabled' : '') + '> Watch the dev accounts</label>' +
+          '<button class="btn btn-primary" onclick="addDevnet(' + i + ')">' + (n.endpoint ? 'Watch accounts' : 'Add endpoint') + '</button>' : '') +
+        (n.endpoint ? '<button class="btn" onclick="showDevnetModal(\'' + esc(n.endpoint) + '\')">Controls</button>' : '') +
+      '</div>' +
+    '</div></div>';
+  }).join('');
+}
+
+async function addDevnet(i) {
+  const n = devnets[i];
+  try {
+    const resp = await fetch('/api/devnets', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ url: n.url, watch: document.getElementById('devnet-watch-' + i).checked })
+    });
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'HTTP ' + resp.status);
+    showNotice((data.created ? 'Added ' + data.endpoint.name : data.endpoint.name + ' was already added') +
+      (data.watched.length ? '; watching ' + data.watched.length + ' dev accounts' : ''));
+    await refresh();
+    await loadDevnets();
+  } catch (err) {
+    alert('Adding the devnet failed: ' + err.message);
+  }
+}
+
+// devnetShown is the status of the endpoint whose test chain the devnet
+// modal controls.
+let devnetShown = null;
+
+async function showDevnetModal(epId) {
+  document.getElementById('devnet-error').style.display = 'none';
+  const ep = endpoints.find(e => e.id === epId);
+  document.getElementById('devnet-title').textContent = 'Test Chain \u2014 ' + (ep ? ep.name : epId);
+  document.getElementById('devnet-balance-label').textContent = 'Balance' + (ep && ep.symbol ? ', ' + ep.symbol : '');
+  devnetShown = { endpoint: epId };
+  showModal('devnet-modal');
+  await devnetRequest('GET', '');
+}
+
+// devnetRequest calls a route of the shown endpoint's /api/devnet group,
+// and shows the node's status it answers with.
+async function devnetRequest(method, path, body) {
+  const errEl = document.getElementById('devnet-error');
+  errEl.style.display = 'none';
+  try {
+    const opts = { method: method };
+    if (body) {
+      opts.headers = { 'Content-Type': 'application/json' };
+      opts.body = JSON.stringify(body);
+    }
+    const resp = await fetch('/api/devnet/' + encodeURIComponent(devnetShown.endpoint) + path, opts);
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'HTTP ' + resp.status);
+    if (data.chain_id) devnetShown = data;
+    renderDevnetModal();
+    return data;
+  } catch (err) {
+    errEl.textContent = err.message;
+    errEl.style.display = 'block';
+    return null;
+  }
+}
+
+function renderDevnetModal() {
+  const st = devnetShown;
+  if (!st.chain_id) return;
+  document.getElementById('devnet-status').innerHTML = [
+    ['Node', st.client],
+    ['Chain', String(st.chain_id)],
+    ['Block', formatNumber(st.block)],
+    ['Block time', new Date(st.timestamp * 1000).toLocaleString()]
+  ].map(r => '<div class="review-row"><span class="label">' + esc(r[0]) + '</span><span class="value">' + esc(r[1]) + '</span></div>').join('');
+  document.getElementById('devnet-snapshots').innerHTML = st.snapshots.length ? st.snapshots.map(sn =>
+    '<div class="sched-row">' +
+      '<span class="sched-name">' + esc(sn.name || 'Snapshot ' + sn.id) + '</span>' +
+      '<span class="sched-meta">block ' + formatNumber(sn.block) + ', ' + esc(new Date(sn.created_at).toLocaleTimeString()) + '</span>' +
+      '<button class="btn-icon admin-only" onclick="devnetRevert(\'' + esc(sn.id) + '\')" title="Revert to this snapshot">&#8630;</button>' +
+    '</div>'
+  ).join('') : '<p class="trash-empty">No snapshots.</p>';
+  document.getElementById('devnet-impersonated').innerHTML = st.impersonated.map(a =>
+    '<div class="sched-row">' +
+      '<span class="sched-name mono">' + esc(a) + '</span>' +
+      '<span class="sched-meta">impersonated</span>' +
+      '<button class="btn-icon danger admin-only" onclick="devnetImpersonate(\'' + esc(a) + '\', false)" title="Stop impersonating">&#10005;</button>' +
+    '</div>'
+  ).join('');
+}
+
+async function devnetSnapshot() {
+  const nameEl = document.getElementById('devnet-snapshot-name');
+  const snap = await devnetRequest('POST', '/snapshots', { name: nameEl.value.trim() });
+  if (!snap) return;
+  nameEl.value = '';
+  showNotice('Took snapshot ' + snap.id + ' at block ' + formatNumber(snap.block));
+  await devnetRequest('GET', '');
+}
+
+async function devnetRevert(id) {
+  if (!confirm('Revert the chain to snapshot ' + id + '? Later snapshots are dropped.')) return;
+  if (await devnetRequest('POST', '/snapshots/' + encodeURIComponent(id) + '/revert')) {
+    showNotice('Reverted to snapshot ' + id);
+    refresh();
+  }
+}
+
+async function devnetMine() {
+  const blocks = parseInt(document.getElementById('devnet-mine-blocks').value, 10) || 1;
+  const interval = parseInt(document.getElementById('devnet-mine-interval').value, 10) || 0;
+  if (await devnetRequest('POST', '/mine', { blocks: blocks, interval: interval })) {
+    showNotice('Mined ' + blocks + (blocks === 1 ? ' block' : ' blocks'));
+  }
+}
+
+async function devnetTime() {
+  const seconds = Math.round(parseFloat(document.getElementById('devnet-time-hours').value) * 3600);
+  if (!(seconds > 0)) {
+    alert('Enter how many hours to move the clock forward.');
+    return;
+  }
+  if (await devnetRequest('POST', '/time', { seconds: seconds, mine: true })) {
+    showNotice('Moved the clock ' + formatNumber(seconds) + ' seconds forward');
+  }
+}
+
+async function devnetSetBalance() {
+  const address = document.getElementById('devnet-balance-address').value.trim();
+  const balance = document.getElementById('devnet-balance-amount').value.trim();
+  if (!address || !balance) {
+    alert('Enter an address and a balance.');
+    return;
+  }
+  if (await devnetRequest('PUT', '/balances/' + encodeURIComponent(address), { balance: balance })) {
+    showNotice('Set the balance of ' + address);
+    refresh();
+  }
+}
+
+async function devnetImpersonate(address, on) {
+  if (!address) return;
+  if (await devnetRequest(on ? 'POST' : 'DELETE', '/impersonated/' + encodeURIComponent(address)) && on) {
+    document.getElementById('devnet-impersonate-address').value = '';
+  }
+}
+
+// ── Faucet ─────────────────────────────────────────────
+async function loadFaucet() {
+  try {
+    const resp = await fetch('/api/faucet');
+    faucetStatus = resp.ok ? await resp.json() : null;
+  } catch (err) {
+    faucetStatus = null;
+  }
+}
+
+function renderFaucet() {
+  const container = document.getElementById('faucet-container');
+  const f = faucetStatus;
+  if (!f) {
+    container.innerHTML = '';
+    return;
+  }
+  let html = '<div class="acct-section-header"><h2>Faucet</h2><a class="btn" href="/faucet" target="_blank">Public Page</a></div>';
+  html += '<div class="acct-card">';
+  html +=   '<div class="acct-detail-row">';
+  html +=     'Key: <span class="mono">' + esc(f.address) + '</span> on ' + esc(f.endpoint);
+  html +=     '<div class="detail-stats">';
+  html +=       '<span' + (f.low_balance ? ' class="faucet-low"' : '') + '>Balance: ' +
+                  (f.balance ? esc(f.balance) + ' ' + esc(f.symbol) : '\u2014') +
+                  (f.low_balance ? ' (low)' : '') + '</span>';
+  html +=       '<span>' + esc(f.amount) + ' ' + esc(f.symbol) + ' every ' + esc(f.interval) + '</span>';
+  html +=       '<span>' + f.dispensed + ' dispensed</span>';
+  html +=     '</div>';
+  html +=   '</div>';
+  for (const d of f.history) {
+    html += '<div class="acct-detail-row">';
+    html +=   '<span class="mono">' + esc(d.address) + '</span>';
+    html +=   '<div class="detail-stats">';
+    html +=     '<span class="mono" title="' + esc(d.tx_hash) + '">' + esc(d.tx_hash.slice(0, 18)) + '\u2026</span>';
+    html +=     '<span>' + esc(new Date(d.created_at).toLocaleString()) + '</span>';
+    html +=   '</div>';
+    html += '</div>';
+  }
+  html += '</div>';
+  container.innerHTML = html;
+}
+
+// ── Send ───────────────────────────────────────────────
+// Sending is two steps: Review builds the transaction on the server and
+// shows what it will do, and Confirm signs it (in the browser for local and
+// hardware keys, on the server for vault keys and remote signers).
+async function showSendModal(link) {
+  link = link || { action: 'send' };
+  sendMode = link.action;
+  sendEnvelope = null;
+
+  sendAccounts = await signingAccounts();
+  document.getElementById('send-from').innerHTML = sendAccounts
+    .map(a => '<option value="' + esc(a.address) + '">' + esc(a.label) + ' (' + esc(a.kind) + ') ' + esc(a.address) + '</option>')
+    .join('');
+  document.getElementById('send-endpoint').innerHTML = endpoints
+    .filter(ep => ep.online)
+    .map(ep => '<option value="' + esc(ep.id) + '">' + esc(ep.name) + '</option>')
+    .join('');
+
+  const errEl = document.getElementById('send-error');
+  errEl.style.display = 'none';
+  if (link.from) {
+    const a = sendAccounts.find(x => x.address.toLowerCase() === link.from.toLowerCase());
+    if (a) {
+      document.getElementById('send-from').value = a.address;
+    } else {
+      errEl.textContent = 'The link asks to send from ' + link.from + ', which is not one of your accounts.';
+      errEl.style.display = 'block';
+    }
+  }
+  let epId = link.endpoint;
+  if (!epId && link.chain_id) {
+    const ep = endpoints.find(e => e.online && e.chain_id && hexToDecimal(e.chain_id) === link.chain_id);
+    if (ep) {
+      epId = ep.id;
+    } else {
+      errEl.textContent = 'No online endpoint serves chain ' + link.chain_id + '.';
+      errEl.style.display = 'block';
+    }
+  }
+  if (epId) document.getElementById('send-endpoint').value = epId;
+
+  document.getElementById('send-title').textContent = sendMode === 'sign' ? 'Sign Transaction' : 'Send';
+  document.getElementById('send-link-warning').style.display = link.to ? 'block' : 'none';
+  document.getElementById('send-to').value = link.to || '';
+  document.getElementById('send-value').value = link.value || '';
+  document.getElementById('send-data').value = link.data || '';
+  document.getElementById('send-safe').value = link.safe || '';
+  document.getElementById('send-private').checked = false;
+  document.getElementById('send-private').parentElement.style.display = sendMode === 'sign' ? 'none' : '';
+  document.getElementById('send-result').style.display = 'none';
+  resetSendReview();
+  showModal('send-modal');
+}
+
+// signingAccounts returns the accounts that can sign: the wallet's local and
+// hardware keys plus the server's vault keys.
+async function signingAccounts() {
+  const out = walletAccounts().filter(a => a.kind !== 'watch');
+  try {
+    const resp = await fetch('/api/vault');
+    const v = resp.ok ? await resp.json() : null;
+    for (const k of (v && v.keys) || []) {
+      if (out.some(a => a.address.toLowerCase() === k.address.toLowerCase())) continue;
+      out.push({ label: k.label, address: k.address, kind: 'server vault' });
+    }
+  } catch (err) {
+    console.error('vault fetch failed:', err);
+  }
+  return out;
+}
+
+// resetSendReview discards a built transaction when any field changes, so
+// what is confirmed is always what was reviewed.
+function resetSendReview() {
+  sendEnvelope = null;
+  document.getElementById('send-warnings').style.display = 'none';
+  document.getElementById('send-review').style.display = 'none';
+  document.getElementById('send-confirm').style.display = 'none';
+  document.getElementById('send-confirm-to').value = '';
+  document.getElementById('send-confirm-value').value = '';
+  document.getElementById('btn-send').textContent = 'Review';
+}
+
+async function sendStep() {
+  const errEl = document.getElementById('send-error');
+  const btn = document.getElementById('btn-send');
+  errEl.style.display = 'none';
+  btn.disabled = true;
+  try {
+    if (sendEnvelope) {
+      await confirmSendTx();
+    } else {
+      await buildSendTx();
+    }
+  } catch (err) {
+    errEl.textContent = err.message;
+    errEl.style.display = 'block';
+  } finally {
+    btn.disabled = false;
+  }
+}
+
+async function buildSendTx() {
+  const from = document.getElementById('send-from').value;
+  const epId = document.getElementById('send-endpoint').value;
+  if (!from) throw new Error('No account to send from.');
+  if (!epId) throw new Error('No online endpoint to send through.');
+  const safeAddress = document.getElementById('send-safe').value.trim();
+  if (safeAddress) return buildSafeSend(safeAddress, from, epId);
+  const resp = await fetch('/api/tx/build', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({
+      endpoint: epId,
+      from: from,
+      to: document.getElementById('send-to').value.trim(),
+      value: parseUnits(document.getElementById('send-value').value || '0', endpoints.find(e => e.id === epId)),
+      data: document.getElementById('send-data').value.trim()
+    })
+  });
+  const env = await resp.json();
+  if (!resp.ok) throw new Error(env.error || 'build failed');
+
+  const review = document.getElementById('send-review');
+  const described = await Promise.all([describeContract(epId, env.tx.to), describeCalldata(env.tx.data)]);
+  review.innerHTML = reviewRows(env, described.flat());
+  review.style.display = 'block';
+  // Scam and address-poisoning checks against the recipients sent to
+  // before, and the risk scanner's findings.
+  const warnEl = document.getElementById('send-warnings');
+  warnEl.textContent = (env.warnings || []).map(warningText).join(' ');
+  warnEl.style.display = env.warnings ? 'block' : 'none';
+  // With RISK_BLOCK_CRITICAL the server refuses it, so don't offer to sign.
+  if (env.blocked) throw new Error('The server refuses transactions with a critical warning.');
+  // Above CONFIRM_THRESHOLD the server asks for the recipient and amount
+  // again; it checks them itself before signing with a server key.
+  document.getElementById('send-confirm').style.display = env.confirm_required ? 'block' : 'none';
+  sendEnvelope = env;
+  document.getElementById('btn-send').textContent = sendMode === 'sign' ? 'Confirm & Sign' : 'Confirm & Send';
+}
+
+// warningText is an envelope warning as shown in a review.
+function warningText(w) {
+  return (w.severity === 'critical' ? 'Critical: ' : '') + w.message;
+}
+
+// buildSafeSend builds the send as a transaction of a Safe that From owns,
+// for From to sign and propose. The Safe takes the nonce after its pending
+// transactions; the other owners sign it from the Safes dialog or the Safe
+// apps.
+async function buildSafeSend(address, from, epId) {
+  const ep = endpoints.find(e => e.id === epId);
+  const sg = await permitRequest('/api/safes/' + encodeURIComponent(address) + '/build', {
+    endpoint: epId,
+    tx: {
+      to: document.getElementById('send-to').value.trim(),
+      value: parseUnits(document.getElementById('send-value').value || '0', ep),
+      data: document.getElementById('send-data').value.trim()
+    }
+  });
+  const rows = [
+    ['Action', 'propose Safe transaction'],
+    ['Safe', sg.safe],
+    ['Signed by', from],
+    ['To', sg.tx.to],
+    ['Value', formatAmount(sg.tx.value, ep)],
+    ['Network', ep.name + ' (chain ' + sg.chain_id + ')'],
+    ['Safe nonce', String(sg.tx.nonce)],
+    ['Safe tx hash', sg.digest]
+  ].concat(await describeContract(epId, sg.tx.to), await describeCalldata(sg.tx.data));
+  const review = document.getElementById('send-review');
+  review.innerHTML = rows.map(r =>
+    '<div class="review-row"><span class="label">' + esc(r[0]) + '</span><span class="value">' + esc(r[1]) + '</span></div>'
+  ).join('');
+  review.style.display = 'block';
+  sendEnvelope = { safe_tx: sg, from: from, endpoint: epId };
+  document.getElementById('btn-send').textContent = 'Confirm & Propose';
+}
+
+// describeContract says whether the contract at address has verified
+// source, from the server's Sourcify and explorer lookups. Plain accounts,
+// and lookups that fail or take too long, show nothing.
+async function describeContract(epId, address) {
+  if (!address) return [];
+  try {
+    const resp = await fetch('/api/endpoints/' + encodeURIComponent(epId) + '/contracts/' + encodeURIComponent(address), { signal: AbortSignal.timeout(8000) });
+    if (!resp.ok) return [];
+    const c = await resp.json();
+    return [['Source', contractText(c)]];
+  } catch (err) {
+    return [];
+  }
+}
+
+// contractText sums up a contract lookup, e.g. "Router (sourcify, exact match)".
+function contractText(c) {
+  if (!c.verified) return 'not verified';
+  return (c.name || 'verified') + ' (' + c.source + (c.match ? ', ' + c.match + ' match' : '') + ')' +
+    (c.implementation ? ', proxy to ' + c.implementation : '');
+}
+
+// describeCalldata decodes calldata against the registered ABIs for the
+// review, or shows nothing when no registered function matches.
+async function describeCalldata(data) {
+  if (!data || data === '0x') return [];
+  try {
+    const resp = await fetch('/api/calldata/decode', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ data: data })
+    });
+    if (!resp.ok) return [];
+    return [['Call', formatCall(await resp.json())]];
+  } catch (err) {
+    return [];
+  }
+}
+
+// formatCall renders a decoded call as name(arg, ...) with its ABI.
+function formatCall(call) {
+  const name = call.function.slice(0, call.function.indexOf('('));
+  const args = call.args.map(a => typeof a === 'string' ? a : JSON.stringify(a));
+  return name + '(' + args.join(', ') + ') \u00b7 ' + call.abi + (call.verified ? '' : ' \u00b7 not canonical');
+}
+
+let abis = [];
+let calldataResult = null;
+
+// showCalldataModal opens the builder. Calldata already in the send dialog
+// is decoded to preselect its function and fill in its arguments.
+async function showCalldataModal() {
+  const errEl = document.getElementById('calldata-error');
+  errEl.style.display = 'none';
+  try {
+    const resp = await fetch('/api/abis');
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'HTTP ' + resp.status);
+    abis = data;
+  } catch (err) {
+    errEl.textContent = 'Failed to load ABIs: ' + err.message;
+    errEl.style.display = 'block';
+  }
+  const abiSel = document.getElementById('calldata-abi');
+  abiSel.innerHTML = abis.map(a => '<option value="' + esc(a.id) + '">' + esc(a.name) + '</option>').join('');
+  let decoded = null;
+  const current = document.getElementById('send-data').value.trim();
+  if (current && current !== '0x') {
+    const resp = await fetch('/api/calldata/decode', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ data: current })
+    });
+    if (resp.ok) decoded = await resp.json();
+  }
+  if (decoded) {
+    const a = abis.find(a => a.name === decoded.abi);
+    if (a) abiSel.value = a.id;
+  }
+  renderCalldataFunctions(decoded);
+  showModal('calldata-modal');
+}
+
+function calldataABI() {
+  return abis.find(a => a.id === document.getElementById('calldata-abi').value);
 }
 
-async function saveEncryptedKey(record) {
-  const db = await openVaultDB();
-  return new Promise((resolve, reject) => {
-    const tx = db.transaction('keys', 'readwrite');
-    tx.objectStore('keys').put(record);
-    tx.oncomplete = () => resolve();
-    tx.onerror = () => reject(tx.error);
-  });
+function renderCalldataFunctions(decoded) {
+  const a = calldataABI();
+  const fnSel = document.getElementById('calldata-function');
+  // View functions are listed too; their calldata works for eth_call.
+  fnSel.innerHTML = (a ? a.functions : []).map(f =>
+    '<option value="' + esc(f.signature) + '">' + esc(f.signature) + (f.stateMutability === 'view' || f.stateMutability === 'pure' ? ' \u00b7 view' : '') + '</option>'
+  ).join('');
+  if (decoded && decoded.function) fnSel.value = decoded.function;
+  renderCalldataInputs(decoded);
 }
 
-async function getEncryptedKeys() {
-  const db = await openVaultDB();
-  return new Promise((resolve, reject) => {
-    const tx = db.transaction('keys', 'readonly');
-    const req = tx.objectStore('keys').getAll();
-    req.onsuccess = () => resolve(req.result);
-    req.onerror = () => reject(req.error);
-  });
+function calldataFunction() {
+  const a = calldataABI();
+  const sig = document.getElementById('calldata-function').value;
+  return a ? a.functions.find(f => f.signature === sig) : null;
 }
 
-async function deleteEncryptedKey(id) {
-  const db = await openVaultDB();
-  return new Promise((resolve, reject) => {
-    const tx = db.transaction('keys', 'readwrite');
-    tx.objectStore('keys').delete(id);
-    tx.oncomplete = () => resolve();
-    tx.onerror = () => reject(tx.error);
-  });
+// renderCalldataInputs shows a field per argument. Arrays and tuples are
+// typed as JSON.
+function renderCalldataInputs(decoded) {
+  const f = calldataFunction();
+  calldataResult = null;
+  document.getElementById('btn-calldata-use').disabled = true;
+  document.getElementById('calldata-review').style.display = 'none';
+  const inputs = f ? f.inputs : [];
+  document.getElementById('calldata-inputs').innerHTML = inputs.map((p, i) => {
+    let value = '';
+    if (decoded && decoded.function === f.signature) {
+      const v = decoded.args[i];
+      value = typeof v === 'string' ? v : JSON.stringify(v);
+    }
+    return '<label for="calldata-arg-' + i + '">' + esc(p.name || 'argument ' + (i + 1)) + ' <span class="trash-kind">' + esc(p.type) + '</span></label>' +
+      '<input type="text" id="calldata-arg-' + i + '" value="' + esc(value) + '" placeholder="' + esc(calldataPlaceholder(p.type)) + '" autocomplete="off" spellcheck="false" oninput="resetCalldata()">';
+  }).join('');
 }
 
-// ── Crypto Helpers ─────────────────────────────────────
-async function deriveAESKeyFromPRF(prfOutput) {
-  const keyMaterial = await crypto.subtle.importKey(
-    'raw', prfOutput, 'HKDF', false, ['deriveKey']
-  );
-  return crypto.subtle.deriveKey(
-    { name: 'HKDF', salt: PRF_SALT, info: HKDF_INFO, hash: 'SHA-256' },
-    keyMaterial,
-    { name: 'AES-GCM', length: 256 },
-    false,
-    ['encrypt', 'decrypt']
-  );
+function calldataPlaceholder(type) {
+  if (type.endsWith(']') || type.startsWith('tuple')) return 'JSON, e.g. ["a", "b"]';
+  if (type === 'address') return '0x...';
+  if (type === 'bool') return 'true or false';
+  if (type.startsWith('bytes')) return '0x hex';
+  if (type.startsWith('uint') || type.startsWith('int')) return 'integer, decimal or 0x hex';
+  return '';
 }
 
-async function deriveAESKeyFromPassword(password, salt) {
-  const enc = new TextEncoder();
-  const keyMaterial = await crypto.subtle.importKey(
-    'raw', enc.encode(password), 'PBKDF2', false, ['deriveKey']
-  );
-  return crypto.subtle.deriveKey(
-    { name: 'PBKDF2', salt: salt, iterations: PBKDF2_ITERATIONS, hash: 'SHA-256' },
-    keyMaterial,
-    { name: 'AES-GCM', length: 256 },
-    false,
-    ['encrypt', 'decrypt']
-  );
+function resetCalldata() {
+  calldataResult = null;
+  document.getElementById('btn-calldata-use').disabled = true;
+  document.getElementById('calldata-review').style.display = 'none';
 }
 
-async function encryptPrivateKey(plaintext, key) {
-  const iv = crypto.getRandomValues(new Uint8Array(12));
-  const encoded = new TextEncoder().encode(plaintext);
-  const encrypted = await crypto.subtle.encrypt(
-    { name: 'AES-GCM', iv }, key, encoded
-  );
-  return { encrypted: new Uint8Array(encrypted), iv };
+// encodeCalldata has the server encode the call, then shows the arguments
+// decoded back from the result, so what is used is what the data says.
+async function encodeCalldata() {
+  const errEl = document.getElementById('calldata-error');
+  errEl.style.display = 'none';
+  const f = calldataFunction();
+  if (!f) return;
+  try {
+    const args = f.inputs.map((p, i) => {
+      const raw = document.getElementById('calldata-arg-' + i).value.trim();
+      if (p.type.endsWith(']') || p.type.startsWith('tuple')) {
+        try {
+          return JSON.parse(raw);
+        } catch (err) {
+          throw new Error((p.name || 'argument ' + (i + 1)) + ': not valid JSON');
+        }
+      }
+      return raw;
+    });
+    const resp = await fetch('/api/calldata/encode', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ abi: calldataABI().id, function: f.signature, args: args })
+    });
+    const call = await resp.json();
+    if (!resp.ok) throw new Error(call.error || 'encode failed');
+    const rows = [['Selector', call.selector]].concat(call.inputs.map((p, i) =>
+      [(p.name || 'argument ' + (i + 1)) + ' (' + p.type + ')', typeof call.args[i] === 'string' ? call.args[i] : JSON.stringify(call.args[i])]
+    ));
+    rows.push(['Round trip', call.verified ? 'verified' : 'mismatch']);
+    rows.push(['Data', call.data]);
+    const review = document.getElementById('calldata-review');
+    review.innerHTML = rows.map(r =>
+      '<div class="review-row"><span class="label">' + esc(r[0]) + '</span><span class="value">' + esc(r[1]) + '</span></div>'
+    ).join('');
+    review.style.display = 'block';
+    calldataResult = call.verified ? call : null;
+    document.getElementById('btn-calldata-use').disabled = !call.verified;
+  } catch (err) {
+    errEl.textContent = err.message;
+    errEl.style.display = 'block';
+  }
 }
 
-async function decryptPrivateKey(encrypted, iv, key) {
-  const decrypted = await crypto.subtle.decrypt(
-    { name: 'AES-GCM', iv }, key, encrypted
-  );
-  return new TextDecoder().decode(decrypted);
+function useCalldata() {
+  if (!calldataResult) return;
+  document.getElementById('send-data').value = calldataResult.data;
+  resetSendReview();
+  hideModal('calldata-modal');
 }
 
-// ── Biometric Setup ────────────────────────────────────
-async function setupBiometric() {
-  const errEl = document.getElementById('setup-error');
+// fillVerifiedABI fills in the registration form with the verified ABI of
+// the send dialog's recipient, for a proxy the ABI of its implementation.
+async function fillVerifiedABI() {
+  const errEl = document.getElementById('calldata-error');
   errEl.style.display = 'none';
-
-  if (!window.PublicKeyCredential) {
-    errEl.textContent = 'WebAuthn is not available in this browser. Use password setup instead.';
+  try {
+    const epId = document.getElementById('send-endpoint').value;
+    const address = document.getElementById('send-to').value.trim();
+    if (!epId || !address) throw new Error('Enter the contract as the recipient first.');
+    let c = await fetchContract(epId, address);
+    if (c.implementation) c = await fetchContract(epId, c.implementation);
+    if (!c.verified || !c.abi) throw new Error(address + ' has no verified ABI.');
+    document.getElementById('abi-name').value = c.name || '';
+    document.getElementById('abi-json').value = JSON.stringify(c.abi);
+  } catch (err) {
+    errEl.textContent = err.message;
     errEl.style.display = 'block';
-    return;
   }
+}
+
+async function fetchContract(epId, address) {
+  const resp = await fetch('/api/endpoints/' + encodeURIComponent(epId) + '/contracts/' + encodeURIComponent(address));
+  const data = await resp.json();
+  if (!resp.ok) throw new Error(data.error || 'lookup failed');
+  return data;
+}
 
+async function addABI() {
+  const errEl = document.getElementById('calldata-error');
+  errEl.style.display = 'none';
   try {
-    // 1. Create credential with PRF extension.
-    const userId = crypto.getRandomValues(new Uint8Array(32));
-    const credential = await navigator.credentials.create({
-      publicKey: {
-        rp: { name: 'Wallet', id: location.hostname },
-        user: {
-          id: userId,
-          name: 'wallet-user',
-          displayName: 'Wallet User'
-        },
-        challenge: crypto.getRandomValues(new Uint8Array(32)),
-        pubKeyCredParams: [
-          { type: 'public-key', alg: -7 },
-          { type: 'public-key', alg: -257 }
-        ],
-        authenticatorSelection: {
-          residentKey: 'preferred',
-          userVerification: 'required'
-        },
-        extensions: { prf: {} }
-      }
+    let abi;
+    try {
+      abi = JSON.parse(document.getElementById('abi-json').value);
+    } catch (err) {
+      throw new Error('The ABI is not valid JSON.');
+    }
+    const resp = await fetch('/api/abis', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ name: document.getElementById('abi-name').value.trim(), abi: abi })
     });
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'register failed');
+    document.getElementById('abi-name').value = '';
+    document.getElementById('abi-json').value = '';
+    await showCalldataModal();
+    document.getElementById('calldata-abi').value = data.id;
+    renderCalldataFunctions();
+  } catch (err) {
+    errEl.textContent = err.message;
+    errEl.style.display = 'block';
+  }
+}
 
-    // 2. Try PRF eval regardless of prf.enabled — some browsers
-    //    (Safari) report enabled:false but support PRF at assertion time.
-    const transports = credential.response.getTransports ? credential.response.getTransports() : [];
-
-    const assertion = await navigator.credentials.get({
-      publicKey: {
-        challenge: crypto.getRandomValues(new Uint8Array(32)),
-        rpId: location.hostname,
-        allowCredentials: [{
-          type: 'public-key',
-          id: credential.rawId,
-          transports: transports
-        }],
-        userVerification: 'required',
-        extensions: {
-          prf: { eval: { first: PRF_SALT } }
-        }
-      }
+// reviewRows renders the decoded preview of a built envelope.
+function reviewRows(env, extra) {
+  const sum = env.summary;
+  const ep = endpoints.find(e => e.id === env.endpoint);
+  const rows = [
+    ['Action', sum.action],
+    ['From', labeledAddress(env, env.from)],
+    ['To', env.tx.to ? labeledAddress(env, env.tx.to) : '(contract creation)'],
+    ['Value', sum.value],
+    ['Max fee', sum.max_fee],
+    ['Network', (ep ? ep.name : env.endpoint) + ' (chain ' + hexToDecimal(env.chain_id) + ')'],
+    ['Nonce', hexToDecimal(env.tx.nonce)]
+  ];
+  if (sum.l1_fee) rows.push(['L1 data fee', sum.l1_fee + (env.l1_fee.included ? ' (in gas)' : ' (added to max fee)')]);
+  if (sum.recipient) rows.push([sum.action === 'approve' ? 'Spender' : 'Token recipient', labeledAddress(env, sum.recipient)]);
+  if (sum.amount) rows.push(['Token amount (raw)', sum.amount]);
+  if (sum.method) rows.push(['Method', sum.method]);
+  return rows.concat(extra || []).map(r =>
+    '<div class="review-row"><span class="label">' + esc(r[0]) + '</span><span class="value">' + esc(r[1]) + '</span></div>'
+  ).join('');
+}
+
+// labeledAddress is address followed by the name and tags the profile
+// gave it, from the envelope's labels.
+function labeledAddress(env, address) {
+  const l = (env.labels || []).find(l => l.address.toLowerCase() === address.toLowerCase());
+  if (!l) return address;
+  const parts = [l.name, (l.tags || []).map(t => '#' + t).join(' ')].filter(Boolean);
+  return address + ' (' + parts.join(' ') + ')';
+}
+
+async function confirmSendTx() {
+  const env = sendEnvelope;
+  if (env.safe_tx) return confirmSafeSend(env);
+  const acct = sendAccounts.find(a => a.address.toLowerCase() === env.from.toLowerCase());
+  const broadcast = sendMode === 'send';
+  const isPrivate = broadcast && document.getElementById('send-private').checked;
+  const confirm = env.confirm_required ? {
+    to_suffix: document.getElementById('send-confirm-to').value.trim(),
+    value: document.getElementById('send-confirm-value').value.trim()
+  } : undefined;
+  let resp;
+  if (acct && (acct.kind === 'local' || acct.kind === 'ledger' || acct.kind === 'trezor' || acct.kind === 'airgap')) {
+    if (confirm) checkSendConfirmation(env, confirm);
+    const signature = await signInBrowser(acct, env);
+    resp = await fetch('/api/tx/import', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ envelope: env, signature: signature, broadcast: broadcast, private: isPrivate })
+    });
+  } else {
+    resp = await fetch('/api/tx/sign', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ envelope: env, broadcast: broadcast, private: isPrivate, confirm: confirm })
     });
+  }
+  const data = await resp.json();
+  if (!resp.ok) throw new Error(data.error || 'signing failed');
+  const signed = data.signed || data;
+
+  resetSendReview();
+  const resultEl = document.getElementById('send-result');
+  resultEl.style.display = 'block';
+  if (resp.status === 202) {
+    // REQUIRE_APPROVAL is on: the server queued it instead of signing.
+    resultEl.textContent = 'Queued for approval (' + data.approval.id + ').';
+    loadApprovals();
+  } else if (broadcast) {
+    resultEl.textContent = (data.private_endpoint ? 'Sent privately: ' : 'Sent: ') + signed.hash;
+    watchTx(env.endpoint, signed.hash, resultEl);
+  } else {
+    resultEl.textContent = 'Signed (not broadcast): ' + signed.raw;
+  }
+}
 
-    const exts = assertion.getClientExtensionResults();
-    if (!exts.prf || !exts.prf.results || !exts.prf.results.first) {
-      errEl.textContent = 'Your authenticator does not support PRF encryption. Use password setup instead.';
-      errEl.style.display = 'block';
-      return;
-    }
+// confirmSafeSend signs a reviewed Safe transaction as its owner and
+// proposes it to the Transaction Service.
+async function confirmSafeSend(env) {
+  const sg = env.safe_tx;
+  const acct = sendAccounts.find(a => a.address.toLowerCase() === env.from.toLowerCase());
+  let data;
+  if (acct && (acct.kind === 'local' || acct.kind === 'ledger' || acct.kind === 'trezor')) {
+    const signature = await signPermitInBrowser(acct, sg);
+    data = await permitRequest('/api/safes/' + sg.safe + '/propose', { endpoint: env.endpoint, tx: sg.tx, signature: signature });
+  } else {
+    data = await permitRequest('/api/safes/sign', { endpoint: env.endpoint, safe: sg.safe, tx: sg.tx, owner: env.from });
+  }
+  resetSendReview();
+  const resultEl = document.getElementById('send-result');
+  resultEl.style.display = 'block';
+  resultEl.textContent = 'Proposed to the Safe: ' + data.safe_tx_hash + '. It runs once enough owners have signed.';
+}
+
+// checkSendConfirmation applies the server's large-send check before a key
+// in the browser signs, since the server never sees that signature request.
+// Token transfers repeat the token recipient and amount, as env.confirm says.
+function checkSendConfirmation(env, confirm) {
+  const ep = endpoints.find(e => e.id === env.endpoint);
+  const want = env.confirm || { to: env.tx.to || '', amount: BigInt(env.tx.value).toString(), decimals: (ep && ep.decimals) ?? 18 };
+  const to = want.to.toLowerCase().replace(/^0x/, '');
+  if (confirm.to_suffix.toLowerCase().replace(/^0x/, '') !== to.slice(-6)) {
+    throw new Error('Confirmation does not match: the recipient address ends differently.');
+  }
+  if (!want.amount) return;
+  let typed;
+  try {
+    typed = BigInt(parseUnits(confirm.value, { decimals: want.decimals }));
+  } catch {
+    throw new Error('Confirmation does not match: the amount is not a number.');
+  }
+  if (typed !== BigInt(want.amount)) throw new Error('Confirmation does not match: the amount differs.');
+}
 
-    // 3. PRF works — derive AES key and store credential.
-    aesKey = await deriveAESKeyFromPRF(exts.prf.results.first);
+// signInBrowser signs an envelope with a local key, a hardware wallet, or
+// an air-gapped one, and returns the signature in the form /api/tx/import
+// takes.
+async function signInBrowser(acct, env) {
+  if (acct.kind === 'airgap') return airgapSign(env);
+  if (acct.kind === 'ledger') {
+    const sig = await ledgerSignTransaction(acct.path, hexToBytes(env.signing_payload));
+    return { y_parity: '0x' + sig.v.toString(16), r: sig.r, s: sig.s };
+  }
+  if (acct.kind === 'trezor') {
+    const t = env.tx;
+    const sig = await trezorSignTransaction(acct.path, {
+      to: t.to,
+      value: t.value,
+      gasLimit: t.gas,
+      nonce: t.nonce,
+      data: t.data || '0x',
+      chainId: parseInt(env.chain_id, 16),
+      maxFeePerGas: t.max_fee_per_gas,
+      maxPriorityFeePerGas: t.max_priority_fee_per_gas
+    });
+    return { y_parity: sig.v, r: sig.r, s: sig.s };
+  }
+  const k = decryptedKeys.find(x => x.address.toLowerCase() === env.from.toLowerCase());
+  if (!k || !k.key) throw new Error('Unlock the wallet to sign with this key.');
+  await ensureEthers();
+  const sig = new ethers.SigningKey(k.key.startsWith('0x') ? k.key : '0x' + k.key).sign(env.hash_to_sign);
+  return { y_parity: '0x' + sig.yParity.toString(16), r: sig.r, s: sig.s };
+}
 
-    await saveCredential({
-      id: 'primary',
-      method: 'prf',
-      credentialId: Array.from(new Uint8Array(credential.rawId)),
-      rpId: location.hostname,
-      transports: transports,
-      createdAt: Date.now()
+// ── Schedules ──────────────────────────────────────────
+// Schedules live on the server, which builds each run when it comes due.
+// Approve-mode runs wait in the queue here and are rebuilt with a fresh
+// nonce when approved; the server pushes schedule_run as runs change.
+async function loadSchedules() {
+  try {
+    const [sResp, rResp] = await Promise.all([fetch('/api/schedules'), fetch('/api/schedules/runs')]);
+    schedules = sResp.ok ? await sResp.json() : [];
+    scheduleRuns = rResp.ok ? await rResp.json() : [];
+  } catch (err) {
+    schedules = [];
+    scheduleRuns = [];
+  }
+  const pending = scheduleRuns.filter(r => r.status === 'pending').length;
+  document.getElementById('schedules-badge').textContent = pending ? String(pending) : '';
+  if (document.getElementById('schedules-modal').classList.contains('active')) renderSchedules();
+}
+
+async function showSchedulesModal() {
+  // Only keys the server can sign with: vault keys and remote signers.
+  const froms = [];
+  try {
+    const resp = await fetch('/api/vault');
+    const v = resp.ok ? await resp.json() : null;
+    for (const k of (v && v.keys) || []) froms.push({ label: k.label, address: k.address, kind: 'server vault' });
+  } catch (err) {
+    console.error('vault fetch failed:', err);
+  }
+  for (const a of hwAccounts) {
+    if (a.kind !== 'ledger' && a.kind !== 'trezor' && a.kind !== 'airgap' && a.kind !== 'watch') froms.push(a);
+  }
+  document.getElementById('sched-from').innerHTML = froms.length
+    ? froms.map(a => '<option value="' + esc(a.address) + '">' + esc(a.label) + ' (' + esc(a.kind) + ') ' + esc(a.address) + '</option>').join('')
+    : '<option value="">No server vault keys or remote signers</option>';
+  document.getElementById('sched-endpoint').innerHTML = endpoints
+    .map(ep => '<option value="' + esc(ep.id) + '">' + esc(ep.name) + '</option>')
+    .join('');
+  document.getElementById('schedules-error').style.display = 'none';
+  document.getElementById('schedules-result').style.display = 'none';
+  await loadSchedules();
+  renderSchedules();
+  showModal('schedules-modal');
+}
+
+function renderSchedules() {
+  const epFor = id => endpoints.find(e => e.id === id);
+
+  const pending = scheduleRuns.filter(r => r.status === 'pending');
+  document.getElementById('sched-pending').innerHTML = pending.length ? pending.map(r => {
+    const ep = epFor(r.envelope.endpoint);
+    return '<div class="sched-row">' +
+      '<span class="sched-name">' + esc(r.name) + ' \u2014 ' + esc(formatAmount(r.envelope.tx.value, ep)) + ' to ' + esc(r.envelope.tx.to || '') + '</span>' +
+      '<span class="sched-meta">due ' + esc(new Date(r.due_at).toLocaleString()) + ' \u00b7 ' + esc(r.envelope.summary.action) +
+        (r.missed ? ' \u00b7 missed while the server was down' : '') + '</span>' +
+      '<button class="btn btn-primary admin-only" onclick="decideRun(\'' + esc(r.id) + '\', \'approve\', this)">Approve</button>' +
+      '<button class="btn admin-only" onclick="decideRun(\'' + esc(r.id) + '\', \'reject\', this)">Reject</button>' +
+    '</div>';
+  }).join('') : '<p class="trash-empty">Nothing is waiting for approval.</p>';
+
+  document.getElementById('sched-list').innerHTML = schedules.length ? schedules.map(sc => {
+    const next = sc.paused ? 'paused' : sc.next_run ? 'next ' + new Date(sc.next_run).toLocaleString() : 'never fires';
+    return '<div class="sched-row">' +
+      '<span class="sched-name">' + esc(sc.name) + ' \u2014 ' + esc(formatAmount(sc.value, epFor(sc.endpoint))) + ' to ' + esc(sc.to) + '</span>' +
+      '<span class="sched-meta mono">' + esc(sc.spec) + '</span>' +
+      '<span class="sched-meta">' + esc(sc.mode) + ' \u00b7 ' + esc(next) + '</span>' +
+      '<button class="btn admin-only" onclick="toggleSchedulePaused(\'' + esc(sc.id) + '\')">' + (sc.paused ? 'Resume' : 'Pause') + '</button>' +
+      '<button class="btn-icon danger admin-only" onclick="deleteSchedule(\'' + esc(sc.id) + '\')" title="Delete">&#10005;</button>' +
+    '</div>';
+  }).join('') : '<p class="trash-empty">No schedules yet.</p>';
+
+  const finished = scheduleRuns.filter(r => r.status !== 'pending').slice(0, 10);
+  document.getElementById('sched-runs').innerHTML = finished.length ? finished.map(r =>
+    '<div class="sched-row">' +
+      '<span class="sched-name">' + esc(r.name) + ' \u00b7 ' + esc(new Date(r.due_at).toLocaleString()) + '</span>' +
+      '<span class="sched-meta">' + esc(r.hash || r.error || '') + '</span>' +
+      '<span class="sched-status ' + esc(r.status) + '">' + esc(r.status) + '</span>' +
+    '</div>'
+  ).join('') : '<p class="trash-empty">No runs yet.</p>';
+}
+
+async function addSchedule() {
+  const errEl = document.getElementById('schedules-error');
+  const btn = document.getElementById('btn-sched-add');
+  errEl.style.display = 'none';
+  btn.disabled = true;
+  try {
+    const resp = await fetch('/api/schedules', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({
+        name: document.getElementById('sched-name').value.trim(),
+        spec: document.getElementById('sched-spec').value.trim(),
+        mode: document.getElementById('sched-mode').value,
+        endpoint: document.getElementById('sched-endpoint').value,
+        from: document.getElementById('sched-from').value,
+        to: document.getElementById('sched-to').value.trim(),
+        value: parseUnits(document.getElementById('sched-value').value || '0', endpoints.find(e => e.id === document.getElementById('sched-endpoint').value)),
+        data: document.getElementById('sched-data').value.trim()
+      })
     });
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'Failed to add schedule.');
+    for (const id of ['sched-name', 'sched-spec', 'sched-to', 'sched-value', 'sched-data']) {
+      document.getElementById(id).value = '';
+    }
+    await loadSchedules();
+    renderSchedules();
+  } catch (err) {
+    errEl.textContent = err.message;
+    errEl.style.display = 'block';
+  } finally {
+    btn.disabled = false;
+  }
+}
 
-    credMethod = 'prf';
-    walletState = 'unlocked';
-    decryptedKeys = [];
-    storedKeyCount = 0;
-    renderWalletBar();
-    hideModal('setup-modal');
-    showModal('addkey-modal');
+async function toggleSchedulePaused(id) {
+  const sc = schedules.find(x => x.id === id);
+  if (!sc) return;
+  const errEl = document.getElementById('schedules-error');
+  errEl.style.display = 'none';
+  try {
+    const resp = await fetch('/api/schedules/' + id, {
+      method: 'PUT',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify(Object.assign({}, sc, { paused: !sc.paused }))
+    });
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'Update failed.');
+  } catch (err) {
+    errEl.textContent = err.message;
+    errEl.style.display = 'block';
+  }
+  await loadSchedules();
+  renderSchedules();
+}
 
+async function deleteSchedule(id) {
+  const sc = schedules.find(x => x.id === id);
+  try {
+    const resp = await fetch('/api/schedules/' + id, { method: 'DELETE' });
+    if (!resp.ok) throw new Error((await resp.json()).error || 'Delete failed.');
   } catch (err) {
-    if (err.name === 'NotAllowedError') {
-      errEl.textContent = 'Biometric prompt was cancelled or timed out.';
-    } else {
-      errEl.textContent = err.message;
+    alert('Request failed: ' + err.message);
+    return;
+  }
+  await loadSchedules();
+  renderSchedules();
+  showUndoToast('Deleted schedule ' + (sc ? sc.name : ''), async () => {
+    await fetch('/api/schedules/' + id + '/restore', { method: 'POST' });
+    await loadSchedules();
+  });
+}
+
+// decideRun approves (signs and broadcasts) or rejects a pending run.
+async function decideRun(id, action, btn) {
+  const errEl = document.getElementById('schedules-error');
+  const resultEl = document.getElementById('schedules-result');
+  errEl.style.display = 'none';
+  btn.disabled = true;
+  try {
+    const resp = await fetch('/api/schedules/runs/' + id + '/' + action, {
+      method: 'POST',
+      headers: action === 'approve' ? { 'Idempotency-Key': 'approve-' + id } : {}
+    });
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'Request failed.');
+    if (data.hash) {
+      resultEl.textContent = 'Sent: ' + data.hash;
+      resultEl.style.display = 'block';
+      watchTx(data.envelope.endpoint, data.hash, resultEl);
+    }
+  } catch (err) {
+    errEl.textContent = err.message;
+    errEl.style.display = 'block';
+  } finally {
+    btn.disabled = false;
+  }
+  await loadSchedules();
+  renderSchedules();
+}
+
+// ── Bridges ────────────────────────────────────────────
+// The server tracks each registered transfer from its source receipt to
+// its arrival on the destination, and pushes bridge as transfers move on.
+async function loadBridges() {
+  try {
+    const resp = await fetch('/api/bridges');
+    bridges = resp.ok ? await resp.json() : [];
+  } catch {
+    bridges = [];
+  }
+  const moving = bridges.filter(t => t.status === 'pending' || t.status === 'in_flight').length;
+  document.getElementById('bridges-badge').textContent = moving ? String(moving) : '';
+  if (document.getElementById('bridges-modal').classList.contains('active')) renderBridges();
+}
+
+async function showBridgesModal() {
+  const options = endpoints
+    .map(ep => '<option value="' + esc(ep.id) + '">' + esc(ep.name) + '</option>')
+    .join('');
+  document.getElementById('bridge-source').innerHTML = options;
+  document.getElementById('bridge-dest').innerHTML = options;
+  if (endpoints.length > 1) document.getElementById('bridge-dest').selectedIndex = 1;
+  document.getElementById('bridges-error').style.display = 'none';
+  await loadBridges();
+  renderBridges();
+  showModal('bridges-modal');
+}
+
+function renderBridges() {
+  const epName = id => (endpoints.find(e => e.id === id) || { name: id }).name;
+  const amount = t => {
+    if (!t.received) return '';
+    const ep = endpoints.find(e => e.id === t.dest_endpoint);
+    return t.token ? t.received + ' of ' + t.token : formatAmount(t.received, ep);
+  };
+  document.getElementById('bridge-list').innerHTML = bridges.length ? bridges.map(t =>
+    '<div class="sched-row">' +
+      '<span class="sched-name">' + esc(t.name || t.source_hash) + ' \u2014 ' + esc(epName(t.source_endpoint)) + ' \u2192 ' + esc(epName(t.dest_endpoint)) + '</span>' +
+      '<span class="sched-meta">' + esc(t.error || amount(t) || new Date(t.created_at).toLocaleString()) + '</span>' +
+      '<span class="sched-status ' + esc(t.status) + '">' + esc(t.status.replace('_', ' ')) + '</span>' +
+      '<button class="btn-icon danger needs-operate" onclick="deleteBridge(\'' + esc(t.id) + '\')" title="Stop tracking">&#10005;</button>' +
+    '</div>'
+  ).join('') : '<p class="trash-empty">No bridge transfers tracked.</p>';
+}
+
+async function addBridge() {
+  const errEl = document.getElementById('bridges-error');
+  const btn = document.getElementById('btn-bridge-add');
+  errEl.style.display = 'none';
+  btn.disabled = true;
+  try {
+    const resp = await fetch('/api/bridges', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({
+        name: document.getElementById('bridge-name').value.trim(),
+        source_endpoint: document.getElementById('bridge-source').value,
+        source_hash: document.getElementById('bridge-hash').value.trim(),
+        dest_endpoint: document.getElementById('bridge-dest').value,
+        recipient: document.getElementById('bridge-recipient').value.trim(),
+        token: document.getElementById('bridge-token').value.trim(),
+        min_amount: document.getElementById('bridge-min').value.trim()
+      })
+    });
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'Failed to track transfer.');
+    for (const id of ['bridge-name', 'bridge-hash', 'bridge-recipient', 'bridge-token', 'bridge-min']) {
+      document.getElementById(id).value = '';
     }
+    await loadBridges();
+    renderBridges();
+  } catch (err) {
+    errEl.textContent = err.message;
+    errEl.style.display = 'block';
+  } finally {
+    btn.disabled = false;
+  }
+}
+
+async function deleteBridge(id) {
+  try {
+    const resp = await fetch('/api/bridges/' + id, { method: 'DELETE' });
+    if (!resp.ok) throw new Error((await resp.json()).error || 'Delete failed.');
+  } catch (err) {
+    alert('Request failed: ' + err.message);
+    return;
+  }
+  await loadBridges();
+  renderBridges();
+}
+
+// ── Batch sends ────────────────────────────────────────
+// The server checks and builds a batch and reads each transaction's stage
+// from the journal, so progress follows the status poll. Keys in the
+// browser sign each unsent transaction here; the server's own keys send
+// the whole batch at once.
+async function loadBatches() {
+  try {
+    const resp = await fetch('/api/batches');
+    batches = resp.ok ? await resp.json() : [];
+  } catch {
+    batches = [];
+  }
+  const confirming = batches.filter(b => b.progress && b.progress.pending > 0).length;
+  document.getElementById('batches-badge').textContent = confirming ? String(confirming) : '';
+  if (!document.getElementById('batches-modal').classList.contains('active')) return;
+  if (batchShown && batchShown.id) {
+    const b = batches.find(x => x.id === batchShown.id);
+    if (b) batchShown = b;
+  }
+  renderBatches();
+}
+
+// Contacts come with their totals from the journal's index of sends by
+// counterparty; a contact's history is the journal filtered to it.
+let contacts = [];
+
+async function showContactsModal() {
+  document.getElementById('contacts-error').style.display = 'none';
+  document.getElementById('contact-detail').style.display = 'none';
+  await loadContacts();
+  showModal('contacts-modal');
+}
+
+async function loadContacts() {
+  try {
+    const resp = await fetch('/api/contacts');
+    contacts = resp.ok ? await resp.json() : [];
+  } catch {
+    contacts = [];
+  }
+  renderContacts();
+}
+
+function chainName(id) {
+  const ep = endpoints.find(e => e.chain_id && Number(hexToDecimal(e.chain_id)) === id);
+  return ep ? ep.name : 'chain ' + id;
+}
+
+function assetTotals(list) {
+  return (list || []).map(t => t.amount + ' ' + (t.token || 'native') + ' on ' + chainName(t.chain_id)).join(', ');
+}
+
+function renderContacts() {
+  document.getElementById('contact-list').innerHTML = contacts.length ? contacts.map(ct => {
+    const meta = [ct.sends + (ct.sends === 1 ? ' send' : ' sends')];
+    if (ct.transactions) meta.push(ct.transactions + ' mined');
+    meta.push('last ' + new Date(ct.last_interaction || ct.last_sent).toLocaleString());
+    const totals = [];
+    if (ct.sent && ct.sent.length) totals.push('Sent ' + assetTotals(ct.sent));
+    if (ct.received && ct.received.length) totals.push('Received ' + assetTotals(ct.received));
+    return '<div class="sched-row">' +
+      '<span class="sched-name" title="' + esc(ct.address) + '">' + esc(ct.name ? ct.name + ' \u2014 ' + ct.address : ct.address) +
+        (totals.length ? '<br><span class="sched-meta">' + esc(totals.join(' \u00b7 ')) + '</span>' : '') + '</span>' +
+      '<span class="sched-meta">' + esc(meta.join(' \u00b7 ')) + '</span>' +
+      '<button class="btn-icon server-only" onclick="showContactHistory(\'' + esc(ct.address) + '\')" title="History">&#9776;</button>' +
+      '<a class="btn-icon server-only" href="/api/history/export?counterparty=' + encodeURIComponent(ct.address) + '" title="Export CSV">&#8681;</a>' +
+      '<button class="btn-icon danger needs-manage" onclick="deleteContact(\'' + esc(ct.address) + '\')" title="Forget">&#10005;</button>' +
+    '</div>';
+  }).join('') : '<p class="trash-empty">No contacts yet. Addresses are added when a send to them goes out.</p>';
+}
+
+// showContactHistory lists the journal's sends involving a contact, newest
+// first.
+async function showContactHistory(address) {
+  const errEl = document.getElementById('contacts-error');
+  errEl.style.display = 'none';
+  const ct = contacts.find(c => c.address === address);
+  document.getElementById('contact-detail-title').textContent = 'History with ' + (ct && ct.name ? ct.name : address);
+  const el = document.getElementById('contact-history');
+  try {
+    const resp = await fetch('/api/journal?counterparty=' + encodeURIComponent(address));
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'Failed to load history');
+    el.innerHTML = data.length ? '<table><tr><th>Time</th><th>From</th><th>Stage</th><th>What</th><th>Hash</th></tr>' +
+      data.map(e =>
+        '<tr><td>' + esc(new Date(e.mined_at || e.updated_at).toLocaleString()) + '</td><td>' + esc(e.from) + '</td>' +
+        '<td' + (e.error ? ' class="error"' : '') + '>' + esc(e.stage + (e.error ? ': ' + e.error : '')) + '</td>' +
+        '<td>' + esc(e.summary || '') + '</td><td>' + esc(e.hash || '') + '</td></tr>'
+      ).join('') + '</table>' : '<p class="trash-empty">The journal has no sends involving this address.</p>';
+    document.getElementById('contact-detail').style.display = 'block';
+  } catch (e) {
+    errEl.textContent = e.message;
     errEl.style.display = 'block';
   }
 }
 
-// ── Password Setup ─────────────────────────────────────
-function showPasswordSetup() {
-  hideModal('setup-modal');
-  document.getElementById('setup-password').value = '';
-  document.getElementById('setup-password-confirm').value = '';
-  document.getElementById('password-setup-error').style.display = 'none';
-  showModal('password-setup-modal');
+async function deleteContact(address) {
+  if (!confirm('Move ' + address + ' to the recycle bin? Until it is restored or sent to again, it counts as unfamiliar.')) return;
+  const errEl = document.getElementById('contacts-error');
+  try {
+    const resp = await fetch('/api/contacts/' + address, { method: 'DELETE' });
+    if (!resp.ok) throw new Error((await resp.json()).error || 'Failed to delete contact');
+    document.getElementById('contact-detail').style.display = 'none';
+    await loadContacts();
+  } catch (e) {
+    errEl.textContent = e.message;
+    errEl.style.display = 'block';
+  }
 }
 
-async function setupWithPassword() {
-  const pw = document.getElementById('setup-password').value;
-  const confirm = document.getElementById('setup-password-confirm').value;
-  const errEl = document.getElementById('password-setup-error');
-  const btn = document.getElementById('btn-password-setup');
-  errEl.style.display = 'none';
+async function showBatchesModal() {
+  batchAccounts = await signingAccounts();
+  document.getElementById('batch-from').innerHTML = batchAccounts
+    .map(a => '<option value="' + esc(a.address) + '">' + esc(a.label) + ' (' + esc(a.kind) + ') ' + esc(a.address) + '</option>')
+    .join('');
+  document.getElementById('batch-endpoint').innerHTML = endpoints
+    .filter(ep => ep.online)
+    .map(ep => '<option value="' + esc(ep.id) + '">' + esc(ep.name) + '</option>')
+    .join('');
+  document.getElementById('batches-error').style.display = 'none';
+  batchShown = null;
+  await loadBatches();
+  renderBatches();
+  showModal('batches-modal');
+}
 
-  if (!pw) {
-    errEl.textContent = 'Please enter a password.';
-    errEl.style.display = 'block';
-    return;
-  }
-  if (pw.length < 8) {
-    errEl.textContent = 'Password must be at least 8 characters.';
-    errEl.style.display = 'block';
-    return;
+function renderBatches() {
+  const epName = id => (endpoints.find(e => e.id === id) || { name: id }).name;
+  document.getElementById('batch-list').innerHTML = batches.length ? batches.map(b =>
+    '<div class="sched-row">' +
+      '<span class="sched-name">' + esc(b.name || b.id) + ' \u2014 ' + esc(b.recipients.length + ' recipients, ' + b.cost.total + ' ' + b.cost.symbol + ' on ' + epName(b.endpoint)) + '</span>' +
+      '<span class="sched-meta">' + esc(batchProgressText(b.progress)) + '</span>' +
+      '<button class="btn-icon" onclick="showBatch(\'' + esc(b.id) + '\')" title="Show">&#9776;</button>' +
+      '<button class="btn-icon danger needs-operate" onclick="deleteBatch(\'' + esc(b.id) + '\')" title="Forget">&#10005;</button>' +
+    '</div>'
+  ).join('') : '<p class="trash-empty">No batch sends.</p>';
+  renderBatchDetail();
+}
+
+function batchProgressText(p) {
+  if (!p) return '';
+  const parts = [p.confirmed + '/' + p.total + ' confirmed'];
+  for (const k of ['pending', 'reverted', 'failed', 'unsent']) {
+    if (p[k]) parts.push(p[k] + ' ' + k);
   }
-  if (pw !== confirm) {
-    errEl.textContent = 'Passwords do not match.';
-    errEl.style.display = 'block';
+  return parts.join(', ');
+}
+
+function showBatch(id) {
+  batchShown = batches.find(b => b.id === id) || null;
+  document.getElementById('batch-confirm').style.display = 'none';
+  renderBatchDetail();
+}
+
+// renderBatchDetail shows the shown batch's cost, each recipient with its
+// problem, and each transaction with its stage.
+function renderBatchDetail() {
+  const b = batchShown;
+  const detail = document.getElementById('batch-detail');
+  const sendBtn = document.getElementById('btn-batch-send');
+  if (!b) {
+    detail.style.display = 'none';
+    sendBtn.style.display = 'none';
     return;
   }
+  detail.style.display = 'block';
+  document.getElementById('batch-detail-title').textContent = (b.id ? (b.name || 'Batch ' + b.id) : 'Preview') + ' \u2014 ' + b.mode;
+  const c = b.cost;
+  const costEl = document.getElementById('batch-cost');
+  costEl.className = 'batch-cost' + (c.short ? ' short' : '');
+  costEl.innerHTML = b.txs && b.txs.length ? [
+    ['Total', c.total + ' ' + c.symbol],
+    ['Max fees', c.max_fee],
+    ['Needs', c.needed + (c.token_balance ? ' and ' + c.total + ' ' + c.symbol : '')],
+    ['Has', c.balance + (c.token_balance ? ' and ' + c.token_balance + ' ' + c.symbol : '') + (c.short ? ' (not enough)' : '')]
+  ].map(r => '<div class="review-row"><span class="label">' + esc(r[0]) + '</span><span class="value">' + esc(r[1]) + '</span></div>').join('') : '';
+  document.getElementById('batch-recipients').innerHTML = '<table><tr><th>#</th><th>Address</th><th>Amount</th><th></th></tr>' +
+    b.recipients.map((r, i) =>
+      '<tr><td>' + (i + 1) + '</td><td>' + esc(r.address) + '</td><td>' + esc(r.amount) + '</td>' +
+      (r.error ? '<td class="error">' + esc(r.error) + '</td>' : '<td class="warning">' + esc(r.warning || '') + '</td>') + '</tr>'
+    ).join('') + '</table>';
+  document.getElementById('batch-txs').innerHTML = b.txs && b.txs.length ? '<table><tr><th>#</th><th>Kind</th><th>Nonce</th><th>Stage</th><th>Hash</th></tr>' +
+    b.txs.map((t, i) =>
+      '<tr><td>' + (i + 1) + '</td><td>' + esc(t.kind + (t.recipients ? ' \u00d7' + t.recipients.length : '')) + '</td><td>' + esc(hexToDecimal(t.envelope.tx.nonce)) + '</td>' +
+      '<td' + (t.error ? ' class="error"' : '') + '>' + esc((t.stage || 'unsent') + (t.error ? ': ' + t.error : '')) + '</td><td>' + esc(t.hash || '') + '</td></tr>'
+    ).join('') + '</table>' : '';
+  sendBtn.style.display = b.id && b.progress && (b.progress.unsent || b.progress.failed) ? '' : 'none';
+}
 
-  btn.disabled = true;
-  btn.textContent = 'Deriving key...';
+async function loadBatchFile() {
+  const input = document.getElementById('batch-file');
+  if (!input.files.length) return;
+  document.getElementById('batch-list-text').value = await input.files[0].text();
+}
 
+// addBatch previews or creates a batch. Either way the recipients come
+// back with their problems, shown in the detail.
+async function addBatch(preview) {
+  const errEl = document.getElementById('batches-error');
+  const btn = document.getElementById(preview ? 'btn-batch-preview' : 'btn-batch-add');
+  errEl.style.display = 'none';
+  btn.disabled = true;
   try {
-    const salt = crypto.getRandomValues(new Uint8Array(32));
-    aesKey = await deriveAESKeyFromPassword(pw, salt);
-
-    await saveCredential({
-      id: 'primary',
-      method: 'password',
-      pbkdf2Salt: Array.from(salt),
-      createdAt: Date.now()
+    const resp = await fetch(preview ? '/api/batches/preview' : '/api/batches', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({
+        name: document.getElementById('batch-name').value.trim(),
+        endpoint: document.getElementById('batch-endpoint').value,
+        from: document.getElementById('batch-from').value,
+        token: document.getElementById('batch-token').value.trim(),
+        mode: document.getElementById('batch-mode').value,
+        list: document.getElementById('batch-list-text').value
+      })
     });
-
-    credMethod = 'password';
-    walletState = 'unlocked';
-    decryptedKeys = [];
-    storedKeyCount = 0;
-    renderWalletBar();
-    hideModal('password-setup-modal');
-    showModal('addkey-modal');
-
+    const data = await resp.json();
+    if (data.batch) batchShown = data.batch;
+    if (!resp.ok) throw new Error(data.error || 'Failed to build the batch.');
+    batchShown = data;
+    if (!preview) {
+      for (const id of ['batch-name', 'batch-token', 'batch-list-text', 'batch-file']) {
+        document.getElementById(id).value = '';
+      }
+      await loadBatches();
+    }
+    renderBatches();
   } catch (err) {
-    errEl.textContent = 'Setup failed: ' + err.message;
+    renderBatchDetail();
+    errEl.textContent = err.message;
     errEl.style.display = 'block';
   } finally {
     btn.disabled = false;
-    btn.textContent = 'Set Password';
   }
 }
 
-// ── Unlock ─────────────────────────────────────────────
-async function unlockWallet() {
-  if (credMethod === 'password') {
-    document.getElementById('unlock-password').value = '';
-    document.getElementById('password-unlock-error').style.display = 'none';
-    showModal('password-unlock-modal');
-    return;
-  }
-  // PRF unlock.
-  const btn = document.querySelector('#wallet-actions .btn-primary');
-  if (btn) { btn.disabled = true; btn.textContent = 'Unlocking...'; }
-
+// sendBatch sends the shown batch's unsent transactions in order: through
+// the server for its keys, or signed here one by one for keys in the
+// browser after the server rebuilds them with fresh nonces and fees.
+async function sendBatch() {
+  const errEl = document.getElementById('batches-error');
+  const btn = document.getElementById('btn-batch-send');
+  errEl.style.display = 'none';
+  btn.disabled = true;
+  const confirmShown = document.getElementById('batch-confirm').style.display !== 'none';
+  const confirm = confirmShown ? {
+    to_suffix: document.getElementById('batch-confirm-to').value.trim(),
+    value: document.getElementById('batch-confirm-value').value.trim()
+  } : undefined;
   try {
-    const stored = await getCredential();
-    if (!stored) throw new Error('No credential found.');
-
-    const credentialId = new Uint8Array(stored.credentialId);
-    const assertion = await navigator.credentials.get({
-      publicKey: {
-        challenge: crypto.getRandomValues(new Uint8Array(32)),
-        rpId: stored.rpId,
-        allowCredentials: [{
-          type: 'public-key',
-          id: credentialId.buffer,
-          transports: stored.transports || []
-        }],
-        userVerification: 'required',
-        extensions: {
-          prf: { eval: { first: PRF_SALT } }
+    const b = batchShown;
+    const acct = batchAccounts.find(a => a.address.toLowerCase() === b.from.toLowerCase());
+    if (acct && (acct.kind === 'local' || acct.kind === 'ledger' || acct.kind === 'trezor' || acct.kind === 'airgap')) {
+      let resp = await fetch('/api/batches/' + b.id + '/build', { method: 'POST' });
+      let data = await resp.json();
+      if (!resp.ok) throw new Error(data.error || 'Rebuild failed.');
+      batchShown = data;
+      renderBatchDetail();
+      for (const [i, t] of data.txs.entries()) {
+        if (t.stage && t.stage !== 'failed') continue;
+        if (t.envelope.confirm_required) {
+          if (!confirm) {
+            document.getElementById('batch-confirm').style.display = '';
+            throw new Error('Transaction ' + (i + 1) + ' is large: re-type its target and value, then send again.');
+          }
+          checkSendConfirmation(t.envelope, confirm);
         }
+        const signature = await signInBrowser(acct, t.envelope);
+        resp = await fetch('/api/tx/import', {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify({ envelope: t.envelope, signature: signature, broadcast: true })
+        });
+        const out = await resp.json();
+        if (!resp.ok) throw new Error('Transaction ' + (i + 1) + ': ' + (out.error || 'send failed'));
+        await loadBatches();
       }
-    });
-
-    const exts = assertion.getClientExtensionResults();
-    if (!exts.prf || !exts.prf.results || !exts.prf.results.first) {
-      throw new Error('PRF evaluation failed.');
+    } else {
+      const resp = await fetch('/api/batches/' + b.id + '/send', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ confirm: confirm })
+      });
+      const data = await resp.json();
+      if (data.batch) batchShown = data.batch;
+      if (resp.status === 428) document.getElementById('batch-confirm').style.display = '';
+      if (!resp.ok) throw new Error(data.error || 'Send failed.');
+      batchShown = data;
+      if (data.progress && data.progress.pending) loadApprovals();
     }
-
-    aesKey = await deriveAESKeyFromPRF(exts.prf.results.first);
-    await decryptAllKeys();
-    walletState = 'unlocked';
-    renderWalletBar();
-    refresh();
-
+    document.getElementById('batch-confirm').style.display = 'none';
+    await loadBatches();
   } catch (err) {
-    if (err.name !== 'NotAllowedError') {
-      console.error('Unlock failed:', err);
-    }
-    renderWalletBar();
+    errEl.textContent = err.message;
+    errEl.style.display = 'block';
+    renderBatchDetail();
+  } finally {
+    btn.disabled = false;
   }
 }
 
-async function unlockWithPassword() {
-  const pw = document.getElementById('unlock-password').value;
-  const errEl = document.getElementById('password-unlock-error');
-  const btn = document.getElementById('btn-password-unlock');
-  errEl.style.display = 'none';
-
-  if (!pw) {
-    errEl.textContent = 'Please enter your password.';
-    errEl.style.display = 'block';
+async function deleteBatch(id) {
+  try {
+    const resp = await fetch('/api/batches/' + id, { method: 'DELETE' });
+    if (!resp.ok) throw new Error((await resp.json()).error || 'Delete failed.');
+  } catch (err) {
+    alert('Request failed: ' + err.message);
     return;
   }
+  if (batchShown && batchShown.id === id) batchShown = null;
+  await loadBatches();
+  renderBatches();
+}
 
-  btn.disabled = true;
-  btn.textContent = 'Unlocking...';
-
+// ── Alerts ─────────────────────────────────────────────
+// The server checks alerts as it polls and pushes notification when one
+// starts firing.
+async function loadAlerts() {
   try {
-    const stored = await getCredential();
-    if (!stored || !stored.pbkdf2Salt) throw new Error('No password credential found.');
+    const resp = await fetch('/api/alerts');
+    alerts = resp.ok ? await resp.json() : [];
+  } catch {
+    alerts = [];
+  }
+  const firing = alerts.filter(a => a.firing && !a.muted).length;
+  document.getElementById('alerts-badge').textContent = firing ? String(firing) : '';
+  if (document.getElementById('alerts-modal').classList.contains('active')) renderAlerts();
+}
 
-    const salt = new Uint8Array(stored.pbkdf2Salt);
-    aesKey = await deriveAESKeyFromPassword(pw, salt);
+async function showAlertsModal() {
+  document.getElementById('alert-endpoint').innerHTML = endpoints
+    .map(ep => '<option value="' + esc(ep.id) + '">' + esc(ep.name) + '</option>')
+    .join('');
+  document.getElementById('alert-addresses').innerHTML = walletAccounts()
+    .map(a => '<option value="' + esc(a.address) + '">' + esc(a.label) + '</option>')
+    .join('');
+  showAlertFields();
+  showChannelFields();
+  document.getElementById('alerts-error').style.display = 'none';
+  document.getElementById('channels-error').style.display = 'none';
+  document.getElementById('push-error').style.display = 'none';
+  await Promise.all([loadAlerts(), loadChannels(), renderPush()]);
+  renderAlerts();
+  showModal('alerts-modal');
+}
 
-    // Try decrypting — if the password is wrong, decryption will fail.
-    await decryptAllKeys();
-    walletState = 'unlocked';
-    renderWalletBar();
-    hideModal('password-unlock-modal');
-    refresh();
+function showAlertFields() {
+  const kind = document.getElementById('alert-kind').value;
+  document.querySelectorAll('#alerts-modal .alert-gas').forEach(el => el.style.display = kind === 'gas' ? '' : 'none');
+  document.querySelectorAll('#alerts-modal .alert-balance').forEach(el => el.style.display = kind === 'balance' ? '' : 'none');
+  document.querySelectorAll('#alerts-modal .alert-offline').forEach(el => el.style.display = kind === 'offline' ? '' : 'none');
+}
+
+function renderAlerts() {
+  const epName = id => (endpoints.find(e => e.id === id) || { name: id }).name;
+  const symbol = id => ((endpoints.find(e => e.id === id) || {}).symbol || '');
+  const condition = a => {
+    if (a.kind === 'balance') {
+      const dir = { any: 'balance changes', in: 'incoming', out: 'outgoing' }[a.direction] || a.direction;
+      return a.address.slice(0, 6) + '...' + a.address.slice(-4) + ' ' + dir + (a.min ? ' \u2265 ' + a.min + ' ' + symbol(a.endpoint) : '');
+    }
+    if (a.kind === 'offline') return 'offline' + (a.after ? ' for ' + a.after : '');
+    const parts = [];
+    if (a.below) parts.push('< ' + a.below + ' gwei');
+    if (a.above) parts.push('> ' + a.above + ' gwei');
+    return a.metric.replace('_', ' ') + ' ' + parts.join(' or ');
+  };
+  const state = a => a.muted ? 'muted' : a.error ? 'failed' : a.firing ? 'firing' : 'ok';
+  const value = a => {
+    if (!a.value) return 'not checked yet';
+    if (a.kind === 'offline') return a.value === 'offline' && a.since ? 'offline since ' + new Date(a.since).toLocaleString() : a.value;
+    if (a.kind !== 'balance') return 'now ' + a.value + ' gwei';
+    return 'balance ' + a.value + ' ' + symbol(a.endpoint) + (a.change ? ', last ' + (a.change.startsWith('-') ? '' : '+') + a.change : '');
+  };
+  document.getElementById('alert-list').innerHTML = alerts.length ? alerts.map(a =>
+    '<div class="sched-row">' +
+      '<span class="sched-name">' + esc((a.name ? a.name + ' \u2014 ' : '') + epName(a.endpoint) + ' ' + condition(a)) + '</span>' +
+      '<span class="sched-meta">' + esc(a.error || value(a)) + '</span>' +
+      '<span class="sched-status ' + state(a) + '">' + state(a) + '</span>' +
+      '<button class="btn needs-operate" onclick="muteAlert(\'' + esc(a.id) + '\', ' + !a.muted + ')">' + (a.muted ? 'Unmute' : 'Mute') + '</button>' +
+      '<button class="btn-icon danger needs-operate" onclick="deleteAlert(\'' + esc(a.id) + '\')" title="Delete">&#10005;</button>' +
+    '</div>'
+  ).join('') : '<p class="trash-empty">No alerts yet.</p>';
+}
 
+async function addAlert() {
+  const errEl = document.getElementById('alerts-error');
+  const btn = document.getElementById('btn-alert-add');
+  const kind = document.getElementById('alert-kind').value;
+  errEl.style.display = 'none';
+  btn.disabled = true;
+  try {
+    const resp = await fetch('/api/alerts', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify(kind === 'offline' ? {
+        kind,
+        name: document.getElementById('alert-name').value.trim(),
+        endpoint: document.getElementById('alert-endpoint').value,
+        after: document.getElementById('alert-after').value.trim()
+      } : kind === 'gas' ? {
+        kind,
+        name: document.getElementById('alert-name').value.trim(),
+        endpoint: document.getElementById('alert-endpoint').value,
+        metric: document.getElementById('alert-metric').value,
+        below: document.getElementById('alert-below').value.trim(),
+        above: document.getElementById('alert-above').value.trim()
+      } : {
+        kind,
+        name: document.getElementById('alert-name').value.trim(),
+        endpoint: document.getElementById('alert-endpoint').value,
+        address: document.getElementById('alert-address').value.trim(),
+        direction: document.getElementById('alert-direction').value,
+        min: document.getElementById('alert-min').value.trim()
+      })
+    });
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'Failed to add alert.');
+    for (const id of ['alert-name', 'alert-below', 'alert-above', 'alert-address', 'alert-min', 'alert-after']) {
+      document.getElementById(id).value = '';
+    }
+    await loadAlerts();
   } catch (err) {
-    errEl.textContent = 'Wrong password or decryption failed.';
+    errEl.textContent = err.message;
     errEl.style.display = 'block';
-    aesKey = null;
   } finally {
     btn.disabled = false;
-    btn.textContent = 'Unlock';
-  }
-}
-
-async function decryptAllKeys() {
-  const encryptedKeys = await getEncryptedKeys();
-  decryptedKeys = [];
-  for (const rec of encryptedKeys) {
-    const plaintext = await decryptPrivateKey(
-      new Uint8Array(rec.encrypted),
-      new Uint8Array(rec.iv),
-      aesKey
-    );
-    decryptedKeys.push({ id: rec.id, label: rec.label, address: rec.address, key: plaintext });
   }
-  activeKeyIndex = 0;
-  storedKeyCount = decryptedKeys.length;
 }
 
-// ── Lock ───────────────────────────────────────────────
-function lockWallet() {
-  for (let i = 0; i < decryptedKeys.length; i++) {
-    decryptedKeys[i].key = '';
+async function muteAlert(id, muted) {
+  const a = alerts.find(x => x.id === id);
+  if (!a) return;
+  try {
+    const resp = await fetch('/api/alerts/' + id, {
+      method: 'PUT',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ ...a, muted })
+    });
+    if (!resp.ok) throw new Error((await resp.json()).error || 'Update failed.');
+  } catch (err) {
+    alert('Request failed: ' + err.message);
+    return;
   }
-  decryptedKeys = [];
-  aesKey = null;
-  activeKeyIndex = 0;
-  walletState = 'locked';
-  expandedAccounts.clear();
-  accountBalances = {};
-  renderWalletBar();
-  renderEndpoints();
-  renderAccounts();
+  await loadAlerts();
 }
 
-// ── Import Key ─────────────────────────────────────────
-async function doImportKey() {
-  const labelInput = document.getElementById('import-label');
-  const keyInput = document.getElementById('import-key');
-  const errEl = document.getElementById('import-error');
-  const btn = document.getElementById('btn-import-confirm');
-  errEl.style.display = 'none';
+// Web Push needs a secure context: HTTPS, or localhost.
+const pushSupported = window.isSecureContext && 'serviceWorker' in navigator && 'PushManager' in window;
 
-  const label = labelInput.value.trim() || 'Key ' + (storedKeyCount + 1);
-  let key = keyInput.value.trim();
+async function browserPushSubscription() {
+  const reg = await navigator.serviceWorker.getRegistration('/static/');
+  return reg ? reg.pushManager.getSubscription() : null;
+}
 
-  if (!key) {
-    errEl.textContent = 'Please enter a private key.';
-    errEl.style.display = 'block';
+async function renderPush() {
+  const status = document.getElementById('push-status');
+  const btn = document.getElementById('btn-push');
+  const test = document.getElementById('btn-push-test');
+  if (!pushSupported) {
+    status.textContent = 'This browser can\'t get notifications from the wallet here: they need HTTPS (or localhost) and a browser with Web Push.';
+    btn.style.display = test.style.display = 'none';
     return;
   }
+  const on = !!localStorage.getItem(PUSH_SUBSCRIPTION_KEY) && !!(await browserPushSubscription().catch(() => null));
+  status.textContent = on
+    ? 'This browser shows alerts and confirmed sends as system notifications, even with the dashboard closed.'
+    : Notification.permission === 'denied'
+      ? 'Notifications are blocked for this site in the browser\'s settings.'
+      : 'Get alerts and confirmed sends as system notifications, even with the dashboard closed.';
+  btn.style.display = '';
+  btn.textContent = on ? 'Stop Notifying' : 'Notify this browser';
+  test.style.display = on ? '' : 'none';
+}
 
-  if (!key.startsWith('0x')) key = '0x' + key;
-
-  if (!/^0x[0-9a-fA-F]{64}$/.test(key)) {
-    errEl.textContent = 'Invalid key format. Expected 64 hex characters.';
+async function togglePush() {
+  const errEl = document.getElementById('push-error');
+  const btn = document.getElementById('btn-push');
+  errEl.style.display = 'none';
+  btn.disabled = true;
+  try {
+    const id = localStorage.getItem(PUSH_SUBSCRIPTION_KEY);
+    const sub = await browserPushSubscription();
+    if (id && sub) {
+      const resp = await fetch('/api/push/subscriptions/' + id, { method: 'DELETE' });
+      if (!resp.ok && resp.status !== 404) throw new Error((await resp.json()).error || 'Failed to unsubscribe.');
+      await sub.unsubscribe();
+      localStorage.removeItem(PUSH_SUBSCRIPTION_KEY);
+    } else {
+      if (await Notification.requestPermission() !== 'granted') throw new Error('Notifications weren\'t allowed for this site.');
+      const reg = await navigator.serviceWorker.register('/static/push-worker.js');
+      // The dashboard is outside the worker's scope, so wait on the worker itself.
+      const worker = reg.installing || reg.waiting;
+      if (!reg.active && worker) {
+        await new Promise(resolve => worker.addEventListener('statechange', () => worker.state === 'activated' && resolve()));
+      }
+      const keyResp = await fetch('/api/push/key');
+      const key = await keyResp.json();
+      if (!keyResp.ok) throw new Error(key.error || 'Failed to get the server\'s push key.');
+      // Start afresh: an old subscription may be for another server key.
+      if (sub) await sub.unsubscribe();
+      const raw = atob(key.public_key.replace(/-/g, '+').replace(/_/g, '/'));
+      const fresh = await reg.pushManager.subscribe({
+        userVisibleOnly: true,
+        applicationServerKey: Uint8Array.from(raw, c => c.charCodeAt(0))
+      });
+      const resp = await fetch('/api/push/subscriptions', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(fresh.toJSON())
+      });
+      const data = await resp.json();
+      if (!resp.ok) {
+        await fresh.unsubscribe();
+        throw new Error(data.error || 'Failed to subscribe.');
+      }
+      localStorage.setItem(PUSH_SUBSCRIPTION_KEY, data.id);
+    }
+  } catch (err) {
+    errEl.textContent = err.message;
     errEl.style.display = 'block';
-    return;
+  } finally {
+    btn.disabled = false;
   }
+  await renderPush();
+}
 
-  if (!aesKey) {
-    errEl.textContent = 'Wallet is not unlocked. Please unlock first.';
+async function testPush() {
+  const errEl = document.getElementById('push-error');
+  const btn = document.getElementById('btn-push-test');
+  errEl.style.display = 'none';
+  btn.disabled = true;
+  try {
+    const resp = await fetch('/api/push/subscriptions/' + localStorage.getItem(PUSH_SUBSCRIPTION_KEY) + '/test', { method: 'POST' });
+    if (resp.status === 404) localStorage.removeItem(PUSH_SUBSCRIPTION_KEY);
+    if (!resp.ok) throw new Error((await resp.json()).error || 'Test failed.');
+  } catch (err) {
+    errEl.textContent = err.message;
     errEl.style.display = 'block';
-    return;
+  } finally {
+    btn.disabled = false;
   }
+  await renderPush();
+}
 
-  btn.disabled = true;
-  btn.textContent = 'Encrypting...';
-
+// Channels are admin-only; for anyone else the list stays empty and hidden.
+async function loadChannels() {
   try {
-    await ensureEthers();
-    const wallet = new ethers.Wallet(key);
-    const address = wallet.address;
-
-    const { encrypted, iv } = await encryptPrivateKey(key, aesKey);
-
-    await saveEncryptedKey({
-      label: label,
-      address: address,
-      encrypted: Array.from(encrypted),
-      iv: Array.from(iv),
-      createdAt: Date.now()
-    });
+    const resp = await fetch('/api/channels');
+    channels = resp.ok ? await resp.json() : [];
+  } catch {
+    channels = [];
+  }
+  renderChannels();
+}
 
-    const allKeys = await getEncryptedKeys();
-    const newest = allKeys[allKeys.length - 1];
-    decryptedKeys.push({ id: newest.id, label: label, address: address, key: key });
-    activeKeyIndex = decryptedKeys.length - 1;
-    storedKeyCount = decryptedKeys.length;
+function showChannelFields() {
+  const type = document.getElementById('channel-type').value;
+  for (const t of ['webhook', 'telegram', 'email', 'ntfy']) {
+    document.querySelectorAll('#alerts-modal .channel-' + t).forEach(el => el.style.display = 'none');
+  }
+  document.querySelectorAll('#alerts-modal .channel-' + type).forEach(el => el.style.display = '');
+}
 
-    labelInput.value = '';
-    keyInput.value = '';
-    errEl.style.display = 'none';
-    hideModal('import-modal');
-    renderWalletBar();
-    refresh();
+function renderChannels() {
+  const dest = c => c.type === 'telegram' ? 'chat ' + c.chat_id : c.type === 'email' ? (c.to || []).join(', ') : c.url;
+  document.getElementById('channel-list').innerHTML = channels.length ? channels.map(c =>
+    '<div class="sched-row">' +
+      '<span class="sched-name">' + esc(c.name + ' \u2014 ' + c.type + ' to ' + dest(c)) + '</span>' +
+      '<span class="sched-meta">' + esc(c.last_error || (c.kinds && c.kinds.length ? c.kinds.join(', ') : 'all kinds')) + '</span>' +
+      '<span class="sched-status ' + (c.disabled ? 'muted' : c.last_error ? 'failed' : 'ok') + '">' + (c.disabled ? 'disabled' : c.last_error ? 'failing' : 'ok') + '</span>' +
+      '<button class="btn" onclick="testChannel(\'' + esc(c.id) + '\', this)">Test</button>' +
+      '<button class="btn" onclick="toggleChannel(\'' + esc(c.id) + '\')">' + (c.disabled ? 'Enable' : 'Disable') + '</button>' +
+      '<button class="btn-icon danger" onclick="deleteChannel(\'' + esc(c.id) + '\')" title="Delete">&#10005;</button>' +
+    '</div>'
+  ).join('') : '<p class="trash-empty">No channels yet; notifications only reach open dashboards.</p>';
+}
 
+async function addChannel() {
+  const errEl = document.getElementById('channels-error');
+  const btn = document.getElementById('btn-channel-add');
+  const val = id => document.getElementById(id).value.trim();
+  errEl.style.display = 'none';
+  btn.disabled = true;
+  try {
+    const kinds = Array.from(document.querySelectorAll('.channel-kinds input:checked')).map(el => el.value);
+    const resp = await fetch('/api/channels', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({
+        type: val('channel-type'),
+        name: val('channel-name'),
+        kinds: kinds.length === 4 ? [] : kinds,
+        url: val('channel-url'),
+        token: val('channel-token'),
+        bot_token: val('channel-bot-token'),
+        chat_id: val('channel-chat-id'),
+        smtp_host: val('channel-smtp'),
+        username: val('channel-username'),
+        password: document.getElementById('channel-password').value,
+        from: val('channel-from'),
+        to: val('channel-to').split(',').map(s => s.trim()).filter(Boolean)
+      })
+    });
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'Failed to add channel.');
+    for (const id of ['channel-name', 'channel-url', 'channel-token', 'channel-bot-token', 'channel-chat-id', 'channel-smtp', 'channel-username', 'channel-password', 'channel-from', 'channel-to']) {
+      document.getElementById(id).value = '';
+    }
+    await loadChannels();
   } catch (err) {
-    errEl.textContent = 'Failed: ' + err.message;
+    errEl.textContent = err.message;
     errEl.style.display = 'block';
   } finally {
     btn.disabled = false;
-    btn.textContent = 'Import';
   }
 }
 
-// ── Generate Key ───────────────────────────────────────
-async function generateKey() {
-  const errEl = document.getElementById('addkey-error');
-  errEl.style.display = 'none';
-
-  if (!aesKey) {
-    errEl.textContent = 'Wallet is not unlocked.';
-    errEl.style.display = 'block';
+async function testChannel(id, btn) {
+  btn.disabled = true;
+  try {
+    const resp = await fetch('/api/channels/' + id + '/test', { method: 'POST' });
+    if (!resp.ok) throw new Error((await resp.json()).error || 'Test failed.');
+    showNotice('Test notification sent.');
+  } catch (err) {
+    alert('Test failed: ' + err.message);
+  } finally {
+    btn.disabled = false;
+  }
+  await loadChannels();
+}
+
+async function toggleChannel(id) {
+  const c = channels.find(x => x.id === id);
+  if (!c) return;
+  try {
+    const resp = await fetch('/api/channels/' + id, {
+      method: 'PUT',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ ...c, disabled: !c.disabled })
+    });
+    if (!resp.ok) throw new Error((await resp.json()).error || 'Update failed.');
+  } catch (err) {
+    alert('Request failed: ' + err.message);
     return;
   }
+  await loadChannels();
+}
 
+async function deleteChannel(id) {
+  if (!confirm('Delete this channel?')) return;
   try {
-    await ensureEthers();
-    const wallet = ethers.Wallet.createRandom();
-    const key = wallet.privateKey;
-    const address = wallet.address;
-    const label = 'Key ' + (storedKeyCount + 1);
+    const resp = await fetch('/api/channels/' + id, { method: 'DELETE' });
+    if (!resp.ok) throw new Error((await resp.json()).error || 'Delete failed.');
+  } catch (err) {
+    alert('Request failed: ' + err.message);
+    return;
+  }
+  await loadChannels();
+}
 
-    const { encrypted, iv } = await encryptPrivateKey(key, aesKey);
+async function deleteAlert(id) {
+  try {
+    const resp = await fetch('/api/alerts/' + id, { method: 'DELETE' });
+    if (!resp.ok) throw new Error((await resp.json()).error || 'Delete failed.');
+  } catch (err) {
+    alert('Request failed: ' + err.message);
+    return;
+  }
+  await loadAlerts();
+}
 
-    await saveEncryptedKey({
-      label: label,
-      address: address,
-      encrypted: Array.from(encrypted),
-      iv: Array.from(iv),
-      createdAt: Date.now()
-    });
+// ── Safes ──────────────────────────────────────────────
+// Safes are found through the Transaction Service and read from the chain.
+// An owner signs a pending transaction's typed data in the browser or on a
+// hardware wallet, or has a server key sign it; the server checks every
+// signature before passing it on.
+async function showSafesModal() {
+  document.getElementById('safes-endpoint').innerHTML = endpoints
+    .filter(ep => ep.online)
+    .map(ep => '<option value="' + esc(ep.id) + '">' + esc(ep.name) + '</option>')
+    .join('');
+  document.getElementById('safes-result').style.display = 'none';
+  safes = [];
+  safeOpen = null;
+  renderSafes();
+  showModal('safes-modal');
+  await detectSafes();
+}
 
-    const allKeys = await getEncryptedKeys();
-    const newest = allKeys[allKeys.length - 1];
-    decryptedKeys.push({ id: newest.id, label: label, address: address, key: key });
-    activeKeyIndex = decryptedKeys.length - 1;
-    storedKeyCount = decryptedKeys.length;
+async function detectSafes() {
+  const errEl = document.getElementById('safes-error');
+  errEl.style.display = 'none';
+  const epId = document.getElementById('safes-endpoint').value;
+  safes = [];
+  safeOpen = null;
+  try {
+    if (!epId) throw new Error('No online endpoint to look on.');
+    safeSigners = await signingAccounts();
+    if (!safeSigners.length) throw new Error('Unlock the wallet or add a key to find the Safes it owns.');
+    const owners = safeSigners.map(a => a.address).join(',');
+    const resp = await fetch('/api/safes?endpoint=' + encodeURIComponent(epId) + '&owners=' + encodeURIComponent(owners));
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'HTTP ' + resp.status);
+    safes = data;
+  } catch (err) {
+    errEl.textContent = err.message;
+    errEl.style.display = 'block';
+  }
+  renderSafes();
+}
 
-    hideModal('addkey-modal');
-    renderWalletBar();
-    refresh();
+function renderSafes() {
+  document.getElementById('safe-list').innerHTML = safes.length ? safes.map(sf =>
+    '<div class="sched-row">' +
+      '<span class="sched-name">' + esc(sf.address) + '</span>' +
+      '<span class="sched-meta">' + sf.threshold + ' of ' + sf.owners.length + ' owners \u00b7 nonce ' + sf.nonce + ' \u00b7 v' + esc(sf.version) + '</span>' +
+      '<button class="btn" onclick="openSafe(\'' + esc(sf.address) + '\')">Open</button>' +
+    '</div>'
+  ).join('') : '<p class="trash-empty">No Safes found for your keys on this chain.</p>';
+  renderSafeDetail();
+}
 
+// openSafe loads a Safe's pending transactions, decoding each one's call.
+async function openSafe(address) {
+  const errEl = document.getElementById('safes-error');
+  errEl.style.display = 'none';
+  const epId = document.getElementById('safes-endpoint').value;
+  try {
+    const resp = await fetch('/api/safes/' + encodeURIComponent(address) + '?endpoint=' + encodeURIComponent(epId));
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'HTTP ' + resp.status);
+    for (const p of data.pending) p.call = await describeCalldata(p.tx.data);
+    safeOpen = { endpoint: epId, safe: data.safe, pending: data.pending };
   } catch (err) {
-    errEl.textContent = 'Failed: ' + err.message;
+    errEl.textContent = err.message;
     errEl.style.display = 'block';
   }
+  renderSafeDetail();
 }
 
-function showAddKeyModal() {
-  document.getElementById('addkey-error').style.display = 'none';
-  showModal('addkey-modal');
+function renderSafeDetail() {
+  const el = document.getElementById('safe-detail');
+  if (!safeOpen) {
+    el.innerHTML = '';
+    return;
+  }
+  const sf = safeOpen.safe;
+  const ep = endpoints.find(e => e.id === safeOpen.endpoint);
+  const owners = safeSigners.filter(a => sf.owners.some(o => o.toLowerCase() === a.address.toLowerCase()));
+  el.innerHTML = '<div class="sched-heading">Pending in ' + esc(sf.address) + '</div>' +
+    (safeOpen.pending.length ? safeOpen.pending.map(p => {
+      const signed = p.confirmations.map(c => c.owner.toLowerCase());
+      const unsigned = owners.filter(a => !signed.includes(a.address.toLowerCase()));
+      const rows = [
+        ['To', p.tx.to],
+        ['Value', formatAmount(p.tx.value, ep)]
+      ].concat(p.call, [
+        ['Signed by', p.confirmations.map(c => c.owner).join(', ') || 'nobody yet'],
+        ['Safe tx hash', p.safe_tx_hash]
+      ]);
+      return '<div class="approval-card">' +
+        '<div class="approval-head">' +
+          '<span class="approval-origin">Nonce ' + p.tx.nonce + (p.origin ? ' \u00b7 ' + esc(p.origin) : '') + '</span>' +
+          '<span class="sched-meta">' + p.confirmations.length + ' of ' + p.confirmations_required + ' signatures</span>' +
+        '</div>' +
+        (p.mismatch ? '<div class="modal-warning">The Transaction Service\'s hash does not match this transaction. It cannot be signed here.</div>' : '') +
+        (p.tx.operation === 1 ? '<div class="modal-warning">This is a delegatecall: the target runs with the Safe\'s storage and funds.</div>' : '') +
+        '<div class="send-review">' + rows.map(r =>
+          '<div class="review-row"><span class="label">' + esc(r[0]) + '</span><span class="value">' + esc(r[1]) + '</span></div>'
+        ).join('') + '</div>' +
+        (!p.mismatch && unsigned.length ? '<div class="approval-actions needs-operate">' + unsigned.map(a =>
+          '<button class="btn btn-primary" onclick="signSafeTx(\'' + esc(p.safe_tx_hash) + '\', \'' + esc(a.address) + '\', this)">Sign as ' + esc(a.label) + '</button>'
+        ).join('') + '</div>' : '') +
+      '</div>';
+    }).join('') : '<p class="trash-empty">No pending transactions.</p>') +
+    (owners.length ? '<div class="approval-actions needs-operate"><button class="btn" onclick="proposeFromSafe()">Propose</button></div>' : '');
 }
 
-// ── Wallet Bar Rendering ───────────────────────────────
-function renderWalletBar() {
-  const statusEl = document.getElementById('wallet-status');
-  const actionsEl = document.getElementById('wallet-actions');
-
-  if (walletState === 'none') {
-    statusEl.className = 'no-wallet';
-    statusEl.textContent = 'No wallet configured';
-    actionsEl.innerHTML = '<button class="btn btn-primary" onclick="showModal(\'setup-modal\')">Setup Wallet</button>';
-  } else if (walletState === 'locked') {
-    const methodLabel = credMethod === 'prf' ? 'biometric' : 'password';
-    statusEl.className = 'label';
-    statusEl.innerHTML = '<span class="lock-icon">&#128274;</span> Wallet locked' +
-      (storedKeyCount > 0 ? ' <span class="key-badge">' + storedKeyCount + ' key' + (storedKeyCount !== 1 ? 's' : '') + '</span>' : '') +
-      ' <span class="method-badge">' + methodLabel + '</span>';
-    actionsEl.innerHTML = '<button class="btn btn-primary" onclick="unlockWallet()">Unlock</button>';
-  } else if (walletState === 'unlocked') {
-    let html = '';
-    if (decryptedKeys.length > 0) {
-      const active = decryptedKeys[activeKeyIndex];
-      if (decryptedKeys.length > 1) {
-        html += '<select class="key-selector" onchange="switchKey(this.value)">';
-        for (let i = 0; i < decryptedKeys.length; i++) {
-          const k = decryptedKeys[i];
-          const sel = i === activeKeyIndex ? ' selected' : '';
-          html += '<option value="' + i + '"' + sel + '>' + esc(k.label) + ' (' + k.address.slice(0, 6) + '...' + k.address.slice(-4) + ')</option>';
-        }
-        html += '</select>';
-      }
-      statusEl.className = 'address';
-      statusEl.textContent = active.address;
+// signSafeTx adds an owner's signature to a pending transaction: made here
+// for local and hardware keys, on the server for vault keys.
+async function signSafeTx(hash, owner, btn) {
+  const errEl = document.getElementById('safes-error');
+  const resultEl = document.getElementById('safes-result');
+  errEl.style.display = 'none';
+  resultEl.style.display = 'none';
+  btn.disabled = true;
+  try {
+    const p = safeOpen.pending.find(x => x.safe_tx_hash === hash);
+    const acct = safeSigners.find(a => a.address.toLowerCase() === owner.toLowerCase());
+    const body = { endpoint: safeOpen.endpoint, safe: safeOpen.safe.address, safe_tx_hash: hash, owner: owner };
+    if (acct && (acct.kind === 'local' || acct.kind === 'ledger' || acct.kind === 'trezor')) {
+      body.signature = await signPermitInBrowser(acct, p);
+      await permitRequest('/api/safes/' + body.safe + '/confirm', body);
     } else {
-      statusEl.className = 'no-wallet';
-      statusEl.textContent = 'No keys imported';
+      await permitRequest('/api/safes/sign', body);
     }
+    resultEl.textContent = 'Signed as ' + owner + '.';
+    resultEl.style.display = 'block';
+    await openSafe(safeOpen.safe.address);
+  } catch (err) {
+    errEl.textContent = err.message;
+    errEl.style.display = 'block';
+  } finally {
+    btn.disabled = false;
+  }
+}
 
-    actionsEl.innerHTML = html +
-      '<button class="btn btn-primary" onclick="showAddKeyModal()">Add Key</button>' +
-      '<button class="btn" onclick="lockWallet()">Lock</button>';
+// proposeFromSafe opens the send dialog to propose a transaction from the
+// open Safe, signed by the first of its owners held here.
+async function proposeFromSafe() {
+  const sf = safeOpen.safe;
+  const owner = safeSigners.find(a => sf.owners.some(o => o.toLowerCase() === a.address.toLowerCase()));
+  hideModal('safes-modal');
+  await showSendModal({ action: 'send', endpoint: safeOpen.endpoint, from: owner.address, safe: sf.address });
+}
+
+// ── Approvals ──────────────────────────────────────────
+// Transactions submitted through /api/approvals (and, with REQUIRE_APPROVAL,
+// the server signing routes) wait here. The server pushes approval as
+// requests are queued, decided, or expire.
+async function loadApprovals() {
+  try {
+    const resp = await fetch('/api/approvals');
+    approvals = resp.ok ? await resp.json() : [];
+  } catch {
+    approvals = [];
   }
+  const pending = approvals.filter(r => r.status === 'pending').length;
+  document.getElementById('approvals-badge').textContent = pending ? String(pending) : '';
+  if (document.getElementById('approvals-modal').classList.contains('active')) renderApprovals();
 }
 
-function switchKey(index) {
-  activeKeyIndex = parseInt(index, 10);
-  renderWalletBar();
-  refresh();
+async function showApprovalsModal() {
+  document.getElementById('approvals-error').style.display = 'none';
+  document.getElementById('approvals-result').style.display = 'none';
+  await loadApprovals();
+  renderApprovals();
+  showModal('approvals-modal');
 }
 
-function showImportModal() {
-  document.getElementById('import-label').value = '';
-  document.getElementById('import-key').value = '';
-  document.getElementById('import-error').style.display = 'none';
-  showModal('import-modal');
+function renderApprovals() {
+  const pending = approvals.filter(r => r.status === 'pending');
+  document.getElementById('approvals-pending').innerHTML = pending.length ? pending.map(r =>
+    '<div class="approval-card">' +
+      '<div class="approval-head">' +
+        '<span class="approval-origin">' + esc(r.origin) + '</span>' +
+        '<span class="sched-meta">' + (r.broadcast ? 'sign and send' : 'sign only') + ' \u00b7 expires ' + esc(new Date(r.expires_at).toLocaleString()) + '</span>' +
+      '</div>' +
+      (r.note ? '<div class="approval-note">' + esc(r.note) + '</div>' : '') +
+      (r.envelope.warnings || []).map(w => '<div class="modal-warning">' + esc(warningText(w)) + '</div>').join('') +
+      (r.approvals_needed > 1 ? '<div class="approval-note">Needs ' + r.approvals_needed + ' approvers' +
+        (r.signoffs && r.signoffs.length ? ' \u00b7 signed off by ' + esc(r.signoffs.map(so => so.approver).join(', ')) : '') + '</div>' : '') +
+      reviewRows(r.envelope) +
+      '<div class="approval-actions admin-only">' +
+        '<button class="btn" onclick="decideApproval(\'' + esc(r.id) + '\', \'reject\', this)">Reject</button>' +
+        '<button class="btn btn-primary" onclick="decideApproval(\'' + esc(r.id) + '\', \'approve\', this)">Approve</button>' +
+      '</div>' +
+    '</div>'
+  ).join('') : '<p class="trash-empty">Nothing is waiting for approval.</p>';
+
+  const done = approvals.filter(r => r.status !== 'pending').slice(0, 10);
+  document.getElementById('approvals-done').innerHTML = done.length ? done.map(r =>
+    '<div class="sched-row">' +
+      '<span class="sched-name">' + esc(r.origin) + ' \u2014 ' + esc(r.envelope.summary.value) + ' to ' + esc(r.envelope.tx.to || '(contract creation)') + '</span>' +
+      '<span class="sched-meta">' + esc((r.signed && r.signed.hash) || r.error || '') + (r.decided_by ? ' \u00b7 ' + esc(r.decided_by) : '') + '</span>' +
+      '<span class="sched-status ' + esc(r.status) + '">' + esc(r.status) + '</span>' +
+    '</div>'
+  ).join('') : '<p class="trash-empty">No decisions yet.</p>';
 }
 
-// ── Refresh ────────────────────────────────────────────
-async function refresh() {
+// decideApproval approves (signs, and broadcasts if asked) or rejects a
+// queued transaction. With an approver token it signs off as that approver;
+// the idempotency key is left off then, since each approver's sign-off is a
+// different request.
+async function decideApproval(id, action, btn) {
+  const errEl = document.getElementById('approvals-error');
+  const resultEl = document.getElementById('approvals-result');
+  errEl.style.display = 'none';
+  resultEl.style.display = 'none';
+  btn.disabled = true;
+  const token = document.getElementById('approver-token').value.trim();
+  const headers = {};
+  if (token) headers['Authorization'] = 'Bearer ' + token;
+  else if (action === 'approve') headers['Idempotency-Key'] = 'approval-' + id;
   try {
-    const resp = await fetch('/api/status');
+    const resp = await fetch('/api/approvals/' + id + '/' + action, { method: 'POST', headers: headers });
     const data = await resp.json();
-    endpoints = data.endpoints || [];
-    renderEndpoints();
-    renderAccounts();
+    if (!resp.ok) throw new Error(data.error || 'Request failed.');
+    if (resp.status === 202) {
+      resultEl.style.display = 'block';
+      resultEl.textContent = 'Signed off. Waiting for ' + data.approvals_needed + ' approvers in all.';
+    }
+    if (data.signed) {
+      resultEl.style.display = 'block';
+      if (data.broadcast) {
+        resultEl.textContent = 'Sent: ' + data.signed.hash;
+        watchTx(data.envelope.endpoint, data.signed.hash, resultEl);
+      } else {
+        resultEl.textContent = 'Signed (not broadcast): ' + data.signed.raw;
+      }
+    }
   } catch (err) {
-    console.error('status poll failed:', err);
+    errEl.textContent = err.message;
+    errEl.style.display = 'block';
+  } finally {
+    btn.disabled = false;
   }
+  await loadApprovals();
+  renderApprovals();
 }
 
-// ── Render ─────────────────────────────────────────────
-function renderEndpoints() {
-  const container = document.getElementById('endpoints-container');
-  const walletAddress = getActiveAddress();
-
-  if (endpoints.length === 0) {
-    container.innerHTML =
-      '<div class="empty-state">' +
-        '<h2>No Endpoints Configured</h2>' +
-        '<p>Click "+ Add Endpoint" above to get started.</p>' +
-      '</div>';
+// ── Deep Links ─────────────────────────────────────────
+// primalwallet: links arrive as /?uri=<link>, either from the browser's
+// web+primalwallet handler or from 'wallet open' behind the OS handler.
+// They only pre-fill the Send dialog; nothing is signed without Confirm.
+async function openDeepLink() {
+  const uri = new URLSearchParams(location.search).get('uri');
+  if (!uri) return;
+  history.replaceState(null, '', location.pathname);
+  let link;
+  try {
+    const resp = await fetch('/api/deeplink?uri=' + encodeURIComponent(uri));
+    link = await resp.json();
+    if (!resp.ok) throw new Error(link.error || 'invalid link');
+  } catch (err) {
+    await showSendModal();
+    const errEl = document.getElementById('send-error');
+    errEl.textContent = 'Could not open link: ' + err.message;
+    errEl.style.display = 'block';
     return;
   }
+  await showSendModal(link);
+}
 
-  let html = '<div class="endpoints">';
-  for (const ep of endpoints) {
-    const statusClass = ep.online ? 'status-online' : 'status-offline';
-    const statusLabel = ep.online ? 'Online' : 'Offline';
-    const chainId = ep.chain_id ? hexToDecimal(ep.chain_id) : '\u2014';
-    const blockNum = ep.block_number ? hexToDecimal(ep.block_number) : '\u2014';
-    const latencyClass = ep.latency_ms < 200 ? 'fast' : ep.latency_ms < 1000 ? 'medium' : 'slow';
-    const urlAbbrev = abbreviateURL(ep.url);
+function registerLinkHandler() {
+  const errEl = document.getElementById('send-error');
+  try {
+    navigator.registerProtocolHandler('web+primalwallet', location.origin + '/?uri=%s');
+  } catch (err) {
+    errEl.textContent = 'This browser refused to register the link handler: ' + err.message;
+    errEl.style.display = 'block';
+  }
+}
 
-    html += '<div class="ep-card">';
-    html +=   '<div class="ep-card-header">';
-    html +=     '<h3>' + esc(ep.name) + '</h3>';
-    html +=     '<div style="display:flex;align-items:center;gap:0.25rem">';
-    html +=       '<span class="' + statusClass + '">';
-    html +=         '<span class="status-dot"></span>';
-    html +=         '<span class="status-text">' + statusLabel + '</span>';
-    html +=       '</span>';
-    html +=       '<div class="ep-card-actions">';
-    html +=         '<button class="btn-icon" onclick="editEndpoint(\'' + esc(ep.id) + '\')" title="Edit">&#9998;</button>';
-    html +=         '<button class="btn-icon danger" onclick="deleteEndpoint(\'' + esc(ep.id) + '\', \'' + esc(ep.name) + '\')" title="Delete">&#10005;</button>';
-    html +=       '</div>';
-    html +=     '</div>';
-    html +=   '</div>';
-    html +=   '<div class="ep-card-body">';
-    html +=     '<div class="ep-row">';
-    html +=       '<span class="label">RPC</span>';
-    html +=       '<span class="url-display" title="' + esc(ep.url) + '">' + esc(urlAbbrev) + '</span>';
-    html +=     '</div>';
-    html +=     '<div class="ep-row">';
-    html +=       '<span class="label">Chain ID</span>';
-    html +=       '<span class="value">' + chainId + '</span>';
-    html +=     '</div>';
-    html +=     '<div class="ep-row">';
-    html +=       '<span class="label">Block</span>';
-    html +=       '<span class="value">' + formatNumber(blockNum) + '</span>';
-    html +=     '</div>';
-    html +=     '<div class="ep-row">';
-    html +=       '<span class="label">Latency</span>';
-    html +=       '<span class="latency ' + latencyClass + '">' + ep.latency_ms + ' ms</span>';
-    html +=     '</div>';
+// ── Compare ────────────────────────────────────────────
+// The compare view measures two endpoints of one chain every push tick
+// (or every 5s by polling /api/compare while the socket is down).
+function showCompareModal() {
+  const selA = document.getElementById('compare-a');
+  selA.innerHTML = endpoints
+    .map(ep => '<option value="' + esc(ep.id) + '">' + esc(ep.name) + '</option>')
+    .join('');
+  // Start on the first endpoint that has a peer on its chain.
+  const first = endpoints.find(ep => ep.chain_id && comparePeers(ep).length > 0);
+  if (first) selA.value = first.id;
+  showModal('compare-modal');
+  compareChanged(true);
+}
 
-    if (walletAddress && ep.online) {
-      html +=   '<div class="ep-row" id="balance-' + esc(ep.id) + '">';
-      html +=     '<span class="label">Balance</span>';
-      html +=     '<span class="value balance" data-ep="' + esc(ep.id) + '">...</span>';
-      html +=   '</div>';
-    }
+function comparePeers(ep) {
+  return endpoints.filter(e => e.id !== ep.id && (!ep.chain_id || !e.chain_id || e.chain_id === ep.chain_id));
+}
 
-    html +=   '</div>';
-    html += '</div>';
+// compareChanged restarts the comparison after a pick. Changing the first
+// endpoint narrows the second to endpoints on the same chain.
+function compareChanged(first) {
+  const a = endpoints.find(ep => ep.id === document.getElementById('compare-a').value);
+  const selB = document.getElementById('compare-b');
+  if (first) {
+    const peers = a ? comparePeers(a) : [];
+    selB.innerHTML = peers
+      .map(ep => '<option value="' + esc(ep.id) + '">' + esc(ep.name) + '</option>')
+      .join('');
   }
-  html += '</div>';
-  container.innerHTML = html;
-
-  if (walletAddress) {
-    fetchBalances(walletAddress);
+  const errEl = document.getElementById('compare-error');
+  errEl.style.display = 'none';
+  stopCompare();
+  if (!a || !selB.value) {
+    document.getElementById('compare-table').innerHTML = '';
+    errEl.textContent = 'No other endpoint serves this chain.';
+    errEl.style.display = 'block';
+    return;
   }
+  comparePair = [a.id, selB.value];
+  startCompare();
 }
 
-// ── Balances ───────────────────────────────────────────
-async function fetchBalances(address) {
-  for (const ep of endpoints) {
-    if (!ep.online) continue;
-    try {
-      const resp = await fetch('/api/rpc/' + ep.id, {
-        method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ method: 'eth_getBalance', params: [address, 'latest'] })
-      });
-      const data = await resp.json();
-      if (data.result) {
-        const el = document.querySelector('[data-ep="' + ep.id + '"]');
-        if (el) {
-          el.textContent = formatBalance(data.result) + ' ' + (ep.symbol || 'ETH');
-        }
-      }
-    } catch (err) {
-      console.error('balance fetch failed for ' + ep.name + ':', err);
-    }
+function startCompare() {
+  if (compareTimer) {
+    clearInterval(compareTimer);
+    compareTimer = null;
+  }
+  if (pushSocket) {
+    pushSocket.send(JSON.stringify({ type: 'compare', endpoints: comparePair }));
+    return;
   }
+  pollCompare();
+  compareTimer = setInterval(pollCompare, 5000);
 }
 
-// ── Active Address Helper ──────────────────────────────
-function getActiveAddress() {
-  if (walletState !== 'unlocked' || decryptedKeys.length === 0) return '';
-  return decryptedKeys[activeKeyIndex].address;
+function stopCompare() {
+  if (comparePair.length && pushSocket) pushSocket.send(JSON.stringify({ type: 'compare', endpoints: [] }));
+  comparePair = [];
+  if (compareTimer) {
+    clearInterval(compareTimer);
+    compareTimer = null;
+  }
 }
 
-// ── Ethers.js Lazy Load ────────────────────────────────
-let ethersLoaded = false;
-function ensureEthers() {
-  if (ethersLoaded) return Promise.resolve();
-  return new Promise((resolve, reject) => {
-    const script = document.createElement('script');
-    script.src = 'https://cdnjs.cloudflare.com/ajax/libs/ethers/6.13.4/ethers.umd.min.js';
-    script.onload = () => { ethersLoaded = true; resolve(); };
-    script.onerror = () => reject(new Error('Failed to load ethers.js'));
-    document.head.appendChild(script);
-  });
+async function pollCompare() {
+  if (!comparePair.length) return;
+  try {
+    const resp = await fetch('/api/compare?a=' + encodeURIComponent(comparePair[0]) + '&b=' + encodeURIComponent(comparePair[1]));
+    const data = await resp.json();
+    renderCompare(resp.ok ? data : { error: data.error || 'Compare failed.' });
+  } catch (err) {
+    renderCompare({ error: err.message });
+  }
 }
 
-// ── Endpoint Management ─────────────────────────────────
-function showEndpointModal(editId) {
-  document.getElementById('endpoint-edit-id').value = editId || '';
-  document.getElementById('endpoint-name').value = '';
-  document.getElementById('endpoint-url').value = '';
-  document.getElementById('endpoint-symbol').value = '';
-  document.getElementById('endpoint-error').style.display = 'none';
-
-  if (editId) {
-    const ep = endpoints.find(e => e.id === editId);
-    if (ep) {
-      document.getElementById('endpoint-name').value = ep.name;
-      document.getElementById('endpoint-url').value = ep.url;
-      document.getElementById('endpoint-symbol').value = ep.symbol;
-    }
-    document.getElementById('endpoint-modal-title').textContent = 'Edit Endpoint';
-    document.getElementById('btn-endpoint-save').textContent = 'Save';
-  } else {
-    document.getElementById('endpoint-modal-title').textContent = 'Add Endpoint';
-    document.getElementById('btn-endpoint-save').textContent = 'Add';
+function renderCompare(msg) {
+  const errEl = document.getElementById('compare-error');
+  if (msg.error) {
+    errEl.textContent = msg.error;
+    errEl.style.display = 'block';
+    return;
   }
-  showModal('endpoint-modal');
+  errEl.style.display = 'none';
+  const [a, b] = msg.endpoints;
+  // Stale pushes for a previous pair are ignored.
+  if (a.id !== comparePair[0] || b.id !== comparePair[1]) return;
+
+  const num = hex => hex ? BigInt(hex) : null;
+  // best marks the better of two values: 1 for a, -1 for b, 0 for a tie or
+  // when either is missing.
+  const best = (x, y, higher) => {
+    if (x === null || y === null || x === y) return 0;
+    return (x > y) === higher ? 1 : -1;
+  };
+  const row = (label, x, y, cmp) =>
+    '<tr><th>' + label + '</th>' +
+      '<td' + (cmp === 1 ? ' class="best"' : '') + '>' + x + '</td>' +
+      '<td' + (cmp === -1 ? ' class="best"' : '') + '>' + y + '</td></tr>';
+
+  const blockA = num(a.block_number), blockB = num(b.block_number);
+  const blockText = (n, other) => {
+    if (n === null) return '\u2014';
+    let t = formatNumber(n.toString());
+    if (other !== null && n < other) t += ' <span class="compare-note">' + (other - n) + ' behind</span>';
+    return t;
+  };
+  const gasA = num(a.gas_price), gasB = num(b.gas_price);
+  const gasText = n => n === null ? '\u2014' : (Number(n) / 1e9).toFixed(2) + ' gwei';
+  const pendingText = m => m.pending_count === undefined ? '\u2014' :
+    formatNumber(m.pending_count) + ' <span class="compare-note">' + (m.pending_source === 'txpool' ? 'txpool' : 'pending block') + '</span>';
+  const pendA = a.pending_count === undefined ? null : a.pending_count;
+  const pendB = b.pending_count === undefined ? null : b.pending_count;
+
+  document.getElementById('compare-table').innerHTML =
+    row('', esc(a.name), esc(b.name), 0) +
+    row('Status', a.online ? 'online' : 'offline', b.online ? 'online' : 'offline', best(a.online, b.online, true)) +
+    row('Block height', blockText(blockA, blockB), blockText(blockB, blockA), best(blockA, blockB, true)) +
+    row('Latency', a.latency_ms + ' ms', b.latency_ms + ' ms', best(a.latency_ms, b.latency_ms, false)) +
+    row('Gas price', gasText(gasA), gasText(gasB), best(gasA, gasB, false)) +
+    // A bigger pool means the node sees more of the mempool.
+    row('Pending pool', pendingText(a), pendingText(b), a.pending_source === b.pending_source ? best(pendA, pendB, true) : 0);
 }
 
-function editEndpoint(id) {
-  showEndpointModal(id);
+// Stop measuring however the modal gets closed (button, overlay, Escape).
+new MutationObserver(() => {
+  if (!document.getElementById('compare-modal').classList.contains('active')) stopCompare();
+}).observe(document.getElementById('compare-modal'), { attributes: true, attributeFilter: ['class'] });
+
+// ── Broadcast ──────────────────────────────────────────
+function showBroadcastModal() {
+  const select = document.getElementById('broadcast-endpoint');
+  select.innerHTML = endpoints
+    .filter(ep => ep.online)
+    .map(ep => '<option value="' + esc(ep.id) + '">' + esc(ep.name) + '</option>')
+    .join('');
+  document.getElementById('broadcast-raw').value = '';
+  document.getElementById('broadcast-private').checked = false;
+  document.getElementById('broadcast-error').style.display = 'none';
+  document.getElementById('broadcast-result').style.display = 'none';
+  showModal('broadcast-modal');
 }
 
-async function saveEndpoint() {
-  const editId = document.getElementById('endpoint-edit-id').value;
-  const name = document.getElementById('endpoint-name').value.trim();
-  const url = document.getElementById('endpoint-url').value.trim();
-  const symbol = document.getElementById('endpoint-symbol').value.trim();
-  const errEl = document.getElementById('endpoint-error');
-  const btn = document.getElementById('btn-endpoint-save');
+async function broadcastRaw() {
+  const errEl = document.getElementById('broadcast-error');
+  const resultEl = document.getElementById('broadcast-result');
+  const btn = document.getElementById('btn-broadcast');
+  const epId = document.getElementById('broadcast-endpoint').value;
+  const raw = document.getElementById('broadcast-raw').value.trim();
+  const isPrivate = document.getElementById('broadcast-private').checked;
   errEl.style.display = 'none';
-
-  if (!name || !url || !symbol) {
-    errEl.textContent = 'All fields are required.';
+  resultEl.style.display = 'none';
+  if (!epId) {
+    errEl.textContent = 'No online endpoint to broadcast through.';
+    errEl.style.display = 'block';
+    return;
+  }
+  if (!/^(0x)?[0-9a-fA-F]+$/.test(raw)) {
+    errEl.textContent = 'Paste the signed transaction as hex.';
     errEl.style.display = 'block';
     return;
   }
 
   btn.disabled = true;
   try {
-    const isEdit = !!editId;
-    const resp = await fetch(isEdit ? '/api/endpoints/' + editId : '/api/endpoints', {
-      method: isEdit ? 'PUT' : 'POST',
+    const resp = await fetch('/api/broadcast', {
+      method: 'POST',
       headers: { 'Content-Type': 'application/json' },
-      body: JSON.stringify({ name, url, symbol })
+      body: JSON.stringify({ endpoint: epId, raw: raw, private: isPrivate })
     });
     const data = await resp.json();
-    if (!resp.ok) {
-      errEl.textContent = data.error || 'Failed to save endpoint.';
-      errEl.style.display = 'block';
-      return;
-    }
-    hideModal('endpoint-modal');
-    refresh();
+    if (!resp.ok) throw new Error(data.error || 'broadcast failed');
+    resultEl.textContent = (data.private_endpoint ? 'Sent privately: ' : 'Sent: ') + data.hash;
+    resultEl.style.display = 'block';
+    watchTx(epId, data.hash, resultEl);
   } catch (err) {
-    errEl.textContent = 'Request failed: ' + err.message;
+    errEl.textContent = err.message;
     errEl.style.display = 'block';
   } finally {
     btn.disabled = false;
   }
 }
 
-function deleteEndpoint(id, name) {
-  document.getElementById('delete-endpoint-id').value = id;
-  document.getElementById('delete-endpoint-name').textContent = name;
-  document.getElementById('delete-endpoint-error').style.display = 'none';
-  showModal('delete-endpoint-modal');
+// ── Search ─────────────────────────────────────────────
+let searchTimer = null;
+let searchSeq = 0;
+let searchResults = [];
+let searchSelected = 0;
+
+function showSearchModal() {
+  const input = document.getElementById('search-input');
+  input.value = '';
+  searchResults = [];
+  document.getElementById('search-results').innerHTML = '';
+  document.getElementById('search-error').textContent = '';
+  showModal('search-modal');
+  input.focus();
 }
 
-async function confirmDeleteEndpoint() {
-  const id = document.getElementById('delete-endpoint-id').value;
-  const errEl = document.getElementById('delete-endpoint-error');
-  const btn = document.getElementById('btn-endpoint-delete');
-  errEl.style.display = 'none';
+// searchSoon searches once typing pauses. A full hash or address can take
+// the server a few seconds to look up on the endpoints.
+function searchSoon() {
+  clearTimeout(searchTimer);
+  searchTimer = setTimeout(runSearch, 200);
+}
 
-  btn.disabled = true;
+async function runSearch() {
+  const q = document.getElementById('search-input').value.trim();
+  const seq = ++searchSeq;
+  const errEl = document.getElementById('search-error');
+  if (q.length < 2) {
+    searchResults = [];
+    renderSearchResults();
+    return;
+  }
   try {
-    const resp = await fetch('/api/endpoints/' + id, { method: 'DELETE' });
+    const resp = await fetch('/api/search?q=' + encodeURIComponent(q));
     const data = await resp.json();
-    if (!resp.ok) {
-      errEl.textContent = data.error || 'Failed to delete endpoint.';
-      errEl.style.display = 'block';
-      return;
-    }
-    hideModal('delete-endpoint-modal');
-    refresh();
+    if (seq !== searchSeq) return;
+    if (!resp.ok) throw new Error(data.error || 'Search failed.');
+    searchResults = data;
+    searchSelected = 0;
+    errEl.textContent = searchResults.length ? '' : 'Nothing found.';
   } catch (err) {
-    errEl.textContent = 'Request failed: ' + err.message;
-    errEl.style.display = 'block';
-  } finally {
-    btn.disabled = false;
+    if (seq !== searchSeq) return;
+    searchResults = [];
+    errEl.textContent = err.message;
   }
+  renderSearchResults();
 }
 
-// ── Accounts Section ────────────────────────────────────
-function renderAccounts() {
-  const container = document.getElementById('accounts-container');
-  if (walletState !== 'unlocked' || decryptedKeys.length === 0 || endpoints.length === 0) {
-    container.innerHTML = '';
-    return;
-  }
-
-  let html = '<div class="acct-section-header"><h2>Accounts</h2></div>';
-
-  for (const ep of endpoints) {
-    const isOpen = expandedAccounts.has(ep.id);
-    const statusClass = ep.online ? 'status-online' : 'status-offline';
-    const statusLabel = ep.online ? 'Online' : 'Offline';
+function renderSearchResults() {
+  let html = '';
+  searchResults.forEach((r, i) => {
+    html += '<li class="' + (i === searchSelected ? 'selected' : '') + '" onclick="openSearchResult(' + i + ')" onmousemove="selectSearchResult(' + i + ')" title="' + esc(r.address || r.hash || '') + '">';
+    html +=   '<span class="search-kind">' + esc(r.kind) + '</span>';
+    html +=   '<span class="search-title">' + esc(r.title) + '</span>';
+    html +=   '<span class="search-detail">' + esc(r.detail || '') + '</span>';
+    html += '</li>';
+  });
+  document.getElementById('search-results').innerHTML = html;
+}
 
-    html += '<div class="acct-card">';
-    html +=   '<div class="acct-card-header" onclick="toggleAccount(\'' + esc(ep.id) + '\')">';
-    html +=     '<span class="acct-name">';
-    html +=       '<span class="chevron' + (isOpen ? ' open' : '') + '">&#9654;</span> ';
-    html +=       esc(ep.name);
-    html +=     '</span>';
-    html +=     '<span class="' + statusClass + '">';
-    html +=       '<span class="status-dot"></span>';
-    html +=       '<span class="status-text">' + statusLabel + '</span>';
-    html +=     '</span>';
-    html +=   '</div>';
+function selectSearchResult(i) {
+  if (i === searchSelected) return;
+  searchSelected = i;
+  document.querySelectorAll('#search-results li').forEach((li, j) => li.classList.toggle('selected', j === i));
+}
 
-    html +=   '<div class="acct-card-body' + (isOpen ? ' open' : '') + '">';
+function searchKey(e) {
+  if (e.key === 'ArrowDown' || e.key === 'ArrowUp') {
+    e.preventDefault();
+    if (!searchResults.length) return;
+    const n = searchResults.length;
+    selectSearchResult((searchSelected + (e.key === 'ArrowDown' ? 1 : n - 1)) % n);
+    document.querySelectorAll('#search-results li')[searchSelected].scrollIntoView({block: 'nearest'});
+  } else if (e.key === 'Enter' && searchResults.length) {
+    e.preventDefault();
+    openSearchResult(searchSelected);
+  }
+}
 
-    // Connection details
-    const chainId = ep.chain_id ? hexToDecimal(ep.chain_id) : '\u2014';
-    const blockNum = ep.block_number ? hexToDecimal(ep.block_number) : '\u2014';
-    const latencyClass = ep.latency_ms < 200 ? 'fast' : ep.latency_ms < 1000 ? 'medium' : 'slow';
-    html +=     '<div class="acct-detail-row">';
-    html +=       'RPC: <span class="mono">' + esc(abbreviateURL(ep.url)) + '</span>';
-    html +=       '<div class="detail-stats">';
-    html +=         '<span>Chain ID: ' + chainId + '</span>';
-    html +=         '<span>Block: ' + formatNumber(blockNum) + '</span>';
-    html +=         '<span class="latency ' + latencyClass + '">' + ep.latency_ms + ' ms</span>';
-    html +=       '</div>';
-    html +=     '</div>';
+// openSearchResult shows an endpoint's card, lists a tag's addresses, and
+// copies anything else's address or hash.
+async function openSearchResult(i) {
+  const r = searchResults[i];
+  if (!r) return;
+  if (r.kind === 'tag') {
+    document.getElementById('search-input').value = r.tag;
+    runSearch();
+    return;
+  }
+  if (r.kind === 'endpoint') {
+    hideModal('search-modal');
+    const card = document.querySelector('.ep-card[data-id="' + CSS.escape(r.endpoint) + '"]');
+    if (!card) return;
+    card.scrollIntoView({behavior: 'smooth', block: 'center'});
+    card.classList.add('found');
+    setTimeout(() => card.classList.remove('found'), 2000);
+    return;
+  }
+  const text = r.hash || r.address;
+  if (!text) return;
+  try {
+    await navigator.clipboard.writeText(text);
+    hideModal('search-modal');
+    showNotice('Copied ' + text);
+  } catch (err) {
+    document.getElementById('search-error').textContent = 'Could not copy: ' + err.message;
+  }
+}
 
-    // Key sections
-    for (const k of decryptedKeys) {
-      const balKey = accountBalances[ep.id] && accountBalances[ep.id][k.address];
-      const balText = balKey || '...';
-      const balClass = balKey ? '' : ' loading';
+// ── Soft Delete & Recycle Bin ──────────────────────────
+const UNDO_WINDOW_MS = 30000;
+let toastUndo = null;
+let toastTimer = null;
+
+// showUndoToast offers to reverse a deletion for 30 seconds. After that the
+// item stays in the recycle bin until restored or purged from there.
+function showUndoToast(message, undoFn) {
+  clearTimeout(toastTimer);
+  toastUndo = undoFn;
+  document.getElementById('toast-undo').style.display = '';
+  document.getElementById('toast-text').textContent = message;
+  document.getElementById('toast').classList.add('active');
+  toastTimer = setTimeout(hideToast, UNDO_WINDOW_MS);
+}
 
-      html +=   '<div class="acct-key-section">';
-      html +=     '<div class="acct-key-header">';
-      html +=       '<span class="key-label">' + esc(k.label) + '</span>';
-      html +=       '<button class="btn-rename" onclick="event.stopPropagation(); showRenameModal(' + k.id + ', \'' + esc(k.label).replace(/'/g, "\\'") + '\')">rename</button>';
-      html +=     '</div>';
-      html +=     '<div class="acct-key-address">' + k.address + '</div>';
-      html +=     '<div class="acct-key-balance' + balClass + '" data-acct-bal="' + esc(ep.id) + '-' + esc(k.address) + '">' + balText + '</div>';
-      html +=   '</div>';
-    }
+// showNotice shows message in the toast, without Undo.
+function showNotice(message) {
+  showUndoToast(message, null);
+  document.getElementById('toast-undo').style.display = 'none';
+}
 
-    // Add key button
-    html +=     '<div class="acct-add-key">';
-    html +=       '<button class="btn" onclick="event.stopPropagation(); showAddKeyModal()">+ Add Key</button>';
-    html +=     '</div>';
+function hideToast() {
+  clearTimeout(toastTimer);
+  toastUndo = null;
+  document.getElementById('toast').classList.remove('active');
+}
 
-    html +=   '</div>'; // acct-card-body
-    html += '</div>';   // acct-card
+async function undoToast() {
+  const fn = toastUndo;
+  hideToast();
+  if (!fn) return;
+  try {
+    await fn();
+  } catch (err) {
+    alert('Undo failed: ' + err.message);
   }
+}
 
-  container.innerHTML = html;
+async function setKeyDeleted(id, deleted) {
+  const db = await openVaultDB();
+  return new Promise((resolve, reject) => {
+    const tx = db.transaction('keys', 'readwrite');
+    const store = tx.objectStore('keys');
+    const req = store.get(id);
+    req.onsuccess = () => {
+      const rec = req.result;
+      if (!rec) { reject(new Error('Key not found')); return; }
+      if (deleted) rec.deletedAt = Date.now(); else delete rec.deletedAt;
+      rec.dirty = true;
+      rec.updatedAt = Date.now();
+      store.put(rec);
+    };
+    tx.oncomplete = () => {
+      scheduleKeySync();
+      resolve();
+    };
+    tx.onerror = () => reject(tx.error);
+  });
+}
 
-  // Fetch balances for expanded cards
-  for (const epId of expandedAccounts) {
-    const ep = endpoints.find(e => e.id === epId);
-    if (ep && ep.online) fetchAccountBalances(epId);
+async function removeKey(id) {
+  const idx = decryptedKeys.findIndex(k => k.id === id);
+  if (idx < 0) return;
+  const label = decryptedKeys[idx].label;
+  try {
+    await setKeyDeleted(id, true);
+  } catch (err) {
+    alert('Failed: ' + err.message);
+    return;
   }
+  decryptedKeys[idx].key = '';
+  decryptedKeys.splice(idx, 1);
+  if (activeKeyIndex >= decryptedKeys.length) activeKeyIndex = Math.max(0, decryptedKeys.length - 1);
+  storedKeyCount = decryptedKeys.length;
+  renderWalletBar();
+  refresh();
+  showUndoToast('Removed ' + label, () => restoreKey(id));
 }
 
-function toggleAccount(epId) {
-  if (expandedAccounts.has(epId)) {
-    expandedAccounts.delete(epId);
-  } else {
-    expandedAccounts.add(epId);
+// restoreKey clears a key's tombstone and, if the wallet is unlocked,
+// decrypts it back into memory.
+async function restoreKey(id) {
+  await setKeyDeleted(id, false);
+  storedKeyCount++;
+  if (walletState === 'unlocked' && aesKey) {
+    const rec = (await getEncryptedKeys()).find(k => k.id === id);
+    const plaintext = await decryptPrivateKey(new Uint8Array(rec.encrypted), new Uint8Array(rec.iv), aesKey);
+    decryptedKeys.push({ id: rec.id, label: rec.label, address: rec.address, key: plaintext });
+    decryptedKeys.sort((a, b) => a.id - b.id);
   }
-  renderAccounts();
+  renderWalletBar();
+  refresh();
 }
 
-async function fetchAccountBalances(epId) {
-  const ep = endpoints.find(e => e.id === epId);
-  if (!ep || !ep.online) return;
+async function showTrashModal() {
+  document.getElementById('trash-error').style.display = 'none';
+  showModal('trash-modal');
+  await renderTrash();
+}
 
-  if (!accountBalances[epId]) accountBalances[epId] = {};
+async function renderTrash() {
+  const listEl = document.getElementById('trash-list');
+  const errEl = document.getElementById('trash-error');
+  try {
+    const resp = await fetch('/api/trash');
+    const data = await resp.json();
+    const keys = (await getEncryptedKeys()).filter(k => k.deletedAt);
 
-  for (const k of decryptedKeys) {
-    try {
-      const resp = await fetch('/api/rpc/' + epId, {
-        method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ method: 'eth_getBalance', params: [k.address, 'latest'] })
-      });
-      const data = await resp.json();
-      if (data.result) {
-        const formatted = formatBalance(data.result) + ' ' + (ep.symbol || 'ETH');
-        accountBalances[epId][k.address] = formatted;
-        const el = document.querySelector('[data-acct-bal="' + ep.id + '-' + k.address + '"]');
-        if (el) {
-          el.textContent = formatted;
-          el.classList.remove('loading');
-        }
-      }
-    } catch (err) {
-      console.error('account balance fetch failed:', err);
+    const rows = [];
+    for (const ep of data.endpoints || []) {
+      rows.push(trashRow('endpoint', ep.name, 'restoreTrashEndpoint(\'' + esc(ep.id) + '\')', 'purgeTrashEndpoint(\'' + esc(ep.id) + '\')'));
+    }
+    for (const a of data.accounts || []) {
+      rows.push(trashRow(a.kind + ' account', a.label + ' (' + a.address.slice(0, 8) + '...)', 'restoreTrashAccount(\'' + a.address + '\')', 'purgeTrashAccount(\'' + a.address + '\')'));
+    }
+    for (const b of data.bookmarks || []) {
+      rows.push(trashRow('bookmark', b.note || 'Block ' + b.block_number, 'restoreTrashBookmark(\'' + esc(b.id) + '\')', 'purgeTrashBookmark(\'' + esc(b.id) + '\')'));
+    }
+    for (const ct of data.contacts || []) {
+      rows.push(trashRow('contact', ct.address, 'restoreTrashContact(\'' + ct.address + '\')', 'purgeTrashContact(\'' + ct.address + '\')'));
+    }
+    for (const sc of data.schedules || []) {
+      rows.push(trashRow('schedule', sc.name, 'restoreTrashSchedule(\'' + esc(sc.id) + '\')', 'purgeTrashSchedule(\'' + esc(sc.id) + '\')'));
+    }
+    for (const k of keys) {
+      rows.push(trashRow('key', k.label + ' (' + k.address.slice(0, 8) + '...)', 'restoreTrashKey(' + k.id + ')', 'purgeTrashKey(' + k.id + ')'));
     }
+    listEl.innerHTML = rows.length ? rows.join('') : '<p class="trash-empty">The recycle bin is empty.</p>';
+  } catch (err) {
+    errEl.textContent = 'Failed to load recycle bin: ' + err.message;
+    errEl.style.display = 'block';
   }
 }
 
-function showRenameModal(keyId, currentLabel) {
-  document.getElementById('rename-key-id').value = keyId;
-  document.getElementById('rename-key-label').value = currentLabel;
-  document.getElementById('rename-key-error').style.display = 'none';
-  showModal('rename-key-modal');
-  document.getElementById('rename-key-label').focus();
+function trashRow(kind, name, restoreCall, purgeCall) {
+  return '<div class="trash-row">' +
+    '<span class="trash-name">' + esc(name) + ' <span class="trash-kind">' + esc(kind) + '</span></span>' +
+    '<button class="btn" onclick="' + restoreCall + '">Restore</button>' +
+    '<button class="btn btn-danger" onclick="' + purgeCall + '">Delete Forever</button>' +
+  '</div>';
 }
 
-async function doRenameKey() {
-  const keyId = parseInt(document.getElementById('rename-key-id').value, 10);
-  const newLabel = document.getElementById('rename-key-label').value.trim();
-  const errEl = document.getElementById('rename-key-error');
-  const btn = document.getElementById('btn-rename-save');
+async function trashAction(fn) {
+  const errEl = document.getElementById('trash-error');
   errEl.style.display = 'none';
-
-  if (!newLabel) {
-    errEl.textContent = 'Label cannot be empty.';
-    errEl.style.display = 'block';
-    return;
-  }
-
-  btn.disabled = true;
   try {
-    await updateKeyLabel(keyId, newLabel);
-    // Update in-memory
-    const dk = decryptedKeys.find(k => k.id === keyId);
-    if (dk) dk.label = newLabel;
-    hideModal('rename-key-modal');
-    renderWalletBar();
-    renderAccounts();
+    await fn();
+    await renderTrash();
   } catch (err) {
-    errEl.textContent = 'Failed: ' + err.message;
+    errEl.textContent = err.message;
     errEl.style.display = 'block';
-  } finally {
-    btn.disabled = false;
   }
 }
 
-async function updateKeyLabel(id, newLabel) {
-  const db = await openVaultDB();
-  return new Promise((resolve, reject) => {
-    const tx = db.transaction('keys', 'readwrite');
-    const store = tx.objectStore('keys');
-    const req = store.get(id);
-    req.onsuccess = () => {
-      const rec = req.result;
-      if (!rec) { reject(new Error('Key not found')); return; }
-      rec.label = newLabel;
-      store.put(rec);
-    };
-    tx.oncomplete = () => resolve();
-    tx.onerror = () => reject(tx.error);
+async function trashFetch(url, method) {
+  const resp = await fetch(url, { method });
+  const data = await resp.json();
+  if (!resp.ok) throw new Error(data.error || 'Request failed.');
+  return data;
+}
+
+function restoreTrashEndpoint(id) {
+  trashAction(async () => { await trashFetch('/api/endpoints/' + id + '/restore', 'POST'); refresh(); });
+}
+
+function purgeTrashEndpoint(id) {
+  if (!confirm('Permanently delete this endpoint?')) return;
+  trashAction(() => trashFetch('/api/trash/endpoints/' + id, 'DELETE'));
+}
+
+function restoreTrashAccount(address) {
+  trashAction(async () => {
+    await trashFetch('/api/accounts/' + address + '/restore', 'POST');
+    await loadHardwareAccounts();
+    renderAccounts();
+  });
+}
+
+function purgeTrashAccount(address) {
+  if (!confirm('Permanently delete this account?')) return;
+  trashAction(() => trashFetch('/api/trash/accounts/' + address, 'DELETE'));
+}
+
+function restoreTrashBookmark(id) {
+  trashAction(async () => {
+    await trashFetch('/api/bookmarks/' + id + '/restore', 'POST');
+    await loadBookmarks();
+    renderAccounts();
+  });
+}
+
+function purgeTrashBookmark(id) {
+  if (!confirm('Permanently delete this bookmark?')) return;
+  trashAction(() => trashFetch('/api/trash/bookmarks/' + id, 'DELETE'));
+}
+
+function restoreTrashContact(address) {
+  trashAction(() => trashFetch('/api/contacts/' + address + '/restore', 'POST'));
+}
+
+function purgeTrashContact(address) {
+  if (!confirm('Permanently delete this contact?')) return;
+  trashAction(() => trashFetch('/api/trash/contacts/' + address, 'DELETE'));
+}
+
+function restoreTrashSchedule(id) {
+  trashAction(async () => {
+    await trashFetch('/api/schedules/' + id + '/restore', 'POST');
+    await loadSchedules();
   });
 }
 
+function purgeTrashSchedule(id) {
+  if (!confirm('Permanently delete this schedule?')) return;
+  trashAction(() => trashFetch('/api/trash/schedules/' + id, 'DELETE'));
+}
+
+function restoreTrashKey(id) {
+  trashAction(() => restoreKey(id));
+}
+
+function purgeTrashKey(id) {
+  if (!confirm('Permanently delete this private key? Without a backup, funds it controls will be lost.')) return;
+  trashAction(() => purgeKey(id));
+}
+
 // ── Helpers ────────────────────────────────────────────
 function hexToDecimal(hex) {
   if (!hex || hex === '0x') return '0';
@@ -1623,12 +9548,55 @@ function formatNumber(n) {
   return Number(n).toLocaleString();
 }
 
-function formatBalance(hexWei) {
-  const wei = BigInt(hexWei);
-  const ether = Number(wei) / 1e18;
-  if (ether === 0) return '0';
-  if (ether < 0.0001) return '< 0.0001';
-  return ether.toFixed(4);
+// formatDuration rounds a number of seconds to its largest unit.
+function formatDuration(secs) {
+  if (secs < 60) return Math.max(1, Math.round(secs)) + ' s';
+  if (secs < 3600) return Math.round(secs / 60) + ' min';
+  if (secs < 86400) return Math.round(secs / 3600) + ' h';
+  return formatNumber(Math.round(secs / 86400)) + ' days';
+}
+
+function formatBalance(wei, decimals) {
+  wei = BigInt(wei); // hex quantity or decimal string
+  const whole = Number(wei) / 10 ** (decimals ?? 18);
+  if (whole === 0) return '0';
+  if (whole < 0.0001) return '< 0.0001';
+  return whole.toFixed(4);
+}
+
+// formatAmount formats an amount of ep's native currency with its symbol.
+function formatAmount(wei, ep) {
+  return formatBalance(wei, ep && ep.decimals) + ' ' + ((ep && ep.symbol) || 'ETH');
+}
+
+function bytesToHex(bytes) {
+  return Array.from(bytes, b => b.toString(16).padStart(2, '0')).join('');
+}
+
+// parseUnits converts whole units ("0.05") of ep's native currency to a
+// decimal string in its smallest unit.
+function parseUnits(s, ep) {
+  const decimals = (ep && ep.decimals) ?? 18;
+  const m = new RegExp('^(\\d*)(?:\\.(\\d{0,' + decimals + '}))?$').exec(s.trim());
+  if (!m || (m[1] === '' && !m[2])) throw new Error('Invalid amount: ' + s);
+  return (BigInt(m[1] || '0') * 10n ** BigInt(decimals) + BigInt((m[2] || '').padEnd(decimals, '0') || '0')).toString();
+}
+
+function hexToBytes(hex) {
+  hex = hex.replace(/^0x/, '');
+  const out = new Uint8Array(hex.length / 2);
+  for (let i = 0; i < out.length; i++) out[i] = parseInt(hex.substr(i * 2, 2), 16);
+  return out;
+}
+
+function concatBytes(...parts) {
+  const out = new Uint8Array(parts.reduce((n, p) => n + p.length, 0));
+  let off = 0;
+  for (const p of parts) {
+    out.set(p, off);
+    off += p.length;
+  }
+  return out;
 }
 
 function abbreviateURL(url) {
@@ -1643,10 +9611,47 @@ function abbreviateURL(url) {
   }
 }
 
+// endpointState returns an endpoint's status class, label, and tooltip. A
+// forked or lagging endpoint is online but its state can't be trusted.
+function endpointState(ep) {
+  if (!ep.online && ep.recovering) {
+    return ['status-offline', 'Recovering', 'Answered the last ' + ep.recovering + ' check' + (ep.recovering === 1 ? '' : 's') + '; shown online after a few in a row'];
+  }
+  if (!ep.online) return ['status-offline', 'Offline', ep.failures > 1 ? ep.failures + ' failed checks in a row; checked less often until it answers' : ''];
+  const flags = ep.flags || [];
+  if (flags.includes('forked')) {
+    return ['status-warn', 'Forked', 'Its blocks differ from most endpoints on this chain'];
+  }
+  if (flags.includes('lagging')) {
+    return ['status-warn', 'Lagging', formatNumber(ep.lag_blocks) + ' blocks behind the highest endpoint on this chain'];
+  }
+  return ['status-online', 'Online', ''];
+}
+
+// capabilityText lists what an endpoint was found to serve beyond the basics,
+// and whether it is an archive or a full node.
+function capabilityText(c) {
+  if (!c) return '\u2014';
+  const out = [];
+  if (c.debug) out.push('debug');
+  if (c.trace) out.push('trace');
+  if (c.txpool) out.push('txpool');
+  if (c.fee_history) out.push('fee history');
+  if (c.websocket) out.push('WebSocket');
+  if (c.archive) out.push('archive node');
+  else if (c.state_depth) out.push('full node, state ' + formatNumber(c.state_depth) + ' blocks back');
+  else out.push('full node');
+  return out.join(' \u00b7 ');
+}
+
+// esc escapes s for HTML text and quoted attribute values. It is not
+// enough for a JavaScript string inside an onclick attribute, since the
+// browser decodes the entities before running it: put free text in data-*
+// attributes and bind handlers with addEventListener instead.
 function esc(s) {
   const d = document.createElement('div');
   d.textContent = s || '';
-  return d.innerHTML;
+  return d.innerHTML.replace(/"/g, '&quot;').replace(/'/g, '&#39;');
 }
 
 function showModal(id) {
@@ -1656,24 +9661,42 @@ function hideModal(id) {
   document.getElementById(id).classList.remove('active');
 }
 
-// Close modals on overlay click.
+// Close modals on overlay click. The login modal stays until login.
 document.querySelectorAll('.modal-overlay').forEach(overlay => {
   overlay.addEventListener('click', (e) => {
-    if (e.target === overlay) overlay.classList.remove('active');
+    if (e.target === overlay && !overlay.dataset.persistent) overlay.classList.remove('active');
   });
 });
 
+// Search on Ctrl/Cmd+K.
+document.addEventListener('keydown', (e) => {
+  if ((e.ctrlKey || e.metaKey) && !e.shiftKey && e.key.toLowerCase() === 'k' && !BROADCAST_ONLY) {
+    e.preventDefault();
+    showSearchModal();
+  }
+});
+
+// Panic lock on Ctrl/Cmd+Shift+L.
+document.addEventListener('keydown', (e) => {
+  if ((e.ctrlKey || e.metaKey) && e.shiftKey && e.key.toLowerCase() === 'l') {
+    e.preventDefault();
+    panicLock(true);
+  }
+});
+
 // Close modals on Escape key.
 document.addEventListener('keydown', (e) => {
   if (e.key === 'Escape') {
-    document.querySelectorAll('.modal-overlay.active').forEach(m => m.classList.remove('active'));
+    document.querySelectorAll('.modal-overlay.active:not([data-persistent])').forEach(m => m.classList.remove('active'));
   }
 });
 
 // Submit password modals on Enter key.
 document.addEventListener('keydown', (e) => {
   if (e.key !== 'Enter') return;
-  if (document.getElementById('password-setup-modal').classList.contains('active')) {
+  if (document.getElementById('login-modal').classList.contains('active')) {
+    login();
+  } else if (document.getElementById('password-setup-modal').classList.contains('active')) {
     setupWithPassword();
   } else if (document.getElementById('password-unlock-modal').classList.contains('active')) {
     unlockWithPassword();
@@ -1683,6 +9706,8 @@ document.addEventListener('keydown', (e) => {
     doRenameKey();
   } else if (document.getElementById('endpoint-modal').classList.contains('active')) {
     saveEndpoint();
+  } else if (document.getElementById('labels-modal').classList.contains('active')) {
+    saveLabelTemplate();
   }
 });
 </script>
@@ -0,0 +1,166 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/qr"
+	"github.com/primal-host/wallet/internal/user"
+)
+
+// deviceCookie carries a paired device's secret. It outlives login
+// sessions: a device stays paired until it is revoked.
+const deviceCookie = "wallet_device"
+
+// deviceCookieAge is the longest lifetime browsers accept for a cookie.
+const deviceCookieAge = 400 * 24 * time.Hour
+
+// handleListDevices lists the caller's paired devices, or every device for
+// admins.
+func (s *Server) handleListDevices(c echo.Context) error {
+	p := s.profileFor(c.Request().Context())
+	owner := p.user.ID
+	if p.can(user.PermAdmin) {
+		owner = ""
+	}
+	return c.JSON(http.StatusOK, s.devices.List(owner))
+}
+
+// handleStartPairing issues a one-time pairing code for the caller and
+// returns it as a dashboard URL, with the TLS certificate fingerprint the
+// device should see, and as a QR code of both.
+func (s *Server) handleStartPairing(c echo.Context) error {
+	me := *s.profileFor(c.Request().Context()).user
+	code, expires, err := s.devices.StartPairing(me)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	host := c.Request().Host
+	link := c.Scheme() + "://" + host + "/#pair=" + code
+	fingerprint := ""
+	if c.Scheme() == "https" {
+		if fingerprint, err = tlsFingerprint(host); err != nil {
+			slog.Warn("TLS fingerprint unavailable for pairing", "subsystem", "devices", "host", host, "error", err)
+		} else {
+			link += "&fp=" + strings.ReplaceAll(fingerprint, ":", "")
+		}
+	}
+	img, err := qr.Encode(link)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	slog.Info("device pairing started", "subsystem", "devices", "user", me.Name, "expires", expires.Format(time.RFC3339))
+	return c.JSON(http.StatusCreated, map[string]any{
+		"url":         link,
+		"fingerprint": fingerprint,
+		"expires_at":  expires.UTC(),
+		"svg":         img.SVG(4),
+	})
+}
+
+// handlePair redeems a pairing code and gives the browser that sent it a
+// device cookie. It is public: the device has no login yet.
+func (s *Server) handlePair(c echo.Context) error {
+	var req struct {
+		Code string `json:"code"`
+		Name string `json:"name"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if req.Name == "" {
+		req.Name = deviceName(c.Request().UserAgent())
+	}
+	d, secret, err := s.devices.Pair(req.Code, req.Name)
+	if err != nil {
+		if errors.Is(err, user.ErrInvalidName) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		slog.Warn("device pairing failed", "subsystem", "devices", "ip", c.RealIP(), "error", err)
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     deviceCookie,
+		Value:    secret,
+		Path:     "/",
+		MaxAge:   int(deviceCookieAge.Seconds()),
+		HttpOnly: true,
+		Secure:   c.IsTLS(),
+		SameSite: http.SameSiteStrictMode,
+	})
+	slog.Info("device paired", "subsystem", "devices", "device", d.Name, "id", d.ID, "user", d.Owner, "ip", c.RealIP())
+	return c.JSON(http.StatusCreated, d)
+}
+
+// handleRevokeDevice unpairs one of the caller's devices; admins may unpair
+// anyone's.
+func (s *Server) handleRevokeDevice(c echo.Context) error {
+	p := s.profileFor(c.Request().Context())
+	d, ok := s.devices.Get(c.Param("id"))
+	if !ok || (d.User != p.user.ID && !p.can(user.PermAdmin)) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device " + c.Param("id") + " not found"})
+	}
+	if err := s.devices.Revoke(d.ID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	slog.Info("device revoked", "subsystem", "devices", "device", d.Name, "id", d.ID, "owner", d.Owner, "by", p.user.Name)
+	return c.JSON(http.StatusOK, map[string]string{"status": "revoked"})
+}
+
+// tlsFingerprint connects to host the way a device would and returns the
+// SHA-256 fingerprint of the certificate it is shown, in the colon-separated
+// form browsers display. Behind a reverse proxy that is the proxy's
+// certificate, not one the wallet has.
+func tlsFingerprint(host string) (string, error) {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "443")
+	}
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	// Not verifying is the point: the device compares the fingerprint
+	// itself, which also covers self-signed LAN certificates.
+	conn, err := tls.DialWithDialer(dialer, "tcp", host, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return "", fmt.Errorf("%s sent no certificate", host)
+	}
+	sum := sha256.Sum256(certs[0].Raw)
+	hexes := make([]string, len(sum))
+	for i, b := range sum {
+		hexes[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(hexes, ":"), nil
+}
+
+// deviceName names a device after its browser's platform.
+func deviceName(userAgent string) string {
+	for _, p := range []struct{ match, name string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android device"},
+		{"Macintosh", "Mac"},
+		{"Windows", "Windows PC"},
+		{"Linux", "Linux device"},
+	} {
+		if strings.Contains(userAgent, p.match) {
+			return p.name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,360 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/primal-host/wallet/internal/devnet"
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+	"github.com/primal-host/wallet/internal/signer"
+)
+
+// devnetRoutes registers local devnet detection and the test-chain
+// controls of Anvil and Hardhat endpoints.
+func (s *Server) devnetRoutes() {
+	s.echo.GET("/api/devnets", s.handleListDevnets)
+	s.echo.POST("/api/devnets", s.handleAddDevnet)
+	s.echo.GET("/api/devnet/:id", s.handleDevnetStatus)
+	s.echo.POST("/api/devnet/:id/snapshots", s.handleDevnetSnapshot)
+	s.echo.POST("/api/devnet/:id/snapshots/:snapshot/revert", s.handleDevnetRevert)
+	s.echo.POST("/api/devnet/:id/mine", s.handleDevnetMine)
+	s.echo.POST("/api/devnet/:id/time", s.handleDevnetTime)
+	s.echo.PUT("/api/devnet/:id/balances/:address", s.handleDevnetBalance)
+	s.echo.POST("/api/devnet/:id/impersonated/:address", s.handleDevnetImpersonate)
+	s.echo.DELETE("/api/devnet/:id/impersonated/:address", s.handleDevnetImpersonate)
+}
+
+// devnetView is a detected node with what the profile already has of it.
+type devnetView struct {
+	devnet.Node
+	Endpoint string   `json:"endpoint,omitempty"` // ID of the endpoint with the node's URL
+	Watched  []string `json:"watched"`            // accounts of the node the profile has
+}
+
+// handleListDevnets probes the devnet URLs and returns the Anvil and
+// Hardhat nodes that answered.
+func (s *Server) handleListDevnets(c echo.Context) error {
+	ctx := c.Request().Context()
+	p := s.profileFor(ctx)
+	nodes := devnet.Detect(ctx, s.devnets)
+	views := make([]devnetView, len(nodes))
+	for i, n := range nodes {
+		views[i] = devnetView{Node: n, Watched: []string{}}
+		if dup := p.store.FindDuplicate(ctx, devnet.Endpoint(n.URL), ""); dup != nil && dup.Reason == "url" {
+			views[i].Endpoint = dup.Existing.ID
+		}
+		for _, a := range n.Accounts {
+			if _, ok := p.accounts.Get(a.Address); ok {
+				views[i].Watched = append(views[i].Watched, a.Address)
+			}
+		}
+	}
+	return c.JSON(http.StatusOK, views)
+}
+
+// handleAddDevnet adds an endpoint for a detected node, unless one has its
+// URL already, and with "watch" its funded accounts as watch-only accounts.
+func (s *Server) handleAddDevnet(c echo.Context) error {
+	ctx := c.Request().Context()
+	p := s.profileFor(ctx)
+	var req struct {
+		URL   string `json:"url"`
+		Name  string `json:"name"`
+		Watch bool   `json:"watch"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	// Only the configured URLs are probed, so this can't be made to reach
+	// arbitrary hosts.
+	if !slices.Contains(s.devnets, req.URL) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": req.URL + " is not a devnet URL; set DEVNET_URLS"})
+	}
+	n, err := devnet.Probe(ctx, req.URL)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": "no Anvil or Hardhat node at " + req.URL + ": " + err.Error()})
+	}
+
+	var ep endpoint.Endpoint
+	created := false
+	if dup := p.store.FindDuplicate(ctx, devnet.Endpoint(n.URL), ""); dup != nil && dup.Reason == "url" {
+		ep = dup.Existing
+	} else {
+		// A node on this machine can't be reached through RPC_PROXY.
+		ep, err = p.store.Add(endpoint.Endpoint{Name: cmp.Or(strings.TrimSpace(req.Name), n.Name()), URL: n.URL, Asset: "eth", Proxy: endpoint.ProxyDirect})
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		created = true
+		slog.Info("devnet endpoint added", "subsystem", "devnet", "endpoint", ep.ID, "url", n.URL, "kind", n.Kind, "chain_id", n.ChainID, "by", p.name())
+	}
+
+	watched := []signer.Account{}
+	if req.Watch {
+		for i, a := range n.Accounts {
+			if _, ok := p.accounts.Get(a.Address); ok {
+				continue
+			}
+			acct, err := p.accounts.Add(signer.Account{Address: a.Address, Label: fmt.Sprintf("%s dev #%d", n.Product(), i), Kind: signer.KindWatch})
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			}
+			watched = append(watched, acct)
+		}
+		slog.Info("devnet accounts watched", "subsystem", "devnet", "endpoint", ep.ID, "count", len(watched), "by", p.name())
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	return c.JSON(status, map[string]any{"endpoint": ep, "created": created, "watched": watched})
+}
+
+// devnetSnapshot is a snapshot taken through the wallet.
+type devnetSnapshot struct {
+	ID        string    `json:"id"` // the node's snapshot ID
+	Name      string    `json:"name,omitempty"`
+	Block     uint64    `json:"block"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// devnetStatus is a test node's head, with the snapshots taken and the
+// accounts impersonated through the wallet since the server started.
+type devnetStatus struct {
+	devnet.Node
+	Endpoint     string           `json:"endpoint"`
+	Snapshots    []devnetSnapshot `json:"snapshots"`
+	Impersonated []string         `json:"impersonated"`
+}
+
+// devnetFor returns the endpoint :id names and its node, which must be
+// Anvil or Hardhat.
+func (s *Server) devnetFor(c echo.Context) (endpoint.Endpoint, devnet.Node, error) {
+	ctx := c.Request().Context()
+	ep, ok := s.storeFor(ctx).Get(c.Param("id"))
+	if !ok {
+		return endpoint.Endpoint{}, devnet.Node{}, errors.New("endpoint not found")
+	}
+	n, err := devnet.Status(ctx, ep)
+	if err != nil {
+		return endpoint.Endpoint{}, devnet.Node{}, err
+	}
+	n.URL = ep.URL
+	return ep, n, nil
+}
+
+// devnetError answers with the status an error of the devnet routes calls for.
+func devnetError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, devnet.ErrNotDevnet):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case err.Error() == "endpoint not found":
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+}
+
+// devnetStatusOf returns the node's status as the routes answer with it.
+// Snapshots and impersonations are kept by node URL, since that is what
+// they belong to.
+func (s *Server) devnetStatusOf(ep endpoint.Endpoint, n devnet.Node) devnetStatus {
+	s.devnetMu.Lock()
+	defer s.devnetMu.Unlock()
+	return devnetStatus{
+		Node:         n,
+		Endpoint:     ep.ID,
+		Snapshots:    append([]devnetSnapshot{}, s.snapshots[ep.URL]...),
+		Impersonated: append([]string{}, s.impersonated[ep.URL]...),
+	}
+}
+
+// handleDevnetStatus returns an Anvil or Hardhat endpoint's head and the
+// wallet's snapshots of it.
+func (s *Server) handleDevnetStatus(c echo.Context) error {
+	ep, n, err := s.devnetFor(c)
+	if err != nil {
+		return devnetError(c, err)
+	}
+	return c.JSON(http.StatusOK, s.devnetStatusOf(ep, n))
+}
+
+// handleDevnetSnapshot saves the chain's state under an optional name.
+func (s *Server) handleDevnetSnapshot(c echo.Context) error {
+	ep, n, err := s.devnetFor(c)
+	if err != nil {
+		return devnetError(c, err)
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	id, err := devnet.Snapshot(c.Request().Context(), ep)
+	if err != nil {
+		return devnetError(c, err)
+	}
+	snap := devnetSnapshot{ID: id, Name: strings.TrimSpace(req.Name), Block: n.Block, CreatedAt: time.Now().UTC()}
+	s.devnetMu.Lock()
+	s.snapshots[ep.URL] = append(s.snapshots[ep.URL], snap)
+	s.devnetMu.Unlock()
+	slog.Info("devnet snapshot taken", "subsystem", "devnet", "endpoint", ep.ID, "snapshot", id, "block", n.Block, "by", s.profileFor(c.Request().Context()).name())
+	return c.JSON(http.StatusCreated, snap)
+}
+
+// handleDevnetRevert restores a snapshot. The node drops it and every
+// later snapshot, so they are dropped here too, as is one the node no
+// longer has.
+func (s *Server) handleDevnetRevert(c echo.Context) error {
+	ctx := c.Request().Context()
+	ep, _, err := s.devnetFor(c)
+	if err != nil {
+		return devnetError(c, err)
+	}
+	id := c.Param("snapshot")
+	ok, err := devnet.Revert(ctx, ep, id)
+	if err != nil {
+		return devnetError(c, err)
+	}
+	s.devnetMu.Lock()
+	snaps := s.snapshots[ep.URL]
+	if i := slices.IndexFunc(snaps, func(sn devnetSnapshot) bool { return sn.ID == id }); i >= 0 {
+		s.snapshots[ep.URL] = snaps[:i]
+	}
+	s.devnetMu.Unlock()
+	if !ok {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "the node has no snapshot " + id})
+	}
+	slog.Info("devnet reverted", "subsystem", "devnet", "endpoint", ep.ID, "snapshot", id, "by", s.profileFor(ctx).name())
+	return s.devnetResult(c, ep)
+}
+
+// handleDevnetMine mines blocks, by default one.
+func (s *Server) handleDevnetMine(c echo.Context) error {
+	ctx := c.Request().Context()
+	ep, n, err := s.devnetFor(c)
+	if err != nil {
+		return devnetError(c, err)
+	}
+	var req struct {
+		Blocks   uint64 `json:"blocks"`
+		Interval uint64 `json:"interval"` // seconds between their timestamps
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	req.Blocks = max(req.Blocks, 1)
+	if req.Blocks > maxDevnetBlocks {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("mine at most %d blocks at once", maxDevnetBlocks)})
+	}
+	if err := devnet.Mine(ctx, ep, n.Kind, req.Blocks, req.Interval); err != nil {
+		return devnetError(c, err)
+	}
+	return s.devnetResult(c, ep)
+}
+
+// maxDevnetBlocks is the most blocks one mine request asks for.
+const maxDevnetBlocks = 1_000_000
+
+// handleDevnetTime moves the clock forward and, unless "mine" is false,
+// mines a block so the new time shows.
+func (s *Server) handleDevnetTime(c echo.Context) error {
+	ctx := c.Request().Context()
+	ep, n, err := s.devnetFor(c)
+	if err != nil {
+		return devnetError(c, err)
+	}
+	var req struct {
+		Seconds uint64 `json:"seconds"`
+		Mine    *bool  `json:"mine"`
+	}
+	if err := c.Bind(&req); err != nil || req.Seconds == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "seconds must be a positive integer"})
+	}
+	if err := devnet.IncreaseTime(ctx, ep, req.Seconds); err != nil {
+		return devnetError(c, err)
+	}
+	if req.Mine == nil || *req.Mine {
+		if err := devnet.Mine(ctx, ep, n.Kind, 1, 0); err != nil {
+			return devnetError(c, err)
+		}
+	}
+	return s.devnetResult(c, ep)
+}
+
+// handleDevnetBalance sets an address's balance, in the endpoint's native
+// currency.
+func (s *Server) handleDevnetBalance(c echo.Context) error {
+	ctx := c.Request().Context()
+	ep, n, err := s.devnetFor(c)
+	if err != nil {
+		return devnetError(c, err)
+	}
+	addr, err := evm.ParseAddress(c.Param("address"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	var req struct {
+		Balance string `json:"balance"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	wei, err := evm.ParseUnits(req.Balance, ep.Native.Decimals)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "balance: " + err.Error()})
+	}
+	if err := devnet.SetBalance(ctx, ep, n.Kind, addr, wei); err != nil {
+		return devnetError(c, err)
+	}
+	slog.Info("devnet balance set", "subsystem", "devnet", "endpoint", ep.ID, "address", addr.Hex(), "balance", req.Balance, "by", s.profileFor(ctx).name())
+	return s.devnetResult(c, ep)
+}
+
+// handleDevnetImpersonate starts (POST) or stops (DELETE) impersonating an
+// address, so the node signs eth_sendTransaction from it without its key.
+func (s *Server) handleDevnetImpersonate(c echo.Context) error {
+	ctx := c.Request().Context()
+	ep, n, err := s.devnetFor(c)
+	if err != nil {
+		return devnetError(c, err)
+	}
+	addr, err := evm.ParseAddress(c.Param("address"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	on := c.Request().Method == http.MethodPost
+	if err := devnet.Impersonate(ctx, ep, n.Kind, addr, on); err != nil {
+		return devnetError(c, err)
+	}
+	s.devnetMu.Lock()
+	list := slices.DeleteFunc(s.impersonated[ep.URL], func(a string) bool { return a == addr.Hex() })
+	if on {
+		list = append(list, addr.Hex())
+	}
+	s.impersonated[ep.URL] = list
+	s.devnetMu.Unlock()
+	slog.Info("devnet impersonation", "subsystem", "devnet", "endpoint", ep.ID, "address", addr.Hex(), "on", on, "by", s.profileFor(ctx).name())
+	return s.devnetResult(c, ep)
+}
+
+// devnetResult answers a control request with the node's status after it.
+func (s *Server) devnetResult(c echo.Context, ep endpoint.Endpoint) error {
+	n, err := devnet.Status(c.Request().Context(), ep)
+	if err != nil {
+		return devnetError(c, err)
+	}
+	n.URL = ep.URL
+	return c.JSON(http.StatusOK, s.devnetStatusOf(ep, n))
+}
@@ -0,0 +1,292 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/erc20"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// tokenListRefresh is how often token lists imported from a URL are
+// downloaded again. A failed refresh is retried every tokenListTick.
+const (
+	tokenListRefresh = 24 * time.Hour
+	tokenListTick    = time.Hour
+)
+
+// erc20Routes registers the ERC-20 token registry and token list imports.
+func (s *Server) erc20Routes() {
+	s.echo.GET("/api/erc20", s.handleListERC20)
+	s.echo.POST("/api/erc20", s.handleAddERC20)
+	s.echo.DELETE("/api/erc20/:chain/:address", s.handleDeleteERC20)
+	s.echo.GET("/api/erc20/balances", s.handleERC20Balances)
+	s.echo.GET("/api/erc20/lists", s.handleListTokenLists)
+	s.echo.POST("/api/erc20/lists", s.handleImportTokenList)
+	s.echo.POST("/api/erc20/lists/:id/refresh", s.handleRefreshTokenList)
+	s.echo.DELETE("/api/erc20/lists/:id", s.handleRemoveTokenList)
+}
+
+// handleListERC20 returns the registered tokens, of one chain with
+// ?chain_id=.
+func (s *Server) handleListERC20(c echo.Context) error {
+	var chainID uint64
+	if v := c.QueryParam("chain_id"); v != "" {
+		var err error
+		if chainID, err = parseChainID(v); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	}
+	return c.JSON(http.StatusOK, s.profileFor(c.Request().Context()).erc20.Tokens(chainID))
+}
+
+// handleAddERC20 registers a custom token. Its chain comes from the
+// endpoint, and its symbol, name, and decimals from the contract.
+func (s *Server) handleAddERC20(c echo.Context) error {
+	var req struct {
+		Endpoint string `json:"endpoint"`
+		Address  string `json:"address"`
+		LogoURI  string `json:"logo_uri"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	addr, err := evm.ParseAddress(strings.TrimSpace(req.Address))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	p := s.profileFor(c.Request().Context())
+	ep, ok := p.store.Get(req.Endpoint)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "endpoint not found"})
+	}
+	chainID, err := endpointChainID(c.Request().Context(), ep)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	m, err := erc20.Inspect(c.Request().Context(), ep, addr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	now := time.Now().UTC()
+	t, err := p.erc20.Add(erc20.Token{
+		ChainID:    chainID,
+		Address:    addr.Hex(),
+		Symbol:     m.Symbol,
+		Name:       m.Name,
+		Decimals:   m.Decimals,
+		LogoURI:    req.LogoURI,
+		VerifiedAt: &now,
+		FeeBps:     m.FeeBps,
+		Warnings:   m.Warnings,
+	})
+	if err != nil {
+		if errors.Is(err, erc20.ErrDuplicate) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	slog.Info("erc20 token added", "subsystem", "erc20", "chain_id", t.ChainID, "address", t.Address, "symbol", t.Symbol, "warnings", len(t.Warnings), "by", p.name())
+	return c.JSON(http.StatusCreated, t)
+}
+
+// handleDeleteERC20 removes a custom token.
+func (s *Server) handleDeleteERC20(c echo.Context) error {
+	chainID, err := parseChainID(c.Param("chain"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	p := s.profileFor(c.Request().Context())
+	if err := p.erc20.Delete(chainID, c.Param("address")); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	slog.Info("erc20 token removed", "subsystem", "erc20", "chain_id", chainID, "address", c.Param("address"), "by", p.name())
+	return c.JSON(http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// handleERC20Balances returns an address's nonzero balances of the tokens
+// registered for an endpoint's chain.
+func (s *Server) handleERC20Balances(c echo.Context) error {
+	owner, err := evm.ParseAddress(c.QueryParam("address"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	p := s.profileFor(c.Request().Context())
+	ep, ok := p.store.Get(c.QueryParam("endpoint"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "endpoint not found"})
+	}
+	chainID, err := endpointChainID(c.Request().Context(), ep)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, erc20.Balances(c.Request().Context(), ep, owner, p.erc20.Tokens(chainID)))
+}
+
+// handleListTokenLists returns the imported token lists.
+func (s *Server) handleListTokenLists(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.profileFor(c.Request().Context()).erc20.Lists())
+}
+
+// handleImportTokenList imports a token list, downloaded from url or given
+// as list, keeping the entries for the chains of the caller's endpoints.
+// Lists from a URL are refreshed daily.
+func (s *Server) handleImportTokenList(c echo.Context) error {
+	var req struct {
+		URL  string          `json:"url"`
+		List json.RawMessage `json:"list"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	req.URL = strings.TrimSpace(req.URL)
+	if (req.URL == "") == (len(req.List) == 0) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "give either a url or a list"})
+	}
+	ctx := c.Request().Context()
+	var (
+		doc erc20.Doc
+		err error
+	)
+	if req.URL != "" {
+		doc, err = erc20.FetchList(ctx, req.URL)
+	} else {
+		doc, err = erc20.ParseList(req.List)
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	p := s.profileFor(ctx)
+	l, err := p.erc20.Import(doc, req.URL, endpointChains(ctx, p.store))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	slog.Info("token list imported", "subsystem", "erc20", "list", l.Name, "tokens", l.Tokens, "skipped", l.Skipped, "by", p.name())
+	return c.JSON(http.StatusOK, l)
+}
+
+// handleRefreshTokenList downloads a token list again now, as after adding
+// an endpoint for a chain it skipped.
+func (s *Server) handleRefreshTokenList(c echo.Context) error {
+	p := s.profileFor(c.Request().Context())
+	l, ok := p.erc20.GetList(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "token list not found"})
+	}
+	if l.URL == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "an uploaded list can't be refreshed; import it again"})
+	}
+	l, err := refreshTokenList(c.Request().Context(), p, l)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, l)
+}
+
+// handleRemoveTokenList removes a token list and its tokens.
+func (s *Server) handleRemoveTokenList(c echo.Context) error {
+	p := s.profileFor(c.Request().Context())
+	if err := p.erc20.RemoveList(c.Param("id")); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	slog.Info("token list removed", "subsystem", "erc20", "list", c.Param("id"), "by", p.name())
+	return c.JSON(http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// refreshTokenLists downloads token lists again once they are a day old,
+// in the server's profile and every user's own, until the server shuts
+// down.
+func (s *Server) refreshTokenLists() {
+	t := time.NewTicker(tokenListTick)
+	defer t.Stop()
+	for {
+		profiles := []*profile{s.serverProfile}
+		if s.users != nil {
+			list, err := s.users.List()
+			if err != nil {
+				slog.Error("token list refresh failed", "subsystem", "erc20", "error", err)
+			}
+			for _, u := range list {
+				if u.Role.Shared() {
+					continue
+				}
+				p, err := s.userProfile(u)
+				if err != nil {
+					slog.Error("token list refresh failed", "subsystem", "erc20", "user", u.Name, "error", err)
+					continue
+				}
+				profiles = append(profiles, p)
+			}
+		}
+		for _, p := range profiles {
+			for _, l := range p.erc20.Due(time.Now(), tokenListRefresh) {
+				if _, err := refreshTokenList(context.Background(), p, l); err != nil {
+					slog.Warn("token list refresh failed", "subsystem", "erc20", "list", l.Name, "user", p.name(), "error", err)
+				}
+			}
+		}
+		select {
+		case <-s.closing:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// refreshTokenList downloads a list again and re-imports it for the
+// profile's current endpoints. A failure is recorded on the list, whose
+// tokens stay as they were.
+func refreshTokenList(ctx context.Context, p *profile, l erc20.List) (erc20.List, error) {
+	doc, err := erc20.FetchList(ctx, l.URL)
+	if err != nil {
+		if serr := p.erc20.SetListError(l.ID, err); serr != nil {
+			return erc20.List{}, serr
+		}
+		return erc20.List{}, err
+	}
+	return p.erc20.Import(doc, l.URL, endpointChains(ctx, p.store))
+}
+
+// endpointChains returns the chain IDs of the store's endpoints that
+// answer.
+func endpointChains(ctx context.Context, store *endpoint.Store) map[uint64]bool {
+	chains := map[uint64]bool{}
+	for _, st := range store.Poll(ctx) {
+		if id, err := evm.ParseQuantity(st.ChainID); err == nil && id.IsUint64() {
+			chains[id.Uint64()] = true
+		}
+	}
+	return chains
+}
+
+// endpointChainID asks an endpoint for its chain ID.
+func endpointChainID(ctx context.Context, ep endpoint.Endpoint) (uint64, error) {
+	result, err := endpoint.RPCCall(ctx, ep, "eth_chainId", nil)
+	if err != nil {
+		return 0, err
+	}
+	var s string
+	if err := json.Unmarshal(result, &s); err != nil {
+		return 0, err
+	}
+	id, err := evm.ParseQuantity(s)
+	if err != nil || !id.IsUint64() {
+		return 0, errors.New("unexpected eth_chainId result")
+	}
+	return id.Uint64(), nil
+}
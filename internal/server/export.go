@@ -0,0 +1,309 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/primal-host/wallet/internal/abi"
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+	"github.com/primal-host/wallet/internal/journal"
+	"github.com/primal-host/wallet/internal/label"
+)
+
+// exportRow is one asset a mined send moved, as exported. A send that
+// moved nothing, or reverted, is one row with amount 0, so its fee is still
+// accounted for.
+type exportRow struct {
+	Time         time.Time `json:"time"`
+	Chain        string    `json:"chain"` // the endpoint's name
+	ChainID      uint64    `json:"chain_id"`
+	Block        uint64    `json:"block"`
+	Hash         string    `json:"hash"`
+	Status       string    `json:"status"`    // confirmed or reverted
+	Direction    string    `json:"direction"` // out, in, or self, for the sending account
+	From         string    `json:"from"`
+	To           string    `json:"to"`
+	FromLabel    string    `json:"from_label,omitempty"` // the name the profile gave from
+	ToLabel      string    `json:"to_label,omitempty"`
+	Token        string    `json:"token"`                   // symbol; an unregistered token's address
+	TokenAddress string    `json:"token_address,omitempty"` // empty for the native currency
+	TokenID      string    `json:"token_id,omitempty"`      // ERC-721
+	Amount       string    `json:"amount"`                  // in whole units; raw for an unregistered token
+	Fee          string    `json:"fee"`                     // on a send's first row only, in the native currency
+	FeeToken     string    `json:"fee_token"`
+	Summary      string    `json:"summary,omitempty"`
+	Tags         []string  `json:"tags,omitempty"` // of from and to
+}
+
+// exportColumns are the CSV header, in the order of exportRow's fields.
+var exportColumns = []string{"time", "chain", "chain_id", "block", "hash", "status", "direction", "from", "to", "from_label", "to_label", "token", "token_address", "token_id", "amount", "fee", "fee_token", "summary", "tags"}
+
+func (r exportRow) record() []string {
+	return []string{
+		r.Time.Format(time.RFC3339), r.Chain, strconv.FormatUint(r.ChainID, 10), strconv.FormatUint(r.Block, 10),
+		r.Hash, r.Status, r.Direction, r.From, r.To, r.FromLabel, r.ToLabel, r.Token, r.TokenAddress, r.TokenID, r.Amount, r.Fee, r.FeeToken, r.Summary,
+		strings.Join(r.Tags, ";"),
+	}
+}
+
+// handleExportHistory exports the journal's mined sends oldest first, as
+// ?format=csv (the default) or json, one row per asset moved, or as koinly
+// or cointracker, a tax tool's CSV import. ?address= keeps one sending
+// account's, ?tag= those involving an address with the tag, ?counterparty=
+// those that sent to or moved assets to or from an address, and ?range= a
+// span of time: the last 30d or 24h, a year such as 2025, or dates such as
+// 2025-01-01..2025-06-30.
+func (s *Server) handleExportHistory(c echo.Context) error {
+	format := c.QueryParam("format")
+	if format == "" {
+		format = "csv"
+	}
+	tax, isTax := taxFormats[format]
+	if format != "csv" && format != "json" && !isTax {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "format must be csv, json, koinly, or cointracker"})
+	}
+	var from *evm.Address
+	if a := c.QueryParam("address"); a != "" {
+		addr, err := evm.ParseAddress(a)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid address"})
+		}
+		from = &addr
+	}
+	counterparty := c.QueryParam("counterparty")
+	if counterparty != "" {
+		if _, err := evm.ParseAddress(counterparty); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid counterparty"})
+		}
+	}
+	start, end, err := parseExportRange(c.QueryParam("range"), time.Now().UTC())
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	rows := s.exportRows(s.profileFor(c.Request().Context()).labels, from, c.QueryParam("tag"), counterparty, start, end)
+	name := "wallet-history-" + time.Now().UTC().Format("2006-01-02") + ".csv"
+	switch {
+	case format == "json":
+		name = strings.TrimSuffix(name, ".csv") + ".json"
+	case isTax:
+		name = "wallet-history-" + format + "-" + time.Now().UTC().Format("2006-01-02") + ".csv"
+	}
+	c.Response().Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	if format == "json" {
+		return c.JSON(http.StatusOK, rows)
+	}
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	c.Response().WriteHeader(http.StatusOK)
+	w := csv.NewWriter(c.Response())
+	if isTax {
+		w.Write(tax.columns)
+		for _, t := range taxRows(rows) {
+			w.Write(csvSafe(tax.record(t)))
+		}
+	} else {
+		w.Write(exportColumns)
+		for _, r := range rows {
+			w.Write(csvSafe(r.record()))
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// exportRows lists the movements of the journal's confirmed and reverted
+// sends from from (any account when nil) mined in [start, end), oldest
+// first, labeled from labels. With a tag, only sends involving an address
+// with it are listed, and with a counterparty only those involving it. A
+// send mined before the journal kept block times is placed at its last
+// update.
+func (s *Server) exportRows(labels *label.Store, from *evm.Address, tag, counterparty string, start, end time.Time) []exportRow {
+	known := s.knownEvents()
+	list := s.journal.List("")
+	slices.Reverse(list)
+	var rows []exportRow
+	for _, in := range list {
+		if in.Stage != journal.StageConfirmed && in.Stage != journal.StageReverted {
+			continue
+		}
+		if from != nil && !strings.EqualFold(in.From, from.Hex()) {
+			continue
+		}
+		at := in.UpdatedAt
+		if in.MinedAt != nil {
+			at = *in.MinedAt
+		}
+		if (!start.IsZero() && at.Before(start)) || (!end.IsZero() && !at.Before(end)) {
+			continue
+		}
+		rows = append(rows, s.intentRows(in, at, known, labels, tag, counterparty)...)
+	}
+	// Sends are journaled as they are made, and mined in another order.
+	// Stable, so a send's rows stay together.
+	slices.SortStableFunc(rows, func(a, b exportRow) int { return a.Time.Compare(b.Time) })
+	return rows
+}
+
+// intentRows is the export of one mined send, or nothing if tag is set
+// and none of the addresses it involves has it, or counterparty is set and
+// it doesn't involve it.
+func (s *Server) intentRows(in journal.Intent, at time.Time, known []abi.Function, labels *label.Store, tag, counterparty string) []exportRow {
+	chainID := intentChainID(in)
+	chain, native, decimals := in.Endpoint, "", 18
+	if ep, ok := s.store.Get(in.Endpoint); ok {
+		chain, native, decimals = ep.Name, ep.Native.Symbol, ep.Native.Decimals
+	}
+	base := exportRow{Time: at.UTC(), Chain: chain, ChainID: chainID, Hash: in.Hash, Status: in.Stage, FeeToken: native}
+	if b, err := evm.ParseQuantity(in.Block); err == nil && b.IsUint64() {
+		base.Block = b.Uint64()
+	}
+	if fee, err := evm.ParseQuantity(in.Fee); err == nil {
+		base.Fee = evm.FormatUnits(fee, decimals)
+	}
+
+	var moved []movement
+	if in.Stage == journal.StageConfirmed {
+		e := s.decodeIntent(in, known)
+		base.Summary = e.Summary
+		var internal []endpoint.Transfer
+		if len(in.Internal) > 0 {
+			_ = json.Unmarshal(in.Internal, &internal)
+		}
+		moved = movements(in, e.Events, internal)
+	}
+	addresses := []string{in.From, in.To}
+	for _, m := range moved {
+		addresses = append(addresses, m.from, m.to)
+	}
+	if counterparty != "" && !involves(in, addresses, counterparty) {
+		return nil
+	}
+	found := labels.Lookup(addresses...)
+	if tag != "" && !tagged(found, tag) {
+		return nil
+	}
+	if len(moved) == 0 {
+		r := base
+		r.Direction, r.From, r.To, r.Token, r.Amount = "out", in.From, in.To, native, "0"
+		labelRow(&r, found)
+		return []exportRow{r}
+	}
+	rows := make([]exportRow, len(moved))
+	for i, m := range moved {
+		r := base
+		if i > 0 {
+			r.Fee = ""
+		}
+		r.From, r.To = m.from, m.to
+		switch {
+		case strings.EqualFold(m.from, in.From) && strings.EqualFold(m.to, in.From):
+			r.Direction = "self"
+		case strings.EqualFold(m.from, in.From):
+			r.Direction = "out"
+		default:
+			r.Direction = "in"
+		}
+		switch {
+		case m.token == "":
+			r.Token, r.Amount = native, evm.FormatUnits(m.amount, decimals)
+		case m.id != "":
+			r.Token, r.TokenAddress, r.TokenID, r.Amount = s.tokenName(chainID, m.token), m.token, m.id, "1"
+		default:
+			r.Token, r.TokenAddress, r.Amount = m.token, m.token, m.amount.String()
+			if t, ok := s.erc20.Get(chainID, m.token); ok {
+				r.Token, r.Amount = t.Symbol, evm.FormatUnits(m.amount, t.Decimals)
+			}
+		}
+		labelRow(&r, found)
+		rows[i] = r
+	}
+	return rows
+}
+
+// labelRow sets r's label names and tags from labels.
+func labelRow(r *exportRow, labels []label.Label) {
+	for _, l := range labels {
+		from, to := strings.EqualFold(l.Address, r.From), strings.EqualFold(l.Address, r.To)
+		if !from && !to {
+			continue
+		}
+		if from {
+			r.FromLabel = l.Name
+		}
+		if to {
+			r.ToLabel = l.Name
+		}
+		for _, t := range l.Tags {
+			if !slices.Contains(r.Tags, t) {
+				r.Tags = append(r.Tags, t)
+			}
+		}
+	}
+	slices.Sort(r.Tags)
+}
+
+// parseExportRange parses an export's ?range= into [start, end): empty for
+// all time, a span back from now such as 30d or 24h, a calendar year such
+// as 2025, or inclusive dates such as 2025-01-01..2025-06-30, in UTC.
+func parseExportRange(s string, now time.Time) (time.Time, time.Time, error) {
+	switch {
+	case s == "":
+		return time.Time{}, time.Time{}, nil
+	case len(s) == 4 && strings.Trim(s, "0123456789") == "":
+		year, _ := strconv.Atoi(s)
+		start := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(1, 0, 0), nil
+	case strings.Contains(s, ".."):
+		first, last, _ := strings.Cut(s, "..")
+		start, err1 := time.Parse(time.DateOnly, first)
+		end, err2 := time.Parse(time.DateOnly, last)
+		if err1 != nil || err2 != nil || end.Before(start) {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid range %q: use dates such as 2025-01-01..2025-06-30", s)
+		}
+		return start, end.AddDate(0, 0, 1), nil
+	}
+	d, err := parseSpan(s)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid range %q: use a span such as 30d, a year such as 2025, or dates such as 2025-01-01..2025-06-30", s)
+	}
+	return now.Add(-d), time.Time{}, nil
+}
+
+// parseSpan parses a positive duration in Go syntax or whole days, such as
+// 24h or 30d.
+func parseSpan(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid span %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid span %q", s)
+	}
+	return d, nil
+}
+
+// csvSafe keeps spreadsheets from running cells as formulas: token symbols
+// and endpoint names come from outside, and one starting with = would.
+func csvSafe(record []string) []string {
+	for i, v := range record {
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			record[i] = "'" + v
+		}
+	}
+	return record
+}
@@ -0,0 +1,90 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"errors"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/faucet"
+)
+
+// faucetRoutes registers the public faucet page and its drip API, plus the
+// operator status view.
+func (s *Server) faucetRoutes() {
+	s.echo.GET("/faucet", s.handleFaucetPage)
+	s.echo.POST("/faucet/drip", s.handleFaucetDrip)
+	s.echo.GET("/api/faucet", s.handleFaucetStatus)
+}
+
+func (s *Server) handleFaucetPage(c echo.Context) error {
+	captcha := ""
+	if key := s.faucet.SiteKey(); key != "" {
+		captcha = `<div class="cf-turnstile" data-sitekey="` + html.EscapeString(key) + `" data-theme="dark"></div>` +
+			`<script src="` + turnstileOrigin + `/turnstile/v0/api.js" async defer></script>`
+	}
+	page := strings.NewReplacer(
+		"{{AMOUNT}}", html.EscapeString(s.faucet.AmountDisplay()),
+		"{{SYMBOL}}", html.EscapeString(s.faucet.Symbol()),
+		"{{CAPTCHA}}", captcha,
+	).Replace(faucetHTML)
+	// Turnstile is the one remote script, and only on this public page.
+	scripts, frames := "'self' 'unsafe-inline'", "'none'"
+	if s.faucet.SiteKey() != "" {
+		scripts += " " + turnstileOrigin
+		frames = turnstileOrigin
+	}
+	s.setCSP(c, "default-src 'self'", "script-src "+scripts, "style-src 'self' 'unsafe-inline'",
+		"connect-src 'self'", "frame-src "+frames, "object-src 'none'", "base-uri 'none'", "frame-ancestors 'none'")
+	return c.HTML(http.StatusOK, page)
+}
+
+const turnstileOrigin = "https://challenges.cloudflare.com"
+
+// handleFaucetDrip sends the faucet amount to the requested address. The
+// per-IP limit counts the IP the server's extractor trusts: the peer's
+// address, or the forwarded one behind TRUSTED_PROXIES, never a header a
+// client set itself.
+func (s *Server) handleFaucetDrip(c echo.Context) error {
+	var req struct {
+		Address string `json:"address"`
+		Captcha string `json:"captcha"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	d, err := s.faucet.Drip(c.Request().Context(), req.Address, c.RealIP(), req.Captcha)
+	if err != nil {
+		var rl *faucet.RateLimitError
+		switch {
+		case errors.As(err, &rl):
+			c.Response().Header().Set("Retry-After", strconv.Itoa(int(rl.RetryAfter.Seconds())))
+			return c.JSON(http.StatusTooManyRequests, map[string]string{"error": err.Error()})
+		case strings.Contains(err.Error(), "captcha"):
+			return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+		case strings.Contains(err.Error(), "locked"), strings.Contains(err.Error(), "no vault key"):
+			return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "faucet is unavailable"})
+		case strings.Contains(err.Error(), "address"), strings.Contains(err.Error(), "faucet itself"):
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"tx_hash": d.TxHash})
+}
+
+// handleFaucetStatus shows operators the faucet balance and recent dispenses.
+// It answers without a login in multi-user mode, so callers who aren't
+// logged in get the dispenses without their requesters' IPs.
+func (s *Server) handleFaucetStatus(c echo.Context) error {
+	st := s.faucet.Status()
+	if s.users != nil && c.Request().Context().Value(profileKey{}) == nil {
+		for i := range st.History {
+			st.History[i].IP = ""
+		}
+	}
+	return c.JSON(http.StatusOK, st)
+}
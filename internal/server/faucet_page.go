@@ -0,0 +1,102 @@
+//go:build !broadcastonly
+
+package server
+
+// faucetHTML is the public faucet page. {{AMOUNT}}, {{SYMBOL}}, and
+// {{CAPTCHA}} are filled in per request.
+const faucetHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Faucet</title>
+<style>
+  * { box-sizing: border-box; margin: 0; padding: 0; }
+  body {
+    font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
+    background: #0f1117;
+    color: #e4e4e7;
+    min-height: 100vh;
+    display: flex;
+    align-items: center;
+    justify-content: center;
+    padding: 1rem;
+  }
+  .card {
+    background: #18181b;
+    border: 1px solid #27272a;
+    border-radius: 0.5rem;
+    padding: 1.5rem;
+    width: 100%;
+    max-width: 28rem;
+  }
+  h1 { font-size: 1.25rem; margin-bottom: 0.5rem; }
+  p { color: #a1a1aa; font-size: 0.875rem; margin-bottom: 1rem; }
+  input {
+    width: 100%;
+    padding: 0.5rem 0.75rem;
+    background: #0f1117;
+    border: 1px solid #27272a;
+    border-radius: 0.25rem;
+    color: #e4e4e7;
+    font-family: "SF Mono", "Fira Code", monospace;
+    font-size: 0.8125rem;
+    margin-bottom: 1rem;
+  }
+  input:focus { outline: none; border-color: #1d4ed8; }
+  .cf-turnstile { margin-bottom: 1rem; }
+  button {
+    width: 100%;
+    padding: 0.5rem 1rem;
+    background: #1d4ed8;
+    border: none;
+    border-radius: 0.25rem;
+    color: #fff;
+    font-size: 0.875rem;
+    cursor: pointer;
+  }
+  button:disabled { opacity: 0.5; cursor: default; }
+  .result { font-size: 0.8125rem; margin-top: 1rem; word-break: break-all; display: none; }
+  .result.ok { color: #4ade80; }
+  .result.err { color: #f87171; }
+</style>
+</head>
+<body>
+<div class="card">
+  <h1>Faucet</h1>
+  <p>Request {{AMOUNT}} {{SYMBOL}} for testing.</p>
+  <input type="text" id="address" placeholder="0x..." autocomplete="off" spellcheck="false">
+  {{CAPTCHA}}
+  <button id="btn" onclick="drip()">Send me {{SYMBOL}}</button>
+  <div class="result" id="result"></div>
+</div>
+<script>
+async function drip() {
+  const btn = document.getElementById('btn');
+  const result = document.getElementById('result');
+  const address = document.getElementById('address').value.trim();
+  const tokenEl = document.querySelector('[name="cf-turnstile-response"]');
+  result.style.display = 'none';
+  btn.disabled = true;
+  try {
+    const resp = await fetch('/faucet/drip', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ address: address, captcha: tokenEl ? tokenEl.value : '' })
+    });
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'request failed');
+    result.className = 'result ok';
+    result.textContent = 'Sent! Transaction: ' + data.tx_hash;
+  } catch (err) {
+    result.className = 'result err';
+    result.textContent = err.message;
+  } finally {
+    result.style.display = 'block';
+    btn.disabled = false;
+    if (window.turnstile) turnstile.reset();
+  }
+}
+</script>
+</body>
+</html>`
@@ -0,0 +1,96 @@
+//go:build ignore
+
+// gen_ethers vendors the ethers.js UMD bundle into static/ for the dashboard
+// to load from the wallet server. The npm tarball is checked against the
+// integrity hash pinned below, not one fetched from the registry, which
+// would vouch for whatever the registry served. Run it by hand and commit
+// the result; builds never run it.
+//
+//	go generate ./internal/server
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+const (
+	version = "6.13.4"
+	member  = "package/dist/ethers.umd.min.js"
+	out     = "static/ethers.umd.min.js"
+
+	// integrity is the tarball's npm integrity hash (sha512, base64), as
+	// package-lock.json records it. When upgrading, take it from a lock
+	// file or npm view ethers@<version> dist.integrity on a trusted
+	// machine, and check it against a second source, such as the GitHub
+	// release, before pinning it here.
+	integrity = ""
+)
+
+func main() {
+	if integrity == "" {
+		log.Fatalf("pin the npm integrity hash of ethers %s in gen_ethers.go first", version)
+	}
+	tarball := "https://registry.npmjs.org/ethers/-/ethers-" + version + ".tgz"
+	tgz, err := get(tarball)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sum := sha512.Sum512(tgz)
+	if got := "sha512-" + base64.StdEncoding.EncodeToString(sum[:]); got != integrity {
+		log.Fatalf("ethers %s tarball is %s, pinned %s", version, got, integrity)
+	}
+
+	data, err := extract(tgz, member)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(out, data, 0644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("vendored ethers %s (%d bytes) to %s\n", version, len(data), out)
+}
+
+func get(url string) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: HTTP %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func extract(tgz []byte, name string) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(tgz))
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(zr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not in the ethers tarball", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if h.Name == name {
+			return io.ReadAll(tr)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/config"
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+	"github.com/primal-host/wallet/internal/graphql"
+	"github.com/primal-host/wallet/internal/lightclient"
+)
+
+// balance is a native-token balance as served over GraphQL.
+type balance struct {
+	Address  string `json:"address"`
+	Endpoint string `json:"endpoint"`
+	Block    string `json:"block"`
+	Wei      string `json:"wei"`
+	Value    string `json:"value"` // whole native units
+	Symbol   string `json:"symbol"`
+
+	Proof       *endpoint.ProofCheck `json:"proof,omitempty"`        // with proof verification on
+	LightClient *lightclient.Check   `json:"light_client,omitempty"` // from a light client endpoint
+}
+
+// graphqlSchema describes the dashboard's data. Field names follow the REST
+// API's JSON so both can share client-side code.
+func (s *Server) graphqlSchema() *graphql.Schema {
+	balanceArgs := map[string]string{"address": "String!", "block": "String"}
+	schema := &graphql.Schema{
+		Query: "Query",
+		Types: map[string]graphql.Object{
+			"Query": {
+				"version":    {Type: "String", Resolve: func(context.Context, graphql.Params) (any, error) { return config.Version, nil }},
+				"lock_epoch": {Type: "Int", Resolve: func(context.Context, graphql.Params) (any, error) { return s.currentLockEpoch(), nil }},
+				"endpoints": {Type: "[Endpoint]", Resolve: func(ctx context.Context, _ graphql.Params) (any, error) {
+					return s.storeFor(ctx).List(), nil
+				}},
+				"endpoint": {Type: "Endpoint", Args: map[string]string{"id": "ID!"}, Resolve: func(ctx context.Context, p graphql.Params) (any, error) {
+					if ep, ok := s.storeFor(ctx).Get(p.String("id")); ok {
+						return ep, nil
+					}
+					return nil, nil
+				}},
+				"assets": {Type: "[Asset]", Resolve: func(context.Context, graphql.Params) (any, error) {
+					return s.store.Assets().List(), nil
+				}},
+			},
+			"Endpoint": {
+				"id":   {Type: "ID"},
+				"name": {Type: "String"},
+				"url":  {Type: "String"},
+				"asset": {Type: "Asset", Resolve: func(_ context.Context, p graphql.Params) (any, error) {
+					return p.Source.(endpoint.Endpoint).Native, nil
+				}},
+				"symbol": {Type: "String", Resolve: func(_ context.Context, p graphql.Params) (any, error) {
+					return p.Source.(endpoint.Endpoint).Native.Symbol, nil
+				}},
+				"status": {Type: "EndpointStatus", Resolve: func(ctx context.Context, p graphql.Params) (any, error) {
+					ep := p.Source.(endpoint.Endpoint)
+					if st, ok := s.poller.status(s.storeFor(ctx), ep.ID); ok {
+						return st, nil
+					}
+					return endpoint.Check(ctx, ep), nil
+				}},
+				"balance": {Type: "Balance", Args: balanceArgs, Resolve: func(ctx context.Context, p graphql.Params) (any, error) {
+					return s.balanceAt(ctx, s.storeFor(ctx), p.Source.(endpoint.Endpoint), p.String("address"), p.String("block"))
+				}},
+				"balances": {Type: "[Balance]", Args: map[string]string{"addresses": "[String!]!", "block": "String"}, Resolve: func(ctx context.Context, p graphql.Params) (any, error) {
+					// Look every address up at once; a failed lookup nulls
+					// its entry and reports an error at its path.
+					ep := p.Source.(endpoint.Endpoint)
+					addrs := p.Strings("addresses")
+					out := make([]any, len(addrs))
+					var wg sync.WaitGroup
+					for i, addr := range addrs {
+						wg.Add(1)
+						go func(i int, addr string) {
+							defer wg.Done()
+							b, err := s.balanceAt(ctx, s.storeFor(ctx), ep, addr, p.String("block"))
+							if err != nil {
+								out[i] = err
+								return
+							}
+							out[i] = b
+						}(i, addr)
+					}
+					wg.Wait()
+					return out, nil
+				}},
+			},
+			"Asset": {
+				"id":           {Type: "ID"},
+				"symbol":       {Type: "String"},
+				"decimals":     {Type: "Int"},
+				"coingecko_id": {Type: "String"},
+				"icon":         {Type: "String"},
+			},
+			"EndpointStatus": {
+				"online":       {Type: "Boolean"},
+				"chain_id":     {Type: "String"},
+				"block_number": {Type: "String"},
+				"latency_ms":   {Type: "Int"},
+			},
+			"Balance": {
+				"address":      {Type: "String"},
+				"endpoint":     {Type: "ID"},
+				"block":        {Type: "String"},
+				"wei":          {Type: "String"},
+				"value":        {Type: "String"},
+				"symbol":       {Type: "String"},
+				"proof":        {Type: "ProofCheck"},
+				"light_client": {Type: "LightClientCheck"},
+			},
+			"ProofCheck": {
+				"endpoint":   {Type: "ID"},
+				"block":      {Type: "String"},
+				"state_root": {Type: "String"},
+				"status":     {Type: "String"},
+				"error":      {Type: "String"},
+			},
+			"LightClientCheck": {
+				"status":     {Type: "String"},
+				"slot":       {Type: "Int"},
+				"block":      {Type: "String"},
+				"state_root": {Type: "String"},
+			},
+		},
+	}
+	s.manageGraphQL(schema)
+	return schema
+}
+
+// balanceAt reads address's native balance on ep at block: "latest" when
+// empty, a tag such as "finalized", or a decimal or hex block number.
+// Historical blocks ep no longer keeps are read from an archive endpoint of
+// store on the same chain. A light client endpoint's balance is checked
+// against the headers it follows; otherwise, with proof verification on,
+// it is checked with eth_getProof against another endpoint's state root.
+func (s *Server) balanceAt(ctx context.Context, store *endpoint.Store, ep endpoint.Endpoint, address, block string) (*balance, error) {
+	if _, err := evm.ParseAddress(address); err != nil {
+		return nil, err
+	}
+	tag := "latest"
+	switch block {
+	case "", "latest", "earliest", "pending", "safe", "finalized":
+		if block != "" {
+			tag = block
+		}
+	default:
+		n, err := evm.ParseQuantity(block)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block %q", block)
+		}
+		tag = evm.EncodeQuantity(n)
+	}
+	var (
+		result json.RawMessage
+		proof  *endpoint.ProofCheck
+		light  *lightclient.Check
+		err    error
+	)
+	switch {
+	case ep.Consensus != "":
+		var lc lightclient.Check
+		result, lc, err = s.lights.client(ep).Call(ctx, ep, "eth_getBalance", []any{address, tag})
+		light = &lc
+	case s.proxy.VerifyProofs:
+		result, _, proof, err = store.Proven(ctx, ep, "eth_getBalance", []any{address, tag})
+	default:
+		result, _, err = store.Historical(ctx, ep, "eth_getBalance", []any{address, tag})
+	}
+	if err != nil {
+		return nil, err
+	}
+	var hex string
+	if err := json.Unmarshal(result, &hex); err != nil {
+		return nil, fmt.Errorf("eth_getBalance: unexpected result %s", result)
+	}
+	wei, err := evm.ParseQuantity(hex)
+	if err != nil {
+		return nil, err
+	}
+	return &balance{
+		Address:     address,
+		Endpoint:    ep.ID,
+		Block:       tag,
+		Wei:         wei.String(),
+		Value:       evm.FormatUnits(wei, ep.Native.Decimals),
+		Symbol:      ep.Native.Symbol,
+		Proof:       proof,
+		LightClient: light,
+	}, nil
+}
+
+// handleGraphQL runs a read-only GraphQL query, given as a JSON body on POST
+// or as query parameters on GET.
+func (s *Server) handleGraphQL(c echo.Context) error {
+	var req graphql.Request
+	if c.Request().Method == http.MethodGet {
+		req.Query = c.QueryParam("query")
+		req.OperationName = c.QueryParam("operationName")
+		if v := c.QueryParam("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				return c.JSON(http.StatusBadRequest, graphql.Response{Errors: []graphql.Error{{Message: "invalid variables"}}})
+			}
+		}
+	} else if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, graphql.Response{Errors: []graphql.Error{{Message: "invalid request"}}})
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		return c.JSON(http.StatusBadRequest, graphql.Response{Errors: []graphql.Error{{Message: "query is required"}}})
+	}
+
+	resp := s.schema.Execute(c.Request().Context(), req)
+	if resp.Data == nil {
+		return c.JSON(http.StatusBadRequest, resp)
+	}
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,114 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/primal-host/wallet/internal/graphql"
+	"github.com/primal-host/wallet/internal/signer"
+	"github.com/primal-host/wallet/internal/vault"
+)
+
+// manageGraphQL adds signer accounts, the server vault, bookmarks, and the
+// faucet to the schema.
+func (s *Server) manageGraphQL(schema *graphql.Schema) {
+	// Accounts and vault keys take the endpoint as an argument to their
+	// balance, since the address is already known.
+	accountBalance := graphql.Field{
+		Type: "Balance",
+		Args: map[string]string{"endpoint": "ID!", "block": "String"},
+		Resolve: func(ctx context.Context, p graphql.Params) (any, error) {
+			ep, ok := s.storeFor(ctx).Get(p.String("endpoint"))
+			if !ok {
+				return nil, fmt.Errorf("endpoint not found")
+			}
+			var addr string
+			switch src := p.Source.(type) {
+			case signer.Account:
+				addr = src.Address
+			case vault.Key:
+				addr = src.Address
+			}
+			return s.balanceAt(ctx, s.storeFor(ctx), ep, addr, p.String("block"))
+		},
+	}
+
+	query := schema.Types[schema.Query]
+	query["accounts"] = graphql.Field{Type: "[Account]", Args: map[string]string{"kind": "String"}, Resolve: func(ctx context.Context, p graphql.Params) (any, error) {
+		accounts := s.profileFor(ctx).accounts
+		if kind := p.String("kind"); kind != "" {
+			if accts := accounts.Signer(signer.Kind(kind)).Accounts(); accts != nil {
+				return accts, nil
+			}
+			return []signer.Account{}, nil
+		}
+		return accounts.List(), nil
+	}}
+	query["vault"] = graphql.Field{Type: "Vault", Resolve: func(ctx context.Context, _ graphql.Params) (any, error) {
+		if !s.sharedFor(ctx) {
+			return nil, fmt.Errorf("the vault belongs to the server profile")
+		}
+		return s.vault.Status(), nil
+	}}
+	query["bookmarks"] = graphql.Field{Type: "[Bookmark]", Resolve: func(ctx context.Context, _ graphql.Params) (any, error) {
+		return s.profileFor(ctx).bookmarks.List(), nil
+	}}
+	query["faucet"] = graphql.Field{Type: "Faucet", Resolve: func(context.Context, graphql.Params) (any, error) {
+		if s.faucet == nil {
+			return nil, nil
+		}
+		return s.faucet.Status(), nil
+	}}
+
+	schema.Types["Account"] = graphql.Object{
+		"address":    {Type: "String"},
+		"label":      {Type: "String"},
+		"kind":       {Type: "String"},
+		"path":       {Type: "String"},
+		"key_id":     {Type: "String"},
+		"region":     {Type: "String"},
+		"url":        {Type: "String"},
+		"created_at": {Type: "String"},
+		"balance":    accountBalance,
+	}
+	schema.Types["Vault"] = graphql.Object{
+		"initialized": {Type: "Boolean"},
+		"unlocked":    {Type: "Boolean"},
+		"keys":        {Type: "[VaultKey]"},
+	}
+	schema.Types["VaultKey"] = graphql.Object{
+		"address":    {Type: "String"},
+		"label":      {Type: "String"},
+		"created_at": {Type: "String"},
+		"balance":    accountBalance,
+	}
+	schema.Types["Bookmark"] = graphql.Object{
+		"id":           {Type: "ID"},
+		"chain_id":     {Type: "String"},
+		"endpoint":     {Type: "ID"},
+		"block_number": {Type: "Int"},
+		"timestamp":    {Type: "String"},
+		"note":         {Type: "String"},
+		"created_at":   {Type: "String"},
+	}
+	schema.Types["Faucet"] = graphql.Object{
+		"endpoint":    {Type: "ID"},
+		"address":     {Type: "String"},
+		"symbol":      {Type: "String"},
+		"amount":      {Type: "String"},
+		"interval":    {Type: "String"},
+		"balance":     {Type: "String"},
+		"low_balance": {Type: "Boolean"},
+		"dispensed":   {Type: "Int"},
+		"history":     {Type: "[Dispense]"},
+	}
+	schema.Types["Dispense"] = graphql.Object{
+		"address":    {Type: "String"},
+		"ip":         {Type: "String"},
+		"amount":     {Type: "String"},
+		"tx_hash":    {Type: "String"},
+		"created_at": {Type: "String"},
+	}
+}
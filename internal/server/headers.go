@@ -0,0 +1,139 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Headers configures the security headers set on every response, and
+// which forwarding headers on requests are believed.
+type Headers struct {
+	// Off leaves the headers to a reverse proxy in front of the wallet.
+	Off bool
+	// Sources are extra origins the dashboard may load scripts from,
+	// connect to, and frame, e.g. https://connect.trezor.io for Trezor.
+	Sources []string
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For is
+	// believed. Without any, a request's client is the address it came
+	// from, and forwarding headers are ignored.
+	TrustedProxies []*net.IPNet
+}
+
+// ParseSources parses a space- or comma-separated list of origins for
+// Headers.Sources.
+func ParseSources(s string) ([]string, error) {
+	var sources []string
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' }) {
+		u, err := url.Parse(f)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "wss") || u.Host == "" || strings.Trim(u.Path, "/") != "" || u.RawQuery != "" || u.Fragment != "" {
+			return nil, fmt.Errorf("%q must be an https:// or wss:// origin", f)
+		}
+		sources = append(sources, u.Scheme+"://"+u.Host)
+	}
+	return sources, nil
+}
+
+// apiCSP covers everything that isn't a page: JSON, icons, and the ethers.js
+// bundle are never rendered as documents, so nothing is allowed.
+const apiCSP = "default-src 'none'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'"
+
+// permissionsPolicy grants the dashboard WebHID for Ledger, WebAuthn for
+// passkey unlock, and the camera for scanning air-gapped signatures, and
+// denies the features it never uses.
+const permissionsPolicy = "hid=(self), publickey-credentials-get=(self), publickey-credentials-create=(self), camera=(self), " +
+	"usb=(), serial=(), bluetooth=(), microphone=(), geolocation=(), payment=(), display-capture=()"
+
+// ParseTrustedProxies parses a space- or comma-separated list of IPs and
+// CIDR ranges for Headers.TrustedProxies.
+func ParseTrustedProxies(s string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' }) {
+		if !strings.Contains(f, "/") {
+			if ip := net.ParseIP(f); ip != nil {
+				bits := 8 * len(ip)
+				if ip4 := ip.To4(); ip4 != nil {
+					ip, bits = ip4, 32
+				}
+				nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+		}
+		_, n, err := net.ParseCIDR(f)
+		if err != nil {
+			return nil, fmt.Errorf("%q must be an IP or a CIDR range", f)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// ipExtractor names a request's client for rate limits, the faucet, and
+// logs: the address the request came from, or, when that is a trusted
+// proxy, the nearest address in X-Forwarded-For that isn't one.
+func (h Headers) ipExtractor() echo.IPExtractor {
+	if len(h.TrustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	opts := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, n := range h.TrustedProxies {
+		opts = append(opts, echo.TrustIPRange(n))
+	}
+	return echo.ExtractIPFromXFFHeader(opts...)
+}
+
+// securityHeaders keeps the wallet from being framed, sniffed, or leaking
+// its URLs in Referer headers. Pages replace the API policy with their own
+// through setCSP.
+func (s *Server) securityHeaders(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if s.headers.Off {
+			return next(c)
+		}
+		h := c.Response().Header()
+		h.Set("Content-Security-Policy", apiCSP)
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", "no-referrer")
+		h.Set("Permissions-Policy", permissionsPolicy)
+		return next(c)
+	}
+}
+
+// setCSP sets a page's Content-Security-Policy from its directives.
+func (s *Server) setCSP(c echo.Context, directives ...string) {
+	if s.headers.Off {
+		return
+	}
+	c.Response().Header().Set("Content-Security-Policy", strings.Join(directives, "; "))
+}
+
+// dashboardCSP is the dashboard's policy. Scripts come only from this
+// server and the page talks to nothing else, unless the operator allowed
+// more sources.
+// The inline script and onclick handlers still need 'unsafe-inline'.
+func (s *Server) dashboardCSP(host string) []string {
+	extra := ""
+	if len(s.headers.Sources) > 0 {
+		extra = " " + strings.Join(s.headers.Sources, " ")
+	}
+	frames := "'none'"
+	if extra != "" {
+		frames = extra[1:]
+	}
+	return []string{
+		"default-src 'self'",
+		"script-src 'self' 'unsafe-inline'" + extra,
+		"style-src 'self' 'unsafe-inline'",
+		"img-src 'self' data:",
+		"connect-src 'self' ws://" + host + " wss://" + host + extra,
+		"frame-src " + frames,
+		"object-src 'none'",
+		"base-uri 'none'",
+		"form-action 'self'",
+		"frame-ancestors 'none'",
+	}
+}
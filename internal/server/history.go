@@ -0,0 +1,422 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/primal-host/wallet/internal/abi"
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+	"github.com/primal-host/wallet/internal/journal"
+	"github.com/primal-host/wallet/internal/label"
+	"github.com/primal-host/wallet/internal/verified"
+)
+
+// journalEntry is an intent with its receipt's logs decoded, and the
+// labels of the addresses it involves.
+type journalEntry struct {
+	journal.Intent
+	Events  []abi.Event   `json:"events,omitempty"`
+	Summary string        `json:"summary,omitempty"`
+	Labels  []label.Label `json:"labels,omitempty"`
+
+	// Contract is the target's verified source, if a lookup found it.
+	Contract *verified.Summary `json:"contract,omitempty"`
+}
+
+// knownEvents are the events logs are decoded against: the registered
+// ABIs' first, then the common ones.
+func (s *Server) knownEvents() []abi.Function {
+	return append(s.abis.Events(), abi.CommonEvents()...)
+}
+
+// decodeIntent decodes in's logs against known and sums up what it and its
+// internal transfers moved.
+func (s *Server) decodeIntent(in journal.Intent, known []abi.Function) journalEntry {
+	e := journalEntry{Intent: in}
+	var logs []abi.Log
+	if len(in.Logs) > 0 && json.Unmarshal(in.Logs, &logs) == nil {
+		for _, l := range logs {
+			if ev, ok := abi.DecodeLog(l, known); ok {
+				e.Events = append(e.Events, ev)
+			}
+		}
+	}
+	var internal []endpoint.Transfer
+	if len(in.Internal) > 0 {
+		_ = json.Unmarshal(in.Internal, &internal) // malformed, it is left out of the summary
+	}
+	if in.Stage == journal.StageConfirmed {
+		e.Summary = s.summarize(in, e.Events, internal)
+	}
+	if in.To != "" {
+		if ct, ok := s.contracts.Cached(intentChainID(in), in.To); ok {
+			e.Contract = ct.Summary()
+		}
+	}
+	return e
+}
+
+// intentAddresses returns the addresses in involves: its sender, its
+// target, and those its transfers moved assets between.
+func intentAddresses(in journal.Intent, events []abi.Event) []string {
+	var internal []endpoint.Transfer
+	if len(in.Internal) > 0 {
+		_ = json.Unmarshal(in.Internal, &internal)
+	}
+	out := []string{in.From}
+	if in.To != "" {
+		out = append(out, in.To)
+	}
+	for _, m := range movements(in, events, internal) {
+		out = append(out, m.from, m.to)
+	}
+	return out
+}
+
+// involves reports whether addresses include counterparty as other than
+// in's sender.
+func involves(in journal.Intent, addresses []string, counterparty string) bool {
+	return !strings.EqualFold(counterparty, in.From) &&
+		slices.ContainsFunc(addresses, func(a string) bool { return strings.EqualFold(a, counterparty) })
+}
+
+// tagged reports whether any of labels carries tag.
+func tagged(labels []label.Label, tag string) bool {
+	return slices.ContainsFunc(labels, func(l label.Label) bool { return l.Has(tag) })
+}
+
+// flow is an amount of one asset moved in or out; token is empty for the
+// native currency.
+type flow struct {
+	token  string
+	id     string // ERC-721 token ID
+	amount *big.Int
+}
+
+// movement is an amount of one asset moved between two addresses.
+type movement struct {
+	from, to string
+	flow
+}
+
+// movements lists what a mined send moved to or from its sender: its value,
+// the transfers it logged, and the native currency its internal calls
+// moved.
+func movements(in journal.Intent, events []abi.Event, internal []endpoint.Transfer) []movement {
+	var out []movement
+	if v, err := evm.ParseQuantity(in.Value); err == nil && v.Sign() > 0 {
+		out = append(out, movement{in.From, in.To, flow{amount: v}})
+	}
+	for _, ev := range events {
+		from, to, value, ok := transferArgs(ev, "Transfer")
+		if !ok || (!strings.EqualFold(from, in.From) && !strings.EqualFold(to, in.From)) {
+			continue
+		}
+		f := flow{token: ev.Address}
+		if ev.Args[2].Indexed {
+			f.id = value
+		} else if f.amount, ok = new(big.Int).SetString(value, 10); !ok {
+			continue
+		}
+		out = append(out, movement{from, to, f})
+	}
+	for _, t := range internal {
+		v, err := evm.ParseQuantity(t.Value)
+		if err != nil || (!strings.EqualFold(t.From, in.From) && !strings.EqualFold(t.To, in.From)) {
+			continue
+		}
+		out = append(out, movement{t.From, t.To, flow{amount: v}})
+	}
+	return out
+}
+
+// summarize describes what a mined send moved for its sender, from its value,
+// the transfers it logged, and the native currency its internal calls moved:
+// "Swap 1.2 WETH → 3200 USDC", "Send 5 USDC", "Receive 0.5 ETH", or for an
+// approval alone "Approve USDC for 0x…".
+func (s *Server) summarize(in journal.Intent, events []abi.Event, internal []endpoint.Transfer) string {
+	chainID := intentChainID(in)
+	var sent, received []flow
+	for _, m := range movements(in, events, internal) {
+		if strings.EqualFold(m.from, in.From) {
+			sent = addFlow(sent, m.flow)
+		} else {
+			received = addFlow(received, m.flow)
+		}
+	}
+	switch {
+	case len(sent) > 0 && len(received) > 0:
+		return "Swap " + s.formatFlows(in, chainID, sent) + " → " + s.formatFlows(in, chainID, received)
+	case len(received) > 0:
+		return "Receive " + s.formatFlows(in, chainID, received)
+	case len(sent) > 0:
+		return "Send " + s.formatFlows(in, chainID, sent)
+	}
+	for _, ev := range events {
+		owner, spender, value, ok := transferArgs(ev, "Approval")
+		if !ok || ev.Args[2].Indexed || !strings.EqualFold(owner, in.From) {
+			continue
+		}
+		amount, ok := new(big.Int).SetString(value, 10)
+		switch {
+		case !ok:
+		case amount.Sign() == 0:
+			return "Revoke " + s.tokenName(chainID, ev.Address) + " approval for " + spender
+		case amount.BitLen() > 255:
+			return "Approve unlimited " + s.tokenName(chainID, ev.Address) + " for " + spender
+		default:
+			return "Approve " + s.formatFlows(in, chainID, []flow{{token: ev.Address, amount: amount}}) + " for " + spender
+		}
+	}
+	return ""
+}
+
+// contactActivity is what the journal's mined sends moved to and from one
+// counterparty, and when they last involved it.
+type contactActivity struct {
+	Sent            []assetTotal `json:"sent"`
+	Received        []assetTotal `json:"received"`
+	Transactions    int          `json:"transactions"`
+	LastInteraction *time.Time   `json:"last_interaction,omitempty"`
+}
+
+// assetTotal is the total of one asset moved on one chain.
+type assetTotal struct {
+	ChainID      uint64 `json:"chain_id"`
+	Token        string `json:"token"`                   // symbol; an unregistered token's address
+	TokenAddress string `json:"token_address,omitempty"` // empty for the native currency
+	Amount       string `json:"amount"`                  // in whole units; raw for an unregistered token; the count of ERC-721 tokens
+}
+
+// tally sums one asset moved on one chain, with a send that moved it to
+// format the sum by.
+type tally struct {
+	in     journal.Intent
+	flow   flow
+	tokens int // ERC-721 tokens moved
+}
+
+// counterpartyActivity indexes the journal's confirmed and reverted sends by
+// counterparty: every address other than a send's sender that it targeted
+// or moved assets to or from, keyed in lowercase. Only what moved between
+// the sender and the counterparty counts towards the totals. The journal
+// has the sends of the server's profile only, so transfers others made to
+// it aren't seen.
+func (s *Server) counterpartyActivity() map[string]*contactActivity {
+	known := s.knownEvents()
+	type key struct {
+		counterparty string
+		chainID      uint64
+		token        string
+	}
+	sent, received := map[key]*tally{}, map[key]*tally{}
+	var order []key // first seen first, for a stable order of totals
+	out := map[string]*contactActivity{}
+	for _, in := range s.journal.List("") {
+		if in.Stage != journal.StageConfirmed && in.Stage != journal.StageReverted {
+			continue
+		}
+		at := in.UpdatedAt
+		if in.MinedAt != nil {
+			at = *in.MinedAt
+		}
+		var moved []movement
+		if in.Stage == journal.StageConfirmed {
+			e := s.decodeIntent(in, known)
+			var internal []endpoint.Transfer
+			if len(in.Internal) > 0 {
+				_ = json.Unmarshal(in.Internal, &internal)
+			}
+			moved = movements(in, e.Events, internal)
+		}
+
+		seen := map[string]bool{}
+		count := func(address string) {
+			c := strings.ToLower(address)
+			if c == "" || strings.EqualFold(c, in.From) || seen[c] {
+				return
+			}
+			seen[c] = true
+			act := out[c]
+			if act == nil {
+				act = &contactActivity{Sent: []assetTotal{}, Received: []assetTotal{}}
+				out[c] = act
+			}
+			act.Transactions++
+			if act.LastInteraction == nil || at.After(*act.LastInteraction) {
+				t := at.UTC()
+				act.LastInteraction = &t
+			}
+		}
+		count(in.To)
+		chainID := intentChainID(in)
+		for _, m := range moved {
+			count(m.from)
+			count(m.to)
+			totals, other := sent, m.to
+			switch {
+			case strings.EqualFold(m.from, in.From) && !strings.EqualFold(m.to, in.From):
+			case strings.EqualFold(m.to, in.From) && !strings.EqualFold(m.from, in.From):
+				totals, other = received, m.from
+			default:
+				continue
+			}
+			k := key{strings.ToLower(other), chainID, strings.ToLower(m.token)}
+			t := totals[k]
+			if t == nil {
+				t = &tally{in: in, flow: flow{token: m.token}}
+				if sent[k] == nil && received[k] == nil {
+					order = append(order, k)
+				}
+				totals[k] = t
+			}
+			switch {
+			case m.id != "":
+				t.tokens++
+			case t.flow.amount == nil:
+				t.flow.amount = new(big.Int).Set(m.amount)
+			default:
+				t.flow.amount.Add(t.flow.amount, m.amount)
+			}
+		}
+	}
+	for _, k := range order {
+		act := out[k.counterparty]
+		if t := sent[k]; t != nil {
+			act.Sent = append(act.Sent, s.assetTotal(t))
+		}
+		if t := received[k]; t != nil {
+			act.Received = append(act.Received, s.assetTotal(t))
+		}
+	}
+	return out
+}
+
+// assetTotal formats a tally like the history export formats an amount.
+func (s *Server) assetTotal(t *tally) assetTotal {
+	chainID := intentChainID(t.in)
+	out := assetTotal{ChainID: chainID, TokenAddress: t.flow.token}
+	switch {
+	case t.flow.token == "":
+		out.Token, out.Amount = "", evm.FormatUnits(t.flow.amount, 18)
+		if ep, ok := s.store.Get(t.in.Endpoint); ok {
+			out.Token, out.Amount = ep.Native.Symbol, evm.FormatUnits(t.flow.amount, ep.Native.Decimals)
+		}
+	case t.flow.amount == nil:
+		out.Token, out.Amount = s.tokenName(chainID, t.flow.token), strconv.Itoa(t.tokens)
+	default:
+		out.Token, out.Amount = t.flow.token, t.flow.amount.String()
+		if tok, ok := s.erc20.Get(chainID, t.flow.token); ok {
+			out.Token, out.Amount = tok.Symbol, evm.FormatUnits(t.flow.amount, tok.Decimals)
+		}
+	}
+	return out
+}
+
+// intentChainID returns in's chain ID, or 0 if it doesn't parse.
+func intentChainID(in journal.Intent) uint64 {
+	if n, err := evm.ParseQuantity(in.ChainID); err == nil && n.IsUint64() {
+		return n.Uint64()
+	}
+	return 0
+}
+
+// transferArgs returns the arguments of a name(address,address,uint256)
+// event, the shape of ERC-20 and ERC-721 Transfer and Approval, by position,
+// since ABIs name them differently (WETH's are src, dst, and wad).
+func transferArgs(ev abi.Event, name string) (string, string, string, bool) {
+	if ev.Signature != name+"(address,address,uint256)" {
+		return "", "", "", false
+	}
+	a, okA := ev.Args[0].Value.(string)
+	b, okB := ev.Args[1].Value.(string)
+	v, okV := ev.Args[2].Value.(string)
+	return a, b, v, okA && okB && okV
+}
+
+// addFlow adds f to flows, summing amounts of the same token.
+func addFlow(flows []flow, f flow) []flow {
+	if f.amount != nil {
+		for i := range flows {
+			if flows[i].amount != nil && strings.EqualFold(flows[i].token, f.token) {
+				flows[i].amount = new(big.Int).Add(flows[i].amount, f.amount)
+				return flows
+			}
+		}
+	}
+	if f.amount == nil && f.id == "" {
+		return flows
+	}
+	return append(flows, f)
+}
+
+// formatFlows writes amounts with the native currency's or registered
+// token's symbol and decimals; an unregistered token's amount is raw.
+func (s *Server) formatFlows(in journal.Intent, chainID uint64, flows []flow) string {
+	out := make([]string, len(flows))
+	for i, f := range flows {
+		switch {
+		case f.token == "":
+			if ep, ok := s.store.Get(in.Endpoint); ok {
+				out[i] = ep.Native.Format(f.amount)
+			} else {
+				out[i] = evm.FormatUnits(f.amount, 18)
+			}
+		case f.id != "":
+			out[i] = s.tokenName(chainID, f.token) + " #" + f.id
+		default:
+			if t, ok := s.erc20.Get(chainID, f.token); ok {
+				out[i] = evm.FormatUnits(f.amount, t.Decimals) + " " + t.Symbol
+			} else {
+				out[i] = f.amount.String() + " of " + f.token
+			}
+		}
+	}
+	return strings.Join(out, " + ")
+}
+
+// tokenName is a registered token's symbol, or else its address.
+func (s *Server) tokenName(chainID uint64, address string) string {
+	if t, ok := s.erc20.Get(chainID, address); ok {
+		return t.Symbol
+	}
+	return address
+}
+
+// handleInternalTransfers traces a transaction on ?endpoint= for the native
+// currency its internal calls moved. An endpoint that can't trace answers
+// with no trace method and no transfers rather than an error.
+func (s *Server) handleInternalTransfers(c echo.Context) error {
+	hash := c.Param("hash")
+	if b, err := evm.DecodeHex(hash); err != nil || len(b) != 32 || !strings.HasPrefix(hash, "0x") {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid transaction hash"})
+	}
+	ep, ok := s.profileFor(c.Request().Context()).store.Get(c.QueryParam("endpoint"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "endpoint not found"})
+	}
+	out := map[string]any{"hash": hash, "endpoint": ep.ID, "trace": "", "transfers": []endpoint.Transfer{}}
+	transfers, err := endpoint.InternalTransfers(c.Request().Context(), ep, hash)
+	switch {
+	case errors.Is(err, endpoint.ErrNoTrace):
+		return c.JSON(http.StatusOK, out)
+	case err != nil:
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	out["trace"] = endpoint.Probe(c.Request().Context(), ep).TraceMethod()
+	if transfers != nil {
+		out["transfers"] = transfers
+	}
+	return c.JSON(http.StatusOK, out)
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/evm"
+	"github.com/primal-host/wallet/internal/icon"
+)
+
+// handleChainIcon serves a chain's logo. The chain ID may be decimal or 0x
+// hex.
+func (s *Server) handleChainIcon(c echo.Context) error {
+	chainID, err := parseChainID(c.Param("chain"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	img, err := s.icons.Chain(c.Request().Context(), chainID)
+	return serveIcon(c, img, err)
+}
+
+// handleAssetIcon serves an asset's icon.
+func (s *Server) handleAssetIcon(c echo.Context) error {
+	a, ok := s.store.Assets().Get(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "asset " + c.Param("id") + " not found"})
+	}
+	img, err := s.icons.Asset(c.Request().Context(), a)
+	return serveIcon(c, img, err)
+}
+
+// handleTokenIcon serves the logo of a token contract.
+func (s *Server) handleTokenIcon(c echo.Context) error {
+	chainID, err := parseChainID(c.Param("chain"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	addr, err := evm.ParseAddress(c.Param("address"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	img, err := s.icons.Token(c.Request().Context(), chainID, addr)
+	return serveIcon(c, img, err)
+}
+
+// serveIcon writes an image from the icon cache. Browsers may keep it for a
+// day, and a miss for an hour.
+func serveIcon(c echo.Context, img icon.Icon, err error) error {
+	if err != nil {
+		if errors.Is(err, icon.ErrNotFound) {
+			// Misses are remembered server-side too; spare the round trip.
+			c.Response().Header().Set("Cache-Control", "private, max-age=3600")
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	c.Response().Header().Set("Cache-Control", "private, max-age=86400")
+	return c.Blob(http.StatusOK, img.ContentType, img.Data)
+}
+
+func parseChainID(s string) (uint64, error) {
+	base := 10
+	if rest, ok := strings.CutPrefix(strings.ToLower(s), "0x"); ok {
+		s, base = rest, 16
+	}
+	n, err := strconv.ParseUint(s, base, 64)
+	if err != nil {
+		return 0, errors.New("chain must be a decimal or 0x hex chain ID")
+	}
+	return n, nil
+}
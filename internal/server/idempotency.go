@@ -0,0 +1,106 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/idempotency"
+)
+
+// idempotent wraps a route that sends transactions. A request carrying an
+// Idempotency-Key header runs at most once: retries with the same key and
+// body get the stored response back, marked Idempotent-Replayed. Keys are
+// scoped to the principal that sent them, so another user or API token
+// reusing a key runs its own request rather than seeing this one's result.
+//
+// 4xx responses are not stored, since those requests were rejected before
+// anything was sent; fix the request and retry with the same key. Every
+// other response is stored, including 502s, because the transaction may
+// have reached the node even though the call failed.
+func (s *Server) idempotent(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key := c.Request().Header.Get("Idempotency-Key")
+		if key == "" {
+			return next(c)
+		}
+		if len(key) > 255 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Idempotency-Key is longer than 255 characters"})
+		}
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		}
+		c.Request().Body = io.NopCloser(bytes.NewReader(body))
+		// Whitespace doesn't make it a different request.
+		var compact bytes.Buffer
+		if json.Compact(&compact, body) == nil {
+			body = compact.Bytes()
+		}
+		sum := sha256.Sum256(body)
+		rec := idempotency.Record{
+			Key:         key,
+			Principal:   s.principal(c.Request().Context()),
+			Route:       c.Request().Method + " " + c.Path(),
+			RequestHash: hex.EncodeToString(sum[:]),
+		}
+
+		prev, err := s.idem.Begin(rec.Principal, rec.Key, rec.Route, rec.RequestHash)
+		switch {
+		case errors.Is(err, idempotency.ErrInProgress):
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		case err != nil:
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		case prev != nil:
+			c.Response().Header().Set("Idempotent-Replayed", "true")
+			var out bytes.Buffer
+			if err := json.Compact(&out, prev.Body); err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "stored response is unreadable"})
+			}
+			out.WriteByte('\n')
+			return c.JSONBlob(prev.Status, out.Bytes())
+		}
+
+		// Until the response is stored, the key is given back however the
+		// handler ends, panics included, so the request can be retried.
+		stored := false
+		defer func() {
+			if !stored {
+				s.idem.Release(rec.Principal, rec.Key)
+			}
+		}()
+		tee := &teeWriter{ResponseWriter: c.Response().Writer}
+		c.Response().Writer = tee
+		err = next(c)
+		rec.Status = c.Response().Status
+		if err != nil || !c.Response().Committed || (rec.Status >= 400 && rec.Status < 500) {
+			return err
+		}
+		rec.Body = tee.buf.Bytes()
+		stored = true
+		if err := s.idem.Finish(rec); err != nil {
+			// The record is still held in memory, so retries are answered
+			// from it; only a restart before the next successful write
+			// would forget the key.
+			slog.Error("idempotency key not persisted; replays only until restart", "key", key, "error", err)
+		}
+		return nil
+	}
+}
+
+// teeWriter keeps a copy of the response body.
+type teeWriter struct {
+	http.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (w *teeWriter) Write(b []byte) (int, error) {
+	w.buf.Write(b)
+	return w.ResponseWriter.Write(b)
+}
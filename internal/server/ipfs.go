@@ -0,0 +1,42 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/ipfs"
+)
+
+// ipfsRoutes registers the IPFS gateway proxy.
+func (s *Server) ipfsRoutes() {
+	s.echo.GET("/api/ipfs/*", s.handleIPFS)
+}
+
+// handleIPFS serves /api/ipfs/<cid>[/<path>] from the IPFS cache, fetching
+// it through the configured gateways the first time, so the browser never
+// contacts a gateway itself. The content is immutable, so browsers may keep
+// it indefinitely. It is served sandboxed: an HTML or SVG document must not
+// run scripts on the wallet's origin.
+func (s *Server) handleIPFS(c echo.Context) error {
+	path, err := url.PathUnescape(c.Param("*"))
+	if err == nil {
+		path, err = ipfs.ParsePath(path)
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	content, err := s.ipfs.Get(c.Request().Context(), path)
+	if err != nil {
+		if errors.Is(err, ipfs.ErrNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	s.setCSP(c, apiCSP, "sandbox")
+	c.Response().Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	return c.Blob(http.StatusOK, content.ContentType, content.Data)
+}
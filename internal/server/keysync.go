@@ -0,0 +1,137 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/keysync"
+)
+
+// keySyncRoutes registers the synced browser vault.
+func (s *Server) keySyncRoutes() {
+	s.echo.GET("/api/keysync", s.handleGetKeySync)
+	s.echo.PUT("/api/keysync", s.handleEnableKeySync)
+	s.echo.DELETE("/api/keysync", s.handleDisableKeySync)
+	s.echo.PUT("/api/keysync/credential", s.handleSetSyncedCredential)
+	s.echo.PUT("/api/keysync/keys/:address", s.handlePutSyncedKey)
+	s.echo.DELETE("/api/keysync/keys/:address", s.handlePurgeSyncedKey)
+}
+
+// keySyncError maps a synced vault error to its status.
+func keySyncError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, keysync.ErrOff):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, keysync.ErrConflict):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case strings.Contains(err.Error(), "not found"):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+}
+
+// handleGetKeySync returns the caller's synced vault, or 404 while sync is
+// off.
+func (s *Server) handleGetKeySync(c echo.Context) error {
+	v, err := s.profileFor(c.Request().Context()).synced.Get()
+	if err != nil {
+		return keySyncError(c, err)
+	}
+	return c.JSON(http.StatusOK, v)
+}
+
+// handleEnableKeySync turns sync on with the calling browser's vault. If a
+// different vault is synced it answers 409, unless ?replace=true.
+func (s *Server) handleEnableKeySync(c echo.Context) error {
+	var req keysync.Vault
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	p := s.profileFor(c.Request().Context())
+	v, err := p.synced.Enable(req, c.QueryParam("replace") == "true")
+	if err != nil {
+		return keySyncError(c, err)
+	}
+	slog.Info("vault sync enabled", "subsystem", "keysync", "by", p.name(), "keys", len(v.Keys))
+	return c.JSON(http.StatusOK, v)
+}
+
+// handleDisableKeySync turns sync off and deletes the server's copy. Each
+// browser keeps its own.
+func (s *Server) handleDisableKeySync(c echo.Context) error {
+	p := s.profileFor(c.Request().Context())
+	if err := p.synced.Disable(); err != nil {
+		if errors.Is(err, keysync.ErrOff) {
+			return keySyncError(c, err)
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	slog.Info("vault sync disabled", "subsystem", "keysync", "by", p.name())
+	return c.JSON(http.StatusOK, map[string]string{"status": "disabled"})
+}
+
+// handleSetSyncedCredential replaces the synced vault's credential when a
+// browser adds or removes a password or passkey. The body names the vault
+// and the credential version the browser last saw; if either is out of date
+// it answers 409.
+func (s *Server) handleSetSyncedCredential(c echo.Context) error {
+	var req struct {
+		Vault       string          `json:"vault"`
+		BaseVersion int64           `json:"base_version"`
+		Credential  json.RawMessage `json:"credential"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	p := s.profileFor(c.Request().Context())
+	v, err := p.synced.SetCredential(req.Vault, req.BaseVersion, req.Credential)
+	if err != nil {
+		return keySyncError(c, err)
+	}
+	slog.Info("synced credential changed", "subsystem", "keysync", "by", p.name())
+	return c.JSON(http.StatusOK, v)
+}
+
+// handlePutSyncedKey adds or updates one key. The body names the vault and
+// the version of the key the browser last saw (0 for a new key); if either
+// is out of date it answers 409 with the server's copy of the key, when
+// there is one.
+func (s *Server) handlePutSyncedKey(c echo.Context) error {
+	var req struct {
+		keysync.Key
+		Vault       string `json:"vault"`
+		BaseVersion int64  `json:"base_version"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	req.Key.Address = c.Param("address")
+	k, err := s.profileFor(c.Request().Context()).synced.Put(req.Vault, req.BaseVersion, req.Key)
+	if errors.Is(err, keysync.ErrConflict) && k.Address != "" {
+		return c.JSON(http.StatusConflict, map[string]any{"error": err.Error(), "key": k})
+	}
+	if err != nil {
+		return keySyncError(c, err)
+	}
+	return c.JSON(http.StatusOK, k)
+}
+
+// handlePurgeSyncedKey permanently removes a key, given ?vault= and the
+// ?base_version= the browser last saw.
+func (s *Server) handlePurgeSyncedKey(c echo.Context) error {
+	base, err := strconv.ParseInt(c.QueryParam("base_version"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "base_version is required"})
+	}
+	if err := s.profileFor(c.Request().Context()).synced.Purge(c.QueryParam("vault"), base, c.Param("address")); err != nil {
+		return keySyncError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "purged"})
+}
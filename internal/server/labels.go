@@ -0,0 +1,59 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/label"
+	"github.com/primal-host/wallet/internal/txbuild"
+)
+
+// labelRoutes registers the names and tags of addresses.
+func (s *Server) labelRoutes() {
+	s.echo.GET("/api/labels", s.handleListLabels)
+	s.echo.PUT("/api/labels/:address", s.handleSetLabel)
+	s.echo.DELETE("/api/labels/:address", s.handleDeleteLabel)
+}
+
+// handleListLabels returns the profile's labels by address, only those
+// with ?tag= if given.
+func (s *Server) handleListLabels(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.profileFor(c.Request().Context()).labels.List(c.QueryParam("tag")))
+}
+
+// handleSetLabel names and tags an address, replacing its label.
+func (s *Server) handleSetLabel(c echo.Context) error {
+	p := s.profileFor(c.Request().Context())
+	var req label.Label
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	req.Address = c.Param("address")
+	l, err := p.labels.Set(req)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	slog.Info("label set", "subsystem", "labels", "address", l.Address, "name", l.Name, "tags", strings.Join(l.Tags, ","), "by", p.name())
+	return c.JSON(http.StatusOK, l)
+}
+
+// handleDeleteLabel removes an address's label.
+func (s *Server) handleDeleteLabel(c echo.Context) error {
+	p := s.profileFor(c.Request().Context())
+	if err := p.labels.Delete(c.Param("address")); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	slog.Info("label deleted", "subsystem", "labels", "address", c.Param("address"), "by", p.name())
+	return c.JSON(http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// envelopeLabels returns the profile's labels of the addresses env
+// involves: its sender, its target, and a token recipient or spender.
+func (s *Server) envelopeLabels(ctx context.Context, env *txbuild.Envelope) []label.Label {
+	return s.profileFor(ctx).labels.Lookup(append([]string{env.From}, recipients(env)...)...)
+}
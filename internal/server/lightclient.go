@@ -0,0 +1,89 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/lightclient"
+)
+
+// lightClients keeps a light client per beacon node and checkpoint that
+// endpoints in use name, shared by endpoints configured alike. The poller
+// keeps them synced.
+type lightClients struct {
+	mu      sync.Mutex
+	clients map[string]*lightEntry
+}
+
+type lightEntry struct {
+	client *lightclient.Client
+	used   time.Time
+}
+
+// lightKey is what sets a light client apart: its beacon node, checkpoint,
+// and how it reaches the node.
+func lightKey(ep endpoint.Endpoint) string {
+	return fmt.Sprintf("%s|%s|%s|%s", ep.Consensus, ep.Checkpoint, ep.Proxy, ep.Timeout)
+}
+
+// client returns the light client of ep, which must have a consensus URL,
+// starting one if there is none.
+func (l *lightClients) client(ep endpoint.Endpoint) *lightclient.Client {
+	key := lightKey(ep)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.clients == nil {
+		l.clients = map[string]*lightEntry{}
+	}
+	e, ok := l.clients[key]
+	if !ok {
+		beacon := endpoint.Endpoint{ID: ep.ID, URL: ep.Consensus, Proxy: ep.Proxy, Timeout: ep.Timeout}
+		e = &lightEntry{client: lightclient.New(beacon, ep.Checkpoint)}
+		l.clients[key] = e
+	}
+	e.used = time.Now()
+	return e.client
+}
+
+// prune drops clients no endpoint has used for longer than pollerIdle.
+func (l *lightClients) prune() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, e := range l.clients {
+		if time.Since(e.used) > pollerIdle {
+			delete(l.clients, key)
+		}
+	}
+}
+
+// syncLight starts a sync of the light client of every endpoint in stores
+// that has one. Clients skip syncs while one runs or within a slot of the
+// last.
+func (p *poller) syncLight(stores []*endpoint.Store) {
+	p.s.lights.prune()
+	for _, store := range stores {
+		for _, ep := range store.List() {
+			if ep.Consensus != "" {
+				go p.s.lights.client(ep).Sync(p.s.ctx)
+			}
+		}
+	}
+}
+
+// handleLightClient reports how far an endpoint's light client has
+// followed the beacon chain.
+func (s *Server) handleLightClient(c echo.Context) error {
+	ep, ok := s.storeFor(c.Request().Context()).Get(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "endpoint not found"})
+	}
+	if ep.Consensus == "" {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "endpoint has no light client"})
+	}
+	return c.JSON(http.StatusOK, s.lights.client(ep).Status())
+}
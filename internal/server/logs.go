@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/logtail"
+)
+
+// logFilter reads the ?level= (default info) and ?subsystem= query
+// parameters.
+func logFilter(c echo.Context) (logtail.Filter, error) {
+	f := logtail.Filter{Level: slog.LevelInfo, Subsystem: c.QueryParam("subsystem")}
+	if lvl := c.QueryParam("level"); lvl != "" {
+		if err := f.Level.UnmarshalText([]byte(lvl)); err != nil {
+			return f, fmt.Errorf("invalid level %q", lvl)
+		}
+	}
+	return f, nil
+}
+
+// handleLogs returns recent log entries and the subsystems that logged them.
+func (s *Server) handleLogs(c echo.Context) error {
+	f, err := logFilter(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"subsystems": s.logs.Subsystems(),
+		"entries":    s.logs.Recent(f),
+	})
+}
+
+// handleLogStream sends recent log entries as server-sent events, then
+// streams new ones as they are logged.
+func (s *Server) handleLogStream(c echo.Context) error {
+	f, err := logFilter(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	// Subscribe before reading the backlog so nothing falls in between.
+	live, cancel := s.logs.Subscribe()
+	defer cancel()
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+
+	send := func(e logtail.Entry) error {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(res, "data: %s\n\n", data)
+		return err
+	}
+
+	var last time.Time
+	for _, e := range s.logs.Recent(f) {
+		if err := send(e); err != nil {
+			return nil
+		}
+		last = e.Time
+	}
+	res.Flush()
+
+	ping := time.NewTicker(30 * time.Second)
+	defer ping.Stop()
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-s.closing:
+			return nil
+		case <-ping.C:
+			if _, err := fmt.Fprint(res, ": ping\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		case e, ok := <-live:
+			if !ok {
+				return nil
+			}
+			if !f.Match(e) || !e.Time.After(last) {
+				continue
+			}
+			if err := send(e); err != nil {
+				return nil
+			}
+			res.Flush()
+		}
+	}
+}
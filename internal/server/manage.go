@@ -0,0 +1,225 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/primal-host/wallet/internal/abi"
+	"github.com/primal-host/wallet/internal/alert"
+	"github.com/primal-host/wallet/internal/approval"
+	"github.com/primal-host/wallet/internal/batch"
+	"github.com/primal-host/wallet/internal/bench"
+	"github.com/primal-host/wallet/internal/bookmark"
+	"github.com/primal-host/wallet/internal/bridge"
+	"github.com/primal-host/wallet/internal/contact"
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/erc20"
+	"github.com/primal-host/wallet/internal/faucet"
+	"github.com/primal-host/wallet/internal/icon"
+	"github.com/primal-host/wallet/internal/idempotency"
+	"github.com/primal-host/wallet/internal/ipfs"
+	"github.com/primal-host/wallet/internal/journal"
+	"github.com/primal-host/wallet/internal/keysync"
+	"github.com/primal-host/wallet/internal/label"
+	"github.com/primal-host/wallet/internal/logtail"
+	"github.com/primal-host/wallet/internal/nft"
+	"github.com/primal-host/wallet/internal/notify"
+	"github.com/primal-host/wallet/internal/paymaster"
+	"github.com/primal-host/wallet/internal/phishing"
+	"github.com/primal-host/wallet/internal/risk"
+	"github.com/primal-host/wallet/internal/safe"
+	"github.com/primal-host/wallet/internal/schedule"
+	"github.com/primal-host/wallet/internal/signer"
+	"github.com/primal-host/wallet/internal/uptime"
+	"github.com/primal-host/wallet/internal/user"
+	"github.com/primal-host/wallet/internal/vault"
+	"github.com/primal-host/wallet/internal/verified"
+	"github.com/primal-host/wallet/internal/verify"
+	"github.com/primal-host/wallet/internal/webpush"
+)
+
+const broadcastOnly = false
+
+// manageState is everything behind the management routes: keys, signers,
+// bookmarks, contacts, address labels, the scam address list and risk
+// scanner, ABIs, contract verification lookups, the ERC-20 token registry,
+// preferences, the synced browser vault, the IPFS cache, the NFT index,
+// schedules, tracked bridge transfers, batch sends, alerts, notification
+// channels and browser push subscriptions, paymasters, the Safe
+// Transaction Service client, the approval queue, the send journal, the
+// faucet, local devnet detection, and users.
+// Broadcast-only builds replace it with an empty struct.
+type manageState struct {
+	accounts     *signer.Store
+	bookmarks    *bookmark.Store
+	contacts     *contact.Store
+	labels       *label.Store
+	scams        *phishing.List
+	scanner      risk.Scanner // nil unless RISK_WEBHOOK is set
+	riskBlock    bool         // refuse transactions with a critical warning
+	abis         *abi.Registry
+	contracts    *verified.Cache
+	erc20        *erc20.Store
+	prefs        *user.Prefs
+	synced       *keysync.Store
+	ipfs         *ipfs.Cache
+	nfts         *nft.Index
+	schedules    *schedule.Store
+	bridges      *bridge.Store
+	batches      *batch.Store
+	disperse     string     // Disperse contract for batch sends
+	batchMu      sync.Mutex // held while a batch is sent
+	alerts       *alert.Store
+	alertMu      sync.Mutex        // held while alerts are checked
+	alertBlocks  map[string]string // alert ID -> block it was last checked at; under alertMu
+	channels     *notify.Store
+	pushes       *webpush.Store
+	paymasters   *paymaster.Store
+	safeService  *safe.Service
+	approvals    *approval.Store
+	journal      *journal.Store
+	vault        *vault.Vault
+	faucet       *faucet.Faucet // nil unless faucet mode is enabled
+	devnets      []string       // node URLs probed for Anvil and Hardhat
+	devnetMu     sync.Mutex
+	snapshots    map[string][]devnetSnapshot // node URL -> snapshots taken through the wallet; under devnetMu
+	impersonated map[string][]string         // node URL -> addresses impersonated; under devnetMu
+	files        []verify.File               // store files checked by /api/verify
+
+	users         *user.Store // nil unless multi-user mode is enabled
+	sessions      *user.Sessions
+	tokens        *user.Tokens
+	devices       *user.Devices
+	serverProfile *profile
+	profileMu     sync.Mutex
+	profiles      map[string]*userData // user ID -> open profile directory
+
+	lockMu    sync.Mutex
+	lockEpoch int64         // bumped by every panic lock
+	lockCh    chan struct{} // closed (and replaced) by every panic lock
+}
+
+var errPanicLock = errors.New("signing cancelled: wallet locked")
+
+// New builds the full server. f may be nil to leave faucet mode off, and
+// users nil to leave multi-user mode off.
+func New(store *endpoint.Store, idem *idempotency.Store, icons *icon.Cache, history *uptime.Store, benches *bench.Store, limits Limits, headers Headers, proxy Proxy, accounts *signer.Store, bookmarks *bookmark.Store, contacts *contact.Store, labels *label.Store, scams *phishing.List, scanner risk.Scanner, riskBlock bool, abis *abi.Registry, contracts *verified.Cache, tokens20 *erc20.Store, prefs *user.Prefs, synced *keysync.Store, ipfsCache *ipfs.Cache, nfts *nft.Index, schedules *schedule.Store, bridges *bridge.Store, batches *batch.Store, disperse string, alerts *alert.Store, channels *notify.Store, pushes *webpush.Store, paymasters *paymaster.Store, safeService *safe.Service, approvals *approval.Store, j *journal.Store, v *vault.Vault, f *faucet.Faucet, devnets []string, users *user.Store, sessions *user.Sessions, tokens *user.Tokens, devices *user.Devices, files []verify.File, logs *logtail.Tail, addr string) *Server {
+	s := newServer(store, idem, icons, history, benches, limits, headers, proxy, logs, addr)
+	s.accounts = accounts
+	s.bookmarks = bookmarks
+	s.contacts = contacts
+	s.labels = labels
+	s.scams = scams
+	s.scanner = scanner
+	s.riskBlock = riskBlock
+	s.abis = abis
+	s.contracts = contracts
+	s.erc20 = tokens20
+	s.prefs = prefs
+	s.synced = synced
+	s.ipfs = ipfsCache
+	s.nfts = nfts
+	s.schedules = schedules
+	s.bridges = bridges
+	s.batches = batches
+	s.disperse = disperse
+	s.alerts = alerts
+	s.alertBlocks = map[string]string{}
+	s.channels = channels
+	s.pushes = pushes
+	s.paymasters = paymasters
+	s.safeService = safeService
+	s.approvals = approvals
+	s.journal = j
+	s.vault = v
+	s.faucet = f
+	s.devnets = devnets
+	s.snapshots = map[string][]devnetSnapshot{}
+	s.impersonated = map[string][]string{}
+	s.users = users
+	s.sessions = sessions
+	s.tokens = tokens
+	s.devices = devices
+	s.files = files
+	s.serverProfile = &profile{store: store, accounts: accounts, bookmarks: bookmarks, contacts: contacts, labels: labels, erc20: tokens20, prefs: prefs, synced: synced}
+	s.profiles = map[string]*userData{}
+	s.lockCh = make(chan struct{})
+	s.userRoutes()
+	s.manageRoutes()
+	s.keySyncRoutes()
+	s.ipfsRoutes()
+	s.nftRoutes()
+	s.erc20Routes()
+	s.permitRoutes()
+	s.safeRoutes()
+	s.contactRoutes()
+	s.labelRoutes()
+	s.searchRoutes()
+	go s.refreshTokenLists()
+	s.calldataRoutes()
+	s.contractRoutes()
+	go s.recoverWork()
+	s.scheduleRoutes()
+	go s.runSchedules()
+	s.bridgeRoutes()
+	go s.runBridges()
+	s.batchRoutes()
+	s.alertRoutes()
+	s.channelRoutes()
+	s.webPushRoutes()
+	s.paymasterRoutes()
+	s.approvalRoutes()
+	go s.runApprovals()
+	if f != nil {
+		s.faucetRoutes()
+	}
+	s.devnetRoutes()
+	return s
+}
+
+// panicLock locks the server vault, bumps the lock epoch so dashboards lock
+// (at once over the push channel, otherwise on their next poll), and cancels
+// signing requests still in flight.
+func (s *Server) panicLock() int64 {
+	s.vault.Lock()
+	s.lockMu.Lock()
+	defer s.lockMu.Unlock()
+	s.lockEpoch++
+	close(s.lockCh)
+	s.lockCh = make(chan struct{})
+	slog.Warn("panic lock", "subsystem", "vault", "epoch", s.lockEpoch)
+	s.hub.broadcast(map[string]any{"type": "lock", "lock_epoch": s.lockEpoch})
+	return s.lockEpoch
+}
+
+func (s *Server) currentLockEpoch() int64 {
+	s.lockMu.Lock()
+	defer s.lockMu.Unlock()
+	return s.lockEpoch
+}
+
+// customErrors returns the registered ABIs' custom errors, for decoding
+// reverts.
+func (s *Server) customErrors() []abi.Function { return s.abis.Errors() }
+
+// signingContext derives a context that is cancelled with errPanicLock by
+// the next panic lock.
+func (s *Server) signingContext(parent context.Context) (context.Context, context.CancelFunc) {
+	s.lockMu.Lock()
+	locked := s.lockCh
+	s.lockMu.Unlock()
+
+	ctx, cancel := context.WithCancelCause(parent)
+	go func() {
+		select {
+		case <-locked:
+			cancel(errPanicLock)
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() { cancel(nil) }
+}
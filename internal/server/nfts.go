@@ -0,0 +1,68 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/evm"
+	"github.com/primal-host/wallet/internal/nft"
+)
+
+// nftRoutes registers the NFT inventory and its image cache.
+func (s *Server) nftRoutes() {
+	s.echo.GET("/api/nfts", s.handleNFTs)
+	s.echo.GET("/api/nfts/image/:chain/:contract/:token", s.handleNFTImage)
+}
+
+// handleNFTs returns the ERC-721 and ERC-1155 tokens an address holds on an
+// endpoint's chain. Indexing a long history takes several requests; the
+// dashboard asks again until the inventory is complete.
+func (s *Server) handleNFTs(c echo.Context) error {
+	owner, err := evm.ParseAddress(c.QueryParam("address"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	var fromBlock uint64
+	if v := c.QueryParam("from_block"); v != "" {
+		if fromBlock, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "from_block must be a block number"})
+		}
+	}
+	ctx := c.Request().Context()
+	ep, ok := s.storeFor(ctx).Get(c.QueryParam("endpoint"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "endpoint not found"})
+	}
+	inv, err := s.nfts.Inventory(ctx, ep, owner, fromBlock)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, inv)
+}
+
+// handleNFTImage serves a token's image from the cache, downloading it the
+// first time. Browsers may keep it for a day, and a miss for an hour.
+func (s *Server) handleNFTImage(c echo.Context) error {
+	chainID, err := parseChainID(c.Param("chain"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	contract, err := evm.ParseAddress(c.Param("contract"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	img, err := s.nfts.Image(c.Request().Context(), chainID, contract.Hex(), c.Param("token"))
+	if err != nil {
+		if errors.Is(err, nft.ErrNotFound) {
+			c.Response().Header().Set("Cache-Control", "private, max-age=3600")
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	c.Response().Header().Set("Cache-Control", "private, max-age=86400")
+	return c.Blob(http.StatusOK, img.ContentType, img.Data)
+}
@@ -0,0 +1,102 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/evm"
+	"github.com/primal-host/wallet/internal/paymaster"
+)
+
+// paymasterRoutes registers paymaster configuration and sponsorship.
+func (s *Server) paymasterRoutes() {
+	s.echo.GET("/api/paymasters", s.handleListPaymasters)
+	s.echo.POST("/api/paymasters", s.handleAddPaymaster)
+	s.echo.DELETE("/api/paymasters/:id", s.handleDeletePaymaster)
+	s.echo.POST("/api/paymasters/sponsor", s.handleSponsor)
+}
+
+// sponsorRequest asks for sponsorship of a UserOperation, from a named
+// paymaster or else the first one configured for the chain.
+type sponsorRequest struct {
+	Paymaster     string                  `json:"paymaster"`
+	ChainID       uint64                  `json:"chain_id"`
+	UserOperation paymaster.UserOperation `json:"user_operation"`
+}
+
+// sponsorResponse is the sponsorship and the UserOperation with it applied,
+// ready to sign.
+type sponsorResponse struct {
+	*paymaster.Sponsorship
+	PaymasterID   string                  `json:"paymaster_id"`
+	UserOperation paymaster.UserOperation `json:"user_operation"`
+}
+
+// handleListPaymasters returns the configured paymasters.
+func (s *Server) handleListPaymasters(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.paymasters.List())
+}
+
+// handleAddPaymaster configures a paymaster service for a chain.
+func (s *Server) handleAddPaymaster(c echo.Context) error {
+	var req paymaster.Paymaster
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	pm, err := s.paymasters.Add(req)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	slog.Info("paymaster added", "subsystem", "paymaster", "paymaster", pm.ID, "name", pm.Name, "chain_id", pm.ChainID, "by", s.profileFor(c.Request().Context()).name())
+	return c.JSON(http.StatusCreated, pm)
+}
+
+// handleDeletePaymaster removes a paymaster.
+func (s *Server) handleDeletePaymaster(c echo.Context) error {
+	if err := s.paymasters.Delete(c.Param("id")); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	slog.Info("paymaster deleted", "subsystem", "paymaster", "paymaster", c.Param("id"), "by", s.profileFor(c.Request().Context()).name())
+	return c.JSON(http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// handleSponsor asks a paymaster to pay for a UserOperation and returns who
+// pays, in what token, and the operation with the paymaster fields set.
+func (s *Server) handleSponsor(c echo.Context) error {
+	var req sponsorRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if _, err := evm.ParseAddress(req.UserOperation.Sender); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "user_operation.sender: " + err.Error()})
+	}
+	var (
+		pm paymaster.Paymaster
+		ok bool
+	)
+	if req.Paymaster != "" {
+		pm, ok = s.paymasters.Get(req.Paymaster)
+	} else {
+		pm, ok = s.paymasters.ForChain(req.ChainID)
+	}
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "paymaster not found"})
+	}
+	if req.ChainID != 0 && req.ChainID != pm.ChainID {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "paymaster is for another chain"})
+	}
+	sp, err := paymaster.Sponsor(c.Request().Context(), pm, req.UserOperation)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	if sp.Token != "" {
+		if t, ok := s.erc20.Get(pm.ChainID, sp.Token); ok {
+			sp.TokenSymbol = t.Symbol
+		}
+	}
+	slog.Info("paymaster sponsorship", "subsystem", "paymaster", "paymaster", pm.ID, "sender", req.UserOperation.Sender, "sponsor", sp.Sponsor, "token", sp.Token, "by", s.profileFor(c.Request().Context()).name())
+	return c.JSON(http.StatusOK, sponsorResponse{Sponsorship: sp, PaymasterID: pm.ID, UserOperation: sp.Apply(req.UserOperation)})
+}
@@ -0,0 +1,146 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/erc20"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// Default lifetimes of a permit's signature and of a Permit2 allowance.
+const (
+	permitDeadline   = time.Hour
+	permitExpiration = 30 * 24 * time.Hour
+)
+
+// permitRequest is the body of the permit endpoints. Amount is in the
+// token's smallest unit, as decimal or 0x hex; empty is unlimited.
+type permitRequest struct {
+	Endpoint   string           `json:"endpoint"`
+	Kind       erc20.PermitKind `json:"kind"`
+	Owner      string           `json:"owner"`
+	Token      string           `json:"token"`
+	Spender    string           `json:"spender"`
+	Amount     string           `json:"amount"`
+	Deadline   uint64           `json:"deadline"`
+	Expiration uint64           `json:"expiration"`
+	Signature  string           `json:"signature"`
+}
+
+// permitRoutes registers EIP-2612 and Permit2 permit signing.
+func (s *Server) permitRoutes() {
+	s.echo.POST("/api/permits", s.handleBuildPermit)
+	s.echo.POST("/api/permits/sign", s.handleSignPermit)
+}
+
+// handleBuildPermit returns a permit's typed data for a browser or hardware
+// key to sign. With a signature, it checks that the owner made it and adds
+// the permit() calldata.
+func (s *Server) handleBuildPermit(c echo.Context) error {
+	var req permitRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	p, status, err := s.buildPermit(c.Request().Context(), req)
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+	if req.Signature != "" {
+		sig, err := evm.ParseSignature(req.Signature)
+		if err == nil {
+			err = p.SetSignature(sig)
+		}
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	}
+	return c.JSON(http.StatusOK, p)
+}
+
+// handleSignPermit signs a permit with the vault key or remote signer that
+// holds its owner. Permits can't wait in the approval queue, so they are
+// refused while REQUIRE_APPROVAL is on.
+func (s *Server) handleSignPermit(c echo.Context) error {
+	var req permitRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if s.approvals.Required() {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "REQUIRE_APPROVAL is on, and permits can't be queued; sign with a browser or hardware key instead"})
+	}
+	p, status, err := s.buildPermit(c.Request().Context(), req)
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+	acct, backend, err := s.txSigner(p.Owner)
+	if err != nil {
+		if strings.Contains(err.Error(), "no signer account") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	ctx, cancel := s.signingContext(c.Request().Context())
+	defer cancel()
+	sig, err := backend.SignPayload(ctx, acct, p.Payload())
+	if context.Cause(ctx) == errPanicLock {
+		err = errPanicLock
+	}
+	if err == nil {
+		err = p.SetSignature(sig)
+	}
+	if err != nil {
+		return s.signError(c, err)
+	}
+	slog.Info("permit signed", "subsystem", "permits", "kind", p.Kind, "chain_id", p.ChainID, "owner", p.Owner, "token", p.Token, "spender", p.Spender, "amount", p.Amount, "by", s.profileFor(c.Request().Context()).name())
+	return c.JSON(http.StatusOK, p)
+}
+
+// buildPermit validates req and builds its permit through the caller's
+// endpoint, returning the status to answer with on failure.
+func (s *Server) buildPermit(ctx context.Context, req permitRequest) (*erc20.Permit, int, error) {
+	var (
+		r   = erc20.PermitRequest{Kind: req.Kind, Deadline: req.Deadline, Expiration: req.Expiration}
+		err error
+	)
+	for _, f := range []struct {
+		name string
+		in   string
+		out  *evm.Address
+	}{{"owner", req.Owner, &r.Owner}, {"token", req.Token, &r.Token}, {"spender", req.Spender, &r.Spender}} {
+		if *f.out, err = evm.ParseAddress(strings.TrimSpace(f.in)); err != nil {
+			return nil, http.StatusBadRequest, errors.New(f.name + ": " + err.Error())
+		}
+	}
+	if req.Amount != "" {
+		var amount *big.Int
+		if amount, err = evm.ParseQuantity(req.Amount); err != nil {
+			return nil, http.StatusBadRequest, errors.New("amount must be a decimal or 0x hex integer")
+		}
+		r.Amount = amount
+	}
+	now := time.Now()
+	if r.Deadline == 0 {
+		r.Deadline = uint64(now.Add(permitDeadline).Unix())
+	}
+	if r.Expiration == 0 {
+		r.Expiration = uint64(now.Add(permitExpiration).Unix())
+	}
+	ep, ok := s.profileFor(ctx).store.Get(req.Endpoint)
+	if !ok {
+		return nil, http.StatusNotFound, errors.New("endpoint not found")
+	}
+	p, err := erc20.BuildPermit(ctx, ep, r)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	return p, 0, nil
+}
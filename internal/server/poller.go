@@ -0,0 +1,232 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/primal-host/wallet/internal/endpoint"
+)
+
+// pollerTick is how often the poller looks for endpoints due a check. Each
+// endpoint's poll interval decides whether it is asked.
+const pollerTick = time.Second
+
+// uptimeSaveInterval is how often the uptime history is written while it
+// changes.
+const uptimeSaveInterval = time.Minute
+
+// pollerIdle is how long a user's endpoint store is kept polled after its
+// statuses were last asked for. The server's store always is.
+const pollerIdle = 10 * time.Minute
+
+// poller polls every endpoint store in use in the background and keeps
+// their latest statuses, so /api/status answers from memory and push
+// clients hear of changes instead of asking again.
+type poller struct {
+	s    *Server
+	mu   sync.Mutex
+	seen map[*endpoint.Store]*storeStatus
+	wake chan struct{}
+}
+
+// storeStatus is the latest poll of one store.
+type storeStatus struct {
+	statuses []endpoint.Status
+	ready    chan struct{} // closed once the first poll is in
+	used     time.Time     // when its statuses were last asked for
+
+	picks map[uint64]chainPick // endpoint picked per chain ID by the chain route
+	marks map[uint64]headMark  // highest head the proxy reported per chain ID
+	heads map[string]headMark  // highest head each endpoint's results reported, by endpoint ID
+}
+
+func newPoller(s *Server) *poller {
+	p := &poller{
+		s:    s,
+		seen: map[*endpoint.Store]*storeStatus{},
+		wake: make(chan struct{}, 1),
+	}
+	p.track(s.store)
+	return p
+}
+
+// track starts polling store if it isn't polled already.
+func (p *poller) track(store *endpoint.Store) *storeStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ss, ok := p.seen[store]
+	if !ok {
+		ss = &storeStatus{ready: make(chan struct{})}
+		p.seen[store] = ss
+		select {
+		case p.wake <- struct{}{}:
+		default:
+		}
+	}
+	ss.used = time.Now()
+	return ss
+}
+
+// statuses returns store's latest statuses, waiting for its first poll if
+// it hasn't been polled yet. Endpoints added or edited since the last poll
+// are polled now, so a change shows up at once. It returns nil if ctx ends
+// first.
+func (p *poller) statuses(ctx context.Context, store *endpoint.Store) []endpoint.Status {
+	ss := p.track(store)
+	select {
+	case <-ss.ready:
+	case <-ctx.Done():
+		return nil
+	}
+	p.mu.Lock()
+	statuses := ss.statuses
+	p.mu.Unlock()
+	if !describes(statuses, store.List()) {
+		statuses = store.Poll(ctx)
+	}
+	return statuses
+}
+
+// describes reports whether statuses are of eps, in order and as they are
+// configured now.
+func describes(statuses []endpoint.Status, eps []endpoint.Endpoint) bool {
+	if len(statuses) != len(eps) {
+		return false
+	}
+	for i, st := range statuses {
+		ep := eps[i]
+		if st.ID != ep.ID || st.Name != ep.Name || st.URL != ep.URL || st.Asset != ep.Asset || !st.CheckedWithJWT(ep.JWTSecret) ||
+			st.Timeout != ep.Timeout || st.Proxy != ep.Proxy || st.PollInterval != ep.PollInterval ||
+			st.Consensus != ep.Consensus || st.Checkpoint != ep.Checkpoint || st.Private != ep.Private || st.StatusURL != ep.StatusURL ||
+			st.Confirmations != ep.Confirmations {
+			return false
+		}
+	}
+	return true
+}
+
+// status returns the latest status of the endpoint with the given ID in
+// store, if it has been polled.
+func (p *poller) status(store *endpoint.Store, id string) (endpoint.Status, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ss, ok := p.seen[store]; ok {
+		for _, st := range ss.statuses {
+			if st.ID == id {
+				return st, true
+			}
+		}
+	}
+	return endpoint.Status{}, false
+}
+
+// run polls until the server shuts down.
+func (p *poller) run() {
+	t := time.NewTicker(pollerTick)
+	defer t.Stop()
+	saved := time.Now()
+	for {
+		p.round()
+		if time.Since(saved) >= uptimeSaveInterval {
+			p.saveUptime()
+			saved = time.Now()
+		}
+		select {
+		case <-p.s.closing:
+			return
+		case <-t.C:
+		case <-p.wake:
+		}
+	}
+}
+
+func (p *poller) saveUptime() {
+	if err := p.s.uptime.Save(); err != nil {
+		slog.Warn("uptime history save failed", "subsystem", "endpoint", "error", err)
+	}
+}
+
+// round polls every tracked store at once, then stores each one's
+// statuses and tells the push channel what changed.
+func (p *poller) round() {
+	p.mu.Lock()
+	var stores []*endpoint.Store
+	for store, ss := range p.seen {
+		if store != p.s.store && time.Since(ss.used) > pollerIdle {
+			delete(p.seen, store)
+			delete(p.s.hub.heads, store)
+			continue
+		}
+		stores = append(stores, store)
+	}
+	p.mu.Unlock()
+	p.syncLight(stores)
+
+	polled := make([][]endpoint.Status, len(stores))
+	var wg sync.WaitGroup
+	for i, store := range stores {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			polled[i] = store.Poll(p.s.ctx)
+		}()
+	}
+	wg.Wait()
+	if p.s.ctx.Err() != nil {
+		return
+	}
+
+	for i, store := range stores {
+		p.mu.Lock()
+		ss, ok := p.seen[store]
+		if !ok {
+			p.mu.Unlock()
+			continue
+		}
+		old := ss.statuses
+		ss.statuses = polled[i]
+		select {
+		case <-ss.ready:
+		default:
+			close(ss.ready)
+		}
+		p.mu.Unlock()
+
+		if store == p.s.store {
+			for _, st := range polled[i] {
+				// An endpoint recovering answered, though it isn't shown
+				// online yet.
+				up := st.Online || st.Recovering > 0
+				p.s.uptime.Record(st.ID, st.CheckedAt, up, time.Duration(st.Latency)*time.Millisecond)
+			}
+			p.s.checkAlerts(polled[i])
+		}
+
+		changed, removed := statusChanges(old, polled[i])
+		if len(changed) > 0 || len(removed) > 0 {
+			p.s.hub.statusChanged(store, changed, removed)
+		}
+	}
+}
+
+// statusChanges returns the statuses in next that differ from or are
+// missing in prev, and the IDs of endpoints in prev no longer in next.
+func statusChanges(prev, next []endpoint.Status) (changed []endpoint.Status, removed []string) {
+	byID := make(map[string]endpoint.Status, len(prev))
+	for _, st := range prev {
+		byID[st.ID] = st
+	}
+	for _, st := range next {
+		if old, ok := byID[st.ID]; !ok || !reflect.DeepEqual(old, st) {
+			changed = append(changed, st)
+		}
+		delete(byID, st.ID)
+	}
+	for id := range byID {
+		removed = append(removed, id)
+	}
+	return changed, removed
+}
@@ -0,0 +1,253 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// privateTick is how often transactions sent to private endpoints are
+// checked.
+const privateTick = 12 * time.Second
+
+// privateWindow is how long a transaction sent to a private endpoint is
+// checked before it is given up on. Flashbots Protect drops one it can't
+// get included within 25 blocks.
+const privateWindow = time.Hour
+
+// privateLimit is how many transactions sent to private endpoints are
+// kept.
+const privateLimit = 200
+
+// privateTx is a transaction sent to a private endpoint and what its relay
+// last said of it.
+type privateTx struct {
+	Hash     string `json:"hash"`
+	Endpoint string `json:"endpoint"` // the private endpoint it went to
+	endpoint.PrivateStatus
+	Error     string     `json:"error,omitempty"` // why the last check failed, or why it was given up on
+	SentAt    time.Time  `json:"sent_at"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+
+	store  *endpoint.Store // the endpoints it was sent with
+	gaveUp bool
+}
+
+// privateTxs keeps transactions sent to private endpoints in memory; a
+// restart forgets them, and the journal follows their receipts as it does
+// any send.
+type privateTxs struct {
+	mu  sync.Mutex
+	txs []*privateTx // oldest first
+}
+
+// add starts tracking a transaction sent to ep, an endpoint of store.
+func (p *privateTxs) add(store *endpoint.Store, ep endpoint.Endpoint, hash string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.txs = append(p.txs, &privateTx{
+		Hash: hash, Endpoint: ep.ID, PrivateStatus: endpoint.PrivateStatus{Status: endpoint.PrivatePending},
+		SentAt: time.Now().UTC(), store: store,
+	})
+	if len(p.txs) > privateLimit {
+		p.txs = p.txs[len(p.txs)-privateLimit:]
+	}
+}
+
+// list returns the transactions sent with store's endpoints, newest first.
+func (p *privateTxs) list(store *endpoint.Store) []privateTx {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := []privateTx{}
+	for i := len(p.txs) - 1; i >= 0; i-- {
+		if p.txs[i].store == store {
+			out = append(out, *p.txs[i])
+		}
+	}
+	return out
+}
+
+// get returns the latest transaction with the given hash sent with store's
+// endpoints.
+func (p *privateTxs) get(store *endpoint.Store, hash string) (privateTx, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := len(p.txs) - 1; i >= 0; i-- {
+		if p.txs[i].store == store && strings.EqualFold(p.txs[i].Hash, hash) {
+			return *p.txs[i], true
+		}
+	}
+	return privateTx{}, false
+}
+
+// check asks the relays about the transactions still tracked and returns
+// those whose status changed or that were given up on.
+func (p *privateTxs) check(ctx context.Context) []privateTx {
+	p.mu.Lock()
+	var due []privateTx
+	for _, tx := range p.txs {
+		if !endpoint.PrivateDone(tx.Status) && !tx.gaveUp {
+			due = append(due, *tx)
+		}
+	}
+	p.mu.Unlock()
+
+	var changed []privateTx
+	for _, tx := range due {
+		checked := time.Now().UTC()
+		next := tx
+		next.CheckedAt = &checked
+		if ep, ok := tx.store.Get(tx.Endpoint); !ok {
+			next.Error = "endpoint not found"
+		} else if st, err := endpoint.ReadPrivateStatus(ctx, ep, tx.Hash); err != nil {
+			next.Error = err.Error()
+		} else {
+			next.PrivateStatus, next.Error = st, ""
+		}
+		if !endpoint.PrivateDone(next.Status) && checked.Sub(tx.SentAt) >= privateWindow {
+			next.gaveUp = true
+			next.Error = fmt.Sprintf("no outcome within %s", privateWindow)
+		}
+		p.mu.Lock()
+		for _, t := range p.txs {
+			if t.store == tx.store && t.Hash == tx.Hash {
+				*t = next
+			}
+		}
+		p.mu.Unlock()
+		if next.PrivateStatus != tx.PrivateStatus || next.gaveUp {
+			changed = append(changed, next)
+		}
+	}
+	return changed
+}
+
+// runPrivate checks transactions sent to private endpoints until the server
+// shuts down, and pushes each status change to the dashboards of the users
+// who sent them as a private_tx message.
+func (s *Server) runPrivate() {
+	t := time.NewTicker(privateTick)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.closing:
+			return
+		case <-t.C:
+		}
+		for _, tx := range s.private.check(s.ctx) {
+			switch {
+			case tx.gaveUp:
+				slog.Warn("private transaction given up on", "subsystem", "private", "endpoint", tx.Endpoint, "tx", tx.Hash, "status", tx.Status, "error", tx.Error)
+			case tx.Status == endpoint.PrivateFailed || tx.Status == endpoint.PrivateCancelled:
+				slog.Warn("private transaction "+tx.Status, "subsystem", "private", "endpoint", tx.Endpoint, "tx", tx.Hash)
+			default:
+				slog.Info("private transaction "+tx.Status, "subsystem", "private", "endpoint", tx.Endpoint, "tx", tx.Hash, "block", tx.Block)
+			}
+			s.hub.broadcastStore(tx.store, map[string]any{"type": "private_tx", "tx": tx})
+		}
+	}
+}
+
+// privateFor returns the endpoint of store to send privately what would go
+// to ep: ep itself if it is private, otherwise the private endpoint of ep's
+// chain that is online with the lowest latency. On failure it also returns
+// the HTTP status to answer with.
+func (s *Server) privateFor(ctx context.Context, store *endpoint.Store, ep endpoint.Endpoint) (endpoint.Endpoint, int, error) {
+	if ep.Private {
+		return ep, 0, nil
+	}
+	ctx, cancel := s.pollContext(ctx)
+	defer cancel()
+	statuses := s.poller.statuses(ctx, store)
+	var chainID string
+	for _, st := range statuses {
+		if st.ID == ep.ID {
+			chainID = st.ChainID
+		}
+	}
+	if chainID == "" {
+		return endpoint.Endpoint{}, http.StatusServiceUnavailable, fmt.Errorf("chain of %s not known yet", ep.Name)
+	}
+	var best *endpoint.Status
+	served := false
+	for i, st := range statuses {
+		if !st.Private || st.ChainID != chainID {
+			continue
+		}
+		served = true
+		if st.Online && (best == nil || st.Latency < best.Latency) {
+			best = &statuses[i]
+		}
+	}
+	chain := chainID
+	if n, err := evm.ParseQuantity(chainID); err == nil {
+		chain = n.String()
+	}
+	if best == nil {
+		if !served {
+			return endpoint.Endpoint{}, http.StatusBadRequest, fmt.Errorf("no private endpoint serves chain %s", chain)
+		}
+		return endpoint.Endpoint{}, http.StatusServiceUnavailable, fmt.Errorf("no private endpoint of chain %s is online", chain)
+	}
+	priv, ok := store.Get(best.ID)
+	if !ok {
+		return endpoint.Endpoint{}, http.StatusServiceUnavailable, fmt.Errorf("no private endpoint of chain %s is online", chain)
+	}
+	return priv, 0, nil
+}
+
+// sentPrivately starts tracking a transaction sent to ep, a private
+// endpoint of store.
+func (s *Server) sentPrivately(store *endpoint.Store, ep endpoint.Endpoint, hash string) {
+	slog.Info("transaction sent privately", "subsystem", "private", "endpoint", ep.ID, "tx", hash)
+	s.private.add(store, ep, hash)
+}
+
+// handleListPrivate returns the transactions sent to private endpoints,
+// newest first.
+func (s *Server) handleListPrivate(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.private.list(s.storeFor(c.Request().Context())))
+}
+
+// handleGetPrivate returns a transaction sent to a private endpoint as last
+// checked, or with ?endpoint=, asks that private endpoint about any
+// transaction now.
+func (s *Server) handleGetPrivate(c echo.Context) error {
+	hash := c.Param("hash")
+	if b, err := evm.DecodeHex(hash); err != nil || len(b) != 32 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid transaction hash"})
+	}
+	store := s.storeFor(c.Request().Context())
+	id := c.QueryParam("endpoint")
+	if id == "" {
+		tx, ok := s.private.get(store, hash)
+		if !ok {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "transaction not sent privately here; name its endpoint with ?endpoint="})
+		}
+		return c.JSON(http.StatusOK, tx)
+	}
+	ep, ok := store.Get(id)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "endpoint not found"})
+	}
+	if !ep.Private {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": ep.Name + " is not a private endpoint"})
+	}
+	ctx, cancel := s.pollContext(c.Request().Context())
+	defer cancel()
+	st, err := endpoint.ReadPrivateStatus(ctx, ep, hash)
+	if err != nil {
+		return s.rpcFailure(c, http.StatusBadGateway, err)
+	}
+	checked := time.Now().UTC()
+	return c.JSON(http.StatusOK, privateTx{Hash: hash, Endpoint: ep.ID, PrivateStatus: st, CheckedAt: &checked})
+}
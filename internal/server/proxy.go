@@ -0,0 +1,18 @@
+package server
+
+import "time"
+
+// Proxy configures the RPC proxy.
+type Proxy struct {
+	// CrossCheck asks a second endpoint of the same chain every state read
+	// and reports whether the answers agree, for untrusted public RPCs.
+	CrossCheck bool
+	// VerifyProofs checks balance and nonce reads, the proxy's and the
+	// dashboard's, with eth_getProof against the state root a second
+	// endpoint of the same chain has for the block.
+	VerifyProofs bool
+	// HedgeDelay is how long a read waits for its endpoint before it is
+	// sent to another endpoint of the same chain as well; zero turns
+	// hedging off.
+	HedgeDelay time.Duration
+}
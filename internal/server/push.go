@@ -0,0 +1,435 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/config"
+	"github.com/primal-host/wallet/internal/endpoint"
+	"golang.org/x/net/websocket"
+)
+
+// compareInterval is how often clients' compared endpoint pairs are
+// measured.
+const compareInterval = 5 * time.Second
+
+// pushCommand is a message from a client.
+type pushCommand struct {
+	Type      string   `json:"type"` // refresh, subscribe, watch_tx, compare
+	Endpoints []string `json:"endpoints,omitempty"`
+	Addresses []string `json:"addresses,omitempty"`
+	Endpoint  string   `json:"endpoint,omitempty"`
+	Hash      string   `json:"hash,omitempty"`
+}
+
+// pushHub pushes the poller's status changes, new blocks, subscribed
+// balances, watched transaction receipts, and endpoint comparisons to every
+// connected dashboard over WebSocket, so one poll serves all clients that
+// share an endpoint store.
+type pushHub struct {
+	s       *Server
+	mu      sync.Mutex
+	clients map[*pushClient]struct{}
+	heads   map[*endpoint.Store]map[string]string // endpoint ID -> last block number; poller goroutine only
+}
+
+type pushClient struct {
+	conn   *websocket.Conn
+	out    chan any
+	store  *endpoint.Store // the user's endpoints
+	shared bool            // gets the server profile's approvals, runs, and receipts
+
+	mu        sync.Mutex
+	closed    bool
+	endpoints map[string]bool   // subscribed for balances
+	addresses []string          // subscribed for balances
+	txs       map[string]string // watched tx hash -> endpoint ID
+	compare   []string          // endpoint pair to measure every tick; nil when not comparing
+}
+
+func newPushHub(s *Server) *pushHub {
+	return &pushHub{
+		s:       s,
+		clients: map[*pushClient]struct{}{},
+		heads:   map[*endpoint.Store]map[string]string{},
+	}
+}
+
+// handlePush upgrades to a WebSocket carrying push messages. Browsers may
+// only connect from the dashboard's own origin.
+func (s *Server) handlePush(c echo.Context) error {
+	store, shared := s.storeFor(c.Request().Context()), s.sharedFor(c.Request().Context())
+	ws := websocket.Server{
+		Handshake: func(cfg *websocket.Config, req *http.Request) error {
+			if origin := req.Header.Get("Origin"); origin != "" {
+				u, err := url.Parse(origin)
+				if err != nil || !strings.EqualFold(u.Host, req.Host) {
+					return websocket.ErrBadWebSocketOrigin
+				}
+			}
+			return nil
+		},
+		Handler: func(conn *websocket.Conn) { s.hub.serve(conn, store, shared) },
+	}
+	ws.ServeHTTP(c.Response(), c.Request())
+	return nil
+}
+
+func (h *pushHub) serve(conn *websocket.Conn, store *endpoint.Store, shared bool) {
+	cl := &pushClient{
+		conn:      conn,
+		out:       make(chan any, 32),
+		store:     store,
+		shared:    shared,
+		endpoints: map[string]bool{},
+		txs:       map[string]string{},
+	}
+	go cl.write()
+	h.mu.Lock()
+	h.clients[cl] = struct{}{}
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		delete(h.clients, cl)
+		h.mu.Unlock()
+		cl.close()
+	}()
+
+	// Send the status right away rather than on the next change.
+	go h.pushStatus(cl)
+	for {
+		var cmd pushCommand
+		if err := websocket.JSON.Receive(conn, &cmd); err != nil {
+			return
+		}
+		h.handle(cl, cmd)
+	}
+}
+
+func (h *pushHub) handle(cl *pushClient, cmd pushCommand) {
+	switch cmd.Type {
+	case "refresh":
+		go h.pushStatus(cl)
+	case "subscribe":
+		cl.mu.Lock()
+		cl.endpoints = map[string]bool{}
+		for _, id := range cmd.Endpoints {
+			cl.endpoints[id] = true
+		}
+		cl.addresses = cmd.Addresses
+		cl.mu.Unlock()
+		for _, id := range cmd.Endpoints {
+			if ep, ok := cl.store.Get(id); ok {
+				go h.pushBalances(ep, "", []*pushClient{cl}, cmd.Addresses)
+			}
+		}
+	case "watch_tx":
+		ep, ok := cl.store.Get(cmd.Endpoint)
+		if !ok || cmd.Hash == "" {
+			cl.push(map[string]string{"type": "error", "message": "watch_tx needs a known endpoint and a hash"})
+			return
+		}
+		cl.mu.Lock()
+		cl.txs[cmd.Hash] = ep.ID
+		cl.mu.Unlock()
+		go h.checkTx(ep, cl, cmd.Hash, "")
+	case "compare":
+		// An empty pair stops the comparison.
+		if len(cmd.Endpoints) != 0 && len(cmd.Endpoints) != 2 {
+			cl.push(map[string]string{"type": "error", "message": "compare needs two endpoints"})
+			return
+		}
+		cl.mu.Lock()
+		cl.compare = cmd.Endpoints
+		cl.mu.Unlock()
+		if len(cmd.Endpoints) == 2 {
+			go h.pushCompare(cl, cmd.Endpoints)
+		}
+	default:
+		cl.push(map[string]string{"type": "error", "message": "unknown command " + cmd.Type})
+	}
+}
+
+// pushStatus sends cl the latest status of its endpoint store.
+func (h *pushHub) pushStatus(cl *pushClient) {
+	statuses := h.s.poller.statuses(h.s.ctx, cl.store)
+	if statuses == nil {
+		return
+	}
+	cl.push(map[string]any{
+		"type":       "status",
+		"version":    config.Version,
+		"endpoints":  statuses,
+		"lock_epoch": h.s.currentLockEpoch(),
+	})
+}
+
+// run measures compared endpoint pairs until the server shuts down.
+func (h *pushHub) run() {
+	t := time.NewTicker(compareInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-h.s.closing:
+			for _, cl := range h.snapshot() {
+				cl.close()
+			}
+			return
+		case <-t.C:
+		}
+		for _, cl := range h.snapshot() {
+			// Connected clients keep their store polled.
+			h.s.poller.track(cl.store)
+			cl.mu.Lock()
+			pair := cl.compare
+			cl.mu.Unlock()
+			if len(pair) == 2 {
+				go h.pushCompare(cl, pair)
+			}
+		}
+	}
+}
+
+// statusChanged pushes the endpoints of store whose status changed, and
+// the IDs of those removed, to the clients using it, along with new
+// blocks. The poller calls it after each poll that changed anything.
+func (h *pushHub) statusChanged(store *endpoint.Store, changed []endpoint.Status, removed []string) {
+	var clients []*pushClient
+	for _, cl := range h.snapshot() {
+		if cl.store == store {
+			clients = append(clients, cl)
+		}
+	}
+	update := map[string]any{
+		"type":       "status_update",
+		"endpoints":  changed,
+		"lock_epoch": h.s.currentLockEpoch(),
+	}
+	if len(removed) > 0 {
+		update["removed"] = removed
+	}
+	for _, cl := range clients {
+		cl.push(update)
+	}
+
+	heads := h.heads[store]
+	if heads == nil {
+		heads = map[string]string{}
+		h.heads[store] = heads
+	}
+	for _, id := range removed {
+		delete(heads, id)
+	}
+	for _, st := range changed {
+		if !st.Online || st.BlockNumber == "" || heads[st.ID] == st.BlockNumber {
+			continue
+		}
+		heads[st.ID] = st.BlockNumber
+		for _, cl := range clients {
+			cl.push(map[string]string{"type": "block", "endpoint": st.ID, "block_number": st.BlockNumber})
+		}
+		if ep, ok := store.Get(st.ID); ok {
+			h.newHead(ep, st.BlockNumber, clients)
+		}
+	}
+}
+
+// pushCompare sends a fresh comparison of pair, or the reason it failed.
+func (h *pushHub) pushCompare(cl *pushClient, pair []string) {
+	metrics, err := compareEndpoints(h.s.ctx, cl.store, pair[0], pair[1])
+	if err != nil {
+		cl.push(map[string]string{"type": "compare", "error": err.Error()})
+		return
+	}
+	cl.push(map[string]any{"type": "compare", "endpoints": metrics})
+}
+
+// newHead refreshes subscribed balances and watched transactions on ep for
+// clients, which share ep's store.
+func (h *pushHub) newHead(ep endpoint.Endpoint, head string, clients []*pushClient) {
+	var subs []*pushClient
+	seen := map[string]bool{}
+	var addrs []string
+	for _, cl := range clients {
+		cl.mu.Lock()
+		if cl.endpoints[ep.ID] {
+			subs = append(subs, cl)
+			for _, a := range cl.addresses {
+				if !seen[strings.ToLower(a)] {
+					seen[strings.ToLower(a)] = true
+					addrs = append(addrs, a)
+				}
+			}
+		}
+		var hashes []string
+		for hash, id := range cl.txs {
+			if id == ep.ID {
+				hashes = append(hashes, hash)
+			}
+		}
+		cl.mu.Unlock()
+		for _, hash := range hashes {
+			go h.checkTx(ep, cl, hash, head)
+		}
+	}
+	if len(subs) > 0 {
+		go h.pushBalances(ep, head, subs, addrs)
+	}
+}
+
+// pushBalances looks addrs up once each and sends every subscriber the
+// balances it asked for. head is the block that prompted the lookup, or
+// empty for a new subscription.
+func (h *pushHub) pushBalances(ep endpoint.Endpoint, head string, subs []*pushClient, addrs []string) {
+	found := make([]*balance, len(addrs))
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+			found[i], _ = h.s.balanceAt(h.s.ctx, subs[0].store, ep, addr, "")
+		}(i, addr)
+	}
+	wg.Wait()
+	byAddr := map[string]*balance{}
+	for _, b := range found {
+		if b != nil {
+			byAddr[strings.ToLower(b.Address)] = b
+		}
+	}
+
+	for _, cl := range subs {
+		cl.mu.Lock()
+		wanted := cl.addresses
+		cl.mu.Unlock()
+		out := []*balance{}
+		for _, a := range wanted {
+			if b, ok := byAddr[strings.ToLower(a)]; ok {
+				out = append(out, b)
+			}
+		}
+		if len(out) == 0 {
+			continue
+		}
+		msg := map[string]any{"type": "balances", "endpoint": ep.ID, "balances": out}
+		if head != "" {
+			msg["block_number"] = head
+		}
+		cl.push(msg)
+	}
+}
+
+// checkTx reports a watched transaction's receipt, or that it is still
+// pending. head is ep's latest block, or empty to read it. A transaction
+// mined short of ep's confirmations is reported as mined with its depth,
+// and stops being watched once it is deep enough; one a reorg takes away
+// is pending again.
+func (h *pushHub) checkTx(ep endpoint.Endpoint, cl *pushClient, hash, head string) {
+	receipt, err := endpoint.ReadReceipt(h.s.ctx, ep, hash)
+	if err != nil {
+		return
+	}
+	msg := map[string]any{"type": "tx", "endpoint": ep.ID, "hash": hash, "status": "pending"}
+	if receipt != nil {
+		msg["block_number"] = receipt.BlockNumber
+		need := ep.ConfirmDepth()
+		depth := uint64(1)
+		if need > 1 {
+			if head == "" {
+				if head, err = endpoint.ReadHead(h.s.ctx, ep); err != nil {
+					return
+				}
+			}
+			depth = endpoint.Depth(receipt.BlockNumber, head)
+		}
+		if depth < need {
+			msg["status"] = "mined"
+			msg["confirmations"] = depth
+			msg["confirmations_required"] = need
+		} else {
+			msg["status"] = "confirmed"
+			if receipt.Status == "0x0" {
+				msg["status"] = "failed"
+			}
+			cl.mu.Lock()
+			delete(cl.txs, hash)
+			cl.mu.Unlock()
+		}
+	}
+	cl.push(msg)
+}
+
+func (h *pushHub) snapshot() []*pushClient {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]*pushClient, 0, len(h.clients))
+	for cl := range h.clients {
+		out = append(out, cl)
+	}
+	return out
+}
+
+func (h *pushHub) broadcast(msg any) {
+	for _, cl := range h.snapshot() {
+		cl.push(msg)
+	}
+}
+
+// broadcastShared pushes msg to the clients of users working in the server
+// profile, who alone see its approvals, schedule runs, and sends.
+func (h *pushHub) broadcastShared(msg any) {
+	for _, cl := range h.snapshot() {
+		if cl.shared {
+			cl.push(msg)
+		}
+	}
+}
+
+// broadcastStore pushes msg to the clients of users working with store's
+// endpoints.
+func (h *pushHub) broadcastStore(store *endpoint.Store, msg any) {
+	for _, cl := range h.snapshot() {
+		if cl.store == store {
+			cl.push(msg)
+		}
+	}
+}
+
+// push queues msg for the client. A client too slow to drain its queue is
+// disconnected; the dashboard reconnects and gets a fresh status.
+func (cl *pushClient) push(msg any) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.closed {
+		return
+	}
+	select {
+	case cl.out <- msg:
+	default:
+		cl.closed = true
+		close(cl.out)
+	}
+}
+
+func (cl *pushClient) close() {
+	cl.mu.Lock()
+	if !cl.closed {
+		cl.closed = true
+		close(cl.out)
+	}
+	cl.mu.Unlock()
+	cl.conn.Close()
+}
+
+func (cl *pushClient) write() {
+	for msg := range cl.out {
+		if err := websocket.JSON.Send(cl.conn, msg); err != nil {
+			break
+		}
+	}
+	cl.conn.Close()
+}
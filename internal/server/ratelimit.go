@@ -0,0 +1,82 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/ratelimit"
+	"github.com/primal-host/wallet/internal/user"
+)
+
+// Limits are the server's rate limits. A nil limiter doesn't limit.
+type Limits struct {
+	RPC   *ratelimit.Limiter // the RPC proxy, GraphQL, comparisons, and benchmarks, which reach upstream nodes
+	Write *ratelimit.Limiter // every other state-changing request
+}
+
+// rateLimit refuses requests over their class's limit with 429 and a
+// Retry-After header. Requests with an API token are counted per token,
+// others per client IP. Reads that don't reach upstream nodes aren't
+// limited.
+func (s *Server) rateLimit(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var (
+			limiter *ratelimit.Limiter
+			class   string
+		)
+		path, method := c.Path(), c.Request().Method
+		switch {
+		case strings.HasPrefix(path, "/api/rpc/") || path == "/graphql" || path == "/api/compare",
+			path == "/api/endpoints/:id/bench" && method == http.MethodPost:
+			limiter, class = s.limits.RPC, "rpc"
+		case method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions:
+			return next(c)
+		default:
+			limiter, class = s.limits.Write, "write"
+		}
+		key := s.rateKey(c)
+		ok, wait, first := limiter.Allow(key)
+		if ok {
+			return next(c)
+		}
+		if first {
+			slog.Warn("rate limited", "subsystem", "ratelimit", "class", class, "client", key)
+		}
+		secs := int(math.Ceil(wait.Seconds()))
+		c.Response().Header().Set("Retry-After", strconv.Itoa(secs))
+		return c.JSON(http.StatusTooManyRequests, map[string]string{"error": fmt.Sprintf("rate limit exceeded; retry in %ds", secs)})
+	}
+}
+
+// rateKey names the client a request is counted against. A token is only
+// counted on its own once it checks out, so made-up tokens can't each get a
+// fresh bucket; others count against the client IP. Tokens are named by
+// the start of their hash, which matches tokens.json.
+func (s *Server) rateKey(c echo.Context) string {
+	if secret, ok := strings.CutPrefix(c.Request().Header.Get("Authorization"), "Bearer "+user.TokenPrefix); ok && s.validToken(user.TokenPrefix+secret) {
+		sum := sha256.Sum256([]byte(user.TokenPrefix + secret))
+		return "token " + hex.EncodeToString(sum[:8])
+	}
+	return c.RealIP()
+}
+
+// handleMetrics reports the rate limiters' counters, the RPC proxy's
+// hedging, and RPC retries.
+func (s *Server) handleMetrics(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]any{
+		"rate_limits": map[string]ratelimit.Stats{
+			"rpc":   s.limits.RPC.Stats(),
+			"write": s.limits.Write.Stats(),
+		},
+		"hedges":  endpoint.Hedges(),
+		"retries": endpoint.Retries(),
+	})
+}
@@ -0,0 +1,148 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/primal-host/wallet/internal/approval"
+	"github.com/primal-host/wallet/internal/journal"
+	"github.com/primal-host/wallet/internal/notify"
+	"github.com/primal-host/wallet/internal/txbuild"
+)
+
+// receiptTick is how often sent transactions are checked for receipts.
+const receiptTick = 15 * time.Second
+
+// recoverWork resumes what a crash or restart interrupted, driven by the send
+// journal: it settles interrupted sends, tells approvals that were sending
+// how they ended, and then polls receipts for sent transactions, including
+// those sent before the restart, until the server shuts down. Missed
+// schedule runs are handled by runSchedules.
+func (s *Server) recoverWork() {
+	resolved, err := s.journal.Reconcile(s.ctx, s.store.Get)
+	if err != nil {
+		slog.Error("journal save failed", "subsystem", "journal", "error", err)
+	}
+	for _, in := range resolved {
+		slog.Warn("interrupted send reconciled", "subsystem", "journal", "intent", in.ID, "origin", in.Origin, "stage", in.Stage, "hash", in.Hash, "reason", in.Error)
+	}
+	s.recoverApprovals()
+	s.runReceipts()
+}
+
+// recoverApprovals finds the journal intent of each approval that was
+// sending when the server stopped and records whether it went out.
+func (s *Server) recoverApprovals() {
+	intents := s.journal.List("")
+	for _, r := range s.approvals.List(approval.StatusFailed) {
+		if r.Error != approval.Interrupted || r.Envelope == nil {
+			continue
+		}
+		in, ok := intentFor(intents, "approval", r.Envelope)
+		if !ok || in.Stage == journal.StagePrepared || in.Stage == journal.StageSigned {
+			continue
+		}
+		var signed *txbuild.Signed
+		var sendErr error
+		if in.Stage == journal.StageFailed {
+			sendErr = errors.New(in.Error)
+		} else {
+			signed = &txbuild.Signed{Hash: in.Hash, Raw: in.Raw, From: in.From}
+		}
+		done, err := s.approvals.Finish(r.ID, signed, sendErr)
+		if err != nil {
+			slog.Error("approval save failed", "subsystem", "approval", "approval", r.ID, "error", err)
+			continue
+		}
+		slog.Info("interrupted approval recovered", "subsystem", "approval", "approval", r.ID, "status", done.Status, "intent", in.ID)
+		s.approvalChanged(done.Status, done)
+	}
+}
+
+// intentFor finds the newest intent from origin for env's sender, nonce,
+// and endpoint. intents are newest first.
+func intentFor(intents []journal.Intent, origin string, env *txbuild.Envelope) (journal.Intent, bool) {
+	for _, in := range intents {
+		if in.Origin == origin && in.Endpoint == env.Endpoint && in.Nonce == env.Tx.Nonce && strings.EqualFold(in.From, env.From) {
+			return in, true
+		}
+	}
+	return journal.Intent{}, false
+}
+
+// runReceipts records the receipts of sent transactions until the server
+// shuts down, and pushes each change to the server profile's dashboards as
+// a tx message: mined while short of its endpoint's confirmations, then
+// confirmed or failed, or reorged when its block was taken away.
+func (s *Server) runReceipts() {
+	t := time.NewTicker(receiptTick)
+	defer t.Stop()
+	for {
+		changed, err := s.journal.CheckReceipts(s.store.Get)
+		if err != nil {
+			slog.Error("journal save failed", "subsystem", "journal", "error", err)
+		}
+		for _, in := range changed {
+			msg := map[string]any{"type": "tx", "endpoint": in.Endpoint, "hash": in.Hash, "block_number": in.Block}
+			switch in.Stage {
+			case journal.StageSent:
+				slog.Warn("sent transaction reorged out", "subsystem", "journal", "intent", in.ID, "origin", in.Origin, "tx", in.Hash, "reorgs", in.Reorgs)
+				msg["status"] = "reorged"
+			case journal.StageMined:
+				slog.Info("sent transaction mined", "subsystem", "journal", "intent", in.ID, "origin", in.Origin, "tx", in.Hash, "block", in.Block, "reorgs", in.Reorgs)
+				msg["status"] = "mined"
+				if ep, ok := s.store.Get(in.Endpoint); ok {
+					msg["confirmations_required"] = ep.ConfirmDepth()
+				}
+			default:
+				slog.Info("sent transaction "+in.Stage, "subsystem", "journal", "intent", in.ID, "origin", in.Origin, "tx", in.Hash, "block", in.Block, "reorgs", in.Reorgs)
+				msg["status"] = "confirmed"
+				if in.Stage == journal.StageReverted {
+					msg["status"] = "failed"
+				}
+			}
+			s.hub.broadcastShared(msg)
+			if in.Stage != journal.StageMined {
+				s.deliver(txNotification(in, s.endpointName(in.Endpoint)))
+			}
+		}
+		select {
+		case <-s.closing:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// txNotification tells of a journaled send confirming, reverting, or being
+// reorged out, for delivery off the server; dashboards already hear of it
+// as a tx message.
+func txNotification(in journal.Intent, endpoint string) notify.Notification {
+	hash := in.Hash
+	if len(hash) > 14 {
+		hash = hash[:10] + "…" + hash[len(hash)-4:]
+	}
+	msg := "Transaction " + hash + " on " + endpoint
+	switch in.Stage {
+	case journal.StageSent:
+		msg += " was reorged out; waiting for it to be mined again"
+	case journal.StageReverted:
+		msg += " failed (reverted)"
+	default:
+		msg += " confirmed"
+	}
+	return notify.Notification{Kind: notify.KindTx, Message: msg}
+}
+
+// endpointName returns the name of one of the server's endpoints, or its ID
+// if it is gone.
+func (s *Server) endpointName(id string) string {
+	if ep, ok := s.store.Get(id); ok && ep.Name != "" {
+		return ep.Name
+	}
+	return id
+}
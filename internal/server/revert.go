@@ -0,0 +1,40 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/abi"
+	"github.com/primal-host/wallet/internal/endpoint"
+)
+
+// revertOf decodes the revert behind err, if a node reported one, against
+// the built-in errors and the registered ABIs' custom errors.
+func (s *Server) revertOf(err error) (*abi.Revert, bool) {
+	var rpcErr *endpoint.RPCError
+	if !errors.As(err, &rpcErr) {
+		return nil, false
+	}
+	data, ok := rpcErr.RevertData()
+	if !ok {
+		return nil, false
+	}
+	r := abi.DecodeRevert(data, rpcErr.Message, s.customErrors())
+	return &r, true
+}
+
+// rpcFailure writes a failed simulation, broadcast or RPC call. A revert
+// gets a readable reason as its error and the decoded details under
+// "revert"; anything else is passed on as it is.
+func (s *Server) rpcFailure(c echo.Context, status int, err error) error {
+	return c.JSON(status, s.rpcErrorBody(err))
+}
+
+// rpcErrorBody is the JSON rpcFailure writes for err.
+func (s *Server) rpcErrorBody(err error) map[string]any {
+	r, ok := s.revertOf(err)
+	if !ok {
+		return map[string]any{"error": err.Error()}
+	}
+	return map[string]any{"error": "execution reverted: " + r.Reason, "revert": r}
+}
@@ -0,0 +1,64 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/primal-host/wallet/internal/txbuild"
+)
+
+// errRiskBlocked is returned when RISK_BLOCK_CRITICAL is set and a
+// transaction has a critical warning.
+var errRiskBlocked = errors.New("refused: critical risk warning")
+
+// txWarnings runs the address checks and the risk scanner on env. A
+// scanner that fails or doesn't answer adds a warning rather than holding
+// up the send.
+func (s *Server) txWarnings(ctx context.Context, env *txbuild.Envelope) []txbuild.Warning {
+	warnings := s.addressWarnings(ctx, env)
+	if s.scanner == nil {
+		return warnings
+	}
+	found, err := s.scanner.Scan(ctx, env)
+	if err != nil {
+		slog.Warn("risk scan failed", "subsystem", "risk", "from", env.From, "error", err)
+		return append(warnings, txbuild.Warning{Kind: "risk_scan_failed", Severity: txbuild.SeverityWarning, Message: "The risk scanner couldn't check this transaction."})
+	}
+	return append(warnings, found...)
+}
+
+// checkWarnings sets env's warnings and labels, and marks it blocked when
+// the server will refuse it.
+func (s *Server) checkWarnings(ctx context.Context, env *txbuild.Envelope) {
+	env.Warnings = s.txWarnings(ctx, env)
+	env.Blocked = s.riskBlock && critical(env.Warnings) != nil
+	env.Labels = s.envelopeLabels(ctx, env)
+}
+
+// riskCheck checks env again before it is signed or broadcast and returns
+// errRiskBlocked for a critical warning when RISK_BLOCK_CRITICAL is set.
+// Warnings the client sent are not trusted.
+func (s *Server) riskCheck(ctx context.Context, env *txbuild.Envelope) error {
+	if !s.riskBlock {
+		return nil
+	}
+	if w := critical(s.txWarnings(ctx, env)); w != nil {
+		slog.Warn("transaction refused", "subsystem", "risk", "from", env.From, "to", env.Tx.To, "kind", w.Kind)
+		return fmt.Errorf("%w: %s", errRiskBlocked, w.Message)
+	}
+	return nil
+}
+
+// critical returns the first critical warning, or nil.
+func critical(warnings []txbuild.Warning) *txbuild.Warning {
+	for i := range warnings {
+		if warnings[i].Severity == txbuild.SeverityCritical {
+			return &warnings[i]
+		}
+	}
+	return nil
+}
@@ -1,23 +1,54 @@
 package server
 
 import (
+	"bytes"
+	_ "embed"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/labstack/echo/v4"
 	"github.com/primal-host/wallet/internal/config"
 	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+	"github.com/primal-host/wallet/internal/lightclient"
+	"github.com/primal-host/wallet/internal/txbuild"
 )
 
 func (s *Server) routes() {
 	s.echo.GET("/health", s.handleHealth)
 	s.echo.GET("/", s.handleDashboard)
+	s.echo.GET("/static/ethers.umd.min.js", s.handleEthers)
+	s.echo.GET("/static/vanity-worker.js", s.handleVanityWorker)
+	s.echo.GET("/api/openapi.json", s.handleOpenAPI)
 	s.echo.GET("/api/status", s.handleStatus)
+	s.echo.GET("/api/compare", s.handleCompare)
+	s.echo.GET("/api/endpoints/:id/uptime", s.handleUptime)
+	s.echo.GET("/api/endpoints/:id/bench", s.handleBench)
+	s.echo.POST("/api/endpoints/:id/bench", s.handleRunBench)
+	s.echo.GET("/api/endpoints/:id/light-client", s.handleLightClient)
+	s.echo.GET("/api/endpoints/:id/txpool", s.handleTxPool)
+	s.echo.GET("/api/assets", s.handleListAssets)
+	s.echo.GET("/api/icons/chain/:chain", s.handleChainIcon)
+	s.echo.GET("/api/icons/asset/:id", s.handleAssetIcon)
+	s.echo.GET("/api/icons/token/:chain/:address", s.handleTokenIcon)
 	s.echo.POST("/api/rpc/:id", s.handleRPC)
-	s.echo.POST("/api/endpoints", s.handleAddEndpoint)
-	s.echo.PUT("/api/endpoints/:id", s.handleUpdateEndpoint)
-	s.echo.DELETE("/api/endpoints/:id", s.handleDeleteEndpoint)
+	s.echo.POST("/api/rpc/chain/:chain", s.handleChainRPC)
+	s.echo.POST("/api/broadcast", s.idempotent(s.handleBroadcast))
+	s.echo.GET("/api/private", s.handleListPrivate)
+	s.echo.GET("/api/private/:hash", s.handleGetPrivate)
+	s.echo.GET("/graphql", s.handleGraphQL)
+	s.echo.POST("/graphql", s.handleGraphQL)
+	s.echo.GET("/api/ws", s.handlePush)
+	s.echo.GET("/api/metrics", s.handleMetrics)
+	if s.logs != nil {
+		s.echo.GET("/api/logs", s.handleLogs)
+		s.echo.GET("/api/logs/stream", s.handleLogStream)
+	}
 }
 
 func (s *Server) handleHealth(c echo.Context) error {
@@ -28,92 +59,292 @@ func (s *Server) handleHealth(c echo.Context) error {
 }
 
 func (s *Server) handleDashboard(c echo.Context) error {
-	html := strings.ReplaceAll(dashboardHTML, "{{VERSION}}", config.Version)
+	token, err := csrfToken(c)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	html := strings.NewReplacer(
+		"{{VERSION}}", config.Version,
+		"{{BROADCAST_ONLY}}", strconv.FormatBool(broadcastOnly),
+		"{{CSRF_TOKEN}}", token,
+		"{{ETHERS_SRI}}", ethersSRI,
+	).Replace(dashboardHTML)
+	// The page carries the CSRF token, so it mustn't outlive its cookie.
+	c.Response().Header().Set("Cache-Control", "no-store")
+	s.setCSP(c, s.dashboardCSP(c.Request().Host)...)
 	return c.HTML(http.StatusOK, html)
 }
 
-// handleStatus polls all endpoints and returns their live status.
+//go:embed openapi.json
+var openapiSpec []byte
+
+// handleOpenAPI serves the API description, trimmed to the routes this build
+// actually registers.
+func (s *Server) handleOpenAPI(c echo.Context) error {
+	var spec struct {
+		OpenAPI    string                                `json:"openapi"`
+		Info       map[string]any                        `json:"info"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components json.RawMessage                       `json:"components"`
+	}
+	if err := json.Unmarshal(openapiSpec, &spec); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	spec.Info["version"] = config.Version
+
+	registered := map[string]bool{}
+	for _, r := range s.echo.Routes() {
+		registered[strings.ToLower(r.Method)+" "+openapiPath(r.Path)] = true
+	}
+	for path, ops := range spec.Paths {
+		for method := range ops {
+			if !registered[method+" "+path] {
+				delete(ops, method)
+			}
+		}
+		if len(ops) == 0 {
+			delete(spec.Paths, path)
+		}
+	}
+	return c.JSON(http.StatusOK, spec)
+}
+
+// openapiPath converts Echo's ":param" segments to OpenAPI's "{param}".
+func openapiPath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		if strings.HasPrefix(p, ":") {
+			parts[i] = "{" + p[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// handleStatus returns every endpoint's latest status from the background
+// poller, waiting only for a store's first poll.
 func (s *Server) handleStatus(c echo.Context) error {
-	statuses := s.store.Poll()
+	ctx, cancel := s.pollContext(c.Request().Context())
+	defer cancel()
+	statuses := s.poller.statuses(ctx, s.storeFor(ctx))
+	if statuses == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "status not polled yet"})
+	}
 	return c.JSON(http.StatusOK, map[string]any{
-		"version":   config.Version,
-		"endpoints": statuses,
+		"version":    config.Version,
+		"endpoints":  statuses,
+		"lock_epoch": s.currentLockEpoch(),
 	})
 }
 
-// handleRPC proxies a JSON-RPC request to the named endpoint.
+// handleListAssets returns the asset registry.
+func (s *Server) handleListAssets(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.store.Assets().List())
+}
+
+// maxProxyBatch is the most calls the proxy takes in one batch. The rate
+// limiter counts a batch as one request, so its size is bounded.
+const maxProxyBatch = 100
+
+// handleRPC proxies a JSON-RPC request, or a batch of them, to the named
+// endpoint.
 func (s *Server) handleRPC(c echo.Context) error {
 	id := c.Param("id")
 
-	// Find the endpoint.
-	var target *endpoint.Endpoint
-	for _, ep := range s.store.List() {
-		if ep.ID == id {
-			ep := ep
-			target = &ep
-			break
-		}
-	}
-	if target == nil {
+	target, ok := s.storeFor(c.Request().Context()).Get(id)
+	if !ok {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "endpoint not found"})
 	}
+	return s.proxyRPC(c, target)
+}
 
+// proxyRPC forwards the request's JSON-RPC call, or batch of them, to
+// target.
+func (s *Server) proxyRPC(c echo.Context, target endpoint.Endpoint) error {
 	// Parse the incoming JSON-RPC request.
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if body = bytes.TrimSpace(body); len(body) > 0 && body[0] == '[' {
+		return s.handleRPCBatch(c, target, body)
+	}
 	var req struct {
 		Method string `json:"method"`
 		Params []any  `json:"params"`
 	}
-	if err := c.Bind(&req); err != nil {
+	if err := json.Unmarshal(body, &req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
 	}
+	if err := s.rpcAllowed(c.Request().Context(), req.Method); err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
+
+	if caps, ok := endpoint.Cached(target); ok && caps.Unserved(req.Method) {
+		return c.JSON(http.StatusNotImplemented, map[string]string{"error": target.Name + " does not serve " + req.Method})
+	}
 
-	result, err := endpoint.RPCCall(target.URL, req.Method, req.Params)
+	// Calls to a light client endpoint are verified against the headers it
+	// follows where they can be. Otherwise, queries for state target no
+	// longer keeps go to an archive endpoint of the same chain. With proof
+	// verification, balance and nonce reads are checked against a second
+	// endpoint's state root; with cross-checking, state reads go to a
+	// second endpoint of the chain too; with hedging, reads target is slow
+	// to answer do.
+	ctx := c.Request().Context()
+	store := s.storeFor(ctx)
+	var (
+		result   json.RawMessage
+		servedBy endpoint.Endpoint
+		check    *endpoint.CrossCheck
+		proof    *endpoint.ProofCheck
+		light    *lightclient.Check
+	)
+	switch {
+	case target.Consensus != "":
+		var lc lightclient.Check
+		result, lc, err = s.lights.client(target).Call(ctx, target, req.Method, req.Params)
+		if errors.Is(err, lightclient.ErrNotSynced) {
+			return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		}
+		servedBy, light = target, &lc
+	case s.proxy.VerifyProofs && endpoint.Provable(req.Method):
+		result, servedBy, proof, err = store.Proven(ctx, target, req.Method, req.Params)
+	case s.proxy.CrossCheck && endpoint.CrossCheckable(req.Method):
+		result, servedBy, check, err = store.CrossChecked(ctx, target, req.Method, req.Params)
+	case s.proxy.HedgeDelay > 0:
+		result, servedBy, err = store.Hedged(ctx, target, req.Method, req.Params, s.proxy.HedgeDelay)
+	default:
+		result, servedBy, err = store.Historical(ctx, target, req.Method, req.Params)
+	}
 	if err != nil {
-		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return s.rpcFailure(c, http.StatusBadGateway, err)
+	}
+
+	// A result reporting a head below one already reported for the chain,
+	// or a read of the latest state from an endpoint known to be behind
+	// it, is asked of its other endpoints instead, so the head never goes
+	// backwards when calls move between them.
+	if g := s.poller.guard(store, target); g != nil && !g.check(servedBy.ID, req.Method, req.Params, result) {
+		result, servedBy, err = g.retry(ctx, req.Method, req.Params, target.ID, servedBy.ID)
+		if err != nil {
+			return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		}
+		check, light = nil, nil
 	}
 
 	// Return the raw result so the frontend can handle it.
-	return c.JSON(http.StatusOK, map[string]json.RawMessage{"result": result})
+	out := map[string]any{"result": result}
+	if servedBy.ID != target.ID {
+		out["served_by"] = servedBy.ID
+	}
+	if check != nil {
+		out["cross_check"] = check
+	}
+	if proof != nil {
+		out["proof"] = proof
+	}
+	if light != nil {
+		out["light_client"] = light
+	}
+	return c.JSON(http.StatusOK, out)
 }
 
-// handleAddEndpoint creates a new endpoint.
-func (s *Server) handleAddEndpoint(c echo.Context) error {
-	var req endpoint.Endpoint
-	if err := c.Bind(&req); err != nil {
+// handleRPCBatch forwards a batch of JSON-RPC calls to target in one
+// upstream request and answers with one object per call, in order: a
+// result, or an error like a single call's. Calls the caller may not send,
+// or that target is known not to serve, are answered without being
+// forwarded. Batches go to target alone, without archive routing,
+// cross-checking, hedging, or light client verification, so a call
+// reporting a head behind one already reported, or reading the latest
+// state while target is known to be behind it, gets an error instead of
+// being asked elsewhere.
+func (s *Server) handleRPCBatch(c echo.Context, target endpoint.Endpoint, body []byte) error {
+	var calls []endpoint.Call
+	if err := json.Unmarshal(body, &calls); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
 	}
-	ep, err := s.store.Add(req)
-	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	if len(calls) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "empty batch"})
+	}
+	if len(calls) > maxProxyBatch {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("batch of %d calls exceeds the limit of %d", len(calls), maxProxyBatch)})
 	}
-	return c.JSON(http.StatusCreated, ep)
-}
 
-// handleUpdateEndpoint updates an existing endpoint.
-func (s *Server) handleUpdateEndpoint(c echo.Context) error {
-	id := c.Param("id")
-	var req endpoint.Endpoint
-	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	ctx := c.Request().Context()
+	out := make([]map[string]any, len(calls))
+	var (
+		forward []endpoint.Call
+		index   []int // position in calls of each forwarded call
+	)
+	caps, probed := endpoint.Cached(target)
+	for i, call := range calls {
+		if err := s.rpcAllowed(ctx, call.Method); err != nil {
+			out[i] = map[string]any{"error": err.Error()}
+			continue
+		}
+		if probed && caps.Unserved(call.Method) {
+			out[i] = map[string]any{"error": target.Name + " does not serve " + call.Method}
+			continue
+		}
+		forward = append(forward, call)
+		index = append(index, i)
 	}
-	ep, err := s.store.Update(id, req)
-	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+
+	if len(forward) > 0 {
+		replies, err := endpoint.RPCBatch(ctx, target, forward)
+		if err != nil {
+			return s.rpcFailure(c, http.StatusBadGateway, err)
+		}
+		g := s.poller.guard(s.storeFor(ctx), target)
+		for j, r := range replies {
+			switch {
+			case r.Err != nil:
+				out[index[j]] = s.rpcErrorBody(r.Err)
+			case g != nil && !g.check(target.ID, forward[j].Method, forward[j].Params, r.Result):
+				out[index[j]] = map[string]any{"error": fmt.Sprintf("%s is behind block %d, already reported", target.Name, g.mark())}
+			default:
+				out[index[j]] = map[string]any{"result": r.Result}
+			}
 		}
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
-	return c.JSON(http.StatusOK, ep)
+	return c.JSON(http.StatusOK, out)
 }
 
-// handleDeleteEndpoint removes an endpoint.
-func (s *Server) handleDeleteEndpoint(c echo.Context) error {
-	id := c.Param("id")
-	if err := s.store.Delete(id); err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+// handleBroadcast sends an already-signed raw transaction to the named
+// endpoint, or with "private", to a private endpoint of its chain, which
+// keeps it out of the public mempool. It is the only way to submit a
+// transaction in broadcast-only builds.
+func (s *Server) handleBroadcast(c echo.Context) error {
+	var req struct {
+		Endpoint string `json:"endpoint"`
+		Raw      string `json:"raw"`
+		Private  bool   `json:"private"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if b, err := evm.DecodeHex(strings.TrimSpace(req.Raw)); err != nil || len(b) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "raw must be a hex-encoded signed transaction"})
+	}
+	store := s.storeFor(c.Request().Context())
+	ep, ok := store.Get(req.Endpoint)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "endpoint not found"})
+	}
+	if req.Private {
+		var status int
+		var err error
+		if ep, status, err = s.privateFor(c.Request().Context(), store, ep); err != nil {
+			return c.JSON(status, map[string]string{"error": err.Error()})
 		}
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
-	return c.JSON(http.StatusOK, map[string]string{"status": "deleted"})
+	hash, err := txbuild.Broadcast(c.Request().Context(), ep, strings.TrimSpace(req.Raw))
+	if err != nil {
+		return s.rpcFailure(c, http.StatusBadGateway, err)
+	}
+	if ep.Private {
+		s.sentPrivately(store, ep, hash)
+		return c.JSON(http.StatusOK, map[string]string{"hash": hash, "private_endpoint": ep.ID})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"hash": hash})
 }
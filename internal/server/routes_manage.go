@@ -0,0 +1,842 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/asset"
+	"github.com/primal-host/wallet/internal/deeplink"
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+	"github.com/primal-host/wallet/internal/schedule"
+	"github.com/primal-host/wallet/internal/signer"
+	"github.com/primal-host/wallet/internal/txbuild"
+	"github.com/primal-host/wallet/internal/vault"
+)
+
+// manageRoutes registers endpoint, account, vault, and transaction
+// management. Broadcast-only builds leave all of it out.
+func (s *Server) manageRoutes() {
+	s.echo.POST("/api/lock", s.handlePanicLock)
+	s.echo.POST("/api/endpoints", s.handleAddEndpoint)
+	s.echo.PUT("/api/endpoints/:id", s.handleUpdateEndpoint)
+	s.echo.DELETE("/api/endpoints/:id", s.handleDeleteEndpoint)
+	s.echo.POST("/api/endpoints/:id/restore", s.handleRestoreEndpoint)
+	s.echo.GET("/api/endpoints/:id/jwt-secret", s.handleEndpointJWTSecret)
+	s.echo.POST("/api/assets", s.handleAddAsset)
+	s.echo.PUT("/api/assets/:id", s.handleUpdateAsset)
+	s.echo.DELETE("/api/assets/:id", s.handleDeleteAsset)
+	s.echo.POST("/api/tx/build", s.handleBuildTx)
+	s.echo.POST("/api/tx/ur", s.handleTxUR)
+	s.echo.POST("/api/tx/ur/signature", s.handleTxURSignature)
+	s.echo.POST("/api/tx/import", s.idempotent(s.handleImportTx))
+	s.echo.POST("/api/tx/sign", s.idempotent(s.handleSignTx))
+	s.echo.GET("/api/tx/:hash/internal", s.handleInternalTransfers)
+	s.echo.GET("/api/journal", s.handleJournal)
+	s.echo.GET("/api/history/export", s.handleExportHistory)
+	s.echo.GET("/api/verify", s.handleVerify)
+	s.echo.GET("/api/deeplink", s.handleDeepLink)
+	s.echo.GET("/api/accounts", s.handleListAccounts)
+	s.echo.POST("/api/accounts", s.handleAddAccount)
+	s.echo.PUT("/api/accounts/:address", s.handleRenameAccount)
+	s.echo.DELETE("/api/accounts/:address", s.handleDeleteAccount)
+	s.echo.POST("/api/accounts/:address/restore", s.handleRestoreAccount)
+	s.echo.GET("/api/bookmarks", s.handleListBookmarks)
+	s.echo.POST("/api/bookmarks", s.handleAddBookmark)
+	s.echo.PUT("/api/bookmarks/:id", s.handleUpdateBookmark)
+	s.echo.DELETE("/api/bookmarks/:id", s.handleDeleteBookmark)
+	s.echo.POST("/api/bookmarks/:id/restore", s.handleRestoreBookmark)
+	s.echo.GET("/api/trash", s.handleTrash)
+	s.echo.DELETE("/api/trash/endpoints/:id", s.handlePurgeEndpoint)
+	s.echo.DELETE("/api/trash/accounts/:address", s.handlePurgeAccount)
+	s.echo.DELETE("/api/trash/bookmarks/:id", s.handlePurgeBookmark)
+	s.echo.GET("/api/backup", s.handleBackup)
+	s.echo.POST("/api/restore", s.handleRestore)
+	s.echo.GET("/api/vault", s.handleVaultStatus)
+	s.echo.POST("/api/vault/init", s.handleVaultInit)
+	s.echo.POST("/api/vault/unlock", s.handleVaultUnlock)
+	s.echo.POST("/api/vault/lock", s.handleVaultLock)
+	s.echo.POST("/api/vault/keys", s.handleVaultAddKey)
+	s.echo.POST("/api/vault/send", s.idempotent(s.handleVaultSend))
+}
+
+// handlePanicLock locks everything at once: the server vault, in-flight
+// signing requests, and (via the lock epoch) every open dashboard.
+func (s *Server) handlePanicLock(c echo.Context) error {
+	epoch := s.panicLock()
+	return c.JSON(http.StatusOK, map[string]any{"status": "locked", "lock_epoch": epoch})
+}
+
+// handleAddEndpoint creates a new endpoint. Duplicates of an existing endpoint
+// are rejected with 409 unless ?force=true.
+func (s *Server) handleAddEndpoint(c echo.Context) error {
+	store := s.profileFor(c.Request().Context()).store
+	var req endpoint.Endpoint
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if c.QueryParam("force") != "true" {
+		if dup := store.FindDuplicate(c.Request().Context(), req, ""); dup != nil {
+			return duplicateResponse(c, dup)
+		}
+	}
+	ep, err := store.Add(req)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, ep)
+}
+
+// handleUpdateEndpoint updates an existing endpoint.
+func (s *Server) handleUpdateEndpoint(c echo.Context) error {
+	store := s.profileFor(c.Request().Context()).store
+	id := c.Param("id")
+	var req endpoint.Endpoint
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if c.QueryParam("force") != "true" {
+		if dup := store.FindDuplicate(c.Request().Context(), req, id); dup != nil {
+			return duplicateResponse(c, dup)
+		}
+	}
+	ep, err := store.Update(id, req)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, ep)
+}
+
+// handleEndpointJWTSecret returns an endpoint's JWT secret, which statuses
+// leave out, for the edit form.
+func (s *Server) handleEndpointJWTSecret(c echo.Context) error {
+	ep, ok := s.profileFor(c.Request().Context()).store.Get(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "endpoint not found"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"jwt_secret": ep.JWTSecret})
+}
+
+// duplicateResponse reports a would-be duplicate endpoint so the client can
+// warn, merge into the existing one, or retry with ?force=true.
+func duplicateResponse(c echo.Context, dup *endpoint.Duplicate) error {
+	msg := fmt.Sprintf("duplicates %q (same URL)", dup.Existing.Name)
+	if dup.Reason == "chain_host" {
+		msg = fmt.Sprintf("duplicates %q (same chain on the same provider)", dup.Existing.Name)
+	}
+	return c.JSON(http.StatusConflict, map[string]any{
+		"error":     msg,
+		"duplicate": dup,
+	})
+}
+
+// handleDeleteEndpoint moves an endpoint to the recycle bin.
+func (s *Server) handleDeleteEndpoint(c echo.Context) error {
+	store := s.profileFor(c.Request().Context()).store
+	id := c.Param("id")
+	if err := store.Delete(id); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// handleAddAsset registers an asset.
+func (s *Server) handleAddAsset(c echo.Context) error {
+	var req asset.Asset
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	a, err := s.store.Assets().Add(req)
+	if err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, a)
+}
+
+// handleUpdateAsset replaces an asset's decimals, CoinGecko ID, and icon.
+func (s *Server) handleUpdateAsset(c echo.Context) error {
+	var req asset.Asset
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	a, err := s.store.Assets().Update(c.Param("id"), req)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, a)
+}
+
+// handleDeleteAsset removes an asset that no endpoint, in any user's
+// profile, refers to. Endpoints in the recycle bin count, so restoring them
+// can't leave a dangling reference.
+func (s *Server) handleDeleteAsset(c echo.Context) error {
+	id := c.Param("id")
+	names, err := s.assetUsers(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if len(names) > 0 {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "asset is used by " + strings.Join(names, ", ")})
+	}
+	if err := s.store.Assets().Delete(id); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// handleBuildTx builds an unsigned transaction envelope for offline review and signing.
+func (s *Server) handleBuildTx(c echo.Context) error {
+	store := s.profileFor(c.Request().Context()).store
+	var req txbuild.Request
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	ep, ok := store.Get(req.Endpoint)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "endpoint not found"})
+	}
+	env, err := txbuild.Build(c.Request().Context(), ep, req)
+	if err != nil {
+		return s.rpcFailure(c, http.StatusBadRequest, err)
+	}
+	env.ConfirmRequired = s.approvals.ConfirmRequired(env, ep.Native.Decimals)
+	if env.ConfirmRequired {
+		target := s.confirmTarget(c.Request().Context(), env)
+		env.Confirm = &target
+	}
+	s.checkWarnings(c.Request().Context(), env)
+	return c.JSON(http.StatusOK, env)
+}
+
+// handleImportTx verifies a signed transaction against its envelope and
+// optionally broadcasts it to the envelope's endpoint, or with "private", to
+// a private endpoint of its chain. The signature may be given as the parts
+// of an air-gapped device's eth-signature UR.
+func (s *Server) handleImportTx(c echo.Context) error {
+	var req struct {
+		Envelope  txbuild.Envelope `json:"envelope"`
+		Raw       string           `json:"raw"`
+		Signature *struct {
+			YParity string `json:"y_parity"`
+			R       string `json:"r"`
+			S       string `json:"s"`
+		} `json:"signature"`
+		UR        []string `json:"ur"`
+		Broadcast bool     `json:"broadcast"`
+		Private   bool     `json:"private"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	var sig *evm.Signature
+	if len(req.UR) > 0 {
+		var err error
+		if sig, err = urSignature(&req.Envelope, req.UR); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	} else if req.Signature != nil {
+		v, errV := evm.ParseQuantity(req.Signature.YParity)
+		r, errR := evm.ParseQuantity(req.Signature.R)
+		sv, errS := evm.ParseQuantity(req.Signature.S)
+		if errV != nil || errR != nil || errS != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid signature"})
+		}
+		// Accept legacy-style v (27/28) as well as a bare parity bit.
+		if v.Cmp(big.NewInt(27)) >= 0 {
+			v.Sub(v, big.NewInt(27))
+		}
+		if v.Cmp(big.NewInt(1)) > 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid signature parity"})
+		}
+		sig = &evm.Signature{YParity: byte(v.Uint64()), R: r, S: sv}
+	}
+
+	signed, err := txbuild.Import(&req.Envelope, req.Raw, sig)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if !req.Broadcast {
+		return c.JSON(http.StatusOK, signed)
+	}
+	if err := s.riskCheck(c.Request().Context(), &req.Envelope); err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
+
+	p := s.profileFor(c.Request().Context())
+	ep, ok := p.store.Get(req.Envelope.Endpoint)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "endpoint not found"})
+	}
+	if req.Private {
+		var status int
+		if ep, status, err = s.privateFor(c.Request().Context(), p.store, ep); err != nil {
+			return c.JSON(status, map[string]string{"error": err.Error()})
+		}
+	}
+	if !p.shared() {
+		// The journal follows the server profile's endpoints only.
+		if _, err := txbuild.Broadcast(c.Request().Context(), ep, signed.Raw); err != nil {
+			return s.rpcFailure(c, http.StatusBadGateway, err)
+		}
+	} else {
+		signedOK := func() (*txbuild.Signed, error) { return signed, nil }
+		if _, err := s.journal.Send(c.Request().Context(), ep, &req.Envelope, "tx_import", signedOK); err != nil {
+			return s.rpcFailure(c, http.StatusBadGateway, err)
+		}
+	}
+	s.recordContacts(c.Request().Context(), &req.Envelope)
+	return c.JSON(http.StatusOK, s.sent(p.store, ep, signed))
+}
+
+// handleSignTx signs an envelope with the remote signer that holds the
+// envelope's from account, optionally broadcasting the result, privately
+// with "private". Values at
+// CONFIRM_THRESHOLD need a confirmation. With REQUIRE_APPROVAL set, the
+// envelope is queued for review instead.
+func (s *Server) handleSignTx(c echo.Context) error {
+	var req struct {
+		Envelope  txbuild.Envelope      `json:"envelope"`
+		Broadcast bool                  `json:"broadcast"`
+		Private   bool                  `json:"private"`
+		Confirm   *txbuild.Confirmation `json:"confirm"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if err := s.checkConfirmation(c.Request().Context(), &req.Envelope, req.Confirm); err != nil {
+		return confirmError(c, err)
+	}
+	if s.mustQueue(&req.Envelope) {
+		return s.queueApproval(c, &req.Envelope, "tx_sign", "", req.Broadcast, req.Private)
+	}
+	return s.signEnvelope(c, &req.Envelope, req.Broadcast, req.Private, "tx_sign")
+}
+
+// signEnvelope signs env with the vault key or remote signer that holds its
+// from account and writes the signed result, broadcasting it if asked, to a
+// private endpoint of its chain with private. Broadcast sends go through
+// the journal.
+func (s *Server) signEnvelope(c echo.Context, env *txbuild.Envelope, broadcast, private bool, origin string) error {
+	sign, err := s.signFunc(c.Request().Context(), env)
+	if err != nil {
+		if strings.Contains(err.Error(), "no signer account") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		if errors.Is(err, errRiskBlocked) {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if !broadcast {
+		signed, err := sign()
+		if err != nil {
+			return s.signError(c, err)
+		}
+		return c.JSON(http.StatusOK, signed)
+	}
+
+	ep, ok := s.store.Get(env.Endpoint)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "endpoint not found"})
+	}
+	if private {
+		var status int
+		if ep, status, err = s.privateFor(c.Request().Context(), s.store, ep); err != nil {
+			return c.JSON(status, map[string]string{"error": err.Error()})
+		}
+	}
+	signed, err := s.journal.Send(c.Request().Context(), ep, env, origin, sign)
+	if err != nil {
+		return s.signError(c, err)
+	}
+	s.recordContacts(c.Request().Context(), env)
+	return c.JSON(http.StatusOK, s.sent(s.store, ep, signed))
+}
+
+// sent tracks a transaction broadcast to ep, an endpoint of store, if ep is
+// private, and returns the response for it.
+func (s *Server) sent(store *endpoint.Store, ep endpoint.Endpoint, signed *txbuild.Signed) map[string]any {
+	out := map[string]any{"signed": signed, "broadcast": true}
+	if ep.Private {
+		s.sentPrivately(store, ep, signed.Hash)
+		out["private_endpoint"] = ep.ID
+	}
+	return out
+}
+
+// signError writes a signing or broadcast failure: 423 when the vault is
+// locked or a panic lock cancelled signing, otherwise 502.
+func (s *Server) signError(c echo.Context, err error) error {
+	if strings.Contains(err.Error(), "locked") {
+		return c.JSON(http.StatusLocked, map[string]string{"error": err.Error()})
+	}
+	return s.rpcFailure(c, http.StatusBadGateway, err)
+}
+
+// handleJournal returns send intents newest first, optionally filtered by
+// ?stage=, with the logs of mined ones decoded into events and summed up,
+// and the labels of the addresses each involves. ?tag= keeps those
+// involving an address with the tag, and ?counterparty= those that sent to
+// it or moved assets to or from it.
+func (s *Server) handleJournal(c echo.Context) error {
+	labels := s.profileFor(c.Request().Context()).labels
+	tag := c.QueryParam("tag")
+	counterparty := c.QueryParam("counterparty")
+	if counterparty != "" {
+		if _, err := evm.ParseAddress(counterparty); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid counterparty"})
+		}
+	}
+	known := s.knownEvents()
+	out := []journalEntry{}
+	for _, in := range s.journal.List(c.QueryParam("stage")) {
+		e := s.decodeIntent(in, known)
+		addresses := intentAddresses(in, e.Events)
+		if counterparty != "" && !involves(in, addresses, counterparty) {
+			continue
+		}
+		e.Labels = labels.Lookup(addresses...)
+		if tag == "" || tagged(e.Labels, tag) {
+			out = append(out, e)
+		}
+	}
+	return c.JSON(http.StatusOK, out)
+}
+
+// txSigner finds the vault key or server-side signer account that holds from.
+func (s *Server) txSigner(from string) (signer.Account, signer.TxSigner, error) {
+	if s.vault.Has(from) {
+		return signer.Account{Address: from}, s.vault, nil
+	}
+	acct, ok := s.accounts.Get(from)
+	if !ok {
+		return signer.Account{}, nil, fmt.Errorf("no signer account for %s", from)
+	}
+	backend, err := signer.For(acct)
+	if err != nil {
+		return signer.Account{}, nil, err
+	}
+	return acct, backend, nil
+}
+
+// signFunc returns a function that signs env with the vault key or remote
+// signer that holds its from account. A panic lock cancels it, and with
+// RISK_BLOCK_CRITICAL set a critical warning refuses it.
+func (s *Server) signFunc(parent context.Context, env *txbuild.Envelope) (func() (*txbuild.Signed, error), error) {
+	acct, backend, err := s.txSigner(env.From)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.riskCheck(parent, env); err != nil {
+		return nil, err
+	}
+	tx, err := env.Transaction()
+	if err != nil {
+		return nil, err
+	}
+	return func() (*txbuild.Signed, error) {
+		ctx, cancel := s.signingContext(parent)
+		defer cancel()
+		sig, err := backend.SignTx(ctx, acct, tx)
+		if context.Cause(ctx) == errPanicLock {
+			err = errPanicLock
+		}
+		if err != nil {
+			return nil, err
+		}
+		return txbuild.Import(env, "", &sig)
+	}, nil
+}
+
+// signTx signs env, broadcasting it through the journal if asked, to a
+// private endpoint of its chain with private, and adding its recipients to
+// the contacts once sent. When only the broadcast fails, the signed
+// transaction is returned with the error.
+func (s *Server) signTx(parent context.Context, env *txbuild.Envelope, broadcast, private bool, origin string) (*txbuild.Signed, error) {
+	sign, err := s.signFunc(parent, env)
+	if err != nil {
+		return nil, err
+	}
+	if !broadcast {
+		return sign()
+	}
+	ep, ok := s.store.Get(env.Endpoint)
+	if !ok {
+		return nil, fmt.Errorf("endpoint %q not found", env.Endpoint)
+	}
+	if private {
+		if ep, _, err = s.privateFor(parent, s.store, ep); err != nil {
+			return nil, err
+		}
+	}
+	signed, err := s.journal.Send(parent, ep, env, origin, sign)
+	if err == nil {
+		s.recordContacts(parent, env)
+		if ep.Private {
+			s.sentPrivately(s.store, ep, signed.Hash)
+		}
+	}
+	return signed, err
+}
+
+// handleDeepLink parses a primalwallet: link (?uri=) for the dashboard's send
+// dialog.
+func (s *Server) handleDeepLink(c echo.Context) error {
+	link, err := deeplink.Parse(c.QueryParam("uri"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, link)
+}
+
+// handleListAccounts returns signer accounts, optionally filtered by kind.
+func (s *Server) handleListAccounts(c echo.Context) error {
+	accounts := s.profileFor(c.Request().Context()).accounts
+	if kind := c.QueryParam("kind"); kind != "" {
+		accts := accounts.Signer(signer.Kind(kind)).Accounts()
+		if accts == nil {
+			accts = []signer.Account{}
+		}
+		return c.JSON(http.StatusOK, accts)
+	}
+	return c.JSON(http.StatusOK, accounts.List())
+}
+
+// handleAddAccount registers a hardware or remote signer account.
+func (s *Server) handleAddAccount(c echo.Context) error {
+	accounts := s.profileFor(c.Request().Context()).accounts
+	var req signer.Account
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	acct, err := accounts.Add(req)
+	if err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, acct)
+}
+
+// handleRenameAccount changes a signer account's label.
+func (s *Server) handleRenameAccount(c echo.Context) error {
+	accounts := s.profileFor(c.Request().Context()).accounts
+	address := c.Param("address")
+	var req struct {
+		Label string `json:"label"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	acct, err := accounts.Rename(address, req.Label)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, acct)
+}
+
+// handleDeleteAccount moves a signer account to the recycle bin.
+func (s *Server) handleDeleteAccount(c echo.Context) error {
+	accounts := s.profileFor(c.Request().Context()).accounts
+	address := c.Param("address")
+	if err := accounts.Delete(address); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// handleRestoreEndpoint brings an endpoint back from the recycle bin.
+func (s *Server) handleRestoreEndpoint(c echo.Context) error {
+	store := s.profileFor(c.Request().Context()).store
+	ep, err := store.Restore(c.Param("id"))
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, ep)
+}
+
+// handleRestoreAccount brings a signer account back from the recycle bin.
+func (s *Server) handleRestoreAccount(c echo.Context) error {
+	accounts := s.profileFor(c.Request().Context()).accounts
+	acct, err := accounts.Restore(c.Param("address"))
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, acct)
+}
+
+// handleTrash lists everything in the caller's recycle bin. Schedules
+// belong to the server profile, so only its users see deleted ones.
+func (s *Server) handleTrash(c echo.Context) error {
+	p := s.profileFor(c.Request().Context())
+	schedules := []schedule.Schedule{}
+	if p.shared() {
+		schedules = s.schedules.Trash()
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"endpoints": p.store.Trash(),
+		"accounts":  p.accounts.Trash(),
+		"bookmarks": p.bookmarks.Trash(),
+		"contacts":  p.contacts.Trash(),
+		"schedules": schedules,
+	})
+}
+
+// handlePurgeEndpoint permanently removes a deleted endpoint.
+func (s *Server) handlePurgeEndpoint(c echo.Context) error {
+	store := s.profileFor(c.Request().Context()).store
+	if err := store.Purge(c.Param("id")); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "purged"})
+}
+
+// handlePurgeAccount permanently removes a deleted signer account.
+func (s *Server) handlePurgeAccount(c echo.Context) error {
+	accounts := s.profileFor(c.Request().Context()).accounts
+	if err := accounts.Purge(c.Param("address")); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "purged"})
+}
+
+// handlePurgeBookmark permanently removes a deleted bookmark.
+func (s *Server) handlePurgeBookmark(c echo.Context) error {
+	bookmarks := s.profileFor(c.Request().Context()).bookmarks
+	if err := bookmarks.Purge(c.Param("id")); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "purged"})
+}
+
+// handleListBookmarks returns chain snapshot bookmarks.
+func (s *Server) handleListBookmarks(c echo.Context) error {
+	bookmarks := s.profileFor(c.Request().Context()).bookmarks
+	return c.JSON(http.StatusOK, bookmarks.List())
+}
+
+// handleAddBookmark resolves a block number or timestamp on an endpoint into
+// a (chain, block, timestamp) bookmark.
+func (s *Server) handleAddBookmark(c echo.Context) error {
+	var req struct {
+		Endpoint    string     `json:"endpoint"`
+		BlockNumber *uint64    `json:"block_number"`
+		Timestamp   *time.Time `json:"timestamp"`
+		Note        string     `json:"note"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	p := s.profileFor(c.Request().Context())
+	ep, ok := p.store.Get(req.Endpoint)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "endpoint not found"})
+	}
+	b, err := p.bookmarks.Add(c.Request().Context(), ep, req.BlockNumber, req.Timestamp, req.Note)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, b)
+}
+
+// handleUpdateBookmark changes a bookmark's note.
+func (s *Server) handleUpdateBookmark(c echo.Context) error {
+	bookmarks := s.profileFor(c.Request().Context()).bookmarks
+	var req struct {
+		Note string `json:"note"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	b, err := bookmarks.SetNote(c.Param("id"), req.Note)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, b)
+}
+
+// handleDeleteBookmark moves a bookmark to the recycle bin.
+func (s *Server) handleDeleteBookmark(c echo.Context) error {
+	bookmarks := s.profileFor(c.Request().Context()).bookmarks
+	if err := bookmarks.Delete(c.Param("id")); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// handleRestoreBookmark brings a bookmark back from the recycle bin.
+func (s *Server) handleRestoreBookmark(c echo.Context) error {
+	bookmarks := s.profileFor(c.Request().Context()).bookmarks
+	b, err := bookmarks.Restore(c.Param("id"))
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, b)
+}
+
+// handleVaultStatus reports whether the server-side vault is initialized and
+// unlocked, along with its key addresses.
+func (s *Server) handleVaultStatus(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.vault.Status())
+}
+
+// handleVaultInit creates a new vault protected by the given passphrase.
+func (s *Server) handleVaultInit(c echo.Context) error {
+	var req struct {
+		Passphrase string `json:"passphrase"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if err := s.vault.Init(req.Passphrase); err != nil {
+		if strings.Contains(err.Error(), "already") {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, s.vault.Status())
+}
+
+// handleVaultUnlock decrypts the vault keys into memory.
+func (s *Server) handleVaultUnlock(c echo.Context) error {
+	var req struct {
+		Passphrase string `json:"passphrase"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if err := s.vault.Unlock(req.Passphrase); err != nil {
+		if strings.Contains(err.Error(), "wrong passphrase") {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, s.vault.Status())
+}
+
+// handleVaultLock drops the decrypted vault keys from memory.
+func (s *Server) handleVaultLock(c echo.Context) error {
+	s.vault.Lock()
+	return c.JSON(http.StatusOK, s.vault.Status())
+}
+
+// handleVaultAddKey generates a new vault key, or imports one when
+// private_key is given.
+func (s *Server) handleVaultAddKey(c echo.Context) error {
+	var req struct {
+		Label      string `json:"label"`
+		PrivateKey string `json:"private_key"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	var (
+		key vault.Key
+		err error
+	)
+	if req.PrivateKey != "" {
+		key, err = s.vault.Import(req.Label, req.PrivateKey)
+	} else {
+		key, err = s.vault.Generate(req.Label)
+	}
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "locked"):
+			return c.JSON(http.StatusLocked, map[string]string{"error": err.Error()})
+		case strings.Contains(err.Error(), "already exists"):
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, key)
+}
+
+// handleVaultSend builds, signs, and broadcasts a transaction from a vault
+// key in one call. Set "broadcast": false to get the signed transaction back
+// without sending it, or "private": true to send it to a private endpoint
+// of its chain. Values at CONFIRM_THRESHOLD need a confirmation. With
+// REQUIRE_APPROVAL set, the built transaction is queued for review instead.
+func (s *Server) handleVaultSend(c echo.Context) error {
+	var req struct {
+		txbuild.Request
+		Broadcast *bool                 `json:"broadcast"`
+		Private   bool                  `json:"private"`
+		Confirm   *txbuild.Confirmation `json:"confirm"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if !s.vault.Has(req.From) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "no vault key for " + req.From})
+	}
+	ep, ok := s.store.Get(req.Endpoint)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "endpoint not found"})
+	}
+	env, err := txbuild.Build(c.Request().Context(), ep, req.Request)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := s.checkConfirmation(c.Request().Context(), env, req.Confirm); err != nil {
+		return confirmError(c, err)
+	}
+	if s.mustQueue(env) {
+		return s.queueApproval(c, env, "vault_send", "", req.Broadcast == nil || *req.Broadcast, req.Private)
+	}
+	return s.signEnvelope(c, env, req.Broadcast == nil || *req.Broadcast, req.Private, "vault_send")
+}
@@ -0,0 +1,372 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/evm"
+	"github.com/primal-host/wallet/internal/safe"
+)
+
+// safeOrigin labels transactions this wallet proposes in the Safe apps.
+const safeOrigin = "primal-wallet"
+
+// maxSafes bounds how many Safes one detection inspects on-chain.
+const maxSafes = 50
+
+// safeRequest is the body of the Safe write endpoints. Tx is a new
+// transaction to propose; SafeTxHash names one the Transaction Service
+// already holds, to confirm.
+type safeRequest struct {
+	Endpoint   string  `json:"endpoint"`
+	Safe       string  `json:"safe"`
+	Tx         safe.Tx `json:"tx"`
+	SafeTxHash string  `json:"safe_tx_hash"`
+	Owner      string  `json:"owner"`
+	Signature  string  `json:"signature"`
+}
+
+// safeSummary is a detected Safe and which of the given keys own it.
+type safeSummary struct {
+	*safe.Info
+	Keys []string `json:"keys"`
+}
+
+// safeRoutes registers Safe multisig detection, review, and signing.
+func (s *Server) safeRoutes() {
+	s.echo.GET("/api/safes", s.handleListSafes)
+	s.echo.POST("/api/safes/sign", s.handleSignSafeTx)
+	s.echo.GET("/api/safes/:address", s.handleGetSafe)
+	s.echo.POST("/api/safes/:address/build", s.handleBuildSafeTx)
+	s.echo.POST("/api/safes/:address/propose", s.handleProposeSafeTx)
+	s.echo.POST("/api/safes/:address/confirm", s.handleConfirmSafeTx)
+}
+
+// handleListSafes finds the Safes on an endpoint's chain owned by the keys
+// in ?owners= (comma-separated), or by default by the profile's signer
+// accounts and, for the server profile, its vault keys.
+func (s *Server) handleListSafes(c echo.Context) error {
+	ctx := c.Request().Context()
+	ep, ok := s.profileFor(ctx).store.Get(c.QueryParam("endpoint"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "endpoint not found"})
+	}
+	var owners []string
+	if q := c.QueryParam("owners"); q != "" {
+		for _, o := range strings.Split(q, ",") {
+			a, err := evm.ParseAddress(strings.TrimSpace(o))
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "owners: " + err.Error()})
+			}
+			owners = append(owners, a.Hex())
+		}
+	} else {
+		owners = s.ownKeys(ctx)
+	}
+	chainID, err := endpointChainID(c.Request().Context(), ep)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	if !s.safeService.Supports(chainID) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "no Safe Transaction Service for this chain; add one with SAFE_TX_SERVICES"})
+	}
+
+	keys := map[string][]string{}
+	var order []string
+	for _, o := range owners {
+		found, err := s.safeService.OwnerSafes(ctx, chainID, o)
+		if err != nil {
+			return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+		}
+		for _, addr := range found {
+			a, err := evm.ParseAddress(addr)
+			if err != nil {
+				continue
+			}
+			if _, seen := keys[a.Hex()]; !seen {
+				order = append(order, a.Hex())
+			}
+			keys[a.Hex()] = append(keys[a.Hex()], o)
+		}
+	}
+	if len(order) > maxSafes {
+		order = order[:maxSafes]
+	}
+	out := []safeSummary{}
+	for _, addr := range order {
+		a, _ := evm.ParseAddress(addr)
+		info, err := safe.Inspect(c.Request().Context(), ep, a)
+		if err != nil {
+			slog.Warn("safe inspect failed", "subsystem", "safe", "safe", addr, "error", err)
+			continue
+		}
+		// The service's index can lag the chain; trust the owners on-chain.
+		var own []string
+		for _, k := range keys[addr] {
+			if info.IsOwner(k) {
+				own = append(own, k)
+			}
+		}
+		if len(own) > 0 {
+			out = append(out, safeSummary{Info: info, Keys: own})
+		}
+	}
+	return c.JSON(http.StatusOK, out)
+}
+
+// handleGetSafe returns a Safe's owners, threshold, and nonce from the chain
+// and its pending transactions from the Transaction Service.
+func (s *Server) handleGetSafe(c echo.Context) error {
+	ctx := c.Request().Context()
+	info, status, err := s.inspectSafe(ctx, c.QueryParam("endpoint"), c.Param("address"))
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+	pending, err := s.safeService.Pending(ctx, info)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]any{"safe": info, "pending": pending})
+}
+
+// handleBuildSafeTx returns a new Safe transaction's typed data for an
+// owner to sign. Without a nonce it takes the next one after the Safe's
+// pending transactions.
+func (s *Server) handleBuildSafeTx(c echo.Context) error {
+	var req safeRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	sg, _, status, err := s.buildSafeTx(c.Request().Context(), req.Endpoint, c.Param("address"), req.Tx)
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, sg)
+}
+
+// handleProposeSafeTx submits a new Safe transaction to the Transaction
+// Service with the proposing owner's signature, made in the browser or on
+// a hardware wallet over the typed data from build.
+func (s *Server) handleProposeSafeTx(c echo.Context) error {
+	var req safeRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	ctx := c.Request().Context()
+	sg, info, status, err := s.buildSafeTx(ctx, req.Endpoint, c.Param("address"), req.Tx)
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+	sig, err := evm.ParseSignature(req.Signature)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return s.proposeSafeTx(c, info, sg, sig)
+}
+
+// handleConfirmSafeTx adds an owner's signature, made in the browser or on
+// a hardware wallet, to a pending Safe transaction.
+func (s *Server) handleConfirmSafeTx(c echo.Context) error {
+	var req safeRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	ctx := c.Request().Context()
+	p, info, status, err := s.pendingSafeTx(ctx, req.Endpoint, c.Param("address"), req.SafeTxHash)
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+	sig, err := evm.ParseSignature(req.Signature)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return s.confirmSafeTx(c, info, p, sig)
+}
+
+// handleSignSafeTx signs a Safe transaction with the vault key or remote
+// signer that holds owner, and proposes it (with tx) or confirms it (with
+// safe_tx_hash). Like permits, it is refused while REQUIRE_APPROVAL is on.
+func (s *Server) handleSignSafeTx(c echo.Context) error {
+	var req safeRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if s.approvals.Required() {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "REQUIRE_APPROVAL is on, and Safe signatures can't be queued; sign with a browser or hardware key instead"})
+	}
+	owner, err := evm.ParseAddress(strings.TrimSpace(req.Owner))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "owner: " + err.Error()})
+	}
+	ctx := c.Request().Context()
+	var (
+		sg     *safe.Signable
+		info   *safe.Info
+		p      *safe.Pending
+		status int
+	)
+	if req.SafeTxHash != "" {
+		p, info, status, err = s.pendingSafeTx(ctx, req.Endpoint, req.Safe, req.SafeTxHash)
+		if err == nil {
+			sg = p.Signable
+		}
+	} else {
+		sg, info, status, err = s.buildSafeTx(ctx, req.Endpoint, req.Safe, req.Tx)
+	}
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+	if !info.IsOwner(owner.Hex()) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": owner.Hex() + " is not an owner of the Safe"})
+	}
+	acct, backend, err := s.txSigner(owner.Hex())
+	if err != nil {
+		if strings.Contains(err.Error(), "no signer account") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	sctx, cancel := s.signingContext(ctx)
+	defer cancel()
+	sig, err := backend.SignPayload(sctx, acct, sg.Payload())
+	if context.Cause(sctx) == errPanicLock {
+		err = errPanicLock
+	}
+	if err != nil {
+		return s.signError(c, err)
+	}
+	if p != nil {
+		return s.confirmSafeTx(c, info, p, sig)
+	}
+	return s.proposeSafeTx(c, info, sg, sig)
+}
+
+// proposeSafeTx checks that sig is an owner's and submits sg.
+func (s *Server) proposeSafeTx(c echo.Context, info *safe.Info, sg *safe.Signable, sig evm.Signature) error {
+	owner, signature, err := sg.Signature(info, sig)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := s.safeService.Propose(c.Request().Context(), sg, owner, signature, safeOrigin); err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	slog.Info("safe transaction proposed", "subsystem", "safe", "safe", sg.Safe, "chain_id", sg.ChainID, "safe_tx_hash", sg.Digest, "nonce", sg.Tx.Nonce, "to", sg.Tx.To, "value", sg.Tx.Value, "owner", owner, "by", s.profileFor(c.Request().Context()).name())
+	return c.JSON(http.StatusCreated, map[string]any{"safe_tx_hash": sg.Digest, "owner": owner, "signature": signature, "transaction": sg})
+}
+
+// confirmSafeTx checks that sig is a new owner's and adds it to p.
+func (s *Server) confirmSafeTx(c echo.Context, info *safe.Info, p *safe.Pending, sig evm.Signature) error {
+	owner, signature, err := p.Signature(info, sig)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if p.Confirmed(owner) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": owner + " has already signed this transaction"})
+	}
+	if err := s.safeService.Confirm(c.Request().Context(), info.ChainID, p.SafeTxHash, signature); err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	slog.Info("safe transaction confirmed", "subsystem", "safe", "safe", p.Safe, "chain_id", p.ChainID, "safe_tx_hash", p.SafeTxHash, "owner", owner, "by", s.profileFor(c.Request().Context()).name())
+	return c.JSON(http.StatusOK, map[string]any{"safe_tx_hash": p.SafeTxHash, "owner": owner, "signature": signature})
+}
+
+// inspectSafe reads a Safe through the caller's endpoint, returning the
+// status to answer with on failure.
+func (s *Server) inspectSafe(ctx context.Context, epID, address string) (*safe.Info, int, error) {
+	ep, ok := s.profileFor(ctx).store.Get(epID)
+	if !ok {
+		return nil, http.StatusNotFound, errors.New("endpoint not found")
+	}
+	a, err := evm.ParseAddress(strings.TrimSpace(address))
+	if err != nil {
+		return nil, http.StatusBadRequest, errors.New("safe: " + err.Error())
+	}
+	info, err := safe.Inspect(ctx, ep, a)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if !s.safeService.Supports(info.ChainID) {
+		return nil, http.StatusBadRequest, errors.New("no Safe Transaction Service for this chain; add one with SAFE_TX_SERVICES")
+	}
+	return info, 0, nil
+}
+
+// buildSafeTx builds tx for a Safe. A zero nonce means the next free one:
+// the Safe's on-chain nonce, or one past its highest pending transaction.
+func (s *Server) buildSafeTx(ctx context.Context, epID, address string, tx safe.Tx) (*safe.Signable, *safe.Info, int, error) {
+	info, status, err := s.inspectSafe(ctx, epID, address)
+	if err != nil {
+		return nil, nil, status, err
+	}
+	if tx.Nonce == 0 {
+		pending, err := s.safeService.Pending(ctx, info)
+		if err != nil {
+			return nil, nil, http.StatusBadGateway, err
+		}
+		tx.Nonce = info.Nonce
+		for _, p := range pending {
+			if p.Tx.Nonce >= tx.Nonce {
+				tx.Nonce = p.Tx.Nonce + 1
+			}
+		}
+	} else if tx.Nonce < info.Nonce {
+		return nil, nil, http.StatusBadRequest, errors.New("nonce has already been used by the Safe")
+	}
+	sg, err := safe.Build(info, tx)
+	if err != nil {
+		return nil, nil, http.StatusBadRequest, err
+	}
+	return sg, info, 0, nil
+}
+
+// pendingSafeTx fetches a pending transaction and refuses one whose hash
+// the service got wrong, so nobody signs something other than what they
+// reviewed.
+func (s *Server) pendingSafeTx(ctx context.Context, epID, address, safeTxHash string) (*safe.Pending, *safe.Info, int, error) {
+	if b, err := evm.DecodeHex(safeTxHash); err != nil || len(b) != 32 {
+		return nil, nil, http.StatusBadRequest, errors.New("safe_tx_hash must be a 32-byte hex hash")
+	}
+	info, status, err := s.inspectSafe(ctx, epID, address)
+	if err != nil {
+		return nil, nil, status, err
+	}
+	p, err := s.safeService.Transaction(ctx, info, safeTxHash)
+	if err != nil {
+		return nil, nil, http.StatusBadGateway, err
+	}
+	if p.Mismatch {
+		return nil, nil, http.StatusBadGateway, errors.New("the Transaction Service's hash doesn't match the transaction it describes; not signing")
+	}
+	if p.Tx.Nonce < info.Nonce {
+		return nil, nil, http.StatusConflict, errors.New("the Safe has already used this transaction's nonce")
+	}
+	return p, info, 0, nil
+}
+
+// ownKeys returns the profile's signer accounts and, for the server
+// profile, its vault keys.
+func (s *Server) ownKeys(ctx context.Context) []string {
+	p := s.profileFor(ctx)
+	var keys []string
+	add := func(address string) {
+		if a, err := evm.ParseAddress(address); err == nil && !slices.Contains(keys, a.Hex()) {
+			keys = append(keys, a.Hex())
+		}
+	}
+	for _, a := range p.accounts.List() {
+		add(a.Address)
+	}
+	if p == s.serverProfile {
+		for _, k := range s.vault.Status().Keys {
+			add(k.Address)
+		}
+	}
+	return keys
+}
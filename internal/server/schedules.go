@@ -0,0 +1,281 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/schedule"
+	"github.com/primal-host/wallet/internal/txbuild"
+)
+
+// scheduleTick is how often the scheduler looks for due schedules. Specs
+// have minute resolution.
+const scheduleTick = 15 * time.Second
+
+// scheduleRoutes registers recurring transactions and their approval queue.
+func (s *Server) scheduleRoutes() {
+	s.echo.GET("/api/schedules", s.handleListSchedules)
+	s.echo.POST("/api/schedules", s.handleAddSchedule)
+	s.echo.GET("/api/schedules/runs", s.handleListRuns)
+	s.echo.POST("/api/schedules/runs/:id/approve", s.idempotent(s.handleApproveRun))
+	s.echo.POST("/api/schedules/runs/:id/reject", s.handleRejectRun)
+	s.echo.PUT("/api/schedules/:id", s.handleUpdateSchedule)
+	s.echo.DELETE("/api/schedules/:id", s.handleDeleteSchedule)
+	s.echo.POST("/api/schedules/:id/restore", s.handleRestoreSchedule)
+	s.echo.DELETE("/api/trash/schedules/:id", s.handlePurgeSchedule)
+}
+
+// runSchedules fires due schedules until the server shuts down. Runs that
+// came due while the server was down are queued for approval even in auto
+// mode, so nobody is surprised by a send hours after it was meant to go.
+func (s *Server) runSchedules() {
+	start := time.Now()
+	t := time.NewTicker(scheduleTick)
+	defer t.Stop()
+	for {
+		due, err := s.schedules.Due(time.Now())
+		if err != nil {
+			slog.Error("schedule save failed", "subsystem", "schedule", "error", err)
+		}
+		for _, sc := range due {
+			s.fireSchedule(sc, sc.NextRun.Before(start))
+		}
+		select {
+		case <-s.closing:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// fireSchedule builds a due schedule's transaction. Approve-mode schedules,
+// and runs missed while the server was down, queue it for review; auto-mode
+// schedules sign and broadcast it.
+func (s *Server) fireSchedule(sc schedule.Schedule, missed bool) {
+	run := schedule.Run{ScheduleID: sc.ID, Name: sc.Name, Mode: sc.Mode, DueAt: *sc.NextRun, Missed: missed}
+	if sc.Mode == schedule.ModeAuto && !missed {
+		env, signed, err := s.sendTx(context.Background(), sc.Request())
+		run.Envelope = env
+		now := time.Now().UTC()
+		run.DecidedAt = &now
+		if err != nil {
+			run.Status, run.Error = schedule.StatusFailed, err.Error()
+		} else {
+			run.Status, run.Hash = schedule.StatusSent, signed.Hash
+		}
+	} else {
+		env, err := s.buildTx(s.ctx, sc.Request())
+		run.Envelope = env
+		if err != nil {
+			run.Status, run.Error = schedule.StatusFailed, err.Error()
+		} else {
+			run.Status = schedule.StatusPending
+		}
+	}
+
+	run, err := s.schedules.AddRun(run)
+	if err != nil {
+		slog.Error("schedule run save failed", "subsystem", "schedule", "schedule", sc.ID, "error", err)
+	}
+	if run.Status == schedule.StatusFailed {
+		slog.Warn("schedule run failed", "subsystem", "schedule", "schedule", sc.ID, "error", run.Error)
+	} else {
+		slog.Info("schedule fired", "subsystem", "schedule", "schedule", sc.ID, "status", run.Status, "tx", run.Hash)
+	}
+	s.hub.broadcastShared(map[string]any{"type": "schedule_run", "run": run})
+}
+
+// buildTx builds req against its endpoint.
+func (s *Server) buildTx(ctx context.Context, req txbuild.Request) (*txbuild.Envelope, error) {
+	ep, ok := s.store.Get(req.Endpoint)
+	if !ok {
+		return nil, fmt.Errorf("endpoint %q not found", req.Endpoint)
+	}
+	return txbuild.Build(ctx, ep, req)
+}
+
+// sendTx builds req with a fresh nonce and fees, signs it with the vault key
+// or remote signer that holds its from account, and broadcasts it. The
+// envelope is returned whenever it was built, even if sending then failed.
+func (s *Server) sendTx(parent context.Context, req txbuild.Request) (*txbuild.Envelope, *txbuild.Signed, error) {
+	if _, _, err := s.txSigner(req.From); err != nil {
+		return nil, nil, err
+	}
+	env, err := s.buildTx(parent, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	signed, err := s.signTx(parent, env, true, false, "schedule")
+	if err != nil {
+		return env, nil, err
+	}
+	return env, signed, nil
+}
+
+// handleListSchedules returns recurring transaction schedules.
+func (s *Server) handleListSchedules(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.schedules.List())
+}
+
+// handleAddSchedule creates a schedule. Its from account must be a server
+// vault key or a remote signer, since nobody is at the dashboard to sign
+// when it fires.
+func (s *Server) handleAddSchedule(c echo.Context) error {
+	var req schedule.Schedule
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if err := schedule.Validate(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := s.checkSchedule(req); err != nil {
+		return scheduleError(c, err)
+	}
+	sc, err := s.schedules.Add(req)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, sc)
+}
+
+// handleUpdateSchedule replaces a schedule's settings, including pausing and
+// resuming it.
+func (s *Server) handleUpdateSchedule(c echo.Context) error {
+	var req schedule.Schedule
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if err := schedule.Validate(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := s.checkSchedule(req); err != nil {
+		return scheduleError(c, err)
+	}
+	sc, err := s.schedules.Update(c.Param("id"), req)
+	if err != nil {
+		return scheduleError(c, err)
+	}
+	return c.JSON(http.StatusOK, sc)
+}
+
+// checkSchedule checks that a schedule's endpoint exists and that the server
+// can sign for its from account.
+func (s *Server) checkSchedule(sc schedule.Schedule) error {
+	if _, ok := s.store.Get(sc.Endpoint); !ok {
+		return fmt.Errorf("endpoint %q not found", sc.Endpoint)
+	}
+	if _, _, err := s.txSigner(sc.From); err != nil {
+		return err
+	}
+	return nil
+}
+
+// handleDeleteSchedule moves a schedule to the recycle bin.
+func (s *Server) handleDeleteSchedule(c echo.Context) error {
+	if err := s.schedules.Delete(c.Param("id")); err != nil {
+		return scheduleError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// handleRestoreSchedule brings a schedule back from the recycle bin.
+func (s *Server) handleRestoreSchedule(c echo.Context) error {
+	sc, err := s.schedules.Restore(c.Param("id"))
+	if err != nil {
+		return scheduleError(c, err)
+	}
+	return c.JSON(http.StatusOK, sc)
+}
+
+// handlePurgeSchedule permanently removes a deleted schedule.
+func (s *Server) handlePurgeSchedule(c echo.Context) error {
+	if err := s.schedules.Purge(c.Param("id")); err != nil {
+		return scheduleError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "purged"})
+}
+
+// handleListRuns returns schedule runs newest first, optionally filtered by
+// ?status= (pending for the approval queue).
+func (s *Server) handleListRuns(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.schedules.Runs(c.QueryParam("status")))
+}
+
+// handleApproveRun sends a pending run. The transaction is rebuilt with a
+// fresh nonce and fees, since the queued preview may be hours old.
+func (s *Server) handleApproveRun(c echo.Context) error {
+	id := c.Param("id")
+	var pending *schedule.Run
+	for _, r := range s.schedules.Runs(schedule.StatusPending) {
+		if r.ID == id {
+			pending = &r
+			break
+		}
+	}
+	if pending == nil || pending.Envelope == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "pending run " + id + " not found"})
+	}
+	// Leave the run pending if it can't be signed right now.
+	if s.vault.Has(pending.Envelope.From) && !s.vault.Status().Unlocked {
+		return c.JSON(http.StatusLocked, map[string]string{"error": "vault is locked"})
+	}
+	if _, _, err := s.txSigner(pending.Envelope.From); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if _, err := s.schedules.Claim(id); err != nil {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+
+	req := txbuild.Request{
+		Endpoint: pending.Envelope.Endpoint,
+		From:     pending.Envelope.From,
+		To:       pending.Envelope.Tx.To,
+		Value:    pending.Envelope.Tx.Value,
+		Data:     pending.Envelope.Tx.Data,
+	}
+	env, signed, sendErr := s.sendTx(c.Request().Context(), req)
+	hash := ""
+	if signed != nil {
+		hash = signed.Hash
+	}
+	run, err := s.schedules.FinishRun(id, env, hash, sendErr)
+	if err != nil {
+		slog.Error("schedule run save failed", "subsystem", "schedule", "run", id, "error", err)
+	}
+	s.hub.broadcastShared(map[string]any{"type": "schedule_run", "run": run})
+	if sendErr != nil {
+		slog.Warn("schedule run failed", "subsystem", "schedule", "run", id, "error", sendErr)
+		return c.JSON(http.StatusBadGateway, map[string]any{"error": sendErr.Error(), "run": run})
+	}
+	slog.Info("schedule run approved", "subsystem", "schedule", "run", id, "tx", hash)
+	return c.JSON(http.StatusOK, run)
+}
+
+// handleRejectRun drops a pending run without sending it.
+func (s *Server) handleRejectRun(c echo.Context) error {
+	run, err := s.schedules.Reject(c.Param("id"))
+	if err != nil {
+		return scheduleError(c, err)
+	}
+	s.hub.broadcastShared(map[string]any{"type": "schedule_run", "run": run})
+	return c.JSON(http.StatusOK, run)
+}
+
+func scheduleError(c echo.Context, err error) error {
+	switch {
+	case strings.Contains(err.Error(), "not found"), strings.Contains(err.Error(), "no signer account"):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case strings.Contains(err.Error(), "not pending"):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case strings.Contains(err.Error(), "marshal"), strings.Contains(err.Error(), "write"):
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,320 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/primal-host/wallet/internal/alert"
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// Search limits: results by default and at most, and how long lookups on
+// the endpoints may take.
+const (
+	searchLimit      = 20
+	searchMaxLimit   = 100
+	searchRemoteWait = 5 * time.Second
+)
+
+// searchKinds orders results that match equally well.
+var searchKinds = []string{"endpoint", "account", "label", "tag", "contact", "alert", "token", "tx", "block", "address"}
+
+// searchResult is one thing a search found.
+type searchResult struct {
+	Kind     string `json:"kind"` // one of searchKinds
+	Title    string `json:"title"`
+	Detail   string `json:"detail,omitempty"`
+	Address  string `json:"address,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+	Endpoint string `json:"endpoint,omitempty"`
+	ChainID  uint64 `json:"chain_id,omitempty"`
+	Tag      string `json:"tag,omitempty"`
+
+	score int // 0 exact, 1 prefix, 2 substring
+}
+
+// searchRoutes registers the global search.
+func (s *Server) searchRoutes() {
+	s.echo.GET("/api/search", s.handleSearch)
+}
+
+// handleSearch finds ?q= among the profile's endpoints, signer accounts,
+// labels and their tags, contacts, and ERC-20 tokens, and in the server
+// profile the addresses balance alerts watch and the journal's
+// transactions, best matches first, up to ?limit=. A full transaction hash
+// or address found nowhere locally is looked up on one online endpoint of
+// each chain.
+func (s *Server) handleSearch(c echo.Context) error {
+	q := strings.TrimSpace(c.QueryParam("q"))
+	if q == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "q is required"})
+	}
+	limit := searchLimit
+	if l := c.QueryParam("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid limit"})
+		}
+		limit = min(n, searchMaxLimit)
+	}
+	if len(q) < 2 {
+		return c.JSON(http.StatusOK, []searchResult{})
+	}
+	ctx := c.Request().Context()
+	out := s.searchLocal(ctx, q)
+
+	isHash := len(q) == 66 && isHex(q)
+	isAddress := len(q) == 42 && isHex(q)
+	exact := slices.ContainsFunc(out, func(r searchResult) bool {
+		return strings.EqualFold(r.Hash, q) || strings.EqualFold(r.Address, q)
+	})
+	if (isHash || isAddress) && !exact {
+		remote, cancel := context.WithTimeout(ctx, searchRemoteWait)
+		defer cancel()
+		lookup := s.lookupAddress
+		if isHash {
+			lookup = s.lookupHash
+		}
+		out = append(out, s.searchChains(remote, q, lookup)...)
+	}
+
+	slices.SortStableFunc(out, func(a, b searchResult) int {
+		if a.score != b.score {
+			return a.score - b.score
+		}
+		return slices.Index(searchKinds, a.Kind) - slices.Index(searchKinds, b.Kind)
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return c.JSON(http.StatusOK, out)
+}
+
+// searchLocal searches what the server keeps.
+func (s *Server) searchLocal(ctx context.Context, q string) []searchResult {
+	p := s.profileFor(ctx)
+	out := []searchResult{}
+	add := func(score int, r searchResult) {
+		if score >= 0 {
+			r.score = score
+			out = append(out, r)
+		}
+	}
+	chainOf := map[string]uint64{}
+	for _, st := range s.poller.statuses(ctx, p.store) {
+		if n, err := evm.ParseQuantity(st.ChainID); err == nil && n.IsUint64() {
+			chainOf[st.ID] = n.Uint64()
+		}
+	}
+
+	for _, ep := range p.store.List() {
+		chain := ""
+		if id, ok := chainOf[ep.ID]; ok {
+			chain = strconv.FormatUint(id, 10)
+		}
+		add(matchScore(q, ep.Name, ep.ID, chain, ep.Native.Symbol), searchResult{
+			Kind: "endpoint", Title: ep.Name, Detail: strings.TrimSpace(ep.Native.Symbol + " " + chainDetail(chainOf[ep.ID])), Endpoint: ep.ID, ChainID: chainOf[ep.ID],
+		})
+	}
+	for _, a := range p.accounts.List() {
+		add(matchScore(q, a.Label, a.Address), searchResult{Kind: "account", Title: a.Label, Detail: string(a.Kind) + " account", Address: a.Address})
+	}
+	tags := map[string]int{}
+	for _, l := range p.labels.List("") {
+		fields := append([]string{l.Name, l.Address, l.Note}, l.Tags...)
+		title := l.Name
+		if title == "" {
+			title = "#" + strings.Join(l.Tags, " #")
+		}
+		add(matchScore(q, fields...), searchResult{Kind: "label", Title: title, Detail: l.Note, Address: l.Address})
+		for _, t := range l.Tags {
+			tags[t]++
+		}
+	}
+	for _, t := range slices.Sorted(maps.Keys(tags)) {
+		add(matchScore(strings.TrimPrefix(q, "#"), t), searchResult{Kind: "tag", Title: "#" + t, Detail: plural(tags[t], "address", "addresses"), Tag: t})
+	}
+	for _, ct := range p.contacts.List() {
+		add(matchScore(q, ct.Address), searchResult{Kind: "contact", Title: ct.Address, Detail: "sent to " + plural(ct.Sends, "time", "times"), Address: ct.Address})
+	}
+	for _, t := range p.erc20.Tokens(0) {
+		add(matchScore(q, t.Symbol, t.Name, t.Address), searchResult{Kind: "token", Title: t.Symbol, Detail: strings.TrimSpace(t.Name + " " + chainDetail(t.ChainID)), Address: t.Address, ChainID: t.ChainID})
+	}
+	if !p.shared() {
+		return out
+	}
+
+	for _, a := range s.alerts.List(alert.KindBalance) {
+		add(matchScore(q, a.Name, a.Address), searchResult{Kind: "alert", Title: cmp.Or(a.Name, a.Address), Detail: "balance alert on " + a.Endpoint, Address: a.Address, Endpoint: a.Endpoint})
+	}
+	// Transactions match by hash only, from the start, since every hash
+	// contains most short hex strings.
+	if len(q) >= 6 && isHex(q) {
+		for _, in := range s.journal.List("") {
+			if in.Hash == "" || !strings.HasPrefix(strings.ToLower(in.Hash), strings.ToLower(q)) {
+				continue
+			}
+			score := 1
+			if len(q) == len(in.Hash) {
+				score = 0
+			}
+			add(score, searchResult{Kind: "tx", Title: in.Hash, Detail: in.Stage + " send from " + in.From + " on " + s.endpointName(in.Endpoint), Hash: in.Hash, Endpoint: in.Endpoint, ChainID: intentChainID(in)})
+		}
+	}
+	return out
+}
+
+// searchChains runs lookup for q on the best online endpoint of each chain
+// the profile has, at once, and returns what they found.
+func (s *Server) searchChains(ctx context.Context, q string, lookup func(context.Context, endpoint.Endpoint, string) (searchResult, bool)) []searchResult {
+	store := s.profileFor(ctx).store
+	var chains []uint64
+	for _, st := range s.poller.statuses(ctx, store) {
+		n, err := evm.ParseQuantity(st.ChainID)
+		if err == nil && n.IsUint64() && st.Online && !st.Private && !slices.Contains(chains, n.Uint64()) {
+			chains = append(chains, n.Uint64())
+		}
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var out []searchResult
+	for _, chainID := range chains {
+		ep, _, err := s.poller.best(ctx, store, chainID)
+		if err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if r, ok := lookup(ctx, ep, q); ok {
+				r.Endpoint, r.ChainID = ep.ID, chainID
+				mu.Lock()
+				out = append(out, r)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	slices.SortFunc(out, func(a, b searchResult) int { return cmp.Compare(a.ChainID, b.ChainID) })
+	return out
+}
+
+// lookupHash finds a transaction, or else a block, with the hash on ep.
+func (s *Server) lookupHash(ctx context.Context, ep endpoint.Endpoint, hash string) (searchResult, bool) {
+	var tx *struct {
+		From        string `json:"from"`
+		To          string `json:"to"`
+		BlockNumber string `json:"blockNumber"`
+	}
+	if raw, err := endpoint.RPCCall(ctx, ep, "eth_getTransactionByHash", []any{hash}); err == nil && json.Unmarshal(raw, &tx) == nil && tx != nil {
+		detail := "from " + tx.From
+		if tx.To != "" {
+			detail += " to " + tx.To
+		}
+		if n, err := evm.ParseQuantity(tx.BlockNumber); err == nil {
+			detail += ", block " + n.String()
+		} else {
+			detail += ", pending"
+		}
+		return searchResult{Kind: "tx", Title: hash, Detail: detail + " on " + ep.Name, Hash: hash}, true
+	}
+	var block *struct {
+		Number string `json:"number"`
+	}
+	if raw, err := endpoint.RPCCall(ctx, ep, "eth_getBlockByHash", []any{hash, false}); err == nil && json.Unmarshal(raw, &block) == nil && block != nil {
+		detail := "block"
+		if n, err := evm.ParseQuantity(block.Number); err == nil {
+			detail += " " + n.String()
+		}
+		return searchResult{Kind: "block", Title: hash, Detail: detail + " on " + ep.Name, Hash: hash}, true
+	}
+	return searchResult{}, false
+}
+
+// lookupAddress describes an address on ep: a contract, or an account
+// that has a balance or has sent. One that is neither isn't found.
+func (s *Server) lookupAddress(ctx context.Context, ep endpoint.Endpoint, address string) (searchResult, bool) {
+	var code, balance, nonce string
+	for _, call := range []struct {
+		method string
+		out    *string
+	}{{"eth_getCode", &code}, {"eth_getBalance", &balance}, {"eth_getTransactionCount", &nonce}} {
+		raw, err := endpoint.RPCCall(ctx, ep, call.method, []any{address, "latest"})
+		if err != nil || json.Unmarshal(raw, call.out) != nil {
+			return searchResult{}, false
+		}
+	}
+	a, _ := evm.ParseAddress(address)
+	r := searchResult{Kind: "address", Title: a.Hex(), Address: a.Hex()}
+	bal, _ := evm.ParseQuantity(balance)
+	sent, _ := evm.ParseQuantity(nonce)
+	switch {
+	case code != "" && code != "0x":
+		r.Detail = "contract on " + ep.Name
+	case (bal != nil && bal.Sign() > 0) || (sent != nil && sent.Sign() > 0):
+		r.Detail = "account on " + ep.Name
+	default:
+		return searchResult{}, false
+	}
+	if bal != nil && bal.Sign() > 0 {
+		r.Detail += ", " + ep.Native.Format(bal)
+	}
+	return r, true
+}
+
+// matchScore returns how well q matches the best of fields, ignoring case:
+// 0 exactly, 1 as a prefix, 2 within, or -1 not at all.
+func matchScore(q string, fields ...string) int {
+	q = strings.ToLower(q)
+	best := -1
+	for _, f := range fields {
+		f = strings.ToLower(f)
+		score := -1
+		switch {
+		case f == "":
+		case f == q:
+			score = 0
+		case strings.HasPrefix(f, q):
+			score = 1
+		case strings.Contains(f, q):
+			score = 2
+		}
+		if score >= 0 && (best < 0 || score < best) {
+			best = score
+		}
+	}
+	return best
+}
+
+// isHex reports whether s is 0x followed by hex digits.
+func isHex(s string) bool {
+	rest, ok := strings.CutPrefix(strings.ToLower(s), "0x")
+	return ok && rest != "" && strings.Trim(rest, "0123456789abcdef") == ""
+}
+
+func chainDetail(chainID uint64) string {
+	if chainID == 0 {
+		return ""
+	}
+	return "chain " + strconv.FormatUint(chainID, 10)
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return "1 " + one
+	}
+	return strconv.Itoa(n) + " " + many
+}
@@ -7,24 +7,80 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/primal-host/wallet/internal/bench"
 	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/graphql"
+	"github.com/primal-host/wallet/internal/icon"
+	"github.com/primal-host/wallet/internal/idempotency"
+	"github.com/primal-host/wallet/internal/logtail"
+	"github.com/primal-host/wallet/internal/uptime"
 )
 
 type Server struct {
-	echo  *echo.Echo
-	store *endpoint.Store
-	addr  string
+	echo    *echo.Echo
+	store   *endpoint.Store
+	addr    string
+	schema  *graphql.Schema
+	logs    *logtail.Tail
+	idem    *idempotency.Store
+	icons   *icon.Cache
+	uptime  *uptime.Store // history of the server's endpoints
+	benches *bench.Store  // last benchmark of each of the server's endpoints
+	limits  Limits
+	headers Headers
+	proxy   Proxy
+	hub     *pushHub
+	poller  *poller
+	lights  lightClients
+	private privateTxs // transactions sent to private endpoints
+
+	// closing is closed by Shutdown to end long-lived streams, which
+	// would otherwise hold shutdown open until its deadline. ctx is
+	// canceled with it to end polls of endpoints in flight.
+	closing chan struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	manageState
 }
 
-func New(store *endpoint.Store, addr string) *Server {
+// newServer sets up the parts shared by every build: endpoint monitoring
+// with uptime history and benchmarks, the RPC proxy, raw-transaction
+// broadcast, the push channel, the icon cache, rate limits, security
+// headers, and the log tail.
+func newServer(store *endpoint.Store, idem *idempotency.Store, icons *icon.Cache, history *uptime.Store, benches *bench.Store, limits Limits, headers Headers, proxy Proxy, logs *logtail.Tail, addr string) *Server {
 	s := &Server{
-		echo:  echo.New(),
-		store: store,
-		addr:  addr,
+		echo:    echo.New(),
+		store:   store,
+		addr:    addr,
+		logs:    logs,
+		idem:    idem,
+		icons:   icons,
+		uptime:  history,
+		benches: benches,
+		limits:  limits,
+		headers: headers,
+		proxy:   proxy,
+
+		closing: make(chan struct{}),
 	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
 	s.echo.HideBanner = true
 	s.echo.HidePort = true
+	s.echo.IPExtractor = headers.ipExtractor()
 	s.echo.Use(middleware.Recover())
+	s.echo.Use(s.securityHeaders)
+	s.echo.Use(s.rateLimit)
+	s.echo.Use(s.checkOrigin)
+	if ethersJS == nil {
+		slog.Warn("ethers.js not bundled; browser signing is unavailable", "fix", "go generate ./internal/server")
+	}
+	s.schema = s.graphqlSchema()
+	s.hub = newPushHub(s)
+	go s.hub.run()
+	s.poller = newPoller(s)
+	go s.poller.run()
+	go s.runPrivate()
 	s.routes()
 	return s
 }
@@ -38,5 +94,21 @@ func (s *Server) Start() error {
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.echo.Shutdown(ctx)
+	close(s.closing)
+	s.cancel()
+	err := s.echo.Shutdown(ctx)
+	s.poller.saveUptime()
+	return err
+}
+
+// pollContext returns a context for polling endpoints on behalf of a
+// request with ctx, canceled as well when the server shuts down, so a slow
+// endpoint doesn't hold shutdown open until its deadline.
+func (s *Server) pollContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(s.ctx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
 }
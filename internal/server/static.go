@@ -0,0 +1,42 @@
+package server
+
+import (
+	"crypto/sha512"
+	"embed"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+//go:generate go run gen_ethers.go
+
+// staticFS holds the browser libraries the dashboard would otherwise load
+// from a CDN; see static/README.md.
+//
+//go:embed static
+var staticFS embed.FS
+
+// ethersJS is the vendored ethers.js bundle, nil if it wasn't vendored
+// before building. ethersSRI is its subresource integrity hash, which the
+// dashboard sets on the script tag. There is no CDN fallback: a build
+// without the bundle can't sign in the browser.
+var ethersJS, ethersSRI = loadEthers()
+
+func loadEthers() ([]byte, string) {
+	data, err := staticFS.ReadFile("static/ethers.umd.min.js")
+	if err != nil {
+		return nil, ""
+	}
+	sum := sha512.Sum384(data)
+	return data, "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// handleEthers serves the vendored ethers.js bundle.
+func (s *Server) handleEthers(c echo.Context) error {
+	if ethersJS == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "ethers.js isn't bundled in this build; run go generate ./internal/server"})
+	}
+	c.Response().Header().Set("Cache-Control", "public, max-age=86400")
+	return c.Blob(http.StatusOK, "text/javascript; charset=utf-8", ethersJS)
+}
@@ -0,0 +1,128 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"strings"
+	"time"
+)
+
+// taxRow is a send as tax tools import it: what went out, what came in,
+// and the fee. A swap is one row; a send that moved several assets one way
+// is a row for each.
+type taxRow struct {
+	time                     time.Time
+	sentAmount, sentCurrency string
+	recvAmount, recvCurrency string
+	feeAmount, feeCurrency   string
+	label, description, hash string
+}
+
+// taxFormat maps taxRows onto a tax tool's CSV import.
+type taxFormat struct {
+	columns []string
+	record  func(taxRow) []string
+}
+
+// taxFormats are the tax tools' CSV imports, by ?format=.
+var taxFormats = map[string]taxFormat{
+	// Koinly's universal format.
+	"koinly": {
+		columns: []string{"Date", "Sent Amount", "Sent Currency", "Received Amount", "Received Currency", "Fee Amount", "Fee Currency", "Net Worth Amount", "Net Worth Currency", "Label", "Description", "TxHash"},
+		record: func(t taxRow) []string {
+			return []string{t.time.Format("2006-01-02 15:04:05 UTC"), t.sentAmount, t.sentCurrency, t.recvAmount, t.recvCurrency,
+				t.feeAmount, t.feeCurrency, "", "", t.label, t.description, t.hash}
+		},
+	},
+	// CoinTracker's generic format, which has no description or hash.
+	"cointracker": {
+		columns: []string{"Date", "Received Quantity", "Received Currency", "Sent Quantity", "Sent Currency", "Fee Amount", "Fee Currency", "Tag"},
+		record: func(t taxRow) []string {
+			return []string{t.time.Format("01/02/2006 15:04:05"), t.recvAmount, t.recvCurrency, t.sentAmount, t.sentCurrency,
+				t.feeAmount, t.feeCurrency, ""}
+		},
+	},
+}
+
+// taxRows turns export rows, which are grouped by send, into tax rows. A
+// send that moved one asset out and another in is a trade; otherwise each
+// asset is its own row. The fee goes on the send's first row, and a send
+// that moved nothing, such as a reverted one, is a row of its fee alone,
+// labeled a cost. Moves between the sender's own addresses are left out.
+// Descriptions start with the chain's name, since tax tools see only
+// symbols.
+func taxRows(rows []exportRow) []taxRow {
+	var out []taxRow
+	for len(rows) > 0 {
+		n := 1
+		for n < len(rows) && rows[n].Hash == rows[0].Hash {
+			n++
+		}
+		send := rows[:n]
+		rows = rows[n:]
+
+		first := send[0]
+		base := taxRow{time: first.Time, hash: first.Hash, description: first.Chain}
+		if first.Summary != "" {
+			base.description += ": " + first.Summary
+		} else if first.Status == "reverted" {
+			base.description += ": reverted"
+		}
+		var sent, received []exportRow
+		for _, r := range send {
+			switch {
+			case r.Direction == "self" || r.Amount == "0":
+			case r.Direction == "out":
+				sent = append(sent, r)
+			default:
+				received = append(received, r)
+			}
+		}
+
+		var group []taxRow
+		switch {
+		case len(sent) == 1 && len(received) == 1:
+			t := base
+			t.sentAmount, t.sentCurrency = sent[0].Amount, taxCurrency(sent[0])
+			t.recvAmount, t.recvCurrency = received[0].Amount, taxCurrency(received[0])
+			group = append(group, t)
+		default:
+			for _, r := range sent {
+				t := base
+				t.sentAmount, t.sentCurrency = r.Amount, taxCurrency(r)
+				group = append(group, t)
+			}
+			for _, r := range received {
+				t := base
+				t.recvAmount, t.recvCurrency = r.Amount, taxCurrency(r)
+				group = append(group, t)
+			}
+		}
+		if first.Fee == "" || isZero(first.Fee) {
+			out = append(out, group...)
+			continue
+		}
+		if len(group) == 0 {
+			t := base
+			t.sentAmount, t.sentCurrency, t.label = first.Fee, first.FeeToken, "cost"
+			out = append(out, t)
+			continue
+		}
+		group[0].feeAmount, group[0].feeCurrency = first.Fee, first.FeeToken
+		out = append(out, group...)
+	}
+	return out
+}
+
+// taxCurrency names a row's asset: its symbol, with an ERC-721 token's ID.
+func taxCurrency(r exportRow) string {
+	if r.TokenID != "" {
+		return r.Token + " #" + r.TokenID
+	}
+	return r.Token
+}
+
+// isZero reports whether a decimal amount is zero.
+func isZero(amount string) bool {
+	return strings.Trim(amount, "0.") == ""
+}
@@ -0,0 +1,69 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/user"
+)
+
+// handleListTokens lists the caller's API tokens, or every token for
+// admins.
+func (s *Server) handleListTokens(c echo.Context) error {
+	p := s.profileFor(c.Request().Context())
+	owner := p.user.ID
+	if p.can(user.PermAdmin) {
+		owner = ""
+	}
+	return c.JSON(http.StatusOK, s.tokens.List(owner))
+}
+
+// handleCreateToken issues an API token to the caller. The secret is in the
+// response and can't be retrieved again.
+func (s *Server) handleCreateToken(c echo.Context) error {
+	var req struct {
+		Name      string       `json:"name"`
+		Scopes    []user.Scope `json:"scopes"`
+		ExpiresIn string       `json:"expires_in"` // Go duration; empty never expires
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	var ttl time.Duration
+	if req.ExpiresIn != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.ExpiresIn); err != nil || ttl <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "expires_in must be a positive duration, e.g. 720h"})
+		}
+	}
+	me := *s.profileFor(c.Request().Context()).user
+	t, secret, err := s.tokens.Create(me, req.Name, req.Scopes, ttl)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	slog.Info("API token created", "subsystem", "tokens", "token", t.Name, "id", t.ID, "user", me.Name, "scopes", t.Scopes)
+	return c.JSON(http.StatusCreated, map[string]any{"token": t, "secret": secret})
+}
+
+// handleRevokeToken deletes one of the caller's API tokens; admins may
+// delete anyone's.
+func (s *Server) handleRevokeToken(c echo.Context) error {
+	p := s.profileFor(c.Request().Context())
+	t, ok := s.tokens.Get(c.Param("id"))
+	if !ok || (t.User != p.user.ID && !p.can(user.PermAdmin)) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "token " + c.Param("id") + " not found"})
+	}
+	if err := s.tokens.Revoke(t.ID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	slog.Info("API token revoked", "subsystem", "tokens", "token", t.Name, "id", t.ID, "owner", t.Owner, "by", p.user.Name)
+	return c.JSON(http.StatusOK, map[string]string{"status": "revoked"})
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// handleTxPool reports the size of an endpoint's transaction pool and the
+// transactions waiting in it from the caller's signer accounts and any
+// ?address= given, repeated or comma-separated.
+func (s *Server) handleTxPool(c echo.Context) error {
+	ctx := c.Request().Context()
+	ep, ok := s.storeFor(ctx).Get(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "endpoint not found"})
+	}
+	if caps, ok := endpoint.Cached(ep); ok && !caps.TxPool {
+		return c.JSON(http.StatusNotImplemented, map[string]string{"error": ep.Name + " does not serve txpool_status"})
+	}
+	addresses := s.ownAddresses(ctx)
+	for _, param := range c.QueryParams()["address"] {
+		for _, a := range strings.Split(param, ",") {
+			if a = strings.TrimSpace(a); a == "" {
+				continue
+			}
+			if _, err := evm.ParseAddress(a); err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+			}
+			addresses = append(addresses, a)
+		}
+	}
+	ctx, cancel := s.pollContext(ctx)
+	defer cancel()
+	pool, err := endpoint.ReadTxPool(ctx, ep, addresses)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, pool)
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/primal-host/wallet/internal/uptime"
+)
+
+// handleUptime reports an endpoint's uptime over a range (?range=7d by
+// default): the share of time it answered, its latency percentiles, and
+// its outages.
+func (s *Server) handleUptime(c echo.Context) error {
+	id := c.Param("id")
+	if _, ok := s.store.Get(id); !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "endpoint not found"})
+	}
+	r := c.QueryParam("range")
+	if r == "" {
+		r = "7d"
+	}
+	d, err := uptime.ParseRange(r)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	now := time.Now().UTC()
+	report, ok := s.uptime.Report(id, now.Add(-d), now)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "no uptime history for endpoint"})
+	}
+	return c.JSON(http.StatusOK, report)
+}
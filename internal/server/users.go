@@ -0,0 +1,647 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/bookmark"
+	"github.com/primal-host/wallet/internal/contact"
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/erc20"
+	"github.com/primal-host/wallet/internal/keysync"
+	"github.com/primal-host/wallet/internal/label"
+	"github.com/primal-host/wallet/internal/signer"
+	"github.com/primal-host/wallet/internal/user"
+)
+
+// sessionCookie carries a login session in multi-user mode.
+const sessionCookie = "wallet_session"
+
+// profile is the data a request works on. In single-user mode every
+// request gets the server's profile. In multi-user mode admins, operators,
+// and viewers work in the server's profile, which the vault, schedules,
+// approvals, and journal belong to, and users in one of their own.
+type profile struct {
+	user      *user.User   // nil in single-user mode
+	token     *user.Token  // set when the request came with an API token
+	device    *user.Device // set when the request came from a paired device
+	store     *endpoint.Store
+	accounts  *signer.Store
+	bookmarks *bookmark.Store
+	contacts  *contact.Store
+	labels    *label.Store
+	erc20     *erc20.Store
+	prefs     *user.Prefs
+	synced    *keysync.Store
+}
+
+// can reports whether the profile's user has the permission.
+func (p *profile) can(perm user.Permission) bool { return p.user == nil || p.user.Role.Can(perm) }
+
+// name names the profile's user in logs; it is empty in single-user mode.
+func (p *profile) name() string {
+	if p.user == nil {
+		return ""
+	}
+	return p.user.Name
+}
+
+// shared reports whether the profile is the server's.
+func (p *profile) shared() bool { return p.user == nil || p.user.Role.Shared() }
+
+// userData is what a user's profile directory holds.
+type userData struct {
+	store     *endpoint.Store
+	accounts  *signer.Store
+	bookmarks *bookmark.Store
+	contacts  *contact.Store
+	labels    *label.Store
+	erc20     *erc20.Store
+	prefs     *user.Prefs
+	synced    *keysync.Store
+}
+
+type profileKey struct{}
+
+// profileFor returns the profile the authentication middleware attached to
+// ctx, or the server's.
+func (s *Server) profileFor(ctx context.Context) *profile {
+	if p, ok := ctx.Value(profileKey{}).(*profile); ok {
+		return p
+	}
+	return s.serverProfile
+}
+
+func (s *Server) storeFor(ctx context.Context) *endpoint.Store {
+	return s.profileFor(ctx).store
+}
+
+func (s *Server) sharedFor(ctx context.Context) bool {
+	return s.profileFor(ctx).shared()
+}
+
+// principal names who sent the request, for scoping Idempotency-Keys: the
+// API token when there is one, else the user; empty in single-user mode.
+func (s *Server) principal(ctx context.Context) string {
+	p := s.profileFor(ctx)
+	switch {
+	case p.token != nil:
+		return "token:" + p.token.ID
+	case p.user != nil:
+		return "user:" + p.user.ID
+	}
+	return ""
+}
+
+// validToken reports whether secret is a current API token. Single-user
+// mode has none.
+func (s *Server) validToken(secret string) bool {
+	if s.tokens == nil {
+		return false
+	}
+	_, err := s.tokens.Authenticate(secret)
+	return err == nil
+}
+
+// ownAddresses returns the addresses of the caller's signer accounts.
+func (s *Server) ownAddresses(ctx context.Context) []string {
+	var out []string
+	for _, acct := range s.profileFor(ctx).accounts.List() {
+		out = append(out, acct.Address)
+	}
+	return out
+}
+
+// userRoutes registers login, user management, API tokens, and paired
+// devices, which exist only in multi-user mode, and preferences, which
+// always do.
+func (s *Server) userRoutes() {
+	s.echo.GET("/api/me", s.handleMe)
+	s.echo.GET("/api/preferences", s.handleGetPreferences)
+	s.echo.PUT("/api/preferences", s.handleUpdatePreferences)
+	if s.users == nil {
+		return
+	}
+	s.echo.Use(s.authenticate)
+	s.echo.POST("/api/login", s.handleLogin)
+	s.echo.POST("/api/logout", s.handleLogout)
+	s.echo.GET("/api/users", s.handleListUsers)
+	s.echo.POST("/api/users", s.handleAddUser)
+	s.echo.PUT("/api/users/:id", s.handleUpdateUser)
+	s.echo.DELETE("/api/users/:id", s.handleDeleteUser)
+	s.echo.GET("/api/tokens", s.handleListTokens)
+	s.echo.POST("/api/tokens", s.handleCreateToken)
+	s.echo.DELETE("/api/tokens/:id", s.handleRevokeToken)
+	s.echo.GET("/api/devices", s.handleListDevices)
+	s.echo.POST("/api/devices/pairing", s.handleStartPairing)
+	s.echo.POST("/api/devices/pair", s.handlePair)
+	s.echo.DELETE("/api/devices/:id", s.handleRevokeDevice)
+}
+
+// publicRoutes answer without a login: the dashboard (which shows the login
+// form), health checks, the API description, login and device pairing
+// themselves, and the faucet.
+var publicRoutes = map[string]bool{
+	"/":                 true,
+	"/health":           true,
+	"/api/openapi.json": true,
+	"/api/login":        true,
+	"/api/me":           true,
+	"/api/devices/pair": true,
+	"/faucet":           true,
+	"/faucet/drip":      true,
+	"/api/faucet":       true,
+}
+
+// routeRule gives the permission the routes under a path need, and the
+// scope an API token needs to call them. method is empty for every method,
+// GET for reads only, or writeMethods for the rest. Rules marked server
+// reach data only the server's profile has, so users with a profile of
+// their own can't call them whatever their permissions.
+type routeRule struct {
+	prefix string
+	method string
+	perm   user.Permission
+	server bool
+	scope  user.Scope
+}
+
+const writeMethods = "write"
+
+// routePolicy is checked in order and the first matching rule applies.
+// Routes no rule matches need read for GET and admin otherwise, and the
+// admin scope.
+var routePolicy = []routeRule{
+	{"/api/users", "", user.PermAdmin, false, user.ScopeAdmin},
+	{"/api/logs", "", user.PermAdmin, false, user.ScopeAdmin},
+	{"/api/lock", "", user.PermAdmin, false, user.ScopeAdmin},
+	{"/api/tx/sign", "", user.PermAdmin, false, user.ScopeAdmin},
+	{"/api/permits/sign", "", user.PermAdmin, false, user.ScopeAdmin},
+	{"/api/safes/sign", "", user.PermAdmin, false, user.ScopeAdmin},
+	{"/api/batches/:id/send", "", user.PermAdmin, true, user.ScopeAdmin},
+	{"/api/verify", "", user.PermAdmin, false, user.ScopeAdmin},
+	{"/api/tx/:hash/internal", http.MethodGet, user.PermRead, false, user.ScopeReadBalances},
+	{"/api/journal", http.MethodGet, user.PermRead, true, user.ScopeReadBalances},
+	{"/api/history/export", http.MethodGet, user.PermRead, true, user.ScopeReadBalances},
+	{"/api/vault", http.MethodGet, user.PermRead, true, user.ScopeAdmin},
+	{"/api/schedules", http.MethodGet, user.PermRead, true, user.ScopeAdmin},
+	{"/api/bridges", http.MethodGet, user.PermRead, true, user.ScopeReadBalances},
+	{"/api/batches", http.MethodGet, user.PermRead, true, user.ScopeReadBalances},
+	{"/api/alerts", http.MethodGet, user.PermRead, true, user.ScopeReadStatus},
+	{"/api/private", http.MethodGet, user.PermRead, false, user.ScopeReadBalances},
+	{"/api/paymasters/sponsor", "", user.PermOperate, true, user.ScopeBroadcast},
+	{"/api/approvals", http.MethodGet, user.PermRead, true, user.ScopeAdmin},
+	{"/api/approvals/:id", "", user.PermAdmin, false, user.ScopeAdmin},
+	{"/api/approvals", "", user.PermOperate, true, user.ScopeAdmin},
+	{"/api/vault", "", user.PermAdmin, false, user.ScopeAdmin},
+	{"/api/schedules", "", user.PermAdmin, false, user.ScopeAdmin},
+	{"/api/trash/schedules", "", user.PermAdmin, false, user.ScopeAdmin},
+	{"/api/bridges", "", user.PermOperate, true, user.ScopeBroadcast},
+	{"/api/batches", "", user.PermOperate, true, user.ScopeBroadcast},
+	{"/api/alerts", "", user.PermOperate, true, user.ScopeAdmin},
+	{"/api/channels", "", user.PermAdmin, true, user.ScopeAdmin},
+	{"/api/push/subscriptions", http.MethodGet, user.PermAdmin, true, user.ScopeAdmin},
+	{"/api/push", "", user.PermRead, true, user.ScopeAdmin}, // anyone who sees alerts may have their browser notified
+	{"/api/paymasters", "", user.PermAdmin, false, user.ScopeAdmin},
+	{"/api/assets", writeMethods, user.PermAdmin, false, user.ScopeAdmin},
+	{"/api/abis", writeMethods, user.PermAdmin, false, user.ScopeAdmin},
+	{"/api/broadcast", "", user.PermOperate, false, user.ScopeBroadcast},
+	{"/api/tx", "", user.PermOperate, false, user.ScopeBroadcast},
+	{"/api/permits", "", user.PermOperate, false, user.ScopeBroadcast},
+	{"/api/safes", http.MethodGet, user.PermRead, false, user.ScopeReadBalances},
+	{"/api/safes", "", user.PermOperate, false, user.ScopeBroadcast},
+	{"/api/endpoints/:id/txpool", http.MethodGet, user.PermRead, false, user.ScopeReadBalances},
+	{"/api/endpoints/:id/contracts", http.MethodGet, user.PermRead, false, user.ScopeReadBalances},
+	{"/api/endpoints/:id/jwt-secret", http.MethodGet, user.PermManage, false, user.ScopeAdmin},
+	{"/api/endpoints", http.MethodGet, user.PermRead, true, user.ScopeReadStatus}, // uptime and benchmarks are kept for the server's endpoints only
+	{"/api/endpoints/:id/bench", "", user.PermOperate, true, user.ScopeReadStatus},
+	{"/api/endpoints", writeMethods, user.PermManage, false, user.ScopeAdmin},
+	{"/api/devnets", "", user.PermManage, false, user.ScopeAdmin},
+	{"/api/devnet", http.MethodGet, user.PermRead, false, user.ScopeReadStatus},
+	{"/api/devnet", "", user.PermAdmin, false, user.ScopeAdmin}, // as the proxy's anvil_, hardhat_ and evm_ calls
+	{"/api/accounts", writeMethods, user.PermManage, false, user.ScopeAdmin},
+	{"/api/bookmarks", writeMethods, user.PermManage, false, user.ScopeAdmin},
+	{"/api/contacts", writeMethods, user.PermManage, false, user.ScopeAdmin},
+	{"/api/labels", writeMethods, user.PermManage, false, user.ScopeAdmin},
+	{"/api/erc20", writeMethods, user.PermManage, false, user.ScopeAdmin},
+	{"/api/trash", writeMethods, user.PermManage, false, user.ScopeAdmin},
+	{"/api/keysync", "", user.PermOperate, false, user.ScopeBroadcast}, // paired phones sign with these keys
+	{"/api/backup", "", user.PermManage, false, user.ScopeAdmin},       // carries endpoint JWT secrets
+	{"/api/restore", "", user.PermManage, false, user.ScopeAdmin},
+	{"/api/status", "", user.PermRead, false, user.ScopeReadStatus},
+	{"/api/compare", "", user.PermRead, false, user.ScopeReadStatus},
+	{"/api/assets", "", user.PermRead, false, user.ScopeReadStatus},
+	{"/api/ws", "", user.PermRead, false, user.ScopeReadStatus},
+	{"/api/icons", "", user.PermRead, false, user.ScopeReadStatus},
+	{"/api/metrics", "", user.PermRead, false, user.ScopeReadStatus},
+	{"/api/accounts", "", user.PermRead, false, user.ScopeReadBalances},
+	{"/api/nfts", "", user.PermRead, false, user.ScopeReadBalances},
+	{"/api/ipfs", "", user.PermRead, false, user.ScopeReadBalances},
+	{"/api/bookmarks", "", user.PermRead, false, user.ScopeReadBalances},
+	{"/api/contacts", "", user.PermRead, false, user.ScopeReadBalances},
+	{"/api/labels", "", user.PermRead, false, user.ScopeReadBalances},
+	{"/api/search", http.MethodGet, user.PermRead, false, user.ScopeReadBalances}, // server profile results only for shared roles
+	{"/api/erc20", "", user.PermRead, false, user.ScopeReadBalances},
+	{"/api/rpc", "", user.PermRead, false, user.ScopeReadStatus}, // methods are checked by handleRPC
+	{"/graphql", "", user.PermRead, false, user.ScopeReadBalances},
+	{"/api/calldata", "", user.PermRead, false, user.ScopeAdmin},
+	{"/api/preferences", "", user.PermRead, false, user.ScopeAdmin},
+	{"/api/tokens", "", user.PermRead, false, user.ScopeAdmin},
+	{"/api/devices", "", user.PermRead, false, user.ScopeAdmin},
+	{"/api/logout", "", user.PermRead, false, user.ScopeAdmin},
+}
+
+// routePermission returns the rule for a route, identified by its
+// registered path.
+func routePermission(method, path string) routeRule {
+	for _, r := range routePolicy {
+		if path != r.prefix && !strings.HasPrefix(path, r.prefix+"/") {
+			continue
+		}
+		switch {
+		case r.method == "",
+			r.method == writeMethods && method != http.MethodGet,
+			r.method == method:
+			return r
+		}
+	}
+	if method == http.MethodGet {
+		return routeRule{perm: user.PermRead, scope: user.ScopeAdmin}
+	}
+	return routeRule{perm: user.PermAdmin, scope: user.ScopeAdmin}
+}
+
+// balanceMethods are the RPC methods that read account state, which API
+// tokens need the read-balances scope for.
+var balanceMethods = map[string]bool{
+	"eth_getBalance":          true,
+	"eth_getTransactionCount": true,
+	"eth_call":                true,
+	"eth_getStorageAt":        true,
+	"eth_getProof":            true,
+}
+
+// rpcPermission returns the permission and token scope an RPC method needs
+// through the proxy: sending transactions needs operate, and node
+// administration and test-chain control need admin.
+func rpcPermission(method string) (user.Permission, user.Scope) {
+	switch {
+	case strings.HasPrefix(method, "eth_send"):
+		return user.PermOperate, user.ScopeBroadcast
+	case strings.HasPrefix(method, "eth_sign"):
+		return user.PermOperate, user.ScopeAdmin
+	case balanceMethods[method]:
+		return user.PermRead, user.ScopeReadBalances
+	}
+	for _, prefix := range []string{"admin_", "debug_", "miner_", "personal_", "engine_", "anvil_", "hardhat_", "evm_"} {
+		if strings.HasPrefix(method, prefix) {
+			return user.PermAdmin, user.ScopeAdmin
+		}
+	}
+	return user.PermRead, user.ScopeReadStatus
+}
+
+// rpcAllowed checks that the caller may send the RPC method.
+func (s *Server) rpcAllowed(ctx context.Context, method string) error {
+	p := s.profileFor(ctx)
+	perm, scope := rpcPermission(method)
+	if !p.can(perm) {
+		return fmt.Errorf("%s permission required for %s", perm, method)
+	}
+	if p.token != nil && !p.token.Allows(scope) {
+		return fmt.Errorf("API token needs the %s scope for %s", scope, method)
+	}
+	if p.device != nil && !p.device.Allows(scope) {
+		return fmt.Errorf("paired devices can't send %s", method)
+	}
+	return nil
+}
+
+// authenticate resolves the API token, session cookie, or device cookie to
+// a user and attaches their profile to the request. Requests without any
+// get 401 except on public routes; users whose role lacks the route's
+// permission, and tokens and devices without its scope, get 403.
+func (s *Server) authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var (
+			u      user.User
+			token  *user.Token
+			device *user.Device
+			found  bool
+		)
+		if secret, ok := strings.CutPrefix(c.Request().Header.Get("Authorization"), "Bearer "+user.TokenPrefix); ok {
+			t, err := s.tokens.Authenticate(user.TokenPrefix + secret)
+			if err != nil {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+			}
+			if u, found = s.users.Get(t.User); !found {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "API token's user no longer exists"})
+			}
+			token = &t
+		} else if cookie, err := c.Cookie(sessionCookie); err == nil {
+			if id, ok := s.sessions.Lookup(cookie.Value); ok {
+				u, found = s.users.Get(id)
+			}
+		}
+		if !found {
+			// A revoked or unknown device cookie is ignored, so the
+			// browser falls back to the login form.
+			if cookie, err := c.Cookie(deviceCookie); err == nil {
+				if d, err := s.devices.Authenticate(cookie.Value, c.RealIP()); err == nil {
+					if u, found = s.users.Get(d.User); found {
+						device = &d
+					}
+				}
+			}
+		}
+		if !found {
+			if publicRoutes[c.Path()] {
+				return next(c)
+			}
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "login required"})
+		}
+		if !publicRoutes[c.Path()] {
+			rule := routePermission(c.Request().Method, c.Path())
+			if !u.Role.Can(rule.perm) {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": string(rule.perm) + " permission required"})
+			}
+			if rule.server && !u.Role.Shared() {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "only the server profile has " + rule.prefix})
+			}
+			if token != nil && !token.Allows(rule.scope) {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "API token needs the " + string(rule.scope) + " scope"})
+			}
+			if device != nil && !device.Allows(rule.scope) {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "paired devices can't use " + c.Path()})
+			}
+		}
+		p, err := s.userProfile(u)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		p.token, p.device = token, device
+		c.SetRequest(c.Request().WithContext(context.WithValue(c.Request().Context(), profileKey{}, p)))
+		return next(c)
+	}
+}
+
+// userProfile builds u's profile: the server's data for roles that share
+// it, their own otherwise, and their own preferences and synced browser
+// vault either way.
+func (s *Server) userProfile(u user.User) (*profile, error) {
+	d, err := s.loadUserData(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	p := &profile{user: &u, store: d.store, accounts: d.accounts, bookmarks: d.bookmarks, contacts: d.contacts, labels: d.labels, erc20: d.erc20, prefs: d.prefs, synced: d.synced}
+	if u.Role.Shared() {
+		p.store, p.accounts, p.bookmarks, p.contacts, p.labels, p.erc20 = s.store, s.accounts, s.bookmarks, s.contacts, s.labels, s.erc20
+	}
+	return p, nil
+}
+
+// loadUserData opens a user's profile directory, creating it on first use,
+// and keeps it open for later requests.
+func (s *Server) loadUserData(id string) (*userData, error) {
+	s.profileMu.Lock()
+	defer s.profileMu.Unlock()
+	if d, ok := s.profiles[id]; ok {
+		return d, nil
+	}
+	dir := s.users.ProfileDir(id)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create profile: %w", err)
+	}
+	store, err := endpoint.NewStore(filepath.Join(dir, "endpoints.json"), s.store.Assets())
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := signer.NewStore(filepath.Join(dir, "accounts.json"))
+	if err != nil {
+		return nil, err
+	}
+	bookmarks, err := bookmark.NewStore(filepath.Join(dir, "bookmarks.json"))
+	if err != nil {
+		return nil, err
+	}
+	contacts, err := contact.NewStore(filepath.Join(dir, "contacts.json"))
+	if err != nil {
+		return nil, err
+	}
+	labels, err := label.NewStore(filepath.Join(dir, "labels.json"))
+	if err != nil {
+		return nil, err
+	}
+	tokens20, err := erc20.NewStore(filepath.Join(dir, "erc20.json"))
+	if err != nil {
+		return nil, err
+	}
+	prefs, err := user.NewPrefs(filepath.Join(dir, "preferences.json"))
+	if err != nil {
+		return nil, err
+	}
+	synced, err := keysync.NewStore(filepath.Join(dir, "keysync.json"))
+	if err != nil {
+		return nil, err
+	}
+	d := &userData{store: store, accounts: accounts, bookmarks: bookmarks, contacts: contacts, labels: labels, erc20: tokens20, prefs: prefs, synced: synced}
+	s.profiles[id] = d
+	return d, nil
+}
+
+// assetUsers names the endpoints, in any profile, that refer to the asset.
+func (s *Server) assetUsers(id string) ([]string, error) {
+	names := s.store.UsesAsset(id)
+	if s.users == nil {
+		return names, nil
+	}
+	list, err := s.users.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range list {
+		d, err := s.loadUserData(u.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range d.store.UsesAsset(id) {
+			names = append(names, name+" ("+u.Name+")")
+		}
+	}
+	return names, nil
+}
+
+// handleLogin checks a name and password and starts a session, set as a
+// cookie and also returned for API clients.
+func (s *Server) handleLogin(c echo.Context) error {
+	var req struct {
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	u, err := s.users.Authenticate(req.Name, req.Password)
+	if err != nil {
+		slog.Warn("login failed", "subsystem", "users", "name", req.Name, "ip", c.RealIP())
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+	}
+	token, err := s.sessions.Create(u.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   c.IsTLS(),
+		SameSite: http.SameSiteStrictMode,
+	})
+	slog.Info("user logged in", "subsystem", "users", "user", u.Name, "role", u.Role)
+	return c.JSON(http.StatusOK, map[string]any{"user": u, "session": token})
+}
+
+// handleLogout ends the caller's session.
+func (s *Server) handleLogout(c echo.Context) error {
+	if cookie, err := c.Cookie(sessionCookie); err == nil {
+		s.sessions.Revoke(cookie.Value)
+	}
+	c.SetCookie(&http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteStrictMode})
+	return c.JSON(http.StatusOK, map[string]string{"status": "logged out"})
+}
+
+// handleMe reports whether multi-user mode is on, who is logged in, what
+// they may do, and the API token or paired device the request came from,
+// if any.
+func (s *Server) handleMe(c echo.Context) error {
+	p := s.profileFor(c.Request().Context())
+	perms := []user.Permission{}
+	switch {
+	case p.user != nil:
+		perms = p.user.Role.Permissions()
+	case s.users == nil:
+		perms = user.RoleAdmin.Permissions()
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"multi_user":  s.users != nil,
+		"user":        p.user,
+		"permissions": perms,
+		"token":       p.token,
+		"device":      p.device,
+	})
+}
+
+// handleListUsers returns every user.
+func (s *Server) handleListUsers(c echo.Context) error {
+	list, err := s.users.List()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// handleAddUser creates a user with a password and role.
+func (s *Server) handleAddUser(c echo.Context) error {
+	var req struct {
+		Name     string    `json:"name"`
+		Password string    `json:"password"`
+		Role     user.Role `json:"role"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if req.Role == "" {
+		req.Role = user.RoleUser
+	}
+	u, err := s.users.Add(req.Name, req.Password, req.Role)
+	if err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	slog.Info("user added", "subsystem", "users", "user", u.Name, "role", u.Role, "by", s.profileFor(c.Request().Context()).user.Name)
+	return c.JSON(http.StatusCreated, u)
+}
+
+// handleUpdateUser changes a user's role or password. A new password ends
+// the user's sessions.
+func (s *Server) handleUpdateUser(c echo.Context) error {
+	var req struct {
+		Role     user.Role `json:"role"`
+		Password string    `json:"password"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	u, err := s.users.Update(c.Param("id"), req.Role, req.Password)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if req.Password != "" {
+		s.sessions.RevokeUser(u.ID)
+	}
+	slog.Info("user updated", "subsystem", "users", "user", u.Name, "role", u.Role, "by", s.profileFor(c.Request().Context()).user.Name)
+	return c.JSON(http.StatusOK, u)
+}
+
+// handleDeleteUser removes a user, ends their sessions, and revokes their
+// API tokens and paired devices. Their profile directory is kept.
+func (s *Server) handleDeleteUser(c echo.Context) error {
+	id := c.Param("id")
+	me := s.profileFor(c.Request().Context()).user
+	if id == me.ID {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "can't remove yourself"})
+	}
+	u, _ := s.users.Get(id)
+	if err := s.users.Delete(id); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	s.sessions.RevokeUser(id)
+	if err := s.tokens.RevokeUser(id); err != nil {
+		slog.Error("revoking removed user's tokens failed", "subsystem", "tokens", "user", u.Name, "error", err)
+	}
+	if err := s.devices.RevokeUser(id); err != nil {
+		slog.Error("revoking removed user's devices failed", "subsystem", "devices", "user", u.Name, "error", err)
+	}
+	s.profileMu.Lock()
+	delete(s.profiles, id)
+	s.profileMu.Unlock()
+	slog.Info("user removed", "subsystem", "users", "user", u.Name, "by", me.Name)
+	return c.JSON(http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// handleGetPreferences returns the caller's preferences.
+func (s *Server) handleGetPreferences(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.profileFor(c.Request().Context()).prefs.Get())
+}
+
+// handleUpdatePreferences merges a JSON object into the caller's
+// preferences; null removes a key.
+func (s *Server) handleUpdatePreferences(c echo.Context) error {
+	var patch map[string]json.RawMessage
+	if err := c.Bind(&patch); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "preferences must be a JSON object"})
+	}
+	prefs, err := s.profileFor(c.Request().Context()).prefs.Update(patch)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, prefs)
+}
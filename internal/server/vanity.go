@@ -0,0 +1,52 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// vanityWorkerJS grinds random keys for the dashboard's vanity address
+// generator. It runs as a Web Worker, one per core, so the page stays
+// responsive; keys never leave the browser. The page sends
+// {prefix, suffix, checksum}, where prefix and suffix are hex digits to
+// match against the address (checksummed when checksum is set), and the
+// worker reports tries in batches until it posts {key, address}. The page
+// terminates it to cancel.
+const vanityWorkerJS = `importScripts('/static/ethers.umd.min.js');
+
+const BATCH = 256;
+
+onmessage = e => {
+  const { prefix, suffix, checksum } = e.data;
+  const bytes = new Uint8Array(32);
+  let tries = 0;
+  for (;;) {
+    crypto.getRandomValues(bytes);
+    const key = ethers.hexlify(bytes);
+    let address;
+    try {
+      address = ethers.computeAddress(key);
+    } catch {
+      continue; // zero or not below the curve order
+    }
+    const body = checksum ? address.slice(2) : address.slice(2).toLowerCase();
+    if (body.startsWith(prefix) && body.endsWith(suffix)) {
+      postMessage({ tries: tries + 1, key: key, address: address });
+      return;
+    }
+    if (++tries === BATCH) {
+      postMessage({ tries: tries });
+      tries = 0;
+    }
+  }
+};
+`
+
+// handleVanityWorker serves the vanity address worker. Its policy lets it
+// load ethers.js and nothing else.
+func (s *Server) handleVanityWorker(c echo.Context) error {
+	s.setCSP(c, "default-src 'none'", "script-src 'self'")
+	c.Response().Header().Set("Cache-Control", "public, max-age=86400")
+	return c.Blob(http.StatusOK, "text/javascript; charset=utf-8", []byte(vanityWorkerJS))
+}
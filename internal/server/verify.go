@@ -0,0 +1,32 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/verify"
+)
+
+// handleVerify checks the server's stores for corruption and inconsistencies.
+// With ?receipts=true, mined sends in the journal are also checked against
+// their receipts, which takes an RPC call each.
+func (s *Server) handleVerify(c echo.Context) error {
+	r := verify.Run(c.Request().Context(), verify.Stores{
+		Files:     s.files,
+		Endpoints: s.store,
+		Accounts:  s.accounts,
+		Vault:     s.vault,
+		Journal:   s.journal,
+		Schedules: s.schedules,
+		Users:     s.users,
+		Tokens:    s.tokens,
+		Devices:   s.devices,
+	}, c.QueryParam("receipts") == "true")
+	if !r.OK() {
+		slog.Warn("verification found problems", "subsystem", "verify", "problems", len(r.Problems))
+	}
+	return c.JSON(http.StatusOK, r)
+}
@@ -0,0 +1,112 @@
+//go:build !broadcastonly
+
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/primal-host/wallet/internal/webpush"
+)
+
+// pushWorkerJS is the service worker that shows the notifications pushed
+// to a subscribed browser, and brings up the dashboard when one is
+// clicked.
+const pushWorkerJS = `self.addEventListener('push', event => {
+  let n = {};
+  try { n = event.data ? event.data.json() : {}; } catch { n = { body: event.data.text() }; }
+  event.waitUntil(self.registration.showNotification(n.title || 'Wallet', {
+    body: n.body || '',
+    tag: n.kind,
+    renotify: !!n.kind,
+    timestamp: n.at ? Date.parse(n.at) : Date.now()
+  }));
+});
+
+self.addEventListener('notificationclick', event => {
+  event.notification.close();
+  event.waitUntil(clients.matchAll({ type: 'window', includeUncontrolled: true }).then(windows => {
+    for (const w of windows) {
+      if (new URL(w.url).pathname === '/' && 'focus' in w) return w.focus();
+    }
+    return clients.openWindow('/');
+  }));
+});
+`
+
+// webPushRoutes registers browser push subscriptions and the service
+// worker that receives them.
+func (s *Server) webPushRoutes() {
+	s.echo.GET("/static/push-worker.js", s.handlePushWorker)
+	s.echo.GET("/api/push/key", s.handlePushKey)
+	s.echo.GET("/api/push/subscriptions", s.handleListPushSubscriptions)
+	s.echo.POST("/api/push/subscriptions", s.handlePushSubscribe)
+	s.echo.DELETE("/api/push/subscriptions/:id", s.handlePushUnsubscribe)
+	s.echo.POST("/api/push/subscriptions/:id/test", s.handleTestPushSubscription)
+}
+
+// handlePushWorker serves the push service worker. It fetches nothing, and
+// isn't cached, so browsers pick up a new version at once.
+func (s *Server) handlePushWorker(c echo.Context) error {
+	s.setCSP(c, "default-src 'none'")
+	c.Response().Header().Set("Cache-Control", "no-cache")
+	return c.Blob(http.StatusOK, "text/javascript; charset=utf-8", []byte(pushWorkerJS))
+}
+
+// handlePushKey returns the VAPID public key browsers subscribe with.
+func (s *Server) handlePushKey(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"public_key": s.pushes.PublicKey()})
+}
+
+// handleListPushSubscriptions returns the subscribed browsers, without
+// their keys.
+func (s *Server) handleListPushSubscriptions(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.pushes.List())
+}
+
+// handlePushSubscribe stores a browser's push subscription, named after
+// its user agent unless the request names it.
+func (s *Server) handlePushSubscribe(c echo.Context) error {
+	var req webpush.Subscription
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if err := checkKinds(req.Kinds); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		req.Name = c.Request().UserAgent()
+		if len(req.Name) > 120 {
+			req.Name = req.Name[:120]
+		}
+	}
+	req.By = s.profileFor(c.Request().Context()).name()
+	sub, err := s.pushes.Subscribe(req)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	slog.Info("web push subscribed", "subsystem", "notify", "subscription", sub.ID, "service", sub.Endpoint, "by", sub.By)
+	return c.JSON(http.StatusCreated, sub)
+}
+
+// handlePushUnsubscribe removes a browser's push subscription.
+func (s *Server) handlePushUnsubscribe(c echo.Context) error {
+	if err := s.pushes.Delete(c.Param("id")); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// handleTestPushSubscription pushes a test notification to a browser and
+// reports how it went.
+func (s *Server) handleTestPushSubscription(c echo.Context) error {
+	if err := s.pushes.Test(c.Param("id")); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "sent"})
+}
@@ -0,0 +1,126 @@
+package signer
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// awsKMS signs with an AWS KMS ECC_SECG_P256K1 key. Account.KeyID is the key
+// ID or ARN, Account.Region overrides AWS_REGION. Credentials come from the
+// standard AWS_ACCESS_KEY_ID / AWS_SECRET_ACCESS_KEY / AWS_SESSION_TOKEN env vars.
+type awsKMS struct{}
+
+func (k awsKMS) SignTx(ctx context.Context, acct Account, tx *evm.Tx) (evm.Signature, error) {
+	return k.SignPayload(ctx, acct, tx.SigningPayload())
+}
+
+func (awsKMS) SignPayload(ctx context.Context, acct Account, payload []byte) (evm.Signature, error) {
+	region := acct.Region
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if region == "" || accessKey == "" || secretKey == "" {
+		return evm.Signature{}, fmt.Errorf("aws kms: region and AWS credentials are required")
+	}
+
+	hash := evm.Keccak256(payload)
+	body, err := json.Marshal(map[string]string{
+		"KeyId":            acct.KeyID,
+		"Message":          base64.StdEncoding.EncodeToString(hash),
+		"MessageType":      "DIGEST",
+		"SigningAlgorithm": "ECDSA_SHA_256",
+	})
+	if err != nil {
+		return evm.Signature{}, err
+	}
+
+	host := "kms." + region + ".amazonaws.com"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+host+"/", bytes.NewReader(body))
+	if err != nil {
+		return evm.Signature{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService.Sign")
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+	signV4(req, body, host, region, "kms", accessKey, secretKey, time.Now().UTC())
+
+	resp, err := remoteClient.Do(req)
+	if err != nil {
+		return evm.Signature{}, fmt.Errorf("aws kms: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return evm.Signature{}, fmt.Errorf("aws kms: %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	var out struct {
+		Signature string `json:"Signature"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return evm.Signature{}, fmt.Errorf("aws kms: decode response: %w", err)
+	}
+	der, err := base64.StdEncoding.DecodeString(out.Signature)
+	if err != nil {
+		return evm.Signature{}, fmt.Errorf("aws kms: decode signature: %w", err)
+	}
+	return digestSignature(der, hash, acct.Address)
+}
+
+// signV4 adds an AWS Signature Version 4 Authorization header to req.
+func signV4(req *http.Request, body []byte, host, region, service, accessKey, secretKey string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("Host", host)
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	var names []string
+	for name := range req.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	bodyHash := sha256.Sum256(body)
+	canonical := strings.Join([]string{
+		req.Method, "/", "", canonicalHeaders.String(), signedHeaders, hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
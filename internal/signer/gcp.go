@@ -0,0 +1,92 @@
+package signer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+const gcpMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// gcpKMS signs with a Cloud KMS EC_SIGN_SECP256K1_SHA256 key. Account.KeyID is
+// the full key version name (projects/.../cryptoKeyVersions/N). The access
+// token comes from GCP_ACCESS_TOKEN or, on GCE/GKE, the metadata server.
+type gcpKMS struct{}
+
+func (k gcpKMS) SignTx(ctx context.Context, acct Account, tx *evm.Tx) (evm.Signature, error) {
+	return k.SignPayload(ctx, acct, tx.SigningPayload())
+}
+
+func (gcpKMS) SignPayload(ctx context.Context, acct Account, payload []byte) (evm.Signature, error) {
+	token, err := gcpToken(ctx)
+	if err != nil {
+		return evm.Signature{}, fmt.Errorf("gcp kms: %w", err)
+	}
+
+	hash := evm.Keccak256(payload)
+	body, err := json.Marshal(map[string]any{
+		"digest": map[string]string{"sha256": base64.StdEncoding.EncodeToString(hash)},
+	})
+	if err != nil {
+		return evm.Signature{}, err
+	}
+	url := "https://cloudkms.googleapis.com/v1/" + acct.KeyID + ":asymmetricSign"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return evm.Signature{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := remoteClient.Do(req)
+	if err != nil {
+		return evm.Signature{}, fmt.Errorf("gcp kms: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return evm.Signature{}, fmt.Errorf("gcp kms: %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	var out struct {
+		Signature string `json:"signature"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return evm.Signature{}, fmt.Errorf("gcp kms: decode response: %w", err)
+	}
+	der, err := base64.StdEncoding.DecodeString(out.Signature)
+	if err != nil {
+		return evm.Signature{}, fmt.Errorf("gcp kms: decode signature: %w", err)
+	}
+	return digestSignature(der, hash, acct.Address)
+}
+
+func gcpToken(ctx context.Context) (string, error) {
+	if token := os.Getenv("GCP_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpMetadataTokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := remoteClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("no GCP_ACCESS_TOKEN and metadata server unavailable: %w", err)
+	}
+	defer resp.Body.Close()
+	var out struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil || out.AccessToken == "" {
+		return "", fmt.Errorf("metadata token: %s", resp.Status)
+	}
+	return out.AccessToken, nil
+}
@@ -0,0 +1,83 @@
+package signer
+
+import (
+	"context"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// TxSigner signs transactions on the server using keys held by a remote
+// service. The private key never leaves that service.
+type TxSigner interface {
+	SignTx(ctx context.Context, acct Account, tx *evm.Tx) (evm.Signature, error)
+	// SignPayload signs the Keccak-256 hash of payload, as SignTx does a
+	// transaction's signing payload. EIP-712 typed data is signed this way,
+	// with payload 0x1901 || domain separator || struct hash.
+	SignPayload(ctx context.Context, acct Account, payload []byte) (evm.Signature, error)
+}
+
+// IsRemote reports whether accounts of this kind sign on the server.
+//
+// HashiCorp Vault Transit isn't one of them: its keys are NIST curves,
+// Ed25519, and RSA, never secp256k1, so it can't make an Ethereum
+// signature. Keys kept in Vault are used through Web3Signer, which reads
+// them from Vault's key-value store.
+func (k Kind) IsRemote() bool {
+	switch k {
+	case KindAWSKMS, KindGCPKMS, KindWeb3Signer:
+		return true
+	}
+	return false
+}
+
+// For returns the server-side signer for a remote account.
+func For(acct Account) (TxSigner, error) {
+	switch acct.Kind {
+	case KindAWSKMS:
+		return awsKMS{}, nil
+	case KindGCPKMS:
+		return gcpKMS{}, nil
+	case KindWeb3Signer:
+		return web3Signer{}, nil
+	case KindLedger, KindTrezor, KindAirGap:
+		return nil, fmt.Errorf("%s accounts sign on the device, not on the server", acct.Kind)
+	case KindWatch:
+		return nil, fmt.Errorf("%s is watch-only and can't sign", acct.Address)
+	}
+	return nil, fmt.Errorf("unknown signer kind %q", acct.Kind)
+}
+
+var remoteClient = &http.Client{Timeout: 15 * time.Second}
+
+// digestSignature turns an ASN.1 DER ECDSA signature over hash (as returned by
+// cloud KMS services) into an Ethereum signature: S is normalized to the lower
+// half of the curve order and the recovery parity is found by trying both
+// values against the account's address.
+func digestSignature(der []byte, hash []byte, address string) (evm.Signature, error) {
+	var parsed struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(der, &parsed); err != nil {
+		return evm.Signature{}, fmt.Errorf("parse DER signature: %w", err)
+	}
+	n := secp256k1.S256().Params().N
+	halfN := new(big.Int).Rsh(n, 1)
+	if parsed.S.Cmp(halfN) > 0 {
+		parsed.S = new(big.Int).Sub(n, parsed.S)
+	}
+	want, err := evm.ParseAddress(address)
+	if err != nil {
+		return evm.Signature{}, err
+	}
+	for v := byte(0); v <= 1; v++ {
+		sig := evm.Signature{YParity: v, R: parsed.R, S: parsed.S}
+		if got, err := evm.RecoverAddress(hash, sig); err == nil && got == want {
+			return sig, nil
+		}
+	}
+	return evm.Signature{}, fmt.Errorf("key does not belong to %s", address)
+}
@@ -0,0 +1,347 @@
+package signer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kind identifies the signer backing an account.
+type Kind string
+
+const (
+	// KindLedger accounts live on a Ledger device and sign through WebHID in the dashboard.
+	KindLedger Kind = "ledger"
+	// KindTrezor accounts live on a Trezor device and sign through Trezor Connect in the dashboard.
+	KindTrezor Kind = "trezor"
+	// KindAirGap accounts live on an air-gapped device such as Keystone, which
+	// scans transactions from QR codes in the dashboard and shows its signature as one.
+	KindAirGap Kind = "airgap"
+	// KindAWSKMS accounts sign on the server with an AWS KMS secp256k1 key.
+	KindAWSKMS Kind = "aws-kms"
+	// KindGCPKMS accounts sign on the server with a Cloud KMS secp256k1 key.
+	KindGCPKMS Kind = "gcp-kms"
+	// KindWeb3Signer accounts sign on the server through a Web3Signer instance.
+	KindWeb3Signer Kind = "web3signer"
+	// KindWatch accounts are watch-only: the dashboard shows their balances
+	// and history, but nothing can sign for them. Rotated keys end up here.
+	KindWatch Kind = "watch"
+)
+
+// Account is an address controlled by a signer other than the browser vault.
+type Account struct {
+	Address     string    `json:"address"`
+	Label       string    `json:"label"`
+	Kind        Kind      `json:"kind"`
+	Path        string    `json:"path,omitempty"`        // hardware: BIP-32 derivation path, e.g. "m/44'/60'/0'/0/0"
+	Fingerprint string    `json:"fingerprint,omitempty"` // airgap: master key fingerprint, 8 hex digits
+	KeyID       string    `json:"key_id,omitempty"`      // remote: KMS key ID/ARN, key version name, or Web3Signer identifier
+	Region      string    `json:"region,omitempty"`      // aws-kms: overrides AWS_REGION
+	URL         string    `json:"url,omitempty"`         // web3signer: base URL
+	CreatedAt   time.Time `json:"created_at"`
+
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // set while in the recycle bin
+}
+
+// Signer is a source of accounts that can sign transactions and EIP-712 data.
+// Hardware signers sign on the device via the dashboard, so the server only
+// keeps their accounts; remote signers also implement TxSigner. The server
+// never sees key material.
+type Signer interface {
+	Kind() Kind
+	Accounts() []Account
+}
+
+var (
+	addressRe = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+	pathRe    = regexp.MustCompile(`^m(/[0-9]+'?)+$`)
+	fingerRe  = regexp.MustCompile(`^[0-9a-fA-F]{8}$`)
+)
+
+// Store manages signer accounts persisted to a JSON file.
+type Store struct {
+	mu       sync.RWMutex
+	accounts []Account
+	path     string
+}
+
+// NewStore loads accounts from a JSON file. If the file doesn't exist, starts empty.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.accounts = []Account{}
+			return s, nil
+		}
+		return nil, fmt.Errorf("read accounts: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.accounts); err != nil {
+		return nil, fmt.Errorf("parse accounts: %w", err)
+	}
+	return s, nil
+}
+
+// List returns all registered accounts, excluding deleted ones.
+func (s *Store) List() []Account {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Account, 0, len(s.accounts))
+	for _, acct := range s.accounts {
+		if acct.DeletedAt == nil {
+			out = append(out, acct)
+		}
+	}
+	return out
+}
+
+// Trash returns deleted accounts that can still be restored.
+func (s *Store) Trash() []Account {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []Account{}
+	for _, acct := range s.accounts {
+		if acct.DeletedAt != nil {
+			out = append(out, acct)
+		}
+	}
+	return out
+}
+
+// Signer returns a view of the store restricted to accounts of one kind.
+func (s *Store) Signer(kind Kind) Signer {
+	return &storeSigner{store: s, kind: kind}
+}
+
+// check validates acct for its kind and trims its label.
+func check(acct *Account) error {
+	if !addressRe.MatchString(acct.Address) {
+		return fmt.Errorf("invalid address")
+	}
+	switch acct.Kind {
+	case KindLedger, KindTrezor:
+		if !pathRe.MatchString(acct.Path) {
+			return fmt.Errorf("invalid derivation path %q", acct.Path)
+		}
+	case KindAirGap:
+		if !pathRe.MatchString(acct.Path) {
+			return fmt.Errorf("invalid derivation path %q", acct.Path)
+		}
+		// The device signs only for its own fingerprint.
+		if !fingerRe.MatchString(acct.Fingerprint) {
+			return fmt.Errorf("invalid fingerprint %q: want 8 hex digits", acct.Fingerprint)
+		}
+		acct.Fingerprint = strings.ToLower(acct.Fingerprint)
+	case KindAWSKMS, KindGCPKMS:
+		if acct.KeyID == "" {
+			return fmt.Errorf("key_id is required for %s accounts", acct.Kind)
+		}
+	case KindWeb3Signer:
+		if _, err := url.ParseRequestURI(acct.URL); err != nil {
+			return fmt.Errorf("invalid web3signer url: %w", err)
+		}
+	case KindWatch:
+	default:
+		return fmt.Errorf("unknown signer kind %q", acct.Kind)
+	}
+	acct.Label = strings.TrimSpace(acct.Label)
+	if acct.Label == "" {
+		return fmt.Errorf("label is required")
+	}
+	return nil
+}
+
+// Add registers a new account. Addresses are unique across all signers.
+func (s *Store) Add(acct Account) (Account, error) {
+	if err := check(&acct); err != nil {
+		return Account{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing := s.findLocked(acct.Address); existing != nil {
+		if existing.DeletedAt == nil {
+			return Account{}, fmt.Errorf("account %s already exists", acct.Address)
+		}
+		// Re-adding an account in the recycle bin replaces it.
+		s.removeLocked(existing.Address)
+	}
+	acct.CreatedAt = time.Now().UTC()
+
+	old := s.accounts
+	s.accounts = append(s.accounts[:len(s.accounts):len(s.accounts)], acct)
+	if err := s.save(); err != nil {
+		s.accounts = old
+		return Account{}, err
+	}
+	return acct, nil
+}
+
+// Put stores acct, replacing any account with its address, including one in
+// the recycle bin. Unlike Add it keeps the account's creation time, so it
+// can restore accounts from a backup.
+func (s *Store) Put(acct Account) (Account, error) {
+	if err := check(&acct); err != nil {
+		return Account{}, err
+	}
+	if acct.CreatedAt.IsZero() {
+		acct.CreatedAt = time.Now().UTC()
+	}
+	acct.DeletedAt = nil
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := s.accounts
+	s.removeLocked(acct.Address)
+	s.accounts = append(s.accounts[:len(s.accounts):len(s.accounts)], acct)
+	if err := s.save(); err != nil {
+		s.accounts = old
+		return Account{}, err
+	}
+	return acct, nil
+}
+
+// Get returns the account with the given address.
+func (s *Store) Get(address string) (Account, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if acct := s.findLocked(address); acct != nil && acct.DeletedAt == nil {
+		return *acct, true
+	}
+	return Account{}, false
+}
+
+// Rename changes an account's label.
+func (s *Store) Rename(address, label string) (Account, error) {
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return Account{}, fmt.Errorf("label is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acct := s.findLocked(address)
+	if acct == nil || acct.DeletedAt != nil {
+		return Account{}, fmt.Errorf("account %q not found", address)
+	}
+	old := acct.Label
+	acct.Label = label
+	if err := s.save(); err != nil {
+		acct.Label = old
+		return Account{}, err
+	}
+	return *acct, nil
+}
+
+// Delete moves an account to the recycle bin.
+func (s *Store) Delete(address string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acct := s.findLocked(address)
+	if acct == nil || acct.DeletedAt != nil {
+		return fmt.Errorf("account %q not found", address)
+	}
+	now := time.Now().UTC()
+	acct.DeletedAt = &now
+	if err := s.save(); err != nil {
+		acct.DeletedAt = nil
+		return err
+	}
+	return nil
+}
+
+// Restore brings a deleted account back from the recycle bin.
+func (s *Store) Restore(address string) (Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acct := s.findLocked(address)
+	if acct == nil || acct.DeletedAt == nil {
+		return Account{}, fmt.Errorf("deleted account %q not found", address)
+	}
+	deletedAt := acct.DeletedAt
+	acct.DeletedAt = nil
+	if err := s.save(); err != nil {
+		acct.DeletedAt = deletedAt
+		return Account{}, err
+	}
+	return *acct, nil
+}
+
+// Purge permanently removes a deleted account.
+func (s *Store) Purge(address string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acct := s.findLocked(address)
+	if acct == nil || acct.DeletedAt == nil {
+		return fmt.Errorf("deleted account %q not found", address)
+	}
+	old := s.accounts
+	s.removeLocked(address)
+	if err := s.save(); err != nil {
+		s.accounts = old
+		return err
+	}
+	return nil
+}
+
+// removeLocked drops an account from the slice without saving. Must be called with mu held.
+func (s *Store) removeLocked(address string) {
+	for i, acct := range s.accounts {
+		if strings.EqualFold(acct.Address, address) {
+			s.accounts = append(s.accounts[:i:i], s.accounts[i+1:]...)
+			return
+		}
+	}
+}
+
+// findLocked finds an account by address, case-insensitively, including
+// deleted ones. Must be called with mu held.
+func (s *Store) findLocked(address string) *Account {
+	for i := range s.accounts {
+		if strings.EqualFold(s.accounts[i].Address, address) {
+			return &s.accounts[i]
+		}
+	}
+	return nil
+}
+
+// save writes the current accounts to disk. Must be called with mu held.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.accounts, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal accounts: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("write accounts: %w", err)
+	}
+	return nil
+}
+
+type storeSigner struct {
+	store *Store
+	kind  Kind
+}
+
+func (s *storeSigner) Kind() Kind { return s.kind }
+
+func (s *storeSigner) Accounts() []Account {
+	var out []Account
+	for _, acct := range s.store.List() {
+		if acct.Kind == s.kind {
+			out = append(out, acct)
+		}
+	}
+	return out
+}
@@ -0,0 +1,54 @@
+package signer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// web3Signer signs through a Consensys Web3Signer instance at Account.URL
+// using its eth1 API. Web3Signer hashes the payload itself, so the unsigned
+// transaction is sent rather than its hash.
+type web3Signer struct{}
+
+func (w web3Signer) SignTx(ctx context.Context, acct Account, tx *evm.Tx) (evm.Signature, error) {
+	return w.SignPayload(ctx, acct, tx.SigningPayload())
+}
+
+func (web3Signer) SignPayload(ctx context.Context, acct Account, payload []byte) (evm.Signature, error) {
+	body, err := json.Marshal(map[string]string{"data": evm.EncodeHex(payload)})
+	if err != nil {
+		return evm.Signature{}, err
+	}
+	identifier := acct.KeyID
+	if identifier == "" {
+		identifier = acct.Address
+	}
+	url := strings.TrimRight(acct.URL, "/") + "/api/v1/eth1/sign/" + identifier
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return evm.Signature{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := remoteClient.Do(req)
+	if err != nil {
+		return evm.Signature{}, fmt.Errorf("web3signer: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return evm.Signature{}, fmt.Errorf("web3signer: %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	sig, err := evm.ParseSignature(string(data))
+	if err != nil {
+		return evm.Signature{}, fmt.Errorf("web3signer: %w", err)
+	}
+	return sig, nil
+}
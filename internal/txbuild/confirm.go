@@ -0,0 +1,81 @@
+package txbuild
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// ConfirmSuffixLen is how many trailing characters of the recipient address
+// a Confirmation repeats.
+const ConfirmSuffixLen = 6
+
+// ErrConfirmRequired is returned by Confirmation.Check when no confirmation
+// was given.
+var ErrConfirmRequired = errors.New("confirmation required: re-type the last 6 characters of the recipient address and the amount")
+
+// Confirmation is what a sender re-types before the server signs a large
+// send or a token transfer: the end of the recipient address and the
+// amount. It is deliberate
+// friction against a pasted-over address or a slipped decimal point.
+type Confirmation struct {
+	ToSuffix string `json:"to_suffix"`
+	Value    string `json:"value"` // whole units of the native currency or token, e.g. "2.5"
+}
+
+// ConfirmTarget is what a Confirmation must repeat: the recipient and the
+// native value, or for a call that hands over tokens (see DecodeTokenMove),
+// the token recipient and amount.
+type ConfirmTarget struct {
+	To       string `json:"to"`
+	Amount   string `json:"amount,omitempty"` // base units, in decimal; empty when a token call carries none
+	Decimals int    `json:"decimals"`         // of the amount as typed
+}
+
+// Target returns what a Confirmation of env repeats. nativeDecimals are
+// those of the endpoint's native currency; tokenDecimals, those of the
+// token env calls, or 0 to have its amounts typed in base units.
+func Target(env *Envelope, nativeDecimals, tokenDecimals int) ConfirmTarget {
+	if data, err := evm.DecodeHex(env.Tx.Data); err == nil {
+		if move, ok := DecodeTokenMove(data); ok {
+			t := ConfirmTarget{To: move.To, Decimals: tokenDecimals}
+			if move.Amount != nil {
+				t.Amount = move.Amount.String()
+			}
+			return t
+		}
+	}
+	t := ConfirmTarget{To: env.Tx.To, Amount: "0", Decimals: nativeDecimals}
+	if value, err := evm.ParseQuantity(env.Tx.Value); err == nil {
+		t.Amount = value.String()
+	}
+	return t
+}
+
+// Check reports whether c repeats want.
+func (c *Confirmation) Check(want ConfirmTarget) error {
+	if c == nil || (c.ToSuffix == "" && c.Value == "") {
+		return ErrConfirmRequired
+	}
+	to := strings.TrimPrefix(strings.ToLower(want.To), "0x")
+	if len(to) > ConfirmSuffixLen {
+		to = to[len(to)-ConfirmSuffixLen:]
+	}
+	if !strings.EqualFold(strings.TrimPrefix(strings.TrimSpace(c.ToSuffix), "0x"), to) {
+		return errors.New("confirmation does not match: the recipient address ends differently")
+	}
+	if want.Amount == "" {
+		return nil
+	}
+	typed, err := evm.ParseUnits(c.Value, want.Decimals)
+	if err != nil {
+		return errors.New("confirmation does not match: the amount is not a number")
+	}
+	amount, ok := new(big.Int).SetString(want.Amount, 10)
+	if !ok || typed.Cmp(amount) != 0 {
+		return errors.New("confirmation does not match: the amount differs")
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package txbuild
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"sync"
+
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// Rollups whose L1 data fee Build estimates.
+const (
+	RollupOP       = "op"       // OP stack: Optimism, Base, and other chains with the GasPriceOracle predeploy
+	RollupArbitrum = "arbitrum" // Arbitrum One, Nova, and Orbit chains
+)
+
+var (
+	// gasPriceOracle is the OP stack predeploy that prices L1 data.
+	gasPriceOracle = "0x420000000000000000000000000000000000000F"
+	// nodeInterface is Arbitrum's virtual contract for node-side estimates.
+	// It has no code; nodes answer eth_call to it directly.
+	nodeInterface = "0x00000000000000000000000000000000000000C8"
+
+	selGetL1Fee               = evm.Keccak256([]byte("getL1Fee(bytes)"))[:4]
+	selGasEstimateL1Component = evm.Keccak256([]byte("gasEstimateL1Component(address,bool,bytes)"))[:4]
+)
+
+// errShortResult is a call that returned less than expected, as a call to
+// NodeInterface does on a chain that isn't Arbitrum.
+var errShortResult = errors.New("short result")
+
+// rollups caches which rollup each chain is, by decimal chain ID. Chains
+// that are neither map to "".
+var rollups sync.Map
+
+// L1Fee is what a rollup charges to post a transaction's data to L1. On the
+// OP stack it is charged on top of gas × gas price, so an estimate from
+// eth_estimateGas alone falls short. On Arbitrum eth_estimateGas already
+// includes it as extra gas, shown here as Gas.
+type L1Fee struct {
+	Rollup   string `json:"rollup"`        // op or arbitrum
+	Fee      string `json:"fee"`           // hex wei at build time; it moves with the L1 base fee
+	Included bool   `json:"included"`      // already paid for by tx.gas
+	Gas      string `json:"gas,omitempty"` // hex; the part of tx.gas that pays for L1 data, on Arbitrum
+}
+
+// estimateL1Fee returns tx's L1 data fee on a rollup, or nil on any other
+// chain.
+func estimateL1Fee(ctx context.Context, ep endpoint.Endpoint, tx *evm.Tx) (*L1Fee, error) {
+	rollup, err := detectRollup(ctx, ep, tx.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	switch rollup {
+	case RollupOP:
+		// getL1Fee takes the unsigned transaction and allows for the
+		// signature itself.
+		out, err := endpoint.EthCall(ctx, ep, gasPriceOracle, selGetL1Fee, dynamicBytes(tx.SigningPayload(), 1))
+		if err != nil {
+			return nil, fmt.Errorf("GasPriceOracle.getL1Fee: %w", err)
+		}
+		if len(out) < 32 {
+			return nil, fmt.Errorf("GasPriceOracle.getL1Fee: short result")
+		}
+		return &L1Fee{Rollup: rollup, Fee: evm.EncodeQuantity(new(big.Int).SetBytes(out[:32]))}, nil
+	case RollupArbitrum:
+		out, err := l1Component(ctx, ep, tx)
+		if err != nil {
+			return nil, fmt.Errorf("NodeInterface.gasEstimateL1Component: %w", err)
+		}
+		gas := new(big.Int).SetBytes(out[:32])
+		baseFee := new(big.Int).SetBytes(out[32:64])
+		return &L1Fee{
+			Rollup:   rollup,
+			Fee:      evm.EncodeQuantity(new(big.Int).Mul(gas, baseFee)),
+			Included: true,
+			Gas:      evm.EncodeQuantity(gas),
+		}, nil
+	}
+	return nil, nil
+}
+
+// detectRollup works out whether a chain is an OP stack chain, from the
+// GasPriceOracle's code, or an Arbitrum chain, from NodeInterface answering
+// a call. Chains with no code at the oracle return empty output for the
+// call. The answer is cached per chain.
+func detectRollup(ctx context.Context, ep endpoint.Endpoint, chainID *big.Int) (string, error) {
+	key := chainID.String()
+	if r, ok := rollups.Load(key); ok {
+		return r.(string), nil
+	}
+	result, err := endpoint.RPCCall(ctx, ep, "eth_getCode", []any{gasPriceOracle, "latest"})
+	if err != nil {
+		return "", err
+	}
+	var code string
+	if err := json.Unmarshal(result, &code); err != nil {
+		return "", fmt.Errorf("unexpected eth_getCode result: %s", result)
+	}
+	rollup := ""
+	if b, _ := evm.DecodeHex(code); len(b) > 0 {
+		rollup = RollupOP
+	} else if _, err := l1Component(ctx, ep, &evm.Tx{ChainID: chainID}); err == nil {
+		rollup = RollupArbitrum
+	} else if !errors.Is(err, errShortResult) {
+		// Only Arbitrum nodes answer NodeInterface, but a failed call could
+		// be either; ask again next time.
+		return "", nil
+	}
+	rollups.Store(key, rollup)
+	return rollup, nil
+}
+
+// l1Component calls NodeInterface.gasEstimateL1Component for tx and returns
+// its three result words: L1 gas, L2 base fee, and L1 base fee estimate.
+func l1Component(ctx context.Context, ep endpoint.Endpoint, tx *evm.Tx) ([]byte, error) {
+	to := make([]byte, 32)
+	creation := make([]byte, 32)
+	if tx.To != nil {
+		copy(to[12:], tx.To[:])
+	} else {
+		creation[31] = 1
+	}
+	out, err := endpoint.EthCall(ctx, ep, nodeInterface, selGasEstimateL1Component, to, creation, dynamicBytes(tx.Data, 3))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) < 96 {
+		return nil, errShortResult
+	}
+	return out, nil
+}
+
+// dynamicBytes ABI-encodes b as the last of head arguments: its offset,
+// then its length and padded contents.
+func dynamicBytes(b []byte, head int) []byte {
+	offset := big.NewInt(int64(32 * head)).FillBytes(make([]byte, 32))
+	n := big.NewInt(int64(len(b))).FillBytes(make([]byte, 32))
+	padded := make([]byte, (len(b)+31)/32*32)
+	copy(padded, b)
+	return slices.Concat(offset, n, padded)
+}
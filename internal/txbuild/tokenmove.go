@@ -0,0 +1,75 @@
+package txbuild
+
+import (
+	"math/big"
+
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// TokenMove is what a call to a token contract hands over.
+type TokenMove struct {
+	// To is who gets the tokens or the allowance: the recipient, spender,
+	// or operator.
+	To string
+	// Amount is the raw amount, for ERC-20 calls and ERC-1155 single
+	// transfers; nil when the call carries no amount, as for ERC-721 and
+	// batch transfers and operator approvals. transferFrom is read as
+	// ERC-20's, though for an ERC-721 contract the amount is a token ID.
+	Amount *big.Int
+}
+
+// tokenSelectors maps the selectors of calls that move or grant tokens to
+// the argument word holding To and the one holding the amount, -1 for none.
+var tokenSelectors = map[string]struct{ to, amount int }{
+	"0xa9059cbb": {0, 1},  // transfer(address,uint256)
+	"0x23b872dd": {1, 2},  // transferFrom(address,address,uint256)
+	"0x095ea7b3": {0, 1},  // approve(address,uint256)
+	"0x39509351": {0, 1},  // increaseAllowance(address,uint256)
+	"0x42842e0e": {1, -1}, // safeTransferFrom(address,address,uint256)
+	"0xb88d4fde": {1, -1}, // safeTransferFrom(address,address,uint256,bytes)
+	"0xf242432a": {1, 3},  // safeTransferFrom(address,address,uint256,uint256,bytes)
+	"0x2eb2c2d6": {1, -1}, // safeBatchTransferFrom(address,address,uint256[],uint256[],bytes)
+	"0xa22cb465": {0, 1},  // setApprovalForAll(address,bool)
+}
+
+// DecodeTokenMove reads calldata that moves or grants tokens: ERC-20
+// transfers and approvals, ERC-721 and ERC-1155 transfers, and operator
+// approvals. It reports false for any other call, and for revocations,
+// an approval of zero or setApprovalForAll(false), which hand nothing over.
+func DecodeTokenMove(data []byte) (TokenMove, bool) {
+	if len(data) < 4 {
+		return TokenMove{}, false
+	}
+	sel := evm.EncodeHex(data[:4])
+	args, ok := tokenSelectors[sel]
+	if !ok {
+		return TokenMove{}, false
+	}
+	word := func(i int) []byte {
+		if len(data) < 4+32*(i+1) {
+			return nil
+		}
+		return data[4+32*i : 4+32*(i+1)]
+	}
+	to := word(args.to)
+	if to == nil {
+		return TokenMove{}, false
+	}
+	var addr evm.Address
+	copy(addr[:], to[12:])
+	move := TokenMove{To: addr.Hex()}
+	if args.amount >= 0 {
+		amount := word(args.amount)
+		if amount == nil {
+			return TokenMove{}, false
+		}
+		n := new(big.Int).SetBytes(amount)
+		if n.Sign() == 0 && (sel == "0x095ea7b3" || sel == "0xa22cb465") {
+			return TokenMove{}, false
+		}
+		if sel != "0xa22cb465" {
+			move.Amount = n
+		}
+	}
+	return move, true
+}
@@ -0,0 +1,507 @@
+// Package txbuild builds unsigned transactions into a portable JSON envelope
+// that can be reviewed and signed on another machine, then imported back for
+// verification and broadcast.
+package txbuild
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/primal-host/wallet/internal/asset"
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+	"github.com/primal-host/wallet/internal/label"
+)
+
+// EnvelopeVersion is the current envelope format version.
+const EnvelopeVersion = 1
+
+// Request describes a transaction to build. Quantities are wei, as decimal or
+// 0x-hex strings. Empty nonce, gas, and fee fields are filled from the endpoint.
+type Request struct {
+	Endpoint             string `json:"endpoint"`
+	From                 string `json:"from"`
+	To                   string `json:"to"` // empty for contract creation
+	Value                string `json:"value"`
+	Data                 string `json:"data"`
+	Nonce                string `json:"nonce"`
+	Gas                  string `json:"gas"`
+	MaxFeePerGas         string `json:"max_fee_per_gas"`
+	MaxPriorityFeePerGas string `json:"max_priority_fee_per_gas"`
+}
+
+// Envelope is an unsigned transaction plus everything needed to review and
+// sign it offline.
+type Envelope struct {
+	Version        int       `json:"version"`
+	Endpoint       string    `json:"endpoint"`
+	ChainID        string    `json:"chain_id"`
+	From           string    `json:"from"`
+	Tx             Fields    `json:"tx"`
+	Summary        Summary   `json:"summary"`
+	SigningPayload string    `json:"signing_payload"` // type byte + RLP, what hardware wallets sign
+	HashToSign     string    `json:"hash_to_sign"`    // keccak256(signing_payload)
+	CreatedAt      time.Time `json:"created_at"`
+
+	// L1Fee is set by Build on rollups. It is advisory and not signed.
+	L1Fee *L1Fee `json:"l1_fee,omitempty"`
+
+	// ConfirmRequired is set by the server when the value is large enough,
+	// or the call hands over tokens, so that signing it there takes a
+	// Confirmation. It is advisory; the
+	// server works it out again when signing.
+	ConfirmRequired bool `json:"confirm_required,omitempty"`
+	// Confirm, set with ConfirmRequired, is what the confirmation repeats.
+	Confirm *ConfirmTarget `json:"confirm,omitempty"`
+
+	// Warnings are set by the server when a recipient is a known scam
+	// address or looks like an address the wallet knows without being it,
+	// and with whatever a risk scanner finds. They are advisory.
+	Warnings []Warning `json:"warnings,omitempty"`
+
+	// Blocked is set by the server when a critical warning means it will
+	// refuse to sign or broadcast the transaction. It is advisory; the
+	// server checks again when signing.
+	Blocked bool `json:"blocked,omitempty"`
+
+	// Labels are set by the server to the profile's names and tags for
+	// the addresses the transaction involves. They are advisory.
+	Labels []label.Label `json:"labels,omitempty"`
+}
+
+// Warning severities.
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Warning is a reason to look twice at a transaction before signing it.
+type Warning struct {
+	Kind     string `json:"kind"` // scam_address, address_poisoning, risk_scan_failed, or a risk scanner's own
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// Fields are the transaction fields as JSON-RPC hex quantities and data.
+type Fields struct {
+	Type                 string `json:"type"`
+	Nonce                string `json:"nonce"`
+	To                   string `json:"to,omitempty"`
+	Value                string `json:"value"`
+	Gas                  string `json:"gas"`
+	MaxFeePerGas         string `json:"max_fee_per_gas"`
+	MaxPriorityFeePerGas string `json:"max_priority_fee_per_gas"`
+	Data                 string `json:"data"`
+}
+
+// Summary is a human-readable description of what the transaction does.
+type Summary struct {
+	Action string `json:"action"` // transfer, token_transfer, approve, contract_call, deploy
+	Value  string `json:"value"`
+	// MaxFee is gas × max fee per gas, plus the L1 data fee on rollups that
+	// charge it on top.
+	MaxFee    string `json:"max_fee"`
+	L1Fee     string `json:"l1_fee,omitempty"`    // rollup L1 data fee, part of MaxFee
+	Method    string `json:"method,omitempty"`    // 4-byte selector for contract calls
+	Recipient string `json:"recipient,omitempty"` // token recipient or spender
+	Amount    string `json:"amount,omitempty"`    // raw token amount
+}
+
+// Signed is the result of importing a signed transaction.
+type Signed struct {
+	Hash string `json:"hash"`
+	Raw  string `json:"raw"`
+	From string `json:"from"`
+}
+
+const (
+	selectorTransfer = "0xa9059cbb"
+	selectorApprove  = "0x095ea7b3"
+)
+
+// defaultPriorityFee is used when the endpoint doesn't support eth_maxPriorityFeePerGas.
+var defaultPriorityFee = big.NewInt(1_500_000_000)
+
+// Build fills in missing fields from the endpoint and returns the envelope.
+func Build(ctx context.Context, ep endpoint.Endpoint, req Request) (*Envelope, error) {
+	from, err := evm.ParseAddress(req.From)
+	if err != nil {
+		return nil, fmt.Errorf("from: %w", err)
+	}
+	tx := &evm.Tx{Value: new(big.Int)}
+	if req.To != "" {
+		to, err := evm.ParseAddress(req.To)
+		if err != nil {
+			return nil, fmt.Errorf("to: %w", err)
+		}
+		tx.To = &to
+	}
+	if req.Value != "" {
+		if tx.Value, err = evm.ParseQuantity(req.Value); err != nil {
+			return nil, fmt.Errorf("value: %w", err)
+		}
+	}
+	if tx.Data, err = evm.DecodeHex(req.Data); err != nil {
+		return nil, fmt.Errorf("data: %w", err)
+	}
+	if tx.To == nil && len(tx.Data) == 0 {
+		return nil, fmt.Errorf("to is required unless deploying a contract")
+	}
+
+	chainID, err := quantityCall(ctx, ep, "eth_chainId", nil)
+	if err != nil {
+		return nil, fmt.Errorf("chain id: %w", err)
+	}
+	tx.ChainID = chainID
+
+	nonce, err := quantityOr(req.Nonce, func() (*big.Int, error) {
+		return quantityCall(ctx, ep, "eth_getTransactionCount", []any{from.Hex(), "pending"})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("nonce: %w", err)
+	}
+	tx.Nonce = nonce.Uint64()
+
+	// eth_feeHistory gives the next block's base fee rather than the last
+	// one's, and recent tips for nodes without eth_maxPriorityFeePerGas.
+	var hist *fees
+	if caps, ok := endpoint.Cached(ep); ok && caps.FeeHistory && (req.MaxPriorityFeePerGas == "" || req.MaxFeePerGas == "") {
+		hist, _ = feeHistory(ctx, ep)
+	}
+	tx.MaxPriorityFeePerGas, err = quantityOr(req.MaxPriorityFeePerGas, func() (*big.Int, error) {
+		if tip, err := quantityCall(ctx, ep, "eth_maxPriorityFeePerGas", nil); err == nil {
+			return tip, nil
+		}
+		if hist != nil && hist.tip != nil {
+			return hist.tip, nil
+		}
+		return defaultPriorityFee, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("max priority fee: %w", err)
+	}
+	tx.MaxFeePerGas, err = quantityOr(req.MaxFeePerGas, func() (*big.Int, error) {
+		baseFee, err := nextBaseFee(ctx, ep, hist)
+		if err != nil {
+			return nil, err
+		}
+		// Allow the base fee to double before the transaction is priced out.
+		return new(big.Int).Add(new(big.Int).Mul(baseFee, big.NewInt(2)), tx.MaxPriorityFeePerGas), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("max fee: %w", err)
+	}
+	if tx.MaxFeePerGas.Cmp(tx.MaxPriorityFeePerGas) < 0 {
+		return nil, fmt.Errorf("max fee per gas is below max priority fee per gas")
+	}
+
+	gas, err := quantityOr(req.Gas, func() (*big.Int, error) {
+		call := map[string]string{"from": from.Hex(), "value": evm.EncodeQuantity(tx.Value)}
+		if tx.To != nil {
+			call["to"] = tx.To.Hex()
+		}
+		if len(tx.Data) > 0 {
+			call["data"] = evm.EncodeHex(tx.Data)
+		}
+		return quantityCall(ctx, ep, "eth_estimateGas", []any{call})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("gas: %w", err)
+	}
+	tx.Gas = gas.Uint64()
+
+	l1Fee, err := estimateL1Fee(ctx, ep, tx)
+	if err != nil {
+		return nil, fmt.Errorf("l1 fee: %w", err)
+	}
+	env := NewEnvelope(ep, from, tx)
+	if l1Fee != nil {
+		env.setL1Fee(l1Fee, tx, ep.Native)
+	}
+	return env, nil
+}
+
+// NewEnvelope wraps a fully populated transaction.
+func NewEnvelope(ep endpoint.Endpoint, from evm.Address, tx *evm.Tx) *Envelope {
+	env := &Envelope{
+		Version:  EnvelopeVersion,
+		Endpoint: ep.ID,
+		ChainID:  evm.EncodeQuantity(tx.ChainID),
+		From:     from.Hex(),
+		Tx: Fields{
+			Type:                 "0x2",
+			Nonce:                evm.EncodeQuantity(new(big.Int).SetUint64(tx.Nonce)),
+			Value:                evm.EncodeQuantity(tx.Value),
+			Gas:                  evm.EncodeQuantity(new(big.Int).SetUint64(tx.Gas)),
+			MaxFeePerGas:         evm.EncodeQuantity(tx.MaxFeePerGas),
+			MaxPriorityFeePerGas: evm.EncodeQuantity(tx.MaxPriorityFeePerGas),
+			Data:                 evm.EncodeHex(tx.Data),
+		},
+		Summary:        summarize(tx, ep.Native),
+		SigningPayload: evm.EncodeHex(tx.SigningPayload()),
+		HashToSign:     evm.EncodeHex(tx.SigningHash()),
+		CreatedAt:      time.Now().UTC(),
+	}
+	if tx.To != nil {
+		env.Tx.To = tx.To.Hex()
+	}
+	return env
+}
+
+// setL1Fee records a rollup's L1 data fee and adds it to the summary's max
+// fee when gas doesn't already cover it.
+func (env *Envelope) setL1Fee(fee *L1Fee, tx *evm.Tx, native asset.Asset) {
+	env.L1Fee = fee
+	amount, _ := evm.ParseQuantity(fee.Fee)
+	env.Summary.L1Fee = native.Format(amount)
+	if !fee.Included {
+		maxFee := new(big.Int).Mul(tx.MaxFeePerGas, new(big.Int).SetUint64(tx.Gas))
+		env.Summary.MaxFee = native.Format(maxFee.Add(maxFee, amount))
+	}
+}
+
+// Transaction reconstructs the transaction from the envelope fields and checks
+// that the payload and hash in the envelope match them, so an edited field
+// can't slip past a reviewer who only compared the hash.
+func (env *Envelope) Transaction() (*evm.Tx, error) {
+	if env.Version != EnvelopeVersion {
+		return nil, fmt.Errorf("unsupported envelope version %d", env.Version)
+	}
+	if env.Tx.Type != "0x2" {
+		return nil, fmt.Errorf("unsupported transaction type %q", env.Tx.Type)
+	}
+	tx := &evm.Tx{}
+	var err error
+	if tx.ChainID, err = evm.ParseQuantity(env.ChainID); err != nil {
+		return nil, fmt.Errorf("chain_id: %w", err)
+	}
+	nonce, err := evm.ParseQuantity(env.Tx.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("nonce: %w", err)
+	}
+	tx.Nonce = nonce.Uint64()
+	if env.Tx.To != "" {
+		to, err := evm.ParseAddress(env.Tx.To)
+		if err != nil {
+			return nil, fmt.Errorf("to: %w", err)
+		}
+		tx.To = &to
+	}
+	if tx.Value, err = evm.ParseQuantity(env.Tx.Value); err != nil {
+		return nil, fmt.Errorf("value: %w", err)
+	}
+	gas, err := evm.ParseQuantity(env.Tx.Gas)
+	if err != nil {
+		return nil, fmt.Errorf("gas: %w", err)
+	}
+	tx.Gas = gas.Uint64()
+	if tx.MaxFeePerGas, err = evm.ParseQuantity(env.Tx.MaxFeePerGas); err != nil {
+		return nil, fmt.Errorf("max_fee_per_gas: %w", err)
+	}
+	if tx.MaxPriorityFeePerGas, err = evm.ParseQuantity(env.Tx.MaxPriorityFeePerGas); err != nil {
+		return nil, fmt.Errorf("max_priority_fee_per_gas: %w", err)
+	}
+	if tx.Data, err = evm.DecodeHex(env.Tx.Data); err != nil {
+		return nil, fmt.Errorf("data: %w", err)
+	}
+
+	if !strings.EqualFold(evm.EncodeHex(tx.SigningPayload()), env.SigningPayload) {
+		return nil, fmt.Errorf("signing_payload does not match transaction fields")
+	}
+	if !strings.EqualFold(evm.EncodeHex(tx.SigningHash()), env.HashToSign) {
+		return nil, fmt.Errorf("hash_to_sign does not match transaction fields")
+	}
+	return tx, nil
+}
+
+// Import verifies a signed transaction against its envelope. Either raw (the
+// full signed transaction) or sig must be provided. The signer must be the
+// envelope's from address.
+func Import(env *Envelope, raw string, sig *evm.Signature) (*Signed, error) {
+	tx, err := env.Transaction()
+	if err != nil {
+		return nil, err
+	}
+	from, err := evm.ParseAddress(env.From)
+	if err != nil {
+		return nil, fmt.Errorf("from: %w", err)
+	}
+
+	var signature evm.Signature
+	switch {
+	case raw != "":
+		b, err := evm.DecodeHex(raw)
+		if err != nil {
+			return nil, fmt.Errorf("raw: %w", err)
+		}
+		signedTx, s, err := evm.DecodeSignedTx(b)
+		if err != nil {
+			return nil, fmt.Errorf("raw: %w", err)
+		}
+		if !bytes.Equal(signedTx.SigningPayload(), tx.SigningPayload()) {
+			return nil, fmt.Errorf("signed transaction does not match the envelope")
+		}
+		signature = s
+	case sig != nil:
+		signature = *sig
+	default:
+		return nil, fmt.Errorf("raw signed transaction or signature is required")
+	}
+
+	signer, err := tx.Sender(signature)
+	if err != nil {
+		return nil, err
+	}
+	if signer != from {
+		return nil, fmt.Errorf("signed by %s, expected %s", signer.Hex(), from.Hex())
+	}
+	return &Signed{
+		Hash: evm.EncodeHex(tx.Hash(signature)),
+		Raw:  evm.EncodeHex(tx.EncodeSigned(signature)),
+		From: signer.Hex(),
+	}, nil
+}
+
+// summarize decodes the common cases: native transfers, ERC-20 transfer and
+// approve, contract calls, and deployments.
+func summarize(tx *evm.Tx, native asset.Asset) Summary {
+	maxFee := new(big.Int).Mul(tx.MaxFeePerGas, new(big.Int).SetUint64(tx.Gas))
+	sum := Summary{
+		Value:  native.Format(tx.Value),
+		MaxFee: native.Format(maxFee),
+	}
+	switch {
+	case tx.To == nil:
+		sum.Action = "deploy"
+	case len(tx.Data) == 0:
+		sum.Action = "transfer"
+		sum.Recipient = tx.To.Hex()
+	default:
+		sum.Action = "contract_call"
+		if len(tx.Data) >= 4 {
+			sum.Method = evm.EncodeHex(tx.Data[:4])
+		}
+		if len(tx.Data) == 4+64 && (sum.Method == selectorTransfer || sum.Method == selectorApprove) {
+			var who evm.Address
+			copy(who[:], tx.Data[4+12:4+32])
+			sum.Recipient = who.Hex()
+			sum.Amount = new(big.Int).SetBytes(tx.Data[4+32:]).String()
+			sum.Action = "token_transfer"
+			if sum.Method == selectorApprove {
+				sum.Action = "approve"
+			}
+		}
+	}
+	return sum
+}
+
+// Broadcast submits a signed raw transaction and returns its hash.
+func Broadcast(ctx context.Context, ep endpoint.Endpoint, raw string) (string, error) {
+	result, err := endpoint.RPCCall(ctx, ep, "eth_sendRawTransaction", []any{raw})
+	if err != nil {
+		return "", err
+	}
+	var hash string
+	if err := json.Unmarshal(result, &hash); err != nil {
+		return "", fmt.Errorf("unexpected result: %s", result)
+	}
+	return hash, nil
+}
+
+func quantityCall(ctx context.Context, ep endpoint.Endpoint, method string, params []any) (*big.Int, error) {
+	result, err := endpoint.RPCCall(ctx, ep, method, params)
+	if err != nil {
+		return nil, err
+	}
+	var s string
+	if err := json.Unmarshal(result, &s); err != nil {
+		return nil, fmt.Errorf("unexpected %s result: %s", method, result)
+	}
+	return evm.ParseQuantity(s)
+}
+
+// quantityOr parses the provided value, or calls fetch when it's empty.
+func quantityOr(provided string, fetch func() (*big.Int, error)) (*big.Int, error) {
+	if provided != "" {
+		return evm.ParseQuantity(provided)
+	}
+	return fetch()
+}
+
+// feeHistoryBlocks is how many recent blocks' tips are looked at.
+const feeHistoryBlocks = 10
+
+// fees is what eth_feeHistory says about the next block.
+type fees struct {
+	baseFee *big.Int // the next block's
+	tip     *big.Int // the median of recent blocks' median tips; nil when they had none
+}
+
+// feeHistory asks ep for its fee history. Only endpoints found to serve
+// eth_feeHistory are asked.
+func feeHistory(ctx context.Context, ep endpoint.Endpoint) (*fees, error) {
+	result, err := endpoint.RPCCall(ctx, ep, "eth_feeHistory", []any{evm.EncodeQuantity(big.NewInt(feeHistoryBlocks)), "latest", []any{50}})
+	if err != nil {
+		return nil, err
+	}
+	var h struct {
+		BaseFeePerGas []string   `json:"baseFeePerGas"`
+		Reward        [][]string `json:"reward"`
+	}
+	if err := json.Unmarshal(result, &h); err != nil {
+		return nil, fmt.Errorf("decode fee history: %w", err)
+	}
+	if len(h.BaseFeePerGas) == 0 {
+		return nil, fmt.Errorf("endpoint does not support EIP-1559 (no base fee)")
+	}
+	f := &fees{}
+	if f.baseFee, err = evm.ParseQuantity(h.BaseFeePerGas[len(h.BaseFeePerGas)-1]); err != nil {
+		return nil, fmt.Errorf("base fee: %w", err)
+	}
+	var tips []*big.Int
+	for _, r := range h.Reward {
+		if len(r) == 0 {
+			continue
+		}
+		if tip, err := evm.ParseQuantity(r[0]); err == nil && tip.Sign() > 0 {
+			tips = append(tips, tip)
+		}
+	}
+	if len(tips) > 0 {
+		slices.SortFunc(tips, (*big.Int).Cmp)
+		f.tip = tips[len(tips)/2]
+	}
+	return f, nil
+}
+
+// nextBaseFee is the base fee from hist, or else the latest block's.
+func nextBaseFee(ctx context.Context, ep endpoint.Endpoint, hist *fees) (*big.Int, error) {
+	if hist != nil {
+		return hist.baseFee, nil
+	}
+	return latestBaseFee(ctx, ep)
+}
+
+func latestBaseFee(ctx context.Context, ep endpoint.Endpoint) (*big.Int, error) {
+	result, err := endpoint.RPCCall(ctx, ep, "eth_getBlockByNumber", []any{"latest", false})
+	if err != nil {
+		return nil, err
+	}
+	var block struct {
+		BaseFeePerGas string `json:"baseFeePerGas"`
+	}
+	if err := json.Unmarshal(result, &block); err != nil {
+		return nil, fmt.Errorf("decode block: %w", err)
+	}
+	if block.BaseFeePerGas == "" {
+		return nil, fmt.Errorf("endpoint does not support EIP-1559 (no base fee)")
+	}
+	return evm.ParseQuantity(block.BaseFeePerGas)
+}
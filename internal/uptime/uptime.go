@@ -0,0 +1,278 @@
+// Package uptime keeps a history of endpoint checks, so RPC providers can be
+// compared by how often they answered, how fast, and when they were down.
+package uptime
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Retention is how long history is kept.
+const Retention = 90 * 24 * time.Hour
+
+// bucketSize is the span of time checks are counted over together.
+const bucketSize = time.Hour
+
+// latencyBounds are the upper bounds, in milliseconds, of the latency
+// histogram's buckets. Slower answers fall in one more bucket after them.
+var latencyBounds = []int64{25, 50, 100, 150, 200, 300, 500, 750, 1000, 1500, 2500, 5000, 10000}
+
+// bucket counts an hour's checks of one endpoint.
+type bucket struct {
+	Start   time.Time `json:"start"`
+	Checks  int       `json:"checks"`
+	Up      int       `json:"up"`
+	Latency []int     `json:"latency"` // answered checks by latencyBounds bucket
+}
+
+// Outage is a window in which an endpoint didn't answer its checks. It
+// starts at the first failed check and ends at the next one answered.
+type Outage struct {
+	Start time.Time  `json:"start"`
+	End   *time.Time `json:"end,omitempty"` // unset while it lasts
+}
+
+// history is one endpoint's record.
+type history struct {
+	Buckets []bucket  `json:"buckets"`
+	Outages []Outage  `json:"outages"`
+	Last    time.Time `json:"last"` // the latest check recorded
+}
+
+// Store keeps every endpoint's history in a JSON file. Record only marks
+// it changed; Save writes it.
+type Store struct {
+	mu        sync.Mutex
+	endpoints map[string]*history // by endpoint ID
+	dirty     bool
+	path      string
+}
+
+// NewStore loads history from a JSON file. If the file doesn't exist, starts
+// empty.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path, endpoints: map[string]*history{}}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("read uptime history: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.endpoints); err != nil {
+		return nil, fmt.Errorf("parse uptime history: %w", err)
+	}
+	return s, nil
+}
+
+// Record adds a check of the endpoint with the given ID made at at. Checks
+// no later than the last one recorded are ignored, so the same status can
+// be offered again.
+func (s *Store) Record(id string, at time.Time, up bool, latency time.Duration) {
+	if at.IsZero() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, ok := s.endpoints[id]
+	if !ok {
+		h = &history{}
+		s.endpoints[id] = h
+	}
+	if !at.After(h.Last) {
+		return
+	}
+	h.Last = at.UTC()
+	s.dirty = true
+
+	start := at.UTC().Truncate(bucketSize)
+	if n := len(h.Buckets); n == 0 || !h.Buckets[n-1].Start.Equal(start) {
+		h.Buckets = append(h.Buckets, bucket{Start: start, Latency: make([]int, len(latencyBounds)+1)})
+	}
+	b := &h.Buckets[len(h.Buckets)-1]
+	b.Checks++
+
+	down := len(h.Outages) > 0 && h.Outages[len(h.Outages)-1].End == nil
+	if up {
+		b.Up++
+		b.Latency[latencyBucket(latency.Milliseconds())]++
+		if down {
+			end := at.UTC()
+			h.Outages[len(h.Outages)-1].End = &end
+		}
+	} else if !down {
+		h.Outages = append(h.Outages, Outage{Start: at.UTC()})
+	}
+
+	cutoff := at.Add(-Retention)
+	for len(h.Buckets) > 0 && h.Buckets[0].Start.Before(cutoff) {
+		h.Buckets = h.Buckets[1:]
+	}
+	for len(h.Outages) > 0 && h.Outages[0].End != nil && h.Outages[0].End.Before(cutoff) {
+		h.Outages = h.Outages[1:]
+	}
+}
+
+func latencyBucket(ms int64) int {
+	i, _ := slices.BinarySearch(latencyBounds, ms)
+	return i
+}
+
+// Report is an endpoint's uptime since a point in time.
+type Report struct {
+	Since    time.Time `json:"since"`
+	Checks   int       `json:"checks"`
+	Answered int       `json:"answered"`
+
+	// Uptime is the percentage of the time covered by history, from Since
+	// or the first check after it, that fell outside outages.
+	Uptime   float64 `json:"uptime"`
+	Downtime string  `json:"downtime"` // total, as a duration
+
+	// Latency percentiles of answered checks, in milliseconds. Each is
+	// the upper bound of the histogram bucket it falls in; zero when
+	// nothing answered, and -1 when slower than the highest bound.
+	Latency Percentiles `json:"latency_ms"`
+
+	Outages []Outage `json:"outages"` // overlapping the range, oldest first
+}
+
+// Percentiles are latency percentiles in milliseconds.
+type Percentiles struct {
+	P50 int64 `json:"p50"`
+	P90 int64 `json:"p90"`
+	P95 int64 `json:"p95"`
+	P99 int64 `json:"p99"`
+}
+
+// Report summarizes the endpoint's history from since to now, and whether
+// there is any.
+func (s *Store) Report(id string, since, now time.Time) (Report, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, ok := s.endpoints[id]
+	if !ok || len(h.Buckets) == 0 {
+		return Report{}, false
+	}
+	r := Report{Since: since.UTC(), Outages: []Outage{}}
+	hist := make([]int, len(latencyBounds)+1)
+	first := time.Time{}
+	for _, b := range h.Buckets {
+		if b.Start.Add(bucketSize).Before(since) {
+			continue
+		}
+		if first.IsZero() {
+			first = b.Start
+		}
+		r.Checks += b.Checks
+		r.Answered += b.Up
+		for i, n := range b.Latency {
+			hist[i] += n
+		}
+	}
+	first = maxTime(first, since)
+	if first.IsZero() {
+		first = since
+	}
+
+	var down time.Duration
+	for _, o := range h.Outages {
+		end := now
+		if o.End != nil {
+			end = *o.End
+		}
+		if !end.After(first) {
+			continue
+		}
+		r.Outages = append(r.Outages, o)
+		down += end.Sub(maxTime(o.Start, first))
+	}
+	if span := now.Sub(first); span > 0 {
+		r.Uptime = 100 * (1 - down.Seconds()/span.Seconds())
+	}
+	r.Downtime = down.Round(time.Second).String()
+	r.Latency = Percentiles{
+		P50: percentile(hist, 0.50),
+		P90: percentile(hist, 0.90),
+		P95: percentile(hist, 0.95),
+		P99: percentile(hist, 0.99),
+	}
+	return r, true
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// percentile returns the upper bound of the histogram bucket holding the
+// p-th share of its counts.
+func percentile(hist []int, p float64) int64 {
+	total := 0
+	for _, n := range hist {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := int(p*float64(total) + 0.5)
+	seen := 0
+	for i, n := range hist {
+		seen += n
+		if seen >= rank && n > 0 {
+			if i == len(latencyBounds) {
+				return -1
+			}
+			return latencyBounds[i]
+		}
+	}
+	return -1
+}
+
+// ParseRange parses a report range such as "24h", "7d", or "30d".
+func ParseRange(s string) (time.Duration, error) {
+	var d time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid range %q: use hours or days such as 24h or 7d", s)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, fmt.Errorf("invalid range %q: use hours or days such as 24h or 7d", s)
+		}
+	}
+	if d <= 0 || d > Retention {
+		return 0, fmt.Errorf("range must be positive and at most %d days", int(Retention.Hours()/24))
+	}
+	return d, nil
+}
+
+// Save writes the history if it changed since the last save.
+func (s *Store) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirty {
+		return nil
+	}
+	data, err := json.Marshal(s.endpoints)
+	if err != nil {
+		return fmt.Errorf("marshal uptime history: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("write uptime history: %w", err)
+	}
+	s.dirty = false
+	return nil
+}
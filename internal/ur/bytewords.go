@@ -0,0 +1,73 @@
+package ur
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"strings"
+)
+
+// words are the 256 bytewords, in byte order. URs use the minimal form of
+// each word, its first and last letters, which no two words share.
+const words = "able acid also apex aqua arch atom aunt away axis back bald barn belt beta bias blue body " +
+	"brag brew bulb buzz calm cash cats chef city claw code cola cook cost crux curl cusp cyan " +
+	"dark data days deli dice diet door down draw drop drum dull duty each easy echo edge epic " +
+	"even exam exit eyes fact fair fern figs film fish fizz flap flew flux foxy free frog fuel " +
+	"fund gala game gear gems gift girl glow good gray grim guru gush gyro half hang hard hawk " +
+	"heat help high hill holy hope horn huts iced idea idle inch inky into iris iron item jade " +
+	"jazz join jolt jowl judo jugs jump junk jury keep keno kept keys kick kiln king kite kiwi " +
+	"knob lamb lava lazy leaf legs liar limp lion list logo loud love luau luck lung main many " +
+	"math maze memo menu meow mild mint miss monk nail navy need news next noon note numb obey " +
+	"oboe omit onyx open oval owls paid part peck play plus poem pool pose puff puma purr quad " +
+	"quiz race ramp real redo rich road rock roof ruby ruin runs rust safe saga scar sets silk " +
+	"skew slot soap solo song stub surf swan taco task taxi tent tied time tiny toil tomb toys " +
+	"trip tuna twin ugly undo unit urge user vast very veto vial vibe view visa void vows wall " +
+	"wand warm wasp wave waxy webs what when whiz wolf work yank yawn yell yoga yurt zaps zero " +
+	"zest zinc zone zoom"
+
+var (
+	minimal  [256]string    // byte → minimal word
+	minimalB map[string]int // minimal word → byte
+)
+
+func init() {
+	list := strings.Fields(words)
+	minimalB = make(map[string]int, len(list))
+	for i, w := range list {
+		minimal[i] = w[:1] + w[3:]
+		minimalB[minimal[i]] = i
+	}
+}
+
+// encodeWords encodes data and its CRC-32 checksum as minimal bytewords.
+func encodeWords(data []byte) string {
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(data))
+	var b strings.Builder
+	b.Grow(2 * (len(data) + 4))
+	for _, c := range append(append([]byte{}, data...), sum[:]...) {
+		b.WriteString(minimal[c])
+	}
+	return b.String()
+}
+
+// decodeWords decodes minimal bytewords and checks their checksum.
+func decodeWords(s string) ([]byte, error) {
+	s = strings.ToLower(s)
+	if len(s)%2 != 0 || len(s) < 10 {
+		return nil, errors.New("invalid bytewords")
+	}
+	out := make([]byte, len(s)/2)
+	for i := range out {
+		c, ok := minimalB[s[2*i:2*i+2]]
+		if !ok {
+			return nil, errors.New("invalid bytewords")
+		}
+		out[i] = byte(c)
+	}
+	data, sum := out[:len(out)-4], out[len(out)-4:]
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(sum) {
+		return nil, errors.New("bytewords checksum mismatch")
+	}
+	return data, nil
+}
@@ -0,0 +1,169 @@
+package ur
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// The CBOR here is the subset the UR types use: unsigned integers, byte
+// and text strings, arrays, maps, tags, and booleans.
+
+const (
+	majorUint  = 0
+	majorBytes = 2
+	majorText  = 3
+	majorArray = 4
+	majorMap   = 5
+	majorTag   = 6
+	majorOther = 7
+)
+
+// tagged is a CBOR tag and its content.
+type tagged struct {
+	tag uint64
+	v   any
+}
+
+// appendHead appends the head of a CBOR item: its major type and argument.
+func appendHead(b []byte, major byte, n uint64) []byte {
+	m := major << 5
+	switch {
+	case n < 24:
+		return append(b, m|byte(n))
+	case n <= 0xff:
+		return append(b, m|24, byte(n))
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16(append(b, m|25), uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32(append(b, m|26), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(b, m|27), n)
+}
+
+func appendUint(b []byte, n uint64) []byte { return appendHead(b, majorUint, n) }
+
+func appendBytes(b, data []byte) []byte {
+	return append(appendHead(b, majorBytes, uint64(len(data))), data...)
+}
+
+func appendText(b []byte, s string) []byte {
+	return append(appendHead(b, majorText, uint64(len(s))), s...)
+}
+
+func appendBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 0xf5)
+	}
+	return append(b, 0xf4)
+}
+
+// decoder reads CBOR items from a buffer.
+type decoder struct {
+	b []byte
+}
+
+// decode decodes a whole buffer as one CBOR item.
+func decode(b []byte) (any, error) {
+	d := &decoder{b: b}
+	v, err := d.item(0)
+	if err != nil {
+		return nil, err
+	}
+	if len(d.b) != 0 {
+		return nil, errors.New("cbor: trailing data")
+	}
+	return v, nil
+}
+
+func (d *decoder) head() (byte, uint64, error) {
+	if len(d.b) == 0 {
+		return 0, 0, errors.New("cbor: unexpected end")
+	}
+	major, info := d.b[0]>>5, d.b[0]&0x1f
+	d.b = d.b[1:]
+	if info < 24 {
+		return major, uint64(info), nil
+	}
+	if info > 27 {
+		return 0, 0, fmt.Errorf("cbor: unsupported additional info %d", info)
+	}
+	size := 1 << (info - 24)
+	if len(d.b) < size {
+		return 0, 0, errors.New("cbor: unexpected end")
+	}
+	var n uint64
+	for _, c := range d.b[:size] {
+		n = n<<8 | uint64(c)
+	}
+	d.b = d.b[size:]
+	return major, n, nil
+}
+
+func (d *decoder) item(depth int) (any, error) {
+	if depth > 16 {
+		return nil, errors.New("cbor: nested too deeply")
+	}
+	major, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case majorUint:
+		return n, nil
+	case majorBytes, majorText:
+		if n > uint64(len(d.b)) {
+			return nil, errors.New("cbor: unexpected end")
+		}
+		data := d.b[:n]
+		d.b = d.b[n:]
+		if major == majorText {
+			return string(data), nil
+		}
+		return append([]byte{}, data...), nil
+	case majorArray:
+		if n > uint64(len(d.b)) {
+			return nil, errors.New("cbor: unexpected end")
+		}
+		out := make([]any, n)
+		for i := range out {
+			if out[i], err = d.item(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case majorMap:
+		if n > uint64(len(d.b)) {
+			return nil, errors.New("cbor: unexpected end")
+		}
+		out := make(map[uint64]any, n)
+		for range n {
+			k, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(uint64)
+			if !ok {
+				return nil, errors.New("cbor: map keys must be unsigned integers")
+			}
+			if out[key], err = d.item(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case majorTag:
+		v, err := d.item(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return tagged{tag: n, v: v}, nil
+	case majorOther:
+		switch n {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		}
+	}
+	return nil, fmt.Errorf("cbor: unsupported major type %d", major)
+}
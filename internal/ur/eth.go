@@ -0,0 +1,155 @@
+package ur
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// UR types for Ethereum signing (BCR-2021-006 as Keystone implements it).
+const (
+	TypeSignRequest = "eth-sign-request"
+	TypeSignature   = "eth-signature"
+)
+
+// DataTypedTx is the sign request data type of an EIP-2718 transaction,
+// whose sign data is its type byte and RLP.
+const DataTypedTx = 4
+
+// CBOR tags of the registry types.
+const (
+	tagUUID    = 37
+	tagKeypath = 304
+)
+
+// Origin names the wallet on the device's confirmation screen.
+const Origin = "primal-wallet"
+
+var pathRe = regexp.MustCompile(`^m(/[0-9]+'?)+$`)
+
+// SignRequest asks a device to sign a transaction with the key at Path.
+type SignRequest struct {
+	ID          [16]byte
+	Data        []byte // the transaction's signing payload
+	DataType    int
+	ChainID     uint64
+	Path        string // BIP-32 derivation path, e.g. "m/44'/60'/0'/0/0"
+	Fingerprint uint32 // the device's master key fingerprint, which picks its key
+	Address     []byte // 20 bytes, optional
+}
+
+// RequestID derives a request ID from the hash the device signs, so that a
+// signature can be matched to its transaction without keeping state. It
+// has the form of a version 8 (custom) UUID.
+func RequestID(hash []byte) [16]byte {
+	var id [16]byte
+	copy(id[:], hash)
+	id[6] = id[6]&0x0f | 0x80
+	id[8] = id[8]&0x3f | 0x80
+	return id
+}
+
+// Marshal encodes the request as an eth-sign-request CBOR message.
+func (r *SignRequest) Marshal() ([]byte, error) {
+	if !pathRe.MatchString(r.Path) {
+		return nil, fmt.Errorf("invalid derivation path %q", r.Path)
+	}
+	fields := 6
+	if r.Address != nil {
+		fields++
+	}
+	b := appendHead(nil, majorMap, uint64(fields))
+
+	b = appendUint(b, 1)
+	b = appendHead(b, majorTag, tagUUID)
+	b = appendBytes(b, r.ID[:])
+
+	b = appendUint(b, 2)
+	b = appendBytes(b, r.Data)
+
+	b = appendUint(b, 3)
+	b = appendUint(b, uint64(r.DataType))
+
+	b = appendUint(b, 4)
+	b = appendUint(b, r.ChainID)
+
+	b = appendUint(b, 5)
+	b = appendHead(b, majorTag, tagKeypath)
+	b = appendKeypath(b, r.Path, r.Fingerprint)
+
+	if r.Address != nil {
+		b = appendUint(b, 6)
+		b = appendBytes(b, r.Address)
+	}
+	b = appendUint(b, 7)
+	b = appendText(b, Origin)
+	return b, nil
+}
+
+// appendKeypath appends a crypto-keypath: the path's components as
+// index, hardened pairs, and the source fingerprint.
+func appendKeypath(b []byte, path string, fingerprint uint32) []byte {
+	comps := strings.Split(path, "/")[1:]
+	b = appendHead(b, majorMap, 2)
+	b = appendUint(b, 1)
+	b = appendHead(b, majorArray, uint64(2*len(comps)))
+	for _, c := range comps {
+		hardened := strings.HasSuffix(c, "'")
+		n, _ := strconv.ParseUint(strings.TrimSuffix(c, "'"), 10, 31)
+		b = appendUint(b, n)
+		b = appendBool(b, hardened)
+	}
+	b = appendUint(b, 2)
+	return appendUint(b, uint64(fingerprint))
+}
+
+// Signature is a device's eth-signature.
+type Signature struct {
+	RequestID [16]byte
+	YParity   byte
+	R, S      []byte
+}
+
+// ParseSignature decodes an eth-signature CBOR message. The recovery value
+// may be a parity bit, 27/28, or EIP-155's chain-dependent form; YParity is
+// the bit in each case.
+func ParseSignature(msg []byte) (*Signature, error) {
+	v, err := decode(msg)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[uint64]any)
+	if !ok {
+		return nil, errors.New("eth-signature is not a map")
+	}
+	var sig Signature
+	id, ok := m[1].(tagged)
+	idBytes, _ := id.v.([]byte)
+	if !ok || id.tag != tagUUID || len(idBytes) != 16 {
+		return nil, errors.New("eth-signature has no request ID")
+	}
+	copy(sig.RequestID[:], idBytes)
+
+	raw, ok := m[2].([]byte)
+	if !ok || len(raw) < 65 || len(raw) > 72 {
+		return nil, errors.New("eth-signature has no signature")
+	}
+	sig.R, sig.S = raw[:32], raw[32:64]
+	var recovery uint64
+	for _, c := range raw[64:] {
+		recovery = recovery<<8 | uint64(c)
+	}
+	switch {
+	case recovery <= 1:
+		sig.YParity = byte(recovery)
+	case recovery == 27 || recovery == 28:
+		sig.YParity = byte(recovery - 27)
+	case recovery >= 35:
+		sig.YParity = byte((recovery - 35) % 2)
+	default:
+		return nil, fmt.Errorf("eth-signature has an invalid recovery value %d", recovery)
+	}
+	return &sig, nil
+}
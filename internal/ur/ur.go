@@ -0,0 +1,168 @@
+// Package ur encodes and decodes Uniform Resources (BCR-2020-005), the QR
+// format air-gapped signers such as Keystone use. A UR carries a CBOR
+// message as bytewords:
+//
+//	ur:eth-sign-request/onadtpdagd...
+//
+// Messages too long for one QR code are split into the parts of an
+// animated code, ur:type/seq-len/..., which the device scans in any order.
+package ur
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"regexp"
+	"strings"
+)
+
+// MaxFragment is the default largest fragment of a multipart UR, in bytes.
+// It keeps each code in the animation small enough to scan from a screen.
+const MaxFragment = 200
+
+// minFragment is the smallest fragment a message is split into.
+const minFragment = 10
+
+var (
+	typeRe = regexp.MustCompile(`^[a-z0-9-]+$`)
+	seqRe  = regexp.MustCompile(`^[1-9][0-9]*-[1-9][0-9]*$`)
+)
+
+// Encode encodes a CBOR message of the given UR type. A message longer
+// than maxFragment bytes becomes the parts of an animated code, one
+// fragment each, to show in a loop; a shorter one is a single part.
+func Encode(typ string, msg []byte, maxFragment int) []string {
+	if maxFragment < minFragment {
+		maxFragment = MaxFragment
+	}
+	if len(msg) <= maxFragment {
+		return []string{"ur:" + typ + "/" + encodeWords(msg)}
+	}
+	size := fragmentSize(len(msg), maxFragment)
+	count := (len(msg) + size - 1) / size
+	sum := crc32.ChecksumIEEE(msg)
+	parts := make([]string, count)
+	for i := range parts {
+		frag := make([]byte, size) // the last fragment is padded with zeros
+		copy(frag, msg[i*size:])
+
+		b := appendHead(nil, majorArray, 5)
+		b = appendUint(b, uint64(i+1))
+		b = appendUint(b, uint64(count))
+		b = appendUint(b, uint64(len(msg)))
+		b = appendUint(b, uint64(sum))
+		b = appendBytes(b, frag)
+		parts[i] = fmt.Sprintf("ur:%s/%d-%d/%s", typ, i+1, count, encodeWords(b))
+	}
+	return parts
+}
+
+// fragmentSize is the size of the fewest equal fragments of at most limit
+// bytes that a message of n bytes splits into.
+func fragmentSize(n, limit int) int {
+	for count := 1; ; count++ {
+		if size := (n + count - 1) / count; size <= limit {
+			return size
+		}
+	}
+}
+
+// Decode decodes the parts of a UR, given in any order and with repeats,
+// and returns its type and CBOR message. A multipart UR needs each of its
+// fragments; the mixed parts a fountain encoder adds after them are
+// skipped.
+func Decode(parts []string) (string, []byte, error) {
+	if len(parts) == 0 {
+		return "", nil, errors.New("no UR parts")
+	}
+	var (
+		typ      string
+		frags    [][]byte
+		msgLen   uint64
+		checksum uint64
+	)
+	for _, part := range parts {
+		t, seq, body, err := split(part)
+		if err != nil {
+			return "", nil, err
+		}
+		if typ != "" && t != typ {
+			return "", nil, fmt.Errorf("UR parts of different types: %s and %s", typ, t)
+		}
+		typ = t
+		data, err := decodeWords(body)
+		if err != nil {
+			return "", nil, err
+		}
+		if seq == "" {
+			return typ, data, nil
+		}
+
+		v, err := decode(data)
+		if err != nil {
+			return "", nil, err
+		}
+		fields, ok := v.([]any)
+		if !ok || len(fields) != 5 {
+			return "", nil, errors.New("invalid UR part")
+		}
+		seqNum, ok1 := fields[0].(uint64)
+		seqLen, ok2 := fields[1].(uint64)
+		n, ok3 := fields[2].(uint64)
+		sum, ok4 := fields[3].(uint64)
+		frag, ok5 := fields[4].([]byte)
+		if !ok1 || !ok2 || !ok3 || !ok4 || !ok5 || seqLen == 0 || seqLen > 1000 {
+			return "", nil, errors.New("invalid UR part")
+		}
+		if frags == nil {
+			frags, msgLen, checksum = make([][]byte, seqLen), n, sum
+		} else if uint64(len(frags)) != seqLen || msgLen != n || checksum != sum {
+			return "", nil, errors.New("UR parts from different messages")
+		}
+		if seqNum >= 1 && seqNum <= seqLen {
+			frags[seqNum-1] = frag
+		}
+	}
+
+	var msg []byte
+	for i, frag := range frags {
+		if frag == nil {
+			return "", nil, fmt.Errorf("missing UR part %d of %d", i+1, len(frags))
+		}
+		msg = append(msg, frag...)
+	}
+	if uint64(len(msg)) < msgLen {
+		return "", nil, errors.New("UR parts are shorter than their message")
+	}
+	msg = msg[:msgLen]
+	if uint64(crc32.ChecksumIEEE(msg)) != checksum {
+		return "", nil, errors.New("UR message checksum mismatch")
+	}
+	return typ, msg, nil
+}
+
+// split splits a UR into its type, sequence ("" for a single part), and
+// bytewords.
+func split(part string) (typ, seq, body string, err error) {
+	part = strings.ToLower(strings.TrimSpace(part))
+	rest, ok := strings.CutPrefix(part, "ur:")
+	if !ok {
+		return "", "", "", errors.New("not a UR: it must start with ur:")
+	}
+	fields := strings.Split(rest, "/")
+	switch len(fields) {
+	case 2:
+		typ, body = fields[0], fields[1]
+	case 3:
+		typ, seq, body = fields[0], fields[1], fields[2]
+		if !seqRe.MatchString(seq) {
+			return "", "", "", fmt.Errorf("invalid UR sequence %q", seq)
+		}
+	default:
+		return "", "", "", errors.New("invalid UR")
+	}
+	if !typeRe.MatchString(typ) {
+		return "", "", "", fmt.Errorf("invalid UR type %q", typ)
+	}
+	return typ, seq, body, nil
+}
@@ -0,0 +1,267 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DevicePrefix starts every paired device's secret, and PairingPrefix every
+// one-time pairing code.
+const (
+	DevicePrefix  = "dev_"
+	PairingPrefix = "pair_"
+)
+
+// PairingTTL is how long a pairing code can be redeemed.
+const PairingTTL = 5 * time.Minute
+
+// deviceScopes are what a paired device may do, within its owner's role:
+// check statuses and balances, and broadcast transactions signed on the
+// device. Devices never get the admin scope.
+var deviceScopes = []Scope{ScopeReadStatus, ScopeReadBalances, ScopeBroadcast}
+
+// Device is the public view of a paired device, such as a phone. Only the
+// hash of its secret is stored.
+type Device struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	User       string     `json:"user"`  // owner's user ID
+	Owner      string     `json:"owner"` // owner's name
+	Scopes     []Scope    `json:"scopes"`
+	PairedAt   time.Time  `json:"paired_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastIP     string     `json:"last_ip,omitempty"`
+}
+
+// Allows reports whether the device's scopes cover scope.
+func (d Device) Allows(scope Scope) bool {
+	for _, s := range d.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type deviceRecord struct {
+	Device
+	Hash string `json:"hash"` // hex SHA-256 of the secret
+}
+
+// pairing is an unredeemed pairing code. Codes live in memory only, so a
+// restart cancels them.
+type pairing struct {
+	owner   User
+	expires time.Time
+}
+
+// Devices manages paired devices persisted to a JSON file, and the pairing
+// codes that add them.
+type Devices struct {
+	mu       sync.Mutex
+	devices  []deviceRecord
+	pairings map[string]pairing // code hash -> pairing
+	path     string
+}
+
+// NewDevices loads paired devices from a JSON file. If the file doesn't
+// exist, starts empty.
+func NewDevices(path string) (*Devices, error) {
+	s := &Devices{path: path, pairings: map[string]pairing{}}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.devices = []deviceRecord{}
+			return s, nil
+		}
+		return nil, fmt.Errorf("read devices: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.devices); err != nil {
+		return nil, fmt.Errorf("parse devices: %w", err)
+	}
+	return s, nil
+}
+
+// List returns the devices of the user with the given ID, or every device
+// when userID is empty.
+func (s *Devices) List(userID string) []Device {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []Device{}
+	for _, r := range s.devices {
+		if userID == "" || r.User == userID {
+			out = append(out, r.Device)
+		}
+	}
+	return out
+}
+
+// Get returns the device with the given ID.
+func (s *Devices) Get(id string) (Device, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.devices {
+		if r.ID == id {
+			return r.Device, true
+		}
+	}
+	return Device{}, false
+}
+
+// StartPairing issues a one-time code that pairs a device to owner if it is
+// redeemed within PairingTTL.
+func (s *Devices) StartPairing(owner User) (string, time.Time, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	code := PairingPrefix + hex.EncodeToString(b)
+	expires := time.Now().Add(PairingTTL)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for h, p := range s.pairings {
+		if now.After(p.expires) {
+			delete(s.pairings, h)
+		}
+	}
+	s.pairings[hashSecret(code)] = pairing{owner: owner, expires: expires}
+	return code, expires, nil
+}
+
+// Pair redeems a pairing code, which can't be used again, and adds the
+// device. It returns the device and its secret. The device names itself,
+// so a name checkLabel refuses fails with ErrInvalidName before the code
+// is used up.
+func (s *Devices) Pair(code, name string) (Device, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Mobile device"
+	}
+	if err := checkLabel("device", name); err != nil {
+		return Device{}, "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := hashSecret(code)
+	p, ok := s.pairings[h]
+	if !ok {
+		return Device{}, "", fmt.Errorf("unknown or already used pairing code")
+	}
+	delete(s.pairings, h)
+	if time.Now().After(p.expires) {
+		return Device{}, "", fmt.Errorf("pairing code has expired")
+	}
+
+	var scopes []Scope
+	for _, sc := range deviceScopes {
+		if p.owner.Role.Can(scopePerms[sc]) {
+			scopes = append(scopes, sc)
+		}
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return Device{}, "", err
+	}
+	secret := DevicePrefix + hex.EncodeToString(b)
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Device{}, "", err
+	}
+	d := Device{ID: hex.EncodeToString(id), Name: name, User: p.owner.ID, Owner: p.owner.Name, Scopes: scopes, PairedAt: time.Now().UTC()}
+	s.devices = append(s.devices, deviceRecord{Device: d, Hash: hashSecret(secret)})
+	if err := s.save(); err != nil {
+		s.devices = s.devices[:len(s.devices)-1]
+		return Device{}, "", err
+	}
+	return d, secret, nil
+}
+
+// Revoke unpairs a device.
+func (s *Devices) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, r := range s.devices {
+		if r.ID == id {
+			old := s.devices
+			s.devices = append(s.devices[:i:i], s.devices[i+1:]...)
+			if err := s.save(); err != nil {
+				s.devices = old
+				return err
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("device %q not found", id)
+}
+
+// RevokeUser unpairs every device of the user, e.g. when they are removed,
+// and cancels their pending pairing codes.
+func (s *Devices) RevokeUser(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for h, p := range s.pairings {
+		if p.owner.ID == userID {
+			delete(s.pairings, h)
+		}
+	}
+	old := s.devices
+	kept := []deviceRecord{}
+	for _, r := range s.devices {
+		if r.User != userID {
+			kept = append(kept, r)
+		}
+	}
+	if len(kept) == len(old) {
+		return nil
+	}
+	s.devices = kept
+	if err := s.save(); err != nil {
+		s.devices = old
+		return err
+	}
+	return nil
+}
+
+// Authenticate returns the device whose secret this is and records the use
+// and the address it came from. The last use is written to disk at most
+// once a minute per device.
+func (s *Devices) Authenticate(secret, ip string) (Device, error) {
+	sum := hashSecret(secret)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.devices {
+		r := &s.devices[i]
+		if subtle.ConstantTimeCompare([]byte(r.Hash), []byte(sum)) != 1 {
+			continue
+		}
+		now := time.Now().UTC()
+		if r.LastUsedAt == nil || now.Sub(*r.LastUsedAt) >= lastUsedEvery || r.LastIP != ip {
+			r.LastUsedAt, r.LastIP = &now, ip
+			// A failed write only loses the timestamp.
+			_ = s.save()
+		}
+		return r.Device, nil
+	}
+	return Device{}, fmt.Errorf("unknown device; pair it again")
+}
+
+// save writes the current devices to disk. Must be called with mu held.
+func (s *Devices) save() error {
+	data, err := json.MarshalIndent(s.devices, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal devices: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		return fmt.Errorf("write devices: %w", err)
+	}
+	return nil
+}
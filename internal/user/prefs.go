@@ -0,0 +1,88 @@
+package user
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Prefs is a user's dashboard preferences: a JSON object whose keys the
+// server doesn't interpret.
+type Prefs struct {
+	mu     sync.RWMutex
+	values map[string]json.RawMessage
+	path   string
+}
+
+// NewPrefs loads preferences from a JSON file. If the file doesn't exist,
+// starts empty.
+func NewPrefs(path string) (*Prefs, error) {
+	p := &Prefs{path: path, values: map[string]json.RawMessage{}}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return p, nil
+		}
+		return nil, fmt.Errorf("read preferences: %w", err)
+	}
+	if err := json.Unmarshal(data, &p.values); err != nil {
+		return nil, fmt.Errorf("parse preferences: %w", err)
+	}
+	if p.values == nil {
+		p.values = map[string]json.RawMessage{}
+	}
+	return p, nil
+}
+
+// Get returns all preferences.
+func (p *Prefs) Get() map[string]json.RawMessage {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	out := make(map[string]json.RawMessage, len(p.values))
+	for k, v := range p.values {
+		out[k] = v
+	}
+	return out
+}
+
+// Update merges patch into the preferences; a null value removes its key.
+func (p *Prefs) Update(patch map[string]json.RawMessage) (map[string]json.RawMessage, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	prev := p.values
+	next := make(map[string]json.RawMessage, len(prev)+len(patch))
+	for k, v := range prev {
+		next[k] = v
+	}
+	for k, v := range patch {
+		if string(v) == "null" {
+			delete(next, k)
+			continue
+		}
+		next[k] = v
+	}
+	p.values = next
+	if err := p.save(); err != nil {
+		p.values = prev
+		return nil, err
+	}
+	out := make(map[string]json.RawMessage, len(next))
+	for k, v := range next {
+		out[k] = v
+	}
+	return out, nil
+}
+
+// save writes the current preferences to disk. Must be called with mu held.
+func (p *Prefs) save() error {
+	data, err := json.MarshalIndent(p.values, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal preferences: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(p.path, data, 0644); err != nil {
+		return fmt.Errorf("write preferences: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package user
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Sessions maps login tokens to user IDs. They live in memory only, so a
+// restart logs everyone out. A session expires after a period without use.
+type Sessions struct {
+	mu   sync.Mutex
+	ttl  time.Duration
+	byID map[string]*session
+}
+
+type session struct {
+	user    string
+	expires time.Time
+}
+
+// NewSessions returns an empty session table whose sessions last ttl past
+// their last use.
+func NewSessions(ttl time.Duration) *Sessions {
+	return &Sessions{ttl: ttl, byID: map[string]*session{}}
+}
+
+// Create starts a session for the user and returns its token.
+func (s *Sessions) Create(userID string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for t, sess := range s.byID {
+		if now.After(sess.expires) {
+			delete(s.byID, t)
+		}
+	}
+	s.byID[token] = &session{user: userID, expires: now.Add(s.ttl)}
+	return token, nil
+}
+
+// Lookup returns the user ID of a live session and extends it.
+func (s *Sessions) Lookup(token string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.byID[token]
+	if !ok {
+		return "", false
+	}
+	now := time.Now()
+	if now.After(sess.expires) {
+		delete(s.byID, token)
+		return "", false
+	}
+	sess.expires = now.Add(s.ttl)
+	return sess.user, true
+}
+
+// Revoke ends a session.
+func (s *Sessions) Revoke(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.byID, token)
+}
+
+// RevokeUser ends every session of the user, e.g. after a password change.
+func (s *Sessions) RevokeUser(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for t, sess := range s.byID {
+		if sess.user == userID {
+			delete(s.byID, t)
+		}
+	}
+}
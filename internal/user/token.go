@@ -0,0 +1,267 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope limits what an API token may do. A token never does more than its
+// owner's role allows.
+type Scope string
+
+const (
+	ScopeReadStatus   Scope = "read-status"   // endpoint statuses, comparisons, and assets
+	ScopeReadBalances Scope = "read-balances" // accounts, bookmarks, the journal, and GraphQL
+	ScopeBroadcast    Scope = "broadcast"     // build, import, and broadcast transactions
+	ScopeAdmin        Scope = "admin"         // everything the owner's role allows
+)
+
+// scopePerms is the permission the owner needs to be given each scope.
+var scopePerms = map[Scope]Permission{
+	ScopeReadStatus:   PermRead,
+	ScopeReadBalances: PermRead,
+	ScopeBroadcast:    PermOperate,
+	ScopeAdmin:        PermAdmin,
+}
+
+// TokenPrefix starts every API token, which tells them apart from approver
+// tokens sent the same way.
+const TokenPrefix = "wlt_"
+
+// lastUsedEvery is how stale a token's last-used time may get before a use
+// is written to disk.
+const lastUsedEvery = time.Minute
+
+// Token is the public view of an API token. The secret is shown once, when
+// the token is created; only its hash is stored.
+type Token struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	User       string     `json:"user"`  // owner's user ID
+	Owner      string     `json:"owner"` // owner's name
+	Scopes     []Scope    `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Allows reports whether the token's scopes cover scope.
+func (t Token) Allows(scope Scope) bool {
+	for _, s := range t.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired reports whether the token has expired at now.
+func (t Token) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+type tokenRecord struct {
+	Token
+	Hash string `json:"hash"` // hex SHA-256 of the secret
+}
+
+// Tokens manages API tokens persisted to a JSON file.
+type Tokens struct {
+	mu     sync.Mutex
+	tokens []tokenRecord
+	path   string
+}
+
+// NewTokens loads API tokens from a JSON file. If the file doesn't exist,
+// starts empty.
+func NewTokens(path string) (*Tokens, error) {
+	s := &Tokens{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.tokens = []tokenRecord{}
+			return s, nil
+		}
+		return nil, fmt.Errorf("read tokens: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.tokens); err != nil {
+		return nil, fmt.Errorf("parse tokens: %w", err)
+	}
+	return s, nil
+}
+
+// List returns the tokens of the user with the given ID, or every token
+// when userID is empty.
+func (s *Tokens) List(userID string) []Token {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []Token{}
+	for _, r := range s.tokens {
+		if userID == "" || r.User == userID {
+			out = append(out, r.Token)
+		}
+	}
+	return out
+}
+
+// Get returns the token with the given ID.
+func (s *Tokens) Get(id string) (Token, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.tokens {
+		if r.ID == id {
+			return r.Token, true
+		}
+	}
+	return Token{}, false
+}
+
+// Create issues a token for owner with the given scopes, each of which the
+// owner's role must permit. A zero ttl never expires. It returns the token
+// and its secret.
+func (s *Tokens) Create(owner User, name string, scopes []Scope, ttl time.Duration) (Token, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Token{}, "", fmt.Errorf("name is required")
+	}
+	if err := checkLabel("token", name); err != nil {
+		return Token{}, "", err
+	}
+	if len(scopes) == 0 {
+		return Token{}, "", fmt.Errorf("at least one scope is required")
+	}
+	seen := map[Scope]bool{}
+	var clean []Scope
+	for _, sc := range scopes {
+		perm, ok := scopePerms[sc]
+		if !ok {
+			return Token{}, "", fmt.Errorf("scope %q must be %s, %s, %s, or %s", sc, ScopeReadStatus, ScopeReadBalances, ScopeBroadcast, ScopeAdmin)
+		}
+		if !owner.Role.Can(perm) {
+			return Token{}, "", fmt.Errorf("the %s role can't grant the %s scope", owner.Role, sc)
+		}
+		if !seen[sc] {
+			seen[sc] = true
+			clean = append(clean, sc)
+		}
+	}
+	if ttl < 0 {
+		return Token{}, "", fmt.Errorf("expiry must not be negative")
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return Token{}, "", err
+	}
+	secret := TokenPrefix + hex.EncodeToString(b)
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Token{}, "", err
+	}
+	now := time.Now().UTC()
+	t := Token{ID: hex.EncodeToString(id), Name: name, User: owner.ID, Owner: owner.Name, Scopes: clean, CreatedAt: now}
+	if ttl > 0 {
+		expires := now.Add(ttl)
+		t.ExpiresAt = &expires
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = append(s.tokens, tokenRecord{Token: t, Hash: hashSecret(secret)})
+	if err := s.save(); err != nil {
+		s.tokens = s.tokens[:len(s.tokens)-1]
+		return Token{}, "", err
+	}
+	return t, secret, nil
+}
+
+// Revoke deletes a token.
+func (s *Tokens) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, r := range s.tokens {
+		if r.ID == id {
+			old := s.tokens
+			s.tokens = append(s.tokens[:i:i], s.tokens[i+1:]...)
+			if err := s.save(); err != nil {
+				s.tokens = old
+				return err
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("token %q not found", id)
+}
+
+// RevokeUser deletes every token of the user, e.g. when they are removed.
+func (s *Tokens) RevokeUser(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.tokens
+	kept := []tokenRecord{}
+	for _, r := range s.tokens {
+		if r.User != userID {
+			kept = append(kept, r)
+		}
+	}
+	if len(kept) == len(old) {
+		return nil
+	}
+	s.tokens = kept
+	if err := s.save(); err != nil {
+		s.tokens = old
+		return err
+	}
+	return nil
+}
+
+// Authenticate returns the live token whose secret this is and records the
+// use. The last-used time is written to disk at most once a minute per
+// token.
+func (s *Tokens) Authenticate(secret string) (Token, error) {
+	sum := hashSecret(secret)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.tokens {
+		r := &s.tokens[i]
+		if subtle.ConstantTimeCompare([]byte(r.Hash), []byte(sum)) != 1 {
+			continue
+		}
+		now := time.Now().UTC()
+		if r.Expired(now) {
+			return Token{}, fmt.Errorf("API token %s has expired", r.Name)
+		}
+		if r.LastUsedAt == nil || now.Sub(*r.LastUsedAt) >= lastUsedEvery {
+			r.LastUsedAt = &now
+			// A failed write only loses the timestamp.
+			_ = s.save()
+		}
+		return r.Token, nil
+	}
+	return Token{}, fmt.Errorf("unknown API token")
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// save writes the current tokens to disk. Must be called with mu held.
+func (s *Tokens) save() error {
+	data, err := json.MarshalIndent(s.tokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal tokens: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		return fmt.Errorf("write tokens: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,420 @@
+// Package user holds the accounts of a multi-user server: who can log in,
+// with what role, their login sessions, their API tokens, and their paired
+// devices. Users with the user role keep their endpoints, signer accounts,
+// bookmarks, and preferences in a profile directory of their own; admins,
+// operators, and viewers share the server's profile.
+package user
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Role is what a user may do.
+type Role string
+
+const (
+	// RoleAdmin manages users, endpoints, and policies, and works in the
+	// server's profile, with its vault, signers, schedules, approvals, and
+	// journal.
+	RoleAdmin Role = "admin"
+	// RoleOperator reads the server's profile and builds, imports, and
+	// broadcasts transactions, but changes nothing else.
+	RoleOperator Role = "operator"
+	// RoleViewer reads the server's profile: statuses, balances, and
+	// history.
+	RoleViewer Role = "viewer"
+	// RoleUser works in a profile of their own and can't sign server-side.
+	RoleUser Role = "user"
+)
+
+// Permission is a class of API operations.
+type Permission string
+
+const (
+	PermRead    Permission = "read"    // statuses, balances, history, and other reads
+	PermOperate Permission = "operate" // build, import, and broadcast transactions
+	PermManage  Permission = "manage"  // change the profile's endpoints, accounts, and bookmarks
+	PermAdmin   Permission = "admin"   // keys, server signing, policies, registries, logs, and users
+)
+
+var grants = map[Role][]Permission{
+	RoleAdmin:    {PermRead, PermOperate, PermManage, PermAdmin},
+	RoleOperator: {PermRead, PermOperate},
+	RoleViewer:   {PermRead},
+	RoleUser:     {PermRead, PermOperate, PermManage},
+}
+
+// Permissions lists what the role may do.
+func (r Role) Permissions() []Permission {
+	return append([]Permission{}, grants[r]...)
+}
+
+// Can reports whether the role has the permission.
+func (r Role) Can(p Permission) bool {
+	for _, g := range grants[r] {
+		if g == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Shared reports whether the role works in the server's profile rather than
+// one of its own.
+func (r Role) Shared() bool { return r != RoleUser }
+
+func validRole(r Role) error {
+	if _, ok := grants[r]; !ok {
+		return fmt.Errorf("role must be %s, %s, %s, or %s", RoleAdmin, RoleOperator, RoleViewer, RoleUser)
+	}
+	return nil
+}
+
+// maxLabel is the longest name a token or device may have.
+const maxLabel = 64
+
+// ErrInvalidName is returned for a token or device name checkLabel refuses.
+var ErrInvalidName = errors.New("invalid name")
+
+// checkLabel checks the name of a token or device: at most maxLabel
+// characters of letters, digits, spaces, and . , _ - ( ) # : @ +. Names
+// are shown to admins, so quotes, brackets, and backslashes that could
+// break out of the page's markup are refused.
+func checkLabel(kind, name string) error {
+	if utf8.RuneCountInString(name) > maxLabel {
+		return fmt.Errorf("%w: %s name is longer than %d characters", ErrInvalidName, kind, maxLabel)
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != ' ' && !strings.ContainsRune(".,_-()#:@+", r) {
+			return fmt.Errorf("%w: %s name may only have letters, digits, spaces, and . , _ - ( ) # : @ +", ErrInvalidName, kind)
+		}
+	}
+	return nil
+}
+
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// User is the public view of a user.
+type User struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Role      Role      `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Admin reports whether u has the admin role.
+func (u User) Admin() bool { return u.Role == RoleAdmin }
+
+type record struct {
+	User
+	Salt []byte `json:"salt"`
+	Hash []byte `json:"hash"` // scrypt of the password
+}
+
+// Store manages users persisted to a JSON file. The CLI edits the file
+// directly, so it is reread whenever it changes on disk.
+type Store struct {
+	mu      sync.Mutex
+	path    string
+	dir     string // holds a profile directory per user
+	users   []record
+	modTime time.Time
+}
+
+// NewStore loads users from a JSON file. If the file doesn't exist, starts
+// empty. Profiles are kept in dir.
+func NewStore(path, dir string) (*Store, error) {
+	s := &Store{path: path, dir: dir}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load rereads the file if it changed since it was last read. Must be
+// called with mu held.
+func (s *Store) load() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.users = []record{}
+			s.modTime = time.Time{}
+			return nil
+		}
+		return fmt.Errorf("read users: %w", err)
+	}
+	if s.users != nil && info.ModTime().Equal(s.modTime) {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("read users: %w", err)
+	}
+	var users []record
+	if err := json.Unmarshal(data, &users); err != nil {
+		return fmt.Errorf("parse users: %w", err)
+	}
+	s.users = users
+	s.modTime = info.ModTime()
+	return nil
+}
+
+// ProfileDir is where the user's endpoints, signer accounts, bookmarks, and
+// preferences are kept.
+func (s *Store) ProfileDir(id string) string {
+	return filepath.Join(s.dir, id)
+}
+
+// List returns all users.
+func (s *Store) List() ([]User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	out := make([]User, len(s.users))
+	for i, r := range s.users {
+		out[i] = r.User
+	}
+	return out, nil
+}
+
+// Get returns the user with the given ID.
+func (s *Store) Get(id string) (User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return User{}, false
+	}
+	if r := s.findLocked(id); r != nil {
+		return r.User, true
+	}
+	return User{}, false
+}
+
+// Add creates a user. Names are unique, ignoring case.
+func (s *Store) Add(name, password string, role Role) (User, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return User{}, fmt.Errorf("name is required")
+	}
+	if err := validRole(role); err != nil {
+		return User{}, err
+	}
+	salt, hash, err := hashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return User{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return User{}, err
+	}
+	if s.findByNameLocked(name) != nil {
+		return User{}, fmt.Errorf("user %q already exists", name)
+	}
+	r := record{
+		User: User{ID: hex.EncodeToString(b), Name: name, Role: role, CreatedAt: time.Now().UTC()},
+		Salt: salt,
+		Hash: hash,
+	}
+	s.users = append(s.users, r)
+	if err := s.save(); err != nil {
+		s.users = s.users[:len(s.users)-1]
+		return User{}, err
+	}
+	return r.User, nil
+}
+
+// Update changes a user's role and, when password is non-empty, their
+// password. The last admin can't be demoted.
+func (s *Store) Update(id string, role Role, password string) (User, error) {
+	if role != "" {
+		if err := validRole(role); err != nil {
+			return User{}, err
+		}
+	}
+	var salt, hash []byte
+	if password != "" {
+		var err error
+		if salt, hash, err = hashPassword(password); err != nil {
+			return User{}, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return User{}, err
+	}
+	r := s.findLocked(id)
+	if r == nil {
+		return User{}, fmt.Errorf("user %q not found", id)
+	}
+	if role != "" && role != RoleAdmin && r.Role == RoleAdmin && s.adminsLocked() == 1 {
+		return User{}, fmt.Errorf("can't demote the last admin")
+	}
+	prev := *r
+	if role != "" {
+		r.Role = role
+	}
+	if password != "" {
+		r.Salt, r.Hash = salt, hash
+	}
+	if err := s.save(); err != nil {
+		*r = prev
+		return User{}, err
+	}
+	return r.User, nil
+}
+
+// Delete removes a user. Their profile directory is left in place. The last
+// admin can't be removed.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	for i, r := range s.users {
+		if r.ID != id {
+			continue
+		}
+		if r.Role == RoleAdmin && s.adminsLocked() == 1 {
+			return fmt.Errorf("can't remove the last admin")
+		}
+		prev := s.users
+		s.users = append(append([]record{}, s.users[:i]...), s.users[i+1:]...)
+		if err := s.save(); err != nil {
+			s.users = prev
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("user %q not found", id)
+}
+
+// Find returns the user with the given name, ignoring case.
+func (s *Store) Find(name string) (User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return User{}, false
+	}
+	if r := s.findByNameLocked(name); r != nil {
+		return r.User, true
+	}
+	return User{}, false
+}
+
+// Authenticate checks name and password and returns the user.
+func (s *Store) Authenticate(name, password string) (User, error) {
+	s.mu.Lock()
+	if err := s.load(); err != nil {
+		s.mu.Unlock()
+		return User{}, err
+	}
+	var r record
+	found := s.findByNameLocked(name)
+	if found != nil {
+		r = *found
+	}
+	s.mu.Unlock()
+
+	// Hash even for unknown names so timing doesn't reveal which exist.
+	salt := r.Salt
+	if found == nil {
+		salt = make([]byte, 16)
+	}
+	hash, err := scrypt.Key([]byte(password), salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return User{}, fmt.Errorf("derive key: %w", err)
+	}
+	if found == nil || subtle.ConstantTimeCompare(hash, r.Hash) != 1 {
+		return User{}, fmt.Errorf("wrong name or password")
+	}
+	return r.User, nil
+}
+
+func hashPassword(password string) (salt, hash []byte, err error) {
+	if len(password) < 8 {
+		return nil, nil, fmt.Errorf("password must be at least 8 characters")
+	}
+	salt = make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, nil, err
+	}
+	hash, err = scrypt.Key([]byte(password), salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, nil, fmt.Errorf("derive key: %w", err)
+	}
+	return salt, hash, nil
+}
+
+func (s *Store) findLocked(id string) *record {
+	for i := range s.users {
+		if s.users[i].ID == id {
+			return &s.users[i]
+		}
+	}
+	return nil
+}
+
+func (s *Store) findByNameLocked(name string) *record {
+	name = strings.TrimSpace(name)
+	for i := range s.users {
+		if strings.EqualFold(s.users[i].Name, name) {
+			return &s.users[i]
+		}
+	}
+	return nil
+}
+
+func (s *Store) adminsLocked() int {
+	n := 0
+	for _, r := range s.users {
+		if r.Role == RoleAdmin {
+			n++
+		}
+	}
+	return n
+}
+
+// save writes the current users to disk. Must be called with mu held.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.users, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal users: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		return fmt.Errorf("write users: %w", err)
+	}
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime = info.ModTime()
+	}
+	return nil
+}
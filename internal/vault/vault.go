@@ -0,0 +1,380 @@
+// Package vault is an optional server-side key store for headless use: keys
+// are encrypted at rest with a passphrase and only decrypted in memory while
+// the vault is unlocked.
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/primal-host/wallet/internal/evm"
+	"github.com/primal-host/wallet/internal/signer"
+)
+
+const (
+	fileVersion = 1
+	scryptN     = 1 << 15
+	scryptR     = 8
+	scryptP     = 1
+	checkPhrase = "wallet-vault-check"
+)
+
+// Key is the public view of a vault key.
+type Key struct {
+	Address   string    `json:"address"`
+	Label     string    `json:"label"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Status summarizes the vault for the API.
+type Status struct {
+	Initialized bool  `json:"initialized"`
+	Unlocked    bool  `json:"unlocked"`
+	Keys        []Key `json:"keys"`
+}
+
+type sealed struct {
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+type record struct {
+	Key
+	Secret sealed `json:"secret"`
+}
+
+type file struct {
+	Version int      `json:"version"`
+	Salt    []byte   `json:"salt"`
+	N       int      `json:"n"`
+	R       int      `json:"r"`
+	P       int      `json:"p"`
+	Check   sealed   `json:"check"`
+	Keys    []record `json:"keys"`
+}
+
+// Vault holds encrypted keys loaded from a JSON file.
+type Vault struct {
+	mu   sync.RWMutex
+	path string
+	data *file // nil until initialized
+
+	aead    cipher.AEAD                           // set while unlocked
+	private map[evm.Address]*secp256k1.PrivateKey // set while unlocked
+}
+
+// Open loads the vault file. A missing file leaves the vault uninitialized.
+func Open(path string) (*Vault, error) {
+	v := &Vault{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return v, nil
+		}
+		return nil, fmt.Errorf("read vault: %w", err)
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse vault: %w", err)
+	}
+	if f.Version != fileVersion {
+		return nil, fmt.Errorf("unsupported vault version %d", f.Version)
+	}
+	v.data = &f
+	return v, nil
+}
+
+// Status reports whether the vault is initialized and unlocked, and its keys.
+func (v *Vault) Status() Status {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	st := Status{Initialized: v.data != nil, Unlocked: v.aead != nil, Keys: []Key{}}
+	if v.data != nil {
+		for _, r := range v.data.Keys {
+			st.Keys = append(st.Keys, r.Key)
+		}
+	}
+	return st
+}
+
+// Has reports whether the vault holds a key for the address.
+func (v *Vault) Has(address string) bool {
+	a, err := evm.ParseAddress(address)
+	if err != nil {
+		return false
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.findLocked(a) != nil
+}
+
+// Init creates a new empty vault protected by passphrase and leaves it unlocked.
+func (v *Vault) Init(passphrase string) error {
+	if len(passphrase) < 8 {
+		return fmt.Errorf("passphrase must be at least 8 characters")
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.data != nil {
+		return fmt.Errorf("vault already initialized")
+	}
+
+	f := &file{Version: fileVersion, N: scryptN, R: scryptR, P: scryptP, Salt: make([]byte, 32), Keys: []record{}}
+	if _, err := rand.Read(f.Salt); err != nil {
+		return err
+	}
+	aead, err := deriveAEAD(passphrase, f)
+	if err != nil {
+		return err
+	}
+	if f.Check, err = seal(aead, []byte(checkPhrase)); err != nil {
+		return err
+	}
+	if err := writeFile(v.path, f); err != nil {
+		return err
+	}
+	v.data = f
+	v.aead = aead
+	v.private = map[evm.Address]*secp256k1.PrivateKey{}
+	return nil
+}
+
+// Unlock decrypts all keys into memory.
+func (v *Vault) Unlock(passphrase string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.data == nil {
+		return fmt.Errorf("vault not initialized")
+	}
+	aead, err := deriveAEAD(passphrase, v.data)
+	if err != nil {
+		return err
+	}
+	if check, err := open(aead, v.data.Check); err != nil || string(check) != checkPhrase {
+		return fmt.Errorf("wrong passphrase")
+	}
+	private := map[evm.Address]*secp256k1.PrivateKey{}
+	for _, r := range v.data.Keys {
+		secret, err := open(aead, r.Secret)
+		if err != nil {
+			return fmt.Errorf("decrypt %s: %w", r.Address, err)
+		}
+		priv := secp256k1.PrivKeyFromBytes(secret)
+		addr := evm.PubkeyToAddress(priv.PubKey())
+		if addr.Hex() != r.Address {
+			return fmt.Errorf("key for %s derives %s", r.Address, addr.Hex())
+		}
+		private[addr] = priv
+	}
+	v.aead = aead
+	v.private = private
+	return nil
+}
+
+// Verify rereads the vault file and checks it against the keys in memory.
+// While the vault is unlocked, every key on disk is also decrypted and must
+// derive its address. It describes each problem found.
+func (v *Vault) Verify() []string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if v.data == nil {
+		return nil
+	}
+	data, err := os.ReadFile(v.path)
+	if err != nil {
+		return []string{fmt.Sprintf("read vault: %v", err)}
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return []string{fmt.Sprintf("parse vault: %v", err)}
+	}
+	var problems []string
+	if f.Version != v.data.Version || !bytes.Equal(f.Salt, v.data.Salt) {
+		problems = append(problems, "vault file was replaced since it was loaded")
+	}
+	if len(f.Keys) != len(v.data.Keys) {
+		problems = append(problems, fmt.Sprintf("vault file has %d keys, memory has %d", len(f.Keys), len(v.data.Keys)))
+	}
+	for _, r := range f.Keys {
+		addr, err := evm.ParseAddress(r.Address)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		if v.findLocked(addr) == nil {
+			problems = append(problems, fmt.Sprintf("key %s is on disk but not in memory", r.Address))
+		}
+		if v.aead == nil {
+			continue
+		}
+		secret, err := open(v.aead, r.Secret)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("key %s doesn't decrypt: %v", r.Address, err))
+			continue
+		}
+		priv := secp256k1.PrivKeyFromBytes(secret)
+		if derived := evm.PubkeyToAddress(priv.PubKey()); derived != addr {
+			problems = append(problems, fmt.Sprintf("key for %s derives %s", r.Address, derived.Hex()))
+		}
+		priv.Zero()
+	}
+	return problems
+}
+
+// Lock forgets the decrypted keys and the derived encryption key.
+func (v *Vault) Lock() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, priv := range v.private {
+		priv.Zero()
+	}
+	v.private = nil
+	v.aead = nil
+}
+
+// Generate creates a new random key.
+func (v *Vault) Generate(label string) (Key, error) {
+	priv, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		return Key{}, err
+	}
+	return v.add(label, priv)
+}
+
+// Import adds an existing hex-encoded private key.
+func (v *Vault) Import(label, privateKey string) (Key, error) {
+	b, err := evm.DecodeHex(strings.TrimSpace(privateKey))
+	if err != nil || len(b) != 32 {
+		return Key{}, fmt.Errorf("invalid private key: expected 32 bytes of hex")
+	}
+	return v.add(label, secp256k1.PrivKeyFromBytes(b))
+}
+
+func (v *Vault) add(label string, priv *secp256k1.PrivateKey) (Key, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.aead == nil {
+		return Key{}, fmt.Errorf("vault is locked")
+	}
+	addr := evm.PubkeyToAddress(priv.PubKey())
+	if v.findLocked(addr) != nil {
+		return Key{}, fmt.Errorf("key %s already exists", addr.Hex())
+	}
+	label = strings.TrimSpace(label)
+	if label == "" {
+		label = fmt.Sprintf("Vault %d", len(v.data.Keys)+1)
+	}
+	secret, err := seal(v.aead, priv.Serialize())
+	if err != nil {
+		return Key{}, err
+	}
+	rec := record{Key: Key{Address: addr.Hex(), Label: label, CreatedAt: time.Now().UTC()}, Secret: secret}
+
+	old := v.data.Keys
+	v.data.Keys = append(v.data.Keys[:len(old):len(old)], rec)
+	if err := writeFile(v.path, v.data); err != nil {
+		v.data.Keys = old
+		return Key{}, err
+	}
+	v.private[addr] = priv
+	return rec.Key, nil
+}
+
+// SignTx signs a transaction with the vault key for acct.Address. It
+// satisfies signer.TxSigner so vault keys sign through the same path as
+// remote signers.
+func (v *Vault) SignTx(ctx context.Context, acct signer.Account, tx *evm.Tx) (evm.Signature, error) {
+	return v.SignPayload(ctx, acct, tx.SigningPayload())
+}
+
+// SignPayload signs the Keccak-256 hash of payload with the vault key for
+// acct.Address.
+func (v *Vault) SignPayload(_ context.Context, acct signer.Account, payload []byte) (evm.Signature, error) {
+	addr, err := evm.ParseAddress(acct.Address)
+	if err != nil {
+		return evm.Signature{}, err
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if v.aead == nil {
+		return evm.Signature{}, fmt.Errorf("vault is locked")
+	}
+	priv, ok := v.private[addr]
+	if !ok {
+		return evm.Signature{}, fmt.Errorf("no vault key for %s", acct.Address)
+	}
+	compact := ecdsa.SignCompact(priv, evm.Keccak256(payload), false)
+	return evm.Signature{
+		YParity: compact[0] - 27,
+		R:       new(big.Int).SetBytes(compact[1:33]),
+		S:       new(big.Int).SetBytes(compact[33:65]),
+	}, nil
+}
+
+// findLocked returns the record for addr. Must be called with mu held.
+func (v *Vault) findLocked(addr evm.Address) *record {
+	if v.data == nil {
+		return nil
+	}
+	for i := range v.data.Keys {
+		if v.data.Keys[i].Address == addr.Hex() {
+			return &v.data.Keys[i]
+		}
+	}
+	return nil
+}
+
+func deriveAEAD(passphrase string, f *file) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), f.Salt, f.N, f.R, f.P, 32)
+	if err != nil {
+		return nil, fmt.Errorf("derive key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plaintext []byte) (sealed, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return sealed{}, err
+	}
+	return sealed{Nonce: nonce, Ciphertext: aead.Seal(nil, nonce, plaintext, nil)}, nil
+}
+
+func open(aead cipher.AEAD, s sealed) ([]byte, error) {
+	return aead.Open(nil, s.Nonce, s.Ciphertext, nil)
+}
+
+// writeFile saves the vault atomically so a crash mid-write can't corrupt it.
+func writeFile(path string, f *file) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal vault: %w", err)
+	}
+	data = append(data, '\n')
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("write vault: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("write vault: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,473 @@
+// Package verified looks up whether a contract's source is verified, on
+// Sourcify and on Etherscan-compatible explorer APIs, and caches what they
+// return on disk: the ABI, the compiler metadata, and the sources.
+// Verification doesn't go away, so a verified contract is kept for good;
+// an unverified one is asked about again after a while.
+package verified
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/primal-host/wallet/internal/atomicfile"
+	"github.com/primal-host/wallet/internal/evm"
+)
+
+// DefaultSourcify is the public Sourcify server.
+const DefaultSourcify = "https://sourcify.dev/server"
+
+// etherscanV2 is Etherscan's multichain API, used for chains without an
+// explorer of their own when an Etherscan API key is set.
+const etherscanV2 = "https://api.etherscan.io/v2/api"
+
+const (
+	// fetchTimeout bounds one source's answer.
+	fetchTimeout = 20 * time.Second
+
+	// unverifiedTTL is how long a contract no source had verified is
+	// believed before they are asked again.
+	unverifiedTTL = 6 * time.Hour
+
+	// maxResponse is the largest answer read from a source.
+	maxResponse = 32 << 20
+)
+
+// Sources.
+const (
+	SourceSourcify = "sourcify"
+)
+
+// Contract is what the sources say about a contract's verification.
+type Contract struct {
+	ChainID        uint64            `json:"chain_id"`
+	Address        string            `json:"address"`
+	Verified       bool              `json:"verified"`
+	Source         string            `json:"source,omitempty"` // sourcify, or the explorer API's host
+	Match          string            `json:"match,omitempty"`  // Sourcify's exact or partial; empty for explorers, which don't say
+	Name           string            `json:"name,omitempty"`
+	Language       string            `json:"language,omitempty"`
+	Compiler       string            `json:"compiler,omitempty"` // e.g. v0.8.25+commit.b61c2a91
+	License        string            `json:"license,omitempty"`
+	Proxy          bool              `json:"proxy,omitempty"`
+	Implementation string            `json:"implementation,omitempty"` // a proxy's implementation, where the source knows it
+	ABI            json.RawMessage   `json:"abi,omitempty"`
+	Files          []string          `json:"files,omitempty"`   // source file paths, sorted
+	Sources        map[string]string `json:"sources,omitempty"` // path -> content
+	CheckedAt      time.Time         `json:"checked_at"`
+}
+
+// Summary is the short form shown next to an address.
+type Summary struct {
+	Source string `json:"source"`
+	Match  string `json:"match,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+// Summary returns c's short form, or nil when it isn't verified.
+func (c Contract) Summary() *Summary {
+	if !c.Verified {
+		return nil
+	}
+	return &Summary{Source: c.Source, Match: c.Match, Name: c.Name}
+}
+
+// ParseExplorers parses a space- or comma-separated list of chainID=URL
+// Etherscan-compatible explorer APIs, e.g.
+// 1=https://eth.blockscout.com/api. A URL may carry a query, such as an
+// apikey.
+func ParseExplorers(s string) (map[uint64]string, error) {
+	explorers := map[uint64]string{}
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' }) {
+		id, raw, ok := strings.Cut(f, "=")
+		chainID, err := strconv.ParseUint(id, 10, 64)
+		if !ok || err != nil || chainID == 0 {
+			return nil, fmt.Errorf("%q must be chainID=URL", f)
+		}
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.Fragment != "" {
+			return nil, fmt.Errorf("%q must be an http:// or https:// URL", raw)
+		}
+		explorers[chainID] = u.String()
+	}
+	return explorers, nil
+}
+
+// Cache looks contracts up and keeps the answers in a directory.
+type Cache struct {
+	dir          string
+	sourcify     string            // base URL; empty to skip Sourcify
+	explorers    map[uint64]string // chain ID -> explorer API URL
+	etherscanKey string
+	client       *http.Client
+
+	mu       sync.Mutex
+	inflight map[string]*flight // file name -> lookup in progress
+}
+
+type flight struct {
+	done chan struct{}
+	c    Contract
+	err  error
+}
+
+// New returns a cache in dir, creating it. sourcify is the Sourcify
+// server, or empty to leave it out; explorers are Etherscan-compatible
+// APIs by chain ID; and etherscanKey, if set, adds Etherscan's own API for
+// every other chain.
+func New(dir, sourcify string, explorers map[uint64]string, etherscanKey string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create contracts dir: %w", err)
+	}
+	return &Cache{
+		dir:          dir,
+		sourcify:     strings.TrimRight(sourcify, "/"),
+		explorers:    explorers,
+		etherscanKey: etherscanKey,
+		client:       &http.Client{Timeout: fetchTimeout},
+		inflight:     map[string]*flight{},
+	}, nil
+}
+
+// Get returns what the sources say about the contract at address, from
+// the cache unless refresh is set or an unverified answer is old. Sourcify
+// is asked first, then the chain's explorer. A contract is unverified only
+// when every source answered; if one failed, so does Get, and nothing is
+// cached.
+func (c *Cache) Get(ctx context.Context, chainID uint64, address string, refresh bool) (Contract, error) {
+	addr, err := evm.ParseAddress(address)
+	if err != nil {
+		return Contract{}, err
+	}
+	name := fileName(chainID, addr)
+	if !refresh {
+		if ct, ok := c.read(name); ok && (ct.Verified || time.Since(ct.CheckedAt) < unverifiedTTL) {
+			return ct, nil
+		}
+	}
+
+	c.mu.Lock()
+	if f, ok := c.inflight[name]; ok {
+		c.mu.Unlock()
+		select {
+		case <-f.done:
+			return f.c, f.err
+		case <-ctx.Done():
+			return Contract{}, ctx.Err()
+		}
+	}
+	f := &flight{done: make(chan struct{})}
+	c.inflight[name] = f
+	c.mu.Unlock()
+
+	f.c, f.err = c.lookup(ctx, chainID, addr)
+	if f.err == nil {
+		f.err = c.write(name, f.c)
+	}
+	c.mu.Lock()
+	delete(c.inflight, name)
+	c.mu.Unlock()
+	close(f.done)
+	return f.c, f.err
+}
+
+// Cached returns the cached answer for address, without asking the sources.
+func (c *Cache) Cached(chainID uint64, address string) (Contract, bool) {
+	addr, err := evm.ParseAddress(address)
+	if err != nil {
+		return Contract{}, false
+	}
+	return c.read(fileName(chainID, addr))
+}
+
+// lookup asks the sources in turn.
+func (c *Cache) lookup(ctx context.Context, chainID uint64, addr evm.Address) (Contract, error) {
+	ct := Contract{ChainID: chainID, Address: addr.Hex()}
+	var errs []error
+	if c.sourcify != "" {
+		ok, err := c.fromSourcify(ctx, &ct)
+		if ok {
+			ct.CheckedAt = time.Now().UTC()
+			return ct, nil
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sourcify: %w", err))
+		}
+	}
+	if api := c.explorer(chainID); api != "" {
+		ok, err := c.fromExplorer(ctx, api, &ct)
+		if ok {
+			ct.CheckedAt = time.Now().UTC()
+			return ct, nil
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", host(api), err))
+		}
+	}
+	if len(errs) > 0 {
+		return Contract{}, errors.Join(errs...)
+	}
+	ct.CheckedAt = time.Now().UTC()
+	return ct, nil
+}
+
+// explorer returns the explorer API for chainID, or "" if it has none.
+func (c *Cache) explorer(chainID uint64) string {
+	if api, ok := c.explorers[chainID]; ok {
+		return api
+	}
+	if c.etherscanKey == "" {
+		return ""
+	}
+	return etherscanV2 + "?" + url.Values{"chainid": {strconv.FormatUint(chainID, 10)}, "apikey": {c.etherscanKey}}.Encode()
+}
+
+// fromSourcify fills ct from Sourcify's v2 API, reporting whether the
+// contract is verified there.
+func (c *Cache) fromSourcify(ctx context.Context, ct *Contract) (bool, error) {
+	u := fmt.Sprintf("%s/v2/contract/%d/%s?fields=abi,compilation,sources,proxyResolution", c.sourcify, ct.ChainID, ct.Address)
+	var out struct {
+		Match       string          `json:"match"` // exact_match, match, or null
+		ABI         json.RawMessage `json:"abi"`
+		Compilation struct {
+			Language        string `json:"language"`
+			CompilerVersion string `json:"compilerVersion"`
+			Name            string `json:"name"`
+		} `json:"compilation"`
+		Sources map[string]struct {
+			Content string `json:"content"`
+		} `json:"sources"`
+		ProxyResolution *struct {
+			IsProxy         bool `json:"isProxy"`
+			Implementations []struct {
+				Address string `json:"address"`
+			} `json:"implementations"`
+		} `json:"proxyResolution"`
+	}
+	status, err := c.getJSON(ctx, u, &out)
+	if status == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if out.Match == "" {
+		return false, nil
+	}
+	ct.Verified, ct.Source = true, SourceSourcify
+	ct.Match = "partial"
+	if out.Match == "exact_match" {
+		ct.Match = "exact"
+	}
+	ct.ABI = out.ABI
+	ct.Name, ct.Language, ct.Compiler = out.Compilation.Name, out.Compilation.Language, out.Compilation.CompilerVersion
+	ct.Sources = map[string]string{}
+	for path, src := range out.Sources {
+		ct.Sources[path] = src.Content
+		if ct.License == "" {
+			ct.License = spdx(src.Content)
+		}
+	}
+	if p := out.ProxyResolution; p != nil && p.IsProxy {
+		ct.Proxy = true
+		if len(p.Implementations) > 0 {
+			if a, err := evm.ParseAddress(p.Implementations[0].Address); err == nil {
+				ct.Implementation = a.Hex()
+			}
+		}
+	}
+	ct.Files = files(ct.Sources)
+	return true, nil
+}
+
+// fromExplorer fills ct from an Etherscan-compatible getsourcecode call,
+// reporting whether the contract is verified there.
+func (c *Cache) fromExplorer(ctx context.Context, api string, ct *Contract) (bool, error) {
+	u, err := url.Parse(api)
+	if err != nil {
+		return false, err
+	}
+	q := u.Query()
+	q.Set("module", "contract")
+	q.Set("action", "getsourcecode")
+	q.Set("address", ct.Address)
+	u.RawQuery = q.Encode()
+	var out struct {
+		Status  string          `json:"status"`
+		Message string          `json:"message"`
+		Result  json.RawMessage `json:"result"` // an array, or a string on error
+	}
+	if _, err := c.getJSON(ctx, u.String(), &out); err != nil {
+		return false, err
+	}
+	var results []struct {
+		SourceCode      string `json:"SourceCode"`
+		ABI             string `json:"ABI"`
+		ContractName    string `json:"ContractName"`
+		CompilerVersion string `json:"CompilerVersion"`
+		LicenseType     string `json:"LicenseType"`
+		Proxy           string `json:"Proxy"`
+		Implementation  string `json:"Implementation"`
+	}
+	if out.Status != "1" || json.Unmarshal(out.Result, &results) != nil {
+		var msg string
+		if json.Unmarshal(out.Result, &msg) != nil || msg == "" {
+			msg = out.Message
+		}
+		return false, errors.New(msg)
+	}
+	if len(results) == 0 || results[0].SourceCode == "" || !json.Valid([]byte(results[0].ABI)) {
+		return false, nil // "Contract source code not verified"
+	}
+	r := results[0]
+	ct.Verified, ct.Source = true, host(api)
+	ct.ABI = json.RawMessage(r.ABI)
+	ct.Name, ct.Compiler = r.ContractName, r.CompilerVersion
+	ct.Language = "Solidity"
+	if strings.HasPrefix(r.CompilerVersion, "vyper") {
+		ct.Language = "Vyper"
+	}
+	if r.LicenseType != "" && r.LicenseType != "None" {
+		ct.License = r.LicenseType
+	}
+	ct.Proxy = r.Proxy == "1"
+	if a, err := evm.ParseAddress(r.Implementation); err == nil && ct.Proxy {
+		ct.Implementation = a.Hex()
+	}
+	ct.Sources = explorerSources(r.SourceCode, r.ContractName)
+	ct.Files = files(ct.Sources)
+	return true, nil
+}
+
+// explorerSources reads an explorer's SourceCode field: a single file, a
+// map of files, or compiler standard JSON input wrapped in an extra pair
+// of braces.
+func explorerSources(code, name string) map[string]string {
+	if strings.HasPrefix(code, "{{") && strings.HasSuffix(code, "}}") {
+		code = code[1 : len(code)-1]
+	}
+	var input struct {
+		Sources map[string]struct {
+			Content string `json:"content"`
+		} `json:"sources"`
+	}
+	if json.Unmarshal([]byte(code), &input) == nil && len(input.Sources) > 0 {
+		out := map[string]string{}
+		for path, src := range input.Sources {
+			out[path] = src.Content
+		}
+		return out
+	}
+	var flat map[string]struct {
+		Content string `json:"content"`
+	}
+	if json.Unmarshal([]byte(code), &flat) == nil && len(flat) > 0 {
+		out := map[string]string{}
+		for path, src := range flat {
+			out[path] = src.Content
+		}
+		return out
+	}
+	return map[string]string{name + ".sol": code}
+}
+
+// getJSON fetches u and decodes its JSON body into out, returning the
+// status too.
+func (c *Cache) getJSON(ctx context.Context, u string, out any) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err // the URL may hold an API key
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponse+1))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if len(data) > maxResponse {
+		return resp.StatusCode, fmt.Errorf("answer is larger than %d bytes", maxResponse)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return resp.StatusCode, fmt.Errorf("unexpected answer: %w", err)
+	}
+	return resp.StatusCode, nil
+}
+
+func (c *Cache) read(name string) (Contract, bool) {
+	data, err := os.ReadFile(filepath.Join(c.dir, name))
+	if err != nil {
+		return Contract{}, false
+	}
+	var ct Contract
+	if json.Unmarshal(data, &ct) != nil {
+		return Contract{}, false
+	}
+	return ct, true
+}
+
+// write saves ct through a temporary file, so a reader never sees half of
+// it.
+func (c *Cache) write(name string, ct Contract) error {
+	data, err := json.Marshal(ct)
+	if err != nil {
+		return fmt.Errorf("marshal contract: %w", err)
+	}
+	if err := atomicfile.Write(filepath.Join(c.dir, name), data); err != nil {
+		return fmt.Errorf("write contract: %w", err)
+	}
+	return nil
+}
+
+func fileName(chainID uint64, addr evm.Address) string {
+	return strconv.FormatUint(chainID, 10) + "-" + strings.ToLower(addr.Hex()) + ".json"
+}
+
+func files(sources map[string]string) []string {
+	out := make([]string, 0, len(sources))
+	for path := range sources {
+		out = append(out, path)
+	}
+	slices.Sort(out)
+	return out
+}
+
+// spdx returns the SPDX license identifier a source file declares.
+func spdx(src string) string {
+	_, rest, ok := strings.Cut(src, "SPDX-License-Identifier:")
+	if !ok {
+		return ""
+	}
+	line, _, _ := strings.Cut(rest, "\n")
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(line), "*/"))
+}
+
+// host names an explorer API by its host, leaving out any key.
+func host(api string) string {
+	u, err := url.Parse(api)
+	if err != nil {
+		return api
+	}
+	return u.Host
+}
@@ -0,0 +1,349 @@
+// Package verify checks the wallet's stores for corruption: files that no
+// longer parse or are readable by others, addresses that don't match what
+// they are derived from, records that point at records that don't exist,
+// and sends whose journal entry contradicts their signed transaction or
+// their receipt.
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/primal-host/wallet/internal/endpoint"
+	"github.com/primal-host/wallet/internal/evm"
+	"github.com/primal-host/wallet/internal/journal"
+	"github.com/primal-host/wallet/internal/schedule"
+	"github.com/primal-host/wallet/internal/signer"
+	"github.com/primal-host/wallet/internal/user"
+	"github.com/primal-host/wallet/internal/vault"
+)
+
+// File is a store's file on disk.
+type File struct {
+	Name   string // store name, e.g. "journal"
+	Path   string
+	Secret bool // must not be readable by other users
+}
+
+// Stores are what Run checks. Nil stores are skipped.
+type Stores struct {
+	Files     []File
+	Endpoints *endpoint.Store
+	Accounts  *signer.Store
+	Vault     *vault.Vault
+	Journal   *journal.Store
+	Schedules *schedule.Store
+	Users     *user.Store
+	Tokens    *user.Tokens
+	Devices   *user.Devices
+}
+
+// Problem is one inconsistency.
+type Problem struct {
+	Store   string `json:"store"`
+	Item    string `json:"item,omitempty"` // record ID, address, or hash
+	Message string `json:"message"`
+}
+
+// Report is the outcome of a check.
+type Report struct {
+	Checked  map[string]int `json:"checked"` // records checked per store
+	Skipped  []string       `json:"skipped"` // checks that couldn't run, and why
+	Problems []Problem      `json:"problems"`
+}
+
+// OK reports whether no problems were found.
+func (r *Report) OK() bool { return len(r.Problems) == 0 }
+
+func (r *Report) problem(store, item, format string, args ...any) {
+	r.Problems = append(r.Problems, Problem{Store: store, Item: item, Message: fmt.Sprintf(format, args...)})
+}
+
+// Run checks the stores. With receipts, every mined send in the journal is
+// also checked against its receipt on the endpoint it went out through.
+func Run(ctx context.Context, st Stores, receipts bool) *Report {
+	r := &Report{Checked: map[string]int{}, Skipped: []string{}, Problems: []Problem{}}
+	checkFiles(r, st.Files)
+	if st.Endpoints != nil {
+		checkEndpoints(r, st.Endpoints)
+	}
+	if st.Accounts != nil {
+		checkAccounts(r, st.Accounts)
+	}
+	if st.Vault != nil {
+		checkVault(r, st.Vault)
+	}
+	if st.Journal != nil {
+		checkJournal(ctx, r, st.Journal, st.Endpoints, receipts)
+	}
+	if st.Schedules != nil {
+		checkSchedules(r, st.Schedules, st.Endpoints, st.Accounts, st.Vault)
+	}
+	if st.Users != nil {
+		checkUsers(r, st.Users, st.Tokens, st.Devices)
+	}
+	return r
+}
+
+// checkFiles rereads each file, which must still be valid JSON, and checks
+// that secret ones are private. Missing files are stores never written.
+func checkFiles(r *Report, files []File) {
+	for _, f := range files {
+		info, err := os.Stat(f.Path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		r.Checked["files"]++
+		if err != nil {
+			r.problem(f.Name, f.Path, "%v", err)
+			continue
+		}
+		data, err := os.ReadFile(f.Path)
+		if err != nil {
+			r.problem(f.Name, f.Path, "%v", err)
+			continue
+		}
+		if !json.Valid(data) {
+			r.problem(f.Name, f.Path, "not valid JSON")
+		}
+		if f.Secret && info.Mode().Perm()&0077 != 0 {
+			r.problem(f.Name, f.Path, "readable by other users (mode %04o); expected 0600", info.Mode().Perm())
+		}
+	}
+}
+
+func checkEndpoints(r *Report, store *endpoint.Store) {
+	seen := map[string]bool{}
+	for _, ep := range append(store.List(), store.Trash()...) {
+		r.Checked["endpoints"]++
+		if seen[ep.ID] {
+			r.problem("endpoints", ep.ID, "duplicate endpoint ID")
+		}
+		seen[ep.ID] = true
+		if _, ok := store.Assets().Get(ep.Asset); !ok {
+			r.problem("endpoints", ep.ID, "asset %q is not in the registry", ep.Asset)
+		}
+		if u, err := url.Parse(ep.URL); err != nil || u.Host == "" {
+			r.problem("endpoints", ep.ID, "invalid URL %q", ep.URL)
+		}
+	}
+}
+
+// checkAccounts checks that every address parses, with a valid checksum if
+// it is in mixed case, and appears once.
+func checkAccounts(r *Report, accounts *signer.Store) {
+	seen := map[string]bool{}
+	for _, a := range append(accounts.List(), accounts.Trash()...) {
+		r.Checked["accounts"]++
+		if _, err := evm.ParseAddress(a.Address); err != nil {
+			r.problem("accounts", a.Address, "%v", err)
+		}
+		key := strings.ToLower(a.Address)
+		if seen[key] {
+			r.problem("accounts", a.Address, "duplicate account")
+		}
+		seen[key] = true
+	}
+}
+
+func checkVault(r *Report, v *vault.Vault) {
+	st := v.Status()
+	if !st.Initialized {
+		return
+	}
+	for _, k := range st.Keys {
+		r.Checked["vault"]++
+		if a, err := evm.ParseAddress(k.Address); err != nil {
+			r.problem("vault", k.Address, "%v", err)
+		} else if a.Hex() != k.Address {
+			r.problem("vault", k.Address, "not in checksummed form (%s)", a.Hex())
+		}
+	}
+	for _, p := range v.Verify() {
+		r.problem("vault", "", "%s", p)
+	}
+	if !st.Unlocked {
+		r.Skipped = append(r.Skipped, "vault is locked; keys were not decrypted to re-derive their addresses")
+	}
+}
+
+// checkJournal decodes the signed transaction kept with each send and checks
+// that its hash, sender, recipient, value, nonce, and chain match the
+// intent. With receipts, mined sends are looked up on their endpoint.
+func checkJournal(ctx context.Context, r *Report, j *journal.Store, endpoints *endpoint.Store, receipts bool) {
+	for _, in := range j.List("") {
+		r.Checked["journal"]++
+		switch in.Stage {
+		case journal.StageSent, journal.StageMined, journal.StageConfirmed, journal.StageReverted:
+			if in.Hash == "" {
+				r.problem("journal", in.ID, "%s without a transaction hash", in.Stage)
+			}
+		}
+		if in.Raw != "" {
+			checkRaw(r, in)
+		}
+		if receipts && (in.Stage == journal.StageConfirmed || in.Stage == journal.StageReverted) {
+			checkReceipt(ctx, r, in, endpoints)
+		}
+	}
+	if !receipts {
+		r.Skipped = append(r.Skipped, "receipts were not checked")
+	}
+}
+
+func checkRaw(r *Report, in journal.Intent) {
+	raw, err := evm.DecodeHex(in.Raw)
+	if err != nil {
+		r.problem("journal", in.ID, "raw transaction: %v", err)
+		return
+	}
+	tx, sig, err := evm.DecodeSignedTx(raw)
+	if err != nil {
+		r.problem("journal", in.ID, "raw transaction: %v", err)
+		return
+	}
+	if hash := evm.EncodeHex(tx.Hash(sig)); in.Hash != "" && !strings.EqualFold(hash, in.Hash) {
+		r.problem("journal", in.ID, "hash %s doesn't match the signed transaction's %s", in.Hash, hash)
+	}
+	if sender, err := tx.Sender(sig); err != nil {
+		r.problem("journal", in.ID, "recover sender: %v", err)
+	} else if !strings.EqualFold(sender.Hex(), in.From) {
+		r.problem("journal", in.ID, "from %s, but the signed transaction is from %s", in.From, sender.Hex())
+	}
+	to := ""
+	if tx.To != nil {
+		to = tx.To.Hex()
+	}
+	if !strings.EqualFold(to, in.To) {
+		r.problem("journal", in.ID, "to %q, but the signed transaction is to %q", in.To, to)
+	}
+	if !sameQuantity(in.Value, tx.Value) {
+		r.problem("journal", in.ID, "value %s, but the signed transaction sends %s", in.Value, evm.EncodeQuantity(tx.Value))
+	}
+	if !sameQuantity(in.Nonce, new(big.Int).SetUint64(tx.Nonce)) {
+		r.problem("journal", in.ID, "nonce %s, but the signed transaction has %d", in.Nonce, tx.Nonce)
+	}
+	if in.ChainID != "" && !sameQuantity(in.ChainID, tx.ChainID) {
+		r.problem("journal", in.ID, "chain %s, but the signed transaction is for %s", in.ChainID, evm.EncodeQuantity(tx.ChainID))
+	}
+}
+
+func sameQuantity(hex string, n *big.Int) bool {
+	q, err := evm.ParseQuantity(hex)
+	return err == nil && n != nil && q.Cmp(n) == 0
+}
+
+func checkReceipt(ctx context.Context, r *Report, in journal.Intent, endpoints *endpoint.Store) {
+	if endpoints == nil || in.Hash == "" {
+		return
+	}
+	ep, ok := endpoints.Get(in.Endpoint)
+	if !ok {
+		r.problem("journal", in.ID, "endpoint %s no longer exists; receipt not checked", in.Endpoint)
+		return
+	}
+	result, err := endpoint.RPCCall(ctx, ep, "eth_getTransactionReceipt", []any{in.Hash})
+	if err != nil {
+		r.problem("journal", in.ID, "fetch receipt from %s: %v", ep.ID, err)
+		return
+	}
+	var receipt *struct {
+		Status      string `json:"status"`
+		BlockNumber string `json:"blockNumber"`
+		BlockHash   string `json:"blockHash"`
+	}
+	if err := json.Unmarshal(result, &receipt); err != nil {
+		r.problem("journal", in.ID, "parse receipt: %v", err)
+		return
+	}
+	if receipt == nil {
+		r.problem("journal", in.ID, "%s, but %s has no receipt for %s", in.Stage, ep.ID, in.Hash)
+		return
+	}
+	stage := journal.StageConfirmed
+	if receipt.Status == "0x0" {
+		stage = journal.StageReverted
+	}
+	if stage != in.Stage {
+		r.problem("journal", in.ID, "%s, but the receipt says %s", in.Stage, stage)
+	}
+	if in.Block != "" && !strings.EqualFold(in.Block, receipt.BlockNumber) {
+		r.problem("journal", in.ID, "mined in block %s, but the receipt says %s", in.Block, receipt.BlockNumber)
+	} else if in.BlockHash != "" && !strings.EqualFold(in.BlockHash, receipt.BlockHash) {
+		r.problem("journal", in.ID, "mined in block %s, but the receipt says %s; a reorg took it away after it was confirmed", in.BlockHash, receipt.BlockHash)
+	}
+}
+
+// checkSchedules checks that each schedule still parses and that its
+// endpoint and sending account exist.
+func checkSchedules(r *Report, schedules *schedule.Store, endpoints *endpoint.Store, accounts *signer.Store, v *vault.Vault) {
+	for _, sc := range append(schedules.List(), schedules.Trash()...) {
+		r.Checked["schedules"]++
+		c := sc
+		if err := schedule.Validate(&c); err != nil {
+			r.problem("schedules", sc.ID, "%v", err)
+		}
+		if endpoints != nil && sc.DeletedAt == nil {
+			if _, ok := endpoints.Get(sc.Endpoint); !ok {
+				r.problem("schedules", sc.ID, "endpoint %s doesn't exist", sc.Endpoint)
+			}
+		}
+		if sc.DeletedAt == nil && !signable(sc.From, accounts, v) {
+			r.problem("schedules", sc.ID, "from %s is neither a vault key nor a signer account", sc.From)
+		}
+	}
+}
+
+func signable(address string, accounts *signer.Store, v *vault.Vault) bool {
+	if v != nil && v.Has(address) {
+		return true
+	}
+	if accounts != nil {
+		if _, ok := accounts.Get(address); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkUsers checks that user names are unique and that every API token and
+// paired device belongs to a user who still exists.
+func checkUsers(r *Report, users *user.Store, tokens *user.Tokens, devices *user.Devices) {
+	list, err := users.List()
+	if err != nil {
+		r.problem("users", "", "%v", err)
+		return
+	}
+	ids, names := map[string]bool{}, map[string]bool{}
+	for _, u := range list {
+		r.Checked["users"]++
+		if ids[u.ID] {
+			r.problem("users", u.ID, "duplicate user ID")
+		}
+		if names[strings.ToLower(u.Name)] {
+			r.problem("users", u.ID, "duplicate user name %q", u.Name)
+		}
+		ids[u.ID], names[strings.ToLower(u.Name)] = true, true
+	}
+	if tokens != nil {
+		for _, t := range tokens.List("") {
+			r.Checked["tokens"]++
+			if !ids[t.User] {
+				r.problem("tokens", t.ID, "token %s belongs to user %s, who doesn't exist", t.Name, t.User)
+			}
+		}
+	}
+	if devices != nil {
+		for _, d := range devices.List("") {
+			r.Checked["devices"]++
+			if !ids[d.User] {
+				r.problem("devices", d.ID, "device %s belongs to user %s, who doesn't exist", d.Name, d.User)
+			}
+		}
+	}
+}
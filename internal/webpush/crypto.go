@@ -0,0 +1,176 @@
+package webpush
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// recordSize is the aes128gcm record size; a notification is one record.
+const recordSize = 4096
+
+// tokenLifetime is how long a VAPID token is valid; push services accept
+// up to 24 hours.
+const tokenLifetime = 12 * time.Hour
+
+// vapidKey is the server's application server key pair.
+type vapidKey struct {
+	PublicKey  string `json:"public_key"`  // uncompressed P-256 point, base64url
+	PrivateKey string `json:"private_key"` // P-256 scalar, base64url
+}
+
+func newVAPIDKey() (vapidKey, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return vapidKey{}, err
+	}
+	d, err := priv.Bytes()
+	if err != nil {
+		return vapidKey{}, err
+	}
+	pub, err := priv.PublicKey.Bytes()
+	if err != nil {
+		return vapidKey{}, err
+	}
+	return vapidKey{PublicKey: b64(pub), PrivateKey: b64(d)}, nil
+}
+
+// signer parses the private key and checks it matches the public one.
+func (k vapidKey) signer() (*ecdsa.PrivateKey, error) {
+	d, err := unb64(k.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	priv, err := ecdsa.ParseRawPrivateKey(elliptic.P256(), d)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	if pub, _ := priv.PublicKey.Bytes(); b64(pub) != k.PublicKey {
+		return nil, fmt.Errorf("the VAPID public key doesn't match the private key")
+	}
+	return priv, nil
+}
+
+// authorization returns the Authorization header for a push to endpoint:
+// a VAPID token signed with ES256 for the push service's origin, and the
+// public key.
+func (k vapidKey) authorization(endpoint, subject string, now time.Time) (string, error) {
+	priv, err := k.signer()
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	claims := map[string]any{"aud": u.Scheme + "://" + u.Host, "exp": now.Add(tokenLifetime).Unix()}
+	if subject != "" {
+		claims["sub"] = subject
+	}
+	header, _ := json.Marshal(map[string]string{"typ": "JWT", "alg": "ES256"})
+	payload, _ := json.Marshal(claims)
+	unsigned := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, priv, digest[:])
+	if err != nil {
+		return "", err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return "vapid t=" + unsigned + "." + b64(sig) + ", k=" + k.PublicKey, nil
+}
+
+// decode parses the browser's public key and authentication secret.
+func (k Keys) decode() (*ecdh.PublicKey, []byte, error) {
+	raw, err := unb64(k.P256dh)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid keys.p256dh: %w", err)
+	}
+	pub, err := ecdh.P256().NewPublicKey(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid keys.p256dh: %w", err)
+	}
+	auth, err := unb64(k.Auth)
+	if err != nil || len(auth) != 16 {
+		return nil, nil, fmt.Errorf("invalid keys.auth: want 16 bytes, base64url")
+	}
+	return pub, auth, nil
+}
+
+// encrypt encrypts payload for a browser as one aes128gcm record (RFC
+// 8188), keyed as RFC 8291 describes: an ephemeral key agreed with the
+// browser's key, mixed with its authentication secret.
+func encrypt(keys Keys, payload []byte) ([]byte, error) {
+	uaPub, auth, err := keys.decode()
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) > recordSize-16-1-86 {
+		return nil, fmt.Errorf("payload too large for web push")
+	}
+	asPriv, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := asPriv.ECDH(uaPub)
+	if err != nil {
+		return nil, err
+	}
+	asPub := asPriv.PublicKey().Bytes()
+	keyInfo := "WebPush: info\x00" + string(uaPub.Bytes()) + string(asPub)
+	ikm, err := hkdf.Key(sha256.New, secret, auth, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// The header: salt, record size, and the key the browser agrees with.
+	out := make([]byte, 0, 16+4+1+len(asPub)+len(payload)+1+gcm.Overhead())
+	out = append(out, salt...)
+	out = binary.BigEndian.AppendUint32(out, recordSize)
+	out = append(out, byte(len(asPub)))
+	out = append(out, asPub...)
+	// 0x02 marks the last (and only) record.
+	plain := append(append([]byte{}, payload...), 0x02)
+	return gcm.Seal(out, nonce, plain, nil), nil
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// unb64 decodes base64url with or without padding, as browsers differ.
+func unb64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(strings.TrimSpace(s), "="))
+}
@@ -0,0 +1,329 @@
+// Package webpush sends notifications to browsers through the Web Push
+// protocol, so a dashboard can notify its user with the tab closed. The
+// server's VAPID key pair (RFC 8292) and the browsers' push subscriptions
+// are kept in one JSON file; each notification is encrypted for its
+// subscription (RFC 8291) and POSTed to the subscription's push service.
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/primal-host/wallet/internal/notify"
+)
+
+// sendTimeout bounds one delivery.
+const sendTimeout = 15 * time.Second
+
+// ttl is how long a push service keeps a notification for a browser that
+// is offline, in seconds.
+const ttl = "86400"
+
+// Keys are a subscription's encryption keys, as the browser's
+// PushSubscription.toJSON gives them.
+type Keys struct {
+	P256dh string `json:"p256dh"` // the browser's P-256 public key, base64url
+	Auth   string `json:"auth"`   // authentication secret, base64url
+}
+
+// Subscription is one browser that receives notifications.
+type Subscription struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name,omitempty"` // e.g. the browser's user agent
+	Endpoint string   `json:"endpoint"`       // the push service URL; List shows only its origin
+	Keys     Keys     `json:"keys,omitzero"`
+	Kinds    []string `json:"kinds,omitempty"` // the notification kinds it gets; all when empty
+	By       string   `json:"by,omitempty"`    // who subscribed
+
+	LastSentAt *time.Time `json:"last_sent_at,omitempty"`
+	LastError  string     `json:"last_error,omitempty"` // why the last delivery failed
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Wants reports whether sub gets notifications of kind.
+func (sub Subscription) Wants(kind string) bool {
+	return len(sub.Kinds) == 0 || slices.Contains(sub.Kinds, kind)
+}
+
+// Redacted returns sub without its keys, and its endpoint cut to the push
+// service's origin: the full endpoint is enough to push to the browser.
+func (sub Subscription) Redacted() Subscription {
+	if u, err := url.Parse(sub.Endpoint); err == nil {
+		sub.Endpoint = u.Scheme + "://" + u.Host
+	}
+	sub.Keys = Keys{}
+	sub.Kinds = slices.Clone(sub.Kinds)
+	return sub
+}
+
+// file is the store's JSON file.
+type file struct {
+	VAPID         vapidKey       `json:"vapid"`
+	Subscriptions []Subscription `json:"subscriptions"` // oldest first
+}
+
+// Store keeps the VAPID key and subscriptions in a JSON file.
+type Store struct {
+	mu      sync.Mutex
+	data    file
+	path    string
+	subject string
+}
+
+// NewStore loads the VAPID key and subscriptions from a JSON file. If the
+// file doesn't exist, generates a key and saves it, so browsers subscribed
+// to this server stay subscribed across restarts. subject is the contact
+// push services see in the VAPID token, a mailto: or https: URL.
+func NewStore(path, subject string) (*Store, error) {
+	s := &Store{path: path, subject: subject, data: file{Subscriptions: []Subscription{}}}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read web push: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &s.data); err != nil {
+			return nil, fmt.Errorf("parse web push: %w", err)
+		}
+	}
+	if s.data.VAPID.PrivateKey == "" {
+		if s.data.VAPID, err = newVAPIDKey(); err != nil {
+			return nil, err
+		}
+		if err := s.save(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := s.data.VAPID.signer(); err != nil {
+		return nil, fmt.Errorf("web push: %w", err)
+	}
+	return s, nil
+}
+
+// PublicKey returns the VAPID public key browsers subscribe with, the
+// uncompressed point in base64url.
+func (s *Store) PublicKey() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.VAPID.PublicKey
+}
+
+// List returns the subscriptions oldest first, redacted.
+func (s *Store) List() []Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Subscription, len(s.data.Subscriptions))
+	for i, sub := range s.data.Subscriptions {
+		out[i] = sub.Redacted()
+	}
+	return out
+}
+
+// Subscribe validates sub and stores it. A browser subscribing again with
+// the same endpoint replaces its subscription and keeps its ID.
+func (s *Store) Subscribe(sub Subscription) (Subscription, error) {
+	sub.Name = strings.TrimSpace(sub.Name)
+	sub.Endpoint = strings.TrimSpace(sub.Endpoint)
+	if u, err := url.Parse(sub.Endpoint); err != nil || u.Scheme != "https" || u.Host == "" {
+		return Subscription{}, fmt.Errorf("invalid endpoint: a push subscription's endpoint is an https URL")
+	}
+	if _, _, err := sub.Keys.decode(); err != nil {
+		return Subscription{}, err
+	}
+	var kinds []string
+	for _, k := range sub.Kinds {
+		if k = strings.TrimSpace(k); k != "" && !slices.Contains(kinds, k) {
+			kinds = append(kinds, k)
+		}
+	}
+	sub.Kinds = kinds
+	sub.LastSentAt, sub.LastError = nil, ""
+	sub.CreatedAt = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.data.Subscriptions {
+		if cur := &s.data.Subscriptions[i]; cur.Endpoint == sub.Endpoint {
+			old := *cur
+			sub.ID = old.ID
+			*cur = sub
+			if err := s.save(); err != nil {
+				*cur = old
+				return Subscription{}, err
+			}
+			return sub.Redacted(), nil
+		}
+	}
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return Subscription{}, err
+	}
+	sub.ID = hex.EncodeToString(b)
+	old := s.data.Subscriptions
+	s.data.Subscriptions = append(old[:len(old):len(old)], sub)
+	if err := s.save(); err != nil {
+		s.data.Subscriptions = old
+		return Subscription{}, err
+	}
+	return sub.Redacted(), nil
+}
+
+// Delete removes a subscription.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.deleteLocked(id) {
+		return fmt.Errorf("subscription %q not found", id)
+	}
+	return s.save()
+}
+
+// Deliver sends n to every subscription that wants its kind, in the
+// background. Failures are logged and recorded on the subscription; one
+// the push service reports gone, because the browser unsubscribed, is
+// removed.
+func (s *Store) Deliver(n notify.Notification) {
+	s.mu.Lock()
+	var to []Subscription
+	for _, sub := range s.data.Subscriptions {
+		if sub.Wants(n.Kind) {
+			to = append(to, sub)
+		}
+	}
+	s.mu.Unlock()
+	for _, sub := range to {
+		go func(sub Subscription) {
+			if err := s.send(sub, n); err != nil {
+				slog.Error("web push failed", "subsystem", "notify", "subscription", sub.ID, "error", err)
+			}
+		}(sub)
+	}
+}
+
+// Test sends a test notification to the subscription id now.
+func (s *Store) Test(id string) error {
+	s.mu.Lock()
+	sub := s.findLocked(id)
+	if sub == nil {
+		s.mu.Unlock()
+		return fmt.Errorf("subscription %q not found", id)
+	}
+	cp := *sub
+	s.mu.Unlock()
+	return s.send(cp, notify.Notification{Kind: notify.KindTest, Message: "Browser notifications are working.", At: time.Now().UTC()})
+}
+
+// errGone reports a subscription the push service no longer knows.
+var errGone = errors.New("the browser unsubscribed")
+
+// send pushes n to sub and records the outcome.
+func (s *Store) send(sub Subscription, n notify.Notification) error {
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	err := s.push(ctx, sub, n)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == errGone {
+		slog.Info("web push subscription removed", "subsystem", "notify", "subscription", sub.ID, "reason", err)
+		s.deleteLocked(sub.ID)
+	} else if cur := s.findLocked(sub.ID); cur != nil {
+		if err != nil {
+			cur.LastError = err.Error()
+		} else {
+			now := time.Now().UTC()
+			cur.LastSentAt, cur.LastError = &now, ""
+		}
+	}
+	if serr := s.save(); serr != nil {
+		slog.Error("web push save failed", "subsystem", "notify", "error", serr)
+	}
+	return err
+}
+
+// push encrypts n for sub and POSTs it to the push service.
+func (s *Store) push(ctx context.Context, sub Subscription, n notify.Notification) error {
+	payload, _ := json.Marshal(map[string]any{"title": n.Title(), "body": n.Message, "kind": n.Kind, "at": n.At})
+	body, err := encrypt(sub.Keys, payload)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	key := s.data.VAPID
+	s.mu.Unlock()
+	auth, err := key.authorization(sub.Endpoint, s.subject, time.Now())
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", ttl)
+	req.Header.Set("Urgency", "high")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return errGone
+	case resp.StatusCode/100 != 2:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("push service: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// findLocked finds a subscription by ID. Must be called with mu held.
+func (s *Store) findLocked(id string) *Subscription {
+	for i := range s.data.Subscriptions {
+		if s.data.Subscriptions[i].ID == id {
+			return &s.data.Subscriptions[i]
+		}
+	}
+	return nil
+}
+
+// deleteLocked removes a subscription by ID and reports whether it was
+// there. Must be called with mu held.
+func (s *Store) deleteLocked(id string) bool {
+	for i := range s.data.Subscriptions {
+		if s.data.Subscriptions[i].ID == id {
+			s.data.Subscriptions = append(s.data.Subscriptions[:i:i], s.data.Subscriptions[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// save writes the key and subscriptions to disk, readable only by the
+// owner. Must be called with mu held, or before the store is shared.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal web push: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		return fmt.Errorf("write web push: %w", err)
+	}
+	return nil
+}